@@ -2,7 +2,6 @@ package main
 
 import (
 	"log"
-	"net/http"
 
 	"animate-server/internal"
 
@@ -17,6 +16,29 @@ func main() {
 	if _, err := internal.JWTSecret(); err != nil {
 		log.Fatalf("Invalid JWT_SECRET_KEY: %v", err)
 	}
+	if ring, err := internal.MoodKeyring(); err != nil {
+		log.Fatalf("Invalid mood encryption keys: %v", err)
+	} else if ring == nil {
+		log.Println("Warning: MOOD_ENCRYPTION_KEYS is not set, moods are stored unencrypted")
+	}
+	if cipher, err := internal.EmailEncryption(); err != nil {
+		log.Fatalf("Invalid email encryption keys: %v", err)
+	} else if cipher == nil {
+		log.Println("Warning: EMAIL_ENCRYPTION_KEYS is not set, emails are stored unencrypted")
+	}
+	if _, err := internal.TenantRegions(); err != nil {
+		log.Fatalf("Invalid data residency configuration: %v", err)
+	}
+	if err := internal.LoadLogRedactionRules(); err != nil {
+		log.Fatalf("Invalid log redaction rules: %v", err)
+	}
+	serverConfig, err := internal.ServerConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+	if _, err := internal.GRPCConfigFromEnv(); err != nil {
+		log.Fatalf("Invalid gRPC configuration: %v", err)
+	}
 
 	// Initialize the PostgreSQL database
 	if err := internal.InitDB(); err != nil {
@@ -27,9 +49,8 @@ func main() {
 	// Set up the router with Gorilla Mux
 	router := internal.SetupRouter()
 
-	// Start the server on port 8080
-	log.Println("Animation Server starting on port 8080...")
-	if err := http.ListenAndServe(":8080", router); err != nil {
+	// Start the server on port 8080, or on 80/443 when serving HTTPS directly
+	if err := internal.ListenAndServe(serverConfig, router); err != nil {
 		log.Fatalf("could not start server: %v", err)
 	}
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"animate-server/internal"
+
+	"github.com/joho/godotenv"
+)
+
+// contract-check generates a sketch for each description in a corpus and checks that the
+// output passes validation. It is meant to run nightly from cron or CI and exits with
+// status 1 when the pass rate falls below CONTRACT_MIN_PASS_RATE.
+func main() {
+	mode := flag.String("mode", internal.ContractModeMock, "mock for a canned sketch, live for real Claude calls")
+	corpusPath := flag.String("corpus", "", "file with one description per line (defaults to the built-in corpus)")
+	maxCalls := flag.Int("max-calls", -1, "maximum generations to run, 0 for no limit (defaults to CONTRACT_MAX_CALLS)")
+	save := flag.Bool("save", true, "store the run in the database for trend reporting")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found or could not be loaded")
+	}
+
+	corpus, err := internal.LoadContractCorpus(*corpusPath)
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+
+	var generate internal.AnimationGenerator
+	switch *mode {
+	case internal.ContractModeMock:
+		generate = internal.MockAnimationGenerator
+	case internal.ContractModeLive:
+		apiKey := internal.GetAPIKey("CLAUDE_API_KEY")
+		if apiKey == "" {
+			log.Fatal("CLAUDE_API_KEY is required for live contract checks")
+		}
+		generate = internal.ClaudeAnimationGenerator(apiKey)
+	default:
+		log.Fatalf("Unknown mode %q", *mode)
+	}
+
+	if *maxCalls < 0 {
+		*maxCalls = internal.ContractMaxCalls()
+	}
+
+	ctx := context.Background()
+	report := internal.RunContractChecks(ctx, *mode, corpus, generate, *maxCalls)
+
+	if *save {
+		if err := internal.InitDB(); err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		store := internal.NewPostgresStore()
+		if report.ID, err = store.SaveContractRun(ctx, report); err != nil {
+			log.Fatalf("Failed to save contract run: %v", err)
+		}
+		if previous, err := store.GetContractRuns(ctx, 30); err == nil {
+			for _, run := range internal.WithContractTrend(previous) {
+				if run.ID == report.ID {
+					report.Change = run.Change
+				}
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	log.Println("Contract check " + report.Summary())
+	if report.PassRate < internal.ContractMinPassRate() {
+		log.Printf("Pass rate is below the minimum of %.0f%%", internal.ContractMinPassRate())
+		os.Exit(1)
+	}
+}
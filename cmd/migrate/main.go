@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"animate-server/internal"
+
+	"github.com/joho/godotenv"
+)
+
+// migrate applies or reverts the schema migrations embedded in the server.
+//
+//	migrate up             apply all pending migrations
+//	migrate down [-steps]  revert the most recent migrations (1 by default)
+//	migrate status         list migrations and when they were applied
+//	migrate encrypt-moods  seal plain text moods and re-wrap older ones under the active key
+//	migrate encrypt-emails seal plain text emails and re-wrap older ones under the active key
+//	migrate embed-animations embed descriptions that have no embedding from EMBEDDING_MODEL
+//	migrate index-animations upsert every animation into the SEARCH_BACKEND index
+func main() {
+	steps := flag.Int("steps", 1, "number of migrations to revert with down")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate [-steps n] up|down|status|encrypt-moods|encrypt-emails|embed-animations|index-animations")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found or could not be loaded")
+	}
+	if err := internal.OpenDB(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// Every data region holds the full schema, so each command runs against all of them
+	ctx := context.Background()
+	var run func(ctx context.Context, region string) error
+	switch flag.Arg(0) {
+	case "up":
+		run = func(ctx context.Context, region string) error {
+			applied, err := internal.MigrateUp(ctx)
+			log.Printf("Applied %d migrations in the %s region", applied, region)
+			return err
+		}
+	case "down":
+		run = func(ctx context.Context, region string) error {
+			reverted, err := internal.MigrateDown(ctx, *steps)
+			log.Printf("Reverted %d migrations in the %s region", reverted, region)
+			return err
+		}
+	case "status":
+		run = func(ctx context.Context, region string) error {
+			states, err := internal.GetMigrationStatus(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s region\n", region)
+			for _, state := range states {
+				applied := "pending"
+				if state.AppliedAt != nil {
+					applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%04d  %-30s %s\n", state.Version, state.Name, applied)
+			}
+			return nil
+		}
+	case "encrypt-moods":
+		run = func(ctx context.Context, region string) error {
+			updated, err := internal.EncryptMoods(ctx)
+			log.Printf("Encrypted or re-wrapped %d moods in the %s region", updated, region)
+			return err
+		}
+	case "encrypt-emails":
+		run = func(ctx context.Context, region string) error {
+			updated, err := internal.EncryptEmails(ctx)
+			log.Printf("Encrypted or re-wrapped %d emails in the %s region", updated, region)
+			return err
+		}
+	case "embed-animations":
+		embedder, ok := internal.GetEmbedder()
+		if !ok {
+			log.Fatal("EMBEDDING_API_URL is not set")
+		}
+		run = func(ctx context.Context, region string) error {
+			stored, err := internal.BackfillEmbeddings(ctx, internal.NewPostgresStore(), embedder)
+			log.Printf("Embedded %d descriptions in the %s region", stored, region)
+			return err
+		}
+	case "index-animations":
+		index, ok := internal.GetSearchIndex()
+		if !ok {
+			log.Fatal("SEARCH_BACKEND is not set")
+		}
+		run = func(ctx context.Context, region string) error {
+			// Only the primary region is replicated into the index
+			if region != internal.PrimaryDataRegion() {
+				return nil
+			}
+			indexed, err := internal.BackfillSearchIndex(ctx, index)
+			log.Printf("Indexed %d animations in %s", indexed, index.Backend())
+			return err
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := internal.ForEachDataRegion(ctx, run); err != nil {
+		log.Fatalf("%s failed: %v", flag.Arg(0), err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"animate-server/internal"
+)
+
+// replay sends the requests in a replay log recorded with REPLAY_LOG_FILE to a staging server on
+// their recorded schedule, for capacity planning. Only reads are replayed.
+func main() {
+	logPath := flag.String("log", "", "replay log to read")
+	target := flag.String("target", "", "base URL of the server to replay against")
+	speed := flag.Float64("speed", 1, "how many times faster than recorded to replay, 0 for as fast as possible")
+	concurrency := flag.Int("concurrency", 50, "maximum requests in flight")
+	token := flag.String("token", "", "bearer token for requests that were authenticated when recorded")
+	fill := flag.String("fill", "calm", "value sent for redacted query parameters such as the search query")
+	flag.Parse()
+
+	if *logPath == "" || *target == "" {
+		log.Fatal("-log and -target are required")
+	}
+	if *speed < 0 {
+		log.Fatal("-speed must be zero or more")
+	}
+
+	file, err := os.Open(*logPath)
+	if err != nil {
+		log.Fatalf("Failed to open replay log: %v", err)
+	}
+	entries, err := internal.LoadReplayLog(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("Failed to read replay log: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	ids, err := internal.FetchReplayIDs(ctx, client, *target)
+	if err != nil {
+		log.Printf("Warning: Failed to fetch animation IDs from the target, skipping routes with {id}: %v", err)
+	}
+
+	log.Printf("Replaying %d requests against %s at %gx", len(entries), *target, *speed)
+	report := internal.Replay(ctx, entries, internal.ReplayOptions{
+		Target:      *target,
+		Speed:       *speed,
+		Concurrency: *concurrency,
+		Token:       *token,
+		Fill:        *fill,
+		IDs:         ids,
+		Client:      client,
+	})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// IsAdmin reports whether the user ID is listed in the comma-separated ADMIN_USER_IDS variable
+func IsAdmin(userId string) bool {
+	if userId == "" {
+		return false
+	}
+	for _, adminId := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if strings.TrimSpace(adminId) == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminMiddleware only lets administrators through. It must run after AuthMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userId, ok := GetUserIDFromContext(r.Context())
+		if !ok || !IsAdmin(userId) {
+			LogResponse(r.URL.Path, "Admin access denied for user "+userId, nil)
+			EncodeError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProfessionalMiddleware only lets professional accounts through. It must run after AuthMiddleware.
+func (s *Server) ProfessionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userId, _ := GetUserIDFromContext(r.Context())
+		accountType, err := s.store.GetAccountType(r.Context(), userId)
+		if err != nil && err.Error() != "user not found" {
+			LogResponse(r.URL.Path, "Error retrieving account type", err)
+			EncodeError(w, "Error retrieving account type", http.StatusInternalServerError)
+			return
+		}
+		if accountType != AccountProfessional {
+			LogResponse(r.URL.Path, "Professional access denied for user "+userId, nil)
+			EncodeError(w, "Professional account required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,1183 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: animate/v1/animate.proto
+
+package animatepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Animation struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Id          string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Code        string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Description string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	// p5_version, p5_url and p5_integrity are empty for animations not pinned to a p5.js build
+	P5Version   string `protobuf:"bytes,4,opt,name=p5_version,json=p5Version,proto3" json:"p5_version,omitempty"`
+	P5Url       string `protobuf:"bytes,5,opt,name=p5_url,json=p5Url,proto3" json:"p5_url,omitempty"`
+	P5Integrity string `protobuf:"bytes,6,opt,name=p5_integrity,json=p5Integrity,proto3" json:"p5_integrity,omitempty"`
+	// review_status is set on saves held for the workspace owner's review
+	ReviewStatus  string `protobuf:"bytes,7,opt,name=review_status,json=reviewStatus,proto3" json:"review_status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Animation) Reset() {
+	*x = Animation{}
+	mi := &file_animate_v1_animate_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Animation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Animation) ProtoMessage() {}
+
+func (x *Animation) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Animation.ProtoReflect.Descriptor instead.
+func (*Animation) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Animation) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Animation) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Animation) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Animation) GetP5Version() string {
+	if x != nil {
+		return x.P5Version
+	}
+	return ""
+}
+
+func (x *Animation) GetP5Url() string {
+	if x != nil {
+		return x.P5Url
+	}
+	return ""
+}
+
+func (x *Animation) GetP5Integrity() string {
+	if x != nil {
+		return x.P5Integrity
+	}
+	return ""
+}
+
+func (x *Animation) GetReviewStatus() string {
+	if x != nil {
+		return x.ReviewStatus
+	}
+	return ""
+}
+
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Email         string                 `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	LastLogin     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_login,json=lastLogin,proto3" json:"last_login,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_animate_v1_animate_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *User) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *User) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetLastLogin() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastLogin
+	}
+	return nil
+}
+
+type Mood struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	AnimationId          string                 `protobuf:"bytes,1,opt,name=animation_id,json=animationId,proto3" json:"animation_id,omitempty"`
+	AnimationDescription string                 `protobuf:"bytes,2,opt,name=animation_description,json=animationDescription,proto3" json:"animation_description,omitempty"`
+	// mood is "much worse", "worse", "same", "better" or "much better"
+	Mood      string                 `protobuf:"bytes,3,opt,name=mood,proto3" json:"mood,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// follow_ups are set on SaveMood responses, by the mood rules the mood matched
+	FollowUps     []*MoodFollowUp `protobuf:"bytes,5,rep,name=follow_ups,json=followUps,proto3" json:"follow_ups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Mood) Reset() {
+	*x = Mood{}
+	mi := &file_animate_v1_animate_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Mood) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Mood) ProtoMessage() {}
+
+func (x *Mood) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Mood.ProtoReflect.Descriptor instead.
+func (*Mood) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Mood) GetAnimationId() string {
+	if x != nil {
+		return x.AnimationId
+	}
+	return ""
+}
+
+func (x *Mood) GetAnimationDescription() string {
+	if x != nil {
+		return x.AnimationDescription
+	}
+	return ""
+}
+
+func (x *Mood) GetMood() string {
+	if x != nil {
+		return x.Mood
+	}
+	return ""
+}
+
+func (x *Mood) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Mood) GetFollowUps() []*MoodFollowUp {
+	if x != nil {
+		return x.FollowUps
+	}
+	return nil
+}
+
+type MoodFollowUp struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	RuleId int32                  `protobuf:"varint,1,opt,name=rule_id,json=ruleId,proto3" json:"rule_id,omitempty"`
+	// type is "crisis_resources" or "suggest_animations"
+	Type string `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// resources is the JSON an admin configured for crisis_resources follow-ups
+	Resources     string       `protobuf:"bytes,3,opt,name=resources,proto3" json:"resources,omitempty"`
+	Animations    []*Animation `protobuf:"bytes,4,rep,name=animations,proto3" json:"animations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MoodFollowUp) Reset() {
+	*x = MoodFollowUp{}
+	mi := &file_animate_v1_animate_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MoodFollowUp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MoodFollowUp) ProtoMessage() {}
+
+func (x *MoodFollowUp) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MoodFollowUp.ProtoReflect.Descriptor instead.
+func (*MoodFollowUp) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MoodFollowUp) GetRuleId() int32 {
+	if x != nil {
+		return x.RuleId
+	}
+	return 0
+}
+
+func (x *MoodFollowUp) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *MoodFollowUp) GetResources() string {
+	if x != nil {
+		return x.Resources
+	}
+	return ""
+}
+
+func (x *MoodFollowUp) GetAnimations() []*Animation {
+	if x != nil {
+		return x.Animations
+	}
+	return nil
+}
+
+type GenerationJob struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// status is "queued", "generating", "sanitizing", "done" or "failed"
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// code is set once the job is done
+	Code          string                 `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerationJob) Reset() {
+	*x = GenerationJob{}
+	mi := &file_animate_v1_animate_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerationJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerationJob) ProtoMessage() {}
+
+func (x *GenerationJob) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerationJob.ProtoReflect.Descriptor instead.
+func (*GenerationJob) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GenerationJob) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GenerationJob) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *GenerationJob) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *GenerationJob) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *GenerationJob) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *GenerationJob) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type GetAnimationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAnimationRequest) Reset() {
+	*x = GetAnimationRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAnimationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAnimationRequest) ProtoMessage() {}
+
+func (x *GetAnimationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAnimationRequest.ProtoReflect.Descriptor instead.
+func (*GetAnimationRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetAnimationRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListFeedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// limit defaults to 20 and is at most 100
+	Limit         int32 `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset        int32 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	ReducedMotion bool  `protobuf:"varint,3,opt,name=reduced_motion,json=reducedMotion,proto3" json:"reduced_motion,omitempty"`
+	AvoidFlashing bool  `protobuf:"varint,4,opt,name=avoid_flashing,json=avoidFlashing,proto3" json:"avoid_flashing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFeedRequest) Reset() {
+	*x = ListFeedRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFeedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFeedRequest) ProtoMessage() {}
+
+func (x *ListFeedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFeedRequest.ProtoReflect.Descriptor instead.
+func (*ListFeedRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListFeedRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListFeedRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ListFeedRequest) GetReducedMotion() bool {
+	if x != nil {
+		return x.ReducedMotion
+	}
+	return false
+}
+
+func (x *ListFeedRequest) GetAvoidFlashing() bool {
+	if x != nil {
+		return x.AvoidFlashing
+	}
+	return false
+}
+
+type ListFeedResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Animations    []*Animation           `protobuf:"bytes,1,rep,name=animations,proto3" json:"animations,omitempty"`
+	Total         int32                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFeedResponse) Reset() {
+	*x = ListFeedResponse{}
+	mi := &file_animate_v1_animate_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFeedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFeedResponse) ProtoMessage() {}
+
+func (x *ListFeedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFeedResponse.ProtoReflect.Descriptor instead.
+func (*ListFeedResponse) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListFeedResponse) GetAnimations() []*Animation {
+	if x != nil {
+		return x.Animations
+	}
+	return nil
+}
+
+func (x *ListFeedResponse) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+type SaveAnimationRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	UserId      string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Code        string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Description string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	// p5_version pins the animation to a registered p5.js build; empty for the default
+	P5Version     string `protobuf:"bytes,4,opt,name=p5_version,json=p5Version,proto3" json:"p5_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SaveAnimationRequest) Reset() {
+	*x = SaveAnimationRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SaveAnimationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SaveAnimationRequest) ProtoMessage() {}
+
+func (x *SaveAnimationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SaveAnimationRequest.ProtoReflect.Descriptor instead.
+func (*SaveAnimationRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SaveAnimationRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SaveAnimationRequest) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *SaveAnimationRequest) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *SaveAnimationRequest) GetP5Version() string {
+	if x != nil {
+		return x.P5Version
+	}
+	return ""
+}
+
+type GenerateAnimationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Style         string                 `protobuf:"bytes,3,opt,name=style,proto3" json:"style,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerateAnimationRequest) Reset() {
+	*x = GenerateAnimationRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerateAnimationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateAnimationRequest) ProtoMessage() {}
+
+func (x *GenerateAnimationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateAnimationRequest.ProtoReflect.Descriptor instead.
+func (*GenerateAnimationRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GenerateAnimationRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *GenerateAnimationRequest) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *GenerateAnimationRequest) GetStyle() string {
+	if x != nil {
+		return x.Style
+	}
+	return ""
+}
+
+type GetGenerationJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGenerationJobRequest) Reset() {
+	*x = GetGenerationJobRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGenerationJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGenerationJobRequest) ProtoMessage() {}
+
+func (x *GetGenerationJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGenerationJobRequest.ProtoReflect.Descriptor instead.
+func (*GetGenerationJobRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetGenerationJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetGenerationJobRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type GetUserRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetUserRequest) Reset() {
+	*x = GetUserRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUserRequest) ProtoMessage() {}
+
+func (x *GetUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUserRequest.ProtoReflect.Descriptor instead.
+func (*GetUserRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetUserRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListMoodsRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// limit defaults to 20 and is at most 100
+	Limit  int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset int32 `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	// from and to bound when the moods were saved; unset for no bound
+	From          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMoodsRequest) Reset() {
+	*x = ListMoodsRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMoodsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMoodsRequest) ProtoMessage() {}
+
+func (x *ListMoodsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMoodsRequest.ProtoReflect.Descriptor instead.
+func (*ListMoodsRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListMoodsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ListMoodsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListMoodsRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *ListMoodsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ListMoodsRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type ListMoodsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Moods         []*Mood                `protobuf:"bytes,1,rep,name=moods,proto3" json:"moods,omitempty"`
+	Total         int32                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMoodsResponse) Reset() {
+	*x = ListMoodsResponse{}
+	mi := &file_animate_v1_animate_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMoodsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMoodsResponse) ProtoMessage() {}
+
+func (x *ListMoodsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMoodsResponse.ProtoReflect.Descriptor instead.
+func (*ListMoodsResponse) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListMoodsResponse) GetMoods() []*Mood {
+	if x != nil {
+		return x.Moods
+	}
+	return nil
+}
+
+func (x *ListMoodsResponse) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+type SaveMoodRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	AnimationId   string                 `protobuf:"bytes,2,opt,name=animation_id,json=animationId,proto3" json:"animation_id,omitempty"`
+	Mood          string                 `protobuf:"bytes,3,opt,name=mood,proto3" json:"mood,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SaveMoodRequest) Reset() {
+	*x = SaveMoodRequest{}
+	mi := &file_animate_v1_animate_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SaveMoodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SaveMoodRequest) ProtoMessage() {}
+
+func (x *SaveMoodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_animate_v1_animate_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SaveMoodRequest.ProtoReflect.Descriptor instead.
+func (*SaveMoodRequest) Descriptor() ([]byte, []int) {
+	return file_animate_v1_animate_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SaveMoodRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SaveMoodRequest) GetAnimationId() string {
+	if x != nil {
+		return x.AnimationId
+	}
+	return ""
+}
+
+func (x *SaveMoodRequest) GetMood() string {
+	if x != nil {
+		return x.Mood
+	}
+	return ""
+}
+
+var File_animate_v1_animate_proto protoreflect.FileDescriptor
+
+const file_animate_v1_animate_proto_rawDesc = "" +
+	"\n" +
+	"\x18animate/v1/animate.proto\x12\n" +
+	"animate.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xcf\x01\n" +
+	"\tAnimation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x1d\n" +
+	"\n" +
+	"p5_version\x18\x04 \x01(\tR\tp5Version\x12\x15\n" +
+	"\x06p5_url\x18\x05 \x01(\tR\x05p5Url\x12!\n" +
+	"\fp5_integrity\x18\x06 \x01(\tR\vp5Integrity\x12#\n" +
+	"\rreview_status\x18\a \x01(\tR\freviewStatus\"\x83\x01\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x14\n" +
+	"\x05email\x18\x03 \x01(\tR\x05email\x129\n" +
+	"\n" +
+	"last_login\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tlastLogin\"\xe6\x01\n" +
+	"\x04Mood\x12!\n" +
+	"\fanimation_id\x18\x01 \x01(\tR\vanimationId\x123\n" +
+	"\x15animation_description\x18\x02 \x01(\tR\x14animationDescription\x12\x12\n" +
+	"\x04mood\x18\x03 \x01(\tR\x04mood\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x127\n" +
+	"\n" +
+	"follow_ups\x18\x05 \x03(\v2\x18.animate.v1.MoodFollowUpR\tfollowUps\"\x90\x01\n" +
+	"\fMoodFollowUp\x12\x17\n" +
+	"\arule_id\x18\x01 \x01(\x05R\x06ruleId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x1c\n" +
+	"\tresources\x18\x03 \x01(\tR\tresources\x125\n" +
+	"\n" +
+	"animations\x18\x04 \x03(\v2\x15.animate.v1.AnimationR\n" +
+	"animations\"\xd7\x01\n" +
+	"\rGenerationJob\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x12\n" +
+	"\x04code\x18\x03 \x01(\tR\x04code\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"%\n" +
+	"\x13GetAnimationRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x8d\x01\n" +
+	"\x0fListFeedRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x05R\x06offset\x12%\n" +
+	"\x0ereduced_motion\x18\x03 \x01(\bR\rreducedMotion\x12%\n" +
+	"\x0eavoid_flashing\x18\x04 \x01(\bR\ravoidFlashing\"_\n" +
+	"\x10ListFeedResponse\x125\n" +
+	"\n" +
+	"animations\x18\x01 \x03(\v2\x15.animate.v1.AnimationR\n" +
+	"animations\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\"\x84\x01\n" +
+	"\x14SaveAnimationRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x1d\n" +
+	"\n" +
+	"p5_version\x18\x04 \x01(\tR\tp5Version\"k\n" +
+	"\x18GenerateAnimationRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x14\n" +
+	"\x05style\x18\x03 \x01(\tR\x05style\"B\n" +
+	"\x17GetGenerationJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\" \n" +
+	"\x0eGetUserRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xb5\x01\n" +
+	"\x10ListMoodsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x05R\x06offset\x12.\n" +
+	"\x04from\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\"Q\n" +
+	"\x11ListMoodsResponse\x12&\n" +
+	"\x05moods\x18\x01 \x03(\v2\x10.animate.v1.MoodR\x05moods\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\"a\n" +
+	"\x0fSaveMoodRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12!\n" +
+	"\fanimation_id\x18\x02 \x01(\tR\vanimationId\x12\x12\n" +
+	"\x04mood\x18\x03 \x01(\tR\x04mood2\xd1\x04\n" +
+	"\x0eAnimateService\x12F\n" +
+	"\fGetAnimation\x12\x1f.animate.v1.GetAnimationRequest\x1a\x15.animate.v1.Animation\x12E\n" +
+	"\bListFeed\x12\x1b.animate.v1.ListFeedRequest\x1a\x1c.animate.v1.ListFeedResponse\x12H\n" +
+	"\rSaveAnimation\x12 .animate.v1.SaveAnimationRequest\x1a\x15.animate.v1.Animation\x12T\n" +
+	"\x11GenerateAnimation\x12$.animate.v1.GenerateAnimationRequest\x1a\x19.animate.v1.GenerationJob\x12R\n" +
+	"\x10GetGenerationJob\x12#.animate.v1.GetGenerationJobRequest\x1a\x19.animate.v1.GenerationJob\x127\n" +
+	"\aGetUser\x12\x1a.animate.v1.GetUserRequest\x1a\x10.animate.v1.User\x12H\n" +
+	"\tListMoods\x12\x1c.animate.v1.ListMoodsRequest\x1a\x1d.animate.v1.ListMoodsResponse\x129\n" +
+	"\bSaveMood\x12\x1b.animate.v1.SaveMoodRequest\x1a\x10.animate.v1.MoodB#Z!animate-server/internal/animatepbb\x06proto3"
+
+var (
+	file_animate_v1_animate_proto_rawDescOnce sync.Once
+	file_animate_v1_animate_proto_rawDescData []byte
+)
+
+func file_animate_v1_animate_proto_rawDescGZIP() []byte {
+	file_animate_v1_animate_proto_rawDescOnce.Do(func() {
+		file_animate_v1_animate_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_animate_v1_animate_proto_rawDesc), len(file_animate_v1_animate_proto_rawDesc)))
+	})
+	return file_animate_v1_animate_proto_rawDescData
+}
+
+var file_animate_v1_animate_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_animate_v1_animate_proto_goTypes = []any{
+	(*Animation)(nil),                // 0: animate.v1.Animation
+	(*User)(nil),                     // 1: animate.v1.User
+	(*Mood)(nil),                     // 2: animate.v1.Mood
+	(*MoodFollowUp)(nil),             // 3: animate.v1.MoodFollowUp
+	(*GenerationJob)(nil),            // 4: animate.v1.GenerationJob
+	(*GetAnimationRequest)(nil),      // 5: animate.v1.GetAnimationRequest
+	(*ListFeedRequest)(nil),          // 6: animate.v1.ListFeedRequest
+	(*ListFeedResponse)(nil),         // 7: animate.v1.ListFeedResponse
+	(*SaveAnimationRequest)(nil),     // 8: animate.v1.SaveAnimationRequest
+	(*GenerateAnimationRequest)(nil), // 9: animate.v1.GenerateAnimationRequest
+	(*GetGenerationJobRequest)(nil),  // 10: animate.v1.GetGenerationJobRequest
+	(*GetUserRequest)(nil),           // 11: animate.v1.GetUserRequest
+	(*ListMoodsRequest)(nil),         // 12: animate.v1.ListMoodsRequest
+	(*ListMoodsResponse)(nil),        // 13: animate.v1.ListMoodsResponse
+	(*SaveMoodRequest)(nil),          // 14: animate.v1.SaveMoodRequest
+	(*timestamppb.Timestamp)(nil),    // 15: google.protobuf.Timestamp
+}
+var file_animate_v1_animate_proto_depIdxs = []int32{
+	15, // 0: animate.v1.User.last_login:type_name -> google.protobuf.Timestamp
+	15, // 1: animate.v1.Mood.created_at:type_name -> google.protobuf.Timestamp
+	3,  // 2: animate.v1.Mood.follow_ups:type_name -> animate.v1.MoodFollowUp
+	0,  // 3: animate.v1.MoodFollowUp.animations:type_name -> animate.v1.Animation
+	15, // 4: animate.v1.GenerationJob.created_at:type_name -> google.protobuf.Timestamp
+	15, // 5: animate.v1.GenerationJob.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 6: animate.v1.ListFeedResponse.animations:type_name -> animate.v1.Animation
+	15, // 7: animate.v1.ListMoodsRequest.from:type_name -> google.protobuf.Timestamp
+	15, // 8: animate.v1.ListMoodsRequest.to:type_name -> google.protobuf.Timestamp
+	2,  // 9: animate.v1.ListMoodsResponse.moods:type_name -> animate.v1.Mood
+	5,  // 10: animate.v1.AnimateService.GetAnimation:input_type -> animate.v1.GetAnimationRequest
+	6,  // 11: animate.v1.AnimateService.ListFeed:input_type -> animate.v1.ListFeedRequest
+	8,  // 12: animate.v1.AnimateService.SaveAnimation:input_type -> animate.v1.SaveAnimationRequest
+	9,  // 13: animate.v1.AnimateService.GenerateAnimation:input_type -> animate.v1.GenerateAnimationRequest
+	10, // 14: animate.v1.AnimateService.GetGenerationJob:input_type -> animate.v1.GetGenerationJobRequest
+	11, // 15: animate.v1.AnimateService.GetUser:input_type -> animate.v1.GetUserRequest
+	12, // 16: animate.v1.AnimateService.ListMoods:input_type -> animate.v1.ListMoodsRequest
+	14, // 17: animate.v1.AnimateService.SaveMood:input_type -> animate.v1.SaveMoodRequest
+	0,  // 18: animate.v1.AnimateService.GetAnimation:output_type -> animate.v1.Animation
+	7,  // 19: animate.v1.AnimateService.ListFeed:output_type -> animate.v1.ListFeedResponse
+	0,  // 20: animate.v1.AnimateService.SaveAnimation:output_type -> animate.v1.Animation
+	4,  // 21: animate.v1.AnimateService.GenerateAnimation:output_type -> animate.v1.GenerationJob
+	4,  // 22: animate.v1.AnimateService.GetGenerationJob:output_type -> animate.v1.GenerationJob
+	1,  // 23: animate.v1.AnimateService.GetUser:output_type -> animate.v1.User
+	13, // 24: animate.v1.AnimateService.ListMoods:output_type -> animate.v1.ListMoodsResponse
+	2,  // 25: animate.v1.AnimateService.SaveMood:output_type -> animate.v1.Mood
+	18, // [18:26] is the sub-list for method output_type
+	10, // [10:18] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_animate_v1_animate_proto_init() }
+func file_animate_v1_animate_proto_init() {
+	if File_animate_v1_animate_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_animate_v1_animate_proto_rawDesc), len(file_animate_v1_animate_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_animate_v1_animate_proto_goTypes,
+		DependencyIndexes: file_animate_v1_animate_proto_depIdxs,
+		MessageInfos:      file_animate_v1_animate_proto_msgTypes,
+	}.Build()
+	File_animate_v1_animate_proto = out.File
+	file_animate_v1_animate_proto_goTypes = nil
+	file_animate_v1_animate_proto_depIdxs = nil
+}
@@ -0,0 +1,417 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: animate/v1/animate.proto
+
+package animatepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	AnimateService_GetAnimation_FullMethodName      = "/animate.v1.AnimateService/GetAnimation"
+	AnimateService_ListFeed_FullMethodName          = "/animate.v1.AnimateService/ListFeed"
+	AnimateService_SaveAnimation_FullMethodName     = "/animate.v1.AnimateService/SaveAnimation"
+	AnimateService_GenerateAnimation_FullMethodName = "/animate.v1.AnimateService/GenerateAnimation"
+	AnimateService_GetGenerationJob_FullMethodName  = "/animate.v1.AnimateService/GetGenerationJob"
+	AnimateService_GetUser_FullMethodName           = "/animate.v1.AnimateService/GetUser"
+	AnimateService_ListMoods_FullMethodName         = "/animate.v1.AnimateService/ListMoods"
+	AnimateService_SaveMood_FullMethodName          = "/animate.v1.AnimateService/SaveMood"
+)
+
+// AnimateServiceClient is the client API for AnimateService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// AnimateService lets other backend services use the animation store and generation pipeline
+// without going through the JSON API. Every call acts for the user it names, so callers are
+// trusted to have authenticated that user themselves.
+type AnimateServiceClient interface {
+	// GetAnimation returns a saved animation; NOT_FOUND when there is none, FAILED_PRECONDITION
+	// when a takedown removed it
+	GetAnimation(ctx context.Context, in *GetAnimationRequest, opts ...grpc.CallOption) (*Animation, error)
+	// ListFeed returns a page of the feed, newest first
+	ListFeed(ctx context.Context, in *ListFeedRequest, opts ...grpc.CallOption) (*ListFeedResponse, error)
+	// SaveAnimation saves an animation as the user, as POST /save-animation does
+	SaveAnimation(ctx context.Context, in *SaveAnimationRequest, opts ...grpc.CallOption) (*Animation, error)
+	// GenerateAnimation queues a generation for the user, counted against their quota or their
+	// workspace's credits as POST /generate-animation is
+	GenerateAnimation(ctx context.Context, in *GenerateAnimationRequest, opts ...grpc.CallOption) (*GenerationJob, error)
+	// GetGenerationJob reports on one of the user's queued generations
+	GetGenerationJob(ctx context.Context, in *GetGenerationJobRequest, opts ...grpc.CallOption) (*GenerationJob, error)
+	// GetUser returns a user's profile
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error)
+	// ListMoods returns a page of a user's moods, newest first
+	ListMoods(ctx context.Context, in *ListMoodsRequest, opts ...grpc.CallOption) (*ListMoodsResponse, error)
+	// SaveMood records how the user felt after watching an animation, running the mood rules it
+	// matches
+	SaveMood(ctx context.Context, in *SaveMoodRequest, opts ...grpc.CallOption) (*Mood, error)
+}
+
+type animateServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAnimateServiceClient(cc grpc.ClientConnInterface) AnimateServiceClient {
+	return &animateServiceClient{cc}
+}
+
+func (c *animateServiceClient) GetAnimation(ctx context.Context, in *GetAnimationRequest, opts ...grpc.CallOption) (*Animation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Animation)
+	err := c.cc.Invoke(ctx, AnimateService_GetAnimation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) ListFeed(ctx context.Context, in *ListFeedRequest, opts ...grpc.CallOption) (*ListFeedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFeedResponse)
+	err := c.cc.Invoke(ctx, AnimateService_ListFeed_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) SaveAnimation(ctx context.Context, in *SaveAnimationRequest, opts ...grpc.CallOption) (*Animation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Animation)
+	err := c.cc.Invoke(ctx, AnimateService_SaveAnimation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) GenerateAnimation(ctx context.Context, in *GenerateAnimationRequest, opts ...grpc.CallOption) (*GenerationJob, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerationJob)
+	err := c.cc.Invoke(ctx, AnimateService_GenerateAnimation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) GetGenerationJob(ctx context.Context, in *GetGenerationJobRequest, opts ...grpc.CallOption) (*GenerationJob, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerationJob)
+	err := c.cc.Invoke(ctx, AnimateService_GetGenerationJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, AnimateService_GetUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) ListMoods(ctx context.Context, in *ListMoodsRequest, opts ...grpc.CallOption) (*ListMoodsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMoodsResponse)
+	err := c.cc.Invoke(ctx, AnimateService_ListMoods_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *animateServiceClient) SaveMood(ctx context.Context, in *SaveMoodRequest, opts ...grpc.CallOption) (*Mood, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Mood)
+	err := c.cc.Invoke(ctx, AnimateService_SaveMood_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AnimateServiceServer is the server API for AnimateService service.
+// All implementations must embed UnimplementedAnimateServiceServer
+// for forward compatibility.
+//
+// AnimateService lets other backend services use the animation store and generation pipeline
+// without going through the JSON API. Every call acts for the user it names, so callers are
+// trusted to have authenticated that user themselves.
+type AnimateServiceServer interface {
+	// GetAnimation returns a saved animation; NOT_FOUND when there is none, FAILED_PRECONDITION
+	// when a takedown removed it
+	GetAnimation(context.Context, *GetAnimationRequest) (*Animation, error)
+	// ListFeed returns a page of the feed, newest first
+	ListFeed(context.Context, *ListFeedRequest) (*ListFeedResponse, error)
+	// SaveAnimation saves an animation as the user, as POST /save-animation does
+	SaveAnimation(context.Context, *SaveAnimationRequest) (*Animation, error)
+	// GenerateAnimation queues a generation for the user, counted against their quota or their
+	// workspace's credits as POST /generate-animation is
+	GenerateAnimation(context.Context, *GenerateAnimationRequest) (*GenerationJob, error)
+	// GetGenerationJob reports on one of the user's queued generations
+	GetGenerationJob(context.Context, *GetGenerationJobRequest) (*GenerationJob, error)
+	// GetUser returns a user's profile
+	GetUser(context.Context, *GetUserRequest) (*User, error)
+	// ListMoods returns a page of a user's moods, newest first
+	ListMoods(context.Context, *ListMoodsRequest) (*ListMoodsResponse, error)
+	// SaveMood records how the user felt after watching an animation, running the mood rules it
+	// matches
+	SaveMood(context.Context, *SaveMoodRequest) (*Mood, error)
+	mustEmbedUnimplementedAnimateServiceServer()
+}
+
+// UnimplementedAnimateServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAnimateServiceServer struct{}
+
+func (UnimplementedAnimateServiceServer) GetAnimation(context.Context, *GetAnimationRequest) (*Animation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAnimation not implemented")
+}
+func (UnimplementedAnimateServiceServer) ListFeed(context.Context, *ListFeedRequest) (*ListFeedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFeed not implemented")
+}
+func (UnimplementedAnimateServiceServer) SaveAnimation(context.Context, *SaveAnimationRequest) (*Animation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveAnimation not implemented")
+}
+func (UnimplementedAnimateServiceServer) GenerateAnimation(context.Context, *GenerateAnimationRequest) (*GenerationJob, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GenerateAnimation not implemented")
+}
+func (UnimplementedAnimateServiceServer) GetGenerationJob(context.Context, *GetGenerationJobRequest) (*GenerationJob, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGenerationJob not implemented")
+}
+func (UnimplementedAnimateServiceServer) GetUser(context.Context, *GetUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedAnimateServiceServer) ListMoods(context.Context, *ListMoodsRequest) (*ListMoodsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMoods not implemented")
+}
+func (UnimplementedAnimateServiceServer) SaveMood(context.Context, *SaveMoodRequest) (*Mood, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveMood not implemented")
+}
+func (UnimplementedAnimateServiceServer) mustEmbedUnimplementedAnimateServiceServer() {}
+func (UnimplementedAnimateServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeAnimateServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AnimateServiceServer will
+// result in compilation errors.
+type UnsafeAnimateServiceServer interface {
+	mustEmbedUnimplementedAnimateServiceServer()
+}
+
+func RegisterAnimateServiceServer(s grpc.ServiceRegistrar, srv AnimateServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAnimateServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AnimateService_ServiceDesc, srv)
+}
+
+func _AnimateService_GetAnimation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAnimationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).GetAnimation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_GetAnimation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).GetAnimation(ctx, req.(*GetAnimationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_ListFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).ListFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_ListFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).ListFeed(ctx, req.(*ListFeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_SaveAnimation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveAnimationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).SaveAnimation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_SaveAnimation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).SaveAnimation(ctx, req.(*SaveAnimationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_GenerateAnimation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateAnimationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).GenerateAnimation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_GenerateAnimation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).GenerateAnimation(ctx, req.(*GenerateAnimationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_GetGenerationJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGenerationJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).GetGenerationJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_GetGenerationJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).GetGenerationJob(ctx, req.(*GetGenerationJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).GetUser(ctx, req.(*GetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_ListMoods_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMoodsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).ListMoods(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_ListMoods_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).ListMoods(ctx, req.(*ListMoodsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AnimateService_SaveMood_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveMoodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnimateServiceServer).SaveMood(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AnimateService_SaveMood_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnimateServiceServer).SaveMood(ctx, req.(*SaveMoodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AnimateService_ServiceDesc is the grpc.ServiceDesc for AnimateService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AnimateService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "animate.v1.AnimateService",
+	HandlerType: (*AnimateServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetAnimation",
+			Handler:    _AnimateService_GetAnimation_Handler,
+		},
+		{
+			MethodName: "ListFeed",
+			Handler:    _AnimateService_ListFeed_Handler,
+		},
+		{
+			MethodName: "SaveAnimation",
+			Handler:    _AnimateService_SaveAnimation_Handler,
+		},
+		{
+			MethodName: "GenerateAnimation",
+			Handler:    _AnimateService_GenerateAnimation_Handler,
+		},
+		{
+			MethodName: "GetGenerationJob",
+			Handler:    _AnimateService_GetGenerationJob_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _AnimateService_GetUser_Handler,
+		},
+		{
+			MethodName: "ListMoods",
+			Handler:    _AnimateService_ListMoods_Handler,
+		},
+		{
+			MethodName: "SaveMood",
+			Handler:    _AnimateService_SaveMood_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "animate/v1/animate.proto",
+}
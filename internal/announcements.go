@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Announcement audiences
+const (
+	// AnnouncementAll shows an announcement to everyone, signed in or not
+	AnnouncementAll AnnouncementAudience = "all"
+	// AnnouncementPlan shows an announcement to signed-in users whose account type is the target
+	AnnouncementPlan AnnouncementAudience = "plan"
+	// AnnouncementTenant shows an announcement on requests for the tenant named by the target
+	AnnouncementTenant AnnouncementAudience = "tenant"
+)
+
+const (
+	maxAnnouncementTitleLength = 120
+	maxAnnouncementBodyLength  = 2000
+)
+
+// ValidateAnnouncement checks an announcement request and returns the announcement it describes,
+// defaulting to everyone and starting now
+func ValidateAnnouncement(req AnnouncementRequest, now time.Time) (Announcement, error) {
+	announcement := Announcement{
+		Title:    strings.TrimSpace(req.Title),
+		Body:     strings.TrimSpace(req.Body),
+		Audience: req.Audience,
+		Target:   strings.TrimSpace(req.Target),
+		StartsAt: now,
+	}
+	if announcement.Title == "" || len(announcement.Title) > maxAnnouncementTitleLength {
+		return Announcement{}, fmt.Errorf("title must be 1-%d characters", maxAnnouncementTitleLength)
+	}
+	if announcement.Body == "" || len(announcement.Body) > maxAnnouncementBodyLength {
+		return Announcement{}, fmt.Errorf("body must be 1-%d characters", maxAnnouncementBodyLength)
+	}
+
+	switch announcement.Audience {
+	case "", AnnouncementAll:
+		announcement.Audience = AnnouncementAll
+		if announcement.Target != "" {
+			return Announcement{}, errors.New("announcements for everyone take no target")
+		}
+	case AnnouncementPlan:
+		if !ValidAccountType(announcement.Target) {
+			return Announcement{}, fmt.Errorf("plan announcements target %s or %s accounts", AccountPersonal, AccountProfessional)
+		}
+	case AnnouncementTenant:
+		tenants, err := TenantRegions()
+		if err != nil {
+			return Announcement{}, err
+		}
+		if _, ok := tenants[announcement.Target]; !ok {
+			return Announcement{}, fmt.Errorf("unknown tenant %q", announcement.Target)
+		}
+	default:
+		return Announcement{}, fmt.Errorf("audience must be %s, %s or %s", AnnouncementAll, AnnouncementPlan, AnnouncementTenant)
+	}
+
+	if req.StartsAt != nil {
+		announcement.StartsAt = req.StartsAt.UTC()
+	}
+	if req.EndsAt != nil {
+		endsAt := req.EndsAt.UTC()
+		if !endsAt.After(announcement.StartsAt) {
+			return Announcement{}, errors.New("endsAt must be after startsAt")
+		}
+		announcement.EndsAt = &endsAt
+	}
+	return announcement, nil
+}
+
+// shownTo reports whether an announcement's audience includes a viewer with the given account type,
+// empty when signed out, on a request for tenant, empty without one
+func (a Announcement) shownTo(accountType, tenant string) bool {
+	switch a.Audience {
+	case AnnouncementAll:
+		return true
+	case AnnouncementPlan:
+		return accountType != "" && accountType == a.Target
+	case AnnouncementTenant:
+		return tenant != "" && tenant == a.Target
+	}
+	return false
+}
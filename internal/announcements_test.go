@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateAnnouncement(t *testing.T) {
+	t.Setenv("TENANT_REGIONS", "globex=primary")
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name         string
+		req          AnnouncementRequest
+		wantAudience AnnouncementAudience
+		wantErr      bool
+	}{
+		{name: "Everyone by default", req: AnnouncementRequest{Title: "New feed", Body: "Try it"}, wantAudience: AnnouncementAll},
+		{name: "Plan", req: AnnouncementRequest{Title: "Client tools", Body: "New", Audience: AnnouncementPlan, Target: AccountProfessional}, wantAudience: AnnouncementPlan},
+		{name: "Tenant", req: AnnouncementRequest{Title: "Maintenance", Body: "Tonight", Audience: AnnouncementTenant, Target: "globex", EndsAt: &later}, wantAudience: AnnouncementTenant},
+		{name: "Missing title", req: AnnouncementRequest{Body: "Try it"}, wantErr: true},
+		{name: "Target for everyone", req: AnnouncementRequest{Title: "New feed", Body: "Try it", Target: "globex"}, wantErr: true},
+		{name: "Unknown plan", req: AnnouncementRequest{Title: "Client tools", Body: "New", Audience: AnnouncementPlan, Target: "enterprise"}, wantErr: true},
+		{name: "Unknown tenant", req: AnnouncementRequest{Title: "Maintenance", Body: "Tonight", Audience: AnnouncementTenant, Target: "initech"}, wantErr: true},
+		{name: "Unknown audience", req: AnnouncementRequest{Title: "New feed", Body: "Try it", Audience: "beta"}, wantErr: true},
+		{name: "Ends before it starts", req: AnnouncementRequest{Title: "New feed", Body: "Try it", EndsAt: &earlier}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			announcement, err := ValidateAnnouncement(tt.req, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateAnnouncement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (announcement.Audience != tt.wantAudience || !announcement.StartsAt.Equal(now)) {
+				t.Errorf("announcement = %+v, want audience %s starting now", announcement, tt.wantAudience)
+			}
+		})
+	}
+}
+
+func TestAnnouncementsHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("TENANT_REGIONS", "globex=primary")
+
+	router := NewServer(NewMemoryStore()).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	pro := registerAccount(t, router, "therapist")
+	if code := doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil); code != http.StatusOK {
+		t.Fatalf("set account type status = %d", code)
+	}
+	viewer := registerUser(t, router, "viewer")
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	var everyone Announcement
+	for _, req := range []AnnouncementRequest{
+		{Title: "Everyone", Body: "New animations every day"},
+		{Title: "Professionals", Body: "Client tools", Audience: AnnouncementPlan, Target: AccountProfessional},
+		{Title: "Globex", Body: "Maintenance tonight", Audience: AnnouncementTenant, Target: "globex"},
+		{Title: "Scheduled", Body: "Coming soon", StartsAt: &tomorrow},
+	} {
+		var created Announcement
+		if code := doJSON(t, router, http.MethodPost, "/admin/announcements", admin.Token, req, &created); code != http.StatusCreated {
+			t.Fatalf("create %q status = %d", req.Title, code)
+		}
+		if req.Title == "Everyone" {
+			everyone = created
+		}
+	}
+	if code := doJSON(t, router, http.MethodPost, "/admin/announcements", viewer, AnnouncementRequest{Title: "Hi", Body: "Hi"}, nil); code != http.StatusForbidden {
+		t.Errorf("non-admin create status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	active := func(token, tenant string) []string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/announcements/active", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var announcements []Announcement
+		if err := json.NewDecoder(rec.Body).Decode(&announcements); err != nil {
+			t.Fatalf("decode active announcements (status %d): %v", rec.Code, err)
+		}
+		titles := []string{}
+		for _, announcement := range announcements {
+			titles = append(titles, announcement.Title)
+		}
+		return titles
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		tenant string
+		want   []string
+	}{
+		{name: "Signed out", want: []string{"Everyone"}},
+		{name: "Personal account", token: viewer, want: []string{"Everyone"}},
+		{name: "Professional account", token: pro.Token, want: []string{"Professionals", "Everyone"}},
+		{name: "Tenant", tenant: "globex", want: []string{"Globex", "Everyone"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := active(tt.token, tt.tenant); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("active announcements = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Dismissing hides an announcement from that user only
+	dismissPath := "/announcements/" + strconv.Itoa(everyone.ID) + "/dismiss"
+	if code := doJSON(t, router, http.MethodPost, dismissPath, viewer, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("dismiss status = %d", code)
+	}
+	if got := active(viewer, ""); len(got) != 0 {
+		t.Errorf("active announcements after dismissing = %v, want none", got)
+	}
+	if got := active(pro.Token, ""); !reflect.DeepEqual(got, []string{"Professionals", "Everyone"}) {
+		t.Errorf("other user's announcements = %v, want the dismissed one still shown", got)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/announcements/999/dismiss", viewer, nil, nil); code != http.StatusNotFound {
+		t.Errorf("dismiss unknown status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	var all []Announcement
+	if code := doJSON(t, router, http.MethodGet, "/admin/announcements", admin.Token, nil, &all); code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	if len(all) != 4 || all[0].Title != "Scheduled" || all[len(all)-1].Dismissals != 1 {
+		t.Errorf("announcements = %+v, want all four, newest first, with the dismissal counted", all)
+	}
+
+	// Ending an announcement takes it down for everyone
+	ended := time.Now().Add(-time.Minute)
+	started := ended.Add(-time.Hour)
+	update := AnnouncementRequest{Title: "Everyone", Body: "New animations every day", StartsAt: &started, EndsAt: &ended}
+	if code := doJSON(t, router, http.MethodPut, "/admin/announcements/"+strconv.Itoa(everyone.ID), admin.Token, update, nil); code != http.StatusOK {
+		t.Fatalf("update status = %d", code)
+	}
+	if got := active("", ""); len(got) != 0 {
+		t.Errorf("active announcements after ending = %v, want none", got)
+	}
+	if code := doJSON(t, router, http.MethodDelete, "/admin/announcements/"+strconv.Itoa(everyone.ID), admin.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodDelete, "/admin/announcements/"+strconv.Itoa(everyone.ID), admin.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("delete again status = %d, want %d", code, http.StatusNotFound)
+	}
+}
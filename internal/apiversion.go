@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// APIVersion names a response contract. Handlers build the same domain objects for every version
+// and render them into the version's shapes only when encoding.
+type APIVersion string
+
+// API versions
+const (
+	// APIVersionV1 is the contract of the original root package, which returned an animation's code alone
+	APIVersionV1 APIVersion = "v1"
+	// APIVersionV2 returns animations in full, with their p5.js pin and mood summary
+	APIVersionV2 APIVersion = "v2"
+	// LatestAPIVersion is the newest contract
+	LatestAPIVersion = APIVersionV2
+	// UnversionedAPIVersion is served by routes without a version prefix. It stays on the contract
+	// those routes had when the prefixes were introduced, so their clients keep working when a
+	// breaking change ships as a new latest version.
+	UnversionedAPIVersion = APIVersionV2
+)
+
+// APIVersions are the versions routes are mounted under, oldest first
+var APIVersions = []APIVersion{APIVersionV1, APIVersionV2}
+
+// APIVersionHeader names the contract a response was rendered in
+const APIVersionHeader = "API-Version"
+
+// apiVersionKey holds the contract of the route a request matched
+const apiVersionKey contextKey = "apiVersion"
+
+// withAPIVersion serves next as a route of version
+func withAPIVersion(version APIVersion, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(APIVersionHeader, string(version))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, version)))
+	})
+}
+
+// GetAPIVersionFromContext returns the contract a request's response is rendered in,
+// UnversionedAPIVersion for routes without a version
+func GetAPIVersionFromContext(ctx context.Context) APIVersion {
+	if version, ok := ctx.Value(apiVersionKey).(APIVersion); ok {
+		return version
+	}
+	return UnversionedAPIVersion
+}
+
+// unversionedRoute returns a route template without its API version prefix, so settings keyed by
+// route apply to every version of it
+func unversionedRoute(template string) string {
+	for _, version := range APIVersions {
+		prefix := "/" + string(version)
+		if template == prefix || strings.HasPrefix(template, prefix+"/") {
+			return strings.TrimPrefix(template, prefix)
+		}
+	}
+	return template
+}
+
+// renderAnimation returns an animation in version's shape
+func renderAnimation(version APIVersion, animation GetAnimationResponse) interface{} {
+	if version == APIVersionV1 {
+		return AnimationV1{Code: animation.Code}
+	}
+	return animation
+}
+
+// renderAnimationFeed returns a page of the feed in version's shape
+func renderAnimationFeed(version APIVersion, page GetAnimationFeedResponse) interface{} {
+	if version != APIVersionV1 {
+		return page
+	}
+	animations := make([]AnimationV1, len(page.Animations))
+	for i, animation := range page.Animations {
+		animations[i] = AnimationV1{Code: animation.Code}
+	}
+	return AnimationFeedV1{Animations: animations, Total: page.Total, Limit: page.Limit, Offset: page.Offset, NextOffset: page.NextOffset}
+}
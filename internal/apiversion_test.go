@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVersionedAnimationRoutes(t *testing.T) {
+	resetFeatures(t)
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	author := registerUser(t, router, "author")
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantVersion string
+		wantFields  []string
+	}{
+		{name: "v1 animation", path: "/v1/animation/" + saved.ID, wantVersion: "v1", wantFields: []string{"code"}},
+		{name: "v2 animation", path: "/v2/animation/" + saved.ID, wantVersion: "v2", wantFields: []string{"code", "description", "id", "moods"}},
+		{name: "Unversioned animation", path: "/animation/" + saved.ID, wantFields: []string{"code", "description", "id", "moods"}},
+		{name: "v1 feed", path: "/v1/feed", wantVersion: "v1", wantFields: []string{"code"}},
+		{name: "v2 feed", path: "/v2/feed", wantVersion: "v2", wantFields: []string{"code", "description", "id", "moods"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d", rec.Code)
+			}
+			if got := rec.Header().Get(APIVersionHeader); got != tt.wantVersion {
+				t.Errorf("%s = %q, want %q", APIVersionHeader, got, tt.wantVersion)
+			}
+			var body map[string]json.RawMessage
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var fields []string
+			for _, field := range []string{"code", "description", "id", "moods"} {
+				if _, ok := body[field]; ok {
+					fields = append(fields, field)
+				}
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+
+	var page AnimationFeedV1
+	if code := doJSON(t, router, http.MethodGet, "/v1/feed?limit=5", "", nil, &page); code != http.StatusOK {
+		t.Fatalf("v1 feed page status = %d", code)
+	}
+	if page.Total != 1 || len(page.Animations) != 1 || page.Animations[0].Code != sketch.Code {
+		t.Errorf("v1 feed page = %+v, want the sketch's code", page)
+	}
+}
+
+func TestEveryRouteIsVersioned(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	var registered RegisterResponse
+	if code := doJSON(t, router, http.MethodPost, "/v1/register", "", RegisterRequest{Username: "artist", Email: "artist@example.com", Password: "password123"}, &registered); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("v1 register status = %d", code)
+	}
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	if code := doJSON(t, router, http.MethodPost, "/v2/save-animation", registered.Token, sketch, nil); code != http.StatusOK {
+		t.Fatalf("v2 save animation status = %d", code)
+	}
+
+	for _, path := range []string{"/v1/my-animations", "/v2/my-animations", "/my-animations"} {
+		var mine MyAnimationsResponse
+		if code := doJSON(t, router, http.MethodGet, path, registered.Token, nil, &mine); code != http.StatusOK || mine.Total != 1 {
+			t.Errorf("%s = %d %+v, want the saved animation", path, code, mine)
+		}
+	}
+	if code := doJSON(t, router, http.MethodGet, "/v1/my-animations", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("v1 my-animations without a token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestUnversionedRoute(t *testing.T) {
+	for template, want := range map[string]string{
+		"/v1/feed":           "/feed",
+		"/v2/animation/{id}": "/animation/{id}",
+		"/v1":                "",
+		"/feed":              "/feed",
+		"/v1beta/feed":       "/v1beta/feed",
+		"/videos/v1/{id}":    "/videos/v1/{id}",
+	} {
+		if got := unversionedRoute(template); got != want {
+			t.Errorf("unversionedRoute(%q) = %q, want %q", template, got, want)
+		}
+	}
+	if RoutePriority("/v1/feed") != PriorityLow || RoutePriority("/v2/save-animation") != PriorityCritical {
+		t.Error("versioned routes should keep their unversioned priority")
+	}
+}
@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Providers a user's own API key can belong to
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+)
+
+const (
+	// DefaultOpenAIModel generates animations for users who bring an OpenAI key
+	DefaultOpenAIModel   = "gpt-4o"
+	minProviderKeyLength = 20
+	maxProviderKeyLength = 256
+)
+
+var (
+	providers = []string{ProviderAnthropic, ProviderOpenAI}
+	// providerKeyPrefixes catch keys pasted for the wrong provider
+	providerKeyPrefixes = map[string]string{ProviderAnthropic: "sk-ant-", ProviderOpenAI: "sk-"}
+)
+
+// openAIChatURL is the OpenAI Chat Completions endpoint
+var openAIChatURL = "https://api.openai.com/v1/chat/completions"
+
+// ProviderKeyring returns the master keys users' own API keys are sealed with, configured by
+// PROVIDER_KEY_ENCRYPTION_KEYS or PROVIDER_KEY_ENCRYPTION_KEYS_FILE, or nil when none are set and
+// users cannot store keys
+func ProviderKeyring() (*Keyring, error) {
+	return keyringFromEnv("PROVIDER_KEY_ENCRYPTION_KEYS")
+}
+
+// OpenAIModel returns the model used with users' OpenAI keys, configured by OPENAI_MODEL
+func OpenAIModel() string {
+	if model := os.Getenv("OPENAI_MODEL"); model != "" {
+		return model
+	}
+	return DefaultOpenAIModel
+}
+
+// ValidateProviderKey checks that a key looks like one issued by the named provider
+func ValidateProviderKey(req ProviderKeyRequest) error {
+	if !slices.Contains(providers, req.Provider) {
+		return fmt.Errorf("provider must be one of %s", strings.Join(providers, ", "))
+	}
+	key := strings.TrimSpace(req.Key)
+	if len(key) < minProviderKeyLength || len(key) > maxProviderKeyLength || strings.ContainsAny(key, " \t\r\n") {
+		return fmt.Errorf("key must be %d-%d characters without spaces", minProviderKeyLength, maxProviderKeyLength)
+	}
+	if !strings.HasPrefix(key, providerKeyPrefixes[req.Provider]) {
+		return fmt.Errorf("%s keys start with %s", req.Provider, providerKeyPrefixes[req.Provider])
+	}
+	// Anthropic keys share OpenAI's prefix, so check the other way round too
+	if req.Provider == ProviderOpenAI && strings.HasPrefix(key, providerKeyPrefixes[ProviderAnthropic]) {
+		return errors.New("this is an anthropic key")
+	}
+	return nil
+}
+
+// sealProviderKey seals a validated key for storage
+func sealProviderKey(req ProviderKeyRequest) (ProviderKey, error) {
+	ring, err := ProviderKeyring()
+	if err != nil {
+		return ProviderKey{}, err
+	}
+	if ring == nil {
+		return ProviderKey{}, errors.New("provider key encryption is not configured")
+	}
+	key := strings.TrimSpace(req.Key)
+	keyId, envelope, err := ring.Seal([]byte(key))
+	if err != nil {
+		return ProviderKey{}, fmt.Errorf("failed to encrypt provider key: %w", err)
+	}
+	return ProviderKey{Provider: req.Provider, Hint: key[len(key)-4:], KeyID: keyId, Encrypted: envelope}, nil
+}
+
+// openProviderKey returns the API key sealed in a stored provider key
+func openProviderKey(key ProviderKey) (string, error) {
+	ring, err := ProviderKeyring()
+	if err != nil {
+		return "", err
+	}
+	if ring == nil {
+		return "", errors.New("provider keys are encrypted but PROVIDER_KEY_ENCRYPTION_KEYS is not set")
+	}
+	apiKey, err := ring.Open(key.KeyID, key.Encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt provider key: %w", err)
+	}
+	return string(apiKey), nil
+}
+
+// GenerationKey is the API key a generation is made with: the house Claude key, counted against
+// the user's quota, or the user's own key for either provider
+type GenerationKey struct {
+	Provider string
+	APIKey   string
+	Own      bool
+}
+
+// generate asks the key's provider for an animation matching description, in style
+func (k GenerationKey) generate(ctx context.Context, description, style string) (string, error) {
+	if k.Provider == ProviderOpenAI {
+		log.Printf("[OPENAI] Generating animation for description: %s", RedactDescriptionFor(ctx, description))
+		return sendOpenAIPrompt(ctx, BuildAnimationPrompt(PromptTemplate(PromptGenerate), description, style), k.APIKey)
+	}
+	return GenerateAnimationWithClaude(ctx, description, style, k.APIKey)
+}
+
+// stream generates like generate, handing text to onText as it is written. OpenAI replies are
+// handed over whole once they arrive.
+func (k GenerationKey) stream(ctx context.Context, description, style string, onText func(string) error) (string, error) {
+	if k.Provider != ProviderOpenAI {
+		return streamAnimationWithClaude(ctx, description, style, k.APIKey, onText)
+	}
+	animation, err := k.generate(ctx, description, style)
+	if err != nil {
+		return "", err
+	}
+	return animation, onText(animation)
+}
+
+// refine sends the key's provider a refinement conversation and returns the code it answers with
+func (k GenerationKey) refine(ctx context.Context, messages []ClaudeMessage) (string, error) {
+	if k.Provider == ProviderOpenAI {
+		return sendOpenAIMessages(ctx, messages, k.APIKey)
+	}
+	return sendClaudeMessagesWithModel(ctx, messages, DefaultClaudeModel, k.APIKey)
+}
+
+// fix asks the key's provider to repair code that failed with errorMessage
+func (k GenerationKey) fix(ctx context.Context, brokenCode, errorMessage string) (string, error) {
+	if k.Provider == ProviderOpenAI {
+		log.Printf("[OPENAI] Repairing animation after error: %s", RedactLogFor(ctx, errorMessage))
+		return sendOpenAIPrompt(ctx, buildFixPrompt(brokenCode, errorMessage), k.APIKey)
+	}
+	return FixAnimationWithClaude(ctx, brokenCode, errorMessage, k.APIKey)
+}
+
+// sendOpenAIPrompt sends a single user prompt to OpenAIModel and returns the text of the reply
+func sendOpenAIPrompt(ctx context.Context, prompt string, apiKey string) (string, error) {
+	return sendOpenAIMessages(ctx, userMessages(prompt), apiKey)
+}
+
+// sendOpenAIMessages sends a conversation to OpenAIModel, after the system prompt, and returns the
+// text of the reply. Only users' own keys are sent to OpenAI, so its failures do not count against
+// GET /status.
+func sendOpenAIMessages(ctx context.Context, messages []ClaudeMessage, apiKey string) (string, error) {
+	ctx, span := StartSpan(ctx, "openai.chat.completions", SpanKindClient)
+	defer span.End()
+
+	model := OpenAIModel()
+	span.SetAttribute("gen_ai.system", "openai")
+	span.SetAttribute("gen_ai.request.model", model)
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"messages":   append([]ClaudeMessage{{Role: "system", Content: SystemPrompt()}}, messages...),
+		"max_tokens": ClaudeMaxTokens(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal OpenAI request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIChatURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("[OPENAI ERROR] Failed to send request: %v", err)
+		span.RecordError(err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read OpenAI response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		json.Unmarshal(data, &parsed)
+		err := fmt.Errorf("openai returned status %d: %s", resp.StatusCode, parsed.Error.Message)
+		log.Printf("[OPENAI ERROR] %v", err)
+		span.RecordError(err)
+		return "", err
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		span.RecordError(err)
+		return "", fmt.Errorf("failed to parse OpenAI response: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", errors.New("openai returned no choices")
+	}
+
+	log.Printf("[OPENAI] Response received successfully")
+	return parsed.Choices[0].Message.Content, nil
+}
+
+// ownGenerationKey returns the key a professional user stored for their own generations, or false
+// when they have none. Keys stored by users who are no longer professionals are left unused.
+func (s *Server) ownGenerationKey(ctx context.Context, userId string) (GenerationKey, bool, error) {
+	stored, err := s.store.GetProviderKey(ctx, userId)
+	if err != nil {
+		if err.Error() == "provider key not found" {
+			return GenerationKey{}, false, nil
+		}
+		return GenerationKey{}, false, err
+	}
+	accountType, err := s.store.GetAccountType(ctx, userId)
+	if err != nil && err.Error() != "user not found" {
+		return GenerationKey{}, false, err
+	}
+	if accountType != AccountProfessional {
+		return GenerationKey{}, false, nil
+	}
+	apiKey, err := openProviderKey(stored)
+	if err != nil {
+		return GenerationKey{}, false, err
+	}
+	return GenerationKey{Provider: stored.Provider, APIKey: apiKey, Own: true}, true, nil
+}
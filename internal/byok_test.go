@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testAnthropicKey = "sk-ant-REDACTED"
+	testOpenAIKey    = "sk-proj-abcdefghijklmnopqrst5678"
+)
+
+func TestValidateProviderKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ProviderKeyRequest
+		wantErr bool
+	}{
+		{name: "Anthropic", req: ProviderKeyRequest{Provider: ProviderAnthropic, Key: testAnthropicKey}},
+		{name: "OpenAI", req: ProviderKeyRequest{Provider: ProviderOpenAI, Key: "  " + testOpenAIKey + "\n"}},
+		{name: "Unknown provider", req: ProviderKeyRequest{Provider: "mistral", Key: testOpenAIKey}, wantErr: true},
+		{name: "Too short", req: ProviderKeyRequest{Provider: ProviderOpenAI, Key: "sk-123"}, wantErr: true},
+		{name: "Spaces inside", req: ProviderKeyRequest{Provider: ProviderOpenAI, Key: "sk-proj abcdefghijklmnopqrst"}, wantErr: true},
+		{name: "OpenAI key as Anthropic", req: ProviderKeyRequest{Provider: ProviderAnthropic, Key: testOpenAIKey}, wantErr: true},
+		{name: "Anthropic key as OpenAI", req: ProviderKeyRequest{Provider: ProviderOpenAI, Key: testAnthropicKey}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateProviderKey(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateProviderKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderKeyHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("PROVIDER_KEY_ENCRYPTION_KEYS", testKey("k1", 7))
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	pro := registerAccount(t, router, "therapist")
+	if code := doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil); code != http.StatusOK {
+		t.Fatalf("set account type status = %d", code)
+	}
+	viewer := registerUser(t, router, "viewer")
+
+	if code := doJSON(t, router, http.MethodGet, "/me/provider-key", pro.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("status before storing = %d, want %d", code, http.StatusNotFound)
+	}
+
+	var key ProviderKey
+	if code := doJSON(t, router, http.MethodPut, "/me/provider-key", pro.Token, ProviderKeyRequest{Provider: ProviderOpenAI, Key: testOpenAIKey}, &key); code != http.StatusOK {
+		t.Fatalf("store key status = %d", code)
+	}
+	if key.Provider != ProviderOpenAI || key.Hint != "5678" {
+		t.Errorf("key = %+v, want the OpenAI key ending 5678", key)
+	}
+	stored, err := store.GetProviderKey(context.Background(), pro.User.ID)
+	if err != nil || bytes.Contains(stored.Encrypted, []byte(testOpenAIKey)) {
+		t.Errorf("stored key = %+v, %v, want it sealed", stored, err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Personal account", method: http.MethodPut, token: viewer, body: ProviderKeyRequest{Provider: ProviderOpenAI, Key: testOpenAIKey}, wantCode: http.StatusForbidden},
+		{name: "Invalid key", method: http.MethodPut, token: pro.Token, body: ProviderKeyRequest{Provider: ProviderAnthropic, Key: testOpenAIKey}, wantCode: http.StatusBadRequest},
+		{name: "Read back", method: http.MethodGet, token: pro.Token, wantCode: http.StatusOK},
+		{name: "Signed out", method: http.MethodGet, wantCode: http.StatusUnauthorized},
+		{name: "Delete", method: http.MethodDelete, token: pro.Token, wantCode: http.StatusNoContent},
+		{name: "Delete again", method: http.MethodDelete, token: pro.Token, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, "/me/provider-key", tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	t.Setenv("PROVIDER_KEY_ENCRYPTION_KEYS", "")
+	if code := doJSON(t, router, http.MethodPut, "/me/provider-key", pro.Token, ProviderKeyRequest{Provider: ProviderOpenAI, Key: testOpenAIKey}, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("status without encryption keys = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestGenerateWithOwnKey(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("PROVIDER_KEY_ENCRYPTION_KEYS", testKey("k1", 7))
+
+	openAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testOpenAIKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "Incorrect API key provided"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": "function setup() {}\nfunction draw() {}"}}},
+		})
+	}))
+	defer openAI.Close()
+	savedURL := openAIChatURL
+	openAIChatURL = openAI.URL
+	t.Cleanup(func() { openAIChatURL = savedURL })
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	pro := registerAccount(t, router, "therapist")
+	doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil)
+	if code := doJSON(t, router, http.MethodPut, "/me/provider-key", pro.Token, ProviderKeyRequest{Provider: ProviderOpenAI, Key: testOpenAIKey}, nil); code != http.StatusOK {
+		t.Fatalf("store key status = %d", code)
+	}
+
+	// The quota lives in PostgreSQL, so this only succeeds if it is bypassed
+	code, job := generateAndWait(t, server, router, pro.Token, AnimationRequest{Description: "a calm ocean"})
+	if code != http.StatusAccepted || job.Status != GenerationDone {
+		t.Fatalf("generate = %d %+v, want it done", code, job)
+	}
+	if !strings.Contains(job.Result.Code, "function draw()") {
+		t.Errorf("code = %q, want the sketch OpenAI returned", job.Result.Code)
+	}
+
+	var key ProviderKey
+	doJSON(t, router, http.MethodGet, "/me/provider-key", pro.Token, nil, &key)
+	if key.GenerationsToday != 1 || key.GenerationsThisMonth != 1 {
+		t.Errorf("key usage = %+v, want one generation logged", key)
+	}
+}
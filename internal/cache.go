@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheTTLSeconds = 300
+	// feedSampleSize is how many eligible animation IDs are cached for the feed to pick from
+	feedSampleSize = 500
+
+	feedCacheKey = "animate:feed:ids"
+	// reducedMotionFeedCacheKey holds the sample for viewers who prefer reduced motion
+	reducedMotionFeedCacheKey = "animate:feed:ids:reduced-motion"
+	// screenedFeedCacheKey holds the sample for viewers who avoid animations not yet screened for flashing
+	screenedFeedCacheKey = "animate:feed:ids:screened"
+)
+
+// feedCacheKeys are every cached feed sample, dropped together whenever eligibility may change
+var feedCacheKeys = []string{feedCacheKey, reducedMotionFeedCacheKey, screenedFeedCacheKey}
+
+// Cache stores short-lived copies of hot data. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Cache hit and miss counts reported by /metrics
+var cacheHits, cacheMisses atomic.Int64
+
+// CacheTTL returns how long cached entries live, configured by CACHE_TTL_SECONDS
+func CacheTTL() time.Duration {
+	return time.Duration(envLimit("CACHE_TTL_SECONDS", defaultCacheTTLSeconds)) * time.Second
+}
+
+// CacheFromEnv returns a Redis cache when REDIS_URL is set, or nil when caching is disabled
+func CacheFromEnv() Cache {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return nil
+	}
+	cache, err := NewRedisCache(redisURL)
+	if err != nil {
+		log.Printf("[CACHE] Caching disabled: %v", err)
+		return nil
+	}
+	log.Printf("[CACHE] Caching animations in Redis at %s for %s", cache.addr, CacheTTL())
+	return cache
+}
+
+// animationCacheKey is the key of a cached animation
+func animationCacheKey(id string) string {
+	return "animate:animation:" + id
+}
+
+// CachedStore is a read-through cache in front of a Store. Animations and the feed's candidate
+// IDs are cached; everything else goes straight to the store. Cache failures are logged and the
+// store is used instead, so the cache can never take the service down. Only the primary region is
+// cached, so data held in another region for residency never reaches the shared cache.
+type CachedStore struct {
+	Store
+	cache Cache
+	ttl   time.Duration
+}
+
+// NewCachedStore wraps store with cache. A nil cache returns store unchanged.
+func NewCachedStore(store Store, cache Cache, ttl time.Duration) Store {
+	if cache == nil {
+		return store
+	}
+	return &CachedStore{Store: store, cache: cache, ttl: ttl}
+}
+
+// getCached decodes the cached value at key into out and reports whether it was found
+func (c *CachedStore) getCached(ctx context.Context, key string, out interface{}) bool {
+	if !isPrimaryRegion(ctx) {
+		return false
+	}
+	data, ok, err := c.cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("[CACHE] Get %s failed: %v", key, err)
+	}
+	if ok && json.Unmarshal(data, out) == nil {
+		cacheHits.Add(1)
+		return true
+	}
+	cacheMisses.Add(1)
+	return false
+}
+
+// setCached stores value at key
+func (c *CachedStore) setCached(ctx context.Context, key string, value interface{}) {
+	if !isPrimaryRegion(ctx) {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = c.cache.Set(ctx, key, data, c.ttl)
+	}
+	if err != nil {
+		log.Printf("[CACHE] Set %s failed: %v", key, err)
+	}
+}
+
+// invalidate removes keys from the cache
+func (c *CachedStore) invalidate(ctx context.Context, keys ...string) {
+	if !isPrimaryRegion(ctx) {
+		return
+	}
+	if err := c.cache.Delete(ctx, keys...); err != nil {
+		log.Printf("[CACHE] Delete %v failed: %v", keys, err)
+	}
+}
+
+// InvalidateAnimation drops the cached copy of an animation changed outside the store, e.g. by a takedown
+func (c *CachedStore) InvalidateAnimation(ctx context.Context, id string) {
+	c.invalidate(ctx, append([]string{animationCacheKey(id)}, feedCacheKeys...)...)
+}
+
+func (c *CachedStore) GetAnimation(ctx context.Context, id string) (GetAnimationResponse, error) {
+	var animation GetAnimationResponse
+	if c.getCached(ctx, animationCacheKey(id), &animation) {
+		return animation, nil
+	}
+
+	animation, err := c.Store.GetAnimation(ctx, id)
+	if err != nil {
+		return animation, err
+	}
+	c.setCached(ctx, animationCacheKey(id), animation)
+	return animation, nil
+}
+
+func (c *CachedStore) AnimationExists(ctx context.Context, id string) bool {
+	var animation GetAnimationResponse
+	if c.getCached(ctx, animationCacheKey(id), &animation) {
+		return true
+	}
+	return c.Store.AnimationExists(ctx, id)
+}
+
+// GetRandomAnimation picks from a cached sample of eligible IDs and reads the animation through the cache
+func (c *CachedStore) GetRandomAnimation(ctx context.Context, filter FeedFilter) (GetAnimationResponse, error) {
+	key := feedCacheKey
+	if filter.ReducedMotion {
+		key = reducedMotionFeedCacheKey
+	} else if filter.AvoidFlashing {
+		key = screenedFeedCacheKey
+	}
+
+	var ids []string
+	if !c.getCached(ctx, key, &ids) {
+		var err error
+		if ids, err = c.Store.ListFeedAnimationIDs(ctx, filter, feedSampleSize); err != nil {
+			return GetAnimationResponse{}, err
+		}
+		c.setCached(ctx, key, ids)
+	}
+	if len(ids) == 0 {
+		return GetAnimationResponse{}, errors.New("no animations found")
+	}
+
+	animation, err := c.GetAnimation(ctx, ids[rand.Intn(len(ids))])
+	if err != nil {
+		// The sample is stale; drop it and let the store pick
+		c.invalidate(ctx, key)
+		return c.Store.GetRandomAnimation(ctx, filter)
+	}
+	return animation, nil
+}
+
+func (c *CachedStore) SaveAnimation(ctx context.Context, code string, description string, userId string, p5Version string) (string, error) {
+	id, err := c.Store.SaveAnimation(ctx, code, description, userId, p5Version)
+	if err == nil {
+		c.invalidate(ctx, feedCacheKeys...)
+	}
+	return id, err
+}
+
+func (c *CachedStore) UpdateAnimation(ctx context.Context, id, userId string, update UpdateAnimationRequest) error {
+	err := c.Store.UpdateAnimation(ctx, id, userId, update)
+	if err == nil {
+		c.invalidate(ctx, animationCacheKey(id))
+	}
+	return err
+}
+
+func (c *CachedStore) RestoreAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error) {
+	restored, err := c.Store.RestoreAnimationVersion(ctx, id, version, userId)
+	if err == nil {
+		c.invalidate(ctx, animationCacheKey(id))
+	}
+	return restored, err
+}
+
+func (c *CachedStore) DeleteAnimation(ctx context.Context, id, userId string, asAdmin bool) error {
+	err := c.Store.DeleteAnimation(ctx, id, userId, asAdmin)
+	if err == nil {
+		c.invalidate(ctx, append([]string{animationCacheKey(id)}, feedCacheKeys...)...)
+	}
+	return err
+}
+
+func (c *CachedStore) SetAnimationRenderStatus(ctx context.Context, id string, status string) error {
+	err := c.Store.SetAnimationRenderStatus(ctx, id, status)
+	if err == nil {
+		c.invalidate(ctx, feedCacheKeys...)
+	}
+	return err
+}
+
+func (c *CachedStore) SetAnimationPhotosensitivity(ctx context.Context, id string, report PhotosensitivityReport) error {
+	err := c.Store.SetAnimationPhotosensitivity(ctx, id, report)
+	if err == nil {
+		c.invalidate(ctx, feedCacheKeys...)
+	}
+	return err
+}
+
+// ApplySanitizationFixes drops the cached copies of the animations whose code the fixes rewrote
+func (c *CachedStore) ApplySanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) ([]string, error) {
+	applied, err := c.Store.ApplySanitizationFixes(ctx, runId, fixIds, adminId)
+	for _, id := range applied {
+		c.invalidate(ctx, animationCacheKey(id))
+	}
+	return applied, err
+}
+
+// DecideAnimationReview drops the feed samples, since approved animations join the feed
+func (c *CachedStore) DecideAnimationReview(ctx context.Context, animationId, status, reviewerId, note string) (AnimationReview, error) {
+	review, err := c.Store.DecideAnimationReview(ctx, animationId, status, reviewerId, note)
+	if err == nil {
+		c.invalidate(ctx, feedCacheKeys...)
+	}
+	return review, err
+}
+
+// memoryCacheEntry is a value held by MemoryCache
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryCache is an in-process Cache for tests and single-instance deployments
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	now     func() time.Time
+}
+
+// NewMemoryCache returns an empty in-process cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry), now: time.Now}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok || !m.now().Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = memoryCacheEntry{value: append([]byte(nil), value...), expiresAt: m.now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Both implementations must satisfy Cache
+var (
+	_ Cache = (*RedisCache)(nil)
+	_ Cache = (*MemoryCache)(nil)
+)
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingStore counts animation reads that reach the underlying store
+type countingStore struct {
+	Store
+	reads int
+}
+
+func (c *countingStore) GetAnimation(ctx context.Context, id string) (GetAnimationResponse, error) {
+	c.reads++
+	return c.Store.GetAnimation(ctx, id)
+}
+
+func TestCachedStoreReadThrough(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemoryStore()
+	userId, _ := memory.CreateUserWithUsername(ctx, "owner@example.com", "owner", "hash")
+	counting := &countingStore{Store: memory}
+	store := NewCachedStore(counting, NewMemoryCache(), time.Minute)
+
+	id, err := store.SaveAnimation(ctx, "function draw() {}", "calm", userId, "")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if animation, err := store.GetAnimation(ctx, id); err != nil || animation.Code != "function draw() {}" {
+			t.Fatalf("get = %+v, %v", animation, err)
+		}
+	}
+	if counting.reads != 1 {
+		t.Errorf("store reads = %d, want 1", counting.reads)
+	}
+
+	newCode := "function draw() { background(0); }"
+	if err := store.UpdateAnimation(ctx, id, userId, UpdateAnimationRequest{Code: &newCode}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if animation, _ := store.GetAnimation(ctx, id); animation.Code != newCode {
+		t.Errorf("code after update = %q, want %q", animation.Code, newCode)
+	}
+	if counting.reads != 2 {
+		t.Errorf("store reads after update = %d, want 2", counting.reads)
+	}
+
+	feed, err := store.GetRandomAnimation(ctx, FeedFilter{})
+	if err != nil || feed.ID != id || feed.Code != newCode {
+		t.Errorf("feed = %+v, %v, want the updated animation", feed, err)
+	}
+	if counting.reads != 2 {
+		t.Errorf("store reads after feed = %d, want 2", counting.reads)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewMemoryCache()
+	cache.now = func() time.Time { return now }
+
+	cache.Set(ctx, "key", []byte("value"), time.Minute)
+	if value, ok, _ := cache.Get(ctx, "key"); !ok || string(value) != "value" {
+		t.Fatalf("get = %q, %v, want value", value, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "key"); ok {
+		t.Error("entry still cached after its TTL")
+	}
+}
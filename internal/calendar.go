@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// calendarFeedWindow is how far back a calendar feed reaches; older check-ins are left out so
+	// feeds stay small enough for calendar apps that poll them
+	calendarFeedWindow = 365 * 24 * time.Hour
+	// calendarEventDuration is how long each check-in is shown for. Check-ins are instants, but
+	// calendar apps hide events that take no time.
+	calendarEventDuration = 15 * time.Minute
+	// calendarLineLength is the most octets RFC 5545 allows on one line before it is folded
+	calendarLineLength = 75
+	icsTimeLayout      = "20060102T150405Z"
+)
+
+// calendarEscaper escapes the characters RFC 5545 gives a meaning in text values
+var calendarEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// newCalendarToken returns a random calendar token and the hash it is stored under
+func newCalendarToken() (string, string, error) {
+	token, err := generateRandomID()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// listCalendarMoods returns the moods a user recorded within calendarFeedWindow of now, newest first
+func listCalendarMoods(ctx context.Context, store Store, userId string, now time.Time) ([]MoodEntry, error) {
+	var moods []MoodEntry
+	for offset := 0; ; offset += reportPageSize {
+		page, total, err := store.ListMoods(ctx, userId, now.Add(-calendarFeedWindow), time.Time{}, reportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		moods = append(moods, page...)
+		if len(page) == 0 || offset+len(page) >= total {
+			return moods, nil
+		}
+	}
+}
+
+// renderMoodCalendar writes a user's mood check-ins as an iCalendar feed with one event each.
+// Each event's UID is stable across polls, so calendar apps update check-ins rather than repeat them.
+func renderMoodCalendar(userId, username string, moods []MoodEntry, now time.Time) []byte {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		writeCalendarLine(&buf, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//animate-server//Mood check-ins//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", calendarEscaper.Replace("Mood check-ins ("+username+")"))
+	line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	line("X-PUBLISHED-TTL", "PT1H")
+	for _, mood := range moods {
+		start := mood.CreatedAt.UTC()
+		line("BEGIN", "VEVENT")
+		// A user has one mood per animation, which a new check-in replaces
+		uid := HashToken(userId + ":" + mood.AnimationID)[:32]
+		line("UID", uid+"@animate-server")
+		line("DTSTAMP", now.UTC().Format(icsTimeLayout))
+		line("DTSTART", start.Format(icsTimeLayout))
+		line("DTEND", start.Add(calendarEventDuration).Format(icsTimeLayout))
+		line("SUMMARY", calendarEscaper.Replace("Felt "+string(mood.Mood)))
+		if mood.AnimationDescription != "" {
+			line("DESCRIPTION", calendarEscaper.Replace("After watching \""+mood.AnimationDescription+"\""))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+// writeCalendarLine writes a content line ended by CRLF, folding it into lines of at most
+// calendarLineLength octets without splitting a UTF-8 character
+func writeCalendarLine(buf *bytes.Buffer, content string) {
+	limit := calendarLineLength
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		buf.WriteString(content[:cut])
+		buf.WriteString("\r\n ")
+		content = content[cut:]
+		// The space that continues a folded line counts towards its length
+		limit = calendarLineLength - 1
+	}
+	buf.WriteString(content)
+	buf.WriteString("\r\n")
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCalendarLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "Short", content: "SUMMARY:Felt better", want: "SUMMARY:Felt better\r\n"},
+		{name: "Folded", content: "X:" + strings.Repeat("a", 150), want: "X:" + strings.Repeat("a", 73) + "\r\n " + strings.Repeat("a", 74) + "\r\n " + strings.Repeat("a", 3) + "\r\n"},
+		{name: "Multibyte kept whole", content: "X:" + strings.Repeat("a", 72) + "ë", want: "X:" + strings.Repeat("a", 72) + "\r\n ë\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeCalendarLine(&buf, tt.content)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeCalendarLine() = %q, want %q", got, tt.want)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+				if len(line) > calendarLineLength {
+					t.Errorf("line %q is %d octets long", line, len(line))
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMoodCalendar(t *testing.T) {
+	at := time.Date(2026, 3, 4, 18, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	moods := []MoodEntry{
+		{AnimationID: "a1", AnimationDescription: "rain, then sun; slowly", Mood: MoodMuchBetter, CreatedAt: at},
+		{AnimationID: "a2", Mood: MoodWorse, CreatedAt: at.Add(-time.Hour)},
+	}
+	ics := string(renderMoodCalendar("u1", "sam", moods, at))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Mood check-ins (sam)\r\n",
+		"DTSTART:20260304T233000Z\r\nDTEND:20260304T234500Z\r\n",
+		"SUMMARY:Felt much better\r\n",
+		`DESCRIPTION:After watching "rain\, then sun\; slowly"` + "\r\n",
+		"SUMMARY:Felt worse\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar is missing %q", want)
+		}
+	}
+	if strings.Count(ics, "BEGIN:VEVENT") != 2 || strings.Count(ics, "DESCRIPTION:") != 1 {
+		t.Errorf("calendar = %q, want two events and one description", ics)
+	}
+
+	// A check-in keeps its UID when polled again later, but not across users
+	uid := "UID:" + HashToken("u1:a1")[:32] + "@animate-server\r\n"
+	if again := string(renderMoodCalendar("u1", "sam", moods[:1], at.Add(time.Hour))); !strings.Contains(ics, uid) || !strings.Contains(again, uid) {
+		t.Errorf("UID %q is not stable", uid)
+	}
+	if other := string(renderMoodCalendar("u2", "kim", moods[:1], at)); strings.Contains(other, uid) {
+		t.Errorf("another user's calendar reuses UID %q", uid)
+	}
+}
+
+func TestCalendarFeedHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	sam := registerAccount(t, router, "sam")
+	animationId, _ := store.SaveAnimation(ctx, "function draw() {}", "waves", sam.User.ID, "")
+	store.SaveMood(ctx, sam.User.ID, animationId, string(MoodBetter))
+
+	var first CalendarFeed
+	if code := doJSON(t, router, http.MethodPost, "/me/calendar-feed", sam.Token, nil, &first); code != http.StatusCreated {
+		t.Fatalf("create status = %d", code)
+	}
+	if !strings.HasSuffix(first.URL, "/me/moods.ics?token="+url.QueryEscape(first.Token)) {
+		t.Errorf("url = %q, want the feed with token %q", first.URL, first.Token)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/me/moods.ics?token="+url.QueryEscape(first.Token), nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("feed = %d %s, want a calendar", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "SUMMARY:Felt better") || !strings.Contains(body, `After watching "waves"`) {
+		t.Errorf("feed = %q, want the check-in", body)
+	}
+
+	// Issuing a new token retires the old one
+	var second CalendarFeed
+	doJSON(t, router, http.MethodPost, "/me/calendar-feed", sam.Token, nil, &second)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		wantCode int
+	}{
+		{name: "Current token", method: http.MethodGet, path: "/me/moods.ics?token=" + url.QueryEscape(second.Token), wantCode: http.StatusOK},
+		{name: "Replaced token", method: http.MethodGet, path: "/me/moods.ics?token=" + url.QueryEscape(first.Token), wantCode: http.StatusNotFound},
+		{name: "No token", method: http.MethodGet, path: "/me/moods.ics", wantCode: http.StatusBadRequest},
+		{name: "Session token", method: http.MethodGet, path: "/me/moods.ics?token=" + url.QueryEscape(sam.Token), wantCode: http.StatusNotFound},
+		{name: "Create signed out", method: http.MethodPost, path: "/me/calendar-feed", wantCode: http.StatusUnauthorized},
+		{name: "Delete", method: http.MethodDelete, path: "/me/calendar-feed", token: sam.Token, wantCode: http.StatusNoContent},
+		{name: "Deleted token", method: http.MethodGet, path: "/me/moods.ics?token=" + url.QueryEscape(second.Token), wantCode: http.StatusNotFound},
+		{name: "Delete again", method: http.MethodDelete, path: "/me/calendar-feed", token: sam.Token, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, nil, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
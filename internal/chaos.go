@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Dependencies faults can be injected into
+const (
+	ChaosTargetDB     = "db"
+	ChaosTargetClaude = "claude"
+)
+
+// errChaosFault is returned by calls failed on purpose by chaos mode
+var errChaosFault = errors.New("chaos: injected fault")
+
+// ChaosRule slows down or fails calls to a dependency made while serving a route
+type ChaosRule struct {
+	// Route is a route template such as /animation/{id}, or * for every route
+	Route string `json:"route"`
+	// Target is db or claude; empty targets both
+	Target         string  `json:"target"`
+	LatencyMs      int     `json:"latencyMs"`
+	LatencyPercent float64 `json:"latencyPercent"`
+	ErrorPercent   float64 `json:"errorPercent"`
+}
+
+type chaosRulesContextKey struct{}
+
+// chaosAllowed reports whether APP_ENV names an environment chaos mode may run in
+func chaosAllowed(env string) bool {
+	switch strings.ToLower(strings.TrimSpace(env)) {
+	case "development", "dev", "local", "staging", "test":
+		return true
+	}
+	return false
+}
+
+// parseChaosRules parses the JSON array of rules in CHAOS_RULES
+func parseChaosRules(raw string) ([]ChaosRule, error) {
+	var rules []ChaosRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("CHAOS_RULES is not a JSON array of rules: %v", err)
+	}
+	for _, rule := range rules {
+		switch {
+		case rule.Route == "":
+			return nil, errors.New("CHAOS_RULES has a rule without a route")
+		case rule.Target != "" && rule.Target != ChaosTargetDB && rule.Target != ChaosTargetClaude:
+			return nil, fmt.Errorf("CHAOS_RULES has unknown target %q", rule.Target)
+		case rule.LatencyMs < 0 || rule.LatencyPercent < 0 || rule.LatencyPercent > 100 || rule.ErrorPercent < 0 || rule.ErrorPercent > 100:
+			return nil, fmt.Errorf("CHAOS_RULES rule for %s needs a non-negative latency and percentages from 0 to 100", rule.Route)
+		}
+	}
+	return rules, nil
+}
+
+// ChaosRules returns the fault injection rules when CHAOS_ENABLED is set in a development or
+// staging APP_ENV, and nil otherwise. Chaos mode never runs in production.
+func ChaosRules() []ChaosRule {
+	if enabled, _ := envBool("CHAOS_ENABLED"); !enabled {
+		return nil
+	}
+	if !chaosAllowed(os.Getenv("APP_ENV")) {
+		log.Printf("[CHAOS] CHAOS_ENABLED is ignored in APP_ENV %q; use development or staging", os.Getenv("APP_ENV"))
+		return nil
+	}
+	rules, err := parseChaosRules(os.Getenv("CHAOS_RULES"))
+	if err != nil {
+		log.Printf("[CHAOS] Chaos mode disabled: %v", err)
+		return nil
+	}
+	return rules
+}
+
+// ChaosMiddleware attaches the rules matching each request's route to its context, where database and
+// Claude calls pick them up. It must be registered on the router so the matched route is known.
+func ChaosMiddleware() func(http.Handler) http.Handler {
+	rules := ChaosRules()
+	if len(rules) > 0 {
+		log.Printf("[CHAOS] Fault injection enabled with %d rules", len(rules))
+	}
+	return func(next http.Handler) http.Handler {
+		if len(rules) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			var matching []ChaosRule
+			for _, rule := range rules {
+				if rule.Route == "*" || rule.Route == route {
+					matching = append(matching, rule)
+				}
+			}
+			if len(matching) > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), chaosRulesContextKey{}, matching))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// injectFault applies ctx's chaos rules for target: it may sleep, returning early with ctx's error
+// when the deadline passes first, and may fail the call outright
+func injectFault(ctx context.Context, target string) error {
+	rules, _ := ctx.Value(chaosRulesContextKey{}).([]ChaosRule)
+	for _, rule := range rules {
+		if rule.Target != "" && rule.Target != target {
+			continue
+		}
+		if rule.LatencyMs > 0 && rand.Float64()*100 < rule.LatencyPercent {
+			log.Printf("[CHAOS] Delaying %s call by %dms", target, rule.LatencyMs)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+			}
+		}
+		if rand.Float64()*100 < rule.ErrorPercent {
+			log.Printf("[CHAOS] Failing %s call", target)
+			return errChaosFault
+		}
+	}
+	return nil
+}
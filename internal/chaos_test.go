@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestChaosRules(t *testing.T) {
+	validRules := `[{"route": "/feed", "target": "db", "errorPercent": 100}]`
+	tests := []struct {
+		name      string
+		enabled   string
+		appEnv    string
+		rules     string
+		wantRules int
+	}{
+		{name: "Disabled", appEnv: "staging", rules: validRules},
+		{name: "Staging", enabled: "true", appEnv: "staging", rules: validRules, wantRules: 1},
+		{name: "Never in production", enabled: "true", appEnv: "production", rules: validRules},
+		{name: "Never without APP_ENV", enabled: "true", rules: validRules},
+		{name: "Not JSON", enabled: "true", appEnv: "development", rules: "/feed=100"},
+		{name: "Unknown target", enabled: "true", appEnv: "development", rules: `[{"route": "*", "target": "redis", "errorPercent": 5}]`},
+		{name: "Percentage out of range", enabled: "true", appEnv: "development", rules: `[{"route": "*", "latencyMs": 10, "latencyPercent": 150}]`},
+		{name: "Missing route", enabled: "true", appEnv: "development", rules: `[{"errorPercent": 5}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CHAOS_ENABLED", tt.enabled)
+			t.Setenv("APP_ENV", tt.appEnv)
+			t.Setenv("CHAOS_RULES", tt.rules)
+			if got := ChaosRules(); len(got) != tt.wantRules {
+				t.Errorf("ChaosRules() = %+v, want %d rules", got, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	t.Setenv("CHAOS_ENABLED", "true")
+	t.Setenv("APP_ENV", "staging")
+	t.Setenv("CHAOS_RULES", `[
+		{"route": "/animation/{id}", "target": "db", "errorPercent": 100},
+		{"route": "*", "target": "claude", "latencyMs": 5000, "latencyPercent": 100}
+	]`)
+
+	var dbErr, claudeErr error
+	r := mux.NewRouter()
+	r.Use(ChaosMiddleware())
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		dbErr = injectFault(r.Context(), ChaosTargetDB)
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Millisecond)
+		defer cancel()
+		claudeErr = injectFault(ctx, ChaosTargetClaude)
+	}
+	r.HandleFunc("/animation/{id}", handler)
+	r.HandleFunc("/feed", handler)
+
+	tests := []struct {
+		path      string
+		wantDBErr error
+	}{
+		{path: "/animation/abc", wantDBErr: errChaosFault},
+		{path: "/feed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			start := time.Now()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if !errors.Is(dbErr, tt.wantDBErr) {
+				t.Errorf("db fault = %v, want %v", dbErr, tt.wantDBErr)
+			}
+			// The injected latency gives way to the caller's timeout
+			if !errors.Is(claudeErr, context.DeadlineExceeded) {
+				t.Errorf("claude fault = %v, want %v", claudeErr, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("request took %v, want the timeout to cut the latency short", elapsed)
+			}
+		})
+	}
+
+	if err := injectFault(context.Background(), ChaosTargetDB); err != nil {
+		t.Errorf("fault outside a request = %v, want none", err)
+	}
+}
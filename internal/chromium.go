@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// defaultRendererP5URL is the p5.js build sketches are rendered with unless RENDERER_P5_URL is set
+const defaultRendererP5URL = "https://cdn.jsdelivr.net/npm/p5@1.9.4/lib/p5.min.js"
+
+// chromiumHarness runs a sketch in a blank page and resolves to its RenderResult
+//
+//go:embed chromium_harness.js
+var chromiumHarness string
+
+// chromiumRenderer renders sketches in tabs of one headless Chromium, started on the first render
+// and again whenever it has exited
+type chromiumRenderer struct {
+	execPath string
+	p5URL    string
+	slots    chan struct{}
+
+	mu      sync.Mutex
+	browser context.Context
+	cancel  context.CancelFunc
+}
+
+// newChromiumRenderer returns a renderer driving the Chromium binary at execPath, rendering at
+// most poolSize sketches at once with the p5.js build at p5URL
+func newChromiumRenderer(execPath, p5URL string, poolSize int) *chromiumRenderer {
+	return &chromiumRenderer{execPath: execPath, p5URL: p5URL, slots: make(chan struct{}, poolSize)}
+}
+
+// browserContext returns the context of the running browser, starting it if it is not running
+func (c *chromiumRenderer) browserContext() (context.Context, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.browser != nil && c.browser.Err() == nil {
+		return c.browser, nil
+	}
+
+	options := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(c.execPath))
+	allocator, cancelAllocator := chromedp.NewExecAllocator(context.Background(), options...)
+	browser, cancelBrowser := chromedp.NewContext(allocator)
+	if err := chromedp.Run(browser); err != nil {
+		cancelBrowser()
+		cancelAllocator()
+		return nil, fmt.Errorf("failed to start Chromium: %w", err)
+	}
+	c.browser = browser
+	c.cancel = func() {
+		cancelBrowser()
+		cancelAllocator()
+	}
+	return browser, nil
+}
+
+// Render runs the sketch in a new tab, waiting for a free slot in the pool. A sketch that hangs
+// the tab past its timeout is reported as a sketch error, as one that throws is.
+func (c *chromiumRenderer) Render(ctx context.Context, req RenderRequest) (RenderResult, error) {
+	select {
+	case c.slots <- struct{}{}:
+		defer func() { <-c.slots }()
+	case <-ctx.Done():
+		return RenderResult{}, fmt.Errorf("waiting for renderer: %w", ctx.Err())
+	}
+
+	browser, err := c.browserContext()
+	if err != nil {
+		return RenderResult{}, err
+	}
+	tab, cancelTab := chromedp.NewContext(browser)
+	defer cancelTab()
+	// The harness times the sketch out itself unless a single frame hangs the page
+	tab, cancelTimeout := context.WithTimeout(tab, time.Duration(req.TimeoutMs)*time.Millisecond+5*time.Second)
+	defer cancelTimeout()
+	stop := context.AfterFunc(ctx, cancelTab)
+	defer stop()
+
+	input, err := json.Marshal(map[string]any{"request": req, "p5URL": c.p5URL})
+	if err != nil {
+		return RenderResult{}, fmt.Errorf("failed to marshal render request: %w", err)
+	}
+	var result RenderResult
+	err = chromedp.Run(tab,
+		chromedp.Navigate("about:blank"),
+		chromedp.Evaluate(chromiumHarness+"("+string(input)+")", &result, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}),
+	)
+	switch {
+	case err == nil:
+		return result, nil
+	case ctx.Err() != nil:
+		return RenderResult{}, fmt.Errorf("renderer failed: %w", ctx.Err())
+	case errors.Is(err, context.DeadlineExceeded):
+		return RenderResult{Error: fmt.Sprintf("the sketch stopped responding within %dms", req.TimeoutMs)}, nil
+	default:
+		return RenderResult{}, fmt.Errorf("renderer failed: %w", err)
+	}
+}
+
+// Close stops the browser
+func (c *chromiumRenderer) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+		c.browser, c.cancel = nil, nil
+	}
+}
+
+// RendererP5URL returns the p5.js build the Chromium renderer loads, configured by RENDERER_P5_URL
+func RendererP5URL() string {
+	if url := os.Getenv("RENDERER_P5_URL"); url != "" {
+		return url
+	}
+	return defaultRendererP5URL
+}
@@ -0,0 +1,140 @@
+// Runs a p5.js sketch in global mode in the blank page of a headless Chromium tab and resolves to
+// the RenderResult the server reads. Frames are drawn one after another as fast as the sketch
+// allows rather than at the display's frame rate, so a two second smoke test does not take two
+// seconds of wall time.
+(async function ({ request, p5URL }) {
+  const result = { frameHashes: [], frameStats: [], captures: [] };
+  const captureFrames = new Set(request.captureFrames || []);
+  let finished = false;
+  let finish;
+  const done = new Promise((resolve) => { finish = resolve; });
+  const fail = (error) => {
+    if (finished) return;
+    finished = true;
+    result.error = error instanceof Error ? `${error.name}: ${error.message}` : String(error);
+    finish();
+  };
+  window.addEventListener('error', (event) => fail(event.error || event.message));
+  window.addEventListener('unhandledrejection', (event) => fail(event.reason));
+
+  await new Promise((resolve, reject) => {
+    const script = document.createElement('script');
+    script.src = p5URL;
+    script.onload = resolve;
+    script.onerror = () => reject(new Error(`failed to load p5.js from ${p5URL}`));
+    document.head.appendChild(script);
+  });
+
+  // Syntax errors and top-level exceptions are reported through the error listener
+  const sketch = document.createElement('script');
+  sketch.textContent = request.code;
+  document.body.appendChild(sketch);
+  if (finished) return { error: result.error };
+
+  // Relative luminance of each 8-bit sRGB channel value, as WCAG defines it
+  const linear = new Float64Array(256);
+  for (let i = 0; i < 256; i++) {
+    const c = i / 255;
+    linear[i] = c <= 0.03928 ? c / 12.92 : Math.pow((c + 0.055) / 1.055, 2.4);
+  }
+  const scratch = document.createElement('canvas').getContext('2d', { willReadFrequently: true });
+  let previous = null;
+
+  // record hashes the canvas after a frame, measures it for the photosensitivity screen and
+  // captures it when asked to
+  const record = (frame) => {
+    const canvas = document.querySelector('canvas');
+    if (!canvas) throw new Error('the sketch has no canvas');
+    scratch.canvas.width = canvas.width;
+    scratch.canvas.height = canvas.height;
+    scratch.drawImage(canvas, 0, 0);
+    const { data } = scratch.getImageData(0, 0, canvas.width, canvas.height);
+
+    // cyrb53, a 53-bit hash quick enough to run over every pixel of every frame
+    let h1 = 0xdeadbeef ^ request.seed;
+    let h2 = 0x41c6ce57 ^ request.seed;
+    let luminance = 0;
+    let red = 0;
+    let changed = 0;
+    for (let i = 0; i < data.length; i += 4) {
+      const r = data[i], g = data[i + 1], b = data[i + 2];
+      const pixel = (r << 24 | g << 16 | b << 8 | data[i + 3]) >>> 0;
+      h1 = Math.imul(h1 ^ pixel, 2654435761);
+      h2 = Math.imul(h2 ^ pixel, 1597334677);
+      luminance += 0.2126 * linear[r] + 0.7152 * linear[g] + 0.0722 * linear[b];
+      if (r + g + b > 0 && r / (r + g + b) >= 0.8) red++;
+      if (previous && (previous[i] !== r || previous[i + 1] !== g || previous[i + 2] !== b)) changed++;
+    }
+    h1 = Math.imul(h1 ^ (h1 >>> 16), 2246822507) ^ Math.imul(h2 ^ (h2 >>> 13), 3266489909);
+    h2 = Math.imul(h2 ^ (h2 >>> 16), 2246822507) ^ Math.imul(h1 ^ (h1 >>> 13), 3266489909);
+    const hash = 4294967296 * (2097151 & h2) + (h1 >>> 0);
+    result.frameHashes.push(hash.toString(16).padStart(14, '0'));
+
+    const pixels = data.length / 4 || 1;
+    result.frameStats.push({ luminance: luminance / pixels, red: red / pixels, changed: previous ? changed / pixels : 0 });
+    previous = data;
+    if (captureFrames.has(frame)) {
+      result.captures.push(canvas.toDataURL('image/png').slice('data:image/png;base64,'.length));
+    }
+  };
+
+  const channel = new MessageChannel();
+  const userSetup = window.setup;
+  const userDraw = window.draw;
+  let frame = 0;
+  let drawMs = 0;
+  window.setup = function () {
+    randomSeed(request.seed);
+    noiseSeed(request.seed);
+    if (userSetup) userSetup();
+    // Frames are driven by step below, not by the display. p5.js draws the first frame once
+    // setup returns, and step picks up from the next one.
+    noLoop();
+    channel.port2.postMessage(null);
+  };
+  window.draw = function () {
+    const started = performance.now();
+    if (userDraw) userDraw();
+    drawMs += performance.now() - started;
+    frame++;
+    record(frame);
+  };
+
+  // step draws the next frame, yielding between frames so the timeout and errors get through
+  const step = () => {
+    if (finished) return;
+    if (frame >= request.frames) {
+      finished = true;
+      finish();
+      return;
+    }
+    try {
+      redraw();
+    } catch (error) {
+      fail(error);
+      return;
+    }
+    channel.port2.postMessage(null);
+  };
+  channel.port1.onmessage = step;
+  const timeout = setTimeout(() => fail(new Error(`the sketch did not draw ${request.frames} frames within ${request.timeoutMs}ms`)), request.timeoutMs);
+
+  // The page has long loaded, so p5.js will not start global mode itself. Unless the sketch
+  // preloads files, setup runs and draws the first frame before the constructor returns.
+  try {
+    new p5();
+  } catch (error) {
+    fail(error);
+  }
+  await done;
+  clearTimeout(timeout);
+  channel.port1.close();
+
+  result.avgFrameMs = frame > 0 ? drawMs / frame : 0;
+  if (performance.memory) result.heapUsedBytes = performance.memory.usedJSHeapSize;
+  if (result.error) {
+    delete result.frameStats;
+    delete result.captures;
+  }
+  return result;
+})
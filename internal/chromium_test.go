@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testChromiumRenderer returns a renderer driving the Chromium at CHROMIUM_PATH, loading p5.js from
+// RENDERER_P5_URL or the CDN. Tests using it are skipped when CHROMIUM_PATH is unset.
+func testChromiumRenderer(t *testing.T) *chromiumRenderer {
+	t.Helper()
+	path := os.Getenv("CHROMIUM_PATH")
+	if path == "" {
+		t.Skip("CHROMIUM_PATH is not set")
+	}
+	renderer := newChromiumRenderer(path, RendererP5URL(), 1)
+	t.Cleanup(renderer.Close)
+	return renderer
+}
+
+func TestChromiumRenderer(t *testing.T) {
+	renderer := testChromiumRenderer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Seeded randomness renders the same frames every time, and captures are PNGs of the canvas
+	sketch := "function setup() { createCanvas(64, 48); }\nfunction draw() { background(random(255), 0, 0); }"
+	req := RenderRequest{Code: sketch, Seed: determinismSeed, Frames: 10, TimeoutMs: 10000, CaptureFrames: []int{10}}
+	first, err := renderer.Render(ctx, req)
+	if err != nil || first.Error != "" {
+		t.Fatalf("Render() = %+v, %v", first, err)
+	}
+	if len(first.FrameHashes) != 10 || len(first.FrameStats) != 10 || len(first.Captures) != 1 {
+		t.Fatalf("rendered %d hashes, %d stats and %d captures, want 10, 10 and 1", len(first.FrameHashes), len(first.FrameStats), len(first.Captures))
+	}
+	if first.FrameHashes[0] == first.FrameHashes[1] || first.FrameStats[1].Changed == 0 {
+		t.Errorf("frames 1 and 2 look the same, want a new random background each frame")
+	}
+	data, err := base64.StdEncoding.DecodeString(first.Captures[0])
+	if err != nil {
+		t.Fatalf("capture is not base64: %v", err)
+	}
+	if image, err := png.Decode(bytes.NewReader(data)); err != nil || image.Bounds().Dx() != 64 || image.Bounds().Dy() != 48 {
+		t.Errorf("capture = %v, %v, want a 64x48 PNG", image, err)
+	}
+	report, err := CheckDeterminism(ctx, renderer, sketch)
+	if err != nil || report.Status != RenderStatusOK || report.Photosensitivity == nil {
+		t.Errorf("CheckDeterminism() = %+v, %v, want a screened %q", report, err, RenderStatusOK)
+	}
+
+	// Sketches that throw, or never finish a frame, are reported as the sketch's errors
+	for name, tt := range map[string]struct {
+		code string
+		want string
+	}{
+		"Syntax error":  {code: "function setup( {", want: "SyntaxError"},
+		"Throws":        {code: "function draw() { if (frameCount > 3) missing(); }", want: "ReferenceError: missing is not defined"},
+		"Never returns": {code: "function draw() { while (true) {} }", want: "stopped responding"},
+	} {
+		result, err := renderer.Render(ctx, RenderRequest{Code: tt.code, Seed: determinismSeed, Frames: 10, TimeoutMs: 1000})
+		if err != nil || !strings.Contains(result.Error, tt.want) {
+			t.Errorf("%s: Render() = %+v, %v, want an error containing %q", name, result, err, tt.want)
+		}
+	}
+
+	// The browser survives the tab that hung
+	if result, err := renderer.Render(ctx, req); err != nil || result.Error != "" {
+		t.Errorf("Render() after a hung sketch = %+v, %v", result, err)
+	}
+}
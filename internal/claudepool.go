@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for how many Claude calls run at once
+const (
+	defaultClaudeMaxConcurrent = 8
+	defaultClaudeMaxQueued     = 100
+)
+
+// ErrClaudeBusy is returned by Claude calls that found every slot taken and too many calls
+// already waiting for one
+var ErrClaudeBusy = errors.New("too many generations are waiting for Claude; try again shortly")
+
+// callPool caps how many calls run at once. Calls beyond the cap wait their turn, in no particular
+// order, unless too many are waiting already.
+type callPool struct {
+	// slots holds a token per running call; nil leaves calls uncapped
+	slots chan struct{}
+	// maxQueued is how many calls may wait for a slot; 0 lets any number wait
+	maxQueued int64
+	running   atomic.Int64
+	queued    atomic.Int64
+	rejected  atomic.Int64
+	// waitNanos is the total time calls spent waiting for a slot
+	waitNanos atomic.Int64
+}
+
+// newCallPool returns a pool running up to maxConcurrent calls at once, 0 for any number, with up
+// to maxQueued waiting, 0 for any number
+func newCallPool(maxConcurrent, maxQueued int) *callPool {
+	pool := &callPool{maxQueued: int64(maxQueued)}
+	if maxConcurrent > 0 {
+		pool.slots = make(chan struct{}, maxConcurrent)
+	}
+	return pool
+}
+
+// acquire waits for a slot until ctx is done and returns the function that gives it back. It
+// fails at once with ErrClaudeBusy when the queue is full.
+func (p *callPool) acquire(ctx context.Context) (func(), error) {
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			if queued := p.queued.Add(1); p.maxQueued > 0 && queued > p.maxQueued {
+				p.queued.Add(-1)
+				p.rejected.Add(1)
+				return nil, ErrClaudeBusy
+			}
+			start := time.Now()
+			select {
+			case p.slots <- struct{}{}:
+				p.queued.Add(-1)
+				p.waitNanos.Add(int64(time.Since(start)))
+			case <-ctx.Done():
+				p.queued.Add(-1)
+				p.waitNanos.Add(int64(time.Since(start)))
+				return nil, ctx.Err()
+			}
+		}
+	}
+	p.running.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.running.Add(-1)
+			if p.slots != nil {
+				<-p.slots
+			}
+		})
+	}, nil
+}
+
+var (
+	claudePoolOnce sync.Once
+	claudePool     *callPool
+)
+
+// ClaudeCallPool returns the pool every Claude call on this instance runs in, configured by
+// CLAUDE_MAX_CONCURRENT and CLAUDE_MAX_QUEUED, so bursts of generations queue instead of opening
+// an outbound request each. Calls with a user's own OpenAI key are not counted.
+func ClaudeCallPool() *callPool {
+	claudePoolOnce.Do(func() {
+		maxConcurrent := envLimit("CLAUDE_MAX_CONCURRENT", defaultClaudeMaxConcurrent)
+		maxQueued := envLimit("CLAUDE_MAX_QUEUED", defaultClaudeMaxQueued)
+		log.Printf("[CLAUDE] Running up to %d calls at once with up to %d waiting (0 for no limit)", maxConcurrent, maxQueued)
+		claudePool = newCallPool(maxConcurrent, maxQueued)
+	})
+	return claudePool
+}
+
+// writeClaudePoolMetrics reports how busy the Claude call pool is
+func writeClaudePoolMetrics(w io.Writer) {
+	pool := ClaudeCallPool()
+	writeMetric(w, "animate_claude_max_concurrent_calls", "gauge", "Claude calls allowed at once, 0 for no limit.", float64(cap(pool.slots)))
+	writeMetric(w, "animate_claude_calls_running", "gauge", "Claude calls currently running.", float64(pool.running.Load()))
+	writeMetric(w, "animate_claude_calls_queued", "gauge", "Claude calls waiting for a slot.", float64(pool.queued.Load()))
+	writeMetric(w, "animate_claude_calls_rejected_total", "counter", "Total Claude calls turned away because too many were waiting.", float64(pool.rejected.Load()))
+	writeMetric(w, "animate_claude_queue_wait_seconds_total", "counter", "Total time Claude calls spent waiting for a slot.", time.Duration(pool.waitNanos.Load()).Seconds())
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallPool(t *testing.T) {
+	pool := newCallPool(1, 1)
+	release, err := pool.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		next, err := pool.acquire(context.Background())
+		if err != nil {
+			t.Errorf("queued acquire: %v", err)
+		}
+		acquired <- next
+	}()
+	for pool.queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := pool.acquire(context.Background()); !errors.Is(err, ErrClaudeBusy) {
+		t.Errorf("acquire with a full queue = %v, want ErrClaudeBusy", err)
+	}
+	if pool.rejected.Load() != 1 {
+		t.Errorf("rejected = %d, want 1", pool.rejected.Load())
+	}
+
+	// Releasing twice gives back one slot only
+	release()
+	release()
+	next := <-acquired
+	if pool.running.Load() != 1 || pool.queued.Load() != 0 {
+		t.Errorf("running = %d, queued = %d, want the waiting call running", pool.running.Load(), pool.queued.Load())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire past the deadline = %v, want context.DeadlineExceeded", err)
+	}
+	next()
+	if pool.running.Load() != 0 || pool.waitNanos.Load() == 0 {
+		t.Errorf("running = %d, waited %v, want an idle pool that counted the waits", pool.running.Load(), time.Duration(pool.waitNanos.Load()))
+	}
+
+	unlimited := newCallPool(0, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := unlimited.acquire(context.Background()); err != nil {
+			t.Fatalf("unlimited acquire: %v", err)
+		}
+	}
+	if unlimited.running.Load() != 3 {
+		t.Errorf("unlimited running = %d, want 3", unlimited.running.Load())
+	}
+}
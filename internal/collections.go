@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxCollectionTitleLength       = 80
+	maxCollectionDescriptionLength = 500
+	// maxCollectionAnimations is how many animations one collection may hold
+	maxCollectionAnimations = 200
+	// maxCollections is how many collections each user may keep
+	maxCollections = 50
+	// collectionFeedMaxAge is how long feed readers and proxies may reuse a page of a collection's feed
+	collectionFeedMaxAge = 15 * time.Minute
+)
+
+// Formats a collection's feed is syndicated in
+const (
+	CollectionFeedJSON = "json"
+	CollectionFeedRSS  = "rss"
+)
+
+// jsonFeedVersion identifies the JSON Feed format in each feed
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// ValidateCollection checks a collection request and returns the collection it describes, with
+// repeated animations listed once
+func ValidateCollection(req CollectionRequest) (Collection, error) {
+	collection := Collection{
+		Title:        strings.TrimSpace(req.Title),
+		Description:  strings.TrimSpace(req.Description),
+		Public:       req.Public,
+		AnimationIDs: []string{},
+	}
+	if collection.Title == "" || len(collection.Title) > maxCollectionTitleLength {
+		return Collection{}, fmt.Errorf("title must be 1-%d characters", maxCollectionTitleLength)
+	}
+	if len(collection.Description) > maxCollectionDescriptionLength {
+		return Collection{}, fmt.Errorf("description must be at most %d characters", maxCollectionDescriptionLength)
+	}
+	seen := map[string]bool{}
+	for _, id := range req.AnimationIDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		collection.AnimationIDs = append(collection.AnimationIDs, id)
+	}
+	if len(collection.AnimationIDs) > maxCollectionAnimations {
+		return Collection{}, fmt.Errorf("collections may hold at most %d animations", maxCollectionAnimations)
+	}
+	return collection, nil
+}
+
+// collectionFeedURL returns the absolute URL of a page of a collection's feed in format
+func collectionFeedURL(id int, format string, limit, offset int) string {
+	path := "/collections/" + strconv.Itoa(id) + "/feed." + format
+	query := url.Values{}
+	if limit != defaultPageSize {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return PublicURL(path)
+}
+
+// collectionFeedTitle returns the text describing an animation in feeds, which have no room for
+// an empty title
+func collectionFeedTitle(animation CollectionAnimation) string {
+	if title := strings.TrimSpace(animation.Description); title != "" {
+		return title
+	}
+	return "Animation " + animation.ID
+}
+
+// BuildJSONFeed returns a page of a collection's feed in the JSON Feed format, linking to the next
+// page when there is one
+func BuildJSONFeed(collection Collection, animations []CollectionAnimation, limit, offset int, next *int) JSONFeed {
+	feed := JSONFeed{
+		Version:     jsonFeedVersion,
+		Title:       collection.Title,
+		FeedURL:     collectionFeedURL(collection.ID, CollectionFeedJSON, limit, offset),
+		Description: collection.Description,
+		Items:       []JSONFeedItem{},
+	}
+	if collection.Username != "" {
+		feed.Authors = []JSONFeedAuthor{{Name: collection.Username}}
+	}
+	if next != nil {
+		feed.NextURL = collectionFeedURL(collection.ID, CollectionFeedJSON, limit, *next)
+	}
+	for _, animation := range animations {
+		feed.Items = append(feed.Items, JSONFeedItem{
+			ID:            animation.ID,
+			URL:           PublicURL("/animation/" + animation.ID + "/embed"),
+			Title:         collectionFeedTitle(animation),
+			ContentText:   animation.Description,
+			Image:         PublicURL("/animation/" + animation.ID + "/thumbnail"),
+			DatePublished: animation.AddedAt,
+			Attachments: []JSONFeedAttachment{
+				{URL: PublicURL("/animation/" + animation.ID + ".js"), MimeType: "application/javascript"},
+			},
+		})
+	}
+	return feed
+}
+
+// rssFeed is an RSS 2.0 document. Pages link to each other with Atom links, as RFC 5005 pages feeds.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	AtomLinks   []rssAtomLink `xml:"atom:link"`
+	Items       []rssItem     `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	GUID        rssGUID      `xml:"guid"`
+	Description string       `xml:"description,omitempty"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// BuildRSSFeed returns a page of a collection's feed as an RSS 2.0 document
+func BuildRSSFeed(collection Collection, animations []CollectionAnimation, limit, offset int, next *int) ([]byte, error) {
+	self := collectionFeedURL(collection.ID, CollectionFeedRSS, limit, offset)
+	channel := rssChannel{
+		Title:       collection.Title,
+		Link:        collectionFeedURL(collection.ID, CollectionFeedJSON, limit, offset),
+		Description: collection.Description,
+		AtomLinks:   []rssAtomLink{{Href: self, Rel: "self", Type: "application/rss+xml"}},
+		Items:       []rssItem{},
+	}
+	if channel.Description == "" {
+		// RSS requires a description
+		channel.Description = collection.Title
+	}
+	if next != nil {
+		channel.AtomLinks = append(channel.AtomLinks, rssAtomLink{Href: collectionFeedURL(collection.ID, CollectionFeedRSS, limit, *next), Rel: "next", Type: "application/rss+xml"})
+	}
+	for _, animation := range animations {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       collectionFeedTitle(animation),
+			Link:        PublicURL("/animation/" + animation.ID + "/embed"),
+			GUID:        rssGUID{Value: "animation:" + animation.ID, IsPermaLink: false},
+			Description: animation.Description,
+			PubDate:     animation.AddedAt.UTC().Format(time.RFC1123Z),
+			// Feed readers show the thumbnail; its size is not known without rendering it
+			Enclosure: rssEnclosure{URL: PublicURL("/animation/" + animation.ID + "/thumbnail"), Length: 0, Type: "image/png"},
+		})
+	}
+
+	body, err := xml.MarshalIndent(rssFeed{Version: "2.0", Atom: "http://www.w3.org/2005/Atom", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
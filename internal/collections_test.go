@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateCollection(t *testing.T) {
+	tooMany := make([]string, maxCollectionAnimations+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name    string
+		req     CollectionRequest
+		wantIDs []string
+		wantErr bool
+	}{
+		{name: "Repeated animations", req: CollectionRequest{Title: " Waves ", AnimationIDs: []string{"b", "a", " b", ""}}, wantIDs: []string{"b", "a"}},
+		{name: "Empty", req: CollectionRequest{Title: "Waves"}, wantIDs: []string{}},
+		{name: "Missing title", req: CollectionRequest{Title: "  "}, wantErr: true},
+		{name: "Title too long", req: CollectionRequest{Title: strings.Repeat("a", maxCollectionTitleLength+1)}, wantErr: true},
+		{name: "Description too long", req: CollectionRequest{Title: "Waves", Description: strings.Repeat("a", maxCollectionDescriptionLength+1)}, wantErr: true},
+		{name: "Too many animations", req: CollectionRequest{Title: "Waves", AnimationIDs: tooMany}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection, err := ValidateCollection(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateCollection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(collection.AnimationIDs, tt.wantIDs) {
+				t.Errorf("animation IDs = %v, want %v", collection.AnimationIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestCollectionHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	alice := registerUser(t, router, "alice")
+	bob := registerUser(t, router, "bob")
+
+	var ids []string
+	for _, description := range []string{"waves", "rain", "stars"} {
+		var saved SaveAnimationResponse
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", alice, sketch, &saved); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+		ids = append(ids, saved.ID)
+	}
+
+	if code := doJSON(t, router, http.MethodPost, "/me/collections", alice, CollectionRequest{Title: "Weather", AnimationIDs: []string{"missing"}}, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown animation status = %d, want %d", code, http.StatusBadRequest)
+	}
+	var created Collection
+	if code := doJSON(t, router, http.MethodPost, "/me/collections", alice, CollectionRequest{Title: "Weather", AnimationIDs: ids[:2]}, &created); code != http.StatusCreated {
+		t.Fatalf("create status = %d", code)
+	}
+	path := "/me/collections/" + strconv.Itoa(created.ID)
+	feed := "/collections/" + strconv.Itoa(created.ID) + "/feed"
+
+	// Private collections are not syndicated
+	if code := doJSON(t, router, http.MethodGet, feed+".json", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("private feed status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	update := CollectionRequest{Title: "Weather", Description: "Skies", Public: true, AnimationIDs: []string{ids[2], ids[0], ids[1]}}
+	if code := doJSON(t, router, http.MethodPut, path, bob, update, nil); code != http.StatusNotFound {
+		t.Errorf("update by another user status = %d, want %d", code, http.StatusNotFound)
+	}
+	var updated Collection
+	if code := doJSON(t, router, http.MethodPut, path, alice, update, &updated); code != http.StatusOK || !reflect.DeepEqual(updated.AnimationIDs, update.AnimationIDs) {
+		t.Fatalf("update = %d %+v", code, updated)
+	}
+
+	var mine CollectionsResponse
+	if code := doJSON(t, router, http.MethodGet, "/me/collections", alice, nil, &mine); code != http.StatusOK || mine.Total != 1 {
+		t.Errorf("list = %d %+v, want the collection", code, mine)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/me/collections", bob, nil, &mine); code != http.StatusOK || mine.Total != 0 {
+		t.Errorf("list for another user = %d %+v, want none", code, mine)
+	}
+
+	var first JSONFeed
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, feed+".json?limit=2", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/feed+json" {
+		t.Fatalf("json feed = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&first); err != nil {
+		t.Fatalf("decode feed: %v", err)
+	}
+	if first.Version != jsonFeedVersion || first.Title != "Weather" || len(first.Items) != 2 || first.Items[0].ID != ids[2] {
+		t.Errorf("json feed = %+v, want the first two animations in order", first)
+	}
+	if want := PublicURL(feed + ".json?limit=2&offset=2"); first.NextURL != want {
+		t.Errorf("next_url = %q, want %q", first.NextURL, want)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Cache-Control"), "public, max-age=") {
+		t.Errorf("Cache-Control = %q", rec.Header().Get("Cache-Control"))
+	}
+
+	// Unchanged pages are revalidated without a body
+	etag := rec.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, feed+".json?limit=2", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if etag == "" || rec.Code != http.StatusNotModified {
+		t.Errorf("revalidated feed status = %d with ETag %q, want %d", rec.Code, etag, http.StatusNotModified)
+	}
+
+	var last JSONFeed
+	if code := doJSON(t, router, http.MethodGet, feed+".json?limit=2&offset=2", "", nil, &last); code != http.StatusOK || len(last.Items) != 1 || last.NextURL != "" {
+		t.Errorf("last page = %d %+v, want one item and no next page", code, last)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, feed+".rss?limit=2", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/rss+xml") {
+		t.Fatalf("rss feed = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var rss struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"http://www.w3.org/2005/Atom link"`
+			Items []struct {
+				Title string `xml:"title"`
+				Link  string `xml:"link"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rss); err != nil {
+		t.Fatalf("decode rss: %v", err)
+	}
+	if rss.Channel.Title != "Weather" || len(rss.Channel.Items) != 2 || rss.Channel.Items[0].Title != "stars" || rss.Channel.Items[0].Link != PublicURL("/animation/"+ids[2]+"/embed") {
+		t.Errorf("rss channel = %+v", rss.Channel)
+	}
+	if len(rss.Channel.Links) != 2 || rss.Channel.Links[1].Rel != "next" || rss.Channel.Links[1].Href != PublicURL(feed+".rss?limit=2&offset=2") {
+		t.Errorf("rss links = %+v, want self and next", rss.Channel.Links)
+	}
+
+	if code := doJSON(t, router, http.MethodDelete, path, bob, nil, nil); code != http.StatusNotFound {
+		t.Errorf("delete by another user status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := doJSON(t, router, http.MethodDelete, path, alice, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, feed+".rss", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleted feed status = %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Contract check modes
+const (
+	ContractModeMock = "mock"
+	ContractModeLive = "live"
+
+	defaultContractMaxCalls    = 20
+	defaultContractMinPassRate = 90 // percent
+)
+
+// defaultContractCorpus covers the kinds of descriptions users submit most often
+var defaultContractCorpus = []string{
+	"calm blue waves rolling across the screen",
+	"fireworks exploding over a dark city skyline",
+	"a slowly rotating 3D cube with pastel faces",
+	"rain falling on a window at night",
+	"particles drifting toward the mouse",
+	"a heart that beats faster when I feel anxious",
+	"sunrise over green hills",
+	"a spiral of colorful dots that pulses with time",
+	"stars twinkling in a purple sky",
+	"leaves falling from a tree in autumn",
+	"a bouncing ball that leaves a fading trail",
+	"lava lamp blobs merging and splitting",
+}
+
+// AnimationGenerator produces raw sketch code for a description
+type AnimationGenerator func(ctx context.Context, description string) (string, error)
+
+// ContractCaseResult is the outcome of generating and validating one corpus description
+type ContractCaseResult struct {
+	Description string   `json:"description"`
+	Passed      bool     `json:"passed"`
+	Violations  []string `json:"violations"`
+	DurationMs  int64    `json:"durationMs"`
+}
+
+// ContractReport summarises one run of the generation contract checks
+type ContractReport struct {
+	ID        int                  `json:"id,omitempty"`
+	Mode      string               `json:"mode"`
+	Total     int                  `json:"total"`
+	Passed    int                  `json:"passed"`
+	Skipped   int                  `json:"skipped"`
+	PassRate  float64              `json:"passRate"`
+	Change    *float64             `json:"change,omitempty"`
+	Cases     []ContractCaseResult `json:"cases,omitempty"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+// ContractMaxCalls returns how many generations a run may make, configured by CONTRACT_MAX_CALLS
+func ContractMaxCalls() int {
+	return envLimit("CONTRACT_MAX_CALLS", defaultContractMaxCalls)
+}
+
+// ContractMinPassRate returns the pass rate in percent below which a run fails, configured by CONTRACT_MIN_PASS_RATE
+func ContractMinPassRate() float64 {
+	return float64(envLimit("CONTRACT_MIN_PASS_RATE", defaultContractMinPassRate))
+}
+
+// LoadContractCorpus reads one description per line from path, skipping blank lines and # comments.
+// An empty path returns the built-in corpus.
+func LoadContractCorpus(path string) ([]string, error) {
+	if path == "" {
+		return defaultContractCorpus, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open contract corpus: %w", err)
+	}
+	defer file.Close()
+
+	corpus := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			corpus = append(corpus, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read contract corpus: %w", err)
+	}
+	if len(corpus) == 0 {
+		return nil, fmt.Errorf("contract corpus %s is empty", path)
+	}
+	return corpus, nil
+}
+
+// ClaudeAnimationGenerator generates sketches with the real Claude API
+func ClaudeAnimationGenerator(apiKey string) AnimationGenerator {
+	return func(ctx context.Context, description string) (string, error) {
+		return GenerateAnimationWithClaude(ctx, description, "", apiKey)
+	}
+}
+
+// MockAnimationGenerator returns a fixed, well-formed sketch so the pipeline can be checked without API calls
+func MockAnimationGenerator(ctx context.Context, description string) (string, error) {
+	return "```javascript\n" +
+		"// " + strings.ReplaceAll(description, "\n", " ") + "\n" +
+		"function setup() {\n" +
+		"  let canvas = createCanvas(windowWidth, windowHeight);\n" +
+		"  canvas.parent('animation-container');\n" +
+		"}\n\n" +
+		"function draw() {\n" +
+		"  background(220);\n" +
+		"  for (let i = 0; i < 20; i++) {\n" +
+		"    circle(width / 2 + Math.cos(frameCount * 0.02 + i) * 100, height / 2, 10);\n" +
+		"  }\n" +
+		"}\n\n" +
+		"function windowResized() {\n" +
+		"  resizeCanvas(windowWidth, windowHeight);\n" +
+		"}\n" +
+		"```", nil
+}
+
+// CheckGeneratedCode runs raw generated code through the same pipeline as /generate-animation
+// and returns every reason it would not be fit to show
+func CheckGeneratedCode(ctx context.Context, raw string) []string {
+	code := PreprocessP5Code(SanitizeAnimationCode(raw))
+	if strings.TrimSpace(code) == "" {
+		return []string{"empty output"}
+	}
+
+	violations := make([]string, 0)
+	if errs, ok := AnalyzeP5Code(code)["errors"].([]string); ok {
+		violations = append(violations, errs...)
+	}
+	violations = append(violations, EstimateSketchCost(code, CurrentSketchBudget()).Violations...)
+
+	if renderer, ok := GetSketchRenderer(); ok {
+		_, result, err := SmokeTestWithRepairs(ctx, renderer, code, 0, nil)
+		if err != nil {
+			violations = append(violations, "smoke test could not run: "+err.Error())
+		} else if !result.Passed {
+			violations = append(violations, "runtime error: "+result.Error)
+		}
+	}
+	return violations
+}
+
+// RunContractChecks generates a sketch for each description, up to maxCalls, and validates it
+func RunContractChecks(ctx context.Context, mode string, corpus []string, generate AnimationGenerator, maxCalls int) ContractReport {
+	report := ContractReport{Mode: mode, Cases: make([]ContractCaseResult, 0, len(corpus)), CreatedAt: time.Now()}
+
+	for i, description := range corpus {
+		if maxCalls > 0 && i >= maxCalls {
+			report.Skipped = len(corpus) - i
+			break
+		}
+
+		started := time.Now()
+		result := ContractCaseResult{Description: description}
+		raw, err := generate(ctx, description)
+		if err != nil {
+			result.Violations = []string{"generation failed: " + err.Error()}
+		} else {
+			result.Violations = CheckGeneratedCode(ctx, raw)
+		}
+		result.Passed = len(result.Violations) == 0
+		result.DurationMs = time.Since(started).Milliseconds()
+
+		report.Total++
+		if result.Passed {
+			report.Passed++
+		}
+		report.Cases = append(report.Cases, result)
+	}
+
+	if report.Total > 0 {
+		report.PassRate = 100 * float64(report.Passed) / float64(report.Total)
+	}
+	return report
+}
+
+// WithContractTrend sets each report's change in pass rate against the previous run of the same mode.
+// Reports must be ordered newest first.
+func WithContractTrend(reports []ContractReport) []ContractReport {
+	for i := range reports {
+		for j := i + 1; j < len(reports); j++ {
+			if reports[j].Mode == reports[i].Mode {
+				change := reports[i].PassRate - reports[j].PassRate
+				reports[i].Change = &change
+				break
+			}
+		}
+	}
+	return reports
+}
+
+// Summary is a one-line description of the report for logs
+func (r ContractReport) Summary() string {
+	summary := r.Mode + ": " + strconv.Itoa(r.Passed) + "/" + strconv.Itoa(r.Total) + " passed (" + strconv.FormatFloat(r.PassRate, 'f', 1, 64) + "%)"
+	if r.Change != nil {
+		summary += fmt.Sprintf(", %+.1f points since last run", *r.Change)
+	}
+	if r.Skipped > 0 {
+		summary += ", " + strconv.Itoa(r.Skipped) + " skipped by budget"
+	}
+	return summary
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunContractChecks(t *testing.T) {
+	outputs := map[string]string{
+		"good":     "function setup() {}\nfunction draw() {}",
+		"no draw":  "function setup() {}",
+		"infinite": "function setup() {}\nfunction draw() {\n  while (true) {}\n}",
+	}
+	generate := func(ctx context.Context, description string) (string, error) {
+		if code, ok := outputs[description]; ok {
+			return code, nil
+		}
+		return "", errors.New("overloaded")
+	}
+
+	report := RunContractChecks(context.Background(), ContractModeMock, []string{"good", "no draw", "infinite", "error", "over budget"}, generate, 4)
+
+	if report.Total != 4 || report.Passed != 1 || report.Skipped != 1 {
+		t.Fatalf("report = %d/%d passed, %d skipped, want 1/4 passed, 1 skipped", report.Passed, report.Total, report.Skipped)
+	}
+	if report.PassRate != 25 {
+		t.Errorf("PassRate = %v, want 25", report.PassRate)
+	}
+
+	wantViolations := [][]string{
+		{},
+		{"Missing draw() function"},
+		{"draw() contains a loop that never terminates"},
+		{"generation failed: overloaded"},
+	}
+	for i, want := range wantViolations {
+		if got := report.Cases[i].Violations; !reflect.DeepEqual(got, want) {
+			t.Errorf("case %q violations = %v, want %v", report.Cases[i].Description, got, want)
+		}
+	}
+}
+
+func TestMockAnimationGeneratorPassesContract(t *testing.T) {
+	report := RunContractChecks(context.Background(), ContractModeMock, defaultContractCorpus, MockAnimationGenerator, 0)
+	if report.Passed != len(defaultContractCorpus) {
+		t.Errorf("mock generator passed %d/%d cases: %+v", report.Passed, report.Total, report.Cases)
+	}
+}
+
+func TestWithContractTrend(t *testing.T) {
+	reports := WithContractTrend([]ContractReport{
+		{Mode: ContractModeLive, PassRate: 80},
+		{Mode: ContractModeMock, PassRate: 100},
+		{Mode: ContractModeLive, PassRate: 90},
+	})
+
+	if reports[0].Change == nil || *reports[0].Change != -10 {
+		t.Errorf("latest live change = %v, want -10", reports[0].Change)
+	}
+	if reports[1].Change != nil || reports[2].Change != nil {
+		t.Errorf("runs without an earlier run of the same mode should have no change")
+	}
+}
+
+func TestLoadContractCorpus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(path, []byte("# moods\ncalm sea\n\n  busy city  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	corpus, err := LoadContractCorpus(path)
+	if err != nil {
+		t.Fatalf("LoadContractCorpus() error = %v", err)
+	}
+	if want := []string{"calm sea", "busy city"}; !reflect.DeepEqual(corpus, want) {
+		t.Errorf("corpus = %v, want %v", corpus, want)
+	}
+
+	if corpus, _ := LoadContractCorpus(""); len(corpus) != len(defaultContractCorpus) {
+		t.Errorf("empty path should return the built-in corpus")
+	}
+}
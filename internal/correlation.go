@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// ClientRequestIDHeader carries the ID the frontend gave a request, echoed back on every response
+	ClientRequestIDHeader = "X-Client-Request-ID"
+	// maxClientRequestIDLength caps the request IDs clients may send
+	maxClientRequestIDLength = 128
+)
+
+// Correlation identifies a request across the frontend, this server, its database and Claude
+type Correlation struct {
+	// RequestID is the frontend's X-Client-Request-ID, or one generated for the request
+	RequestID string
+	// TraceID is the trace ID of an incoming traceparent header, if any
+	TraceID string
+}
+
+// correlationKey holds the correlation of the request a context belongs to
+const correlationKey contextKey = "correlation"
+
+// WithCorrelation returns ctx carrying correlation, so work done for a request after it was
+// answered can still be traced to it
+func WithCorrelation(ctx context.Context, correlation Correlation) context.Context {
+	if correlation.RequestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey, correlation)
+}
+
+// GetCorrelationFromContext returns the correlation of the request ctx belongs to
+func GetCorrelationFromContext(ctx context.Context) (Correlation, bool) {
+	correlation, ok := ctx.Value(correlationKey).(Correlation)
+	return correlation, ok
+}
+
+// validClientRequestID reports whether id is short and plain enough to be logged and put into
+// SQL comments as it is
+func validClientRequestID(id string) bool {
+	if id == "" || len(id) > maxClientRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random ID for requests the frontend did not name
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// requestCorrelation returns the correlation of an incoming request. A missing or malformed
+// X-Client-Request-ID is replaced with a generated one.
+func requestCorrelation(r *http.Request) Correlation {
+	correlation := Correlation{RequestID: r.Header.Get(ClientRequestIDHeader)}
+	if !validClientRequestID(correlation.RequestID) {
+		correlation.RequestID = newRequestID()
+	}
+	if traceID, _, ok := parseTraceParent(r.Header.Get("traceparent")); ok {
+		correlation.TraceID = hex.EncodeToString(traceID[:])
+	}
+	return correlation
+}
+
+// String formats the correlation for log lines, empty for work no request asked for
+func (c Correlation) String() string {
+	if c.RequestID == "" {
+		return ""
+	}
+	if c.TraceID == "" {
+		return "request_id=" + c.RequestID
+	}
+	return "request_id=" + c.RequestID + " trace_id=" + c.TraceID
+}
+
+// CorrelationMiddleware adds each request's correlation to its context and echoes the request ID
+// in X-Client-Request-ID, so a failure a user reports can be found in the logs, the database's
+// query log and Claude's request log. It must run before LoggingMiddleware.
+func CorrelationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlation := requestCorrelation(r)
+		w.Header().Set(ClientRequestIDHeader, correlation.RequestID)
+		next.ServeHTTP(w, r.WithContext(WithCorrelation(r.Context(), correlation)))
+	})
+}
+
+// annotateQuery appends the correlation of ctx to a SQL statement as a comment in the sqlcommenter
+// format, so slow or failing statements in the database's logs lead back to the request. Statements
+// without a correlation are returned unchanged.
+func annotateQuery(ctx context.Context, query string) string {
+	correlation, ok := GetCorrelationFromContext(ctx)
+	if !ok {
+		return query
+	}
+	comment := "request_id='" + url.QueryEscape(correlation.RequestID) + "'"
+	if correlation.TraceID != "" {
+		comment += ",trace_id='" + url.QueryEscape(correlation.TraceID) + "'"
+	}
+	return query + " /*" + comment + "*/"
+}
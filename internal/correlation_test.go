@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCorrelationMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestID     string
+		traceParent   string
+		wantRequestID string
+		wantTraceID   string
+	}{
+		{name: "Client request ID", requestID: "web-7f3a:42", wantRequestID: "web-7f3a:42"},
+		{name: "Traceparent", requestID: "abc", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantRequestID: "abc", wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "Missing request ID"},
+		{name: "Unsafe request ID", requestID: "x*/ DROP TABLE users; /*"},
+		{name: "Invalid traceparent", requestID: "abc", traceParent: "00-zz-00f067aa0ba902b7-01", wantRequestID: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Correlation
+			handler := CorrelationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = GetCorrelationFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+			req.Header.Set(ClientRequestIDHeader, tt.requestID)
+			req.Header.Set("traceparent", tt.traceParent)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if tt.wantRequestID == "" {
+				if len(got.RequestID) != 32 || got.RequestID == tt.requestID {
+					t.Errorf("request ID = %q, want a generated one", got.RequestID)
+				}
+			} else if got.RequestID != tt.wantRequestID {
+				t.Errorf("request ID = %q, want %q", got.RequestID, tt.wantRequestID)
+			}
+			if got.TraceID != tt.wantTraceID {
+				t.Errorf("trace ID = %q, want %q", got.TraceID, tt.wantTraceID)
+			}
+			if echoed := rec.Header().Get(ClientRequestIDHeader); echoed != got.RequestID {
+				t.Errorf("echoed %s = %q, want %q", ClientRequestIDHeader, echoed, got.RequestID)
+			}
+		})
+	}
+}
+
+func TestAnnotateQuery(t *testing.T) {
+	query := "SELECT 1"
+	if got := annotateQuery(context.Background(), query); got != query {
+		t.Errorf("annotateQuery() without a request = %q, want it unchanged", got)
+	}
+	ctx := WithCorrelation(context.Background(), Correlation{RequestID: "web:42", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+	want := "SELECT 1 /*request_id='web%3A42',trace_id='4bf92f3577b34da6a3ce929d0e0e4736'*/"
+	if got := annotateQuery(ctx, query); got != want {
+		t.Errorf("annotateQuery() = %q, want %q", got, want)
+	}
+}
+
+func TestGenerationJobKeepsCorrelation(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	token := registerUser(t, router, "artist")
+
+	req := httptest.NewRequest(http.MethodPost, "/generate-animation", strings.NewReader(`{"description": "a calm ocean"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(ClientRequestIDHeader, "web-1234")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("generate status = %d", rec.Code)
+	}
+
+	claimed, err := store.ClaimGenerationJobs(context.Background(), 1)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimGenerationJobs() = %v, %v", claimed, err)
+	}
+	if claimed[0].Correlation.RequestID != "web-1234" {
+		t.Errorf("job correlation = %+v, want the queueing request's", claimed[0].Correlation)
+	}
+}
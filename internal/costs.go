@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Defaults for what Claude charges in US dollars per million tokens, at the prices of
+// DefaultClaudeModel
+const (
+	defaultClaudeInputCostPerMTok  = 3.0
+	defaultClaudeOutputCostPerMTok = 15.0
+	// Claude bills prompt tokens written to its prompt cache at a premium on the input price, and
+	// ones read from it at a tenth
+	claudeCacheWriteCostFactor = 1.25
+	claudeCacheReadCostFactor  = 0.1
+	// defaultCostReportUsers is how many of the users who cost the most a cost report lists
+	defaultCostReportUsers = 20
+	maxCostReportUsers     = 100
+)
+
+// ClaudeTokenPrices returns what Claude charges in US dollars per million input and output
+// tokens, configured by CLAUDE_INPUT_COST_PER_MTOK and CLAUDE_OUTPUT_COST_PER_MTOK. Costs are
+// worked out when a generation is recorded, so changing them leaves past costs as they were.
+func ClaudeTokenPrices() (float64, float64) {
+	return envPrice("CLAUDE_INPUT_COST_PER_MTOK", defaultClaudeInputCostPerMTok),
+		envPrice("CLAUDE_OUTPUT_COST_PER_MTOK", defaultClaudeOutputCostPerMTok)
+}
+
+// envPrice reads a non-negative price from key
+func envPrice(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	price, err := strconv.ParseFloat(raw, 64)
+	if err != nil || price < 0 {
+		log.Printf("Warning: Ignoring invalid %s value %q", key, raw)
+		return fallback
+	}
+	return price
+}
+
+// claudeCost returns what the tokens of a Claude call cost in US dollars
+func claudeCost(usage ClaudeUsage) float64 {
+	input, output := ClaudeTokenPrices()
+	prompt := float64(usage.InputTokens) +
+		float64(usage.CacheCreationInputTokens)*claudeCacheWriteCostFactor +
+		float64(usage.CacheReadInputTokens)*claudeCacheReadCostFactor
+	return (prompt*input + float64(usage.OutputTokens)*output) / 1e6
+}
+
+// PromptTokens returns every token of the prompt, whether or not it was cached
+func (u ClaudeUsage) PromptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// tokenMeter adds up the tokens of the Claude calls made with a context, so a generation is
+// billed for its repairs as well as the call that wrote it
+type tokenMeter struct {
+	mu    sync.Mutex
+	model string
+	usage ClaudeUsage
+}
+
+type tokenMeterKey struct{}
+
+// withTokenMeter returns a context whose Claude calls are counted by the returned meter
+func withTokenMeter(ctx context.Context) (context.Context, *tokenMeter) {
+	meter := &tokenMeter{}
+	return context.WithValue(ctx, tokenMeterKey{}, meter), meter
+}
+
+// meterTokens counts the tokens of a Claude call against the context's meter, if it has one
+func meterTokens(ctx context.Context, model string, usage ClaudeUsage) {
+	meter, ok := ctx.Value(tokenMeterKey{}).(*tokenMeter)
+	if !ok {
+		return
+	}
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	meter.model = model
+	meter.usage.InputTokens += usage.InputTokens
+	meter.usage.OutputTokens += usage.OutputTokens
+	meter.usage.CacheCreationInputTokens += usage.CacheCreationInputTokens
+	meter.usage.CacheReadInputTokens += usage.CacheReadInputTokens
+}
+
+// record returns the generation the meter counted, costed unless it was made with the user's own key
+func (m *tokenMeter) record(job generationJob, succeeded bool) GenerationRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record := GenerationRecord{
+		UserID:       job.userId,
+		JobID:        job.id,
+		Provider:     job.key.Provider,
+		Model:        m.model,
+		OwnKey:       job.key.Own,
+		Succeeded:    succeeded,
+		InputTokens:  m.usage.PromptTokens(),
+		OutputTokens: m.usage.OutputTokens,
+	}
+	// Calls that failed, and OpenAI's, are not metered
+	if record.Model == "" && record.Provider == ProviderOpenAI {
+		record.Model = OpenAIModel()
+	} else if record.Model == "" {
+		record.Model = DefaultClaudeModel
+	}
+	if !job.key.Own {
+		record.CostUSD = claudeCost(m.usage)
+	}
+	return record
+}
+
+// recordGeneration stores what a generation cost once it is over. It still records after the
+// client went away, and a failure is only logged.
+func (s *Server) recordGeneration(ctx context.Context, endpoint string, job generationJob, meter *tokenMeter, succeeded bool) {
+	if err := s.store.RecordGeneration(context.WithoutCancel(ctx), meter.record(job, succeeded)); err != nil {
+		LogResponse(endpoint, "Error recording generation costs", err)
+	}
+}
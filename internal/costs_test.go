@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClaudeCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputPrice  string
+		outputPrice string
+		usage       ClaudeUsage
+		want        float64
+	}{
+		{name: "Default prices", usage: ClaudeUsage{InputTokens: 1000, OutputTokens: 2000}, want: 0.033},
+		{name: "Configured prices", inputPrice: "1", outputPrice: "5", usage: ClaudeUsage{InputTokens: 1_000_000, OutputTokens: 100_000}, want: 1.5},
+		{name: "Invalid price", inputPrice: "-1", outputPrice: "free", usage: ClaudeUsage{InputTokens: 1000, OutputTokens: 2000}, want: 0.033},
+		{name: "Cached prompt", usage: ClaudeUsage{InputTokens: 100_000, CacheCreationInputTokens: 400_000, CacheReadInputTokens: 500_000}, want: 1.95},
+		{name: "No tokens", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLAUDE_INPUT_COST_PER_MTOK", tt.inputPrice)
+			t.Setenv("CLAUDE_OUTPUT_COST_PER_MTOK", tt.outputPrice)
+			if got := claudeCost(tt.usage); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("claudeCost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamMetersTokens(t *testing.T) {
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(claudeStreamEvent("message_start", `{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":25,"cache_read_input_tokens":300,"output_tokens":1}}}`) +
+			textDelta("function draw() {}") +
+			claudeStreamEvent("message_delta", `{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":40}}`) +
+			claudeStreamEvent("message_stop", `{"type":"message_stop"}`)))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	ctx, meter := withTokenMeter(context.Background())
+	for i := 0; i < 2; i++ {
+		if _, err := streamClaudePromptWithModel(ctx, "a calm ocean", DefaultClaudeModel, "test-key", func(string) error { return nil }); err != nil {
+			t.Fatalf("streamClaudePromptWithModel: %v", err)
+		}
+	}
+	if meter.usage != (ClaudeUsage{InputTokens: 50, OutputTokens: 80, CacheReadInputTokens: 600}) || meter.model != DefaultClaudeModel {
+		t.Errorf("meter = %+v of %s, want both calls counted", meter.usage, meter.model)
+	}
+}
+
+func TestGenerationCosts(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+
+	failing := false
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}\nfunction draw() {}"}], "usage": {"input_tokens": 1000, "output_tokens": 2000}}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	artist := registerAccount(t, router, "artist")
+
+	for _, fail := range []bool{false, true} {
+		failing = fail
+		generateAndWait(t, server, router, artist.Token, AnimationRequest{Description: "a calm ocean"})
+	}
+
+	var report CostReport
+	if code := doJSON(t, router, http.MethodGet, "/admin/costs?from=2020-01-01", admin.Token, nil, &report); code != http.StatusOK {
+		t.Fatalf("costs status = %d", code)
+	}
+	want := GenerationCosts{Generations: 2, InputTokens: 1000, OutputTokens: 2000, CostUSD: 0.033}
+	if report.From == nil || report.Totals.Generations != want.Generations || report.Totals.InputTokens != want.InputTokens ||
+		report.Totals.OutputTokens != want.OutputTokens || math.Abs(report.Totals.CostUSD-want.CostUSD) > 1e-9 {
+		t.Errorf("totals = %+v from %v, want %+v", report.Totals, report.From, want)
+	}
+	if len(report.Users) != 1 || report.Users[0].Username != "artist" || report.Users[0].Generations != 2 {
+		t.Errorf("users = %+v, want the artist", report.Users)
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		token           string
+		wantCode        int
+		wantGenerations int
+	}{
+		{name: "One user", path: "/admin/costs/users/" + artist.User.ID, token: admin.Token, wantCode: http.StatusOK, wantGenerations: 2},
+		{name: "User without generations", path: "/admin/costs/users/" + admin.User.ID, token: admin.Token, wantCode: http.StatusOK},
+		{name: "Before any generation", path: "/admin/costs?to=2020-01-01", token: admin.Token, wantCode: http.StatusOK},
+		{name: "Bad limit", path: "/admin/costs?limit=0", token: admin.Token, wantCode: http.StatusBadRequest},
+		{name: "Bad range", path: "/admin/costs?from=2026-02-01&to=2026-01-01", token: admin.Token, wantCode: http.StatusBadRequest},
+		{name: "Not an admin", path: "/admin/costs", token: artist.Token, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report CostReport
+			if code := doJSON(t, router, http.MethodGet, tt.path, tt.token, nil, &report); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if report.Totals.Generations != tt.wantGenerations {
+				t.Errorf("generations = %d, want %d", report.Totals.Generations, tt.wantGenerations)
+			}
+		})
+	}
+}
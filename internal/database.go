@@ -1,22 +1,228 @@
 package internal
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
-var db *sql.DB
+var db *tracedDB
 
-// InitDB initializes the PostgreSQL database connection
+// Default connection pool settings
+const (
+	defaultDBMaxOpenConns        = 25
+	defaultDBMaxIdleConns        = 10
+	defaultDBConnMaxLifetimeMins = 30
+	defaultDBConnMaxIdleTimeMins = 5
+	defaultDBQueryTimeoutSecs    = 5
+)
+
+// DBPoolConfig holds the database connection pool limits
+type DBPoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DBPoolConfigFromEnv reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME_MINUTES and
+// DB_CONN_MAX_IDLE_TIME_MINUTES. A value of 0 removes that limit.
+func DBPoolConfigFromEnv() DBPoolConfig {
+	config := DBPoolConfig{
+		MaxOpenConns:    envLimit("DB_MAX_OPEN_CONNS", defaultDBMaxOpenConns),
+		MaxIdleConns:    envLimit("DB_MAX_IDLE_CONNS", defaultDBMaxIdleConns),
+		ConnMaxLifetime: time.Duration(envLimit("DB_CONN_MAX_LIFETIME_MINUTES", defaultDBConnMaxLifetimeMins)) * time.Minute,
+		ConnMaxIdleTime: time.Duration(envLimit("DB_CONN_MAX_IDLE_TIME_MINUTES", defaultDBConnMaxIdleTimeMins)) * time.Minute,
+	}
+
+	// Idle connections above the open limit would be closed straight away
+	if config.MaxOpenConns > 0 && config.MaxIdleConns > config.MaxOpenConns {
+		config.MaxIdleConns = config.MaxOpenConns
+	}
+	return config
+}
+
+// Apply sets the pool limits on a connection
+func (c DBPoolConfig) Apply(conn *sql.DB) {
+	conn.SetMaxOpenConns(c.MaxOpenConns)
+	conn.SetMaxIdleConns(c.MaxIdleConns)
+	conn.SetConnMaxLifetime(c.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
+
+// DBStats returns connection pool statistics, or false before the database is initialized
+func DBStats() (sql.DBStats, bool) {
+	if db == nil {
+		return sql.DBStats{}, false
+	}
+	return db.Stats(), true
+}
+
+// DBQueryTimeout returns how long a database call may take, configured by DB_QUERY_TIMEOUT_SECONDS.
+// 0 leaves calls bounded only by their caller's context.
+func DBQueryTimeout() time.Duration {
+	return time.Duration(envLimit("DB_QUERY_TIMEOUT_SECONDS", defaultDBQueryTimeoutSecs)) * time.Second
+}
+
+// withQueryTimeout bounds a database call by DBQueryTimeout, or sooner if ctx already has an earlier deadline.
+// Every exported database function calls it so a stuck PostgreSQL cannot hang a handler.
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := DBQueryTimeout(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// tracedDB wraps the connection pool so every query is recorded as a span, annotated with the
+// request it was made for and can have chaos mode faults injected. Only the *Context methods are traced; callers pass a context bounded by
+// withQueryTimeout. The pool behind it can be swapped by refresh after a failover.
+type tracedDB struct {
+	pool atomic.Pointer[sql.DB]
+	// connector opens the connections of a refreshed pool; nil when the pool cannot be refreshed
+	connector driver.Connector
+}
+
+// newTracedDB wraps conn, which connector opened if it is not nil
+func newTracedDB(conn *sql.DB, connector driver.Connector) *tracedDB {
+	t := &tracedDB{connector: connector}
+	t.pool.Store(conn)
+	return t
+}
+
+// current returns the connection pool in use
+func (t *tracedDB) current() *sql.DB {
+	return t.pool.Load()
+}
+
+// PingContext checks that the current pool can reach the database
+func (t *tracedDB) PingContext(ctx context.Context) error {
+	return t.current().PingContext(ctx)
+}
+
+// Stats returns the statistics of the current pool
+func (t *tracedDB) Stats() sql.DBStats {
+	return t.current().Stats()
+}
+
+// ExecContext executes a statement inside a span
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	if err := injectFault(ctx, ChaosTargetDB); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	result, err := t.current().ExecContext(ctx, annotateQuery(ctx, query), args...)
+	span.RecordError(err)
+	return result, err
+}
+
+// QueryContext runs a query inside a span
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	if err := injectFault(ctx, ChaosTargetDB); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	rows, err := t.current().QueryContext(ctx, annotateQuery(ctx, query), args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+// QueryRowContext runs a single-row query inside a span, which ends once the row is scanned
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *tracedRow {
+	ctx, span := startQuerySpan(ctx, query)
+
+	if err := injectFault(ctx, ChaosTargetDB); err != nil {
+		// A Row can only carry an error from the driver, so fail the query by cancelling it
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		ctx = cancelled
+	}
+	return &tracedRow{Row: t.current().QueryRowContext(ctx, annotateQuery(ctx, query), args...), span: span}
+}
+
+// tracedRow is the result of a traced single-row query. The row is only read from the database
+// when it is scanned, so its span ends there rather than when the query is sent.
+type tracedRow struct {
+	*sql.Row
+	span  *Span
+	ended bool
+}
+
+// Scan copies the row into dest and ends the query's span
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if !r.ended {
+		if err != sql.ErrNoRows {
+			r.span.RecordError(err)
+		}
+		r.span.End()
+		r.ended = true
+	}
+	return err
+}
+
+// BeginTx starts a transaction, unless chaos mode fails it
+func (t *tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if err := injectFault(ctx, ChaosTargetDB); err != nil {
+		return nil, err
+	}
+	return t.current().BeginTx(ctx, opts)
+}
+
+// startQuerySpan starts a client span describing a SQL statement
+func startQuerySpan(ctx context.Context, query string) (context.Context, *Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+	operation := statement
+	if i := strings.Index(statement, " "); i > 0 {
+		operation = statement[:i]
+	}
+
+	ctx, span := StartSpan(ctx, "db "+strings.ToUpper(operation), SpanKindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.query.text", statement)
+	return ctx, span
+}
+
+// InitDB connects to PostgreSQL and, unless DB_AUTO_MIGRATE is false, applies pending schema migrations
 func InitDB() error {
+	if err := OpenDB(); err != nil {
+		return err
+	}
+
+	if autoMigrate, set := envBool("DB_AUTO_MIGRATE"); set && !autoMigrate {
+		log.Println("[DB] DB_AUTO_MIGRATE is false, skipping schema migrations")
+		return nil
+	}
+
+	// Every region holds the full schema
+	return ForEachDataRegion(context.Background(), func(ctx context.Context, region string) error {
+		applied, err := MigrateUp(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		log.Printf("[DB] Schema of the %s region up to date (%d migrations applied)", region, applied)
+		return nil
+	})
+}
+
+// OpenDB opens the PostgreSQL connection pool, creating the database if it does not exist
+func OpenDB() error {
 	log.Println("[DB] Initializing database connection...")
 
 	// Load environment variables from .env file if they haven't been loaded yet
@@ -48,27 +254,46 @@ func InitDB() error {
 		log.Println("[DB] Using default database name: animations")
 	}
 
-	log.Printf("[DB] Connecting to PostgreSQL at %s:%s", dbHost, dbPort)
-
-	// First, connect to the 'postgres' database to check if our target database exists
-	connStrPostgres := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=postgres sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword)
-
-	dbPostgres, err := sql.Open("postgres", connStrPostgres)
+	hosts, err := parseDBHosts(dbHost, dbPort)
 	if err != nil {
-		return fmt.Errorf("failed to connect to postgres database: %v", err)
+		return err
+	}
+	readWrite := len(hosts) > 1
+	if attrs := os.Getenv("DB_TARGET_SESSION_ATTRS"); attrs != "" {
+		if readWrite, err = parseTargetSessionAttrs(attrs); err != nil {
+			return err
+		}
 	}
+	log.Printf("[DB] Connecting to PostgreSQL at %s", formatDBHosts(hosts))
+
+	// Every host gets the same credentials; only host and port differ
+	dsnFor := func(dbname string) func(h dbHostPort) string {
+		return func(h dbHostPort) string {
+			return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+				h.Host, h.Port, dbUser, dbPassword, dbname)
+		}
+	}
+
+	// First, connect to the 'postgres' database to check if our target database exists
+	dbPostgres := sql.OpenDB(newFailoverConnector(hosts, dsnFor("postgres"), readWrite))
 	defer dbPostgres.Close()
 
+	// Bound each setup step so startup fails instead of hanging when PostgreSQL is unresponsive
+	ctx := context.Background()
+
 	// Check if we can connect
-	if err = dbPostgres.Ping(); err != nil {
+	pingCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	if err = dbPostgres.PingContext(pingCtx); err != nil {
 		return fmt.Errorf("failed to ping postgres database: %v", err)
 	}
 	log.Println("[DB] Successfully connected to PostgreSQL")
 
 	// Check if our database exists
 	var exists bool
-	err = dbPostgres.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&exists)
+	existsCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	err = dbPostgres.QueryRowContext(existsCtx, "SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("failed to check if database exists: %v", err)
 	}
@@ -76,7 +301,9 @@ func InitDB() error {
 	// If database doesn't exist, create it
 	if !exists {
 		log.Printf("[DB] Database '%s' does not exist, creating it...", dbName)
-		_, err = dbPostgres.Exec(fmt.Sprintf("CREATE DATABASE %s", dbName))
+		createCtx, cancel := withQueryTimeout(ctx)
+		defer cancel()
+		_, err = dbPostgres.ExecContext(createCtx, fmt.Sprintf("CREATE DATABASE %s", dbName))
 		if err != nil {
 			return fmt.Errorf("failed to create database: %v", err)
 		}
@@ -86,121 +313,23 @@ func InitDB() error {
 	}
 
 	// Now connect to our target database
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	// Connect to the PostgreSQL database
-	db, err = sql.Open("postgres", connStr)
-	if err != nil {
-		return fmt.Errorf("failed to connect to %s database: %v", dbName, err)
-	}
+	connector := newFailoverConnector(hosts, dsnFor(dbName), readWrite)
+	conn := sql.OpenDB(connector)
+	poolConfig := DBPoolConfigFromEnv()
+	poolConfig.Apply(conn)
+	db = newTracedDB(conn, connector)
+	log.Printf("[DB] Connection pool: max open %d, max idle %d, max lifetime %s, max idle time %s",
+		poolConfig.MaxOpenConns, poolConfig.MaxIdleConns, poolConfig.ConnMaxLifetime, poolConfig.ConnMaxIdleTime)
 
 	// Check the connection
-	if err = db.Ping(); err != nil {
+	connCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	if err = db.PingContext(connCtx); err != nil {
 		return fmt.Errorf("failed to ping %s database: %v", dbName, err)
 	}
 	log.Printf("[DB] Successfully connected to '%s' database", dbName)
 
-	// Create tables
-	log.Println("[DB] Setting up database tables...")
-
-	// Create animations table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS animations (
-			id VARCHAR(32) PRIMARY KEY,
-			code TEXT NOT NULL,
-			description TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create animations table: %v", err)
-	}
-	log.Println("[DB] Animations table created or already exists")
-
-	// Create users table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id VARCHAR(32) PRIMARY KEY,
-			email VARCHAR(255) UNIQUE NOT NULL,
-			username VARCHAR(255),
-			password_hash TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create users table: %v", err)
-	}
-	log.Println("[DB] Users table created or already exists")
-
-	// Create user_moods table if it doesn't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS user_moods (
-			id SERIAL PRIMARY KEY,
-			user_id VARCHAR(32) NOT NULL,
-			animation_id VARCHAR(32) NOT NULL,
-			mood VARCHAR(20) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id),
-			FOREIGN KEY (animation_id) REFERENCES animations(id)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create user_moods table: %v", err)
-	}
-	log.Println("[DB] User_moods table created or already exists")
-
-	// Create indexes for better query performance
-	log.Println("[DB] Creating indexes...")
-
-	// Add index on animations table for faster lookups
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_animations_id ON animations(id)`)
-	if err != nil {
-		log.Printf("[DB] Warning: Failed to create index on animations table: %v", err)
-	}
-
-	// Add indexes on user_moods table for faster lookups
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_user_moods_user_id ON user_moods(user_id)`)
-	if err != nil {
-		log.Printf("[DB] Warning: Failed to create user_id index on user_moods table: %v", err)
-	}
-
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_user_moods_animation_id ON user_moods(animation_id)`)
-	if err != nil {
-		log.Printf("[DB] Warning: Failed to create animation_id index on user_moods table: %v", err)
-	}
-
-	// Keep the latest legacy mood before enforcing one mood per user and animation.
-	_, err = db.Exec(`
-		DELETE FROM user_moods AS older
-		USING user_moods AS newer
-		WHERE older.user_id = newer.user_id
-			AND older.animation_id = newer.animation_id
-			AND older.id < newer.id
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to remove duplicate user moods: %w", err)
-	}
-
-	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_moods_unique_user_animation ON user_moods(user_id, animation_id)`)
-	if err != nil {
-		return fmt.Errorf("failed to enforce unique user moods: %w", err)
-	}
-
-	// Add index on email for faster user lookups
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`)
-	if err != nil {
-		log.Printf("[DB] Warning: Failed to create email index on users table: %v", err)
-	}
-
-	// Perform any necessary migrations for existing databases
-	log.Println("[DB] Checking for necessary database migrations...")
-	if err := performDatabaseMigrations(); err != nil {
-		log.Printf("[DB] Warning: Some database migrations may have failed: %v", err)
-	}
-
-	log.Println("[DB] Database initialization completed successfully")
-	return nil
+	return openRegionDBs(ctx)
 }
 
 // generateRandomID generates a random ID for database records
@@ -212,184 +341,272 @@ func generateRandomID() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes)[:22], nil
 }
 
-// UserExists checks if a user with the given email already exists
-func UserExists(email string) bool {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = $1", email).Scan(&count)
+// moodEncryptionBatchSize is how many moods EncryptMoods updates per transaction
+const moodEncryptionBatchSize = 500
+
+// EncryptMoods seals every mood stored in plain text and re-wraps the data keys of moods sealed
+// under an older key with the active one. Run it after configuring MOOD_ENCRYPTION_KEYS and after
+// each rotation; once it returns, the old key can be removed.
+func EncryptMoods(ctx context.Context) (int, error) {
+	ring, err := MoodKeyring()
 	if err != nil {
-		log.Printf("[DB ERROR] Failed to check if user exists: %v", err)
-		return false
+		return 0, err
+	}
+	if ring == nil {
+		return 0, errors.New("MOOD_ENCRYPTION_KEYS is not set")
+	}
+
+	updated := 0
+	for {
+		n, err := encryptMoodBatch(ctx, ring)
+		updated += n
+		if err != nil || n == 0 {
+			return updated, err
+		}
+		log.Printf("[DB] Encrypted or re-wrapped %d moods so far", updated)
 	}
-	return count > 0
 }
 
-// CreateUserWithUsername creates a new user with username in the database
-func CreateUserWithUsername(email, username, passwordHash string) (string, error) {
-	// Generate a random user ID
-	userId, err := generateRandomID()
+// encryptMoodBatch updates one batch of moods not yet under the active key
+func encryptMoodBatch(ctx context.Context, ring *Keyring) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := dbFor(ctx).BeginTx(ctx, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate user ID: %v", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Insert the user into the database
-	_, err = db.Exec(
-		"INSERT INTO users (id, email, username, password_hash) VALUES ($1, $2, $3, $4)",
-		userId, email, username, passwordHash,
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, mood, mood_encrypted, mood_key_id FROM user_moods
+		 WHERE mood_key_id IS DISTINCT FROM $1
+		 ORDER BY id LIMIT $2 FOR UPDATE`,
+		ring.ActiveKeyID(), moodEncryptionBatchSize,
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to insert user: %v", err)
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	type sealedMood struct {
+		id       int
+		envelope []byte
+	}
+	var batch []sealedMood
+	for rows.Next() {
+		var id int
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&id, &plain, &encrypted, &keyId); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("database error: %v", err)
+		}
+
+		var envelope []byte
+		if keyId.Valid {
+			_, envelope, err = ring.Rewrap(keyId.String, encrypted)
+		} else {
+			_, envelope, err = ring.Seal([]byte(plain.String))
+		}
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("mood %d: %w", id, err)
+		}
+		batch = append(batch, sealedMood{id: id, envelope: envelope})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
 	}
 
-	log.Printf("[DB] User created successfully with ID: %s", userId)
-	return userId, nil
+	for _, mood := range batch {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE user_moods SET mood = NULL, mood_encrypted = $1, mood_key_id = $2 WHERE id = $3",
+			mood.envelope, ring.ActiveKeyID(), mood.id,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update mood %d: %v", mood.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(batch), nil
 }
 
-// GetUserCredentials retrieves user credentials for authentication
-func GetUserCredentials(email string) (string, string, error) {
-	var userId, passwordHash string
-	err := db.QueryRow(
-		"SELECT id, password_hash FROM users WHERE email = $1",
-		email,
-	).Scan(&userId, &passwordHash)
+// emailEncryptionBatchSize is how many rows EncryptEmails updates per transaction
+const emailEncryptionBatchSize = 500
 
+// EncryptEmails seals every email stored in plain text, in users and in the email change history,
+// and re-wraps the data keys of emails sealed under an older key with the active one. Run it after
+// configuring EMAIL_ENCRYPTION_KEYS and EMAIL_INDEX_KEY and after each rotation; once it returns,
+// the old key can be removed.
+func EncryptEmails(ctx context.Context) (int, error) {
+	cipher, err := EmailEncryption()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", "", errors.New("user not found")
+		return 0, err
+	}
+	if cipher == nil {
+		return 0, errors.New("EMAIL_ENCRYPTION_KEYS and EMAIL_INDEX_KEY are not set")
+	}
+
+	updated := 0
+	for _, batch := range []func(context.Context, *EmailCipher) (int, error){encryptUserEmailBatch, encryptEmailChangeBatch} {
+		for {
+			n, err := batch(ctx, cipher)
+			updated += n
+			if err != nil {
+				return updated, err
+			}
+			if n == 0 {
+				break
+			}
+			log.Printf("[DB] Encrypted or re-wrapped %d emails so far", updated)
 		}
-		return "", "", fmt.Errorf("database error: %v", err)
 	}
-
-	return userId, passwordHash, nil
+	return updated, nil
 }
 
-// SaveAnimation saves an animation to the database
-func SaveAnimation(code string, description string) (string, error) {
-	// Generate a random animation ID
-	animationId, err := generateRandomID()
+// encryptUserEmailBatch updates one batch of users whose email is not yet under the active key
+func encryptUserEmailBatch(ctx context.Context, cipher *EmailCipher) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := dbFor(ctx).BeginTx(ctx, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate animation ID: %v", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Insert the animation into the database
-	_, err = db.Exec(
-		"INSERT INTO animations (id, code, description) VALUES ($1, $2, $3)",
-		animationId, code, description,
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, email, email_encrypted, email_key_id FROM users
+		 WHERE email_key_id IS DISTINCT FROM $1
+		 ORDER BY id LIMIT $2 FOR UPDATE`,
+		cipher.ring.ActiveKeyID(), emailEncryptionBatchSize,
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to insert animation: %v", err)
-	}
-
-	log.Printf("[DB] Animation saved successfully with ID: %s", animationId)
-	return animationId, nil
-}
-
-// GetAnimation retrieves an animation from the database
-func GetAnimation(id string) (string, string, error) {
-	var code, description string
-	err := db.QueryRow(
-		"SELECT code, description FROM animations WHERE id = $1",
-		id,
-	).Scan(&code, &description)
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	type sealedEmail struct {
+		userId   string
+		hash     sql.NullString
+		envelope []byte
+	}
+	var batch []sealedEmail
+	for rows.Next() {
+		var userId string
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&userId, &plain, &encrypted, &keyId); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("database error: %v", err)
+		}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", "", errors.New("animation not found")
+		sealed := sealedEmail{userId: userId}
+		if keyId.Valid {
+			_, sealed.envelope, err = cipher.ring.Rewrap(keyId.String, encrypted)
+		} else {
+			sealed.hash = sql.NullString{String: cipher.Index(plain.String), Valid: true}
+			_, sealed.envelope, err = cipher.ring.Seal([]byte(plain.String))
+		}
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("user %s: %w", userId, err)
 		}
-		return "", "", fmt.Errorf("database error: %v", err)
+		batch = append(batch, sealed)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
 	}
 
-	return code, description, nil
-}
-
-// GetUserDetails retrieves user details by user ID
-func GetUserDetails(userId string) (User, error) {
-	var user User
-	err := db.QueryRow(
-		"SELECT id, email, username FROM users WHERE id = $1",
-		userId,
-	).Scan(&user.ID, &user.Email, &user.Username)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return user, errors.New("user not found")
+	for _, sealed := range batch {
+		// Re-wrapped rows keep their index; it only depends on EMAIL_INDEX_KEY
+		_, err := tx.ExecContext(ctx,
+			`UPDATE users SET email = NULL, email_hash = COALESCE($1, email_hash), email_encrypted = $2, email_key_id = $3
+			 WHERE id = $4`,
+			sealed.hash, sealed.envelope, cipher.ring.ActiveKeyID(), sealed.userId,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update email of user %s: %v", sealed.userId, err)
 		}
-		return user, fmt.Errorf("database error: %v", err)
 	}
-
-	return user, nil
-}
-
-// AnimationExists checks if an animation with the given ID exists
-func AnimationExists(id string) bool {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM animations WHERE id = $1", id).Scan(&count)
-	if err != nil {
-		log.Printf("[DB ERROR] Failed to check if animation exists: %v", err)
-		return false
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
-	return count > 0
+	return len(batch), nil
 }
 
-// GetRandomAnimation retrieves a random animation from the database
-func GetRandomAnimation() (GetAnimationResponse, error) {
-	var animation GetAnimationResponse
-	err := db.QueryRow(
-		"SELECT id, code, description FROM animations ORDER BY RANDOM() LIMIT 1",
-	).Scan(&animation.ID, &animation.Code, &animation.Description)
+// encryptEmailChangeBatch updates one batch of email changes not yet under the active key
+func encryptEmailChangeBatch(ctx context.Context, cipher *EmailCipher) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
 
+	tx, err := dbFor(ctx).BeginTx(ctx, nil)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return animation, errors.New("no animations found")
-		}
-		return animation, fmt.Errorf("database error: %v", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return animation, nil
-}
-
-// SaveMood saves a user's mood for an animation
-func SaveMood(userId string, animationId string, mood string) error {
-	_, err := db.Exec(
-		`INSERT INTO user_moods (user_id, animation_id, mood)
-		 VALUES ($1, $2, $3)
-		 ON CONFLICT (user_id, animation_id)
-		 DO UPDATE SET mood = EXCLUDED.mood, created_at = CURRENT_TIMESTAMP`,
-		userId, animationId, mood,
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, old_value, new_value, old_value_encrypted, new_value_encrypted, value_key_id FROM profile_changes
+		 WHERE field = 'email' AND value_key_id IS DISTINCT FROM $1
+		 ORDER BY id LIMIT $2 FOR UPDATE`,
+		cipher.ring.ActiveKeyID(), emailEncryptionBatchSize,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to save mood: %w", err)
-	}
-
-	log.Printf("[DB] Mood saved successfully for user %s and animation %s", userId, animationId)
-	return nil
-}
-
-// performDatabaseMigrations performs any necessary database migrations
-func performDatabaseMigrations() error {
-	// Check if username column exists in users table
-	var columnExists bool
-	err := db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 
-			FROM information_schema.columns 
-			WHERE table_name = 'users' 
-			AND column_name = 'username'
-		)
-	`).Scan(&columnExists)
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	type sealedChange struct {
+		id                       int
+		oldEnvelope, newEnvelope []byte
+	}
+	var batch []sealedChange
+	for rows.Next() {
+		var change storedEmailChange
+		var id int
+		if err := rows.Scan(&id, &change.oldValue, &change.newValue, &change.oldEncrypted, &change.newEncrypted, &change.keyId); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("database error: %v", err)
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to check for username column: %v", err)
+		sealed := sealedChange{id: id}
+		if change.keyId.Valid {
+			if _, sealed.oldEnvelope, err = cipher.ring.Rewrap(change.keyId.String, change.oldEncrypted); err == nil {
+				_, sealed.newEnvelope, err = cipher.ring.Rewrap(change.keyId.String, change.newEncrypted)
+			}
+		} else {
+			if _, sealed.oldEnvelope, err = cipher.ring.Seal([]byte(change.oldValue.String)); err == nil {
+				_, sealed.newEnvelope, err = cipher.ring.Seal([]byte(change.newValue.String))
+			}
+		}
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("profile change %d: %w", id, err)
+		}
+		batch = append(batch, sealed)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
 	}
 
-	// Add username column if it doesn't exist
-	if !columnExists {
-		log.Println("[DB] Adding username column to users table...")
-		_, err = db.Exec("ALTER TABLE users ADD COLUMN username VARCHAR(255)")
+	for _, sealed := range batch {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE profile_changes SET old_value = NULL, new_value = NULL,
+			        old_value_encrypted = $1, new_value_encrypted = $2, value_key_id = $3
+			 WHERE id = $4`,
+			sealed.oldEnvelope, sealed.newEnvelope, cipher.ring.ActiveKeyID(), sealed.id,
+		)
 		if err != nil {
-			return fmt.Errorf("failed to add username column: %v", err)
+			return 0, fmt.Errorf("failed to update profile change %d: %v", sealed.id, err)
 		}
-		log.Println("[DB] Username column added successfully")
 	}
-
-	return nil
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(batch), nil
 }
+
+// monthlyGenerationCountQuery sums a user's generations for the current calendar month
+const monthlyGenerationCountQuery = `SELECT COALESCE(SUM(generation_count), 0) FROM generation_usage
+	WHERE user_id = $1 AND usage_date >= date_trunc('month', CURRENT_DATE)`
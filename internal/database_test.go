@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWithQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      string
+		parent       time.Duration
+		wantDeadline bool
+		wantWithin   time.Duration
+	}{
+		{name: "default", wantDeadline: true, wantWithin: 5 * time.Second},
+		{name: "configured", timeout: "1", wantDeadline: true, wantWithin: time.Second},
+		{name: "disabled", timeout: "0"},
+		{name: "earlier parent deadline wins", timeout: "30", parent: 100 * time.Millisecond, wantDeadline: true, wantWithin: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_QUERY_TIMEOUT_SECONDS", tt.timeout)
+
+			parent := context.Background()
+			if tt.parent > 0 {
+				var cancel context.CancelFunc
+				parent, cancel = context.WithTimeout(parent, tt.parent)
+				defer cancel()
+			}
+
+			ctx, cancel := withQueryTimeout(parent)
+			deadline, ok := ctx.Deadline()
+			if ok != tt.wantDeadline {
+				t.Fatalf("has deadline = %v, want %v", ok, tt.wantDeadline)
+			}
+			if ok && time.Until(deadline) > tt.wantWithin {
+				t.Errorf("deadline in %s, want at most %s", time.Until(deadline), tt.wantWithin)
+			}
+
+			cancel()
+			if ctx.Err() == nil {
+				t.Error("context not cancelled by its cancel func")
+			}
+		})
+	}
+}
+
+// oneRowConnector opens connections whose every query returns a single row holding 1
+type oneRowConnector struct{}
+
+func (oneRowConnector) Connect(context.Context) (driver.Conn, error) { return oneRowConn{}, nil }
+func (oneRowConnector) Driver() driver.Driver                        { return nil }
+
+type oneRowConn struct{}
+
+func (oneRowConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (oneRowConn) Close() error                        { return nil }
+func (oneRowConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+func (oneRowConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &oneRow{}, nil
+}
+
+type oneRow struct{ read bool }
+
+func (*oneRow) Columns() []string { return []string{"n"} }
+func (*oneRow) Close() error      { return nil }
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read, dest[0] = true, int64(1)
+	return nil
+}
+
+func TestTracedRowEndsSpanOnScan(t *testing.T) {
+	db := sql.OpenDB(oneRowConnector{})
+	defer db.Close()
+
+	exporter := &tracer{queue: make(chan *Span, 2)}
+	row := &tracedRow{Row: db.QueryRowContext(context.Background(), "SELECT 1"), span: &Span{tracer: exporter}}
+	if len(exporter.queue) != 0 {
+		t.Fatal("span ended before the row was scanned")
+	}
+
+	var n int
+	if err := row.Scan(&n); err != nil || n != 1 {
+		t.Fatalf("Scan = %d, %v", n, err)
+	}
+	if len(exporter.queue) != 1 {
+		t.Fatalf("%d spans ended after Scan, want 1", len(exporter.queue))
+	}
+	if span := <-exporter.queue; span.end.IsZero() {
+		t.Error("span has no end time")
+	}
+	row.Scan(&n)
+	if len(exporter.queue) != 0 {
+		t.Error("scanning again ended the span twice")
+	}
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Defaults for the research dataset
+const (
+	defaultDatasetInterval     = 24 * time.Hour
+	defaultDatasetMinGroupSize = 10
+	// datasetCheckInterval is how often the publisher checks whether the dataset is due
+	datasetCheckInterval = time.Hour
+	// datasetsKept is how many published datasets are kept
+	datasetsKept = 5
+)
+
+// DatasetInterval returns how often the research dataset is regenerated, configured by
+// DATASET_INTERVAL_HOURS. Zero disables publishing.
+func DatasetInterval() time.Duration {
+	return envHours("DATASET_INTERVAL_HOURS", defaultDatasetInterval)
+}
+
+// DatasetMinGroupSize returns the k of the dataset's k-anonymity threshold: mood statistics drawn
+// from fewer people are suppressed. Configured by DATASET_MIN_GROUP_SIZE.
+func DatasetMinGroupSize() int {
+	if k := envLimit("DATASET_MIN_GROUP_SIZE", defaultDatasetMinGroupSize); k > 0 {
+		return k
+	}
+	return 1
+}
+
+// AnonymizeDataset builds the dataset published from animations. Each user records at most one mood
+// per animation, so an animation's mood total is the number of people behind its statistics; below
+// minGroupSize they are suppressed. Totals across all animations are suppressed the same way.
+func AnonymizeDataset(animations []DatasetAnimation, minGroupSize int, generatedAt time.Time) Dataset {
+	dataset := Dataset{
+		GeneratedAt:  generatedAt.UTC(),
+		MinGroupSize: minGroupSize,
+		Animations:   make([]DatasetAnimation, 0, len(animations)),
+		MoodTotals:   make(map[Mood]int),
+	}
+	total := 0
+	for _, animation := range animations {
+		for mood, count := range animation.MoodCounts {
+			dataset.MoodTotals[mood] += count
+			total += count
+		}
+		animation.CreatedWeek = weekStart(animation.CreatedWeek)
+		if animation.MoodTotal < minGroupSize {
+			animation.MoodCounts, animation.MoodTotal = nil, 0
+			animation.MoodsSuppressed = true
+		}
+		dataset.Animations = append(dataset.Animations, animation)
+	}
+	if total < minGroupSize {
+		dataset.MoodTotals = nil
+	}
+	return dataset
+}
+
+// PublishDataset generates and stores a new dataset
+func PublishDataset(ctx context.Context, store DatasetStore) (Dataset, error) {
+	animations, err := store.ListDatasetAnimations(ctx)
+	if err != nil {
+		return Dataset{}, err
+	}
+	dataset := AnonymizeDataset(animations, DatasetMinGroupSize(), time.Now())
+	if err := store.SaveDataset(ctx, dataset); err != nil {
+		return Dataset{}, err
+	}
+	log.Printf("[DATASET] Published dataset of %d animations", len(dataset.Animations))
+	return dataset, nil
+}
+
+// RunDatasetPublisher regenerates the dataset whenever the latest one is older than DatasetInterval,
+// until ctx is done. Replicas may each publish once when they start together; readers only ever see
+// the latest.
+func RunDatasetPublisher(ctx context.Context, store DatasetStore) {
+	interval := DatasetInterval()
+	if interval == 0 {
+		log.Println("[DATASET] DATASET_INTERVAL_HOURS is 0, not publishing datasets")
+		return
+	}
+	for {
+		latest, err := store.GetLatestDataset(ctx)
+		if err != nil && err.Error() != "dataset not found" {
+			log.Printf("[DATASET] Failed to read the latest dataset: %v", err)
+		} else if err != nil || time.Since(latest.GeneratedAt) >= interval {
+			if _, err = PublishDataset(ctx, store); err != nil {
+				log.Printf("[DATASET] Failed to publish dataset: %v", err)
+			}
+		}
+		recordWorkerPass("dataset publishing", min(interval, datasetCheckInterval), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(interval, datasetCheckInterval)):
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnonymizeDataset(t *testing.T) {
+	created := time.Date(2026, 3, 12, 15, 30, 0, 0, time.UTC) // a Thursday
+	animations := []DatasetAnimation{
+		{ID: "popular", CreatedWeek: created, MoodCounts: map[Mood]int{MoodBetter: 2, MoodSame: 1}, MoodTotal: 3},
+		{ID: "rare", CreatedWeek: created, MoodCounts: map[Mood]int{MoodWorse: 1}, MoodTotal: 1},
+		{ID: "unrated", CreatedWeek: created},
+	}
+
+	tests := []struct {
+		name           string
+		minGroupSize   int
+		wantSuppressed map[string]bool
+		wantTotals     map[Mood]int
+	}{
+		{name: "Low threshold", minGroupSize: 1,
+			wantSuppressed: map[string]bool{"unrated": true},
+			wantTotals:     map[Mood]int{MoodBetter: 2, MoodSame: 1, MoodWorse: 1}},
+		{name: "Small groups suppressed", minGroupSize: 3,
+			wantSuppressed: map[string]bool{"rare": true, "unrated": true},
+			wantTotals:     map[Mood]int{MoodBetter: 2, MoodSame: 1, MoodWorse: 1}},
+		{name: "Everything suppressed", minGroupSize: 5,
+			wantSuppressed: map[string]bool{"popular": true, "rare": true, "unrated": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := AnonymizeDataset(animations, tt.minGroupSize, created)
+			if len(dataset.Animations) != len(animations) {
+				t.Fatalf("animations = %d, want %d", len(dataset.Animations), len(animations))
+			}
+			for _, animation := range dataset.Animations {
+				suppressed := tt.wantSuppressed[animation.ID]
+				if animation.MoodsSuppressed != suppressed {
+					t.Errorf("%s suppressed = %v, want %v", animation.ID, animation.MoodsSuppressed, suppressed)
+				}
+				if suppressed && (animation.MoodCounts != nil || animation.MoodTotal != 0) {
+					t.Errorf("%s publishes suppressed moods %v", animation.ID, animation.MoodCounts)
+				}
+				if want := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC); !animation.CreatedWeek.Equal(want) {
+					t.Errorf("%s createdWeek = %v, want %v", animation.ID, animation.CreatedWeek, want)
+				}
+			}
+			if len(dataset.MoodTotals) != len(tt.wantTotals) {
+				t.Fatalf("moodTotals = %v, want %v", dataset.MoodTotals, tt.wantTotals)
+			}
+			for mood, count := range tt.wantTotals {
+				if dataset.MoodTotals[mood] != count {
+					t.Errorf("moodTotals[%s] = %d, want %d", mood, dataset.MoodTotals[mood], count)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestDataset(t *testing.T) {
+	t.Setenv("DATASET_MIN_GROUP_SIZE", "2")
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/datasets/latest", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status before publishing = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	animationId, _ := store.SaveAnimation(ctx, "function draw() {}", "calm waves", "", "")
+	var userIds []string
+	for _, email := range []string{"ada@example.com", "bob@example.com"} {
+		userId, _ := store.CreateUserWithUsername(ctx, email, strings.Split(email, "@")[0], "hash")
+		store.SaveMood(ctx, userId, animationId, string(MoodBetter))
+		userIds = append(userIds, userId)
+	}
+	if _, err := PublishDataset(ctx, store); err != nil {
+		t.Fatalf("PublishDataset: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/datasets/latest", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("Last-Modified header missing")
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"moodCounts":{"better":2}`) {
+		t.Errorf("dataset does not publish mood counts: %s", body)
+	}
+	for _, leaked := range append(userIds, "ada@example.com", "bob@example.com") {
+		if strings.Contains(body, leaked) {
+			t.Errorf("dataset contains user identifier %q", leaked)
+		}
+	}
+}
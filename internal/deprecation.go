@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DeprecatedFieldsHeader names the response fields a route still returns but clients should stop reading
+	DeprecatedFieldsHeader = "X-Deprecated-Fields"
+	// maxDeprecationConsumers caps how many consumers are tracked per deprecation; requests from
+	// further consumers are still counted towards its total
+	maxDeprecationConsumers = 200
+)
+
+// DeprecationRule marks a route, or one field of its responses, as deprecated
+type DeprecationRule struct {
+	// Route is a route template such as /animation/{id}
+	Route string `json:"route"`
+	// Method limits the rule to one method; empty matches every method
+	Method string `json:"method,omitempty"`
+	// Field names a deprecated response field; empty deprecates the whole route
+	Field string `json:"field,omitempty"`
+	// DeprecatedAt is when the route or field was deprecated
+	DeprecatedAt time.Time `json:"deprecatedAt"`
+	// Sunset is when the route stops being served; it is not sent for fields
+	Sunset *time.Time `json:"sunset,omitempty"`
+	// Link points to migration notes
+	Link string `json:"link,omitempty"`
+}
+
+// name identifies the rule in logs and reports
+func (d DeprecationRule) name() string {
+	name := d.Route
+	if d.Method != "" {
+		name = d.Method + " " + name
+	}
+	if d.Field != "" {
+		name += " field " + d.Field
+	}
+	return name
+}
+
+// parseDeprecationRules parses the JSON array of rules in DEPRECATIONS
+func parseDeprecationRules(raw string) ([]DeprecationRule, error) {
+	var rules []DeprecationRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("DEPRECATIONS is not a JSON array of rules: %v", err)
+	}
+	for i, rule := range rules {
+		switch {
+		case !strings.HasPrefix(rule.Route, "/"):
+			return nil, errors.New("DEPRECATIONS has a rule without a route template")
+		case rule.DeprecatedAt.IsZero():
+			return nil, fmt.Errorf("DEPRECATIONS rule for %s needs deprecatedAt", rule.name())
+		case rule.Sunset != nil && rule.Field != "":
+			return nil, fmt.Errorf("DEPRECATIONS rule for %s sets a sunset, which only routes have", rule.name())
+		case rule.Sunset != nil && !rule.Sunset.After(rule.DeprecatedAt):
+			return nil, fmt.Errorf("DEPRECATIONS rule for %s has its sunset before it was deprecated", rule.name())
+		}
+		if rule.Link != "" {
+			if link, err := url.Parse(rule.Link); err != nil || !link.IsAbs() {
+				return nil, fmt.Errorf("DEPRECATIONS rule for %s needs an absolute link", rule.name())
+			}
+		}
+		rules[i].Method = strings.ToUpper(rule.Method)
+	}
+	return rules, nil
+}
+
+// DeprecationRules returns the deprecated routes and fields configured by DEPRECATIONS
+func DeprecationRules() []DeprecationRule {
+	raw := os.Getenv("DEPRECATIONS")
+	if raw == "" {
+		return nil
+	}
+	rules, err := parseDeprecationRules(raw)
+	if err != nil {
+		log.Printf("[DEPRECATION] Ignoring deprecations: %v", err)
+		return nil
+	}
+	return rules
+}
+
+// deprecationHeaders sets the Deprecation, Sunset and Link headers for the rules a request matched,
+// as RFC 9745 and RFC 8594 describe them. Several rules announce the earliest dates among them.
+func deprecationHeaders(header http.Header, matched []DeprecationRule) {
+	var deprecatedAt time.Time
+	var sunset *time.Time
+	var fields []string
+	for _, rule := range matched {
+		if deprecatedAt.IsZero() || rule.DeprecatedAt.Before(deprecatedAt) {
+			deprecatedAt = rule.DeprecatedAt
+		}
+		if rule.Sunset != nil && (sunset == nil || rule.Sunset.Before(*sunset)) {
+			sunset = rule.Sunset
+		}
+		if rule.Field != "" {
+			fields = append(fields, rule.Field)
+		}
+		if rule.Link != "" {
+			header.Add("Link", "<"+rule.Link+`>; rel="deprecation"`)
+		}
+	}
+	header.Set("Deprecation", "@"+strconv.FormatInt(deprecatedAt.Unix(), 10))
+	if sunset != nil {
+		header.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	if len(fields) > 0 {
+		header.Set(DeprecatedFieldsHeader, strings.Join(fields, ", "))
+	}
+}
+
+// deprecationConsumer names who made a request: the third-party app, impersonating admin or
+// signed-in user, or anonymous
+func deprecationConsumer(r *http.Request) string {
+	if token, ok := GetAppTokenFromContext(r.Context()); ok {
+		return "app " + token.ClientID
+	}
+	if impersonation, ok := GetImpersonationFromContext(r.Context()); ok {
+		return "admin " + impersonation.AdminID + " as user " + impersonation.UserID
+	}
+	if secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if token, err := parseJWT(secret); err == nil && token.Valid {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if userId, ok := claims["userId"].(string); ok {
+					return "user " + userId
+				}
+			}
+		}
+	}
+	return "anonymous"
+}
+
+type deprecationUse struct {
+	rule      int
+	consumer  string
+	userAgent string
+}
+
+// deprecationTracker counts the requests each consumer made to deprecated routes and fields on
+// this instance
+type deprecationTracker struct {
+	rules     []DeprecationRule
+	mu        sync.Mutex
+	requests  []int64
+	consumers map[deprecationUse]*DeprecationConsumer
+	tracked   []int
+}
+
+func newDeprecationTracker(rules []DeprecationRule) *deprecationTracker {
+	return &deprecationTracker{
+		rules:     rules,
+		requests:  make([]int64, len(rules)),
+		consumers: map[deprecationUse]*DeprecationConsumer{},
+		tracked:   make([]int, len(rules)),
+	}
+}
+
+// record counts one request under a rule and reports whether it is the consumer's first
+func (t *deprecationTracker) record(use deprecationUse, at time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests[use.rule]++
+	if consumer, ok := t.consumers[use]; ok {
+		consumer.Requests++
+		consumer.LastSeen = at
+		return false
+	}
+	if t.tracked[use.rule] >= maxDeprecationConsumers {
+		return false
+	}
+	t.tracked[use.rule]++
+	t.consumers[use] = &DeprecationConsumer{Consumer: use.consumer, UserAgent: use.userAgent, Requests: 1, FirstSeen: at, LastSeen: at}
+	return true
+}
+
+// report returns each rule with the consumers still using it, busiest first
+func (t *deprecationTracker) report() DeprecationReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := DeprecationReport{Deprecations: make([]DeprecationUsage, len(t.rules))}
+	for i, rule := range t.rules {
+		report.Deprecations[i] = DeprecationUsage{DeprecationRule: rule, Requests: t.requests[i], Consumers: []DeprecationConsumer{}}
+	}
+	for use, consumer := range t.consumers {
+		report.Deprecations[use.rule].Consumers = append(report.Deprecations[use.rule].Consumers, *consumer)
+	}
+	for _, usage := range report.Deprecations {
+		sort.Slice(usage.Consumers, func(i, j int) bool {
+			if usage.Consumers[i].Requests != usage.Consumers[j].Requests {
+				return usage.Consumers[i].Requests > usage.Consumers[j].Requests
+			}
+			return usage.Consumers[i].Consumer < usage.Consumers[j].Consumer
+		})
+	}
+	return report
+}
+
+// middleware announces the deprecations matching each request's route and method in its response
+// headers and counts the request towards them, logging each consumer's first use. It must be
+// registered on the router after AppTokenMiddleware so the matched route and app are known.
+func (t *deprecationTracker) middleware(next http.Handler) http.Handler {
+	if len(t.rules) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := mux.CurrentRoute(r)
+		if r.Method == http.MethodOptions || current == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, err := current.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var matched []DeprecationRule
+		var consumer string
+		now := time.Now()
+		for i, rule := range t.rules {
+			if rule.Route != route || (rule.Method != "" && rule.Method != r.Method) {
+				continue
+			}
+			matched = append(matched, rule)
+			if consumer == "" {
+				consumer = deprecationConsumer(r)
+			}
+			use := deprecationUse{rule: i, consumer: consumer, userAgent: r.UserAgent()}
+			if t.record(use, now) {
+				log.Printf("[DEPRECATION] %s (%q) called deprecated %s", consumer, use.userAgent, rule.name())
+			}
+		}
+		if len(matched) > 0 {
+			deprecationHeaders(w.Header(), matched)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecationsHandler serves GET /admin/deprecations
+func (s *Server) deprecationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	LogResponse("/admin/deprecations", "Deprecation usage retrieved", nil)
+	json.NewEncoder(w).Encode(s.deprecations.report())
+}
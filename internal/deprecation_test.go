@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeprecationRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     string
+		wantRules int
+	}{
+		{name: "Unset"},
+		{name: "Route and field", rules: `[
+			{"route": "/feed", "method": "get", "deprecatedAt": "2026-01-01T00:00:00Z", "sunset": "2026-07-01T00:00:00Z", "link": "https://docs.example/feed"},
+			{"route": "/animation/{id}", "field": "code", "deprecatedAt": "2026-01-01T00:00:00Z"}
+		]`, wantRules: 2},
+		{name: "Not JSON", rules: "/feed"},
+		{name: "Missing route", rules: `[{"deprecatedAt": "2026-01-01T00:00:00Z"}]`},
+		{name: "Missing date", rules: `[{"route": "/feed"}]`},
+		{name: "Sunset before deprecation", rules: `[{"route": "/feed", "deprecatedAt": "2026-01-01T00:00:00Z", "sunset": "2025-01-01T00:00:00Z"}]`},
+		{name: "Sunset on a field", rules: `[{"route": "/feed", "field": "code", "deprecatedAt": "2026-01-01T00:00:00Z", "sunset": "2027-01-01T00:00:00Z"}]`},
+		{name: "Relative link", rules: `[{"route": "/feed", "deprecatedAt": "2026-01-01T00:00:00Z", "link": "/docs"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEPRECATIONS", tt.rules)
+			if got := DeprecationRules(); len(got) != tt.wantRules {
+				t.Errorf("DeprecationRules() = %+v, want %d rules", got, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestDeprecationMiddleware(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("DEPRECATIONS", `[
+		{"route": "/feed", "method": "GET", "deprecatedAt": "2026-01-01T00:00:00Z", "sunset": "2026-07-01T00:00:00Z", "link": "https://docs.example/feed"},
+		{"route": "/feed", "field": "code", "deprecatedAt": "2025-06-01T00:00:00Z"}
+	]`)
+
+	router := NewServer(NewMemoryStore()).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+
+	for _, token := range []string{"", admin.Token, admin.Token} {
+		req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("User-Agent", "legacy-client/1.0")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("feed status = %d", rec.Code)
+		}
+		headers := map[string]string{
+			"Deprecation":          "@1748736000",
+			"Sunset":               "Wed, 01 Jul 2026 00:00:00 GMT",
+			"Link":                 `<https://docs.example/feed>; rel="deprecation"`,
+			DeprecatedFieldsHeader: "code",
+		}
+		for name, want := range headers {
+			if got := rec.Header().Get(name); got != want {
+				t.Errorf("%s = %q, want %q", name, got, want)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Header().Get("Deprecation") != "" {
+		t.Errorf("Deprecation = %q on a route that is not deprecated", rec.Header().Get("Deprecation"))
+	}
+
+	var report DeprecationReport
+	if code := doJSON(t, router, http.MethodGet, "/admin/deprecations", admin.Token, nil, &report); code != http.StatusOK {
+		t.Fatalf("deprecations status = %d", code)
+	}
+	if len(report.Deprecations) != 2 {
+		t.Fatalf("deprecations = %+v, want both rules", report.Deprecations)
+	}
+	route := report.Deprecations[0]
+	if route.Requests != 3 || len(route.Consumers) != 2 {
+		t.Fatalf("route usage = %+v, want 3 requests from 2 consumers", route)
+	}
+	if route.Consumers[0].Consumer != "user "+admin.User.ID || route.Consumers[0].Requests != 2 || route.Consumers[1].Consumer != "anonymous" {
+		t.Errorf("consumers = %+v, want the admin ahead of the anonymous caller", route.Consumers)
+	}
+}
@@ -0,0 +1,45 @@
+package internal
+
+import "strings"
+
+// LineDiff returns a line-based diff of two texts. Unchanged lines are prefixed
+// with two spaces, removed lines with "- " and added lines with "+ ".
+func LineDiff(oldText, newText string) string {
+	oldLines := strings.Split(oldText, "\n")
+	newLines := strings.Split(newText, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			diff.WriteString("  " + oldLines[i] + "\n")
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff.WriteString("- " + oldLines[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+ " + newLines[j] + "\n")
+			j++
+		}
+	}
+	return diff.String()
+}
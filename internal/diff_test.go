@@ -0,0 +1,17 @@
+package internal
+
+import "testing"
+
+func TestLineDiff(t *testing.T) {
+	oldText := "function draw() {\n  x = Math.p.floor(y);\n}"
+	newText := "function draw() {\n  x = Math.floor(y);\n}"
+
+	want := "  function draw() {\n-   x = Math.p.floor(y);\n+   x = Math.floor(y);\n  }\n"
+	if got := LineDiff(oldText, newText); got != want {
+		t.Errorf("LineDiff() = %q, want %q", got, want)
+	}
+
+	if got := LineDiff("a\nb", "a\nb\nc"); got != "  a\n  b\n+ c\n" {
+		t.Errorf("LineDiff() = %q, want appended line", got)
+	}
+}
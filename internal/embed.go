@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// embedMaxAge is how long browsers and CDNs may reuse an embed page or script before revalidating
+// it; the ETag follows the code and p5.js build, and takedowns are picked up once it runs out
+const embedMaxAge = 5 * time.Minute
+
+// embedContentSecurityPolicy runs embed pages in a sandbox with an opaque origin, as the widget's
+// frames do, so sketch code cannot reach this API's origin. Any site may frame them.
+const embedContentSecurityPolicy = "sandbox allow-scripts; frame-ancestors *"
+
+// inlineScriptBreakers matches what would end an inline script early or make the parser skip its end
+var inlineScriptBreakers = regexp.MustCompile(`(?i)</script|<!--`)
+
+// embedPage returns a standalone HTML page playing animation with its p5.js build, for sites to
+// put in an iframe
+func embedPage(animation GetAnimationResponse) string {
+	var page strings.Builder
+	page.WriteString("<!doctype html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	page.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	page.WriteString("<title>" + html.EscapeString(animation.Description) + "</title>\n")
+	page.WriteString("<style>html,body{margin:0;overflow:hidden}</style>\n")
+	if animation.P5URL != "" {
+		page.WriteString(`<script src="` + html.EscapeString(animation.P5URL) + `"`)
+		if animation.P5Integrity != "" {
+			page.WriteString(` integrity="` + html.EscapeString(animation.P5Integrity) + `" crossorigin="anonymous"`)
+		}
+		page.WriteString("></script>\n")
+	}
+	page.WriteString("</head>\n<body>\n<script>\n")
+	// Both are only valid inside strings, regular expressions and comments, where "\/" and "\!"
+	// read the same
+	page.WriteString(inlineScriptBreakers.ReplaceAllStringFunc(animation.Code, func(match string) string {
+		return match[:1] + `\` + match[1:]
+	}))
+	page.WriteString("\n</script>\n</body>\n</html>\n")
+	return page.String()
+}
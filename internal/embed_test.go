@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEmbedPage(t *testing.T) {
+	page := embedPage(GetAnimationResponse{
+		Description: `<b>"waves"</b>`,
+		Code:        "var s = '</SCRIPT><script>alert(1)</script>'; // <!-- hidden",
+		P5URL:       "https://cdn.example.com/p5.min.js",
+		P5Integrity: "sha384-abc",
+	})
+
+	for _, want := range []string{
+		"<title>&lt;b&gt;&#34;waves&#34;&lt;/b&gt;</title>",
+		`<script src="https://cdn.example.com/p5.min.js" integrity="sha384-abc" crossorigin="anonymous"></script>`,
+		`var s = '<\/SCRIPT><script>alert(1)<\/script>'; // <\!-- hidden`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %q:\n%s", want, page)
+		}
+	}
+	if strings.Count(page, "</script>") != 2 {
+		t.Errorf("page has %d closing script tags, want the library's and the sketch's", strings.Count(page, "</script>"))
+	}
+}
+
+func TestEmbedHandler(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	author := registerUser(t, router, "author")
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	var saved SaveAnimationResponse
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	// Builds registered after the save are picked up by unpinned animations
+	library := P5Library{Version: "1.9.4", URL: "https://cdn.example.com/p5@1.9.4.min.js", Integrity: "sha384-abc"}
+	if err := store.SaveP5Library(context.Background(), library); err != nil {
+		t.Fatalf("SaveP5Library: %v", err)
+	}
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/animation/"+saved.ID+"/embed", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("embed = %d %q, want an HTML page", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, sketch.Code) || !strings.Contains(body, library.URL) {
+		t.Errorf("page does not play the sketch with the default build:\n%s", body)
+	}
+	if rec.Header().Get("Content-Security-Policy") != embedContentSecurityPolicy || rec.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+	if revalidated := get(rec.Header().Get("ETag")); revalidated.Code != http.StatusNotModified {
+		t.Errorf("revalidated status = %d, want %d", revalidated.Code, http.StatusNotModified)
+	}
+
+	edit := "function setup() {}\nfunction draw() { background(0); }"
+	doJSON(t, router, http.MethodPatch, "/animation/"+saved.ID, author, UpdateAnimationRequest{Code: &edit}, nil)
+	if edited := get(rec.Header().Get("ETag")); edited.Code != http.StatusOK || !strings.Contains(edited.Body.String(), edit) {
+		t.Errorf("edited embed = %d, want the new code", edited.Code)
+	}
+
+	missing := httptest.NewRecorder()
+	router.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/animation/missing/embed", nil))
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("missing animation status = %d, want %d", missing.Code, http.StatusNotFound)
+	}
+}
+
+func TestAnimationScriptHandler(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	author := registerUser(t, router, "author")
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	var saved SaveAnimationResponse
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/animation/"+saved.ID+".js", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != sketch.Code {
+		t.Fatalf("script = %d %q, want the stored code", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "application/javascript; charset=utf-8" || rec.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/animation/"+saved.ID+".js", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	revalidated := httptest.NewRecorder()
+	router.ServeHTTP(revalidated, req)
+	if revalidated.Code != http.StatusNotModified {
+		t.Errorf("revalidated status = %d, want %d", revalidated.Code, http.StatusNotModified)
+	}
+
+	missing := httptest.NewRecorder()
+	router.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/animation/missing.js", nil))
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("missing animation status = %d, want %d", missing.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for description embeddings
+const (
+	defaultEmbeddingModel           = "text-embedding-3-small"
+	defaultSemanticMinSimilarityPct = 30
+	embeddingTimeout                = 10 * time.Second
+	// embeddingBatchSize is how many descriptions BackfillEmbeddings embeds per request
+	embeddingBatchSize = 64
+)
+
+// Embedder turns texts into embedding vectors whose cosine similarity reflects how close their
+// meanings are
+type Embedder interface {
+	// Model names the model vectors come from; vectors from different models are not comparable
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// httpEmbedder calls an OpenAI-compatible embeddings endpoint
+type httpEmbedder struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+func (e *httpEmbedder) Model() string {
+	return e.model
+}
+
+// Embed sends texts in one request and returns their vectors in the same order
+func (e *httpEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	ctx, span := StartSpan(ctx, "embeddings.create", SpanKindClient)
+	defer span.End()
+	span.SetAttribute("embedding.model", e.model)
+
+	body, err := json.Marshal(map[string]interface{}{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding response has unexpected index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("embedding response is missing input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+var (
+	embedderOnce sync.Once
+	embedder     Embedder
+)
+
+// GetEmbedder returns the shared embedder configured by EMBEDDING_API_URL, EMBEDDING_API_KEY and
+// EMBEDDING_MODEL, or false when semantic search is disabled
+func GetEmbedder() (Embedder, bool) {
+	embedderOnce.Do(func() {
+		url := os.Getenv("EMBEDDING_API_URL")
+		if url == "" {
+			log.Println("[EMBED] EMBEDDING_API_URL not set, semantic search disabled")
+			return
+		}
+		model := os.Getenv("EMBEDDING_MODEL")
+		if model == "" {
+			model = defaultEmbeddingModel
+		}
+		embedder = &httpEmbedder{url: url, apiKey: os.Getenv("EMBEDDING_API_KEY"), model: model, client: &http.Client{}}
+	})
+	return embedder, embedder != nil
+}
+
+// SemanticMinSimilarity returns the lowest cosine similarity a search result may have, configured
+// in percent by SEMANTIC_SEARCH_MIN_SIMILARITY_PERCENT
+func SemanticMinSimilarity() float64 {
+	return float64(envLimit("SEMANTIC_SEARCH_MIN_SIMILARITY_PERCENT", defaultSemanticMinSimilarityPct)) / 100
+}
+
+// normalizeVector scales v to unit length so cosine similarity is a dot product
+func normalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := math.Sqrt(sum)
+	normalized := make([]float32, len(v))
+	for i, x := range v {
+		normalized[i] = float32(float64(x) / norm)
+	}
+	return normalized
+}
+
+// dotProduct returns the dot product of two vectors, or 0 when their lengths differ
+func dotProduct(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// rankBySimilarity returns the IDs of the embeddings at least minSimilarity to query, most similar first
+func rankBySimilarity(query []float32, embeddings []AnimationEmbedding, minSimilarity float64) []ScoredAnimation {
+	query = normalizeVector(query)
+	ranked := []ScoredAnimation{}
+	for _, embedding := range embeddings {
+		if similarity := dotProduct(query, embedding.Vector); similarity >= minSimilarity {
+			ranked = append(ranked, ScoredAnimation{ID: embedding.AnimationID, Similarity: similarity})
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Similarity > ranked[j].Similarity })
+	return ranked
+}
+
+// embedDescription computes and stores the embedding of an animation's description. Failures are
+// logged; BackfillEmbeddings fills in whatever was missed.
+func embedDescription(ctx context.Context, store AnimationStore, embedder Embedder, id, description string) {
+	if strings.TrimSpace(description) == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, embeddingTimeout)
+	defer cancel()
+
+	vectors, err := embedder.Embed(ctx, []string{description})
+	if err == nil {
+		err = store.SaveAnimationEmbedding(ctx, id, embedder.Model(), normalizeVector(vectors[0]))
+	}
+	if err != nil {
+		log.Printf("[EMBED] Failed to embed description of animation %s: %v", id, err)
+	}
+}
+
+// BackfillEmbeddings embeds every description that has no embedding from the current model, in
+// batches, and returns how many it stored
+func BackfillEmbeddings(ctx context.Context, store AnimationStore, embedder Embedder) (int, error) {
+	stored := 0
+	for {
+		pending, err := store.ListAnimationsWithoutEmbedding(ctx, embedder.Model(), embeddingBatchSize)
+		if err != nil || len(pending) == 0 {
+			return stored, err
+		}
+		texts := make([]string, len(pending))
+		for i, animation := range pending {
+			texts[i] = animation.Description
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return stored, err
+		}
+		for i, animation := range pending {
+			if err := store.SaveAnimationEmbedding(ctx, animation.ID, embedder.Model(), normalizeVector(vectors[i])); err != nil {
+				return stored, err
+			}
+			stored++
+		}
+		log.Printf("[EMBED] Embedded %d descriptions so far", stored)
+	}
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeEmbedder embeds a text as counts of the concepts its words belong to, so synonyms land close
+// together the way a real model's vectors do
+type fakeEmbedder struct {
+	calls int
+	err   error
+}
+
+var fakeConcepts = map[string]int{
+	"calm": 0, "relaxing": 0, "peaceful": 0,
+	"ocean": 1, "sea": 1, "waves": 1,
+	"fire": 2, "flames": 2, "burning": 2,
+	"spinning": 3, "squares": 3, "circles": 3,
+}
+
+func (e *fakeEmbedder) Model() string {
+	return "fake-concepts"
+}
+
+func (e *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, 4)
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			if concept, ok := fakeConcepts[word]; ok {
+				vectors[i][concept]++
+			}
+		}
+	}
+	return vectors, nil
+}
+
+func TestRankBySimilarity(t *testing.T) {
+	embeddings := []AnimationEmbedding{
+		{AnimationID: "near", Vector: normalizeVector([]float32{1, 1, 0})},
+		{AnimationID: "exact", Vector: normalizeVector([]float32{1, 0, 0})},
+		{AnimationID: "unrelated", Vector: normalizeVector([]float32{0, 0, 1})},
+		{AnimationID: "other-model", Vector: []float32{1, 0}},
+	}
+
+	ranked := rankBySimilarity([]float32{3, 0, 0}, embeddings, 0.5)
+	if len(ranked) != 2 || ranked[0].ID != "exact" || ranked[1].ID != "near" {
+		t.Fatalf("ranked = %+v, want exact then near", ranked)
+	}
+	if math.Abs(ranked[0].Similarity-1) > 1e-6 || math.Abs(ranked[1].Similarity-math.Sqrt2/2) > 1e-6 {
+		t.Errorf("similarities = %v, %v, want 1 and %v", ranked[0].Similarity, ranked[1].Similarity, math.Sqrt2/2)
+	}
+	if zero := normalizeVector([]float32{0, 0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("normalizeVector(zero) = %v, want zero", zero)
+	}
+}
+
+func TestSemanticSearch(t *testing.T) {
+	resetFeatures(t)
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	embedder := &fakeEmbedder{}
+	server := NewServer(NewMemoryStore())
+	server.embedder = embedder
+	router := server.Router()
+	token := registerUser(t, router, "maker")
+
+	save := func(description string) string {
+		t.Helper()
+		var saved SaveAnimationResponse
+		req := SaveAnimationRequest{Code: "function draw() { background(0); }", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", token, req, &saved); code != http.StatusOK {
+			t.Fatalf("save status = %d", code)
+		}
+		return saved.ID
+	}
+	sea, shapes := save("calm sea loop"), save("peaceful spinning squares")
+	save("burning fire")
+	if embedder.calls != 3 {
+		t.Errorf("embedder calls = %d, want one per saved description", embedder.calls)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{name: "Matches by meaning", query: "?q=relaxing+ocean+waves", wantStatus: http.StatusOK, wantIDs: []string{sea}},
+		{name: "Most similar first", query: "?q=calm+circles", wantStatus: http.StatusOK, wantIDs: []string{shapes, sea}},
+		{name: "Paged", query: "?q=calm+circles&limit=1&offset=1", wantStatus: http.StatusOK, wantIDs: []string{sea}},
+		{name: "Nothing similar", query: "?q=volcano", wantStatus: http.StatusOK, wantIDs: []string{}},
+		{name: "Missing query", query: "?q=", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page SemanticSearchResponse
+			if code := doJSON(t, router, http.MethodGet, "/search/semantic"+tt.query, "", nil, &page); code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if len(page.Results) != len(tt.wantIDs) {
+				t.Fatalf("results = %+v, want %v", page.Results, tt.wantIDs)
+			}
+			for i, id := range tt.wantIDs {
+				if page.Results[i].ID != id {
+					t.Errorf("result %d = %s, want %s", i, page.Results[i].ID, id)
+				}
+			}
+		})
+	}
+
+	embedder.err = errors.New("provider down")
+	if code := doJSON(t, router, http.MethodGet, "/search/semantic?q=calm", "", nil, nil); code != http.StatusBadGateway {
+		t.Errorf("status when embedding fails = %d, want %d", code, http.StatusBadGateway)
+	}
+	if code := doJSON(t, NewServer(NewMemoryStore()).Router(), http.MethodGet, "/search/semantic?q=calm", "", nil, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("status without an embedder = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestBackfillEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, description := range []string{"calm sea", "burning fire", "spinning squares"} {
+		if _, err := store.SaveAnimation(ctx, "function draw() {}", description, "", ""); err != nil {
+			t.Fatalf("SaveAnimation: %v", err)
+		}
+	}
+
+	embedder := &fakeEmbedder{}
+	stored, err := BackfillEmbeddings(ctx, store, embedder)
+	if err != nil || stored != 3 {
+		t.Fatalf("BackfillEmbeddings() = %d, %v, want 3", stored, err)
+	}
+	if stored, err := BackfillEmbeddings(ctx, store, embedder); err != nil || stored != 0 {
+		t.Errorf("second BackfillEmbeddings() = %d, %v, want 0", stored, err)
+	}
+	embeddings, err := store.ListAnimationEmbeddings(ctx, embedder.Model(), FeedFilter{})
+	if err != nil || len(embeddings) != 3 {
+		t.Errorf("ListAnimationEmbeddings() = %d embeddings, %v, want 3", len(embeddings), err)
+	}
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the animation lookup enumeration guard
+const (
+	defaultNotFoundPerMinute   = 20
+	defaultNotFoundBurst       = 20
+	defaultChallengeDifficulty = 20
+	challengeTTL               = 5 * time.Minute
+)
+
+// ChallengeResponseHeader carries a solved proof-of-work challenge as "<nonce>:<solution>"
+const ChallengeResponseHeader = "X-Challenge-Response"
+
+// ProofOfWorkChallenge asks the client to find a solution whose SHA-256 of "<nonce>:<solution>"
+// starts with Difficulty zero bits before further lookups are allowed
+type ProofOfWorkChallenge struct {
+	Nonce      string `json:"nonce"`
+	Difficulty int    `json:"difficulty"`
+	Header     string `json:"header"`
+}
+
+// enumerationGuard tracks animation lookups that miss, per client IP
+type enumerationGuard struct {
+	misses     *RateLimiter
+	challenge  bool
+	difficulty int
+	secret     []byte
+	now        func() time.Time
+
+	mu         sync.Mutex
+	usedNonces map[string]time.Time
+}
+
+// AnimationEnumerationGuard limits how many unknown animation IDs a client IP can probe.
+// Once the budget set by ANIMATION_NOT_FOUND_PER_MINUTE and ANIMATION_NOT_FOUND_BURST is spent,
+// lookups from that IP get 429 until it refills, or a proof-of-work challenge when
+// ANIMATION_NOT_FOUND_CHALLENGE is enabled.
+func AnimationEnumerationGuard() func(http.Handler) http.Handler {
+	perMinute := envLimit("ANIMATION_NOT_FOUND_PER_MINUTE", defaultNotFoundPerMinute)
+	if perMinute == 0 {
+		log.Println("[SECURITY] Animation enumeration guard disabled")
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	guard := &enumerationGuard{
+		misses:     NewRateLimiter(float64(perMinute)/60, envLimit("ANIMATION_NOT_FOUND_BURST", defaultNotFoundBurst)),
+		difficulty: envLimit("ANIMATION_CHALLENGE_DIFFICULTY", defaultChallengeDifficulty),
+		now:        time.Now,
+		usedNonces: make(map[string]time.Time),
+	}
+	if enabled, _ := envBool("ANIMATION_NOT_FOUND_CHALLENGE"); enabled {
+		secret, err := JWTSecret()
+		if err != nil {
+			log.Printf("[SECURITY] Animation lookup challenge disabled: %v", err)
+		} else {
+			guard.challenge = true
+			guard.secret = secret
+		}
+	}
+
+	return guard.middleware
+}
+
+func (g *enumerationGuard) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+
+		// A solved challenge restores the full budget for the IP
+		if g.challenge {
+			if response := r.Header.Get(ChallengeResponseHeader); response != "" && g.verify(ip, response) {
+				g.misses.Reset(ip)
+			}
+		}
+
+		if allowed, wait := g.misses.Peek(ip); !allowed {
+			g.reject(w, r, ip, wait)
+			return
+		}
+
+		wrw := newResponseWriter(w)
+		next.ServeHTTP(wrw, r)
+
+		if wrw.statusCode == http.StatusNotFound {
+			g.misses.Allow(ip)
+			if allowed, _ := g.misses.Peek(ip); !allowed {
+				log.Printf("[SECURITY] Possible animation ID enumeration from %s, blocking further lookups", ip)
+			}
+		}
+	})
+}
+
+// reject answers a blocked lookup with 429 and, when enabled, a fresh challenge
+func (g *enumerationGuard) reject(w http.ResponseWriter, r *http.Request, ip string, wait time.Duration) {
+	LogResponse(r.URL.Path, "Too many unknown animation lookups from "+ip, nil)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	if !g.challenge {
+		EncodeError(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	response := struct {
+		Error     string               `json:"error"`
+		Code      ErrorCode            `json:"code"`
+		Status    int                  `json:"status"`
+		Challenge ProofOfWorkChallenge `json:"challenge"`
+	}{
+		Error:  "Too many requests",
+		Code:   ErrCodeRateLimited,
+		Status: http.StatusTooManyRequests,
+		Challenge: ProofOfWorkChallenge{
+			Nonce:      g.newNonce(ip),
+			Difficulty: g.difficulty,
+			Header:     ChallengeResponseHeader,
+		},
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// newNonce issues a challenge nonce bound to the IP as "<expiry>.<random>.<mac>"
+func (g *enumerationGuard) newNonce(ip string) string {
+	random, err := generateRandomID()
+	if err != nil {
+		random = strconv.FormatInt(g.now().UnixNano(), 36)
+	}
+	payload := strconv.FormatInt(g.now().Add(challengeTTL).Unix(), 10) + "." + random
+	return payload + "." + g.sign(ip, payload)
+}
+
+// verify checks a "<nonce>:<solution>" response for the IP, accepting each nonce only once
+func (g *enumerationGuard) verify(ip, response string) bool {
+	separator := strings.LastIndex(response, ":")
+	if separator < 0 {
+		return false
+	}
+	nonce, solution := response[:separator], response[separator+1:]
+
+	parts := strings.Split(nonce, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(g.sign(ip, payload))) {
+		return false
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || g.now().Unix() > expiry {
+		return false
+	}
+
+	if leadingZeroBits(sha256.Sum256([]byte(nonce+":"+solution))) < g.difficulty {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for used, expiresAt := range g.usedNonces {
+		if g.now().After(expiresAt) {
+			delete(g.usedNonces, used)
+		}
+	}
+	if _, used := g.usedNonces[nonce]; used {
+		return false
+	}
+	g.usedNonces[nonce] = time.Unix(expiry, 0)
+	return true
+}
+
+func (g *enumerationGuard) sign(ip, payload string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(ip + "|" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// leadingZeroBits counts the zero bits at the start of a hash
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
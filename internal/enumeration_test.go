@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestEnumerationGuard() *enumerationGuard {
+	return &enumerationGuard{
+		misses:     NewRateLimiter(1.0/60, 2),
+		challenge:  true,
+		difficulty: 4,
+		secret:     []byte("test-secret"),
+		now:        time.Now,
+		usedNonces: make(map[string]time.Time),
+	}
+}
+
+// solveChallenge brute-forces a solution for the test difficulty
+func solveChallenge(t *testing.T, nonce string, difficulty int) string {
+	for i := 0; i < 1<<20; i++ {
+		solution := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(nonce+":"+solution))) >= difficulty {
+			return solution
+		}
+	}
+	t.Fatal("no solution found")
+	return ""
+}
+
+func TestEnumerationGuardBlocksRepeatedMisses(t *testing.T) {
+	guard := newTestEnumerationGuard()
+	guard.challenge = false
+	handler := guard.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		EncodeError(w, "Animation not found", http.StatusNotFound)
+	}))
+
+	statuses := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/animation/missing", nil))
+		statuses = append(statuses, recorder.Code)
+	}
+
+	want := []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", statuses, want)
+		}
+	}
+}
+
+func TestEnumerationGuardChallenge(t *testing.T) {
+	guard := newTestEnumerationGuard()
+	ip := "192.0.2.1"
+
+	nonce := guard.newNonce(ip)
+	solution := solveChallenge(t, nonce, guard.difficulty)
+
+	if guard.verify("192.0.2.2", nonce+":"+solution) {
+		t.Error("challenge should be bound to the issuing IP")
+	}
+	if !guard.verify(ip, nonce+":"+solution) {
+		t.Fatal("valid solution should be accepted")
+	}
+	if guard.verify(ip, nonce+":"+solution) {
+		t.Error("nonce should only be accepted once")
+	}
+
+	guard.now = func() time.Time { return time.Now().Add(2 * challengeTTL) }
+	expired := newTestEnumerationGuard().newNonce(ip)
+	if guard.verify(ip, expired+":"+solveChallenge(t, expired, guard.difficulty)) {
+		t.Error("expired nonce should be rejected")
+	}
+}
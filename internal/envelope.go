@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Envelope encryption: every value is sealed with its own random data key, and the data key is
+// stored alongside it wrapped by a master key from a Keyring. Rotating the master key only
+// re-wraps data keys; the values themselves are never re-encrypted.
+const (
+	dataKeySize = 32
+	// wrappedKeySize is a nonce, the sealed data key and the GCM tag
+	wrappedKeySize = 12 + dataKeySize + 16
+)
+
+// Keyring holds the master keys values are sealed with. New values use the active key; older keys
+// stay listed so values sealed before a rotation can still be opened.
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// ParseKeyring parses a comma-separated list of id:base64 master keys of 32 bytes each. The first
+// key is the active one.
+func ParseKeyring(raw string) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string][]byte)}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("key %q must be written id:base64", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %s must be %d base64-encoded bytes", id, dataKeySize)
+		}
+		if _, dup := ring.keys[id]; dup {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		if ring.active == "" {
+			ring.active = id
+		}
+		ring.keys[id] = key
+	}
+	if ring.active == "" {
+		return nil, errors.New("no keys listed")
+	}
+	return ring, nil
+}
+
+// secretFromEnv reads the variable key, or the file named by key_FILE so secrets can be mounted by a
+// secret manager. The file takes precedence.
+func secretFromEnv(key string) (string, error) {
+	raw := os.Getenv(key)
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s_FILE: %w", key, err)
+		}
+		raw = string(contents)
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+// keyringFromEnv reads a keyring with secretFromEnv. It returns nil when neither variable is set.
+func keyringFromEnv(key string) (*Keyring, error) {
+	raw, err := secretFromEnv(key)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+	ring, err := ParseKeyring(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return ring, nil
+}
+
+// MoodKeyring returns the master keys moods are encrypted with, configured by MOOD_ENCRYPTION_KEYS
+// or MOOD_ENCRYPTION_KEYS_FILE, or nil when moods are stored in plain text
+func MoodKeyring() (*Keyring, error) {
+	return keyringFromEnv("MOOD_ENCRYPTION_KEYS")
+}
+
+// sealMood returns the columns a mood is stored in: the plain text mood when no keys are configured,
+// otherwise the key ID and envelope with no plain text
+func sealMood(mood string) (plain, keyId sql.NullString, encrypted []byte, err error) {
+	ring, err := MoodKeyring()
+	if err != nil {
+		return plain, keyId, nil, err
+	}
+	if ring == nil {
+		return sql.NullString{String: mood, Valid: true}, keyId, nil, nil
+	}
+	id, envelope, err := ring.Seal([]byte(mood))
+	if err != nil {
+		return plain, keyId, nil, fmt.Errorf("failed to encrypt mood: %w", err)
+	}
+	return plain, sql.NullString{String: id, Valid: true}, envelope, nil
+}
+
+// openMood returns the mood stored in a row's columns, decrypting it when it is sealed
+func openMood(ring *Keyring, plain sql.NullString, encrypted []byte, keyId sql.NullString) (string, error) {
+	if !keyId.Valid {
+		return plain.String, nil
+	}
+	if ring == nil {
+		return "", errors.New("moods are encrypted but MOOD_ENCRYPTION_KEYS is not set")
+	}
+	mood, err := ring.Open(keyId.String, encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt mood: %w", err)
+	}
+	return string(mood), nil
+}
+
+// ActiveKeyID returns the ID of the key new values are sealed with
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// Seal encrypts plaintext under a new data key wrapped by the active key. It returns the ID of
+// that key and the envelope: the wrapped data key followed by the sealed value.
+func (k *Keyring) Seal(plaintext []byte) (string, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", nil, err
+	}
+	wrapped, err := gcmSeal(k.keys[k.active], dataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	sealed, err := gcmSeal(dataKey, plaintext)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.active, append(wrapped, sealed...), nil
+}
+
+// Open decrypts an envelope sealed under the key with the given ID
+func (k *Keyring) Open(keyId string, envelope []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(keyId, envelope)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(dataKey, envelope[wrappedKeySize:])
+}
+
+// Rewrap re-wraps an envelope's data key under the active key, leaving the sealed value as it is
+func (k *Keyring) Rewrap(keyId string, envelope []byte) (string, []byte, error) {
+	dataKey, err := k.unwrap(keyId, envelope)
+	if err != nil {
+		return "", nil, err
+	}
+	wrapped, err := gcmSeal(k.keys[k.active], dataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.active, append(wrapped, envelope[wrappedKeySize:]...), nil
+}
+
+func (k *Keyring) unwrap(keyId string, envelope []byte) ([]byte, error) {
+	master, ok := k.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %s is not configured", keyId)
+	}
+	if len(envelope) < wrappedKeySize {
+		return nil, errors.New("envelope is too short")
+	}
+	return gcmOpen(master, envelope[:wrappedKeySize])
+}
+
+// gcmSeal encrypts plaintext with AES-256-GCM under a random nonce, which it prepends
+func gcmSeal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// gcmOpen decrypts what gcmSeal produced
+func gcmOpen(key, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("decryption failed")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKey returns an id:base64 master key entry filled with b
+func testKey(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, dataKeySize))
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        string
+		wantActive string
+		wantErr    bool
+	}{
+		{name: "One key", raw: testKey("k1", 1), wantActive: "k1"},
+		{name: "First key is active", raw: testKey("k2", 2) + ", " + testKey("k1", 1), wantActive: "k2"},
+		{name: "Empty", raw: " , ", wantErr: true},
+		{name: "Missing ID", raw: base64.StdEncoding.EncodeToString(make([]byte, dataKeySize)), wantErr: true},
+		{name: "Short key", raw: "k1:" + base64.StdEncoding.EncodeToString(make([]byte, 16)), wantErr: true},
+		{name: "Duplicate ID", raw: testKey("k1", 1) + "," + testKey("k1", 2), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring, err := ParseKeyring(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ring.ActiveKeyID() != tt.wantActive {
+				t.Errorf("ActiveKeyID() = %q, want %q", ring.ActiveKeyID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := ParseKeyring(testKey("k1", 1))
+	if err != nil {
+		t.Fatalf("ParseKeyring: %v", err)
+	}
+	keyId, envelope, err := old.Seal([]byte("much better"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if bytes.Contains(envelope, []byte("much better")) {
+		t.Fatal("envelope contains the plain text")
+	}
+
+	// After rotation both keys are listed until every data key is re-wrapped
+	rotated, _ := ParseKeyring(testKey("k2", 2) + "," + testKey("k1", 1))
+	if got, err := rotated.Open(keyId, envelope); err != nil || string(got) != "much better" {
+		t.Fatalf("Open() with rotated keyring = %q, %v", got, err)
+	}
+	newId, rewrapped, err := rotated.Rewrap(keyId, envelope)
+	if err != nil || newId != "k2" {
+		t.Fatalf("Rewrap() = %q, %v", newId, err)
+	}
+	if !bytes.Equal(rewrapped[wrappedKeySize:], envelope[wrappedKeySize:]) {
+		t.Error("Rewrap() changed the sealed value")
+	}
+
+	retired, _ := ParseKeyring(testKey("k2", 2))
+	if got, err := retired.Open(newId, rewrapped); err != nil || string(got) != "much better" {
+		t.Errorf("Open() after retiring the old key = %q, %v", got, err)
+	}
+	if _, err := retired.Open(keyId, envelope); err == nil {
+		t.Error("Open() with a retired key succeeded")
+	}
+
+	tampered := append([]byte{}, rewrapped...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := retired.Open(newId, tampered); err == nil {
+		t.Error("Open() of a tampered envelope succeeded")
+	}
+}
+
+func TestSealMood(t *testing.T) {
+	t.Setenv("MOOD_ENCRYPTION_KEYS", "")
+	plain, keyId, encrypted, err := sealMood("same")
+	if err != nil || plain.String != "same" || keyId.Valid || encrypted != nil {
+		t.Fatalf("sealMood() without keys = %v, %v, %v, %v", plain, keyId, encrypted, err)
+	}
+	if mood, err := openMood(nil, plain, encrypted, keyId); err != nil || mood != "same" {
+		t.Errorf("openMood() of plain text = %q, %v", mood, err)
+	}
+
+	// Keys can be mounted as a file by a secret manager
+	path := filepath.Join(t.TempDir(), "mood-keys")
+	if err := os.WriteFile(path, []byte(testKey("k1", 1)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("MOOD_ENCRYPTION_KEYS_FILE", path)
+	plain, keyId, encrypted, err = sealMood("worse")
+	if err != nil || plain.Valid || keyId.String != "k1" {
+		t.Fatalf("sealMood() with keys = %v, %v, %v", plain, keyId, err)
+	}
+	ring, err := MoodKeyring()
+	if err != nil {
+		t.Fatalf("MoodKeyring: %v", err)
+	}
+	if mood, err := openMood(ring, plain, encrypted, keyId); err != nil || mood != "worse" {
+		t.Errorf("openMood() = %q, %v", mood, err)
+	}
+	if _, err := openMood(nil, plain, encrypted, keyId); err == nil {
+		t.Error("openMood() without keys succeeded for an encrypted mood")
+	}
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"net/http"
+	"slices"
+)
+
+// ErrorCode is a stable, machine-readable name for an error, sent as "code" beside the message in
+// every JSON error body. Messages are for people and may be reworded; codes are not renamed once
+// clients can see them, so apps should branch on the code.
+type ErrorCode string
+
+// Codes for errors any route may return, chosen by HTTP status when no more specific code applies
+const (
+	ErrCodeInvalidRequest     ErrorCode = "INVALID_REQUEST"
+	ErrCodeValidationFailed   ErrorCode = "VALIDATION_FAILED"
+	ErrCodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	ErrCodeForbidden          ErrorCode = "FORBIDDEN"
+	ErrCodeNotFound           ErrorCode = "NOT_FOUND"
+	ErrCodeConflict           ErrorCode = "CONFLICT"
+	ErrCodeGone               ErrorCode = "GONE"
+	ErrCodeTooLarge           ErrorCode = "REQUEST_TOO_LARGE"
+	ErrCodeUnprocessable      ErrorCode = "UNPROCESSABLE"
+	ErrCodeRateLimited        ErrorCode = "RATE_LIMITED"
+	ErrCodeUnavailableLegally ErrorCode = "UNAVAILABLE_FOR_LEGAL_REASONS"
+	ErrCodeInternal           ErrorCode = "INTERNAL_ERROR"
+	ErrCodeUpstreamFailed     ErrorCode = "UPSTREAM_FAILED"
+	ErrCodeUnavailable        ErrorCode = "SERVICE_UNAVAILABLE"
+	ErrCodeTimeout            ErrorCode = "TIMEOUT"
+)
+
+// Codes for errors clients are expected to handle on their own, given by the handler that answers
+// with one through EncodeErrorCode
+const (
+	ErrCodeAnimationNotFound      ErrorCode = "ANIMATION_NOT_FOUND"
+	ErrCodeAnimationRemoved       ErrorCode = "ANIMATION_REMOVED"
+	ErrCodeAnimationNotRenderable ErrorCode = "ANIMATION_NOT_RENDERABLE"
+	ErrCodeNotOwner               ErrorCode = "NOT_OWNER"
+	ErrCodeUserNotFound           ErrorCode = "USER_NOT_FOUND"
+	ErrCodeUserExists             ErrorCode = "USER_EXISTS"
+	ErrCodeEmailInUse             ErrorCode = "EMAIL_IN_USE"
+	ErrCodeInvalidCredentials     ErrorCode = "INVALID_CREDENTIALS"
+	ErrCodeInvalidToken           ErrorCode = "INVALID_TOKEN"
+	ErrCodeInvalidMood            ErrorCode = "INVALID_MOOD"
+	ErrCodeQuotaExceeded          ErrorCode = "QUOTA_EXCEEDED"
+	ErrCodeCreditsExhausted       ErrorCode = "CREDITS_EXHAUSTED"
+	ErrCodeMemberLimitReached     ErrorCode = "MEMBER_LIMIT_REACHED"
+	ErrCodeGenerationBusy         ErrorCode = "GENERATION_BUSY"
+	ErrCodeGenerationTimeout      ErrorCode = "GENERATION_TIMEOUT"
+	ErrCodePlaybackSessionMissing ErrorCode = "PLAYBACK_SESSION_REQUIRED"
+	ErrCodePlaybackSessionInvalid ErrorCode = "PLAYBACK_SESSION_INVALID"
+	ErrCodePlaybackSessionExpired ErrorCode = "PLAYBACK_SESSION_EXPIRED"
+	ErrCodeDegraded               ErrorCode = "DEGRADED"
+	ErrCodeIdempotencyKeyInUse    ErrorCode = "IDEMPOTENCY_KEY_IN_USE"
+	ErrCodeIdempotencyKeyReused   ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	ErrCodeTenantMismatch         ErrorCode = "TENANT_MISMATCH"
+)
+
+// Codes for a request field that broke a validate rule, sent in each of an error's "fields"
+const (
+	ErrCodeFieldRequired ErrorCode = "REQUIRED"
+	ErrCodeFieldType     ErrorCode = "INVALID_TYPE"
+	ErrCodeFieldEmail    ErrorCode = "INVALID_EMAIL"
+	ErrCodeFieldTooShort ErrorCode = "TOO_SHORT"
+	ErrCodeFieldTooLong  ErrorCode = "TOO_LONG"
+	ErrCodeFieldTooSmall ErrorCode = "TOO_SMALL"
+	ErrCodeFieldTooLarge ErrorCode = "TOO_LARGE"
+	ErrCodeFieldChoice   ErrorCode = "INVALID_CHOICE"
+	ErrCodeFieldFormat   ErrorCode = "INVALID_FORMAT"
+)
+
+// fieldErrorCodes are the codes of the validate rules, which only say what is wrong with a field
+var fieldErrorCodes = []ErrorCode{
+	ErrCodeFieldRequired, ErrCodeFieldType, ErrCodeFieldEmail, ErrCodeFieldTooShort, ErrCodeFieldTooLong,
+	ErrCodeFieldTooSmall, ErrCodeFieldTooLarge, ErrCodeFieldChoice, ErrCodeFieldFormat,
+}
+
+// statusErrorCodes gives the code of errors by their HTTP status
+var statusErrorCodes = map[int]ErrorCode{
+	http.StatusBadRequest:                 ErrCodeInvalidRequest,
+	http.StatusUnauthorized:               ErrCodeUnauthorized,
+	http.StatusForbidden:                  ErrCodeForbidden,
+	http.StatusNotFound:                   ErrCodeNotFound,
+	http.StatusConflict:                   ErrCodeConflict,
+	http.StatusGone:                       ErrCodeGone,
+	http.StatusRequestEntityTooLarge:      ErrCodeTooLarge,
+	http.StatusUnprocessableEntity:        ErrCodeUnprocessable,
+	http.StatusTooManyRequests:            ErrCodeRateLimited,
+	http.StatusUnavailableForLegalReasons: ErrCodeUnavailableLegally,
+	http.StatusInternalServerError:        ErrCodeInternal,
+	http.StatusBadGateway:                 ErrCodeUpstreamFailed,
+	http.StatusServiceUnavailable:         ErrCodeUnavailable,
+	http.StatusGatewayTimeout:             ErrCodeTimeout,
+}
+
+// StatusErrorCode returns the code of an error answered with statusCode and no code of its own
+func StatusErrorCode(statusCode int) ErrorCode {
+	if code, ok := statusErrorCodes[statusCode]; ok {
+		return code
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return ErrCodeInternal
+	}
+	return ErrCodeInvalidRequest
+}
+
+// isClientErrorCode reports whether code is one clients handle on their own, rather than one given
+// by a validate rule or a status
+func isClientErrorCode(code ErrorCode) bool {
+	if slices.Contains(fieldErrorCodes, code) {
+		return false
+	}
+	for _, statusCode := range statusErrorCodes {
+		if code == statusCode {
+			return false
+		}
+	}
+	return true
+}
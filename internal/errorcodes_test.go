@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStatusErrorCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   ErrorCode
+	}{
+		{status: http.StatusNotFound, want: ErrCodeNotFound},
+		{status: http.StatusInternalServerError, want: ErrCodeInternal},
+		{status: http.StatusTeapot, want: ErrCodeInvalidRequest},
+		{status: http.StatusNotImplemented, want: ErrCodeInternal},
+	}
+	for _, tt := range tests {
+		if got := StatusErrorCode(tt.status); got != tt.want {
+			t.Errorf("StatusErrorCode(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+// Codes of their own are only sent where a handler names them, so one named nowhere is never sent
+func TestErrorCodesAreSent(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var source strings.Builder
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || file == "errorcodes.go" {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source.Write(content)
+	}
+	errorCodes, err := os.ReadFile("errorcodes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, clientCodes, _ := strings.Cut(string(errorCodes), "// Codes for errors clients are expected to handle on their own")
+	clientCodes, _, _ = strings.Cut(clientCodes, ")")
+	for _, name := range regexp.MustCompile(`ErrCode\w+`).FindAllString(clientCodes, -1) {
+		if !strings.Contains(source.String(), name) {
+			t.Errorf("no error is sent with the code %s", name)
+		}
+	}
+}
+
+func TestErrorCodeInResponse(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	user := registerAccount(t, router, "viewer")
+
+	errorBody := func(method, path, token string, req any) (int, ErrorCode, []FieldError) {
+		t.Helper()
+		payload, _ := json.Marshal(req)
+		r := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		var body struct {
+			Code   ErrorCode    `json:"code"`
+			Fields []FieldError `json:"fields"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode %s %s error: %v", method, path, err)
+		}
+		return rec.Code, body.Code, body.Fields
+	}
+
+	if status, code, _ := errorBody(http.MethodGet, "/animation/missing", user.Token, nil); status != http.StatusNotFound || code != ErrCodeAnimationNotFound {
+		t.Errorf("missing animation = %d %s, want %d %s", status, code, http.StatusNotFound, ErrCodeAnimationNotFound)
+	}
+	if status, code, _ := errorBody(http.MethodPost, "/login", "", LoginRequest{Email: user.User.Email, Password: "wrong"}); status != http.StatusUnauthorized || code != ErrCodeInvalidCredentials {
+		t.Errorf("wrong password = %d %s, want %d %s", status, code, http.StatusUnauthorized, ErrCodeInvalidCredentials)
+	}
+	status, code, fields := errorBody(http.MethodPost, "/save-mood", user.Token, SaveMoodRequest{AnimationID: "abc", Mood: "ecstatic"})
+	if status != http.StatusBadRequest || code != ErrCodeInvalidMood || len(fields) != 1 || fields[0].Code != ErrCodeInvalidMood {
+		t.Errorf("unknown mood = %d %s %+v, want %s on the mood field", status, code, fields, ErrCodeInvalidMood)
+	}
+	// Beside other faults, the mood is one field of a failed validation
+	status, code, fields = errorBody(http.MethodPost, "/save-mood", user.Token, SaveMoodRequest{Mood: "ecstatic"})
+	if status != http.StatusBadRequest || code != ErrCodeValidationFailed || len(fields) != 2 || fields[1].Code != ErrCodeInvalidMood {
+		t.Errorf("unknown mood without an animation = %d %s %+v, want %s with the mood field %s", status, code, fields, ErrCodeValidationFailed, ErrCodeInvalidMood)
+	}
+	t.Setenv("ADMIN_USER_IDS", user.User.ID)
+	rule := MoodRuleRequest{Name: "low", Mood: "ecstatic", Repeats: 1, Actions: []MoodRuleAction{{Type: MoodActionCrisisResources}}}
+	if status, code, _ := errorBody(http.MethodPost, "/admin/mood-rules", user.Token, rule); status != http.StatusBadRequest || code != ErrCodeInvalidMood {
+		t.Errorf("mood rule with an unknown mood = %d %s, want %d %s", status, code, http.StatusBadRequest, ErrCodeInvalidMood)
+	}
+}
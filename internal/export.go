@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Export formats
+const (
+	ExportFormatGIF = "gif"
+	ExportFormatMP4 = "mp4"
+)
+
+// Defaults and limits for exports
+const (
+	defaultExportFrames = 60
+	maxExportFrames     = 180
+	defaultExportFPS    = 20
+	maxExportFPS        = 30
+	// sketchFrameRate is the frame rate p5.js draws at unless a sketch sets its own; exports
+	// capture every sketchFrameRate/fps-th frame so they play at the sketch's speed
+	sketchFrameRate     = 60
+	exportRenderTimeout = time.Minute
+	// defaultExportRetention is how long an export can be downloaded
+	defaultExportRetention = 24 * time.Hour
+	exportPruneEvery       = time.Hour
+)
+
+// exportContentTypes maps each export format to the Content-Type it is downloaded with
+var exportContentTypes = map[string]string{
+	ExportFormatGIF: "image/gif",
+	ExportFormatMP4: "video/mp4",
+}
+
+// errExportFormatUnavailable is returned for MP4 exports when no encoder is configured
+var errExportFormatUnavailable = errors.New("export format not configured")
+
+// ExportRetention returns how long exports can be downloaded, from EXPORT_RETENTION_HOURS
+func ExportRetention() time.Duration {
+	return envHours("EXPORT_RETENTION_HOURS", defaultExportRetention)
+}
+
+// exportURL returns the address an export is downloaded from
+func exportURL(id string) string {
+	return PublicURL("/exports/" + id)
+}
+
+// exportFrameNumbers returns the sketch frames captured for an export of frames frames at fps
+func exportFrameNumbers(frames, fps int) []int {
+	step := sketchFrameRate / fps
+	if step < 1 {
+		step = 1
+	}
+	numbers := make([]int, frames)
+	for i := range numbers {
+		numbers[i] = (i + 1) * step
+	}
+	return numbers
+}
+
+// RenderExportFrames renders code headlessly and captures the PNG frames of an export
+func RenderExportFrames(ctx context.Context, renderer SketchRenderer, code string, frames, fps int) ([][]byte, error) {
+	numbers := exportFrameNumbers(frames, fps)
+	result, err := renderer.Render(ctx, RenderRequest{
+		Code:          code,
+		Seed:          determinismSeed,
+		Frames:        numbers[len(numbers)-1],
+		TimeoutMs:     int(exportRenderTimeout / time.Millisecond),
+		CaptureFrames: numbers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%w: %s", errSketchCrashed, result.Error)
+	}
+	return capturedPNGs(result, frames)
+}
+
+// encodeGIF encodes PNG frames as a looping GIF, dithered to the Plan 9 palette
+func encodeGIF(frames [][]byte, fps int) ([]byte, error) {
+	// GIF delays are in hundredths of a second
+	delay := 100 / fps
+	animation := &gif.GIF{}
+	for _, frame := range frames {
+		img, err := png.Decode(bytes.NewReader(frame))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode frame: %w", err)
+		}
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, delay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return nil, fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeMP4 encodes PNG frames as an H.264 MP4 with the ffmpeg binary at FFMPEG_PATH
+func encodeMP4(ctx context.Context, frames [][]byte, fps int) ([]byte, error) {
+	ffmpeg := os.Getenv("FFMPEG_PATH")
+	if ffmpeg == "" {
+		return nil, errExportFormatUnavailable
+	}
+
+	dir, err := os.MkdirTemp("", "animate-export-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	for i, frame := range frames {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("frame%04d.png", i)), frame, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write frame: %w", err)
+		}
+	}
+
+	output := filepath.Join(dir, "export.mp4")
+	cmd := exec.CommandContext(ctx, ffmpeg,
+		"-loglevel", "error",
+		"-framerate", strconv.Itoa(fps),
+		"-i", filepath.Join(dir, "frame%04d.png"),
+		"-c:v", "libx264",
+		// H.264 players expect 4:2:0 chroma, which needs even dimensions
+		"-pix_fmt", "yuv420p",
+		"-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2",
+		"-movflags", "+faststart",
+		output,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return os.ReadFile(output)
+}
+
+// exportAnimation renders code into a file of the requested format
+func exportAnimation(ctx context.Context, renderer SketchRenderer, code string, req ExportRequest) ([]byte, error) {
+	if req.Format == ExportFormatMP4 && os.Getenv("FFMPEG_PATH") == "" {
+		return nil, errExportFormatUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, exportRenderTimeout)
+	defer cancel()
+	frames, err := RenderExportFrames(ctx, renderer, code, req.Frames, req.FPS)
+	if err != nil {
+		return nil, err
+	}
+	if req.Format == ExportFormatMP4 {
+		return encodeMP4(ctx, frames, req.FPS)
+	}
+	return encodeGIF(frames, req.FPS)
+}
+
+// RunExportPruner deletes expired exports in every region every exportPruneEvery, until ctx is done
+func RunExportPruner(ctx context.Context, store Store) {
+	ticker := time.NewTicker(exportPruneEvery)
+	defer ticker.Stop()
+	for {
+		deleted, err := deleteInEveryDataRegion(ctx, func(ctx context.Context) (int, error) {
+			return store.DeleteExpiredAnimationExports(ctx, time.Now())
+		})
+		if err != nil {
+			log.Printf("[EXPORT] Failed to delete expired exports: %v", err)
+		} else if deleted > 0 {
+			log.Printf("[EXPORT] Deleted %d expired exports", deleted)
+		}
+		recordWorkerPass("exports", exportPruneEvery, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validateExportRequest checks an export request and fills in the default frame count and rate
+func validateExportRequest(req ExportRequest) (ExportRequest, error) {
+	if _, ok := exportContentTypes[req.Format]; !ok {
+		return req, fmt.Errorf("format must be %q or %q", ExportFormatGIF, ExportFormatMP4)
+	}
+	if req.Frames == 0 {
+		req.Frames = defaultExportFrames
+	}
+	if req.Frames < 1 || req.Frames > maxExportFrames {
+		return req, fmt.Errorf("frames must be between 1 and %d", maxExportFrames)
+	}
+	if req.FPS == 0 {
+		req.FPS = defaultExportFPS
+	}
+	if req.FPS < 1 || req.FPS > maxExportFPS {
+		return req, fmt.Errorf("fps must be between 1 and %d", maxExportFPS)
+	}
+	return req, nil
+}
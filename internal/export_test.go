@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportFrameNumbers(t *testing.T) {
+	tests := []struct {
+		frames, fps int
+		want        []int
+	}{
+		{frames: 3, fps: 20, want: []int{3, 6, 9}},
+		{frames: 4, fps: 30, want: []int{2, 4, 6, 8}},
+		{frames: 2, fps: 7, want: []int{8, 16}},
+	}
+	for _, tt := range tests {
+		if got := exportFrameNumbers(tt.frames, tt.fps); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("exportFrameNumbers(%d, %d) = %v, want %v", tt.frames, tt.fps, got, tt.want)
+		}
+	}
+}
+
+func TestExportAnimationGIF(t *testing.T) {
+	capture := func(c color.Color) string {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		for x := 0; x < 4; x++ {
+			for y := 0; y < 3; y++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+		return base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	renderer := &fakeRenderer{results: []RenderResult{{Captures: []string{capture(color.White), capture(color.Black)}}}}
+
+	data, err := exportAnimation(context.Background(), renderer, "function draw() {}", ExportRequest{Format: ExportFormatGIF, Frames: 2, FPS: 20})
+	if err != nil {
+		t.Fatalf("exportAnimation() error = %v", err)
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("export is not a GIF: %v", err)
+	}
+	if len(decoded.Image) != 2 || !reflect.DeepEqual(decoded.Delay, []int{5, 5}) || decoded.Config.Width != 4 {
+		t.Errorf("GIF has %d frames with delays %v and width %d, want 2 frames of 5 at width 4", len(decoded.Image), decoded.Delay, decoded.Config.Width)
+	}
+
+	if _, err := exportAnimation(context.Background(), renderer, "function draw() {}", ExportRequest{Format: ExportFormatMP4, Frames: 2, FPS: 20}); err != errExportFormatUnavailable {
+		t.Errorf("MP4 export without ffmpeg error = %v, want %v", err, errExportFormatUnavailable)
+	}
+}
+
+func TestExportHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	author := registerUser(t, router, "author")
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	var saved SaveAnimationResponse
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	tests := []struct {
+		name       string
+		req        ExportRequest
+		wantStatus int
+	}{
+		{name: "Unknown format", req: ExportRequest{Format: "webm"}, wantStatus: http.StatusBadRequest},
+		{name: "Too many frames", req: ExportRequest{Format: ExportFormatGIF, Frames: maxExportFrames + 1}, wantStatus: http.StatusBadRequest},
+		{name: "No renderer", req: ExportRequest{Format: ExportFormatGIF}, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodPost, "/animation/"+saved.ID+"/export", author, tt.req, nil); code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", code, tt.wantStatus)
+			}
+		})
+	}
+
+	// An export rendered earlier is reused without a renderer
+	data := []byte("GIF89a")
+	stored := AnimationExport{
+		ID: "export-1", AnimationID: saved.ID, CodeHash: CodeHash(sketch.Code), Format: ExportFormatGIF,
+		Frames: defaultExportFrames, FPS: defaultExportFPS, SizeBytes: len(data),
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := server.store.SaveAnimationExport(context.Background(), stored, data); err != nil {
+		t.Fatalf("SaveAnimationExport: %v", err)
+	}
+	var export AnimationExport
+	if code := doJSON(t, router, http.MethodPost, "/animation/"+saved.ID+"/export", author, ExportRequest{Format: ExportFormatGIF}, &export); code != http.StatusOK {
+		t.Fatalf("reused export status = %d", code)
+	}
+	if export.ID != stored.ID || !strings.HasSuffix(export.URL, "/exports/"+stored.ID) {
+		t.Errorf("export = %+v, want the stored one", export)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/exports/"+stored.ID, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/gif" || !bytes.Equal(rec.Body.Bytes(), data) {
+		t.Fatalf("download = %d %q, want the stored GIF", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if want := `attachment; filename="animation-` + saved.ID + `.gif"`; rec.Header().Get("Content-Disposition") != want {
+		t.Errorf("Content-Disposition = %q, want %q", rec.Header().Get("Content-Disposition"), want)
+	}
+
+	stored.ID, stored.ExpiresAt = "export-2", time.Now().Add(-time.Minute)
+	server.store.SaveAnimationExport(context.Background(), stored, data)
+	expired := httptest.NewRecorder()
+	router.ServeHTTP(expired, httptest.NewRequest(http.MethodGet, "/exports/"+stored.ID, nil))
+	if expired.Code != http.StatusNotFound {
+		t.Errorf("expired download status = %d, want %d", expired.Code, http.StatusNotFound)
+	}
+}
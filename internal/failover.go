@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// defaultDBHealthCheckSecs is how often the health probe checks the primary connection pool
+const defaultDBHealthCheckSecs = 10
+
+// errReadOnlyServer means a host accepted the connection but is a standby
+var errReadOnlyServer = errors.New("server is read-only")
+
+// dbHostPort is one PostgreSQL server listed in DB_HOST
+type dbHostPort struct {
+	Host string
+	Port string
+}
+
+// parseDBHosts splits a comma-separated DB_HOST such as "db-a,db-b:5433" into servers, using
+// defaultPort for hosts without one
+func parseDBHosts(value, defaultPort string) ([]dbHostPort, error) {
+	var hosts []dbHostPort
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port := entry, defaultPort
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("invalid DB_HOST entry %q", entry)
+		}
+		hosts = append(hosts, dbHostPort{Host: host, Port: port})
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("DB_HOST lists no hosts")
+	}
+	return hosts, nil
+}
+
+// formatDBHosts lists servers for logging
+func formatDBHosts(hosts []dbHostPort) string {
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = net.JoinHostPort(h.Host, h.Port)
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseTargetSessionAttrs reads DB_TARGET_SESSION_ATTRS, reporting whether connections must be
+// read-write
+func parseTargetSessionAttrs(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "read-write":
+		return true, nil
+	case "any":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid DB_TARGET_SESSION_ATTRS %q, want read-write or any", value)
+}
+
+// failoverConnector opens connections to the first reachable server in its list, like libpq's
+// multi-host connection strings. With readWrite set, standbys are skipped as with
+// target_session_attrs=read-write, so a promoted standby is found after a failover. The host that
+// last worked is tried first so new connections do not wait on a dead primary.
+type failoverConnector struct {
+	hosts     []dbHostPort
+	dsn       func(dbHostPort) string
+	readWrite bool
+	// connect opens a connection from a DSN; replaced in tests
+	connect func(ctx context.Context, dsn string) (driver.Conn, error)
+
+	mu        sync.Mutex
+	preferred int
+}
+
+func newFailoverConnector(hosts []dbHostPort, dsn func(dbHostPort) string, readWrite bool) *failoverConnector {
+	return &failoverConnector{hosts: hosts, dsn: dsn, readWrite: readWrite, connect: pqConnect}
+}
+
+// pqConnect opens a connection with lib/pq
+func pqConnect(ctx context.Context, dsn string) (driver.Conn, error) {
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Connect implements driver.Connector
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	start := c.preferred
+	c.mu.Unlock()
+
+	var errs []error
+	for i := range c.hosts {
+		index := (start + i) % len(c.hosts)
+		host := c.hosts[index]
+		conn, err := c.connectTo(ctx, host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", net.JoinHostPort(host.Host, host.Port), err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if index != start {
+			log.Printf("[DB] Connected to %s after %d other host(s) failed", net.JoinHostPort(host.Host, host.Port), i)
+		}
+		c.mu.Lock()
+		c.preferred = index
+		c.mu.Unlock()
+		return conn, nil
+	}
+	return nil, fmt.Errorf("no usable database host: %w", errors.Join(errs...))
+}
+
+// connectTo opens a connection to one server, rejecting standbys when read-write is required
+func (c *failoverConnector) connectTo(ctx context.Context, host dbHostPort) (driver.Conn, error) {
+	conn, err := c.connect(ctx, c.dsn(host))
+	if err != nil {
+		return nil, err
+	}
+	if !c.readWrite {
+		return conn, nil
+	}
+	readOnly, err := isReadOnly(ctx, conn)
+	if err == nil && readOnly {
+		err = errReadOnlyServer
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c *failoverConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// isReadOnly reports whether a connection's server only accepts reads, which is the case for
+// standbys and for a primary demoted with default_transaction_read_only
+func isReadOnly(ctx context.Context, conn driver.Conn) (bool, error) {
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return false, errors.New("driver cannot check transaction_read_only")
+	}
+	rows, err := queryer.QueryContext(ctx, "SHOW transaction_read_only", nil)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return false, errors.New("SHOW transaction_read_only returned no rows")
+		}
+		return false, err
+	}
+	var value string
+	switch v := dest[0].(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	}
+	return value == "on", nil
+}
+
+// DBHealthCheckInterval reads DB_HEALTH_CHECK_SECONDS; 0 disables the health probe
+func DBHealthCheckInterval() time.Duration {
+	return time.Duration(envLimit("DB_HEALTH_CHECK_SECONDS", defaultDBHealthCheckSecs)) * time.Second
+}
+
+// RunDBHealthProbe checks the primary connection pool every DBHealthCheckInterval until ctx is
+// done, refreshing it when it can no longer serve writes
+func RunDBHealthProbe(ctx context.Context) {
+	interval := DBHealthCheckInterval()
+	if interval <= 0 || db == nil || db.connector == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkDBHealth(ctx, db)
+		}
+	}
+}
+
+// checkDBHealth refreshes t when its pool fails a probe or is connected to a server in recovery,
+// as the old primary is after a standby has been promoted
+func checkDBHealth(ctx context.Context, t *tracedDB) {
+	probeCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var inRecovery bool
+	err := t.current().QueryRowContext(probeCtx, "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+	recordDatabaseCheck(err)
+	switch {
+	case err != nil:
+		log.Printf("[DB] Health probe failed: %v", err)
+	case inRecovery:
+		log.Println("[DB] Health probe found the database in recovery")
+	default:
+		return
+	}
+
+	if err := t.refresh(ctx); err != nil {
+		log.Printf("[DB] Failed to refresh the connection pool: %v", err)
+		recordDatabaseCheck(err)
+		return
+	}
+	log.Println("[DB] Refreshed the connection pool")
+}
+
+// refresh opens a new pool through the connector and swaps it in once it reaches a server. The old
+// pool is closed in the background; queries already running on it finish first.
+func (t *tracedDB) refresh(ctx context.Context) error {
+	if t.connector == nil {
+		return errors.New("connection pool cannot be refreshed")
+	}
+	conn := sql.OpenDB(t.connector)
+	DBPoolConfigFromEnv().Apply(conn)
+
+	pingCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	if err := conn.PingContext(pingCtx); err != nil {
+		conn.Close()
+		return err
+	}
+	old := t.pool.Swap(conn)
+	go old.Close()
+	return nil
+}
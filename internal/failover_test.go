@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestParseDBHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []dbHostPort
+		wantErr bool
+	}{
+		{name: "Single host", value: "localhost", want: []dbHostPort{{"localhost", "5432"}}},
+		{name: "Primary and standbys", value: "db-a, db-b:5433,db-c", want: []dbHostPort{{"db-a", "5432"}, {"db-b", "5433"}, {"db-c", "5432"}}},
+		{name: "IPv6", value: "[::1]:6432", want: []dbHostPort{{"::1", "6432"}}},
+		{name: "Missing port", value: "db-a:", wantErr: true},
+		{name: "Empty", value: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDBHosts(tt.value, "5432")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDBHosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDBHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeCluster stands in for PostgreSQL servers keyed by host; down hosts refuse connections
+type fakeCluster struct {
+	mu       sync.Mutex
+	readOnly map[string]bool
+	down     map[string]bool
+	dials    []string
+}
+
+func (c *fakeCluster) connect(ctx context.Context, host string) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dials = append(c.dials, host)
+	if c.down[host] {
+		return nil, errors.New("connection refused")
+	}
+	return &fakePGConn{cluster: c, host: host}, nil
+}
+
+func (c *fakeCluster) connector(hosts []dbHostPort, readWrite bool) *failoverConnector {
+	connector := newFailoverConnector(hosts, func(h dbHostPort) string { return h.Host }, readWrite)
+	connector.connect = c.connect
+	return connector
+}
+
+func (c *fakeCluster) takeDials() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dials := c.dials
+	c.dials = nil
+	return dials
+}
+
+type fakePGConn struct {
+	cluster *fakeCluster
+	host    string
+}
+
+func (c *fakePGConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakePGConn) Close() error              { return nil }
+func (c *fakePGConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakePGConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.cluster.mu.Lock()
+	defer c.cluster.mu.Unlock()
+	if c.cluster.down[c.host] {
+		return nil, driver.ErrBadConn
+	}
+	readOnly := c.cluster.readOnly[c.host]
+	switch query {
+	case "SHOW transaction_read_only":
+		value := "off"
+		if readOnly {
+			value = "on"
+		}
+		return &fakePGRows{value: []byte(value)}, nil
+	case "SELECT pg_is_in_recovery()":
+		return &fakePGRows{value: readOnly}, nil
+	}
+	return nil, errors.New("unexpected query " + query)
+}
+
+type fakePGRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (r *fakePGRows) Columns() []string { return []string{"value"} }
+func (r *fakePGRows) Close() error      { return nil }
+func (r *fakePGRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func TestFailoverConnector(t *testing.T) {
+	hosts := []dbHostPort{{"db-a", "5432"}, {"db-b", "5432"}, {"db-c", "5432"}}
+	tests := []struct {
+		name      string
+		readWrite bool
+		readOnly  map[string]bool
+		down      map[string]bool
+		wantHost  string
+		wantErr   bool
+	}{
+		{name: "Primary first", readWrite: true, wantHost: "db-a"},
+		{name: "Primary down", readWrite: true, down: map[string]bool{"db-a": true}, wantHost: "db-b"},
+		{name: "Skips standbys", readWrite: true, readOnly: map[string]bool{"db-a": true, "db-b": true}, wantHost: "db-c"},
+		{name: "Any server", readOnly: map[string]bool{"db-a": true}, wantHost: "db-a"},
+		{name: "No primary", readWrite: true, readOnly: map[string]bool{"db-a": true, "db-b": true}, down: map[string]bool{"db-c": true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &fakeCluster{readOnly: tt.readOnly, down: tt.down}
+			conn, err := cluster.connector(hosts, tt.readWrite).Connect(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Connect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && conn.(*fakePGConn).host != tt.wantHost {
+				t.Errorf("Connect() host = %s, want %s", conn.(*fakePGConn).host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestFailoverConnectorPrefersLastHost(t *testing.T) {
+	cluster := &fakeCluster{down: map[string]bool{"db-a": true}}
+	connector := cluster.connector([]dbHostPort{{"db-a", "5432"}, {"db-b", "5432"}}, true)
+	for i := 0; i < 2; i++ {
+		if _, err := connector.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+	}
+	if dials := cluster.takeDials(); !reflect.DeepEqual(dials, []string{"db-a", "db-b", "db-b"}) {
+		t.Errorf("dials = %v, want the dead primary tried only once", dials)
+	}
+}
+
+func TestCheckDBHealth(t *testing.T) {
+	cluster := &fakeCluster{readOnly: map[string]bool{"db-b": true}, down: map[string]bool{}}
+	connector := cluster.connector([]dbHostPort{{"db-a", "5432"}, {"db-b", "5432"}}, true)
+	traced := newTracedDB(sql.OpenDB(connector), connector)
+	if err := traced.PingContext(context.Background()); err != nil {
+		t.Fatalf("PingContext() error = %v", err)
+	}
+
+	// A healthy primary keeps its pool
+	old := traced.current()
+	checkDBHealth(context.Background(), traced)
+	if traced.current() != old {
+		t.Error("healthy pool was replaced")
+	}
+
+	// db-b is promoted and db-a comes back as a standby
+	cluster.mu.Lock()
+	cluster.readOnly = map[string]bool{"db-a": true}
+	cluster.mu.Unlock()
+	checkDBHealth(context.Background(), traced)
+	if traced.current() == old {
+		t.Fatal("pool connected to a standby was kept")
+	}
+
+	var inRecovery bool
+	if err := traced.QueryRowContext(context.Background(), "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil || inRecovery {
+		t.Errorf("after refresh in recovery = %v, %v, want the promoted primary", inRecovery, err)
+	}
+}
@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Optional features, which are switched off while a component they depend on is degraded
+const (
+	FeatureThumbnails      = "thumbnails"
+	FeatureAnalytics       = "analytics"
+	FeaturePersonalization = "personalization"
+	FeatureSmokeTests      = "smoke_tests"
+)
+
+// Feature flag modes set in FEATURE_FLAGS. Features are auto unless configured otherwise: on while
+// what they depend on is healthy and off while it is degraded.
+const (
+	FeatureModeAuto = "auto"
+	FeatureModeOn   = "on"
+	FeatureModeOff  = "off"
+)
+
+// errFeatureOff is returned for work an optional feature was asked to do while it is switched off
+var errFeatureOff = errors.New("feature switched off")
+
+// featureEvaluateEvery is how long a decision to switch features on or off stands before the
+// components are checked again, so a flapping signal does not toggle them on every request
+const featureEvaluateEvery = 15 * time.Second
+
+// optionalFeature is work the service can do without, and the status components it is dropped for
+type optionalFeature struct {
+	Name        string
+	Description string
+	DependsOn   []string
+}
+
+var optionalFeatures = []optionalFeature{
+	{
+		Name:        FeatureThumbnails,
+		Description: "Rendering thumbnails and preview frames that are not stored yet",
+		DependsOn:   []string{ComponentDatabase},
+	},
+	{
+		Name:        FeatureAnalytics,
+		Description: "Mood summaries on animations, and the compatibility matrices and embeddings stored after saves",
+		DependsOn:   []string{ComponentDatabase},
+	},
+	{
+		Name:        FeaturePersonalization,
+		Description: "Applying signed-in viewers' stored content preferences to the feed",
+		DependsOn:   []string{ComponentDatabase},
+	},
+	{
+		Name:        FeatureSmokeTests,
+		Description: "Smoke testing generated sketches and sending crashing ones back to Claude for repair",
+		DependsOn:   []string{ComponentGeneration},
+	},
+}
+
+// componentSLOs are the objectives whose burning error budget marks a component degraded. Feed and
+// animation reads are core paths, so their objectives stand for the database they read from.
+var componentSLOs = map[string][]string{
+	ComponentDatabase:   {SLOAvailability, SLOFeedLatency, SLOAnimationLatency},
+	ComponentGeneration: {SLOGenerationSuccess},
+}
+
+// parseFeatureFlags parses the JSON object of feature modes in FEATURE_FLAGS
+func parseFeatureFlags(raw string) (map[string]string, error) {
+	var flags map[string]string
+	if err := json.Unmarshal([]byte(raw), &flags); err != nil {
+		return nil, fmt.Errorf("FEATURE_FLAGS is not a JSON object of feature modes: %v", err)
+	}
+	for name, mode := range flags {
+		if !slices.ContainsFunc(optionalFeatures, func(f optionalFeature) bool { return f.Name == name }) {
+			return nil, fmt.Errorf("FEATURE_FLAGS has unknown feature %q", name)
+		}
+		if mode != FeatureModeAuto && mode != FeatureModeOn && mode != FeatureModeOff {
+			return nil, fmt.Errorf("FEATURE_FLAGS sets %s to %q; use %s, %s or %s", name, mode, FeatureModeAuto, FeatureModeOn, FeatureModeOff)
+		}
+	}
+	return flags, nil
+}
+
+// FeatureFlags returns the mode of each feature configured in FEATURE_FLAGS. Features left out, or
+// all of them when the setting is invalid, are auto.
+func FeatureFlags() map[string]string {
+	raw := os.Getenv("FEATURE_FLAGS")
+	if raw == "" {
+		return nil
+	}
+	flags, err := parseFeatureFlags(raw)
+	if err != nil {
+		log.Printf("[FEATURES] Ignoring FEATURE_FLAGS: %v", err)
+		return nil
+	}
+	return flags
+}
+
+var (
+	databaseCheckMu  sync.Mutex
+	databaseCheckErr error
+)
+
+// recordDatabaseCheck notes the outcome of the latest health probe or status ping of the database
+func recordDatabaseCheck(err error) {
+	databaseCheckMu.Lock()
+	defer databaseCheckMu.Unlock()
+	databaseCheckErr = err
+}
+
+// degradedComponents returns why each degraded component is: its latest check failed, or the error
+// budget of one of its objectives is burning fast enough to alert on
+func degradedComponents(now time.Time) map[string]string {
+	degraded := map[string]string{}
+	databaseCheckMu.Lock()
+	if databaseCheckErr != nil {
+		degraded[ComponentDatabase] = "database check failed"
+	}
+	databaseCheckMu.Unlock()
+	if status := providerStatus(now); status.Status != StatusOperational {
+		degraded[ComponentGeneration] = status.Detail
+	}
+
+	for _, slo := range SLOs() {
+		firing := firingRules(slo, now)
+		if len(firing) == 0 {
+			continue
+		}
+		for component, names := range componentSLOs {
+			if _, ok := degraded[component]; !ok && slices.Contains(names, slo.Name) {
+				worst := 0.0
+				for _, rate := range firing {
+					worst = max(worst, rate)
+				}
+				degraded[component] = fmt.Sprintf("%s error budget burning %.1fx", slo.Name, worst)
+			}
+		}
+	}
+	return degraded
+}
+
+// featureGate decides which optional features are on, re-evaluating at most every
+// featureEvaluateEvery
+type featureGate struct {
+	mu          sync.Mutex
+	evaluatedAt time.Time
+	statuses    []FeatureStatus
+}
+
+// features is the gate every optional feature asks before doing its work
+var features = &featureGate{}
+
+// evaluate returns the status of every feature as of now
+func (g *featureGate) evaluate(now time.Time) []FeatureStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.statuses != nil && now.Sub(g.evaluatedAt) < featureEvaluateEvery {
+		return g.statuses
+	}
+
+	flags := FeatureFlags()
+	degraded := degradedComponents(now)
+	statuses := make([]FeatureStatus, len(optionalFeatures))
+	for i, feature := range optionalFeatures {
+		status := FeatureStatus{Name: feature.Name, Description: feature.Description, Mode: FeatureModeAuto, Enabled: true}
+		if mode, ok := flags[feature.Name]; ok {
+			status.Mode = mode
+		}
+		switch status.Mode {
+		case FeatureModeOff:
+			status.Enabled = false
+			status.Reason = "switched off in FEATURE_FLAGS"
+		case FeatureModeAuto:
+			var reasons []string
+			for _, component := range feature.DependsOn {
+				if reason, ok := degraded[component]; ok {
+					reasons = append(reasons, reason)
+				}
+			}
+			if len(reasons) > 0 {
+				sort.Strings(reasons)
+				status.Enabled = false
+				status.Reason = strings.Join(reasons, "; ")
+			}
+		}
+		statuses[i] = status
+	}
+
+	for i, status := range statuses {
+		if g.statuses == nil || g.statuses[i].Enabled == status.Enabled {
+			continue
+		}
+		if status.Enabled {
+			log.Printf("[FEATURES] Switched %s back on", status.Name)
+		} else {
+			log.Printf("[FEATURES] Switched %s off: %s", status.Name, status.Reason)
+		}
+	}
+	g.statuses = statuses
+	g.evaluatedAt = now
+	return statuses
+}
+
+// FeatureEnabled reports whether the optional feature called name should do its work right now
+func FeatureEnabled(name string) bool {
+	for _, status := range features.evaluate(time.Now()) {
+		if status.Name == name {
+			return status.Enabled
+		}
+	}
+	return true
+}
+
+// encodeFeatureOff answers a request for work an optional feature is switched off for, asking the
+// client to come back once the features are evaluated again
+func encodeFeatureOff(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(featureEvaluateEvery.Seconds())))
+	EncodeErrorCode(w, ErrCodeDegraded, "Temporarily unavailable while the service is degraded", http.StatusServiceUnavailable)
+}
+
+// writeFeatureMetrics reports which optional features are on
+func writeFeatureMetrics(w io.Writer) {
+	enabled := map[string]float64{}
+	for _, status := range features.evaluate(time.Now()) {
+		enabled[status.Name] = 0
+		if status.Enabled {
+			enabled[status.Name] = 1
+		}
+	}
+	writeLabeledMetric(w, "animate_feature_enabled", "gauge", "Whether an optional feature is on (1) or switched off (0).", "feature", enabled)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// resetFeatures gives the test a fresh feature gate, decided only by what the test itself records.
+// Errors earlier tests provoked on purpose would otherwise have switched auto features off.
+func resetFeatures(t *testing.T) {
+	t.Helper()
+	resetSLOTrackers(t)
+	databaseCheckMu.Lock()
+	savedCheck := databaseCheckErr
+	databaseCheckErr = nil
+	databaseCheckMu.Unlock()
+	savedGate, savedCalls := features, providerCalls
+	features, providerCalls = &featureGate{}, &sloTracker{}
+	t.Cleanup(func() {
+		recordDatabaseCheck(savedCheck)
+		features, providerCalls = savedGate, savedCalls
+	})
+}
+
+func TestParseFeatureFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "Modes", raw: `{"thumbnails": "off", "analytics": "on", "personalization": "auto"}`, want: map[string]string{FeatureThumbnails: FeatureModeOff, FeatureAnalytics: FeatureModeOn, FeaturePersonalization: FeatureModeAuto}},
+		{name: "Unknown feature", raw: `{"confetti": "off"}`, wantErr: true},
+		{name: "Unknown mode", raw: `{"thumbnails": "maybe"}`, wantErr: true},
+		{name: "Not an object", raw: `["thumbnails"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFeatureFlags(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFeatureFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for name, mode := range tt.want {
+				if got[name] != mode {
+					t.Errorf("mode of %s = %q, want %q", name, got[name], mode)
+				}
+			}
+		})
+	}
+}
+
+func TestFeatureGate(t *testing.T) {
+	resetFeatures(t)
+	t.Setenv("FEATURE_FLAGS", `{"analytics": "on", "smoke_tests": "off"}`)
+
+	enabled := func(statuses []FeatureStatus) map[string]bool {
+		got := map[string]bool{}
+		for _, status := range statuses {
+			got[status.Name] = status.Enabled
+		}
+		return got
+	}
+
+	gate := &featureGate{}
+	now := time.Now()
+	got := enabled(gate.evaluate(now))
+	want := map[string]bool{FeatureThumbnails: true, FeatureAnalytics: true, FeaturePersonalization: true, FeatureSmokeTests: false}
+	for name, on := range want {
+		if got[name] != on {
+			t.Errorf("healthy: %s enabled = %v, want %v", name, got[name], on)
+		}
+	}
+
+	// A failing database switches off the auto features depending on it, once the decision is due
+	recordDatabaseCheck(errors.New("connection refused"))
+	if got := enabled(gate.evaluate(now.Add(time.Second))); !got[FeatureThumbnails] {
+		t.Error("features were re-evaluated before featureEvaluateEvery passed")
+	}
+	statuses := gate.evaluate(now.Add(featureEvaluateEvery))
+	got = enabled(statuses)
+	want = map[string]bool{FeatureThumbnails: false, FeatureAnalytics: true, FeaturePersonalization: false, FeatureSmokeTests: false}
+	for name, on := range want {
+		if got[name] != on {
+			t.Errorf("database degraded: %s enabled = %v, want %v", name, got[name], on)
+		}
+	}
+	if statuses[0].Reason != "database check failed" {
+		t.Errorf("reason = %q, want the failing check", statuses[0].Reason)
+	}
+
+	recordDatabaseCheck(nil)
+	if got := enabled(gate.evaluate(now.Add(2 * featureEvaluateEvery))); !got[FeatureThumbnails] || !got[FeaturePersonalization] {
+		t.Errorf("recovered: features = %v, want database features back on", got)
+	}
+}
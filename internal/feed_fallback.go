@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultFeedFallbackPoolSize       = 200
+	defaultFeedFallbackRefreshSeconds = 600
+)
+
+// FeedFallbackHeader marks feed responses served from the fallback pool while the database could
+// not answer
+const FeedFallbackHeader = "X-Feed-Fallback"
+
+// feedFallbacks counts feed requests answered from the fallback pool
+var feedFallbacks atomic.Int64
+
+// FeedFallbackPoolSize returns how many animations each fallback pool holds, configured by
+// FEED_FALLBACK_POOL_SIZE; 0 disables the fallback
+func FeedFallbackPoolSize() int {
+	return envLimit("FEED_FALLBACK_POOL_SIZE", defaultFeedFallbackPoolSize)
+}
+
+// FeedFallbackRefresh returns how often the fallback pools are rebuilt, configured by
+// FEED_FALLBACK_REFRESH_SECONDS
+func FeedFallbackRefresh() time.Duration {
+	seconds := envLimit("FEED_FALLBACK_REFRESH_SECONDS", defaultFeedFallbackRefreshSeconds)
+	if seconds == 0 {
+		seconds = defaultFeedFallbackRefreshSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// fallbackEntry is an animation in a fallback pool and how likely it is to be picked
+type fallbackEntry struct {
+	animation GetAnimationResponse
+	weight    float64
+}
+
+// feedFallback keeps recent feed animations in memory, so the feed can still answer while the
+// database cannot. Viewers who asked for reduced motion or no flashing only get the calm pool.
+type feedFallback struct {
+	mu       sync.RWMutex
+	standard []fallbackEntry
+	calm     []fallbackEntry
+}
+
+// fallbackWeight returns how likely an animation is to be picked from a fallback pool. Animations
+// viewers felt better after are favoured, ones they consistently felt much worse after are left
+// out, and ones with too few moods recorded to say are weighted as neutral.
+func fallbackWeight(summary *MoodSummary) float64 {
+	if summary == nil || summary.NetPositivity == nil {
+		return 1
+	}
+	return 1 + *summary.NetPositivity
+}
+
+// buildFeedFallbackPool returns the newest size animations filter lets the feed show, with their
+// mood summaries and weights
+func (s *Server) buildFeedFallbackPool(ctx context.Context, filter FeedFilter, size int) ([]fallbackEntry, error) {
+	animations, _, err := s.store.ListFeedAnimations(ctx, filter, size, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.attachMoodSummaries(ctx, animations)
+	pool := make([]fallbackEntry, 0, len(animations))
+	for _, animation := range animations {
+		pool = append(pool, fallbackEntry{animation: animation, weight: fallbackWeight(animation.Moods)})
+	}
+	return pool, nil
+}
+
+// refreshFeedFallback rebuilds the fallback pools. A pool that fails to build keeps its previous
+// animations, since a stale pool still beats an empty one.
+func (s *Server) refreshFeedFallback(ctx context.Context) error {
+	size := FeedFallbackPoolSize()
+	if size == 0 {
+		s.fallback.mu.Lock()
+		s.fallback.standard, s.fallback.calm = nil, nil
+		s.fallback.mu.Unlock()
+		return nil
+	}
+	standard, err := s.buildFeedFallbackPool(ctx, FeedFilter{MaxMotionScore: ReducedMotionMaxChange()}, size)
+	if err != nil {
+		return err
+	}
+	calm, err := s.buildFeedFallbackPool(ctx, widgetFilter(), size)
+	if err != nil {
+		return err
+	}
+
+	s.fallback.mu.Lock()
+	defer s.fallback.mu.Unlock()
+	s.fallback.standard, s.fallback.calm = standard, calm
+	return nil
+}
+
+// RunFeedFallbackRefresher builds the fallback pools straight away and rebuilds them every
+// FeedFallbackRefresh, until ctx is done
+func (s *Server) RunFeedFallbackRefresher(ctx context.Context) {
+	interval := FeedFallbackRefresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := s.refreshFeedFallback(ctx)
+		if err != nil {
+			log.Printf("[FEED] Failed to refresh the fallback pool: %v", err)
+		}
+		recordWorkerPass("feed fallback", interval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fallbackPool returns the pool that may be shown to a viewer with filter
+func (s *Server) fallbackPool(filter FeedFilter) []fallbackEntry {
+	s.fallback.mu.RLock()
+	defer s.fallback.mu.RUnlock()
+	if filter.ReducedMotion || filter.AvoidFlashing {
+		return s.fallback.calm
+	}
+	return s.fallback.standard
+}
+
+// fallbackAnimation picks a random animation from the pool for filter, weighted by how viewers
+// felt after watching. It returns false when the pool is empty.
+func (s *Server) fallbackAnimation(filter FeedFilter) (GetAnimationResponse, bool) {
+	pool := s.fallbackPool(filter)
+	total := 0.0
+	for _, entry := range pool {
+		total += entry.weight
+	}
+	if total == 0 {
+		// Every animation in the pool left viewers feeling much worse; any of them beats nothing
+		if len(pool) == 0 {
+			return GetAnimationResponse{}, false
+		}
+		return pool[rand.Intn(len(pool))].animation, true
+	}
+	pick := rand.Float64() * total
+	for _, entry := range pool {
+		if pick < entry.weight {
+			return entry.animation, true
+		}
+		pick -= entry.weight
+	}
+	return pool[len(pool)-1].animation, true
+}
+
+// fallbackPage returns a page of the pool for filter, newest first as the feed is, and how many
+// animations the pool holds. It returns false when the pool is empty.
+func (s *Server) fallbackPage(filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, bool) {
+	pool := s.fallbackPool(filter)
+	if len(pool) == 0 {
+		return nil, 0, false
+	}
+	animations := []GetAnimationResponse{}
+	for i := offset; i < len(pool) && i < offset+limit; i++ {
+		animations = append(animations, pool[i].animation)
+	}
+	return animations, len(pool), true
+}
+
+// writeFeedFallbackMetrics reports how often the feed was answered from the fallback pool
+func writeFeedFallbackMetrics(w io.Writer) {
+	writeMetric(w, "animate_feed_fallbacks_total", "counter", "Total feed requests answered from the in-memory fallback pool.", float64(feedFallbacks.Load()))
+}
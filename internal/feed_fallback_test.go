@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// flakyStore is a store whose feed queries fail while down is set
+type flakyStore struct {
+	*MemoryStore
+	down bool
+}
+
+func (f *flakyStore) GetRandomAnimation(ctx context.Context, filter FeedFilter) (GetAnimationResponse, error) {
+	if f.down {
+		return GetAnimationResponse{}, errors.New("database error: connection refused")
+	}
+	return f.MemoryStore.GetRandomAnimation(ctx, filter)
+}
+
+func (f *flakyStore) ListFeedAnimations(ctx context.Context, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error) {
+	if f.down {
+		return nil, 0, errors.New("database error: connection refused")
+	}
+	return f.MemoryStore.ListFeedAnimations(ctx, filter, limit, offset)
+}
+
+func TestFallbackWeight(t *testing.T) {
+	better, worse := 0.5, -1.0
+	tests := []struct {
+		name    string
+		summary *MoodSummary
+		want    float64
+	}{
+		{name: "No summary", want: 1},
+		{name: "Suppressed", summary: &MoodSummary{Suppressed: true}, want: 1},
+		{name: "Felt better", summary: &MoodSummary{Total: 10, NetPositivity: &better}, want: 1.5},
+		{name: "Felt much worse", summary: &MoodSummary{Total: 10, NetPositivity: &worse}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fallbackWeight(tt.summary); got != tt.want {
+				t.Errorf("fallbackWeight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackAnimationIsWeighted(t *testing.T) {
+	s := NewServer(NewMemoryStore())
+	if _, ok := s.fallbackAnimation(FeedFilter{}); ok {
+		t.Fatal("empty pool returned an animation")
+	}
+
+	s.fallback.standard = []fallbackEntry{
+		{animation: GetAnimationResponse{ID: "worse"}, weight: 0},
+		{animation: GetAnimationResponse{ID: "better"}, weight: 2},
+	}
+	for i := 0; i < 50; i++ {
+		if animation, _ := s.fallbackAnimation(FeedFilter{}); animation.ID != "better" {
+			t.Fatalf("picked %q, want only the animation viewers felt better after", animation.ID)
+		}
+	}
+	if _, ok := s.fallbackAnimation(FeedFilter{ReducedMotion: true}); ok {
+		t.Error("reduced motion viewer was served from the standard pool")
+	}
+}
+
+func TestFeedFallsBackToPool(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	server := NewServer(store)
+	router := server.Router()
+	author := registerUser(t, router, "author")
+	for _, description := range []string{"waves", "rain"} {
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, nil); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+	}
+
+	// Before the pool is built there is nothing to fall back to
+	store.down = true
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feed", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("feed with an empty pool = %d, want %d with Retry-After", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	store.down = false
+	if err := server.refreshFeedFallback(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	store.down = true
+	// A failed refresh keeps the pool it had
+	if err := server.refreshFeedFallback(context.Background()); err == nil {
+		t.Error("refresh succeeded while the store was down")
+	}
+
+	var animation GetAnimationResponse
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feed", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get(FeedFallbackHeader) != "true" {
+		t.Fatalf("feed while down = %d %q, want the fallback pool", rec.Code, rec.Header().Get(FeedFallbackHeader))
+	}
+	if code := doJSON(t, router, http.MethodGet, "/feed", "", nil, &animation); code != http.StatusOK || animation.ID == "" {
+		t.Errorf("fallback animation = %d %+v", code, animation)
+	}
+
+	var page GetAnimationFeedResponse
+	if code := doJSON(t, router, http.MethodGet, "/feed?limit=1", "", nil, &page); code != http.StatusOK || page.Total != 2 || len(page.Animations) != 1 || page.Animations[0].Description != "rain" || page.NextOffset == nil {
+		t.Errorf("fallback page = %d %+v, want the newest animation of two", code, page)
+	}
+
+	// Unscreened animations are never in the calm pool
+	if code := doJSON(t, router, http.MethodGet, "/feed?reducedMotion=true", "", nil, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("reduced motion feed while down = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
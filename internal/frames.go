@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults for preview frames
+const (
+	defaultPreviewFrameCount = 4
+	maxPreviewFrameCount     = 8
+	// previewFrameSpan is how many frames previews are spread over, about two seconds at 60fps
+	previewFrameSpan     = 120
+	previewRenderTimeout = 10 * time.Second
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// errSketchCrashed is returned when a sketch throws while its preview is rendered
+var errSketchCrashed = errors.New("sketch crashed while rendering")
+
+// previewFrameNumbers returns count frame numbers spread evenly over the preview span, ending on its last frame
+func previewFrameNumbers(count int) []int {
+	frames := make([]int, count)
+	for i := range frames {
+		frames[i] = (i + 1) * previewFrameSpan / count
+	}
+	return frames
+}
+
+// RenderPreviewFrames renders code headlessly and captures count evenly spaced frames as PNGs
+func RenderPreviewFrames(ctx context.Context, renderer SketchRenderer, code string, count int) ([]PreviewFrame, error) {
+	numbers := previewFrameNumbers(count)
+	result, err := renderer.Render(ctx, RenderRequest{
+		Code:          code,
+		Seed:          determinismSeed,
+		Frames:        previewFrameSpan,
+		TimeoutMs:     int(previewRenderTimeout / time.Millisecond),
+		CaptureFrames: numbers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%w: %s", errSketchCrashed, result.Error)
+	}
+	pngs, err := capturedPNGs(result, count)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]PreviewFrame, count)
+	for i, png := range pngs {
+		frames[i] = PreviewFrame{Frame: numbers[i], PNG: png}
+	}
+	return frames, nil
+}
+
+// capturedPNGs decodes the count frames a renderer captured, checking each is a PNG
+func capturedPNGs(result RenderResult, count int) ([][]byte, error) {
+	if len(result.Captures) != count {
+		return nil, fmt.Errorf("renderer returned %d frames, want %d", len(result.Captures), count)
+	}
+
+	pngs := make([][]byte, count)
+	for i, capture := range result.Captures {
+		png, err := base64.StdEncoding.DecodeString(capture)
+		if err != nil {
+			return nil, fmt.Errorf("renderer returned an invalid frame: %w", err)
+		}
+		if !bytes.HasPrefix(png, pngSignature) {
+			return nil, errors.New("renderer returned a frame that is not a PNG")
+		}
+		pngs[i] = png
+	}
+	return pngs, nil
+}
+
+// previewFrames returns the preview frames of code, rendering and storing them the first time they
+// are asked for. Frames are stored by code hash, so editing an animation renders new ones. Stored
+// frames are still returned while thumbnails are switched off.
+func (s *Server) previewFrames(ctx context.Context, renderer SketchRenderer, code string, count int) ([]PreviewFrame, error) {
+	codeHash := CodeHash(code)
+	frames, err := s.store.GetPreviewFrames(ctx, codeHash, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == count {
+		return frames, nil
+	}
+	if !FeatureEnabled(FeatureThumbnails) {
+		return nil, errFeatureOff
+	}
+
+	if frames, err = RenderPreviewFrames(ctx, renderer, code, count); err != nil {
+		return nil, err
+	}
+	if err := s.store.SavePreviewFrames(ctx, codeHash, frames); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// previewFrameImage returns a frame as a data URL an <img> can show directly
+func previewFrameImage(png []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakePNG returns a base64 capture that starts like a PNG file
+func fakePNG(body string) string {
+	return base64.StdEncoding.EncodeToString(append(append([]byte{}, pngSignature...), body...))
+}
+
+func TestPreviewFrameNumbers(t *testing.T) {
+	tests := []struct {
+		count int
+		want  []int
+	}{
+		{1, []int{120}},
+		{4, []int{30, 60, 90, 120}},
+		{8, []int{15, 30, 45, 60, 75, 90, 105, 120}},
+	}
+	for _, tt := range tests {
+		if got := previewFrameNumbers(tt.count); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("previewFrameNumbers(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPreviewFrames(t *testing.T) {
+	tests := []struct {
+		name      string
+		result    RenderResult
+		wantErr   bool
+		wantCrash bool
+	}{
+		{name: "Captured", result: RenderResult{Captures: []string{fakePNG("a"), fakePNG("b")}}},
+		{name: "Sketch throws", result: RenderResult{Error: "ReferenceError: x is not defined"}, wantErr: true, wantCrash: true},
+		{name: "Missing frames", result: RenderResult{Captures: []string{fakePNG("a")}}, wantErr: true},
+		{name: "Not a PNG", result: RenderResult{Captures: []string{fakePNG("a"), base64.StdEncoding.EncodeToString([]byte("GIF89a"))}}, wantErr: true},
+		{name: "Not base64", result: RenderResult{Captures: []string{fakePNG("a"), "%%%"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &fakeRenderer{results: []RenderResult{tt.result}}
+			frames, err := RenderPreviewFrames(context.Background(), renderer, "function draw() {}", 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderPreviewFrames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, errSketchCrashed) != tt.wantCrash {
+				t.Errorf("crash = %v, want %v", errors.Is(err, errSketchCrashed), tt.wantCrash)
+			}
+			if err == nil && (frames[0].Frame != 60 || frames[1].Frame != 120) {
+				t.Errorf("frames = %+v, want frames 60 and 120", frames)
+			}
+		})
+	}
+}
+
+func TestPreviewFramesAreStoredByCode(t *testing.T) {
+	resetFeatures(t)
+	ctx := context.Background()
+	server := NewServer(NewMemoryStore())
+	renderer := &fakeRenderer{results: []RenderResult{{Captures: []string{fakePNG("a"), fakePNG("b")}}}}
+
+	for i := 0; i < 2; i++ {
+		frames, err := server.previewFrames(ctx, renderer, "function draw() {}", 2)
+		if err != nil || len(frames) != 2 {
+			t.Fatalf("previewFrames() = %d frames, %v", len(frames), err)
+		}
+	}
+	if renderer.calls != 1 {
+		t.Errorf("renderer called %d times, want 1", renderer.calls)
+	}
+
+	// Edited code and a different frame count each render a new set
+	if _, err := server.previewFrames(ctx, renderer, "function draw() { background(0); }", 2); err != nil {
+		t.Fatalf("previewFrames() for edited code: %v", err)
+	}
+	renderer.results = []RenderResult{{Captures: []string{fakePNG("a")}}}
+	if _, err := server.previewFrames(ctx, renderer, "function draw() {}", 1); err != nil {
+		t.Fatalf("previewFrames() with one frame: %v", err)
+	}
+	if renderer.calls != 3 {
+		t.Errorf("renderer called %d times, want 3", renderer.calls)
+	}
+}
@@ -0,0 +1,489 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"animate-server/internal/animatepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCConfig describes the gRPC service other backend services call, read from the environment
+// by GRPCConfigFromEnv
+type GRPCConfig struct {
+	Addr     string
+	Token    string
+	CertFile string
+	KeyFile  string
+	// TenantTokens are the bearer tokens of callers acting for a single tenant, by tenant
+	TenantTokens map[string]string
+}
+
+// Enabled reports whether the gRPC service is served
+func (c GRPCConfig) Enabled() bool {
+	return c.Addr != ""
+}
+
+// GRPCConfigFromEnv reads GRPC_ADDR, where the gRPC service listens, and GRPC_TOKEN, the bearer
+// token callers must send. The service is off without an address, and refuses to start without a
+// token, since every call acts for whichever user it names. Off a loopback address it also needs
+// GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE, so tokens never cross the network in the clear.
+// GRPC_TENANT_TOKENS gives callers acting for one tenant their own tokens, as tenant=token pairs.
+func GRPCConfigFromEnv() (GRPCConfig, error) {
+	config := GRPCConfig{
+		Addr:     os.Getenv("GRPC_ADDR"),
+		Token:    os.Getenv("GRPC_TOKEN"),
+		CertFile: os.Getenv("GRPC_TLS_CERT_FILE"),
+		KeyFile:  os.Getenv("GRPC_TLS_KEY_FILE"),
+	}
+	if !config.Enabled() {
+		return config, nil
+	}
+	if config.Token == "" {
+		return config, errors.New("GRPC_TOKEN must be set when GRPC_ADDR is")
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return config, errors.New("GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE must be set together")
+	}
+	if config.CertFile == "" && !isLoopbackAddr(config.Addr) {
+		return config, fmt.Errorf("GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE must be set to serve gRPC on %s, which is not a loopback address", config.Addr)
+	}
+
+	tokens, err := parseRegionMap("GRPC_TENANT_TOKENS")
+	if err != nil {
+		return config, err
+	}
+	tenants, err := TenantRegions()
+	if err != nil {
+		return config, err
+	}
+	seen := map[string]bool{config.Token: true}
+	for tenant, token := range tokens {
+		if _, ok := tenants[tenant]; !ok {
+			return config, fmt.Errorf("GRPC_TENANT_TOKENS names unknown tenant %s", tenant)
+		}
+		if seen[token] {
+			return config, fmt.Errorf("GRPC_TENANT_TOKENS gives %s a token already in use", tenant)
+		}
+		seen[token] = true
+	}
+	config.TenantTokens = tokens
+	return config, nil
+}
+
+// isLoopbackAddr reports whether a listen address only accepts connections from this machine. An
+// address without a host listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// grpcService serves animatepb.AnimateService from the same store and generation queue as the
+// HTTP handlers
+type grpcService struct {
+	animatepb.UnimplementedAnimateServiceServer
+	server *Server
+}
+
+// NewGRPCServer returns a gRPC server offering AnimateService to the callers config names, over
+// TLS when it has a certificate
+func (s *Server) NewGRPCServer(config GRPCConfig) (*grpc.Server, error) {
+	options := []grpc.ServerOption{grpc.UnaryInterceptor(grpcAuthInterceptor(config))}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load gRPC certificate: %w", err)
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})))
+	}
+	server := grpc.NewServer(options...)
+	animatepb.RegisterAnimateServiceServer(server, &grpcService{server: s})
+	return server, nil
+}
+
+// ServeGRPC serves the gRPC service as configured, exiting when its address cannot be listened on
+func (s *Server) ServeGRPC(config GRPCConfig) {
+	server, err := s.NewGRPCServer(config)
+	if err != nil {
+		log.Fatalf("could not start gRPC server: %v", err)
+	}
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		log.Fatalf("could not start gRPC server: %v", err)
+	}
+	log.Printf("gRPC service starting on %s...", config.Addr)
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("gRPC server stopped: %v", err)
+	}
+}
+
+// grpcMetadata returns the first value of an incoming call's metadata key
+func grpcMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcCaller returns the tenant of the caller whose token was provided, empty for GRPC_TOKEN, and
+// whether any token matched. Every token is compared so the time taken reveals none of them.
+func grpcCaller(config GRPCConfig, provided string) (string, bool) {
+	tenant, found := "", subtle.ConstantTimeCompare([]byte(provided), []byte(config.Token)) == 1
+	for name, token := range config.TenantTokens {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			tenant, found = name, true
+		}
+	}
+	return tenant, found
+}
+
+// grpcAuthInterceptor turns away calls without a configured bearer token, and sends the queries of
+// callers acting for a tenant to the tenant's region, as TenantMiddleware does. The tenant comes
+// from the caller's token; x-tenant-id metadata naming any other tenant is refused.
+func grpcAuthInterceptor(config GRPCConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		tenant, ok := grpcCaller(config, strings.TrimPrefix(grpcMetadata(ctx, "authorization"), "Bearer "))
+		if !ok {
+			LogResponse(info.FullMethod, "Invalid gRPC token", nil)
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+		if named := strings.TrimSpace(grpcMetadata(ctx, strings.ToLower(TenantHeader))); named != "" && named != tenant {
+			return nil, grpcError(info.FullMethod, "Tenant does not match the caller's token", codes.PermissionDenied, nil)
+		}
+
+		if tenant != "" {
+			tenants, err := TenantRegions()
+			if err != nil {
+				return nil, grpcError(info.FullMethod, "Tenant configuration error", codes.Internal, err)
+			}
+			region, ok := tenants[tenant]
+			if !ok {
+				return nil, grpcError(info.FullMethod, "Unknown tenant", codes.Internal, nil)
+			}
+			ctx = WithDataRegion(WithTenant(ctx, tenant), region)
+		}
+
+		LogRequest(info.FullMethod, "gRPC call")
+		return handler(ctx, req)
+	}
+}
+
+// grpcError logs a failed call and returns the status the caller gets, with message as its text
+func grpcError(method, message string, code codes.Code, err error) error {
+	LogResponse(method, message, err)
+	return status.Error(code, message)
+}
+
+// grpcScrubber returns the text scrubber for the user a call acts for, empty for calls made for
+// nobody in particular
+func (g *grpcService) grpcScrubber(ctx context.Context, userId string) TextScrubber {
+	return ScrubberFor(ctx, g.server.store, userId)
+}
+
+// grpcPage returns the limit and offset of a paged call, defaulting and bounding them as parsePage does
+func grpcPage(method string, limit, offset int32) (int, int, error) {
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 1 || limit > maxPageSize {
+		return 0, 0, grpcError(method, "Limit must be between 1 and "+strconv.Itoa(maxPageSize), codes.InvalidArgument, nil)
+	}
+	if offset < 0 {
+		return 0, 0, grpcError(method, "Offset must be zero or more", codes.InvalidArgument, nil)
+	}
+	return int(limit), int(offset), nil
+}
+
+// grpcUser checks that the user a call acts for exists
+func (g *grpcService) grpcUser(ctx context.Context, method, userId string) (User, error) {
+	if userId == "" {
+		return User{}, grpcError(method, "User ID cannot be empty", codes.InvalidArgument, nil)
+	}
+	user, err := g.server.store.GetUserDetails(ctx, userId)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return User{}, grpcError(method, "User not found", codes.NotFound, nil)
+		}
+		return User{}, grpcError(method, "Error retrieving user", codes.Internal, err)
+	}
+	return user, nil
+}
+
+func animationMessage(animation GetAnimationResponse) *animatepb.Animation {
+	return &animatepb.Animation{
+		Id:          animation.ID,
+		Code:        animation.Code,
+		Description: animation.Description,
+		P5Version:   animation.P5Version,
+		P5Url:       animation.P5URL,
+		P5Integrity: animation.P5Integrity,
+	}
+}
+
+func moodMessage(mood MoodEntry) *animatepb.Mood {
+	return &animatepb.Mood{
+		AnimationId:          mood.AnimationID,
+		AnimationDescription: mood.AnimationDescription,
+		Mood:                 string(mood.Mood),
+		CreatedAt:            timestamppb.New(mood.CreatedAt),
+	}
+}
+
+func generationJobMessage(job GenerationJob) *animatepb.GenerationJob {
+	message := &animatepb.GenerationJob{
+		Id:        job.ID,
+		Status:    job.Status,
+		Error:     job.Error,
+		CreatedAt: timestamppb.New(job.CreatedAt),
+		UpdatedAt: timestamppb.New(job.UpdatedAt),
+	}
+	if job.Result != nil {
+		message.Code = job.Result.Code
+	}
+	return message
+}
+
+func (g *grpcService) GetAnimation(ctx context.Context, req *animatepb.GetAnimationRequest) (*animatepb.Animation, error) {
+	const method = animatepb.AnimateService_GetAnimation_FullMethodName
+	if req.Id == "" || !g.server.store.AnimationExists(ctx, req.Id) {
+		return nil, grpcError(method, "Animation not found", codes.NotFound, nil)
+	}
+	animation, err := g.server.store.GetAnimation(ctx, req.Id)
+	if err != nil {
+		if err.Error() == "animation removed" {
+			return nil, grpcError(method, "Animation removed following a takedown request", codes.FailedPrecondition, nil)
+		}
+		return nil, grpcError(method, "Error retrieving animation", codes.Internal, err)
+	}
+	animation.Description = g.grpcScrubber(ctx, "").Mask(animation.Description)
+	return animationMessage(animation), nil
+}
+
+func (g *grpcService) ListFeed(ctx context.Context, req *animatepb.ListFeedRequest) (*animatepb.ListFeedResponse, error) {
+	const method = animatepb.AnimateService_ListFeed_FullMethodName
+	limit, offset, err := grpcPage(method, req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	filter := FeedFilter{ReducedMotion: req.ReducedMotion, AvoidFlashing: req.AvoidFlashing, MaxMotionScore: ReducedMotionMaxChange()}
+	animations, total, err := g.server.store.ListFeedAnimations(ctx, filter, limit, offset)
+	if err != nil {
+		var ok bool
+		if animations, total, ok = g.server.fallbackPage(filter, limit, offset); !ok {
+			return nil, grpcError(method, "The feed is temporarily unavailable", codes.Unavailable, err)
+		}
+		LogResponse(method, "Error retrieving feed page, serving the fallback pool", err)
+		feedFallbacks.Add(1)
+	}
+
+	scrubber := g.grpcScrubber(ctx, "")
+	response := &animatepb.ListFeedResponse{Total: int32(total)}
+	for _, animation := range animations {
+		animation.Description = scrubber.Mask(animation.Description)
+		response.Animations = append(response.Animations, animationMessage(animation))
+	}
+	return response, nil
+}
+
+func (g *grpcService) SaveAnimation(ctx context.Context, req *animatepb.SaveAnimationRequest) (*animatepb.Animation, error) {
+	const method = animatepb.AnimateService_SaveAnimation_FullMethodName
+	if _, err := g.grpcUser(ctx, method, req.UserId); err != nil {
+		return nil, err
+	}
+	description := g.grpcScrubber(ctx, req.UserId).Scrub(ctx, req.Description)
+
+	// Keep sketches that would stutter on low-end devices out of the feed, as saves over HTTP do
+	if estimate := checkSketchBudget(ctx, req.Code); !estimate.WithinBudget() {
+		return nil, grpcError(method, "Sketch exceeds performance budget: "+strings.Join(estimate.Violations, "; "), codes.InvalidArgument, nil)
+	}
+	p5Version, err := g.server.resolveP5Version(ctx, req.P5Version)
+	if err != nil {
+		if err.Error() == "p5.js version not found" {
+			return nil, grpcError(method, "Unknown p5.js version "+req.P5Version, codes.InvalidArgument, nil)
+		}
+		return nil, grpcError(method, "Error saving animation", codes.Internal, err)
+	}
+
+	id, err := g.server.store.SaveAnimation(ctx, req.Code, description, req.UserId, p5Version)
+	if err != nil {
+		return nil, grpcError(method, "Error saving animation", codes.Internal, err)
+	}
+	reviewStatus := g.server.afterSaveAnimation(ctx, method, id, req.UserId, req.Code, description)
+	LogResponse(method, "Animation saved with ID: "+id, nil)
+
+	animation, err := g.server.store.GetAnimation(ctx, id)
+	if err != nil {
+		return nil, grpcError(method, "Error retrieving saved animation", codes.Internal, err)
+	}
+	message := animationMessage(animation)
+	message.ReviewStatus = reviewStatus
+	return message, nil
+}
+
+func (g *grpcService) GenerateAnimation(ctx context.Context, req *animatepb.GenerateAnimationRequest) (*animatepb.GenerationJob, error) {
+	const method = animatepb.AnimateService_GenerateAnimation_FullMethodName
+	if _, err := g.grpcUser(ctx, method, req.UserId); err != nil {
+		return nil, err
+	}
+	if req.Description == "" {
+		return nil, grpcError(method, "Description cannot be empty", codes.InvalidArgument, nil)
+	}
+	style, err := ValidatePromptStyle(req.Style)
+	if err != nil {
+		return nil, grpcError(method, err.Error(), codes.InvalidArgument, nil)
+	}
+	jobId, err := generateRandomID()
+	if err != nil {
+		return nil, grpcError(method, "Error starting generation", codes.Internal, err)
+	}
+	job := generationJob{id: jobId, userId: req.UserId, description: req.Description, style: style}
+
+	// Pick the key as pickGenerationKey does: the user's own when they stored one, otherwise the
+	// house key against their workspace's credits or their quota
+	key, own, err := g.server.ownGenerationKey(ctx, req.UserId)
+	if err != nil {
+		return nil, grpcError(method, "Error retrieving the user's provider key", codes.Internal, err)
+	}
+	if own {
+		job.key = key
+	} else {
+		claudeAPIKey := GetAPIKey("CLAUDE_API_KEY")
+		if claudeAPIKey == "" {
+			return nil, grpcError(method, "Claude API key not configured", codes.Internal, nil)
+		}
+		if job.organizationId, _, err = g.server.reserveHouseGeneration(ctx, req.UserId); err != nil {
+			switch err.Error() {
+			case "organization credits exhausted":
+				return nil, grpcError(method, "Workspace credits exhausted for this month", codes.ResourceExhausted, nil)
+			case "organization member limit reached":
+				return nil, grpcError(method, "The user's monthly limit in their workspace is reached", codes.ResourceExhausted, nil)
+			case "generation quota exceeded":
+				return nil, grpcError(method, "Generation quota exceeded", codes.ResourceExhausted, nil)
+			}
+			return nil, grpcError(method, "Error checking generation quota", codes.Internal, err)
+		}
+		job.key = GenerationKey{Provider: ProviderAnthropic, APIKey: claudeAPIKey}
+	}
+
+	job.publish(GenerationUpdate{Status: GenerationQueued})
+	if err := g.server.store.EnqueueGenerationJob(ctx, job.queued()); err != nil {
+		g.server.settleGeneration(ctx, method, job, false)
+		job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Error starting generation"})
+		return nil, grpcError(method, "Error starting generation", codes.Internal, err)
+	}
+	g.server.wakeGenerationWorker()
+	LogResponse(method, "Queued generation job "+job.id, nil)
+
+	now := time.Now().UTC()
+	return generationJobMessage(GenerationJob{ID: job.id, Status: GenerationQueued, CreatedAt: now, UpdatedAt: now}), nil
+}
+
+func (g *grpcService) GetGenerationJob(ctx context.Context, req *animatepb.GetGenerationJobRequest) (*animatepb.GenerationJob, error) {
+	const method = animatepb.AnimateService_GetGenerationJob_FullMethodName
+	job, err := g.server.store.GetGenerationJob(ctx, req.Id, req.UserId)
+	if err != nil {
+		if err.Error() == "generation job not found" {
+			return nil, grpcError(method, "Generation job not found", codes.NotFound, nil)
+		}
+		return nil, grpcError(method, "Error retrieving generation job", codes.Internal, err)
+	}
+	return generationJobMessage(job), nil
+}
+
+func (g *grpcService) GetUser(ctx context.Context, req *animatepb.GetUserRequest) (*animatepb.User, error) {
+	user, err := g.grpcUser(ctx, animatepb.AnimateService_GetUser_FullMethodName, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	message := &animatepb.User{Id: user.ID, Username: user.Username, Email: user.Email}
+	if user.LastLogin != nil {
+		message.LastLogin = timestamppb.New(*user.LastLogin)
+	}
+	return message, nil
+}
+
+func (g *grpcService) ListMoods(ctx context.Context, req *animatepb.ListMoodsRequest) (*animatepb.ListMoodsResponse, error) {
+	const method = animatepb.AnimateService_ListMoods_FullMethodName
+	limit, offset, err := grpcPage(method, req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	var from, to time.Time
+	if req.From != nil {
+		from = req.From.AsTime()
+	}
+	if req.To != nil {
+		to = req.To.AsTime()
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, grpcError(method, "from must be before to", codes.InvalidArgument, nil)
+	}
+
+	moods, total, err := g.server.store.ListMoods(ctx, req.UserId, from, to, limit, offset)
+	if err != nil {
+		return nil, grpcError(method, "Error retrieving moods", codes.Internal, err)
+	}
+	response := &animatepb.ListMoodsResponse{Total: int32(total)}
+	for _, mood := range moods {
+		response.Moods = append(response.Moods, moodMessage(mood))
+	}
+	return response, nil
+}
+
+func (g *grpcService) SaveMood(ctx context.Context, req *animatepb.SaveMoodRequest) (*animatepb.Mood, error) {
+	const method = animatepb.AnimateService_SaveMood_FullMethodName
+	if _, err := g.grpcUser(ctx, method, req.UserId); err != nil {
+		return nil, err
+	}
+	mood := Mood(req.Mood)
+	if !mood.Valid() {
+		return nil, grpcError(method, "Invalid mood value", codes.InvalidArgument, nil)
+	}
+	if req.AnimationId == "" || !g.server.store.AnimationExists(ctx, req.AnimationId) {
+		return nil, grpcError(method, "Animation not found", codes.NotFound, nil)
+	}
+
+	if err := g.server.store.SaveMood(ctx, req.UserId, req.AnimationId, string(mood)); err != nil {
+		return nil, grpcError(method, "Error saving mood", codes.Internal, err)
+	}
+	// A mood soon after a reminder answers it
+	if err := g.server.store.RecordReminderCheckIn(ctx, req.UserId, reminderCheckInWindow); err != nil {
+		LogResponse(method, "Error recording reminder check-in", err)
+	}
+
+	message := moodMessage(MoodEntry{AnimationID: req.AnimationId, Mood: mood, CreatedAt: time.Now().UTC()})
+	tenant := TenantFromContext(ctx)
+	scrubber := g.grpcScrubber(ctx, req.UserId)
+	for _, followUp := range g.server.runMoodRules(ctx, method, req.UserId, tenant, mood) {
+		followUpMessage := &animatepb.MoodFollowUp{RuleId: int32(followUp.RuleID), Type: followUp.Type, Resources: string(followUp.Resources)}
+		for _, animation := range followUp.Animations {
+			animation.Description = scrubber.Mask(animation.Description)
+			followUpMessage.Animations = append(followUpMessage.Animations, animationMessage(animation))
+		}
+		message.FollowUps = append(message.FollowUps, followUpMessage)
+	}
+	return message, nil
+}
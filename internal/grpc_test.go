@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"animate-server/internal/animatepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCConfigFromEnv(t *testing.T) {
+	t.Setenv("DATA_REGION_DATABASES", "eu=postgres://eu-db/animations")
+	t.Setenv("TENANT_REGIONS", "acme=eu")
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "address without a token", env: map[string]string{"GRPC_ADDR": "127.0.0.1:9090"}, wantErr: true},
+		{name: "loopback address", env: map[string]string{"GRPC_ADDR": "127.0.0.1:9090", "GRPC_TOKEN": "internal"}, wantEnabled: true},
+		{name: "localhost", env: map[string]string{"GRPC_ADDR": "localhost:9090", "GRPC_TOKEN": "internal"}, wantEnabled: true},
+		{name: "IPv6 loopback address", env: map[string]string{"GRPC_ADDR": "[::1]:9090", "GRPC_TOKEN": "internal"}, wantEnabled: true},
+		{name: "every interface without TLS", env: map[string]string{"GRPC_ADDR": ":9090", "GRPC_TOKEN": "internal"}, wantErr: true},
+		{name: "public address without TLS", env: map[string]string{"GRPC_ADDR": "10.0.0.5:9090", "GRPC_TOKEN": "internal"}, wantErr: true},
+		{name: "every interface with TLS", env: map[string]string{"GRPC_ADDR": ":9090", "GRPC_TOKEN": "internal", "GRPC_TLS_CERT_FILE": "cert.pem", "GRPC_TLS_KEY_FILE": "key.pem"}, wantEnabled: true},
+		{name: "certificate without key", env: map[string]string{"GRPC_ADDR": ":9090", "GRPC_TOKEN": "internal", "GRPC_TLS_CERT_FILE": "cert.pem"}, wantErr: true},
+		{name: "tenant token", env: map[string]string{"GRPC_ADDR": "127.0.0.1:9090", "GRPC_TOKEN": "internal", "GRPC_TENANT_TOKENS": "acme=acme-token"}, wantEnabled: true},
+		{name: "unknown tenant token", env: map[string]string{"GRPC_ADDR": "127.0.0.1:9090", "GRPC_TOKEN": "internal", "GRPC_TENANT_TOKENS": "initech=initech-token"}, wantErr: true},
+		{name: "tenant token reusing GRPC_TOKEN", env: map[string]string{"GRPC_ADDR": "127.0.0.1:9090", "GRPC_TOKEN": "internal", "GRPC_TENANT_TOKENS": "acme=internal"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"GRPC_ADDR", "GRPC_TOKEN", "GRPC_TLS_CERT_FILE", "GRPC_TLS_KEY_FILE", "GRPC_TENANT_TOKENS"} {
+				t.Setenv(key, tt.env[key])
+			}
+			config, err := GRPCConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GRPCConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.Enabled() != tt.wantEnabled {
+				t.Errorf("enabled = %v, want %v", config.Enabled(), tt.wantEnabled)
+			}
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for localhost and its key, returning their paths
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// dialGRPC serves server's gRPC service in memory as configured and returns a client for it,
+// trusting the configured certificate when there is one
+func dialGRPC(t *testing.T, server *Server, config GRPCConfig) animatepb.AnimateServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer, err := server.NewGRPCServer(config)
+	if err != nil {
+		t.Fatalf("NewGRPCServer: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	creds := insecure.NewCredentials()
+	if config.CertFile != "" {
+		if creds, err = credentials.NewClientTLSFromFile(config.CertFile, "localhost"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return animatepb.NewAnimateServiceClient(conn)
+}
+
+func TestGRPCOverTLS(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	server := NewServer(NewMemoryStore())
+	artist := registerAccount(t, server.Router(), "artist")
+	certFile, keyFile := writeTestCertificate(t)
+	config := GRPCConfig{Token: "internal", CertFile: certFile, KeyFile: keyFile}
+
+	client := dialGRPC(t, server, config)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer internal")
+	if user, err := client.GetUser(ctx, &animatepb.GetUserRequest{Id: artist.User.ID}); err != nil || user.Username != "artist" {
+		t.Errorf("GetUser over TLS = %+v, %v", user, err)
+	}
+
+	if _, err := server.NewGRPCServer(GRPCConfig{Token: "internal", CertFile: certFile, KeyFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("a missing key file was accepted")
+	}
+}
+
+func TestGRPCCallerTenant(t *testing.T) {
+	t.Setenv("DATA_REGION_DATABASES", "eu=postgres://eu-db/animations")
+	t.Setenv("TENANT_REGIONS", "acme=eu,globex=primary")
+
+	interceptor := grpcAuthInterceptor(GRPCConfig{Token: "internal", TenantTokens: map[string]string{"acme": "acme-token", "globex": "globex-token"}})
+	tests := []struct {
+		name       string
+		token      string
+		tenant     string
+		wantCode   codes.Code
+		wantRegion string
+		wantTenant string
+	}{
+		{name: "Shared token", token: "internal", wantCode: codes.OK, wantRegion: "primary"},
+		{name: "Regional tenant's token", token: "acme-token", wantCode: codes.OK, wantRegion: "eu", wantTenant: "acme"},
+		{name: "Primary tenant's token", token: "globex-token", wantCode: codes.OK, wantRegion: "primary", wantTenant: "globex"},
+		{name: "Tenant naming itself", token: "acme-token", tenant: "acme", wantCode: codes.OK, wantRegion: "eu", wantTenant: "acme"},
+		{name: "Tenant naming another tenant", token: "acme-token", tenant: "globex", wantCode: codes.PermissionDenied},
+		{name: "Shared token naming a tenant", token: "internal", tenant: "acme", wantCode: codes.PermissionDenied},
+		{name: "Wrong token", token: "guess", wantCode: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.Pairs("authorization", "Bearer "+tt.token)
+			if tt.tenant != "" {
+				md.Set(strings.ToLower(TenantHeader), tt.tenant)
+			}
+			var gotRegion, gotTenant string
+			_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), nil, &grpc.UnaryServerInfo{FullMethod: "/animate.v1.AnimateService/GetUser"},
+				func(ctx context.Context, _ any) (any, error) {
+					gotRegion, gotTenant = DataRegionFromContext(ctx), TenantFromContext(ctx)
+					return nil, nil
+				})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v", code, tt.wantCode)
+			}
+			if tt.wantCode == codes.OK && (gotRegion != tt.wantRegion || gotTenant != tt.wantTenant) {
+				t.Errorf("region, tenant = %q, %q, want %q, %q", gotRegion, gotTenant, tt.wantRegion, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestGRPCService(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}\nfunction draw() {}"}]}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	artist := registerAccount(t, router, "artist")
+
+	client := dialGRPC(t, server, GRPCConfig{Token: "internal"})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer internal")
+
+	if _, err := client.GetUser(context.Background(), &animatepb.GetUserRequest{Id: artist.User.ID}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call without a token = %v, want %v", err, codes.Unauthenticated)
+	}
+	wrong := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer guess")
+	if _, err := client.GetUser(wrong, &animatepb.GetUserRequest{Id: artist.User.ID}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("call with the wrong token = %v, want %v", err, codes.Unauthenticated)
+	}
+
+	user, err := client.GetUser(ctx, &animatepb.GetUserRequest{Id: artist.User.ID})
+	if err != nil || user.Username != "artist" || user.Email != "artist@example.com" {
+		t.Fatalf("GetUser = %+v, %v", user, err)
+	}
+	if _, err := client.GetUser(ctx, &animatepb.GetUserRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown user = %v, want %v", err, codes.NotFound)
+	}
+
+	saved, err := client.SaveAnimation(ctx, &animatepb.SaveAnimationRequest{UserId: artist.User.ID, Code: "function setup() {}\nfunction draw() {}", Description: "waves"})
+	if err != nil || saved.Id == "" || saved.Description != "waves" {
+		t.Fatalf("SaveAnimation = %+v, %v", saved, err)
+	}
+	if _, err := client.SaveAnimation(ctx, &animatepb.SaveAnimationRequest{UserId: "missing", Code: "function draw() {}"}); status.Code(err) != codes.NotFound {
+		t.Errorf("save for an unknown user = %v, want %v", err, codes.NotFound)
+	}
+	if animation, err := client.GetAnimation(ctx, &animatepb.GetAnimationRequest{Id: saved.Id}); err != nil || !strings.Contains(animation.Code, "function draw()") {
+		t.Errorf("GetAnimation = %+v, %v", animation, err)
+	}
+	if _, err := client.GetAnimation(ctx, &animatepb.GetAnimationRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown animation = %v, want %v", err, codes.NotFound)
+	}
+	if feed, err := client.ListFeed(ctx, &animatepb.ListFeedRequest{Limit: 5}); err != nil || feed.Total != 1 || feed.Animations[0].Id != saved.Id {
+		t.Errorf("ListFeed = %+v, %v", feed, err)
+	}
+	if _, err := client.ListFeed(ctx, &animatepb.ListFeedRequest{Limit: maxPageSize + 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("oversized page = %v, want %v", err, codes.InvalidArgument)
+	}
+
+	if _, err := client.SaveMood(ctx, &animatepb.SaveMoodRequest{UserId: artist.User.ID, AnimationId: saved.Id, Mood: "ecstatic"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid mood = %v, want %v", err, codes.InvalidArgument)
+	}
+	if _, err := client.SaveMood(ctx, &animatepb.SaveMoodRequest{UserId: artist.User.ID, AnimationId: saved.Id, Mood: string(MoodBetter)}); err != nil {
+		t.Fatalf("SaveMood: %v", err)
+	}
+	if moods, err := client.ListMoods(ctx, &animatepb.ListMoodsRequest{UserId: artist.User.ID}); err != nil || moods.Total != 1 || moods.Moods[0].Mood != string(MoodBetter) {
+		t.Errorf("ListMoods = %+v, %v", moods, err)
+	}
+
+	job, err := client.GenerateAnimation(ctx, &animatepb.GenerateAnimationRequest{UserId: artist.User.ID, Description: "a calm ocean"})
+	if err != nil || job.Status != GenerationQueued {
+		t.Fatalf("GenerateAnimation = %+v, %v", job, err)
+	}
+	if _, err := client.GenerateAnimation(ctx, &animatepb.GenerateAnimationRequest{UserId: artist.User.ID}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("generation without a description = %v, want %v", err, codes.InvalidArgument)
+	}
+	if ran, err := server.runNextGenerationJob(context.Background()); !ran || err != nil {
+		t.Fatalf("run job = %v, %v", ran, err)
+	}
+	job, err = client.GetGenerationJob(ctx, &animatepb.GetGenerationJobRequest{Id: job.Id, UserId: artist.User.ID})
+	if err != nil || job.Status != GenerationDone || !strings.Contains(job.Code, "function draw()") {
+		t.Errorf("GetGenerationJob = %+v, %v, want it done", job, err)
+	}
+	if _, err := client.GetGenerationJob(ctx, &animatepb.GetGenerationJobRequest{Id: job.Id, UserId: admin.User.ID}); status.Code(err) != codes.NotFound {
+		t.Errorf("another user's job = %v, want %v", err, codes.NotFound)
+	}
+
+	var quota GenerationQuota
+	if code := doJSON(t, router, http.MethodGet, "/quota", artist.Token, nil, &quota); code != http.StatusOK || quota.DailyUsed != 1 {
+		t.Errorf("quota = %d %+v, want the gRPC generation counted", code, quota)
+	}
+}
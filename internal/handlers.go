@@ -1,8 +1,18 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,54 +20,348 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// SetupRouter configures and returns the application router
+// Server holds the dependencies shared by the HTTP handlers
+type Server struct {
+	store Store
+	// embedder computes description embeddings for semantic search; nil when it is disabled
+	embedder Embedder
+	// searcher answers full-text searches
+	searcher Searcher
+	// widget is the animation embedded widgets are showing
+	widget widgetMoment
+	// reports holds the monthly PDF reports rendering and rendered on this instance
+	reports reportJobs
+	// generationWake wakes an idle generation worker when a job is queued on this instance
+	generationWake chan struct{}
+	// deprecations announces deprecated routes and fields and counts who still uses them
+	deprecations *deprecationTracker
+	// fallback holds the animations the feed serves while the database cannot answer
+	fallback feedFallback
+	// events carries published animations to the subscription notifier
+	events *eventBus
+	// mailer sends the emails handlers send directly, such as login links
+	mailer Mailer
+	// loginLinks tracks login link requests still being worked on after they were answered
+	loginLinks sync.WaitGroup
+}
+
+// NewServer returns a server that persists data in store
+func NewServer(store Store) *Server {
+	server := &Server{store: store, searcher: NewSearcher(store), generationWake: make(chan struct{}, 1), events: newEventBus(), mailer: GetMailer()}
+	if embedder, ok := GetEmbedder(); ok {
+		server.embedder = embedder
+	}
+	return server
+}
+
+// SetupRouter configures and returns the application router backed by the PostgreSQL database,
+// and starts the background workers and, when GRPC_ADDR is set, the gRPC service.
 func SetupRouter() *mux.Router {
+	store := NewCachedStore(NewPostgresStore(), CacheFromEnv(), CacheTTL())
+	go RunDatasetPublisher(context.Background(), store)
+	go RunSLOAlerter(context.Background())
+	go RunDBHealthProbe(context.Background())
+	go RunSearchReplicator(context.Background())
+	go RunNotificationDispatcher(context.Background(), store)
+	go RunReminderScheduler(context.Background(), store)
+	go RunTeamPoster(context.Background(), store)
+	go RunExportPruner(context.Background(), store)
+	go RunPlaybackSessionPruner(context.Background(), store)
+	go RunIdempotencyKeyPruner(context.Background(), store)
+	server := NewServer(store)
+	go server.RunFeedFallbackRefresher(context.Background())
+	go server.RunSubscriptionNotifier(context.Background())
+	go server.RunGenerationWorkers(context.Background())
+	if config, err := GRPCConfigFromEnv(); err == nil && config.Enabled() {
+		go server.ServeGRPC(config)
+	}
+	return server.Router()
+}
+
+// Router configures and returns the application router
+func (s *Server) Router() *mux.Router {
 	r := mux.NewRouter()
 
 	// Add global middlewares
 	r.Use(CorsMiddleware)
+	r.Use(CorrelationMiddleware)
+	r.Use(TenantMiddleware)
 	r.Use(LoggingMiddleware)
+	r.Use(SLOMiddleware)
+	r.Use(LoadShedMiddleware())
+	r.Use(TracingMiddleware)
+	r.Use(ChaosMiddleware())
+	r.Use(ReplayRecorderMiddleware())
+	r.Use(IPRateLimitMiddleware())
+	r.Use(s.AppTokenMiddleware)
+	r.Use(s.ImpersonationMiddleware)
+	r.Use(s.SessionRevocationMiddleware)
+	s.deprecations = newDeprecationTracker(DeprecationRules())
+	r.Use(s.deprecations.middleware)
+
+	// The document is built from this router on its first request
+	r.HandleFunc("/openapi.json", openAPIHandler(r)).Methods(http.MethodGet)
+	r.HandleFunc("/docs", swaggerUIHandler).Methods(http.MethodGet)
+
+	// Every route is served under each API version's prefix, answering in that version's shapes.
+	// Without a prefix, routes stay on the contract clients used before the prefixes existed.
+	limits := newRouteLimits()
+	for _, version := range APIVersions {
+		versioned := r.PathPrefix("/" + string(version)).Subrouter()
+		versioned.Use(func(next http.Handler) http.Handler { return withAPIVersion(version, next) })
+		s.mountRoutes(versioned, limits)
+	}
+	s.mountRoutes(r, limits)
+
+	return r
+}
+
+// routeLimits are the limiting middlewares of the routes, created once so that a client's budget
+// is shared by a route's versioned and unversioned paths
+type routeLimits struct {
+	enumerationGuard func(http.Handler) http.Handler
+	userRateLimit    func(http.Handler) http.Handler
+	triggerRateLimit func(http.Handler) http.Handler
+	widgetRateLimit  func(http.Handler) http.Handler
+}
 
+func newRouteLimits() routeLimits {
+	return routeLimits{
+		enumerationGuard: AnimationEnumerationGuard(),
+		userRateLimit:    UserRateLimitMiddleware(),
+		triggerRateLimit: UserRateLimitMiddleware(),
+		widgetRateLimit:  WidgetRateLimitMiddleware(),
+	}
+}
+
+// mountRoutes registers every route on r, which is the root router or an API version's subrouter
+func (s *Server) mountRoutes(r *mux.Router, limits routeLimits) {
 	// Public routes
-	r.HandleFunc("/register", registerHandler).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/login", loginHandler).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/animation/{id}", getAnimationHandler).Methods(http.MethodGet)
-	r.HandleFunc("/feed", getFeedHandler).Methods(http.MethodGet)
+	r.HandleFunc("/register", s.registerHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/login", s.loginHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/login/magic-link", s.magicLinkHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/login/magic", s.magicLoginHandler).Methods(http.MethodGet)
+	// Both lookups by ID share one probing budget
+	enumerationGuard := limits.enumerationGuard
+	// Registered before /animation/{id}, which would match it too
+	r.Handle("/animation/{id}.js", enumerationGuard(http.HandlerFunc(s.getAnimationScriptHandler))).Methods(http.MethodGet)
+	// Signed-in viewers' playback sessions are tied to them rather than their IP
+	r.Handle("/animation/{id}", enumerationGuard(OptionalAuthMiddleware(http.HandlerFunc(s.getAnimationHandler)))).Methods(http.MethodGet)
+	r.HandleFunc("/animation/{id}/views", s.recordViewHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/animation/{id}/changelog", enumerationGuard(http.HandlerFunc(s.getAnimationChangelogHandler))).Methods(http.MethodGet)
+	r.Handle("/animation/{id}/frames", enumerationGuard(http.HandlerFunc(s.getPreviewFramesHandler))).Methods(http.MethodGet)
+	r.Handle("/animation/{id}/thumbnail", enumerationGuard(http.HandlerFunc(s.getThumbnailHandler))).Methods(http.MethodGet)
+	r.Handle("/animation/{id}/embed", enumerationGuard(http.HandlerFunc(s.getEmbedHandler))).Methods(http.MethodGet)
+	// Exports are shared by their unguessable IDs
+	r.HandleFunc("/exports/{id}", s.downloadExportHandler).Methods(http.MethodGet)
+	r.Handle("/animation/{id}/compatibility", enumerationGuard(http.HandlerFunc(s.getP5CompatibilityHandler))).Methods(http.MethodGet)
+	r.Handle("/animation/{id}/comments", enumerationGuard(http.HandlerFunc(s.listCommentsHandler))).Methods(http.MethodGet)
+	r.Handle("/animation/{id}/moods", enumerationGuard(http.HandlerFunc(s.getAnimationMoodsHandler))).Methods(http.MethodGet)
+	// Signed-in viewers get a feed filtered by their content preferences
+	r.Handle("/feed", OptionalAuthMiddleware(http.HandlerFunc(s.getFeedHandler))).Methods(http.MethodGet)
+	r.Handle("/search", OptionalAuthMiddleware(http.HandlerFunc(s.searchAnimationsHandler))).Methods(http.MethodGet)
+	r.Handle("/search/semantic", OptionalAuthMiddleware(http.HandlerFunc(s.semanticSearchHandler))).Methods(http.MethodGet)
+	r.HandleFunc("/p5-versions", s.listP5LibrariesHandler).Methods(http.MethodGet)
+	r.HandleFunc("/datasets/latest", s.getLatestDatasetHandler).Methods(http.MethodGet)
+	r.HandleFunc("/metrics", metricsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/status", s.statusHandler).Methods(http.MethodGet)
+	r.HandleFunc("/prompt-presets", s.listPublicPromptPresetsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/collections/{id:[0-9]+}/feed.json", s.collectionFeedHandler(CollectionFeedJSON)).Methods(http.MethodGet)
+	r.HandleFunc("/collections/{id:[0-9]+}/feed.rss", s.collectionFeedHandler(CollectionFeedRSS)).Methods(http.MethodGet)
+	// Signage screens poll by the schedule's unguessable ID
+	r.HandleFunc("/signage/schedules/{id}/now", s.signageNowPlayingHandler).Methods(http.MethodGet)
+	// Unattended displays authenticate with kiosk tokens, which only open these routes
+	kiosk := r.PathPrefix("/kiosk").Subrouter()
+	kiosk.Use(s.KioskAuthMiddleware)
+	kiosk.HandleFunc("", s.kioskAssignmentHandler).Methods(http.MethodGet)
+	kiosk.HandleFunc("/schedules/{id}/now", s.kioskNowPlayingHandler).Methods(http.MethodGet)
+	kiosk.HandleFunc("/feed", s.kioskFeedHandler).Methods(http.MethodGet)
+	kiosk.HandleFunc("/animation/{id}", s.kioskAnimationHandler).Methods(http.MethodGet)
+	r.HandleFunc("/profile/revert-email", s.revertEmailPageHandler).Methods(http.MethodGet)
+	r.HandleFunc("/profile/revert-email", s.revertEmailHandler).Methods(http.MethodPost)
+	// Calendar apps cannot sign in, so the feed carries its own token and is routed ahead of /me
+	r.HandleFunc("/me/moods.ics", s.moodCalendarHandler).Methods(http.MethodGet)
+	// Slack and Discord relays sign their events instead of signing in
+	r.HandleFunc("/integrations/{platform:slack|discord}/events/{id}", s.teamEventsHandler).Methods(http.MethodPost)
+	// No-code tools poll with integration keys, which only open these routes
+	triggers := r.PathPrefix("/integrations/triggers").Subrouter()
+	triggers.Use(s.IntegrationKeyAuthMiddleware)
+	triggers.Use(limits.triggerRateLimit)
+	triggers.HandleFunc("", s.listTriggersHandler).Methods(http.MethodGet)
+	triggers.HandleFunc("/{event}", s.triggerHandler).Methods(http.MethodGet)
+	// Third-party apps exchange codes and revoke tokens with PKCE instead of signing in
+	r.HandleFunc("/oauth/token", s.oauthTokenHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/oauth/revoke", s.oauthRevokeHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/takedown-requests", s.createTakedownHandler).Methods(http.MethodPost, http.MethodOptions)
+	r.Handle("/announcements/active", OptionalAuthMiddleware(http.HandlerFunc(s.getActiveAnnouncementsHandler))).Methods(http.MethodGet)
+	// Widgets embedded on other sites share a budget per site
+	widgetLimit := limits.widgetRateLimit
+	r.Handle("/widget/random.json", widgetLimit(http.HandlerFunc(s.widgetAnimationHandler))).Methods(http.MethodGet)
+	r.Handle("/widget/random.js", widgetLimit(http.HandlerFunc(widgetScriptHandler))).Methods(http.MethodGet)
+	// WebSockets authenticate themselves, since browsers cannot send an Authorization header on them
+	r.Handle("/ws", WebSocketAuthMiddleware(AuthMiddleware(http.HandlerFunc(s.generationUpdatesHandler)))).Methods(http.MethodGet)
 
 	// Create a subrouter for protected routes
 	protected := r.PathPrefix("").Subrouter()
 	protected.Use(AuthMiddleware)
+	protected.Use(limits.userRateLimit)
 
 	// Protected routes
-	protected.HandleFunc("/generate-animation", animationHandler).Methods(http.MethodPost, http.MethodOptions)
-	protected.HandleFunc("/save-animation", saveAnimationHandler).Methods(http.MethodPost, http.MethodOptions)
-	protected.HandleFunc("/save-mood", saveMoodHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.Handle("/generate-animation", s.Idempotent(http.HandlerFunc(s.animationHandler))).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/generate-animation/stream", s.streamAnimationHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/jobs/{id}", s.getGenerationJobHandler).Methods(http.MethodGet, http.MethodOptions)
+	protected.Handle("/save-animation", s.Idempotent(http.HandlerFunc(s.saveAnimationHandler))).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/animation/{id}", s.updateAnimationHandler).Methods(http.MethodPatch, http.MethodOptions)
+	protected.HandleFunc("/animation/{id}", s.deleteAnimationHandler).Methods(http.MethodDelete)
+	protected.HandleFunc("/animation/{id}/refine", s.refineAnimationHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/animation/{id}/export", s.exportAnimationHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/animation/{id}/versions", s.listAnimationVersionsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/animation/{id}/versions/{version:[0-9]+}", s.getAnimationVersionHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/animation/{id}/versions/{version:[0-9]+}/restore", s.restoreAnimationVersionHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/animation/{id}/comments", s.createCommentHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/animation/{id}/comments/{commentId:[0-9]+}", s.deleteCommentHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/my-animations", s.getMyAnimationsHandler).Methods(http.MethodGet, http.MethodOptions)
+	protected.HandleFunc("/quota", s.getQuotaHandler).Methods(http.MethodGet, http.MethodOptions)
+	protected.HandleFunc("/save-mood", s.saveMoodHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/moods", s.listMoodsHandler).Methods(http.MethodGet, http.MethodOptions)
+	protected.HandleFunc("/profile", s.updateProfileHandler).Methods(http.MethodPatch, http.MethodOptions)
+	protected.HandleFunc("/me/preferences/content", s.getContentPreferencesHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/preferences/content", s.updateContentPreferencesHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/me/preferences/notifications", s.getNotificationPreferencesHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/preferences/notifications", s.updateNotificationPreferencesHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/me/reminders", s.getRemindersHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/reminders", s.updateRemindersHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/announcements/{id:[0-9]+}/dismiss", s.dismissAnnouncementHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/takedown-requests/{id}/appeal", s.appealTakedownHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/professionals", s.listMyProfessionalsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/professionals/accept", s.acceptClientInviteHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/professionals/{linkId:[0-9]+}", s.endClientLinkByClientHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/me/professionals/{linkId:[0-9]+}/consent", s.setMoodTrendConsentHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/me/professionals/{linkId:[0-9]+}/audit", s.clientLinkAuditHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/reports/monthly.pdf", s.monthlyReportHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/calendar-feed", s.createCalendarFeedHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/calendar-feed", s.deleteCalendarFeedHandler).Methods(http.MethodDelete)
+	protected.HandleFunc("/me/integration-keys", s.listIntegrationKeysHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/integration-keys", s.createIntegrationKeyHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/integration-keys/{id:[0-9]+}", s.deleteIntegrationKeyHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/subscriptions", s.listSubscriptionsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/subscriptions", s.createSubscriptionHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/subscriptions/{id:[0-9]+}", s.deleteSubscriptionHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/me/impersonations", s.listMyImpersonationsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/impersonations/{id:[0-9]+}", s.endMyImpersonationHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/me/impersonations/{id:[0-9]+}/approve", s.decideImpersonationHandler(true)).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/impersonations/{id:[0-9]+}/deny", s.decideImpersonationHandler(false)).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/impersonations/{id:[0-9]+}/audit", s.myImpersonationAuditHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/oauth/authorize", s.oauthConsentHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/oauth/authorize", s.oauthAuthorizeHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/oauth-apps", s.listOAuthAppsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/oauth-apps", s.createOAuthAppHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/oauth-apps/{clientId}", s.deleteOAuthAppHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/me/oauth-grants", s.listOAuthGrantsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/oauth-grants/{clientId}", s.revokeOAuthGrantHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/me/sessions", s.listMySessionsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/prompt-presets", s.listPromptPresetsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/prompt-presets", s.createPromptPresetHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/prompt-presets/{id:[0-9]+}", s.updatePromptPresetHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/me/prompt-presets/{id:[0-9]+}", s.deletePromptPresetHandler).Methods(http.MethodDelete)
+	protected.HandleFunc("/me/collections", s.listCollectionsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/me/collections", s.createCollectionHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/me/collections/{id:[0-9]+}", s.updateCollectionHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/me/collections/{id:[0-9]+}", s.deleteCollectionHandler).Methods(http.MethodDelete)
+	// Professionals may generate with their own API key
+	protected.Handle("/me/provider-key", s.ProfessionalMiddleware(http.HandlerFunc(s.getProviderKeyHandler))).Methods(http.MethodGet)
+	protected.Handle("/me/provider-key", s.ProfessionalMiddleware(http.HandlerFunc(s.setProviderKeyHandler))).Methods(http.MethodPut, http.MethodOptions)
+	protected.Handle("/me/provider-key", s.ProfessionalMiddleware(http.HandlerFunc(s.deleteProviderKeyHandler))).Methods(http.MethodDelete)
+	protected.HandleFunc("/me/organization", s.getMyOrganizationHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/signage/schedules", s.listSignageSchedulesHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/signage/schedules", s.createSignageScheduleHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/signage/schedules/{id}", s.getSignageScheduleHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/signage/schedules/{id}", s.updateSignageScheduleHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/signage/schedules/{id}", s.deleteSignageScheduleHandler).Methods(http.MethodDelete)
+	protected.HandleFunc("/orgs", s.createOrganizationHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/orgs/{id:[0-9]+}", s.getOrganizationHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/orgs/{id:[0-9]+}", s.deleteOrganizationHandler).Methods(http.MethodDelete, http.MethodOptions)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/members", s.addOrganizationMemberHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/members/{userId}", s.updateOrganizationMemberHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/members/{userId}", s.removeOrganizationMemberHandler).Methods(http.MethodDelete)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/usage", s.organizationUsageHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/review", s.setOrganizationReviewHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/reviews", s.listOrganizationReviewsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/orgs/{id:[0-9]+}/reviews/{animationId}", s.decideAnimationReviewHandler).Methods(http.MethodPut, http.MethodOptions)
+	protected.HandleFunc("/me/reviews", s.listMyReviewsHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/integrations/{platform:slack|discord}", s.saveTeamIntegrationHandler).Methods(http.MethodPost, http.MethodOptions)
+	protected.HandleFunc("/integrations/{platform:slack|discord}", s.teamIntegrationReportHandler).Methods(http.MethodGet)
+	protected.HandleFunc("/integrations/{platform:slack|discord}", s.deleteTeamIntegrationHandler).Methods(http.MethodDelete)
+
+	// Professional routes
+	professional := protected.PathPrefix("/professional").Subrouter()
+	professional.Use(s.ProfessionalMiddleware)
+	professional.HandleFunc("/invites", s.inviteClientHandler).Methods(http.MethodPost, http.MethodOptions)
+	professional.HandleFunc("/clients", s.listClientsHandler).Methods(http.MethodGet)
+	professional.HandleFunc("/clients/{linkId:[0-9]+}", s.endClientLinkByProfessionalHandler).Methods(http.MethodDelete, http.MethodOptions)
+	professional.HandleFunc("/clients/{linkId:[0-9]+}/sessions", s.assignSessionHandler).Methods(http.MethodPost, http.MethodOptions)
+	professional.HandleFunc("/clients/{linkId:[0-9]+}/sessions", s.listLinkSessionsHandler).Methods(http.MethodGet)
+	professional.HandleFunc("/clients/{linkId:[0-9]+}/mood-trends", s.clientMoodTrendsHandler).Methods(http.MethodGet)
+	professional.HandleFunc("/clients/{linkId:[0-9]+}/reports/monthly.pdf", s.clientMonthlyReportHandler).Methods(http.MethodGet)
+
+	// Admin routes
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminMiddleware)
+	admin.HandleFunc("/animations/{id}/determinism-check", s.determinismCheckHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/animations/{id}/audit", s.moderationAuditHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/animations/{id}/views", s.playbackStatsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/determinism-checks", s.determinismBatchHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/p5-versions", s.registerP5LibraryHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/users/{id}/account-type", s.setAccountTypeHandler).Methods(http.MethodPut, http.MethodOptions)
+	admin.HandleFunc("/users/{id}/impersonations", s.createImpersonationHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/impersonations", s.listImpersonationsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/impersonations/{id:[0-9]+}", s.endImpersonationHandler).Methods(http.MethodDelete, http.MethodOptions)
+	admin.HandleFunc("/impersonations/{id:[0-9]+}/token", s.startImpersonationHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/impersonations/{id:[0-9]+}/audit", s.impersonationAuditHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/orgs/{id:[0-9]+}/credits", s.setOrganizationCreditsHandler).Methods(http.MethodPut, http.MethodOptions)
+	admin.HandleFunc("/costs", s.generationCostsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/costs/users/{id}", s.userGenerationCostsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/kiosk-tokens", s.listKioskTokensHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/kiosk-tokens", s.createKioskTokenHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/kiosk-tokens/{id:[0-9]+}", s.updateKioskTokenHandler).Methods(http.MethodPut, http.MethodOptions)
+	admin.HandleFunc("/kiosk-tokens/{id:[0-9]+}", s.revokeKioskTokenHandler).Methods(http.MethodDelete)
+	admin.HandleFunc("/announcements", s.listAnnouncementsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/announcements", s.createAnnouncementHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/announcements/{id:[0-9]+}", s.updateAnnouncementHandler).Methods(http.MethodPut, http.MethodOptions)
+	admin.HandleFunc("/announcements/{id:[0-9]+}", s.deleteAnnouncementHandler).Methods(http.MethodDelete)
+	admin.HandleFunc("/mood-rules", s.listMoodRulesHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/mood-rules", s.createMoodRuleHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/mood-rules/{id:[0-9]+}", s.updateMoodRuleHandler).Methods(http.MethodPut, http.MethodOptions)
+	admin.HandleFunc("/mood-rules/{id:[0-9]+}", s.deleteMoodRuleHandler).Methods(http.MethodDelete)
+	admin.HandleFunc("/takedown-requests", s.listTakedownsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/takedown-requests/{id}", s.getTakedownHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/takedown-requests/{id}/transition", s.transitionTakedownHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/prompt-playground", s.promptPlaygroundHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/slo", sloHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/deprecations", s.deprecationsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/incidents", s.createIncidentHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/incidents/{id:[0-9]+}/updates", s.addIncidentUpdateHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/contract-runs", s.getContractRunsHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/resanitize", s.startResanitizeHandler).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/resanitize/{runId}", s.getResanitizeRunHandler).Methods(http.MethodGet, http.MethodOptions)
+	admin.HandleFunc("/resanitize/{runId}/approve", s.reviewResanitizeFixesHandler(true)).Methods(http.MethodPost, http.MethodOptions)
+	admin.HandleFunc("/resanitize/{runId}/reject", s.reviewResanitizeFixesHandler(false)).Methods(http.MethodPost, http.MethodOptions)
 
-	return r
 }
 
-func registerHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Parse the request body
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		LogResponse("/register", "Invalid request format", err)
-		EncodeError(w, "Invalid request format", http.StatusBadRequest)
-		return
-	}
-
-	// Validate request
-	if req.Email == "" || req.Password == "" || req.Username == "" {
-		LogResponse("/register", "Username, email and password are required", nil)
-		EncodeError(w, "Username, email and password are required", http.StatusBadRequest)
+	if !decodeRequest(w, r, "/register", &req) {
 		return
 	}
 
 	// Check if user already exists
-	if UserExists(req.Email) {
+	if s.store.UserExists(r.Context(), req.Email) {
 		LogResponse("/register", "User already exists", nil)
-		EncodeError(w, "User already exists", http.StatusConflict)
+		EncodeErrorCode(w, ErrCodeUserExists, "User already exists", http.StatusConflict)
 		return
 	}
 
@@ -70,15 +374,16 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create the user in the database
-	userId, err := CreateUserWithUsername(req.Email, req.Username, string(hashedPassword))
+	userId, err := s.store.CreateUserWithUsername(r.Context(), req.Email, req.Username, string(hashedPassword))
 	if err != nil {
 		LogResponse("/register", "Error creating user", err)
 		EncodeError(w, "Error creating user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(userId)
+	// Generate JWT token. The account belongs to the tenant it was registered for.
+	tenant := TenantFromContext(r.Context())
+	token, err := generateJWT(userId, tenant)
 	if err != nil {
 		LogResponse("/register", "Error generating token", err)
 		EncodeError(w, "Error generating token", http.StatusInternalServerError)
@@ -94,34 +399,27 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 			ID:       userId,
 			Email:    req.Email,
 			Username: req.Username,
+			Tenant:   tenant,
 		},
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Parse the request body
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		LogResponse("/login", "Invalid request format", err)
-		EncodeError(w, "Invalid request format", http.StatusBadRequest)
-		return
-	}
-
-	// Validate request
-	if req.Email == "" || req.Password == "" {
-		LogResponse("/login", "Email and password are required", nil)
-		EncodeError(w, "Email and password are required", http.StatusBadRequest)
+	if !decodeRequest(w, r, "/login", &req) {
 		return
 	}
 
-	// Get user from database
-	userId, storedHash, err := GetUserCredentials(req.Email)
+	// Get user from database, in whichever region holds the account
+	ctx := s.accountContext(r.Context(), req.Email)
+	userId, storedHash, err := s.store.GetUserCredentials(ctx, req.Email)
 	if err != nil {
 		LogResponse("/login", "Invalid credentials", nil)
-		EncodeError(w, "Invalid credentials", http.StatusUnauthorized)
+		EncodeErrorCode(w, ErrCodeInvalidCredentials, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
@@ -129,26 +427,31 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	err = bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(req.Password))
 	if err != nil {
 		LogResponse("/login", "Invalid credentials", nil)
-		EncodeError(w, "Invalid credentials", http.StatusUnauthorized)
+		EncodeErrorCode(w, ErrCodeInvalidCredentials, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(userId)
-	if err != nil {
-		LogResponse("/login", "Error generating token", err)
-		EncodeError(w, "Error generating token", http.StatusInternalServerError)
+	// Get user details
+	user, err := s.accountDetails(ctx, userId)
+	if errors.Is(err, errTenantMismatch) {
+		LogResponse("/login", "Invalid credentials", err)
+		EncodeErrorCode(w, ErrCodeInvalidCredentials, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
-
-	// Get user details
-	user, err := GetUserDetails(userId)
 	if err != nil {
 		LogResponse("/login", "Error retrieving user details", err)
 		EncodeError(w, "Error retrieving user details", http.StatusInternalServerError)
 		return
 	}
 
+	// Generate JWT token
+	token, err := generateJWT(userId, user.Tenant)
+	if err != nil {
+		LogResponse("/login", "Error generating token", err)
+		EncodeError(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
 	LogResponse("/login", "User logged in successfully", nil)
 
 	// Return the JWT token and user information
@@ -159,231 +462,6036 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// generateJWT creates a new JWT token for the given user ID
-func generateJWT(userId string) (string, error) {
-	secretKey, err := JWTSecret()
-	if err != nil {
-		return "", err
+func (s *Server) magicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the request body
+	var req MagicLinkRequest
+	if !decodeRequest(w, r, "/login/magic-link", &req) {
+		return
 	}
 
-	// Create a new token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": userId,
-		"exp":    time.Now().Add(time.Hour * 24 * 7).Unix(), // Token expires in 7 days
-	})
+	req.Email = strings.TrimSpace(req.Email)
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString(secretKey)
+	// Respond the same way, and at once, whether or not the account exists so emails cannot be
+	// enumerated by the response or by how long it took
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(MagicLinkResponse{Success: true})
+
+	s.loginLinks.Add(1)
+	go func() {
+		defer s.loginLinks.Done()
+		s.sendMagicLink(context.WithoutCancel(r.Context()), req.Email)
+	}()
+}
+
+// sendMagicLink emails a single-use login link to the account with email, if there is one
+func (s *Server) sendMagicLink(ctx context.Context, email string) {
+	ctx = s.accountContext(ctx, email)
+	userId, err := s.store.GetUserIDByEmail(ctx, email)
 	if err != nil {
-		return "", err
+		LogResponse("/login/magic-link", "No login link sent for "+email, err)
+		return
 	}
 
-	return tokenString, nil
+	// Store only the hash of the single-use token
+	token, err := generateRandomID()
+	if err != nil {
+		LogResponse("/login/magic-link", "Error generating login token", err)
+		return
+	}
+	ttl := MagicLinkTTL()
+	if err := s.store.SaveMagicLinkToken(ctx, userId, HashToken(token), time.Now().Add(ttl)); err != nil {
+		LogResponse("/login/magic-link", "Error saving login token", err)
+		return
+	}
+
+	loginURL := PublicURL("/login/magic?token=" + url.QueryEscape(token))
+	body := "Open the link below to sign in to Animate. It expires in " + ttl.String() + " and can only be used once.\n\n" +
+		loginURL + "\n\n" +
+		"If you didn't request this, you can ignore this email.\n"
+	if err := s.mailer.Send(email, "Your Animate login link", body); err != nil {
+		LogResponse("/login/magic-link", "Error sending login link", err)
+		return
+	}
+
+	LogResponse("/login/magic-link", "Login link sent to "+email, nil)
 }
 
-func animationHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) magicLoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Parse the request body
-	var req AnimationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		LogResponse("/generate-animation", "Invalid request format", err)
-		EncodeError(w, "Invalid request format", http.StatusBadRequest)
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		LogResponse("/login/magic", "Login token is required", nil)
+		EncodeError(w, "Login token is required", http.StatusBadRequest)
 		return
 	}
 
-	// Validate request
-	if req.Description == "" {
-		LogResponse("/generate-animation", "Description cannot be empty", nil)
-		EncodeError(w, "Description cannot be empty", http.StatusBadRequest)
+	// Exchange the single-use token for the user it was issued to
+	ctx, userId, err := s.consumeMagicLinkToken(r.Context(), HashToken(token))
+	if err != nil {
+		if err.Error() == "login link is invalid or expired" {
+			LogResponse("/login/magic", "Invalid or expired login link", nil)
+			EncodeErrorCode(w, ErrCodeInvalidToken, "Login link is invalid or expired", http.StatusUnauthorized)
+			return
+		}
+		LogResponse("/login/magic", "Error consuming login link", err)
+		EncodeError(w, "Error consuming login link", http.StatusInternalServerError)
 		return
 	}
 
-	LogRequest("/generate-animation", "Description: "+req.Description)
-
-	// Get Claude API key from environment variable
-	claudeAPIKey := GetAPIKey("CLAUDE_API_KEY")
-	if claudeAPIKey == "" {
-		LogResponse("/generate-animation", "Claude API key not configured", nil)
-		EncodeError(w, "Claude API key not configured", http.StatusInternalServerError)
+	// Get user details
+	user, err := s.accountDetails(ctx, userId)
+	if errors.Is(err, errTenantMismatch) {
+		LogResponse("/login/magic", "Invalid or expired login link", err)
+		EncodeErrorCode(w, ErrCodeInvalidToken, "Login link is invalid or expired", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		LogResponse("/login/magic", "Error retrieving user details", err)
+		EncodeError(w, "Error retrieving user details", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate animation with Claude
-	animation, err := GenerateAnimationWithClaude(req.Description, claudeAPIKey)
+	// Generate JWT token
+	jwtToken, err := generateJWT(userId, user.Tenant)
 	if err != nil {
-		LogResponse("/generate-animation", "Error generating animation", err)
-		EncodeError(w, "Error generating animation: "+err.Error(), http.StatusInternalServerError)
+		LogResponse("/login/magic", "Error generating token", err)
+		EncodeError(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	// Sanitize the animation code by removing markdown fences
-	animation = SanitizeAnimationCode(animation)
+	LogResponse("/login/magic", "User logged in with magic link", nil)
 
-	// Preprocess the p5.js code for better compatibility
-	processedAnimation := PreprocessP5Code(animation)
+	// Return the JWT token and user information
+	response := LoginResponse{
+		Token: jwtToken,
+		User:  user,
+	}
+	json.NewEncoder(w).Encode(response)
+}
 
-	// Analyze the code to provide metadata
-	metadata := AnalyzeP5Code(processedAnimation)
+// errTenantMismatch is returned when a request signs in to an account of another tenant than the
+// one it names
+var errTenantMismatch = errors.New("account belongs to another tenant")
 
-	LogResponse("/generate-animation", "Animation generated and processed successfully", nil)
+// accountContext returns ctx routed to the region holding the account with email. Requests naming
+// a tenant only look in its region; others look in every region, so clients need not know which
+// region an account is in to sign in to it.
+func (s *Server) accountContext(ctx context.Context, email string) context.Context {
+	if TenantFromContext(ctx) != "" {
+		return ctx
+	}
+	for _, region := range DataRegions() {
+		if regionCtx := WithDataRegion(ctx, region); s.store.UserExists(regionCtx, email) {
+			return regionCtx
+		}
+	}
+	return ctx
+}
 
-	// Return the processed animation code with metadata
-	response := AnimationResponse{
-		Code:     processedAnimation,
-		Metadata: metadata,
+// consumeMagicLinkToken exchanges a login link's token for the user it was issued to, returning
+// ctx routed to the region it was found in. Links do not name a tenant, so unless the request does,
+// every region is tried.
+func (s *Server) consumeMagicLinkToken(ctx context.Context, tokenHash string) (context.Context, string, error) {
+	regions := []context.Context{ctx}
+	if TenantFromContext(ctx) == "" {
+		regions = regions[:0]
+		for _, region := range DataRegions() {
+			regions = append(regions, WithDataRegion(ctx, region))
+		}
 	}
-	json.NewEncoder(w).Encode(response)
+	var err error
+	for _, regionCtx := range regions {
+		var userId string
+		if userId, err = s.store.ConsumeMagicLinkToken(regionCtx, tokenHash); err == nil || err.Error() != "login link is invalid or expired" {
+			return regionCtx, userId, err
+		}
+	}
+	return ctx, "", err
 }
 
-func saveAnimationHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// accountDetails returns the details of the user signing in, refusing accounts of another tenant
+// than the one the request names. Accounts from before tenants were recorded take the tenant they
+// are first signed in to, which can only be one in their region.
+func (s *Server) accountDetails(ctx context.Context, userId string) (User, error) {
+	user, err := s.store.GetUserDetails(ctx, userId)
+	if err != nil {
+		return user, err
+	}
+	tenant := TenantFromContext(ctx)
+	if tenant == "" || user.Tenant == tenant {
+		return user, nil
+	}
+	if user.Tenant != "" {
+		return user, errTenantMismatch
+	}
+	if err := s.store.SetUserTenant(ctx, userId, tenant); err != nil {
+		return user, err
+	}
+	user.Tenant = tenant
+	return user, nil
+}
 
-	// Parse the request body
-	var req SaveAnimationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		LogResponse("/save-animation", "Invalid request format", err)
-		EncodeError(w, "Invalid request format", http.StatusBadRequest)
-		return
+// generateJWT creates a new JWT token for the given user ID, naming the tenant their account
+// belongs to, if any, so that their requests are served from its region
+func generateJWT(userId, tenant string) (string, error) {
+	secretKey, err := JWTSecret()
+	if err != nil {
+		return "", err
 	}
 
-	LogRequest("/save-animation", "Received animation code to save")
+	// Create a new token with claims. The issue time keeps milliseconds, so a token issued just
+	// after the user was signed out everywhere is not refused with the ones before.
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"userId": userId,
+		"iat":    float64(now.UnixMilli()) / 1000,
+		"exp":    now.Add(JWTLifetime()).Unix(),
+	}
+	if tenant != "" {
+		claims["tenant"] = tenant
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	// Save the animation to the database
-	id, err := SaveAnimation(req.Code, req.Description)
+	// Sign the token with the secret key
+	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
-		LogResponse("/save-animation", "Error saving animation", err)
-		EncodeError(w, "Error saving animation: "+err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
-	LogResponse("/save-animation", "Animation saved with ID: "+id, nil)
-
-	// Return the animation ID
-	response := SaveAnimationResponse{ID: id}
-	json.NewEncoder(w).Encode(response)
+	return tokenString, nil
 }
 
-func getAnimationHandler(w http.ResponseWriter, r *http.Request) {
+// animationHandler queues a generation and answers 202 with the job, which GET /jobs/{id} reports on
+// until a worker has run it. Problems found before it is queued are answered straight away.
+func (s *Server) animationHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get animation ID from URL params
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	LogRequest("/animation/{id}", "Retrieving animation ID: "+id)
-
-	// First check if the animation exists
-	if !AnimationExists(id) {
-		LogResponse("/animation/{id}", "Animation not found with ID: "+id, nil)
-		EncodeError(w, "Animation not found", http.StatusNotFound)
+	job, ok := s.beginGeneration(w, r, "/generate-animation")
+	if !ok {
 		return
 	}
 
-	// Retrieve the animation from the database
-	code, description, err := GetAnimation(id)
-	if err != nil {
-		LogResponse("/animation/{id}", "Error retrieving animation ID: "+id, err)
-		// Always keep the Content-Type as application/json for consistent error handling
-		EncodeError(w, "Error retrieving animation: "+err.Error(), http.StatusInternalServerError)
+	queued := job.queued()
+	queued.Correlation, _ = GetCorrelationFromContext(r.Context())
+	if err := s.store.EnqueueGenerationJob(r.Context(), queued); err != nil {
+		s.settleGeneration(r.Context(), "/generate-animation", job, false)
+		LogResponse("/generate-animation", "Error queueing generation job", err)
+		job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Error starting generation"})
+		EncodeError(w, "Error starting generation", http.StatusInternalServerError)
 		return
 	}
+	s.wakeGenerationWorker()
+	LogResponse("/generate-animation", "Queued generation job "+job.id, nil)
 
-	LogResponse("/animation/{id}", "Animation retrieved successfully", nil)
-
-	// Return the animation code
-	response := GetAnimationResponse{
-		ID:          id,
-		Code:        code,
-		Description: description,
-	}
-	json.NewEncoder(w).Encode(response)
+	now := time.Now().UTC()
+	w.Header().Set("Location", "/jobs/"+job.id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(GenerationJob{ID: job.id, Status: GenerationQueued, CreatedAt: now, UpdatedAt: now})
 }
 
-func getFeedHandler(w http.ResponseWriter, r *http.Request) {
+// getGenerationJobHandler reports on one of the caller's queued generations. Clients are asked to
+// wait a little before polling again until it is done or failed.
+func (s *Server) getGenerationJobHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	LogRequest("/feed", "Retrieving random animation")
-
-	// Retrieve a random animation from the database
-	animation, err := GetRandomAnimation()
+	userId, _ := GetUserIDFromContext(r.Context())
+	id := mux.Vars(r)["id"]
+	job, err := s.store.GetGenerationJob(r.Context(), id, userId)
 	if err != nil {
-		// Check if the error is because no animations exist
-		if err.Error() == "no animations found" {
-			LogResponse("/feed", "No animations found in database", nil)
-			w.WriteHeader(http.StatusNoContent)
+		if err.Error() == "generation job not found" {
+			LogResponse("/jobs/{id}", "Generation job not found: "+id, nil)
+			EncodeError(w, "Generation job not found", http.StatusNotFound)
 			return
 		}
-
-		LogResponse("/feed", "Error retrieving random animation", err)
-		EncodeError(w, "Error retrieving random animation: "+err.Error(), http.StatusInternalServerError)
+		LogResponse("/jobs/{id}", "Error retrieving generation job", err)
+		EncodeError(w, "Error retrieving generation job", http.StatusInternalServerError)
 		return
 	}
-
-	LogResponse("/feed", "Random animation retrieved successfully: "+animation.ID, nil)
-
-	// Return the random animation
-	json.NewEncoder(w).Encode(animation)
+	if job.Status == GenerationQueued || job.Status == GenerationGenerating {
+		w.Header().Set("Retry-After", strconv.Itoa(int(generationJobRetryAfter.Seconds())))
+	}
+	json.NewEncoder(w).Encode(job)
 }
 
-func saveMoodHandler(w http.ResponseWriter, r *http.Request) {
+// streamAnimationHandler generates an animation like animationHandler but answers with server-sent
+// events: progress as each stage starts, chunk for each piece of code Claude writes, and finally
+// done with the processed code and metadata, or error. Problems found before generation starts are
+// answered with a plain JSON error.
+func (s *Server) streamAnimationHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Parse the request body
-	var req SaveMoodRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		LogResponse("/save-mood", "Invalid request format", err)
-		EncodeError(w, "Invalid request format", http.StatusBadRequest)
+	job, ok := s.beginGeneration(w, r, "/generate-animation/stream")
+	if !ok {
 		return
 	}
 
-	// Validate request
-	if req.AnimationID == "" {
-		LogResponse("/save-mood", "Animation ID cannot be empty", nil)
-		EncodeError(w, "Animation ID cannot be empty", http.StatusBadRequest)
+	stream, ok := newEventStream(w)
+	if !ok {
+		s.settleGeneration(r.Context(), "/generate-animation/stream", job, false)
+		LogResponse("/generate-animation/stream", "Response writer cannot stream", nil)
+		job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Streaming is not supported"})
+		EncodeError(w, "Streaming is not supported", http.StatusInternalServerError)
 		return
 	}
 
-	// Validate mood
-	validMood := false
-	for _, mood := range []Mood{MoodMuchWorse, MoodWorse, MoodSame, MoodBetter, MoodMuchBetter} {
-		if req.Mood == mood {
-			validMood = true
-			break
+	ctx, meter := withTokenMeter(r.Context())
+	succeeded := false
+	defer func() { s.recordGeneration(ctx, "/generate-animation/stream", job, meter, succeeded) }()
+
+	stream.send("progress", GenerationProgress{Stage: StageGenerating})
+	job.publish(GenerationUpdate{Status: GenerationGenerating})
+	animation, err := job.key.stream(ctx, job.description, job.style, func(text string) error {
+		return stream.send("chunk", GenerationChunk{Text: text})
+	})
+	s.settleGeneration(r.Context(), "/generate-animation/stream", job, err == nil)
+	if err != nil {
+		if r.Context().Err() != nil {
+			LogResponse("/generate-animation/stream", "Client went away during generation", err)
+			job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Generation canceled"})
+			return
 		}
-	}
-	if !validMood {
-		LogResponse("/save-mood", "Invalid mood value", nil)
-		EncodeError(w, "Invalid mood value", http.StatusBadRequest)
+		LogResponse("/generate-animation/stream", "Error generating animation", err)
+		job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Error generating animation"})
+		stream.send("error", AnimationResponse{Error: "Error generating animation: " + err.Error()})
 		return
 	}
 
-	// Check if animation exists
-	if !AnimationExists(req.AnimationID) {
-		LogResponse("/save-mood", "Animation not found with ID: "+req.AnimationID, nil)
-		EncodeError(w, "Animation not found", http.StatusNotFound)
-		return
+	stream.send("progress", GenerationProgress{Stage: StageProcessing})
+	response := finishGeneration(ctx, job, animation, "/generate-animation/stream")
+	succeeded = true
+	LogResponse("/generate-animation/stream", "Animation generated and processed successfully", nil)
+	stream.send("done", response)
+}
+
+// beginGeneration validates a generation request and picks the key it is made with: the caller's
+// own key when they are a professional who stored one, otherwise the house key, reserving the
+// generation against their workspace's credits or their quota. It answers the request itself and returns false when generation
+// cannot go ahead; otherwise the job is announced as queued and its ID returned in
+// GenerationJobHeader.
+func (s *Server) beginGeneration(w http.ResponseWriter, r *http.Request, endpoint string) (generationJob, bool) {
+	// Parse the request body
+	var req AnimationRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return generationJob{}, false
 	}
 
 	// Get user ID from context
 	userId, ok := GetUserIDFromContext(r.Context())
 	if !ok {
-		LogResponse("/save-mood", "User ID missing from context", nil)
+		LogResponse(endpoint, "User ID missing from context", nil)
 		EncodeError(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return generationJob{}, false
 	}
 
-	// Save the mood to the database
-	err := SaveMood(userId, req.AnimationID, string(req.Mood))
+	// A prompt preset stands in for the description
+	if req.PresetID != 0 {
+		preset, err := s.store.GetPromptPreset(r.Context(), req.PresetID, userId)
+		if err != nil {
+			if err.Error() == "prompt preset not found" {
+				LogResponse(endpoint, "Prompt preset not found: "+strconv.Itoa(req.PresetID), nil)
+				EncodeError(w, "Prompt preset not found", http.StatusNotFound)
+				return generationJob{}, false
+			}
+			LogResponse(endpoint, "Error retrieving prompt preset", err)
+			EncodeError(w, "Error retrieving prompt preset", http.StatusInternalServerError)
+			return generationJob{}, false
+		}
+		if req.Description, err = preset.Apply(req.Variables); err != nil {
+			LogResponse(endpoint, "Invalid prompt preset variables", err)
+			EncodeError(w, err.Error(), http.StatusBadRequest)
+			return generationJob{}, false
+		}
+	}
+
+	// Validate request
+	if req.Description == "" {
+		LogResponse(endpoint, "Description cannot be empty", nil)
+		EncodeError(w, "Description cannot be empty", http.StatusBadRequest)
+		return generationJob{}, false
+	}
+
+	style, err := ValidatePromptStyle(req.Style)
 	if err != nil {
-		LogResponse("/save-mood", "Error saving mood", err)
-		EncodeError(w, "Error saving mood: "+err.Error(), http.StatusInternalServerError)
-		return
+		LogResponse(endpoint, "Invalid style", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return generationJob{}, false
 	}
 
-	LogResponse("/save-mood", "Mood saved successfully", nil)
+	LogRequestFor(r.Context(), endpoint, "Description: "+RedactDescriptionFor(r.Context(), req.Description))
 
-	// Return success response
-	response := SaveMoodResponse{Success: true}
-	json.NewEncoder(w).Encode(response)
+	jobId, err := generateRandomID()
+	if err != nil {
+		LogResponse(endpoint, "Error generating job ID", err)
+		EncodeError(w, "Error starting generation", http.StatusInternalServerError)
+		return generationJob{}, false
+	}
+	return s.pickGenerationKey(w, r, endpoint, generationJob{id: jobId, userId: userId, description: req.Description, style: style})
+}
+
+// pickGenerationKey picks the key a job is made with, as beginGeneration describes, and queues it.
+// It answers the request itself and returns false when generation cannot go ahead.
+func (s *Server) pickGenerationKey(w http.ResponseWriter, r *http.Request, endpoint string, job generationJob) (generationJob, bool) {
+	userId := job.userId
+
+	// Generations with the user's own key are paid for by them and bypass the quota
+	key, own, err := s.ownGenerationKey(r.Context(), userId)
+	if err != nil {
+		LogResponse(endpoint, "Error retrieving provider key for user "+userId, err)
+		EncodeError(w, "Error retrieving your provider key", http.StatusInternalServerError)
+		return generationJob{}, false
+	}
+	if own {
+		LogRequest(endpoint, "Generating with the "+key.Provider+" key of user "+userId)
+		job.key = key
+		return queueGeneration(w, job), true
+	}
+
+	// Get Claude API key from environment variable
+	claudeAPIKey := GetAPIKey("CLAUDE_API_KEY")
+	if claudeAPIKey == "" {
+		LogResponse(endpoint, "Claude API key not configured", nil)
+		EncodeError(w, "Claude API key not configured", http.StatusInternalServerError)
+		return generationJob{}, false
+	}
+
+	var ok bool
+	if job.organizationId, ok = s.reserveGeneration(w, r, endpoint, userId); !ok {
+		return generationJob{}, false
+	}
+	job.key = GenerationKey{Provider: ProviderAnthropic, APIKey: claudeAPIKey}
+	return queueGeneration(w, job), true
+}
+
+// reserveGeneration counts a generation with the house key as reserveHouseGeneration does. It
+// answers the request itself and returns false when the generation cannot go ahead.
+func (s *Server) reserveGeneration(w http.ResponseWriter, r *http.Request, endpoint, userId string) (int, bool) {
+	orgId, quota, err := s.reserveHouseGeneration(r.Context(), userId)
+	if err != nil {
+		switch err.Error() {
+		case "organization credits exhausted":
+			quota.SetHeaders(w)
+			LogResponse(endpoint, "Credits of organization "+strconv.Itoa(orgId)+" exhausted", nil)
+			EncodeErrorCode(w, ErrCodeCreditsExhausted, "Workspace credits exhausted for this month", http.StatusTooManyRequests)
+		case "organization member limit reached":
+			quota.SetHeaders(w)
+			LogResponse(endpoint, "Organization member limit reached for user "+userId, nil)
+			EncodeErrorCode(w, ErrCodeMemberLimitReached, "Your monthly limit in this workspace is reached", http.StatusTooManyRequests)
+		case "generation quota exceeded":
+			quota.SetHeaders(w)
+			LogResponse(endpoint, "Generation quota exceeded for user "+userId, nil)
+			EncodeErrorCode(w, ErrCodeQuotaExceeded, "Generation quota exceeded", http.StatusTooManyRequests)
+		default:
+			LogResponse(endpoint, "Error checking generation quota for user "+userId, err)
+			EncodeError(w, "Error checking generation quota", http.StatusInternalServerError)
+		}
+		return 0, false
+	}
+	quota.SetHeaders(w)
+	return orgId, true
+}
+
+// reserveHouseGeneration counts a generation with the house key against the credits of the user's
+// workspace, when it has any, and otherwise against their own quota. It returns the ID of the
+// workspace paying for it, or 0, and what is left of the credits or quota.
+func (s *Server) reserveHouseGeneration(ctx context.Context, userId string) (int, GenerationQuota, error) {
+	org, err := s.store.GetUserOrganization(ctx, userId)
+	if err != nil && err.Error() != "organization not found" {
+		return 0, GenerationQuota{}, err
+	}
+	if err == nil && org.MonthlyCredits > 0 {
+		quota, err := s.store.ReserveOrganizationGeneration(ctx, org.ID, userId)
+		return org.ID, quota, err
+	}
+
+	// Count this generation against the user's quota
+	dailyLimit, monthlyLimit := GenerationLimits()
+	quota, err := s.store.ReserveGeneration(ctx, userId, dailyLimit, monthlyLimit)
+	return 0, quota, err
+}
+
+// queueGeneration announces an accepted job and tells the client its ID
+func queueGeneration(w http.ResponseWriter, job generationJob) generationJob {
+	w.Header().Set(GenerationJobHeader, job.id)
+	job.publish(GenerationUpdate{Status: GenerationQueued})
+	return job
+}
+
+// settleGeneration accounts for a generation once the provider has answered: failed generations
+// with the house key do not count against the quota or workspace credits, and successful ones with the user's own key
+// are logged against it. It still settles after the client went away.
+func (s *Server) settleGeneration(ctx context.Context, endpoint string, job generationJob, succeeded bool) {
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case job.key.Own && succeeded:
+		if err := s.store.RecordProviderKeyGeneration(ctx, job.userId, job.key.Provider); err != nil {
+			LogResponse(endpoint, "Error recording provider key usage", err)
+		}
+	case !job.key.Own && !succeeded && job.organizationId != 0:
+		if err := s.store.ReleaseOrganizationGeneration(ctx, job.organizationId, job.userId); err != nil {
+			LogResponse(endpoint, "Error releasing organization credits", err)
+		}
+	case !job.key.Own && !succeeded:
+		if err := s.store.ReleaseGeneration(ctx, job.userId); err != nil {
+			LogResponse(endpoint, "Error releasing generation quota", err)
+		}
+	}
+}
+
+// finishGeneration turns Claude's raw reply into the code and metadata returned to the client,
+// announcing the job as done with the code
+func finishGeneration(ctx context.Context, job generationJob, animation string, endpoint string) AnimationResponse {
+	job.publish(GenerationUpdate{Status: GenerationSanitizing})
+
+	// Sanitize the animation code by removing markdown fences
+	animation = SanitizeAnimationCode(animation)
+
+	// Preprocess the p5.js code for better compatibility
+	processedAnimation := PreprocessP5Code(animation)
+
+	// Run the sketch briefly and feed any runtime error back to Claude for repair
+	var smokeTest *SmokeTestResult
+	if renderer, ok := GetSketchRenderer(); ok && SmokeTestEnabled() && FeatureEnabled(FeatureSmokeTests) {
+		repair := func(code, errorMessage string) (string, error) {
+			fixed, err := job.key.fix(ctx, code, errorMessage)
+			if err != nil {
+				return "", err
+			}
+			return PreprocessP5Code(SanitizeAnimationCode(fixed)), nil
+		}
+
+		tested, result, err := SmokeTestWithRepairs(ctx, renderer, processedAnimation, SmokeTestMaxRepairs(), repair)
+		if err != nil {
+			LogResponse(endpoint, "Smoke test could not complete", err)
+		} else {
+			processedAnimation = tested
+			smokeTest = &result
+		}
+	}
+
+	// Analyze the code to provide metadata
+	metadata := AnalyzeP5Code(processedAnimation)
+	if smokeTest != nil {
+		metadata["smokeTest"] = smokeTest
+	}
+	metadata["performance"] = EstimateSketchCost(processedAnimation, CurrentSketchBudget())
+	job.publish(GenerationUpdate{Status: GenerationDone, Code: processedAnimation})
+
+	// Return the processed animation code with metadata
+	return AnimationResponse{
+		Code:     processedAnimation,
+		Metadata: metadata,
+	}
+}
+
+func (s *Server) getQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get user ID from context
+	userId, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		LogResponse("/quota", "User ID missing from context", nil)
+		EncodeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Members of a workspace with credits see their share of them
+	org, err := s.store.GetUserOrganization(r.Context(), userId)
+	if err != nil && err.Error() != "organization not found" {
+		LogResponse("/quota", "Error retrieving organization", err)
+		EncodeError(w, "Error retrieving generation quota", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && org.MonthlyCredits > 0 {
+		month, _ := parseUsageMonth("", time.Now())
+		usage, err := s.store.GetOrganizationUsage(r.Context(), org.ID, month)
+		if err != nil {
+			LogResponse("/quota", "Error retrieving organization usage", err)
+			EncodeError(w, "Error retrieving generation quota", http.StatusInternalServerError)
+			return
+		}
+		for _, member := range usage.Members {
+			if member.UserID == userId {
+				quota := organizationQuota(usage.MonthlyCredits, usage.Used, member.MonthlyLimit, member.Used)
+				quota.SetHeaders(w)
+				json.NewEncoder(w).Encode(quota)
+				return
+			}
+		}
+	}
+
+	dailyLimit, monthlyLimit := GenerationLimits()
+	quota, err := s.store.GetGenerationQuota(r.Context(), userId, dailyLimit, monthlyLimit)
+	if err != nil {
+		LogResponse("/quota", "Error retrieving generation quota", err)
+		EncodeError(w, "Error retrieving generation quota", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/quota", "Generation quota retrieved successfully", nil)
+
+	quota.SetHeaders(w)
+	json.NewEncoder(w).Encode(quota)
+}
+
+func (s *Server) saveAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the request body
+	var req SaveAnimationRequest
+	if !decodeRequest(w, r, "/save-animation", &req) {
+		return
+	}
+
+	LogRequest("/save-animation", "Received animation code to save")
+	req.Description = s.scrubberFor(r).Scrub(r.Context(), req.Description)
+
+	// Keep sketches that would stutter on low-end devices out of the feed
+	if estimate := checkSketchBudget(r.Context(), req.Code); !estimate.WithinBudget() {
+		LogResponse("/save-animation", "Sketch exceeds performance budget: "+strings.Join(estimate.Violations, "; "), nil)
+		EncodeError(w, "Sketch exceeds performance budget: "+strings.Join(estimate.Violations, "; "), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Pin the p5.js build the sketch was written against so later library upgrades cannot break it
+	p5Version, err := s.resolveP5Version(r.Context(), req.P5Version)
+	if err != nil {
+		if err.Error() == "p5.js version not found" {
+			LogResponse("/save-animation", "Unknown p5.js version: "+req.P5Version, nil)
+			EncodeError(w, "Unknown p5.js version "+req.P5Version, http.StatusBadRequest)
+			return
+		}
+		LogResponse("/save-animation", "Error resolving p5.js version", err)
+		EncodeError(w, "Error saving animation", http.StatusInternalServerError)
+		return
+	}
+
+	// Save the animation to the database, remembering who uploaded it
+	userId, _ := GetUserIDFromContext(r.Context())
+	id, err := s.store.SaveAnimation(r.Context(), req.Code, req.Description, userId, p5Version)
+	if err != nil {
+		LogResponse("/save-animation", "Error saving animation", err)
+		EncodeError(w, "Error saving animation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reviewStatus := s.afterSaveAnimation(r.Context(), "/save-animation", id, userId, req.Code, req.Description)
+	LogResponse("/save-animation", "Animation saved with ID: "+id, nil)
+
+	// Return the animation ID
+	json.NewEncoder(w).Encode(SaveAnimationResponse{ID: id, ReviewStatus: reviewStatus})
+}
+
+// afterSaveAnimation records a newly saved animation's p5.js compatibility, embeds its
+// description, renders its thumbnail, screens it for flashing and, when the uploader's workspace
+// reviews their work, asks the owner to review it; otherwise it tells subscribers the animation was
+// published. It returns the animation's review status, empty when it is not held.
+func (s *Server) afterSaveAnimation(ctx context.Context, endpoint, id, userId, code, description string) string {
+	s.recordP5Compatibility(ctx, id, code)
+	if s.embedder != nil && FeatureEnabled(FeatureAnalytics) {
+		embedDescription(ctx, s.store, s.embedder, id, description)
+	}
+	s.renderThumbnailInBackground(id, code)
+	s.screenPhotosensitivityInBackground(ctx, id, code)
+
+	// Workspaces that review their members' work hold the animation until the owner approves it
+	review, err := s.store.GetAnimationReview(ctx, id)
+	if err != nil {
+		if err.Error() != "animation review not found" {
+			LogResponse(endpoint, "Error checking the review of animation "+id, err)
+			return ""
+		}
+		s.events.publishAnimation(AnimationPublished{AnimationID: id, CreatorID: userId})
+		return ""
+	}
+	if org, err := s.store.GetOrganization(ctx, review.OrganizationID); err == nil {
+		sendReviewNotices(ctx, s.store, org, review)
+	}
+	return review.Status
+}
+
+// checkSketchBudget estimates the per-frame cost of code and, when SKETCH_BUDGET_DYNAMIC is
+// enabled and a renderer is configured, adds measured frame time and heap usage
+func checkSketchBudget(ctx context.Context, code string) SketchCostEstimate {
+	budget := CurrentSketchBudget()
+	estimate := EstimateSketchCost(code, budget)
+
+	if dynamic, _ := envBool("SKETCH_BUDGET_DYNAMIC"); dynamic {
+		if renderer, ok := GetSketchRenderer(); ok {
+			result, err := MeasureSketch(ctx, renderer, code)
+			if err != nil {
+				LogResponse("/save-animation", "Could not measure sketch", err)
+			} else {
+				estimate.ApplyRenderMetrics(result, budget)
+			}
+		}
+	}
+	return estimate
+}
+
+func (s *Server) getAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Get animation ID from URL params
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	LogRequest("/animation/{id}", "Retrieving animation ID: "+id)
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "global" && mode != "instance" {
+		EncodeError(w, "mode must be global or instance", http.StatusBadRequest)
+		return
+	}
+
+	// First check if the animation exists
+	if !s.store.AnimationExists(r.Context(), id) {
+		LogResponse("/animation/{id}", "Animation not found with ID: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+
+	// Retrieve the animation from the database
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		if err.Error() == "animation removed" {
+			LogResponse("/animation/{id}", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+			return
+		}
+		LogResponse("/animation/{id}", "Error retrieving animation ID: "+id, err)
+		// Always keep the Content-Type as application/json for consistent error handling
+		EncodeError(w, "Error retrieving animation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/animation/{id}", "Animation retrieved successfully", nil)
+
+	// Pages playing several sketches at once ask for them in instance mode, ready for new p5()
+	if mode == "instance" {
+		if animation.Code, err = ToInstanceMode(animation.Code); err != nil {
+			LogResponse("/animation/{id}", "Error converting animation ID "+id+" to instance mode", err)
+			EncodeError(w, "Animation code could not be converted to instance mode", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	// Return the animation code, from v2 on with the p5.js build it is pinned to, its mood summary
+	// and a playback session
+	version := GetAPIVersionFromContext(r.Context())
+	animation.Description = s.scrubberFor(r).Mask(animation.Description)
+	animations := []GetAnimationResponse{animation}
+	if version != APIVersionV1 {
+		s.attachMoodSummaries(r.Context(), animations)
+		s.attachPlaybackSessions(r, "/animation/{id}", animations)
+	}
+	json.NewEncoder(w).Encode(renderAnimation(version, animations[0]))
+}
+
+// recordViewHandler records a view reported by a player. Only a session's first report counts as
+// a view, and reports that come in sooner than anyone could have watched are kept out of the count.
+func (s *Server) recordViewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var req RecordViewRequest
+	if !decodeRequest(w, r, "/animation/{id}/views", &req) {
+		return
+	}
+	if req.WatchedSeconds < 0 || req.WatchedSeconds > maxWatchedSeconds {
+		LogResponse("/animation/{id}/views", "Invalid watched time", nil)
+		EncodeError(w, "watchedSeconds must be between 0 and "+strconv.Itoa(maxWatchedSeconds), http.StatusBadRequest)
+		return
+	}
+	if req.AverageFPS < 0 || req.AverageFPS > maxReportedFPS {
+		LogResponse("/animation/{id}/views", "Invalid frame rate", nil)
+		EncodeError(w, "averageFps must be between 0 and "+strconv.Itoa(maxReportedFPS), http.StatusBadRequest)
+		return
+	}
+	session, ok := s.checkPlaybackSession(w, r, "/animation/{id}/views", req.PlaybackSession, id)
+	if !ok {
+		return
+	}
+
+	view := PlaybackView{At: time.Now().UTC(), WatchedSeconds: req.WatchedSeconds, AverageFPS: req.AverageFPS}
+	view.Suspect = view.At.Sub(session.CreatedAt) < minPlaybackViewDelay
+	first, err := s.store.RecordPlaybackView(r.Context(), session, view)
+	if err != nil {
+		LogResponse("/animation/{id}/views", "Error recording view of animation ID: "+id, err)
+		EncodeError(w, "Error recording view", http.StatusInternalServerError)
+		return
+	}
+
+	// Suspect views are answered like any other, so scripts learn nothing from the response
+	switch {
+	case !first:
+		playbackDuplicateViews.Add(1)
+	case view.Suspect:
+		playbackSuspectViews.Add(1)
+		LogResponse("/animation/{id}/views", "Suspect view of animation "+id+" from "+session.ViewerKey, nil)
+	default:
+		playbackViews.Add(1)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// playbackStatsHandler counts an animation's playbacks, by default over the last 30 days
+func (s *Server) playbackStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	from, to, ok := parseTimeRange(w, r, "/admin/animations/{id}/views")
+	if !ok {
+		return
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultPlaybackStatsWindow)
+	}
+	if !s.store.AnimationExists(r.Context(), id) {
+		LogResponse("/admin/animations/{id}/views", "Animation not found with ID: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := s.store.GetPlaybackStats(r.Context(), id, from, to)
+	if err != nil {
+		LogResponse("/admin/animations/{id}/views", "Error counting views of animation ID: "+id, err)
+		EncodeError(w, "Error retrieving views", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(stats)
+}
+
+// resolveP5Version returns the registered p5.js version an animation should be pinned to: the
+// requested one, or the default. An unregistered default leaves the animation unpinned.
+func (s *Server) resolveP5Version(ctx context.Context, requested string) (string, error) {
+	if requested != "" {
+		library, err := s.store.GetP5Library(ctx, requested)
+		return library.Version, err
+	}
+
+	version, err := defaultP5Version(ctx, s.store)
+	if err != nil || version == "" {
+		return "", err
+	}
+	if _, err := s.store.GetP5Library(ctx, version); err != nil {
+		if err.Error() == "p5.js version not found" {
+			log.Printf("[P5] Default p5.js version %s is not registered, saving unpinned", version)
+			return "", nil
+		}
+		return "", err
+	}
+	return version, nil
+}
+
+func (s *Server) listP5LibrariesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	libraries, err := s.store.ListP5Libraries(r.Context())
+	if err != nil {
+		LogResponse("/p5-versions", "Error listing p5.js versions", err)
+		EncodeError(w, "Error listing p5.js versions", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(libraries)
+}
+
+func (s *Server) registerP5LibraryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req RegisterP5LibraryRequest
+	if !decodeRequest(w, r, "/admin/p5-versions", &req) {
+		return
+	}
+	if err := ValidateP5LibraryRequest(req); err != nil {
+		LogResponse("/admin/p5-versions", "Invalid p5.js version", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	LogRequest("/admin/p5-versions", "Registering p5.js "+req.Version+" from "+req.URL)
+
+	// Hash exactly what the URL serves now; browsers refuse the script if it ever changes
+	library, err := FetchP5Library(r.Context(), req.Version, req.URL)
+	if err != nil {
+		LogResponse("/admin/p5-versions", "Error downloading p5.js", err)
+		EncodeError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if err := s.store.SaveP5Library(r.Context(), library); err != nil {
+		if err.Error() == "p5.js version already registered" {
+			LogResponse("/admin/p5-versions", "p5.js "+req.Version+" already registered", nil)
+			EncodeError(w, "p5.js "+req.Version+" is already registered", http.StatusConflict)
+			return
+		}
+		LogResponse("/admin/p5-versions", "Error saving p5.js version", err)
+		EncodeError(w, "Error saving p5.js version", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/p5-versions", "Registered p5.js "+library.Version+" with "+library.Integrity, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(library)
+}
+
+// maxChangeNoteLength is the longest "what changed" note accepted with an edit, as the validate
+// tag of UpdateAnimationRequest.ChangeNote says
+const maxChangeNoteLength = 280
+
+func (s *Server) updateAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+
+	var req UpdateAnimationRequest
+	if !decodeRequest(w, r, "/animation/{id}", &req) {
+		return
+	}
+
+	if req.Code == nil && req.Description == nil {
+		LogResponse("/animation/{id}", "Nothing to update", nil)
+		EncodeError(w, "Provide code and/or description to update", http.StatusBadRequest)
+		return
+	}
+	req.ChangeNote = strings.TrimSpace(req.ChangeNote)
+
+	LogRequest("/animation/{id}", "Updating animation ID: "+id)
+	if req.Description != nil {
+		description := s.scrubberFor(r).Scrub(r.Context(), *req.Description)
+		req.Description = &description
+	}
+
+	// Edited sketches must fit the same budget as newly saved ones
+	if req.Code != nil {
+		if estimate := checkSketchBudget(r.Context(), *req.Code); !estimate.WithinBudget() {
+			LogResponse("/animation/{id}", "Sketch exceeds performance budget: "+strings.Join(estimate.Violations, "; "), nil)
+			EncodeError(w, "Sketch exceeds performance budget: "+strings.Join(estimate.Violations, "; "), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	if err := s.store.UpdateAnimation(r.Context(), id, userId, req); err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "not the animation owner":
+			LogResponse("/animation/{id}", "User "+userId+" does not own animation "+id, nil)
+			EncodeErrorCode(w, ErrCodeNotOwner, "Only the owner can update this animation", http.StatusForbidden)
+		case "animation removed":
+			LogResponse("/animation/{id}", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}", "Error updating animation ID: "+id, err)
+			EncodeError(w, "Error updating animation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if req.Code != nil {
+		s.recordP5Compatibility(r.Context(), id, *req.Code)
+		s.renderThumbnailInBackground(id, *req.Code)
+		s.screenPhotosensitivityInBackground(r.Context(), id, *req.Code)
+	}
+	if req.Description != nil && s.embedder != nil && FeatureEnabled(FeatureAnalytics) {
+		embedDescription(r.Context(), s.store, s.embedder, id, *req.Description)
+	}
+
+	LogResponse("/animation/{id}", "Animation updated: "+id, nil)
+	json.NewEncoder(w).Encode(SaveAnimationResponse{ID: id})
+}
+
+// refineAnimationHandler sends the owner's follow-up instruction for a saved animation to Claude,
+// or the provider of their own key, along with the conversation so far, and answers with the
+// updated code. The code is not saved; the owner keeps it with PATCH /animation/{id}. Refinements
+// count against the quota like generations.
+func (s *Server) refineAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	var req RefineRequest
+	if !decodeRequest(w, r, "/animation/{id}/refine", &req) {
+		return
+	}
+	instruction, err := ValidateRefineInstruction(req.Instruction)
+	if err != nil {
+		LogResponse("/animation/{id}/refine", "Invalid instruction", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	turns, err := s.store.ListRefinementTurns(r.Context(), id, userId, 2*maxRefinementExchanges)
+	var animation GetAnimationResponse
+	if err == nil {
+		animation, err = s.store.GetAnimation(r.Context(), id)
+	}
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/refine", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "not the animation owner":
+			LogResponse("/animation/{id}/refine", "User "+userId+" does not own animation "+id, nil)
+			EncodeErrorCode(w, ErrCodeNotOwner, "Only the owner can refine this animation", http.StatusForbidden)
+		case "animation removed":
+			LogResponse("/animation/{id}/refine", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/refine", "Error retrieving animation ID: "+id, err)
+			EncodeError(w, "Error retrieving animation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	LogRequestFor(r.Context(), "/animation/{id}/refine", "Refining animation "+id+": "+RedactDescriptionFor(r.Context(), instruction))
+	jobId, err := generateRandomID()
+	if err != nil {
+		LogResponse("/animation/{id}/refine", "Error generating job ID", err)
+		EncodeError(w, "Error starting generation", http.StatusInternalServerError)
+		return
+	}
+	job, ok := s.pickGenerationKey(w, r, "/animation/{id}/refine", generationJob{id: jobId, userId: userId, description: instruction})
+	if !ok {
+		return
+	}
+
+	ctx, meter := withTokenMeter(r.Context())
+	succeeded := false
+	defer func() { s.recordGeneration(ctx, "/animation/{id}/refine", job, meter, succeeded) }()
+
+	added, messages := refinementConversation(turns, animation, instruction)
+	job.publish(GenerationUpdate{Status: GenerationGenerating})
+	reply, err := job.key.refine(ctx, messages)
+	s.settleGeneration(r.Context(), "/animation/{id}/refine", job, err == nil)
+	if err != nil {
+		if r.Context().Err() != nil {
+			LogResponse("/animation/{id}/refine", "Client went away during refinement", err)
+			job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Generation canceled"})
+			return
+		}
+		LogResponse("/animation/{id}/refine", "Error refining animation", err)
+		job.publish(GenerationUpdate{Status: GenerationFailed, Error: "Error refining animation"})
+		if errors.Is(err, context.DeadlineExceeded) {
+			EncodeErrorCode(w, ErrCodeGenerationTimeout, "Refinement timed out waiting for the provider", http.StatusGatewayTimeout)
+			return
+		}
+		if errors.Is(err, ErrClaudeBusy) {
+			w.Header().Set("Retry-After", strconv.Itoa(loadShedRetryAfterSeconds))
+			EncodeErrorCode(w, ErrCodeGenerationBusy, "Too many generations are running; try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		EncodeError(w, "Error refining animation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := finishGeneration(ctx, job, reply, "/animation/{id}/refine")
+	succeeded = true
+
+	// The code is returned even when the conversation cannot be kept, since it was paid for
+	added = append(added, RefinementTurn{Role: "assistant", Content: response.Code})
+	if err := s.store.AddRefinementTurns(context.WithoutCancel(r.Context()), id, added); err != nil {
+		LogResponse("/animation/{id}/refine", "Error saving refinement of animation "+id, err)
+	}
+
+	LogResponse("/animation/{id}/refine", "Animation refined: "+id, nil)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) deleteAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	LogRequest("/animation/{id}", "Deleting animation ID: "+id)
+
+	// Admins may delete any animation, owners only their own
+	if err := s.store.DeleteAnimation(r.Context(), id, userId, IsAdmin(userId)); err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "not the animation owner":
+			LogResponse("/animation/{id}", "User "+userId+" does not own animation "+id, nil)
+			EncodeErrorCode(w, ErrCodeNotOwner, "Only the owner can delete this animation", http.StatusForbidden)
+		default:
+			LogResponse("/animation/{id}", "Error deleting animation ID: "+id, err)
+			EncodeError(w, "Error deleting animation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	LogResponse("/animation/{id}", "Animation deleted: "+id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// encodeVersionError answers a failed version history lookup or restore
+func encodeVersionError(w http.ResponseWriter, endpoint, id, userId string, err error) {
+	switch err.Error() {
+	case "animation not found":
+		LogResponse(endpoint, "Animation not found with ID: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+	case "version not found":
+		LogResponse(endpoint, "Version not found for animation "+id, nil)
+		EncodeError(w, "Version not found", http.StatusNotFound)
+	case "not the animation owner":
+		LogResponse(endpoint, "User "+userId+" does not own animation "+id, nil)
+		EncodeErrorCode(w, ErrCodeNotOwner, "Only the owner can see and restore versions of this animation", http.StatusForbidden)
+	case "animation removed":
+		LogResponse(endpoint, "Animation removed after takedown: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+	default:
+		LogResponse(endpoint, "Error with versions of animation ID: "+id, err)
+		EncodeError(w, "Error retrieving versions", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) listAnimationVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	versions, err := s.store.ListAnimationVersions(r.Context(), id, userId)
+	if err != nil {
+		encodeVersionError(w, "/animation/{id}/versions", id, userId, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(versions)
+}
+
+func (s *Server) getAnimationVersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+	// The route only matches digits
+	number, _ := strconv.Atoi(vars["version"])
+
+	version, err := s.store.GetAnimationVersion(r.Context(), id, number, userId)
+	if err != nil {
+		encodeVersionError(w, "/animation/{id}/versions/{version}", id, userId, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(version)
+}
+
+func (s *Server) restoreAnimationVersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+	number, _ := strconv.Atoi(vars["version"])
+
+	LogRequest("/animation/{id}/versions/{version}/restore", "Restoring animation "+id+" to version "+vars["version"])
+
+	restored, err := s.store.RestoreAnimationVersion(r.Context(), id, number, userId)
+	if err != nil {
+		encodeVersionError(w, "/animation/{id}/versions/{version}/restore", id, userId, err)
+		return
+	}
+	s.recordP5Compatibility(r.Context(), id, restored.Code)
+
+	LogResponse("/animation/{id}/versions/{version}/restore", "Animation "+id+" restored as version "+strconv.Itoa(restored.Version), nil)
+	json.NewEncoder(w).Encode(restored)
+}
+
+func (s *Server) getAnimationChangelogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+
+	entries, err := s.store.GetAnimationChangelog(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/changelog", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}/changelog", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/changelog", "Error retrieving changelog for animation ID: "+id, err)
+			EncodeError(w, "Error retrieving changelog", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *Server) getAnimationMoodsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+
+	if !s.store.AnimationExists(r.Context(), id) {
+		LogResponse("/animation/{id}/moods", "Animation not found with ID: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+	if _, err := s.store.GetAnimation(r.Context(), id); err != nil {
+		if err.Error() == "animation removed" {
+			LogResponse("/animation/{id}/moods", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+			return
+		}
+		LogResponse("/animation/{id}/moods", "Error retrieving animation ID: "+id, err)
+		EncodeError(w, "Error retrieving moods", http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := s.store.GetMoodCounts(r.Context(), []string{id})
+	if err != nil {
+		LogResponse("/animation/{id}/moods", "Error counting moods for animation ID: "+id, err)
+		EncodeError(w, "Error retrieving moods", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(SummarizeMoods(counts[id], DatasetMinGroupSize()))
+}
+
+func (s *Server) getP5CompatibilityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+
+	matrix, err := s.store.GetP5Compatibility(r.Context(), id)
+	if err == nil && len(matrix) == 0 {
+		// Animations saved before the checker existed, or whose code was just migrated, are checked on first lookup
+		var animation GetAnimationResponse
+		if animation, err = s.store.GetAnimation(r.Context(), id); err == nil {
+			matrix = s.recordP5Compatibility(r.Context(), id, animation.Code)
+		}
+	}
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/compatibility", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}/compatibility", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/compatibility", "Error retrieving compatibility for animation ID: "+id, err)
+			EncodeError(w, "Error retrieving compatibility", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(matrix)
+}
+
+func (s *Server) getPreviewFramesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+
+	count := defaultPreviewFrameCount
+	if raw := r.URL.Query().Get("count"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxPreviewFrameCount {
+			LogResponse("/animation/{id}/frames", "Invalid frame count", err)
+			EncodeError(w, "Count must be between 1 and "+strconv.Itoa(maxPreviewFrameCount), http.StatusBadRequest)
+			return
+		}
+		count = parsed
+	}
+
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/frames", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}/frames", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/frames", "Error retrieving animation ID: "+id, err)
+			EncodeError(w, "Error retrieving preview frames", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	renderer, ok := GetSketchRenderer()
+	if !ok {
+		LogResponse("/animation/{id}/frames", "Sketch renderer not configured", nil)
+		EncodeError(w, "Sketch renderer not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	frames, err := s.previewFrames(r.Context(), renderer, animation.Code, count)
+	if err != nil {
+		if errors.Is(err, errSketchCrashed) {
+			LogResponse("/animation/{id}/frames", "Animation crashed while rendering preview: "+id, err)
+			EncodeErrorCode(w, ErrCodeAnimationNotRenderable, "Animation could not be rendered", http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, errFeatureOff) {
+			LogResponse("/animation/{id}/frames", "Thumbnails switched off; not rendering preview frames for animation ID: "+id, nil)
+			encodeFeatureOff(w)
+			return
+		}
+		LogResponse("/animation/{id}/frames", "Error rendering preview frames for animation ID: "+id, err)
+		EncodeError(w, "Error retrieving preview frames", http.StatusInternalServerError)
+		return
+	}
+
+	response := PreviewFramesResponse{AnimationID: id, Frames: frames}
+	for i := range response.Frames {
+		response.Frames[i].Image = previewFrameImage(response.Frames[i].PNG)
+	}
+
+	LogResponse("/animation/{id}/frames", "Returned "+strconv.Itoa(len(frames))+" preview frames for animation ID: "+id, nil)
+	json.NewEncoder(w).Encode(response)
+}
+
+// getThumbnailHandler serves an animation's thumbnail as a PNG for feed previews. Thumbnails are
+// rendered after each save, or on the first request when that has not finished; the ETag follows
+// the code, so an edit is picked up as soon as caches revalidate.
+func (s *Server) getThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/thumbnail", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}/thumbnail", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/thumbnail", "Error retrieving animation ID: "+id, err)
+			EncodeError(w, "Error retrieving thumbnail", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	etag := `"` + CodeHash(animation.Code) + `"`
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(thumbnailMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	png, err := s.thumbnail(r.Context(), animation.Code)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		switch {
+		case errors.Is(err, errThumbnailNotRendered):
+			LogResponse("/animation/{id}/thumbnail", "Sketch renderer not configured", nil)
+			EncodeError(w, "Sketch renderer not configured", http.StatusServiceUnavailable)
+		case errors.Is(err, errFeatureOff):
+			LogResponse("/animation/{id}/thumbnail", "Thumbnails switched off; not rendering thumbnail for animation ID: "+id, nil)
+			encodeFeatureOff(w)
+		case errors.Is(err, errSketchCrashed):
+			LogResponse("/animation/{id}/thumbnail", "Animation crashed while rendering thumbnail: "+id, err)
+			EncodeErrorCode(w, ErrCodeAnimationNotRenderable, "Animation could not be rendered", http.StatusUnprocessableEntity)
+		default:
+			LogResponse("/animation/{id}/thumbnail", "Error rendering thumbnail for animation ID: "+id, err)
+			EncodeError(w, "Error retrieving thumbnail", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	LogResponse("/animation/{id}/thumbnail", "Returned thumbnail for animation ID: "+id, nil)
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// getEmbedHandler serves an animation as a standalone HTML page with its p5.js build, so blogs can
+// put it in an iframe without a frontend
+func (s *Server) getEmbedHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/embed", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}/embed", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/embed", "Error retrieving animation ID: "+id, err)
+			EncodeError(w, "Error retrieving animation", http.StatusInternalServerError)
+		}
+		return
+	}
+	animation = withDefaultP5Library(r.Context(), s.store, animation)
+
+	etag := `"` + CodeHash(animation.P5URL+"\n"+animation.Code) + `"`
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(embedMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	LogResponse("/animation/{id}/embed", "Returned embed page for animation ID: "+id, nil)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", embedContentSecurityPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.WriteString(w, embedPage(animation))
+}
+
+// getAnimationScriptHandler serves an animation's code as JavaScript, so pages that load p5.js
+// themselves can include it with a script tag
+func (s *Server) getAnimationScriptHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}.js", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}.js", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}.js", "Error retrieving animation ID: "+id, err)
+			EncodeError(w, "Error retrieving animation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	etag := `"` + CodeHash(animation.Code) + `"`
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(embedMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	LogResponse("/animation/{id}.js", "Returned script for animation ID: "+id, nil)
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.WriteString(w, animation.Code)
+}
+
+// exportAnimationHandler renders an animation into a GIF or MP4 and returns where to download it.
+// Exports of the same code with the same settings are reused until they expire.
+func (s *Server) exportAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var req ExportRequest
+	if !decodeRequest(w, r, "/animation/{id}/export", &req) {
+		return
+	}
+	req, err := validateExportRequest(req)
+	if err != nil {
+		LogResponse("/animation/{id}/export", "Invalid export request", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		switch err.Error() {
+		case "animation not found":
+			LogResponse("/animation/{id}/export", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		case "animation removed":
+			LogResponse("/animation/{id}/export", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+		default:
+			LogResponse("/animation/{id}/export", "Error retrieving animation ID: "+id, err)
+			EncodeError(w, "Error retrieving animation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	codeHash := CodeHash(animation.Code)
+	export, err := s.store.FindAnimationExport(r.Context(), id, codeHash, req.Format, req.Frames, req.FPS)
+	if err == nil {
+		export.URL = exportURL(export.ID)
+		LogResponse("/animation/{id}/export", "Reused export "+export.ID+" of animation ID: "+id, nil)
+		json.NewEncoder(w).Encode(export)
+		return
+	}
+	if err.Error() != "export not found" {
+		LogResponse("/animation/{id}/export", "Error looking up exports of animation ID: "+id, err)
+		EncodeError(w, "Error exporting animation", http.StatusInternalServerError)
+		return
+	}
+
+	renderer, ok := GetSketchRenderer()
+	if !ok {
+		LogResponse("/animation/{id}/export", "Sketch renderer not configured", nil)
+		EncodeError(w, "Sketch renderer not configured", http.StatusServiceUnavailable)
+		return
+	}
+	data, err := exportAnimation(r.Context(), renderer, animation.Code, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errExportFormatUnavailable):
+			LogResponse("/animation/{id}/export", "No encoder configured for "+req.Format, nil)
+			EncodeError(w, "Exporting to "+req.Format+" is not configured", http.StatusServiceUnavailable)
+		case errors.Is(err, errSketchCrashed):
+			LogResponse("/animation/{id}/export", "Animation crashed while exporting: "+id, err)
+			EncodeErrorCode(w, ErrCodeAnimationNotRenderable, "Animation could not be rendered", http.StatusUnprocessableEntity)
+		default:
+			LogResponse("/animation/{id}/export", "Error exporting animation ID: "+id, err)
+			EncodeError(w, "Error exporting animation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	exportId, err := generateRandomID()
+	if err != nil {
+		LogResponse("/animation/{id}/export", "Error generating export ID", err)
+		EncodeError(w, "Error exporting animation", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	export = AnimationExport{
+		ID:          exportId,
+		AnimationID: id,
+		CodeHash:    codeHash,
+		Format:      req.Format,
+		Frames:      req.Frames,
+		FPS:         req.FPS,
+		SizeBytes:   len(data),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ExportRetention()),
+	}
+	if err := s.store.SaveAnimationExport(r.Context(), export, data); err != nil {
+		LogResponse("/animation/{id}/export", "Error saving export of animation ID: "+id, err)
+		EncodeError(w, "Error exporting animation", http.StatusInternalServerError)
+		return
+	}
+	export.URL = exportURL(exportId)
+
+	LogResponse("/animation/{id}/export", "Exported animation ID "+id+" as "+req.Format+" ("+strconv.Itoa(len(data))+" bytes)", nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(export)
+}
+
+// downloadExportHandler serves an exported file as an attachment. Export IDs are unguessable, so
+// links can be shared with people who are not signed in.
+func (s *Server) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	export, data, err := s.store.GetAnimationExport(r.Context(), id)
+	if err != nil {
+		if err.Error() == "export not found" {
+			LogResponse("/exports/{id}", "Export not found or expired: "+id, nil)
+			EncodeError(w, "Export not found or expired", http.StatusNotFound)
+			return
+		}
+		LogResponse("/exports/{id}", "Error retrieving export ID: "+id, err)
+		EncodeError(w, "Error retrieving export", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/exports/{id}", "Returned export ID: "+id, nil)
+	w.Header().Set("Content-Type", exportContentTypes[export.Format])
+	w.Header().Set("Content-Disposition", `attachment; filename="animation-`+export.AnimationID+"."+export.Format+`"`)
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(time.Until(export.ExpiresAt).Seconds())))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// recordP5Compatibility checks code against each major p5.js version and stores the result for the
+// animation. A failure to store is logged, and nothing is stored while analytics is switched off,
+// since the matrix can always be computed again.
+func (s *Server) recordP5Compatibility(ctx context.Context, id, code string) []P5Compatibility {
+	matrix := CheckP5Compatibility(code)
+	if !FeatureEnabled(FeatureAnalytics) {
+		return matrix
+	}
+	if err := s.store.SaveP5Compatibility(ctx, id, matrix); err != nil {
+		log.Printf("[P5] Failed to store compatibility of animation %s: %v", id, err)
+	}
+	return matrix
+}
+
+// Page sizes for paginated lists such as GET /feed?limit=&offset=
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePage reads the limit and offset query parameters, writing a 400 response and returning false when they are invalid
+func parsePage(w http.ResponseWriter, r *http.Request, endpoint string) (int, int, bool) {
+	limit, offset := defaultPageSize, 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			LogResponse(endpoint, "Invalid limit", err)
+			EncodeError(w, "Limit must be between 1 and "+strconv.Itoa(maxPageSize), http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = parsed
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			LogResponse(endpoint, "Invalid offset", err)
+			EncodeError(w, "Offset must be zero or more", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+	return limit, offset, true
+}
+
+// nextOffset returns the offset of the page after one of count items at offset, or nil on the last page
+func nextOffset(offset, count, total int) *int {
+	next := offset + count
+	if count == 0 || next >= total {
+		return nil
+	}
+	return &next
+}
+
+// feedFilter returns the feed filter for a request's reduced motion preference and, when the viewer
+// is signed in and personalization is on, their stored content preferences. It asks browsers to
+// send the reduced motion preference as a client hint.
+func (s *Server) feedFilter(w http.ResponseWriter, r *http.Request) FeedFilter {
+	w.Header().Set("Accept-CH", "Sec-CH-Prefers-Reduced-Motion")
+	w.Header().Add("Vary", "Sec-CH-Prefers-Reduced-Motion, Authorization")
+	filter := FeedFilter{ReducedMotion: prefersReducedMotion(r), MaxMotionScore: ReducedMotionMaxChange()}
+
+	if userId, ok := GetUserIDFromContext(r.Context()); ok && FeatureEnabled(FeaturePersonalization) {
+		preferences, err := s.store.GetContentPreferences(r.Context(), userId)
+		if err != nil {
+			// An unfiltered feed beats no feed; flashing animations stay out either way
+			LogResponse("/feed", "Error retrieving content preferences for user "+userId, err)
+			return filter
+		}
+		filter.ReducedMotion = filter.ReducedMotion || preferences.ReduceMotion
+		filter.AvoidFlashing = preferences.AvoidFlashing
+	}
+	return filter
+}
+
+func (s *Server) getFeedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	filter := s.feedFilter(w, r)
+
+	// Without paging parameters the feed keeps returning a single random animation
+	query := r.URL.Query()
+	if query.Has("limit") || query.Has("offset") {
+		s.getFeedPage(w, r, filter)
+		return
+	}
+
+	LogRequest("/feed", "Retrieving random animation")
+
+	// Retrieve a random animation from the database
+	animation, err := s.store.GetRandomAnimation(r.Context(), filter)
+	if err != nil {
+		// Check if the error is because no animations exist
+		if err.Error() == "no animations found" {
+			LogResponse("/feed", "No animations found in database", nil)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		fallback, ok := s.fallbackAnimation(filter)
+		if !ok {
+			LogResponse("/feed", "Error retrieving random animation with an empty fallback pool", err)
+			w.Header().Set("Retry-After", "5")
+			EncodeError(w, "The feed is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		LogResponse("/feed", "Error retrieving random animation, serving "+fallback.ID+" from the fallback pool", err)
+		feedFallbacks.Add(1)
+		w.Header().Set(FeedFallbackHeader, "true")
+		fallback.Description = s.scrubberFor(r).Mask(fallback.Description)
+		version := GetAPIVersionFromContext(r.Context())
+		animations := []GetAnimationResponse{fallback}
+		if version != APIVersionV1 {
+			s.attachPlaybackSessions(r, "/feed", animations)
+		}
+		json.NewEncoder(w).Encode(renderAnimation(version, animations[0]))
+		return
+	}
+
+	LogResponse("/feed", "Random animation retrieved successfully: "+animation.ID, nil)
+
+	// Return the random animation
+	version := GetAPIVersionFromContext(r.Context())
+	animation.Description = s.scrubberFor(r).Mask(animation.Description)
+	animations := []GetAnimationResponse{animation}
+	if version != APIVersionV1 {
+		s.attachMoodSummaries(r.Context(), animations)
+		s.attachPlaybackSessions(r, "/feed", animations)
+	}
+	json.NewEncoder(w).Encode(renderAnimation(version, animations[0]))
+}
+
+// getFeedPage returns the page of the feed selected by the limit and offset query parameters
+func (s *Server) getFeedPage(w http.ResponseWriter, r *http.Request, filter FeedFilter) {
+	limit, offset, ok := parsePage(w, r, "/feed")
+	if !ok {
+		return
+	}
+
+	LogRequest("/feed", "Retrieving feed page limit="+strconv.Itoa(limit)+" offset="+strconv.Itoa(offset))
+
+	animations, total, err := s.store.ListFeedAnimations(r.Context(), filter, limit, offset)
+	fromFallback := false
+	if err != nil {
+		// The pool keeps the newest animations, and their mood summaries from when it was built
+		animations, total, fromFallback = s.fallbackPage(filter, limit, offset)
+		if !fromFallback {
+			LogResponse("/feed", "Error retrieving feed page with an empty fallback pool", err)
+			w.Header().Set("Retry-After", "5")
+			EncodeError(w, "The feed is temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		LogResponse("/feed", "Error retrieving feed page, serving the fallback pool", err)
+		feedFallbacks.Add(1)
+		w.Header().Set(FeedFallbackHeader, "true")
+	}
+
+	scrubber := s.scrubberFor(r)
+	for i := range animations {
+		animations[i].Description = scrubber.Mask(animations[i].Description)
+	}
+	version := GetAPIVersionFromContext(r.Context())
+	if version != APIVersionV1 {
+		if !fromFallback {
+			s.attachMoodSummaries(r.Context(), animations)
+		}
+		s.attachPlaybackSessions(r, "/feed", animations)
+	}
+	response := GetAnimationFeedResponse{Animations: animations, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(animations), total)
+
+	LogResponse("/feed", "Feed page retrieved with "+strconv.Itoa(len(animations))+" of "+strconv.Itoa(total)+" animations", nil)
+	json.NewEncoder(w).Encode(renderAnimationFeed(version, response))
+}
+
+// getLatestDatasetHandler returns the most recently published anonymized research dataset
+func (s *Server) getLatestDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	LogRequest("/datasets/latest", "Retrieving the latest dataset")
+
+	dataset, err := s.store.GetLatestDataset(r.Context())
+	if err != nil {
+		if err.Error() == "dataset not found" {
+			LogResponse("/datasets/latest", "No dataset published yet", nil)
+			EncodeError(w, "No dataset has been published yet", http.StatusNotFound)
+			return
+		}
+		LogResponse("/datasets/latest", "Error retrieving the latest dataset", err)
+		EncodeError(w, "Error retrieving dataset", http.StatusInternalServerError)
+		return
+	}
+
+	// The dataset only changes when it is regenerated, so clients and proxies may keep it a while
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Last-Modified", dataset.GeneratedAt.UTC().Format(http.TimeFormat))
+	LogResponse("/datasets/latest", "Dataset generated at "+dataset.GeneratedAt.Format(time.RFC3339)+" retrieved", nil)
+	json.NewEncoder(w).Encode(dataset)
+}
+
+// maxSearchQueryLength bounds the q parameter of GET /search
+const maxSearchQueryLength = 200
+
+// parseSearchQuery reads the q query parameter, writing a 400 response and returning false when it is missing or too long
+func parseSearchQuery(w http.ResponseWriter, r *http.Request, endpoint string) (string, bool) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		LogResponse(endpoint, "Missing search query", nil)
+		EncodeError(w, "Search query q is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len(query) > maxSearchQueryLength {
+		LogResponse(endpoint, "Search query too long", nil)
+		EncodeError(w, "Search query must be at most "+strconv.Itoa(maxSearchQueryLength)+" characters", http.StatusBadRequest)
+		return "", false
+	}
+	return query, true
+}
+
+// searchAnimationsHandler returns a page of the animations whose description matches the q query
+// parameter, best match first. It applies the same filters as the feed, and external search
+// backends can narrow the results to a p5Version facet.
+func (s *Server) searchAnimationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query, ok := parseSearchQuery(w, r, "/search")
+	if !ok {
+		return
+	}
+	limit, offset, ok := parsePage(w, r, "/search")
+	if !ok {
+		return
+	}
+	filter := s.feedFilter(w, r)
+
+	LogRequest("/search", "Searching animations limit="+strconv.Itoa(limit)+" offset="+strconv.Itoa(offset))
+
+	results, err := s.searcher.Search(r.Context(), SearchRequest{
+		Query: query, Filter: filter, P5Version: r.URL.Query().Get("p5Version"), Limit: limit, Offset: offset,
+	})
+	if err != nil {
+		if errors.Is(err, errFacetsUnsupported) {
+			LogResponse("/search", "Facet filter requested without a search backend", nil)
+			EncodeError(w, "Filtering by p5Version requires an external search backend", http.StatusBadRequest)
+			return
+		}
+		LogResponse("/search", "Error searching animations", err)
+		EncodeError(w, "Error searching animations", http.StatusInternalServerError)
+		return
+	}
+
+	s.attachMoodSummaries(r.Context(), results.Animations)
+	response := SearchAnimationsResponse{
+		Query: query, Animations: results.Animations, Total: results.Total, Limit: limit, Offset: offset, Facets: results.Facets,
+	}
+	response.NextOffset = nextOffset(offset, len(results.Animations), results.Total)
+
+	LogResponse("/search", "Found "+strconv.Itoa(results.Total)+" animations", nil)
+	json.NewEncoder(w).Encode(response)
+}
+
+// semanticSearchHandler returns a page of the animations whose description is closest in meaning to
+// the q query parameter, most similar first. It applies the same filters as the feed.
+func (s *Server) semanticSearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.embedder == nil {
+		LogResponse("/search/semantic", "Semantic search is not configured", nil)
+		EncodeError(w, "Semantic search is not available", http.StatusServiceUnavailable)
+		return
+	}
+	query, ok := parseSearchQuery(w, r, "/search/semantic")
+	if !ok {
+		return
+	}
+	limit, offset, ok := parsePage(w, r, "/search/semantic")
+	if !ok {
+		return
+	}
+	filter := s.feedFilter(w, r)
+
+	LogRequest("/search/semantic", "Searching animations by meaning limit="+strconv.Itoa(limit)+" offset="+strconv.Itoa(offset))
+
+	ctx, cancel := context.WithTimeout(r.Context(), embeddingTimeout)
+	defer cancel()
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		LogResponse("/search/semantic", "Error embedding search query", err)
+		EncodeError(w, "Error searching animations", http.StatusBadGateway)
+		return
+	}
+	embeddings, err := s.store.ListAnimationEmbeddings(r.Context(), s.embedder.Model(), filter)
+	if err != nil {
+		LogResponse("/search/semantic", "Error listing embeddings", err)
+		EncodeError(w, "Error searching animations", http.StatusInternalServerError)
+		return
+	}
+	ranked := rankBySimilarity(vectors[0], embeddings, SemanticMinSimilarity())
+
+	var animations []GetAnimationResponse
+	var similarities []float64
+	for i := offset; i < len(ranked) && len(animations) < limit; i++ {
+		animation, err := s.store.GetAnimation(r.Context(), ranked[i].ID)
+		if err != nil {
+			// Deleted since its embedding was listed
+			LogResponse("/search/semantic", "Skipping animation "+ranked[i].ID, err)
+			continue
+		}
+		animations = append(animations, animation)
+		similarities = append(similarities, ranked[i].Similarity)
+	}
+	s.attachMoodSummaries(r.Context(), animations)
+	results := make([]SemanticSearchResult, len(animations))
+	for i, animation := range animations {
+		results[i] = SemanticSearchResult{GetAnimationResponse: animation, Similarity: similarities[i]}
+	}
+
+	response := SemanticSearchResponse{Query: query, Results: results, Total: len(ranked), Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(results), len(ranked))
+
+	LogResponse("/search/semantic", "Found "+strconv.Itoa(len(ranked))+" animations", nil)
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxCommentLength is the longest comment accepted, as the validate tag of CreateCommentRequest says
+const maxCommentLength = 2000
+
+func (s *Server) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	var req CreateCommentRequest
+	if !decodeRequest(w, r, "/animation/{id}/comments", &req) {
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+
+	LogRequest("/animation/{id}/comments", "User "+userId+" commenting on animation "+id)
+	req.Body = s.scrubberFor(r).Scrub(r.Context(), req.Body)
+
+	comment, err := s.store.CreateComment(r.Context(), id, userId, req.Body)
+	if err != nil {
+		if err.Error() == "animation not found" {
+			LogResponse("/animation/{id}/comments", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/animation/{id}/comments", "Error saving comment", err)
+		EncodeError(w, "Error saving comment", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/animation/{id}/comments", "Comment "+strconv.Itoa(comment.ID)+" added to animation "+id, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (s *Server) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	limit, offset, ok := parsePage(w, r, "/animation/{id}/comments")
+	if !ok {
+		return
+	}
+
+	comments, total, err := s.store.ListComments(r.Context(), id, limit, offset)
+	if err != nil {
+		if err.Error() == "animation not found" {
+			LogResponse("/animation/{id}/comments", "Animation not found with ID: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/animation/{id}/comments", "Error listing comments", err)
+		EncodeError(w, "Error retrieving comments", http.StatusInternalServerError)
+		return
+	}
+
+	scrubber := s.scrubberFor(r)
+	for i := range comments {
+		comments[i].Body = scrubber.Mask(comments[i].Body)
+	}
+	response := CommentsResponse{Comments: comments, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(comments), total)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	commentId, _ := strconv.Atoi(mux.Vars(r)["commentId"])
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	LogRequest("/animation/{id}/comments/{commentId}", "Deleting comment "+strconv.Itoa(commentId)+" on animation "+id)
+
+	// Authors may delete their comments and owners any comment on their animation; admins any comment
+	if err := s.store.DeleteComment(r.Context(), id, commentId, userId, IsAdmin(userId)); err != nil {
+		switch err.Error() {
+		case "comment not found":
+			LogResponse("/animation/{id}/comments/{commentId}", "Comment not found", nil)
+			EncodeError(w, "Comment not found", http.StatusNotFound)
+		case "not the comment author":
+			LogResponse("/animation/{id}/comments/{commentId}", "User "+userId+" may not delete comment "+strconv.Itoa(commentId), nil)
+			EncodeError(w, "Only the author or the animation's owner can delete this comment", http.StatusForbidden)
+		default:
+			LogResponse("/animation/{id}/comments/{commentId}", "Error deleting comment", err)
+			EncodeError(w, "Error deleting comment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	LogResponse("/animation/{id}/comments/{commentId}", "Comment "+strconv.Itoa(commentId)+" deleted", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getMyAnimationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, offset, ok := parsePage(w, r, "/my-animations")
+	if !ok {
+		return
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	LogRequest("/my-animations", "Listing animations of user "+userId)
+
+	animations, total, err := s.store.ListUserAnimations(r.Context(), userId, limit, offset)
+	if err != nil {
+		LogResponse("/my-animations", "Error listing animations of user "+userId, err)
+		EncodeError(w, "Error retrieving your animations", http.StatusInternalServerError)
+		return
+	}
+
+	response := MyAnimationsResponse{Animations: animations, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(animations), total)
+
+	LogResponse("/my-animations", "Listed "+strconv.Itoa(len(animations))+" of "+strconv.Itoa(total)+" animations", nil)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseTimeRange reads the from and to query parameters as RFC 3339 times or YYYY-MM-DD dates. A
+// date passed as to includes that whole day; missing parameters return zero times.
+func parseTimeRange(w http.ResponseWriter, r *http.Request, endpoint string) (time.Time, time.Time, bool) {
+	var bounds [2]time.Time
+	for i, name := range []string{"from", "to"} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			if parsed, err = time.Parse(time.DateOnly, raw); err == nil && name == "to" {
+				parsed = parsed.AddDate(0, 0, 1)
+			}
+		}
+		if err != nil {
+			LogResponse(endpoint, "Invalid "+name+": "+raw, err)
+			EncodeError(w, name+" must be an RFC 3339 time or a YYYY-MM-DD date", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		bounds[i] = parsed
+	}
+	if !bounds[0].IsZero() && !bounds[1].IsZero() && !bounds[0].Before(bounds[1]) {
+		LogResponse(endpoint, "Empty time range", nil)
+		EncodeError(w, "from must be before to", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	return bounds[0], bounds[1], true
+}
+
+func (s *Server) listMoodsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	limit, offset, ok := parsePage(w, r, "/moods")
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(w, r, "/moods")
+	if !ok {
+		return
+	}
+
+	moods, total, err := s.store.ListMoods(r.Context(), userId, from, to, limit, offset)
+	if err != nil {
+		LogResponse("/moods", "Error listing moods for user "+userId, err)
+		EncodeError(w, "Error retrieving moods", http.StatusInternalServerError)
+		return
+	}
+
+	response := MoodsResponse{Moods: moods, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(moods), total)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) saveMoodHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the request body
+	var req SaveMoodRequest
+	if !decodeRequest(w, r, "/save-mood", &req) {
+		return
+	}
+
+	// Check if animation exists
+	if !s.store.AnimationExists(r.Context(), req.AnimationID) {
+		LogResponse("/save-mood", "Animation not found with ID: "+req.AnimationID, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+	if !s.checkMoodPlaybackSession(w, r, req) {
+		return
+	}
+
+	// Get user ID from context
+	userId, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		LogResponse("/save-mood", "User ID missing from context", nil)
+		EncodeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Save the mood to the database
+	err := s.store.SaveMood(r.Context(), userId, req.AnimationID, string(req.Mood))
+	if err != nil {
+		LogResponse("/save-mood", "Error saving mood", err)
+		EncodeError(w, "Error saving mood: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/save-mood", "Mood saved successfully", nil)
+
+	// A mood soon after a reminder answers it
+	if err := s.store.RecordReminderCheckIn(r.Context(), userId, reminderCheckInWindow); err != nil {
+		LogResponse("/save-mood", "Error recording reminder check-in", err)
+	}
+
+	followUps := s.runMoodRules(r.Context(), "/save-mood", userId, TenantFromContext(r.Context()), req.Mood)
+	scrubber := s.scrubberFor(r)
+	for _, followUp := range followUps {
+		for i := range followUp.Animations {
+			followUp.Animations[i].Description = scrubber.Mask(followUp.Animations[i].Description)
+		}
+	}
+
+	// Return success response
+	response := SaveMoodResponse{Success: true, FollowUps: followUps}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) getContentPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	preferences, err := s.store.GetContentPreferences(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/preferences/content", "Error retrieving content preferences", err)
+		EncodeError(w, "Error retrieving content preferences", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (s *Server) updateContentPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// The body replaces every preference; omitted ones are turned off
+	var preferences ContentPreferences
+	if !decodeRequest(w, r, "/me/preferences/content", &preferences) {
+		return
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	if err := s.store.SaveContentPreferences(r.Context(), userId, preferences); err != nil {
+		LogResponse("/me/preferences/content", "Error saving content preferences", err)
+		EncodeError(w, "Error saving content preferences", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/preferences/content", "Content preferences saved for user "+userId, nil)
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (s *Server) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	preferences, err := s.store.GetNotificationPreferences(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/preferences/notifications", "Error retrieving notification preferences", err)
+		EncodeError(w, "Error retrieving notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	preferences.Events = EffectiveNotificationEvents(preferences)
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (s *Server) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// The body replaces every preference; omitted events use their defaults
+	var preferences NotificationPreferences
+	if !decodeRequest(w, r, "/me/preferences/notifications", &preferences) {
+		return
+	}
+	if err := ValidateNotificationPreferences(&preferences); err != nil {
+		LogResponse("/me/preferences/notifications", "Invalid notification preferences", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	if err := s.store.SaveNotificationPreferences(r.Context(), userId, preferences); err != nil {
+		LogResponse("/me/preferences/notifications", "Error saving notification preferences", err)
+		EncodeError(w, "Error saving notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/preferences/notifications", "Notification preferences saved for user "+userId, nil)
+	preferences.Events = EffectiveNotificationEvents(preferences)
+	json.NewEncoder(w).Encode(preferences)
+}
+
+// remindersResponse returns a user's reminder schedule with their next reminder and adherence
+func (s *Server) remindersResponse(ctx context.Context, userId string, schedule ReminderSchedule) (RemindersResponse, error) {
+	response := RemindersResponse{ReminderSchedule: schedule}
+	if next, ok := schedule.nextReminder(time.Now()); ok {
+		response.NextReminderAt = &next
+	}
+	deliveries, err := s.store.ListReminderDeliveries(ctx, userId, reminderAdherenceDays*24*time.Hour)
+	if err != nil {
+		return RemindersResponse{}, err
+	}
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	response.Adherence = summarizeAdherence(deliveries, location, time.Now())
+	return response, nil
+}
+
+func (s *Server) getRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	schedule, err := s.store.GetReminderSchedule(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/reminders", "Error retrieving reminder schedule", err)
+		EncodeError(w, "Error retrieving reminders", http.StatusInternalServerError)
+		return
+	}
+	response, err := s.remindersResponse(r.Context(), userId, schedule)
+	if err != nil {
+		LogResponse("/me/reminders", "Error retrieving reminder adherence", err)
+		EncodeError(w, "Error retrieving reminders", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) updateRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var schedule ReminderSchedule
+	if !decodeRequest(w, r, "/me/reminders", &schedule) {
+		return
+	}
+	if err := ValidateReminderSchedule(&schedule); err != nil {
+		LogResponse("/me/reminders", "Invalid reminder schedule", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	next, _ := schedule.nextReminder(time.Now())
+	if err := s.store.SaveReminderSchedule(r.Context(), userId, schedule, next); err != nil {
+		LogResponse("/me/reminders", "Error saving reminder schedule", err)
+		EncodeError(w, "Error saving reminders", http.StatusInternalServerError)
+		return
+	}
+	response, err := s.remindersResponse(r.Context(), userId, schedule)
+	if err != nil {
+		LogResponse("/me/reminders", "Error retrieving reminder adherence", err)
+		EncodeError(w, "Error retrieving reminders", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/reminders", "Reminder schedule saved for user "+userId, nil)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) getProviderKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	key, err := s.store.GetProviderKey(r.Context(), userId)
+	if err != nil {
+		if err.Error() == "provider key not found" {
+			LogResponse("/me/provider-key", "No provider key stored for user "+userId, nil)
+			EncodeError(w, "No provider key stored", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/provider-key", "Error retrieving provider key", err)
+		EncodeError(w, "Error retrieving provider key", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *Server) setProviderKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ProviderKeyRequest
+	if !decodeRequest(w, r, "/me/provider-key", &req) {
+		return
+	}
+	if err := ValidateProviderKey(req); err != nil {
+		LogResponse("/me/provider-key", "Invalid provider key", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keys are only ever stored sealed
+	sealed, err := sealProviderKey(req)
+	if err != nil {
+		if err.Error() == "provider key encryption is not configured" {
+			LogResponse("/me/provider-key", "PROVIDER_KEY_ENCRYPTION_KEYS not set", nil)
+			EncodeError(w, "Storing provider keys is not enabled", http.StatusServiceUnavailable)
+			return
+		}
+		LogResponse("/me/provider-key", "Error encrypting provider key", err)
+		EncodeError(w, "Error saving provider key", http.StatusInternalServerError)
+		return
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	key, err := s.store.SetProviderKey(r.Context(), userId, sealed)
+	if err != nil {
+		LogResponse("/me/provider-key", "Error saving provider key", err)
+		EncodeError(w, "Error saving provider key", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/provider-key", key.Provider+" key saved for user "+userId, nil)
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *Server) deleteProviderKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	if err := s.store.DeleteProviderKey(r.Context(), userId); err != nil {
+		if err.Error() == "provider key not found" {
+			LogResponse("/me/provider-key", "No provider key stored for user "+userId, nil)
+			EncodeError(w, "No provider key stored", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/provider-key", "Error deleting provider key", err)
+		EncodeError(w, "Error deleting provider key", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/provider-key", "Provider key deleted for user "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodePromptPreset reads and validates a prompt preset request, writing a 400 response and
+// returning false when it is invalid
+func decodePromptPreset(w http.ResponseWriter, r *http.Request, endpoint string) (PromptPreset, bool) {
+	var req PromptPresetRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return PromptPreset{}, false
+	}
+	preset, err := ValidatePromptPreset(req)
+	if err != nil {
+		LogResponse(endpoint, "Invalid prompt preset", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return PromptPreset{}, false
+	}
+	preset.UserID, _ = GetUserIDFromContext(r.Context())
+	return preset, true
+}
+
+func (s *Server) createPromptPresetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	preset, ok := decodePromptPreset(w, r, "/me/prompt-presets")
+	if !ok {
+		return
+	}
+
+	_, total, err := s.store.ListPromptPresets(r.Context(), preset.UserID, 1, 0)
+	if err != nil {
+		LogResponse("/me/prompt-presets", "Error counting prompt presets", err)
+		EncodeError(w, "Error saving prompt preset", http.StatusInternalServerError)
+		return
+	}
+	if total >= maxPromptPresets {
+		LogResponse("/me/prompt-presets", "User "+preset.UserID+" has too many prompt presets", nil)
+		EncodeError(w, "You can keep at most "+strconv.Itoa(maxPromptPresets)+" prompt presets", http.StatusConflict)
+		return
+	}
+
+	created, err := s.store.CreatePromptPreset(r.Context(), preset)
+	if err != nil {
+		LogResponse("/me/prompt-presets", "Error saving prompt preset", err)
+		EncodeError(w, "Error saving prompt preset", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/prompt-presets", "Prompt preset "+strconv.Itoa(created.ID)+" saved", nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listPromptPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, offset, ok := parsePage(w, r, "/me/prompt-presets")
+	if !ok {
+		return
+	}
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	presets, total, err := s.store.ListPromptPresets(r.Context(), userId, limit, offset)
+	if err != nil {
+		LogResponse("/me/prompt-presets", "Error listing prompt presets", err)
+		EncodeError(w, "Error retrieving prompt presets", http.StatusInternalServerError)
+		return
+	}
+
+	response := PromptPresetsResponse{Presets: presets, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(presets), total)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) updatePromptPresetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	preset, ok := decodePromptPreset(w, r, "/me/prompt-presets/{id}")
+	if !ok {
+		return
+	}
+	preset.ID, _ = strconv.Atoi(mux.Vars(r)["id"])
+
+	updated, err := s.store.UpdatePromptPreset(r.Context(), preset)
+	if err != nil {
+		if err.Error() == "prompt preset not found" {
+			LogResponse("/me/prompt-presets/{id}", "Prompt preset not found: "+strconv.Itoa(preset.ID), nil)
+			EncodeError(w, "Prompt preset not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/prompt-presets/{id}", "Error updating prompt preset", err)
+		EncodeError(w, "Error updating prompt preset", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/prompt-presets/{id}", "Prompt preset "+strconv.Itoa(updated.ID)+" updated", nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *Server) deletePromptPresetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	// Admins may take down presets shared in the gallery
+	if err := s.store.DeletePromptPreset(r.Context(), id, userId, IsAdmin(userId)); err != nil {
+		if err.Error() == "prompt preset not found" {
+			LogResponse("/me/prompt-presets/{id}", "Prompt preset not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Prompt preset not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/prompt-presets/{id}", "Error deleting prompt preset", err)
+		EncodeError(w, "Error deleting prompt preset", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/prompt-presets/{id}", "Prompt preset "+strconv.Itoa(id)+" deleted by "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listPublicPromptPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, offset, ok := parsePage(w, r, "/prompt-presets")
+	if !ok {
+		return
+	}
+
+	presets, total, err := s.store.ListPublicPromptPresets(r.Context(), limit, offset)
+	if err != nil {
+		LogResponse("/prompt-presets", "Error listing public prompt presets", err)
+		EncodeError(w, "Error retrieving prompt presets", http.StatusInternalServerError)
+		return
+	}
+
+	response := PromptPresetsResponse{Presets: presets, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(presets), total)
+	json.NewEncoder(w).Encode(response)
+}
+
+// decodeCollection reads and validates a collection request, writing a 400 response and returning
+// false when it is invalid or lists animations that do not exist
+func (s *Server) decodeCollection(w http.ResponseWriter, r *http.Request, endpoint string) (Collection, bool) {
+	var req CollectionRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return Collection{}, false
+	}
+	collection, err := ValidateCollection(req)
+	if err != nil {
+		LogResponse(endpoint, "Invalid collection", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return Collection{}, false
+	}
+	for _, id := range collection.AnimationIDs {
+		if !s.store.AnimationExists(r.Context(), id) {
+			LogResponse(endpoint, "Collection lists unknown animation "+id, nil)
+			EncodeError(w, "Animation not found: "+id, http.StatusBadRequest)
+			return Collection{}, false
+		}
+	}
+	// Public collections are syndicated to other sites, so they are held to the comment rules
+	scrubber := s.scrubberFor(r)
+	collection.Title = scrubber.Scrub(r.Context(), collection.Title)
+	collection.Description = scrubber.Scrub(r.Context(), collection.Description)
+	collection.UserID, _ = GetUserIDFromContext(r.Context())
+	return collection, true
+}
+
+func (s *Server) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	collection, ok := s.decodeCollection(w, r, "/me/collections")
+	if !ok {
+		return
+	}
+
+	_, total, err := s.store.ListCollections(r.Context(), collection.UserID, 1, 0)
+	if err != nil {
+		LogResponse("/me/collections", "Error counting collections", err)
+		EncodeError(w, "Error saving collection", http.StatusInternalServerError)
+		return
+	}
+	if total >= maxCollections {
+		LogResponse("/me/collections", "User "+collection.UserID+" has too many collections", nil)
+		EncodeError(w, "You can keep at most "+strconv.Itoa(maxCollections)+" collections", http.StatusConflict)
+		return
+	}
+
+	created, err := s.store.CreateCollection(r.Context(), collection)
+	if err != nil {
+		LogResponse("/me/collections", "Error saving collection", err)
+		EncodeError(w, "Error saving collection", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/collections", "Collection "+strconv.Itoa(created.ID)+" saved", nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, offset, ok := parsePage(w, r, "/me/collections")
+	if !ok {
+		return
+	}
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	collections, total, err := s.store.ListCollections(r.Context(), userId, limit, offset)
+	if err != nil {
+		LogResponse("/me/collections", "Error listing collections", err)
+		EncodeError(w, "Error retrieving collections", http.StatusInternalServerError)
+		return
+	}
+
+	response := CollectionsResponse{Collections: collections, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(collections), total)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	collection, ok := s.decodeCollection(w, r, "/me/collections/{id}")
+	if !ok {
+		return
+	}
+	collection.ID, _ = strconv.Atoi(mux.Vars(r)["id"])
+
+	updated, err := s.store.UpdateCollection(r.Context(), collection)
+	if err != nil {
+		if err.Error() == "collection not found" {
+			LogResponse("/me/collections/{id}", "Collection not found: "+strconv.Itoa(collection.ID), nil)
+			EncodeError(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/collections/{id}", "Error updating collection", err)
+		EncodeError(w, "Error updating collection", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/collections/{id}", "Collection "+strconv.Itoa(updated.ID)+" updated", nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *Server) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	// Admins may take down collections syndicated to other sites
+	if err := s.store.DeleteCollection(r.Context(), id, userId, IsAdmin(userId)); err != nil {
+		if err.Error() == "collection not found" {
+			LogResponse("/me/collections/{id}", "Collection not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/collections/{id}", "Error deleting collection", err)
+		EncodeError(w, "Error deleting collection", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/me/collections/{id}", "Collection "+strconv.Itoa(id)+" deleted by "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// collectionFeedHandler serves a page of a public collection as a feed in format, so other sites
+// can syndicate it without signing in. Private collections look the same as unknown ones.
+func (s *Server) collectionFeedHandler(format string) http.HandlerFunc {
+	endpoint := "/collections/{id}/feed." + format
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit, offset, ok := parsePage(w, r, endpoint)
+		if !ok {
+			return
+		}
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+		collection, err := s.store.GetCollection(r.Context(), id, "")
+		if err != nil {
+			if err.Error() == "collection not found" {
+				LogResponse(endpoint, "Collection not found: "+strconv.Itoa(id), nil)
+				EncodeError(w, "Collection not found", http.StatusNotFound)
+				return
+			}
+			LogResponse(endpoint, "Error retrieving collection", err)
+			EncodeError(w, "Error retrieving collection", http.StatusInternalServerError)
+			return
+		}
+		animations, total, err := s.store.ListCollectionAnimations(r.Context(), id, limit, offset)
+		if err != nil {
+			LogResponse(endpoint, "Error listing collection animations", err)
+			EncodeError(w, "Error retrieving collection", http.StatusInternalServerError)
+			return
+		}
+		scrubber := s.scrubberFor(r)
+		for i := range animations {
+			animations[i].Description = scrubber.Mask(animations[i].Description)
+		}
+		next := nextOffset(offset, len(animations), total)
+
+		var body []byte
+		contentType := "application/feed+json"
+		if format == CollectionFeedRSS {
+			contentType = "application/rss+xml; charset=utf-8"
+			body, err = BuildRSSFeed(collection, animations, limit, offset, next)
+		} else {
+			body, err = json.Marshal(BuildJSONFeed(collection, animations, limit, offset, next))
+		}
+		if err != nil {
+			LogResponse(endpoint, "Error rendering feed", err)
+			EncodeError(w, "Error retrieving collection", http.StatusInternalServerError)
+			return
+		}
+
+		etag := `"` + CodeHash(string(body)) + `"`
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(collectionFeedMaxAge.Seconds())))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		LogResponse(endpoint, "Returned feed for collection "+strconv.Itoa(id), nil)
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	}
+}
+
+// organizationFor returns the workspace named in the request when the user may act on it: its
+// owner, or when ownerOnly is not set any member. Admins may act on every workspace. Workspaces
+// the user is not in look the same as unknown ones.
+func (s *Server) organizationFor(w http.ResponseWriter, r *http.Request, endpoint, userId string, ownerOnly bool) (Organization, bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	org, err := s.store.GetOrganization(r.Context(), id)
+	if err != nil && err.Error() != "organization not found" {
+		LogResponse(endpoint, "Error retrieving organization", err)
+		EncodeError(w, "Error retrieving organization", http.StatusInternalServerError)
+		return Organization{}, false
+	}
+	if err != nil || (!org.HasMember(userId) && !IsAdmin(userId)) {
+		LogResponse(endpoint, "Organization "+strconv.Itoa(id)+" not found for user "+userId, nil)
+		EncodeError(w, "Organization not found", http.StatusNotFound)
+		return Organization{}, false
+	}
+	if ownerOnly && !org.IsOwner(userId) && !IsAdmin(userId) {
+		LogResponse(endpoint, "User "+userId+" does not own organization "+strconv.Itoa(id), nil)
+		EncodeError(w, "Only the workspace owner may do this", http.StatusForbidden)
+		return Organization{}, false
+	}
+	return org, true
+}
+
+func (s *Server) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	var req OrganizationRequest
+	if !decodeRequest(w, r, "/orgs", &req) {
+		return
+	}
+	name, err := ValidateOrganizationName(req.Name)
+	if err != nil {
+		LogResponse("/orgs", "Invalid organization name", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	org, err := s.store.CreateOrganization(r.Context(), name, userId)
+	if err != nil {
+		if err.Error() == "already in an organization" {
+			LogResponse("/orgs", "User "+userId+" is already in an organization", nil)
+			EncodeError(w, "You are already in a workspace", http.StatusConflict)
+			return
+		}
+		LogResponse("/orgs", "Error creating organization", err)
+		EncodeError(w, "Error creating organization", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/orgs", "Organization "+strconv.Itoa(org.ID)+" created by "+userId, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s *Server) getMyOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, err := s.store.GetUserOrganization(r.Context(), userId)
+	if err != nil {
+		if err.Error() == "organization not found" {
+			LogResponse("/me/organization", "User "+userId+" is not in an organization", nil)
+			EncodeError(w, "You are not in a workspace", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/organization", "Error retrieving organization", err)
+		EncodeError(w, "Error retrieving organization", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s *Server) getOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}", userId, false)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s *Server) deleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}", userId, true)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteOrganization(r.Context(), org.ID); err != nil {
+		LogResponse("/orgs/{id}", "Error deleting organization", err)
+		EncodeError(w, "Error deleting organization", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/orgs/{id}", "Organization "+strconv.Itoa(org.ID)+" deleted by "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/members", userId, true)
+	if !ok {
+		return
+	}
+
+	var req OrganizationMemberRequest
+	if !decodeRequest(w, r, "/orgs/{id}/members", &req) {
+		return
+	}
+	if req.Email == "" {
+		encodeFieldError(w, "/orgs/{id}/members", "email", ErrCodeFieldRequired, "is required")
+		return
+	}
+
+	memberId, err := s.store.GetUserIDByEmail(r.Context(), req.Email)
+	if err != nil {
+		LogResponse("/orgs/{id}/members", "No user to add to organization "+strconv.Itoa(org.ID), err)
+		EncodeErrorCode(w, ErrCodeUserNotFound, "User not found", http.StatusNotFound)
+		return
+	}
+
+	member, err := s.store.AddOrganizationMember(r.Context(), org.ID, memberId, req.MonthlyLimit)
+	if err != nil {
+		if err.Error() == "already in an organization" {
+			LogResponse("/orgs/{id}/members", "User "+memberId+" is already in an organization", nil)
+			EncodeError(w, "The user is already in a workspace", http.StatusConflict)
+			return
+		}
+		LogResponse("/orgs/{id}/members", "Error adding organization member", err)
+		EncodeError(w, "Error adding organization member", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/orgs/{id}/members", "User "+memberId+" added to organization "+strconv.Itoa(org.ID)+" by "+userId, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+func (s *Server) updateOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/members/{userId}", userId, true)
+	if !ok {
+		return
+	}
+
+	var req OrganizationMemberRequest
+	if !decodeRequest(w, r, "/orgs/{id}/members/{userId}", &req) {
+		return
+	}
+
+	memberId := mux.Vars(r)["userId"]
+	member, err := s.store.SetOrganizationMemberLimit(r.Context(), org.ID, memberId, req.MonthlyLimit)
+	if err != nil {
+		if err.Error() == "organization member not found" {
+			LogResponse("/orgs/{id}/members/{userId}", "User "+memberId+" is not in organization "+strconv.Itoa(org.ID), nil)
+			EncodeError(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/orgs/{id}/members/{userId}", "Error setting organization member limit", err)
+		EncodeError(w, "Error setting member limit", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/orgs/{id}/members/{userId}", "Monthly limit of "+memberId+" in organization "+strconv.Itoa(org.ID)+" set to "+strconv.Itoa(req.MonthlyLimit), nil)
+	json.NewEncoder(w).Encode(member)
+}
+
+func (s *Server) removeOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Members may leave; only the owner may remove others
+	userId, _ := GetUserIDFromContext(r.Context())
+	memberId := mux.Vars(r)["userId"]
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/members/{userId}", userId, memberId != userId)
+	if !ok {
+		return
+	}
+	if org.IsOwner(memberId) {
+		LogResponse("/orgs/{id}/members/{userId}", "Owner cannot leave organization "+strconv.Itoa(org.ID), nil)
+		EncodeError(w, "The owner cannot leave the workspace; delete it instead", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.RemoveOrganizationMember(r.Context(), org.ID, memberId); err != nil {
+		if err.Error() == "organization member not found" {
+			LogResponse("/orgs/{id}/members/{userId}", "User "+memberId+" is not in organization "+strconv.Itoa(org.ID), nil)
+			EncodeError(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/orgs/{id}/members/{userId}", "Error removing organization member", err)
+		EncodeError(w, "Error removing organization member", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/orgs/{id}/members/{userId}", "User "+memberId+" removed from organization "+strconv.Itoa(org.ID)+" by "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) organizationUsageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/usage", userId, true)
+	if !ok {
+		return
+	}
+
+	month, err := parseUsageMonth(r.URL.Query().Get("month"), time.Now())
+	if err != nil {
+		LogResponse("/orgs/{id}/usage", "Invalid month", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	usage, err := s.store.GetOrganizationUsage(r.Context(), org.ID, month)
+	if err != nil {
+		LogResponse("/orgs/{id}/usage", "Error retrieving organization usage", err)
+		EncodeError(w, "Error retrieving organization usage", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(usage)
+}
+
+func (s *Server) setOrganizationReviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/review", userId, true)
+	if !ok {
+		return
+	}
+
+	var req OrganizationReviewRequest
+	if !decodeRequest(w, r, "/orgs/{id}/review", &req) {
+		return
+	}
+
+	updated, err := s.store.SetOrganizationReviewRequired(r.Context(), org.ID, req.ReviewRequired)
+	if err != nil {
+		LogResponse("/orgs/{id}/review", "Error setting organization review", err)
+		EncodeError(w, "Error updating organization", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/orgs/{id}/review", "Organization "+strconv.Itoa(org.ID)+" review required set to "+strconv.FormatBool(req.ReviewRequired)+" by "+userId, nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// parseReviewFilter reads the status query parameter of review listings, writing a 400 response
+// and returning false when it is not a review status
+func parseReviewFilter(w http.ResponseWriter, r *http.Request, endpoint string) (AnimationReviewFilter, bool) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", ReviewPending, ReviewApproved, ReviewRejected:
+		return AnimationReviewFilter{Status: status}, true
+	}
+	LogResponse(endpoint, "Invalid review status "+status, nil)
+	EncodeError(w, "status must be "+ReviewPending+", "+ReviewApproved+" or "+ReviewRejected, http.StatusBadRequest)
+	return AnimationReviewFilter{}, false
+}
+
+// writeAnimationReviews writes a page of the reviews matching filter
+func (s *Server) writeAnimationReviews(w http.ResponseWriter, r *http.Request, endpoint string, filter AnimationReviewFilter) {
+	limit, offset, ok := parsePage(w, r, endpoint)
+	if !ok {
+		return
+	}
+
+	reviews, total, err := s.store.ListAnimationReviews(r.Context(), filter, limit, offset)
+	if err != nil {
+		LogResponse(endpoint, "Error listing animation reviews", err)
+		EncodeError(w, "Error retrieving reviews", http.StatusInternalServerError)
+		return
+	}
+
+	response := AnimationReviewsResponse{Reviews: reviews, Total: total, Limit: limit, Offset: offset}
+	response.NextOffset = nextOffset(offset, len(reviews), total)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) listOrganizationReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/reviews", userId, true)
+	if !ok {
+		return
+	}
+	filter, ok := parseReviewFilter(w, r, "/orgs/{id}/reviews")
+	if !ok {
+		return
+	}
+	filter.OrganizationID = org.ID
+	s.writeAnimationReviews(w, r, "/orgs/{id}/reviews", filter)
+}
+
+func (s *Server) listMyReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := parseReviewFilter(w, r, "/me/reviews")
+	if !ok {
+		return
+	}
+	filter.AuthorID, _ = GetUserIDFromContext(r.Context())
+	s.writeAnimationReviews(w, r, "/me/reviews", filter)
+}
+
+// decideAnimationReviewHandler lets a workspace owner approve a member's animation into the feed,
+// or reject it, and tells the member
+func (s *Server) decideAnimationReviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.organizationFor(w, r, "/orgs/{id}/reviews/{animationId}", userId, true)
+	if !ok {
+		return
+	}
+	animationId := mux.Vars(r)["animationId"]
+
+	var req ReviewDecisionRequest
+	if !decodeRequest(w, r, "/orgs/{id}/reviews/{animationId}", &req) {
+		return
+	}
+	req, err := ValidateReviewDecision(req)
+	if err != nil {
+		LogResponse("/orgs/{id}/reviews/{animationId}", "Invalid review decision", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Reviews of other workspaces look the same as unknown ones
+	review, err := s.store.GetAnimationReview(r.Context(), animationId)
+	if err == nil && review.OrganizationID != org.ID {
+		err = errors.New("animation review not found")
+	}
+	if err == nil {
+		review, err = s.store.DecideAnimationReview(r.Context(), animationId, req.Status, userId, s.scrubberFor(r).Scrub(r.Context(), req.Note))
+	}
+	if err != nil {
+		switch err.Error() {
+		case "animation review not found":
+			LogResponse("/orgs/{id}/reviews/{animationId}", "No review of animation "+animationId+" in organization "+strconv.Itoa(org.ID), nil)
+			EncodeError(w, "Review not found", http.StatusNotFound)
+		case "animation review already decided":
+			LogResponse("/orgs/{id}/reviews/{animationId}", "Review of animation "+animationId+" already decided", nil)
+			EncodeError(w, "The review was already decided", http.StatusConflict)
+		default:
+			LogResponse("/orgs/{id}/reviews/{animationId}", "Error deciding animation review", err)
+			EncodeError(w, "Error deciding review", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	sendReviewNotices(r.Context(), s.store, org, review)
+	if review.Status == ReviewApproved {
+		s.events.publishAnimation(AnimationPublished{AnimationID: animationId, CreatorID: review.AuthorID})
+	}
+	LogResponse("/orgs/{id}/reviews/{animationId}", "Animation "+animationId+" "+review.Status+" by "+userId, nil)
+	json.NewEncoder(w).Encode(review)
+}
+
+func (s *Server) setOrganizationCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var req OrganizationCreditsRequest
+	if !decodeRequest(w, r, "/admin/orgs/{id}/credits", &req) {
+		return
+	}
+
+	org, err := s.store.SetOrganizationCredits(r.Context(), id, req.MonthlyCredits)
+	if err != nil {
+		if err.Error() == "organization not found" {
+			LogResponse("/admin/orgs/{id}/credits", "Organization not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Organization not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/orgs/{id}/credits", "Error setting organization credits", err)
+		EncodeError(w, "Error setting organization credits", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/orgs/{id}/credits", "Organization "+strconv.Itoa(id)+" now has "+strconv.Itoa(req.MonthlyCredits)+" monthly credits", nil)
+	json.NewEncoder(w).Encode(org)
+}
+
+// decodeSignageSchedule reads and validates a signage schedule request, checking that the
+// animations it plays exist. It answers the request itself and returns false when it is invalid.
+func (s *Server) decodeSignageSchedule(w http.ResponseWriter, r *http.Request, endpoint string) (SignageSchedule, bool) {
+	var req SignageScheduleRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return SignageSchedule{}, false
+	}
+	schedule, err := ValidateSignageSchedule(req)
+	if err != nil {
+		LogResponse(endpoint, "Invalid signage schedule", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return SignageSchedule{}, false
+	}
+	for _, animationId := range schedule.AnimationIDs() {
+		if !s.store.AnimationExists(r.Context(), animationId) {
+			LogResponse(endpoint, "Signage schedule plays unknown animation "+animationId, nil)
+			EncodeError(w, "Animation not found: "+animationId, http.StatusBadRequest)
+			return SignageSchedule{}, false
+		}
+	}
+	schedule.UserID, _ = GetUserIDFromContext(r.Context())
+	return schedule, true
+}
+
+func (s *Server) createSignageScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	schedule, ok := s.decodeSignageSchedule(w, r, "/signage/schedules")
+	if !ok {
+		return
+	}
+
+	created, err := s.store.CreateSignageSchedule(r.Context(), schedule)
+	if err != nil {
+		LogResponse("/signage/schedules", "Error saving signage schedule", err)
+		EncodeError(w, "Error saving signage schedule", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/signage/schedules", "Signage schedule "+created.ID+" saved by "+schedule.UserID, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listSignageSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	schedules, err := s.store.ListSignageSchedules(r.Context(), userId)
+	if err != nil {
+		LogResponse("/signage/schedules", "Error listing signage schedules", err)
+		EncodeError(w, "Error retrieving signage schedules", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(SignageSchedulesResponse{Schedules: schedules})
+}
+
+func (s *Server) getSignageScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	// Other users' schedules look the same as unknown ones
+	schedule, err := s.store.GetSignageSchedule(r.Context(), id)
+	if err != nil && err.Error() != "signage schedule not found" {
+		LogResponse("/signage/schedules/{id}", "Error retrieving signage schedule", err)
+		EncodeError(w, "Error retrieving signage schedule", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || schedule.UserID != userId {
+		LogResponse("/signage/schedules/{id}", "Signage schedule "+id+" not found for user "+userId, nil)
+		EncodeError(w, "Signage schedule not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(schedule)
+}
+
+func (s *Server) updateSignageScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	schedule, ok := s.decodeSignageSchedule(w, r, "/signage/schedules/{id}")
+	if !ok {
+		return
+	}
+	schedule.ID = mux.Vars(r)["id"]
+
+	updated, err := s.store.UpdateSignageSchedule(r.Context(), schedule)
+	if err != nil {
+		if err.Error() == "signage schedule not found" {
+			LogResponse("/signage/schedules/{id}", "Signage schedule "+schedule.ID+" not found for user "+schedule.UserID, nil)
+			EncodeError(w, "Signage schedule not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/signage/schedules/{id}", "Error updating signage schedule", err)
+		EncodeError(w, "Error updating signage schedule", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/signage/schedules/{id}", "Signage schedule "+schedule.ID+" updated", nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *Server) deleteSignageScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	if err := s.store.DeleteSignageSchedule(r.Context(), id, userId); err != nil {
+		if err.Error() == "signage schedule not found" {
+			LogResponse("/signage/schedules/{id}", "Signage schedule "+id+" not found for user "+userId, nil)
+			EncodeError(w, "Signage schedule not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/signage/schedules/{id}", "Error deleting signage schedule", err)
+		EncodeError(w, "Error deleting signage schedule", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/signage/schedules/{id}", "Signage schedule "+id+" deleted by "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signageNowPlayingHandler tells a screen what to play now. Screens poll it without signing in,
+// so answers are small and cacheable until they may change, or for at most signagePollInterval so
+// that edits to the schedule reach them.
+func (s *Server) signageNowPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	schedule, err := s.store.GetSignageSchedule(r.Context(), id)
+	if err != nil {
+		if err.Error() == "signage schedule not found" {
+			LogResponse("/signage/schedules/{id}/now", "Signage schedule not found: "+id, nil)
+			EncodeError(w, "Signage schedule not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/signage/schedules/{id}/now", "Error retrieving signage schedule", err)
+		EncodeError(w, "Error retrieving signage schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Del("Access-Control-Allow-Credentials")
+	writeSignageNowPlaying(w, r, schedule, "public")
+}
+
+// writeSignageNowPlaying answers with what the schedule plays now, cacheable with the given
+// Cache-Control scope until it may change or for at most signagePollInterval, and with an ETag
+// screens revalidate with
+func writeSignageNowPlaying(w http.ResponseWriter, r *http.Request, schedule SignageSchedule, scope string) {
+	now := time.Now()
+	playing := schedule.NowPlaying(now)
+	maxAge := min(int(math.Ceil(playing.Until.Sub(now).Seconds())), int(signagePollInterval.Seconds()))
+	w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(maxAge))
+	etag := `"` + playing.AnimationID + "-" + strconv.FormatInt(playing.Until.Unix(), 10) + "-" +
+		strconv.FormatInt(schedule.UpdatedAt.UnixMilli(), 10) + `"`
+	w.Header().Set("ETag", etag)
+	if strings.Contains(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	json.NewEncoder(w).Encode(playing)
+}
+
+// newCostReport returns an empty cost report for the range from until before to
+func newCostReport(from, to time.Time) CostReport {
+	report := CostReport{}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	return report
+}
+
+// generationCostsHandler reports what generations cost in total between the from and to query
+// parameters, with the limit users who cost the most
+func (s *Server) generationCostsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	from, to, ok := parseTimeRange(w, r, "/admin/costs")
+	if !ok {
+		return
+	}
+	limit := defaultCostReportUsers
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxCostReportUsers {
+			LogResponse("/admin/costs", "Invalid limit", err)
+			EncodeError(w, "limit must be between 1 and "+strconv.Itoa(maxCostReportUsers), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	report := newCostReport(from, to)
+	var err error
+	if report.Totals, err = s.store.GetGenerationCosts(r.Context(), from, to, ""); err == nil {
+		report.Users, err = s.store.ListUserGenerationCosts(r.Context(), from, to, limit)
+	}
+	if err != nil {
+		LogResponse("/admin/costs", "Error retrieving generation costs", err)
+		EncodeError(w, "Error retrieving generation costs", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// userGenerationCostsHandler reports what one user's generations cost between the from and to
+// query parameters
+func (s *Server) userGenerationCostsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId := mux.Vars(r)["id"]
+	from, to, ok := parseTimeRange(w, r, "/admin/costs/users/{id}")
+	if !ok {
+		return
+	}
+
+	report := newCostReport(from, to)
+	report.UserID = userId
+	totals, err := s.store.GetGenerationCosts(r.Context(), from, to, userId)
+	if err != nil {
+		LogResponse("/admin/costs/users/{id}", "Error retrieving generation costs for user "+userId, err)
+		EncodeError(w, "Error retrieving generation costs", http.StatusInternalServerError)
+		return
+	}
+	report.Totals = totals
+	json.NewEncoder(w).Encode(report)
+}
+
+// decodeKioskToken reads and validates a kiosk token request, checking that the schedules it
+// assigns exist. It writes the error response and returns false when the request is not valid.
+func (s *Server) decodeKioskToken(w http.ResponseWriter, r *http.Request, endpoint string) (KioskToken, int, bool) {
+	var req KioskTokenRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return KioskToken{}, 0, false
+	}
+	token, err := ValidateKioskToken(req)
+	if err != nil {
+		LogResponse(endpoint, "Invalid kiosk token", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return KioskToken{}, 0, false
+	}
+	for _, id := range token.ScheduleIDs {
+		if _, err := s.store.GetSignageSchedule(r.Context(), id); err != nil {
+			if err.Error() == "signage schedule not found" {
+				LogResponse(endpoint, "Kiosk token assigned unknown schedule "+id, nil)
+				EncodeError(w, "Signage schedule not found: "+id, http.StatusBadRequest)
+				return KioskToken{}, 0, false
+			}
+			LogResponse(endpoint, "Error retrieving signage schedule", err)
+			EncodeError(w, "Error retrieving signage schedule", http.StatusInternalServerError)
+			return KioskToken{}, 0, false
+		}
+	}
+	return token, req.ExpiresInDays, true
+}
+
+func (s *Server) createKioskTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, expiresInDays, ok := s.decodeKioskToken(w, r, "/admin/kiosk-tokens")
+	if !ok {
+		return
+	}
+	token.CreatedBy, _ = GetUserIDFromContext(r.Context())
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	secret, hash, err := newKioskToken()
+	if err != nil {
+		LogResponse("/admin/kiosk-tokens", "Error generating kiosk token", err)
+		EncodeError(w, "Error generating kiosk token", http.StatusInternalServerError)
+		return
+	}
+	created, err := s.store.CreateKioskToken(r.Context(), token, hash)
+	if err != nil {
+		LogResponse("/admin/kiosk-tokens", "Error saving kiosk token", err)
+		EncodeError(w, "Error saving kiosk token", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is only ever shown here
+	created.Token = secret
+	LogResponse("/admin/kiosk-tokens", "Kiosk token "+strconv.Itoa(created.ID)+" issued by "+token.CreatedBy, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listKioskTokensHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	tokens, err := s.store.ListKioskTokens(r.Context())
+	if err != nil {
+		LogResponse("/admin/kiosk-tokens", "Error listing kiosk tokens", err)
+		EncodeError(w, "Error retrieving kiosk tokens", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(KioskTokensResponse{Tokens: tokens})
+}
+
+func (s *Server) updateKioskTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	token, _, ok := s.decodeKioskToken(w, r, "/admin/kiosk-tokens/{id}")
+	if !ok {
+		return
+	}
+	token.ID = id
+
+	updated, err := s.store.UpdateKioskToken(r.Context(), token)
+	if err != nil {
+		if err.Error() == "kiosk token not found" {
+			LogResponse("/admin/kiosk-tokens/{id}", "Kiosk token not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Kiosk token not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/kiosk-tokens/{id}", "Error updating kiosk token", err)
+		EncodeError(w, "Error updating kiosk token", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/kiosk-tokens/{id}", "Kiosk token "+strconv.Itoa(id)+" updated", nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *Server) revokeKioskTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := s.store.RevokeKioskToken(r.Context(), id); err != nil {
+		if err.Error() == "kiosk token not found" {
+			LogResponse("/admin/kiosk-tokens/{id}", "Kiosk token not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Kiosk token not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/kiosk-tokens/{id}", "Error revoking kiosk token", err)
+		EncodeError(w, "Error revoking kiosk token", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/kiosk-tokens/{id}", "Kiosk token "+strconv.Itoa(id)+" revoked", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// kioskAssignmentHandler tells a display what its kiosk token may read
+func (s *Server) kioskAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, _ := GetKioskTokenFromContext(r.Context())
+	json.NewEncoder(w).Encode(KioskAssignment{Name: token.Name, ScheduleIDs: token.ScheduleIDs, Feed: token.Feed})
+}
+
+// kioskNowPlayingHandler tells a display what one of its assigned schedules plays now. Schedules
+// it is not assigned are answered as missing.
+func (s *Server) kioskNowPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	token, _ := GetKioskTokenFromContext(r.Context())
+	if !token.CanReadSchedule(id) {
+		LogResponse("/kiosk/schedules/{id}/now", "Signage schedule "+id+" not assigned to kiosk token "+strconv.Itoa(token.ID), nil)
+		EncodeError(w, "Signage schedule not found", http.StatusNotFound)
+		return
+	}
+	schedule, err := s.store.GetSignageSchedule(r.Context(), id)
+	if err != nil {
+		if err.Error() == "signage schedule not found" {
+			LogResponse("/kiosk/schedules/{id}/now", "Signage schedule not found: "+id, nil)
+			EncodeError(w, "Signage schedule not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/kiosk/schedules/{id}/now", "Error retrieving signage schedule", err)
+		EncodeError(w, "Error retrieving signage schedule", http.StatusInternalServerError)
+		return
+	}
+	writeSignageNowPlaying(w, r, schedule, "private")
+}
+
+// kioskFeedHandler returns a random animation from the feed to displays allowed to read it.
+// Displays get no mood summaries, since nobody is there to record one.
+func (s *Server) kioskFeedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, _ := GetKioskTokenFromContext(r.Context())
+	if !token.Feed {
+		LogResponse("/kiosk/feed", "Feed not allowed for kiosk token "+strconv.Itoa(token.ID), nil)
+		EncodeError(w, "This kiosk token may not read the feed", http.StatusForbidden)
+		return
+	}
+
+	animation, err := s.store.GetRandomAnimation(r.Context(), s.feedFilter(w, r))
+	if err != nil {
+		if err.Error() == "no animations found" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		LogResponse("/kiosk/feed", "Error retrieving random animation", err)
+		EncodeError(w, "Error retrieving random animation", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(animation)
+}
+
+// kioskAnimationHandler returns an animation one of the display's schedules plays, or any
+// animation when it may read the feed, without its mood summary
+func (s *Server) kioskAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	token, _ := GetKioskTokenFromContext(r.Context())
+	allowed := token.Feed
+	for _, scheduleId := range token.ScheduleIDs {
+		if allowed {
+			break
+		}
+		schedule, err := s.store.GetSignageSchedule(r.Context(), scheduleId)
+		if err != nil && err.Error() != "signage schedule not found" {
+			LogResponse("/kiosk/animation/{id}", "Error retrieving signage schedule", err)
+			EncodeError(w, "Error retrieving signage schedule", http.StatusInternalServerError)
+			return
+		}
+		allowed = err == nil && slices.Contains(schedule.AnimationIDs(), id)
+	}
+	if !allowed || !s.store.AnimationExists(r.Context(), id) {
+		LogResponse("/kiosk/animation/{id}", "Animation "+id+" not available to kiosk token "+strconv.Itoa(token.ID), nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+
+	animation, err := s.store.GetAnimation(r.Context(), id)
+	if err != nil {
+		if err.Error() == "animation removed" {
+			LogResponse("/kiosk/animation/{id}", "Animation removed after takedown: "+id, nil)
+			EncodeErrorCode(w, ErrCodeAnimationRemoved, "Animation removed following a takedown request", http.StatusUnavailableForLegalReasons)
+			return
+		}
+		LogResponse("/kiosk/animation/{id}", "Error retrieving animation ID: "+id, err)
+		EncodeError(w, "Error retrieving animation", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(animation)
+}
+
+func (s *Server) getActiveAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Signed-out viewers see announcements for everyone and for their tenant
+	userId, _ := GetUserIDFromContext(r.Context())
+	var accountType string
+	if userId != "" {
+		var err error
+		if accountType, err = s.store.GetAccountType(r.Context(), userId); err != nil && err.Error() != "user not found" {
+			LogResponse("/announcements/active", "Error retrieving account type", err)
+			EncodeError(w, "Error retrieving announcements", http.StatusInternalServerError)
+			return
+		}
+	}
+	tenant := TenantFromContext(r.Context())
+
+	announcements, err := s.store.ListActiveAnnouncements(r.Context(), userId)
+	if err != nil {
+		LogResponse("/announcements/active", "Error listing announcements", err)
+		EncodeError(w, "Error retrieving announcements", http.StatusInternalServerError)
+		return
+	}
+	shown := []Announcement{}
+	for _, announcement := range announcements {
+		if announcement.shownTo(accountType, tenant) {
+			announcement.CreatedBy = ""
+			shown = append(shown, announcement)
+		}
+	}
+
+	json.NewEncoder(w).Encode(shown)
+}
+
+func (s *Server) dismissAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	userId, _ := GetUserIDFromContext(r.Context())
+
+	if err := s.store.DismissAnnouncement(r.Context(), id, userId); err != nil {
+		if err.Error() == "announcement not found" {
+			LogResponse("/announcements/{id}/dismiss", "Announcement not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Announcement not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/announcements/{id}/dismiss", "Error dismissing announcement", err)
+		EncodeError(w, "Error dismissing announcement", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/announcements/{id}/dismiss", "Announcement "+strconv.Itoa(id)+" dismissed by user "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	announcements, err := s.store.ListAnnouncements(r.Context())
+	if err != nil {
+		LogResponse("/admin/announcements", "Error listing announcements", err)
+		EncodeError(w, "Error retrieving announcements", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(announcements)
+}
+
+// decodeAnnouncement reads and validates the announcement in an admin's request
+func decodeAnnouncement(w http.ResponseWriter, r *http.Request, endpoint string) (Announcement, bool) {
+	var req AnnouncementRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return Announcement{}, false
+	}
+	announcement, err := ValidateAnnouncement(req, time.Now().UTC())
+	if err != nil {
+		LogResponse(endpoint, "Invalid announcement", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return Announcement{}, false
+	}
+	return announcement, true
+}
+
+func (s *Server) createAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	announcement, ok := decodeAnnouncement(w, r, "/admin/announcements")
+	if !ok {
+		return
+	}
+	announcement.CreatedBy, _ = GetUserIDFromContext(r.Context())
+
+	created, err := s.store.CreateAnnouncement(r.Context(), announcement)
+	if err != nil {
+		LogResponse("/admin/announcements", "Error creating announcement", err)
+		EncodeError(w, "Error creating announcement", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/announcements", "Announcement "+strconv.Itoa(created.ID)+" created for audience "+string(created.Audience), nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) updateAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	announcement, ok := decodeAnnouncement(w, r, "/admin/announcements/{id}")
+	if !ok {
+		return
+	}
+	announcement.ID, _ = strconv.Atoi(mux.Vars(r)["id"])
+
+	updated, err := s.store.UpdateAnnouncement(r.Context(), announcement)
+	if err != nil {
+		if err.Error() == "announcement not found" {
+			LogResponse("/admin/announcements/{id}", "Announcement not found: "+strconv.Itoa(announcement.ID), nil)
+			EncodeError(w, "Announcement not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/announcements/{id}", "Error updating announcement", err)
+		EncodeError(w, "Error updating announcement", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/announcements/{id}", "Announcement "+strconv.Itoa(updated.ID)+" updated", nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *Server) deleteAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := s.store.DeleteAnnouncement(r.Context(), id); err != nil {
+		if err.Error() == "announcement not found" {
+			LogResponse("/admin/announcements/{id}", "Announcement not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Announcement not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/announcements/{id}", "Error deleting announcement", err)
+		EncodeError(w, "Error deleting announcement", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/announcements/{id}", "Announcement "+strconv.Itoa(id)+" deleted", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listMoodRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rules, err := s.store.ListMoodRules(r.Context())
+	if err != nil {
+		LogResponse("/admin/mood-rules", "Error listing mood rules", err)
+		EncodeError(w, "Error retrieving mood rules", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rules)
+}
+
+// decodeMoodRule reads and validates the mood rule in an admin's request
+func (s *Server) decodeMoodRule(w http.ResponseWriter, r *http.Request, endpoint string) (MoodRule, bool) {
+	var req MoodRuleRequest
+	if !decodeRequest(w, r, endpoint, &req) {
+		return MoodRule{}, false
+	}
+	rule, err := ValidateMoodRule(req)
+	if errors.Is(err, ErrInvalidMood) {
+		LogResponse(endpoint, "Invalid mood rule", err)
+		EncodeErrorCode(w, ErrCodeInvalidMood, err.Error(), http.StatusBadRequest)
+		return MoodRule{}, false
+	}
+	if err != nil {
+		LogResponse(endpoint, "Invalid mood rule", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return MoodRule{}, false
+	}
+	for _, action := range rule.Actions {
+		for _, id := range action.AnimationIDs {
+			if !s.store.AnimationExists(r.Context(), id) {
+				LogResponse(endpoint, "Animation not found with ID: "+id, nil)
+				EncodeError(w, "Animation not found: "+id, http.StatusBadRequest)
+				return MoodRule{}, false
+			}
+		}
+	}
+	return rule, true
+}
+
+func (s *Server) createMoodRuleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rule, ok := s.decodeMoodRule(w, r, "/admin/mood-rules")
+	if !ok {
+		return
+	}
+	rule.CreatedBy, _ = GetUserIDFromContext(r.Context())
+
+	created, err := s.store.CreateMoodRule(r.Context(), rule)
+	if err != nil {
+		LogResponse("/admin/mood-rules", "Error creating mood rule", err)
+		EncodeError(w, "Error creating mood rule", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/mood-rules", "Mood rule "+strconv.Itoa(created.ID)+" created for mood "+string(created.Mood), nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) updateMoodRuleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rule, ok := s.decodeMoodRule(w, r, "/admin/mood-rules/{id}")
+	if !ok {
+		return
+	}
+	rule.ID, _ = strconv.Atoi(mux.Vars(r)["id"])
+
+	updated, err := s.store.UpdateMoodRule(r.Context(), rule)
+	if err != nil {
+		if err.Error() == "mood rule not found" {
+			LogResponse("/admin/mood-rules/{id}", "Mood rule not found: "+strconv.Itoa(rule.ID), nil)
+			EncodeError(w, "Mood rule not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/mood-rules/{id}", "Error updating mood rule", err)
+		EncodeError(w, "Error updating mood rule", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/mood-rules/{id}", "Mood rule "+strconv.Itoa(updated.ID)+" updated", nil)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *Server) deleteMoodRuleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := s.store.DeleteMoodRule(r.Context(), id); err != nil {
+		if err.Error() == "mood rule not found" {
+			LogResponse("/admin/mood-rules/{id}", "Mood rule not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Mood rule not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/mood-rules/{id}", "Error deleting mood rule", err)
+		EncodeError(w, "Error deleting mood rule", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/mood-rules/{id}", "Mood rule "+strconv.Itoa(id)+" deleted", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BuildStatus(r.Context(), s.store, time.Now()))
+}
+
+func (s *Server) widgetAnimationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	now := time.Now()
+	animation, err := s.animationOfTheMoment(r.Context(), now)
+	if err != nil {
+		if err.Error() == "no animations found" {
+			LogResponse("/widget/random.json", "No calm animations to show", nil)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		LogResponse("/widget/random.json", "Error retrieving animation of the moment", err)
+		EncodeError(w, "Error retrieving animation", http.StatusInternalServerError)
+		return
+	}
+
+	// Caches expire together at the end of the window, when a new animation is picked
+	setWidgetHeaders(w, int(math.Ceil(animation.ExpiresAt.Sub(now).Seconds())))
+	etag := `"` + animation.ID + "-" + strconv.FormatInt(animation.ExpiresAt.Unix(), 10) + `"`
+	w.Header().Set("ETag", etag)
+	if strings.Contains(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	json.NewEncoder(w).Encode(animation)
+}
+
+func widgetScriptHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	setWidgetHeaders(w, widgetScriptMaxAge)
+	w.Write([]byte(widgetScript))
+}
+
+func (s *Server) createIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req CreateIncidentRequest
+	if !decodeRequest(w, r, "/admin/incidents", &req) {
+		return
+	}
+	incident, err := ValidateIncident(req)
+	if err != nil {
+		LogResponse("/admin/incidents", "Invalid incident", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	incident.CreatedBy, _ = GetUserIDFromContext(r.Context())
+
+	created, err := s.store.CreateIncident(r.Context(), incident, strings.TrimSpace(req.Message))
+	if err != nil {
+		LogResponse("/admin/incidents", "Error creating incident", err)
+		EncodeError(w, "Error creating incident", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/incidents", "Incident "+strconv.Itoa(created.ID)+" opened on "+created.Component, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) addIncidentUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	var req IncidentUpdateRequest
+	if !decodeRequest(w, r, "/admin/incidents/{id}/updates", &req) {
+		return
+	}
+	if err := ValidateIncidentUpdate(req); err != nil {
+		LogResponse("/admin/incidents/{id}/updates", "Invalid incident update", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	incident, err := s.store.AddIncidentUpdate(r.Context(), id, req.Status, strings.TrimSpace(req.Message))
+	if err != nil {
+		switch err.Error() {
+		case "incident not found":
+			LogResponse("/admin/incidents/{id}/updates", "Incident not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Incident not found", http.StatusNotFound)
+		case "incident resolved":
+			LogResponse("/admin/incidents/{id}/updates", "Incident "+strconv.Itoa(id)+" is already resolved", nil)
+			EncodeError(w, "Incident is already resolved", http.StatusConflict)
+		default:
+			LogResponse("/admin/incidents/{id}/updates", "Error updating incident", err)
+			EncodeError(w, "Error updating incident", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	LogResponse("/admin/incidents/{id}/updates", "Incident "+strconv.Itoa(id)+" is now "+incident.Status, nil)
+	json.NewEncoder(w).Encode(incident)
+}
+
+func (s *Server) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Parse the request body
+	var req UpdateProfileRequest
+	if !decodeRequest(w, r, "/profile", &req) {
+		return
+	}
+
+	// Validate request
+	req.Email = strings.TrimSpace(req.Email)
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Email == "" && req.Username == "" {
+		LogResponse("/profile", "Username or email is required", nil)
+		EncodeError(w, "Username or email is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context
+	userId, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		LogResponse("/profile", "User ID missing from context", nil)
+		EncodeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Load the current profile so unchanged fields keep their values
+	previous, err := s.store.GetUserDetails(r.Context(), userId)
+	if err != nil {
+		LogResponse("/profile", "Error retrieving user details", err)
+		EncodeError(w, "Error retrieving user details", http.StatusInternalServerError)
+		return
+	}
+	if req.Email == "" {
+		req.Email = previous.Email
+	}
+	if req.Username == "" {
+		req.Username = previous.Username
+	}
+
+	// Check the new email is not already taken
+	if s.store.EmailInUseByOtherUser(r.Context(), req.Email, userId) {
+		LogResponse("/profile", "Email already in use", nil)
+		EncodeErrorCode(w, ErrCodeEmailInUse, "Email already in use", http.StatusConflict)
+		return
+	}
+
+	// Update the user in the database
+	user, err := s.store.UpdateUserProfile(r.Context(), userId, req.Email, req.Username)
+	if err != nil {
+		LogResponse("/profile", "Error updating profile", err)
+		EncodeError(w, "Error updating profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep an audit trail and let the previous address undo an email change
+	s.recordProfileChanges(r.Context(), previous, user)
+
+	LogResponse("/profile", "Profile updated successfully", nil)
+
+	// Return the refreshed user
+	json.NewEncoder(w).Encode(user)
+}
+
+// recordProfileChanges audits changed profile fields and emails a revert link to the previous address
+func (s *Server) recordProfileChanges(ctx context.Context, previous, updated User) {
+	if previous.Username != updated.Username {
+		if err := s.store.RecordProfileChange(ctx, updated.ID, "username", previous.Username, updated.Username, "", time.Time{}); err != nil {
+			LogResponse("/profile", "Error recording username change", err)
+		}
+	}
+
+	if previous.Email == updated.Email {
+		return
+	}
+
+	revertToken, err := generateRandomID()
+	if err != nil {
+		LogResponse("/profile", "Error generating revert token", err)
+		return
+	}
+
+	revertWindow := EmailChangeRevertWindow()
+	err = s.store.RecordProfileChange(ctx, updated.ID, "email", previous.Email, updated.Email, HashToken(revertToken), time.Now().Add(revertWindow))
+	if err != nil {
+		LogResponse("/profile", "Error recording email change", err)
+		return
+	}
+
+	revertURL := PublicURL("/profile/revert-email?token=" + url.QueryEscape(revertToken))
+	body := "The email address on your Animate account was changed to " + updated.Email + ".\n\n" +
+		"If this wasn't you, open the link below within " + revertWindow.String() + " to restore this address:\n\n" +
+		revertURL + "\n"
+	if err := s.mailer.Send(previous.Email, "Your Animate email address was changed", body); err != nil {
+		LogResponse("/profile", "Error sending email change notice", err)
+	}
+}
+
+// revertEmailPageHandler opens the link sent to the previous address of an email change. It only
+// asks to confirm, so link previews and scanners that fetch the link change nothing.
+func (s *Server) revertEmailPageHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		LogResponse("/profile/revert-email", "Revert token is required", nil)
+		writeRevertEmailPage(w, http.StatusBadRequest, "Link incomplete", "This link is missing its token. Open the link from the email again.", "")
+		return
+	}
+	writeRevertEmailPage(w, http.StatusOK, "Restore your email address?",
+		"Restoring it signs your account out everywhere, including whoever changed the email.", token)
+}
+
+// revertEmailHandler restores the email a revert link was sent to, from the form the link's page posts
+func (s *Server) revertEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := ""
+	if err := r.ParseForm(); err == nil {
+		token = r.PostForm.Get("token")
+	}
+	if token == "" {
+		LogResponse("/profile/revert-email", "Revert token is required", nil)
+		writeRevertEmailPage(w, http.StatusBadRequest, "Link incomplete", "This link is missing its token. Open the link from the email again.", "")
+		return
+	}
+
+	// Restore the previous email and sign the account out everywhere
+	user, err := s.store.RevertEmailChange(r.Context(), HashToken(token))
+	if err != nil {
+		switch err.Error() {
+		case "revert link is invalid or expired":
+			LogResponse("/profile/revert-email", "Invalid or expired revert link", nil)
+			writeRevertEmailPage(w, http.StatusNotFound, "Link expired", "This link was already used or has expired.", "")
+		case "email already in use":
+			LogResponse("/profile/revert-email", "Previous email now belongs to another user", nil)
+			writeRevertEmailPage(w, http.StatusConflict, "Email already in use", "Another account now uses this email address, so it cannot be restored.", "")
+		default:
+			LogResponse("/profile/revert-email", "Error reverting email change", err)
+			writeRevertEmailPage(w, http.StatusInternalServerError, "Something went wrong", "Your email address could not be restored. Try the link again later.", "")
+		}
+		return
+	}
+
+	LogResponse("/profile/revert-email", "Email change reverted for user "+user.ID, nil)
+	writeRevertEmailPage(w, http.StatusOK, "Email address restored",
+		"Your account uses "+user.Email+" again and was signed out everywhere. Sign in again, and change your password if you did not make the change.", "")
+}
+
+func (s *Server) determinismCheckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	LogRequest("/admin/animations/{id}/determinism-check", "Checking animation ID: "+id)
+
+	renderer, ok := GetSketchRenderer()
+	if !ok {
+		LogResponse("/admin/animations/{id}/determinism-check", "Sketch renderer not configured", nil)
+		EncodeError(w, "Sketch renderer not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !s.store.AnimationExists(r.Context(), id) {
+		LogResponse("/admin/animations/{id}/determinism-check", "Animation not found with ID: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := s.checkAnimationDeterminism(r.Context(), renderer, id)
+	if err != nil {
+		LogResponse("/admin/animations/{id}/determinism-check", "Error checking animation ID: "+id, err)
+		EncodeError(w, "Error checking animation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/animations/{id}/determinism-check", "Animation "+id+" is "+report.Status, nil)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) determinismBatchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	renderer, ok := GetSketchRenderer()
+	if !ok {
+		LogResponse("/admin/determinism-checks", "Sketch renderer not configured", nil)
+		EncodeError(w, "Sketch renderer not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			LogResponse("/admin/determinism-checks", "Invalid limit", err)
+			EncodeError(w, "Limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	// Check the oldest animations that have not been rendered yet
+	ids, err := s.store.GetAnimationIDsByRenderStatus(r.Context(), RenderStatusUnchecked, limit)
+	if err != nil {
+		LogResponse("/admin/determinism-checks", "Error retrieving unchecked animations", err)
+		EncodeError(w, "Error retrieving unchecked animations", http.StatusInternalServerError)
+		return
+	}
+
+	reports := make([]DeterminismReport, 0, len(ids))
+	for _, id := range ids {
+		report, err := s.checkAnimationDeterminism(r.Context(), renderer, id)
+		if err != nil {
+			LogResponse("/admin/determinism-checks", "Error checking animation ID: "+id, err)
+			report = DeterminismReport{AnimationID: id, Status: RenderStatusUnchecked, Error: err.Error()}
+		}
+		reports = append(reports, report)
+	}
+
+	LogResponse("/admin/determinism-checks", "Checked "+strconv.Itoa(len(reports))+" animations", nil)
+	json.NewEncoder(w).Encode(reports)
+}
+
+// checkAnimationDeterminism renders a stored animation twice and records the resulting render status
+func (s *Server) checkAnimationDeterminism(ctx context.Context, renderer SketchRenderer, id string) (DeterminismReport, error) {
+	animation, err := s.store.GetAnimation(ctx, id)
+	if err != nil {
+		return DeterminismReport{}, err
+	}
+
+	report, err := CheckDeterminism(ctx, renderer, animation.Code)
+	if err != nil {
+		return DeterminismReport{}, err
+	}
+	report.AnimationID = id
+
+	if err := s.store.SetAnimationRenderStatus(ctx, id, report.Status); err != nil {
+		return DeterminismReport{}, err
+	}
+	if report.Photosensitivity != nil {
+		if err := s.store.SetAnimationPhotosensitivity(ctx, id, *report.Photosensitivity); err != nil {
+			return DeterminismReport{}, err
+		}
+	}
+	return report, nil
+}
+
+func (s *Server) startResanitizeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req StartResanitizeRequest
+	if r.ContentLength != 0 {
+		if !decodeRequest(w, r, "/admin/resanitize", &req) {
+			return
+		}
+	}
+
+	// Only migrations to 2.x are automated; the rewrite rules go from 1.x to 2.x
+	if req.TargetP5Version != "" {
+		if _, err := s.store.GetP5Library(r.Context(), req.TargetP5Version); err != nil {
+			if err.Error() == "p5.js version not found" {
+				LogResponse("/admin/resanitize", "Unknown p5.js version: "+req.TargetP5Version, nil)
+				EncodeError(w, "Unknown p5.js version "+req.TargetP5Version, http.StatusBadRequest)
+				return
+			}
+			LogResponse("/admin/resanitize", "Error looking up p5.js version", err)
+			EncodeError(w, "Error starting re-sanitization", http.StatusInternalServerError)
+			return
+		}
+		if p5Major(req.TargetP5Version) != 2 {
+			LogResponse("/admin/resanitize", "Unsupported migration target: "+req.TargetP5Version, nil)
+			EncodeError(w, "Animations can only be migrated to p5.js 2.x", http.StatusBadRequest)
+			return
+		}
+	}
+
+	adminId, _ := GetUserIDFromContext(r.Context())
+	LogRequest("/admin/resanitize", "Starting re-sanitization run for admin "+adminId)
+
+	runId, err := s.store.CreateSanitizationRun(r.Context(), adminId, req.TargetP5Version)
+	if err != nil {
+		LogResponse("/admin/resanitize", "Error creating re-sanitization run", err)
+		EncodeError(w, "Error starting re-sanitization", http.StatusInternalServerError)
+		return
+	}
+
+	// Scanning every animation can take a while, so it runs after the response is sent, in the
+	// region the run was recorded in
+	go RunResanitization(WithDataRegion(context.Background(), DataRegionFromContext(r.Context())), s.store, runId, req.TargetP5Version)
+
+	LogResponse("/admin/resanitize", "Started re-sanitization run "+strconv.Itoa(runId), nil)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(SanitizationRun{ID: runId, CreatedBy: adminId, Status: "running", TargetP5Version: req.TargetP5Version})
+}
+
+func (s *Server) getResanitizeRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	runId, err := strconv.Atoi(mux.Vars(r)["runId"])
+	if err != nil {
+		LogResponse("/admin/resanitize/{runId}", "Invalid run ID", err)
+		EncodeError(w, "Invalid run ID", http.StatusBadRequest)
+		return
+	}
+
+	run, err := s.store.GetSanitizationRun(r.Context(), runId)
+	if err != nil {
+		if err.Error() == "sanitization run not found" {
+			LogResponse("/admin/resanitize/{runId}", "Re-sanitization run not found: "+strconv.Itoa(runId), nil)
+			EncodeError(w, "Re-sanitization run not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/resanitize/{runId}", "Error retrieving re-sanitization run", err)
+		EncodeError(w, "Error retrieving re-sanitization run", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(run)
+}
+
+// reviewResanitizeFixesHandler approves (and applies) or rejects the selected pending fixes of a run
+func (s *Server) reviewResanitizeFixesHandler(approve bool) http.HandlerFunc {
+	endpoint := "/admin/resanitize/{runId}/reject"
+	if approve {
+		endpoint = "/admin/resanitize/{runId}/approve"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		runId, err := strconv.Atoi(mux.Vars(r)["runId"])
+		if err != nil {
+			LogResponse(endpoint, "Invalid run ID", err)
+			EncodeError(w, "Invalid run ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ReviewSanitizationFixesRequest
+		if r.ContentLength != 0 {
+			if !decodeRequest(w, r, endpoint, &req) {
+				return
+			}
+		}
+
+		adminId, _ := GetUserIDFromContext(r.Context())
+		var updated int
+		if approve {
+			var applied []string
+			applied, err = s.store.ApplySanitizationFixes(r.Context(), runId, req.FixIDs, adminId)
+			updated = len(applied)
+		} else {
+			updated, err = s.store.RejectSanitizationFixes(r.Context(), runId, req.FixIDs, adminId)
+		}
+		if err != nil {
+			LogResponse(endpoint, "Error reviewing fixes for run "+strconv.Itoa(runId), err)
+			EncodeError(w, "Error reviewing fixes", http.StatusInternalServerError)
+			return
+		}
+
+		LogResponse(endpoint, "Reviewed "+strconv.Itoa(updated)+" fixes for run "+strconv.Itoa(runId), nil)
+		json.NewEncoder(w).Encode(ReviewSanitizationFixesResponse{Updated: updated})
+	}
+}
+
+func (s *Server) getContractRunsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := 30
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 365 {
+			LogResponse("/admin/contract-runs", "Invalid limit", err)
+			EncodeError(w, "Limit must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	reports, err := s.store.GetContractRuns(r.Context(), limit)
+	if err != nil {
+		LogResponse("/admin/contract-runs", "Error retrieving contract runs", err)
+		EncodeError(w, "Error retrieving contract runs", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(WithContractTrend(reports))
+}
+
+func (s *Server) promptPlaygroundHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req PromptPlaygroundRequest
+	if !decodeRequest(w, r, "/admin/prompt-playground", &req) {
+		return
+	}
+
+	if err := ValidatePlaygroundRequest(&req); err != nil {
+		LogResponse("/admin/prompt-playground", "Invalid playground request", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	LogRequestFor(r.Context(), "/admin/prompt-playground", "Comparing "+strconv.Itoa(len(req.Variants))+" variants for description: "+RedactDescriptionFor(r.Context(), req.Description))
+
+	claudeAPIKey := GetAPIKey("CLAUDE_API_KEY")
+	if claudeAPIKey == "" {
+		LogResponse("/admin/prompt-playground", "Claude API key not configured", nil)
+		EncodeError(w, "Claude API key not configured", http.StatusInternalServerError)
+		return
+	}
+
+	results := RunPromptPlayground(r.Context(), req, claudeAPIKey)
+
+	LogResponse("/admin/prompt-playground", "Playground variants generated", nil)
+	json.NewEncoder(w).Encode(PromptPlaygroundResponse{Description: req.Description, Results: results})
+}
+
+func (s *Server) createTakedownHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req TakedownReportRequest
+	if !decodeRequest(w, r, "/takedown-requests", &req) {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	LogRequest("/takedown-requests", "Takedown requested for animation ID: "+req.AnimationID)
+
+	if !s.store.AnimationExists(r.Context(), req.AnimationID) {
+		LogResponse("/takedown-requests", "Animation not found with ID: "+req.AnimationID, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+
+	takedown, err := s.store.CreateTakedownRequest(r.Context(), req.AnimationID, req.Name, req.Email, req.Reason)
+	if err != nil {
+		LogResponse("/takedown-requests", "Error creating takedown request", err)
+		EncodeError(w, "Error creating takedown request", http.StatusInternalServerError)
+		return
+	}
+	s.notifyTakedown(r.Context(), takedown)
+
+	LogResponse("/takedown-requests", "Takedown request "+strconv.Itoa(takedown.ID)+" created", nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TakedownRequest{ID: takedown.ID, AnimationID: takedown.AnimationID, Status: takedown.Status, CreatedAt: takedown.CreatedAt})
+}
+
+func (s *Server) appealTakedownHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		LogResponse("/takedown-requests/{id}/appeal", "Invalid takedown request ID", err)
+		EncodeError(w, "Invalid takedown request ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TakedownAppealRequest
+	if !decodeRequest(w, r, "/takedown-requests/{id}/appeal", &req) {
+		return
+	}
+
+	userId, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		LogResponse("/takedown-requests/{id}/appeal", "User ID missing from context", nil)
+		EncodeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Only the uploader can appeal, and unknown requests look the same as other people's
+	takedown, err := s.store.GetTakedownRequest(r.Context(), id)
+	if err != nil && err.Error() != "takedown request not found" {
+		LogResponse("/takedown-requests/{id}/appeal", "Error retrieving takedown request", err)
+		EncodeError(w, "Error retrieving takedown request", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || takedown.UploaderID != userId {
+		LogResponse("/takedown-requests/{id}/appeal", "Takedown request not found for uploader "+userId, nil)
+		EncodeError(w, "Takedown request not found", http.StatusNotFound)
+		return
+	}
+
+	s.applyTakedownTransition(r.Context(), w, "/takedown-requests/{id}/appeal", id, TakedownAppealed, userId, strings.TrimSpace(req.Reason))
+}
+
+func (s *Server) listTakedownsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := r.URL.Query().Get("status")
+	if _, known := takedownTransitions[status]; status != "" && !known && status != TakedownRestored {
+		LogResponse("/admin/takedown-requests", "Invalid status filter: "+status, nil)
+		EncodeError(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	takedowns, err := s.store.ListTakedownRequests(r.Context(), status, 100)
+	if err != nil {
+		LogResponse("/admin/takedown-requests", "Error listing takedown requests", err)
+		EncodeError(w, "Error listing takedown requests", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(takedowns)
+}
+
+// moderationAuditHandler lists the visibility, rating and moderation changes made to an animation,
+// including one that has since been deleted
+func (s *Server) moderationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	entries, err := s.store.ListModerationAudit(r.Context(), id)
+	if err != nil {
+		LogResponse("/admin/animations/{id}/audit", "Error retrieving moderation audit", err)
+		EncodeError(w, "Error retrieving moderation audit", http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 && !s.store.AnimationExists(r.Context(), id) {
+		LogResponse("/admin/animations/{id}/audit", "Animation not found with ID: "+id, nil)
+		EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+		return
+	}
+
+	LogResponse("/admin/animations/{id}/audit", "Listed "+strconv.Itoa(len(entries))+" moderation changes to animation "+id, nil)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *Server) getTakedownHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		LogResponse("/admin/takedown-requests/{id}", "Invalid takedown request ID", err)
+		EncodeError(w, "Invalid takedown request ID", http.StatusBadRequest)
+		return
+	}
+
+	takedown, err := s.store.GetTakedownRequest(r.Context(), id)
+	if err != nil {
+		if err.Error() == "takedown request not found" {
+			LogResponse("/admin/takedown-requests/{id}", "Takedown request not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Takedown request not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/takedown-requests/{id}", "Error retrieving takedown request", err)
+		EncodeError(w, "Error retrieving takedown request", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(takedown)
+}
+
+func (s *Server) transitionTakedownHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		LogResponse("/admin/takedown-requests/{id}/transition", "Invalid takedown request ID", err)
+		EncodeError(w, "Invalid takedown request ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TakedownTransitionRequest
+	if !decodeRequest(w, r, "/admin/takedown-requests/{id}/transition", &req) {
+		return
+	}
+
+	// Appeals can only come from the uploader
+	if req.Status == TakedownAppealed {
+		LogResponse("/admin/takedown-requests/{id}/transition", "Admins cannot file appeals", nil)
+		EncodeError(w, "Only the uploader can appeal", http.StatusBadRequest)
+		return
+	}
+
+	adminId, _ := GetUserIDFromContext(r.Context())
+	s.applyTakedownTransition(r.Context(), w, "/admin/takedown-requests/{id}/transition", id, req.Status, adminId, req.Note)
+}
+
+// applyTakedownTransition moves a takedown request to a new status, notifies the parties and writes the updated request
+func (s *Server) applyTakedownTransition(ctx context.Context, w http.ResponseWriter, endpoint string, id int, status, actor, note string) {
+	takedown, err := s.store.TransitionTakedown(ctx, id, status, actor, note)
+	if err != nil {
+		switch {
+		case err.Error() == "takedown request not found":
+			LogResponse(endpoint, "Takedown request not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Takedown request not found", http.StatusNotFound)
+		case strings.HasPrefix(err.Error(), "cannot move takedown request"):
+			LogResponse(endpoint, "Invalid takedown transition", err)
+			EncodeError(w, err.Error(), http.StatusConflict)
+		default:
+			LogResponse(endpoint, "Error updating takedown request", err)
+			EncodeError(w, "Error updating takedown request", http.StatusInternalServerError)
+		}
+		return
+	}
+	s.invalidateAnimation(ctx, takedown.AnimationID)
+	s.notifyTakedown(ctx, takedown)
+
+	LogResponse(endpoint, "Takedown request "+strconv.Itoa(id)+" is now "+takedown.Status, nil)
+	json.NewEncoder(w).Encode(takedown)
+}
+
+// invalidateAnimation drops cached copies of an animation whose visibility changed outside the store
+func (s *Server) invalidateAnimation(ctx context.Context, id string) {
+	if cached, ok := s.store.(*CachedStore); ok {
+		cached.InvalidateAnimation(ctx, id)
+	}
+}
+
+// notifyTakedown tells the reporter and, when known, the uploader about a takedown request's status
+func (s *Server) notifyTakedown(ctx context.Context, takedown TakedownRequest) {
+	sendTakedownNotices(ctx, s.store, s.mailer, takedown)
+}
+
+func (s *Server) setAccountTypeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId := mux.Vars(r)["id"]
+
+	var req SetAccountTypeRequest
+	if !decodeRequest(w, r, "/admin/users/{id}/account-type", &req) {
+		return
+	}
+
+	if err := s.store.SetAccountType(r.Context(), userId, req.AccountType); err != nil {
+		if err.Error() == "user not found" {
+			LogResponse("/admin/users/{id}/account-type", "User not found: "+userId, nil)
+			EncodeErrorCode(w, ErrCodeUserNotFound, "User not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/users/{id}/account-type", "Error setting account type", err)
+		EncodeError(w, "Error setting account type", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/admin/users/{id}/account-type", "User "+userId+" is now a "+req.AccountType+" account", nil)
+	json.NewEncoder(w).Encode(req)
+}
+
+// clientLinkFor returns the client link named in the request when the user is on the given side of it.
+// Links belonging to other people look the same as unknown ones.
+func (s *Server) clientLinkFor(w http.ResponseWriter, r *http.Request, endpoint, userId string, asProfessional bool) (ClientLink, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["linkId"])
+	if err != nil {
+		LogResponse(endpoint, "Invalid client link ID", err)
+		EncodeError(w, "Invalid client link ID", http.StatusBadRequest)
+		return ClientLink{}, false
+	}
+
+	link, err := s.store.GetClientLink(r.Context(), id)
+	if err != nil && err.Error() != "client link not found" {
+		LogResponse(endpoint, "Error retrieving client link", err)
+		EncodeError(w, "Error retrieving client link", http.StatusInternalServerError)
+		return ClientLink{}, false
+	}
+	owner := link.ClientID
+	if asProfessional {
+		owner = link.ProfessionalID
+	}
+	if err != nil || owner != userId {
+		LogResponse(endpoint, "Client link "+strconv.Itoa(id)+" not found for user "+userId, nil)
+		EncodeError(w, "Client link not found", http.StatusNotFound)
+		return ClientLink{}, false
+	}
+	return link, true
+}
+
+// recordProfessionalAudit adds an entry to a link's audit log. Failures are logged; handlers that
+// disclose client data record the entry themselves and refuse to answer when it fails.
+func (s *Server) recordProfessionalAudit(ctx context.Context, linkId int, actorId, action string) {
+	if err := s.store.RecordProfessionalAudit(ctx, linkId, actorId, action); err != nil {
+		log.Printf("[PROFESSIONAL] Failed to record %s on link %d: %v", action, linkId, err)
+	}
+}
+
+func (s *Server) inviteClientHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ClientInviteRequest
+	if !decodeRequest(w, r, "/professional/invites", &req) {
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	professional, err := s.store.GetUserDetails(r.Context(), userId)
+	if err != nil {
+		LogResponse("/professional/invites", "Error retrieving user details", err)
+		EncodeError(w, "Error retrieving user details", http.StatusInternalServerError)
+		return
+	}
+
+	// Store only the hash of the single-use token; the client receives it by email
+	token, err := generateRandomID()
+	if err != nil {
+		LogResponse("/professional/invites", "Error generating invite token", err)
+		EncodeError(w, "Error creating invite", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(ClientInviteTTL())
+	link, err := s.store.CreateClientInvite(r.Context(), userId, req.Email, HashToken(token), expiresAt)
+	if err != nil {
+		LogResponse("/professional/invites", "Error creating invite", err)
+		EncodeError(w, "Error creating invite", http.StatusInternalServerError)
+		return
+	}
+	s.recordProfessionalAudit(r.Context(), link.ID, userId, AuditClientInvited)
+	sendClientInvite(req.Email, professional.Username, token, expiresAt)
+
+	LogResponse("/professional/invites", "Client invite "+strconv.Itoa(link.ID)+" sent", nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+func (s *Server) listClientsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	links, err := s.store.ListProfessionalClients(r.Context(), userId)
+	if err != nil {
+		LogResponse("/professional/clients", "Error listing clients", err)
+		EncodeError(w, "Error listing clients", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(links)
+}
+
+func (s *Server) endClientLinkByProfessionalHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/professional/clients/{linkId}", userId, true)
+	if !ok {
+		return
+	}
+	s.endClientLink(w, r, "/professional/clients/{linkId}", link, userId, AuditLinkEndedByPro)
+}
+
+// endClientLink ends a link from either side, which withdraws any consent to share mood trends
+func (s *Server) endClientLink(w http.ResponseWriter, r *http.Request, endpoint string, link ClientLink, userId, action string) {
+	if err := s.store.EndClientLink(r.Context(), link.ID); err != nil {
+		LogResponse(endpoint, "Error ending client link", err)
+		EncodeError(w, "Error ending client link", http.StatusInternalServerError)
+		return
+	}
+	s.recordProfessionalAudit(r.Context(), link.ID, userId, action)
+
+	LogResponse(endpoint, "Client link "+strconv.Itoa(link.ID)+" ended by "+userId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) assignSessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/professional/clients/{linkId}/sessions", userId, true)
+	if !ok {
+		return
+	}
+
+	var req AssignSessionRequest
+	if !decodeRequest(w, r, "/professional/clients/{linkId}/sessions", &req) {
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxSessionNoteLength {
+		LogResponse("/professional/clients/{linkId}/sessions", "Session note too long", nil)
+		EncodeError(w, "Note must be at most "+strconv.Itoa(maxSessionNoteLength)+" characters", http.StatusBadRequest)
+		return
+	}
+	if link.Status != ClientLinkActive {
+		LogResponse("/professional/clients/{linkId}/sessions", "Client link "+strconv.Itoa(link.ID)+" is "+link.Status, nil)
+		EncodeError(w, "Sessions can only be assigned to active clients", http.StatusConflict)
+		return
+	}
+
+	session, err := s.store.AssignSession(r.Context(), link.ID, req.AnimationID, req.Note)
+	if err != nil {
+		if err.Error() == "animation not found" {
+			LogResponse("/professional/clients/{linkId}/sessions", "Animation not found with ID: "+req.AnimationID, nil)
+			EncodeErrorCode(w, ErrCodeAnimationNotFound, "Animation not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/professional/clients/{linkId}/sessions", "Error assigning session", err)
+		EncodeError(w, "Error assigning session", http.StatusInternalServerError)
+		return
+	}
+	s.recordProfessionalAudit(r.Context(), link.ID, userId, AuditSessionAssigned)
+
+	LogResponse("/professional/clients/{linkId}/sessions", "Session "+strconv.Itoa(session.ID)+" assigned on link "+strconv.Itoa(link.ID), nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+func (s *Server) listLinkSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/professional/clients/{linkId}/sessions", userId, true)
+	if !ok {
+		return
+	}
+
+	sessions, err := s.store.ListLinkSessions(r.Context(), link.ID)
+	if err != nil {
+		LogResponse("/professional/clients/{linkId}/sessions", "Error listing sessions", err)
+		EncodeError(w, "Error listing sessions", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (s *Server) clientMoodTrendsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/professional/clients/{linkId}/mood-trends", userId, true)
+	if !ok {
+		return
+	}
+
+	weeks := defaultMoodTrendWeeks
+	if raw := r.URL.Query().Get("weeks"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxMoodTrendWeeks {
+			LogResponse("/professional/clients/{linkId}/mood-trends", "Invalid weeks: "+raw, err)
+			EncodeError(w, "weeks must be between 1 and "+strconv.Itoa(maxMoodTrendWeeks), http.StatusBadRequest)
+			return
+		}
+		weeks = n
+	}
+
+	if link.Status != ClientLinkActive || !link.ShareMoodTrends {
+		LogResponse("/professional/clients/{linkId}/mood-trends", "Client on link "+strconv.Itoa(link.ID)+" has not consented to share mood trends", nil)
+		EncodeError(w, "The client has not agreed to share their mood trends", http.StatusForbidden)
+		return
+	}
+
+	// Every view is audited before anything is disclosed
+	if err := s.store.RecordProfessionalAudit(r.Context(), link.ID, userId, AuditMoodTrendsViewed); err != nil {
+		LogResponse("/professional/clients/{linkId}/mood-trends", "Error recording audit entry", err)
+		EncodeError(w, "Error retrieving mood trends", http.StatusInternalServerError)
+		return
+	}
+
+	since := weekStart(time.Now()).AddDate(0, 0, -7*(weeks-1))
+	trends, err := s.store.GetMoodTrends(r.Context(), link.ClientID, since)
+	if err != nil {
+		LogResponse("/professional/clients/{linkId}/mood-trends", "Error retrieving mood trends", err)
+		EncodeError(w, "Error retrieving mood trends", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/professional/clients/{linkId}/mood-trends", "Mood trends for link "+strconv.Itoa(link.ID)+" viewed by "+userId, nil)
+	json.NewEncoder(w).Encode(trends)
+}
+
+// serveMonthlyReport answers with the user's monthly report for the month query parameter once it
+// is rendered, and with 202 while it renders in the background. disclose, when set, runs just
+// before the report is sent, and the report is withheld if it fails.
+func (s *Server) serveMonthlyReport(w http.ResponseWriter, r *http.Request, endpoint, userId string, disclose func() error) {
+	now := time.Now()
+	month, err := parseUsageMonth(r.URL.Query().Get("month"), now)
+	if err != nil {
+		LogResponse(endpoint, "Invalid month", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if month.After(now) {
+		LogResponse(endpoint, "Report requested for a future month: "+month.Format(usageMonthLayout), nil)
+		EncodeError(w, "month must not be in the future", http.StatusBadRequest)
+		return
+	}
+
+	pdf, ready, err := s.reports.fetch(userId+"/"+month.Format(usageMonthLayout), func(ctx context.Context) ([]byte, error) {
+		report, err := buildMonthlyReport(ctx, s.store, userId, month, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return renderMonthlyReport(report), nil
+	})
+	if err != nil {
+		LogResponse(endpoint, "Error rendering monthly report for user "+userId, err)
+		EncodeError(w, "Error rendering monthly report", http.StatusInternalServerError)
+		return
+	}
+	if !ready {
+		w.Header().Set("Retry-After", strconv.Itoa(reportRetryAfter))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(MonthlyReportStatus{Month: month.Format(usageMonthLayout), Status: "pending"})
+		return
+	}
+	if disclose != nil {
+		if err := disclose(); err != nil {
+			LogResponse(endpoint, "Error recording report disclosure", err)
+			EncodeError(w, "Error retrieving monthly report", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	LogResponse(endpoint, "Monthly report for user "+userId+" served", nil)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="wellbeing-report-`+month.Format(usageMonthLayout)+`.pdf"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(pdf)
+}
+
+func (s *Server) monthlyReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	s.serveMonthlyReport(w, r, "/me/reports/monthly.pdf", userId, nil)
+}
+
+// clientMonthlyReportHandler shares a client's monthly report with their professional, on the
+// same consent as their mood trends
+func (s *Server) clientMonthlyReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/professional/clients/{linkId}/reports/monthly.pdf", userId, true)
+	if !ok {
+		return
+	}
+	if link.Status != ClientLinkActive || !link.ShareMoodTrends {
+		LogResponse("/professional/clients/{linkId}/reports/monthly.pdf", "Client on link "+strconv.Itoa(link.ID)+" has not consented to share mood trends", nil)
+		EncodeError(w, "The client has not agreed to share their mood trends", http.StatusForbidden)
+		return
+	}
+
+	// Polls while the report renders disclose nothing, so only the one that gets it is audited
+	s.serveMonthlyReport(w, r, "/professional/clients/{linkId}/reports/monthly.pdf", link.ClientID, func() error {
+		return s.store.RecordProfessionalAudit(r.Context(), link.ID, userId, AuditReportViewed)
+	})
+}
+
+// createCalendarFeedHandler issues the token a calendar app subscribes to the user's mood
+// check-ins with, replacing the one they had so the old address stops working
+func (s *Server) createCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	token, tokenHash, err := newCalendarToken()
+	if err != nil {
+		LogResponse("/me/calendar-feed", "Error generating calendar token", err)
+		EncodeError(w, "Error creating calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.SetCalendarFeedToken(r.Context(), userId, tokenHash); err != nil {
+		LogResponse("/me/calendar-feed", "Error saving calendar feed for user "+userId, err)
+		EncodeError(w, "Error creating calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CalendarFeed{URL: PublicURL("/me/moods.ics?token=" + url.QueryEscape(token)), Token: token})
+}
+
+func (s *Server) deleteCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	if err := s.store.DeleteCalendarFeedToken(r.Context(), userId); err != nil {
+		if err.Error() == "calendar feed not found" {
+			LogResponse("/me/calendar-feed", "No calendar feed for user "+userId, nil)
+			EncodeError(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/calendar-feed", "Error deleting calendar feed for user "+userId, err)
+		EncodeError(w, "Error deleting calendar feed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moodCalendarHandler serves a user's mood check-ins as an iCalendar feed. Calendar apps cannot
+// sign in, so the feed is found by the secret token in its address instead.
+func (s *Server) moodCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		LogResponse("/me/moods.ics", "Calendar token is required", nil)
+		EncodeError(w, "Calendar token is required", http.StatusBadRequest)
+		return
+	}
+	userId, err := s.store.GetCalendarFeedUser(r.Context(), HashToken(token))
+	if err != nil {
+		if err.Error() == "calendar feed not found" {
+			LogResponse("/me/moods.ics", "Unknown calendar token", nil)
+			EncodeError(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/moods.ics", "Error finding calendar feed", err)
+		EncodeError(w, "Error retrieving calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	user, err := s.store.GetUserDetails(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/moods.ics", "Error retrieving user "+userId, err)
+		EncodeError(w, "Error retrieving calendar feed", http.StatusInternalServerError)
+		return
+	}
+	moods, err := listCalendarMoods(r.Context(), s.store, userId, now)
+	if err != nil {
+		LogResponse("/me/moods.ics", "Error listing moods for user "+userId, err)
+		EncodeError(w, "Error retrieving calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="moods.ics"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(renderMoodCalendar(userId, user.Username, moods, now))
+}
+
+// teamIntegrationWorkspace returns the workspace of the signed-in user, whose integrations the
+// /integrations routes manage. Only its owner may change them. It answers the request itself and
+// returns false when the user has no workspace or may not do this.
+func (s *Server) teamIntegrationWorkspace(w http.ResponseWriter, r *http.Request, userId string, ownerOnly bool) (Organization, bool) {
+	org, err := s.store.GetUserOrganization(r.Context(), userId)
+	if err != nil {
+		if err.Error() == "organization not found" {
+			LogResponse("/integrations/{platform}", "User "+userId+" is not in an organization", nil)
+			EncodeError(w, "You are not in a workspace", http.StatusNotFound)
+			return Organization{}, false
+		}
+		LogResponse("/integrations/{platform}", "Error retrieving organization", err)
+		EncodeError(w, "Error retrieving organization", http.StatusInternalServerError)
+		return Organization{}, false
+	}
+	if ownerOnly && !org.IsOwner(userId) && !IsAdmin(userId) {
+		LogResponse("/integrations/{platform}", "User "+userId+" does not own organization "+strconv.Itoa(org.ID), nil)
+		EncodeError(w, "Only the workspace owner may do this", http.StatusForbidden)
+		return Organization{}, false
+	}
+	return org, true
+}
+
+// saveTeamIntegrationHandler configures the workspace's Slack or Discord integration, replacing
+// the one it had with the platform. A Discord integration gets a new relay secret each time.
+func (s *Server) saveTeamIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.teamIntegrationWorkspace(w, r, userId, true)
+	if !ok {
+		return
+	}
+
+	var req TeamIntegrationRequest
+	if !decodeRequest(w, r, "/integrations/{platform}", &req) {
+		return
+	}
+	platform := mux.Vars(r)["platform"]
+	integration, err := ValidateTeamIntegration(platform, req)
+	if err != nil {
+		LogResponse("/integrations/{platform}", "Invalid "+platform+" integration", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := generateRandomID()
+	if err == nil && platform == PlatformDiscord {
+		integration.Secret, err = generateRandomID()
+	}
+	if err != nil {
+		LogResponse("/integrations/{platform}", "Error generating integration ID", err)
+		EncodeError(w, "Error saving integration", http.StatusInternalServerError)
+		return
+	}
+	integration.ID, integration.OrganizationID, integration.CreatedBy = id, org.ID, userId
+	nextPostAt := integration.nextPost(time.Now())
+	integration.NextPostAt = &nextPostAt
+
+	saved, err := s.store.SaveTeamIntegration(r.Context(), integration)
+	if err != nil {
+		LogResponse("/integrations/{platform}", "Error saving "+platform+" integration for organization "+strconv.Itoa(org.ID), err)
+		EncodeError(w, "Error saving integration", http.StatusInternalServerError)
+		return
+	}
+
+	saved.EventsURL = PublicURL("/integrations/" + platform + "/events/" + saved.ID)
+	if platform == PlatformDiscord {
+		saved.RelaySecret = integration.Secret
+	}
+	LogResponse("/integrations/{platform}", "Organization "+strconv.Itoa(org.ID)+" configured its "+platform+" integration", nil)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// teamIntegrationReportHandler shows the workspace's integration with its latest posts. Moods are
+// only shown for posts enough teammates reacted to.
+func (s *Server) teamIntegrationReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.teamIntegrationWorkspace(w, r, userId, false)
+	if !ok {
+		return
+	}
+	platform := mux.Vars(r)["platform"]
+	integration, err := s.store.GetTeamIntegration(r.Context(), org.ID, platform)
+	if err != nil {
+		if err.Error() == "team integration not found" {
+			LogResponse("/integrations/{platform}", "No "+platform+" integration for organization "+strconv.Itoa(org.ID), nil)
+			EncodeError(w, "Integration not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/integrations/{platform}", "Error retrieving "+platform+" integration", err)
+		EncodeError(w, "Error retrieving integration", http.StatusInternalServerError)
+		return
+	}
+	posts, err := s.store.ListTeamPosts(r.Context(), integration.ID, teamReportPosts)
+	if err != nil {
+		LogResponse("/integrations/{platform}", "Error listing posts of integration "+integration.ID, err)
+		EncodeError(w, "Error retrieving integration", http.StatusInternalServerError)
+		return
+	}
+	for i := range posts {
+		posts[i].Moods = SummarizeMoods(posts[i].Counts, minTeamMoodReactions)
+	}
+
+	integration.EventsURL = PublicURL("/integrations/" + platform + "/events/" + integration.ID)
+	json.NewEncoder(w).Encode(TeamIntegrationReport{Integration: integration, Posts: posts})
+}
+
+func (s *Server) deleteTeamIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	org, ok := s.teamIntegrationWorkspace(w, r, userId, true)
+	if !ok {
+		return
+	}
+	platform := mux.Vars(r)["platform"]
+	if err := s.store.DeleteTeamIntegration(r.Context(), org.ID, platform); err != nil {
+		if err.Error() == "team integration not found" {
+			LogResponse("/integrations/{platform}", "No "+platform+" integration for organization "+strconv.Itoa(org.ID), nil)
+			EncodeError(w, "Integration not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/integrations/{platform}", "Error deleting "+platform+" integration", err)
+		EncodeError(w, "Error deleting integration", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// teamEventsHandler receives reactions to an integration's posts: Slack's Events API requests,
+// signed with the app's signing secret, or Discord reactions forwarded by a relay, signed with the
+// integration's relay secret. Reactions that are not moods are acknowledged and ignored.
+func (s *Server) teamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	integration, err := s.store.GetTeamIntegrationByID(r.Context(), vars["id"])
+	if err == nil && integration.Platform != vars["platform"] {
+		err = errors.New("team integration not found")
+	}
+	if err != nil {
+		if err.Error() == "team integration not found" {
+			LogResponse("/integrations/{platform}/events/{id}", "Unknown integration "+vars["id"], nil)
+			EncodeError(w, "Integration not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/integrations/{platform}/events/{id}", "Error retrieving integration", err)
+		EncodeError(w, "Error retrieving integration", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTeamEventBytes))
+	if err != nil {
+		LogResponse("/integrations/{platform}/events/{id}", "Error reading event", err)
+		EncodeError(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if integration.Platform == PlatformSlack {
+		err = verifySlackSignature(integration.Secret, r.Header.Get("X-Slack-Request-Timestamp"), r.Header.Get("X-Slack-Signature"), body, time.Now())
+	} else {
+		err = verifyRelaySignature(integration.Secret, r.Header.Get("X-Signature-256"), body)
+	}
+	if err != nil {
+		LogResponse("/integrations/{platform}/events/{id}", "Rejected event for integration "+integration.ID, err)
+		EncodeError(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if integration.Platform == PlatformSlack {
+		var event slackEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			LogResponse("/integrations/{platform}/events/{id}", "Invalid Slack event", err)
+			EncodeError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		if event.Type == "url_verification" {
+			json.NewEncoder(w).Encode(map[string]string{"challenge": event.Challenge})
+			return
+		}
+		if event.Type == "event_callback" && event.Event.Item.Type == "message" &&
+			(event.Event.Type == "reaction_added" || event.Event.Type == "reaction_removed") {
+			at, err := slackTimestamp(event.Event.Item.TS)
+			if err == nil {
+				err = applyTeamReaction(r.Context(), s.store, integration, "", at, event.Event.User, event.Event.Reaction, event.Event.Type == "reaction_removed")
+			}
+			if err != nil {
+				LogResponse("/integrations/{platform}/events/{id}", "Error recording reaction for integration "+integration.ID, err)
+				EncodeError(w, "Error recording reaction", http.StatusInternalServerError)
+				return
+			}
+		}
+	} else {
+		var reaction TeamReaction
+		if err := json.Unmarshal(body, &reaction); err != nil || reaction.MessageID == "" {
+			LogResponse("/integrations/{platform}/events/{id}", "Invalid relayed reaction", err)
+			EncodeError(w, "messageId is required", http.StatusBadRequest)
+			return
+		}
+		if err := applyTeamReaction(r.Context(), s.store, integration, reaction.MessageID, time.Time{}, reaction.UserID, reaction.Emoji, reaction.Removed); err != nil {
+			LogResponse("/integrations/{platform}/events/{id}", "Error recording reaction for integration "+integration.ID, err)
+			EncodeError(w, "Error recording reaction", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("{}"))
+}
+
+func (s *Server) createIntegrationKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	var req IntegrationKeyRequest
+	if !decodeRequest(w, r, "/me/integration-keys", &req) {
+		return
+	}
+	key, err := ValidateIntegrationKey(req)
+	if err != nil {
+		LogResponse("/me/integration-keys", "Invalid integration key", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := s.store.ListIntegrationKeys(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/integration-keys", "Error listing integration keys for user "+userId, err)
+		EncodeError(w, "Error saving integration key", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxIntegrationKeys {
+		LogResponse("/me/integration-keys", "User "+userId+" holds too many integration keys", nil)
+		EncodeError(w, "You may hold at most "+strconv.Itoa(maxIntegrationKeys)+" integration keys", http.StatusConflict)
+		return
+	}
+
+	secret, hash, err := newIntegrationKey()
+	if err != nil {
+		LogResponse("/me/integration-keys", "Error generating integration key", err)
+		EncodeError(w, "Error generating integration key", http.StatusInternalServerError)
+		return
+	}
+	created, err := s.store.CreateIntegrationKey(r.Context(), userId, key, hash)
+	if err != nil {
+		LogResponse("/me/integration-keys", "Error saving integration key", err)
+		EncodeError(w, "Error saving integration key", http.StatusInternalServerError)
+		return
+	}
+
+	// The key is only ever shown here
+	created.Key = secret
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listIntegrationKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	keys, err := s.store.ListIntegrationKeys(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/integration-keys", "Error listing integration keys for user "+userId, err)
+		EncodeError(w, "Error retrieving integration keys", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(IntegrationKeysResponse{Keys: keys})
+}
+
+func (s *Server) deleteIntegrationKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := s.store.DeleteIntegrationKey(r.Context(), id, userId); err != nil {
+		if err.Error() == "integration key not found" {
+			LogResponse("/me/integration-keys/{id}", "Integration key not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Integration key not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/integration-keys/{id}", "Error deleting integration key", err)
+		EncodeError(w, "Error deleting integration key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listTriggersHandler tells a no-code tool whose integration key it holds and which triggers it
+// may poll, so tools can test a key when it is connected
+func (s *Server) listTriggersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	user, err := s.store.GetUserDetails(r.Context(), userId)
+	if err != nil {
+		LogResponse("/integrations/triggers", "Error retrieving user "+userId, err)
+		EncodeError(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(TriggersResponse{UserID: userId, Username: user.Username, Events: TriggerEvents})
+}
+
+// triggerHandler answers a no-code tool polling for what the key's owner saved since its last
+// poll. Tools pass the nextCursor of one poll as since on the next.
+func (s *Server) triggerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	event := mux.Vars(r)["event"]
+	since := r.URL.Query().Get("since")
+	cursor, err := ParseTriggerSince(since)
+	if err != nil {
+		LogResponse("/integrations/triggers/{event}", "Invalid since", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var items []TriggerItem
+	switch event {
+	case TriggerNewAnimation:
+		var animations []UserAnimation
+		if animations, err = s.store.ListAnimationsAfter(r.Context(), userId, cursor, triggerPageSize); err == nil {
+			items = animationTriggerItems(animations)
+		}
+	case TriggerNewMood:
+		var moods []MoodEntry
+		if moods, err = s.store.ListMoodsAfter(r.Context(), userId, cursor, triggerPageSize); err == nil {
+			items = moodTriggerItems(moods)
+		}
+	default:
+		LogResponse("/integrations/triggers/{event}", "Unknown trigger "+event, nil)
+		EncodeError(w, "Unknown trigger event", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		LogResponse("/integrations/triggers/{event}", "Error listing "+event+" for user "+userId, err)
+		EncodeError(w, "Error retrieving trigger", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(triggerResponse(event, items, since))
+}
+
+func (s *Server) acceptClientInviteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req AcceptClientInviteRequest
+	if !decodeRequest(w, r, "/me/professionals/accept", &req) {
+		return
+	}
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, err := s.store.AcceptClientInvite(r.Context(), HashToken(strings.TrimSpace(req.Token)), userId, req.ShareMoodTrends)
+	if err != nil {
+		switch err.Error() {
+		case "invite is invalid or expired":
+			LogResponse("/me/professionals/accept", "Invalid or expired invite for user "+userId, nil)
+			EncodeError(w, "This invite is invalid or has expired", http.StatusNotFound)
+		case "cannot link to yourself", "client already linked":
+			LogResponse("/me/professionals/accept", "Invite not accepted for user "+userId+": "+err.Error(), nil)
+			EncodeError(w, "You are already linked to this professional", http.StatusConflict)
+		default:
+			LogResponse("/me/professionals/accept", "Error accepting invite", err)
+			EncodeError(w, "Error accepting invite", http.StatusInternalServerError)
+		}
+		return
+	}
+	s.recordProfessionalAudit(r.Context(), link.ID, userId, AuditInviteAccepted)
+	if link.ShareMoodTrends {
+		s.recordProfessionalAudit(r.Context(), link.ID, userId, AuditConsentGranted)
+	}
+
+	LogResponse("/me/professionals/accept", "User "+userId+" accepted client link "+strconv.Itoa(link.ID), nil)
+	json.NewEncoder(w).Encode(link)
+}
+
+func (s *Server) listMyProfessionalsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	links, err := s.store.ListClientProfessionals(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/professionals", "Error listing professionals", err)
+		EncodeError(w, "Error listing professionals", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(links)
+}
+
+func (s *Server) setMoodTrendConsentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/me/professionals/{linkId}/consent", userId, false)
+	if !ok {
+		return
+	}
+
+	var req MoodTrendConsentRequest
+	if !decodeRequest(w, r, "/me/professionals/{linkId}/consent", &req) {
+		return
+	}
+
+	if err := s.store.SetMoodTrendConsent(r.Context(), link.ID, req.ShareMoodTrends); err != nil {
+		if err.Error() == "client link not active" {
+			LogResponse("/me/professionals/{linkId}/consent", "Client link "+strconv.Itoa(link.ID)+" is not active", nil)
+			EncodeError(w, "This link has ended", http.StatusConflict)
+			return
+		}
+		LogResponse("/me/professionals/{linkId}/consent", "Error updating consent", err)
+		EncodeError(w, "Error updating consent", http.StatusInternalServerError)
+		return
+	}
+	action := AuditConsentRevoked
+	if req.ShareMoodTrends {
+		action = AuditConsentGranted
+	}
+	s.recordProfessionalAudit(r.Context(), link.ID, userId, action)
+
+	link.ShareMoodTrends = req.ShareMoodTrends
+	LogResponse("/me/professionals/{linkId}/consent", "Mood trend sharing on link "+strconv.Itoa(link.ID)+" set to "+strconv.FormatBool(req.ShareMoodTrends), nil)
+	json.NewEncoder(w).Encode(link)
+}
+
+func (s *Server) endClientLinkByClientHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/me/professionals/{linkId}", userId, false)
+	if !ok {
+		return
+	}
+	s.endClientLink(w, r, "/me/professionals/{linkId}", link, userId, AuditLinkEndedByClient)
+}
+
+func (s *Server) clientLinkAuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	link, ok := s.clientLinkFor(w, r, "/me/professionals/{linkId}/audit", userId, false)
+	if !ok {
+		return
+	}
+
+	entries, err := s.store.ListProfessionalAudit(r.Context(), link.ID)
+	if err != nil {
+		LogResponse("/me/professionals/{linkId}/audit", "Error listing audit entries", err)
+		EncodeError(w, "Error listing audit entries", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *Server) listMySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	sessions, err := s.store.ListClientSessions(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/sessions", "Error listing sessions", err)
+		EncodeError(w, "Error listing sessions", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (s *Server) createOAuthAppHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	var req OAuthAppRequest
+	if !decodeRequest(w, r, "/me/oauth-apps", &req) {
+		return
+	}
+	app, err := ValidateOAuthApp(req)
+	if err != nil {
+		LogResponse("/me/oauth-apps", "Invalid OAuth app", err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := s.store.ListOAuthApps(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/oauth-apps", "Error listing OAuth apps for user "+userId, err)
+		EncodeError(w, "Error saving app", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxOAuthApps {
+		LogResponse("/me/oauth-apps", "User "+userId+" registered too many OAuth apps", nil)
+		EncodeError(w, "You may register at most "+strconv.Itoa(maxOAuthApps)+" apps", http.StatusConflict)
+		return
+	}
+
+	if app.ClientID, err = generateRandomID(); err != nil {
+		LogResponse("/me/oauth-apps", "Error generating client ID", err)
+		EncodeError(w, "Error generating client ID", http.StatusInternalServerError)
+		return
+	}
+	created, err := s.store.CreateOAuthApp(r.Context(), userId, app)
+	if err != nil {
+		LogResponse("/me/oauth-apps", "Error saving OAuth app", err)
+		EncodeError(w, "Error saving app", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) listOAuthAppsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	apps, err := s.store.ListOAuthApps(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/oauth-apps", "Error listing OAuth apps for user "+userId, err)
+		EncodeError(w, "Error retrieving apps", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(OAuthAppsResponse{Apps: apps})
+}
+
+func (s *Server) deleteOAuthAppHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	clientId := mux.Vars(r)["clientId"]
+	if err := s.store.DeleteOAuthApp(r.Context(), clientId, userId); err != nil {
+		if err.Error() == "oauth app not found" {
+			LogResponse("/me/oauth-apps/{clientId}", "OAuth app not found: "+clientId, nil)
+			EncodeError(w, "App not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/oauth-apps/{clientId}", "Error deleting OAuth app", err)
+		EncodeError(w, "Error deleting app", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// oauthAuthorizeRequest reads the parameters of an app's authorization request from the query
+// string the app sent the user with
+func oauthAuthorizeRequest(query url.Values) OAuthAuthorizeRequest {
+	return OAuthAuthorizeRequest{
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// checkOAuthAuthorizeRequest looks up the app of an authorization request and checks the request
+// against it, answering the problem when there is one. Problems are answered to the user rather
+// than sent to the redirect URI, which may not be the app's.
+func (s *Server) checkOAuthAuthorizeRequest(w http.ResponseWriter, r *http.Request, req OAuthAuthorizeRequest) (OAuthApp, []string, bool) {
+	app, err := s.store.GetOAuthApp(r.Context(), req.ClientID)
+	if err != nil {
+		if err.Error() == "oauth app not found" {
+			LogResponse("/oauth/authorize", "OAuth app not found: "+req.ClientID, nil)
+			EncodeError(w, "Unknown client_id", http.StatusBadRequest)
+			return OAuthApp{}, nil, false
+		}
+		LogResponse("/oauth/authorize", "Error retrieving OAuth app", err)
+		EncodeError(w, "Error retrieving app", http.StatusInternalServerError)
+		return OAuthApp{}, nil, false
+	}
+	scopes, err := checkOAuthAuthorization(app, req)
+	if err != nil {
+		LogResponse("/oauth/authorize", "Invalid authorization request for app "+app.ClientID, err)
+		EncodeError(w, err.Error(), http.StatusBadRequest)
+		return OAuthApp{}, nil, false
+	}
+	return app, scopes, true
+}
+
+// oauthConsentHandler checks the authorization request an app sent the signed-in user with, taken
+// as query parameters, and returns what the consent screen shows them
+func (s *Server) oauthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req := oauthAuthorizeRequest(r.URL.Query())
+	if responseType := r.URL.Query().Get("response_type"); responseType != "code" {
+		LogResponse("/oauth/authorize", "Unsupported response type "+responseType, nil)
+		EncodeError(w, "response_type must be code", http.StatusBadRequest)
+		return
+	}
+	app, scopes, ok := s.checkOAuthAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(OAuthConsent{
+		ClientID:    app.ClientID,
+		AppName:     app.Name,
+		Scopes:      describeOAuthScopes(scopes),
+		RedirectURI: req.RedirectURI,
+		State:       req.State,
+	})
+}
+
+// oauthAuthorizeHandler records the signed-in user's answer on the consent screen and returns
+// where to send them back to the app: with an authorization code when they approved, or with
+// access_denied when they did not
+func (s *Server) oauthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	var req OAuthAuthorizeRequest
+	if !decodeRequest(w, r, "/oauth/authorize", &req) {
+		return
+	}
+	app, scopes, ok := s.checkOAuthAuthorizeRequest(w, r, req)
+	if !ok {
+		return
+	}
+
+	if !req.Approve {
+		LogResponse("/oauth/authorize", "User "+userId+" denied app "+app.ClientID, nil)
+		redirect := oauthRedirect(req.RedirectURI, url.Values{"error": {"access_denied"}, "state": {req.State}})
+		json.NewEncoder(w).Encode(OAuthAuthorizeResponse{RedirectTo: redirect})
+		return
+	}
+
+	code, codeHash, err := newOAuthSecret(oauthCodePrefix)
+	if err != nil {
+		LogResponse("/oauth/authorize", "Error generating authorization code", err)
+		EncodeError(w, "Error generating authorization code", http.StatusInternalServerError)
+		return
+	}
+	authorization := OAuthAuthorization{
+		ClientID:      app.ClientID,
+		UserID:        userId,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(oauthCodeLifetime),
+	}
+	if err := s.store.SaveOAuthCode(r.Context(), codeHash, authorization); err != nil {
+		LogResponse("/oauth/authorize", "Error saving authorization code", err)
+		EncodeError(w, "Error saving authorization code", http.StatusInternalServerError)
+		return
+	}
+
+	LogResponse("/oauth/authorize", "User "+userId+" let app "+app.ClientID+" in with "+strings.Join(scopes, " "), nil)
+	redirect := oauthRedirect(req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+	json.NewEncoder(w).Encode(OAuthAuthorizeResponse{RedirectTo: redirect})
+}
+
+// oauthTokenHandler is the token endpoint apps exchange authorization codes and refresh tokens at,
+// with form-encoded parameters as RFC 6749 has them. Each refresh replaces both tokens.
+func (s *Server) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		encodeOAuthError(w, "invalid_request", "Invalid form body", http.StatusBadRequest)
+		return
+	}
+	clientId := r.PostForm.Get("client_id")
+	if clientId == "" {
+		encodeOAuthError(w, "invalid_request", "client_id is required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var token OAuthToken
+	var response OAuthTokenResponse
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		authorization, err := s.store.ConsumeOAuthCode(r.Context(), HashToken(r.PostForm.Get("code")))
+		if err != nil && err.Error() != "oauth code not found" {
+			LogResponse("/oauth/token", "Error retrieving authorization code", err)
+			encodeOAuthError(w, "server_error", "Error retrieving authorization code", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || !now.Before(authorization.ExpiresAt) || authorization.ClientID != clientId ||
+			authorization.RedirectURI != r.PostForm.Get("redirect_uri") {
+			LogResponse("/oauth/token", "Invalid authorization code for app "+clientId, nil)
+			encodeOAuthError(w, "invalid_grant", "The authorization code is invalid, expired or was issued to another client", http.StatusBadRequest)
+			return
+		}
+		if !VerifyPKCE(r.PostForm.Get("code_verifier"), authorization.CodeChallenge) {
+			LogResponse("/oauth/token", "PKCE verification failed for app "+clientId, nil)
+			encodeOAuthError(w, "invalid_grant", "code_verifier does not match the code_challenge", http.StatusBadRequest)
+			return
+		}
+
+		var accessHash, refreshHash string
+		token, response, accessHash, refreshHash, err = issueOAuthToken(clientId, authorization.UserID, authorization.Scopes, now)
+		if err == nil {
+			token, err = s.store.CreateOAuthToken(r.Context(), token, accessHash, refreshHash)
+		}
+		if err != nil {
+			LogResponse("/oauth/token", "Error issuing OAuth token", err)
+			encodeOAuthError(w, "server_error", "Error issuing token", http.StatusInternalServerError)
+			return
+		}
+	case "refresh_token":
+		// The new pair keeps the scopes, and the user, of the one it replaces
+		fresh, fresher, accessHash, refreshHash, err := issueOAuthToken(clientId, "", nil, now)
+		if err != nil {
+			LogResponse("/oauth/token", "Error issuing OAuth token", err)
+			encodeOAuthError(w, "server_error", "Error issuing token", http.StatusInternalServerError)
+			return
+		}
+		token, err = s.store.RotateOAuthToken(r.Context(), HashToken(r.PostForm.Get("refresh_token")), clientId, fresh, accessHash, refreshHash)
+		if err != nil {
+			if err.Error() == "oauth token not found" {
+				LogResponse("/oauth/token", "Invalid refresh token for app "+clientId, nil)
+				encodeOAuthError(w, "invalid_grant", "The refresh token is invalid, expired or was issued to another client", http.StatusBadRequest)
+				return
+			}
+			LogResponse("/oauth/token", "Error refreshing OAuth token", err)
+			encodeOAuthError(w, "server_error", "Error issuing token", http.StatusInternalServerError)
+			return
+		}
+		response = fresher
+		response.Scope = strings.Join(token.Scopes, " ")
+	default:
+		LogResponse("/oauth/token", "Unsupported grant type "+grantType, nil)
+		encodeOAuthError(w, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token", http.StatusBadRequest)
+		return
+	}
+
+	LogResponse("/oauth/token", "Issued token to app "+clientId+" for user "+token.UserID, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// oauthRevokeHandler lets an app revoke an access or refresh token it was issued, which revokes
+// the pair, as RFC 7009 has it. Unknown tokens are answered like known ones.
+func (s *Server) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		encodeOAuthError(w, "invalid_request", "Invalid form body", http.StatusBadRequest)
+		return
+	}
+	token, clientId := r.PostForm.Get("token"), r.PostForm.Get("client_id")
+	if token == "" || clientId == "" {
+		encodeOAuthError(w, "invalid_request", "token and client_id are required", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.RevokeOAuthToken(r.Context(), HashToken(token), clientId); err != nil && err.Error() != "oauth token not found" {
+		LogResponse("/oauth/revoke", "Error revoking OAuth token", err)
+		encodeOAuthError(w, "server_error", "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listOAuthGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	grants, err := s.store.ListOAuthGrants(r.Context(), userId)
+	if err != nil {
+		LogResponse("/me/oauth-grants", "Error listing OAuth grants for user "+userId, err)
+		EncodeError(w, "Error retrieving connected apps", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(OAuthGrantsResponse{Grants: grants})
+}
+
+// revokeOAuthGrantHandler disconnects an app the user let in, revoking every token it holds
+func (s *Server) revokeOAuthGrantHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	clientId := mux.Vars(r)["clientId"]
+	if err := s.store.RevokeOAuthGrant(r.Context(), userId, clientId); err != nil {
+		if err.Error() == "oauth grant not found" {
+			LogResponse("/me/oauth-grants/{clientId}", "OAuth grant not found: "+clientId, nil)
+			EncodeError(w, "Connected app not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/me/oauth-grants/{clientId}", "Error revoking OAuth grant", err)
+		EncodeError(w, "Error disconnecting app", http.StatusInternalServerError)
+		return
+	}
+	LogResponse("/me/oauth-grants/{clientId}", "User "+userId+" disconnected app "+clientId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createSubscriptionHandler follows a tag or creator. Following one again returns the existing
+// subscription with 200 rather than 201.
+func (s *Server) createSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	var req SubscriptionRequest
+	if !decodeRequest(w, r, "/subscriptions", &req) {
+		return
+	}
+
+	subscription := Subscription{UserID: userId, Kind: SubscriptionTag}
+	if req.Tag != "" {
+		subscription.Tag, _ = normalizeTag(req.Tag)
+	} else {
+		subscription.Kind, subscription.CreatorID = SubscriptionCreator, strings.TrimSpace(req.CreatorID)
+		if subscription.CreatorID == userId {
+			encodeFieldError(w, "/subscriptions", "creatorId", ErrCodeConflict, "must not be your own")
+			return
+		}
+		creator, err := s.store.GetUserDetails(r.Context(), subscription.CreatorID)
+		if err != nil {
+			if err.Error() == "user not found" {
+				LogResponse("/subscriptions", "No creator "+subscription.CreatorID+" to subscribe to", nil)
+				EncodeErrorCode(w, ErrCodeUserNotFound, "User not found", http.StatusNotFound)
+				return
+			}
+			LogResponse("/subscriptions", "Error retrieving user details", err)
+			EncodeError(w, "Error retrieving user details", http.StatusInternalServerError)
+			return
+		}
+		subscription.CreatorUsername = creator.Username
+	}
+
+	existing, err := s.store.ListSubscriptions(r.Context(), userId)
+	if err != nil {
+		LogResponse("/subscriptions", "Error listing subscriptions for user "+userId, err)
+		EncodeError(w, "Error saving subscription", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxSubscriptions {
+		LogResponse("/subscriptions", "User "+userId+" has too many subscriptions", nil)
+		EncodeError(w, "You can follow at most "+strconv.Itoa(maxSubscriptions)+" tags and creators", http.StatusConflict)
+		return
+	}
+
+	saved, created, err := s.store.CreateSubscription(r.Context(), subscription)
+	if err != nil {
+		LogResponse("/subscriptions", "Error saving subscription", err)
+		EncodeError(w, "Error saving subscription", http.StatusInternalServerError)
+		return
+	}
+	if saved.Kind == SubscriptionCreator {
+		saved.CreatorUsername = subscription.CreatorUsername
+	}
+
+	LogResponse("/subscriptions", "User "+userId+" follows "+saved.Kind+" "+subscription.Tag+subscription.CreatorID, nil)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+func (s *Server) listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	subscriptions, err := s.store.ListSubscriptions(r.Context(), userId)
+	if err != nil {
+		LogResponse("/subscriptions", "Error listing subscriptions for user "+userId, err)
+		EncodeError(w, "Error retrieving subscriptions", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(SubscriptionsResponse{Subscriptions: subscriptions})
+}
+
+func (s *Server) deleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if err := s.store.DeleteSubscription(r.Context(), id, userId); err != nil {
+		if err.Error() == "subscription not found" {
+			LogResponse("/subscriptions/{id}", "Subscription not found: "+strconv.Itoa(id), nil)
+			EncodeError(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/subscriptions/{id}", "Error deleting subscription", err)
+		EncodeError(w, "Error deleting subscription", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ImpersonationRequest
+	if !decodeRequest(w, r, "/admin/users/{id}/impersonations", &req) {
+		return
+	}
+
+	adminId, _ := GetUserIDFromContext(r.Context())
+	userId := mux.Vars(r)["id"]
+	if userId == adminId || IsAdmin(userId) {
+		LogResponse("/admin/users/{id}/impersonations", "Admin "+adminId+" may not impersonate admin "+userId, nil)
+		EncodeError(w, "Admins cannot be impersonated", http.StatusForbidden)
+		return
+	}
+	if _, err := s.store.GetUserDetails(r.Context(), userId); err != nil {
+		if err.Error() == "user not found" {
+			LogResponse("/admin/users/{id}/impersonations", "User not found: "+userId, nil)
+			EncodeErrorCode(w, ErrCodeUserNotFound, "User not found", http.StatusNotFound)
+			return
+		}
+		LogResponse("/admin/users/{id}/impersonations", "Error retrieving user", err)
+		EncodeError(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	impersonation := Impersonation{
+		AdminID:         adminId,
+		UserID:          userId,
+		Reason:          strings.TrimSpace(req.Reason),
+		Minutes:         req.Minutes,
+		ConsentRequired: req.RequireConsent || ImpersonationConsentRequired(),
+		Status:          ImpersonationApproved,
+	}
+	if impersonation.Minutes == 0 {
+		impersonation.Minutes = defaultImpersonationMinutes
+	}
+	if impersonation.ConsentRequired {
+		impersonation.Status = ImpersonationPending
+	}
+	created, err := s.store.CreateImpersonation(r.Context(), impersonation)
+	if err != nil {
+		LogResponse("/admin/users/{id}/impersonations", "Error saving impersonation", err)
+		EncodeError(w, "Error saving impersonation", http.StatusInternalServerError)
+		return
+	}
+	s.recordImpersonationAudit(r.Context(), created.ID, adminId, ImpersonationAuditRequested, created.Reason)
+
+	if created.ConsentRequired {
+		s.sendImpersonationNotice(r.Context(), created)
+		LogResponse("/admin/users/{id}/impersonations", "Impersonation "+strconv.Itoa(created.ID)+" of user "+userId+" by "+adminId+" waits for approval", nil)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(created)
+		return
+	}
+	s.startImpersonation(w, r, "/admin/users/{id}/impersonations", created)
+}
+
+// startImpersonation issues the token of an approved impersonation and answers 201 with it. The
+// token is only ever shown here.
+func (s *Server) startImpersonation(w http.ResponseWriter, r *http.Request, endpoint string, impersonation Impersonation) {
+	secret, hash, err := newImpersonationToken()
+	if err != nil {
+		LogResponse(endpoint, "Error generating impersonation token", err)
+		EncodeError(w, "Error generating impersonation token", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(impersonation.Minutes) * time.Minute)
+	started, err := s.store.StartImpersonation(r.Context(), impersonation.ID, hash, expiresAt)
+	if err != nil {
+		if err.Error() == "impersonation status changed" {
+			LogResponse(endpoint, "Impersonation "+strconv.Itoa(impersonation.ID)+" is no longer approved", nil)
+			EncodeError(w, "This impersonation cannot be started", http.StatusConflict)
+			return
+		}
+		LogResponse(endpoint, "Error starting impersonation", err)
+		EncodeError(w, "Error starting impersonation", http.StatusInternalServerError)
+		return
+	}
+	s.recordImpersonationAudit(r.Context(), started.ID, started.AdminID, ImpersonationAuditStarted, "")
+	s.sendImpersonationNotice(r.Context(), started)
+
+	started.Token = secret
+	LogResponse(endpoint, "Impersonation "+strconv.Itoa(started.ID)+" of user "+started.UserID+" started by "+started.AdminID, nil)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(started)
+}
+
+// impersonationFor looks up the impersonation in the request path, which must be of userId unless
+// userId is empty. It writes the error response and returns false when there is none.
+func (s *Server) impersonationFor(w http.ResponseWriter, r *http.Request, endpoint, userId string) (Impersonation, bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	impersonation, err := s.store.GetImpersonation(r.Context(), id)
+	if err != nil && err.Error() != "impersonation not found" {
+		LogResponse(endpoint, "Error retrieving impersonation", err)
+		EncodeError(w, "Error retrieving impersonation", http.StatusInternalServerError)
+		return Impersonation{}, false
+	}
+	if err != nil || (userId != "" && impersonation.UserID != userId) {
+		LogResponse(endpoint, "Impersonation not found: "+strconv.Itoa(id), nil)
+		EncodeError(w, "Impersonation not found", http.StatusNotFound)
+		return Impersonation{}, false
+	}
+	return impersonation, true
+}
+
+func (s *Server) startImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	impersonation, ok := s.impersonationFor(w, r, "/admin/impersonations/{id}/token", "")
+	if !ok {
+		return
+	}
+	adminId, _ := GetUserIDFromContext(r.Context())
+	if impersonation.AdminID != adminId {
+		LogResponse("/admin/impersonations/{id}/token", "Admin "+adminId+" did not request impersonation "+strconv.Itoa(impersonation.ID), nil)
+		EncodeError(w, "Only the admin who requested this impersonation can start it", http.StatusForbidden)
+		return
+	}
+	switch {
+	case impersonation.Expired(time.Now()):
+		LogResponse("/admin/impersonations/{id}/token", "Impersonation "+strconv.Itoa(impersonation.ID)+" expired", nil)
+		EncodeError(w, "This impersonation has expired", http.StatusConflict)
+		return
+	case impersonation.Status == ImpersonationPending:
+		LogResponse("/admin/impersonations/{id}/token", "Impersonation "+strconv.Itoa(impersonation.ID)+" waits for approval", nil)
+		EncodeError(w, "The user has not approved this impersonation yet", http.StatusConflict)
+		return
+	case impersonation.Status != ImpersonationApproved:
+		LogResponse("/admin/impersonations/{id}/token", "Impersonation "+strconv.Itoa(impersonation.ID)+" is "+impersonation.Status, nil)
+		EncodeError(w, "This impersonation cannot be started", http.StatusConflict)
+		return
+	}
+	s.startImpersonation(w, r, "/admin/impersonations/{id}/token", impersonation)
+}
+
+// endImpersonation ends an impersonation that is waiting or active on behalf of actorId, so its
+// token stops working, and answers 204
+func (s *Server) endImpersonation(w http.ResponseWriter, r *http.Request, endpoint string, impersonation Impersonation, actorId string) {
+	if impersonation.Expired(time.Now()) {
+		LogResponse(endpoint, "Impersonation "+strconv.Itoa(impersonation.ID)+" already expired", nil)
+		EncodeError(w, "This impersonation has already ended", http.StatusConflict)
+		return
+	}
+	from := []string{ImpersonationPending, ImpersonationApproved, ImpersonationActive}
+	if _, err := s.store.TransitionImpersonation(r.Context(), impersonation.ID, from, ImpersonationEnded); err != nil {
+		if err.Error() == "impersonation status changed" {
+			LogResponse(endpoint, "Impersonation "+strconv.Itoa(impersonation.ID)+" already ended", nil)
+			EncodeError(w, "This impersonation has already ended", http.StatusConflict)
+			return
+		}
+		LogResponse(endpoint, "Error ending impersonation", err)
+		EncodeError(w, "Error ending impersonation", http.StatusInternalServerError)
+		return
+	}
+	s.recordImpersonationAudit(r.Context(), impersonation.ID, actorId, ImpersonationAuditEnded, "")
+
+	LogResponse(endpoint, "Impersonation "+strconv.Itoa(impersonation.ID)+" ended by "+actorId, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	impersonation, ok := s.impersonationFor(w, r, "/admin/impersonations/{id}", "")
+	if !ok {
+		return
+	}
+	adminId, _ := GetUserIDFromContext(r.Context())
+	s.endImpersonation(w, r, "/admin/impersonations/{id}", impersonation, adminId)
+}
+
+func (s *Server) listImpersonationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	impersonations, err := s.store.ListImpersonations(r.Context(), r.URL.Query().Get("userId"), maxListedImpersonations)
+	if err != nil {
+		LogResponse("/admin/impersonations", "Error listing impersonations", err)
+		EncodeError(w, "Error retrieving impersonations", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	for i := range impersonations {
+		impersonations[i] = impersonations[i].reported(now)
+	}
+	json.NewEncoder(w).Encode(ImpersonationsResponse{Impersonations: impersonations})
+}
+
+// writeImpersonationAudit answers with the audit trail of an impersonation
+func (s *Server) writeImpersonationAudit(w http.ResponseWriter, r *http.Request, endpoint string, impersonation Impersonation) {
+	entries, err := s.store.ListImpersonationAudit(r.Context(), impersonation.ID)
+	if err != nil {
+		LogResponse(endpoint, "Error retrieving impersonation audit", err)
+		EncodeError(w, "Error retrieving impersonation audit", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *Server) impersonationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	impersonation, ok := s.impersonationFor(w, r, "/admin/impersonations/{id}/audit", "")
+	if !ok {
+		return
+	}
+	s.writeImpersonationAudit(w, r, "/admin/impersonations/{id}/audit", impersonation)
+}
+
+func (s *Server) listMyImpersonationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	impersonations, err := s.store.ListImpersonations(r.Context(), userId, maxListedImpersonations)
+	if err != nil {
+		LogResponse("/me/impersonations", "Error listing impersonations", err)
+		EncodeError(w, "Error retrieving impersonations", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	for i := range impersonations {
+		impersonations[i] = impersonations[i].reported(now)
+	}
+	json.NewEncoder(w).Encode(ImpersonationsResponse{Impersonations: impersonations})
+}
+
+// decideImpersonationHandler lets users approve or deny an impersonation of their account that
+// waits for them
+func (s *Server) decideImpersonationHandler(approve bool) http.HandlerFunc {
+	endpoint, status, action := "/me/impersonations/{id}/deny", ImpersonationDenied, ImpersonationAuditDenied
+	if approve {
+		endpoint, status, action = "/me/impersonations/{id}/approve", ImpersonationApproved, ImpersonationAuditApproved
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		userId, _ := GetUserIDFromContext(r.Context())
+		impersonation, ok := s.impersonationFor(w, r, endpoint, userId)
+		if !ok {
+			return
+		}
+		if impersonation.Expired(time.Now()) {
+			LogResponse(endpoint, "Impersonation "+strconv.Itoa(impersonation.ID)+" expired", nil)
+			EncodeError(w, "This impersonation has expired", http.StatusConflict)
+			return
+		}
+		decided, err := s.store.TransitionImpersonation(r.Context(), impersonation.ID, []string{ImpersonationPending}, status)
+		if err != nil {
+			if err.Error() == "impersonation status changed" {
+				LogResponse(endpoint, "Impersonation "+strconv.Itoa(impersonation.ID)+" is not pending", nil)
+				EncodeError(w, "This impersonation is not waiting for your approval", http.StatusConflict)
+				return
+			}
+			LogResponse(endpoint, "Error deciding impersonation", err)
+			EncodeError(w, "Error deciding impersonation", http.StatusInternalServerError)
+			return
+		}
+		s.recordImpersonationAudit(r.Context(), decided.ID, userId, action, "")
+
+		LogResponse(endpoint, "Impersonation "+strconv.Itoa(decided.ID)+" "+status+" by user "+userId, nil)
+		json.NewEncoder(w).Encode(decided)
+	}
+}
+
+func (s *Server) endMyImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	impersonation, ok := s.impersonationFor(w, r, "/me/impersonations/{id}", userId)
+	if !ok {
+		return
+	}
+	s.endImpersonation(w, r, "/me/impersonations/{id}", impersonation, userId)
+}
+
+func (s *Server) myImpersonationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, _ := GetUserIDFromContext(r.Context())
+	impersonation, ok := s.impersonationFor(w, r, "/me/impersonations/{id}/audit", userId)
+	if !ok {
+		return
+	}
+	s.writeImpersonationAudit(w, r, "/me/impersonations/{id}/audit", impersonation)
 }
@@ -0,0 +1,689 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// doJSON sends a JSON request to the router and decodes the response into out when it is not nil
+func doJSON(t *testing.T, router http.Handler, method, path, token string, body, out interface{}) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s response: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHandlersWithMemoryStore(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+
+	register := RegisterRequest{Username: "mira", Email: "mira@example.com", Password: "correct horse battery"}
+	var registered RegisterResponse
+	if code := doJSON(t, router, http.MethodPost, "/register", "", register, &registered); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("register status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/register", "", register, nil); code != http.StatusConflict {
+		t.Errorf("duplicate register status = %d, want %d", code, http.StatusConflict)
+	}
+
+	if code := doJSON(t, router, http.MethodPost, "/login", "", LoginRequest{Email: register.Email, Password: "wrong"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("login with wrong password status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	var login LoginResponse
+	if code := doJSON(t, router, http.MethodPost, "/login", "", LoginRequest{Email: register.Email, Password: register.Password}, &login); code != http.StatusOK {
+		t.Fatalf("login status = %d", code)
+	}
+	if login.User.ID != registered.User.ID || login.User.Username != "mira" {
+		t.Errorf("login user = %+v, want %+v", login.User, registered.User)
+	}
+
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "calm"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", login.Token, sketch, &saved); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	var animation GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID, "", nil, &animation); code != http.StatusOK {
+		t.Fatalf("get animation status = %d", code)
+	}
+	if animation.Code != sketch.Code || animation.Description != sketch.Description {
+		t.Errorf("animation = %+v, want code and description of %+v", animation, sketch)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/animation/unknown", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown animation status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := doJSON(t, router, http.MethodPost, "/save-mood", login.Token, SaveMoodRequest{AnimationID: saved.ID, Mood: MoodSame, PlaybackSession: playAnimation(t, router, login.Token, saved.ID)}, nil); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("save mood status = %d", code)
+	}
+	if mood, ok := store.Mood(login.User.ID, saved.ID); !ok || mood != string(MoodSame) {
+		t.Errorf("stored mood = %q, %v, want %q", mood, ok, MoodSame)
+	}
+}
+
+// registerUser registers a user through the router and returns their token
+func registerUser(t *testing.T, router http.Handler, username string) string {
+	t.Helper()
+	return registerAccount(t, router, username).Token
+}
+
+// registerAccount registers a user at username@example.com through the router
+func registerAccount(t *testing.T, router http.Handler, username string) RegisterResponse {
+	t.Helper()
+	var registered RegisterResponse
+	req := RegisterRequest{Username: username, Email: username + "@example.com", Password: "correct horse battery"}
+	if code := doJSON(t, router, http.MethodPost, "/register", "", req, &registered); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("register %s status = %d", username, code)
+	}
+	return registered
+}
+
+// playAnimation fetches an animation as token's player would, returning its playback session
+func playAnimation(t *testing.T, router http.Handler, token, animationId string) string {
+	t.Helper()
+	var animation GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+animationId, token, nil, &animation); code != http.StatusOK || animation.PlaybackSession == "" {
+		t.Fatalf("play animation %s status = %d, want a playback session", animationId, code)
+	}
+	return animation.PlaybackSession
+}
+
+func TestUpdateAnimationChangelog(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	owner := registerUser(t, router, "owner")
+	other := registerUser(t, router, "other")
+
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "calm"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", owner, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	newCode := "function setup() {}\nfunction draw() { background(0); }"
+	description := "calmer"
+	tests := []struct {
+		name     string
+		token    string
+		id       string
+		req      UpdateAnimationRequest
+		wantCode int
+	}{
+		{name: "not owner", token: other, id: saved.ID, req: UpdateAnimationRequest{Description: &description}, wantCode: http.StatusForbidden},
+		{name: "nothing to update", token: owner, id: saved.ID, req: UpdateAnimationRequest{ChangeNote: "no-op"}, wantCode: http.StatusBadRequest},
+		{name: "note too long", token: owner, id: saved.ID, req: UpdateAnimationRequest{Description: &description, ChangeNote: strings.Repeat("x", maxChangeNoteLength+1)}, wantCode: http.StatusBadRequest},
+		{name: "unknown animation", token: owner, id: "unknown", req: UpdateAnimationRequest{Description: &description}, wantCode: http.StatusNotFound},
+		{name: "without note", token: owner, id: saved.ID, req: UpdateAnimationRequest{Description: &description}, wantCode: http.StatusOK},
+		{name: "with note", token: owner, id: saved.ID, req: UpdateAnimationRequest{Code: &newCode, ChangeNote: "  Darker background  "}, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodPatch, "/animation/"+tt.id, tt.token, tt.req, nil); code != tt.wantCode {
+				t.Errorf("update status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var animation GetAnimationResponse
+	doJSON(t, router, http.MethodGet, "/animation/"+saved.ID, "", nil, &animation)
+	if animation.Code != newCode || animation.Description != description {
+		t.Errorf("animation = %+v, want updated code and description", animation)
+	}
+
+	var changelog []ChangelogEntry
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"/changelog", "", nil, &changelog); code != http.StatusOK {
+		t.Fatalf("changelog status = %d", code)
+	}
+	if len(changelog) != 1 || changelog[0].Note != "Darker background" {
+		t.Errorf("changelog = %+v, want one trimmed note", changelog)
+	}
+}
+
+func TestDeleteAnimation(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	owner := registerUser(t, router, "owner")
+	other := registerUser(t, router, "other")
+
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+
+	save := func() string {
+		var saved SaveAnimationResponse
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "calm"}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", owner, sketch, &saved); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+		return saved.ID
+	}
+	first, second := save(), save()
+	if code := doJSON(t, router, http.MethodPost, "/save-mood", other, SaveMoodRequest{AnimationID: first, Mood: MoodSame, PlaybackSession: playAnimation(t, router, other, first)}, nil); code != http.StatusOK {
+		t.Fatalf("save mood status = %d", code)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		id       string
+		wantCode int
+	}{
+		{name: "anonymous", token: "", id: first, wantCode: http.StatusUnauthorized},
+		{name: "not owner", token: other, id: first, wantCode: http.StatusForbidden},
+		{name: "unknown animation", token: owner, id: "unknown", wantCode: http.StatusNotFound},
+		{name: "owner", token: owner, id: first, wantCode: http.StatusNoContent},
+		{name: "already deleted", token: owner, id: first, wantCode: http.StatusNotFound},
+		{name: "admin", token: admin.Token, id: second, wantCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodDelete, "/animation/"+tt.id, tt.token, nil, nil); code != tt.wantCode {
+				t.Errorf("delete status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+first, "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleted animation status = %d, want %d", code, http.StatusNotFound)
+	}
+	var otherUser User
+	for _, user := range store.users {
+		if user.Username == "other" {
+			otherUser = user
+		}
+	}
+	if _, ok := store.Mood(otherUser.ID, first); ok {
+		t.Error("mood on the deleted animation was kept")
+	}
+}
+
+func TestAnimationComments(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	owner := registerUser(t, router, "owner")
+	viewer := registerUser(t, router, "viewer")
+	other := registerUser(t, router, "other")
+
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "calm"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", owner, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	path := "/animation/" + saved.ID + "/comments"
+
+	comment := func(token, body string) Comment {
+		t.Helper()
+		var created Comment
+		if code := doJSON(t, router, http.MethodPost, path, token, CreateCommentRequest{Body: body}, &created); code != http.StatusCreated {
+			t.Fatalf("comment status = %d", code)
+		}
+		return created
+	}
+	first := comment(viewer, "  so soothing  ")
+	second := comment(other, "love the colours")
+	third := comment(viewer, "watched it twice")
+	if first.Body != "so soothing" || first.Author.Username != "viewer" {
+		t.Errorf("comment = %+v, want trimmed body by viewer", first)
+	}
+
+	createTests := []struct {
+		name     string
+		token    string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{name: "anonymous", path: path, body: "hi", wantCode: http.StatusUnauthorized},
+		{name: "empty", token: viewer, path: path, body: "   ", wantCode: http.StatusBadRequest},
+		{name: "too long", token: viewer, path: path, body: strings.Repeat("a", maxCommentLength+1), wantCode: http.StatusBadRequest},
+		{name: "unknown animation", token: viewer, path: "/animation/unknown/comments", body: "hi", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range createTests {
+		t.Run("create "+tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodPost, tt.path, tt.token, CreateCommentRequest{Body: tt.body}, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var page CommentsResponse
+	if code := doJSON(t, router, http.MethodGet, path+"?limit=2", "", nil, &page); code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	if page.Total != 3 || len(page.Comments) != 2 || page.Comments[0].ID != first.ID || page.Comments[1].ID != second.ID {
+		t.Errorf("first page = %+v, want the two oldest of 3", page)
+	}
+	if page.NextOffset == nil || *page.NextOffset != 2 {
+		t.Errorf("nextOffset = %v, want 2", page.NextOffset)
+	}
+
+	deleteTests := []struct {
+		name     string
+		token    string
+		id       int
+		wantCode int
+	}{
+		{name: "anonymous", id: first.ID, wantCode: http.StatusUnauthorized},
+		{name: "someone else's", token: other, id: first.ID, wantCode: http.StatusForbidden},
+		{name: "author", token: viewer, id: first.ID, wantCode: http.StatusNoContent},
+		{name: "already deleted", token: viewer, id: first.ID, wantCode: http.StatusNotFound},
+		{name: "animation owner", token: owner, id: second.ID, wantCode: http.StatusNoContent},
+	}
+	for _, tt := range deleteTests {
+		t.Run("delete "+tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodDelete, path+"/"+strconv.Itoa(tt.id), tt.token, nil, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	page = CommentsResponse{}
+	doJSON(t, router, http.MethodGet, path, "", nil, &page)
+	if page.Total != 1 || len(page.Comments) != 1 || page.Comments[0].ID != third.ID {
+		t.Errorf("comments after deleting = %+v, want only the third", page)
+	}
+}
+
+func TestListMoods(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	viewer := registerUser(t, router, "viewer")
+	other := registerUser(t, router, "other")
+
+	// Moods saved on the 1st, 2nd and 3rd of March
+	var ids []string
+	for day, description := range []string{"waves", "embers", "rain"} {
+		var saved SaveAnimationResponse
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", viewer, sketch, &saved); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+		if code := doJSON(t, router, http.MethodPost, "/save-mood", viewer, SaveMoodRequest{AnimationID: saved.ID, Mood: MoodBetter, PlaybackSession: playAnimation(t, router, viewer, saved.ID)}, nil); code != http.StatusOK {
+			t.Fatalf("save mood status = %d", code)
+		}
+		for key, mood := range store.moods {
+			if key[1] == saved.ID {
+				mood.savedAt = time.Date(2026, 3, day+1, 12, 0, 0, 0, time.UTC)
+				store.moods[key] = mood
+			}
+		}
+		ids = append(ids, saved.ID)
+	}
+
+	secondPage := 2
+	tests := []struct {
+		name       string
+		token      string
+		query      string
+		wantCode   int
+		wantIds    []string
+		wantTotal  int
+		wantOffset *int
+	}{
+		{name: "Newest first", token: viewer, wantCode: http.StatusOK, wantIds: []string{ids[2], ids[1], ids[0]}, wantTotal: 3},
+		{name: "Paginated", token: viewer, query: "?limit=2", wantCode: http.StatusOK, wantIds: []string{ids[2], ids[1]}, wantTotal: 3, wantOffset: &secondPage},
+		{name: "Date range", token: viewer, query: "?from=2026-03-02&to=2026-03-02", wantCode: http.StatusOK, wantIds: []string{ids[1]}, wantTotal: 1},
+		{name: "Open ended", token: viewer, query: "?from=2026-03-02T00:00:00Z", wantCode: http.StatusOK, wantIds: []string{ids[2], ids[1]}, wantTotal: 2},
+		{name: "Other user", token: other, wantCode: http.StatusOK, wantIds: []string{}},
+		{name: "Invalid date", token: viewer, query: "?from=March", wantCode: http.StatusBadRequest},
+		{name: "Empty range", token: viewer, query: "?from=2026-03-03&to=2026-03-01", wantCode: http.StatusBadRequest},
+		{name: "Anonymous", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got MoodsResponse
+			if code := doJSON(t, router, http.MethodGet, "/moods"+tt.query, tt.token, nil, &got); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			gotIds := []string{}
+			for _, entry := range got.Moods {
+				gotIds = append(gotIds, entry.AnimationID)
+			}
+			if !reflect.DeepEqual(gotIds, tt.wantIds) || got.Total != tt.wantTotal || !reflect.DeepEqual(got.NextOffset, tt.wantOffset) {
+				t.Errorf("moods = %v, total %d, next %v, want %v, total %d, next %v", gotIds, got.Total, got.NextOffset, tt.wantIds, tt.wantTotal, tt.wantOffset)
+			}
+		})
+	}
+
+	var all MoodsResponse
+	doJSON(t, router, http.MethodGet, "/moods", viewer, nil, &all)
+	if entry := all.Moods[0]; entry.Mood != MoodBetter || entry.AnimationDescription != "rain" {
+		t.Errorf("entry = %+v, want the mood with its animation's description", entry)
+	}
+}
+
+func TestFeedPagination(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+
+	ids := make([]string, 5)
+	for i := range ids {
+		id, err := store.SaveAnimation(ctx, "function draw() {}", "animation", "", "")
+		if err != nil {
+			t.Fatalf("SaveAnimation: %v", err)
+		}
+		ids[i] = id
+	}
+	// Crashed animations are left out of the feed and its total
+	store.SetAnimationRenderStatus(ctx, ids[2], RenderStatusCrashed)
+
+	next := func(n int) *int { return &n }
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []string
+		wantNext   *int
+	}{
+		{"first page", "?limit=2", http.StatusOK, []string{ids[4], ids[3]}, next(2)},
+		{"second page", "?limit=2&offset=2", http.StatusOK, []string{ids[1], ids[0]}, nil},
+		{"default limit", "?offset=0", http.StatusOK, []string{ids[4], ids[3], ids[1], ids[0]}, nil},
+		{"past the end", "?limit=2&offset=10", http.StatusOK, []string{}, nil},
+		{"zero limit", "?limit=0", http.StatusBadRequest, nil, nil},
+		{"limit too large", "?limit=101", http.StatusBadRequest, nil, nil},
+		{"negative offset", "?offset=-1", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page GetAnimationFeedResponse
+			if code := doJSON(t, router, http.MethodGet, "/feed"+tt.query, "", nil, &page); code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if page.Total != 4 {
+				t.Errorf("total = %d, want 4", page.Total)
+			}
+			got := make([]string, len(page.Animations))
+			for i, animation := range page.Animations {
+				got[i] = animation.ID
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("animations = %v, want %v", got, tt.wantIDs)
+			}
+			if (page.NextOffset == nil) != (tt.wantNext == nil) || (page.NextOffset != nil && *page.NextOffset != *tt.wantNext) {
+				t.Errorf("nextOffset = %v, want %v", page.NextOffset, tt.wantNext)
+			}
+		})
+	}
+
+	// Without paging parameters a single animation is returned as before
+	var animation GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/feed", "", nil, &animation); code != http.StatusOK || animation.ID == "" {
+		t.Errorf("random feed status = %d, animation = %+v", code, animation)
+	}
+}
+
+func TestSearchAnimations(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+
+	descriptions := []string{"calm ocean waves", "ocean at night with calm stars", "bouncing ocean balls", "spinning squares", "calm ocean crash"}
+	ids := make([]string, len(descriptions))
+	for i, description := range descriptions {
+		id, err := store.SaveAnimation(ctx, "function draw() {}", description, "", "")
+		if err != nil {
+			t.Fatalf("SaveAnimation: %v", err)
+		}
+		ids[i] = id
+	}
+	// Animations the feed leaves out are not searchable either
+	store.SetAnimationRenderStatus(ctx, ids[4], RenderStatusCrashed)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []string
+		wantTotal  int
+	}{
+		{name: "Every word must match", query: "?q=calm+ocean", wantStatus: http.StatusOK, wantIDs: []string{ids[1], ids[0]}, wantTotal: 2},
+		{name: "Word prefix", query: "?q=spin", wantStatus: http.StatusOK, wantIDs: []string{ids[3]}, wantTotal: 1},
+		{name: "Paged", query: "?q=ocean&limit=1&offset=1", wantStatus: http.StatusOK, wantIDs: []string{ids[1]}, wantTotal: 3},
+		{name: "No matches", query: "?q=volcano", wantStatus: http.StatusOK, wantIDs: []string{}, wantTotal: 0},
+		{name: "Missing query", query: "?q=+", wantStatus: http.StatusBadRequest},
+		{name: "Query too long", query: "?q=" + strings.Repeat("a", maxSearchQueryLength+1), wantStatus: http.StatusBadRequest},
+		{name: "Invalid limit", query: "?q=ocean&limit=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var page SearchAnimationsResponse
+			if code := doJSON(t, router, http.MethodGet, "/search"+tt.query, "", nil, &page); code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", page.Total, tt.wantTotal)
+			}
+			got := make([]string, len(page.Animations))
+			for i, animation := range page.Animations {
+				got[i] = animation.ID
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("animations = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestMyAnimations(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	owner := registerUser(t, router, "maker")
+	other := registerUser(t, router, "browser")
+
+	save := func(token, description string) string {
+		t.Helper()
+		var saved SaveAnimationResponse
+		req := SaveAnimationRequest{Code: "function draw() { background(0); }", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", token, req, &saved); code != http.StatusOK {
+			t.Fatalf("save status = %d", code)
+		}
+		return saved.ID
+	}
+	first, second, third := save(owner, "first"), save(owner, "second"), save(owner, "third")
+	save(other, "not mine")
+
+	var page MyAnimationsResponse
+	if code := doJSON(t, router, http.MethodGet, "/my-animations?limit=2", owner, nil, &page); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if page.Total != 3 || len(page.Animations) != 2 || page.Animations[0].ID != third || page.Animations[1].ID != second {
+		t.Errorf("first page = %+v, want the two newest of 3", page)
+	}
+	if page.NextOffset == nil || *page.NextOffset != 2 {
+		t.Errorf("nextOffset = %v, want 2", page.NextOffset)
+	}
+	if page.Animations[0].RenderStatus != RenderStatusUnchecked || page.Animations[0].CreatedAt.IsZero() {
+		t.Errorf("animation = %+v, want render status and creation time", page.Animations[0])
+	}
+
+	var last MyAnimationsResponse
+	if code := doJSON(t, router, http.MethodGet, "/my-animations?offset=2", owner, nil, &last); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(last.Animations) != 1 || last.Animations[0].ID != first || last.NextOffset != nil {
+		t.Errorf("last page = %+v, want only the oldest", last)
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/my-animations?limit=500", owner, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("oversized limit status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/my-animations", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestContentPreferencesFilterFeed(t *testing.T) {
+	resetFeatures(t)
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	token := registerUser(t, router, "viewer")
+
+	screened := map[string]PhotosensitivityReport{
+		"calm": {Status: PhotosensitivitySafe, MotionScore: 0.01},
+		"busy": {Status: PhotosensitivitySafe, MotionScore: 0.5},
+	}
+	for _, description := range []string{"calm", "busy", "unchecked"} {
+		id, err := store.SaveAnimation(ctx, "function draw() {}", description, "", "")
+		if err != nil {
+			t.Fatalf("SaveAnimation: %v", err)
+		}
+		if report, ok := screened[description]; ok {
+			store.SetAnimationPhotosensitivity(ctx, id, report)
+		}
+	}
+
+	var preferences ContentPreferences
+	if code := doJSON(t, router, http.MethodGet, "/me/preferences/content", token, nil, &preferences); code != http.StatusOK || preferences != (ContentPreferences{}) {
+		t.Fatalf("default preferences = %+v, status %d, want all off", preferences, code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/me/preferences/content", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous preferences status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		preferences ContentPreferences
+		want        int
+	}{
+		{name: "Anonymous", want: 3},
+		{name: "No preferences", token: token, want: 3},
+		{name: "Avoid flashing", token: token, preferences: ContentPreferences{AvoidFlashing: true}, want: 2},
+		{name: "Reduce motion", token: token, preferences: ContentPreferences{ReduceMotion: true, MuteSound: true}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.token != "" {
+				var saved ContentPreferences
+				if code := doJSON(t, router, http.MethodPut, "/me/preferences/content", tt.token, tt.preferences, &saved); code != http.StatusOK || saved != tt.preferences {
+					t.Fatalf("save preferences = %+v, status %d", saved, code)
+				}
+			}
+			var page GetAnimationFeedResponse
+			if code := doJSON(t, router, http.MethodGet, "/feed?limit=10", tt.token, nil, &page); code != http.StatusOK {
+				t.Fatalf("feed status = %d", code)
+			}
+			if page.Total != tt.want {
+				t.Errorf("feed total = %d, want %d", page.Total, tt.want)
+			}
+		})
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/feed", "not-a-token", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("feed with an invalid token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	server := NewServer(store)
+	mailer := &fakeMailer{}
+	server.mailer = mailer
+	router := server.Router()
+	user := registerAccount(t, router, "artist")
+
+	// Unknown emails are answered the same way, and no link is sent
+	for _, email := range []string{"artist@example.com", "nobody@example.com"} {
+		var sent MagicLinkResponse
+		if code := doJSON(t, router, http.MethodPost, "/login/magic-link", "", MagicLinkRequest{Email: email}, &sent); code != http.StatusAccepted || !sent.Success {
+			t.Errorf("link for %s = %d %+v, want %d", email, code, sent, http.StatusAccepted)
+		}
+	}
+	server.loginLinks.Wait()
+	if want := []string{"artist@example.com: Your Animate login link"}; !reflect.DeepEqual(mailer.sent, want) {
+		t.Fatalf("sent %v, want %v", mailer.sent, want)
+	}
+	token := linkToken(t, mailer.bodies[0])
+
+	var login LoginResponse
+	if code := doJSON(t, router, http.MethodGet, "/login/magic?token="+url.QueryEscape(token), "", nil, &login); code != http.StatusOK || login.User.ID != user.User.ID || login.Token == "" {
+		t.Fatalf("login = %d %+v, want the artist logged in", code, login)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/me/preferences/content", login.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("request with the issued token status = %d, want %d", code, http.StatusOK)
+	}
+
+	// Links are single use, and expire
+	if code := doJSON(t, router, http.MethodGet, "/login/magic?token="+url.QueryEscape(token), "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("reused link status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if err := store.SaveMagicLinkToken(context.Background(), user.User.ID, HashToken("expired"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/login/magic?token=expired", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expired link status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/login/magic", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("missing token status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -3,6 +3,8 @@ package internal
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +13,9 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -26,8 +30,12 @@ const userIDKey contextKey = "userID"
 const (
 	jwtSecretPlaceholder = "your_jwt_secret_key_here"
 	minJWTSecretLength   = 32
+	defaultJWTLifetime   = 7 * 24 * time.Hour
 )
 
+// RefreshedTokenHeader carries a renewed JWT when a request arrives inside the renewal window
+const RefreshedTokenHeader = "X-Refreshed-Token"
+
 // SetUserIDInContext adds a user ID to the request context
 func SetUserIDInContext(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, userIDKey, userID)
@@ -49,6 +57,31 @@ func JWTSecret() ([]byte, error) {
 	return []byte(secret), nil
 }
 
+// JWTLifetime returns how long issued tokens stay valid, configured by JWT_TTL_HOURS
+func JWTLifetime() time.Duration {
+	return envHours("JWT_TTL_HOURS", defaultJWTLifetime)
+}
+
+// JWTRenewalWindow returns how close to expiry a token must be before a refreshed
+// token is issued, configured by JWT_RENEWAL_WINDOW_HOURS. Zero disables sliding expiration.
+func JWTRenewalWindow() time.Duration {
+	return envHours("JWT_RENEWAL_WINDOW_HOURS", 0)
+}
+
+// envHours reads a non-negative number of hours from the environment
+func envHours(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	hours, err := strconv.ParseFloat(raw, 64)
+	if err != nil || hours < 0 {
+		log.Printf("Warning: Ignoring invalid %s value %q", key, raw)
+		return fallback
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
+
 func validateJWTSecret(secret string) error {
 	switch {
 	case secret == "":
@@ -62,17 +95,59 @@ func validateJWTSecret(secret string) error {
 	}
 }
 
+// Default time an old email address can undo an email change
+const defaultEmailChangeRevertWindow = 72 * time.Hour
+
+// EmailChangeRevertWindow returns how long a revert link stays valid, configured by EMAIL_CHANGE_REVERT_HOURS
+func EmailChangeRevertWindow() time.Duration {
+	return envHours("EMAIL_CHANGE_REVERT_HOURS", defaultEmailChangeRevertWindow)
+}
+
+// Default lifetime of a passwordless login link
+const defaultMagicLinkTTL = 15 * time.Minute
+
+// MagicLinkTTL returns how long a login link stays valid, configured by MAGIC_LINK_TTL_MINUTES
+func MagicLinkTTL() time.Duration {
+	raw := os.Getenv("MAGIC_LINK_TTL_MINUTES")
+	if raw == "" {
+		return defaultMagicLinkTTL
+	}
+	minutes, err := strconv.Atoi(raw)
+	if err != nil || minutes <= 0 {
+		log.Printf("Warning: Ignoring invalid MAGIC_LINK_TTL_MINUTES value %q", raw)
+		return defaultMagicLinkTTL
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// HashToken returns the hex encoded SHA-256 of a token so only hashes are stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CodeHash returns the hex encoded SHA-256 used as the content address of sketch code
+func CodeHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
 // LogRequest logs the request details
 func LogRequest(endpoint, message string) {
-	log.Printf("[REQUEST] %s - %s", endpoint, message)
+	log.Printf("[REQUEST] %s - %s", endpoint, RedactLog(message))
+}
+
+// LogRequestFor logs the request details, redacted by the rules of the tenant ctx acts for
+func LogRequestFor(ctx context.Context, endpoint, message string) {
+	log.Printf("[REQUEST] %s - %s", endpoint, RedactLogFor(ctx, message))
 }
 
 // LogResponse logs the response details
 func LogResponse(endpoint, message string, err error) {
 	if err != nil {
-		log.Printf("[RESPONSE] %s - %s: %v", endpoint, message, err)
+		log.Printf("[RESPONSE] %s - %s: %s", endpoint, RedactLog(message), RedactLog(err.Error()))
 	} else {
-		log.Printf("[RESPONSE] %s - %s", endpoint, message)
+		log.Printf("[RESPONSE] %s - %s", endpoint, RedactLog(message))
 	}
 }
 
@@ -137,15 +212,18 @@ func loadEnvFile() error {
 	return nil
 }
 
-// GenerateAnimationWithClaude calls Claude API to generate p5.js animation from description
-func GenerateAnimationWithClaude(description string, apiKey string) (string, error) {
-	log.Printf("[CLAUDE] Generating animation for description: %s", description)
+// DefaultClaudeModel is the model used for generating and repairing animations
+const DefaultClaudeModel = "claude-sonnet-4-20250514"
+
+// DescriptionPlaceholder marks where the user's description goes in an animation prompt template
+const DescriptionPlaceholder = "{{description}}"
 
-	// Prepare the Claude API request
-	prompt := `Create a p5.js animation based on this description: "` + description + `". ` +
-		`Your response should ONLY include valid JavaScript code that creates a p5.js sketch. The code should:
+// DefaultSystemPromptTemplate is the system prompt every generation and repair is sent with, unless
+// PROMPT_TEMPLATES_DIR replaces it. It holds the instructions on what to return, so the user prompts
+// only say what to draw or fix.
+const DefaultSystemPromptTemplate = `You write p5.js sketches. Your response should ONLY include valid JavaScript code that creates a p5.js sketch. The code should:
 1. Use p5.js functions like setup() and draw()
-2. Create a canvas that fits the container with id "animation-container"
+2. Create a canvas that fits the container with id "{{canvas_target}}"
 3. Include proper animation logic in the draw() function
 4. Be self-contained and ready to run with p5.js library
 
@@ -153,7 +231,7 @@ Example structure:
 // p5.js sketch setup
 function setup() {
     let canvas = createCanvas(windowWidth, windowHeight);
-    canvas.parent('animation-container');
+    canvas.parent('{{canvas_target}}');
     // Initialize your variables here
 }
 
@@ -172,43 +250,152 @@ function windowResized() {
 
 Do not include any markdown, HTML, CSS, or explanations. Only return the JavaScript code.`
 
-	claudeReq := ClaudeRequest{
-		Model: "claude-sonnet-4-20250514",
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		MaxTokens:   8192,
-		Temperature: 1.0,
+// DefaultAnimationPromptTemplate is the prompt used to generate animations, unless
+// PROMPT_TEMPLATES_DIR replaces it; see PromptTemplate
+const DefaultAnimationPromptTemplate = `Create a p5.js animation based on this description: "` + DescriptionPlaceholder + `". ` +
+	`Visual style: {{style}}.`
+
+// DefaultFixPromptTemplate is the prompt used to repair sketches that fail when they run, unless
+// PROMPT_TEMPLATES_DIR replaces it
+const DefaultFixPromptTemplate = `The following p5.js sketch throws an error when it runs.
+
+Error:
+{{error}}
+
+Code:
+{{code}}
+
+Fix the error while keeping the animation's behaviour the same. The sketch must still define setup() and draw() and be self-contained.`
+
+// BuildAnimationPrompt fills a description and style into a prompt template, with the default
+// style when style is empty
+func BuildAnimationPrompt(template, description, style string) string {
+	if style == "" {
+		style = defaultPromptStyle
 	}
+	return renderPrompt(template, map[string]string{"description": description, "style": style, "canvas_target": CanvasTarget()})
+}
 
-	// Convert request to JSON
-	reqBody, err := json.Marshal(claudeReq)
-	if err != nil {
-		log.Printf("[CLAUDE ERROR] Failed to marshal request: %v", err)
-		return "", err
+// GenerateAnimationWithClaude calls Claude API to generate p5.js animation from description
+func GenerateAnimationWithClaude(ctx context.Context, description, style string, apiKey string) (string, error) {
+	log.Printf("[CLAUDE] Generating animation for description: %s", RedactDescriptionFor(ctx, description))
+
+	return sendClaudePrompt(ctx, BuildAnimationPrompt(PromptTemplate(PromptGenerate), description, style), apiKey)
+}
+
+// FixAnimationWithClaude asks Claude to repair p5.js code that failed with the given error
+func FixAnimationWithClaude(ctx context.Context, brokenCode string, errorMessage string, apiKey string) (string, error) {
+	log.Printf("[CLAUDE] Repairing animation after error: %s", RedactLogFor(ctx, errorMessage))
+
+	return sendClaudePrompt(ctx, buildFixPrompt(brokenCode, errorMessage), apiKey)
+}
+
+// buildFixPrompt asks for p5.js code that failed with the given error to be repaired
+func buildFixPrompt(brokenCode string, errorMessage string) string {
+	return renderPrompt(PromptTemplate(PromptFix), map[string]string{"code": brokenCode, "error": errorMessage, "canvas_target": CanvasTarget()})
+}
+
+// sendClaudePrompt sends a single user prompt to the default Claude model and returns the text of the reply
+func sendClaudePrompt(ctx context.Context, prompt string, apiKey string) (string, error) {
+	return sendClaudePromptWithModel(ctx, prompt, DefaultClaudeModel, apiKey)
+}
+
+// claudeMessagesURL is the Claude Messages API endpoint
+var claudeMessagesURL = "https://api.anthropic.com/v1/messages"
+
+// Defaults for how long Claude calls may take
+const (
+	defaultClaudeRequestTimeoutSecs = 90
+	defaultClaudeTotalTimeoutSecs   = 180
+)
+
+// Defaults for the sampling options Claude calls are sent with
+const (
+	defaultClaudeMaxTokens   = 8192
+	defaultClaudeTemperature = 1.0
+)
+
+// ClaudeMaxTokens returns the most tokens a Claude reply may have, configured by CLAUDE_MAX_TOKENS.
+// Replies cut off at the limit fail validation, so it should leave room for whole sketches.
+func ClaudeMaxTokens() int {
+	if maxTokens := envLimit("CLAUDE_MAX_TOKENS", defaultClaudeMaxTokens); maxTokens > 0 {
+		return maxTokens
 	}
+	log.Printf("Warning: Ignoring CLAUDE_MAX_TOKENS of 0")
+	return defaultClaudeMaxTokens
+}
 
-	// Create HTTP request to Claude API
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(reqBody))
-	if err != nil {
-		log.Printf("[CLAUDE ERROR] Failed to create request: %v", err)
-		return "", err
+// ClaudeTemperature returns the sampling temperature Claude calls are sent with, from 0 for the
+// most consistent sketches to 1 for the most varied, configured by CLAUDE_TEMPERATURE
+func ClaudeTemperature() float64 {
+	raw := os.Getenv("CLAUDE_TEMPERATURE")
+	if raw == "" {
+		return defaultClaudeTemperature
+	}
+	temperature, err := strconv.ParseFloat(raw, 64)
+	if err != nil || temperature < 0 || temperature > 1 {
+		log.Printf("Warning: Ignoring invalid CLAUDE_TEMPERATURE value %q", raw)
+		return defaultClaudeTemperature
 	}
+	return temperature
+}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// ClaudeRequestTimeout returns how long one attempt at a Claude call may take, from sending it
+// until the reply is read, configured by CLAUDE_REQUEST_TIMEOUT_SECONDS. Attempts that time out
+// before Claude answers are retried. 0 leaves attempts bounded only by ClaudeTotalTimeout.
+func ClaudeRequestTimeout() time.Duration {
+	return time.Duration(envLimit("CLAUDE_REQUEST_TIMEOUT_SECONDS", defaultClaudeRequestTimeoutSecs)) * time.Second
+}
 
-	// Send the request
-	log.Printf("[CLAUDE] Sending request to API")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// ClaudeTotalTimeout returns how long a Claude call may take including its retries, configured by
+// CLAUDE_TOTAL_TIMEOUT_SECONDS. 0 leaves calls bounded only by their caller's context.
+func ClaudeTotalTimeout() time.Duration {
+	return time.Duration(envLimit("CLAUDE_TOTAL_TIMEOUT_SECONDS", defaultClaudeTotalTimeoutSecs)) * time.Second
+}
+
+// withClaudeTimeout bounds a Claude call by ClaudeTotalTimeout, or sooner if ctx already has an
+// earlier deadline. Handlers pass the request's context, so calls also end when the client goes away.
+func withClaudeTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := ClaudeTotalTimeout(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// withClaudeRequestTimeout bounds one attempt at a Claude call by ClaudeRequestTimeout
+func withClaudeRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := ClaudeRequestTimeout(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// cancelOnClose ends an attempt's context once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// sendClaudePromptWithModel sends a single user prompt to the given Claude model and returns the text of the reply
+func sendClaudePromptWithModel(ctx context.Context, prompt string, model string, apiKey string) (string, error) {
+	return sendClaudeMessagesWithModel(ctx, userMessages(prompt), model, apiKey)
+}
+
+// sendClaudeMessagesWithModel sends a conversation, which must end with a user message, to the
+// given Claude model and returns the text of the reply
+func sendClaudeMessagesWithModel(ctx context.Context, messages []ClaudeMessage, model string, apiKey string) (string, error) {
+	ctx, span := StartSpan(ctx, "claude.messages", SpanKindClient)
+	defer span.End()
+	ctx, cancel := withClaudeTimeout(ctx)
+	defer cancel()
+
+	resp, err := doClaudeRequest(ctx, span, newClaudeRequest(messages, model), apiKey)
 	if err != nil {
-		log.Printf("[CLAUDE ERROR] Failed to send request: %v", err)
 		return "", err
 	}
 	defer resp.Body.Close()
@@ -219,15 +406,25 @@ Do not include any markdown, HTML, CSS, or explanations. Only return the JavaScr
 		log.Printf("[CLAUDE ERROR] Failed to read response: %v", err)
 		return "", err
 	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("claude returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		log.Printf("[CLAUDE ERROR] %v", err)
+		span.RecordError(err)
+		return "", err
+	}
 
 	// Parse the response
 	var claudeResp ClaudeResponse
 	if err := json.Unmarshal(body, &claudeResp); err != nil {
 		log.Printf("[CLAUDE ERROR] Failed to unmarshal response: %v", err)
+		span.RecordError(err)
 		return "", err
 	}
 
 	log.Printf("[CLAUDE] Response received successfully")
+	meterTokens(ctx, model, claudeResp.Usage)
+	span.SetAttribute("gen_ai.usage.input_tokens", claudeResp.Usage.PromptTokens())
+	span.SetAttribute("gen_ai.usage.output_tokens", claudeResp.Usage.OutputTokens)
 
 	// Extract the animation code from the response
 	var animationCode string
@@ -240,20 +437,208 @@ Do not include any markdown, HTML, CSS, or explanations. Only return the JavaScr
 	return animationCode, nil
 }
 
-// EncodeError writes a JSON error response
+// userMessages is the conversation of a single user prompt
+func userMessages(prompt string) []ClaudeMessage {
+	return []ClaudeMessage{{Role: "user", Content: prompt}}
+}
+
+// newClaudeRequest builds a request for a conversation with the given model, with the system
+// prompt and the configured sampling options
+func newClaudeRequest(messages []ClaudeMessage, model string) ClaudeRequest {
+	return ClaudeRequest{
+		Model:       model,
+		System:      claudeSystemBlocks(),
+		Messages:    messages,
+		MaxTokens:   ClaudeMaxTokens(),
+		Temperature: ClaudeTemperature(),
+	}
+}
+
+// claudeSystemBlocks returns the system prompt as Claude is sent it. It is the same for every call,
+// so it is marked for Claude to cache unless CLAUDE_PROMPT_CACHE is false. Claude only caches
+// prompts above a minimum length and ignores the mark on shorter ones.
+func claudeSystemBlocks() []ClaudeSystemBlock {
+	system := SystemPrompt()
+	if system == "" {
+		return nil
+	}
+	block := ClaudeSystemBlock{Type: "text", Text: system}
+	if cache, set := envBool("CLAUDE_PROMPT_CACHE"); cache || !set {
+		block.CacheControl = &ClaudeCacheControl{Type: "ephemeral"}
+	}
+	return []ClaudeSystemBlock{block}
+}
+
+// doClaudeRequest sends claudeReq to the Messages API and returns the response for the caller to
+// read and close. Requests that fail on the way or are answered with a retryable status are sent
+// again as ClaudeRetryPolicyFromEnv allows, and only the last failure is returned once retries run
+// out. Every answer counts towards the generation status on GET /status.
+func doClaudeRequest(ctx context.Context, span *Span, claudeReq ClaudeRequest, apiKey string) (*http.Response, error) {
+	// Convert request to JSON
+	reqBody, err := json.Marshal(claudeReq)
+	if err != nil {
+		log.Printf("[CLAUDE ERROR] Failed to marshal request: %v", err)
+		return nil, err
+	}
+
+	span.SetAttribute("gen_ai.system", "anthropic")
+	span.SetAttribute("gen_ai.request.model", claudeReq.Model)
+
+	policy := ClaudeRetryPolicyFromEnv()
+	for retry := 0; ; retry++ {
+		resp, retryAfter, err := sendClaudeAttempt(ctx, span, reqBody, apiKey)
+		if err == nil {
+			span.SetAttribute("http.request.resend_count", retry)
+			return resp, nil
+		}
+		// A request the caller gave up on is not retried, nor one turned away by a full queue
+		if ctx.Err() != nil || errors.Is(err, ErrClaudeBusy) {
+			return nil, err
+		}
+
+		wait, ok := policy.delay(retry, retryAfter, time.Now())
+		if !ok || !waitToRetry(ctx, wait) {
+			span.SetAttribute("http.request.resend_count", retry)
+			if retry > 0 {
+				err = fmt.Errorf("claude API still failing after %d attempts: %w", retry+1, err)
+			}
+			log.Printf("[CLAUDE ERROR] Giving up: %v", err)
+			return nil, err
+		}
+		log.Printf("[CLAUDE] Retrying in %v after: %v", wait.Round(time.Millisecond), err)
+	}
+}
+
+// sendClaudeAttempt sends a marshaled request to the Messages API once, after waiting for a slot in
+// ClaudeCallPool, which it holds until the response is closed. Responses with a retryable status
+// are closed and turned into an error, returned with their Retry-After header.
+func sendClaudeAttempt(ctx context.Context, span *Span, reqBody []byte, apiKey string) (*http.Response, string, error) {
+	// Waiting for a slot counts against the whole call's deadline, not the attempt's
+	release, err := ClaudeCallPool().acquire(ctx)
+	if err != nil {
+		log.Printf("[CLAUDE ERROR] No slot for request: %v", err)
+		span.RecordError(err)
+		return nil, "", err
+	}
+	attemptCtx, cancelAttempt := withClaudeRequestTimeout(ctx)
+	cancel := func() {
+		cancelAttempt()
+		release()
+	}
+
+	// Create HTTP request to Claude API
+	req, err := http.NewRequestWithContext(attemptCtx, "POST", claudeMessagesURL, bytes.NewReader(reqBody))
+	if err != nil {
+		cancel()
+		log.Printf("[CLAUDE ERROR] Failed to create request: %v", err)
+		return nil, "", err
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	if traceParent := span.TraceParent(); traceParent != "" {
+		req.Header.Set("traceparent", traceParent)
+	}
+	correlation, _ := GetCorrelationFromContext(ctx)
+	if correlation.RequestID != "" {
+		req.Header.Set(ClientRequestIDHeader, correlation.RequestID)
+	}
+
+	if err := injectFault(attemptCtx, ChaosTargetClaude); err != nil {
+		cancel()
+		log.Printf("[CLAUDE ERROR] Failed to send request: %v", err)
+		span.RecordError(err)
+		recordProviderCall(false)
+		return nil, "", err
+	}
+
+	// Send the request
+	log.Printf("[CLAUDE] Sending request to API %s", correlation)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("claude did not answer within %v: %w", ClaudeRequestTimeout(), err)
+		}
+		log.Printf("[CLAUDE ERROR] Failed to send request %s: %v", correlation, err)
+		span.RecordError(err)
+		// A request the caller gave up on says nothing about Claude
+		if ctx.Err() == nil {
+			recordProviderCall(false)
+		}
+		return nil, "", err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	// Claude's own request ID is what Anthropic support asks for
+	if claudeRequestId := resp.Header.Get("request-id"); claudeRequestId != "" {
+		span.SetAttribute("anthropic.request_id", claudeRequestId)
+		log.Printf("[CLAUDE] Claude request %s answered %d %s", claudeRequestId, resp.StatusCode, correlation)
+	}
+	// Rate limiting and overload count against the generation status on GET /status
+	recordProviderCall(!retryableStatus(resp.StatusCode))
+
+	if retryableStatus(resp.StatusCode) {
+		defer cancel()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamLine))
+		err := fmt.Errorf("claude returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		log.Printf("[CLAUDE ERROR] %v", err)
+		span.RecordError(err)
+		return nil, resp.Header.Get("Retry-After"), err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, "", nil
+}
+
+// EncodeError writes a JSON error response, coded by its status
 func EncodeError(w http.ResponseWriter, message string, statusCode int) {
+	EncodeErrorCode(w, StatusErrorCode(statusCode), message, statusCode)
+}
+
+// EncodeErrorCode writes a JSON error response with a code of its own, for errors clients are
+// expected to tell apart from others with the same status
+func EncodeErrorCode(w http.ResponseWriter, code ErrorCode, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	response := struct {
-		Error  string `json:"error"`
-		Status int    `json:"status"`
+		Error  string    `json:"error"`
+		Code   ErrorCode `json:"code"`
+		Status int       `json:"status"`
 	}{
 		Error:  message,
+		Code:   code,
 		Status: statusCode,
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// EncodeValidationError writes a 400 JSON error listing the request fields at fault. A request
+// whose only fault has a code of its own, such as INVALID_MOOD, is answered with that code rather
+// than VALIDATION_FAILED.
+func EncodeValidationError(w http.ResponseWriter, message string, fields []FieldError) {
+	code := ErrCodeValidationFailed
+	if len(fields) == 1 && isClientErrorCode(fields[0].Code) {
+		code = fields[0].Code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	response := struct {
+		Error  string       `json:"error"`
+		Code   ErrorCode    `json:"code"`
+		Status int          `json:"status"`
+		Fields []FieldError `json:"fields"`
+	}{
+		Error:  message,
+		Code:   code,
+		Status: http.StatusBadRequest,
+		Fields: fields,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
 // SanitizeAnimationCode cleans up the raw JavaScript code from Claude
 func SanitizeAnimationCode(raw string) string {
 	// Remove markdown code blocks if present
@@ -1,11 +1,16 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestJWTSecretValidation(t *testing.T) {
@@ -53,14 +58,15 @@ func TestEncodeError(t *testing.T) {
 	}
 
 	var body struct {
-		Error  string `json:"error"`
-		Status int    `json:"status"`
+		Error  string    `json:"error"`
+		Code   ErrorCode `json:"code"`
+		Status int       `json:"status"`
 	}
 	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
 		t.Fatalf("decode response: %v", err)
 	}
-	if body.Error != "invalid request" || body.Status != http.StatusBadRequest {
-		t.Errorf("body = %+v, want error %q and status %d", body, "invalid request", http.StatusBadRequest)
+	if body.Error != "invalid request" || body.Code != ErrCodeInvalidRequest || body.Status != http.StatusBadRequest {
+		t.Errorf("body = %+v, want error %q, code %s and status %d", body, "invalid request", ErrCodeInvalidRequest, http.StatusBadRequest)
 	}
 }
 
@@ -107,6 +113,35 @@ func TestSanitizeAnimationCode(t *testing.T) {
 	}
 }
 
+// Preprocessing leaves member expressions such as Math.floor as they are
+func TestPreprocessP5CodeKeepsMemberExpressions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "Math calls",
+			input: "function draw() {\n  let x = Math.floor(random(width));\n  circle(x, Math.PI * 2, 10);\n}",
+		},
+		{
+			name:  "Property assignment",
+			input: "function draw() {\n  particle.pos.x = Math.max(0, particle.pos.x - 1);\n}",
+		},
+		{
+			name:  "Array element property",
+			input: "function draw() {\n  dots[i].size = Math.sin(frameCount * 0.1);\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := PreprocessP5Code(tt.input); result != tt.input {
+				t.Errorf("PreprocessP5Code() = %q, want unchanged %q", result, tt.input)
+			}
+		})
+	}
+}
+
 func TestValidateP5jsCode(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -209,3 +244,140 @@ func TestGenerateP5jsExample(t *testing.T) {
 		t.Error("Example code should handle window resizing")
 	}
 }
+
+func TestClaudeTimeouts(t *testing.T) {
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+	t.Setenv("CLAUDE_RETRY_BASE_DELAY_MS", "1")
+
+	tests := []struct {
+		name           string
+		requestTimeout string
+		totalTimeout   string
+		answerFrom     int32
+		wantErr        error
+		wantCalls      int32
+	}{
+		{name: "Hung attempt retried", requestTimeout: "1", totalTimeout: "0", answerFrom: 2, wantCalls: 2},
+		{name: "Overall deadline", requestTimeout: "0", totalTimeout: "1", answerFrom: 100, wantErr: context.DeadlineExceeded, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLAUDE_REQUEST_TIMEOUT_SECONDS", tt.requestTimeout)
+			t.Setenv("CLAUDE_TOTAL_TIMEOUT_SECONDS", tt.totalTimeout)
+
+			var calls atomic.Int32
+			claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The server only notices the client hanging up once the body is read
+				io.Copy(io.Discard, r.Body)
+				if calls.Add(1) < tt.answerFrom {
+					// Hang until the client gives up
+					<-r.Context().Done()
+					return
+				}
+				w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}"}]}`))
+			}))
+			defer claude.Close()
+			savedURL := claudeMessagesURL
+			claudeMessagesURL = claude.URL
+			defer func() { claudeMessagesURL = savedURL }()
+
+			start := time.Now()
+			_, err := sendClaudePromptWithModel(context.Background(), "a calm ocean", DefaultClaudeModel, "test-key")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("sendClaudePromptWithModel() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("took %v, want the timeouts to end it", elapsed)
+			}
+		})
+	}
+}
+
+func TestClaudeCallEndsWithCaller(t *testing.T) {
+	var calls atomic.Int32
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		calls.Add(1)
+		<-r.Context().Done()
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	defer func() { claudeMessagesURL = savedURL }()
+
+	// A client going away cancels the request's context
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := sendClaudePromptWithModel(ctx, "a calm ocean", DefaultClaudeModel, "test-key"); !errors.Is(err, context.Canceled) {
+		t.Errorf("sendClaudePromptWithModel() error = %v, want it canceled", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want no retries once the caller gave up", calls.Load())
+	}
+}
+
+func TestClaudeRequestOptions(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxTokens       string
+		temperature     string
+		promptCache     string
+		wantMaxTokens   int
+		wantTemperature float64
+		wantCached      bool
+	}{
+		{name: "Defaults", wantMaxTokens: defaultClaudeMaxTokens, wantTemperature: defaultClaudeTemperature, wantCached: true},
+		{name: "Configured", maxTokens: "4096", temperature: "0.2", promptCache: "false", wantMaxTokens: 4096, wantTemperature: 0.2},
+		{name: "Zero temperature", temperature: "0", promptCache: "true", wantMaxTokens: defaultClaudeMaxTokens, wantTemperature: 0, wantCached: true},
+		{name: "Out of range", maxTokens: "0", temperature: "1.5", wantMaxTokens: defaultClaudeMaxTokens, wantTemperature: defaultClaudeTemperature, wantCached: true},
+		{name: "Invalid", maxTokens: "lots", temperature: "warm", promptCache: "sometimes", wantMaxTokens: defaultClaudeMaxTokens, wantTemperature: defaultClaudeTemperature, wantCached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLAUDE_MAX_TOKENS", tt.maxTokens)
+			t.Setenv("CLAUDE_TEMPERATURE", tt.temperature)
+			t.Setenv("CLAUDE_PROMPT_CACHE", tt.promptCache)
+			t.Setenv("PROMPT_CANVAS_TARGET", "stage")
+
+			var sent map[string]any
+			var sentRequest ClaudeRequest
+			claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				json.Unmarshal(body, &sent)
+				json.Unmarshal(body, &sentRequest)
+				w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}"}]}`))
+			}))
+			defer claude.Close()
+			savedURL := claudeMessagesURL
+			claudeMessagesURL = claude.URL
+			defer func() { claudeMessagesURL = savedURL }()
+
+			if _, err := sendClaudePromptWithModel(context.Background(), "a calm ocean", DefaultClaudeModel, "test-key"); err != nil {
+				t.Fatalf("sendClaudePromptWithModel: %v", err)
+			}
+			// Decoded as JSON numbers, and a zero temperature must still be sent
+			if sent["max_tokens"] != float64(tt.wantMaxTokens) || sent["temperature"] != tt.wantTemperature {
+				t.Errorf("max_tokens = %v, temperature = %v, want %d and %v", sent["max_tokens"], sent["temperature"], tt.wantMaxTokens, tt.wantTemperature)
+			}
+			if len(sentRequest.System) != 1 {
+				t.Fatalf("system = %+v, want one block", sentRequest.System)
+			}
+			system := sentRequest.System[0]
+			if system.Type != "text" || !strings.Contains(system.Text, `id "stage"`) || !strings.Contains(system.Text, "Only return the JavaScript code") {
+				t.Errorf("system = %q, want the instructions for the canvas target", system.Text)
+			}
+			if cached := system.CacheControl != nil && system.CacheControl.Type == "ephemeral"; cached != tt.wantCached {
+				t.Errorf("system cache control = %+v, want cached %v", system.CacheControl, tt.wantCached)
+			}
+			messages, _ := sent["messages"].([]any)
+			if len(messages) != 1 || messages[0].(map[string]any)["content"] != "a calm ocean" {
+				t.Errorf("messages = %v, want only the prompt", messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// IdempotencyKeyHeader carries the key clients retry a request under, and IdempotentReplayedHeader
+// marks the responses replayed for a retry
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes caps the request bodies hashed to tell a retry from another request
+	maxIdempotentBodyBytes = 1 << 20
+	// idempotencyKeyTTL is how long a response is replayed for retries with its key
+	idempotencyKeyTTL = 24 * time.Hour
+	// idempotencyLockTimeout is how long a request may hold its key before it is taken to have
+	// died with its instance, and a retry may run again
+	idempotencyLockTimeout = 5 * time.Minute
+	// idempotencyPruneEvery is how often expired keys are deleted
+	idempotencyPruneEvery = time.Hour
+)
+
+// idempotentHeaders are the response headers replayed along with the status and body. API-Version
+// is among them so a replay names the version its body was rendered in.
+var idempotentHeaders = []string{"Content-Type", "Location", GenerationJobHeader, APIVersionHeader}
+
+// Responses replayed for retries, and retries turned away while the first request still ran or
+// because the key was sent with another request
+var idempotentReplays, idempotentConflicts atomic.Int64
+
+// validIdempotencyKey reports whether key is 1-255 printable ASCII characters
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyRecorder passes a response through while keeping a copy of its status and body
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Idempotent lets clients retry a request safely by sending an Idempotency-Key. The first
+// successful response to a user's key on a route is kept for idempotencyKeyTTL and replayed to
+// retries with the same key and body, so the request is not run twice. Responses that are not
+// successful are not kept, and a retry runs the request again. It must run after AuthMiddleware.
+func (s *Server) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if r.Method == http.MethodOptions || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			LogResponse(r.URL.Path, "Invalid idempotency key", nil)
+			EncodeError(w, "Idempotency-Key must be 1-255 printable characters", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			LogResponse(r.URL.Path, "Error reading request body", err)
+			EncodeError(w, "Invalid request format", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are shared by every API version of a route, so a retry may land on another version
+		// than the first request. It still gets the first response, rendered in the first
+		// request's version and saying so in API-Version, rather than saving again.
+		route, ok := currentRouteKey(r)
+		if !ok {
+			route = r.Method + " " + r.URL.Path
+		}
+		userId, _ := GetUserIDFromContext(r.Context())
+		now := time.Now()
+		claim := IdempotencyKey{
+			UserID:      userId,
+			Route:       route,
+			Key:         key,
+			RequestHash: HashToken(string(body)),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyKeyTTL),
+		}
+		existing, reserved, err := s.store.ReserveIdempotencyKey(r.Context(), claim, now.Add(-idempotencyLockTimeout))
+		if err != nil {
+			LogResponse(r.URL.Path, "Error reserving idempotency key", err)
+			EncodeError(w, "Error checking idempotency key", http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			switch {
+			case existing.RequestHash != claim.RequestHash:
+				idempotentConflicts.Add(1)
+				LogResponse(r.URL.Path, "Idempotency key of user "+userId+" reused with another request", nil)
+				EncodeErrorCode(w, ErrCodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+			case existing.Status == 0:
+				idempotentConflicts.Add(1)
+				LogResponse(r.URL.Path, "Idempotency key of user "+userId+" still in use", nil)
+				w.Header().Set("Retry-After", "1")
+				EncodeErrorCode(w, ErrCodeIdempotencyKeyInUse, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+			default:
+				idempotentReplays.Add(1)
+				LogResponse(r.URL.Path, "Replayed the response to an idempotency key of user "+userId, nil)
+				// The retry's own version is dropped for the first response's, if it had one
+				w.Header().Del(APIVersionHeader)
+				for name, value := range existing.Headers {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// The response is kept even when the client hung up, which is when it will retry
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status < http.StatusOK || rec.status >= http.StatusMultipleChoices {
+			if err := s.store.ReleaseIdempotencyKey(ctx, claim); err != nil {
+				log.Printf("[IDEMPOTENCY] Failed to release a key of user %s on %s: %v", userId, claim.Route, err)
+			}
+			return
+		}
+		claim.Status, claim.Body, claim.Headers = rec.status, rec.body.Bytes(), map[string]string{}
+		for _, name := range idempotentHeaders {
+			if value := rec.Header().Get(name); value != "" {
+				claim.Headers[name] = value
+			}
+		}
+		if err := s.store.CompleteIdempotencyKey(ctx, claim); err != nil {
+			log.Printf("[IDEMPOTENCY] Failed to save the response to a key of user %s on %s: %v", userId, claim.Route, err)
+		}
+	})
+}
+
+// RunIdempotencyKeyPruner deletes expired idempotency keys in every region every
+// idempotencyPruneEvery, until ctx is done
+func RunIdempotencyKeyPruner(ctx context.Context, store Store) {
+	ticker := time.NewTicker(idempotencyPruneEvery)
+	defer ticker.Stop()
+	for {
+		deleted, err := deleteInEveryDataRegion(ctx, func(ctx context.Context) (int, error) {
+			return store.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+		})
+		if err != nil {
+			log.Printf("[IDEMPOTENCY] Failed to delete expired idempotency keys: %v", err)
+		} else if deleted > 0 {
+			log.Printf("[IDEMPOTENCY] Deleted %d expired idempotency keys", deleted)
+		}
+		recordWorkerPass("idempotency keys", idempotencyPruneEvery, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeIdempotencyMetrics reports how retries with an Idempotency-Key were answered
+func writeIdempotencyMetrics(w io.Writer) {
+	writeMetric(w, "animate_idempotent_replays_total", "counter", "Total responses replayed for retries with an Idempotency-Key.", float64(idempotentReplays.Load()))
+	writeMetric(w, "animate_idempotent_conflicts_total", "counter", "Total retries with an Idempotency-Key refused while the first request ran or because the body differed.", float64(idempotentConflicts.Load()))
+}
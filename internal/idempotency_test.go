@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	user := registerAccount(t, router, "retrier")
+	other := registerAccount(t, router, "other")
+
+	save := func(path, token, key string, body SaveAnimationRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "Retried"}
+
+	first := save("/save-animation", user.Token, "save-1", sketch)
+	if first.Code != http.StatusOK || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("save status = %d, replayed %q", first.Code, first.Header().Get(IdempotentReplayedHeader))
+	}
+	// Retries on any API version are answered with the first response, in the first request's
+	// version, without saving again
+	for _, path := range []string{"/save-animation", "/v1/save-animation", "/v2/save-animation"} {
+		retry := save(path, user.Token, "save-1", sketch)
+		if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+			t.Errorf("retry on %s = %d %s, want the first response replayed", path, retry.Code, retry.Body.String())
+		}
+		if got, want := retry.Header().Get(APIVersionHeader), first.Header().Get(APIVersionHeader); got != want {
+			t.Errorf("retry on %s has %s %q, want %q of the first response", path, APIVersionHeader, got, want)
+		}
+	}
+	if len(store.animations) != 1 {
+		t.Errorf("saved %d animations, want 1", len(store.animations))
+	}
+
+	versioned := save("/v2/save-animation", user.Token, "save-v2", sketch)
+	if retry := save("/v1/save-animation", user.Token, "save-v2", sketch); retry.Header().Get(APIVersionHeader) != string(APIVersionV2) || retry.Body.String() != versioned.Body.String() {
+		t.Errorf("v1 retry of a v2 save = %s %s, want the v2 response", retry.Header().Get(APIVersionHeader), retry.Body.String())
+	}
+
+	// Keys belong to their user, and are not replayed for other requests
+	if rec := save("/save-animation", other.Token, "save-1", sketch); rec.Code != http.StatusOK || rec.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("another user's save status = %d, want a new save", rec.Code)
+	}
+	if rec := save("/save-animation", user.Token, "save-1", SaveAnimationRequest{Code: sketch.Code, Description: "Changed"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := save("/save-animation", user.Token, "bad\tkey", sketch); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid key status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Failed requests are not kept, so they can be fixed and retried under the same key
+	if rec := save("/save-animation", user.Token, "save-2", SaveAnimationRequest{}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid save status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := save("/save-animation", user.Token, "save-2", sketch); rec.Code != http.StatusOK || rec.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("retry after a failure status = %d, want a new save", rec.Code)
+	}
+
+	// A key still held by a running request turns retries away, until the request is taken to have died
+	payload, err := json.Marshal(sketch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	held := IdempotencyKey{UserID: user.User.ID, Route: "POST /save-animation", Key: "save-3", RequestHash: HashToken(string(payload)),
+		CreatedAt: now.Add(-time.Minute), ExpiresAt: now.Add(idempotencyKeyTTL)}
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, held, now.Add(-idempotencyLockTimeout)); err != nil || !reserved {
+		t.Fatalf("reserve = %v, %v", reserved, err)
+	}
+	if rec := save("/save-animation", user.Token, "save-3", sketch); rec.Code != http.StatusConflict {
+		t.Errorf("save while held status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if _, reserved, _ := store.ReserveIdempotencyKey(ctx, held, now); !reserved {
+		t.Error("reserve of a stale claim = false, want true")
+	}
+
+	if deleted, err := store.DeleteExpiredIdempotencyKeys(ctx, now.Add(idempotencyKeyTTL+time.Minute)); err != nil || deleted != 5 {
+		t.Errorf("delete expired = %d, %v, want 5", deleted, err)
+	}
+}
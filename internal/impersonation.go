@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Impersonation statuses. Expired is never stored; it is reported for pending and approved
+// impersonations no one started in time, and active ones past their expiry.
+const (
+	ImpersonationPending  = "pending"
+	ImpersonationApproved = "approved"
+	ImpersonationDenied   = "denied"
+	ImpersonationActive   = "active"
+	ImpersonationEnded    = "ended"
+	ImpersonationExpired  = "expired"
+)
+
+// Actions recorded in the impersonation audit trail
+const (
+	ImpersonationAuditRequested = "requested"
+	ImpersonationAuditApproved  = "approved"
+	ImpersonationAuditDenied    = "denied"
+	ImpersonationAuditStarted   = "started"
+	ImpersonationAuditEnded     = "ended"
+	// ImpersonationAuditRequest records each request made with the token, with its route and status
+	ImpersonationAuditRequest = "request"
+	// ImpersonationAuditRefused records each request the token was turned away from
+	ImpersonationAuditRefused = "refused"
+)
+
+const (
+	// impersonationTokenPrefix marks impersonation tokens apart from the JWTs users sign in with
+	impersonationTokenPrefix     = "imp_"
+	defaultImpersonationMinutes  = 15
+	maxImpersonationMinutes      = 60
+	maxImpersonationReasonLength = 500
+	// impersonationRequestTTL is how long an impersonation may wait for the user's approval, and
+	// then for the admin to start it
+	impersonationRequestTTL = 24 * time.Hour
+	// maxListedImpersonations caps how many impersonations the admin list returns
+	maxListedImpersonations = 100
+)
+
+// impersonationRoutes are the routes an impersonation token opens, by method and path template.
+// They are the reads that show how the service looks to the user, so a session cannot change the
+// account or reach admin and professional routes.
+var impersonationRoutes = map[string]bool{
+	http.MethodGet + " /feed":                         true,
+	http.MethodGet + " /search":                       true,
+	http.MethodGet + " /search/semantic":              true,
+	http.MethodGet + " /announcements/active":         true,
+	http.MethodGet + " /animation/{id}":               true,
+	http.MethodGet + " /my-animations":                true,
+	http.MethodGet + " /quota":                        true,
+	http.MethodGet + " /moods":                        true,
+	http.MethodGet + " /me/preferences/content":       true,
+	http.MethodGet + " /me/preferences/notifications": true,
+	http.MethodGet + " /me/reminders":                 true,
+	http.MethodGet + " /me/sessions":                  true,
+	http.MethodGet + " /me/collections":               true,
+	http.MethodGet + " /me/prompt-presets":            true,
+	http.MethodGet + " /me/organization":              true,
+	http.MethodGet + " /subscriptions":                true,
+}
+
+// impersonationKey holds the impersonation a request was authenticated with
+const impersonationKey contextKey = "impersonation"
+
+// GetImpersonationFromContext retrieves the impersonation an admin made a request in
+func GetImpersonationFromContext(ctx context.Context) (Impersonation, bool) {
+	impersonation, ok := ctx.Value(impersonationKey).(Impersonation)
+	return impersonation, ok
+}
+
+// ImpersonationConsentRequired reports whether every impersonation waits for the user's approval,
+// from IMPERSONATION_REQUIRE_CONSENT. Otherwise admins choose per impersonation.
+func ImpersonationConsentRequired() bool {
+	required, _ := envBool("IMPERSONATION_REQUIRE_CONSENT")
+	return required
+}
+
+// newImpersonationToken returns a random impersonation token and the hash it is stored under
+func newImpersonationToken() (string, string, error) {
+	secret, err := generateRandomID()
+	if err != nil {
+		return "", "", err
+	}
+	token := impersonationTokenPrefix + secret
+	return token, HashToken(token), nil
+}
+
+// Expired reports whether the impersonation can no longer be approved, started or used at now
+func (i Impersonation) Expired(now time.Time) bool {
+	switch i.Status {
+	case ImpersonationPending, ImpersonationApproved:
+		return !now.Before(i.CreatedAt.Add(impersonationRequestTTL))
+	case ImpersonationActive:
+		return i.ExpiresAt == nil || !now.Before(*i.ExpiresAt)
+	}
+	return false
+}
+
+// reported returns the impersonation as clients see it, with its status expired once it is
+func (i Impersonation) reported(now time.Time) Impersonation {
+	if i.Expired(now) {
+		i.Status = ImpersonationExpired
+	}
+	return i
+}
+
+// ImpersonationMiddleware authenticates admins by the impersonation token they send as a bearer
+// token, on the routes impersonationRoutes opens, and adds the impersonated user and the
+// impersonation to the context. Every request made with the token is recorded in the
+// impersonation's audit trail, including those turned away. Requests with any other credentials
+// pass through untouched; the auth middlewares after it let impersonated requests through.
+func (s *Server) ImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if r.Method == http.MethodOptions || !bearer || !strings.HasPrefix(secret, impersonationTokenPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		impersonation, err := s.store.GetImpersonationByTokenHash(r.Context(), HashToken(secret))
+		if err != nil && err.Error() != "impersonation not found" {
+			LogResponse(r.URL.Path, "Error retrieving impersonation", err)
+			EncodeError(w, "Error retrieving impersonation", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || impersonation.Status != ImpersonationActive || impersonation.Expired(time.Now()) {
+			EncodeError(w, "Invalid or expired impersonation token", http.StatusUnauthorized)
+			return
+		}
+		request := r.Method + " " + r.URL.RequestURI()
+		if route, ok := currentRouteKey(r); !ok || !impersonationRoutes[route] {
+			s.recordImpersonationAudit(r.Context(), impersonation.ID, impersonation.AdminID, ImpersonationAuditRefused, request)
+			LogResponse(r.URL.Path, fmt.Sprintf("Impersonation %d refused %s", impersonation.ID, request), nil)
+			EncodeError(w, "Impersonation sessions may not use this route", http.StatusForbidden)
+			return
+		}
+
+		wrw := newResponseWriter(w)
+		ctx := SetUserIDInContext(r.Context(), impersonation.UserID)
+		next.ServeHTTP(wrw, r.WithContext(context.WithValue(ctx, impersonationKey, impersonation)))
+		s.recordImpersonationAudit(r.Context(), impersonation.ID, impersonation.AdminID, ImpersonationAuditRequest, fmt.Sprintf("%s %d", request, wrw.statusCode))
+	})
+}
+
+// recordImpersonationAudit appends to an impersonation's audit trail, logging rather than failing
+// the request when it cannot
+func (s *Server) recordImpersonationAudit(ctx context.Context, id int, actorId, action, detail string) {
+	entry := ImpersonationAuditEntry{ImpersonationID: id, ActorID: actorId, Action: action, Detail: detail}
+	if err := s.store.RecordImpersonationAudit(ctx, entry); err != nil {
+		log.Printf("[IMPERSONATION] Failed to record %s on impersonation %d: %v", action, id, err)
+	}
+}
+
+// sendImpersonationNotice emails the user about an impersonation of their account. Like other
+// security emails it does not go through notification preferences.
+func (s *Server) sendImpersonationNotice(ctx context.Context, impersonation Impersonation) {
+	user, err := s.store.GetUserDetails(ctx, impersonation.UserID)
+	if err != nil {
+		log.Printf("[IMPERSONATION] Failed to look up user %s for impersonation %d: %v", impersonation.UserID, impersonation.ID, err)
+		return
+	}
+
+	manage := PublicURL("/me/impersonations")
+	var subject, body string
+	if impersonation.Status == ImpersonationPending {
+		subject = "An Animate administrator asks to view your account"
+		body = "An administrator asks to view Animate as you for " + fmt.Sprint(impersonation.Minutes) + " minutes, to look into:\n\n" +
+			impersonation.Reason + "\n\nThey can only see what you see, and cannot change anything. " +
+			"Approve or deny the request within " + impersonationRequestTTL.String() + " at " + manage + ".\n"
+	} else {
+		subject = "An Animate administrator is viewing your account"
+		body = "An administrator is viewing Animate as you until " + impersonation.ExpiresAt.UTC().Format(time.RFC1123) + ", to look into:\n\n" +
+			impersonation.Reason + "\n\nThey can only see what you see, and cannot change anything. " +
+			"See everything they opened, or end the session, at " + manage + ".\n"
+	}
+	if err := s.mailer.Send(user.Email, subject, body); err != nil {
+		log.Printf("[IMPERSONATION] Failed to send notice of impersonation %d: %v", impersonation.ID, err)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImpersonationExpired(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Minute), now.Add(-time.Minute)
+	tests := []struct {
+		name          string
+		impersonation Impersonation
+		want          bool
+	}{
+		{name: "Pending", impersonation: Impersonation{Status: ImpersonationPending, CreatedAt: now.Add(-time.Hour)}},
+		{name: "Pending too long", impersonation: Impersonation{Status: ImpersonationPending, CreatedAt: now.Add(-impersonationRequestTTL)}, want: true},
+		{name: "Approved too long", impersonation: Impersonation{Status: ImpersonationApproved, CreatedAt: now.Add(-impersonationRequestTTL - time.Hour)}, want: true},
+		{name: "Active", impersonation: Impersonation{Status: ImpersonationActive, CreatedAt: earlier, ExpiresAt: &later}},
+		{name: "Active past its expiry", impersonation: Impersonation{Status: ImpersonationActive, CreatedAt: earlier, ExpiresAt: &earlier}, want: true},
+		{name: "Ended", impersonation: Impersonation{Status: ImpersonationEnded, CreatedAt: now.Add(-impersonationRequestTTL), ExpiresAt: &earlier}},
+	}
+	for _, tt := range tests {
+		if got := tt.impersonation.Expired(now); got != tt.want {
+			t.Errorf("%s: Expired() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	user := registerAccount(t, router, "viewer")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+
+	impersonate := func(token, userId string, req ImpersonationRequest, wantCode int) Impersonation {
+		t.Helper()
+		var impersonation Impersonation
+		if code := doJSON(t, router, http.MethodPost, "/admin/users/"+userId+"/impersonations", token, req, &impersonation); code != wantCode {
+			t.Fatalf("impersonate %s status = %d, want %d", userId, code, wantCode)
+		}
+		return impersonation
+	}
+	impersonate(user.Token, admin.User.ID, ImpersonationRequest{Reason: "Curious"}, http.StatusForbidden)
+	impersonate(admin.Token, admin.User.ID, ImpersonationRequest{Reason: "Testing"}, http.StatusForbidden)
+	impersonate(admin.Token, "missing", ImpersonationRequest{Reason: "Testing"}, http.StatusNotFound)
+	impersonate(admin.Token, user.User.ID, ImpersonationRequest{Reason: " "}, http.StatusBadRequest)
+	impersonate(admin.Token, user.User.ID, ImpersonationRequest{Reason: "Testing", Minutes: 90}, http.StatusBadRequest)
+
+	session := impersonate(admin.Token, user.User.ID, ImpersonationRequest{Reason: "Their feed is empty"}, http.StatusCreated)
+	if session.Status != ImpersonationActive || session.Minutes != defaultImpersonationMinutes || !strings.HasPrefix(session.Token, impersonationTokenPrefix) {
+		t.Fatalf("impersonation = %+v, want an active one with a token", session)
+	}
+
+	// The session reads as the user, and nothing else
+	if code := doJSON(t, router, http.MethodGet, "/v2/me/preferences/content", session.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("content preferences status = %d, want %d", code, http.StatusOK)
+	}
+	for _, call := range []struct{ method, path string }{
+		{http.MethodPost, "/save-mood"},
+		{http.MethodPatch, "/profile"},
+		{http.MethodGet, "/admin/impersonations"},
+		{http.MethodGet, "/me/impersonations"},
+	} {
+		if code := doJSON(t, router, call.method, call.path, session.Token, map[string]string{}, nil); code != http.StatusForbidden {
+			t.Errorf("%s %s status = %d, want %d", call.method, call.path, code, http.StatusForbidden)
+		}
+	}
+
+	var audit []ImpersonationAuditEntry
+	auditPath := "/me/impersonations/" + strconv.Itoa(session.ID) + "/audit"
+	if code := doJSON(t, router, http.MethodGet, auditPath, user.Token, nil, &audit); code != http.StatusOK {
+		t.Fatalf("audit status = %d", code)
+	}
+	var actions []string
+	for _, entry := range audit {
+		actions = append(actions, entry.Action+" "+entry.Detail)
+	}
+	want := []string{"requested Their feed is empty", "started ", "request GET /v2/me/preferences/content 200", "refused POST /save-mood",
+		"refused PATCH /profile", "refused GET /admin/impersonations", "refused GET /me/impersonations"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("audit = %q, want %q", actions, want)
+	}
+
+	// Users end sessions of their account, after which the token stops working
+	path := "/me/impersonations/" + strconv.Itoa(session.ID)
+	if code := doJSON(t, router, http.MethodDelete, path, user.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("end status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := doJSON(t, router, http.MethodDelete, path, user.Token, nil, nil); code != http.StatusConflict {
+		t.Errorf("ending again status = %d, want %d", code, http.StatusConflict)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/me/preferences/content", session.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("content preferences after the end status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// With consent required the session waits for the user's approval
+	pending := impersonate(admin.Token, user.User.ID, ImpersonationRequest{Reason: "Reminders never arrive", RequireConsent: true}, http.StatusAccepted)
+	if pending.Status != ImpersonationPending || pending.Token != "" {
+		t.Fatalf("impersonation = %+v, want a pending one without a token", pending)
+	}
+	tokenPath := "/admin/impersonations/" + strconv.Itoa(pending.ID) + "/token"
+	if code := doJSON(t, router, http.MethodPost, tokenPath, admin.Token, nil, nil); code != http.StatusConflict {
+		t.Errorf("start before approval status = %d, want %d", code, http.StatusConflict)
+	}
+	approvePath := "/me/impersonations/" + strconv.Itoa(pending.ID) + "/approve"
+	if code := doJSON(t, router, http.MethodPost, approvePath, admin.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("approving another user's impersonation status = %d, want %d", code, http.StatusNotFound)
+	}
+	var approved Impersonation
+	if code := doJSON(t, router, http.MethodPost, approvePath, user.Token, nil, &approved); code != http.StatusOK || approved.Status != ImpersonationApproved || approved.DecidedAt == nil {
+		t.Errorf("approve = %d %+v, want it approved", code, approved)
+	}
+	var started Impersonation
+	if code := doJSON(t, router, http.MethodPost, tokenPath, admin.Token, nil, &started); code != http.StatusCreated || started.Token == "" {
+		t.Errorf("start = %d %+v, want a token", code, started)
+	}
+	if code := doJSON(t, router, http.MethodPost, tokenPath, admin.Token, nil, nil); code != http.StatusConflict {
+		t.Errorf("starting again status = %d, want %d", code, http.StatusConflict)
+	}
+
+	// IMPERSONATION_REQUIRE_CONSENT makes every impersonation wait, and users may refuse
+	t.Setenv("IMPERSONATION_REQUIRE_CONSENT", "true")
+	refused := impersonate(admin.Token, user.User.ID, ImpersonationRequest{Reason: "Search misses animations"}, http.StatusAccepted)
+	if code := doJSON(t, router, http.MethodPost, "/me/impersonations/"+strconv.Itoa(refused.ID)+"/deny", user.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("deny status = %d, want %d", code, http.StatusOK)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/admin/impersonations/"+strconv.Itoa(refused.ID)+"/token", admin.Token, nil, nil); code != http.StatusConflict {
+		t.Errorf("start after denial status = %d, want %d", code, http.StatusConflict)
+	}
+
+	var list ImpersonationsResponse
+	if code := doJSON(t, router, http.MethodGet, "/admin/impersonations?userId="+user.User.ID, admin.Token, nil, &list); code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	var statuses []string
+	for _, impersonation := range list.Impersonations {
+		statuses = append(statuses, impersonation.Status)
+	}
+	if want := []string{ImpersonationDenied, ImpersonationActive, ImpersonationEnded}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+}
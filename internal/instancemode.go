@@ -0,0 +1,554 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// p5Callbacks are the functions p5.js calls on a sketch. In global mode they are declared at the
+// top level; in instance mode they are assigned to the sketch instance.
+var p5Callbacks = strings.Fields(`
+	preload setup draw windowResized
+	mousePressed mouseReleased mouseClicked doubleClicked mouseMoved mouseDragged mouseWheel
+	keyPressed keyReleased keyTyped touchStarted touchMoved touchEnded
+	deviceMoved deviceTurned deviceShaken`)
+
+// p5Globals are the functions, variables and constants p5.js defines on window in global mode and
+// on the sketch instance in instance mode
+var p5Globals = newStringSet(strings.Fields(`
+	noLoop loop isLooping push pop redraw frameRate getTargetFrameRate deltaTime focused cursor
+	noCursor displayWidth displayHeight windowWidth windowHeight width height fullscreen pixelDensity
+	displayDensity getURL getURLPath getURLParams frameCount describe describeElement textOutput
+	gridOutput print remove
+
+	arc ellipse circle line point quad rect square triangle ellipseMode noSmooth rectMode smooth
+	strokeCap strokeJoin strokeWeight bezier bezierDetail bezierPoint bezierTangent curve
+	curveDetail curveTightness curvePoint curveTangent beginContour beginShape bezierVertex
+	curveVertex endContour endShape quadraticVertex vertex normal plane box sphere cylinder cone
+	ellipsoid torus loadModel model buildGeometry freeGeometry beginGeometry endGeometry
+
+	alpha blue brightness color green hue lerpColor lightness red saturation background clear
+	colorMode fill noFill noStroke stroke erase noErase blendMode paletteLerp
+
+	applyMatrix resetMatrix rotate rotateX rotateY rotateZ scale shearX shearY translate
+
+	storeItem getItem clearStorage removeItem createStringDict createNumberDict append arrayCopy
+	concat reverse shorten shuffle sort splice subset float int str boolean byte char unchar hex
+	unhex join match matchAll nf nfc nfp nfs split splitTokens trim
+
+	deviceOrientation accelerationX accelerationY accelerationZ pAccelerationX pAccelerationY
+	pAccelerationZ rotationX rotationY rotationZ pRotationX pRotationY pRotationZ turnAxis
+	setMoveThreshold setShakeThreshold keyIsPressed key keyCode keyIsDown movedX movedY mouseX
+	mouseY pmouseX pmouseY winMouseX winMouseY pwinMouseX pwinMouseY mouseButton mouseIsPressed
+	requestPointerLock exitPointerLock touches
+
+	createImage saveCanvas saveFrames loadImage saveGif image tint noTint imageMode pixels blend
+	copy filter get loadPixels set updatePixels createGraphics createFramebuffer
+
+	loadJSON loadStrings loadTable loadXML loadBytes httpGet httpPost httpDo createWriter save
+	saveJSON saveStrings saveTable day hour minute millis month second year
+
+	abs ceil constrain dist exp floor lerp log mag map max min norm pow round sq sqrt fract
+	createVector noise noiseDetail noiseSeed randomSeed random randomGaussian acos asin atan atan2
+	cos sin tan degrees radians angleMode
+
+	textAlign textLeading textSize textStyle textWidth textAscent textDescent textWrap loadFont
+	text textFont
+
+	orbitControl debugMode noDebugMode ambientLight specularColor directionalLight pointLight
+	imageLight panorama lights lightFalloff spotLight noLights loadShader createShader
+	createFilterShader shader resetShader texture textureMode textureWrap normalMaterial
+	ambientMaterial emissiveMaterial specularMaterial shininess metalness camera perspective
+	linePerspective ortho frustum createCamera setCamera
+
+	select selectAll removeElements changed input createDiv createP createSpan createImg createA
+	createSlider createButton createCheckbox createSelect createRadio createColorPicker createInput
+	createFileInput createVideo createAudio createCapture createElement
+
+	createCanvas resizeCanvas noCanvas setAttributes drawingContext
+
+	loadSound soundFormats userStartAudio getAudioContext outputVolume freqToMidi midiToFreq
+
+	P2D WEBGL WEBGL2 ARROW CROSS HAND MOVE TEXT WAIT HALF_PI PI QUARTER_PI TAU TWO_PI DEG_TO_RAD
+	RAD_TO_DEG DEGREES RADIANS CORNER CORNERS RADIUS RIGHT LEFT CENTER TOP BOTTOM BASELINE POINTS
+	LINES LINE_STRIP LINE_LOOP TRIANGLES TRIANGLE_FAN TRIANGLE_STRIP QUADS QUAD_STRIP TESS CLOSE
+	OPEN CHORD PIE PROJECT SQUARE ROUND BEVEL MITER RGB HSB HSL AUTO ALT BACKSPACE CONTROL DELETE
+	DOWN_ARROW ENTER ESCAPE LEFT_ARROW OPTION RETURN RIGHT_ARROW SHIFT TAB UP_ARROW BLEND REMOVE ADD
+	DARKEST LIGHTEST DIFFERENCE SUBTRACT EXCLUSION MULTIPLY SCREEN REPLACE OVERLAY HARD_LIGHT
+	SOFT_LIGHT DODGE BURN THRESHOLD GRAY OPAQUE INVERT POSTERIZE DILATE ERODE BLUR NORMAL ITALIC
+	BOLD BOLDITALIC CHAR WORD LINEAR QUADRATIC BEZIER CURVE STROKE FILL TEXTURE IMMEDIATE IMAGE
+	NEAREST REPEAT CLAMP MIRROR FLAT SMOOTH LANDSCAPE PORTRAIT GRID AXES LABEL FALLBACK CONTAIN
+	COVER VIDEO AUDIO`))
+
+// errNotGlobalMode is returned for code that declares neither setup nor draw at its top level, such
+// as a sketch already in instance mode
+var errNotGlobalMode = errors.New("sketch declares neither setup nor draw at its top level")
+
+// newStringSet returns a set holding values
+func newStringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// ToInstanceMode converts a global-mode p5.js sketch to instance mode. It returns a function
+// expression to pass to new p5(): the sketch's code runs inside it, references to p5.js that the
+// sketch does not shadow are read from the instance it is given, and the callbacks the sketch
+// declares at its top level are assigned to that instance. Member expressions, property names,
+// strings and comments are left as they are, since the code is parsed rather than matched.
+func ToInstanceMode(code string) (string, error) {
+	program, err := parser.ParseFile(nil, "", code, 0, parser.WithDisableSourceMaps)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse sketch: %w", err)
+	}
+
+	c := &instanceModeConverter{instance: "p"}
+	names := make(map[string]bool)
+	collectIdentifierNames(code, names)
+	for i := 2; names[c.instance]; i++ {
+		c.instance = fmt.Sprintf("p%d", i)
+	}
+
+	// The sketch's top level becomes the body of the sketch function
+	top := c.enterScope()
+	c.declareVars(program.DeclarationList)
+	c.declareStatements(program.Body)
+	if !top["setup"] && !top["draw"] {
+		return "", errNotGlobalMode
+	}
+	c.walkStatements(program.Body)
+	c.leaveScope()
+
+	var converted strings.Builder
+	converted.WriteString("function (" + c.instance + ") {\n")
+	sort.SliceStable(c.edits, func(i, j int) bool { return c.edits[i].start < c.edits[j].start })
+	last := 0
+	for _, edit := range c.edits {
+		converted.WriteString(code[last:edit.start])
+		converted.WriteString(edit.text)
+		last = edit.end
+	}
+	converted.WriteString(code[last:])
+	converted.WriteString("\n")
+	for _, callback := range p5Callbacks {
+		if top[callback] {
+			converted.WriteString(c.instance + "." + callback + " = " + callback + ";\n")
+		}
+	}
+	converted.WriteString("}")
+	return converted.String(), nil
+}
+
+// collectIdentifierNames adds every identifier-like word in code to names, so the instance can be
+// given a name nothing in the sketch uses
+func collectIdentifierNames(code string, names map[string]bool) {
+	for _, word := range strings.FieldsFunc(code, func(r rune) bool {
+		return !(r == '_' || r == '$' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) {
+		names[word] = true
+	}
+}
+
+// instanceModeEdit replaces code[start:end] with text
+type instanceModeEdit struct {
+	start, end int
+	text       string
+}
+
+// instanceModeConverter walks a sketch's syntax tree, tracking the names each scope declares, and
+// records the edits that read p5.js from the instance
+type instanceModeConverter struct {
+	instance string
+	scopes   []map[string]bool
+	edits    []instanceModeEdit
+}
+
+func (c *instanceModeConverter) enterScope() map[string]bool {
+	scope := make(map[string]bool)
+	c.scopes = append(c.scopes, scope)
+	return scope
+}
+
+func (c *instanceModeConverter) leaveScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *instanceModeConverter) declare(name string) {
+	c.scopes[len(c.scopes)-1][name] = true
+}
+
+// instanceMember reports whether name, referenced in the current scope, is p5.js's
+func (c *instanceModeConverter) instanceMember(name string) bool {
+	for _, scope := range c.scopes {
+		if scope[name] {
+			return false
+		}
+	}
+	return p5Globals[name]
+}
+
+// reference rewrites a reference to p5.js to read it from the instance
+func (c *instanceModeConverter) reference(id *ast.Identifier) {
+	if c.instanceMember(id.Name.String()) {
+		start := int(id.Idx) - 1
+		c.edits = append(c.edits, instanceModeEdit{start: start, end: start, text: c.instance + "."})
+	}
+}
+
+// declareVars declares the var bindings of a function or the top level
+func (c *instanceModeConverter) declareVars(declarations []*ast.VariableDeclaration) {
+	for _, declaration := range declarations {
+		for _, binding := range declaration.List {
+			c.declareBinding(binding.Target)
+		}
+	}
+}
+
+// declareStatements declares the functions, classes and lexical bindings a block's statements
+// declare, before any of them runs
+func (c *instanceModeConverter) declareStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.FunctionDeclaration:
+			if s.Function.Name != nil {
+				c.declare(s.Function.Name.Name.String())
+			}
+		case *ast.ClassDeclaration:
+			if s.Class.Name != nil {
+				c.declare(s.Class.Name.Name.String())
+			}
+		case *ast.LexicalDeclaration:
+			for _, binding := range s.List {
+				c.declareBinding(binding.Target)
+			}
+		case *ast.VariableStatement:
+			for _, binding := range s.List {
+				c.declareBinding(binding.Target)
+			}
+		}
+	}
+}
+
+// declareBinding declares the names a binding target introduces
+func (c *instanceModeConverter) declareBinding(target ast.Expression) {
+	switch t := target.(type) {
+	case *ast.Identifier:
+		c.declare(t.Name.String())
+	case *ast.ObjectPattern:
+		for _, property := range t.Properties {
+			switch p := property.(type) {
+			case *ast.PropertyShort:
+				c.declare(p.Name.Name.String())
+			case *ast.PropertyKeyed:
+				c.declareBinding(p.Value)
+			}
+		}
+		c.declareBinding(t.Rest)
+	case *ast.ArrayPattern:
+		for _, element := range t.Elements {
+			c.declareBinding(element)
+		}
+		c.declareBinding(t.Rest)
+	case *ast.AssignExpression:
+		c.declareBinding(t.Left)
+	}
+}
+
+// walkBinding walks the default values and computed keys of a declared binding target
+func (c *instanceModeConverter) walkBinding(target ast.Expression) {
+	switch t := target.(type) {
+	case nil, *ast.Identifier:
+	case *ast.ObjectPattern:
+		for _, property := range t.Properties {
+			switch p := property.(type) {
+			case *ast.PropertyShort:
+				c.walkExpression(p.Initializer)
+			case *ast.PropertyKeyed:
+				c.walkExpression(p.Key)
+				c.walkBinding(p.Value)
+			}
+		}
+		c.walkBinding(t.Rest)
+	case *ast.ArrayPattern:
+		for _, element := range t.Elements {
+			c.walkBinding(element)
+		}
+		c.walkBinding(t.Rest)
+	case *ast.AssignExpression:
+		c.walkBinding(t.Left)
+		c.walkExpression(t.Right)
+	default:
+		c.walkExpression(t)
+	}
+}
+
+func (c *instanceModeConverter) walkBindings(bindings []*ast.Binding) {
+	for _, binding := range bindings {
+		c.walkBinding(binding.Target)
+		c.walkExpression(binding.Initializer)
+	}
+}
+
+// walkFunction walks a function's parameters and body in a scope of their own
+func (c *instanceModeConverter) walkFunction(name *ast.Identifier, params *ast.ParameterList, declarations []*ast.VariableDeclaration, body ast.Node) {
+	c.enterScope()
+	defer c.leaveScope()
+	if name != nil {
+		c.declare(name.Name.String())
+	}
+	c.declare("arguments")
+	for _, param := range params.List {
+		c.declareBinding(param.Target)
+	}
+	c.declareBinding(params.Rest)
+	c.declareVars(declarations)
+	for _, param := range params.List {
+		c.walkBinding(param.Target)
+		c.walkExpression(param.Initializer)
+	}
+	c.walkBinding(params.Rest)
+
+	switch b := body.(type) {
+	case *ast.BlockStatement:
+		c.declareStatements(b.List)
+		c.walkStatements(b.List)
+	case *ast.ExpressionBody:
+		c.walkExpression(b.Expression)
+	}
+}
+
+func (c *instanceModeConverter) walkClass(class *ast.ClassLiteral) {
+	c.walkExpression(class.SuperClass)
+	c.enterScope()
+	defer c.leaveScope()
+	if class.Name != nil {
+		c.declare(class.Name.Name.String())
+	}
+	for _, element := range class.Body {
+		switch e := element.(type) {
+		case *ast.FieldDefinition:
+			c.walkExpression(e.Key)
+			c.walkExpression(e.Initializer)
+		case *ast.MethodDefinition:
+			c.walkExpression(e.Key)
+			c.walkExpression(e.Body)
+		case *ast.ClassStaticBlock:
+			c.enterScope()
+			c.declareVars(e.DeclarationList)
+			c.declareStatements(e.Block.List)
+			c.walkStatements(e.Block.List)
+			c.leaveScope()
+		}
+	}
+}
+
+func (c *instanceModeConverter) walkStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		c.walkStatement(statement)
+	}
+}
+
+// walkBlock walks statements in a block scope of their own
+func (c *instanceModeConverter) walkBlock(statements []ast.Statement) {
+	c.enterScope()
+	defer c.leaveScope()
+	c.declareStatements(statements)
+	c.walkStatements(statements)
+}
+
+func (c *instanceModeConverter) walkStatement(statement ast.Statement) {
+	switch s := statement.(type) {
+	case nil:
+	case *ast.BlockStatement:
+		c.walkBlock(s.List)
+	case *ast.ExpressionStatement:
+		c.walkExpression(s.Expression)
+	case *ast.VariableStatement:
+		c.walkBindings(s.List)
+	case *ast.LexicalDeclaration:
+		c.walkBindings(s.List)
+	case *ast.FunctionDeclaration:
+		c.walkExpression(s.Function)
+	case *ast.ClassDeclaration:
+		c.walkClass(s.Class)
+	case *ast.IfStatement:
+		c.walkExpression(s.Test)
+		c.walkStatement(s.Consequent)
+		c.walkStatement(s.Alternate)
+	case *ast.ForStatement:
+		c.enterScope()
+		switch initializer := s.Initializer.(type) {
+		case *ast.ForLoopInitializerExpression:
+			c.walkExpression(initializer.Expression)
+		case *ast.ForLoopInitializerVarDeclList:
+			for _, binding := range initializer.List {
+				c.declareBinding(binding.Target)
+			}
+			c.walkBindings(initializer.List)
+		case *ast.ForLoopInitializerLexicalDecl:
+			for _, binding := range initializer.LexicalDeclaration.List {
+				c.declareBinding(binding.Target)
+			}
+			c.walkBindings(initializer.LexicalDeclaration.List)
+		}
+		c.walkExpression(s.Test)
+		c.walkExpression(s.Update)
+		c.walkStatement(s.Body)
+		c.leaveScope()
+	case *ast.ForInStatement:
+		c.walkForInto(s.Into, s.Source, s.Body)
+	case *ast.ForOfStatement:
+		c.walkForInto(s.Into, s.Source, s.Body)
+	case *ast.WhileStatement:
+		c.walkExpression(s.Test)
+		c.walkStatement(s.Body)
+	case *ast.DoWhileStatement:
+		c.walkStatement(s.Body)
+		c.walkExpression(s.Test)
+	case *ast.ReturnStatement:
+		c.walkExpression(s.Argument)
+	case *ast.ThrowStatement:
+		c.walkExpression(s.Argument)
+	case *ast.LabelledStatement:
+		c.walkStatement(s.Statement)
+	case *ast.SwitchStatement:
+		c.walkExpression(s.Discriminant)
+		c.enterScope()
+		for _, clause := range s.Body {
+			c.declareStatements(clause.Consequent)
+		}
+		for _, clause := range s.Body {
+			c.walkExpression(clause.Test)
+			c.walkStatements(clause.Consequent)
+		}
+		c.leaveScope()
+	case *ast.TryStatement:
+		c.walkBlock(s.Body.List)
+		if s.Catch != nil {
+			c.enterScope()
+			c.declareBinding(s.Catch.Parameter)
+			c.walkBinding(s.Catch.Parameter)
+			c.walkBlock(s.Catch.Body.List)
+			c.leaveScope()
+		}
+		if s.Finally != nil {
+			c.walkBlock(s.Finally.List)
+		}
+	case *ast.WithStatement:
+		c.walkExpression(s.Object)
+		c.walkStatement(s.Body)
+	}
+}
+
+// walkForInto walks a for-in or for-of loop, whose declared bindings are scoped to the loop
+func (c *instanceModeConverter) walkForInto(into ast.ForInto, source ast.Expression, body ast.Statement) {
+	c.walkExpression(source)
+	c.enterScope()
+	defer c.leaveScope()
+	switch i := into.(type) {
+	case *ast.ForIntoVar:
+		c.declareBinding(i.Binding.Target)
+		c.walkBinding(i.Binding.Target)
+	case *ast.ForDeclaration:
+		c.declareBinding(i.Target)
+		c.walkBinding(i.Target)
+	case *ast.ForIntoExpression:
+		c.walkExpression(i.Expression)
+	}
+	c.walkStatement(body)
+}
+
+func (c *instanceModeConverter) walkExpressions(expressions []ast.Expression) {
+	for _, expression := range expressions {
+		c.walkExpression(expression)
+	}
+}
+
+func (c *instanceModeConverter) walkExpression(expression ast.Expression) {
+	switch e := expression.(type) {
+	case nil:
+	case *ast.Identifier:
+		c.reference(e)
+	case *ast.FunctionLiteral:
+		c.walkFunction(e.Name, e.ParameterList, e.DeclarationList, e.Body)
+	case *ast.ArrowFunctionLiteral:
+		c.walkFunction(nil, e.ParameterList, e.DeclarationList, e.Body)
+	case *ast.ClassLiteral:
+		c.walkClass(e)
+	case *ast.DotExpression:
+		// Only the object is a reference; the property name after the dot is not
+		c.walkExpression(e.Left)
+	case *ast.PrivateDotExpression:
+		c.walkExpression(e.Left)
+	case *ast.BracketExpression:
+		c.walkExpression(e.Left)
+		c.walkExpression(e.Member)
+	case *ast.CallExpression:
+		c.walkExpression(e.Callee)
+		c.walkExpressions(e.ArgumentList)
+	case *ast.NewExpression:
+		c.walkExpression(e.Callee)
+		c.walkExpressions(e.ArgumentList)
+	case *ast.AssignExpression:
+		c.walkExpression(e.Left)
+		c.walkExpression(e.Right)
+	case *ast.BinaryExpression:
+		c.walkExpression(e.Left)
+		c.walkExpression(e.Right)
+	case *ast.UnaryExpression:
+		c.walkExpression(e.Operand)
+	case *ast.ConditionalExpression:
+		c.walkExpression(e.Test)
+		c.walkExpression(e.Consequent)
+		c.walkExpression(e.Alternate)
+	case *ast.SequenceExpression:
+		c.walkExpressions(e.Sequence)
+	case *ast.ArrayLiteral:
+		c.walkExpressions(e.Value)
+	case *ast.ArrayPattern:
+		// Destructuring assignment: the targets are references
+		c.walkExpressions(e.Elements)
+		c.walkExpression(e.Rest)
+	case *ast.ObjectLiteral:
+		for _, property := range e.Value {
+			c.walkExpression(property)
+		}
+	case *ast.ObjectPattern:
+		for _, property := range e.Properties {
+			c.walkExpression(property)
+		}
+		c.walkExpression(e.Rest)
+	case *ast.PropertyShort:
+		// {width} is shorthand for {width: width}, so it is spelled out to read from the instance
+		if name := e.Name.Name.String(); c.instanceMember(name) {
+			start := int(e.Name.Idx) - 1
+			c.edits = append(c.edits, instanceModeEdit{start: start, end: start + len(name), text: name + ": " + c.instance + "." + name})
+		}
+		c.walkExpression(e.Initializer)
+	case *ast.PropertyKeyed:
+		if e.Computed {
+			c.walkExpression(e.Key)
+		}
+		c.walkExpression(e.Value)
+	case *ast.SpreadElement:
+		c.walkExpression(e.Expression)
+	case *ast.TemplateLiteral:
+		c.walkExpression(e.Tag)
+		c.walkExpressions(e.Expressions)
+	case *ast.YieldExpression:
+		c.walkExpression(e.Argument)
+	case *ast.AwaitExpression:
+		c.walkExpression(e.Argument)
+	case *ast.OptionalChain:
+		c.walkExpression(e.Expression)
+	case *ast.Optional:
+		c.walkExpression(e.Expression)
+	}
+}
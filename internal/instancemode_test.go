@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestToInstanceMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Callbacks and p5.js calls",
+			input: "let x = 0;\nfunction setup() {\n  createCanvas(400, 400);\n}\nfunction draw() {\n  x = Math.floor(random(width));\n  circle(x, height / 2, 20);\n}",
+			want:  "function (p) {\nlet x = 0;\nfunction setup() {\n  p.createCanvas(400, 400);\n}\nfunction draw() {\n  x = Math.floor(p.random(p.width));\n  p.circle(x, p.height / 2, 20);\n}\np.setup = setup;\np.draw = draw;\n}",
+		},
+		{
+			name:  "Members, properties, strings and comments",
+			input: "function draw() {\n  // fill(255)\n  const o = {fill: 'fill', [key]: Math.PI};\n  o.fill = dots[0].size;\n  text(`at ${mouseX}`, 10, 10);\n}",
+			want:  "function (p) {\nfunction draw() {\n  // fill(255)\n  const o = {fill: 'fill', [p.key]: Math.PI};\n  o.fill = dots[0].size;\n  p.text(`at ${p.mouseX}`, 10, 10);\n}\np.draw = draw;\n}",
+		},
+		{
+			name:  "Shadowed names",
+			input: "function draw() {\n  let width = 3;\n  line(0, 0, width, height);\n  for (const key in keys) print(key);\n  [1].map((random) => random + 1);\n  try {} catch (noise) { noise.x; }\n}",
+			want:  "function (p) {\nfunction draw() {\n  let width = 3;\n  p.line(0, 0, width, p.height);\n  for (const key in keys) p.print(key);\n  [1].map((random) => random + 1);\n  try {} catch (noise) { noise.x; }\n}\np.draw = draw;\n}",
+		},
+		{
+			name:  "Shorthand properties",
+			input: "function draw() {\n  const at = {mouseX, mouseY};\n}",
+			want:  "function (p) {\nfunction draw() {\n  const at = {mouseX: p.mouseX, mouseY: p.mouseY};\n}\np.draw = draw;\n}",
+		},
+		{
+			name:  "Classes",
+			input: "class Ball {\n  constructor() { this.pos = createVector(random(width), 0); }\n  show() { ellipse(this.pos.x, this.pos.y, 10); }\n}\nfunction draw() { new Ball().show(); }",
+			want:  "function (p) {\nclass Ball {\n  constructor() { this.pos = p.createVector(p.random(p.width), 0); }\n  show() { p.ellipse(this.pos.x, this.pos.y, 10); }\n}\nfunction draw() { new Ball().show(); }\np.draw = draw;\n}",
+		},
+		{
+			name:  "Sketch using p",
+			input: "let p = 1;\nfunction draw() { point(p, p); }",
+			want:  "function (p2) {\nlet p = 1;\nfunction draw() { p2.point(p, p); }\np2.draw = draw;\n}",
+		},
+		{
+			name:  "Other characters before a reference",
+			input: "const s = 'café';\nfunction draw() { background(s.length); }",
+			want:  "function (p) {\nconst s = 'café';\nfunction draw() { p.background(s.length); }\np.draw = draw;\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToInstanceMode(tt.input)
+			if err != nil {
+				t.Fatalf("ToInstanceMode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ToInstanceMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for input, want := range map[string]string{
+		"function draw() {":                             "failed to parse sketch",
+		"new p5((p) => { p.draw = () => p.fill(0); });": errNotGlobalMode.Error(),
+	} {
+		if _, err := ToInstanceMode(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ToInstanceMode(%q) error = %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestGetAnimationInInstanceMode(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	token := registerUser(t, router, "artist")
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() { background(frameCount % 255); }", Description: "pulse"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", token, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	var animation GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"?mode=instance", "", nil, &animation); code != http.StatusOK {
+		t.Fatalf("get animation in instance mode status = %d", code)
+	}
+	want := "function (p) {\nfunction setup() {}\nfunction draw() { p.background(p.frameCount % 255); }\np.setup = setup;\np.draw = draw;\n}"
+	if animation.Code != want {
+		t.Errorf("code = %q, want %q", animation.Code, want)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"?mode=global", "", nil, &animation); code != http.StatusOK || animation.Code != sketch.Code {
+		t.Errorf("get animation in global mode = %d %q, want the code as saved", code, animation.Code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"?mode=module", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown mode status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// Code saved before validation, already in instance mode, cannot be converted again
+	id, err := store.SaveAnimation(context.Background(), "new p5((p) => { p.draw = () => p.background(0); });", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+id+"?mode=instance", "", nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("instance mode code status = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+}
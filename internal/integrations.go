@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Platforms team integrations post to
+const (
+	PlatformSlack   = "slack"
+	PlatformDiscord = "discord"
+)
+
+const (
+	defaultTeamPostTime   = "09:00"
+	teamPostBatchSize     = 20
+	teamPostCheckInterval = time.Minute
+	teamWebhookTimeout    = 10 * time.Second
+	// slackPostMatchWindow is how far a reaction's message may be from a post to count towards it.
+	// Slack's incoming webhooks do not say which message they posted, so reactions are matched to
+	// the post made closest to their message's timestamp.
+	slackPostMatchWindow = 2 * time.Minute
+	// slackSignatureMaxAge is how old a signed Slack request may be, so captured ones cannot be replayed
+	slackSignatureMaxAge = 5 * time.Minute
+	// minTeamMoodReactions is how many teammates must react to a post before its moods are shown,
+	// so no one's reaction can be picked out
+	minTeamMoodReactions = 3
+	// teamReportPosts is how many of the latest posts an integration's report shows
+	teamReportPosts = 14
+	// maxTeamEventBytes bounds the body of a reaction event
+	maxTeamEventBytes = 64 << 10
+)
+
+// teamWebhookPrefixes are the addresses each platform's webhooks start with; others are refused
+// so an integration cannot be pointed at internal services
+var teamWebhookPrefixes = map[string][]string{
+	PlatformSlack:   {"https://hooks.slack.com/services/"},
+	PlatformDiscord: {"https://discord.com/api/webhooks/", "https://discordapp.com/api/webhooks/"},
+}
+
+// teamMoodEmoji maps Slack's emoji names and the Unicode emoji Discord reports to the moods they
+// stand for. The daily post asks for the first of each.
+var teamMoodEmoji = map[string]Mood{
+	"heart_eyes": MoodMuchBetter, "star-struck": MoodMuchBetter, "😍": MoodMuchBetter, "🤩": MoodMuchBetter,
+	"slightly_smiling_face": MoodBetter, "smile": MoodBetter, "+1": MoodBetter, "thumbsup": MoodBetter, "🙂": MoodBetter, "😄": MoodBetter, "👍": MoodBetter,
+	"neutral_face": MoodSame, "😐": MoodSame,
+	"slightly_frowning_face": MoodWorse, "-1": MoodWorse, "thumbsdown": MoodWorse, "🙁": MoodWorse, "👎": MoodWorse,
+	"cry": MoodMuchWorse, "sob": MoodMuchWorse, "😢": MoodMuchWorse, "😭": MoodMuchWorse,
+}
+
+// teamMoodPrompt asks teammates to react, in each platform's emoji syntax
+var teamMoodPrompt = map[string]string{
+	PlatformSlack:   "How do you feel after watching? React with :heart_eyes: much better, :slightly_smiling_face: better, :neutral_face: the same, :slightly_frowning_face: worse or :cry: much worse. Reactions are counted anonymously.",
+	PlatformDiscord: "How do you feel after watching? React with 😍 much better, 🙂 better, 😐 the same, 🙁 worse or 😢 much worse. Reactions are counted anonymously.",
+}
+
+// teamReactionMood returns the mood an emoji stands for, ignoring Slack's skin tone modifiers
+func teamReactionMood(emoji string) (Mood, bool) {
+	name, _, _ := strings.Cut(emoji, "::")
+	mood, ok := teamMoodEmoji[name]
+	return mood, ok
+}
+
+// ValidateTeamIntegration checks a request to configure an integration with platform and returns
+// the integration it describes, posting at 09:00 UTC unless it says otherwise
+func ValidateTeamIntegration(platform string, req TeamIntegrationRequest) (TeamIntegration, error) {
+	integration := TeamIntegration{
+		Platform:   platform,
+		WebhookURL: strings.TrimSpace(req.WebhookURL),
+		Secret:     strings.TrimSpace(req.SigningSecret),
+		PostTime:   strings.TrimSpace(req.PostTime),
+		Timezone:   strings.TrimSpace(req.Timezone),
+	}
+	known := false
+	for _, prefix := range teamWebhookPrefixes[platform] {
+		if strings.HasPrefix(integration.WebhookURL, prefix) && len(integration.WebhookURL) > len(prefix) {
+			known = true
+		}
+	}
+	if !known {
+		return TeamIntegration{}, fmt.Errorf("webhookUrl must be a %s webhook starting with %s", platform, teamWebhookPrefixes[platform][0])
+	}
+	if platform == PlatformSlack && integration.Secret == "" {
+		return TeamIntegration{}, errors.New("signingSecret is required to receive Slack reactions")
+	}
+	if integration.PostTime == "" {
+		integration.PostTime = defaultTeamPostTime
+	}
+	if integration.Timezone == "" {
+		integration.Timezone = "UTC"
+	}
+	if err := ValidateReminderSchedule(&ReminderSchedule{Times: []string{integration.PostTime}, Timezone: integration.Timezone}); err != nil {
+		return TeamIntegration{}, err
+	}
+	return integration, nil
+}
+
+// nextPost returns when the integration next posts after after
+func (t TeamIntegration) nextPost(after time.Time) time.Time {
+	next, _ := ReminderSchedule{Times: []string{t.PostTime}, Timezone: t.Timezone}.nextReminder(after)
+	return next
+}
+
+// teamReactorHash identifies a teammate within one integration without storing who they are
+func teamReactorHash(integrationId, platformUserId string) string {
+	return HashToken(integrationId + ":" + platformUserId)
+}
+
+// postTeamAnimation posts an animation to the integration's channel and returns the ID of the
+// message when the platform says it. Discord is asked to wait for the message so it does.
+func postTeamAnimation(ctx context.Context, integration TeamIntegration, animationId, description string) (string, error) {
+	text := "Today's animation"
+	if description != "" {
+		text += ", " + description
+	}
+	text += ": " + PublicURL("/animation/"+animationId) + "\n" + teamMoodPrompt[integration.Platform]
+
+	url := integration.WebhookURL
+	payload := map[string]string{"text": text}
+	if integration.Platform == PlatformDiscord {
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url += separator + "wait=true"
+		payload = map[string]string{"content": text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, teamWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	if integration.Platform != PlatformDiscord {
+		return "", nil
+	}
+	var message struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTeamEventBytes)).Decode(&message); err != nil {
+		return "", fmt.Errorf("failed to read the posted message: %w", err)
+	}
+	return message.ID, nil
+}
+
+// sendTeamPost posts a calm animation from the feed to an integration's channel and records it.
+// Nothing is posted when the feed has nothing suitable.
+func sendTeamPost(ctx context.Context, store Store, integration TeamIntegration) {
+	animation, err := store.GetRandomAnimation(ctx, widgetFilter())
+	if err != nil {
+		if err.Error() != "no animations found" {
+			log.Printf("[TEAM] Failed to pick an animation for integration %s: %v", integration.ID, err)
+		}
+		return
+	}
+	messageId, err := postTeamAnimation(ctx, integration, animation.ID, animation.Description)
+	if err != nil {
+		log.Printf("[TEAM] Failed to post to the %s integration %s: %v", integration.Platform, integration.ID, err)
+		return
+	}
+	if _, err := store.RecordTeamPost(ctx, TeamPost{IntegrationID: integration.ID, AnimationID: animation.ID, MessageID: messageId}); err != nil {
+		log.Printf("[TEAM] Failed to record the post of integration %s: %v", integration.ID, err)
+	}
+}
+
+// sendDueTeamPosts posts to a batch of integrations whose daily post is due, schedules their next
+// one and returns how many it claimed
+func sendDueTeamPosts(ctx context.Context, store Store) (int, error) {
+	due, err := store.ClaimDueTeamIntegrations(ctx, teamPostBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, integration := range due {
+		sendTeamPost(ctx, store, integration)
+		if err := store.SetNextTeamPost(ctx, integration.ID, integration.nextPost(time.Now())); err != nil {
+			log.Printf("[TEAM] Failed to schedule the next post of integration %s: %v", integration.ID, err)
+		}
+	}
+	return len(due), nil
+}
+
+// RunTeamPoster posts the daily animation of each team integration as it comes due, until ctx is done
+func RunTeamPoster(ctx context.Context, store Store) {
+	ticker := time.NewTicker(teamPostCheckInterval)
+	defer ticker.Stop()
+	for {
+		err := drainEveryDataRegion(ctx, teamPostBatchSize, func(ctx context.Context) (int, error) {
+			return sendDueTeamPosts(ctx, store)
+		})
+		if err != nil {
+			log.Printf("[TEAM] Failed to claim due team posts: %v", err)
+		}
+		recordWorkerPass("team posts", teamPostCheckInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// hmacSHA256 returns the hex HMAC-SHA256 of message under secret
+func hmacSHA256(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySlackSignature checks the X-Slack-Signature of a request Slack sent at timestamp
+func verifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid request timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return errors.New("request timestamp is too far from now")
+	}
+	want := "v0=" + hmacSHA256(secret, "v0:"+timestamp+":"+string(body))
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// verifyRelaySignature checks the X-Signature-256 a relay signs forwarded reactions with
+func verifyRelaySignature(secret, signature string, body []byte) error {
+	if !hmac.Equal([]byte(signature), []byte("sha256="+hmacSHA256(secret, string(body)))) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// slackEvent is the part of a Slack Events API request reactions are read from
+type slackEvent struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type     string `json:"type"`
+		User     string `json:"user"`
+		Reaction string `json:"reaction"`
+		Item     struct {
+			Type string `json:"type"`
+			TS   string `json:"ts"`
+		} `json:"item"`
+	} `json:"event"`
+}
+
+// slackTimestamp parses a Slack message timestamp, seconds with a fraction
+func slackTimestamp(ts string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid message timestamp %q", ts)
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)), nil
+}
+
+// applyTeamReaction records, or takes back, a teammate's reaction to a post as a mood signal.
+// Reactions that stand for no mood, or to messages that are not daily posts, are ignored.
+func applyTeamReaction(ctx context.Context, store Store, integration TeamIntegration, messageId string, at time.Time, userId, emoji string, removed bool) error {
+	mood, ok := teamReactionMood(emoji)
+	if !ok || userId == "" {
+		return nil
+	}
+	post, err := store.FindTeamPost(ctx, integration.ID, messageId, at, slackPostMatchWindow)
+	if err != nil {
+		if err.Error() == "team post not found" {
+			return nil
+		}
+		return err
+	}
+	reactor := teamReactorHash(integration.ID, userId)
+	if removed {
+		return store.RemoveTeamMoodSignal(ctx, post.ID, reactor, mood)
+	}
+	return store.SetTeamMoodSignal(ctx, post.ID, reactor, mood)
+}
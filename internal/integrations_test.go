@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateTeamIntegration(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		req      TeamIntegrationRequest
+		want     TeamIntegration
+		wantErr  bool
+	}{
+		{
+			name:     "Slack with defaults",
+			platform: PlatformSlack,
+			req:      TeamIntegrationRequest{WebhookURL: " https://hooks.slack.com/services/T1/B1/x ", SigningSecret: "shh"},
+			want:     TeamIntegration{Platform: PlatformSlack, WebhookURL: "https://hooks.slack.com/services/T1/B1/x", Secret: "shh", PostTime: "09:00", Timezone: "UTC"},
+		},
+		{
+			name:     "Discord with a schedule",
+			platform: PlatformDiscord,
+			req:      TeamIntegrationRequest{WebhookURL: "https://discord.com/api/webhooks/1/x", PostTime: "13:30", Timezone: "Europe/Berlin"},
+			want:     TeamIntegration{Platform: PlatformDiscord, WebhookURL: "https://discord.com/api/webhooks/1/x", PostTime: "13:30", Timezone: "Europe/Berlin"},
+		},
+		{name: "Slack without a signing secret", platform: PlatformSlack, req: TeamIntegrationRequest{WebhookURL: "https://hooks.slack.com/services/T1/B1/x"}, wantErr: true},
+		{name: "Another platform's webhook", platform: PlatformSlack, req: TeamIntegrationRequest{WebhookURL: "https://discord.com/api/webhooks/1/x", SigningSecret: "shh"}, wantErr: true},
+		{name: "Internal address", platform: PlatformDiscord, req: TeamIntegrationRequest{WebhookURL: "http://169.254.169.254/latest"}, wantErr: true},
+		{name: "Prefix only", platform: PlatformDiscord, req: TeamIntegrationRequest{WebhookURL: "https://discord.com/api/webhooks/"}, wantErr: true},
+		{name: "Invalid time", platform: PlatformDiscord, req: TeamIntegrationRequest{WebhookURL: "https://discord.com/api/webhooks/1/x", PostTime: "25:00"}, wantErr: true},
+		{name: "Invalid time zone", platform: PlatformDiscord, req: TeamIntegrationRequest{WebhookURL: "https://discord.com/api/webhooks/1/x", Timezone: "Mars/Olympus"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateTeamIntegration(tt.platform, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateTeamIntegration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ValidateTeamIntegration() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"type":"event_callback"}`)
+	sign := func(secret string, at time.Time) (string, string) {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		return timestamp, "v0=" + hmacSHA256(secret, "v0:"+timestamp+":"+string(body))
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		at      time.Time
+		body    []byte
+		wantErr bool
+	}{
+		{name: "Valid", secret: "shh", at: now, body: body},
+		{name: "Slightly old", secret: "shh", at: now.Add(-4 * time.Minute), body: body},
+		{name: "Other secret", secret: "other", at: now, body: body, wantErr: true},
+		{name: "Replayed", secret: "shh", at: now.Add(-10 * time.Minute), body: body, wantErr: true},
+		{name: "Tampered body", secret: "shh", at: now, body: []byte(`{"type":"url_verification"}`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamp, signature := sign(tt.secret, tt.at)
+			if err := verifySlackSignature("shh", timestamp, signature, tt.body, now); (err != nil) != tt.wantErr {
+				t.Errorf("verifySlackSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := verifySlackSignature("shh", "", "v0=", body, now); err == nil {
+		t.Error("verifySlackSignature() accepted a request without a timestamp")
+	}
+}
+
+func TestTeamReactionMood(t *testing.T) {
+	tests := []struct {
+		emoji  string
+		want   Mood
+		wantOk bool
+	}{
+		{emoji: "heart_eyes", want: MoodMuchBetter, wantOk: true},
+		{emoji: "+1::skin-tone-3", want: MoodBetter, wantOk: true},
+		{emoji: "😐", want: MoodSame, wantOk: true},
+		{emoji: "😭", want: MoodMuchWorse, wantOk: true},
+		{emoji: "tada"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.emoji, func(t *testing.T) {
+			got, ok := teamReactionMood(tt.emoji)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("teamReactionMood(%q) = %q, %v, want %q, %v", tt.emoji, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestTeamIntegrationHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	// Stand-ins for Slack's and Discord's webhooks, which record what was posted
+	var mu sync.Mutex
+	posted := map[string]string{}
+	webhook := func(platform string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			mu.Lock()
+			posted[platform] = payload["text"] + payload["content"]
+			mu.Unlock()
+			if r.URL.Query().Get("wait") == "true" {
+				w.Write([]byte(`{"id": "m1"}`))
+			}
+		}))
+	}
+	slack, discord := webhook(PlatformSlack), webhook(PlatformDiscord)
+	defer slack.Close()
+	defer discord.Close()
+	saved := teamWebhookPrefixes
+	teamWebhookPrefixes = map[string][]string{PlatformSlack: {slack.URL + "/"}, PlatformDiscord: {discord.URL + "/"}}
+	t.Cleanup(func() { teamWebhookPrefixes = saved })
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	owner := registerAccount(t, router, "owner")
+	member := registerAccount(t, router, "member")
+	outsider := registerAccount(t, router, "outsider")
+	var org Organization
+	doJSON(t, router, http.MethodPost, "/orgs", owner.Token, OrganizationRequest{Name: "Studio"}, &org)
+	doJSON(t, router, http.MethodPost, "/orgs/"+strconv.Itoa(org.ID)+"/members", owner.Token, OrganizationMemberRequest{Email: "member@example.com"}, nil)
+	animationId, _ := store.SaveAnimation(ctx, "function draw() {}", "slow tide", "", "")
+	store.SetAnimationPhotosensitivity(ctx, animationId, PhotosensitivityReport{Status: PhotosensitivitySafe, MotionScore: 0.01})
+
+	slackReq := TeamIntegrationRequest{WebhookURL: slack.URL + "/hook", SigningSecret: "shh"}
+	config := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     any
+		wantCode int
+	}{
+		{name: "Member configures", method: http.MethodPost, path: "/integrations/slack", token: member.Token, body: slackReq, wantCode: http.StatusForbidden},
+		{name: "Outsider configures", method: http.MethodPost, path: "/integrations/slack", token: outsider.Token, body: slackReq, wantCode: http.StatusNotFound},
+		{name: "Unknown platform", method: http.MethodPost, path: "/integrations/teams", token: owner.Token, body: slackReq, wantCode: http.StatusNotFound},
+		{name: "Invalid webhook", method: http.MethodPost, path: "/integrations/slack", token: owner.Token, body: TeamIntegrationRequest{WebhookURL: "http://localhost/hook", SigningSecret: "shh"}, wantCode: http.StatusBadRequest},
+		{name: "Report before configuring", method: http.MethodGet, path: "/integrations/slack", token: member.Token, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range config {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var slackIntegration, discordIntegration TeamIntegration
+	if code := doJSON(t, router, http.MethodPost, "/integrations/slack", owner.Token, slackReq, &slackIntegration); code != http.StatusOK {
+		t.Fatalf("configure slack status = %d", code)
+	}
+	doJSON(t, router, http.MethodPost, "/integrations/discord", owner.Token, TeamIntegrationRequest{WebhookURL: discord.URL + "/hook"}, &discordIntegration)
+	if !strings.HasSuffix(slackIntegration.EventsURL, "/integrations/slack/events/"+slackIntegration.ID) || slackIntegration.RelaySecret != "" {
+		t.Errorf("slack integration = %+v, want its events URL and no relay secret", slackIntegration)
+	}
+	if discordIntegration.RelaySecret == "" {
+		t.Fatal("discord integration has no relay secret")
+	}
+
+	// Make both posts due and let the poster send them
+	for _, integration := range []TeamIntegration{slackIntegration, discordIntegration} {
+		store.SetNextTeamPost(ctx, integration.ID, time.Now().Add(-time.Minute))
+	}
+	if count, err := sendDueTeamPosts(ctx, store); err != nil || count != 2 {
+		t.Fatalf("sendDueTeamPosts() = %d, %v, want 2 posts", count, err)
+	}
+	for platform, text := range posted {
+		if !strings.Contains(text, "/animation/"+animationId) || !strings.Contains(text, "slow tide") {
+			t.Errorf("%s post = %q, want a link to the animation", platform, text)
+		}
+	}
+	if count, _ := sendDueTeamPosts(ctx, store); count != 0 {
+		t.Errorf("second pass posted %d times, want the next post scheduled", count)
+	}
+
+	sendEvent := func(integration TeamIntegration, body any, sign func([]byte, *http.Request)) int {
+		t.Helper()
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/integrations/"+integration.Platform+"/events/"+integration.ID, bytes.NewReader(payload))
+		sign(payload, req)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	signSlack := func(payload []byte, req *http.Request) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", "v0="+hmacSHA256("shh", "v0:"+timestamp+":"+string(payload)))
+	}
+	signRelay := func(payload []byte, req *http.Request) {
+		req.Header.Set("X-Signature-256", "sha256="+hmacSHA256(discordIntegration.RelaySecret, string(payload)))
+	}
+	slackReaction := func(eventType, user, reaction string) map[string]any {
+		ts := strconv.FormatFloat(float64(time.Now().UnixMicro())/1e6, 'f', 6, 64)
+		return map[string]any{"type": "event_callback", "event": map[string]any{
+			"type": eventType, "user": user, "reaction": reaction, "item": map[string]string{"type": "message", "ts": ts},
+		}}
+	}
+
+	events := []struct {
+		name        string
+		integration TeamIntegration
+		body        any
+		sign        func([]byte, *http.Request)
+		wantCode    int
+	}{
+		{name: "URL verification", integration: slackIntegration, body: map[string]string{"type": "url_verification", "challenge": "c"}, sign: signSlack, wantCode: http.StatusOK},
+		{name: "Unsigned", integration: slackIntegration, body: slackReaction("reaction_added", "U1", "heart_eyes"), sign: func([]byte, *http.Request) {}, wantCode: http.StatusUnauthorized},
+		{name: "Signed for another platform", integration: discordIntegration, body: TeamReaction{MessageID: "m1", Emoji: "🙂", UserID: "D1"}, sign: signSlack, wantCode: http.StatusUnauthorized},
+		{name: "Slack U1", integration: slackIntegration, body: slackReaction("reaction_added", "U1", "heart_eyes"), sign: signSlack, wantCode: http.StatusOK},
+		{name: "Slack U2", integration: slackIntegration, body: slackReaction("reaction_added", "U2", "slightly_smiling_face"), sign: signSlack, wantCode: http.StatusOK},
+		{name: "Slack U2 changes their mind", integration: slackIntegration, body: slackReaction("reaction_added", "U2", "+1::skin-tone-2"), sign: signSlack, wantCode: http.StatusOK},
+		{name: "Slack U3", integration: slackIntegration, body: slackReaction("reaction_added", "U3", "cry"), sign: signSlack, wantCode: http.StatusOK},
+		{name: "Slack U4 is not a mood", integration: slackIntegration, body: slackReaction("reaction_added", "U4", "tada"), sign: signSlack, wantCode: http.StatusOK},
+		{name: "Discord D1", integration: discordIntegration, body: TeamReaction{MessageID: "m1", Emoji: "🙂", UserID: "D1"}, sign: signRelay, wantCode: http.StatusOK},
+		{name: "Discord D2", integration: discordIntegration, body: TeamReaction{MessageID: "m1", Emoji: "😢", UserID: "D2"}, sign: signRelay, wantCode: http.StatusOK},
+		{name: "Discord D3", integration: discordIntegration, body: TeamReaction{MessageID: "m1", Emoji: "😐", UserID: "D3"}, sign: signRelay, wantCode: http.StatusOK},
+		{name: "Discord D3 takes it back", integration: discordIntegration, body: TeamReaction{MessageID: "m1", Emoji: "😐", UserID: "D3", Removed: true}, sign: signRelay, wantCode: http.StatusOK},
+		{name: "Discord other message", integration: discordIntegration, body: TeamReaction{MessageID: "m2", Emoji: "😐", UserID: "D4"}, sign: signRelay, wantCode: http.StatusOK},
+	}
+	for _, tt := range events {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := sendEvent(tt.integration, tt.body, tt.sign); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	// Slack has three teammates' moods; Discord has two, too few to show
+	reports := []struct {
+		platform       string
+		wantCounts     map[Mood]int
+		wantSuppressed bool
+	}{
+		{platform: PlatformSlack, wantCounts: map[Mood]int{MoodMuchBetter: 1, MoodBetter: 1, MoodMuchWorse: 1}},
+		{platform: PlatformDiscord, wantSuppressed: true},
+	}
+	for _, tt := range reports {
+		t.Run("Report "+tt.platform, func(t *testing.T) {
+			var report TeamIntegrationReport
+			if code := doJSON(t, router, http.MethodGet, "/integrations/"+tt.platform, member.Token, nil, &report); code != http.StatusOK {
+				t.Fatalf("report status = %d", code)
+			}
+			if len(report.Posts) != 1 || report.Posts[0].AnimationID != animationId {
+				t.Fatalf("posts = %+v, want the one post", report.Posts)
+			}
+			moods := report.Posts[0].Moods
+			if moods.Suppressed != tt.wantSuppressed || len(moods.Counts) != len(tt.wantCounts) {
+				t.Errorf("moods = %+v, want counts %v, suppressed %v", moods, tt.wantCounts, tt.wantSuppressed)
+			}
+			for mood, count := range tt.wantCounts {
+				if moods.Counts[mood] != count {
+					t.Errorf("%s = %d, want %d", mood, moods.Counts[mood], count)
+				}
+			}
+		})
+	}
+
+	// Deleting an integration takes its events address with it
+	if code := doJSON(t, router, http.MethodDelete, "/integrations/slack", member.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("member delete status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodDelete, "/integrations/slack", owner.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := sendEvent(slackIntegration, slackReaction("reaction_added", "U5", "cry"), signSlack); code != http.StatusNotFound {
+		t.Errorf("event after delete status = %d, want %d", code, http.StatusNotFound)
+	}
+}
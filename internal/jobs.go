@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	defaultGenerationWorkers = 4
+	// generationJobPollInterval is how often an idle worker checks the queue for jobs queued on
+	// other instances; jobs queued on its own instance wake it straight away
+	generationJobPollInterval = 2 * time.Second
+	// generationJobClaimHold is how long a worker holds a job before another may take it to be
+	// abandoned, long enough for a generation with all its retries and smoke-test repairs
+	generationJobClaimHold = 10 * time.Minute
+	// maxGenerationJobAttempts is how many times a job is claimed before it is given up on, so a job
+	// that brings its worker down is not run forever
+	maxGenerationJobAttempts = 3
+	// generationJobRetention is how long finished jobs can still be read from GET /jobs/{id}
+	generationJobRetention  = 24 * time.Hour
+	generationJobPruneEvery = time.Hour
+	// generationJobRetryAfter is how long clients are told to wait before polling a job again
+	generationJobRetryAfter = 2 * time.Second
+)
+
+// GenerationWorkers returns how many generation jobs each instance runs at once, configured by
+// GENERATION_WORKERS. 0 leaves the instance running none, for instances that only serve requests.
+func GenerationWorkers() int {
+	return envLimit("GENERATION_WORKERS", defaultGenerationWorkers)
+}
+
+// queued returns the job as it waits in the queue, without its key
+func (j generationJob) queued() QueuedGeneration {
+	return QueuedGeneration{
+		ID:             j.id,
+		UserID:         j.userId,
+		Description:    j.description,
+		Style:          j.style,
+		Provider:       j.key.Provider,
+		OwnKey:         j.key.Own,
+		OrganizationID: j.organizationId,
+	}
+}
+
+// wakeGenerationWorker tells an idle worker on this instance that a job was queued
+func (s *Server) wakeGenerationWorker() {
+	select {
+	case s.generationWake <- struct{}{}:
+	default:
+	}
+}
+
+// generationJobKey looks up the key a queued job is made with again. Jobs with the user's own key
+// fail when they removed it, or stopped being a professional, since they were queued.
+func (s *Server) generationJobKey(ctx context.Context, queued QueuedGeneration) (GenerationKey, error) {
+	if queued.OwnKey {
+		key, own, err := s.ownGenerationKey(ctx, queued.UserID)
+		if err != nil {
+			return GenerationKey{}, err
+		}
+		if !own {
+			return GenerationKey{}, errors.New("your provider key was removed")
+		}
+		return key, nil
+	}
+	claudeAPIKey := GetAPIKey("CLAUDE_API_KEY")
+	if claudeAPIKey == "" {
+		return GenerationKey{}, errors.New("Claude API key not configured")
+	}
+	return GenerationKey{Provider: ProviderAnthropic, APIKey: claudeAPIKey}, nil
+}
+
+// failGenerationJob marks a job failed with message and tells the user
+func (s *Server) failGenerationJob(ctx context.Context, job generationJob, message string) {
+	job.publish(GenerationUpdate{Status: GenerationFailed, Error: message})
+	if err := s.store.FailGenerationJob(ctx, job.id, message); err != nil {
+		log.Printf("[JOBS] Failed to record that job %s failed: %v", job.id, err)
+	}
+}
+
+// runGenerationJob generates the animation of a claimed job and records its result. A generation
+// that fails is settled like one made while the client waited, so it does not count against the
+// quota or workspace credits.
+func (s *Server) runGenerationJob(ctx context.Context, queued QueuedGeneration) {
+	const endpoint = "/generate-animation"
+	ctx = WithCorrelation(ctx, queued.Correlation)
+	log.Printf("[JOBS] Running job %s, attempt %d %s", queued.ID, queued.Attempts, queued.Correlation)
+	job := generationJob{
+		id:             queued.ID,
+		userId:         queued.UserID,
+		description:    queued.Description,
+		style:          queued.Style,
+		key:            GenerationKey{Provider: queued.Provider, Own: queued.OwnKey},
+		organizationId: queued.OrganizationID,
+	}
+	if queued.Attempts > maxGenerationJobAttempts {
+		LogResponse(endpoint, "Giving up on job "+job.id+" after it was abandoned repeatedly", nil)
+		s.settleGeneration(ctx, endpoint, job, false)
+		s.failGenerationJob(ctx, job, "Generation was interrupted")
+		return
+	}
+	key, err := s.generationJobKey(ctx, queued)
+	if err != nil {
+		LogResponse(endpoint, "Error picking the key for job "+job.id, err)
+		s.settleGeneration(ctx, endpoint, job, false)
+		s.failGenerationJob(ctx, job, "Error generating animation: "+err.Error())
+		return
+	}
+	job.key = key
+
+	// Every call made for the generation, repairs included, is billed to it
+	ctx, meter := withTokenMeter(ctx)
+	succeeded := false
+	defer func() { s.recordGeneration(ctx, endpoint, job, meter, succeeded) }()
+
+	job.publish(GenerationUpdate{Status: GenerationGenerating})
+	animation, err := job.key.generate(ctx, job.description, job.style)
+	s.settleGeneration(ctx, endpoint, job, err == nil)
+	if err != nil {
+		LogResponse(endpoint, "Error generating animation for job "+job.id, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.failGenerationJob(ctx, job, "Generation timed out waiting for the provider")
+			return
+		}
+		s.failGenerationJob(ctx, job, "Error generating animation: "+err.Error())
+		return
+	}
+
+	response := finishGeneration(ctx, job, animation, endpoint)
+	succeeded = true
+	if err := s.store.CompleteGenerationJob(ctx, job.id, response); err != nil {
+		log.Printf("[JOBS] Failed to record the result of job %s: %v", job.id, err)
+		return
+	}
+	LogResponse(endpoint, "Animation generated and processed successfully for job "+job.id, nil)
+}
+
+// runNextGenerationJob claims the job waiting longest in each data region and runs it in that
+// region, reporting whether there was one. Jobs are queued in the region of the user who asked for
+// them, so every region's queue is taken from in turn.
+func (s *Server) runNextGenerationJob(ctx context.Context) (bool, error) {
+	ran := false
+	err := ForEachDataRegion(ctx, func(ctx context.Context, region string) error {
+		claimed, err := s.store.ClaimGenerationJobs(ctx, 1)
+		if err != nil || len(claimed) == 0 {
+			return err
+		}
+		s.runGenerationJob(ctx, claimed[0])
+		ran = true
+		return nil
+	})
+	return ran, err
+}
+
+// runGenerationWorker runs queued jobs one at a time until ctx is done
+func (s *Server) runGenerationWorker(ctx context.Context) {
+	ticker := time.NewTicker(generationJobPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			ran, err := s.runNextGenerationJob(ctx)
+			if err != nil {
+				log.Printf("[JOBS] Failed to claim a generation job: %v", err)
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.generationWake:
+		}
+	}
+}
+
+// RunGenerationWorkers runs GenerationWorkers workers taking jobs from the generation queue, and
+// deletes finished jobs in every region once they are past generationJobRetention, until ctx is done
+func (s *Server) RunGenerationWorkers(ctx context.Context) {
+	workers := GenerationWorkers()
+	for i := 0; i < workers; i++ {
+		go s.runGenerationWorker(ctx)
+	}
+	log.Printf("[JOBS] Running %d generation workers", workers)
+
+	ticker := time.NewTicker(generationJobPruneEvery)
+	defer ticker.Stop()
+	for {
+		deleted, err := deleteInEveryDataRegion(ctx, func(ctx context.Context) (int, error) {
+			return s.store.DeleteFinishedGenerationJobs(ctx, time.Now().Add(-generationJobRetention))
+		})
+		if err != nil {
+			log.Printf("[JOBS] Failed to delete finished generation jobs: %v", err)
+		} else if deleted > 0 {
+			log.Printf("[JOBS] Deleted %d finished generation jobs", deleted)
+		}
+		recordWorkerPass("generation jobs", generationJobPruneEvery, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
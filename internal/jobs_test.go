@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// generateAndWait queues a generation, runs the jobs queued, and returns the status the queueing
+// was answered with and the job as GET /jobs/{id} reports it once run
+func generateAndWait(t *testing.T, server *Server, router http.Handler, token string, req AnimationRequest) (int, GenerationJob) {
+	t.Helper()
+	var job GenerationJob
+	code := doJSON(t, router, http.MethodPost, "/generate-animation", token, req, &job)
+	if code != http.StatusAccepted {
+		return code, job
+	}
+	for {
+		ran, err := server.runNextGenerationJob(context.Background())
+		if err != nil {
+			t.Fatalf("runNextGenerationJob: %v", err)
+		}
+		if !ran {
+			break
+		}
+	}
+	if status := doJSON(t, router, http.MethodGet, "/jobs/"+job.ID, token, nil, &job); status != http.StatusOK {
+		t.Fatalf("job status = %d", status)
+	}
+	return code, job
+}
+
+func TestGenerationJobs(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+
+	failing := false
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "bad request"}}`))
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}\nfunction draw() {}"}]}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	store := NewMemoryStore()
+	server := NewServer(store)
+	router := server.Router()
+	artist := registerAccount(t, router, "artist")
+	other := registerAccount(t, router, "other")
+
+	t.Run("Queued until a worker runs it", func(t *testing.T) {
+		var queued GenerationJob
+		if code := doJSON(t, router, http.MethodPost, "/generate-animation", artist.Token, AnimationRequest{Description: "a calm ocean"}, &queued); code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+		}
+		var job GenerationJob
+		if code := doJSON(t, router, http.MethodGet, "/jobs/"+queued.ID, artist.Token, nil, &job); code != http.StatusOK || job.Status != GenerationQueued {
+			t.Fatalf("job before running = %d %+v, want it queued", code, job)
+		}
+		if code := doJSON(t, router, http.MethodGet, "/jobs/"+queued.ID, other.Token, nil, nil); code != http.StatusNotFound {
+			t.Errorf("another user's job status = %d, want %d", code, http.StatusNotFound)
+		}
+		if ran, err := server.runNextGenerationJob(context.Background()); !ran || err != nil {
+			t.Fatalf("runNextGenerationJob() = %v, %v", ran, err)
+		}
+		doJSON(t, router, http.MethodGet, "/jobs/"+queued.ID, artist.Token, nil, &job)
+		if job.Status != GenerationDone || job.Result == nil || !strings.Contains(job.Result.Code, "function draw()") {
+			t.Errorf("job after running = %+v, want the sketch", job)
+		}
+	})
+
+	t.Run("Failure releases the quota", func(t *testing.T) {
+		failing = true
+		defer func() { failing = false }()
+		code, job := generateAndWait(t, server, router, artist.Token, AnimationRequest{Description: "a stormy sea"})
+		if code != http.StatusAccepted || job.Status != GenerationFailed || !strings.HasPrefix(job.Error, "Error generating animation") {
+			t.Errorf("job = %d %+v, want it failed", code, job)
+		}
+		var quota GenerationQuota
+		doJSON(t, router, http.MethodGet, "/quota", artist.Token, nil, &quota)
+		if quota.DailyUsed != 1 {
+			t.Errorf("generations used = %d, want only the generation that succeeded", quota.DailyUsed)
+		}
+	})
+
+	t.Run("Abandoned jobs are given up on", func(t *testing.T) {
+		store.EnqueueGenerationJob(context.Background(), QueuedGeneration{ID: "abandoned", UserID: artist.User.ID, Description: "x", Provider: ProviderAnthropic})
+		for i := 0; i < maxGenerationJobAttempts; i++ {
+			store.ClaimGenerationJobs(context.Background(), 1)
+			store.generationJob("abandoned").claimedUntil = time.Now().Add(-time.Second)
+		}
+		server.runNextGenerationJob(context.Background())
+		var job GenerationJob
+		doJSON(t, router, http.MethodGet, "/jobs/abandoned", artist.Token, nil, &job)
+		if job.Status != GenerationFailed || job.Error != "Generation was interrupted" {
+			t.Errorf("job = %+v, want it given up on", job)
+		}
+	})
+
+	t.Run("Finished jobs are deleted", func(t *testing.T) {
+		deleted, _ := store.DeleteFinishedGenerationJobs(context.Background(), time.Now().Add(time.Second))
+		if deleted != 3 {
+			t.Errorf("deleted %d jobs, want the three finished", deleted)
+		}
+	})
+}
+
+func TestGenerationJobsInEveryRegion(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}\nfunction draw() {}"}]}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	withDataRegions(t, "eu")
+	store := newRegionalStore("eu")
+	server := NewServer(store)
+	artist := registerAccount(t, server.Router(), "artist")
+
+	// A job queued in a region other than the primary one is run there
+	eu := WithDataRegion(context.Background(), "eu")
+	for ctx, id := range map[context.Context]string{context.Background(): "primary-job", eu: "eu-job"} {
+		if err := store.EnqueueGenerationJob(ctx, QueuedGeneration{ID: id, UserID: artist.User.ID, Description: "a calm ocean", Provider: ProviderAnthropic}); err != nil {
+			t.Fatalf("EnqueueGenerationJob: %v", err)
+		}
+	}
+	if ran, err := server.runNextGenerationJob(context.Background()); !ran || err != nil {
+		t.Fatalf("runNextGenerationJob() = %v, %v", ran, err)
+	}
+	for ctx, id := range map[context.Context]string{context.Background(): "primary-job", eu: "eu-job"} {
+		if job, err := store.GetGenerationJob(ctx, id, artist.User.ID); err != nil || job.Status != GenerationDone {
+			t.Errorf("%s = %+v, %v, want it done", id, job, err)
+		}
+	}
+	if _, err := store.regions["eu"].GetGenerationJob(context.Background(), "primary-job", artist.User.ID); err == nil {
+		t.Error("the primary region's job was recorded in the eu region")
+	}
+}
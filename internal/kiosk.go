@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// kioskTokenPrefix marks kiosk tokens apart from the JWTs users sign in with
+	kioskTokenPrefix   = "kiosk_"
+	maxKioskNameLength = 80
+	// maxKioskSchedules caps how many signage schedules one display may be assigned
+	maxKioskSchedules = 20
+	// kioskTouchInterval is how stale a token's last use may get before it is recorded again, so
+	// displays polling every minute do not write on every request
+	kioskTouchInterval = 5 * time.Minute
+)
+
+// kioskTokenKey holds the kiosk token a request was authenticated with
+const kioskTokenKey contextKey = "kioskToken"
+
+// GetKioskTokenFromContext retrieves the kiosk token a request was authenticated with
+func GetKioskTokenFromContext(ctx context.Context) (KioskToken, bool) {
+	token, ok := ctx.Value(kioskTokenKey).(KioskToken)
+	return token, ok
+}
+
+// newKioskToken returns a random kiosk token and the hash it is stored under
+func newKioskToken() (string, string, error) {
+	secret, err := generateRandomID()
+	if err != nil {
+		return "", "", err
+	}
+	token := kioskTokenPrefix + secret
+	return token, HashToken(token), nil
+}
+
+// ValidateKioskToken checks a kiosk token request and returns the token it describes, with the
+// schedules trimmed and without repeats. Whether the schedules exist is left to the caller.
+func ValidateKioskToken(req KioskTokenRequest) (KioskToken, error) {
+	token := KioskToken{Name: strings.TrimSpace(req.Name), ScheduleIDs: []string{}, Feed: req.Feed}
+	if token.Name == "" || len(token.Name) > maxKioskNameLength {
+		return KioskToken{}, fmt.Errorf("name must be 1-%d characters", maxKioskNameLength)
+	}
+	for _, id := range req.ScheduleIDs {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			return KioskToken{}, errors.New("schedule IDs must not be blank")
+		}
+		if !slices.Contains(token.ScheduleIDs, id) {
+			token.ScheduleIDs = append(token.ScheduleIDs, id)
+		}
+	}
+	if len(token.ScheduleIDs) > maxKioskSchedules {
+		return KioskToken{}, fmt.Errorf("kiosk tokens may be assigned at most %d schedules", maxKioskSchedules)
+	}
+	if len(token.ScheduleIDs) == 0 && !token.Feed {
+		return KioskToken{}, errors.New("kiosk tokens need a schedule or the feed to read")
+	}
+	if req.ExpiresInDays < 0 {
+		return KioskToken{}, errors.New("expiresInDays must not be negative")
+	}
+	return token, nil
+}
+
+// Expired reports whether the token may no longer be used at now
+func (k KioskToken) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// CanReadSchedule reports whether the token is assigned the signage schedule
+func (k KioskToken) CanReadSchedule(id string) bool {
+	return slices.Contains(k.ScheduleIDs, id)
+}
+
+// KioskAuthMiddleware authenticates unattended displays by their kiosk token and adds it to the
+// context. Kiosk tokens are not JWTs, so AuthMiddleware turns them away from every other route.
+func (s *Server) KioskAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !strings.HasPrefix(secret, kioskTokenPrefix) {
+			EncodeError(w, "Kiosk token required", http.StatusUnauthorized)
+			return
+		}
+		token, err := s.store.GetKioskTokenByHash(r.Context(), HashToken(secret))
+		if err != nil {
+			if err.Error() != "kiosk token not found" {
+				LogResponse(r.URL.Path, "Error retrieving kiosk token", err)
+				EncodeError(w, "Error retrieving kiosk token", http.StatusInternalServerError)
+				return
+			}
+			EncodeError(w, "Invalid or expired kiosk token", http.StatusUnauthorized)
+			return
+		}
+		now := time.Now()
+		if token.Expired(now) {
+			EncodeError(w, "Invalid or expired kiosk token", http.StatusUnauthorized)
+			return
+		}
+
+		if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= kioskTouchInterval {
+			if err := s.store.TouchKioskToken(r.Context(), token.ID, now); err != nil {
+				log.Printf("[KIOSK] Failed to record use of kiosk token %d: %v", token.ID, err)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), kioskTokenKey, token)))
+	})
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateKioskToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		req           KioskTokenRequest
+		wantSchedules []string
+		wantErr       bool
+	}{
+		{name: "Schedules", req: KioskTokenRequest{Name: " Lobby ", ScheduleIDs: []string{"a", " b", "a"}}, wantSchedules: []string{"a", "b"}},
+		{name: "Feed only", req: KioskTokenRequest{Name: "Lobby", Feed: true}, wantSchedules: []string{}},
+		{name: "Nothing to read", req: KioskTokenRequest{Name: "Lobby"}, wantErr: true},
+		{name: "Blank name", req: KioskTokenRequest{Name: " ", Feed: true}, wantErr: true},
+		{name: "Blank schedule", req: KioskTokenRequest{Name: "Lobby", ScheduleIDs: []string{" "}}, wantErr: true},
+		{name: "Negative expiry", req: KioskTokenRequest{Name: "Lobby", Feed: true, ExpiresInDays: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := ValidateKioskToken(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateKioskToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(token.ScheduleIDs, tt.wantSchedules) {
+				t.Errorf("schedules = %v, want %v", token.ScheduleIDs, tt.wantSchedules)
+			}
+		})
+	}
+}
+
+func TestKioskTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	owner := registerUser(t, router, "clinic")
+
+	var scheduled, other SaveAnimationResponse
+	doJSON(t, router, http.MethodPost, "/save-animation", owner, SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "calm"}, &scheduled)
+	doJSON(t, router, http.MethodPost, "/save-animation", owner, SaveAnimationRequest{Code: "function setup() {}\nfunction draw() { background(0); }", Description: "dark"}, &other)
+	var schedule, unassigned SignageSchedule
+	allDay := SignageScheduleRequest{Name: "Waiting room", Timezone: "UTC", Slots: []SignageSlot{{AnimationID: scheduled.ID, Start: "00:00", End: "24:00"}}}
+	doJSON(t, router, http.MethodPost, "/signage/schedules", owner, allDay, &schedule)
+	doJSON(t, router, http.MethodPost, "/signage/schedules", owner, allDay, &unassigned)
+
+	var kiosk KioskToken
+	if code := doJSON(t, router, http.MethodPost, "/admin/kiosk-tokens", admin.Token, KioskTokenRequest{Name: "Lobby", ScheduleIDs: []string{schedule.ID}}, &kiosk); code != http.StatusCreated {
+		t.Fatalf("issue status = %d", code)
+	}
+	if !strings.HasPrefix(kiosk.Token, kioskTokenPrefix) {
+		t.Fatalf("token = %q, want a kiosk token", kiosk.Token)
+	}
+	var expired KioskToken
+	doJSON(t, router, http.MethodPost, "/admin/kiosk-tokens", admin.Token, KioskTokenRequest{Name: "Old", Feed: true}, &expired)
+	past := time.Now().Add(-time.Hour)
+	store.kioskTokens[1].token.ExpiresAt = &past
+
+	tokenPath := "/admin/kiosk-tokens/" + strconv.Itoa(kiosk.ID)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Non-admin issues", method: http.MethodPost, path: "/admin/kiosk-tokens", token: owner, body: KioskTokenRequest{Name: "Lobby", Feed: true}, wantCode: http.StatusForbidden},
+		{name: "Unknown schedule", method: http.MethodPost, path: "/admin/kiosk-tokens", token: admin.Token, body: KioskTokenRequest{Name: "Lobby", ScheduleIDs: []string{"missing"}}, wantCode: http.StatusBadRequest},
+		{name: "Assignment", method: http.MethodGet, path: "/kiosk", token: kiosk.Token, wantCode: http.StatusOK},
+		{name: "Assigned schedule", method: http.MethodGet, path: "/kiosk/schedules/" + schedule.ID + "/now", token: kiosk.Token, wantCode: http.StatusOK},
+		{name: "Unassigned schedule", method: http.MethodGet, path: "/kiosk/schedules/" + unassigned.ID + "/now", token: kiosk.Token, wantCode: http.StatusNotFound},
+		{name: "Scheduled animation", method: http.MethodGet, path: "/kiosk/animation/" + scheduled.ID, token: kiosk.Token, wantCode: http.StatusOK},
+		{name: "Other animation", method: http.MethodGet, path: "/kiosk/animation/" + other.ID, token: kiosk.Token, wantCode: http.StatusNotFound},
+		{name: "Feed not allowed", method: http.MethodGet, path: "/kiosk/feed", token: kiosk.Token, wantCode: http.StatusForbidden},
+		{name: "Moods", method: http.MethodGet, path: "/moods", token: kiosk.Token, wantCode: http.StatusUnauthorized},
+		{name: "Account", method: http.MethodGet, path: "/quota", token: kiosk.Token, wantCode: http.StatusUnauthorized},
+		{name: "User token", method: http.MethodGet, path: "/kiosk", token: owner, wantCode: http.StatusUnauthorized},
+		{name: "Expired", method: http.MethodGet, path: "/kiosk/feed", token: expired.Token, wantCode: http.StatusUnauthorized},
+		{name: "Allow the feed", method: http.MethodPut, path: tokenPath, token: admin.Token, body: KioskTokenRequest{Name: "Lobby", ScheduleIDs: []string{schedule.ID}, Feed: true}, wantCode: http.StatusOK},
+		{name: "Feed", method: http.MethodGet, path: "/kiosk/feed", token: kiosk.Token, wantCode: http.StatusOK},
+		{name: "Any animation with the feed", method: http.MethodGet, path: "/kiosk/animation/" + other.ID, token: kiosk.Token, wantCode: http.StatusOK},
+		{name: "Revoke", method: http.MethodDelete, path: tokenPath, token: admin.Token, wantCode: http.StatusNoContent},
+		{name: "Revoked", method: http.MethodGet, path: "/kiosk", token: kiosk.Token, wantCode: http.StatusUnauthorized},
+		{name: "Revoke twice", method: http.MethodDelete, path: tokenPath, token: admin.Token, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var list KioskTokensResponse
+	doJSON(t, router, http.MethodGet, "/admin/kiosk-tokens", admin.Token, nil, &list)
+	if len(list.Tokens) != 1 || list.Tokens[0].ID != expired.ID || list.Tokens[0].Token != "" {
+		t.Errorf("tokens = %+v, want the expired one without its secret", list.Tokens)
+	}
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Defaults for load shedding
+const (
+	defaultLowPriorityPercent    = 60
+	defaultNormalPriorityPercent = 90
+	loadShedRetryAfterSeconds    = 1
+)
+
+// Request priorities; lower priorities are shed first as the server fills up
+const (
+	PriorityLow      = "low"
+	PriorityNormal   = "normal"
+	PriorityCritical = "critical"
+)
+
+// routePriorities classifies routes that are not PriorityNormal. Signing in and saving work are
+// never shed; browsing can be retried a moment later.
+var routePriorities = map[string]string{
+	"/register":         PriorityCritical,
+	"/login":            PriorityCritical,
+	"/login/magic-link": PriorityCritical,
+	"/login/magic":      PriorityCritical,
+	"/save-animation":   PriorityCritical,
+	"/save-mood":        PriorityCritical,
+	"/feed":             PriorityLow,
+	"/search":           PriorityLow,
+	"/search/semantic":  PriorityLow,
+	"/datasets/latest":  PriorityLow,
+	"/prompt-presets":   PriorityLow,
+	// Feed readers poll collections on a schedule and retry
+	"/collections/{id:[0-9]+}/feed.json": PriorityLow,
+	"/collections/{id:[0-9]+}/feed.rss":  PriorityLow,
+}
+
+// RoutePriority returns the priority of a route template, the same under every API version
+func RoutePriority(route string) string {
+	if priority, ok := routePriorities[unversionedRoute(route)]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// LoadShedConfig decides when requests are shed
+type LoadShedConfig struct {
+	// MaxInFlight is how many requests the server handles at once; 0 disables shedding
+	MaxInFlight int
+	// LowPriorityPercent and NormalPriorityPercent are the shares of MaxInFlight beyond which
+	// new low and normal priority requests are shed
+	LowPriorityPercent    int
+	NormalPriorityPercent int
+	// RouteLimits caps the in-flight requests of individual routes
+	RouteLimits map[string]int
+}
+
+// LoadShedConfigFromEnv reads LOAD_SHED_MAX_INFLIGHT, LOAD_SHED_LOW_PRIORITY_PERCENT,
+// LOAD_SHED_NORMAL_PRIORITY_PERCENT and LOAD_SHED_ROUTE_LIMITS
+func LoadShedConfigFromEnv() LoadShedConfig {
+	config := LoadShedConfig{
+		MaxInFlight:           envLimit("LOAD_SHED_MAX_INFLIGHT", 0),
+		LowPriorityPercent:    min(envLimit("LOAD_SHED_LOW_PRIORITY_PERCENT", defaultLowPriorityPercent), 100),
+		NormalPriorityPercent: min(envLimit("LOAD_SHED_NORMAL_PRIORITY_PERCENT", defaultNormalPriorityPercent), 100),
+		RouteLimits:           map[string]int{},
+	}
+	limits, err := parseRegionMap("LOAD_SHED_ROUTE_LIMITS")
+	if err != nil {
+		log.Printf("Warning: Ignoring LOAD_SHED_ROUTE_LIMITS: %v", err)
+		return config
+	}
+	for route, raw := range limits {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			log.Printf("Warning: Ignoring invalid LOAD_SHED_ROUTE_LIMITS limit %q for %s", raw, route)
+			continue
+		}
+		config.RouteLimits[route] = limit
+	}
+	return config
+}
+
+// inFlightTracker counts the requests each route is serving and how many it shed
+type inFlightTracker struct {
+	mu       sync.Mutex
+	total    int
+	inFlight map[string]int
+	shed     map[string]int64
+}
+
+func newInFlightTracker() *inFlightTracker {
+	return &inFlightTracker{inFlight: map[string]int{}, shed: map[string]int64{}}
+}
+
+// requestsInFlight tracks the requests served by the router
+var requestsInFlight = newInFlightTracker()
+
+// admit starts a request on route unless config says to shed it
+func (t *inFlightTracker) admit(route string, config LoadShedConfig) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	priority := RoutePriority(route)
+	shed := false
+	if priority != PriorityCritical {
+		if limit, ok := config.RouteLimits[route]; ok && t.inFlight[route] >= limit {
+			shed = true
+		}
+		if config.MaxInFlight > 0 {
+			percent := config.NormalPriorityPercent
+			if priority == PriorityLow {
+				percent = config.LowPriorityPercent
+			}
+			if t.total >= config.MaxInFlight*percent/100 {
+				shed = true
+			}
+		}
+	}
+	if shed {
+		t.shed[route]++
+		return false
+	}
+	t.total++
+	t.inFlight[route]++
+	return true
+}
+
+// done finishes a request admitted on route
+func (t *inFlightTracker) done(route string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total--
+	t.inFlight[route]--
+}
+
+// snapshot copies the counts for reporting
+func (t *inFlightTracker) snapshot() (map[string]float64, map[string]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	inFlight := make(map[string]float64, len(t.inFlight))
+	for route, count := range t.inFlight {
+		inFlight[route] = float64(count)
+	}
+	shed := make(map[string]float64, len(t.shed))
+	for route, count := range t.shed {
+		shed[route] = float64(count)
+	}
+	return inFlight, shed
+}
+
+// LoadShedMiddleware tracks in-flight requests per route and, when the server is fuller than
+// LoadShedConfigFromEnv allows, answers lower priority requests with 503 so the rest keep working.
+// It must be registered on the router so the matched route is known.
+func LoadShedMiddleware() func(http.Handler) http.Handler {
+	config := LoadShedConfigFromEnv()
+	if config.MaxInFlight > 0 || len(config.RouteLimits) > 0 {
+		log.Printf("[LOAD] Shedding low priority requests beyond %d%% and normal ones beyond %d%% of %d in flight, route limits %v",
+			config.LowPriorityPercent, config.NormalPriorityPercent, config.MaxInFlight, config.RouteLimits)
+	}
+	return loadShedMiddleware(requestsInFlight, config)
+}
+
+func loadShedMiddleware(tracker *inFlightTracker, config LoadShedConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// WebSocket connections stay open as long as the client does, so counting them would
+			// leave the server looking busy
+			if r.Method == http.MethodOptions || isWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			if !tracker.admit(route, config) {
+				LogResponse(route, "Shedding "+RoutePriority(route)+" priority request under load", nil)
+				w.Header().Set("Retry-After", strconv.Itoa(loadShedRetryAfterSeconds))
+				EncodeError(w, "Server is busy, please retry shortly", http.StatusServiceUnavailable)
+				return
+			}
+			defer tracker.done(route)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeLabeledMetric writes one metric with a value per label value in the Prometheus text
+// exposition format
+func writeLabeledMetric(w io.Writer, name, kind, help, label string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %g\n", name, label, key, values[key])
+	}
+}
+
+// writeLoadMetrics reports in-flight and shed requests per route
+func writeLoadMetrics(w io.Writer) {
+	inFlight, shed := requestsInFlight.snapshot()
+	writeLabeledMetric(w, "animate_http_requests_in_flight", "gauge", "Requests currently being served, by route.", "route", inFlight)
+	writeLabeledMetric(w, "animate_http_requests_shed_total", "counter", "Total requests answered with 503 by load shedding, by route.", "route", shed)
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLoadShedding(t *testing.T) {
+	tracker := newInFlightTracker()
+	config := LoadShedConfig{MaxInFlight: 4, LowPriorityPercent: 50, NormalPriorityPercent: 75, RouteLimits: map[string]int{"/search": 1}}
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r := mux.NewRouter()
+	r.Use(loadShedMiddleware(tracker, config))
+	// Requests with ?hold stay in flight until released
+	block := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("hold") {
+			started <- struct{}{}
+			<-release
+		}
+	}
+	for _, route := range []string{"/feed", "/search", "/animation/{id}", "/login"} {
+		r.HandleFunc(route, block)
+	}
+
+	var wg sync.WaitGroup
+	hold := func(path string) {
+		t.Helper()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path+"?hold", nil))
+		}()
+		<-started
+	}
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	hold("/search")
+	if code := status("/search"); code != http.StatusServiceUnavailable {
+		t.Errorf("second /search status = %d, want 503 beyond its route limit", code)
+	}
+	hold("/feed")
+	if code := status("/feed"); code != http.StatusServiceUnavailable {
+		t.Errorf("/feed with 2 in flight status = %d, want 503", code)
+	}
+	hold("/animation/abc")
+	if code := status("/animation/def"); code != http.StatusServiceUnavailable {
+		t.Errorf("/animation with 3 in flight status = %d, want 503", code)
+	}
+	// Signing in is never shed
+	hold("/login")
+	hold("/login")
+
+	inFlight, shed := tracker.snapshot()
+	if inFlight["/login"] != 2 || inFlight["/feed"] != 1 || shed["/search"] != 1 || shed["/feed"] != 1 || shed["/animation/{id}"] != 1 {
+		t.Errorf("in flight %v, shed %v", inFlight, shed)
+	}
+
+	close(release)
+	wg.Wait()
+	if inFlight, _ := tracker.snapshot(); inFlight["/login"] != 0 || inFlight["/feed"] != 0 {
+		t.Errorf("in flight after finishing = %v, want none", inFlight)
+	}
+}
+
+func TestWriteLabeledMetric(t *testing.T) {
+	var out strings.Builder
+	writeLabeledMetric(&out, "animate_http_requests_in_flight", "gauge", "In flight.", "route", map[string]float64{"/feed": 2, "/animation/{id}": 1})
+
+	want := "# HELP animate_http_requests_in_flight In flight.\n# TYPE animate_http_requests_in_flight gauge\n" +
+		"animate_http_requests_in_flight{route=\"/animation/{id}\"} 1\nanimate_http_requests_in_flight{route=\"/feed\"} 2\n"
+	if out.String() != want {
+		t.Errorf("writeLabeledMetric() = %q, want %q", out.String(), want)
+	}
+}
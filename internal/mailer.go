@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends plain text emails to users
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// smtpMailer delivers email through an SMTP server
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// Send delivers a plain text email over SMTP
+func (m smtpMailer) Send(to, subject, body string) error {
+	message := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// logMailer writes emails to the log when no SMTP server is configured
+type logMailer struct{}
+
+// Send logs who the email was for instead of delivering it. The body is left out, since it may
+// hold login, revert or impersonation links that anyone reading the logs could use.
+func (logMailer) Send(to, subject, body string) error {
+	log.Printf("[MAIL] SMTP not configured, dropped email to %s - %s", RedactLog(to), subject)
+	return nil
+}
+
+// GetMailer returns an SMTP mailer when SMTP_HOST is set, otherwise a mailer that only logs
+func GetMailer() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return logMailer{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	username := os.Getenv("SMTP_USERNAME")
+	if from == "" {
+		from = username
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	return smtpMailer{addr: host + ":" + port, auth: auth, from: from}
+}
+
+// PublicURL builds an absolute URL for links sent to users
+func PublicURL(path string) string {
+	baseURL := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return baseURL + path
+}
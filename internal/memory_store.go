@@ -0,0 +1,3648 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memoryAnimation is an animation held by MemoryStore
+type memoryAnimation struct {
+	id           string
+	userId       string
+	code         string
+	description  string
+	renderStatus string
+	p5Version    string
+	changelog    []ChangelogEntry
+	// versions holds every version with its code, oldest first
+	versions  []AnimationVersion
+	compat    []P5Compatibility
+	createdAt time.Time
+
+	photosensitivity string
+	motionScore      float64
+
+	embeddingModel string
+	embedding      []float32
+
+	// refinements is the conversation the animation is refined through, oldest first
+	refinements []RefinementTurn
+
+	// review is set when the animation was held for its workspace owner's approval
+	review *AnimationReview
+	// removed is set while a takedown request keeps the animation hidden
+	removed bool
+}
+
+// memoryProfileChange is a profile change held by MemoryStore
+type memoryProfileChange struct {
+	userId          string
+	field           string
+	oldValue        string
+	newValue        string
+	revertTokenHash string
+	revertExpiresAt time.Time
+	reverted        bool
+}
+
+// memoryMood is a mood held by MemoryStore
+type memoryMood struct {
+	mood    string
+	savedAt time.Time
+}
+
+// memoryNotification is a queued notification held by MemoryStore
+type memoryNotification struct {
+	notification  Notification
+	nextAttemptAt time.Time
+	lastError     string
+}
+
+// memoryReminder is a reminder schedule held by MemoryStore
+type memoryReminder struct {
+	schedule ReminderSchedule
+	nextAt   time.Time
+}
+
+// memoryReminderDelivery is a reminder sent, held by MemoryStore
+type memoryReminderDelivery struct {
+	userId   string
+	delivery ReminderDelivery
+}
+
+// memoryClientLink is a client link held by MemoryStore
+type memoryClientLink struct {
+	link            ClientLink
+	tokenHash       string
+	inviteExpiresAt time.Time
+}
+
+// MemoryStore is an in-memory Store for tests and local development without PostgreSQL
+type MemoryStore struct {
+	mu    sync.Mutex
+	users map[string]User
+	// sessionsRevokedAt holds when users were last signed out everywhere
+	sessionsRevokedAt map[string]time.Time
+	passwordHashes    map[string]string
+	animations        []*memoryAnimation
+	moods             map[[2]string]memoryMood
+	profileChanges    []*memoryProfileChange
+	p5Libraries       []P5Library
+	previewFrames     map[string][]PreviewFrame
+	preferences       map[string]ContentPreferences
+	accountTypes      map[string]string
+	clientLinks       []*memoryClientLink
+	sessions          []SessionAssignment
+	audit             map[int][]ProfessionalAuditEntry
+	dataset           *Dataset
+	comments          []Comment
+	nextCommentId     int
+	notifyPrefs       map[string]NotificationPreferences
+	notifications     []*memoryNotification
+	nextNotifyId      int64
+	reminders         map[string]*memoryReminder
+	deliveries        []memoryReminderDelivery
+	// announcements are kept in the order they were created
+	announcements      []Announcement
+	nextAnnouncementId int
+	dismissals         map[int]map[string]bool
+	// incidents are kept in the order they started
+	incidents      []*Incident
+	nextIncidentId int
+	providerKeys   map[string]ProviderKey
+	// providerKeyUses holds when each user generated with their own key
+	providerKeyUses map[string][]time.Time
+	// promptPresets are kept in the order they were created
+	promptPresets      []PromptPreset
+	nextPromptPresetId int
+	// collections are kept in the order they were created
+	collections      []Collection
+	nextCollectionId int
+	// collectionAdded holds when each animation was added to each collection
+	collectionAdded    map[int]map[string]time.Time
+	organizations      map[int]*Organization
+	nextOrganizationId int
+	organizationUses   []memoryOrganizationUse
+	// signageSchedules are kept in the order they were created
+	signageSchedules []SignageSchedule
+	// kioskTokens are kept in the order they were issued
+	kioskTokens      []memoryKioskToken
+	nextKioskTokenId int
+	// impersonations are kept in the order they were requested; impersonationAudit is only ever
+	// appended to
+	impersonations     []memoryImpersonation
+	impersonationAudit []ImpersonationAuditEntry
+	generations        []GenerationRecord
+	// calendarFeeds holds the hash of each user's calendar token
+	calendarFeeds map[string]string
+	// teamIntegrations and teamPosts are kept in the order they were created
+	teamIntegrations []TeamIntegration
+	teamPosts        []TeamPost
+	nextTeamPostId   int
+	// teamSignals holds the mood of each teammate who reacted to a post, by post
+	teamSignals map[int]map[string]Mood
+	// integrationKeys are kept in the order they were issued
+	integrationKeys      []memoryIntegrationKey
+	nextIntegrationKeyId int
+	// generationJobs are kept in the order they were queued
+	generationJobs []*memoryGenerationJob
+	// oauthApps and oauthTokens are kept in the order they were created
+	oauthApps        []memoryOAuthApp
+	oauthCodes       map[string]OAuthAuthorization
+	oauthTokens      []memoryOAuthToken
+	nextOAuthTokenId int
+	// exports are kept in the order they were rendered
+	exports []memoryExport
+	// moderationAudit is only ever appended to
+	moderationAudit []ModerationAuditEntry
+	// takedowns are kept in the order they were reported, with their audit trails
+	takedowns []TakedownRequest
+	// moodRules are kept in the order they were created
+	moodRules      []MoodRule
+	nextMoodRuleId int
+	// playbackSessions are the viewed sessions, kept by ID hash
+	playbackSessions map[string]*memoryPlaybackSession
+	// subscriptions are kept in the order they were created
+	subscriptions      []Subscription
+	nextSubscriptionId int
+	// idempotencyKeys are kept by user, route and key
+	idempotencyKeys map[[3]string]IdempotencyKey
+	// generationUsage holds how many generations each user made with the house key, by day
+	generationUsage map[string]map[string]int
+	// magicLinks holds the login tokens emailed to users by hash
+	magicLinks map[string]*memoryMagicLink
+	// sanitizationRuns are kept in the order they were started
+	sanitizationRuns      []*memorySanitizationRun
+	nextSanitizationFixId int
+	// contractRuns are kept in the order they were saved
+	contractRuns []ContractReport
+}
+
+// memoryMagicLink is a login token emailed to a user
+type memoryMagicLink struct {
+	userId    string
+	expiresAt time.Time
+	used      bool
+}
+
+// memorySanitizationRun is a re-sanitization run with the code its fixes propose
+type memorySanitizationRun struct {
+	run   SanitizationRun
+	fixes []memorySanitizationFix
+}
+
+// memorySanitizationFix is a proposed fix with the code it was made from and the code it stores
+type memorySanitizationFix struct {
+	fix         SanitizationFix
+	oldCodeHash string
+	newCode     string
+}
+
+// memoryPlaybackSession is a viewed playback session with the view reported in it
+type memoryPlaybackSession struct {
+	session PlaybackSession
+	view    PlaybackView
+}
+
+// memoryExport is an animation export with its file
+type memoryExport struct {
+	export AnimationExport
+	data   []byte
+}
+
+// memoryOAuthApp is a third-party app with the developer who registered it
+type memoryOAuthApp struct {
+	app    OAuthApp
+	userId string
+}
+
+// memoryOAuthToken is an OAuth token pair with the hashes of its secrets
+type memoryOAuthToken struct {
+	token       OAuthToken
+	accessHash  string
+	refreshHash string
+}
+
+// memoryGenerationJob is a queued generation with its progress
+type memoryGenerationJob struct {
+	queued       QueuedGeneration
+	job          GenerationJob
+	claimedUntil time.Time
+}
+
+// memoryIntegrationKey is an integration key with its owner and the hash of its secret
+type memoryIntegrationKey struct {
+	key    IntegrationKey
+	userId string
+	hash   string
+}
+
+// memoryKioskToken is a kiosk token with the hash of its secret
+type memoryKioskToken struct {
+	token KioskToken
+	hash  string
+}
+
+// memoryImpersonation is an impersonation with the hash of its token, empty until it starts
+type memoryImpersonation struct {
+	impersonation Impersonation
+	hash          string
+}
+
+// memoryOrganizationUse is a generation drawn on a workspace's credits
+type memoryOrganizationUse struct {
+	organizationId int
+	userId         string
+	at             time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:             make(map[string]User),
+		sessionsRevokedAt: make(map[string]time.Time),
+		passwordHashes:    make(map[string]string),
+		moods:             make(map[[2]string]memoryMood),
+		previewFrames:     make(map[string][]PreviewFrame),
+		preferences:       make(map[string]ContentPreferences),
+		accountTypes:      make(map[string]string),
+		audit:             make(map[int][]ProfessionalAuditEntry),
+		notifyPrefs:       make(map[string]NotificationPreferences),
+		reminders:         make(map[string]*memoryReminder),
+		dismissals:        make(map[int]map[string]bool),
+		providerKeys:      make(map[string]ProviderKey),
+		providerKeyUses:   make(map[string][]time.Time),
+		collectionAdded:   make(map[int]map[string]time.Time),
+		organizations:     make(map[int]*Organization),
+		calendarFeeds:     make(map[string]string),
+		teamSignals:       make(map[int]map[string]Mood),
+		oauthCodes:        make(map[string]OAuthAuthorization),
+		playbackSessions:  make(map[string]*memoryPlaybackSession),
+		idempotencyKeys:   make(map[[3]string]IdempotencyKey),
+		generationUsage:   make(map[string]map[string]int),
+		magicLinks:        make(map[string]*memoryMagicLink),
+	}
+}
+
+// userByEmail returns the user with the given email. The caller must hold mu.
+func (m *MemoryStore) userByEmail(email string) (User, bool) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// animation returns the animation with the given ID. The caller must hold mu.
+func (m *MemoryStore) animation(id string) *memoryAnimation {
+	for _, animation := range m.animations {
+		if animation.id == id {
+			return animation
+		}
+	}
+	return nil
+}
+
+// inFeed reports whether the feed may show an animation to viewers matching filter
+func inFeed(animation *memoryAnimation, filter FeedFilter) bool {
+	if animation.removed || animation.renderStatus == RenderStatusCrashed || animation.renderStatus == RenderStatusNondeterministic ||
+		animation.photosensitivity == PhotosensitivityFlashing {
+		return false
+	}
+	if animation.review != nil && animation.review.Status != ReviewApproved {
+		return false
+	}
+	if filter.ReducedMotion {
+		return animation.photosensitivity == PhotosensitivitySafe && animation.motionScore <= filter.MaxMotionScore
+	}
+	return !filter.AvoidFlashing || animation.photosensitivity == PhotosensitivitySafe
+}
+
+// response describes an animation with its pinned p5.js build. The caller must hold mu.
+func (m *MemoryStore) response(animation *memoryAnimation) GetAnimationResponse {
+	response := GetAnimationResponse{ID: animation.id, Code: animation.code, Description: animation.description, P5Version: animation.p5Version}
+	for _, library := range m.p5Libraries {
+		if library.Version == animation.p5Version {
+			response.P5URL, response.P5Integrity = library.URL, library.Integrity
+		}
+	}
+	return response
+}
+
+func (m *MemoryStore) UserExists(ctx context.Context, email string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.userByEmail(email)
+	return ok
+}
+
+func (m *MemoryStore) EmailInUseByOtherUser(ctx context.Context, email, userId string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.userByEmail(email)
+	return ok && user.ID != userId
+}
+
+func (m *MemoryStore) CreateUserWithUsername(ctx context.Context, email, username, passwordHash string) (string, error) {
+	userId, err := generateRandomID()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.userByEmail(email); ok {
+		return "", errors.New("failed to insert user: email already exists")
+	}
+	m.users[userId] = User{ID: userId, Email: email, Username: username, Tenant: TenantFromContext(ctx)}
+	m.passwordHashes[userId] = passwordHash
+	return userId, nil
+}
+
+func (m *MemoryStore) GetUserCredentials(ctx context.Context, email string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.userByEmail(email)
+	if !ok {
+		return "", "", errors.New("user not found")
+	}
+	return user.ID, m.passwordHashes[user.ID], nil
+}
+
+func (m *MemoryStore) GetUserIDByEmail(ctx context.Context, email string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.userByEmail(email)
+	if !ok {
+		return "", errors.New("user not found")
+	}
+	return user.ID, nil
+}
+
+func (m *MemoryStore) GetUserDetails(ctx context.Context, userId string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userId]
+	if !ok {
+		return User{}, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) SetUserTenant(ctx context.Context, userId, tenant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userId]
+	if !ok {
+		return errors.New("user not found")
+	}
+	if user.Tenant == "" {
+		user.Tenant = tenant
+		m.users[userId] = user
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserProfile(ctx context.Context, userId, email, username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userId]
+	if !ok {
+		return User{}, errors.New("user not found")
+	}
+	user.Email, user.Username = email, username
+	m.users[userId] = user
+	return user, nil
+}
+
+func (m *MemoryStore) RecordProfileChange(ctx context.Context, userId, field, oldValue, newValue, revertTokenHash string, revertExpiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profileChanges = append(m.profileChanges, &memoryProfileChange{
+		userId:          userId,
+		field:           field,
+		oldValue:        oldValue,
+		newValue:        newValue,
+		revertTokenHash: revertTokenHash,
+		revertExpiresAt: revertExpiresAt,
+	})
+	return nil
+}
+
+func (m *MemoryStore) RevertEmailChange(ctx context.Context, revertTokenHash string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, change := range m.profileChanges {
+		if change.revertTokenHash == "" || change.revertTokenHash != revertTokenHash || change.field != "email" ||
+			change.reverted || !time.Now().Before(change.revertExpiresAt) {
+			continue
+		}
+
+		if other, ok := m.userByEmail(change.oldValue); ok && other.ID != change.userId {
+			return User{}, errors.New("email already in use")
+		}
+
+		user := m.users[change.userId]
+		user.Email = change.oldValue
+		m.users[change.userId] = user
+		change.reverted = true
+		m.sessionsRevokedAt[change.userId] = time.Now()
+		m.profileChanges = append(m.profileChanges, &memoryProfileChange{
+			userId: change.userId, field: "email", oldValue: change.newValue, newValue: change.oldValue,
+		})
+		return user, nil
+	}
+	return User{}, errors.New("revert link is invalid or expired")
+}
+
+func (m *MemoryStore) SessionsRevokedAt(ctx context.Context, userId string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessionsRevokedAt[userId], nil
+}
+
+func (m *MemoryStore) GetContentPreferences(ctx context.Context, userId string) (ContentPreferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.preferences[userId], nil
+}
+
+func (m *MemoryStore) SaveContentPreferences(ctx context.Context, userId string, preferences ContentPreferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.preferences[userId] = preferences
+	return nil
+}
+
+func (m *MemoryStore) GetNotificationPreferences(ctx context.Context, userId string) (NotificationPreferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	preferences := m.notifyPrefs[userId]
+	preferences.Events = maps.Clone(preferences.Events)
+	return preferences, nil
+}
+
+func (m *MemoryStore) SaveNotificationPreferences(ctx context.Context, userId string, preferences NotificationPreferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	preferences.Events = maps.Clone(preferences.Events)
+	m.notifyPrefs[userId] = preferences
+	return nil
+}
+
+func (m *MemoryStore) QueueNotification(ctx context.Context, notification Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextNotifyId++
+	notification.ID = m.nextNotifyId
+	m.notifications = append(m.notifications, &memoryNotification{notification: notification, nextAttemptAt: notification.DeliverAfter})
+	return nil
+}
+
+func (m *MemoryStore) ClaimDueNotifications(ctx context.Context, limit int) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var claimed []Notification
+	for _, queued := range m.notifications {
+		if len(claimed) == limit {
+			break
+		}
+		if queued.nextAttemptAt.After(now) {
+			continue
+		}
+		queued.notification.Attempts++
+		queued.nextAttemptAt = now.Add(5 * time.Minute)
+		claimed = append(claimed, queued.notification)
+	}
+	return claimed, nil
+}
+
+func (m *MemoryStore) CompleteNotification(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifications = slices.DeleteFunc(m.notifications, func(queued *memoryNotification) bool {
+		return queued.notification.ID == id
+	})
+	return nil
+}
+
+func (m *MemoryStore) FailNotification(ctx context.Context, id int64, cause error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, queued := range m.notifications {
+		if queued.notification.ID == id {
+			minutes := min(1<<queued.notification.Attempts, notificationRetryMaxMinutes)
+			queued.nextAttemptAt = time.Now().Add(time.Duration(minutes) * time.Minute)
+			queued.lastError = cause.Error()
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetReminderSchedule(ctx context.Context, userId string) (ReminderSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reminder, ok := m.reminders[userId]
+	if !ok {
+		return ReminderSchedule{Times: []string{}}, nil
+	}
+	schedule := reminder.schedule
+	schedule.Times = slices.Clone(schedule.Times)
+	return schedule, nil
+}
+
+func (m *MemoryStore) SaveReminderSchedule(ctx context.Context, userId string, schedule ReminderSchedule, nextAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule.Times = slices.Clone(schedule.Times)
+	m.reminders[userId] = &memoryReminder{schedule: schedule, nextAt: nextAt}
+	return nil
+}
+
+func (m *MemoryStore) ClaimDueReminders(ctx context.Context, limit int) ([]DueReminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var due []DueReminder
+	for userId, reminder := range m.reminders {
+		if len(due) == limit {
+			break
+		}
+		if reminder.nextAt.IsZero() || reminder.nextAt.After(now) {
+			continue
+		}
+		reminder.nextAt = now.Add(5 * time.Minute)
+		due = append(due, DueReminder{UserID: userId, Schedule: ReminderSchedule{Times: slices.Clone(reminder.schedule.Times), Timezone: reminder.schedule.Timezone}})
+	}
+	return due, nil
+}
+
+func (m *MemoryStore) SetNextReminder(ctx context.Context, userId string, nextAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reminder, ok := m.reminders[userId]; ok {
+		reminder.nextAt = nextAt
+	}
+	return nil
+}
+
+func (m *MemoryStore) RecordReminderSent(ctx context.Context, userId, animationId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, memoryReminderDelivery{userId: userId, delivery: ReminderDelivery{AnimationID: animationId, SentAt: time.Now()}})
+	return nil
+}
+
+func (m *MemoryStore) RecordReminderCheckIn(ctx context.Context, userId string, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i := range m.deliveries {
+		delivery := &m.deliveries[i].delivery
+		if m.deliveries[i].userId == userId && delivery.CheckedInAt == nil && now.Sub(delivery.SentAt) <= window {
+			delivery.CheckedInAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListReminderDeliveries(ctx context.Context, userId string, window time.Duration) ([]ReminderDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := []ReminderDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if m.deliveries[i].userId == userId && time.Since(m.deliveries[i].delivery.SentAt) <= window {
+			deliveries = append(deliveries, m.deliveries[i].delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryStore) CreateAnnouncement(ctx context.Context, announcement Announcement) (Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextAnnouncementId++
+	announcement.ID = m.nextAnnouncementId
+	announcement.CreatedAt = time.Now()
+	announcement.Dismissals = 0
+	m.announcements = append(m.announcements, announcement)
+	return announcement, nil
+}
+
+func (m *MemoryStore) UpdateAnnouncement(ctx context.Context, announcement Announcement) (Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.announcements {
+		if existing.ID == announcement.ID {
+			announcement.CreatedBy = existing.CreatedBy
+			announcement.CreatedAt = existing.CreatedAt
+			m.announcements[i] = announcement
+			announcement.Dismissals = len(m.dismissals[announcement.ID])
+			return announcement, nil
+		}
+	}
+	return Announcement{}, errors.New("announcement not found")
+}
+
+func (m *MemoryStore) DeleteAnnouncement(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, announcement := range m.announcements {
+		if announcement.ID == id {
+			m.announcements = slices.Delete(m.announcements, i, i+1)
+			delete(m.dismissals, id)
+			return nil
+		}
+	}
+	return errors.New("announcement not found")
+}
+
+// sortedAnnouncements returns the announcements accepted by keep, newest first. The caller must hold mu.
+func (m *MemoryStore) sortedAnnouncements(keep func(Announcement) bool) []Announcement {
+	announcements := []Announcement{}
+	for _, announcement := range m.announcements {
+		if keep(announcement) {
+			announcements = append(announcements, announcement)
+		}
+	}
+	slices.SortStableFunc(announcements, func(a, b Announcement) int {
+		if c := b.StartsAt.Compare(a.StartsAt); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	})
+	return announcements
+}
+
+func (m *MemoryStore) ListAnnouncements(ctx context.Context) ([]Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	announcements := m.sortedAnnouncements(func(Announcement) bool { return true })
+	for i := range announcements {
+		announcements[i].Dismissals = len(m.dismissals[announcements[i].ID])
+	}
+	return announcements, nil
+}
+
+func (m *MemoryStore) ListActiveAnnouncements(ctx context.Context, userId string) ([]Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	return m.sortedAnnouncements(func(announcement Announcement) bool {
+		return !announcement.StartsAt.After(now) && (announcement.EndsAt == nil || announcement.EndsAt.After(now)) &&
+			!m.dismissals[announcement.ID][userId]
+	}), nil
+}
+
+func (m *MemoryStore) DismissAnnouncement(ctx context.Context, id int, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.ContainsFunc(m.announcements, func(announcement Announcement) bool { return announcement.ID == id }) {
+		return errors.New("announcement not found")
+	}
+	if m.dismissals[id] == nil {
+		m.dismissals[id] = make(map[string]bool)
+	}
+	m.dismissals[id][userId] = true
+	return nil
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryStore) CreateIncident(ctx context.Context, incident Incident, message string) (Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextIncidentId++
+	incident.ID = m.nextIncidentId
+	incident.StartedAt = time.Now()
+	incident.ResolvedAt = nil
+	incident.Updates = []IncidentUpdate{{Status: incident.Status, Message: message, CreatedAt: incident.StartedAt}}
+	m.incidents = append(m.incidents, &incident)
+	return cloneIncident(&incident), nil
+}
+
+func (m *MemoryStore) AddIncidentUpdate(ctx context.Context, id int, status, message string) (Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, incident := range m.incidents {
+		if incident.ID != id {
+			continue
+		}
+		if incident.ResolvedAt != nil {
+			return Incident{}, errors.New("incident resolved")
+		}
+		now := time.Now()
+		incident.Status = status
+		incident.Updates = append([]IncidentUpdate{{Status: status, Message: message, CreatedAt: now}}, incident.Updates...)
+		if status == IncidentResolved {
+			incident.ResolvedAt = &now
+		}
+		return cloneIncident(incident), nil
+	}
+	return Incident{}, errors.New("incident not found")
+}
+
+func (m *MemoryStore) ListIncidents(ctx context.Context, resolvedSince time.Time) ([]Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	incidents := []Incident{}
+	for i := len(m.incidents) - 1; i >= 0; i-- {
+		if resolvedAt := m.incidents[i].ResolvedAt; resolvedAt == nil || resolvedAt.After(resolvedSince) {
+			incidents = append(incidents, cloneIncident(m.incidents[i]))
+		}
+	}
+	return incidents, nil
+}
+
+// cloneIncident copies an incident held by MemoryStore, so callers cannot change it
+func cloneIncident(incident *Incident) Incident {
+	clone := *incident
+	clone.Updates = slices.Clone(incident.Updates)
+	return clone
+}
+
+func (m *MemoryStore) SetProviderKey(ctx context.Context, userId string, key ProviderKey) (ProviderKey, error) {
+	m.mu.Lock()
+	key.UpdatedAt = time.Now()
+	m.providerKeys[userId] = key
+	m.mu.Unlock()
+	return m.GetProviderKey(ctx, userId)
+}
+
+func (m *MemoryStore) GetProviderKey(ctx context.Context, userId string) (ProviderKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.providerKeys[userId]
+	if !ok {
+		return ProviderKey{}, errors.New("provider key not found")
+	}
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	key.GenerationsToday, key.GenerationsThisMonth = 0, 0
+	for _, at := range m.providerKeyUses[userId] {
+		if !at.Before(today) {
+			key.GenerationsToday++
+		}
+		if !at.Before(month) {
+			key.GenerationsThisMonth++
+		}
+	}
+	key.Encrypted = slices.Clone(key.Encrypted)
+	return key, nil
+}
+
+func (m *MemoryStore) DeleteProviderKey(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.providerKeys[userId]; !ok {
+		return errors.New("provider key not found")
+	}
+	delete(m.providerKeys, userId)
+	return nil
+}
+
+func (m *MemoryStore) RecordProviderKeyGeneration(ctx context.Context, userId, provider string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providerKeyUses[userId] = append(m.providerKeyUses[userId], time.Now().UTC())
+	return nil
+}
+
+func (m *MemoryStore) CreatePromptPreset(ctx context.Context, preset PromptPreset) (PromptPreset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextPromptPresetId++
+	preset.ID = m.nextPromptPresetId
+	preset.CreatedAt = time.Now()
+	preset.UpdatedAt = preset.CreatedAt
+	m.promptPresets = append(m.promptPresets, preset)
+	return m.promptPreset(preset), nil
+}
+
+func (m *MemoryStore) UpdatePromptPreset(ctx context.Context, preset PromptPreset) (PromptPreset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.promptPresets {
+		if existing.ID == preset.ID && existing.UserID == preset.UserID {
+			existing.Name, existing.Template, existing.Public = preset.Name, preset.Template, preset.Public
+			existing.UpdatedAt = time.Now()
+			m.promptPresets[i] = existing
+			return m.promptPreset(existing), nil
+		}
+	}
+	return PromptPreset{}, errors.New("prompt preset not found")
+}
+
+func (m *MemoryStore) DeletePromptPreset(ctx context.Context, id int, userId string, asAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, preset := range m.promptPresets {
+		if preset.ID == id && (preset.UserID == userId || asAdmin) {
+			m.promptPresets = append(m.promptPresets[:i], m.promptPresets[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("prompt preset not found")
+}
+
+func (m *MemoryStore) GetPromptPreset(ctx context.Context, id int, userId string) (PromptPreset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, preset := range m.promptPresets {
+		if preset.ID == id && (preset.UserID == userId || preset.Public) {
+			return m.promptPreset(preset), nil
+		}
+	}
+	return PromptPreset{}, errors.New("prompt preset not found")
+}
+
+func (m *MemoryStore) ListPromptPresets(ctx context.Context, userId string, limit, offset int) ([]PromptPreset, int, error) {
+	return m.listPromptPresets(func(preset PromptPreset) bool { return preset.UserID == userId }, limit, offset)
+}
+
+func (m *MemoryStore) ListPublicPromptPresets(ctx context.Context, limit, offset int) ([]PromptPreset, int, error) {
+	return m.listPromptPresets(func(preset PromptPreset) bool { return preset.Public }, limit, offset)
+}
+
+// listPromptPresets returns a page of the presets matching keep, newest first, and how many match
+func (m *MemoryStore) listPromptPresets(keep func(PromptPreset) bool, limit, offset int) ([]PromptPreset, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matching []PromptPreset
+	for i := len(m.promptPresets) - 1; i >= 0; i-- {
+		if keep(m.promptPresets[i]) {
+			matching = append(matching, m.promptPresets[i])
+		}
+	}
+	page := []PromptPreset{}
+	for i := offset; i < len(matching) && len(page) < limit; i++ {
+		page = append(page, m.promptPreset(matching[i]))
+	}
+	return page, len(matching), nil
+}
+
+// promptPreset returns a stored preset as it is read back, with its owner's current username and
+// its placeholders. The caller must hold mu.
+func (m *MemoryStore) promptPreset(preset PromptPreset) PromptPreset {
+	preset.Username = m.users[preset.UserID].Username
+	preset.Placeholders = PromptPlaceholders(preset.Template)
+	return preset
+}
+
+func (m *MemoryStore) CreateCollection(ctx context.Context, collection Collection) (Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextCollectionId++
+	collection.ID = m.nextCollectionId
+	collection.CreatedAt = time.Now()
+	collection.UpdatedAt = collection.CreatedAt
+	collection.AnimationIDs = append([]string{}, collection.AnimationIDs...)
+	m.collectionAdded[collection.ID] = map[string]time.Time{}
+	m.addCollectionAnimations(collection)
+	m.collections = append(m.collections, collection)
+	return m.collection(collection), nil
+}
+
+func (m *MemoryStore) UpdateCollection(ctx context.Context, collection Collection) (Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.collections {
+		if existing.ID == collection.ID && existing.UserID == collection.UserID {
+			existing.Title, existing.Description, existing.Public = collection.Title, collection.Description, collection.Public
+			existing.AnimationIDs = append([]string{}, collection.AnimationIDs...)
+			existing.UpdatedAt = time.Now()
+			m.addCollectionAnimations(existing)
+			m.collections[i] = existing
+			return m.collection(existing), nil
+		}
+	}
+	return Collection{}, errors.New("collection not found")
+}
+
+// addCollectionAnimations records when the animations new to a collection were added, forgetting
+// the ones it no longer holds. The caller must hold mu.
+func (m *MemoryStore) addCollectionAnimations(collection Collection) {
+	added := map[string]time.Time{}
+	for _, id := range collection.AnimationIDs {
+		at, ok := m.collectionAdded[collection.ID][id]
+		if !ok {
+			at = time.Now()
+		}
+		added[id] = at
+	}
+	m.collectionAdded[collection.ID] = added
+}
+
+func (m *MemoryStore) DeleteCollection(ctx context.Context, id int, userId string, asAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, collection := range m.collections {
+		if collection.ID == id && (collection.UserID == userId || asAdmin) {
+			m.collections = append(m.collections[:i], m.collections[i+1:]...)
+			delete(m.collectionAdded, id)
+			return nil
+		}
+	}
+	return errors.New("collection not found")
+}
+
+func (m *MemoryStore) GetCollection(ctx context.Context, id int, userId string) (Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, collection := range m.collections {
+		if collection.ID == id && (collection.UserID == userId || collection.Public) {
+			return m.collection(collection), nil
+		}
+	}
+	return Collection{}, errors.New("collection not found")
+}
+
+func (m *MemoryStore) ListCollections(ctx context.Context, userId string, limit, offset int) ([]Collection, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matching []Collection
+	for i := len(m.collections) - 1; i >= 0; i-- {
+		if m.collections[i].UserID == userId {
+			matching = append(matching, m.collections[i])
+		}
+	}
+	page := []Collection{}
+	for i := offset; i < len(matching) && len(page) < limit; i++ {
+		page = append(page, m.collection(matching[i]))
+	}
+	return page, len(matching), nil
+}
+
+func (m *MemoryStore) ListCollectionAnimations(ctx context.Context, id, limit, offset int) ([]CollectionAnimation, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var collection *Collection
+	for i := range m.collections {
+		if m.collections[i].ID == id {
+			collection = &m.collections[i]
+		}
+	}
+	if collection == nil {
+		return []CollectionAnimation{}, 0, nil
+	}
+	ids := m.collection(*collection).AnimationIDs
+	page := []CollectionAnimation{}
+	for i := offset; i < len(ids) && len(page) < limit; i++ {
+		animation := m.animation(ids[i])
+		page = append(page, CollectionAnimation{ID: animation.id, Description: animation.description, AddedAt: m.collectionAdded[id][ids[i]]})
+	}
+	return page, len(ids), nil
+}
+
+// collection returns a stored collection as it is read back, with its owner's current username
+// and without the animations deleted since. The caller must hold mu.
+func (m *MemoryStore) collection(collection Collection) Collection {
+	collection.Username = m.users[collection.UserID].Username
+	ids := []string{}
+	for _, id := range collection.AnimationIDs {
+		if m.animation(id) != nil {
+			ids = append(ids, id)
+		}
+	}
+	collection.AnimationIDs = ids
+	return collection
+}
+
+func (m *MemoryStore) CreateOrganization(ctx context.Context, name, ownerId string) (Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userOrganization(ownerId) != nil {
+		return Organization{}, errors.New("already in an organization")
+	}
+	m.nextOrganizationId++
+	now := time.Now()
+	org := &Organization{ID: m.nextOrganizationId, Name: name, OwnerID: ownerId, CreatedAt: now}
+	org.Members = []OrganizationMember{{UserID: ownerId, Role: OrgRoleOwner, JoinedAt: now}}
+	m.organizations[org.ID] = org
+	return m.organization(org), nil
+}
+
+func (m *MemoryStore) GetOrganization(ctx context.Context, id int) (Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return Organization{}, errors.New("organization not found")
+	}
+	return m.organization(org), nil
+}
+
+func (m *MemoryStore) GetUserOrganization(ctx context.Context, userId string) (Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org := m.userOrganization(userId)
+	if org == nil {
+		return Organization{}, errors.New("organization not found")
+	}
+	return m.organization(org), nil
+}
+
+func (m *MemoryStore) DeleteOrganization(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.organizations[id]; !ok {
+		return errors.New("organization not found")
+	}
+	delete(m.organizations, id)
+	m.organizationUses = slices.DeleteFunc(m.organizationUses, func(use memoryOrganizationUse) bool {
+		return use.organizationId == id
+	})
+	m.deleteTeamIntegrations(func(integration TeamIntegration) bool { return integration.OrganizationID == id })
+	for _, animation := range m.animations {
+		if animation.review != nil && animation.review.OrganizationID == id {
+			animation.review = nil
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetOrganizationCredits(ctx context.Context, id, monthlyCredits int) (Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return Organization{}, errors.New("organization not found")
+	}
+	org.MonthlyCredits = monthlyCredits
+	return m.organization(org), nil
+}
+
+func (m *MemoryStore) AddOrganizationMember(ctx context.Context, id int, userId string, monthlyLimit int) (OrganizationMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return OrganizationMember{}, errors.New("organization not found")
+	}
+	if m.userOrganization(userId) != nil {
+		return OrganizationMember{}, errors.New("already in an organization")
+	}
+	member := OrganizationMember{UserID: userId, Role: OrgRoleMember, MonthlyLimit: monthlyLimit, JoinedAt: time.Now()}
+	org.Members = append(org.Members, member)
+	member.Username = m.users[userId].Username
+	return member, nil
+}
+
+func (m *MemoryStore) SetOrganizationMemberLimit(ctx context.Context, id int, userId string, monthlyLimit int) (OrganizationMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if org, ok := m.organizations[id]; ok {
+		for i, member := range org.Members {
+			if member.UserID == userId {
+				org.Members[i].MonthlyLimit = monthlyLimit
+				member.MonthlyLimit = monthlyLimit
+				member.Username = m.users[userId].Username
+				return member, nil
+			}
+		}
+	}
+	return OrganizationMember{}, errors.New("organization member not found")
+}
+
+func (m *MemoryStore) RemoveOrganizationMember(ctx context.Context, id int, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if org, ok := m.organizations[id]; ok {
+		for i, member := range org.Members {
+			if member.UserID == userId {
+				org.Members = append(org.Members[:i], org.Members[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return errors.New("organization member not found")
+}
+
+func (m *MemoryStore) ReserveOrganizationGeneration(ctx context.Context, id int, userId string) (GenerationQuota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return GenerationQuota{}, errors.New("organization not found")
+	}
+	memberLimit := -1
+	for _, member := range org.Members {
+		if member.UserID == userId {
+			memberLimit = member.MonthlyLimit
+		}
+	}
+	if memberLimit < 0 {
+		return GenerationQuota{}, errors.New("organization member not found")
+	}
+
+	now := time.Now().UTC()
+	used, usedBy := m.organizationUsage(id, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+	quota, err := checkOrganizationReservation(org.MonthlyCredits, used+1, memberLimit, usedBy[userId]+1)
+	if err != nil {
+		return quota, err
+	}
+	m.organizationUses = append(m.organizationUses, memoryOrganizationUse{organizationId: id, userId: userId, at: now})
+	return quota, nil
+}
+
+func (m *MemoryStore) ReleaseOrganizationGeneration(ctx context.Context, id int, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for i := len(m.organizationUses) - 1; i >= 0; i-- {
+		use := m.organizationUses[i]
+		if use.organizationId == id && use.userId == userId && !use.at.Before(today) {
+			m.organizationUses = append(m.organizationUses[:i], m.organizationUses[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetOrganizationUsage(ctx context.Context, id int, month time.Time) (OrganizationUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return OrganizationUsage{}, errors.New("organization not found")
+	}
+	used, usedBy := m.organizationUsage(id, month)
+	return newOrganizationUsage(m.organization(org), month, used, usedBy), nil
+}
+
+// organizationUsage counts the generations drawn on a workspace's credits in the month starting at
+// month, in total and by user. The caller must hold mu.
+func (m *MemoryStore) organizationUsage(id int, month time.Time) (int, map[string]int) {
+	used, usedBy := 0, map[string]int{}
+	end := month.AddDate(0, 1, 0)
+	for _, use := range m.organizationUses {
+		if use.organizationId == id && !use.at.Before(month) && use.at.Before(end) {
+			used++
+			usedBy[use.userId]++
+		}
+	}
+	return used, usedBy
+}
+
+// userOrganization returns the workspace the user belongs to, or nil. The caller must hold mu.
+func (m *MemoryStore) userOrganization(userId string) *Organization {
+	for _, org := range m.organizations {
+		if org.HasMember(userId) {
+			return org
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetOrganizationReviewRequired(ctx context.Context, id int, required bool) (Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return Organization{}, errors.New("organization not found")
+	}
+	org.ReviewRequired = required
+	return m.organization(org), nil
+}
+
+// animationReview returns a copy of an animation's review with its current description and the
+// author's username. The caller must hold mu.
+func (m *MemoryStore) animationReview(animation *memoryAnimation) AnimationReview {
+	review := *animation.review
+	review.Description = animation.description
+	review.AuthorUsername = m.users[review.AuthorID].Username
+	return review
+}
+
+func (m *MemoryStore) GetAnimationReview(ctx context.Context, animationId string) (AnimationReview, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(animationId)
+	if animation == nil || animation.review == nil {
+		return AnimationReview{}, errors.New("animation review not found")
+	}
+	return m.animationReview(animation), nil
+}
+
+func (m *MemoryStore) ListAnimationReviews(ctx context.Context, filter AnimationReviewFilter, limit, offset int) ([]AnimationReview, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reviews := []AnimationReview{}
+	total := 0
+	// Animations are kept in the order they were saved, which is the order they were submitted
+	for _, animation := range m.animations {
+		review := animation.review
+		if review == nil || (filter.OrganizationID != 0 && review.OrganizationID != filter.OrganizationID) ||
+			(filter.AuthorID != "" && review.AuthorID != filter.AuthorID) || (filter.Status != "" && review.Status != filter.Status) {
+			continue
+		}
+		if total >= offset && len(reviews) < limit {
+			reviews = append(reviews, m.animationReview(animation))
+		}
+		total++
+	}
+	return reviews, total, nil
+}
+
+func (m *MemoryStore) DecideAnimationReview(ctx context.Context, animationId, status, reviewerId, note string) (AnimationReview, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(animationId)
+	if animation == nil || animation.review == nil {
+		return AnimationReview{}, errors.New("animation review not found")
+	}
+	if animation.review.Status != ReviewPending {
+		return AnimationReview{}, errors.New("animation review already decided")
+	}
+	now := time.Now()
+	animation.review.Status, animation.review.ReviewedBy, animation.review.ReviewedAt, animation.review.Note = status, reviewerId, &now, note
+	reason := note
+	if reason == "" {
+		reason = "Workspace review"
+	}
+	m.recordModerationAudit(moderationEntry(ctx, animationId, ModerationReview, ReviewPending, status, reason))
+	return m.animationReview(animation), nil
+}
+
+// organization returns a copy of a stored workspace with its members' current usernames. The
+// caller must hold mu.
+func (m *MemoryStore) organization(org *Organization) Organization {
+	clone := *org
+	clone.Members = slices.Clone(org.Members)
+	for i := range clone.Members {
+		clone.Members[i].Username = m.users[clone.Members[i].UserID].Username
+	}
+	return clone
+}
+
+func (m *MemoryStore) CreateSignageSchedule(ctx context.Context, schedule SignageSchedule) (SignageSchedule, error) {
+	id, err := generateRandomID()
+	if err != nil {
+		return SignageSchedule{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule.ID = id
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = schedule.CreatedAt
+	schedule.Slots = slices.Clone(schedule.Slots)
+	m.signageSchedules = append(m.signageSchedules, schedule)
+	return schedule, nil
+}
+
+func (m *MemoryStore) UpdateSignageSchedule(ctx context.Context, schedule SignageSchedule) (SignageSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.signageSchedules {
+		if existing.ID == schedule.ID && existing.UserID == schedule.UserID {
+			existing.Name, existing.Timezone = schedule.Name, schedule.Timezone
+			existing.Slots, existing.FallbackAnimationID = slices.Clone(schedule.Slots), schedule.FallbackAnimationID
+			existing.UpdatedAt = time.Now()
+			m.signageSchedules[i] = existing
+			return existing, nil
+		}
+	}
+	return SignageSchedule{}, errors.New("signage schedule not found")
+}
+
+func (m *MemoryStore) DeleteSignageSchedule(ctx context.Context, id, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, schedule := range m.signageSchedules {
+		if schedule.ID == id && schedule.UserID == userId {
+			m.signageSchedules = append(m.signageSchedules[:i], m.signageSchedules[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("signage schedule not found")
+}
+
+func (m *MemoryStore) GetSignageSchedule(ctx context.Context, id string) (SignageSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, schedule := range m.signageSchedules {
+		if schedule.ID == id {
+			schedule.Slots = slices.Clone(schedule.Slots)
+			return schedule, nil
+		}
+	}
+	return SignageSchedule{}, errors.New("signage schedule not found")
+}
+
+func (m *MemoryStore) ListSignageSchedules(ctx context.Context, userId string) ([]SignageSchedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedules := []SignageSchedule{}
+	for i := len(m.signageSchedules) - 1; i >= 0; i-- {
+		if schedule := m.signageSchedules[i]; schedule.UserID == userId {
+			schedule.Slots = slices.Clone(schedule.Slots)
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+// kioskToken returns a copy of a stored kiosk token that shares nothing with it
+func kioskToken(stored memoryKioskToken) KioskToken {
+	token := stored.token
+	token.ScheduleIDs = slices.Clone(token.ScheduleIDs)
+	return token
+}
+
+func (m *MemoryStore) CreateKioskToken(ctx context.Context, token KioskToken, tokenHash string) (KioskToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextKioskTokenId++
+	token.ID = m.nextKioskTokenId
+	token.CreatedAt = time.Now()
+	token.Token = ""
+	stored := memoryKioskToken{token: token, hash: tokenHash}
+	stored.token.ScheduleIDs = slices.Clone(token.ScheduleIDs)
+	m.kioskTokens = append(m.kioskTokens, stored)
+	return kioskToken(stored), nil
+}
+
+func (m *MemoryStore) ListKioskTokens(ctx context.Context) ([]KioskToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := []KioskToken{}
+	for i := len(m.kioskTokens) - 1; i >= 0; i-- {
+		tokens = append(tokens, kioskToken(m.kioskTokens[i]))
+	}
+	return tokens, nil
+}
+
+func (m *MemoryStore) GetKioskTokenByHash(ctx context.Context, tokenHash string) (KioskToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.kioskTokens {
+		if stored.hash == tokenHash {
+			return kioskToken(stored), nil
+		}
+	}
+	return KioskToken{}, errors.New("kiosk token not found")
+}
+
+func (m *MemoryStore) UpdateKioskToken(ctx context.Context, token KioskToken) (KioskToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, stored := range m.kioskTokens {
+		if stored.token.ID == token.ID {
+			stored.token.Name, stored.token.Feed = token.Name, token.Feed
+			stored.token.ScheduleIDs = slices.Clone(token.ScheduleIDs)
+			m.kioskTokens[i] = stored
+			return kioskToken(stored), nil
+		}
+	}
+	return KioskToken{}, errors.New("kiosk token not found")
+}
+
+func (m *MemoryStore) RevokeKioskToken(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, stored := range m.kioskTokens {
+		if stored.token.ID == id {
+			m.kioskTokens = append(m.kioskTokens[:i], m.kioskTokens[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("kiosk token not found")
+}
+
+func (m *MemoryStore) TouchKioskToken(ctx context.Context, id int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.kioskTokens {
+		if m.kioskTokens[i].token.ID == id {
+			m.kioskTokens[i].token.LastUsedAt = &at
+			return nil
+		}
+	}
+	return errors.New("kiosk token not found")
+}
+
+func (m *MemoryStore) CreateImpersonation(ctx context.Context, impersonation Impersonation) (Impersonation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	impersonation.ID = len(m.impersonations) + 1
+	impersonation.CreatedAt = time.Now()
+	impersonation.Token = ""
+	m.impersonations = append(m.impersonations, memoryImpersonation{impersonation: impersonation})
+	return impersonation, nil
+}
+
+func (m *MemoryStore) GetImpersonation(ctx context.Context, id int) (Impersonation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.impersonations) {
+		return Impersonation{}, errors.New("impersonation not found")
+	}
+	return m.impersonations[id-1].impersonation, nil
+}
+
+func (m *MemoryStore) GetImpersonationByTokenHash(ctx context.Context, tokenHash string) (Impersonation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.impersonations {
+		if stored.hash != "" && stored.hash == tokenHash {
+			return stored.impersonation, nil
+		}
+	}
+	return Impersonation{}, errors.New("impersonation not found")
+}
+
+func (m *MemoryStore) ListImpersonations(ctx context.Context, userId string, limit int) ([]Impersonation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	impersonations := []Impersonation{}
+	for i := len(m.impersonations) - 1; i >= 0 && len(impersonations) < limit; i-- {
+		if userId == "" || m.impersonations[i].impersonation.UserID == userId {
+			impersonations = append(impersonations, m.impersonations[i].impersonation)
+		}
+	}
+	return impersonations, nil
+}
+
+func (m *MemoryStore) TransitionImpersonation(ctx context.Context, id int, from []string, status string) (Impersonation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.impersonations) {
+		return Impersonation{}, errors.New("impersonation not found")
+	}
+	impersonation := &m.impersonations[id-1].impersonation
+	if !slices.Contains(from, impersonation.Status) {
+		return Impersonation{}, errors.New("impersonation status changed")
+	}
+	now := time.Now()
+	impersonation.Status = status
+	switch status {
+	case ImpersonationApproved, ImpersonationDenied:
+		impersonation.DecidedAt = &now
+	case ImpersonationEnded:
+		impersonation.EndedAt = &now
+	}
+	return *impersonation, nil
+}
+
+func (m *MemoryStore) StartImpersonation(ctx context.Context, id int, tokenHash string, expiresAt time.Time) (Impersonation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.impersonations) {
+		return Impersonation{}, errors.New("impersonation not found")
+	}
+	stored := &m.impersonations[id-1]
+	if stored.impersonation.Status != ImpersonationApproved {
+		return Impersonation{}, errors.New("impersonation status changed")
+	}
+	now := time.Now()
+	stored.hash = tokenHash
+	stored.impersonation.Status = ImpersonationActive
+	stored.impersonation.StartedAt, stored.impersonation.ExpiresAt = &now, &expiresAt
+	return stored.impersonation, nil
+}
+
+func (m *MemoryStore) RecordImpersonationAudit(ctx context.Context, entry ImpersonationAuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = int64(len(m.impersonationAudit) + 1)
+	entry.CreatedAt = time.Now()
+	m.impersonationAudit = append(m.impersonationAudit, entry)
+	return nil
+}
+
+func (m *MemoryStore) ListImpersonationAudit(ctx context.Context, id int) ([]ImpersonationAuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []ImpersonationAuditEntry{}
+	for _, entry := range m.impersonationAudit {
+		if entry.ImpersonationID == id {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) RecordGeneration(ctx context.Context, record GenerationRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record.CreatedAt = time.Now()
+	m.generations = append(m.generations, record)
+	return nil
+}
+
+// generationCosts adds up the generations made from from until before to, per user. The caller
+// must hold mu.
+func (m *MemoryStore) generationCosts(from, to time.Time) map[string]GenerationCosts {
+	costs := map[string]GenerationCosts{}
+	for _, record := range m.generations {
+		if (!from.IsZero() && record.CreatedAt.Before(from)) || (!to.IsZero() && !record.CreatedAt.Before(to)) {
+			continue
+		}
+		userCosts := costs[record.UserID]
+		userCosts.Generations++
+		userCosts.InputTokens += record.InputTokens
+		userCosts.OutputTokens += record.OutputTokens
+		userCosts.CostUSD += record.CostUSD
+		costs[record.UserID] = userCosts
+	}
+	return costs
+}
+
+func (m *MemoryStore) GetGenerationCosts(ctx context.Context, from, to time.Time, userId string) (GenerationCosts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var totals GenerationCosts
+	for user, costs := range m.generationCosts(from, to) {
+		if userId == "" || user == userId {
+			totals.Generations += costs.Generations
+			totals.InputTokens += costs.InputTokens
+			totals.OutputTokens += costs.OutputTokens
+			totals.CostUSD += costs.CostUSD
+		}
+	}
+	return totals, nil
+}
+
+func (m *MemoryStore) ListUserGenerationCosts(ctx context.Context, from, to time.Time, limit int) ([]UserGenerationCosts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := []UserGenerationCosts{}
+	for userId, costs := range m.generationCosts(from, to) {
+		users = append(users, UserGenerationCosts{UserID: userId, Username: m.users[userId].Username, GenerationCosts: costs})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CostUSD != users[j].CostUSD {
+			return users[i].CostUSD > users[j].CostUSD
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	return users[:min(limit, len(users))], nil
+}
+
+// teamIntegration returns the stored integration with the given ID. The caller must hold mu.
+func (m *MemoryStore) teamIntegration(id string) *TeamIntegration {
+	for i := range m.teamIntegrations {
+		if m.teamIntegrations[i].ID == id {
+			return &m.teamIntegrations[i]
+		}
+	}
+	return nil
+}
+
+// deleteTeamIntegrations deletes the integrations matching remove, with their posts and mood
+// signals, and reports whether there were any. The caller must hold mu.
+func (m *MemoryStore) deleteTeamIntegrations(remove func(TeamIntegration) bool) bool {
+	removed := map[string]bool{}
+	for _, integration := range m.teamIntegrations {
+		if remove(integration) {
+			removed[integration.ID] = true
+		}
+	}
+	m.teamIntegrations = slices.DeleteFunc(m.teamIntegrations, remove)
+	m.teamPosts = slices.DeleteFunc(m.teamPosts, func(post TeamPost) bool {
+		if removed[post.IntegrationID] {
+			delete(m.teamSignals, post.ID)
+		}
+		return removed[post.IntegrationID]
+	})
+	return len(removed) > 0
+}
+
+// teamIntegrationCopy returns a copy of a stored integration that shares nothing with it
+func teamIntegrationCopy(integration TeamIntegration) TeamIntegration {
+	if integration.NextPostAt != nil {
+		next := *integration.NextPostAt
+		integration.NextPostAt = &next
+	}
+	return integration
+}
+
+func (m *MemoryStore) SaveTeamIntegration(ctx context.Context, integration TeamIntegration) (TeamIntegration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.organizations[integration.OrganizationID]; !ok {
+		return TeamIntegration{}, errors.New("organization not found")
+	}
+	integration.EventsURL, integration.RelaySecret = "", ""
+	for i, stored := range m.teamIntegrations {
+		if stored.OrganizationID == integration.OrganizationID && stored.Platform == integration.Platform {
+			integration.ID, integration.CreatedBy, integration.CreatedAt = stored.ID, stored.CreatedBy, stored.CreatedAt
+			m.teamIntegrations[i] = teamIntegrationCopy(integration)
+			return teamIntegrationCopy(integration), nil
+		}
+	}
+	integration.CreatedAt = time.Now()
+	m.teamIntegrations = append(m.teamIntegrations, teamIntegrationCopy(integration))
+	return teamIntegrationCopy(integration), nil
+}
+
+func (m *MemoryStore) GetTeamIntegration(ctx context.Context, organizationId int, platform string) (TeamIntegration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, integration := range m.teamIntegrations {
+		if integration.OrganizationID == organizationId && integration.Platform == platform {
+			return teamIntegrationCopy(integration), nil
+		}
+	}
+	return TeamIntegration{}, errors.New("team integration not found")
+}
+
+func (m *MemoryStore) GetTeamIntegrationByID(ctx context.Context, id string) (TeamIntegration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if integration := m.teamIntegration(id); integration != nil {
+		return teamIntegrationCopy(*integration), nil
+	}
+	return TeamIntegration{}, errors.New("team integration not found")
+}
+
+func (m *MemoryStore) DeleteTeamIntegration(ctx context.Context, organizationId int, platform string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.deleteTeamIntegrations(func(integration TeamIntegration) bool {
+		return integration.OrganizationID == organizationId && integration.Platform == platform
+	}) {
+		return errors.New("team integration not found")
+	}
+	return nil
+}
+
+func (m *MemoryStore) ClaimDueTeamIntegrations(ctx context.Context, limit int) ([]TeamIntegration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var due []TeamIntegration
+	for i := range m.teamIntegrations {
+		integration := &m.teamIntegrations[i]
+		if len(due) == limit {
+			break
+		}
+		if integration.NextPostAt == nil || integration.NextPostAt.After(now) {
+			continue
+		}
+		held := now.Add(5 * time.Minute)
+		integration.NextPostAt = &held
+		due = append(due, teamIntegrationCopy(*integration))
+	}
+	return due, nil
+}
+
+func (m *MemoryStore) SetNextTeamPost(ctx context.Context, id string, nextAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if integration := m.teamIntegration(id); integration != nil {
+		integration.NextPostAt = &nextAt
+	}
+	return nil
+}
+
+func (m *MemoryStore) RecordTeamPost(ctx context.Context, post TeamPost) (TeamPost, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.teamIntegration(post.IntegrationID) == nil {
+		return TeamPost{}, errors.New("team integration not found")
+	}
+	m.nextTeamPostId++
+	post.ID = m.nextTeamPostId
+	post.PostedAt = time.Now()
+	post.Counts = nil
+	m.teamPosts = append(m.teamPosts, post)
+	return post, nil
+}
+
+func (m *MemoryStore) FindTeamPost(ctx context.Context, integrationId, messageId string, at time.Time, window time.Duration) (TeamPost, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found *TeamPost
+	for i, post := range m.teamPosts {
+		if post.IntegrationID != integrationId {
+			continue
+		}
+		if messageId != "" {
+			if post.MessageID == messageId {
+				return post, nil
+			}
+			continue
+		}
+		distance := post.PostedAt.Sub(at).Abs()
+		if distance <= window && (found == nil || distance < found.PostedAt.Sub(at).Abs()) {
+			found = &m.teamPosts[i]
+		}
+	}
+	if found == nil {
+		return TeamPost{}, errors.New("team post not found")
+	}
+	return *found, nil
+}
+
+func (m *MemoryStore) SetTeamMoodSignal(ctx context.Context, postId int, reactorHash string, mood Mood) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.teamSignals[postId] == nil {
+		m.teamSignals[postId] = map[string]Mood{}
+	}
+	m.teamSignals[postId][reactorHash] = mood
+	return nil
+}
+
+func (m *MemoryStore) RemoveTeamMoodSignal(ctx context.Context, postId int, reactorHash string, mood Mood) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.teamSignals[postId][reactorHash] == mood {
+		delete(m.teamSignals[postId], reactorHash)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListTeamPosts(ctx context.Context, integrationId string, limit int) ([]TeamPost, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	posts := []TeamPost{}
+	for i := len(m.teamPosts) - 1; i >= 0 && len(posts) < limit; i-- {
+		post := m.teamPosts[i]
+		if post.IntegrationID != integrationId {
+			continue
+		}
+		post.Counts = map[Mood]int{}
+		for _, mood := range m.teamSignals[post.ID] {
+			post.Counts[mood]++
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (m *MemoryStore) ListRefinementTurns(ctx context.Context, animationId, userId string, limit int) ([]RefinementTurn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation, err := m.ownedAnimation(animationId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(animation.refinements[max(len(animation.refinements)-limit, 0):]), nil
+}
+
+func (m *MemoryStore) AddRefinementTurns(ctx context.Context, animationId string, turns []RefinementTurn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(animationId)
+	if animation == nil {
+		return errors.New("animation not found")
+	}
+	now := time.Now()
+	for _, turn := range turns {
+		turn.CreatedAt = now
+		animation.refinements = append(animation.refinements, turn)
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateIntegrationKey(ctx context.Context, userId string, key IntegrationKey, keyHash string) (IntegrationKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextIntegrationKeyId++
+	key.ID = m.nextIntegrationKeyId
+	key.CreatedAt = time.Now()
+	key.Key = ""
+	m.integrationKeys = append(m.integrationKeys, memoryIntegrationKey{key: key, userId: userId, hash: keyHash})
+	return key, nil
+}
+
+func (m *MemoryStore) ListIntegrationKeys(ctx context.Context, userId string) ([]IntegrationKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []IntegrationKey{}
+	for i := len(m.integrationKeys) - 1; i >= 0; i-- {
+		if m.integrationKeys[i].userId == userId {
+			keys = append(keys, m.integrationKeys[i].key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MemoryStore) GetIntegrationKeyByHash(ctx context.Context, keyHash string) (IntegrationKey, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.integrationKeys {
+		if stored.hash == keyHash {
+			return stored.key, stored.userId, nil
+		}
+	}
+	return IntegrationKey{}, "", errors.New("integration key not found")
+}
+
+func (m *MemoryStore) DeleteIntegrationKey(ctx context.Context, id int, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, stored := range m.integrationKeys {
+		if stored.key.ID == id && stored.userId == userId {
+			m.integrationKeys = append(m.integrationKeys[:i], m.integrationKeys[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("integration key not found")
+}
+
+func (m *MemoryStore) TouchIntegrationKey(ctx context.Context, id int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.integrationKeys {
+		if m.integrationKeys[i].key.ID == id {
+			m.integrationKeys[i].key.LastUsedAt = &at
+			return nil
+		}
+	}
+	return errors.New("integration key not found")
+}
+
+func (m *MemoryStore) ListAnimationsAfter(ctx context.Context, userId string, cursor TriggerCursor, limit int) ([]UserAnimation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Animations are held oldest first, though ones saved in the same instant still need ordering by ID
+	var animations []UserAnimation
+	for _, animation := range m.animations {
+		if animation.userId == userId && cursor.Before(animation.createdAt, animation.id) {
+			animations = append(animations, UserAnimation{
+				GetAnimationResponse: m.response(animation),
+				RenderStatus:         animation.renderStatus,
+				Photosensitivity:     animation.photosensitivity,
+				CreatedAt:            animation.createdAt,
+			})
+		}
+	}
+	sort.SliceStable(animations, func(i, j int) bool {
+		return TriggerCursor{At: animations[i].CreatedAt, ID: animations[i].ID}.Before(animations[j].CreatedAt, animations[j].ID)
+	})
+	return triggerPage(animations, cursor, limit), nil
+}
+
+func (m *MemoryStore) ListMoodsAfter(ctx context.Context, userId string, cursor TriggerCursor, limit int) ([]MoodEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var moods []MoodEntry
+	for key, mood := range m.moods {
+		if key[0] != userId || !cursor.Before(mood.savedAt, key[1]) {
+			continue
+		}
+		entry := MoodEntry{AnimationID: key[1], Mood: Mood(mood.mood), CreatedAt: mood.savedAt}
+		if animation := m.animation(key[1]); animation != nil {
+			entry.AnimationDescription = animation.description
+		}
+		moods = append(moods, entry)
+	}
+	sort.Slice(moods, func(i, j int) bool {
+		return TriggerCursor{At: moods[i].CreatedAt, ID: moods[i].AnimationID}.Before(moods[j].CreatedAt, moods[j].AnimationID)
+	})
+	return triggerPage(moods, cursor, limit), nil
+}
+
+func (m *MemoryStore) EnqueueGenerationJob(ctx context.Context, job QueuedGeneration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	job.Attempts = 0
+	m.generationJobs = append(m.generationJobs, &memoryGenerationJob{
+		queued: job,
+		job:    GenerationJob{ID: job.ID, Status: GenerationQueued, CreatedAt: now, UpdatedAt: now},
+	})
+	return nil
+}
+
+func (m *MemoryStore) ClaimGenerationJobs(ctx context.Context, limit int) ([]QueuedGeneration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var claimed []QueuedGeneration
+	for _, stored := range m.generationJobs {
+		if len(claimed) == limit {
+			break
+		}
+		abandoned := stored.job.Status == GenerationGenerating && now.After(stored.claimedUntil)
+		if stored.job.Status != GenerationQueued && !abandoned {
+			continue
+		}
+		stored.queued.Attempts++
+		stored.job.Status, stored.job.UpdatedAt = GenerationGenerating, now
+		stored.claimedUntil = now.Add(generationJobClaimHold)
+		claimed = append(claimed, stored.queued)
+	}
+	return claimed, nil
+}
+
+// generationJob returns the job with the given ID. The caller must hold mu.
+func (m *MemoryStore) generationJob(id string) *memoryGenerationJob {
+	for _, stored := range m.generationJobs {
+		if stored.job.ID == id {
+			return stored
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CompleteGenerationJob(ctx context.Context, id string, result AnimationResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.generationJob(id)
+	if stored == nil {
+		return errors.New("generation job not found")
+	}
+	stored.job.Status, stored.job.Result, stored.job.UpdatedAt = GenerationDone, &result, time.Now()
+	return nil
+}
+
+func (m *MemoryStore) FailGenerationJob(ctx context.Context, id, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.generationJob(id)
+	if stored == nil {
+		return errors.New("generation job not found")
+	}
+	stored.job.Status, stored.job.Error, stored.job.UpdatedAt = GenerationFailed, message, time.Now()
+	return nil
+}
+
+func (m *MemoryStore) GetGenerationJob(ctx context.Context, id, userId string) (GenerationJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.generationJob(id)
+	if stored == nil || stored.queued.UserID != userId {
+		return GenerationJob{}, errors.New("generation job not found")
+	}
+	return stored.job, nil
+}
+
+func (m *MemoryStore) DeleteFinishedGenerationJobs(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.generationJobs[:0]
+	for _, stored := range m.generationJobs {
+		finished := stored.job.Status == GenerationDone || stored.job.Status == GenerationFailed
+		if !finished || !stored.job.UpdatedAt.Before(before) {
+			kept = append(kept, stored)
+		}
+	}
+	deleted := len(m.generationJobs) - len(kept)
+	m.generationJobs = kept
+	return deleted, nil
+}
+
+func (m *MemoryStore) CreateOAuthApp(ctx context.Context, userId string, app OAuthApp) (OAuthApp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	app.CreatedAt = time.Now()
+	app.RedirectURIs = slices.Clone(app.RedirectURIs)
+	m.oauthApps = append(m.oauthApps, memoryOAuthApp{app: app, userId: userId})
+	return app, nil
+}
+
+func (m *MemoryStore) ListOAuthApps(ctx context.Context, userId string) ([]OAuthApp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	apps := []OAuthApp{}
+	for i := len(m.oauthApps) - 1; i >= 0; i-- {
+		if m.oauthApps[i].userId == userId {
+			apps = append(apps, m.oauthApps[i].app)
+		}
+	}
+	return apps, nil
+}
+
+func (m *MemoryStore) GetOAuthApp(ctx context.Context, clientId string) (OAuthApp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.oauthApps {
+		if stored.app.ClientID == clientId {
+			return stored.app, nil
+		}
+	}
+	return OAuthApp{}, errors.New("oauth app not found")
+}
+
+func (m *MemoryStore) DeleteOAuthApp(ctx context.Context, clientId, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, stored := range m.oauthApps {
+		if stored.app.ClientID == clientId && stored.userId == userId {
+			m.oauthApps = append(m.oauthApps[:i], m.oauthApps[i+1:]...)
+			for hash, authorization := range m.oauthCodes {
+				if authorization.ClientID == clientId {
+					delete(m.oauthCodes, hash)
+				}
+			}
+			m.oauthTokens = slices.DeleteFunc(m.oauthTokens, func(stored memoryOAuthToken) bool {
+				return stored.token.ClientID == clientId
+			})
+			return nil
+		}
+	}
+	return errors.New("oauth app not found")
+}
+
+func (m *MemoryStore) SaveOAuthCode(ctx context.Context, codeHash string, authorization OAuthAuthorization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for hash, stored := range m.oauthCodes {
+		if !now.Before(stored.ExpiresAt) {
+			delete(m.oauthCodes, hash)
+		}
+	}
+	m.oauthCodes[codeHash] = authorization
+	return nil
+}
+
+func (m *MemoryStore) ConsumeOAuthCode(ctx context.Context, codeHash string) (OAuthAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	authorization, ok := m.oauthCodes[codeHash]
+	if !ok {
+		return OAuthAuthorization{}, errors.New("oauth code not found")
+	}
+	delete(m.oauthCodes, codeHash)
+	return authorization, nil
+}
+
+func (m *MemoryStore) CreateOAuthToken(ctx context.Context, token OAuthToken, accessHash, refreshHash string) (OAuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextOAuthTokenId++
+	token.ID = m.nextOAuthTokenId
+	token.CreatedAt = time.Now()
+	m.oauthTokens = append(m.oauthTokens, memoryOAuthToken{token: token, accessHash: accessHash, refreshHash: refreshHash})
+	return token, nil
+}
+
+func (m *MemoryStore) GetOAuthTokenByAccessHash(ctx context.Context, accessHash string) (OAuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.oauthTokens {
+		if stored.accessHash == accessHash {
+			return stored.token, nil
+		}
+	}
+	return OAuthToken{}, errors.New("oauth token not found")
+}
+
+func (m *MemoryStore) RotateOAuthToken(ctx context.Context, refreshHash, clientId string, token OAuthToken, accessHash, newRefreshHash string) (OAuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i, stored := range m.oauthTokens {
+		if stored.refreshHash == refreshHash && stored.token.ClientID == clientId && now.Before(stored.token.RefreshExpiresAt) {
+			stored.token.ExpiresAt, stored.token.RefreshExpiresAt = token.ExpiresAt, token.RefreshExpiresAt
+			stored.accessHash, stored.refreshHash = accessHash, newRefreshHash
+			m.oauthTokens[i] = stored
+			return stored.token, nil
+		}
+	}
+	return OAuthToken{}, errors.New("oauth token not found")
+}
+
+func (m *MemoryStore) RevokeOAuthToken(ctx context.Context, tokenHash, clientId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, stored := range m.oauthTokens {
+		if (stored.accessHash == tokenHash || stored.refreshHash == tokenHash) && stored.token.ClientID == clientId {
+			m.oauthTokens = append(m.oauthTokens[:i], m.oauthTokens[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("oauth token not found")
+}
+
+func (m *MemoryStore) ListOAuthGrants(ctx context.Context, userId string) ([]OAuthGrant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	grants := []OAuthGrant{}
+	byClient := make(map[string]int)
+	for _, stored := range m.oauthTokens {
+		if stored.token.UserID != userId || !now.Before(stored.token.RefreshExpiresAt) {
+			continue
+		}
+		i, ok := byClient[stored.token.ClientID]
+		if !ok {
+			var name string
+			for _, app := range m.oauthApps {
+				if app.app.ClientID == stored.token.ClientID {
+					name = app.app.Name
+				}
+			}
+			i = len(grants)
+			byClient[stored.token.ClientID] = i
+			grants = append(grants, OAuthGrant{ClientID: stored.token.ClientID, AppName: name, Scopes: []string{}, GrantedAt: stored.token.CreatedAt})
+		}
+		for _, scope := range stored.token.Scopes {
+			if !slices.Contains(grants[i].Scopes, scope) {
+				grants[i].Scopes = append(grants[i].Scopes, scope)
+			}
+		}
+		if stored.token.CreatedAt.Before(grants[i].GrantedAt) {
+			grants[i].GrantedAt = stored.token.CreatedAt
+		}
+	}
+	for i := range grants {
+		slices.Sort(grants[i].Scopes)
+	}
+	slices.SortStableFunc(grants, func(a, b OAuthGrant) int { return b.GrantedAt.Compare(a.GrantedAt) })
+	return grants, nil
+}
+
+func (m *MemoryStore) RevokeOAuthGrant(ctx context.Context, userId, clientId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.oauthTokens)
+	m.oauthTokens = slices.DeleteFunc(m.oauthTokens, func(stored memoryOAuthToken) bool {
+		return stored.token.UserID == userId && stored.token.ClientID == clientId
+	})
+	if len(m.oauthTokens) == before {
+		return errors.New("oauth grant not found")
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetCalendarFeedToken(ctx context.Context, userId, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calendarFeeds[userId] = tokenHash
+	return nil
+}
+
+func (m *MemoryStore) GetCalendarFeedUser(ctx context.Context, tokenHash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for userId, hash := range m.calendarFeeds {
+		if hash == tokenHash {
+			return userId, nil
+		}
+	}
+	return "", errors.New("calendar feed not found")
+}
+
+func (m *MemoryStore) DeleteCalendarFeedToken(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.calendarFeeds[userId]; !ok {
+		return errors.New("calendar feed not found")
+	}
+	delete(m.calendarFeeds, userId)
+	return nil
+}
+
+func (m *MemoryStore) SaveAnimation(ctx context.Context, code string, description string, userId string, p5Version string) (string, error) {
+	animationId, err := generateRandomID()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := &memoryAnimation{
+		id:           animationId,
+		userId:       userId,
+		code:         code,
+		description:  description,
+		renderStatus: RenderStatusUnchecked,
+		p5Version:    p5Version,
+		createdAt:    time.Now(),
+
+		photosensitivity: PhotosensitivityUnchecked,
+	}
+	animation.addVersion(VersionCreated, 0)
+	if org := m.userOrganization(userId); org != nil && org.ReviewRequired && !org.IsOwner(userId) {
+		animation.review = &AnimationReview{
+			AnimationID:    animationId,
+			OrganizationID: org.ID,
+			AuthorID:       userId,
+			Status:         ReviewPending,
+			SubmittedAt:    animation.createdAt,
+		}
+	}
+	m.animations = append(m.animations, animation)
+	return animationId, nil
+}
+
+func (m *MemoryStore) GetAnimation(ctx context.Context, id string) (GetAnimationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return GetAnimationResponse{}, errors.New("animation not found")
+	}
+	if animation.removed {
+		return GetAnimationResponse{}, errors.New("animation removed")
+	}
+	return m.response(animation), nil
+}
+
+func (m *MemoryStore) UpdateAnimation(ctx context.Context, id, userId string, update UpdateAnimationRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return errors.New("animation not found")
+	}
+	if animation.userId == "" || animation.userId != userId {
+		return errors.New("not the animation owner")
+	}
+	if animation.removed {
+		return errors.New("animation removed")
+	}
+
+	if update.Code != nil && *update.Code != animation.code {
+		// The new code is screened for flashing afresh
+		animation.code, animation.photosensitivity = *update.Code, PhotosensitivityUnchecked
+		animation.addVersion(VersionEdited, 0)
+	}
+	if update.Description != nil {
+		animation.description = *update.Description
+	}
+	if update.ChangeNote != "" {
+		// Newest first, as PostgresStore returns them
+		entry := ChangelogEntry{Note: update.ChangeNote, CreatedAt: time.Now()}
+		animation.changelog = append([]ChangelogEntry{entry}, animation.changelog...)
+	}
+	return nil
+}
+
+// addVersion records the animation's current code as its next version
+func (a *memoryAnimation) addVersion(source string, restoredFrom int) AnimationVersion {
+	version := AnimationVersion{Version: len(a.versions) + 1, Source: source, P5Version: a.p5Version, Code: a.code, CreatedAt: time.Now()}
+	if restoredFrom != 0 {
+		version.RestoredFrom = &restoredFrom
+	}
+	a.versions = append(a.versions, version)
+	return version
+}
+
+// ownedAnimation returns an animation userId owns. The caller must hold mu.
+func (m *MemoryStore) ownedAnimation(id, userId string) (*memoryAnimation, error) {
+	animation := m.animation(id)
+	if animation == nil {
+		return nil, errors.New("animation not found")
+	}
+	if animation.userId == "" || animation.userId != userId {
+		return nil, errors.New("not the animation owner")
+	}
+	return animation, nil
+}
+
+func (m *MemoryStore) ListAnimationVersions(ctx context.Context, id, userId string) ([]AnimationVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation, err := m.ownedAnimation(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	versions := []AnimationVersion{}
+	for i := len(animation.versions) - 1; i >= 0; i-- {
+		version := animation.versions[i]
+		version.Code = ""
+		version.Current = i == len(animation.versions)-1
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func (m *MemoryStore) GetAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation, err := m.ownedAnimation(id, userId)
+	if err != nil {
+		return AnimationVersion{}, err
+	}
+	if version < 1 || version > len(animation.versions) {
+		return AnimationVersion{}, errors.New("version not found")
+	}
+	result := animation.versions[version-1]
+	result.Current = version == len(animation.versions)
+	return result, nil
+}
+
+func (m *MemoryStore) RestoreAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation, err := m.ownedAnimation(id, userId)
+	if err != nil {
+		return AnimationVersion{}, err
+	}
+	if version < 1 || version > len(animation.versions) {
+		return AnimationVersion{}, errors.New("version not found")
+	}
+	earlier := animation.versions[version-1]
+	animation.code = earlier.Code
+	animation.p5Version = earlier.P5Version
+	animation.compat = nil
+	restored := animation.addVersion(VersionRestored, version)
+	restored.Current = true
+	return restored, nil
+}
+
+func (m *MemoryStore) DeleteAnimation(ctx context.Context, id, userId string, asAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, animation := range m.animations {
+		if animation.id != id {
+			continue
+		}
+		if !asAdmin && (animation.userId == "" || animation.userId != userId) {
+			return errors.New("not the animation owner")
+		}
+		if animation.userId != userId {
+			m.recordModerationAudit(moderationEntry(ctx, id, ModerationDeleted, visibilityState(animation.removed), VisibilityDeleted, "Deleted by an admin"))
+		}
+		m.animations = append(m.animations[:i], m.animations[i+1:]...)
+		for key := range m.moods {
+			if key[1] == id {
+				delete(m.moods, key)
+			}
+		}
+		comments := m.comments[:0]
+		for _, comment := range m.comments {
+			if comment.AnimationID != id {
+				comments = append(comments, comment)
+			}
+		}
+		m.comments = comments
+		exports := m.exports[:0]
+		for _, stored := range m.exports {
+			if stored.export.AnimationID != id {
+				exports = append(exports, stored)
+			}
+		}
+		m.exports = exports
+		return nil
+	}
+	return errors.New("animation not found")
+}
+
+func (m *MemoryStore) GetAnimationChangelog(ctx context.Context, id string) ([]ChangelogEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return nil, errors.New("animation not found")
+	}
+	return append([]ChangelogEntry{}, animation.changelog...), nil
+}
+
+func (m *MemoryStore) SaveP5Compatibility(ctx context.Context, id string, matrix []P5Compatibility) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if animation := m.animation(id); animation != nil {
+		animation.compat = append([]P5Compatibility{}, matrix...)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetP5Compatibility(ctx context.Context, id string) ([]P5Compatibility, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return nil, errors.New("animation not found")
+	}
+	return append([]P5Compatibility{}, animation.compat...), nil
+}
+
+func (m *MemoryStore) ListUserAnimations(ctx context.Context, userId string, limit, offset int) ([]UserAnimation, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Animations are held oldest first
+	animations, total := make([]UserAnimation, 0, limit), 0
+	for i := len(m.animations) - 1; i >= 0; i-- {
+		animation := m.animations[i]
+		if animation.userId != userId {
+			continue
+		}
+		if total >= offset && len(animations) < limit {
+			animations = append(animations, UserAnimation{
+				GetAnimationResponse: m.response(animation),
+				RenderStatus:         animation.renderStatus,
+				Photosensitivity:     animation.photosensitivity,
+				CreatedAt:            animation.createdAt,
+			})
+		}
+		total++
+	}
+	return animations, total, nil
+}
+
+// previewFramesKey identifies a set of preview frames held by MemoryStore
+func previewFramesKey(codeHash string, count int) string {
+	return codeHash + "/" + strconv.Itoa(count)
+}
+
+func (m *MemoryStore) GetPreviewFrames(ctx context.Context, codeHash string, count int) ([]PreviewFrame, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]PreviewFrame{}, m.previewFrames[previewFramesKey(codeHash, count)]...), nil
+}
+
+func (m *MemoryStore) SavePreviewFrames(ctx context.Context, codeHash string, frames []PreviewFrame) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.previewFrames[previewFramesKey(codeHash, len(frames))] = append([]PreviewFrame{}, frames...)
+	return nil
+}
+
+func (m *MemoryStore) AnimationExists(ctx context.Context, id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.animation(id) != nil
+}
+
+func (m *MemoryStore) GetRandomAnimation(ctx context.Context, filter FeedFilter) (GetAnimationResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eligible := make([]*memoryAnimation, 0, len(m.animations))
+	for _, animation := range m.animations {
+		if inFeed(animation, filter) {
+			eligible = append(eligible, animation)
+		}
+	}
+	if len(eligible) == 0 {
+		return GetAnimationResponse{}, errors.New("no animations found")
+	}
+
+	return m.response(eligible[rand.Intn(len(eligible))]), nil
+}
+
+func (m *MemoryStore) ListFeedAnimationIDs(ctx context.Context, filter FeedFilter, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, limit)
+	for _, i := range rand.Perm(len(m.animations)) {
+		if len(ids) == limit {
+			break
+		}
+		if animation := m.animations[i]; inFeed(animation, filter) {
+			ids = append(ids, animation.id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MemoryStore) ListFeedAnimations(ctx context.Context, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Animations are held oldest first
+	animations, total := make([]GetAnimationResponse, 0, limit), 0
+	for i := len(m.animations) - 1; i >= 0; i-- {
+		animation := m.animations[i]
+		if !inFeed(animation, filter) {
+			continue
+		}
+		if total >= offset && len(animations) < limit {
+			animations = append(animations, m.response(animation))
+		}
+		total++
+	}
+	return animations, total, nil
+}
+
+// SearchAnimations matches animations whose description contains a word starting with each word of
+// query, ranking them by how many words match. It approximates PostgreSQL's stemming for tests.
+func (m *MemoryStore) SearchAnimations(ctx context.Context, query string, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := searchTerms(query)
+	type match struct {
+		animation *memoryAnimation
+		rank      int
+	}
+	var matches []match
+	// Animations are held oldest first, so newest comes first among equal ranks
+	for i := len(m.animations) - 1; i >= 0; i-- {
+		animation := m.animations[i]
+		if !inFeed(animation, filter) || len(terms) == 0 {
+			continue
+		}
+		words, rank := searchTerms(animation.description), 0
+		for _, term := range terms {
+			hits := 0
+			for _, word := range words {
+				if strings.HasPrefix(word, term) {
+					hits++
+				}
+			}
+			if hits == 0 {
+				rank = 0
+				break
+			}
+			rank += hits
+		}
+		if rank > 0 {
+			matches = append(matches, match{animation: animation, rank: rank})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].rank > matches[j].rank })
+
+	animations := make([]GetAnimationResponse, 0, limit)
+	for i := offset; i < len(matches) && len(animations) < limit; i++ {
+		animations = append(animations, m.response(matches[i].animation))
+	}
+	return animations, len(matches), nil
+}
+
+// searchTerms splits text into lower-case words
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (m *MemoryStore) SetAnimationPhotosensitivity(ctx context.Context, id string, report PhotosensitivityReport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return errors.New("animation not found")
+	}
+	if animation.photosensitivity != report.Status {
+		m.recordModerationAudit(moderationEntry(ctx, id, ModerationPhotosensitivity, animation.photosensitivity, report.Status, "Photosensitivity screening"))
+	}
+	animation.photosensitivity, animation.motionScore = report.Status, report.MotionScore
+	return nil
+}
+
+func (m *MemoryStore) SetAnimationRenderStatus(ctx context.Context, id string, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return errors.New("animation not found")
+	}
+	if animation.renderStatus != status {
+		m.recordModerationAudit(moderationEntry(ctx, id, ModerationRenderStatus, animation.renderStatus, status, "Determinism check"))
+	}
+	animation.renderStatus = status
+	return nil
+}
+
+func (m *MemoryStore) GetAnimationIDsByRenderStatus(ctx context.Context, status string, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, limit)
+	for _, animation := range m.animations {
+		if len(ids) == limit {
+			break
+		}
+		if animation.renderStatus == status {
+			ids = append(ids, animation.id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MemoryStore) SaveMood(ctx context.Context, userId string, animationId string, mood string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.moods[[2]string{userId, animationId}] = memoryMood{mood: mood, savedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryStore) ListMoods(ctx context.Context, userId string, from, to time.Time, limit, offset int) ([]MoodEntry, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matching []MoodEntry
+	for key, mood := range m.moods {
+		if key[0] != userId || (!from.IsZero() && mood.savedAt.Before(from)) || (!to.IsZero() && !mood.savedAt.Before(to)) {
+			continue
+		}
+		entry := MoodEntry{AnimationID: key[1], Mood: Mood(mood.mood), CreatedAt: mood.savedAt}
+		if animation := m.animation(key[1]); animation != nil {
+			entry.AnimationDescription = animation.description
+		}
+		matching = append(matching, entry)
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if !matching[i].CreatedAt.Equal(matching[j].CreatedAt) {
+			return matching[i].CreatedAt.After(matching[j].CreatedAt)
+		}
+		return matching[i].AnimationID < matching[j].AnimationID
+	})
+	page := []MoodEntry{}
+	for i := offset; i < len(matching) && len(page) < limit; i++ {
+		page = append(page, matching[i])
+	}
+	return page, len(matching), nil
+}
+
+func (m *MemoryStore) GetMoodCounts(ctx context.Context, animationIds []string) (map[string]map[Mood]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := map[string]bool{}
+	for _, id := range animationIds {
+		wanted[id] = true
+	}
+	counts := map[string]map[Mood]int{}
+	for key, mood := range m.moods {
+		if !wanted[key[1]] {
+			continue
+		}
+		if counts[key[1]] == nil {
+			counts[key[1]] = map[Mood]int{}
+		}
+		counts[key[1]][Mood(mood.mood)]++
+	}
+	return counts, nil
+}
+
+func (m *MemoryStore) SaveP5Library(ctx context.Context, library P5Library) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.p5Libraries {
+		if existing.Version == library.Version {
+			return errors.New("p5.js version already registered")
+		}
+	}
+	library.CreatedAt = time.Now()
+	m.p5Libraries = append([]P5Library{library}, m.p5Libraries...)
+	return nil
+}
+
+func (m *MemoryStore) GetP5Library(ctx context.Context, version string) (P5Library, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, library := range m.p5Libraries {
+		if library.Version == version {
+			return library, nil
+		}
+	}
+	return P5Library{}, errors.New("p5.js version not found")
+}
+
+func (m *MemoryStore) ListP5Libraries(ctx context.Context) ([]P5Library, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]P5Library{}, m.p5Libraries...), nil
+}
+
+// Mood returns the mood a user recorded for an animation, if any
+func (m *MemoryStore) Mood(userId, animationId string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mood, ok := m.moods[[2]string{userId, animationId}]
+	return mood.mood, ok
+}
+
+func (m *MemoryStore) GetAccountType(ctx context.Context, userId string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userId]; !ok {
+		return "", errors.New("user not found")
+	}
+	if accountType, ok := m.accountTypes[userId]; ok {
+		return accountType, nil
+	}
+	return AccountPersonal, nil
+}
+
+func (m *MemoryStore) SetAccountType(ctx context.Context, userId, accountType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userId]; !ok {
+		return errors.New("user not found")
+	}
+	m.accountTypes[userId] = accountType
+	return nil
+}
+
+// clientLink returns the client link with the given ID, with current usernames. The caller must hold mu.
+func (m *MemoryStore) clientLink(id int) (*memoryClientLink, ClientLink, bool) {
+	for _, stored := range m.clientLinks {
+		if stored.link.ID == id {
+			link := stored.link
+			link.ProfessionalName = m.users[link.ProfessionalID].Username
+			link.ClientName = m.users[link.ClientID].Username
+			return stored, link, true
+		}
+	}
+	return nil, ClientLink{}, false
+}
+
+func (m *MemoryStore) CreateClientInvite(ctx context.Context, professionalId, email, tokenHash string, expiresAt time.Time) (ClientLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := &memoryClientLink{
+		link: ClientLink{
+			ID:             len(m.clientLinks) + 1,
+			ProfessionalID: professionalId,
+			InviteEmail:    email,
+			Status:         ClientLinkInvited,
+			CreatedAt:      time.Now(),
+		},
+		tokenHash:       tokenHash,
+		inviteExpiresAt: expiresAt,
+	}
+	m.clientLinks = append(m.clientLinks, stored)
+	_, link, _ := m.clientLink(stored.link.ID)
+	return link, nil
+}
+
+func (m *MemoryStore) AcceptClientInvite(ctx context.Context, tokenHash, clientId string, shareMoodTrends bool) (ClientLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var invite *memoryClientLink
+	for _, stored := range m.clientLinks {
+		if stored.tokenHash != "" && stored.tokenHash == tokenHash && stored.link.Status == ClientLinkInvited &&
+			time.Now().Before(stored.inviteExpiresAt) {
+			invite = stored
+		}
+	}
+	if invite == nil || !strings.EqualFold(m.users[clientId].Email, invite.link.InviteEmail) {
+		return ClientLink{}, errors.New("invite is invalid or expired")
+	}
+	if invite.link.ProfessionalID == clientId {
+		return ClientLink{}, errors.New("cannot link to yourself")
+	}
+	for _, stored := range m.clientLinks {
+		if stored.link.ProfessionalID == invite.link.ProfessionalID && stored.link.ClientID == clientId && stored.link.Status == ClientLinkActive {
+			return ClientLink{}, errors.New("client already linked")
+		}
+	}
+
+	now := time.Now()
+	invite.link.ClientID = clientId
+	invite.link.Status = ClientLinkActive
+	invite.link.ShareMoodTrends = shareMoodTrends
+	invite.link.AcceptedAt = &now
+	invite.tokenHash = ""
+	_, link, _ := m.clientLink(invite.link.ID)
+	return link, nil
+}
+
+func (m *MemoryStore) GetClientLink(ctx context.Context, id int) (ClientLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, link, ok := m.clientLink(id)
+	if !ok {
+		return ClientLink{}, errors.New("client link not found")
+	}
+	return link, nil
+}
+
+// listClientLinks returns the client links that match, newest first. The caller must hold mu.
+func (m *MemoryStore) listClientLinks(match func(ClientLink) bool) []ClientLink {
+	links := []ClientLink{}
+	for i := len(m.clientLinks) - 1; i >= 0; i-- {
+		if _, link, _ := m.clientLink(m.clientLinks[i].link.ID); match(link) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func (m *MemoryStore) ListProfessionalClients(ctx context.Context, professionalId string) ([]ClientLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listClientLinks(func(link ClientLink) bool { return link.ProfessionalID == professionalId }), nil
+}
+
+func (m *MemoryStore) ListClientProfessionals(ctx context.Context, clientId string) ([]ClientLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listClientLinks(func(link ClientLink) bool { return link.ClientID == clientId }), nil
+}
+
+func (m *MemoryStore) SetMoodTrendConsent(ctx context.Context, linkId int, share bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, _, ok := m.clientLink(linkId)
+	if !ok || stored.link.Status != ClientLinkActive {
+		return errors.New("client link not active")
+	}
+	stored.link.ShareMoodTrends = share
+	return nil
+}
+
+func (m *MemoryStore) EndClientLink(ctx context.Context, linkId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, _, ok := m.clientLink(linkId); ok && stored.link.Status != ClientLinkEnded {
+		now := time.Now()
+		stored.link.Status = ClientLinkEnded
+		stored.link.EndedAt = &now
+		stored.link.ShareMoodTrends = false
+		stored.tokenHash = ""
+	}
+	return nil
+}
+
+func (m *MemoryStore) AssignSession(ctx context.Context, linkId int, animationId, note string) (SessionAssignment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(animationId)
+	if animation == nil {
+		return SessionAssignment{}, errors.New("animation not found")
+	}
+	session := SessionAssignment{
+		ID:          len(m.sessions) + 1,
+		LinkID:      linkId,
+		AnimationID: animationId,
+		Description: animation.description,
+		Note:        note,
+		CreatedAt:   time.Now(),
+	}
+	m.sessions = append(m.sessions, session)
+	return session, nil
+}
+
+// listSessions returns the sessions that match, newest first, skipping deleted animations. The caller must hold mu.
+func (m *MemoryStore) listSessions(match func(SessionAssignment) bool) []SessionAssignment {
+	sessions := []SessionAssignment{}
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		if session := m.sessions[i]; m.animation(session.AnimationID) != nil && match(session) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+func (m *MemoryStore) ListLinkSessions(ctx context.Context, linkId int) ([]SessionAssignment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listSessions(func(session SessionAssignment) bool { return session.LinkID == linkId }), nil
+}
+
+func (m *MemoryStore) ListClientSessions(ctx context.Context, clientId string) ([]SessionAssignment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listSessions(func(session SessionAssignment) bool {
+		_, link, ok := m.clientLink(session.LinkID)
+		return ok && link.ClientID == clientId && link.Status == ClientLinkActive
+	}), nil
+}
+
+func (m *MemoryStore) GetMoodTrends(ctx context.Context, userId string, since time.Time) ([]MoodTrend, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trends := []MoodTrend{}
+	for key, mood := range m.moods {
+		if key[0] == userId && !mood.savedAt.Before(since) {
+			trends = addMoodCount(trends, weekStart(mood.savedAt), Mood(mood.mood), 1)
+		}
+	}
+	return trends, nil
+}
+
+func (m *MemoryStore) RecordProfessionalAudit(ctx context.Context, linkId int, actorId, action string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := ProfessionalAuditEntry{ActorID: actorId, Action: action, CreatedAt: time.Now()}
+	// Newest first, as PostgresStore returns them
+	m.audit[linkId] = append([]ProfessionalAuditEntry{entry}, m.audit[linkId]...)
+	return nil
+}
+
+func (m *MemoryStore) ListProfessionalAudit(ctx context.Context, linkId int) ([]ProfessionalAuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ProfessionalAuditEntry{}, m.audit[linkId]...), nil
+}
+
+func (m *MemoryStore) ListDatasetAnimations(ctx context.Context) ([]DatasetAnimation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	animations := make([]DatasetAnimation, 0, len(m.animations))
+	for _, animation := range m.animations {
+		entry := DatasetAnimation{
+			ID:               animation.id,
+			Description:      animation.description,
+			P5Version:        animation.p5Version,
+			RenderStatus:     animation.renderStatus,
+			Photosensitivity: animation.photosensitivity,
+			CreatedWeek:      animation.createdAt,
+		}
+		for key, mood := range m.moods {
+			if key[1] != animation.id {
+				continue
+			}
+			if entry.MoodCounts == nil {
+				entry.MoodCounts = make(map[Mood]int)
+			}
+			entry.MoodCounts[Mood(mood.mood)]++
+			entry.MoodTotal++
+		}
+		animations = append(animations, entry)
+	}
+	return animations, nil
+}
+
+func (m *MemoryStore) SaveDataset(ctx context.Context, dataset Dataset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dataset = &dataset
+	return nil
+}
+
+func (m *MemoryStore) GetLatestDataset(ctx context.Context) (Dataset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dataset == nil {
+		return Dataset{}, errors.New("dataset not found")
+	}
+	return *m.dataset, nil
+}
+
+func (m *MemoryStore) SaveAnimationEmbedding(ctx context.Context, id, model string, vector []float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(id)
+	if animation == nil {
+		return errors.New("animation not found")
+	}
+	animation.embeddingModel, animation.embedding = model, vector
+	return nil
+}
+
+func (m *MemoryStore) ListAnimationEmbeddings(ctx context.Context, model string, filter FeedFilter) ([]AnimationEmbedding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	embeddings := []AnimationEmbedding{}
+	for _, animation := range m.animations {
+		if animation.embeddingModel == model && inFeed(animation, filter) {
+			embeddings = append(embeddings, AnimationEmbedding{AnimationID: animation.id, Vector: animation.embedding})
+		}
+	}
+	return embeddings, nil
+}
+
+func (m *MemoryStore) ListAnimationsWithoutEmbedding(ctx context.Context, model string, limit int) ([]DescribedAnimation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animations := []DescribedAnimation{}
+	for _, animation := range m.animations {
+		if len(animations) == limit {
+			break
+		}
+		if animation.embeddingModel != model && strings.TrimSpace(animation.description) != "" {
+			animations = append(animations, DescribedAnimation{ID: animation.id, Description: animation.description})
+		}
+	}
+	return animations, nil
+}
+
+func (m *MemoryStore) CreateComment(ctx context.Context, animationId, userId, body string) (Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.animation(animationId) == nil {
+		return Comment{}, errors.New("animation not found")
+	}
+	m.nextCommentId++
+	comment := Comment{
+		ID:          m.nextCommentId,
+		AnimationID: animationId,
+		Author:      CommentAuthor{ID: userId, Username: m.users[userId].Username},
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+	m.comments = append(m.comments, comment)
+	return comment, nil
+}
+
+func (m *MemoryStore) ListComments(ctx context.Context, animationId string, limit, offset int) ([]Comment, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.animation(animationId) == nil {
+		return nil, 0, errors.New("animation not found")
+	}
+	var matching []Comment
+	for _, comment := range m.comments {
+		if comment.AnimationID == animationId {
+			// Usernames are joined when listing, so renames show up
+			comment.Author.Username = m.users[comment.Author.ID].Username
+			matching = append(matching, comment)
+		}
+	}
+	page := []Comment{}
+	for i := offset; i < len(matching) && len(page) < limit; i++ {
+		page = append(page, matching[i])
+	}
+	return page, len(matching), nil
+}
+
+func (m *MemoryStore) DeleteComment(ctx context.Context, animationId string, commentId int, userId string, asAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animation := m.animation(animationId)
+	for i, comment := range m.comments {
+		if comment.ID != commentId || comment.AnimationID != animationId || animation == nil {
+			continue
+		}
+		if !asAdmin && userId != comment.Author.ID && (animation.userId == "" || userId != animation.userId) {
+			return errors.New("not the comment author")
+		}
+		m.comments = append(m.comments[:i], m.comments[i+1:]...)
+		return nil
+	}
+	return errors.New("comment not found")
+}
+
+func (m *MemoryStore) SaveAnimationExport(ctx context.Context, export AnimationExport, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.animation(export.AnimationID) == nil {
+		return errors.New("animation not found")
+	}
+	m.exports = append(m.exports, memoryExport{export: export, data: append([]byte{}, data...)})
+	return nil
+}
+
+func (m *MemoryStore) GetAnimationExport(ctx context.Context, id string) (AnimationExport, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.exports {
+		if stored.export.ID == id && time.Now().Before(stored.export.ExpiresAt) {
+			return stored.export, append([]byte{}, stored.data...), nil
+		}
+	}
+	return AnimationExport{}, nil, errors.New("export not found")
+}
+
+func (m *MemoryStore) FindAnimationExport(ctx context.Context, animationId, codeHash, format string, frames, fps int) (AnimationExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.exports) - 1; i >= 0; i-- {
+		export := m.exports[i].export
+		if export.AnimationID == animationId && export.CodeHash == codeHash && export.Format == format &&
+			export.Frames == frames && export.FPS == fps && time.Now().Before(export.ExpiresAt) {
+			return export, nil
+		}
+	}
+	return AnimationExport{}, errors.New("export not found")
+}
+
+func (m *MemoryStore) DeleteExpiredAnimationExports(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.exports[:0]
+	for _, stored := range m.exports {
+		if !stored.export.ExpiresAt.Before(before) {
+			kept = append(kept, stored)
+		}
+	}
+	deleted := len(m.exports) - len(kept)
+	m.exports = kept
+	return deleted, nil
+}
+
+// recordModerationAudit appends entry to the moderation audit; the caller holds m.mu
+func (m *MemoryStore) recordModerationAudit(entry ModerationAuditEntry) {
+	entry.ID = int64(len(m.moderationAudit) + 1)
+	m.moderationAudit = append(m.moderationAudit, entry)
+}
+
+func (m *MemoryStore) ListModerationAudit(ctx context.Context, animationId string) ([]ModerationAuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []ModerationAuditEntry{}
+	for _, entry := range m.moderationAudit {
+		if entry.AnimationID == animationId {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) CreateMoodRule(ctx context.Context, rule MoodRule) (MoodRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextMoodRuleId++
+	rule.ID = m.nextMoodRuleId
+	rule.CreatedAt = time.Now()
+	m.moodRules = append(m.moodRules, rule)
+	return rule, nil
+}
+
+func (m *MemoryStore) UpdateMoodRule(ctx context.Context, rule MoodRule) (MoodRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.moodRules {
+		if existing.ID == rule.ID {
+			rule.CreatedBy = existing.CreatedBy
+			rule.CreatedAt = existing.CreatedAt
+			m.moodRules[i] = rule
+			return rule, nil
+		}
+	}
+	return MoodRule{}, errors.New("mood rule not found")
+}
+
+func (m *MemoryStore) DeleteMoodRule(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, rule := range m.moodRules {
+		if rule.ID == id {
+			m.moodRules = slices.Delete(m.moodRules, i, i+1)
+			return nil
+		}
+	}
+	return errors.New("mood rule not found")
+}
+
+func (m *MemoryStore) ListMoodRules(ctx context.Context) ([]MoodRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.moodRules), nil
+}
+
+func (m *MemoryStore) RecordPlaybackView(ctx context.Context, session PlaybackSession, view PlaybackView) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.playbackSessions[session.IDHash]
+	if !ok {
+		m.playbackSessions[session.IDHash] = &memoryPlaybackSession{session: session, view: view}
+		return true, nil
+	}
+	stored.view.WatchedSeconds = max(stored.view.WatchedSeconds, view.WatchedSeconds)
+	stored.view.AverageFPS = view.AverageFPS
+	return false, nil
+}
+
+func (m *MemoryStore) GetPlaybackStats(ctx context.Context, animationId string, from, to time.Time) (PlaybackStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := PlaybackStats{AnimationID: animationId, From: from, To: to}
+	viewers := map[string]bool{}
+	watched := 0.0
+	for _, stored := range m.playbackSessions {
+		session := stored.session
+		if session.AnimationID != animationId || session.CreatedAt.Before(from) || !session.CreatedAt.Before(to) {
+			continue
+		}
+		if stored.view.Suspect {
+			stats.SuspectViews++
+		} else {
+			stats.Views++
+			viewers[session.ViewerKey] = true
+			watched += stored.view.WatchedSeconds
+		}
+	}
+	stats.UniqueViewers = len(viewers)
+	if stats.Views > 0 {
+		stats.AverageWatchedSeconds = watched / float64(stats.Views)
+	}
+	return stats, nil
+}
+
+func (m *MemoryStore) DeletePlaybackSessions(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for idHash, stored := range m.playbackSessions {
+		if stored.session.CreatedAt.Before(before) {
+			delete(m.playbackSessions, idHash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// subscriptionTarget returns the tag or creator a subscription follows
+func subscriptionTarget(subscription Subscription) string {
+	if subscription.Kind == SubscriptionCreator {
+		return subscription.CreatorID
+	}
+	return subscription.Tag
+}
+
+func (m *MemoryStore) CreateSubscription(ctx context.Context, subscription Subscription) (Subscription, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.subscriptions {
+		if existing.UserID == subscription.UserID && existing.Kind == subscription.Kind && subscriptionTarget(existing) == subscriptionTarget(subscription) {
+			return existing, false, nil
+		}
+	}
+	m.nextSubscriptionId++
+	subscription.ID = m.nextSubscriptionId
+	subscription.CreatedAt = time.Now()
+	subscription.CreatorUsername = ""
+	m.subscriptions = append(m.subscriptions, subscription)
+	return subscription, true, nil
+}
+
+func (m *MemoryStore) ListSubscriptions(ctx context.Context, userId string) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscriptions := []Subscription{}
+	for _, subscription := range m.subscriptions {
+		if subscription.UserID == userId {
+			if subscription.Kind == SubscriptionCreator {
+				subscription.CreatorUsername = m.users[subscription.CreatorID].Username
+			}
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (m *MemoryStore) DeleteSubscription(ctx context.Context, id int, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, subscription := range m.subscriptions {
+		if subscription.ID == id && subscription.UserID == userId {
+			m.subscriptions = slices.Delete(m.subscriptions, i, i+1)
+			return nil
+		}
+	}
+	return errors.New("subscription not found")
+}
+
+func (m *MemoryStore) ListSubscribers(ctx context.Context, creatorId string, tags []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscribers := []string{}
+	for _, subscription := range m.subscriptions {
+		matches := (subscription.Kind == SubscriptionCreator && creatorId != "" && subscription.CreatorID == creatorId) ||
+			(subscription.Kind == SubscriptionTag && slices.Contains(tags, subscription.Tag))
+		if matches && !slices.Contains(subscribers, subscription.UserID) {
+			subscribers = append(subscribers, subscription.UserID)
+		}
+	}
+	return subscribers, nil
+}
+
+func (m *MemoryStore) ReserveIdempotencyKey(ctx context.Context, key IdempotencyKey, staleBefore time.Time) (IdempotencyKey, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := [3]string{key.UserID, key.Route, key.Key}
+	if existing, ok := m.idempotencyKeys[id]; ok && existing.ExpiresAt.After(key.CreatedAt) &&
+		(existing.Status != 0 || !existing.CreatedAt.Before(staleBefore)) {
+		return existing, false, nil
+	}
+	key.Status, key.Headers, key.Body = 0, nil, nil
+	m.idempotencyKeys[id] = key
+	return key, true, nil
+}
+
+func (m *MemoryStore) CompleteIdempotencyKey(ctx context.Context, key IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := [3]string{key.UserID, key.Route, key.Key}
+	existing, ok := m.idempotencyKeys[id]
+	if !ok || existing.RequestHash != key.RequestHash || !existing.CreatedAt.Equal(key.CreatedAt) {
+		return errors.New("idempotency key not found")
+	}
+	existing.Status, existing.Headers, existing.Body = key.Status, key.Headers, slices.Clone(key.Body)
+	m.idempotencyKeys[id] = existing
+	return nil
+}
+
+func (m *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, key IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := [3]string{key.UserID, key.Route, key.Key}
+	if existing, ok := m.idempotencyKeys[id]; ok && existing.Status == 0 && existing.CreatedAt.Equal(key.CreatedAt) {
+		delete(m.idempotencyKeys, id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deleted := 0
+	for id, key := range m.idempotencyKeys {
+		if key.ExpiresAt.Before(before) {
+			delete(m.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// usageDay is the key generationUsage counts a day's generations under
+func usageDay(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// generationQuota returns the user's usage against the limits. The caller must hold mu.
+func (m *MemoryStore) generationQuota(userId string, dailyLimit, monthlyLimit int) GenerationQuota {
+	now := time.Now()
+	month := now.Format("2006-01")
+	monthlyUsed := 0
+	for day, count := range m.generationUsage[userId] {
+		if strings.HasPrefix(day, month) {
+			monthlyUsed += count
+		}
+	}
+	return newGenerationQuota(dailyLimit, m.generationUsage[userId][usageDay(now)], monthlyLimit, monthlyUsed)
+}
+
+func (m *MemoryStore) ReserveGeneration(ctx context.Context, userId string, dailyLimit, monthlyLimit int) (GenerationQuota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.generationQuota(userId, dailyLimit, monthlyLimit)
+	quota := newGenerationQuota(dailyLimit, current.DailyUsed+1, monthlyLimit, current.MonthlyUsed+1)
+	if quota.Exceeded() {
+		return current, errors.New("generation quota exceeded")
+	}
+	if m.generationUsage[userId] == nil {
+		m.generationUsage[userId] = map[string]int{}
+	}
+	m.generationUsage[userId][usageDay(time.Now())]++
+	return quota, nil
+}
+
+func (m *MemoryStore) ReleaseGeneration(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if today := usageDay(time.Now()); m.generationUsage[userId][today] > 0 {
+		m.generationUsage[userId][today]--
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetGenerationQuota(ctx context.Context, userId string, dailyLimit, monthlyLimit int) (GenerationQuota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generationQuota(userId, dailyLimit, monthlyLimit), nil
+}
+
+func (m *MemoryStore) SaveMagicLinkToken(ctx context.Context, userId, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.magicLinks[tokenHash] = &memoryMagicLink{userId: userId, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *MemoryStore) ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.magicLinks[tokenHash]
+	if !ok || link.used || !time.Now().Before(link.expiresAt) {
+		return "", errors.New("login link is invalid or expired")
+	}
+	link.used = true
+	return link.userId, nil
+}
+
+func (m *MemoryStore) ListAnimationCode(ctx context.Context, afterId string, limit int) ([]StoredAnimationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	animations := []StoredAnimationCode{}
+	for _, animation := range m.animations {
+		if animation.id > afterId {
+			animations = append(animations, StoredAnimationCode{ID: animation.id, CodeHash: CodeHash(animation.code), Code: animation.code, P5Version: animation.p5Version})
+		}
+	}
+	sort.Slice(animations, func(i, j int) bool { return animations[i].ID < animations[j].ID })
+	if len(animations) > limit {
+		animations = animations[:limit]
+	}
+	return animations, nil
+}
+
+// sanitizationRun returns the run with the given ID. The caller must hold mu.
+func (m *MemoryStore) sanitizationRun(runId int) *memorySanitizationRun {
+	if runId < 1 || runId > len(m.sanitizationRuns) {
+		return nil
+	}
+	return m.sanitizationRuns[runId-1]
+}
+
+func (m *MemoryStore) CreateSanitizationRun(ctx context.Context, adminId, targetP5Version string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run := SanitizationRun{ID: len(m.sanitizationRuns) + 1, CreatedBy: adminId, Status: "running", TargetP5Version: targetP5Version, CreatedAt: time.Now()}
+	m.sanitizationRuns = append(m.sanitizationRuns, &memorySanitizationRun{run: run})
+	return run.ID, nil
+}
+
+func (m *MemoryStore) AddSanitizationFix(ctx context.Context, runId int, animation StoredAnimationCode, newCode, diff string, validationErrors []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run := m.sanitizationRun(runId)
+	if run == nil {
+		return errors.New("sanitization run not found")
+	}
+	m.nextSanitizationFixId++
+	fix := SanitizationFix{ID: m.nextSanitizationFixId, AnimationID: animation.ID, Diff: diff, ValidationErrors: append([]string{}, validationErrors...), Status: "pending"}
+	run.fixes = append(run.fixes, memorySanitizationFix{fix: fix, oldCodeHash: animation.CodeHash, newCode: newCode})
+	return nil
+}
+
+func (m *MemoryStore) FinishSanitizationRun(ctx context.Context, runId, scanned, changed int, runErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run := m.sanitizationRun(runId)
+	if run == nil {
+		return errors.New("sanitization run not found")
+	}
+	run.run.Status, run.run.Scanned, run.run.Changed = "completed", scanned, changed
+	if runErr != nil {
+		run.run.Status, run.run.Error = "failed", runErr.Error()
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetSanitizationRun(ctx context.Context, runId int) (SanitizationRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run := m.sanitizationRun(runId)
+	if run == nil {
+		return SanitizationRun{}, errors.New("sanitization run not found")
+	}
+	result := run.run
+	result.Fixes = make([]SanitizationFix, 0, len(run.fixes))
+	for _, fix := range run.fixes {
+		result.Fixes = append(result.Fixes, fix.fix)
+	}
+	return result, nil
+}
+
+// pendingSanitizationFixes returns the pending fixes of a run among fixIds, or all of them when
+// fixIds is empty. The caller must hold mu.
+func (m *MemoryStore) pendingSanitizationFixes(runId int, fixIds []int) []*memorySanitizationFix {
+	run := m.sanitizationRun(runId)
+	if run == nil {
+		return nil
+	}
+	var fixes []*memorySanitizationFix
+	for i := range run.fixes {
+		fix := &run.fixes[i]
+		if fix.fix.Status == "pending" && (len(fixIds) == 0 || slices.Contains(fixIds, fix.fix.ID)) {
+			fixes = append(fixes, fix)
+		}
+	}
+	return fixes
+}
+
+func (m *MemoryStore) ApplySanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var targetP5Version string
+	if run := m.sanitizationRun(runId); run != nil {
+		targetP5Version = run.run.TargetP5Version
+	}
+	applied := []string{}
+	for _, fix := range m.pendingSanitizationFixes(runId, fixIds) {
+		animation := m.animation(fix.fix.AnimationID)
+		if animation == nil || CodeHash(animation.code) != fix.oldCodeHash {
+			fix.fix.Status = "stale"
+			continue
+		}
+		animation.code = fix.newCode
+		if targetP5Version != "" {
+			animation.p5Version = targetP5Version
+		}
+		animation.compat = nil
+		animation.addVersion(VersionFixed, 0)
+		fix.fix.Status = "applied"
+		applied = append(applied, animation.id)
+	}
+	return applied, nil
+}
+
+func (m *MemoryStore) RejectSanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fixes := m.pendingSanitizationFixes(runId, fixIds)
+	for _, fix := range fixes {
+		fix.fix.Status = "rejected"
+	}
+	return len(fixes), nil
+}
+
+func (m *MemoryStore) SaveContractRun(ctx context.Context, report ContractReport) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report.ID = len(m.contractRuns) + 1
+	report.CreatedAt = time.Now()
+	m.contractRuns = append(m.contractRuns, report)
+	return report.ID, nil
+}
+
+func (m *MemoryStore) GetContractRuns(ctx context.Context, limit int) ([]ContractReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reports := []ContractReport{}
+	for i := len(m.contractRuns) - 1; i >= 0 && len(reports) < limit; i-- {
+		report := m.contractRuns[i]
+		report.Cases, report.Change, report.PassRate = nil, nil, 0
+		if report.Total > 0 {
+			report.PassRate = 100 * float64(report.Passed) / float64(report.Total)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// takedown returns the takedown request with the given ID, with the animation's current uploader.
+// The caller must hold mu.
+func (m *MemoryStore) takedown(id int) (*TakedownRequest, bool) {
+	if id < 1 || id > len(m.takedowns) {
+		return nil, false
+	}
+	takedown := &m.takedowns[id-1]
+	if animation := m.animation(takedown.AnimationID); animation != nil {
+		takedown.UploaderID = animation.userId
+	}
+	return takedown, true
+}
+
+func (m *MemoryStore) CreateTakedownRequest(ctx context.Context, animationId, reporterName, reporterEmail, reason string) (TakedownRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.animation(animationId) == nil {
+		return TakedownRequest{}, errors.New("animation not found")
+	}
+	now := time.Now()
+	m.takedowns = append(m.takedowns, TakedownRequest{
+		ID: len(m.takedowns) + 1, AnimationID: animationId, ReporterName: reporterName, ReporterEmail: reporterEmail,
+		Reason: reason, Status: TakedownReported, CreatedAt: now, UpdatedAt: now,
+		Events: []TakedownEvent{{Actor: reporterEmail, ToStatus: TakedownReported, Note: reason, CreatedAt: now}},
+	})
+	takedown, _ := m.takedown(len(m.takedowns))
+	result := *takedown
+	result.Events = nil
+	return result, nil
+}
+
+func (m *MemoryStore) GetTakedownRequest(ctx context.Context, id int) (TakedownRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	takedown, ok := m.takedown(id)
+	if !ok {
+		return TakedownRequest{}, errors.New("takedown request not found")
+	}
+	result := *takedown
+	result.Events = append([]TakedownEvent{}, takedown.Events...)
+	return result, nil
+}
+
+func (m *MemoryStore) ListTakedownRequests(ctx context.Context, status string, limit int) ([]TakedownRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	takedowns := make([]TakedownRequest, 0)
+	for id := len(m.takedowns); id >= 1 && len(takedowns) < limit; id-- {
+		takedown, _ := m.takedown(id)
+		if status == "" || takedown.Status == status {
+			result := *takedown
+			result.Events = nil
+			takedowns = append(takedowns, result)
+		}
+	}
+	return takedowns, nil
+}
+
+func (m *MemoryStore) TransitionTakedown(ctx context.Context, id int, to, actor, note string) (TakedownRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	takedown, ok := m.takedown(id)
+	if !ok {
+		return TakedownRequest{}, errors.New("takedown request not found")
+	}
+	from := takedown.Status
+	if err := ValidateTakedownTransition(from, to); err != nil {
+		return TakedownRequest{}, err
+	}
+
+	now := time.Now()
+	if animation := m.animation(takedown.AnimationID); animation != nil && (to == TakedownRemoved || to == TakedownRestored) {
+		before := visibilityState(animation.removed)
+		animation.removed = to == TakedownRemoved
+		if after := visibilityState(animation.removed); before != after {
+			entry := moderationEntry(ctx, animation.id, ModerationVisibility, before, after, "Takedown request "+strconv.Itoa(id))
+			entry.Actor = actor
+			if note != "" {
+				entry.Reason += ": " + note
+			}
+			m.recordModerationAudit(entry)
+		}
+	}
+	takedown.Status, takedown.UpdatedAt = to, now
+	takedown.Events = append(takedown.Events, TakedownEvent{Actor: actor, FromStatus: from, ToStatus: to, Note: note, CreatedAt: now})
+
+	result := *takedown
+	result.Events = nil
+	return result, nil
+}
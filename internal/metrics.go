@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// writeMetric writes one metric in the Prometheus text exposition format
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// writeDBPoolMetrics reports database connection pool statistics
+func writeDBPoolMetrics(w io.Writer) {
+	stats, ok := DBStats()
+	if !ok {
+		return
+	}
+
+	writeMetric(w, "animate_db_max_open_connections", "gauge", "Maximum number of open connections to the database.", float64(stats.MaxOpenConnections))
+	writeMetric(w, "animate_db_open_connections", "gauge", "Number of established connections, both in use and idle.", float64(stats.OpenConnections))
+	writeMetric(w, "animate_db_in_use_connections", "gauge", "Number of connections currently in use.", float64(stats.InUse))
+	writeMetric(w, "animate_db_idle_connections", "gauge", "Number of idle connections.", float64(stats.Idle))
+	writeMetric(w, "animate_db_wait_count_total", "counter", "Total number of connections waited for.", float64(stats.WaitCount))
+	writeMetric(w, "animate_db_wait_duration_seconds_total", "counter", "Total time blocked waiting for a new connection.", stats.WaitDuration.Seconds())
+	writeMetric(w, "animate_db_max_idle_closed_total", "counter", "Total connections closed due to DB_MAX_IDLE_CONNS.", float64(stats.MaxIdleClosed))
+	writeMetric(w, "animate_db_max_idle_time_closed_total", "counter", "Total connections closed due to DB_CONN_MAX_IDLE_TIME_MINUTES.", float64(stats.MaxIdleTimeClosed))
+	writeMetric(w, "animate_db_max_lifetime_closed_total", "counter", "Total connections closed due to DB_CONN_MAX_LIFETIME_MINUTES.", float64(stats.MaxLifetimeClosed))
+}
+
+// writeCacheMetrics reports how often animation reads were served from the cache
+func writeCacheMetrics(w io.Writer) {
+	writeMetric(w, "animate_cache_hits_total", "counter", "Total animation cache lookups served from the cache.", float64(cacheHits.Load()))
+	writeMetric(w, "animate_cache_misses_total", "counter", "Total animation cache lookups that fell through to the database.", float64(cacheMisses.Load()))
+}
+
+// metricsHandler serves metrics for Prometheus. When METRICS_TOKEN is set, scrapers must send it as a bearer token.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			EncodeError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeDBPoolMetrics(w)
+	writeCacheMetrics(w)
+	writeSLOMetrics(w)
+	writeLoadMetrics(w)
+	writeClaudePoolMetrics(w)
+	writeFeatureMetrics(w)
+	writeFeedFallbackMetrics(w)
+	writePlaybackMetrics(w)
+	writeSubscriptionMetrics(w)
+	writeIdempotencyMetrics(w)
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDBPoolConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want DBPoolConfig
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{},
+			want: DBPoolConfig{MaxOpenConns: 25, MaxIdleConns: 10, ConnMaxLifetime: 30 * time.Minute, ConnMaxIdleTime: 5 * time.Minute},
+		},
+		{
+			name: "configured",
+			env:  map[string]string{"DB_MAX_OPEN_CONNS": "50", "DB_MAX_IDLE_CONNS": "20", "DB_CONN_MAX_LIFETIME_MINUTES": "60", "DB_CONN_MAX_IDLE_TIME_MINUTES": "0"},
+			want: DBPoolConfig{MaxOpenConns: 50, MaxIdleConns: 20, ConnMaxLifetime: time.Hour},
+		},
+		{
+			name: "idle capped at open",
+			env:  map[string]string{"DB_MAX_OPEN_CONNS": "4", "DB_MAX_IDLE_CONNS": "10"},
+			want: DBPoolConfig{MaxOpenConns: 4, MaxIdleConns: 4, ConnMaxLifetime: 30 * time.Minute, ConnMaxIdleTime: 5 * time.Minute},
+		},
+	}
+
+	keys := []string{"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME_MINUTES", "DB_CONN_MAX_IDLE_TIME_MINUTES"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range keys {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := DBPoolConfigFromEnv(); got != tt.want {
+				t.Errorf("DBPoolConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMetric(t *testing.T) {
+	var out strings.Builder
+	writeMetric(&out, "animate_db_in_use_connections", "gauge", "Connections in use.", 3)
+
+	want := "# HELP animate_db_in_use_connections Connections in use.\n# TYPE animate_db_in_use_connections gauge\nanimate_db_in_use_connections 3\n"
+	if out.String() != want {
+		t.Errorf("writeMetric() = %q, want %q", out.String(), want)
+	}
+}
+
+func TestMetricsHandlerToken(t *testing.T) {
+	t.Setenv("METRICS_TOKEN", "scrape-secret")
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{name: "missing token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", header: "Bearer scrape-secret", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			metricsHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
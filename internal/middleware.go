@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"strings"
@@ -34,8 +35,13 @@ func CorsMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+TenantHeader+", "+ClientRequestIDHeader+", "+IdempotencyKeyHeader+", traceparent")
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join([]string{
+			RefreshedTokenHeader, QuotaDailyRemainingHeader, QuotaMonthlyRemainingHeader, GenerationJobHeader,
+			"Deprecation", "Sunset", "Link", DeprecatedFieldsHeader, APIVersionHeader, ClientRequestIDHeader,
+			IdempotentReplayedHeader,
+		}, ", "))
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
@@ -62,26 +68,36 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		// Log the request details
 		duration := time.Since(start)
+		correlation, _ := GetCorrelationFromContext(r.Context())
 		log.Printf(
-			"[API] %s - %s %s - Status: %d - Duration: %v",
+			"[API] %s - %s %s - Status: %d - Duration: %v - %s",
 			r.RemoteAddr,
 			r.Method,
 			r.URL.Path,
 			wrw.statusCode,
 			duration,
+			correlation,
 		)
 	})
 }
 
-// responseWriter is a custom response writer that captures the status code
+// responseWriter is a custom response writer that captures the status code and body size
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 // newResponseWriter creates a new responseWriter
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{w, http.StatusOK}
+	return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+// Write counts the bytes written and calls the underlying Write
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
 }
 
 // WriteHeader captures the status code and calls the underlying WriteHeader
@@ -90,6 +106,49 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush sends buffered data to the client when the underlying writer supports it, so streamed
+// responses pass through the middlewares that wrap them
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, so http.ResponseController can hijack connections that
+// switch to WebSocket
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// OptionalAuthMiddleware authenticates requests that carry an Authorization header, rejecting invalid
+// tokens as AuthMiddleware does, and lets anonymous requests through without a user ID
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	authenticated := AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// parseJWT parses a token signed with the JWT secret and checks its signature and expiry
+func parseJWT(tokenString string) (*jwt.Token, error) {
+	secretKey, err := JWTSecret()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return secretKey, nil
+	})
+}
+
 // AuthMiddleware verifies JWT token and adds user information to the context
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -99,6 +158,17 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Third-party apps' access tokens were already checked by AppTokenMiddleware, and admins'
+		// impersonation tokens by ImpersonationMiddleware
+		if _, ok := GetAppTokenFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := GetImpersonationFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Get the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -113,25 +183,10 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		tokenString := bearerToken[1]
-		secretKey, err := JWTSecret()
-		if err != nil {
-			EncodeError(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
-
 		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return secretKey, nil
-		})
-
+		token, err := parseJWT(bearerToken[1])
 		if err != nil {
-			EncodeError(w, "Invalid or expired token", http.StatusUnauthorized)
+			EncodeErrorCode(w, ErrCodeInvalidToken, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
@@ -140,16 +195,28 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			// Check for userId claim
 			userId, ok := claims["userId"].(string)
 			if !ok {
-				EncodeError(w, "Invalid token claims", http.StatusUnauthorized)
+				EncodeErrorCode(w, ErrCodeInvalidToken, "Invalid token claims", http.StatusUnauthorized)
 				return
 			}
 
+			// Issue a refreshed token when the current one is about to expire
+			if window := JWTRenewalWindow(); window > 0 {
+				if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil && time.Until(expiresAt.Time) < window {
+					tenant, _ := claims["tenant"].(string)
+					if refreshed, err := generateJWT(userId, tenant); err == nil {
+						w.Header().Set(RefreshedTokenHeader, refreshed)
+					} else {
+						log.Printf("[AUTH] Failed to refresh token for user %s: %v", userId, err)
+					}
+				}
+			}
+
 			// Add userId to request context
 			ctx := r.Context()
 			ctx = SetUserIDInContext(ctx, userId)
 			r = r.WithContext(ctx)
 		} else {
-			EncodeError(w, "Invalid token claims", http.StatusUnauthorized)
+			EncodeErrorCode(w, ErrCodeInvalidToken, "Invalid token claims", http.StatusUnauthorized)
 			return
 		}
 
@@ -157,3 +224,53 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// bearerCredential returns the bearer token r was sent with, in its Authorization header or, from
+// browsers' WebSockets, which cannot set one, its subprotocols
+func bearerCredential(r *http.Request) (string, bool) {
+	secret, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if protocols := webSocketProtocols(r); !bearer && len(protocols) >= 2 && protocols[0] == webSocketBearerProtocol {
+		secret, bearer = protocols[1], true
+	}
+	return secret, bearer
+}
+
+// SessionRevocationMiddleware turns away JWTs issued before their user was last signed out
+// everywhere, e.g. by reverting an email change. It runs before AuthMiddleware, which would
+// otherwise renew them, and leaves every other check of the token to it.
+func (s *Server) SessionRevocationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, bearer := bearerCredential(r)
+		if r.Method == http.MethodOptions || !bearer {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := parseJWT(secret)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, _ := token.Claims.(jwt.MapClaims)
+		userId, _ := claims["userId"].(string)
+		if userId == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		revokedAt, err := s.store.SessionsRevokedAt(r.Context(), userId)
+		if err != nil {
+			// Fail open, so signed-in users keep the feed's fallback while the database is down
+			log.Printf("[AUTH] Failed to check whether the sessions of user %s were revoked: %v", userId, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The issue time is read as sent, since the library drops its milliseconds. Tokens from
+		// before issue times were recorded count as issued before any revocation, and so do tokens
+		// from the millisecond it happened in, as they may have been issued just before it.
+		if issuedAt, _ := claims["iat"].(float64); !revokedAt.IsZero() && int64(math.Round(issuedAt*1000)) <= revokedAt.UnixMilli() {
+			EncodeErrorCode(w, ErrCodeInvalidToken, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
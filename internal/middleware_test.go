@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthMiddlewareSlidingExpiration(t *testing.T) {
+	secret := strings.Repeat("s", minJWTSecretLength)
+	t.Setenv("JWT_SECRET_KEY", secret)
+	t.Setenv("JWT_RENEWAL_WINDOW_HOURS", "24")
+
+	tests := []struct {
+		name        string
+		expiresIn   time.Duration
+		wantRefresh bool
+	}{
+		{name: "Outside renewal window", expiresIn: 48 * time.Hour, wantRefresh: false},
+		{name: "Inside renewal window", expiresIn: time.Hour, wantRefresh: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"userId": "user-1",
+				"exp":    time.Now().Add(tt.expiresIn).Unix(),
+			}).SignedString([]byte(secret))
+			if err != nil {
+				t.Fatalf("sign token: %v", err)
+			}
+
+			var gotUserID string
+			handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = GetUserIDFromContext(r.Context())
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if gotUserID != "user-1" {
+				t.Errorf("user ID = %q, want %q", gotUserID, "user-1")
+			}
+			if refreshed := recorder.Header().Get(RefreshedTokenHeader); (refreshed != "") != tt.wantRefresh {
+				t.Errorf("%s present = %v, want %v", RefreshedTokenHeader, refreshed != "", tt.wantRefresh)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations, named NNNN_description.up.sql and NNNN_description.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the advisory lock held while a migration runs so that replicas
+// starting at the same time apply each migration once
+const migrationLockKey = 727_001
+
+// Migration is one versioned schema change with the SQL to apply and to undo it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and whether it has been applied to the database
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// LoadMigrations reads the migrations in the root of fsys, ordered by version.
+// Every version must have both an up and a down file.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		filename := entry.Name()
+		if entry.IsDir() || path.Ext(filename) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(filename, ".sql")
+		direction := path.Ext(base)
+		if direction != ".up" && direction != ".down" {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", filename)
+		}
+		versionText, name, found := strings.Cut(strings.TrimSuffix(base, direction), "_")
+		version, err := strconv.Atoi(versionText)
+		if !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number and an underscore", filename)
+		}
+
+		contents, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", filename, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, name)
+		}
+
+		if direction == ".up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// embeddedMigrations returns the migrations compiled into the binary
+func embeddedMigrations() ([]Migration, error) {
+	fsys, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(fsys)
+}
+
+// ensureMigrationsTable creates the table recording applied migration versions
+func ensureMigrationsTable(ctx context.Context) error {
+	_, err := dbFor(ctx).ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns when each applied migration version was applied
+func appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := dbFor(ctx).QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration applies (up) or reverts (!up) one migration in a transaction together with its
+// schema_migrations row. It does nothing if another process got there first.
+func runMigration(ctx context.Context, migration Migration, up bool) (bool, error) {
+	tx, err := dbFor(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return false, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	var isApplied bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version).Scan(&isApplied)
+	if err != nil {
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	if isApplied == up {
+		return false, nil
+	}
+
+	script, action := migration.Up, "apply"
+	if !up {
+		script, action = migration.Down, "revert"
+	}
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return false, fmt.Errorf("failed to %s migration %d_%s: %v", action, migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record migration %d: %v", migration.Version, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
+	}
+	return true, nil
+}
+
+// MigrateUp applies every pending migration in version order and returns how many it applied
+func MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, migration := range migrations {
+		ran, err := runMigration(ctx, migration, true)
+		if err != nil {
+			return applied, err
+		}
+		if ran {
+			log.Printf("[DB] Applied migration %d_%s", migration.Version, migration.Name)
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first, and returns how many it reverted
+func MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		ran, err := runMigration(ctx, migration, false)
+		if err != nil {
+			return reverted, err
+		}
+		if ran {
+			log.Printf("[DB] Reverted migration %d_%s", migration.Version, migration.Name)
+			reverted++
+		}
+	}
+	return reverted, nil
+}
+
+// GetMigrationStatus lists every known migration and when it was applied, if it has been
+func GetMigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
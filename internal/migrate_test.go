@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantVersions []int
+		wantErr      string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"0010_later.up.sql":   file("CREATE TABLE b ();"),
+				"0010_later.down.sql": file("DROP TABLE b;"),
+				"0002_first.up.sql":   file("CREATE TABLE a ();"),
+				"0002_first.down.sql": file("DROP TABLE a;"),
+				"README.md":           file("ignored"),
+			},
+			wantVersions: []int{2, 10},
+		},
+		{
+			name:    "missing down",
+			files:   fstest.MapFS{"0001_init.up.sql": file("CREATE TABLE a ();")},
+			wantErr: "migration 1_init needs both an up and a down file",
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"0001_init.up.sql":  file("CREATE TABLE a ();"),
+				"0001_other.up.sql": file("CREATE TABLE b ();"),
+			},
+			wantErr: "migration version 1 is used by both init and other",
+		},
+		{
+			name:    "no direction",
+			files:   fstest.MapFS{"0001_init.sql": file("CREATE TABLE a ();")},
+			wantErr: "migration 0001_init.sql must end in .up.sql or .down.sql",
+		},
+		{
+			name:    "no version",
+			files:   fstest.MapFS{"init.up.sql": file("CREATE TABLE a ();")},
+			wantErr: "migration init.up.sql must start with a positive version number and an underscore",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := LoadMigrations(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(migrations) != len(tt.wantVersions) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.wantVersions))
+			}
+			for i, version := range tt.wantVersions {
+				if migrations[i].Version != version {
+					t.Errorf("migration %d has version %d, want %d", i, migrations[i].Version, version)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsAreSequential(t *testing.T) {
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		t.Fatalf("embedded migrations are invalid: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+	}
+}
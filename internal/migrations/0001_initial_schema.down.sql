@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS generation_usage;
+DROP TABLE IF EXISTS magic_link_tokens;
+DROP TABLE IF EXISTS profile_changes;
+DROP TABLE IF EXISTS user_moods;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS animations;
+DROP TABLE IF EXISTS code_blobs;
@@ -0,0 +1,107 @@
+-- Baseline schema. Written with IF NOT EXISTS so databases created before versioned
+-- migrations are brought up to the same state instead of failing.
+
+CREATE TABLE IF NOT EXISTS code_blobs (
+    hash VARCHAR(64) PRIMARY KEY,
+    code TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS animations (
+    id VARCHAR(32) PRIMARY KEY,
+    code TEXT,
+    code_hash VARCHAR(64) REFERENCES code_blobs(hash),
+    description TEXT,
+    render_status VARCHAR(20) NOT NULL DEFAULT 'unchecked',
+    render_checked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(32) PRIMARY KEY,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    username VARCHAR(255),
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_moods (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id),
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id),
+    mood VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS profile_changes (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    field VARCHAR(32) NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    revert_token_hash VARCHAR(64),
+    revert_expires_at TIMESTAMP,
+    reverted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS magic_link_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS generation_usage (
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    usage_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    generation_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, usage_date)
+);
+
+-- Columns added to existing tables before migrations were versioned
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username VARCHAR(255);
+ALTER TABLE animations
+    ADD COLUMN IF NOT EXISTS code_hash VARCHAR(64) REFERENCES code_blobs(hash),
+    ADD COLUMN IF NOT EXISTS render_status VARCHAR(20) NOT NULL DEFAULT 'unchecked',
+    ADD COLUMN IF NOT EXISTS render_checked_at TIMESTAMP;
+ALTER TABLE animations ALTER COLUMN code DROP NOT NULL;
+
+-- Move code stored inline on animations into code_blobs, deduplicating identical sketches
+INSERT INTO code_blobs (hash, code)
+SELECT DISTINCT encode(sha256(convert_to(code, 'UTF8')), 'hex'), code
+FROM animations WHERE code_hash IS NULL AND code IS NOT NULL
+ON CONFLICT (hash) DO NOTHING;
+
+UPDATE animations SET code_hash = encode(sha256(convert_to(code, 'UTF8')), 'hex'), code = NULL
+WHERE code_hash IS NULL AND code IS NOT NULL;
+
+-- Keep the latest legacy mood before enforcing one mood per user and animation
+DELETE FROM user_moods AS older
+USING user_moods AS newer
+WHERE older.user_id = newer.user_id
+    AND older.animation_id = newer.animation_id
+    AND older.id < newer.id;
+
+CREATE INDEX IF NOT EXISTS idx_animations_code_hash ON animations(code_hash);
+CREATE INDEX IF NOT EXISTS idx_animations_render_status ON animations(render_status);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+
+CREATE INDEX IF NOT EXISTS idx_user_moods_user_id ON user_moods(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_moods_animation_id ON user_moods(animation_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_moods_unique_user_animation ON user_moods(user_id, animation_id);
+
+CREATE INDEX IF NOT EXISTS idx_profile_changes_user_id ON profile_changes(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_profile_changes_revert_token ON profile_changes(revert_token_hash);
+
+COMMENT ON TABLE animations IS 'Stores p5.js animation codes with unique IDs';
+COMMENT ON COLUMN animations.code IS 'Legacy inline p5.js code, moved to code_blobs by migration 1';
+COMMENT ON COLUMN animations.code_hash IS 'Reference to the animation code in code_blobs';
+COMMENT ON COLUMN animations.render_status IS 'Result of the headless render check (unchecked, ok, nondeterministic, crashed)';
+COMMENT ON TABLE code_blobs IS 'Deduplicated p5.js sketch code keyed by content hash';
+COMMENT ON COLUMN code_blobs.hash IS 'Hex encoded SHA-256 of the code';
+COMMENT ON TABLE users IS 'Stores user account information';
+COMMENT ON TABLE user_moods IS 'Stores user mood responses to animations';
+COMMENT ON TABLE profile_changes IS 'Audit trail of profile changes, with revert links for email changes';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sanitization_fixes;
+DROP TABLE IF EXISTS sanitization_runs;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS sanitization_runs (
+    id SERIAL PRIMARY KEY,
+    created_by VARCHAR(32) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    scanned INTEGER NOT NULL DEFAULT 0,
+    changed INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sanitization_fixes (
+    id SERIAL PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES sanitization_runs(id) ON DELETE CASCADE,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    old_code_hash VARCHAR(64) NOT NULL,
+    new_code TEXT NOT NULL,
+    diff TEXT NOT NULL,
+    validation_errors TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reviewed_by VARCHAR(32),
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sanitization_fixes_run_id ON sanitization_fixes(run_id);
+
+COMMENT ON TABLE sanitization_runs IS 'Admin runs of the current sanitizer over all stored animations';
+COMMENT ON TABLE sanitization_fixes IS 'Code changes proposed by a sanitization run, applied once approved';
+COMMENT ON COLUMN sanitization_fixes.old_code_hash IS 'Code hash the fix was computed from; the fix is marked stale if the animation changed since';
+COMMENT ON COLUMN sanitization_fixes.status IS 'pending, applied, rejected or stale';
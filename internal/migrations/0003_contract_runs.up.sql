@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS contract_runs (
+    id SERIAL PRIMARY KEY,
+    mode VARCHAR(10) NOT NULL,
+    total INTEGER NOT NULL,
+    passed INTEGER NOT NULL,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    cases JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE contract_runs IS 'Nightly generation contract check results used for trend reporting';
+COMMENT ON COLUMN contract_runs.mode IS 'mock (canned output) or live (real Claude calls)';
+COMMENT ON COLUMN contract_runs.cases IS 'Per-description results with validation violations';
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS takedown_events;
+DROP TABLE IF EXISTS takedown_requests;
+
+DROP INDEX IF EXISTS idx_animations_user_id;
+ALTER TABLE animations
+    DROP COLUMN IF EXISTS removed_at,
+    DROP COLUMN IF EXISTS user_id;
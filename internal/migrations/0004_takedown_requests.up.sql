@@ -0,0 +1,36 @@
+-- Record who uploaded an animation and whether a takedown removed it
+ALTER TABLE animations
+    ADD COLUMN IF NOT EXISTS user_id VARCHAR(32) REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS removed_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_animations_user_id ON animations(user_id);
+
+CREATE TABLE IF NOT EXISTS takedown_requests (
+    id SERIAL PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    reporter_name VARCHAR(255) NOT NULL,
+    reporter_email VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'reported',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS takedown_events (
+    id SERIAL PRIMARY KEY,
+    takedown_id INTEGER NOT NULL REFERENCES takedown_requests(id) ON DELETE CASCADE,
+    actor VARCHAR(255) NOT NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_takedown_requests_animation_id ON takedown_requests(animation_id);
+CREATE INDEX IF NOT EXISTS idx_takedown_events_takedown_id ON takedown_events(takedown_id);
+
+COMMENT ON COLUMN animations.user_id IS 'User who saved the animation, if known';
+COMMENT ON COLUMN animations.removed_at IS 'Set while the animation is removed by a takedown request';
+COMMENT ON TABLE takedown_requests IS 'Reports asking for an animation to be removed, such as DMCA notices';
+COMMENT ON COLUMN takedown_requests.status IS 'reported, under_review, removed, appealed or restored';
+COMMENT ON TABLE takedown_events IS 'Audit trail of every status change of a takedown request';
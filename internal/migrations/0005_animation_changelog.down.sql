@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS animation_changelog;
+
+ALTER TABLE animations DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,13 @@
+ALTER TABLE animations ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS animation_changelog (
+    id SERIAL PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    note TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_animation_changelog_animation_id ON animation_changelog(animation_id);
+
+COMMENT ON COLUMN animations.updated_at IS 'Timestamp of the owner''s last edit, NULL if never edited';
+COMMENT ON TABLE animation_changelog IS 'Owner notes describing what changed in each edit of an animation';
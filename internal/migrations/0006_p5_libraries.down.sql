@@ -0,0 +1,3 @@
+ALTER TABLE animations DROP COLUMN IF EXISTS p5_version;
+
+DROP TABLE IF EXISTS p5_libraries;
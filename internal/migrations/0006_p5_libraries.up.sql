@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS p5_libraries (
+    version VARCHAR(32) PRIMARY KEY,
+    url TEXT NOT NULL,
+    integrity VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE animations ADD COLUMN IF NOT EXISTS p5_version VARCHAR(32) REFERENCES p5_libraries(version);
+
+COMMENT ON TABLE p5_libraries IS 'p5.js builds animations can be pinned to, with the SRI hash computed when the build was registered';
+COMMENT ON COLUMN animations.p5_version IS 'p5.js version the animation was saved against, NULL if saved before versions were pinned';
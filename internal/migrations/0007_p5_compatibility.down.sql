@@ -0,0 +1,3 @@
+ALTER TABLE sanitization_runs DROP COLUMN IF EXISTS target_p5_version;
+
+DROP TABLE IF EXISTS animation_p5_compatibility;
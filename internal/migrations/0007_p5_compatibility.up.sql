@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS animation_p5_compatibility (
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    p5_major INTEGER NOT NULL,
+    compatible BOOLEAN NOT NULL,
+    issues JSONB NOT NULL DEFAULT '[]',
+    checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (animation_id, p5_major)
+);
+
+ALTER TABLE sanitization_runs ADD COLUMN IF NOT EXISTS target_p5_version VARCHAR(32) REFERENCES p5_libraries(version);
+
+COMMENT ON TABLE animation_p5_compatibility IS 'Whether an animation''s code runs on each major p5.js version, and the APIs that stop it';
+COMMENT ON COLUMN sanitization_runs.target_p5_version IS 'p5.js version a migration run moves animations to; NULL for plain re-sanitization runs';
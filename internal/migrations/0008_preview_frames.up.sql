@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS preview_frames (
+    code_hash VARCHAR(64) NOT NULL,
+    frame_count INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    frame INTEGER NOT NULL,
+    png BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (code_hash, frame_count, position)
+);
+
+COMMENT ON TABLE preview_frames IS 'PNG frames rendered headlessly for feed previews, keyed by the SHA-256 of the code so edits never serve old frames';
+COMMENT ON COLUMN preview_frames.frame_count IS 'Number of frames in the preview set this frame belongs to';
+COMMENT ON COLUMN preview_frames.frame IS 'Sketch frame number the image was captured at';
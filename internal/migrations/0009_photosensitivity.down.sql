@@ -0,0 +1,2 @@
+ALTER TABLE animations DROP COLUMN IF EXISTS motion_score;
+ALTER TABLE animations DROP COLUMN IF EXISTS photosensitivity;
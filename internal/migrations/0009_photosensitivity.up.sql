@@ -0,0 +1,5 @@
+ALTER TABLE animations ADD COLUMN IF NOT EXISTS photosensitivity VARCHAR(20) NOT NULL DEFAULT 'unchecked';
+ALTER TABLE animations ADD COLUMN IF NOT EXISTS motion_score REAL;
+
+COMMENT ON COLUMN animations.photosensitivity IS 'Result of screening rendered frames for flashing (unchecked, safe, flashing); flashing animations are left out of the feed';
+COMMENT ON COLUMN animations.motion_score IS 'Average share of the canvas that changes each frame, used to honor reduced motion';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_content_preferences (
+    user_id VARCHAR(32) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    reduce_motion BOOLEAN NOT NULL DEFAULT FALSE,
+    avoid_flashing BOOLEAN NOT NULL DEFAULT FALSE,
+    mute_sound BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE user_content_preferences IS 'Playback preferences the feed applies when choosing animations for a signed-in user';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS professional_audit_log;
+DROP TABLE IF EXISTS session_assignments;
+DROP TABLE IF EXISTS client_links;
+ALTER TABLE users DROP COLUMN IF EXISTS account_type;
@@ -0,0 +1,44 @@
+-- Professional (therapist/coach) accounts, their links to clients and an audit trail of access
+ALTER TABLE users ADD COLUMN IF NOT EXISTS account_type VARCHAR(20) NOT NULL DEFAULT 'personal';
+
+CREATE TABLE IF NOT EXISTS client_links (
+    id SERIAL PRIMARY KEY,
+    professional_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(32) REFERENCES users(id) ON DELETE CASCADE,
+    invite_email VARCHAR(255) NOT NULL,
+    invite_token_hash VARCHAR(64) UNIQUE,
+    invite_expires_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'invited',
+    share_mood_trends BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    accepted_at TIMESTAMP,
+    ended_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS session_assignments (
+    id SERIAL PRIMARY KEY,
+    link_id INTEGER NOT NULL REFERENCES client_links(id) ON DELETE CASCADE,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS professional_audit_log (
+    id SERIAL PRIMARY KEY,
+    link_id INTEGER NOT NULL REFERENCES client_links(id) ON DELETE CASCADE,
+    actor_id VARCHAR(32) NOT NULL,
+    action VARCHAR(40) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_links_professional_id ON client_links(professional_id);
+CREATE INDEX IF NOT EXISTS idx_client_links_client_id ON client_links(client_id);
+CREATE INDEX IF NOT EXISTS idx_session_assignments_link_id ON session_assignments(link_id);
+CREATE INDEX IF NOT EXISTS idx_professional_audit_log_link_id ON professional_audit_log(link_id);
+
+COMMENT ON COLUMN users.account_type IS 'personal or professional; professionals can invite clients';
+COMMENT ON TABLE client_links IS 'Links between a professional and a client, from invitation to end';
+COMMENT ON COLUMN client_links.status IS 'invited, active or ended';
+COMMENT ON COLUMN client_links.share_mood_trends IS 'Whether the client consented to the professional viewing their aggregated mood trends';
+COMMENT ON TABLE session_assignments IS 'Animations a professional recommended to a client';
+COMMENT ON TABLE professional_audit_log IS 'Every action a professional or client took on a link, including each view of mood trends';
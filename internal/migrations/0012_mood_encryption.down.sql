@@ -0,0 +1,5 @@
+-- Refuses to run while any mood is only stored encrypted, so rolling back cannot lose moods
+ALTER TABLE user_moods ALTER COLUMN mood SET NOT NULL;
+DROP INDEX IF EXISTS idx_user_moods_mood_key_id;
+ALTER TABLE user_moods DROP COLUMN IF EXISTS mood_key_id;
+ALTER TABLE user_moods DROP COLUMN IF EXISTS mood_encrypted;
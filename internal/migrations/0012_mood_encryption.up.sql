@@ -0,0 +1,9 @@
+-- Moods are sealed with envelope encryption; mood stays as plain text only where no key was configured
+ALTER TABLE user_moods ALTER COLUMN mood DROP NOT NULL;
+ALTER TABLE user_moods ADD COLUMN IF NOT EXISTS mood_encrypted BYTEA;
+ALTER TABLE user_moods ADD COLUMN IF NOT EXISTS mood_key_id VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_user_moods_mood_key_id ON user_moods(mood_key_id);
+
+COMMENT ON COLUMN user_moods.mood_encrypted IS 'Wrapped data key followed by the mood sealed with it (AES-256-GCM)';
+COMMENT ON COLUMN user_moods.mood_key_id IS 'ID of the master key in MOOD_ENCRYPTION_KEYS that wraps the data key';
@@ -0,0 +1,18 @@
+-- Refuses to run while any email is only stored encrypted, so rolling back cannot lose addresses
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM profile_changes WHERE value_key_id IS NOT NULL) THEN
+        RAISE EXCEPTION 'profile_changes holds encrypted email changes';
+    END IF;
+END $$;
+
+ALTER TABLE profile_changes DROP COLUMN IF EXISTS value_key_id;
+ALTER TABLE profile_changes DROP COLUMN IF EXISTS new_value_encrypted;
+ALTER TABLE profile_changes DROP COLUMN IF EXISTS old_value_encrypted;
+
+DROP INDEX IF EXISTS idx_users_email_key_id;
+DROP INDEX IF EXISTS idx_users_email_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS email_key_id;
+ALTER TABLE users DROP COLUMN IF EXISTS email_encrypted;
+ALTER TABLE users DROP COLUMN IF EXISTS email_hash;
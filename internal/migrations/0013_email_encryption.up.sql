@@ -0,0 +1,19 @@
+-- Emails are sealed with envelope encryption and looked up by a keyed hash; email stays as plain
+-- text only where no key was configured
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_hash VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_encrypted BYTEA;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_key_id VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_hash ON users(email_hash);
+CREATE INDEX IF NOT EXISTS idx_users_email_key_id ON users(email_key_id);
+
+-- Email changes keep the old and new address for revert links, so they are sealed the same way
+ALTER TABLE profile_changes ADD COLUMN IF NOT EXISTS old_value_encrypted BYTEA;
+ALTER TABLE profile_changes ADD COLUMN IF NOT EXISTS new_value_encrypted BYTEA;
+ALTER TABLE profile_changes ADD COLUMN IF NOT EXISTS value_key_id VARCHAR(64);
+
+COMMENT ON COLUMN users.email_hash IS 'Hex HMAC-SHA256 of the normalized email under EMAIL_INDEX_KEY, used for lookups';
+COMMENT ON COLUMN users.email_encrypted IS 'Wrapped data key followed by the email sealed with it (AES-256-GCM)';
+COMMENT ON COLUMN users.email_key_id IS 'ID of the master key in EMAIL_ENCRYPTION_KEYS that wraps the data key';
+COMMENT ON COLUMN profile_changes.value_key_id IS 'ID of the master key in EMAIL_ENCRYPTION_KEYS when the values are sealed';
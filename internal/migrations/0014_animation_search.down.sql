@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_animations_search_vector;
+ALTER TABLE animations DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,7 @@
+-- Full-text index over descriptions for GET /search
+ALTER TABLE animations ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(description, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_animations_search_vector ON animations USING GIN (search_vector);
+
+COMMENT ON COLUMN animations.search_vector IS 'English text search vector of the description, kept up to date by PostgreSQL';
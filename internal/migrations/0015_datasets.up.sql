@@ -0,0 +1,10 @@
+-- Anonymized research datasets published at GET /datasets/latest; only the most recent few are kept
+CREATE TABLE IF NOT EXISTS datasets (
+    id SERIAL PRIMARY KEY,
+    generated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    data JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_datasets_generated_at ON datasets(generated_at);
+
+COMMENT ON TABLE datasets IS 'Anonymized animation metadata and mood statistics, regenerated periodically';
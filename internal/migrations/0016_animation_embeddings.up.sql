@@ -0,0 +1,12 @@
+-- Embeddings of animation descriptions for GET /search/semantic
+CREATE TABLE IF NOT EXISTS animation_embeddings (
+    animation_id VARCHAR(32) PRIMARY KEY REFERENCES animations(id) ON DELETE CASCADE,
+    model VARCHAR(100) NOT NULL,
+    embedding REAL[] NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_animation_embeddings_model ON animation_embeddings(model);
+
+COMMENT ON TABLE animation_embeddings IS 'Unit-length embedding of each animation description';
+COMMENT ON COLUMN animation_embeddings.model IS 'Embedding model the vector came from; vectors from other models are ignored';
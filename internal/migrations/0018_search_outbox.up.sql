@@ -0,0 +1,16 @@
+-- Animation changes waiting to be replicated into the external search index
+CREATE TABLE IF NOT EXISTS search_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL,
+    event VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_outbox_next_attempt_at ON search_outbox(next_attempt_at, id);
+
+COMMENT ON TABLE search_outbox IS 'Animation create, update and delete events, written in the same transaction as the change and removed once the search index has them';
+COMMENT ON COLUMN search_outbox.animation_id IS 'Not a foreign key, so delete events outlive the animation';
+COMMENT ON COLUMN search_outbox.next_attempt_at IS 'When the event may next be claimed; pushed back while a replicator holds it and after each failure';
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS user_notification_preferences (
+    user_id VARCHAR(32) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    events JSONB NOT NULL DEFAULT '{}',
+    quiet_start TIME,
+    quiet_end TIME,
+    quiet_timezone TEXT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE user_notification_preferences IS 'Which channels each notification event is delivered on, and the daily quiet hours deliveries wait out';
+COMMENT ON COLUMN user_notification_preferences.events IS 'Channels per event; events left out use their defaults and an empty list mutes one';
+COMMENT ON COLUMN user_notification_preferences.quiet_timezone IS 'IANA timezone quiet_start and quiet_end are read in; all three are NULL without quiet hours';
+
+-- Notifications held back by quiet hours, or waiting for a retry
+CREATE TABLE IF NOT EXISTS notification_queue (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event VARCHAR(32) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_queue_next_attempt_at ON notification_queue(next_attempt_at, id);
+
+COMMENT ON COLUMN notification_queue.next_attempt_at IS 'When the notification may next be claimed; the end of the quiet hours at first, pushed back while a dispatcher holds it and after each failure';
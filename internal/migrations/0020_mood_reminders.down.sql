@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mood_reminder_deliveries;
+DROP TABLE IF EXISTS mood_reminders;
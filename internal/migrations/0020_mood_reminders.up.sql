@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS mood_reminders (
+    user_id VARCHAR(32) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    times TEXT[] NOT NULL DEFAULT '{}',
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    next_reminder_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mood_reminders_next_reminder_at ON mood_reminders(next_reminder_at) WHERE next_reminder_at IS NOT NULL;
+
+COMMENT ON TABLE mood_reminders IS 'Daily times, in the user''s timezone, at which they are reminded to check in with their mood';
+COMMENT ON COLUMN mood_reminders.next_reminder_at IS 'When the next reminder is due, NULL without times; pushed back while a scheduler holds it';
+
+CREATE TABLE IF NOT EXISTS mood_reminder_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    animation_id VARCHAR(32) REFERENCES animations(id) ON DELETE SET NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    checked_in_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mood_reminder_deliveries_user_id ON mood_reminder_deliveries(user_id, sent_at);
+
+COMMENT ON TABLE mood_reminder_deliveries IS 'Reminders sent, with the animation they recommended, for adherence and streaks';
+COMMENT ON COLUMN mood_reminder_deliveries.checked_in_at IS 'When the user recorded a mood after the reminder, NULL while unanswered';
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS animation_versions (
+    id SERIAL PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    code_hash VARCHAR(64) NOT NULL REFERENCES code_blobs(hash),
+    p5_version VARCHAR(32),
+    source VARCHAR(16) NOT NULL,
+    restored_from INTEGER,
+    created_by VARCHAR(32),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (animation_id, version)
+);
+
+-- Earlier history was not kept, so existing animations start from their current code
+INSERT INTO animation_versions (animation_id, version, code_hash, p5_version, source, created_by, created_at)
+SELECT id, 1, code_hash, p5_version, 'created', user_id, COALESCE(updated_at, created_at)
+FROM animations
+WHERE code_hash IS NOT NULL
+ON CONFLICT (animation_id, version) DO NOTHING;
+
+COMMENT ON TABLE animation_versions IS 'Every version of an animation''s code, numbered from 1; the highest is the current code';
+COMMENT ON COLUMN animation_versions.source IS 'created, edit, fix (an applied sanitization fix) or restore';
+COMMENT ON COLUMN animation_versions.restored_from IS 'Version a restore copied, NULL for other sources';
+COMMENT ON COLUMN animation_versions.created_by IS 'Owner or admin who made the change; not a foreign key, so history outlives accounts';
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS announcements (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(120) NOT NULL,
+    body TEXT NOT NULL,
+    audience VARCHAR(16) NOT NULL DEFAULT 'all',
+    target VARCHAR(64) NOT NULL DEFAULT '',
+    starts_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at TIMESTAMP,
+    created_by VARCHAR(32),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcements_window ON announcements(starts_at, ends_at);
+
+COMMENT ON TABLE announcements IS 'Banners admins show in the app between starts_at and ends_at';
+COMMENT ON COLUMN announcements.audience IS 'all, plan (users of the account type in target) or tenant (requests for the tenant in target)';
+COMMENT ON COLUMN announcements.ends_at IS 'When the announcement stops being shown, NULL to show it until it is deleted';
+
+CREATE TABLE IF NOT EXISTS announcement_dismissals (
+    announcement_id INTEGER NOT NULL REFERENCES announcements(id) ON DELETE CASCADE,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dismissed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (announcement_id, user_id)
+);
+
+COMMENT ON TABLE announcement_dismissals IS 'Announcements each user dismissed, which are no longer shown to them';
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS incidents (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(200) NOT NULL,
+    component VARCHAR(32) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    created_by VARCHAR(32)
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_resolved_at ON incidents(resolved_at);
+
+COMMENT ON TABLE incidents IS 'Incidents admins report on GET /status';
+COMMENT ON COLUMN incidents.component IS 'database, generation or workers';
+COMMENT ON COLUMN incidents.severity IS 'minor shows the component as degraded while open, major as an outage';
+COMMENT ON COLUMN incidents.status IS 'investigating, identified, monitoring or resolved; the status of the latest update';
+
+CREATE TABLE IF NOT EXISTS incident_updates (
+    id SERIAL PRIMARY KEY,
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL,
+    message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_updates_incident_id ON incident_updates(incident_id, created_at);
+
+COMMENT ON TABLE incident_updates IS 'The public timeline of each incident, from the first report to its resolution';
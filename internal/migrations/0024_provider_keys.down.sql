@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS provider_key_usage;
+DROP TABLE IF EXISTS user_provider_keys;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS user_provider_keys (
+    user_id VARCHAR(32) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(16) NOT NULL,
+    key_encrypted BYTEA NOT NULL,
+    key_id VARCHAR(64) NOT NULL,
+    key_hint VARCHAR(8) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE user_provider_keys IS 'API keys professional users generate animations with instead of the house key';
+COMMENT ON COLUMN user_provider_keys.key_encrypted IS 'The key sealed under PROVIDER_KEY_ENCRYPTION_KEYS; it is never stored in plain text';
+COMMENT ON COLUMN user_provider_keys.key_hint IS 'The last four characters of the key, shown so users can tell which key is stored';
+
+CREATE TABLE IF NOT EXISTS provider_key_usage (
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    usage_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    provider VARCHAR(16) NOT NULL,
+    generation_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, usage_date, provider)
+);
+
+COMMENT ON TABLE provider_key_usage IS 'Generations made with users'' own keys, which do not count against generation_usage quotas';
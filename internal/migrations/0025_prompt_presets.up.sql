@@ -0,0 +1,15 @@
+-- Descriptions users save to generate from again, optionally shared in the public gallery
+CREATE TABLE IF NOT EXISTS prompt_presets (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(80) NOT NULL,
+    template TEXT NOT NULL,
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_prompt_presets_user_id ON prompt_presets(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_prompt_presets_public ON prompt_presets(created_at DESC) WHERE public;
+
+COMMENT ON COLUMN prompt_presets.template IS 'The description to generate from, with {{name}} placeholders filled in when it is applied';
@@ -0,0 +1,32 @@
+-- Team workspaces whose members share a monthly pool of generation credits
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(80) NOT NULL,
+    owner_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    monthly_credits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON COLUMN organizations.monthly_credits IS 'Generations the members may make together each month with the house key; 0 until an admin grants a subscription';
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id VARCHAR(32) NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL DEFAULT 'member',
+    monthly_limit INTEGER NOT NULL DEFAULT 0,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+COMMENT ON COLUMN organization_members.user_id IS 'Unique, as a user belongs to at most one workspace';
+COMMENT ON COLUMN organization_members.monthly_limit IS 'The member''s share of the credits each month; 0 leaves only the credits';
+
+CREATE TABLE IF NOT EXISTS organization_usage (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    usage_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    generation_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (organization_id, usage_date, user_id)
+);
+
+COMMENT ON TABLE organization_usage IS 'Generations drawn on workspace credits, which do not count against generation_usage quotas';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS signage_schedules;
@@ -0,0 +1,16 @@
+-- Playlists of time slots for lobby and waiting-room screens running the player
+CREATE TABLE IF NOT EXISTS signage_schedules (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(80) NOT NULL,
+    timezone TEXT NOT NULL,
+    slots JSONB NOT NULL DEFAULT '[]',
+    fallback_animation_id VARCHAR(32) REFERENCES animations(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_signage_schedules_user_id ON signage_schedules(user_id, created_at DESC);
+
+COMMENT ON COLUMN signage_schedules.id IS 'Random and unguessable, as screens poll the schedule by it without signing in';
+COMMENT ON COLUMN signage_schedules.slots IS 'Ordered slots of animationId, days, start and end; the first covering the current time plays';
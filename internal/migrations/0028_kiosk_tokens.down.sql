@@ -0,0 +1 @@
+DROP TABLE IF EXISTS kiosk_tokens;
@@ -0,0 +1,15 @@
+-- Long-lived tokens unattended displays read their assigned signage schedules, and the feed, with
+CREATE TABLE IF NOT EXISTS kiosk_tokens (
+    id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(80) NOT NULL,
+    schedule_ids TEXT[] NOT NULL DEFAULT '{}',
+    feed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+COMMENT ON COLUMN kiosk_tokens.token_hash IS 'SHA-256 of the token; the token itself is only shown when it is issued';
+COMMENT ON COLUMN kiosk_tokens.schedule_ids IS 'Signage schedules the display may read; schedules deleted since are skipped';
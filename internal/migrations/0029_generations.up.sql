@@ -0,0 +1,20 @@
+-- Every generation with the tokens it was billed for, so operators can see what the service costs
+CREATE TABLE IF NOT EXISTS generations (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    job_id VARCHAR(32) NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    model TEXT NOT NULL,
+    own_key BOOLEAN NOT NULL DEFAULT FALSE,
+    succeeded BOOLEAN NOT NULL,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_generations_created_at ON generations(created_at);
+CREATE INDEX IF NOT EXISTS idx_generations_user_id ON generations(user_id, created_at);
+
+COMMENT ON COLUMN generations.input_tokens IS 'Summed over every call made for the generation, including smoke-test repairs';
+COMMENT ON COLUMN generations.cost_usd IS 'At the token prices configured when it was recorded; 0 for generations with the user''s own key';
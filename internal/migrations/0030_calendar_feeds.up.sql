@@ -0,0 +1,8 @@
+-- Secret tokens calendar apps subscribe to a user's mood check-ins with, one per user
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id VARCHAR(32) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON COLUMN calendar_feeds.token_hash IS 'SHA-256 of the token; the token itself is only shown when it is issued';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS team_mood_signals;
+DROP TABLE IF EXISTS team_posts;
+DROP TABLE IF EXISTS team_integrations;
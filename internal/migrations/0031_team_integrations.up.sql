@@ -0,0 +1,43 @@
+-- Slack and Discord channels workspaces get a daily animation in, at most one per platform
+CREATE TABLE IF NOT EXISTS team_integrations (
+    id VARCHAR(32) PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    platform VARCHAR(16) NOT NULL,
+    webhook_url TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    post_time VARCHAR(5) NOT NULL,
+    timezone VARCHAR(64) NOT NULL,
+    next_post_at TIMESTAMP,
+    created_by VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, platform)
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_integrations_next_post_at ON team_integrations(next_post_at);
+
+COMMENT ON COLUMN team_integrations.secret IS 'Slack signing secret or Discord relay secret reactions are verified with; never returned by the API';
+
+-- The animations integrations posted
+CREATE TABLE IF NOT EXISTS team_posts (
+    id SERIAL PRIMARY KEY,
+    integration_id VARCHAR(32) NOT NULL REFERENCES team_integrations(id) ON DELETE CASCADE,
+    animation_id VARCHAR(32) NOT NULL,
+    message_id VARCHAR(64),
+    posted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_posts_integration_posted_at ON team_posts(integration_id, posted_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_posts_message_id ON team_posts(integration_id, message_id) WHERE message_id IS NOT NULL;
+
+COMMENT ON COLUMN team_posts.animation_id IS 'Not a foreign key, so a post outlives a deleted animation';
+
+-- Teammates' reactions to posts as anonymous moods, one per teammate and post
+CREATE TABLE IF NOT EXISTS team_mood_signals (
+    post_id INTEGER NOT NULL REFERENCES team_posts(id) ON DELETE CASCADE,
+    reactor_hash CHAR(64) NOT NULL,
+    mood VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, reactor_hash)
+);
+
+COMMENT ON COLUMN team_mood_signals.reactor_hash IS 'SHA-256 of the integration and the platform user ID; who reacted is not stored';
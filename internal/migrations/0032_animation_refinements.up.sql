@@ -0,0 +1,12 @@
+-- The conversation each animation is refined through, sent back to Claude with every follow-up
+CREATE TABLE IF NOT EXISTS animation_refinements (
+    id SERIAL PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_animation_refinements_animation_id ON animation_refinements(animation_id, id);
+
+COMMENT ON COLUMN animation_refinements.role IS 'user for the owner''s instructions, assistant for the code Claude answered with';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_moods_user_id_created_at;
+DROP INDEX IF EXISTS idx_animations_user_id_created_at;
+DROP TABLE IF EXISTS integration_keys;
@@ -0,0 +1,17 @@
+-- Keys no-code tools poll a user's integration triggers with
+CREATE TABLE IF NOT EXISTS integration_keys (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(80) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_integration_keys_user_id ON integration_keys(user_id);
+
+-- Triggers page through a user's animations and moods in the order they were saved
+CREATE INDEX IF NOT EXISTS idx_animations_user_id_created_at ON animations(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_user_moods_user_id_created_at ON user_moods(user_id, created_at, animation_id);
+
+COMMENT ON COLUMN integration_keys.key_hash IS 'SHA-256 of the key; the key itself is only shown when it is issued';
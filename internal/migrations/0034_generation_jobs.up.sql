@@ -0,0 +1,23 @@
+-- The queue POST /generate-animation adds generations to and workers run them from
+CREATE TABLE IF NOT EXISTS generation_jobs (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    description TEXT NOT NULL,
+    style TEXT NOT NULL DEFAULT '',
+    provider VARCHAR(16) NOT NULL,
+    own_key BOOLEAN NOT NULL DEFAULT FALSE,
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    claimed_until TIMESTAMP,
+    result JSONB,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_status ON generation_jobs(status, created_at);
+
+COMMENT ON COLUMN generation_jobs.status IS 'queued, generating, done or failed';
+COMMENT ON COLUMN generation_jobs.own_key IS 'Whether the job is made with the user''s own provider key, which is looked up again when it runs';
+COMMENT ON COLUMN generation_jobs.claimed_until IS 'When a generating job is taken to be abandoned by its worker and may be claimed again';
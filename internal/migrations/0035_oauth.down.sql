@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_apps;
@@ -0,0 +1,38 @@
+-- Third-party apps users can let into their account, and the codes and tokens they are issued
+CREATE TABLE IF NOT EXISTS oauth_apps (
+    client_id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(80) NOT NULL,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_apps_user_id ON oauth_apps(user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    code_hash CHAR(64) PRIMARY KEY,
+    client_id VARCHAR(32) NOT NULL REFERENCES oauth_apps(client_id) ON DELETE CASCADE,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(32) NOT NULL REFERENCES oauth_apps(client_id) ON DELETE CASCADE,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    access_hash CHAR(64) NOT NULL UNIQUE,
+    refresh_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    refresh_expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_user_id ON oauth_tokens(user_id, client_id);
+
+COMMENT ON COLUMN oauth_codes.code_hash IS 'SHA-256 of the authorization code; codes are deleted when they are exchanged';
+COMMENT ON COLUMN oauth_codes.code_challenge IS 'PKCE S256 challenge the code verifier must match';
+COMMENT ON COLUMN oauth_tokens.refresh_hash IS 'SHA-256 of the refresh token, which is replaced with the access token on every refresh';
@@ -0,0 +1,2 @@
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS trace_id;
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS request_id;
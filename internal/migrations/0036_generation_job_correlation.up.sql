@@ -0,0 +1,5 @@
+ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS request_id VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS trace_id VARCHAR(32) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN generation_jobs.request_id IS 'X-Client-Request-ID of the request that queued the job, carried into the worker''s logs, queries and Claude calls';
+COMMENT ON COLUMN generation_jobs.trace_id IS 'Trace ID of the traceparent the queueing request continued, if any';
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS animation_exports (
+    id VARCHAR(32) PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    format VARCHAR(8) NOT NULL,
+    frames INTEGER NOT NULL,
+    fps INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_animation_exports_animation_id ON animation_exports(animation_id, code_hash);
+CREATE INDEX IF NOT EXISTS idx_animation_exports_expires_at ON animation_exports(expires_at);
+
+COMMENT ON TABLE animation_exports IS 'GIF and MP4 files rendered from animations for sharing outside the web player, deleted once they expire';
+COMMENT ON COLUMN animation_exports.code_hash IS 'SHA-256 of the code the export was rendered from, so edits are exported again';
+COMMENT ON COLUMN animation_exports.frames IS 'Number of frames in the file';
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS moderation_audit_append_only ON moderation_audit;
+DROP FUNCTION IF EXISTS moderation_audit_append_only();
+DROP TABLE IF EXISTS moderation_audit;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS moderation_audit (
+    id BIGSERIAL PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL,
+    actor VARCHAR(64) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    from_state VARCHAR(32) NOT NULL,
+    to_state VARCHAR(32) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_audit_animation_id ON moderation_audit(animation_id, id);
+
+-- Entries are never changed or removed, so the trail holds up in trust & safety reviews
+CREATE OR REPLACE FUNCTION moderation_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'moderation_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS moderation_audit_append_only ON moderation_audit;
+CREATE TRIGGER moderation_audit_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON moderation_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION moderation_audit_append_only();
+
+COMMENT ON TABLE moderation_audit IS 'Append-only record of every visibility, rating and moderation change to an animation';
+COMMENT ON COLUMN moderation_audit.animation_id IS 'Not a foreign key, so the trail outlives the animations it records';
+COMMENT ON COLUMN moderation_audit.actor IS 'User ID of who made the change, or system for automated checks';
+COMMENT ON COLUMN moderation_audit.action IS 'What changed: visibility, render_status, photosensitivity or deleted';
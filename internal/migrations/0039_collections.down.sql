@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS collection_animations;
+DROP TABLE IF EXISTS collections;
@@ -0,0 +1,24 @@
+-- Galleries of animations users curate, public ones syndicated as JSON and RSS feeds
+CREATE TABLE IF NOT EXISTS collections (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(80) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_collections_user_id ON collections(user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS collection_animations (
+    collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, animation_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_collection_animations_position ON collection_animations(collection_id, position);
+
+COMMENT ON COLUMN collection_animations.position IS 'Where the curator placed the animation, from 0; feeds list animations in this order';
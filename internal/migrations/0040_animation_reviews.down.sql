@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS animation_reviews;
+ALTER TABLE organizations DROP COLUMN IF EXISTS review_required;
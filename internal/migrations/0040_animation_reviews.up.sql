@@ -0,0 +1,18 @@
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS review_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Members' animations held out of the feed and search until their workspace owner approves them
+CREATE TABLE IF NOT EXISTS animation_reviews (
+    animation_id VARCHAR(32) PRIMARY KEY REFERENCES animations(id) ON DELETE CASCADE,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    author_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    note TEXT NOT NULL DEFAULT '',
+    submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_by VARCHAR(32) REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_animation_reviews_organization ON animation_reviews(organization_id, status, submitted_at);
+CREATE INDEX IF NOT EXISTS idx_animation_reviews_author ON animation_reviews(author_id, submitted_at);
+
+COMMENT ON COLUMN animation_reviews.status IS 'pending, approved or rejected; only approved animations appear in the feed and search';
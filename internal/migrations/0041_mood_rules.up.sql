@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS mood_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(80) NOT NULL,
+    mood VARCHAR(16) NOT NULL,
+    tenant VARCHAR(64) NOT NULL DEFAULT '',
+    repeats INTEGER NOT NULL DEFAULT 1,
+    within_hours INTEGER NOT NULL DEFAULT 0,
+    actions JSONB NOT NULL DEFAULT '[]',
+    created_by VARCHAR(32),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE mood_rules IS 'Follow-ups admins configure for when users save a mood';
+COMMENT ON COLUMN mood_rules.tenant IS 'The tenant whose requests the rule applies to, empty for every request';
+COMMENT ON COLUMN mood_rules.repeats IS 'How many times the mood must be saved within within_hours for the rule to match';
+COMMENT ON COLUMN mood_rules.actions IS 'crisis_resources, suggest_animations and notify_professionals actions, run in order';
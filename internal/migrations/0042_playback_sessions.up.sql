@@ -0,0 +1,20 @@
+-- Sessions issued when an animation's code is fetched, which views and moods name so reloads and
+-- scripted views can be told apart from real playbacks
+CREATE TABLE IF NOT EXISTS playback_sessions (
+    id_hash VARCHAR(64) PRIMARY KEY,
+    animation_id VARCHAR(32) NOT NULL REFERENCES animations(id) ON DELETE CASCADE,
+    viewer_key VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    viewed_at TIMESTAMP,
+    watched_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    average_fps DOUBLE PRECISION NOT NULL DEFAULT 0,
+    suspect BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_playback_sessions_animation ON playback_sessions(animation_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_playback_sessions_created ON playback_sessions(created_at);
+
+COMMENT ON COLUMN playback_sessions.viewer_key IS 'The viewer''s user ID, or ip: and a hash of their IP when signed out';
+COMMENT ON COLUMN playback_sessions.viewed_at IS 'When the first view was reported, NULL until then';
+COMMENT ON COLUMN playback_sessions.suspect IS 'Whether the first view came too soon after the session was issued to be counted';
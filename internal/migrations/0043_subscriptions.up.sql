@@ -0,0 +1,14 @@
+-- Tags and creators users follow, to be notified when matching animations are published
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL,
+    target VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, kind, target)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_target ON subscriptions(kind, target);
+
+COMMENT ON COLUMN subscriptions.kind IS 'tag or creator';
+COMMENT ON COLUMN subscriptions.target IS 'The tag without its #, or the followed creator''s user ID';
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS impersonation_audit_append_only ON impersonation_audit;
+DROP FUNCTION IF EXISTS impersonation_audit_append_only();
+DROP TABLE IF EXISTS impersonation_audit;
+DROP TABLE IF EXISTS impersonations;
@@ -0,0 +1,46 @@
+-- Sessions admins open as users to debug their accounts, from request to end
+CREATE TABLE IF NOT EXISTS impersonations (
+    id SERIAL PRIMARY KEY,
+    admin_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    minutes INTEGER NOT NULL,
+    consent_required BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMP,
+    started_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    ended_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations(user_id, id);
+
+CREATE TABLE IF NOT EXISTS impersonation_audit (
+    id BIGSERIAL PRIMARY KEY,
+    impersonation_id INTEGER NOT NULL,
+    actor_id VARCHAR(32) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_impersonation_id ON impersonation_audit(impersonation_id, id);
+
+-- Entries are never changed or removed, so admins cannot cover what they did as a user
+CREATE OR REPLACE FUNCTION impersonation_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'impersonation_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS impersonation_audit_append_only ON impersonation_audit;
+CREATE TRIGGER impersonation_audit_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON impersonation_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION impersonation_audit_append_only();
+
+COMMENT ON COLUMN impersonations.status IS 'pending, approved, denied, active or ended';
+COMMENT ON COLUMN impersonations.token_hash IS 'Hash of the session token, set when the session starts';
+COMMENT ON TABLE impersonation_audit IS 'Append-only record of every step of an impersonation and every request made with its token';
+COMMENT ON COLUMN impersonation_audit.impersonation_id IS 'Not a foreign key, so the trail outlives the impersonations it records';
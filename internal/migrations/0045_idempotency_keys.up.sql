@@ -0,0 +1,18 @@
+-- Responses to requests sent with an Idempotency-Key, replayed to retries with the same key
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    route VARCHAR(255) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    headers JSONB NOT NULL DEFAULT '{}',
+    body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, route, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+COMMENT ON COLUMN idempotency_keys.route IS 'The method and path the key was sent to';
+COMMENT ON COLUMN idempotency_keys.status IS 'The response status, 0 while the first request is running';
@@ -0,0 +1,5 @@
+-- Reverting an email change signs the account out everywhere, since whoever changed it may still
+-- hold a session
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMP;
+
+COMMENT ON COLUMN users.sessions_revoked_at IS 'Tokens issued before this time are refused';
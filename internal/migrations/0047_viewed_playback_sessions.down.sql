@@ -0,0 +1,3 @@
+-- Sessions issued without a view were never stored, so they cannot be restored
+COMMENT ON TABLE playback_sessions IS NULL;
+COMMENT ON COLUMN playback_sessions.id_hash IS NULL;
@@ -0,0 +1,6 @@
+-- Playback sessions are signed tokens rather than rows, and a session is only stored once its first
+-- view is reported, so fetching an animation writes nothing
+DELETE FROM playback_sessions WHERE viewed_at IS NULL;
+
+COMMENT ON TABLE playback_sessions IS 'Playback sessions that led to a view, stored with their first view';
+COMMENT ON COLUMN playback_sessions.id_hash IS 'SHA-256 of the signed session token';
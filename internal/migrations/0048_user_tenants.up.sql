@@ -0,0 +1,5 @@
+-- Signed-in requests are served from the region of the tenant their account belongs to, rather
+-- than the one the client names
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant VARCHAR(100) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN users.tenant IS 'Tenant the account belongs to, empty for none or for accounts from before tenants were recorded';
@@ -1,12 +1,21 @@
 package internal
 
 import (
+	"encoding/json"
+	"slices"
 	"time"
 )
 
 // AnimationRequest represents the request for animation generation
 type AnimationRequest struct {
-	Description string `json:"description"`
+	Description string `json:"description" validate:"max=1000"`
+	// PresetID generates from one of the user's prompt presets, or a public one, instead of
+	// Description, filling its placeholders from Variables
+	PresetID  int               `json:"presetId,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	// Style is the visual style asked for, such as "pastel watercolour"; the prompt leaves the
+	// choice to the model when it is empty
+	Style string `json:"style,omitempty"`
 }
 
 // AnimationResponse represents the response with p5.js animation
@@ -17,12 +26,131 @@ type AnimationResponse struct {
 }
 
 type SaveAnimationRequest struct {
-	Code        string `json:"code"`
-	Description string `json:"description"`
+	Code        string `json:"code" validate:"required"`
+	Description string `json:"description" validate:"max=1000"`
+	P5Version   string `json:"p5Version"`
 }
 
 type SaveAnimationResponse struct {
 	ID string `json:"id"`
+	// ReviewStatus is set when the animation waits for the workspace owner's approval
+	ReviewStatus string `json:"reviewStatus,omitempty"`
+}
+
+// P5Library is a registered p5.js build that animations can be pinned to
+type P5Library struct {
+	Version   string    `json:"version"`
+	URL       string    `json:"url"`
+	Integrity string    `json:"integrity"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// P5Compatibility is one row of an animation's compatibility matrix: whether its code runs on a major p5.js version
+type P5Compatibility struct {
+	Major      int                    `json:"major"`
+	Compatible bool                   `json:"compatible"`
+	Issues     []P5CompatibilityIssue `json:"issues"`
+}
+
+// P5CompatibilityIssue is a use of an API that a major p5.js version removed, changed or does not have yet
+type P5CompatibilityIssue struct {
+	API     string `json:"api"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	// Fixable is true when a migration run can rewrite the code automatically
+	Fixable bool `json:"fixable"`
+}
+
+// UserAnimation is one of the caller's own animations, with the state only its owner sees
+type UserAnimation struct {
+	GetAnimationResponse
+	RenderStatus     string    `json:"renderStatus"`
+	Photosensitivity string    `json:"photosensitivity"`
+	Removed          bool      `json:"removed"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// MyAnimationsResponse is one page of the caller's animations, newest first
+type MyAnimationsResponse struct {
+	Animations []UserAnimation `json:"animations"`
+	Total      int             `json:"total"`
+	Limit      int             `json:"limit"`
+	Offset     int             `json:"offset"`
+	NextOffset *int            `json:"nextOffset,omitempty"`
+}
+
+// PreviewFrame is one pre-rendered frame of an animation
+type PreviewFrame struct {
+	Frame int    `json:"frame"`
+	PNG   []byte `json:"-"`
+	// Image is a data:image/png;base64 URL of the frame
+	Image string `json:"image"`
+}
+
+// PreviewFramesResponse is a set of evenly spaced frames for a scrubbable preview
+type PreviewFramesResponse struct {
+	AnimationID string         `json:"animationId"`
+	Frames      []PreviewFrame `json:"frames"`
+}
+
+// ExportRequest asks for an animation to be rendered into a file. Zero Frames and FPS use the defaults.
+type ExportRequest struct {
+	Format string `json:"format"`
+	Frames int    `json:"frames"`
+	FPS    int    `json:"fps"`
+}
+
+// AnimationExport is a GIF or MP4 rendered from an animation, downloadable from URL until ExpiresAt
+type AnimationExport struct {
+	ID          string    `json:"id"`
+	AnimationID string    `json:"animationId"`
+	CodeHash    string    `json:"-"`
+	Format      string    `json:"format"`
+	Frames      int       `json:"frames"`
+	FPS         int       `json:"fps"`
+	SizeBytes   int       `json:"sizeBytes"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// RegisterP5LibraryRequest represents an admin request to register a p5.js build
+type RegisterP5LibraryRequest struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+}
+
+// UpdateAnimationRequest represents an owner's edit of an animation. Omitted fields are left unchanged.
+type UpdateAnimationRequest struct {
+	Code        *string `json:"code"`
+	Description *string `json:"description" validate:"max=1000"`
+	ChangeNote  string  `json:"changeNote" validate:"max=280"`
+}
+
+// ChangelogEntry is one "what changed" note recorded when an animation was edited
+type ChangelogEntry struct {
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Sources of animation versions
+const (
+	VersionCreated  = "created"
+	VersionEdited   = "edit"
+	VersionFixed    = "fix"
+	VersionRestored = "restore"
+)
+
+// AnimationVersion is one version of an animation's code, numbered from 1 in the order they were
+// saved. Code is only set when a single version is requested.
+type AnimationVersion struct {
+	Version      int       `json:"version"`
+	Source       string    `json:"source"`
+	P5Version    string    `json:"p5Version,omitempty"`
+	RestoredFrom *int      `json:"restoredFrom,omitempty"`
+	Current      bool      `json:"current"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Code         string    `json:"code,omitempty"`
 }
 
 type GetAnimationRequest struct {
@@ -33,9 +161,309 @@ type GetAnimationResponse struct {
 	ID          string `json:"id"`
 	Code        string `json:"code"`
 	Description string `json:"description"`
+	P5Version   string `json:"p5Version,omitempty"`
+	P5URL       string `json:"p5Url,omitempty"`
+	P5Integrity string `json:"p5Integrity,omitempty"`
+	// Moods summarizes how viewers felt after watching; set by the handlers that serve animations
+	Moods *MoodSummary `json:"moods,omitempty"`
+	// PlaybackSession identifies this playback in the views and moods it leads to; set from v2 on by
+	// GET /animation/{id} and the feed
+	PlaybackSession string `json:"playbackSession,omitempty"`
+}
+
+// AnimationV1 is an animation as the v1 contract returns it
+type AnimationV1 struct {
+	Code string `json:"code"`
+}
+
+// AnimationFeedV1 is a page of the feed as the v1 contract returns it
+type AnimationFeedV1 struct {
+	Animations []AnimationV1 `json:"animations"`
+	Total      int           `json:"total"`
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+	NextOffset *int          `json:"nextOffset,omitempty"`
+}
+
+// MoodSummary aggregates the moods recorded for an animation. Counts and NetPositivity are
+// withheld when too few people recorded a mood for them to stay anonymous.
+type MoodSummary struct {
+	Counts map[Mood]int `json:"counts,omitempty"`
+	Total  int          `json:"total"`
+	// NetPositivity runs from -1 when everyone felt much worse to 1 when everyone felt much better
+	NetPositivity *float64 `json:"netPositivity,omitempty"`
+	Suppressed    bool     `json:"suppressed,omitempty"`
+}
+
+// FeedFilter narrows the animations the feed may show for a viewer
+type FeedFilter struct {
+	// ReducedMotion limits the feed to animations screened as safe whose motion score is at most MaxMotionScore
+	ReducedMotion  bool
+	MaxMotionScore float64
+	// AvoidFlashing also leaves out animations that have not been screened for flashing yet
+	AvoidFlashing bool
+}
+
+// ContentPreferences are a user's playback preferences. The feed honors ReduceMotion and
+// AvoidFlashing when choosing animations; MuteSound tells players to start sketches muted.
+type ContentPreferences struct {
+	ReduceMotion  bool `json:"reduceMotion"`
+	AvoidFlashing bool `json:"avoidFlashing"`
+	MuteSound     bool `json:"muteSound"`
+}
+
+// NotificationEvent is a kind of notification users can choose channels for
+type NotificationEvent string
+
+// NotificationChannel is a way of delivering notifications
+type NotificationChannel string
+
+// NotificationPreferences choose how a user is notified. Events lists the channels each event is
+// delivered on, an empty list muting it; QuietHours, when set, holds deliveries back until they end.
+type NotificationPreferences struct {
+	Events     map[NotificationEvent][]NotificationChannel `json:"events"`
+	QuietHours *QuietHours                                 `json:"quietHours,omitempty"`
+}
+
+// QuietHours is a daily window, in the user's timezone, during which notifications wait. Start and
+// End are "15:04" times; a window whose end is before its start runs past midnight.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// Notification is a message waiting in the notification queue
+type Notification struct {
+	ID           int64
+	UserID       string
+	Event        NotificationEvent
+	Channel      NotificationChannel
+	Subject      string
+	Body         string
+	DeliverAfter time.Time
+	// Attempts counts the deliveries tried so far, including the one the notification was claimed for
+	Attempts int
+}
+
+// ReminderSchedule is when a user is reminded to check in with their mood: every day at each of
+// Times, "15:04" times in Timezone. No times turns reminders off.
+type ReminderSchedule struct {
+	Times    []string `json:"times"`
+	Timezone string   `json:"timezone"`
+}
+
+// DueReminder is a user whose next mood check-in reminder is due
+type DueReminder struct {
+	UserID   string
+	Schedule ReminderSchedule
+}
+
+// ReminderDelivery is a reminder sent to a user, answered when they recorded a mood soon after
+type ReminderDelivery struct {
+	AnimationID string
+	SentAt      time.Time
+	CheckedInAt *time.Time
+}
+
+// ReminderAdherence summarizes how many recent reminders were answered with a mood check-in
+type ReminderAdherence struct {
+	Days      int `json:"days"`
+	Sent      int `json:"sent"`
+	CheckedIn int `json:"checkedIn"`
+	// Streak counts the days in a row, up to today, on which a reminder was answered
+	Streak int `json:"streak"`
+}
+
+// RemindersResponse is a user's reminder schedule and how well they kept up with it
+type RemindersResponse struct {
+	ReminderSchedule
+	NextReminderAt *time.Time        `json:"nextReminderAt,omitempty"`
+	Adherence      ReminderAdherence `json:"adherence"`
+}
+
+// AnnouncementAudience names who an announcement is shown to
+type AnnouncementAudience string
+
+// Announcement is a banner admins show in the app to an audience between StartsAt and EndsAt
+type Announcement struct {
+	ID       int                  `json:"id"`
+	Title    string               `json:"title"`
+	Body     string               `json:"body"`
+	Audience AnnouncementAudience `json:"audience"`
+	// Target is the account type of a plan audience or the tenant of a tenant audience
+	Target    string     `json:"target,omitempty"`
+	StartsAt  time.Time  `json:"startsAt"`
+	EndsAt    *time.Time `json:"endsAt,omitempty"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	// Dismissals counts the users who dismissed the announcement, for admins
+	Dismissals int `json:"dismissals,omitempty"`
+}
+
+// AnnouncementRequest represents an admin creating or replacing an announcement. Without StartsAt
+// it is shown right away, and without EndsAt until it is deleted.
+type AnnouncementRequest struct {
+	Title    string               `json:"title"`
+	Body     string               `json:"body"`
+	Audience AnnouncementAudience `json:"audience"`
+	Target   string               `json:"target"`
+	StartsAt *time.Time           `json:"startsAt"`
+	EndsAt   *time.Time           `json:"endsAt"`
+}
+
+// IncidentUpdate is one entry in an incident's public timeline
+type IncidentUpdate struct {
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Incident is an outage or degradation of a component that admins report on GET /status
+type Incident struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Component  string     `json:"component"`
+	Severity   string     `json:"severity"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"startedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	CreatedBy  string     `json:"-"`
+	// Updates are newest first
+	Updates []IncidentUpdate `json:"updates"`
+}
+
+// CreateIncidentRequest represents an admin reporting an incident with its first update
+type CreateIncidentRequest struct {
+	Title     string `json:"title"`
+	Component string `json:"component"`
+	Severity  string `json:"severity"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+}
+
+// IncidentUpdateRequest represents an admin adding an update to an incident; status resolved ends it
+type IncidentUpdateRequest struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// ComponentStatus is how one component of the service is doing
+type ComponentStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// FeatureStatus is whether an optional feature is on, and why not when it is off
+type FeatureStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Mode is how FEATURE_FLAGS configures the feature: auto, on or off
+	Mode    string `json:"mode"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// StatusResponse is returned by GET /status: the worst status of any component, each component,
+// the optional features and whether they are on, and the open and recently resolved incidents
+type StatusResponse struct {
+	Status      string            `json:"status"`
+	Components  []ComponentStatus `json:"components"`
+	Features    []FeatureStatus   `json:"features"`
+	Incidents   []Incident        `json:"incidents"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+}
+
+// WidgetAnimation is the animation of the moment served to embedded widgets by GET /widget/random.json.
+// Every caller gets the same animation until ExpiresAt.
+type WidgetAnimation struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Code        string    `json:"code"`
+	P5URL       string    `json:"p5Url,omitempty"`
+	P5Integrity string    `json:"p5Integrity,omitempty"`
+	URL         string    `json:"url"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// GetAnimationFeedResponse is one page of the feed, newest animations first
+type GetAnimationFeedResponse struct {
+	Animations []GetAnimationResponse `json:"animations"`
+	Total      int                    `json:"total"`
+	Limit      int                    `json:"limit"`
+	Offset     int                    `json:"offset"`
+	NextOffset *int                   `json:"nextOffset,omitempty"`
 }
 
-type GetAnimationFeedResponse []GetAnimationResponse
+// SearchAnimationsResponse is one page of search results, best match first
+type SearchAnimationsResponse struct {
+	Query      string                 `json:"query"`
+	Animations []GetAnimationResponse `json:"animations"`
+	Total      int                    `json:"total"`
+	Limit      int                    `json:"limit"`
+	Offset     int                    `json:"offset"`
+	NextOffset *int                   `json:"nextOffset,omitempty"`
+	// Facets counts all matches per p5.js version; only external search backends report them
+	Facets map[string]map[string]int `json:"facets,omitempty"`
+}
+
+// DatasetAnimation is one animation in the research dataset. It carries no user identifiers, and
+// its creation time is coarsened to the week.
+type DatasetAnimation struct {
+	ID               string       `json:"id"`
+	Description      string       `json:"description"`
+	P5Version        string       `json:"p5Version,omitempty"`
+	RenderStatus     string       `json:"renderStatus"`
+	Photosensitivity string       `json:"photosensitivity"`
+	CreatedWeek      time.Time    `json:"createdWeek"`
+	MoodCounts       map[Mood]int `json:"moodCounts,omitempty"`
+	MoodTotal        int          `json:"moodTotal"`
+	// MoodsSuppressed is set when too few moods were recorded to publish them
+	MoodsSuppressed bool `json:"moodsSuppressed,omitempty"`
+}
+
+// Dataset is the anonymized research dataset published at GET /datasets/latest
+type Dataset struct {
+	GeneratedAt  time.Time          `json:"generatedAt"`
+	MinGroupSize int                `json:"minGroupSize"`
+	Animations   []DatasetAnimation `json:"animations"`
+	MoodTotals   map[Mood]int       `json:"moodTotals,omitempty"`
+}
+
+// AnimationEmbedding is the unit-length embedding of an animation's description
+type AnimationEmbedding struct {
+	AnimationID string
+	Vector      []float32
+}
+
+// DescribedAnimation is an animation's ID and description
+type DescribedAnimation struct {
+	ID          string
+	Description string
+}
+
+// ScoredAnimation is a semantic search match and its cosine similarity to the query
+type ScoredAnimation struct {
+	ID         string
+	Similarity float64
+}
+
+// SemanticSearchResult is an animation found by semantic search
+type SemanticSearchResult struct {
+	GetAnimationResponse
+	Similarity float64 `json:"similarity"`
+}
+
+// SemanticSearchResponse is one page of semantic search results, most similar first
+type SemanticSearchResponse struct {
+	Query      string                 `json:"query"`
+	Results    []SemanticSearchResult `json:"results"`
+	Total      int                    `json:"total"`
+	Limit      int                    `json:"limit"`
+	Offset     int                    `json:"offset"`
+	NextOffset *int                   `json:"nextOffset,omitempty"`
+}
 
 type FixAnimationRequest struct {
 	BrokenCode   string `json:"broken_code"`
@@ -44,9 +472,9 @@ type FixAnimationRequest struct {
 
 // RegisterRequest represents the user registration request
 type RegisterRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
 }
 
 // RegisterResponse represents the response after successful registration
@@ -57,8 +485,8 @@ type RegisterResponse struct {
 
 // LoginRequest represents the user login request
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 // LoginResponse represents the response after successful login
@@ -67,20 +495,57 @@ type LoginResponse struct {
 	User  User   `json:"user"`
 }
 
+// UpdateProfileRequest represents a request to change the user's profile.
+// Empty fields are left unchanged.
+type UpdateProfileRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email" validate:"email"`
+}
+
+// MagicLinkRequest represents a request to email a passwordless login link
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkResponse represents the response after a login link was requested
+type MagicLinkResponse struct {
+	Success bool `json:"success"`
+}
+
 // User represents user information
 type User struct {
 	ID        string     `json:"id"`
 	Username  string     `json:"username"`
 	Email     string     `json:"email"`
 	LastLogin *time.Time `json:"lastLogin,omitempty"`
+	// Tenant is the tenant the account belongs to, whose region its data lives in
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // Claude API request structure
 type ClaudeRequest struct {
-	Model       string          `json:"model"`
-	Messages    []ClaudeMessage `json:"messages"`
-	MaxTokens   int             `json:"max_tokens"`
-	Temperature float64         `json:"temperature"`
+	Model string `json:"model"`
+	// System holds the instructions that apply to every message, apart from the conversation
+	System      []ClaudeSystemBlock `json:"system,omitempty"`
+	Messages    []ClaudeMessage     `json:"messages"`
+	MaxTokens   int                 `json:"max_tokens"`
+	Temperature float64             `json:"temperature"`
+	// Stream asks for the reply as server-sent events
+	Stream bool `json:"stream,omitempty"`
+}
+
+// ClaudeSystemBlock is a block of text in a Claude request's system prompt. CacheControl marks the
+// end of a prompt prefix Claude caches, so later calls starting with the same prefix are read from
+// the cache, which is cheaper and faster.
+type ClaudeSystemBlock struct {
+	Type         string              `json:"type"`
+	Text         string              `json:"text"`
+	CacheControl *ClaudeCacheControl `json:"cache_control,omitempty"`
+}
+
+// ClaudeCacheControl asks Claude to cache the prompt up to the block it is set on
+type ClaudeCacheControl struct {
+	Type string `json:"type"`
 }
 
 // ClaudeMessage represents a message in the Claude conversation
@@ -92,6 +557,16 @@ type ClaudeMessage struct {
 // Claude API response structure
 type ClaudeResponse struct {
 	Content []ClaudeContent `json:"content"`
+	Usage   ClaudeUsage     `json:"usage"`
+}
+
+// ClaudeUsage is the tokens a Claude call was billed for. InputTokens leaves out the prompt tokens
+// written to or read from the prompt cache, which are billed at other prices.
+type ClaudeUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 // ClaudeContent represents content in Claude's response
@@ -100,6 +575,680 @@ type ClaudeContent struct {
 	Text string `json:"text"`
 }
 
+// ClaudeStreamEvent is the data of one server-sent event in a streamed Claude reply. Text arrives
+// in content_block_delta events; an error event ends the stream early.
+type ClaudeStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+	// Message carries the input tokens in the message_start event, and Usage the output tokens
+	// in message_delta events
+	Message struct {
+		Usage ClaudeUsage `json:"usage"`
+	} `json:"message"`
+	Usage ClaudeUsage `json:"usage"`
+}
+
+// GenerationProgress is the data of a progress event on POST /generate-animation/stream
+type GenerationProgress struct {
+	Stage string `json:"stage"`
+}
+
+// GenerationChunk is the data of a chunk event on POST /generate-animation/stream: the next piece
+// of the raw code as Claude writes it
+type GenerationChunk struct {
+	Text string `json:"text"`
+}
+
+// GenerationUpdate reports a step of one of the user's generations to their WebSocket connections
+// on GET /ws. Code is set when the generation is done and Error when it failed.
+type GenerationUpdate struct {
+	JobID  string    `json:"jobId"`
+	Status string    `json:"status"`
+	Code   string    `json:"code,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// GenerationJob is a generation queued by POST /generate-animation, as GET /jobs/{id} reports it.
+// Status runs from queued through generating to done, with Result set, or failed, with Error set.
+type GenerationJob struct {
+	ID        string             `json:"id"`
+	Status    string             `json:"status"`
+	Result    *AnimationResponse `json:"result,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+// QueuedGeneration is a generation job as a worker claims it. The key it is made with is looked up
+// again when it runs, so provider keys are never stored with the job. Attempts counts the claims
+// including this one.
+type QueuedGeneration struct {
+	ID             string
+	UserID         string
+	Description    string
+	Style          string
+	Provider       string
+	OwnKey         bool
+	OrganizationID int
+	Attempts       int
+	// Correlation is the request that queued the job, which the worker's calls are traced to
+	Correlation Correlation
+}
+
+// PromptPreset is a description a user saved to generate from again. Each {{name}} in Template is
+// a placeholder filled in when the preset is applied.
+type PromptPreset struct {
+	ID           int       `json:"id"`
+	UserID       string    `json:"userId"`
+	Username     string    `json:"username,omitempty"`
+	Name         string    `json:"name"`
+	Template     string    `json:"template"`
+	Placeholders []string  `json:"placeholders"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// PromptPresetRequest represents a user saving or replacing a prompt preset
+type PromptPresetRequest struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	Public   bool   `json:"public"`
+}
+
+// Collection is a gallery of animations a user curated, in the order they chose. Public
+// collections are syndicated as feeds other sites can read without signing in.
+type Collection struct {
+	ID           int       `json:"id"`
+	UserID       string    `json:"userId"`
+	Username     string    `json:"username,omitempty"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Public       bool      `json:"public"`
+	AnimationIDs []string  `json:"animationIds"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// CollectionRequest represents a user saving or replacing a collection
+type CollectionRequest struct {
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Public       bool     `json:"public"`
+	AnimationIDs []string `json:"animationIds"`
+}
+
+// CollectionsResponse is a page of collections, newest first
+type CollectionsResponse struct {
+	Collections []Collection `json:"collections"`
+	Total       int          `json:"total"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+	NextOffset  *int         `json:"nextOffset,omitempty"`
+}
+
+// CollectionAnimation is an animation in a collection's feed, with when it was added
+type CollectionAnimation struct {
+	ID          string
+	Description string
+	AddedAt     time.Time
+}
+
+// JSONFeed is a page of a collection's feed in the JSON Feed 1.1 format (https://jsonfeed.org)
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+// JSONFeedAuthor is the curator of a collection
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// JSONFeedItem is an animation in a JSON feed. URL is its embeddable player, and the attachment
+// its code for pages that load p5.js themselves.
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	Image         string               `json:"image"`
+	DatePublished time.Time            `json:"date_published"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+// JSONFeedAttachment is a file belonging to a JSON feed item
+type JSONFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+// PromptPresetsResponse is a page of prompt presets, newest first
+type PromptPresetsResponse struct {
+	Presets    []PromptPreset `json:"presets"`
+	Total      int            `json:"total"`
+	Limit      int            `json:"limit"`
+	Offset     int            `json:"offset"`
+	NextOffset *int           `json:"nextOffset,omitempty"`
+}
+
+// ProviderKeyRequest stores a user's own API key for a generation provider
+type ProviderKeyRequest struct {
+	Provider string `json:"provider"`
+	Key      string `json:"key"`
+}
+
+// ProviderKey is a user's own API key, sealed for storage. Responses show only its last four
+// characters and how often it was used.
+type ProviderKey struct {
+	Provider             string    `json:"provider"`
+	Hint                 string    `json:"hint"`
+	UpdatedAt            time.Time `json:"updatedAt"`
+	GenerationsToday     int       `json:"generationsToday"`
+	GenerationsThisMonth int       `json:"generationsThisMonth"`
+	KeyID                string    `json:"-"`
+	Encrypted            []byte    `json:"-"`
+}
+
+// GenerationQuota describes a user's generation usage. Remaining counts are -1 when the limit is 0 (unlimited).
+type GenerationQuota struct {
+	DailyLimit       int `json:"dailyLimit"`
+	DailyUsed        int `json:"dailyUsed"`
+	DailyRemaining   int `json:"dailyRemaining"`
+	MonthlyLimit     int `json:"monthlyLimit"`
+	MonthlyUsed      int `json:"monthlyUsed"`
+	MonthlyRemaining int `json:"monthlyRemaining"`
+}
+
+// Organization is a team workspace. While it has monthly credits, its members' generations with
+// the house key draw on them instead of on their own quotas.
+type Organization struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	OwnerID string `json:"ownerId"`
+	// MonthlyCredits is how many generations the members may make together each month; 0 until an
+	// admin grants the workspace a subscription
+	MonthlyCredits int `json:"monthlyCredits"`
+	// ReviewRequired holds members' new animations out of the feed until the owner approves them
+	ReviewRequired bool                 `json:"reviewRequired"`
+	CreatedAt      time.Time            `json:"createdAt"`
+	Members        []OrganizationMember `json:"members,omitempty"`
+}
+
+// OrganizationMember is a user in a workspace
+type OrganizationMember struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// MonthlyLimit caps the member's share of the credits each month; 0 leaves only the credits
+	MonthlyLimit int       `json:"monthlyLimit"`
+	JoinedAt     time.Time `json:"joinedAt"`
+}
+
+// OrganizationRequest represents a user creating a workspace
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// OrganizationReviewRequest represents a workspace owner turning the review of members' animations on or off
+type OrganizationReviewRequest struct {
+	ReviewRequired bool `json:"reviewRequired"`
+}
+
+// AnimationReview is a workspace member's animation waiting for, or given, the owner's decision
+// before it appears in the feed
+type AnimationReview struct {
+	AnimationID    string     `json:"animationId"`
+	OrganizationID int        `json:"organizationId"`
+	AuthorID       string     `json:"authorId"`
+	AuthorUsername string     `json:"authorUsername"`
+	Description    string     `json:"description"`
+	Status         string     `json:"status"`
+	Note           string     `json:"note,omitempty"`
+	SubmittedAt    time.Time  `json:"submittedAt"`
+	ReviewedBy     string     `json:"reviewedBy,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewedAt,omitempty"`
+}
+
+// AnimationReviewFilter narrows the reviews listed; zero fields match every review
+type AnimationReviewFilter struct {
+	OrganizationID int
+	AuthorID       string
+	Status         string
+}
+
+// AnimationReviewsResponse is a page of animation reviews, oldest submission first
+type AnimationReviewsResponse struct {
+	Reviews    []AnimationReview `json:"reviews"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+	NextOffset *int              `json:"nextOffset,omitempty"`
+}
+
+// ReviewDecisionRequest represents a workspace owner approving or rejecting a member's animation
+type ReviewDecisionRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// OrganizationMemberRequest represents a workspace owner adding a member or changing their limit;
+// Email is only read when adding
+type OrganizationMemberRequest struct {
+	Email        string `json:"email,omitempty" validate:"email"`
+	MonthlyLimit int    `json:"monthlyLimit" validate:"min=0"`
+}
+
+// OrganizationCreditsRequest represents an admin setting a workspace's monthly credits
+type OrganizationCreditsRequest struct {
+	MonthlyCredits int `json:"monthlyCredits" validate:"min=0"`
+}
+
+// OrganizationUsage reports how a workspace's credits were used in one month. Used counts every
+// generation drawn on the credits, including those of members who since left.
+type OrganizationUsage struct {
+	OrganizationID int                       `json:"organizationId"`
+	Month          string                    `json:"month"`
+	MonthlyCredits int                       `json:"monthlyCredits"`
+	Used           int                       `json:"used"`
+	Remaining      int                       `json:"remaining"`
+	Members        []OrganizationMemberUsage `json:"members"`
+}
+
+// OrganizationMemberUsage is one member's share of a workspace's monthly usage. Remaining is -1
+// when the member has no limit of their own.
+type OrganizationMemberUsage struct {
+	UserID       string `json:"userId"`
+	Username     string `json:"username"`
+	MonthlyLimit int    `json:"monthlyLimit"`
+	Used         int    `json:"used"`
+	Remaining    int    `json:"remaining"`
+}
+
+// SignageSlot plays an animation on a digital signage screen from Start until End, written HH:MM
+// in the schedule's timezone, with End "24:00" for midnight. Days limits it to some weekdays,
+// written mon to sun; without days it applies every day.
+type SignageSlot struct {
+	AnimationID string   `json:"animationId"`
+	Days        []string `json:"days,omitempty"`
+	Start       string   `json:"start"`
+	End         string   `json:"end"`
+}
+
+// SignageSchedule is a playlist of time slots for lobby and waiting-room screens. Its ID is
+// unguessable, since screens poll it without signing in.
+type SignageSchedule struct {
+	ID       string        `json:"id"`
+	UserID   string        `json:"userId"`
+	Name     string        `json:"name"`
+	Timezone string        `json:"timezone"`
+	Slots    []SignageSlot `json:"slots"`
+	// FallbackAnimationID plays when no slot applies
+	FallbackAnimationID string    `json:"fallbackAnimationId,omitempty"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+// SignageScheduleRequest represents a user creating or replacing a signage schedule
+type SignageScheduleRequest struct {
+	Name                string        `json:"name"`
+	Timezone            string        `json:"timezone"`
+	Slots               []SignageSlot `json:"slots"`
+	FallbackAnimationID string        `json:"fallbackAnimationId,omitempty"`
+}
+
+// SignageSchedulesResponse lists a user's signage schedules, newest first
+type SignageSchedulesResponse struct {
+	Schedules []SignageSchedule `json:"schedules"`
+}
+
+// SignageNowPlaying is what a signage screen should play now. AnimationID is empty when nothing
+// is scheduled; Until is the next time the answer may change.
+type SignageNowPlaying struct {
+	ScheduleID  string    `json:"scheduleId"`
+	AnimationID string    `json:"animationId,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Until       time.Time `json:"until"`
+}
+
+// GenerationRecord is one generation as it was billed: the tokens of every call made for it,
+// including smoke-test repairs, and what they cost with the house key. Generations with a user's
+// own key cost the service nothing.
+type GenerationRecord struct {
+	UserID       string
+	JobID        string
+	Provider     string
+	Model        string
+	OwnKey       bool
+	Succeeded    bool
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+	CreatedAt    time.Time
+}
+
+// IdempotencyKey is the Idempotency-Key a user sent on a route, with the response to the request
+// that first used it. Status is 0 until that request completes.
+type IdempotencyKey struct {
+	UserID string
+	// Route is the method and path the key was sent to
+	Route string
+	Key   string
+	// RequestHash is the hash of the request body, so a key is not replayed for another request
+	RequestHash string
+	Status      int
+	Headers     map[string]string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// GenerationCosts adds up the generations in a cost report
+type GenerationCosts struct {
+	Generations  int     `json:"generations"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+// UserGenerationCosts is one user's share of a cost report
+type UserGenerationCosts struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	GenerationCosts
+}
+
+// CostReport is what generations cost between From and To, open ended when they are left out,
+// for everyone or for one user. The report for everyone also lists the users who cost the most.
+type CostReport struct {
+	From   *time.Time            `json:"from,omitempty"`
+	To     *time.Time            `json:"to,omitempty"`
+	UserID string                `json:"userId,omitempty"`
+	Totals GenerationCosts       `json:"totals"`
+	Users  []UserGenerationCosts `json:"users,omitempty"`
+}
+
+// RefineRequest asks for a change to a saved animation, following on from the earlier ones
+type RefineRequest struct {
+	Instruction string `json:"instruction"`
+}
+
+// RefinementTurn is one message of the conversation an animation is refined through: the owner's
+// instruction, or the code Claude answered with
+type RefinementTurn struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TeamIntegration posts a daily animation to a workspace's Slack or Discord channel and collects
+// teammates' emoji reactions to it as anonymous mood signals. WebhookURL and Secret are never
+// returned; RelaySecret is set once, when a Discord integration is configured.
+type TeamIntegration struct {
+	ID             string     `json:"id"`
+	OrganizationID int        `json:"organizationId"`
+	Platform       string     `json:"platform"`
+	WebhookURL     string     `json:"-"`
+	Secret         string     `json:"-"`
+	PostTime       string     `json:"postTime"`
+	Timezone       string     `json:"timezone"`
+	NextPostAt     *time.Time `json:"nextPostAt,omitempty"`
+	CreatedBy      string     `json:"createdBy"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	// EventsURL is where the platform, or a relay, sends reactions
+	EventsURL   string `json:"eventsUrl,omitempty"`
+	RelaySecret string `json:"relaySecret,omitempty"`
+}
+
+// TeamIntegrationRequest configures a workspace's integration. PostTime is a local "15:04" time,
+// 09:00 by default; SigningSecret is the Slack app's, which Slack signs reaction events with.
+type TeamIntegrationRequest struct {
+	WebhookURL    string `json:"webhookUrl"`
+	PostTime      string `json:"postTime"`
+	Timezone      string `json:"timezone"`
+	SigningSecret string `json:"signingSecret"`
+}
+
+// TeamPost is a daily animation posted by a team integration, with the moods teammates reacted with
+type TeamPost struct {
+	ID            int    `json:"id"`
+	IntegrationID string `json:"-"`
+	AnimationID   string `json:"animationId"`
+	// MessageID is the platform's ID of the message, when it tells the poster
+	MessageID string       `json:"-"`
+	PostedAt  time.Time    `json:"postedAt"`
+	Counts    map[Mood]int `json:"-"`
+	Moods     MoodSummary  `json:"moods"`
+}
+
+// TeamIntegrationReport is a workspace's integration with its latest posts, newest first
+type TeamIntegrationReport struct {
+	Integration TeamIntegration `json:"integration"`
+	Posts       []TeamPost      `json:"posts"`
+}
+
+// TeamReaction is a Discord reaction forwarded by a relay, which signs it with the integration's
+// relay secret. Removed is set when the reaction was taken back.
+type TeamReaction struct {
+	MessageID string `json:"messageId"`
+	Emoji     string `json:"emoji"`
+	UserID    string `json:"userId"`
+	Removed   bool   `json:"removed"`
+}
+
+// KioskToken lets an unattended display read the signage schedules assigned to it, and the feed
+// when Feed is set, and nothing else. Only a hash of the token is stored; Token is set once, when
+// the token is issued.
+type KioskToken struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	ScheduleIDs []string   `json:"scheduleIds"`
+	Feed        bool       `json:"feed"`
+	CreatedBy   string     `json:"createdBy"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	Token       string     `json:"token,omitempty"`
+}
+
+// KioskTokenRequest represents an administrator issuing a kiosk token or changing what it may
+// read. ExpiresInDays of 0 issues a token that does not expire.
+type KioskTokenRequest struct {
+	Name          string   `json:"name"`
+	ScheduleIDs   []string `json:"scheduleIds"`
+	Feed          bool     `json:"feed"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"`
+}
+
+// KioskTokensResponse lists the kiosk tokens issued, newest first
+type KioskTokensResponse struct {
+	Tokens []KioskToken `json:"tokens"`
+}
+
+// ImpersonationRequest represents an admin asking to view the service as a user, to debug their
+// account. Minutes of 0 asks for the default of 15.
+type ImpersonationRequest struct {
+	Reason  string `json:"reason" validate:"required,max=500"`
+	Minutes int    `json:"minutes,omitempty" validate:"min=0,max=60"`
+	// RequireConsent waits for the user's approval, which IMPERSONATION_REQUIRE_CONSENT always does
+	RequireConsent bool `json:"requireConsent,omitempty"`
+}
+
+// Impersonation is an admin's session as a user, from the request through the user's approval, when
+// it needs one, to its end. Only the hash of its token is stored.
+type Impersonation struct {
+	ID              int        `json:"id"`
+	AdminID         string     `json:"adminId"`
+	UserID          string     `json:"userId"`
+	Reason          string     `json:"reason"`
+	Minutes         int        `json:"minutes"`
+	ConsentRequired bool       `json:"consentRequired"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	DecidedAt       *time.Time `json:"decidedAt,omitempty"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"`
+	EndedAt         *time.Time `json:"endedAt,omitempty"`
+	// Token is only returned to the admin when the session starts
+	Token string `json:"token,omitempty"`
+}
+
+// ImpersonationsResponse lists impersonations, newest first
+type ImpersonationsResponse struct {
+	Impersonations []Impersonation `json:"impersonations"`
+}
+
+// ImpersonationAuditEntry records one thing done to or in an impersonation
+type ImpersonationAuditEntry struct {
+	ID              int64  `json:"id"`
+	ImpersonationID int    `json:"impersonationId"`
+	ActorID         string `json:"actorId"`
+	Action          string `json:"action"`
+	// Detail is the admin's reason when the impersonation was requested, or the method, path and
+	// status of a request made with its token
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// KioskAssignment is what a kiosk token may read, as the display sees it
+type KioskAssignment struct {
+	Name        string   `json:"name"`
+	ScheduleIDs []string `json:"scheduleIds"`
+	Feed        bool     `json:"feed"`
+}
+
+// SanitizationRun is a pass of the current sanitizer over all stored animations
+type SanitizationRun struct {
+	ID              int               `json:"id"`
+	CreatedBy       string            `json:"createdBy"`
+	Status          string            `json:"status"`
+	TargetP5Version string            `json:"targetP5Version,omitempty"` // set when the run migrates animations to another p5.js version
+	Scanned         int               `json:"scanned"`
+	Changed         int               `json:"changed"`
+	Error           string            `json:"error,omitempty"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	Fixes           []SanitizationFix `json:"fixes,omitempty"`
+}
+
+// StoredAnimationCode is the current code of a stored animation along with its content hash
+type StoredAnimationCode struct {
+	ID        string
+	CodeHash  string
+	Code      string
+	P5Version string
+}
+
+// SanitizationFix is a proposed change to one animation's code awaiting admin review
+type SanitizationFix struct {
+	ID               int      `json:"id"`
+	AnimationID      string   `json:"animationId"`
+	Diff             string   `json:"diff"`
+	ValidationErrors []string `json:"validationErrors"`
+	Status           string   `json:"status"`
+}
+
+// StartResanitizeRequest optionally turns a re-sanitization run into a migration to a registered p5.js 2.x version
+type StartResanitizeRequest struct {
+	TargetP5Version string `json:"targetP5Version"`
+}
+
+// ReviewSanitizationFixesRequest selects the fixes of a run to approve or reject. An empty list selects every pending fix.
+type ReviewSanitizationFixesRequest struct {
+	FixIDs []int `json:"fixIds"`
+}
+
+// ReviewSanitizationFixesResponse reports how many fixes were approved or rejected
+type ReviewSanitizationFixesResponse struct {
+	Updated int `json:"updated"`
+}
+
+// PromptVariant is a prompt template and model to try in the prompt playground.
+// Empty fields fall back to the production prompt and model.
+type PromptVariant struct {
+	Name           string `json:"name"`
+	PromptTemplate string `json:"promptTemplate,omitempty"`
+	Model          string `json:"model,omitempty"`
+}
+
+// PromptPlaygroundRequest asks for a description to be generated with several prompt variants
+type PromptPlaygroundRequest struct {
+	Description string          `json:"description"`
+	Variants    []PromptVariant `json:"variants"`
+}
+
+// PromptVariantResult is the generated code and validation outcome of one variant
+type PromptVariantResult struct {
+	Name       string                 `json:"name"`
+	Model      string                 `json:"model"`
+	Code       string                 `json:"code,omitempty"`
+	Valid      bool                   `json:"valid"`
+	Violations []string               `json:"violations"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs int64                  `json:"durationMs"`
+}
+
+// PromptPlaygroundResponse lists the variant results in request order
+type PromptPlaygroundResponse struct {
+	Description string                `json:"description"`
+	Results     []PromptVariantResult `json:"results"`
+}
+
+// TakedownRequest is a report asking for an animation to be removed, e.g. a DMCA notice
+type TakedownRequest struct {
+	ID            int             `json:"id"`
+	AnimationID   string          `json:"animationId"`
+	UploaderID    string          `json:"uploaderId,omitempty"`
+	ReporterName  string          `json:"reporterName"`
+	ReporterEmail string          `json:"reporterEmail"`
+	Reason        string          `json:"reason"`
+	Status        string          `json:"status"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+	Events        []TakedownEvent `json:"events,omitempty"`
+}
+
+// TakedownEvent is one entry in a takedown request's audit trail
+type TakedownEvent struct {
+	Actor      string    `json:"actor"`
+	FromStatus string    `json:"fromStatus,omitempty"`
+	ToStatus   string    `json:"toStatus"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// TakedownReportRequest represents a request to take an animation down
+type TakedownReportRequest struct {
+	AnimationID string `json:"animationId" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Email       string `json:"email" validate:"required,email"`
+	Reason      string `json:"reason" validate:"required"`
+}
+
+// TakedownTransitionRequest represents an admin decision on a takedown request
+type TakedownTransitionRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// TakedownAppealRequest represents the uploader's appeal against a removal
+type TakedownAppealRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
 // Mood represents a user's mood after viewing an animation
 type Mood string
 
@@ -112,13 +1261,505 @@ const (
 	MoodMuchBetter Mood = "much better"
 )
 
+// Valid reports whether m is one of the mood values
+func (m Mood) Valid() bool {
+	return slices.Contains([]Mood{MoodMuchWorse, MoodWorse, MoodSame, MoodBetter, MoodMuchBetter}, m)
+}
+
 // SaveMoodRequest represents the request to save a user's mood
 type SaveMoodRequest struct {
-	AnimationID string `json:"animationId"`
-	Mood        Mood   `json:"mood"`
+	AnimationID string `json:"animationId" validate:"required"`
+	Mood        Mood   `json:"mood" validate:"required,mood"`
+	// PlaybackSession is the session the animation was played in; required except on v1, or when
+	// PLAYBACK_SESSIONS_REQUIRED is false
+	PlaybackSession string `json:"playbackSession,omitempty"`
 }
 
 // SaveMoodResponse represents the response from save-mood endpoint
 type SaveMoodResponse struct {
 	Success bool `json:"success"`
+	// FollowUps are what the mood rules the mood matched ask the app to show
+	FollowUps []MoodFollowUp `json:"followUps,omitempty"`
+}
+
+// MoodRule is a follow-up admins configure for users who save Mood, optionally only once they saved
+// it Repeats times within WithinHours
+type MoodRule struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Mood Mood   `json:"mood"`
+	// Tenant limits the rule to moods saved on requests for the tenant; empty for every request
+	Tenant      string           `json:"tenant,omitempty"`
+	Repeats     int              `json:"repeats"`
+	WithinHours int              `json:"withinHours"`
+	Actions     []MoodRuleAction `json:"actions"`
+	CreatedBy   string           `json:"createdBy,omitempty"`
+	CreatedAt   time.Time        `json:"createdAt"`
+}
+
+// MoodRuleAction is one thing a mood rule does when it matches. Resources are shown as they are
+// for crisis_resources; suggest_animations suggests AnimationIDs, or calm animations from the feed
+// without any; notify_professionals sends Message to the professionals the user shares moods with.
+type MoodRuleAction struct {
+	Type         string          `json:"type"`
+	Resources    json.RawMessage `json:"resources,omitempty"`
+	AnimationIDs []string        `json:"animationIds,omitempty"`
+	Message      string          `json:"message,omitempty"`
+}
+
+// MoodRuleRequest represents an admin creating or replacing a mood rule. Repeats defaults to 1,
+// matching every save of the mood.
+type MoodRuleRequest struct {
+	Name        string           `json:"name"`
+	Mood        Mood             `json:"mood"`
+	Tenant      string           `json:"tenant"`
+	Repeats     int              `json:"repeats"`
+	WithinHours int              `json:"withinHours"`
+	Actions     []MoodRuleAction `json:"actions"`
+}
+
+// MoodFollowUp is an action of a matched mood rule for the app to show: crisis resources or
+// suggested animations
+type MoodFollowUp struct {
+	RuleID     int                    `json:"ruleId"`
+	Type       string                 `json:"type"`
+	Resources  json.RawMessage        `json:"resources,omitempty"`
+	Animations []GetAnimationResponse `json:"animations,omitempty"`
+}
+
+// PlaybackSession is a short-lived session issued when an animation's code is fetched, which the
+// views and moods of that playback name. Its ID is a signed token, only ever stored hashed.
+type PlaybackSession struct {
+	IDHash      string
+	AnimationID string
+	// ViewerKey is the signed-in user's ID, or a hash of the client's IP for anonymous viewers
+	ViewerKey string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// PlaybackView is what a player reports about a playback
+type PlaybackView struct {
+	At             time.Time
+	WatchedSeconds float64
+	AverageFPS     float64
+	// Suspect views came in sooner after the session was issued than anyone could have watched
+	Suspect bool
+}
+
+// RecordViewRequest reports a view of an animation, and later how the playback went. Only the
+// first report of a session counts as a view.
+type RecordViewRequest struct {
+	PlaybackSession string  `json:"playbackSession"`
+	WatchedSeconds  float64 `json:"watchedSeconds"`
+	AverageFPS      float64 `json:"averageFps"`
+}
+
+// PlaybackStats counts an animation's playbacks between From and To
+type PlaybackStats struct {
+	AnimationID string    `json:"animationId"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	// Views counts sessions that reported a view, leaving out suspect ones
+	Views int `json:"views"`
+	// UniqueViewers counts the distinct users and anonymous IPs behind Views
+	UniqueViewers int `json:"uniqueViewers"`
+	// SuspectViews were reported too soon after their session was issued, as bots do
+	SuspectViews          int     `json:"suspectViews"`
+	AverageWatchedSeconds float64 `json:"averageWatchedSeconds"`
+}
+
+// SearchDocument is an animation as replicated into an external search index
+type SearchDocument struct {
+	ID               string `json:"id"`
+	Description      string `json:"description"`
+	P5Version        string `json:"p5Version,omitempty"`
+	RenderStatus     string `json:"renderStatus"`
+	Photosensitivity string `json:"photosensitivity"`
+	// MotionScore is left out until the animation has been screened
+	MotionScore *float64 `json:"motionScore,omitempty"`
+	// CreatedAt is in Unix seconds so search engines can sort on it
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// MoodEntry is a mood a user recorded after viewing an animation
+type MoodEntry struct {
+	AnimationID          string    `json:"animationId"`
+	AnimationDescription string    `json:"animationDescription,omitempty"`
+	Mood                 Mood      `json:"mood"`
+	CreatedAt            time.Time `json:"createdAt"`
+}
+
+// MoodsResponse is a page of a user's mood history, newest first
+type MoodsResponse struct {
+	Moods      []MoodEntry `json:"moods"`
+	Total      int         `json:"total"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+	NextOffset *int        `json:"nextOffset,omitempty"`
+}
+
+// CalendarFeed is the address calendar apps subscribe to a user's mood check-ins at. The token in
+// it is only shown when it is issued.
+type CalendarFeed struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// IntegrationKey lets a no-code tool such as Zapier poll its owner's integration triggers, and
+// nothing else. Only a hash of the key is stored; Key is set once, when the key is issued.
+type IntegrationKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// IntegrationKeyRequest represents a user issuing an integration key
+type IntegrationKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// IntegrationKeysResponse lists a user's integration keys, newest first
+type IntegrationKeysResponse struct {
+	Keys []IntegrationKey `json:"keys"`
+}
+
+// OAuthApp is a third-party app a developer registered to ask users for access to their account.
+// Apps are public clients: instead of a secret they prove each code is theirs with PKCE.
+type OAuthApp struct {
+	ClientID     string    `json:"clientId"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirectUris"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// OAuthAppRequest represents a developer registering an app
+type OAuthAppRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+}
+
+// OAuthAppsResponse lists a developer's apps, newest first
+type OAuthAppsResponse struct {
+	Apps []OAuthApp `json:"apps"`
+}
+
+// OAuthScopeDescription is a scope as the consent screen explains it
+type OAuthScopeDescription struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// OAuthConsent is what the consent screen shows a user before they let an app in
+type OAuthConsent struct {
+	ClientID    string                  `json:"clientId"`
+	AppName     string                  `json:"appName"`
+	Scopes      []OAuthScopeDescription `json:"scopes"`
+	RedirectURI string                  `json:"redirectUri"`
+	State       string                  `json:"state,omitempty"`
+}
+
+// OAuthAuthorizeRequest is a user's answer on the consent screen, carrying the parameters of the
+// app's authorization request back
+type OAuthAuthorizeRequest struct {
+	ClientID            string `json:"clientId"`
+	RedirectURI         string `json:"redirectUri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"codeChallenge"`
+	CodeChallengeMethod string `json:"codeChallengeMethod"`
+	Approve             bool   `json:"approve"`
+}
+
+// OAuthAuthorizeResponse is where the consent screen sends the user back to the app
+type OAuthAuthorizeResponse struct {
+	RedirectTo string `json:"redirectTo"`
+}
+
+// OAuthAuthorization is what a user let an app have with an authorization code
+type OAuthAuthorization struct {
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// OAuthToken is an access and refresh token pair issued to an app. Only hashes of the tokens are
+// stored.
+type OAuthToken struct {
+	ID               int
+	ClientID         string
+	UserID           string
+	Scopes           []string
+	ExpiresAt        time.Time
+	RefreshExpiresAt time.Time
+	CreatedAt        time.Time
+}
+
+// OAuthTokenResponse is a token endpoint answer, in the shape RFC 6749 gives it
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthErrorResponse is an error from the token endpoint, in the shape RFC 6749 gives it
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthGrant is an app a user let in, with the scopes its tokens carry
+type OAuthGrant struct {
+	ClientID  string    `json:"clientId"`
+	AppName   string    `json:"appName"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"grantedAt"`
+}
+
+// OAuthGrantsResponse lists the apps a user let in, most recently let in first
+type OAuthGrantsResponse struct {
+	Grants []OAuthGrant `json:"grants"`
+}
+
+// TriggerCursor is where a trigger's poll left off: the creation time and ID of the last item it
+// returned. Items are ordered by both, so ones saved in the same instant are neither skipped nor
+// repeated.
+type TriggerCursor struct {
+	At time.Time
+	ID string
+}
+
+// TriggerItem is one event a trigger reports. ID is stable across polls, so tools can drop items
+// they have already seen.
+type TriggerItem struct {
+	ID          string    `json:"id"`
+	Cursor      string    `json:"cursor"`
+	AnimationID string    `json:"animationId"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	Mood        Mood      `json:"mood,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// TriggerResponse is one poll of a trigger, newest first. Polling again with since set to
+// NextCursor returns what happened after; HasMore tells there is more to fetch right away.
+type TriggerResponse struct {
+	Event      string        `json:"event"`
+	Items      []TriggerItem `json:"items"`
+	NextCursor string        `json:"nextCursor"`
+	HasMore    bool          `json:"hasMore"`
+}
+
+// TriggersResponse tells a no-code tool whose key it holds and which triggers it may poll
+type TriggersResponse struct {
+	UserID   string   `json:"userId"`
+	Username string   `json:"username"`
+	Events   []string `json:"events"`
+}
+
+// ClientLink connects a professional (therapist or coach) account to a client, from invitation to end
+type ClientLink struct {
+	ID               int        `json:"id"`
+	ProfessionalID   string     `json:"professionalId"`
+	ProfessionalName string     `json:"professionalName"`
+	ClientID         string     `json:"clientId,omitempty"`
+	ClientName       string     `json:"clientName,omitempty"`
+	InviteEmail      string     `json:"inviteEmail,omitempty"`
+	Status           string     `json:"status"`
+	ShareMoodTrends  bool       `json:"shareMoodTrends"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	AcceptedAt       *time.Time `json:"acceptedAt,omitempty"`
+	EndedAt          *time.Time `json:"endedAt,omitempty"`
+}
+
+// ClientInviteRequest represents a professional's invitation to a client
+type ClientInviteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// AcceptClientInviteRequest represents a client accepting an invitation. Mood trends are only
+// shared when the client opts in.
+type AcceptClientInviteRequest struct {
+	Token           string `json:"token" validate:"required"`
+	ShareMoodTrends bool   `json:"shareMoodTrends"`
+}
+
+// MoodTrendConsentRequest represents a client granting or revoking access to their mood trends
+type MoodTrendConsentRequest struct {
+	ShareMoodTrends bool `json:"shareMoodTrends"`
+}
+
+// AssignSessionRequest represents a professional recommending an animation to a client
+type AssignSessionRequest struct {
+	AnimationID string `json:"animationId" validate:"required"`
+	Note        string `json:"note"`
+}
+
+// SessionAssignment is an animation a professional recommended to a client
+type SessionAssignment struct {
+	ID          int       `json:"id"`
+	LinkID      int       `json:"linkId"`
+	AnimationID string    `json:"animationId"`
+	Description string    `json:"description"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// MonthlyReportStatus tells a client polling for a monthly report that it is still rendering
+type MonthlyReportStatus struct {
+	Month  string `json:"month"`
+	Status string `json:"status"`
+}
+
+// MoodTrend counts the moods a user recorded in one week, starting on Monday
+type MoodTrend struct {
+	WeekStart time.Time    `json:"weekStart"`
+	Counts    map[Mood]int `json:"counts"`
+	Total     int          `json:"total"`
+}
+
+// ModerationAuditEntry records one visibility, rating or moderation change to an animation, with
+// who made it and the state it replaced
+type ModerationAuditEntry struct {
+	ID          int64     `json:"id"`
+	AnimationID string    `json:"animationId"`
+	Actor       string    `json:"actor"`
+	Action      string    `json:"action"`
+	FromState   string    `json:"fromState"`
+	ToState     string    `json:"toState"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ProfessionalAuditEntry records one action taken on a client link
+type ProfessionalAuditEntry struct {
+	ActorID   string    `json:"actorId"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SetAccountTypeRequest represents an admin changing a user's account type
+type SetAccountTypeRequest struct {
+	AccountType string `json:"accountType" validate:"required,oneof=personal|professional"`
+}
+
+// SLOWindow is an objective's events and error budget burn rate over one window
+type SLOWindow struct {
+	Window   string  `json:"window"`
+	Good     int64   `json:"good"`
+	Total    int64   `json:"total"`
+	BurnRate float64 `json:"burnRate"`
+}
+
+// SLOStatus reports how one service-level objective is doing
+type SLOStatus struct {
+	Name               string      `json:"name"`
+	Description        string      `json:"description"`
+	ObjectivePercent   float64     `json:"objectivePercent"`
+	LatencyThresholdMs int64       `json:"latencyThresholdMs,omitempty"`
+	Windows            []SLOWindow `json:"windows"`
+	Alerts             []string    `json:"alerts"`
+}
+
+// SLOReport is returned by GET /admin/slo
+type SLOReport struct {
+	GeneratedAt time.Time   `json:"generatedAt"`
+	SLOs        []SLOStatus `json:"slos"`
+}
+
+// DeprecationConsumer is one consumer of a deprecated route or field, told apart by user agent
+type DeprecationConsumer struct {
+	// Consumer is "app <client ID>", "user <user ID>" or "anonymous"
+	Consumer  string    `json:"consumer"`
+	UserAgent string    `json:"userAgent"`
+	Requests  int64     `json:"requests"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// DeprecationUsage is a deprecated route or field with the requests made to it on this instance
+type DeprecationUsage struct {
+	DeprecationRule
+	Requests  int64                 `json:"requests"`
+	Consumers []DeprecationConsumer `json:"consumers"`
+}
+
+// DeprecationReport is returned by GET /admin/deprecations
+type DeprecationReport struct {
+	Deprecations []DeprecationUsage `json:"deprecations"`
+}
+
+// SLOAlert is posted to the SLO alert webhooks when a burn rate alert starts or stops firing. Text
+// makes it readable as a Slack message.
+type SLOAlert struct {
+	SLO              string    `json:"slo"`
+	Severity         string    `json:"severity"`
+	Status           string    `json:"status"`
+	Window           string    `json:"window"`
+	BurnRate         float64   `json:"burnRate"`
+	ObjectivePercent float64   `json:"objectivePercent"`
+	At               time.Time `json:"at"`
+	Text             string    `json:"text"`
+}
+
+// CommentAuthor is the user who wrote a comment
+type CommentAuthor struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// Comment is a viewer's comment on an animation
+type Comment struct {
+	ID          int           `json:"id"`
+	AnimationID string        `json:"animationId"`
+	Author      CommentAuthor `json:"author"`
+	Body        string        `json:"body"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+// CreateCommentRequest represents a viewer commenting on an animation
+type CreateCommentRequest struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+// CommentsResponse is a page of an animation's comments, oldest first
+type CommentsResponse struct {
+	Comments   []Comment `json:"comments"`
+	Total      int       `json:"total"`
+	Limit      int       `json:"limit"`
+	Offset     int       `json:"offset"`
+	NextOffset *int      `json:"nextOffset,omitempty"`
+}
+
+// SubscriptionRequest represents a user following a tag, such as "ocean" for animations described
+// with #ocean, or a creator by user ID. Exactly one of the two is given.
+type SubscriptionRequest struct {
+	Tag       string `json:"tag,omitempty"`
+	CreatorID string `json:"creatorId,omitempty"`
+}
+
+// Subscription is a tag or creator a user follows. They are notified when a matching animation is
+// published.
+type Subscription struct {
+	ID     int    `json:"id"`
+	UserID string `json:"-"`
+	Kind   string `json:"kind"`
+	// Tag is set for tag subscriptions, without its #
+	Tag string `json:"tag,omitempty"`
+	// CreatorID and CreatorUsername are set for creator subscriptions
+	CreatorID       string    `json:"creatorId,omitempty"`
+	CreatorUsername string    `json:"creatorUsername,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// SubscriptionsResponse lists the tags and creators a user follows, oldest first
+type SubscriptionsResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
 }
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Moderation audit actions, naming what about an animation changed
+const (
+	ModerationVisibility       = "visibility"
+	ModerationRenderStatus     = "render_status"
+	ModerationPhotosensitivity = "photosensitivity"
+	ModerationDeleted          = "deleted"
+	// ModerationReview records a workspace owner approving or rejecting a member's animation
+	ModerationReview = "review"
+)
+
+// Visibility states recorded in the moderation audit
+const (
+	VisibilityVisible = "visible"
+	VisibilityRemoved = "removed"
+	VisibilityDeleted = "deleted"
+)
+
+// moderationSystemActor is recorded for changes no signed-in user made, such as scheduled checks
+const moderationSystemActor = "system"
+
+// visibilityState names whether an animation is shown or was removed after a takedown
+func visibilityState(removed bool) string {
+	if removed {
+		return VisibilityRemoved
+	}
+	return VisibilityVisible
+}
+
+// moderationEntry describes a change to an animation made by whoever is signed in on ctx
+func moderationEntry(ctx context.Context, animationId, action, from, to, reason string) ModerationAuditEntry {
+	actor, ok := GetUserIDFromContext(ctx)
+	if !ok || actor == "" {
+		actor = moderationSystemActor
+	}
+	return ModerationAuditEntry{
+		AnimationID: animationId,
+		Actor:       actor,
+		Action:      action,
+		FromState:   from,
+		ToState:     to,
+		Reason:      reason,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// recordModerationAudit appends entry to the moderation audit in tx, so the trail is written if and
+// only if the change it records is
+func recordModerationAudit(ctx context.Context, tx *sql.Tx, entry ModerationAuditEntry) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO moderation_audit (animation_id, actor, action, from_state, to_state, reason) VALUES ($1, $2, $3, $4, $5, $6)",
+		entry.AnimationID, entry.Actor, entry.Action, entry.FromState, entry.ToState, entry.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record moderation audit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestModerationAudit(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	author := registerUser(t, router, "author")
+
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	// A scheduled check changes the render status; a screening that finds what was recorded already is not a change
+	ctx := context.Background()
+	if err := store.SetAnimationRenderStatus(ctx, saved.ID, RenderStatusCrashed); err != nil {
+		t.Fatalf("SetAnimationRenderStatus: %v", err)
+	}
+	if err := store.SetAnimationPhotosensitivity(ctx, saved.ID, PhotosensitivityReport{Status: PhotosensitivityUnchecked}); err != nil {
+		t.Fatalf("SetAnimationPhotosensitivity: %v", err)
+	}
+	if code := doJSON(t, router, http.MethodDelete, "/animation/"+saved.ID, admin.Token, nil, nil); code != http.StatusOK && code != http.StatusNoContent {
+		t.Fatalf("admin delete status = %d", code)
+	}
+
+	var entries []ModerationAuditEntry
+	if code := doJSON(t, router, http.MethodGet, "/admin/animations/"+saved.ID+"/audit", admin.Token, nil, &entries); code != http.StatusOK {
+		t.Fatalf("audit status = %d", code)
+	}
+	want := []ModerationAuditEntry{
+		{Actor: moderationSystemActor, Action: ModerationRenderStatus, FromState: RenderStatusUnchecked, ToState: RenderStatusCrashed},
+		{Actor: admin.User.ID, Action: ModerationDeleted, FromState: VisibilityVisible, ToState: VisibilityDeleted},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("audit = %+v, want %d entries", entries, len(want))
+	}
+	for i, entry := range entries {
+		if entry.Actor != want[i].Actor || entry.Action != want[i].Action || entry.FromState != want[i].FromState || entry.ToState != want[i].ToState {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/admin/animations/"+saved.ID+"/audit", author, nil, nil); code != http.StatusForbidden {
+		t.Errorf("non-admin audit status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/admin/animations/missing/audit", admin.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("missing animation audit status = %d, want %d", code, http.StatusNotFound)
+	}
+}
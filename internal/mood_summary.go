@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"log"
+)
+
+// moodWeights scores each mood for NetPositivity
+var moodWeights = map[Mood]float64{
+	MoodMuchWorse:  -2,
+	MoodWorse:      -1,
+	MoodSame:       0,
+	MoodBetter:     1,
+	MoodMuchBetter: 2,
+}
+
+// SummarizeMoods aggregates an animation's mood counts. Each user records at most one mood per
+// animation, so the total is the number of people behind it; below minGroupSize the counts and
+// score are withheld, as in the research dataset.
+func SummarizeMoods(counts map[Mood]int, minGroupSize int) MoodSummary {
+	summary := MoodSummary{}
+	score := 0.0
+	for mood, count := range counts {
+		summary.Total += count
+		score += moodWeights[mood] * float64(count)
+	}
+	if summary.Total < minGroupSize {
+		summary.Suppressed = summary.Total > 0
+		summary.Total = 0
+		return summary
+	}
+	if summary.Total > 0 {
+		summary.Counts = counts
+		// The mean weight over the largest possible weight
+		netPositivity := score / float64(summary.Total) / moodWeights[MoodMuchBetter]
+		summary.NetPositivity = &netPositivity
+	}
+	return summary
+}
+
+// attachMoodSummaries sets the mood summary of each animation. A failure, or analytics being
+// switched off, leaves the summaries out, since they are not worth failing the response for.
+func (s *Server) attachMoodSummaries(ctx context.Context, animations []GetAnimationResponse) {
+	if len(animations) == 0 || !FeatureEnabled(FeatureAnalytics) {
+		return
+	}
+	ids := make([]string, len(animations))
+	for i, animation := range animations {
+		ids[i] = animation.ID
+	}
+	counts, err := s.store.GetMoodCounts(ctx, ids)
+	if err != nil {
+		log.Printf("[MOODS] Failed to summarize moods: %v", err)
+		return
+	}
+	minGroupSize := DatasetMinGroupSize()
+	for i := range animations {
+		summary := SummarizeMoods(counts[animations[i].ID], minGroupSize)
+		animations[i].Moods = &summary
+	}
+}
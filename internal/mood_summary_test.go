@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeMoods(t *testing.T) {
+	half, zero := 0.5, 0.0
+	tests := []struct {
+		name   string
+		counts map[Mood]int
+		want   MoodSummary
+	}{
+		{name: "No moods", want: MoodSummary{}},
+		{name: "Below group size", counts: map[Mood]int{MoodBetter: 2}, want: MoodSummary{Suppressed: true}},
+		{name: "Positive", counts: map[Mood]int{MoodMuchBetter: 1, MoodBetter: 1, MoodSame: 1},
+			want: MoodSummary{Counts: map[Mood]int{MoodMuchBetter: 1, MoodBetter: 1, MoodSame: 1}, Total: 3, NetPositivity: &half}},
+		{name: "Mixed", counts: map[Mood]int{MoodMuchWorse: 1, MoodMuchBetter: 1, MoodWorse: 1, MoodBetter: 1},
+			want: MoodSummary{Counts: map[Mood]int{MoodMuchWorse: 1, MoodMuchBetter: 1, MoodWorse: 1, MoodBetter: 1}, Total: 4, NetPositivity: &zero}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SummarizeMoods(tt.counts, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SummarizeMoods() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnimationMoods(t *testing.T) {
+	resetFeatures(t)
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("DATASET_MIN_GROUP_SIZE", "2")
+
+	router := NewServer(NewMemoryStore()).Router()
+	author := registerUser(t, router, "author")
+
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	saveMood := func(token string, mood Mood) {
+		t.Helper()
+		if code := doJSON(t, router, http.MethodPost, "/save-mood", token, SaveMoodRequest{AnimationID: saved.ID, Mood: mood, PlaybackSession: playAnimation(t, router, token, saved.ID)}, nil); code != http.StatusOK {
+			t.Fatalf("save mood status = %d", code)
+		}
+	}
+
+	// A single mood could identify who recorded it
+	saveMood(author, MoodMuchBetter)
+	var summary MoodSummary
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"/moods", "", nil, &summary); code != http.StatusOK {
+		t.Fatalf("moods status = %d", code)
+	}
+	if !summary.Suppressed || summary.Counts != nil {
+		t.Errorf("summary = %+v, want it suppressed below the group size", summary)
+	}
+
+	saveMood(registerUser(t, router, "viewer"), MoodSame)
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"/moods", "", nil, &summary); code != http.StatusOK {
+		t.Fatalf("moods status = %d", code)
+	}
+	wantCounts := map[Mood]int{MoodMuchBetter: 1, MoodSame: 1}
+	if !reflect.DeepEqual(summary.Counts, wantCounts) || summary.Total != 2 || summary.NetPositivity == nil || *summary.NetPositivity != 0.5 {
+		t.Errorf("summary = %+v, want counts %v and net positivity 0.5", summary, wantCounts)
+	}
+
+	var animation GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID, "", nil, &animation); code != http.StatusOK {
+		t.Fatalf("get animation status = %d", code)
+	}
+	if animation.Moods == nil || animation.Moods.Total != 2 {
+		t.Errorf("animation moods = %+v, want the summary included", animation.Moods)
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/animation/missing/moods", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("missing animation status = %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMood is returned for a mood rule naming an unknown mood
+var ErrInvalidMood = errors.New("invalid mood value")
+
+// Mood rule actions
+const (
+	// MoodActionCrisisResources shows the rule's resources, such as helpline numbers, as they are
+	MoodActionCrisisResources = "crisis_resources"
+	// MoodActionSuggestAnimations suggests the rule's animations, or calm ones from the feed
+	MoodActionSuggestAnimations = "suggest_animations"
+	// MoodActionNotifyProfessionals tells the professionals the user shares their mood trends with
+	MoodActionNotifyProfessionals = "notify_professionals"
+)
+
+const (
+	maxMoodRuleNameLength      = 80
+	maxMoodRuleActions         = 5
+	maxMoodRuleRepeats         = 10
+	maxMoodRuleWithinHours     = 30 * 24
+	maxMoodRuleResourcesLength = 4096
+	maxMoodRuleAnimations      = 10
+	maxMoodRuleMessageLength   = 500
+	// calmSuggestionCount is how many calm animations are suggested by actions naming none
+	calmSuggestionCount = 3
+)
+
+// ValidateMoodRule checks a mood rule request and returns the rule it describes, keeping only the
+// fields each action's type uses. Whether suggested animations exist is left to the caller.
+func ValidateMoodRule(req MoodRuleRequest) (MoodRule, error) {
+	rule := MoodRule{
+		Name:        strings.TrimSpace(req.Name),
+		Mood:        req.Mood,
+		Tenant:      strings.TrimSpace(req.Tenant),
+		Repeats:     req.Repeats,
+		WithinHours: req.WithinHours,
+		Actions:     []MoodRuleAction{},
+	}
+	if rule.Name == "" || len(rule.Name) > maxMoodRuleNameLength {
+		return MoodRule{}, fmt.Errorf("name must be 1-%d characters", maxMoodRuleNameLength)
+	}
+	if !rule.Mood.Valid() {
+		return MoodRule{}, ErrInvalidMood
+	}
+	if rule.Tenant != "" {
+		tenants, err := TenantRegions()
+		if err != nil {
+			return MoodRule{}, err
+		}
+		if _, ok := tenants[rule.Tenant]; !ok {
+			return MoodRule{}, fmt.Errorf("unknown tenant %q", rule.Tenant)
+		}
+	}
+
+	if rule.Repeats == 0 {
+		rule.Repeats = 1
+	}
+	if rule.Repeats < 1 || rule.Repeats > maxMoodRuleRepeats {
+		return MoodRule{}, fmt.Errorf("repeats must be between 1 and %d", maxMoodRuleRepeats)
+	}
+	if rule.Repeats > 1 && (rule.WithinHours < 1 || rule.WithinHours > maxMoodRuleWithinHours) {
+		return MoodRule{}, fmt.Errorf("withinHours must be between 1 and %d when repeats is more than 1", maxMoodRuleWithinHours)
+	}
+	if rule.Repeats == 1 {
+		rule.WithinHours = 0
+	}
+
+	if len(req.Actions) == 0 || len(req.Actions) > maxMoodRuleActions {
+		return MoodRule{}, fmt.Errorf("a rule must have 1-%d actions", maxMoodRuleActions)
+	}
+	for _, action := range req.Actions {
+		validated := MoodRuleAction{Type: action.Type}
+		switch action.Type {
+		case MoodActionCrisisResources:
+			resources := strings.TrimSpace(string(action.Resources))
+			if resources == "" || resources == "null" || !json.Valid([]byte(resources)) {
+				return MoodRule{}, errors.New("crisis_resources actions need resources as JSON")
+			}
+			if len(resources) > maxMoodRuleResourcesLength {
+				return MoodRule{}, fmt.Errorf("resources must be at most %d bytes", maxMoodRuleResourcesLength)
+			}
+			validated.Resources = json.RawMessage(resources)
+		case MoodActionSuggestAnimations:
+			validated.AnimationIDs = []string{}
+			for _, id := range action.AnimationIDs {
+				if id = strings.TrimSpace(id); id != "" && !slices.Contains(validated.AnimationIDs, id) {
+					validated.AnimationIDs = append(validated.AnimationIDs, id)
+				}
+			}
+			if len(validated.AnimationIDs) > maxMoodRuleAnimations {
+				return MoodRule{}, fmt.Errorf("an action may suggest at most %d animations", maxMoodRuleAnimations)
+			}
+		case MoodActionNotifyProfessionals:
+			validated.Message = strings.TrimSpace(action.Message)
+			if validated.Message == "" || len(validated.Message) > maxMoodRuleMessageLength {
+				return MoodRule{}, fmt.Errorf("message must be 1-%d characters", maxMoodRuleMessageLength)
+			}
+		default:
+			return MoodRule{}, fmt.Errorf("action type must be %s, %s or %s", MoodActionCrisisResources, MoodActionSuggestAnimations, MoodActionNotifyProfessionals)
+		}
+		rule.Actions = append(rule.Actions, validated)
+	}
+	return rule, nil
+}
+
+// runMoodRules carries out the rules matching a mood a user just saved on a request for tenant,
+// and returns the follow-ups for the app to show. Rules that fail are logged and skipped, since
+// the mood is saved either way.
+func (s *Server) runMoodRules(ctx context.Context, endpoint, userId, tenant string, mood Mood) []MoodFollowUp {
+	rules, err := s.store.ListMoodRules(ctx)
+	if err != nil {
+		LogResponse(endpoint, "Error listing mood rules", err)
+		return nil
+	}
+
+	var followUps []MoodFollowUp
+	for _, rule := range rules {
+		if rule.Mood != mood || (rule.Tenant != "" && rule.Tenant != tenant) {
+			continue
+		}
+		if rule.Repeats > 1 {
+			repeated, err := s.moodRepeated(ctx, userId, mood, rule.Repeats, time.Duration(rule.WithinHours)*time.Hour)
+			if err != nil {
+				LogResponse(endpoint, fmt.Sprintf("Error evaluating mood rule %d", rule.ID), err)
+				continue
+			}
+			if !repeated {
+				continue
+			}
+		}
+
+		LogResponse(endpoint, fmt.Sprintf("Mood rule %d matched for user %s", rule.ID, userId), nil)
+		for _, action := range rule.Actions {
+			switch action.Type {
+			case MoodActionCrisisResources:
+				followUps = append(followUps, MoodFollowUp{RuleID: rule.ID, Type: action.Type, Resources: action.Resources})
+			case MoodActionSuggestAnimations:
+				if animations := s.suggestedAnimations(ctx, endpoint, action.AnimationIDs); len(animations) > 0 {
+					followUps = append(followUps, MoodFollowUp{RuleID: rule.ID, Type: action.Type, Animations: animations})
+				}
+			case MoodActionNotifyProfessionals:
+				s.notifyProfessionalsOfMood(ctx, endpoint, userId, mood, action.Message)
+			}
+		}
+	}
+	return followUps
+}
+
+// moodRepeated reports whether a user saved mood at least repeats times within the last within
+func (s *Server) moodRepeated(ctx context.Context, userId string, mood Mood, repeats int, within time.Duration) (bool, error) {
+	since := time.Now().Add(-within)
+	count := 0
+	for offset := 0; ; offset += maxPageSize {
+		moods, total, err := s.store.ListMoods(ctx, userId, since, time.Time{}, maxPageSize, offset)
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range moods {
+			if entry.Mood == mood {
+				count++
+			}
+		}
+		if count >= repeats {
+			return true, nil
+		}
+		if len(moods) == 0 || offset+len(moods) >= total {
+			return false, nil
+		}
+	}
+}
+
+// suggestedAnimations returns the animations of ids that can still be shown, or the newest calm
+// animations in the feed when ids is empty
+func (s *Server) suggestedAnimations(ctx context.Context, endpoint string, ids []string) []GetAnimationResponse {
+	if len(ids) == 0 {
+		animations, _, err := s.store.ListFeedAnimations(ctx, widgetFilter(), calmSuggestionCount, 0)
+		if err != nil {
+			LogResponse(endpoint, "Error listing calm animations to suggest", err)
+		}
+		return animations
+	}
+
+	animations := []GetAnimationResponse{}
+	for _, id := range ids {
+		animation, err := s.store.GetAnimation(ctx, id)
+		if err != nil {
+			// Animations deleted or taken down since the rule was written are left out
+			continue
+		}
+		animations = append(animations, animation)
+	}
+	return animations
+}
+
+// notifyProfessionalsOfMood sends a client_mood_alert to the professionals a user shares their
+// mood trends with; professionals receive them only once they opt in
+func (s *Server) notifyProfessionalsOfMood(ctx context.Context, endpoint, userId string, mood Mood, message string) {
+	links, err := s.store.ListClientProfessionals(ctx, userId)
+	if err != nil {
+		LogResponse(endpoint, "Error listing the professionals of user "+userId, err)
+		return
+	}
+	user, err := s.store.GetUserDetails(ctx, userId)
+	if err != nil {
+		LogResponse(endpoint, "Error retrieving user "+userId, err)
+		return
+	}
+
+	subject := user.Username + " may need support"
+	body := user.Username + " just told Animate they feel \"" + string(mood) + "\" after watching an animation.\n\n" + message
+	for _, link := range links {
+		if link.Status == ClientLinkActive && link.ShareMoodTrends {
+			notifyUser(ctx, s.store, s.mailer, link.ProfessionalID, NotificationClientMoodAlert, subject, body)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateMoodRule(t *testing.T) {
+	t.Setenv("TENANT_REGIONS", "globex=primary")
+	resources := MoodRuleAction{Type: MoodActionCrisisResources, Resources: json.RawMessage(`{"helpline": "116 123"}`)}
+
+	tests := []struct {
+		name    string
+		req     MoodRuleRequest
+		wantErr bool
+	}{
+		{name: "Crisis resources", req: MoodRuleRequest{Name: "Helplines", Mood: MoodMuchWorse, Actions: []MoodRuleAction{resources}}},
+		{name: "Repeated within a window", req: MoodRuleRequest{Name: "Twice", Mood: MoodMuchWorse, Repeats: 2, WithinHours: 24, Tenant: "globex",
+			Actions: []MoodRuleAction{{Type: MoodActionNotifyProfessionals, Message: "Please check in"}}}},
+		{name: "Missing name", req: MoodRuleRequest{Mood: MoodMuchWorse, Actions: []MoodRuleAction{resources}}, wantErr: true},
+		{name: "Unknown mood", req: MoodRuleRequest{Name: "Helplines", Mood: "ecstatic", Actions: []MoodRuleAction{resources}}, wantErr: true},
+		{name: "Unknown tenant", req: MoodRuleRequest{Name: "Helplines", Mood: MoodMuchWorse, Tenant: "acme", Actions: []MoodRuleAction{resources}}, wantErr: true},
+		{name: "Repeats without a window", req: MoodRuleRequest{Name: "Twice", Mood: MoodMuchWorse, Repeats: 2, Actions: []MoodRuleAction{resources}}, wantErr: true},
+		{name: "No actions", req: MoodRuleRequest{Name: "Helplines", Mood: MoodMuchWorse}, wantErr: true},
+		{name: "Unknown action", req: MoodRuleRequest{Name: "Helplines", Mood: MoodMuchWorse, Actions: []MoodRuleAction{{Type: "page_oncall"}}}, wantErr: true},
+		{name: "Resources not JSON", req: MoodRuleRequest{Name: "Helplines", Mood: MoodMuchWorse,
+			Actions: []MoodRuleAction{{Type: MoodActionCrisisResources, Resources: json.RawMessage(`{"helpline"`)}}}, wantErr: true},
+		{name: "Empty message", req: MoodRuleRequest{Name: "Coach", Mood: MoodMuchWorse, Actions: []MoodRuleAction{{Type: MoodActionNotifyProfessionals}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateMoodRule(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateMoodRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.Repeats < 1 || len(got.Actions) != len(tt.req.Actions)) {
+				t.Errorf("rule = %+v", got)
+			}
+		})
+	}
+
+	// Fields other action types use are dropped
+	rule, err := ValidateMoodRule(MoodRuleRequest{Name: "Coach", Mood: MoodMuchWorse,
+		Actions: []MoodRuleAction{{Type: MoodActionNotifyProfessionals, Message: " Check in ", AnimationIDs: []string{"abc"}}}})
+	if err != nil || rule.Actions[0].Message != "Check in" || rule.Actions[0].AnimationIDs != nil {
+		t.Errorf("rule = %+v, %v, want only the trimmed message kept", rule, err)
+	}
+}
+
+func TestMoodRulesOnSaveMood(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("TENANT_REGIONS", "globex=primary")
+
+	router := NewServer(NewMemoryStore()).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	user := registerAccount(t, router, "viewer")
+
+	save := func(description string) string {
+		t.Helper()
+		var saved SaveAnimationResponse
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", user.Token, sketch, &saved); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+		return saved.ID
+	}
+	storm, rain, calm := save("storm"), save("rain"), save("calm lake")
+
+	resources := MoodRuleAction{Type: MoodActionCrisisResources, Resources: json.RawMessage(`{"helpline":"116 123"}`)}
+	suggest := MoodRuleAction{Type: MoodActionSuggestAnimations, AnimationIDs: []string{calm}}
+	if code := doJSON(t, router, http.MethodPost, "/admin/mood-rules", user.Token, MoodRuleRequest{Name: "Helplines", Mood: MoodMuchWorse, Actions: []MoodRuleAction{resources}}, nil); code != http.StatusForbidden {
+		t.Errorf("create by non-admin status = %d, want %d", code, http.StatusForbidden)
+	}
+	missing := MoodRuleRequest{Name: "Calm", Mood: MoodMuchWorse, Actions: []MoodRuleAction{{Type: MoodActionSuggestAnimations, AnimationIDs: []string{"missing"}}}}
+	if code := doJSON(t, router, http.MethodPost, "/admin/mood-rules", admin.Token, missing, nil); code != http.StatusBadRequest {
+		t.Errorf("suggesting an unknown animation status = %d, want %d", code, http.StatusBadRequest)
+	}
+	var rule MoodRule
+	twice := MoodRuleRequest{Name: "Twice in a day", Mood: MoodMuchWorse, Repeats: 2, WithinHours: 24, Actions: []MoodRuleAction{resources, suggest}}
+	if code := doJSON(t, router, http.MethodPost, "/admin/mood-rules", admin.Token, twice, &rule); code != http.StatusCreated || rule.ID == 0 || rule.CreatedBy != admin.User.ID {
+		t.Fatalf("create rule = %d %+v", code, rule)
+	}
+	tenantOnly := MoodRuleRequest{Name: "Globex", Mood: MoodMuchWorse, Tenant: "globex", Actions: []MoodRuleAction{resources}}
+	doJSON(t, router, http.MethodPost, "/admin/mood-rules", admin.Token, tenantOnly, nil)
+
+	saveMood := func(animationId string) SaveMoodResponse {
+		t.Helper()
+		var response SaveMoodResponse
+		if code := doJSON(t, router, http.MethodPost, "/save-mood", user.Token, SaveMoodRequest{AnimationID: animationId, Mood: MoodMuchWorse, PlaybackSession: playAnimation(t, router, user.Token, animationId)}, &response); code != http.StatusOK {
+			t.Fatalf("save mood status = %d", code)
+		}
+		return response
+	}
+	// The rule for another tenant never matches, and the first bad mood is not yet a repeat
+	if first := saveMood(storm); len(first.FollowUps) != 0 {
+		t.Errorf("first mood follow-ups = %+v, want none", first.FollowUps)
+	}
+	second := saveMood(rain)
+	if len(second.FollowUps) != 2 || second.FollowUps[0].Type != MoodActionCrisisResources || string(second.FollowUps[0].Resources) != `{"helpline":"116 123"}` {
+		t.Fatalf("second mood follow-ups = %+v, want the resources then the suggestion", second.FollowUps)
+	}
+	if suggested := second.FollowUps[1].Animations; len(suggested) != 1 || suggested[0].ID != calm {
+		t.Errorf("suggested animations = %+v, want the calm lake", suggested)
+	}
+
+	rulePath := "/admin/mood-rules/" + strconv.Itoa(rule.ID)
+	twice.Repeats = 5
+	if code := doJSON(t, router, http.MethodPut, rulePath, admin.Token, twice, &rule); code != http.StatusOK || rule.Repeats != 5 {
+		t.Errorf("update rule = %d %+v", code, rule)
+	}
+	if third := saveMood(calm); len(third.FollowUps) != 0 {
+		t.Errorf("follow-ups after raising repeats = %+v, want none", third.FollowUps)
+	}
+
+	var rules []MoodRule
+	if code := doJSON(t, router, http.MethodGet, "/admin/mood-rules", admin.Token, nil, &rules); code != http.StatusOK || len(rules) != 2 || rules[1].Tenant != "globex" {
+		t.Errorf("list rules = %d %+v", code, rules)
+	}
+	if code := doJSON(t, router, http.MethodDelete, rulePath, admin.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete rule status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := doJSON(t, router, http.MethodPut, rulePath, admin.Token, twice, nil); code != http.StatusNotFound {
+		t.Errorf("update deleted rule status = %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,246 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+	// Quiet hours are read in the user's timezone, also on hosts without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// Notification events. Security emails, such as login links and email change notices, do not go
+// through preferences and are always sent.
+const (
+	// NotificationTakedownReported tells uploaders one of their animations was reported
+	NotificationTakedownReported NotificationEvent = "takedown_reported"
+	// NotificationTakedownDecided tells uploaders whether a reported animation was removed or restored
+	NotificationTakedownDecided NotificationEvent = "takedown_decided"
+	// NotificationMoodReminder nudges users to check in with their mood at the times they chose
+	NotificationMoodReminder NotificationEvent = "mood_reminder"
+	// NotificationReviewRequested tells workspace owners a member's animation waits for their review
+	NotificationReviewRequested NotificationEvent = "review_requested"
+	// NotificationReviewDecided tells members whether their animation was approved
+	NotificationReviewDecided NotificationEvent = "review_decided"
+	// NotificationClientMoodAlert tells professionals a mood rule flagged one of their clients
+	NotificationClientMoodAlert NotificationEvent = "client_mood_alert"
+	// NotificationSubscriptionPublished tells users an animation by a creator or with a tag they
+	// follow was published
+	NotificationSubscriptionPublished NotificationEvent = "subscription_published"
+)
+
+// NotificationChannelEmail delivers notifications to the user's email address
+const NotificationChannelEmail NotificationChannel = "email"
+
+// defaultNotificationChannels lists the channels of each event a user has not configured
+var defaultNotificationChannels = map[NotificationEvent][]NotificationChannel{
+	NotificationTakedownReported: {NotificationChannelEmail},
+	NotificationTakedownDecided:  {NotificationChannelEmail},
+	NotificationMoodReminder:     {NotificationChannelEmail},
+	NotificationReviewRequested:  {NotificationChannelEmail},
+	NotificationReviewDecided:    {NotificationChannelEmail},
+	// Professionals opt in to mood alerts, which can arrive at any hour
+	NotificationClientMoodAlert: {},
+	// Following a tag or creator is itself the opt-in
+	NotificationSubscriptionPublished: {NotificationChannelEmail},
+}
+
+// notificationChannels are the channels the dispatcher can deliver on
+var notificationChannels = []NotificationChannel{NotificationChannelEmail}
+
+const (
+	notificationBatchSize        = 50
+	notificationDispatchInterval = time.Minute
+	// notificationMaxAttempts is how many deliveries of a queued notification are tried before it is dropped
+	notificationMaxAttempts     = 5
+	notificationRetryMaxMinutes = 60
+)
+
+// EffectiveNotificationEvents returns the channels of every event, using the defaults for the
+// events preferences leave out
+func EffectiveNotificationEvents(preferences NotificationPreferences) map[NotificationEvent][]NotificationChannel {
+	events := make(map[NotificationEvent][]NotificationChannel, len(defaultNotificationChannels))
+	for event, channels := range defaultNotificationChannels {
+		if chosen, ok := preferences.Events[event]; ok {
+			channels = chosen
+		}
+		events[event] = slices.Clone(channels)
+	}
+	return events
+}
+
+// ValidateNotificationPreferences checks that preferences name known events and channels and valid
+// quiet hours, and removes repeated channels
+func ValidateNotificationPreferences(preferences *NotificationPreferences) error {
+	for event, channels := range preferences.Events {
+		if _, ok := defaultNotificationChannels[event]; !ok {
+			return fmt.Errorf("unknown notification event %q", event)
+		}
+		unique := []NotificationChannel{}
+		for _, channel := range channels {
+			if !slices.Contains(notificationChannels, channel) {
+				return fmt.Errorf("unknown notification channel %q", channel)
+			}
+			if !slices.Contains(unique, channel) {
+				unique = append(unique, channel)
+			}
+		}
+		preferences.Events[event] = unique
+	}
+	if preferences.QuietHours != nil {
+		return preferences.QuietHours.validate()
+	}
+	return nil
+}
+
+// parseClock converts a "15:04" time to minutes after midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+func (q QuietHours) validate() error {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.New("quiet hours must start and end at different times")
+	}
+	if q.Timezone == "" {
+		return errors.New("quiet hours need a timezone")
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", q.Timezone)
+	}
+	return nil
+}
+
+// quietUntil returns when the quiet hours around now end, and false when now is outside them
+func (q QuietHours) quietUntil(now time.Time) (time.Time, bool) {
+	start, startErr := parseClock(q.Start)
+	end, endErr := parseClock(q.End)
+	location, locationErr := time.LoadLocation(q.Timezone)
+	if startErr != nil || endErr != nil || locationErr != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	endOn := func(days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, end/60, end%60, 0, 0, location)
+	}
+	switch {
+	case start < end && minute >= start && minute < end:
+		return endOn(0), true
+	case start > end && minute >= start:
+		// Past midnight tomorrow
+		return endOn(1), true
+	case start > end && minute < end:
+		return endOn(0), true
+	}
+	return time.Time{}, false
+}
+
+// notifyUser sends a notification to a user on the channels their preferences choose for event, and
+// returns false when they muted it. During their quiet hours it is queued until they end. Failures
+// are logged and queued for a retry.
+func notifyUser(ctx context.Context, store Store, mailer Mailer, userId string, event NotificationEvent, subject, body string) bool {
+	preferences, err := store.GetNotificationPreferences(ctx, userId)
+	if err != nil {
+		log.Printf("[NOTIFY] Failed to read notification preferences of user %s, using the defaults: %v", userId, err)
+	}
+
+	now := time.Now()
+	channels := EffectiveNotificationEvents(preferences)[event]
+	for _, channel := range channels {
+		notification := Notification{UserID: userId, Event: event, Channel: channel, Subject: subject, Body: body, DeliverAfter: now}
+		if preferences.QuietHours != nil {
+			if until, quiet := preferences.QuietHours.quietUntil(now); quiet {
+				notification.DeliverAfter = until
+				if err := store.QueueNotification(ctx, notification); err != nil {
+					log.Printf("[NOTIFY] Failed to hold %s %s notification for user %s: %v", event, channel, userId, err)
+				}
+				continue
+			}
+		}
+
+		if err := deliverNotification(ctx, store, mailer, notification); err != nil {
+			log.Printf("[NOTIFY] Failed to deliver %s %s notification to user %s, will retry: %v", event, channel, userId, err)
+			notification.DeliverAfter = now.Add(time.Minute)
+			if err := store.QueueNotification(ctx, notification); err != nil {
+				log.Printf("[NOTIFY] Failed to queue %s %s notification for user %s: %v", event, channel, userId, err)
+			}
+		}
+	}
+	return len(channels) > 0
+}
+
+// deliverNotification sends a notification on its channel
+func deliverNotification(ctx context.Context, store UserStore, mailer Mailer, notification Notification) error {
+	user, err := store.GetUserDetails(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	switch notification.Channel {
+	case NotificationChannelEmail:
+		return mailer.Send(user.Email, notification.Subject, notification.Body)
+	}
+	return fmt.Errorf("unknown notification channel %q", notification.Channel)
+}
+
+// dispatchDueNotifications delivers a batch of queued notifications that are due, and returns how
+// many it claimed
+func dispatchDueNotifications(ctx context.Context, store Store, mailer Mailer) (int, error) {
+	notifications, err := store.ClaimDueNotifications(ctx, notificationBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, notification := range notifications {
+		err := deliverNotification(ctx, store, mailer, notification)
+		switch {
+		case err == nil:
+			err = store.CompleteNotification(ctx, notification.ID)
+		case notification.Attempts >= notificationMaxAttempts:
+			log.Printf("[NOTIFY] Dropping %s notification %d for user %s after %d attempts: %v",
+				notification.Event, notification.ID, notification.UserID, notification.Attempts, err)
+			err = store.CompleteNotification(ctx, notification.ID)
+		default:
+			err = store.FailNotification(ctx, notification.ID, err)
+		}
+		if err != nil {
+			log.Printf("[NOTIFY] Failed to update queued notification %d: %v", notification.ID, err)
+		}
+	}
+	return len(notifications), nil
+}
+
+// RunNotificationDispatcher delivers queued notifications in every region as their quiet hours end
+// or their retry comes up, until ctx is done
+func RunNotificationDispatcher(ctx context.Context, store Store) {
+	ticker := time.NewTicker(notificationDispatchInterval)
+	defer ticker.Stop()
+	for {
+		err := drainEveryDataRegion(ctx, notificationBatchSize, func(ctx context.Context) (int, error) {
+			return dispatchDueNotifications(ctx, store, GetMailer())
+		})
+		if err != nil {
+			log.Printf("[NOTIFY] Failed to claim queued notifications: %v", err)
+		}
+		recordWorkerPass("notifications", notificationDispatchInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
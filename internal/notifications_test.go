@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overnight := QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}
+	daytime := QuietHours{Start: "09:30", End: "17:00", Timezone: "Europe/Berlin"}
+	tests := []struct {
+		name      string
+		quiet     QuietHours
+		now       time.Time
+		wantUntil time.Time
+		wantQuiet bool
+	}{
+		{name: "Before midnight", quiet: overnight, now: time.Date(2026, 3, 1, 23, 30, 0, 0, berlin),
+			wantUntil: time.Date(2026, 3, 2, 7, 0, 0, 0, berlin), wantQuiet: true},
+		{name: "After midnight", quiet: overnight, now: time.Date(2026, 3, 2, 6, 59, 0, 0, berlin),
+			wantUntil: time.Date(2026, 3, 2, 7, 0, 0, 0, berlin), wantQuiet: true},
+		{name: "Outside overnight", quiet: overnight, now: time.Date(2026, 3, 2, 7, 0, 0, 0, berlin)},
+		{name: "Read in the user's timezone", quiet: overnight, now: time.Date(2026, 3, 1, 21, 30, 0, 0, time.UTC),
+			wantUntil: time.Date(2026, 3, 2, 7, 0, 0, 0, berlin), wantQuiet: true},
+		{name: "Daytime", quiet: daytime, now: time.Date(2026, 3, 2, 12, 0, 0, 0, berlin),
+			wantUntil: time.Date(2026, 3, 2, 17, 0, 0, 0, berlin), wantQuiet: true},
+		{name: "Outside daytime", quiet: daytime, now: time.Date(2026, 3, 2, 9, 29, 0, 0, berlin)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.quiet.quietUntil(tt.now)
+			if quiet != tt.wantQuiet || !until.Equal(tt.wantUntil) {
+				t.Errorf("quietUntil() = %v, %v, want %v, %v", until, quiet, tt.wantUntil, tt.wantQuiet)
+			}
+		})
+	}
+}
+
+func TestValidateNotificationPreferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferences NotificationPreferences
+		wantErr     bool
+	}{
+		{name: "Defaults"},
+		{name: "Muted event", preferences: NotificationPreferences{Events: map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {}}}},
+		{name: "Quiet hours", preferences: NotificationPreferences{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "America/New_York"}}},
+		{name: "Unknown event", preferences: NotificationPreferences{Events: map[NotificationEvent][]NotificationChannel{"new_follower": {NotificationChannelEmail}}}, wantErr: true},
+		{name: "Unknown channel", preferences: NotificationPreferences{Events: map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {"sms"}}}, wantErr: true},
+		{name: "Invalid time", preferences: NotificationPreferences{QuietHours: &QuietHours{Start: "10pm", End: "07:00", Timezone: "UTC"}}, wantErr: true},
+		{name: "Empty window", preferences: NotificationPreferences{QuietHours: &QuietHours{Start: "07:00", End: "07:00", Timezone: "UTC"}}, wantErr: true},
+		{name: "Unknown timezone", preferences: NotificationPreferences{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateNotificationPreferences(&tt.preferences); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNotificationPreferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeMailer records the recipients, subjects and bodies of the emails it sends, or fails with err
+type fakeMailer struct {
+	sent   []string
+	bodies []string
+	err    error
+}
+
+func (f *fakeMailer) Send(to, subject, body string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, to+": "+subject)
+	f.bodies = append(f.bodies, body)
+	return nil
+}
+
+// linkToken returns the token query value of the link in an email body
+func linkToken(t *testing.T, body string) string {
+	t.Helper()
+	start := strings.Index(body, "token=")
+	if start < 0 {
+		t.Fatalf("no token link in %q", body)
+	}
+	token, _, _ := strings.Cut(body[start+len("token="):], "\n")
+	token, err := url.QueryUnescape(token)
+	if err != nil {
+		t.Fatalf("unescape token: %v", err)
+	}
+	return token
+}
+
+func TestNotifyUser(t *testing.T) {
+	ctx := context.Background()
+	// A window of quiet hours around now, wherever the test runs
+	now := time.Now().UTC()
+	aroundNow := &QuietHours{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04"), Timezone: "UTC"}
+	muted := map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {}}
+
+	tests := []struct {
+		name        string
+		preferences NotificationPreferences
+		mailErr     error
+		wantSent    int
+		wantQueued  int
+	}{
+		{name: "Defaults", wantSent: 1},
+		{name: "Muted", preferences: NotificationPreferences{Events: muted}},
+		{name: "Quiet hours", preferences: NotificationPreferences{QuietHours: aroundNow}, wantQueued: 1},
+		{name: "Delivery failure", mailErr: errors.New("smtp unavailable"), wantQueued: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			userId, err := store.CreateUserWithUsername(ctx, "uploader@example.com", "uploader", "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveNotificationPreferences(ctx, userId, tt.preferences); err != nil {
+				t.Fatal(err)
+			}
+			mailer := &fakeMailer{err: tt.mailErr}
+			notifyUser(ctx, store, mailer, userId, NotificationTakedownReported, "Your animation was reported", "body")
+			if len(mailer.sent) != tt.wantSent || len(store.notifications) != tt.wantQueued {
+				t.Errorf("sent %v with %d queued, want %d sent and %d queued", mailer.sent, len(store.notifications), tt.wantSent, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestDispatchDueNotifications(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	userId, err := store.CreateUserWithUsername(ctx, "uploader@example.com", "uploader", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := func(deliverAfter time.Time) {
+		notification := Notification{UserID: userId, Event: NotificationTakedownDecided, Channel: NotificationChannelEmail,
+			Subject: "Your animation was restored", Body: "body", DeliverAfter: deliverAfter}
+		if err := store.QueueNotification(ctx, notification); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queue(time.Now().Add(-time.Minute))
+	queue(time.Now().Add(time.Hour))
+
+	// Only the notification whose quiet hours are over is sent
+	failing := &fakeMailer{err: errors.New("smtp unavailable")}
+	if count, err := dispatchDueNotifications(ctx, store, failing); err != nil || count != 1 {
+		t.Fatalf("dispatchDueNotifications() = %d, %v, want 1 claimed", count, err)
+	}
+	if len(store.notifications) != 2 || store.notifications[0].lastError != "smtp unavailable" {
+		t.Fatalf("failed notification was not kept for a retry")
+	}
+
+	store.notifications[0].nextAttemptAt = time.Now()
+	mailer := &fakeMailer{}
+	if _, err := dispatchDueNotifications(ctx, store, mailer); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"uploader@example.com: Your animation was restored"}; !reflect.DeepEqual(mailer.sent, want) || len(store.notifications) != 1 {
+		t.Errorf("sent %v with %d queued, want %v and the later notification still queued", mailer.sent, len(store.notifications), want)
+	}
+
+	// Notifications that keep failing are dropped
+	store.notifications[0].nextAttemptAt = time.Now()
+	store.notifications[0].notification.Attempts = notificationMaxAttempts - 1
+	dispatchDueNotifications(ctx, store, failing)
+	if len(store.notifications) != 0 {
+		t.Errorf("%d notifications queued, want the failing one dropped", len(store.notifications))
+	}
+}
+
+func TestNotificationPreferencesHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	token := registerUser(t, router, "uploader")
+
+	var got NotificationPreferences
+	if code := doJSON(t, router, http.MethodGet, "/me/preferences/notifications", token, nil, &got); code != http.StatusOK {
+		t.Fatalf("get status = %d", code)
+	}
+	if !reflect.DeepEqual(got.Events, defaultNotificationChannels) || got.QuietHours != nil {
+		t.Errorf("preferences = %+v, want the defaults", got)
+	}
+
+	update := NotificationPreferences{
+		Events:     map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {}},
+		QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Asia/Tokyo"},
+	}
+	if code := doJSON(t, router, http.MethodPut, "/me/preferences/notifications", token, update, nil); code != http.StatusOK {
+		t.Fatalf("put status = %d", code)
+	}
+	doJSON(t, router, http.MethodGet, "/me/preferences/notifications", token, nil, &got)
+	want := map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {}, NotificationTakedownDecided: {NotificationChannelEmail},
+		NotificationMoodReminder: {NotificationChannelEmail}, NotificationReviewRequested: {NotificationChannelEmail}, NotificationReviewDecided: {NotificationChannelEmail},
+		NotificationClientMoodAlert: {}, NotificationSubscriptionPublished: {NotificationChannelEmail}}
+	if !reflect.DeepEqual(got.Events, want) || !reflect.DeepEqual(got.QuietHours, update.QuietHours) {
+		t.Errorf("preferences = %+v, want %v with the quiet hours saved", got, want)
+	}
+
+	invalid := NotificationPreferences{Events: map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {"pager"}}}
+	if code := doJSON(t, router, http.MethodPut, "/me/preferences/notifications", token, invalid, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown channel status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// OAuth secrets carry prefixes that mark them apart from the JWTs users sign in with
+	oauthCodePrefix         = "oac_"
+	oauthAccessTokenPrefix  = "oat_"
+	oauthRefreshTokenPrefix = "ort_"
+	maxOAuthAppNameLength   = 80
+	// maxOAuthApps caps how many apps one developer may register
+	maxOAuthApps = 10
+	// maxOAuthRedirectURIs caps how many redirect URIs one app may register
+	maxOAuthRedirectURIs = 5
+	oauthCodeLifetime    = 10 * time.Minute
+	oauthAccessLifetime  = time.Hour
+	oauthRefreshLifetime = 30 * 24 * time.Hour
+	// maxOAuthStateLength caps the state an app round-trips through the consent screen
+	maxOAuthStateLength = 500
+)
+
+// Scopes third-party apps may ask for
+const (
+	ScopeFeedRead   = "feed:read"
+	ScopeMoodsRead  = "moods:read"
+	ScopeMoodsWrite = "moods:write"
+)
+
+// OAuthScopes are the scopes apps may ask for, as the consent screen explains them
+var OAuthScopes = []OAuthScopeDescription{
+	{Scope: ScopeFeedRead, Description: "Browse the animation feed as you, with your content preferences"},
+	{Scope: ScopeMoodsRead, Description: "Read your mood check-ins"},
+	{Scope: ScopeMoodsWrite, Description: "Check in your mood after an animation"},
+}
+
+// appRouteScopes are the routes third-party apps may call, by method and path template, with the
+// scope their access token must carry. Access tokens open no other route.
+var appRouteScopes = map[string]string{
+	http.MethodGet + " /feed":       ScopeFeedRead,
+	http.MethodGet + " /moods":      ScopeMoodsRead,
+	http.MethodPost + " /save-mood": ScopeMoodsWrite,
+}
+
+// appTokenKey holds the OAuth token a request was authenticated with
+const appTokenKey contextKey = "appToken"
+
+// GetAppTokenFromContext retrieves the OAuth token a third-party app authenticated a request with
+func GetAppTokenFromContext(ctx context.Context) (OAuthToken, bool) {
+	token, ok := ctx.Value(appTokenKey).(OAuthToken)
+	return token, ok
+}
+
+// newOAuthSecret returns a random secret with prefix and the hash it is stored under
+func newOAuthSecret(prefix string) (string, string, error) {
+	secret, err := generateRandomID()
+	if err != nil {
+		return "", "", err
+	}
+	secret = prefix + secret
+	return secret, HashToken(secret), nil
+}
+
+// validOAuthRedirectURI reports whether an app may register uri: an absolute https URL, or http on
+// the loopback interface for apps running on the user's machine, without a fragment
+func validOAuthRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" || parsed.Fragment != "" || parsed.User != nil {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+// ValidateOAuthApp checks an app registration and returns the app it describes, with the redirect
+// URIs without repeats
+func ValidateOAuthApp(req OAuthAppRequest) (OAuthApp, error) {
+	app := OAuthApp{Name: strings.TrimSpace(req.Name), RedirectURIs: []string{}}
+	if app.Name == "" || len(app.Name) > maxOAuthAppNameLength {
+		return OAuthApp{}, fmt.Errorf("name must be 1-%d characters", maxOAuthAppNameLength)
+	}
+	for _, uri := range req.RedirectURIs {
+		uri = strings.TrimSpace(uri)
+		if !validOAuthRedirectURI(uri) {
+			return OAuthApp{}, fmt.Errorf("redirect URI %q must be an https URL, or http on localhost, without a fragment", uri)
+		}
+		if !slices.Contains(app.RedirectURIs, uri) {
+			app.RedirectURIs = append(app.RedirectURIs, uri)
+		}
+	}
+	if len(app.RedirectURIs) == 0 || len(app.RedirectURIs) > maxOAuthRedirectURIs {
+		return OAuthApp{}, fmt.Errorf("apps need 1-%d redirect URIs", maxOAuthRedirectURIs)
+	}
+	return app, nil
+}
+
+// ParseOAuthScope reads a space-separated scope parameter into known scopes without repeats, in
+// the order OAuthScopes lists them
+func ParseOAuthScope(scope string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return nil, errors.New("scope is required")
+	}
+	var scopes []string
+	for _, known := range OAuthScopes {
+		if slices.Contains(requested, known.Scope) {
+			scopes = append(scopes, known.Scope)
+		}
+	}
+	for _, name := range requested {
+		if !slices.Contains(scopes, name) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+	}
+	return scopes, nil
+}
+
+// describeOAuthScopes returns how the consent screen explains scopes
+func describeOAuthScopes(scopes []string) []OAuthScopeDescription {
+	descriptions := make([]OAuthScopeDescription, 0, len(scopes))
+	for _, known := range OAuthScopes {
+		if slices.Contains(scopes, known.Scope) {
+			descriptions = append(descriptions, known)
+		}
+	}
+	return descriptions
+}
+
+// validPKCEValue reports whether a code verifier or S256 challenge has the length and characters
+// RFC 7636 allows
+func validPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyPKCE reports whether verifier is the one an S256 challenge was made from
+func VerifyPKCE(verifier, challenge string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// checkOAuthAuthorization checks an app's authorization request against the app and returns the
+// scopes it asks for. Apps must use PKCE with S256 and a redirect URI they registered.
+func checkOAuthAuthorization(app OAuthApp, req OAuthAuthorizeRequest) ([]string, error) {
+	if !slices.Contains(app.RedirectURIs, req.RedirectURI) {
+		return nil, errors.New("redirect_uri is not registered for this app")
+	}
+	if req.CodeChallengeMethod != "S256" || !validPKCEValue(req.CodeChallenge) {
+		return nil, errors.New("a code_challenge with code_challenge_method S256 is required")
+	}
+	if len(req.State) > maxOAuthStateLength {
+		return nil, fmt.Errorf("state must be at most %d characters", maxOAuthStateLength)
+	}
+	return ParseOAuthScope(req.Scope)
+}
+
+// oauthRedirect returns redirectURI with params added to its query
+func oauthRedirect(redirectURI string, params url.Values) string {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := parsed.Query()
+	for name, values := range params {
+		if values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// issueOAuthToken returns a new token pair for an app and the hashes it is stored under
+func issueOAuthToken(clientId, userId string, scopes []string, now time.Time) (OAuthToken, OAuthTokenResponse, string, string, error) {
+	access, accessHash, err := newOAuthSecret(oauthAccessTokenPrefix)
+	if err != nil {
+		return OAuthToken{}, OAuthTokenResponse{}, "", "", err
+	}
+	refresh, refreshHash, err := newOAuthSecret(oauthRefreshTokenPrefix)
+	if err != nil {
+		return OAuthToken{}, OAuthTokenResponse{}, "", "", err
+	}
+	token := OAuthToken{
+		ClientID:         clientId,
+		UserID:           userId,
+		Scopes:           scopes,
+		ExpiresAt:        now.Add(oauthAccessLifetime),
+		RefreshExpiresAt: now.Add(oauthRefreshLifetime),
+	}
+	response := OAuthTokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessLifetime.Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(scopes, " "),
+	}
+	return token, response, accessHash, refreshHash, nil
+}
+
+// encodeOAuthError writes a token endpoint error in the shape RFC 6749 gives it
+func encodeOAuthError(w http.ResponseWriter, code, description string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// appRouteScope returns the scope an access token needs for the route a request matched, under
+// any API version, or false when apps may not call it
+func appRouteScope(r *http.Request) (string, bool) {
+	route, ok := currentRouteKey(r)
+	if !ok {
+		return "", false
+	}
+	scope, ok := appRouteScopes[route]
+	return scope, ok
+}
+
+// currentRouteKey returns the method and path template of the route a request matched, without
+// its API version prefix, as in "GET /feed"
+func currentRouteKey(r *http.Request) (string, bool) {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return "", false
+	}
+	template, err := current.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return r.Method + " " + unversionedRoute(template), true
+}
+
+// AppTokenMiddleware authenticates third-party apps by the OAuth access token they send as a
+// bearer token, on the routes appRouteScopes opens to the token's scopes, and adds the user who
+// let them in to the context. Requests with any other credentials pass through untouched; the
+// auth middlewares after it let app requests through once this has checked them.
+func (s *Server) AppTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if r.Method == http.MethodOptions || !bearer || !strings.HasPrefix(secret, oauthAccessTokenPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope, ok := appRouteScope(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			EncodeError(w, "Third-party apps may not use this route", http.StatusForbidden)
+			return
+		}
+		token, err := s.store.GetOAuthTokenByAccessHash(r.Context(), HashToken(secret))
+		if err != nil && err.Error() != "oauth token not found" {
+			LogResponse(r.URL.Path, "Error retrieving OAuth token", err)
+			EncodeError(w, "Error retrieving access token", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || !time.Now().Before(token.ExpiresAt) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			EncodeErrorCode(w, ErrCodeInvalidToken, "Invalid or expired access token", http.StatusUnauthorized)
+			return
+		}
+		if !slices.Contains(token.Scopes, scope) {
+			LogResponse(r.URL.Path, "App "+token.ClientID+" lacks scope "+scope, nil)
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			EncodeError(w, "The access token does not carry the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+
+		ctx := SetUserIDInContext(r.Context(), token.UserID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, appTokenKey, token)))
+	})
+}
@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateOAuthApp(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     OAuthAppRequest
+		want    []string
+		wantErr bool
+	}{
+		{name: "https", req: OAuthAppRequest{Name: " Journal ", RedirectURIs: []string{"https://journal.example/cb", "https://journal.example/cb"}}, want: []string{"https://journal.example/cb"}},
+		{name: "Loopback over http", req: OAuthAppRequest{Name: "CLI", RedirectURIs: []string{"http://127.0.0.1:8765/cb"}}, want: []string{"http://127.0.0.1:8765/cb"}},
+		{name: "Plain http", req: OAuthAppRequest{Name: "Journal", RedirectURIs: []string{"http://journal.example/cb"}}, wantErr: true},
+		{name: "Fragment", req: OAuthAppRequest{Name: "Journal", RedirectURIs: []string{"https://journal.example/cb#x"}}, wantErr: true},
+		{name: "No redirect URIs", req: OAuthAppRequest{Name: "Journal"}, wantErr: true},
+		{name: "No name", req: OAuthAppRequest{RedirectURIs: []string{"https://journal.example/cb"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, err := ValidateOAuthApp(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateOAuthApp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(app.RedirectURIs, tt.want) {
+				t.Errorf("redirect URIs = %v, want %v", app.RedirectURIs, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOAuthScope(t *testing.T) {
+	scopes, err := ParseOAuthScope("moods:write feed:read moods:write")
+	if err != nil || !reflect.DeepEqual(scopes, []string{ScopeFeedRead, ScopeMoodsWrite}) {
+		t.Errorf("ParseOAuthScope() = %v, %v, want the known scopes in order", scopes, err)
+	}
+	for _, scope := range []string{"", "feed:read admin"} {
+		if _, err := ParseOAuthScope(scope); err == nil {
+			t.Errorf("ParseOAuthScope(%q) succeeded, want an error", scope)
+		}
+	}
+}
+
+// pkceChallenge returns the S256 challenge of a code verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// postForm posts form-encoded values through the router and decodes a successful JSON answer into out
+func postForm(t *testing.T, router http.Handler, path string, values url.Values, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s response: %v", path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	developer := registerUser(t, router, "developer")
+	user := registerUser(t, router, "user")
+
+	var app OAuthApp
+	if code := doJSON(t, router, http.MethodPost, "/me/oauth-apps", developer, OAuthAppRequest{Name: "Journal", RedirectURIs: []string{"https://journal.example/cb"}}, &app); code != http.StatusCreated {
+		t.Fatalf("register app status = %d", code)
+	}
+
+	verifier := strings.Repeat("v", 50)
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {app.ClientID},
+		"redirect_uri":          {"https://journal.example/cb"},
+		"scope":                 {"moods:read moods:write"},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	var consent OAuthConsent
+	if code := doJSON(t, router, http.MethodGet, "/oauth/authorize?"+query.Encode(), user, nil, &consent); code != http.StatusOK {
+		t.Fatalf("consent status = %d", code)
+	}
+	if consent.AppName != "Journal" || len(consent.Scopes) != 2 || consent.Scopes[0].Description == "" {
+		t.Errorf("consent = %+v, want the app and both scopes explained", consent)
+	}
+	unregistered := url.Values{}
+	for name, values := range query {
+		unregistered[name] = values
+	}
+	unregistered.Set("redirect_uri", "https://evil.example/cb")
+	if code := doJSON(t, router, http.MethodGet, "/oauth/authorize?"+unregistered.Encode(), user, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("unregistered redirect status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	answer := oauthAuthorizeRequest(query)
+	var denied OAuthAuthorizeResponse
+	doJSON(t, router, http.MethodPost, "/oauth/authorize", user, answer, &denied)
+	if denied.RedirectTo != "https://journal.example/cb?error=access_denied&state=xyz" {
+		t.Errorf("denied redirect = %q", denied.RedirectTo)
+	}
+	answer.Approve = true
+	var approved OAuthAuthorizeResponse
+	doJSON(t, router, http.MethodPost, "/oauth/authorize", user, answer, &approved)
+	redirect, _ := url.Parse(approved.RedirectTo)
+	authCode := redirect.Query().Get("code")
+	if !strings.HasPrefix(authCode, oauthCodePrefix) || redirect.Query().Get("state") != "xyz" {
+		t.Fatalf("approved redirect = %q, want a code and the state", approved.RedirectTo)
+	}
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {app.ClientID},
+		"code":          {authCode},
+		"redirect_uri":  {"https://journal.example/cb"},
+		"code_verifier": {strings.Repeat("w", 50)},
+	}
+	if code := postForm(t, router, "/oauth/token", exchange, nil); code != http.StatusBadRequest {
+		t.Errorf("wrong verifier status = %d, want %d", code, http.StatusBadRequest)
+	}
+	// A failed exchange uses the code up, so the user is asked again
+	doJSON(t, router, http.MethodPost, "/oauth/authorize", user, answer, &approved)
+	redirect, _ = url.Parse(approved.RedirectTo)
+	exchange.Set("code", redirect.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+	var tokens OAuthTokenResponse
+	if code := postForm(t, router, "/oauth/token", exchange, &tokens); code != http.StatusOK {
+		t.Fatalf("exchange status = %d", code)
+	}
+	if tokens.Scope != "moods:read moods:write" || tokens.TokenType != "Bearer" {
+		t.Errorf("tokens = %+v, want both mood scopes", tokens)
+	}
+	if code := postForm(t, router, "/oauth/token", exchange, nil); code != http.StatusBadRequest {
+		t.Errorf("second exchange status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Scoped route", method: http.MethodGet, path: "/moods", wantCode: http.StatusOK},
+		{name: "Scope not granted", method: http.MethodGet, path: "/feed", wantCode: http.StatusForbidden},
+		{name: "Route closed to apps", method: http.MethodGet, path: "/me/oauth-grants", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tokens.AccessToken, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var refreshed OAuthTokenResponse
+	refresh := url.Values{"grant_type": {"refresh_token"}, "client_id": {app.ClientID}, "refresh_token": {tokens.RefreshToken}}
+	if code := postForm(t, router, "/oauth/token", refresh, &refreshed); code != http.StatusOK || refreshed.Scope != tokens.Scope {
+		t.Fatalf("refresh = %d %+v, want the same scopes", code, refreshed)
+	}
+	if code := postForm(t, router, "/oauth/token", refresh, nil); code != http.StatusBadRequest {
+		t.Errorf("reused refresh token status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/moods", tokens.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("replaced access token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	var grants OAuthGrantsResponse
+	doJSON(t, router, http.MethodGet, "/me/oauth-grants", user, nil, &grants)
+	if len(grants.Grants) != 1 || grants.Grants[0].AppName != "Journal" || !reflect.DeepEqual(grants.Grants[0].Scopes, []string{ScopeMoodsRead, ScopeMoodsWrite}) {
+		t.Errorf("grants = %+v, want the journal with both mood scopes", grants.Grants)
+	}
+	if code := doJSON(t, router, http.MethodDelete, "/me/oauth-grants/"+app.ClientID, user, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("disconnect status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/moods", refreshed.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("disconnected access token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := postForm(t, router, "/oauth/revoke", url.Values{"token": {refreshed.RefreshToken}, "client_id": {app.ClientID}}, nil); code != http.StatusOK {
+		t.Errorf("revoke unknown token status = %d, want %d", code, http.StatusOK)
+	}
+}
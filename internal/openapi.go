@@ -0,0 +1,583 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the document follows
+const openAPIVersion = "3.1.0"
+
+// Security schemes, named in the document's components
+const (
+	securityBearer         = "bearerAuth"
+	securityKiosk          = "kioskToken"
+	securityIntegrationKey = "integrationKey"
+)
+
+// apiOperation describes what one route takes and returns beyond what the router knows
+type apiOperation struct {
+	Summary string
+	// Request is a value of the JSON body's type, or nil for routes without one
+	Request interface{}
+	// Form marks a form-encoded body, described in the summary
+	Form bool
+	// Response is a value of the JSON body's type, an apiOneOf of its possible types, or nil
+	Response interface{}
+	// Status is the success status, 200 unless set
+	Status int
+	// ContentType is the type of a response body that is not JSON
+	ContentType string
+	// Query names the query parameters the route reads
+	Query []string
+	// OptionalAuth marks public routes that answer differently when a user token is sent
+	OptionalAuth bool
+	// Security names the scheme of routes that authenticate outside the protected subrouters
+	Security string
+}
+
+// apiOneOf lists the types a response body may have
+type apiOneOf []interface{}
+
+// apiOperations documents every route, keyed by method and path template without a version
+// prefix, or with one for routes whose shapes differ between versions. TestOpenAPIDocumentsEveryRoute
+// fails for routes missing here.
+var apiOperations = map[string]apiOperation{
+	// Public routes
+	"POST /register":                    {Summary: "Register a new user", Request: RegisterRequest{}, Response: RegisterResponse{}},
+	"POST /login":                       {Summary: "Login user", Request: LoginRequest{}, Response: LoginResponse{}},
+	"POST /login/magic-link":            {Summary: "Email a single-use passwordless login link", Request: MagicLinkRequest{}, Response: MagicLinkResponse{}, Status: http.StatusAccepted},
+	"GET /login/magic":                  {Summary: "Exchange a login link token for a JWT", Query: []string{"token"}, Response: LoginResponse{}},
+	"GET /animation/{id}.js":            {Summary: "The animation's code as JavaScript", ContentType: "application/javascript"},
+	"GET /animation/{id}":               {Summary: "Retrieve an animation by ID, with a playback session; mode=instance returns its code in p5.js instance mode", Query: []string{"mode"}, Response: GetAnimationResponse{}, OptionalAuth: true},
+	"GET /v1/animation/{id}":            {Summary: "Retrieve an animation by ID in the v1 shape", Query: []string{"mode"}, Response: AnimationV1{}},
+	"GET /v1/feed":                      {Summary: "A random animation, or a page of the feed, in the v1 shape", Query: []string{"limit", "offset", "reducedMotion"}, Response: apiOneOf{AnimationV1{}, AnimationFeedV1{}}, OptionalAuth: true},
+	"GET /v2/animation/{id}":            {Summary: "Retrieve an animation by ID in the v2 shape", Query: []string{"mode"}, Response: GetAnimationResponse{}, OptionalAuth: true},
+	"GET /v2/feed":                      {Summary: "A random animation, or a page of the feed, in the v2 shape", Query: []string{"limit", "offset", "reducedMotion"}, Response: apiOneOf{GetAnimationResponse{}, GetAnimationFeedResponse{}}, OptionalAuth: true},
+	"GET /animation/{id}/changelog":     {Summary: "The owner's change notes for an animation, newest first", Response: []ChangelogEntry{}},
+	"GET /animation/{id}/frames":        {Summary: "Evenly spaced PNG frames from the animation's first two seconds", Query: []string{"count"}, Response: PreviewFramesResponse{}},
+	"GET /animation/{id}/thumbnail":     {Summary: "The animation's PNG thumbnail", ContentType: "image/png"},
+	"GET /animation/{id}/embed":         {Summary: "A standalone HTML page playing the animation", ContentType: "text/html"},
+	"GET /exports/{id}":                 {Summary: "Download an export as an attachment", ContentType: "application/octet-stream"},
+	"GET /animation/{id}/compatibility": {Summary: "Whether the animation runs on each major p5.js version", Response: []P5Compatibility{}},
+	"GET /animation/{id}/comments":      {Summary: "An animation's comments, oldest first", Query: []string{"limit", "offset"}, Response: CommentsResponse{}},
+	"POST /animation/{id}/views":        {Summary: "Report a view in a playback session, and later how the playback went", Request: RecordViewRequest{}, Status: http.StatusNoContent},
+	"GET /animation/{id}/moods":         {Summary: "How often each mood was recorded after viewing the animation", Response: MoodSummary{}},
+	"GET /feed":                         {Summary: "A random animation, or with limit or offset a page of the feed; 204 when it is empty", Query: []string{"limit", "offset", "reducedMotion"}, Response: apiOneOf{GetAnimationResponse{}, GetAnimationFeedResponse{}}, OptionalAuth: true},
+	"GET /search":                       {Summary: "Search animation descriptions, best match first", Query: []string{"q", "limit", "offset", "p5Version"}, Response: SearchAnimationsResponse{}, OptionalAuth: true},
+	"GET /search/semantic":              {Summary: "Search animations by meaning, most similar first", Query: []string{"q", "limit", "offset"}, Response: SemanticSearchResponse{}, OptionalAuth: true},
+	"GET /p5-versions":                  {Summary: "Registered p5.js builds, newest first", Response: []P5Library{}},
+	"GET /datasets/latest":              {Summary: "The latest anonymized research dataset", Response: Dataset{}},
+	"GET /metrics":                      {Summary: "Prometheus metrics; requires METRICS_TOKEN as a bearer token when set", ContentType: "text/plain"},
+	"GET /status":                       {Summary: "The health of the service and its open and recent incidents", Response: StatusResponse{}},
+	"GET /openapi.json":                 {Summary: "This document", ContentType: "application/json"},
+	"GET /docs":                         {Summary: "Swagger UI for this document", ContentType: "text/html"},
+	"GET /prompt-presets":               {Summary: "The gallery of presets users shared, newest first", Query: []string{"limit", "offset"}, Response: PromptPresetsResponse{}},
+
+	// Public collections are syndicated to other sites without signing in
+	"GET /collections/{id:[0-9]+}/feed.json": {Summary: "A page of a public collection as a JSON Feed, linking to the next page", Query: []string{"limit", "offset"}, Response: JSONFeed{}},
+	"GET /collections/{id:[0-9]+}/feed.rss":  {Summary: "A page of a public collection as an RSS feed, linking to the next page", Query: []string{"limit", "offset"}, ContentType: "application/rss+xml"},
+
+	"GET /signage/schedules/{id}/now":                         {Summary: "The animation a screen should play now and until when", Response: SignageNowPlaying{}},
+	"GET /profile/revert-email":                               {Summary: "The page the link sent to the previous address of an email change opens, asking to confirm the revert", Query: []string{"token"}, ContentType: "text/html"},
+	"POST /profile/revert-email":                              {Summary: "Undo an email change and sign the account out everywhere; form-encoded token from the confirm page", Form: true, ContentType: "text/html"},
+	"GET /me/moods.ics":                                       {Summary: "Your mood check-ins as an iCalendar feed, found by the feed's token", Query: []string{"token"}, ContentType: "text/calendar"},
+	"POST /integrations/{platform:slack|discord}/events/{id}": {Summary: "Reactions sent by Slack's Events API or a Discord relay, signed rather than authenticated"},
+	"POST /oauth/token":                                       {Summary: "Exchange an authorization code or refresh token for a token pair; form-encoded", Form: true, Response: OAuthTokenResponse{}},
+	"POST /oauth/revoke":                                      {Summary: "Revoke an access or refresh token and its pair; form-encoded", Form: true},
+	"POST /takedown-requests":                                 {Summary: "Report an animation for removal", Request: TakedownReportRequest{}, Response: TakedownRequest{}, Status: http.StatusCreated},
+	"GET /announcements/active":                               {Summary: "The announcements shown to you now, newest first", Response: []Announcement{}, OptionalAuth: true},
+	"GET /widget/random.json":                                 {Summary: "The calm animation of the moment for embedded widgets", Response: WidgetAnimation{}},
+	"GET /widget/random.js":                                   {Summary: "A script that shows the animation of the moment where it is included", ContentType: "application/javascript"},
+	"GET /ws":                                                 {Summary: "WebSocket pushing the status of your generations; send the token as the subprotocols \"bearer\" and the token", Security: securityBearer},
+
+	// Kiosk routes
+	"GET /kiosk":                    {Summary: "The name, schedules and feed access of the display's token", Response: KioskAssignment{}},
+	"GET /kiosk/schedules/{id}/now": {Summary: "What one of the display's schedules plays now", Response: SignageNowPlaying{}},
+	"GET /kiosk/feed":               {Summary: "A random animation from the feed, without mood summaries", Response: GetAnimationResponse{}},
+	"GET /kiosk/animation/{id}":     {Summary: "An animation the display may play, without its mood summary", Response: GetAnimationResponse{}},
+
+	// Integration trigger routes
+	"GET /integrations/triggers":         {Summary: "Whose key it is and the events it may poll", Response: TriggersResponse{}},
+	"GET /integrations/triggers/{event}": {Summary: "What you saved since the cursor, newest first", Query: []string{"since"}, Response: TriggerResponse{}},
+
+	// Protected routes
+	"POST /generate-animation":                               {Summary: "Queue the generation of an animation from a description, once per Idempotency-Key", Request: AnimationRequest{}, Response: GenerationJob{}, Status: http.StatusAccepted},
+	"POST /generate-animation/stream":                        {Summary: "Generate an animation, streaming progress and code as server-sent events", Request: AnimationRequest{}, ContentType: "text/event-stream"},
+	"GET /jobs/{id}":                                         {Summary: "The status of one of your generation jobs", Response: GenerationJob{}},
+	"POST /save-animation":                                   {Summary: "Save an animation, once per Idempotency-Key", Request: SaveAnimationRequest{}, Response: SaveAnimationResponse{}},
+	"PATCH /animation/{id}":                                  {Summary: "Update the code and/or description of one of your animations", Request: UpdateAnimationRequest{}, Response: SaveAnimationResponse{}},
+	"DELETE /animation/{id}":                                 {Summary: "Delete one of your animations along with its moods", Status: http.StatusNoContent},
+	"POST /animation/{id}/refine":                            {Summary: "Ask for a change to one of your animations without saving it", Request: RefineRequest{}, Response: AnimationResponse{}},
+	"POST /animation/{id}/export":                            {Summary: "Render an animation into a GIF or MP4; 200 with an unexpired export of the same settings", Request: ExportRequest{}, Response: AnimationExport{}, Status: http.StatusCreated},
+	"GET /animation/{id}/versions":                           {Summary: "Every version of one of your animations, newest first, without the code", Response: []AnimationVersion{}},
+	"GET /animation/{id}/versions/{version:[0-9]+}":          {Summary: "One version of one of your animations, with its code", Response: AnimationVersion{}},
+	"POST /animation/{id}/versions/{version:[0-9]+}/restore": {Summary: "Make an earlier version of one of your animations current again", Response: AnimationVersion{}},
+	"POST /animation/{id}/comments":                          {Summary: "Comment on an animation", Request: CreateCommentRequest{}, Response: Comment{}, Status: http.StatusCreated},
+	"DELETE /animation/{id}/comments/{commentId:[0-9]+}":     {Summary: "Delete a comment you wrote or one on your animation", Status: http.StatusNoContent},
+	"GET /my-animations":                                     {Summary: "The animations you saved, newest first", Query: []string{"limit", "offset"}, Response: MyAnimationsResponse{}},
+	"GET /quota":                                             {Summary: "Your daily and monthly generation usage", Response: GenerationQuota{}},
+	"POST /save-mood":                                        {Summary: "Save your mood after viewing an animation", Request: SaveMoodRequest{}, Response: SaveMoodResponse{}},
+	"GET /moods":                                             {Summary: "Your mood history, newest first", Query: []string{"from", "to", "limit", "offset"}, Response: MoodsResponse{}},
+	"PATCH /profile":                                         {Summary: "Update your username and/or email", Request: UpdateProfileRequest{}, Response: User{}},
+	"GET /me/preferences/content":                            {Summary: "Your content preferences", Response: ContentPreferences{}},
+	"PUT /me/preferences/content":                            {Summary: "Replace your content preferences", Request: ContentPreferences{}, Response: ContentPreferences{}},
+	"GET /me/preferences/notifications":                      {Summary: "The channels each notification event is delivered on, and your quiet hours", Response: NotificationPreferences{}},
+	"PUT /me/preferences/notifications":                      {Summary: "Replace your notification preferences", Request: NotificationPreferences{}, Response: NotificationPreferences{}},
+	"GET /me/reminders":                                      {Summary: "Your mood check-in reminders and adherence", Response: RemindersResponse{}},
+	"PUT /me/reminders":                                      {Summary: "Replace your reminder times", Request: ReminderSchedule{}, Response: RemindersResponse{}},
+	"POST /announcements/{id:[0-9]+}/dismiss":                {Summary: "Stop showing an announcement to you", Status: http.StatusNoContent},
+	"POST /takedown-requests/{id}/appeal":                    {Summary: "Appeal the removal of one of your animations", Request: TakedownAppealRequest{}, Response: TakedownRequest{}},
+	"GET /me/professionals":                                  {Summary: "The professionals you are or were linked to", Response: []ClientLink{}},
+	"POST /me/professionals/accept":                          {Summary: "Accept a therapist's or coach's invitation", Request: AcceptClientInviteRequest{}, Response: ClientLink{}},
+	"DELETE /me/professionals/{linkId:[0-9]+}":               {Summary: "End a link to a professional", Status: http.StatusNoContent},
+	"PUT /me/professionals/{linkId:[0-9]+}/consent":          {Summary: "Grant or revoke access to your mood trends", Request: MoodTrendConsentRequest{}, Response: ClientLink{}},
+	"GET /me/professionals/{linkId:[0-9]+}/audit":            {Summary: "Everything done on a link to a professional", Response: []ProfessionalAuditEntry{}},
+	"GET /me/reports/monthly.pdf":                            {Summary: "Your monthly wellbeing report; 202 with Retry-After while it renders", Query: []string{"month"}, ContentType: "application/pdf"},
+	"POST /me/calendar-feed":                                 {Summary: "Issue the address calendar apps subscribe to your mood check-ins at", Response: CalendarFeed{}, Status: http.StatusCreated},
+	"DELETE /me/calendar-feed":                               {Summary: "Stop your calendar feed", Status: http.StatusNoContent},
+	"GET /me/impersonations":                                 {Summary: "Admins' impersonations of your account, newest first", Response: ImpersonationsResponse{}},
+	"DELETE /me/impersonations/{id:[0-9]+}":                  {Summary: "Withdraw your approval of an impersonation, or end it while it runs", Status: http.StatusNoContent},
+	"POST /me/impersonations/{id:[0-9]+}/approve":            {Summary: "Let an admin view the service as you", Response: Impersonation{}},
+	"POST /me/impersonations/{id:[0-9]+}/deny":               {Summary: "Refuse an admin's request to view the service as you", Response: Impersonation{}},
+	"GET /me/impersonations/{id:[0-9]+}/audit":               {Summary: "Everything done in and to an impersonation of your account", Response: []ImpersonationAuditEntry{}},
+	"GET /subscriptions":                                     {Summary: "The tags and creators you follow, oldest first", Response: SubscriptionsResponse{}},
+	"POST /subscriptions":                                    {Summary: "Follow a tag or creator to be notified of their new animations", Request: SubscriptionRequest{}, Response: Subscription{}, Status: http.StatusCreated},
+	"DELETE /subscriptions/{id:[0-9]+}":                      {Summary: "Stop following a tag or creator", Status: http.StatusNoContent},
+	"GET /me/integration-keys":                               {Summary: "Your integration keys, newest first", Response: IntegrationKeysResponse{}},
+	"POST /me/integration-keys":                              {Summary: "Issue a key for a no-code tool to poll your triggers with", Request: IntegrationKeyRequest{}, Response: IntegrationKey{}, Status: http.StatusCreated},
+	"DELETE /me/integration-keys/{id:[0-9]+}":                {Summary: "Revoke one of your integration keys", Status: http.StatusNoContent},
+	"GET /oauth/authorize":                                   {Summary: "Check an app's authorization request and return what the consent screen shows", Query: []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}, Response: OAuthConsent{}},
+	"POST /oauth/authorize":                                  {Summary: "Answer the consent screen", Request: OAuthAuthorizeRequest{}, Response: OAuthAuthorizeResponse{}},
+	"GET /me/oauth-apps":                                     {Summary: "The apps you registered, newest first", Response: OAuthAppsResponse{}},
+	"POST /me/oauth-apps":                                    {Summary: "Register a third-party app", Request: OAuthAppRequest{}, Response: OAuthApp{}, Status: http.StatusCreated},
+	"DELETE /me/oauth-apps/{clientId}":                       {Summary: "Delete one of your apps with every token it was issued", Status: http.StatusNoContent},
+	"GET /me/oauth-grants":                                   {Summary: "The apps you let in, with the scopes they hold", Response: OAuthGrantsResponse{}},
+	"DELETE /me/oauth-grants/{clientId}":                     {Summary: "Disconnect an app, revoking every token it holds", Status: http.StatusNoContent},
+	"GET /me/sessions":                                       {Summary: "Animations your professionals recommended, newest first", Response: []SessionAssignment{}},
+	"GET /me/prompt-presets":                                 {Summary: "Your prompt presets, newest first", Query: []string{"limit", "offset"}, Response: PromptPresetsResponse{}},
+	"POST /me/prompt-presets":                                {Summary: "Save a description with placeholders as a preset", Request: PromptPresetRequest{}, Response: PromptPreset{}, Status: http.StatusCreated},
+	"PUT /me/prompt-presets/{id:[0-9]+}":                     {Summary: "Replace one of your presets", Request: PromptPresetRequest{}, Response: PromptPreset{}},
+	"DELETE /me/prompt-presets/{id:[0-9]+}":                  {Summary: "Delete one of your presets", Status: http.StatusNoContent},
+	"GET /me/collections":                                    {Summary: "Your collections, newest first", Query: []string{"limit", "offset"}, Response: CollectionsResponse{}},
+	"POST /me/collections":                                   {Summary: "Curate animations into a collection", Request: CollectionRequest{}, Response: Collection{}, Status: http.StatusCreated},
+	"PUT /me/collections/{id:[0-9]+}":                        {Summary: "Replace one of your collections", Request: CollectionRequest{}, Response: Collection{}},
+	"DELETE /me/collections/{id:[0-9]+}":                     {Summary: "Delete one of your collections", Status: http.StatusNoContent},
+	"GET /me/provider-key":                                   {Summary: "The provider and last characters of your own API key, with its usage", Response: ProviderKey{}},
+	"PUT /me/provider-key":                                   {Summary: "Generate with your own API key instead of the house key", Request: ProviderKeyRequest{}, Response: ProviderKey{}},
+	"DELETE /me/provider-key":                                {Summary: "Go back to the house key and its quota", Status: http.StatusNoContent},
+	"GET /me/organization":                                   {Summary: "The workspace you are in, with its credits and members", Response: Organization{}},
+	"GET /signage/schedules":                                 {Summary: "Your signage schedules, newest first", Response: SignageSchedulesResponse{}},
+	"POST /signage/schedules":                                {Summary: "Define a playlist of time slots for signage screens", Request: SignageScheduleRequest{}, Response: SignageSchedule{}, Status: http.StatusCreated},
+	"GET /signage/schedules/{id}":                            {Summary: "One of your signage schedules", Response: SignageSchedule{}},
+	"PUT /signage/schedules/{id}":                            {Summary: "Replace one of your signage schedules", Request: SignageScheduleRequest{}, Response: SignageSchedule{}},
+	"DELETE /signage/schedules/{id}":                         {Summary: "Delete one of your signage schedules", Status: http.StatusNoContent},
+	"POST /orgs":                                             {Summary: "Create a workspace you own", Request: OrganizationRequest{}, Response: Organization{}, Status: http.StatusCreated},
+	"GET /orgs/{id:[0-9]+}":                                  {Summary: "A workspace you are in, with its credits and members", Response: Organization{}},
+	"DELETE /orgs/{id:[0-9]+}":                               {Summary: "Delete a workspace you own along with its usage", Status: http.StatusNoContent},
+	"POST /orgs/{id:[0-9]+}/members":                         {Summary: "Add a user to a workspace you own", Request: OrganizationMemberRequest{}, Response: OrganizationMember{}, Status: http.StatusCreated},
+	"PUT /orgs/{id:[0-9]+}/members/{userId}":                 {Summary: "Change a member's monthly limit", Request: OrganizationMemberRequest{}, Response: OrganizationMember{}},
+	"DELETE /orgs/{id:[0-9]+}/members/{userId}":              {Summary: "Remove a member from a workspace you own, or leave one", Status: http.StatusNoContent},
+	"GET /orgs/{id:[0-9]+}/usage":                            {Summary: "How a workspace you own used its credits in a month", Query: []string{"month"}, Response: OrganizationUsage{}},
+	"PUT /orgs/{id:[0-9]+}/review":                           {Summary: "Require your approval before members' new animations appear in the feed", Request: OrganizationReviewRequest{}, Response: Organization{}},
+	"GET /orgs/{id:[0-9]+}/reviews":                          {Summary: "Members' animations held for review in a workspace you own, oldest first", Query: []string{"status", "limit", "offset"}, Response: AnimationReviewsResponse{}},
+	"PUT /orgs/{id:[0-9]+}/reviews/{animationId}":            {Summary: "Approve a member's animation into the feed, or reject it", Request: ReviewDecisionRequest{}, Response: AnimationReview{}},
+	"GET /me/reviews":                                        {Summary: "Your animations held for your workspace owner's review, oldest first", Query: []string{"status", "limit", "offset"}, Response: AnimationReviewsResponse{}},
+	"POST /integrations/{platform:slack|discord}":            {Summary: "Post a daily animation to a channel of your workspace's", Request: TeamIntegrationRequest{}, Response: TeamIntegration{}},
+	"GET /integrations/{platform:slack|discord}":             {Summary: "Your workspace's integration with its latest posts and moods", Response: TeamIntegrationReport{}},
+	"DELETE /integrations/{platform:slack|discord}":          {Summary: "Stop posting and delete the posts and their moods", Status: http.StatusNoContent},
+
+	// Professional routes
+	"POST /professional/invites":                                    {Summary: "Email a client an invitation", Request: ClientInviteRequest{}, Response: ClientLink{}, Status: http.StatusCreated},
+	"GET /professional/clients":                                     {Summary: "Your invitations and clients", Response: []ClientLink{}},
+	"DELETE /professional/clients/{linkId:[0-9]+}":                  {Summary: "End a link to a client", Status: http.StatusNoContent},
+	"POST /professional/clients/{linkId:[0-9]+}/sessions":           {Summary: "Recommend an animation to a client", Request: AssignSessionRequest{}, Response: SessionAssignment{}, Status: http.StatusCreated},
+	"GET /professional/clients/{linkId:[0-9]+}/sessions":            {Summary: "The animations you recommended to a client", Response: []SessionAssignment{}},
+	"GET /professional/clients/{linkId:[0-9]+}/mood-trends":         {Summary: "A client's mood counts per week, only while they share them", Query: []string{"weeks"}, Response: []MoodTrend{}},
+	"GET /professional/clients/{linkId:[0-9]+}/reports/monthly.pdf": {Summary: "A client's monthly wellbeing report", Query: []string{"month"}, ContentType: "application/pdf"},
+
+	// Admin routes
+	"POST /admin/animations/{id}/determinism-check": {Summary: "Render an animation twice with a fixed seed and record whether it is deterministic", Response: DeterminismReport{}},
+	"GET /admin/animations/{id}/views":              {Summary: "Views, unique viewers and suspect views of an animation, by default over 30 days", Query: []string{"from", "to"}, Response: PlaybackStats{}},
+	"GET /admin/animations/{id}/audit":              {Summary: "The moderation changes made to an animation, oldest first", Response: []ModerationAuditEntry{}},
+	"POST /admin/determinism-checks":                {Summary: "Run the determinism check on the oldest unchecked animations", Query: []string{"limit"}, Response: []DeterminismReport{}},
+	"POST /admin/p5-versions":                       {Summary: "Register a p5.js build", Request: RegisterP5LibraryRequest{}, Response: P5Library{}, Status: http.StatusCreated},
+	"PUT /admin/users/{id}/account-type":            {Summary: "Make a user a professional account, or back to personal", Request: SetAccountTypeRequest{}, Response: SetAccountTypeRequest{}},
+	"PUT /admin/orgs/{id:[0-9]+}/credits":           {Summary: "Set how many generations a workspace may make each month", Request: OrganizationCreditsRequest{}, Response: Organization{}},
+	"GET /admin/costs":                              {Summary: "Generations, tokens and cost in total, with the users who cost the most", Query: []string{"from", "to", "limit"}, Response: CostReport{}},
+	"GET /admin/costs/users/{id}":                   {Summary: "Generations, tokens and cost for one user", Query: []string{"from", "to"}, Response: CostReport{}},
+	"POST /admin/users/{id}/impersonations":         {Summary: "Ask to view the service as a user; 201 with the token, or 202 while it waits for their approval", Request: ImpersonationRequest{}, Response: Impersonation{}, Status: http.StatusCreated},
+	"GET /admin/impersonations":                     {Summary: "Impersonations, newest first", Query: []string{"userId"}, Response: ImpersonationsResponse{}},
+	"DELETE /admin/impersonations/{id:[0-9]+}":      {Summary: "End an impersonation", Status: http.StatusNoContent},
+	"POST /admin/impersonations/{id:[0-9]+}/token":  {Summary: "Start an impersonation the user approved and get its token", Response: Impersonation{}, Status: http.StatusCreated},
+	"GET /admin/impersonations/{id:[0-9]+}/audit":   {Summary: "Everything done in and to an impersonation", Response: []ImpersonationAuditEntry{}},
+	"GET /admin/kiosk-tokens":                       {Summary: "Kiosk tokens issued, newest first", Response: KioskTokensResponse{}},
+	"POST /admin/kiosk-tokens":                      {Summary: "Issue a kiosk token for an unattended display", Request: KioskTokenRequest{}, Response: KioskToken{}, Status: http.StatusCreated},
+	"PUT /admin/kiosk-tokens/{id:[0-9]+}":           {Summary: "Change a kiosk token's name, schedules and feed access", Request: KioskTokenRequest{}, Response: KioskToken{}},
+	"DELETE /admin/kiosk-tokens/{id:[0-9]+}":        {Summary: "Revoke a kiosk token", Status: http.StatusNoContent},
+	"GET /admin/announcements":                      {Summary: "Every announcement, newest first", Response: []Announcement{}},
+	"POST /admin/announcements":                     {Summary: "Publish an announcement", Request: AnnouncementRequest{}, Response: Announcement{}, Status: http.StatusCreated},
+	"PUT /admin/announcements/{id:[0-9]+}":          {Summary: "Replace an announcement's content, audience and schedule", Request: AnnouncementRequest{}, Response: Announcement{}},
+	"DELETE /admin/announcements/{id:[0-9]+}":       {Summary: "Delete an announcement and its dismissals", Status: http.StatusNoContent},
+	"GET /admin/mood-rules":                         {Summary: "Every mood rule, in the order they run", Response: []MoodRule{}},
+	"POST /admin/mood-rules":                        {Summary: "Add a rule run when users save a mood", Request: MoodRuleRequest{}, Response: MoodRule{}, Status: http.StatusCreated},
+	"PUT /admin/mood-rules/{id:[0-9]+}":             {Summary: "Replace a mood rule's conditions and actions", Request: MoodRuleRequest{}, Response: MoodRule{}},
+	"DELETE /admin/mood-rules/{id:[0-9]+}":          {Summary: "Delete a mood rule", Status: http.StatusNoContent},
+	"GET /admin/takedown-requests":                  {Summary: "Takedown requests, optionally by status", Query: []string{"status"}, Response: []TakedownRequest{}},
+	"GET /admin/takedown-requests/{id}":             {Summary: "A takedown request with its audit trail", Response: TakedownRequest{}},
+	"POST /admin/takedown-requests/{id}/transition": {Summary: "Move a takedown request to a new status", Request: TakedownTransitionRequest{}, Response: TakedownRequest{}},
+	"POST /admin/prompt-playground":                 {Summary: "Compare prompt template and model variants side by side", Request: PromptPlaygroundRequest{}, Response: PromptPlaygroundResponse{}},
+	"GET /admin/slo":                                {Summary: "Each service-level objective's error budget burn rates and alerts", Response: SLOReport{}},
+	"GET /admin/deprecations":                       {Summary: "Requests made to deprecated routes and fields, busiest first", Response: DeprecationReport{}},
+	"POST /admin/incidents":                         {Summary: "Report an incident on the status page", Request: CreateIncidentRequest{}, Response: Incident{}, Status: http.StatusCreated},
+	"POST /admin/incidents/{id:[0-9]+}/updates":     {Summary: "Add an update to an open incident", Request: IncidentUpdateRequest{}, Response: Incident{}},
+	"GET /admin/contract-runs":                      {Summary: "Recent generation contract check runs", Query: []string{"limit"}, Response: []ContractReport{}},
+	"POST /admin/resanitize":                        {Summary: "Start a background run of the current sanitizer over all stored animations", Request: StartResanitizeRequest{}, Response: SanitizationRun{}, Status: http.StatusAccepted},
+	"GET /admin/resanitize/{runId}":                 {Summary: "A re-sanitization run with the diff of every proposed fix", Response: SanitizationRun{}},
+	"POST /admin/resanitize/{runId}/approve":        {Summary: "Apply pending fixes, or all of them without a body", Request: ReviewSanitizationFixesRequest{}, Response: ReviewSanitizationFixesResponse{}},
+	"POST /admin/resanitize/{runId}/reject":         {Summary: "Reject pending fixes, selected the same way", Request: ReviewSanitizationFixesRequest{}, Response: ReviewSanitizationFixesResponse{}},
+}
+
+// apiOperationFor returns the description of a route, reporting whether it has its own rather than
+// its unversioned path's
+func apiOperationFor(method, template string) (apiOperation, bool) {
+	if op, ok := apiOperations[method+" "+template]; ok {
+		return op, true
+	}
+	return apiOperations[method+" "+unversionedRoute(template)], false
+}
+
+// routeVariablePattern matches a path template's variables, with the pattern they may carry
+var routeVariablePattern = regexp.MustCompile(`\{([^{}:]+)(?::([^{}]+))?\}`)
+
+// openAPISchemas builds the JSON schemas of Go types, collecting named structs as components
+type openAPISchemas struct {
+	components map[string]interface{}
+}
+
+// schemaFor returns the schema of values of t as encoding/json writes them
+func (g *openAPISchemas) schemaFor(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Claimed before the fields are walked, so types that refer to themselves terminate
+			g.components[t.Name()] = nil
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return ref
+	default:
+		// Interfaces hold any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the object schema of a struct's JSON fields. Fields without omitempty are
+// required, and embedded structs contribute their fields as encoding/json flattens them.
+func (g *openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Ptr {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					addFields(embedded)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = g.schemaFor(field.Type)
+			if !strings.Contains(","+options+",", ",omitempty,") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// bodySchema returns the schema of a request or response body described by value
+func (g *openAPISchemas) bodySchema(value interface{}) map[string]interface{} {
+	if alternatives, ok := value.(apiOneOf); ok {
+		schemas := make([]interface{}, len(alternatives))
+		for i, alternative := range alternatives {
+			schemas[i] = g.schemaFor(reflect.TypeOf(alternative))
+		}
+		return map[string]interface{}{"oneOf": schemas}
+	}
+	return g.schemaFor(reflect.TypeOf(value))
+}
+
+// BuildOpenAPI describes every route registered on router as an OpenAPI document. Routes are read
+// from the router itself, so none can be served without being listed; apiOperations adds the
+// bodies, parameters and summaries the router does not know.
+func BuildOpenAPI(router *mux.Router) map[string]interface{} {
+	schemas := &openAPISchemas{components: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+
+	router.Walk(func(route *mux.Route, _ *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters match prefixes rather than serving requests
+			return nil
+		}
+
+		versioned := unversionedRoute(template) != template
+		if versioned {
+			// The first ancestor mounts the version, and the rest are read as they are without it
+			ancestors = ancestors[1:]
+		}
+		var security, role string
+		for _, ancestor := range ancestors {
+			prefix, _ := ancestor.GetPathTemplate()
+			switch unversionedRoute(prefix) {
+			case "":
+				security = securityBearer
+			case "/kiosk":
+				security = securityKiosk
+			case "/integrations/triggers":
+				security = securityIntegrationKey
+			case "/admin":
+				role = "Admins only."
+			case "/professional":
+				role = "Professional accounts only."
+			}
+		}
+
+		path := routeVariablePattern.ReplaceAllString(template, "{$1}")
+		var parameters []interface{}
+		for _, match := range routeVariablePattern.FindAllStringSubmatch(template, -1) {
+			schema := map[string]interface{}{"type": "string"}
+			if match[2] != "" {
+				schema["pattern"] = "^(?:" + match[2] + ")$"
+			}
+			parameters = append(parameters, map[string]interface{}{"name": match[1], "in": "path", "required": true, "schema": schema})
+		}
+
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			op, own := apiOperationFor(method, template)
+			if versioned && !own {
+				// Versions that answer in the same shapes are documented once, without a prefix
+				continue
+			}
+			operation := map[string]interface{}{
+				"summary": op.Summary,
+				"tags":    []string{openAPITag(path)},
+			}
+			if role != "" {
+				operation["description"] = role
+			}
+
+			operationParameters := append([]interface{}(nil), parameters...)
+			for _, name := range op.Query {
+				operationParameters = append(operationParameters, map[string]interface{}{"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"}})
+			}
+			if len(operationParameters) > 0 {
+				operation["parameters"] = operationParameters
+			}
+
+			switch {
+			case op.Form:
+				operation["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+					"application/x-www-form-urlencoded": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+				}}
+			case op.Request != nil:
+				operation["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.bodySchema(op.Request)},
+				}}
+			}
+
+			status := op.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			success := map[string]interface{}{"description": http.StatusText(status)}
+			switch {
+			case op.ContentType != "":
+				success["content"] = map[string]interface{}{op.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+			case op.Response != nil:
+				success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schemas.bodySchema(op.Response)}}
+			}
+			operation["responses"] = map[string]interface{}{
+				strconv.Itoa(status): success,
+				"default":            map[string]interface{}{"$ref": "#/components/responses/Error"},
+			}
+
+			if op.Security != "" {
+				security = op.Security
+			}
+			switch {
+			case security != "":
+				operation["security"] = []interface{}{map[string]interface{}{security: []string{}}}
+			case op.OptionalAuth:
+				operation["security"] = []interface{}{map[string]interface{}{}, map[string]interface{}{securityBearer: []string{}}}
+			default:
+				operation["security"] = []interface{}{}
+			}
+
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(method)] = operation
+		}
+		return nil
+	})
+
+	schemas.components["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error":  map[string]interface{}{"type": "string"},
+			"code":   map[string]interface{}{"type": "string"},
+			"status": map[string]interface{}{"type": "integer"},
+			"fields": map[string]interface{}{"type": "array", "items": schemas.schemaFor(reflect.TypeOf(FieldError{}))},
+		},
+		"required": []string{"error", "code", "status"},
+	}
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "Animate Server API",
+			"version":     string(UnversionedAPIVersion),
+			"description": openAPIDescription(),
+		},
+		"servers": []interface{}{map[string]interface{}{"url": PublicURL("")}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "An error, with its message and status",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}}},
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				securityBearer:         map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "A token from /login or /register, or an access token issued to a third-party app"},
+				securityKiosk:          map[string]interface{}{"type": "http", "scheme": "bearer", "description": "A kiosk token issued by an admin for an unattended display"},
+				securityIntegrationKey: map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "An integration key from /me/integration-keys"},
+			},
+		},
+	}
+}
+
+// openAPIDescription explains the version prefixes the documented paths are also served under
+func openAPIDescription() string {
+	prefixes := make([]string, len(APIVersions))
+	for i, version := range APIVersions {
+		prefixes[i] = "/" + string(version)
+	}
+	return "Every path is also served under " + strings.Join(prefixes, " and ") + ", answering in that API version's shapes. " +
+		"Paths without a prefix answer in " + string(UnversionedAPIVersion) + "'s; paths listed with a prefix are those whose shapes differ."
+}
+
+// openAPITag groups operations by the first segment of their path, leaving out version prefixes
+func openAPITag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for _, version := range APIVersions {
+		if segments[0] == string(version) && len(segments) > 1 {
+			segments = segments[1:]
+		}
+	}
+	return segments[0]
+}
+
+// openAPIHandler serves the document describing router, built on the first request since every
+// route is registered by then
+func openAPIHandler(router *mux.Router) http.HandlerFunc {
+	var (
+		once     sync.Once
+		document []byte
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			document, _ = json.MarshalIndent(BuildOpenAPI(router), "", "  ")
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	}
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at /openapi.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Animate Server API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin="anonymous"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+// swaggerUIHandler serves Swagger UI for the OpenAPI document
+func swaggerUIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
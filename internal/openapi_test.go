@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+
+	router := NewServer(NewMemoryStore()).Router()
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, _ := route.GetPathTemplate()
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			if op, _ := apiOperationFor(method, template); op.Summary == "" {
+				t.Errorf("%s %s is not described in apiOperations", method, template)
+			}
+		}
+		return nil
+	})
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("openapi.json = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var document struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Security    []map[string][]string `json:"security"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]interface{} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Parameters []struct {
+				Name   string            `json:"name"`
+				In     string            `json:"in"`
+				Schema map[string]string `json:"schema"`
+			} `json:"parameters"`
+		} `json:"paths"`
+		Components struct {
+			Schemas         map[string]map[string]interface{} `json:"schemas"`
+			SecuritySchemes map[string]map[string]string      `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	if document.OpenAPI != openAPIVersion {
+		t.Errorf("openapi = %q, want %q", document.OpenAPI, openAPIVersion)
+	}
+
+	register := document.Paths["/register"]["post"]
+	if ref := register.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/RegisterRequest" {
+		t.Errorf("register request schema = %v", ref)
+	}
+	if len(register.Security) != 0 {
+		t.Errorf("register security = %v, want none", register.Security)
+	}
+	required, _ := document.Components.Schemas["RegisterRequest"]["required"].([]interface{})
+	if len(required) == 0 {
+		t.Errorf("RegisterRequest schema = %v, want required fields", document.Components.Schemas["RegisterRequest"])
+	}
+	if _, ok := document.Components.Schemas["GetAnimationResponse"]; !ok {
+		t.Error("GetAnimationResponse schema is missing")
+	}
+
+	for path, scheme := range map[string]string{"/save-animation": securityBearer, "/admin/slo": securityBearer, "/kiosk/feed": securityKiosk, "/integrations/triggers": securityIntegrationKey} {
+		for _, op := range document.Paths[path] {
+			if len(op.Security) != 1 || op.Security[0][scheme] == nil {
+				t.Errorf("%s security = %v, want %s", path, op.Security, scheme)
+			}
+		}
+		if _, ok := document.Components.SecuritySchemes[scheme]; !ok {
+			t.Errorf("security scheme %s is missing", scheme)
+		}
+	}
+
+	// Variables with patterns are documented by name, with their pattern
+	comment := document.Paths["/animation/{id}/comments/{commentId}"]["delete"]
+	if len(comment.Parameters) != 2 || comment.Parameters[1].Name != "commentId" || comment.Parameters[1].Schema["pattern"] != "^(?:[0-9]+)$" {
+		t.Errorf("comment delete parameters = %+v", comment.Parameters)
+	}
+
+	docs := httptest.NewRecorder()
+	router.ServeHTTP(docs, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if docs.Code != http.StatusOK || !strings.Contains(docs.Body.String(), `url: "/openapi.json"`) {
+		t.Errorf("docs = %d, want Swagger UI pointed at /openapi.json", docs.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Roles of workspace members. The owner manages members, limits and usage reports.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+const (
+	maxOrganizationNameLength = 80
+	// usageMonthLayout is how months are written in usage reports and the month query parameter
+	usageMonthLayout = "2006-01"
+)
+
+// ValidateOrganizationName trims a workspace name and checks its length
+func ValidateOrganizationName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxOrganizationNameLength {
+		return "", fmt.Errorf("name must be 1-%d characters", maxOrganizationNameLength)
+	}
+	return name, nil
+}
+
+// IsOwner reports whether the user owns the workspace
+func (o Organization) IsOwner(userId string) bool {
+	return userId != "" && o.OwnerID == userId
+}
+
+// HasMember reports whether the user belongs to the workspace, as owner or member
+func (o Organization) HasMember(userId string) bool {
+	for _, member := range o.Members {
+		if member.UserID == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrganizationReservation decides whether a generation just counted against a workspace may
+// go ahead, given the credits and the member's limit with the usage this month including it. It
+// returns the member's quota, which is the tighter of the credits left and their own limit, as it
+// stands without the generation when it may not.
+func checkOrganizationReservation(credits, used, memberLimit, memberUsed int) (GenerationQuota, error) {
+	if used > credits {
+		return organizationQuota(credits, used-1, memberLimit, memberUsed-1), errors.New("organization credits exhausted")
+	}
+	if memberLimit > 0 && memberUsed > memberLimit {
+		return organizationQuota(credits, used-1, memberLimit, memberUsed-1), errors.New("organization member limit reached")
+	}
+	return organizationQuota(credits, used, memberLimit, memberUsed), nil
+}
+
+// organizationQuota returns a member's monthly quota in a workspace: the credits left, or their own
+// limit when it runs out first. Workspaces have no daily limit.
+func organizationQuota(credits, used, memberLimit, memberUsed int) GenerationQuota {
+	if memberLimit > 0 && memberLimit-memberUsed < credits-used {
+		return newGenerationQuota(0, 0, memberLimit, memberUsed)
+	}
+	return newGenerationQuota(0, 0, credits, used)
+}
+
+// newOrganizationUsage builds the usage report of a workspace for the month starting at month,
+// from the generations drawn on its credits in total and by each user
+func newOrganizationUsage(org Organization, month time.Time, used int, usedBy map[string]int) OrganizationUsage {
+	usage := OrganizationUsage{
+		OrganizationID: org.ID,
+		Month:          month.Format(usageMonthLayout),
+		MonthlyCredits: org.MonthlyCredits,
+		Used:           used,
+		Remaining:      max(org.MonthlyCredits-used, 0),
+		Members:        []OrganizationMemberUsage{},
+	}
+	for _, member := range org.Members {
+		usage.Members = append(usage.Members, OrganizationMemberUsage{
+			UserID:       member.UserID,
+			Username:     member.Username,
+			MonthlyLimit: member.MonthlyLimit,
+			Used:         usedBy[member.UserID],
+			Remaining:    remainingQuota(member.MonthlyLimit, usedBy[member.UserID]),
+		})
+	}
+	return usage
+}
+
+// parseUsageMonth reads a month written as YYYY-MM, returning the start of the current UTC month
+// when it is empty
+func parseUsageMonth(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		now = now.UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	month, err := time.Parse(usageMonthLayout, value)
+	if err != nil {
+		return time.Time{}, errors.New("month must look like 2006-01")
+	}
+	return month, nil
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckOrganizationReservation(t *testing.T) {
+	tests := []struct {
+		name          string
+		credits       int
+		used          int
+		memberLimit   int
+		memberUsed    int
+		wantErr       string
+		wantRemaining int
+	}{
+		{name: "Within credits", credits: 10, used: 4, memberUsed: 2, wantRemaining: 6},
+		{name: "Member limit is tighter", credits: 10, used: 4, memberLimit: 3, memberUsed: 2, wantRemaining: 1},
+		{name: "Last credit", credits: 10, used: 10, memberLimit: 5, memberUsed: 1, wantRemaining: 0},
+		{name: "Credits exhausted", credits: 10, used: 11, memberLimit: 5, memberUsed: 1, wantErr: "organization credits exhausted", wantRemaining: 0},
+		{name: "Member limit reached", credits: 10, used: 5, memberLimit: 2, memberUsed: 3, wantErr: "organization member limit reached", wantRemaining: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota, err := checkOrganizationReservation(tt.credits, tt.used, tt.memberLimit, tt.memberUsed)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Fatalf("checkOrganizationReservation() error = %v, want %q", err, tt.wantErr)
+			}
+			if quota.MonthlyRemaining != tt.wantRemaining || quota.DailyRemaining != -1 {
+				t.Errorf("quota = %+v, want %d left this month and no daily limit", quota, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestParseUsageMonth(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "Current month", want: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Given month", value: "2026-02", want: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Day given", value: "2026-02-03", wantErr: true},
+		{name: "Not a month", value: "2026-13", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUsageMonth(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUsageMonth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseUsageMonth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrganizationHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	owner := registerAccount(t, router, "studio")
+	artist := registerAccount(t, router, "artist")
+	outsider := registerAccount(t, router, "outsider")
+
+	var org Organization
+	if code := doJSON(t, router, http.MethodPost, "/orgs", owner.Token, OrganizationRequest{Name: " Studio "}, &org); code != http.StatusCreated {
+		t.Fatalf("create status = %d", code)
+	}
+	if org.Name != "Studio" || len(org.Members) != 1 || org.Members[0].Role != OrgRoleOwner {
+		t.Errorf("organization = %+v, want Studio with its owner", org)
+	}
+
+	orgPath := "/orgs/" + strconv.Itoa(org.ID)
+	artistPath := orgPath + "/members/" + artist.User.ID
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Second workspace", method: http.MethodPost, path: "/orgs", token: owner.Token, body: OrganizationRequest{Name: "Other"}, wantCode: http.StatusConflict},
+		{name: "Blank name", method: http.MethodPost, path: "/orgs", token: outsider.Token, body: OrganizationRequest{Name: " "}, wantCode: http.StatusBadRequest},
+		{name: "Add member", method: http.MethodPost, path: orgPath + "/members", token: owner.Token, body: OrganizationMemberRequest{Email: "artist@example.com", MonthlyLimit: 5}, wantCode: http.StatusCreated},
+		{name: "Add member twice", method: http.MethodPost, path: orgPath + "/members", token: owner.Token, body: OrganizationMemberRequest{Email: "artist@example.com"}, wantCode: http.StatusConflict},
+		{name: "Add unknown user", method: http.MethodPost, path: orgPath + "/members", token: owner.Token, body: OrganizationMemberRequest{Email: "nobody@example.com"}, wantCode: http.StatusNotFound},
+		{name: "Member adds member", method: http.MethodPost, path: orgPath + "/members", token: artist.Token, body: OrganizationMemberRequest{Email: "outsider@example.com"}, wantCode: http.StatusForbidden},
+		{name: "Outsider views", method: http.MethodGet, path: orgPath, token: outsider.Token, wantCode: http.StatusNotFound},
+		{name: "Member views", method: http.MethodGet, path: orgPath, token: artist.Token, wantCode: http.StatusOK},
+		{name: "Negative limit", method: http.MethodPut, path: artistPath, token: owner.Token, body: OrganizationMemberRequest{MonthlyLimit: -1}, wantCode: http.StatusBadRequest},
+		{name: "Set limit", method: http.MethodPut, path: artistPath, token: owner.Token, body: OrganizationMemberRequest{MonthlyLimit: 2}, wantCode: http.StatusOK},
+		{name: "Member reads usage", method: http.MethodGet, path: orgPath + "/usage", token: artist.Token, wantCode: http.StatusForbidden},
+		{name: "Bad month", method: http.MethodGet, path: orgPath + "/usage?month=october", token: owner.Token, wantCode: http.StatusBadRequest},
+		{name: "Owner leaves", method: http.MethodDelete, path: orgPath + "/members/" + owner.User.ID, token: owner.Token, wantCode: http.StatusBadRequest},
+		{name: "Owner grants credits", method: http.MethodPut, path: "/admin" + orgPath + "/credits", token: owner.Token, body: OrganizationCreditsRequest{MonthlyCredits: 100}, wantCode: http.StatusForbidden},
+		{name: "Admin grants credits", method: http.MethodPut, path: "/admin" + orgPath + "/credits", token: admin.Token, body: OrganizationCreditsRequest{MonthlyCredits: 100}, wantCode: http.StatusOK},
+		{name: "Admin reads usage", method: http.MethodGet, path: orgPath + "/usage", token: admin.Token, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var mine Organization
+	doJSON(t, router, http.MethodGet, "/me/organization", artist.Token, nil, &mine)
+	if mine.ID != org.ID || mine.MonthlyCredits != 100 || len(mine.Members) != 2 || mine.Members[1].MonthlyLimit != 2 {
+		t.Errorf("artist's workspace = %+v, want the studio with its credits and their limit", mine)
+	}
+
+	// Members may leave, after which the workspace is gone for them
+	if code := doJSON(t, router, http.MethodDelete, artistPath, artist.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("leave status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/me/organization", artist.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("workspace after leaving status = %d, want 404", code)
+	}
+	if code := doJSON(t, router, http.MethodDelete, orgPath, owner.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d", code)
+	}
+}
+
+func TestGenerateWithOrganizationCredits(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+
+	failing := false
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}\nfunction draw() {}"}]}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	owner := registerAccount(t, router, "studio")
+	artist := registerAccount(t, router, "artist")
+
+	var org Organization
+	doJSON(t, router, http.MethodPost, "/orgs", owner.Token, OrganizationRequest{Name: "Studio"}, &org)
+	orgPath := "/orgs/" + strconv.Itoa(org.ID)
+	doJSON(t, router, http.MethodPost, orgPath+"/members", owner.Token, OrganizationMemberRequest{Email: "artist@example.com", MonthlyLimit: 1}, nil)
+	doJSON(t, router, http.MethodPut, "/admin"+orgPath+"/credits", admin.Token, OrganizationCreditsRequest{MonthlyCredits: 2}, nil)
+
+	tests := []struct {
+		name       string
+		token      string
+		failing    bool
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "Failed generation is given back", token: artist.Token, failing: true, wantCode: http.StatusAccepted, wantStatus: GenerationFailed},
+		{name: "Member", token: artist.Token, wantCode: http.StatusAccepted, wantStatus: GenerationDone},
+		{name: "Member over their limit", token: artist.Token, wantCode: http.StatusTooManyRequests},
+		{name: "Owner takes the last credit", token: owner.Token, wantCode: http.StatusAccepted, wantStatus: GenerationDone},
+		{name: "Credits exhausted", token: owner.Token, wantCode: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing = tt.failing
+			code, job := generateAndWait(t, server, router, tt.token, AnimationRequest{Description: "a calm ocean"})
+			if code != tt.wantCode || job.Status != tt.wantStatus {
+				t.Errorf("generate = %d %q, want %d %q", code, job.Status, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+
+	var usage OrganizationUsage
+	if code := doJSON(t, router, http.MethodGet, orgPath+"/usage", owner.Token, nil, &usage); code != http.StatusOK {
+		t.Fatalf("usage status = %d", code)
+	}
+	if usage.Used != 2 || usage.Remaining != 0 || len(usage.Members) != 2 || usage.Members[1].Used != 1 || usage.Members[1].Remaining != 0 {
+		t.Errorf("usage = %+v, want both credits used, one by the artist", usage)
+	}
+	var quota GenerationQuota
+	doJSON(t, router, http.MethodGet, "/quota", owner.Token, nil, &quota)
+	if quota.MonthlyLimit != 2 || quota.MonthlyRemaining != 0 {
+		t.Errorf("owner's quota = %+v, want the workspace credits", quota)
+	}
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// p5Majors are the major p5.js versions sketches are checked against
+var p5Majors = []int{1, 2}
+
+// p5CompatRule flags an API that one major p5.js version does not support
+type p5CompatRule struct {
+	api string
+	// pattern's first capture group is the text that is flagged, and replaced when migrating
+	pattern  *regexp.Regexp
+	brokenIn int
+	message  string
+	// replacement migrates the captured text automatically; empty when a person has to do it
+	replacement string
+}
+
+// p5FreeCall matches a call to a global p5 function, not a method of the same name such as arr.sort()
+func p5FreeCall(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|[^.\w$])(` + name + `)\s*\(`)
+}
+
+// p5CompatRules lists the breaking changes between p5.js 1.x and 2.x that sketches run into
+var p5CompatRules = []p5CompatRule{
+	{api: "preload", pattern: regexp.MustCompile(`\bfunction\s+(preload)\s*\(`), brokenIn: 2,
+		message: "preload() was removed; load assets with await in an async setup()"},
+	{api: "curveVertex", pattern: p5FreeCall("curveVertex"), brokenIn: 2,
+		message: "curveVertex() was renamed splineVertex()", replacement: "splineVertex"},
+	{api: "curve", pattern: p5FreeCall("curve"), brokenIn: 2,
+		message: "curve() was renamed spline()", replacement: "spline"},
+	{api: "curveTightness", pattern: regexp.MustCompile(`(?:^|[^.\w$])(curveTightness\s*\()`), brokenIn: 2,
+		message: "curveTightness() was replaced by splineProperty('tightness', ...)", replacement: "splineProperty('tightness', "},
+	{api: "curveDetail", pattern: p5FreeCall("curveDetail"), brokenIn: 2,
+		message: "curveDetail() was removed"},
+	{api: "bezierDetail", pattern: p5FreeCall("bezierDetail"), brokenIn: 2,
+		message: "bezierDetail() was removed"},
+	{api: "quadraticVertex", pattern: p5FreeCall("quadraticVertex"), brokenIn: 2,
+		message: "quadraticVertex() was removed; use bezierOrder(2) with bezierVertex()"},
+	{api: "mouseButton", pattern: regexp.MustCompile(`\b(mouseButton\s*===?\s*LEFT)\b`), brokenIn: 2,
+		message: "mouseButton is now an object; compare with mouseButton.left", replacement: "mouseButton.left"},
+	{api: "mouseButton", pattern: regexp.MustCompile(`\b(mouseButton\s*===?\s*RIGHT)\b`), brokenIn: 2,
+		message: "mouseButton is now an object; compare with mouseButton.right", replacement: "mouseButton.right"},
+	{api: "mouseButton", pattern: regexp.MustCompile(`\b(mouseButton\s*===?\s*CENTER)\b`), brokenIn: 2,
+		message: "mouseButton is now an object; compare with mouseButton.center", replacement: "mouseButton.center"},
+	{api: "data helpers", pattern: p5FreeCall("append|arrayCopy|concat|reverse|shorten|splice|subset|sort"), brokenIn: 2,
+		message: "p5's array helpers moved to an add-on; use the JavaScript array methods"},
+	{api: "dictionaries", pattern: p5FreeCall("createStringDict|createNumberDict"), brokenIn: 2,
+		message: "p5.TypedDict was removed; use a plain object or Map"},
+
+	{api: "splineVertex", pattern: p5FreeCall("splineVertex"), brokenIn: 1,
+		message: "splineVertex() needs p5.js 2.x; use curveVertex()"},
+	{api: "spline", pattern: p5FreeCall("spline"), brokenIn: 1,
+		message: "spline() needs p5.js 2.x; use curve()"},
+	{api: "splineProperty", pattern: p5FreeCall("splineProperty"), brokenIn: 1,
+		message: "splineProperty() needs p5.js 2.x; use curveTightness()"},
+	{api: "bezierOrder", pattern: p5FreeCall("bezierOrder"), brokenIn: 1,
+		message: "bezierOrder() needs p5.js 2.x; use quadraticVertex()"},
+	{api: "async setup", pattern: regexp.MustCompile(`\b(async)\s+function\s+setup\s*\(`), brokenIn: 1,
+		message: "p5.js 1.x does not wait for an async setup(); load assets in preload()"},
+}
+
+// CheckP5Compatibility returns the compatibility matrix of a sketch: for each major p5.js
+// version, whether the code runs on it and the APIs that stop it
+func CheckP5Compatibility(code string) []P5Compatibility {
+	stripped := stripCommentsAndStrings(code)
+
+	matrix := make([]P5Compatibility, 0, len(p5Majors))
+	for _, major := range p5Majors {
+		// Issues are reported in the order they appear in the code
+		type found struct {
+			offset int
+			issue  P5CompatibilityIssue
+		}
+		var all []found
+		for _, rule := range p5CompatRules {
+			if rule.brokenIn != major {
+				continue
+			}
+			for _, match := range rule.pattern.FindAllStringSubmatchIndex(stripped, -1) {
+				all = append(all, found{offset: match[2], issue: P5CompatibilityIssue{
+					API:     rule.api,
+					Line:    strings.Count(code[:match[2]], "\n") + 1,
+					Message: rule.message,
+					Fixable: rule.replacement != "",
+				}})
+			}
+		}
+		sort.SliceStable(all, func(i, j int) bool { return all[i].offset < all[j].offset })
+
+		result := P5Compatibility{Major: major, Compatible: len(all) == 0, Issues: make([]P5CompatibilityIssue, 0, len(all))}
+		for _, f := range all {
+			result.Issues = append(result.Issues, f.issue)
+		}
+		matrix = append(matrix, result)
+	}
+	return matrix
+}
+
+// MigrateToP5V2 rewrites the 1.x APIs that have a direct 2.x replacement and returns the new
+// code with the issues that are left for a person to fix
+func MigrateToP5V2(code string) (string, []P5CompatibilityIssue) {
+	for _, rule := range p5CompatRules {
+		if rule.brokenIn != 2 || rule.replacement == "" {
+			continue
+		}
+		// Matches are found in the stripped code, whose offsets line up with the original,
+		// so APIs mentioned in strings and comments are left alone
+		matches := rule.pattern.FindAllStringSubmatchIndex(stripCommentsAndStrings(code), -1)
+		for i := len(matches) - 1; i >= 0; i-- {
+			start, end := matches[i][2], matches[i][3]
+			code = code[:start] + rule.replacement + code[end:]
+		}
+	}
+
+	for _, result := range CheckP5Compatibility(code) {
+		if result.Major == 2 {
+			return code, result.Issues
+		}
+	}
+	return code, nil
+}
+
+// p5Major returns the major version of a p5.js version such as 1.9.4, or 0 if it has none
+func p5Major(version string) int {
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// compatibleMajors returns the major versions a matrix marks as compatible
+func compatibleMajors(matrix []P5Compatibility) []int {
+	majors := []int{}
+	for _, result := range matrix {
+		if result.Compatible {
+			majors = append(majors, result.Major)
+		}
+	}
+	return majors
+}
+
+func TestCheckP5Compatibility(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		wantMajor []int
+		wantAPIs  []string
+	}{
+		{
+			name:      "portable sketch",
+			code:      "function setup() { createCanvas(400, 400); }\nfunction draw() { ellipse(200, 200, 50); }",
+			wantMajor: []int{1, 2},
+		},
+		{
+			name:      "curves and mouse buttons",
+			code:      "function draw() {\n  curveVertex(1, 2);\n  if (mouseButton === LEFT) { curve(0, 0, 1, 1, 2, 2, 3, 3); }\n}",
+			wantMajor: []int{1},
+			wantAPIs:  []string{"curveVertex", "mouseButton", "curve"},
+		},
+		{
+			name:      "preload",
+			code:      "let img;\nfunction preload() { img = loadImage('a.png'); }",
+			wantMajor: []int{1},
+			wantAPIs:  []string{"preload"},
+		},
+		{
+			name:      "array method is not the removed helper",
+			code:      "function draw() { let xs = [3, 1]; xs.sort(); xs.reverse(); }",
+			wantMajor: []int{1, 2},
+		},
+		{
+			name:      "removed helper",
+			code:      "function draw() { let xs = sort([3, 1]); }",
+			wantMajor: []int{1},
+			wantAPIs:  []string{"data helpers"},
+		},
+		{
+			name:      "mentions in strings and comments",
+			code:      "// curveVertex() looks nicer\nfunction draw() { text('curve(', 10, 10); }",
+			wantMajor: []int{1, 2},
+		},
+		{
+			name:      "2.x only",
+			code:      "async function setup() { createCanvas(100, 100); }\nfunction draw() { splineVertex(1, 2); }",
+			wantMajor: []int{2},
+			wantAPIs:  []string{"async setup", "splineVertex"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matrix := CheckP5Compatibility(tt.code)
+			if got := compatibleMajors(matrix); !reflect.DeepEqual(got, tt.wantMajor) {
+				t.Errorf("compatible majors = %v, want %v", got, tt.wantMajor)
+			}
+
+			apis := []string{}
+			for _, result := range matrix {
+				for _, issue := range result.Issues {
+					apis = append(apis, issue.API)
+				}
+			}
+			if tt.wantAPIs == nil {
+				tt.wantAPIs = []string{}
+			}
+			if !reflect.DeepEqual(apis, tt.wantAPIs) {
+				t.Errorf("flagged APIs = %v, want %v", apis, tt.wantAPIs)
+			}
+		})
+	}
+}
+
+func TestMigrateToP5V2(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		want          string
+		wantRemaining int
+	}{
+		{
+			name: "renames",
+			code: "function draw() {\n  curveTightness(0.5);\n  curveVertex(1, 2);\n  curve(0, 0, 1, 1, 2, 2, 3, 3);\n}",
+			want: "function draw() {\n  splineProperty('tightness', 0.5);\n  splineVertex(1, 2);\n  spline(0, 0, 1, 1, 2, 2, 3, 3);\n}",
+		},
+		{
+			name: "mouse buttons",
+			code: "function mousePressed() { if (mouseButton == RIGHT || mouseButton === CENTER) { clear(); } }",
+			want: "function mousePressed() { if (mouseButton.right || mouseButton.center) { clear(); } }",
+		},
+		{
+			name: "strings are left alone",
+			code: "function draw() { text('curveVertex(', 0, 0); curveVertex(1, 2); }",
+			want: "function draw() { text('curveVertex(', 0, 0); splineVertex(1, 2); }",
+		},
+		{
+			name:          "manual changes remain",
+			code:          "function preload() {}\nfunction draw() { curveVertex(1, 2); quadraticVertex(1, 2, 3, 4); }",
+			want:          "function preload() {}\nfunction draw() { splineVertex(1, 2); quadraticVertex(1, 2, 3, 4); }",
+			wantRemaining: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, remaining := MigrateToP5V2(tt.code)
+			if got != tt.want {
+				t.Errorf("MigrateToP5V2() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if len(remaining) != tt.wantRemaining {
+				t.Errorf("remaining issues = %+v, want %d", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestP5CompatibilityHandler(t *testing.T) {
+	resetFeatures(t)
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+
+	// Animations saved without a stored matrix are checked on first lookup
+	id, err := store.SaveAnimation(ctx, "function draw() { curveVertex(1, 2); }", "curvy", "", "")
+	if err != nil {
+		t.Fatalf("SaveAnimation: %v", err)
+	}
+
+	var matrix []P5Compatibility
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+id+"/compatibility", "", nil, &matrix); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if got := compatibleMajors(matrix); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("compatible majors = %v, want [1]", got)
+	}
+	if stored, _ := store.GetP5Compatibility(ctx, id); len(stored) != len(p5Majors) {
+		t.Errorf("stored matrix = %+v, want one row per major version", stored)
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/animation/missing/compatibility", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown animation status = %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	p5FetchTimeout = 15 * time.Second
+	// maxP5LibrarySize bounds the download when registering a build; p5.min.js is about 1 MB
+	maxP5LibrarySize = 8 << 20
+)
+
+// p5VersionPattern matches release versions such as 1.9.4 or 2.0.0-beta.2
+var p5VersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?$`)
+
+// ComputeSRI returns the Subresource Integrity value for a script, e.g. "sha384-..."
+func ComputeSRI(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ValidateP5LibraryRequest checks a build registration before anything is downloaded
+func ValidateP5LibraryRequest(req RegisterP5LibraryRequest) error {
+	if !p5VersionPattern.MatchString(req.Version) {
+		return errors.New("version must look like 1.9.4")
+	}
+	parsed, err := url.Parse(req.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return errors.New("url must be an https URL")
+	}
+	return nil
+}
+
+// FetchP5Library downloads a p5.js build and returns it pinned with the SRI hash of what was served
+func FetchP5Library(ctx context.Context, version, libraryURL string) (P5Library, error) {
+	ctx, cancel := context.WithTimeout(ctx, p5FetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, libraryURL, nil)
+	if err != nil {
+		return P5Library{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return P5Library{}, fmt.Errorf("failed to download p5.js: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return P5Library{}, fmt.Errorf("failed to download p5.js: %s returned %d", libraryURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxP5LibrarySize+1))
+	if err != nil {
+		return P5Library{}, fmt.Errorf("failed to download p5.js: %w", err)
+	}
+	if len(data) > maxP5LibrarySize {
+		return P5Library{}, fmt.Errorf("p5.js build at %s is larger than %d bytes", libraryURL, maxP5LibrarySize)
+	}
+
+	return P5Library{Version: version, URL: libraryURL, Integrity: ComputeSRI(data)}, nil
+}
+
+// defaultP5Version is the build new animations are pinned to when the client does not ask for one:
+// P5_DEFAULT_VERSION if set, otherwise the most recently registered build. It is empty when no
+// builds are registered, in which case animations are saved unpinned.
+func defaultP5Version(ctx context.Context, store P5LibraryStore) (string, error) {
+	if version := os.Getenv("P5_DEFAULT_VERSION"); version != "" {
+		return version, nil
+	}
+	libraries, err := store.ListP5Libraries(ctx)
+	if err != nil || len(libraries) == 0 {
+		return "", err
+	}
+	return libraries[0].Version, nil
+}
+
+// withDefaultP5Library returns animation set to play with the default p5.js build when it is not
+// pinned to one. It is left unchanged when no build is registered.
+func withDefaultP5Library(ctx context.Context, store P5LibraryStore, animation GetAnimationResponse) GetAnimationResponse {
+	if animation.P5URL != "" {
+		return animation
+	}
+	if version, err := defaultP5Version(ctx, store); err == nil && version != "" {
+		if library, err := store.GetP5Library(ctx, version); err == nil {
+			animation.P5URL, animation.P5Integrity = library.URL, library.Integrity
+		}
+	}
+	return animation
+}
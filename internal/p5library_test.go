@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestComputeSRI(t *testing.T) {
+	data := []byte("function setup() { createCanvas(400, 400); }")
+	sum := sha512.Sum384(data)
+	want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	if got := ComputeSRI(data); got != want {
+		t.Errorf("ComputeSRI = %q, want %q", got, want)
+	}
+	if ComputeSRI([]byte("tampered")) == want {
+		t.Error("different content produced the same SRI hash")
+	}
+}
+
+func TestValidateP5LibraryRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RegisterP5LibraryRequest
+		wantErr bool
+	}{
+		{"release", RegisterP5LibraryRequest{Version: "1.9.4", URL: "https://cdn.jsdelivr.net/npm/p5@1.9.4/lib/p5.min.js"}, false},
+		{"prerelease", RegisterP5LibraryRequest{Version: "2.0.0-beta.2", URL: "https://cdn.example.com/p5.min.js"}, false},
+		{"missing patch", RegisterP5LibraryRequest{Version: "1.9", URL: "https://cdn.example.com/p5.min.js"}, true},
+		{"path in version", RegisterP5LibraryRequest{Version: "../1.9.4", URL: "https://cdn.example.com/p5.min.js"}, true},
+		{"plain http", RegisterP5LibraryRequest{Version: "1.9.4", URL: "http://cdn.example.com/p5.min.js"}, true},
+		{"no host", RegisterP5LibraryRequest{Version: "1.9.4", URL: "https:///p5.min.js"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateP5LibraryRequest(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateP5LibraryRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaveAnimationPinsP5Version(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("P5_DEFAULT_VERSION", "")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	token := registerUser(t, router, "pinner")
+	code := "function setup() { createCanvas(400, 400); }\nfunction draw() { background(0); }"
+
+	// Before any build is registered animations are saved unpinned
+	var saved SaveAnimationResponse
+	if status := doJSON(t, router, http.MethodPost, "/save-animation", token, SaveAnimationRequest{Code: code, Description: "dark"}, &saved); status != http.StatusOK {
+		t.Fatalf("save status = %d", status)
+	}
+	if animation, _ := store.GetAnimation(ctx, saved.ID); animation.P5Version != "" {
+		t.Errorf("unpinned animation has p5Version %q", animation.P5Version)
+	}
+
+	for _, version := range []string{"1.9.3", "1.9.4"} {
+		library := P5Library{Version: version, URL: "https://cdn.example.com/p5@" + version + ".min.js", Integrity: ComputeSRI([]byte(version))}
+		if err := store.SaveP5Library(ctx, library); err != nil {
+			t.Fatalf("SaveP5Library(%s): %v", version, err)
+		}
+	}
+	if err := store.SaveP5Library(ctx, P5Library{Version: "1.9.4"}); err == nil || err.Error() != "p5.js version already registered" {
+		t.Errorf("duplicate SaveP5Library error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		defaultEnv string
+		requested  string
+		wantStatus int
+		wantPin    string
+	}{
+		{"newest by default", "", "", http.StatusOK, "1.9.4"},
+		{"configured default", "1.9.3", "", http.StatusOK, "1.9.3"},
+		{"unregistered default", "2.0.0", "", http.StatusOK, ""},
+		{"requested", "", "1.9.3", http.StatusOK, "1.9.3"},
+		{"unknown requested", "", "0.1.0", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("P5_DEFAULT_VERSION", tt.defaultEnv)
+
+			var saved SaveAnimationResponse
+			req := SaveAnimationRequest{Code: code, Description: "dark", P5Version: tt.requested}
+			if status := doJSON(t, router, http.MethodPost, "/save-animation", token, req, &saved); status != tt.wantStatus {
+				t.Fatalf("save status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var animation GetAnimationResponse
+			if status := doJSON(t, router, http.MethodGet, "/animation/"+saved.ID, "", nil, &animation); status != http.StatusOK {
+				t.Fatalf("get status = %d", status)
+			}
+			if animation.P5Version != tt.wantPin {
+				t.Errorf("p5Version = %q, want %q", animation.P5Version, tt.wantPin)
+			}
+			if tt.wantPin != "" && animation.P5Integrity != ComputeSRI([]byte(tt.wantPin)) {
+				t.Errorf("p5Integrity = %q, want the registered hash", animation.P5Integrity)
+			}
+		})
+	}
+
+	var libraries []P5Library
+	if status := doJSON(t, router, http.MethodGet, "/p5-versions", "", nil, &libraries); status != http.StatusOK {
+		t.Fatalf("list status = %d", status)
+	}
+	if len(libraries) != 2 || libraries[0].Version != "1.9.4" {
+		t.Errorf("p5-versions = %+v, want 1.9.4 first of 2", libraries)
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in PDF points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+)
+
+// pdfPage collects the drawing operators of a single-page PDF. Coordinates are in points from the
+// bottom left corner. Text is set in Helvetica, which every PDF reader has, so nothing is embedded.
+type pdfPage struct {
+	content strings.Builder
+}
+
+// text draws a line of text with its baseline starting at x, y
+func (p *pdfPage) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+// rect fills a rectangle in an RGB color with components from 0 to 1
+func (p *pdfPage) rect(x, y, width, height, r, g, b float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f rg %.1f %.1f %.1f %.1f re f\n", r, g, b, x, y, width, height)
+}
+
+// line strokes a thin gray line from x1, y1 to x2, y2
+func (p *pdfPage) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.6 G 0.5 w %.1f %.1f m %.1f %.1f l S\n", x1, y1, x2, y2)
+}
+
+// pdfEscape makes s safe inside a PDF string. The standard fonts only cover Latin-1 in this
+// encoding, so other characters are replaced.
+func pdfEscape(s string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		case r < ' ' || r > '~':
+			escaped.WriteByte('?')
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+// bytes returns the page as a complete PDF document
+func (p *pdfPage) bytes() []byte {
+	content := p.content.String()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>",
+			pdfPageWidth, pdfPageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return doc.Bytes()
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Photosensitivity statuses stored on animations
+const (
+	PhotosensitivityUnchecked = "unchecked"
+	PhotosensitivitySafe      = "safe"
+	PhotosensitivityFlashing  = "flashing"
+)
+
+// Thresholds from WCAG 2.3.1 (three flashes or below), applied to whole-canvas averages
+const (
+	// renderFrameRate is the frame rate the renderer's frame numbers are measured in
+	renderFrameRate = 60
+	// maxFlashesPerSecond is the most general or red flashes allowed in any one second
+	maxFlashesPerSecond = 3
+	// flashLuminanceDelta is the relative luminance change that counts as half a flash
+	flashLuminanceDelta = 0.1
+	// flashDarkerLuminance is the luminance the darker side of a flash must be below
+	flashDarkerLuminance = 0.8
+	// redFlashDelta is the change in the share of saturated red pixels that counts as half a red flash
+	redFlashDelta = 0.2
+
+	defaultReducedMotionMaxChangePercent = 5
+)
+
+// FrameStats describes one rendered frame for the photosensitivity screen. Luminance is the mean
+// relative luminance (0-1), Red the share of saturated red pixels and Changed the share of pixels
+// that differ from the previous frame.
+type FrameStats struct {
+	Luminance float64 `json:"luminance"`
+	Red       float64 `json:"red"`
+	Changed   float64 `json:"changed"`
+}
+
+// PhotosensitivityReport is the outcome of screening rendered frames for flashing
+type PhotosensitivityReport struct {
+	Status                 string  `json:"status"`
+	MaxFlashesPerSecond    float64 `json:"maxFlashesPerSecond"`
+	MaxRedFlashesPerSecond float64 `json:"maxRedFlashesPerSecond"`
+	// MotionScore is the average share of pixels that change each frame
+	MotionScore float64 `json:"motionScore"`
+}
+
+// ScreenPhotosensitivity checks rendered frames for more than three general or red flashes in any
+// one second, and measures how much of the canvas moves
+func ScreenPhotosensitivity(frames []FrameStats) PhotosensitivityReport {
+	luminance := make([]float64, len(frames))
+	red := make([]float64, len(frames))
+	report := PhotosensitivityReport{Status: PhotosensitivitySafe}
+	for i, frame := range frames {
+		luminance[i], red[i] = frame.Luminance, frame.Red
+		report.MotionScore += frame.Changed
+	}
+	if len(frames) > 0 {
+		report.MotionScore /= float64(len(frames))
+	}
+
+	report.MaxFlashesPerSecond = maxFlashRate(flashTransitions(luminance, flashLuminanceDelta, flashDarkerLuminance))
+	report.MaxRedFlashesPerSecond = maxFlashRate(flashTransitions(red, redFlashDelta, 1))
+	if report.MaxFlashesPerSecond > maxFlashesPerSecond || report.MaxRedFlashesPerSecond > maxFlashesPerSecond {
+		report.Status = PhotosensitivityFlashing
+	}
+	return report
+}
+
+// screenPhotosensitivityInBackground screens an animation's new code for flashing once a save has
+// been answered. Until its screen is recorded the animation is unchecked, which keeps it out of the
+// feeds of viewers avoiding flashing; without a renderer it stays so until a determinism check.
+func (s *Server) screenPhotosensitivityInBackground(ctx context.Context, id, code string) {
+	renderer, ok := GetSketchRenderer()
+	if !ok {
+		return
+	}
+	// Keep the request's data region, which the animation is stored in
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, defaultRenderTimeout)
+		defer cancel()
+		if err := s.screenPhotosensitivity(ctx, renderer, id, code); err != nil {
+			log.Printf("[PHOTOSENSITIVITY] Failed to screen animation %s: %v", id, err)
+		}
+	}()
+}
+
+// screenPhotosensitivity renders code once and records the screen of its frames on the animation.
+// Nothing is recorded when the code has been changed since, as the new code is screened in turn.
+func (s *Server) screenPhotosensitivity(ctx context.Context, renderer SketchRenderer, id, code string) error {
+	result, err := renderer.Render(ctx, RenderRequest{
+		Code:      code,
+		Seed:      determinismSeed,
+		Frames:    defaultRenderFrames,
+		TimeoutMs: int(defaultRenderTimeout / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	// Sketches that throw, and renderers that do not measure frames, leave it unchecked
+	if result.Error != "" || len(result.FrameStats) == 0 {
+		return nil
+	}
+	animation, err := s.store.GetAnimation(ctx, id)
+	if err != nil {
+		return err
+	}
+	if animation.Code != code {
+		return nil
+	}
+	return s.store.SetAnimationPhotosensitivity(ctx, id, ScreenPhotosensitivity(result.FrameStats))
+}
+
+// flashTransitions returns the frames at which series swings by at least delta in the opposite
+// direction to its previous swing, with the lower side of the swing below darker
+func flashTransitions(series []float64, delta, darker float64) []int {
+	if len(series) == 0 {
+		return nil
+	}
+
+	var transitions []int
+	direction := 0 // 1 after a rise, -1 after a fall, 0 before the first swing
+	low, high := series[0], series[0]
+	for i, v := range series[1:] {
+		switch {
+		case direction != 1 && v-low >= delta && low < darker:
+			transitions = append(transitions, i+1)
+			direction, low, high = 1, v, v
+		case direction != -1 && high-v >= delta && v < darker:
+			transitions = append(transitions, i+1)
+			direction, low, high = -1, v, v
+		}
+		// Follow the current swing to its extreme before looking for the next one
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+		if direction == 1 {
+			low = high
+		} else if direction == -1 {
+			high = low
+		}
+	}
+	return transitions
+}
+
+// maxFlashRate returns the most flashes, each a pair of opposing transitions, in any one-second window
+func maxFlashRate(transitions []int) float64 {
+	most := 0
+	for i, start := range transitions {
+		count := 0
+		for _, frame := range transitions[i:] {
+			if frame-start >= renderFrameRate {
+				break
+			}
+			count++
+		}
+		if count > most {
+			most = count
+		}
+	}
+	return float64(most) / 2
+}
+
+// ReducedMotionMaxChange returns the motion score up to which an animation counts as calm,
+// configured by REDUCED_MOTION_MAX_CHANGE_PERCENT as a percentage of the canvas
+func ReducedMotionMaxChange() float64 {
+	percent := envLimit("REDUCED_MOTION_MAX_CHANGE_PERCENT", defaultReducedMotionMaxChangePercent)
+	return float64(percent) / 100
+}
+
+// prefersReducedMotion reports whether a feed request asks for reduced motion, with the reducedMotion
+// query parameter or the browser's Sec-CH-Prefers-Reduced-Motion client hint
+func prefersReducedMotion(r *http.Request) bool {
+	if raw := r.URL.Query().Get("reducedMotion"); raw != "" {
+		reduced, err := strconv.ParseBool(raw)
+		return err == nil && reduced
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Sec-CH-Prefers-Reduced-Motion")), "reduce")
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// alternating returns frames that swap between two luminances every period frames
+func alternating(count, period int, low, high float64) []FrameStats {
+	frames := make([]FrameStats, count)
+	for i := range frames {
+		frames[i].Luminance = low
+		if (i/period)%2 == 1 {
+			frames[i].Luminance = high
+		}
+	}
+	return frames
+}
+
+func TestScreenPhotosensitivity(t *testing.T) {
+	redFlashing := make([]FrameStats, 120)
+	for i := range redFlashing {
+		redFlashing[i] = FrameStats{Luminance: 0.2, Changed: 0.5}
+		if (i/3)%2 == 1 {
+			redFlashing[i].Red = 0.6
+		}
+	}
+	calm := make([]FrameStats, 60)
+	for i := range calm {
+		calm[i] = FrameStats{Luminance: 0.4, Changed: 0.02}
+	}
+
+	tests := []struct {
+		name       string
+		frames     []FrameStats
+		wantStatus string
+		wantMotion float64
+	}{
+		{name: "No frames", frames: nil, wantStatus: PhotosensitivitySafe},
+		{name: "Steady", frames: calm, wantStatus: PhotosensitivitySafe, wantMotion: 0.02},
+		{name: "Slow pulse", frames: alternating(120, 30, 0.1, 0.6), wantStatus: PhotosensitivitySafe},
+		{name: "Rapid flashing", frames: alternating(120, 3, 0.1, 0.6), wantStatus: PhotosensitivityFlashing},
+		{name: "Small swings", frames: alternating(120, 3, 0.3, 0.35), wantStatus: PhotosensitivitySafe},
+		{name: "Bright swings", frames: alternating(120, 3, 0.85, 0.99), wantStatus: PhotosensitivitySafe},
+		{name: "Red flashing", frames: redFlashing, wantStatus: PhotosensitivityFlashing, wantMotion: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := ScreenPhotosensitivity(tt.frames)
+			if report.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q (report %+v)", report.Status, tt.wantStatus, report)
+			}
+			if diff := report.MotionScore - tt.wantMotion; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("MotionScore = %v, want %v", report.MotionScore, tt.wantMotion)
+			}
+		})
+	}
+}
+
+func TestCheckDeterminismScreensFlashing(t *testing.T) {
+	renderer := &fakeRenderer{results: []RenderResult{{FrameHashes: []string{"a"}, FrameStats: alternating(120, 3, 0.1, 0.6)}}}
+	report, err := CheckDeterminism(context.Background(), renderer, "function draw() {}")
+	if err != nil {
+		t.Fatalf("CheckDeterminism() error = %v", err)
+	}
+	if report.Photosensitivity == nil || report.Photosensitivity.Status != PhotosensitivityFlashing {
+		t.Errorf("Photosensitivity = %+v, want flashing", report.Photosensitivity)
+	}
+
+	// Renderers that report no frame stats leave the animation unscreened
+	renderer = &fakeRenderer{results: []RenderResult{{FrameHashes: []string{"a"}}}}
+	if report, _ = CheckDeterminism(context.Background(), renderer, "function draw() {}"); report.Photosensitivity != nil {
+		t.Errorf("Photosensitivity = %+v, want nil", report.Photosensitivity)
+	}
+}
+
+func TestPrefersReducedMotion(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		hint   string
+		want   bool
+	}{
+		{name: "No preference", target: "/feed"},
+		{name: "Query parameter", target: "/feed?reducedMotion=true", want: true},
+		{name: "Client hint", target: "/feed", hint: "reduce", want: true},
+		{name: "Client hint without preference", target: "/feed", hint: "no-preference"},
+		{name: "Query parameter overrides hint", target: "/feed?reducedMotion=false", hint: "reduce"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.hint != "" {
+				r.Header.Set("Sec-CH-Prefers-Reduced-Motion", tt.hint)
+			}
+			if got := prefersReducedMotion(r); got != tt.want {
+				t.Errorf("prefersReducedMotion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedPhotosensitivityFilter(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	reports := map[string]PhotosensitivityReport{
+		"calm":     {Status: PhotosensitivitySafe, MotionScore: 0.01},
+		"busy":     {Status: PhotosensitivitySafe, MotionScore: 0.4},
+		"flashing": {Status: PhotosensitivityFlashing, MotionScore: 0.01},
+	}
+	ids := map[string]string{}
+	for _, name := range []string{"calm", "busy", "flashing", "unchecked"} {
+		id, err := store.SaveAnimation(ctx, "function draw() {}", name, "", "")
+		if err != nil {
+			t.Fatalf("SaveAnimation: %v", err)
+		}
+		ids[id] = name
+		if report, ok := reports[name]; ok {
+			if err := store.SetAnimationPhotosensitivity(ctx, id, report); err != nil {
+				t.Fatalf("SetAnimationPhotosensitivity: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter FeedFilter
+		want   int
+	}{
+		{name: "Everyone", filter: FeedFilter{}, want: 3},
+		{name: "Reduced motion", filter: FeedFilter{ReducedMotion: true, MaxMotionScore: 0.05}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			animations, total, err := store.ListFeedAnimations(ctx, tt.filter, 10, 0)
+			if err != nil {
+				t.Fatalf("ListFeedAnimations: %v", err)
+			}
+			if total != tt.want {
+				t.Errorf("total = %d, want %d", total, tt.want)
+			}
+			for _, animation := range animations {
+				name := ids[animation.ID]
+				if name == "flashing" || (tt.filter.ReducedMotion && name != "calm") {
+					t.Errorf("feed includes %s animation", name)
+				}
+			}
+		})
+	}
+}
+
+func TestSavedAnimationsAreScreened(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	server := NewServer(store)
+	router := server.Router()
+	token := registerUser(t, router, "artist")
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() { background(frameCount % 255); }", Description: "pulse"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", token, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	avoidingFlashing := func() bool {
+		t.Helper()
+		_, err := store.GetRandomAnimation(context.Background(), FeedFilter{AvoidFlashing: true})
+		return err == nil
+	}
+
+	// Until its screen is recorded, the animation is kept from viewers avoiding flashing
+	if avoidingFlashing() {
+		t.Fatal("unscreened animation is in the feed of viewers avoiding flashing")
+	}
+	calm := &fakeRenderer{results: []RenderResult{{FrameStats: []FrameStats{{Luminance: 0.4}, {Luminance: 0.4}}}}}
+	if err := server.screenPhotosensitivity(context.Background(), calm, saved.ID, sketch.Code); err != nil {
+		t.Fatal(err)
+	}
+	if !avoidingFlashing() {
+		t.Error("screened animation is not in the feed of viewers avoiding flashing")
+	}
+
+	// Changing the code takes it out until the new code is screened, and the old code's screen is
+	// not recorded for it
+	edited := "function setup() {}\nfunction draw() { background(random(255)); }"
+	if code := doJSON(t, router, http.MethodPatch, "/animation/"+saved.ID, token, UpdateAnimationRequest{Code: &edited}, nil); code != http.StatusOK {
+		t.Fatalf("update animation status = %d", code)
+	}
+	if avoidingFlashing() {
+		t.Fatal("edited animation is in the feed of viewers avoiding flashing before being screened")
+	}
+	if err := server.screenPhotosensitivity(context.Background(), calm, saved.ID, sketch.Code); err != nil {
+		t.Fatal(err)
+	}
+	if avoidingFlashing() {
+		t.Error("the old code's screen was recorded for the edited animation")
+	}
+	if err := server.screenPhotosensitivity(context.Background(), calm, saved.ID, edited); err != nil || !avoidingFlashing() {
+		t.Errorf("screening the edited code = %v, want it back in the feed", err)
+	}
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EmailCipher encrypts emails for storage and derives the keyed index they are looked up by, so a
+// database dump holds neither the addresses nor hashes that could be matched against a known list
+type EmailCipher struct {
+	ring     *Keyring
+	indexKey []byte
+}
+
+// EmailEncryption returns the cipher emails are stored with, configured by EMAIL_ENCRYPTION_KEYS and
+// EMAIL_INDEX_KEY (or their _FILE variants), or nil when emails are stored in plain text
+func EmailEncryption() (*EmailCipher, error) {
+	ring, err := keyringFromEnv("EMAIL_ENCRYPTION_KEYS")
+	if err != nil {
+		return nil, err
+	}
+	rawIndexKey, err := secretFromEnv("EMAIL_INDEX_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil && rawIndexKey == "" {
+		return nil, nil
+	}
+	if ring == nil || rawIndexKey == "" {
+		return nil, errors.New("EMAIL_ENCRYPTION_KEYS and EMAIL_INDEX_KEY must be set together")
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(rawIndexKey)
+	if err != nil || len(indexKey) != dataKeySize {
+		return nil, fmt.Errorf("invalid EMAIL_INDEX_KEY: must be %d base64-encoded bytes", dataKeySize)
+	}
+	return &EmailCipher{ring: ring, indexKey: indexKey}, nil
+}
+
+// NormalizeEmail returns the form of an email that lookups match on
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Index returns the hex HMAC-SHA256 of the normalized email. Changing EMAIL_INDEX_KEY invalidates
+// every stored index.
+func (c *EmailCipher) Index(email string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(NormalizeEmail(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storedEmail holds the columns an email is stored in: the plain text email when no keys are
+// configured, otherwise its index, key ID and envelope with no plain text
+type storedEmail struct {
+	plain     sql.NullString
+	hash      sql.NullString
+	keyId     sql.NullString
+	encrypted []byte
+}
+
+// sealEmail returns the columns to store email in
+func sealEmail(email string) (storedEmail, error) {
+	cipher, err := EmailEncryption()
+	if err != nil {
+		return storedEmail{}, err
+	}
+	if cipher == nil {
+		return storedEmail{plain: sql.NullString{String: email, Valid: true}}, nil
+	}
+	id, envelope, err := cipher.ring.Seal([]byte(email))
+	if err != nil {
+		return storedEmail{}, fmt.Errorf("failed to encrypt email: %w", err)
+	}
+	return storedEmail{
+		hash:      sql.NullString{String: cipher.Index(email), Valid: true},
+		keyId:     sql.NullString{String: id, Valid: true},
+		encrypted: envelope,
+	}, nil
+}
+
+// emailIndex returns the index to look email up by, or NULL when emails are stored in plain text.
+// Lookups match either column so rows not yet encrypted by EncryptEmails are still found.
+func emailIndex(email string) (sql.NullString, error) {
+	cipher, err := EmailEncryption()
+	if err != nil || cipher == nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: cipher.Index(email), Valid: true}, nil
+}
+
+// openEmail returns the email stored in a row's columns, decrypting it when it is sealed
+func openEmail(cipher *EmailCipher, plain sql.NullString, encrypted []byte, keyId sql.NullString) (string, error) {
+	if !keyId.Valid {
+		return plain.String, nil
+	}
+	if cipher == nil {
+		return "", errors.New("emails are encrypted but EMAIL_ENCRYPTION_KEYS is not set")
+	}
+	email, err := cipher.ring.Open(keyId.String, encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	return string(email), nil
+}
+
+// storedEmailChange holds the columns an email change is stored in, sealed like storedEmail
+type storedEmailChange struct {
+	oldValue     sql.NullString
+	newValue     sql.NullString
+	keyId        sql.NullString
+	oldEncrypted []byte
+	newEncrypted []byte
+}
+
+// sealEmailChange returns the columns to store a change from oldEmail to newEmail in
+func sealEmailChange(oldEmail, newEmail string) (storedEmailChange, error) {
+	oldStored, err := sealEmail(oldEmail)
+	if err != nil {
+		return storedEmailChange{}, err
+	}
+	newStored, err := sealEmail(newEmail)
+	if err != nil {
+		return storedEmailChange{}, err
+	}
+	return storedEmailChange{
+		oldValue:     oldStored.plain,
+		newValue:     newStored.plain,
+		keyId:        oldStored.keyId,
+		oldEncrypted: oldStored.encrypted,
+		newEncrypted: newStored.encrypted,
+	}, nil
+}
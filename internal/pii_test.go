@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestEmailEncryptionConfig(t *testing.T) {
+	indexKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, dataKeySize))
+	tests := []struct {
+		name        string
+		keys        string
+		indexKey    string
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{name: "Unset"},
+		{name: "Both set", keys: testKey("e1", 1), indexKey: indexKey, wantEnabled: true},
+		{name: "Keys without index key", keys: testKey("e1", 1), wantErr: true},
+		{name: "Index key without keys", indexKey: indexKey, wantErr: true},
+		{name: "Short index key", keys: testKey("e1", 1), indexKey: base64.StdEncoding.EncodeToString(make([]byte, 16)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EMAIL_ENCRYPTION_KEYS", tt.keys)
+			t.Setenv("EMAIL_INDEX_KEY", tt.indexKey)
+			cipher, err := EmailEncryption()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EmailEncryption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (cipher != nil) != tt.wantEnabled {
+				t.Errorf("EmailEncryption() = %v, want enabled %v", cipher, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestEmailIndex(t *testing.T) {
+	t.Setenv("EMAIL_ENCRYPTION_KEYS", testKey("e1", 1))
+	t.Setenv("EMAIL_INDEX_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, dataKeySize)))
+	cipher, err := EmailEncryption()
+	if err != nil {
+		t.Fatalf("EmailEncryption: %v", err)
+	}
+
+	if cipher.Index(" Ada@Example.com ") != cipher.Index("ada@example.com") {
+		t.Error("Index() differs for the same address in another case")
+	}
+	if cipher.Index("ada@example.com") == cipher.Index("bob@example.com") {
+		t.Error("Index() matches for different addresses")
+	}
+	if cipher.Index("ada@example.com") == HashToken("ada@example.com") {
+		t.Error("Index() is an unkeyed hash")
+	}
+
+	other := &EmailCipher{ring: cipher.ring, indexKey: bytes.Repeat([]byte{8}, dataKeySize)}
+	if cipher.Index("ada@example.com") == other.Index("ada@example.com") {
+		t.Error("Index() does not depend on the index key")
+	}
+}
+
+func TestSealEmail(t *testing.T) {
+	// Without keys emails are stored as they are
+	stored, err := sealEmail("ada@example.com")
+	if err != nil {
+		t.Fatalf("sealEmail() error = %v", err)
+	}
+	if stored.plain.String != "ada@example.com" || stored.hash.Valid || stored.keyId.Valid {
+		t.Errorf("sealEmail() without keys = %+v, want plain text only", stored)
+	}
+	if got, err := openEmail(nil, stored.plain, stored.encrypted, stored.keyId); err != nil || got != "ada@example.com" {
+		t.Errorf("openEmail() = %q, %v", got, err)
+	}
+
+	t.Setenv("EMAIL_ENCRYPTION_KEYS", testKey("e1", 1))
+	t.Setenv("EMAIL_INDEX_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, dataKeySize)))
+	cipher, _ := EmailEncryption()
+
+	stored, err = sealEmail("Ada@example.com")
+	if err != nil {
+		t.Fatalf("sealEmail() error = %v", err)
+	}
+	if stored.plain.Valid || stored.keyId.String != "e1" || bytes.Contains(stored.encrypted, []byte("Ada@example.com")) {
+		t.Errorf("sealEmail() with keys = %+v, want no plain text", stored)
+	}
+	if index, _ := emailIndex("ada@example.com"); index != stored.hash {
+		t.Errorf("emailIndex() = %v, want the stored index %v", index, stored.hash)
+	}
+	if got, err := openEmail(cipher, stored.plain, stored.encrypted, stored.keyId); err != nil || got != "Ada@example.com" {
+		t.Errorf("openEmail() = %q, %v", got, err)
+	}
+	if _, err := openEmail(nil, stored.plain, stored.encrypted, stored.keyId); err == nil {
+		t.Error("openEmail() without keys succeeded on a sealed email")
+	}
+
+	change, err := sealEmailChange("old@example.com", "new@example.com")
+	if err != nil {
+		t.Fatalf("sealEmailChange() error = %v", err)
+	}
+	if change.oldValue.Valid || change.newValue.Valid {
+		t.Errorf("sealEmailChange() kept plain text: %+v", change)
+	}
+	if got, _ := openEmail(cipher, change.oldValue, change.oldEncrypted, change.keyId); got != "old@example.com" {
+		t.Errorf("old value = %q, want old@example.com", got)
+	}
+	if got, _ := openEmail(cipher, change.newValue, change.newEncrypted, change.keyId); got != "new@example.com" {
+		t.Errorf("new value = %q, want new@example.com", got)
+	}
+}
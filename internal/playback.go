@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// playbackSessionTTL is how long a playback session can be named by views and moods
+	playbackSessionTTL = 2 * time.Hour
+	// minPlaybackViewDelay is how long after its session is issued a view can honestly be reported;
+	// the first frames alone take about this long to load and draw
+	minPlaybackViewDelay = 2 * time.Second
+	// maxWatchedSeconds caps the watched time a view may report, the session's lifetime
+	maxWatchedSeconds = 2 * 60 * 60
+	// maxReportedFPS caps the frame rate a view may report
+	maxReportedFPS = 240
+	// playbackRetention is how long viewed playback sessions are kept for the view counts
+	playbackRetention = 90 * 24 * time.Hour
+	// playbackPruneEvery is how often playback sessions past playbackRetention are deleted
+	playbackPruneEvery = time.Hour
+	// defaultPlaybackStatsWindow is the window GET /admin/animations/{id}/views counts by default
+	defaultPlaybackStatsWindow = 30 * 24 * time.Hour
+)
+
+// Sessions issued, and views counted, repeated within a session, and reported too soon after the
+// session was issued
+var playbackSessionsIssued, playbackViews, playbackDuplicateViews, playbackSuspectViews atomic.Int64
+
+// playbackClaims are what a playback session carries. Sessions are signed rather than stored, so
+// fetching an animation writes nothing; a session is stored once its first view is reported.
+type playbackClaims struct {
+	AnimationID string `json:"a"`
+	ViewerKey   string `json:"v"`
+	// IssuedAt is in Unix milliseconds
+	IssuedAt int64  `json:"t"`
+	Nonce    string `json:"n"`
+}
+
+// PlaybackSessionsRequired reports whether moods must name the playback session they follow, unless
+// PLAYBACK_SESSIONS_REQUIRED is false. Views always need one.
+func PlaybackSessionsRequired() bool {
+	if required, ok := envBool("PLAYBACK_SESSIONS_REQUIRED"); ok {
+		return required
+	}
+	return true
+}
+
+// playbackViewerKey identifies who plays an animation: the signed-in user, or a hash of the
+// client's IP so anonymous viewers can be told apart without keeping their address
+func playbackViewerKey(r *http.Request) string {
+	if userId, ok := GetUserIDFromContext(r.Context()); ok {
+		return userId
+	}
+	return "ip:" + HashToken(ClientIP(r))[:32]
+}
+
+// issuePlaybackSession starts a playback session for an animation fetched by r, returning its ID
+func (s *Server) issuePlaybackSession(r *http.Request, animationId string) (string, error) {
+	nonce, err := generateRandomID()
+	if err != nil {
+		return "", err
+	}
+	token, err := newPlaybackToken(playbackClaims{AnimationID: animationId, ViewerKey: playbackViewerKey(r), IssuedAt: time.Now().UnixMilli(), Nonce: nonce})
+	if err != nil {
+		return "", err
+	}
+	playbackSessionsIssued.Add(1)
+	return token, nil
+}
+
+// attachPlaybackSessions gives each animation fetched by r a playback session. Sessions are only
+// issued with an animation's code, so they cannot be minted without fetching it. Views and moods of
+// an animation whose session could not be issued will be refused, but it can still be shown.
+func (s *Server) attachPlaybackSessions(r *http.Request, endpoint string, animations []GetAnimationResponse) {
+	for i := range animations {
+		session, err := s.issuePlaybackSession(r, animations[i].ID)
+		if err != nil {
+			LogResponse(endpoint, "Error issuing playback session for animation ID: "+animations[i].ID, err)
+			continue
+		}
+		animations[i].PlaybackSession = session
+	}
+}
+
+// newPlaybackToken signs claims into a session ID, "<claims>.<mac>"
+func newPlaybackToken(claims playbackClaims) (string, error) {
+	secret, err := JWTSecret()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signPlaybackSession(secret, payload), nil
+}
+
+// playbackSessionFor returns the unexpired session named by token, which must have been issued for
+// animationId. Sessions for other animations, and tokens the server did not sign, are reported as
+// not found.
+func playbackSessionFor(token, animationId string) (PlaybackSession, error) {
+	secret, err := JWTSecret()
+	if err != nil {
+		return PlaybackSession{}, err
+	}
+	payload, mac, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(signPlaybackSession(secret, payload))) {
+		return PlaybackSession{}, errors.New("playback session not found")
+	}
+	var claims playbackClaims
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &claims) != nil || claims.AnimationID != animationId {
+		return PlaybackSession{}, errors.New("playback session not found")
+	}
+	issued := time.UnixMilli(claims.IssuedAt).UTC()
+	session := PlaybackSession{
+		IDHash:      HashToken(token),
+		AnimationID: claims.AnimationID,
+		ViewerKey:   claims.ViewerKey,
+		CreatedAt:   issued,
+		ExpiresAt:   issued.Add(playbackSessionTTL),
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		return PlaybackSession{}, errors.New("playback session expired")
+	}
+	return session, nil
+}
+
+// signPlaybackSession returns the MAC of a session's claims, kept apart from other uses of the
+// secret by its prefix
+func signPlaybackSession(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("playback|" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkPlaybackSession returns the session named by token for animationId, answering the request
+// itself and returning false when it is unknown or expired
+func (s *Server) checkPlaybackSession(w http.ResponseWriter, r *http.Request, endpoint, token, animationId string) (PlaybackSession, bool) {
+	session, err := playbackSessionFor(token, animationId)
+	if err != nil {
+		switch err.Error() {
+		case "playback session not found":
+			LogResponse(endpoint, "Unknown playback session for animation "+animationId, nil)
+			EncodeErrorCode(w, ErrCodePlaybackSessionInvalid, "Playback session not found", http.StatusBadRequest)
+		case "playback session expired":
+			LogResponse(endpoint, "Expired playback session for animation "+animationId, nil)
+			EncodeErrorCode(w, ErrCodePlaybackSessionExpired, "Playback session expired", http.StatusBadRequest)
+		default:
+			LogResponse(endpoint, "Error retrieving playback session", err)
+			EncodeError(w, "Error retrieving playback session", http.StatusInternalServerError)
+		}
+		return PlaybackSession{}, false
+	}
+	return session, true
+}
+
+// checkMoodPlaybackSession checks the playback session a mood names, answering the request itself
+// and returning false when it is missing but required, unknown or expired
+func (s *Server) checkMoodPlaybackSession(w http.ResponseWriter, r *http.Request, req SaveMoodRequest) bool {
+	if req.PlaybackSession == "" {
+		// v1 clients are never given a session, so they cannot be asked for one
+		if !PlaybackSessionsRequired() || GetAPIVersionFromContext(r.Context()) == APIVersionV1 {
+			return true
+		}
+		LogResponse("/save-mood", "Playback session missing for animation "+req.AnimationID, nil)
+		EncodeErrorCode(w, ErrCodePlaybackSessionMissing, "Playback session required", http.StatusBadRequest)
+		return false
+	}
+	_, ok := s.checkPlaybackSession(w, r, "/save-mood", req.PlaybackSession, req.AnimationID)
+	return ok
+}
+
+// RunPlaybackSessionPruner deletes playback sessions older than playbackRetention in every region
+// every playbackPruneEvery, until ctx is done
+func RunPlaybackSessionPruner(ctx context.Context, store Store) {
+	ticker := time.NewTicker(playbackPruneEvery)
+	defer ticker.Stop()
+	for {
+		deleted, err := deleteInEveryDataRegion(ctx, func(ctx context.Context) (int, error) {
+			return store.DeletePlaybackSessions(ctx, time.Now().Add(-playbackRetention))
+		})
+		if err != nil {
+			log.Printf("[PLAYBACK] Failed to delete old playback sessions: %v", err)
+		} else if deleted > 0 {
+			log.Printf("[PLAYBACK] Deleted %d old playback sessions", deleted)
+		}
+		recordWorkerPass("playback sessions", playbackPruneEvery, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writePlaybackMetrics reports the playback sessions issued and the views reported by players, by
+// how they were counted
+func writePlaybackMetrics(w io.Writer) {
+	writeMetric(w, "animate_playback_sessions_issued_total", "counter", "Total playback sessions issued.", float64(playbackSessionsIssued.Load()))
+	writeMetric(w, "animate_playback_views_total", "counter", "Total views counted, one per playback session.", float64(playbackViews.Load()))
+	writeMetric(w, "animate_playback_duplicate_views_total", "counter", "Total view reports repeating a session that already counted a view.", float64(playbackDuplicateViews.Load()))
+	writeMetric(w, "animate_playback_suspect_views_total", "counter", "Total views reported too soon after their session was issued to be counted.", float64(playbackSuspectViews.Load()))
+}
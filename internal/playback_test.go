@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlaybackSessions(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	viewer := registerAccount(t, router, "viewer")
+	waves, err := store.SaveAnimation(ctx, "function draw() {}", "waves", "", "")
+	if err != nil {
+		t.Fatalf("SaveAnimation: %v", err)
+	}
+	rain, err := store.SaveAnimation(ctx, "function draw() {}", "rain", "", "")
+	if err != nil {
+		t.Fatalf("SaveAnimation: %v", err)
+	}
+
+	var animation GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+waves, viewer.Token, nil, &animation); code != http.StatusOK || animation.PlaybackSession == "" {
+		t.Fatalf("get animation = %d %+v, want a playback session", code, animation)
+	}
+	// The feed gives each animation it serves a session, and sessions are not issued on their own
+	var page GetAnimationFeedResponse
+	if code := doJSON(t, router, http.MethodGet, "/feed?limit=10", "", nil, &page); code != http.StatusOK || len(page.Animations) != 2 {
+		t.Fatalf("feed page = %d %+v", code, page)
+	}
+	fromFeed := map[string]string{}
+	for _, animation := range page.Animations {
+		if animation.PlaybackSession == "" {
+			t.Errorf("feed animation %s has no playback session", animation.ID)
+		}
+		fromFeed[animation.ID] = animation.PlaybackSession
+	}
+	var random GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/feed", "", nil, &random); code != http.StatusOK || random.PlaybackSession == "" {
+		t.Errorf("random feed animation = %d %+v, want a playback session", code, random)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/animation/"+waves+"/sessions", "", nil, nil); code != http.StatusNotFound && code != http.StatusMethodNotAllowed {
+		t.Errorf("standalone session status = %d, want the route gone", code)
+	}
+
+	// Sessions issued long enough ago for an honest view, one past its expiry, and one whose
+	// animation was changed after it was signed
+	sign := func(animationId string, issued time.Time) string {
+		t.Helper()
+		token, err := newPlaybackToken(playbackClaims{AnimationID: animationId, ViewerKey: viewer.User.ID, IssuedAt: issued.UnixMilli(), Nonce: animationId})
+		if err != nil {
+			t.Fatalf("newPlaybackToken: %v", err)
+		}
+		return token
+	}
+	watched := sign(waves, time.Now().Add(-time.Minute))
+	stale := sign(waves, time.Now().Add(-playbackSessionTTL-time.Minute))
+	_, mac, _ := strings.Cut(sign(rain, time.Now().Add(-time.Minute)), ".")
+	forged := strings.Split(watched, ".")[0] + "." + mac
+
+	view := func(animationId string, req RecordViewRequest, wantCode int) {
+		t.Helper()
+		if code := doJSON(t, router, http.MethodPost, "/animation/"+animationId+"/views", "", req, nil); code != wantCode {
+			t.Errorf("view %+v of %s status = %d, want %d", req, animationId, code, wantCode)
+		}
+	}
+	view(waves, RecordViewRequest{}, http.StatusBadRequest)
+	view(waves, RecordViewRequest{PlaybackSession: "guess"}, http.StatusBadRequest)
+	view(waves, RecordViewRequest{PlaybackSession: forged}, http.StatusBadRequest)
+	view(rain, RecordViewRequest{PlaybackSession: watched}, http.StatusBadRequest)
+	view(waves, RecordViewRequest{PlaybackSession: stale}, http.StatusBadRequest)
+	view(waves, RecordViewRequest{PlaybackSession: watched, AverageFPS: maxReportedFPS + 1}, http.StatusBadRequest)
+	view(waves, RecordViewRequest{PlaybackSession: watched, WatchedSeconds: 5, AverageFPS: 60}, http.StatusNoContent)
+	// A reload reporting the same session again only raises the watched time
+	view(waves, RecordViewRequest{PlaybackSession: watched, WatchedSeconds: 20, AverageFPS: 58}, http.StatusNoContent)
+	// A view reported as soon as the session is issued is answered the same but not counted
+	view(waves, RecordViewRequest{PlaybackSession: animation.PlaybackSession}, http.StatusNoContent)
+
+	var stats PlaybackStats
+	if code := doJSON(t, router, http.MethodGet, "/admin/animations/"+waves+"/views", admin.Token, nil, &stats); code != http.StatusOK {
+		t.Fatalf("stats status = %d", code)
+	}
+	// Sessions that were issued but never viewed are not stored
+	if stats.Views != 1 || stats.UniqueViewers != 1 || stats.SuspectViews != 1 || stats.AverageWatchedSeconds != 20 {
+		t.Errorf("stats = %+v, want 1 view of 20s and 1 suspect view", stats)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/admin/animations/"+waves+"/views", viewer.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("stats for a non-admin status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Moods must name a session for the animation by default, except from v1 clients, which never
+	// get one
+	mood := func(path string, req SaveMoodRequest, wantCode int) {
+		t.Helper()
+		if code := doJSON(t, router, http.MethodPost, path, viewer.Token, req, nil); code != wantCode {
+			t.Errorf("%s %+v status = %d, want %d", path, req, code, wantCode)
+		}
+	}
+	mood("/save-mood", SaveMoodRequest{AnimationID: waves, Mood: MoodBetter}, http.StatusBadRequest)
+	mood("/save-mood", SaveMoodRequest{AnimationID: rain, Mood: MoodBetter, PlaybackSession: watched}, http.StatusBadRequest)
+	mood("/save-mood", SaveMoodRequest{AnimationID: waves, Mood: MoodBetter, PlaybackSession: watched}, http.StatusOK)
+	// A session used by a mood alone is not stored either
+	mood("/save-mood", SaveMoodRequest{AnimationID: waves, Mood: MoodSame, PlaybackSession: fromFeed[waves]}, http.StatusOK)
+	mood("/v1/save-mood", SaveMoodRequest{AnimationID: rain, Mood: MoodBetter}, http.StatusOK)
+	t.Setenv("PLAYBACK_SESSIONS_REQUIRED", "false")
+	mood("/save-mood", SaveMoodRequest{AnimationID: rain, Mood: MoodBetter}, http.StatusOK)
+
+	if deleted, err := store.DeletePlaybackSessions(ctx, time.Now().Add(-playbackSessionTTL)); err != nil || deleted != 0 {
+		t.Errorf("DeletePlaybackSessions = %d, %v, want the sessions viewed today kept", deleted, err)
+	}
+	if deleted, err := store.DeletePlaybackSessions(ctx, time.Now().Add(time.Minute)); err != nil || deleted != 2 {
+		t.Errorf("DeletePlaybackSessions = %d, %v, want the 2 viewed sessions deleted", deleted, err)
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPlaygroundVariants caps how many Claude calls one playground request can make
+const maxPlaygroundVariants = 4
+
+// ValidatePlaygroundRequest fills in defaults for each variant and checks the request can be run
+func ValidatePlaygroundRequest(req *PromptPlaygroundRequest) error {
+	if strings.TrimSpace(req.Description) == "" {
+		return errors.New("description cannot be empty")
+	}
+	if len(req.Variants) == 0 {
+		req.Variants = []PromptVariant{{Name: "default"}}
+	}
+	if len(req.Variants) > maxPlaygroundVariants {
+		return errors.New("at most 4 variants can be compared at once")
+	}
+
+	for i := range req.Variants {
+		variant := &req.Variants[i]
+		if variant.PromptTemplate == "" {
+			variant.PromptTemplate = PromptTemplate(PromptGenerate)
+		} else if !strings.Contains(variant.PromptTemplate, DescriptionPlaceholder) {
+			return errors.New("prompt templates must contain " + DescriptionPlaceholder)
+		}
+		if variant.Model == "" {
+			variant.Model = DefaultClaudeModel
+		} else if !strings.HasPrefix(variant.Model, "claude-") {
+			return errors.New("unsupported model " + variant.Model)
+		}
+	}
+	return nil
+}
+
+// RunPromptPlayground generates the description with every variant concurrently and validates each result.
+// Nothing is saved and no quota is used.
+func RunPromptPlayground(ctx context.Context, req PromptPlaygroundRequest, apiKey string) []PromptVariantResult {
+	results := make([]PromptVariantResult, len(req.Variants))
+
+	var wg sync.WaitGroup
+	for i, variant := range req.Variants {
+		wg.Add(1)
+		go func(i int, variant PromptVariant) {
+			defer wg.Done()
+
+			started := time.Now()
+			result := PromptVariantResult{Name: variant.Name, Model: variant.Model, Violations: []string{}}
+			raw, err := sendClaudePromptWithModel(ctx, BuildAnimationPrompt(variant.PromptTemplate, req.Description, ""), variant.Model, apiKey)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Code = PreprocessP5Code(SanitizeAnimationCode(raw))
+				result.Metadata = AnalyzeP5Code(result.Code)
+				result.Violations = CheckGeneratedCode(ctx, raw)
+				result.Valid = len(result.Violations) == 0
+			}
+			result.DurationMs = time.Since(started).Milliseconds()
+			results[i] = result
+		}(i, variant)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,44 @@
+package internal
+
+import "testing"
+
+func TestValidatePlaygroundRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     PromptPlaygroundRequest
+		wantErr string
+	}{
+		{name: "defaults", req: PromptPlaygroundRequest{Description: "calm sea"}},
+		{name: "custom variant", req: PromptPlaygroundRequest{Description: "calm sea", Variants: []PromptVariant{{Name: "terse", PromptTemplate: "p5.js sketch of {{description}}", Model: "claude-3-5-haiku-latest"}}}},
+		{name: "empty description", req: PromptPlaygroundRequest{Description: "  "}, wantErr: "description cannot be empty"},
+		{name: "missing placeholder", req: PromptPlaygroundRequest{Description: "calm sea", Variants: []PromptVariant{{PromptTemplate: "draw something"}}}, wantErr: "prompt templates must contain {{description}}"},
+		{name: "unknown model", req: PromptPlaygroundRequest{Description: "calm sea", Variants: []PromptVariant{{Model: "gpt-4"}}}, wantErr: "unsupported model gpt-4"},
+		{name: "too many variants", req: PromptPlaygroundRequest{Description: "calm sea", Variants: make([]PromptVariant, 5)}, wantErr: "at most 4 variants can be compared at once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePlaygroundRequest(&tt.req)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, variant := range tt.req.Variants {
+				if variant.PromptTemplate == "" || variant.Model == "" {
+					t.Errorf("variant %+v was not given defaults", variant)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildAnimationPrompt(t *testing.T) {
+	if got := BuildAnimationPrompt("Sketch: {{description}}.", "rain", ""); got != "Sketch: rain." {
+		t.Errorf("BuildAnimationPrompt() = %q", got)
+	}
+}
@@ -0,0 +1,6069 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresStore implements Store on the PostgreSQL database opened by InitDB
+type PostgresStore struct {
+	db *tracedDB
+}
+
+// NewPostgresStore returns a store using the database opened by InitDB
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// conn returns the database of ctx's data region
+func (s *PostgresStore) conn(ctx context.Context) *tracedDB {
+	if regional, ok := regionDBs[DataRegionFromContext(ctx)]; ok {
+		return regional
+	}
+	return s.db
+}
+
+// UserExists checks if a user with the given email already exists
+func (s *PostgresStore) UserExists(ctx context.Context, email string) bool {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	index, err := emailIndex(email)
+	if err != nil {
+		log.Printf("[DB ERROR] Failed to index email: %v", err)
+		return false
+	}
+
+	var count int
+	err = s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email_hash = $1 OR email = $2", index, email).Scan(&count)
+	if err != nil {
+		log.Printf("[DB ERROR] Failed to check if user exists: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// EmailInUseByOtherUser checks if the email belongs to a user other than the given one
+func (s *PostgresStore) EmailInUseByOtherUser(ctx context.Context, email, userId string) bool {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	index, err := emailIndex(email)
+	if err != nil {
+		log.Printf("[DB ERROR] Failed to index email: %v", err)
+		return false
+	}
+
+	var count int
+	err = s.conn(ctx).QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM users WHERE (email_hash = $1 OR email = $2) AND id <> $3",
+		index, email, userId,
+	).Scan(&count)
+	if err != nil {
+		log.Printf("[DB ERROR] Failed to check if email is in use: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// CreateUserWithUsername creates a new user with username in the database
+func (s *PostgresStore) CreateUserWithUsername(ctx context.Context, email, username, passwordHash string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// Generate a random user ID
+	userId, err := generateRandomID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate user ID: %v", err)
+	}
+
+	stored, err := sealEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	// Insert the user into the database
+	_, err = s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO users (id, email, email_hash, email_encrypted, email_key_id, username, password_hash, tenant)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		userId, stored.plain, stored.hash, stored.encrypted, stored.keyId, username, passwordHash, TenantFromContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert user: %v", err)
+	}
+
+	log.Printf("[DB] User created successfully with ID: %s", userId)
+	return userId, nil
+}
+
+// GetUserCredentials retrieves user credentials for authentication
+func (s *PostgresStore) GetUserCredentials(ctx context.Context, email string) (string, string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	index, err := emailIndex(email)
+	if err != nil {
+		return "", "", err
+	}
+
+	var userId, passwordHash string
+	err = s.conn(ctx).QueryRowContext(ctx,
+		"SELECT id, password_hash FROM users WHERE email_hash = $1 OR email = $2",
+		index, email,
+	).Scan(&userId, &passwordHash)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", errors.New("user not found")
+		}
+		return "", "", fmt.Errorf("database error: %v", err)
+	}
+
+	return userId, passwordHash, nil
+}
+
+// SaveAnimation saves an animation to the database, storing its code once per distinct content.
+// userId records the uploader and may be empty.
+func (s *PostgresStore) GetContentPreferences(ctx context.Context, userId string) (ContentPreferences, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var preferences ContentPreferences
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT reduce_motion, avoid_flashing, mute_sound FROM user_content_preferences WHERE user_id = $1",
+		userId,
+	).Scan(&preferences.ReduceMotion, &preferences.AvoidFlashing, &preferences.MuteSound)
+	if err != nil && err != sql.ErrNoRows {
+		return ContentPreferences{}, fmt.Errorf("database error: %v", err)
+	}
+	return preferences, nil
+}
+
+func (s *PostgresStore) SaveContentPreferences(ctx context.Context, userId string, preferences ContentPreferences) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO user_content_preferences (user_id, reduce_motion, avoid_flashing, mute_sound, updated_at)
+		 VALUES ($1, $2, $3, $4, NOW())
+		 ON CONFLICT (user_id) DO UPDATE SET reduce_motion = EXCLUDED.reduce_motion,
+			avoid_flashing = EXCLUDED.avoid_flashing, mute_sound = EXCLUDED.mute_sound, updated_at = NOW()`,
+		userId, preferences.ReduceMotion, preferences.AvoidFlashing, preferences.MuteSound,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save content preferences: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) SaveAnimation(ctx context.Context, code string, description string, userId string, p5Version string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// Generate a random animation ID
+	animationId, err := generateRandomID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate animation ID: %v", err)
+	}
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Store the code blob, sharing it with any animation that has the same code
+	codeHash, err := saveCodeBlob(ctx, tx, code)
+	if err != nil {
+		return "", err
+	}
+
+	// Insert the animation into the database
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO animations (id, code_hash, description, user_id, p5_version) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))",
+		animationId, codeHash, description, userId, p5Version,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert animation: %v", err)
+	}
+	if _, err = recordAnimationVersion(ctx, tx, animationId, VersionCreated, userId, 0); err != nil {
+		return "", err
+	}
+	if err = recordSearchEvent(ctx, tx, animationId, SearchEventCreate); err != nil {
+		return "", err
+	}
+	// Members of workspaces that require review wait for the owner's approval
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO animation_reviews (animation_id, organization_id, author_id)
+		 SELECT $1, m.organization_id, m.user_id FROM organization_members m
+		 JOIN organizations o ON o.id = m.organization_id
+		 WHERE m.user_id = $2 AND m.role <> $3 AND o.review_required`,
+		animationId, userId, OrgRoleOwner,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to submit animation for review: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Animation saved successfully with ID: %s", animationId)
+	return animationId, nil
+}
+
+// GetAnimation retrieves an animation from the database. Animations removed by a takedown return "animation removed".
+func (s *PostgresStore) GetAnimation(ctx context.Context, id string) (GetAnimationResponse, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	animation := GetAnimationResponse{ID: id}
+	var removed bool
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT COALESCE(b.code, a.code), a.description, a.removed_at IS NOT NULL,
+			COALESCE(a.p5_version, ''), COALESCE(l.url, ''), COALESCE(l.integrity, '')
+		 FROM animations a
+		 LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 LEFT JOIN p5_libraries l ON l.version = a.p5_version
+		 WHERE a.id = $1`,
+		id,
+	).Scan(&animation.Code, &animation.Description, &removed, &animation.P5Version, &animation.P5URL, &animation.P5Integrity)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return GetAnimationResponse{}, errors.New("animation not found")
+		}
+		return GetAnimationResponse{}, fmt.Errorf("database error: %v", err)
+	}
+	if removed {
+		return GetAnimationResponse{}, errors.New("animation removed")
+	}
+
+	return animation, nil
+}
+
+func (s *PostgresStore) UpdateAnimation(ctx context.Context, id, userId string, update UpdateAnimationRequest) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	currentHash, err := lockOwnedAnimation(ctx, tx, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if update.Code != nil && CodeHash(*update.Code) != currentHash {
+		codeHash, err := saveCodeBlob(ctx, tx, *update.Code)
+		if err != nil {
+			return err
+		}
+		// The new code is screened for flashing afresh
+		if _, err = tx.ExecContext(ctx, "UPDATE animations SET code_hash = $1, code = NULL, photosensitivity = 'unchecked' WHERE id = $2", codeHash, id); err != nil {
+			return fmt.Errorf("failed to update animation code: %v", err)
+		}
+		if _, err = recordAnimationVersion(ctx, tx, id, VersionEdited, userId, 0); err != nil {
+			return err
+		}
+	}
+	if update.Description != nil {
+		if _, err = tx.ExecContext(ctx, "UPDATE animations SET description = $1 WHERE id = $2", *update.Description, id); err != nil {
+			return fmt.Errorf("failed to update animation description: %v", err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE animations SET updated_at = NOW() WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to update animation: %v", err)
+	}
+
+	if update.ChangeNote != "" {
+		_, err = tx.ExecContext(ctx, "INSERT INTO animation_changelog (animation_id, note) VALUES ($1, $2)", id, update.ChangeNote)
+		if err != nil {
+			return fmt.Errorf("failed to record changelog entry: %v", err)
+		}
+	}
+	if err = recordSearchEvent(ctx, tx, id, SearchEventUpdate); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Animation %s updated by its owner", id)
+	return nil
+}
+
+// saveCodeBlob stores code in tx under its content hash, once however many animations and
+// versions share it, and returns the hash
+func saveCodeBlob(ctx context.Context, tx *sql.Tx, code string) (string, error) {
+	codeHash := CodeHash(code)
+	_, err := tx.ExecContext(ctx, "INSERT INTO code_blobs (hash, code) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING", codeHash, code)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert code blob: %w", err)
+	}
+	return codeHash, nil
+}
+
+// lockOwnedAnimation locks an animation that userId owns and has not been removed for update, and
+// returns the hash of its current code
+func lockOwnedAnimation(ctx context.Context, tx *sql.Tx, id, userId string) (string, error) {
+	var ownerId, codeHash string
+	var removed bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(user_id, ''), removed_at IS NOT NULL, COALESCE(code_hash, '') FROM animations WHERE id = $1 FOR UPDATE",
+		id,
+	).Scan(&ownerId, &removed, &codeHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("animation not found")
+		}
+		return "", fmt.Errorf("database error: %v", err)
+	}
+	if removed {
+		return "", errors.New("animation removed")
+	}
+	if ownerId == "" || ownerId != userId {
+		return "", errors.New("not the animation owner")
+	}
+	return codeHash, nil
+}
+
+// checkAnimationOwner returns an error unless userId owns the animation
+func (s *PostgresStore) checkAnimationOwner(ctx context.Context, id, userId string) error {
+	var ownerId string
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT COALESCE(user_id, '') FROM animations WHERE id = $1", id).Scan(&ownerId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("animation not found")
+		}
+		return fmt.Errorf("database error: %v", err)
+	}
+	if ownerId == "" || ownerId != userId {
+		return errors.New("not the animation owner")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListAnimationVersions(ctx context.Context, id, userId string) ([]AnimationVersion, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkAnimationOwner(ctx, id, userId); err != nil {
+		return nil, err
+	}
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT version, source, COALESCE(p5_version, ''), restored_from, created_at
+		 FROM animation_versions WHERE animation_id = $1 ORDER BY version DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	versions := []AnimationVersion{}
+	for rows.Next() {
+		var version AnimationVersion
+		var restoredFrom sql.NullInt64
+		if err := rows.Scan(&version.Version, &version.Source, &version.P5Version, &restoredFrom, &version.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if restoredFrom.Valid {
+			from := int(restoredFrom.Int64)
+			version.RestoredFrom = &from
+		}
+		version.Current = len(versions) == 0
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (s *PostgresStore) GetAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkAnimationOwner(ctx, id, userId); err != nil {
+		return AnimationVersion{}, err
+	}
+	result := AnimationVersion{Version: version}
+	var restoredFrom sql.NullInt64
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT v.source, COALESCE(v.p5_version, ''), v.restored_from, v.created_at, b.code,
+			v.version = (SELECT MAX(version) FROM animation_versions WHERE animation_id = v.animation_id)
+		 FROM animation_versions v JOIN code_blobs b ON b.hash = v.code_hash
+		 WHERE v.animation_id = $1 AND v.version = $2`,
+		id, version,
+	).Scan(&result.Source, &result.P5Version, &restoredFrom, &result.CreatedAt, &result.Code, &result.Current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AnimationVersion{}, errors.New("version not found")
+		}
+		return AnimationVersion{}, fmt.Errorf("database error: %v", err)
+	}
+	if restoredFrom.Valid {
+		from := int(restoredFrom.Int64)
+		result.RestoredFrom = &from
+	}
+	return result, nil
+}
+
+func (s *PostgresStore) RestoreAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return AnimationVersion{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOwnedAnimation(ctx, tx, id, userId); err != nil {
+		return AnimationVersion{}, err
+	}
+	restored := AnimationVersion{Source: VersionRestored, RestoredFrom: &version, Current: true}
+	var codeHash string
+	err = tx.QueryRowContext(ctx,
+		`SELECT v.code_hash, COALESCE(v.p5_version, ''), b.code
+		 FROM animation_versions v JOIN code_blobs b ON b.hash = v.code_hash
+		 WHERE v.animation_id = $1 AND v.version = $2`,
+		id, version,
+	).Scan(&codeHash, &restored.P5Version, &restored.Code)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AnimationVersion{}, errors.New("version not found")
+		}
+		return AnimationVersion{}, fmt.Errorf("database error: %v", err)
+	}
+
+	// The code is restored with the p5.js version it was written for
+	_, err = tx.ExecContext(ctx,
+		"UPDATE animations SET code_hash = $1, code = NULL, p5_version = NULLIF($2, ''), updated_at = NOW() WHERE id = $3",
+		codeHash, restored.P5Version, id,
+	)
+	if err != nil {
+		return AnimationVersion{}, fmt.Errorf("failed to restore animation code: %v", err)
+	}
+	if restored.Version, err = recordAnimationVersion(ctx, tx, id, VersionRestored, userId, version); err != nil {
+		return AnimationVersion{}, err
+	}
+	if err = recordSearchEvent(ctx, tx, id, SearchEventUpdate); err != nil {
+		return AnimationVersion{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return AnimationVersion{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	restored.CreatedAt = time.Now()
+
+	log.Printf("[DB] Animation %s restored to version %d as version %d", id, version, restored.Version)
+	return restored, nil
+}
+
+func (s *PostgresStore) DeleteAnimation(ctx context.Context, id, userId string, asAdmin bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerId string
+	var removed bool
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(user_id, ''), removed_at IS NOT NULL FROM animations WHERE id = $1 FOR UPDATE", id).Scan(&ownerId, &removed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("animation not found")
+		}
+		return fmt.Errorf("database error: %v", err)
+	}
+	if !asAdmin && (ownerId == "" || ownerId != userId) {
+		return errors.New("not the animation owner")
+	}
+	// Uploaders deleting their own animations is not moderation
+	if ownerId != userId {
+		entry := moderationEntry(ctx, id, ModerationDeleted, visibilityState(removed), VisibilityDeleted, "Deleted by an admin")
+		if err = recordModerationAudit(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+
+	// user_moods does not cascade; the other tables that reference animations do
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_moods WHERE animation_id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete moods: %v", err)
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM animations WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete animation: %v", err)
+	}
+	if err = recordSearchEvent(ctx, tx, id, SearchEventDelete); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Animation %s deleted by %s", id, userId)
+	return nil
+}
+
+func (s *PostgresStore) GetAnimationChangelog(ctx context.Context, id string) ([]ChangelogEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var removed bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT removed_at IS NOT NULL FROM animations WHERE id = $1", id).Scan(&removed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("animation not found")
+		}
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	if removed {
+		return nil, errors.New("animation removed")
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT note, created_at FROM animation_changelog WHERE animation_id = $1 ORDER BY created_at DESC, id DESC",
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	entries := make([]ChangelogEntry, 0)
+	for rows.Next() {
+		var entry ChangelogEntry
+		if err := rows.Scan(&entry.Note, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// SaveP5Compatibility replaces the stored compatibility matrix of an animation
+func (s *PostgresStore) SaveP5Compatibility(ctx context.Context, id string, matrix []P5Compatibility) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM animation_p5_compatibility WHERE animation_id = $1", id); err != nil {
+		return fmt.Errorf("failed to clear compatibility: %w", err)
+	}
+	for _, result := range matrix {
+		issues, err := json.Marshal(result.Issues)
+		if err != nil {
+			return fmt.Errorf("failed to encode compatibility issues: %w", err)
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO animation_p5_compatibility (animation_id, p5_major, compatible, issues) VALUES ($1, $2, $3, $4)",
+			id, result.Major, result.Compatible, string(issues),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save compatibility: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetP5Compatibility returns the stored compatibility matrix of an animation, oldest p5.js version first
+func (s *PostgresStore) GetP5Compatibility(ctx context.Context, id string) ([]P5Compatibility, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var removed bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT removed_at IS NOT NULL FROM animations WHERE id = $1", id).Scan(&removed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("animation not found")
+		}
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	if removed {
+		return nil, errors.New("animation removed")
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT p5_major, compatible, issues FROM animation_p5_compatibility WHERE animation_id = $1 ORDER BY p5_major",
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	matrix := make([]P5Compatibility, 0, len(p5Majors))
+	for rows.Next() {
+		var result P5Compatibility
+		var issues []byte
+		if err := rows.Scan(&result.Major, &result.Compatible, &issues); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if err := json.Unmarshal(issues, &result.Issues); err != nil {
+			return nil, fmt.Errorf("failed to decode compatibility issues: %w", err)
+		}
+		matrix = append(matrix, result)
+	}
+	return matrix, rows.Err()
+}
+
+// ListUserAnimations returns a page of the animations a user saved, newest first
+func (s *PostgresStore) ListUserAnimations(ctx context.Context, userId string, limit, offset int) ([]UserAnimation, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM animations WHERE user_id = $1", userId).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, COALESCE(b.code, a.code), a.description,
+			COALESCE(a.p5_version, ''), COALESCE(l.url, ''), COALESCE(l.integrity, ''),
+			a.render_status, a.photosensitivity, a.removed_at IS NOT NULL, a.created_at
+		 FROM animations a
+		 LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 LEFT JOIN p5_libraries l ON l.version = a.p5_version
+		 WHERE a.user_id = $1
+		 ORDER BY a.created_at DESC, a.id DESC
+		 LIMIT $2 OFFSET $3`,
+		userId, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := make([]UserAnimation, 0, limit)
+	for rows.Next() {
+		var animation UserAnimation
+		err := rows.Scan(&animation.ID, &animation.Code, &animation.Description,
+			&animation.P5Version, &animation.P5URL, &animation.P5Integrity,
+			&animation.RenderStatus, &animation.Photosensitivity, &animation.Removed, &animation.CreatedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, total, rows.Err()
+}
+
+// GetPreviewFrames returns the preview frames rendered for code with the given hash, in order
+func (s *PostgresStore) GetPreviewFrames(ctx context.Context, codeHash string, count int) ([]PreviewFrame, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT frame, png FROM preview_frames WHERE code_hash = $1 AND frame_count = $2 ORDER BY position",
+		codeHash, count,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	frames := make([]PreviewFrame, 0, count)
+	for rows.Next() {
+		var frame PreviewFrame
+		if err := rows.Scan(&frame.Frame, &frame.PNG); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, rows.Err()
+}
+
+// SavePreviewFrames stores a set of preview frames for code with the given hash, replacing any set of the same size
+func (s *PostgresStore) SavePreviewFrames(ctx context.Context, codeHash string, frames []PreviewFrame) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM preview_frames WHERE code_hash = $1 AND frame_count = $2", codeHash, len(frames)); err != nil {
+		return fmt.Errorf("failed to clear preview frames: %w", err)
+	}
+	for i, frame := range frames {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO preview_frames (code_hash, frame_count, position, frame, png) VALUES ($1, $2, $3, $4, $5)",
+			codeHash, len(frames), i, frame.Frame, frame.PNG,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save preview frame: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetUserIDByEmail retrieves the ID of the user with the given email
+func (s *PostgresStore) GetUserIDByEmail(ctx context.Context, email string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	index, err := emailIndex(email)
+	if err != nil {
+		return "", err
+	}
+
+	var userId string
+	err = s.conn(ctx).QueryRowContext(ctx, "SELECT id FROM users WHERE email_hash = $1 OR email = $2", index, email).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("user not found")
+		}
+		return "", fmt.Errorf("database error: %v", err)
+	}
+	return userId, nil
+}
+
+// GetUserDetails retrieves user details by user ID
+func (s *PostgresStore) GetUserDetails(ctx context.Context, userId string) (User, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var user User
+	var email, keyId sql.NullString
+	var encrypted []byte
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT id, email, email_encrypted, email_key_id, username, tenant FROM users WHERE id = $1",
+		userId,
+	).Scan(&user.ID, &email, &encrypted, &keyId, &user.Username, &user.Tenant)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return user, errors.New("user not found")
+		}
+		return user, fmt.Errorf("database error: %v", err)
+	}
+
+	cipher, err := EmailEncryption()
+	if err != nil {
+		return User{}, err
+	}
+	if user.Email, err = openEmail(cipher, email, encrypted, keyId); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// SetUserTenant records the tenant of an account from before tenants were recorded, leaving
+// accounts that already belong to one as they are
+func (s *PostgresStore) SetUserTenant(ctx context.Context, userId, tenant string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE users SET tenant = $2 WHERE id = $1 AND tenant = ''",
+		userId, tenant,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set user tenant: %v", err)
+	}
+	return nil
+}
+
+// UpdateUserProfile updates the email and username of a user and returns the refreshed user
+func (s *PostgresStore) UpdateUserProfile(ctx context.Context, userId, email, username string) (User, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	stored, err := sealEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE users SET email = $1, email_hash = $2, email_encrypted = $3, email_key_id = $4, username = $5
+		 WHERE id = $6`,
+		stored.plain, stored.hash, stored.encrypted, stored.keyId, username, userId,
+	)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to update user: %v", err)
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return User{}, errors.New("user not found")
+	}
+
+	log.Printf("[DB] Profile updated successfully for user %s", userId)
+	return s.GetUserDetails(ctx, userId)
+}
+
+// RecordProfileChange stores an audit entry for a changed profile field.
+// A non-empty revertTokenHash allows the change to be reverted until revertExpiresAt.
+func (s *PostgresStore) RecordProfileChange(ctx context.Context, userId, field, oldValue, newValue, revertTokenHash string, revertExpiresAt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var tokenHash sql.NullString
+	var expiresAt sql.NullTime
+	if revertTokenHash != "" {
+		tokenHash = sql.NullString{String: revertTokenHash, Valid: true}
+		expiresAt = sql.NullTime{Time: revertExpiresAt, Valid: true}
+	}
+
+	// Email changes are sealed like the users table so the history does not leak addresses either
+	change := storedEmailChange{
+		oldValue: sql.NullString{String: oldValue, Valid: true},
+		newValue: sql.NullString{String: newValue, Valid: true},
+	}
+	if field == "email" {
+		var err error
+		if change, err = sealEmailChange(oldValue, newValue); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO profile_changes (user_id, field, old_value, new_value, old_value_encrypted, new_value_encrypted,
+		                              value_key_id, revert_token_hash, revert_expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		userId, field, change.oldValue, change.newValue, change.oldEncrypted, change.newEncrypted,
+		change.keyId, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record profile change: %w", err)
+	}
+	return nil
+}
+
+// RevertEmailChange restores the previous email for a pending revert link and returns the refreshed user
+func (s *PostgresStore) RevertEmailChange(ctx context.Context, revertTokenHash string) (User, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var changeId int
+	var userId string
+	var stored storedEmailChange
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, user_id, old_value, new_value, old_value_encrypted, new_value_encrypted, value_key_id
+		 FROM profile_changes
+		 WHERE revert_token_hash = $1 AND field = 'email'
+		   AND reverted_at IS NULL AND revert_expires_at > NOW()
+		 FOR UPDATE`,
+		revertTokenHash,
+	).Scan(&changeId, &userId, &stored.oldValue, &stored.newValue, &stored.oldEncrypted, &stored.newEncrypted, &stored.keyId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, errors.New("revert link is invalid or expired")
+		}
+		return User{}, fmt.Errorf("database error: %v", err)
+	}
+
+	cipher, err := EmailEncryption()
+	if err != nil {
+		return User{}, err
+	}
+	oldEmail, err := openEmail(cipher, stored.oldValue, stored.oldEncrypted, stored.keyId)
+	if err != nil {
+		return User{}, err
+	}
+	newEmail, err := openEmail(cipher, stored.newValue, stored.newEncrypted, stored.keyId)
+	if err != nil {
+		return User{}, err
+	}
+	index, err := emailIndex(oldEmail)
+	if err != nil {
+		return User{}, err
+	}
+
+	var taken bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE (email_hash = $1 OR email = $2) AND id <> $3)",
+		index, oldEmail, userId,
+	).Scan(&taken)
+	if err != nil {
+		return User{}, fmt.Errorf("database error: %v", err)
+	}
+	if taken {
+		return User{}, errors.New("email already in use")
+	}
+
+	restored, err := sealEmail(oldEmail)
+	if err != nil {
+		return User{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET email = $1, email_hash = $2, email_encrypted = $3, email_key_id = $4 WHERE id = $5",
+		restored.plain, restored.hash, restored.encrypted, restored.keyId, userId,
+	)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to restore email: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE profile_changes SET reverted_at = NOW() WHERE id = $1", changeId); err != nil {
+		return User{}, fmt.Errorf("failed to mark change reverted: %w", err)
+	}
+	// Written from Go in UTC, as it is compared with the issue times of tokens
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET sessions_revoked_at = $1 WHERE id = $2", time.Now().UTC(), userId); err != nil {
+		return User{}, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	change, err := sealEmailChange(newEmail, oldEmail)
+	if err != nil {
+		return User{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO profile_changes (user_id, field, old_value, new_value, old_value_encrypted, new_value_encrypted, value_key_id)
+		 VALUES ($1, 'email', $2, $3, $4, $5, $6)`,
+		userId, change.oldValue, change.newValue, change.oldEncrypted, change.newEncrypted, change.keyId,
+	)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to record profile change: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return User{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Email change reverted for user %s", userId)
+	return s.GetUserDetails(ctx, userId)
+}
+
+func (s *PostgresStore) SessionsRevokedAt(ctx context.Context, userId string) (time.Time, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var revokedAt sql.NullTime
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT sessions_revoked_at FROM users WHERE id = $1", userId).Scan(&revokedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, fmt.Errorf("database error: %v", err)
+	}
+	return revokedAt.Time, nil
+}
+
+// AnimationExists checks if an animation with the given ID exists
+func (s *PostgresStore) AnimationExists(ctx context.Context, id string) bool {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM animations WHERE id = $1", id).Scan(&count)
+	if err != nil {
+		log.Printf("[DB ERROR] Failed to check if animation exists: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// reviewedCondition leaves out animations a that are waiting for, or were refused, their workspace
+// owner's approval
+const reviewedCondition = "NOT EXISTS (SELECT 1 FROM animation_reviews r WHERE r.animation_id = a.id AND r.status <> 'approved')"
+
+// feedConditions returns the WHERE conditions on animations a that the feed may show, numbering
+// its placeholders after args and returning them with the filter's values appended
+func feedConditions(filter FeedFilter, args []interface{}) (string, []interface{}) {
+	conditions := "a.render_status NOT IN ('crashed', 'nondeterministic') AND a.removed_at IS NULL AND a.photosensitivity <> 'flashing' AND " + reviewedCondition
+	if filter.ReducedMotion {
+		args = append(args, filter.MaxMotionScore)
+		conditions += fmt.Sprintf(" AND a.photosensitivity = 'safe' AND a.motion_score <= $%d", len(args))
+	} else if filter.AvoidFlashing {
+		conditions += " AND a.photosensitivity = 'safe'"
+	}
+	return conditions, args
+}
+
+// GetRandomAnimation retrieves a random animation from the database
+func (s *PostgresStore) GetRandomAnimation(ctx context.Context, filter FeedFilter) (GetAnimationResponse, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions, args := feedConditions(filter, nil)
+	var animation GetAnimationResponse
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT a.id, COALESCE(b.code, a.code), a.description,
+			COALESCE(a.p5_version, ''), COALESCE(l.url, ''), COALESCE(l.integrity, '')
+		 FROM animations a
+		 LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 LEFT JOIN p5_libraries l ON l.version = a.p5_version
+		 WHERE `+conditions+`
+		 ORDER BY RANDOM() LIMIT 1`,
+		args...,
+	).Scan(&animation.ID, &animation.Code, &animation.Description, &animation.P5Version, &animation.P5URL, &animation.P5Integrity)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return animation, errors.New("no animations found")
+		}
+		return animation, fmt.Errorf("database error: %v", err)
+	}
+
+	return animation, nil
+}
+
+// ListFeedAnimationIDs returns a random sample of the IDs the feed may show
+func (s *PostgresStore) ListFeedAnimationIDs(ctx context.Context, filter FeedFilter, limit int) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions, args := feedConditions(filter, []interface{}{limit})
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT a.id FROM animations a WHERE "+conditions+" ORDER BY RANDOM() LIMIT $1",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0, limit)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListFeedAnimations returns a page of the animations the feed may show, newest first
+func (s *PostgresStore) ListFeedAnimations(ctx context.Context, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions, args := feedConditions(filter, nil)
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM animations a WHERE "+conditions, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	conditions, args = feedConditions(filter, []interface{}{limit, offset})
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, COALESCE(b.code, a.code), a.description,
+			COALESCE(a.p5_version, ''), COALESCE(l.url, ''), COALESCE(l.integrity, '')
+		 FROM animations a
+		 LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 LEFT JOIN p5_libraries l ON l.version = a.p5_version
+		 WHERE `+conditions+`
+		 ORDER BY a.created_at DESC, a.id DESC
+		 LIMIT $1 OFFSET $2`,
+		args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := make([]GetAnimationResponse, 0, limit)
+	for rows.Next() {
+		var animation GetAnimationResponse
+		if err := rows.Scan(&animation.ID, &animation.Code, &animation.Description, &animation.P5Version, &animation.P5URL, &animation.P5Integrity); err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, total, rows.Err()
+}
+
+// SearchAnimations returns a page of the animations the feed may show whose description matches
+// query, ranked by ts_rank. The query accepts web search syntax: quoted phrases, OR and -excluded words.
+func (s *PostgresStore) SearchAnimations(ctx context.Context, query string, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions, args := feedConditions(filter, []interface{}{query})
+	conditions += " AND a.search_vector @@ websearch_to_tsquery('english', $1)"
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM animations a WHERE "+conditions, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	conditions, args = feedConditions(filter, []interface{}{query, limit, offset})
+	conditions += " AND a.search_vector @@ websearch_to_tsquery('english', $1)"
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, COALESCE(b.code, a.code), a.description,
+			COALESCE(a.p5_version, ''), COALESCE(l.url, ''), COALESCE(l.integrity, '')
+		 FROM animations a
+		 LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 LEFT JOIN p5_libraries l ON l.version = a.p5_version
+		 WHERE `+conditions+`
+		 ORDER BY ts_rank(a.search_vector, websearch_to_tsquery('english', $1)) DESC, a.created_at DESC, a.id DESC
+		 LIMIT $2 OFFSET $3`,
+		args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := make([]GetAnimationResponse, 0, limit)
+	for rows.Next() {
+		var animation GetAnimationResponse
+		if err := rows.Scan(&animation.ID, &animation.Code, &animation.Description, &animation.P5Version, &animation.P5URL, &animation.P5Integrity); err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, total, rows.Err()
+}
+
+// SetAnimationPhotosensitivity records the result of screening an animation's rendered frames for flashing
+func (s *PostgresStore) SetAnimationPhotosensitivity(ctx context.Context, id string, report PhotosensitivityReport) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from string
+	err = tx.QueryRowContext(ctx, "SELECT photosensitivity FROM animations WHERE id = $1 FOR UPDATE", id).Scan(&from)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("animation not found")
+		}
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE animations SET photosensitivity = $1, motion_score = $2 WHERE id = $3",
+		report.Status, report.MotionScore, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update photosensitivity: %w", err)
+	}
+	if from != report.Status {
+		entry := moderationEntry(ctx, id, ModerationPhotosensitivity, from, report.Status, "Photosensitivity screening")
+		if err = recordModerationAudit(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	// The search index filters on the screening result
+	if err = recordSearchEvent(ctx, tx, id, SearchEventUpdate); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetAnimationRenderStatus records the result of a headless render check
+func (s *PostgresStore) SetAnimationRenderStatus(ctx context.Context, id string, status string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from string
+	err = tx.QueryRowContext(ctx, "SELECT render_status FROM animations WHERE id = $1 FOR UPDATE", id).Scan(&from)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("animation not found")
+		}
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE animations SET render_status = $1, render_checked_at = NOW() WHERE id = $2",
+		status, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update render status: %w", err)
+	}
+	if from != status {
+		entry := moderationEntry(ctx, id, ModerationRenderStatus, from, status, "Determinism check")
+		if err = recordModerationAudit(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	if err = recordSearchEvent(ctx, tx, id, SearchEventUpdate); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAnimationIDsByRenderStatus returns up to limit animation IDs with the given render status, oldest first
+func (s *PostgresStore) GetAnimationIDsByRenderStatus(ctx context.Context, status string, limit int) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT id FROM animations WHERE render_status = $1 ORDER BY created_at LIMIT $2",
+		status, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0, limit)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SaveMood saves a user's mood for an animation
+func (s *PostgresStore) SaveMood(ctx context.Context, userId string, animationId string, mood string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	plain, keyId, encrypted, err := sealMood(mood)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO user_moods (user_id, animation_id, mood, mood_encrypted, mood_key_id)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (user_id, animation_id)
+		 DO UPDATE SET mood = EXCLUDED.mood, mood_encrypted = EXCLUDED.mood_encrypted,
+			mood_key_id = EXCLUDED.mood_key_id, created_at = CURRENT_TIMESTAMP`,
+		userId, animationId, plain, encrypted, keyId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save mood: %w", err)
+	}
+
+	log.Printf("[DB] Mood saved successfully for user %s and animation %s", userId, animationId)
+	return nil
+}
+
+func (s *PostgresStore) ListMoods(ctx context.Context, userId string, from, to time.Time, limit, offset int) ([]MoodEntry, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	ring, err := MoodKeyring()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// NULL bounds leave the range open
+	fromArg, toArg := timeRangeArgs(from, to)
+	const where = `m.user_id = $1 AND ($2::timestamp IS NULL OR m.created_at >= $2) AND ($3::timestamp IS NULL OR m.created_at < $3)`
+
+	var total int
+	err = s.conn(ctx).QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM user_moods m WHERE "+where,
+		userId, fromArg, toArg,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT m.animation_id, COALESCE(a.description, ''), m.mood, m.mood_encrypted, m.mood_key_id, m.created_at
+		 FROM user_moods m
+		 LEFT JOIN animations a ON a.id = m.animation_id AND a.removed_at IS NULL
+		 WHERE `+where+`
+		 ORDER BY m.created_at DESC, m.animation_id
+		 LIMIT $4 OFFSET $5`,
+		userId, fromArg, toArg, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	moods := []MoodEntry{}
+	for rows.Next() {
+		var entry MoodEntry
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&entry.AnimationID, &entry.AnimationDescription, &plain, &encrypted, &keyId, &entry.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		mood, err := openMood(ring, plain, encrypted, keyId)
+		if err != nil {
+			return nil, 0, err
+		}
+		entry.Mood = Mood(mood)
+		moods = append(moods, entry)
+	}
+	return moods, total, rows.Err()
+}
+
+func (s *PostgresStore) GetMoodCounts(ctx context.Context, animationIds []string) (map[string]map[Mood]int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	ring, err := MoodKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypted moods can only be counted once they are decrypted here
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT animation_id, mood, mood_encrypted, mood_key_id FROM user_moods WHERE animation_id = ANY($1)",
+		pq.Array(animationIds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]map[Mood]int{}
+	for rows.Next() {
+		var animationId string
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&animationId, &plain, &encrypted, &keyId); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		mood, err := openMood(ring, plain, encrypted, keyId)
+		if err != nil {
+			return nil, err
+		}
+		if counts[animationId] == nil {
+			counts[animationId] = map[Mood]int{}
+		}
+		counts[animationId][Mood(mood)]++
+	}
+	return counts, rows.Err()
+}
+
+func (s *PostgresStore) SaveP5Library(ctx context.Context, library P5Library) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// A registered version is never re-pointed, or pinned animations could load different code
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO p5_libraries (version, url, integrity) VALUES ($1, $2, $3) ON CONFLICT (version) DO NOTHING",
+		library.Version, library.URL, library.Integrity,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save p5.js version: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("p5.js version already registered")
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetP5Library(ctx context.Context, version string) (P5Library, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var library P5Library
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT version, url, integrity, created_at FROM p5_libraries WHERE version = $1",
+		version,
+	).Scan(&library.Version, &library.URL, &library.Integrity, &library.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return library, errors.New("p5.js version not found")
+		}
+		return library, fmt.Errorf("database error: %v", err)
+	}
+	return library, nil
+}
+
+// ListP5Libraries returns every registered p5.js build, most recently registered first
+func (s *PostgresStore) ListP5Libraries(ctx context.Context) ([]P5Library, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT version, url, integrity, created_at FROM p5_libraries ORDER BY created_at DESC, version DESC")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	libraries := make([]P5Library, 0)
+	for rows.Next() {
+		var library P5Library
+		if err := rows.Scan(&library.Version, &library.URL, &library.Integrity, &library.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		libraries = append(libraries, library)
+	}
+	return libraries, rows.Err()
+}
+
+func (s *PostgresStore) GetAccountType(ctx context.Context, userId string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var accountType string
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT account_type FROM users WHERE id = $1", userId).Scan(&accountType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("user not found")
+		}
+		return "", fmt.Errorf("database error: %v", err)
+	}
+	return accountType, nil
+}
+
+func (s *PostgresStore) SetAccountType(ctx context.Context, userId, accountType string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET account_type = $1 WHERE id = $2", accountType, userId)
+	if err != nil {
+		return fmt.Errorf("failed to set account type: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("user not found")
+	}
+
+	log.Printf("[DB] User %s is now a %s account", userId, accountType)
+	return nil
+}
+
+// clientLinkColumns selects a client link with the usernames on both sides, for scanClientLink
+const clientLinkColumns = `SELECT l.id, l.professional_id, COALESCE(p.username, ''), COALESCE(l.client_id, ''),
+		COALESCE(c.username, ''), l.invite_email, l.status, l.share_mood_trends, l.created_at, l.accepted_at, l.ended_at
+	 FROM client_links l
+	 JOIN users p ON p.id = l.professional_id
+	 LEFT JOIN users c ON c.id = l.client_id`
+
+func scanClientLink(row interface{ Scan(...interface{}) error }) (ClientLink, error) {
+	var link ClientLink
+	var acceptedAt, endedAt sql.NullTime
+	err := row.Scan(&link.ID, &link.ProfessionalID, &link.ProfessionalName, &link.ClientID, &link.ClientName,
+		&link.InviteEmail, &link.Status, &link.ShareMoodTrends, &link.CreatedAt, &acceptedAt, &endedAt)
+	if acceptedAt.Valid {
+		link.AcceptedAt = &acceptedAt.Time
+	}
+	if endedAt.Valid {
+		link.EndedAt = &endedAt.Time
+	}
+	return link, err
+}
+
+func (s *PostgresStore) listClientLinks(ctx context.Context, where string, userId string) ([]ClientLink, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, clientLinkColumns+" WHERE "+where+" ORDER BY l.created_at DESC, l.id DESC", userId)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	links := []ClientLink{}
+	for rows.Next() {
+		link, err := scanClientLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (s *PostgresStore) CreateClientInvite(ctx context.Context, professionalId, email, tokenHash string, expiresAt time.Time) (ClientLink, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO client_links (professional_id, invite_email, invite_token_hash, invite_expires_at)
+		 VALUES ($1, $2, $3, $4) RETURNING id`,
+		professionalId, email, tokenHash, expiresAt,
+	).Scan(&id)
+	if err != nil {
+		return ClientLink{}, fmt.Errorf("failed to create client invite: %v", err)
+	}
+
+	log.Printf("[DB] Professional %s invited a client (link %d)", professionalId, id)
+	return s.GetClientLink(ctx, id)
+}
+
+func (s *PostgresStore) AcceptClientInvite(ctx context.Context, tokenHash, clientId string, shareMoodTrends bool) (ClientLink, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return ClientLink{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	var professionalId, inviteEmail string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, professional_id, invite_email FROM client_links
+		 WHERE invite_token_hash = $1 AND status = 'invited' AND invite_expires_at > NOW()
+		 FOR UPDATE`,
+		tokenHash,
+	).Scan(&id, &professionalId, &inviteEmail)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ClientLink{}, errors.New("invite is invalid or expired")
+		}
+		return ClientLink{}, fmt.Errorf("database error: %v", err)
+	}
+
+	// An invitation forwarded to someone else reads as invalid rather than revealing who it was for
+	var plainEmail, emailKeyId sql.NullString
+	var encryptedEmail []byte
+	err = tx.QueryRowContext(ctx,
+		"SELECT email, email_encrypted, email_key_id FROM users WHERE id = $1",
+		clientId,
+	).Scan(&plainEmail, &encryptedEmail, &emailKeyId)
+	if err != nil {
+		return ClientLink{}, fmt.Errorf("database error: %v", err)
+	}
+	cipher, err := EmailEncryption()
+	if err != nil {
+		return ClientLink{}, err
+	}
+	clientEmail, err := openEmail(cipher, plainEmail, encryptedEmail, emailKeyId)
+	if err != nil {
+		return ClientLink{}, err
+	}
+	if !strings.EqualFold(clientEmail, inviteEmail) {
+		return ClientLink{}, errors.New("invite is invalid or expired")
+	}
+	if professionalId == clientId {
+		return ClientLink{}, errors.New("cannot link to yourself")
+	}
+
+	var linked bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM client_links WHERE professional_id = $1 AND client_id = $2 AND status = 'active')",
+		professionalId, clientId,
+	).Scan(&linked)
+	if err != nil {
+		return ClientLink{}, fmt.Errorf("database error: %v", err)
+	}
+	if linked {
+		return ClientLink{}, errors.New("client already linked")
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE client_links SET client_id = $1, status = 'active', share_mood_trends = $2,
+			accepted_at = NOW(), invite_token_hash = NULL
+		 WHERE id = $3`,
+		clientId, shareMoodTrends, id,
+	)
+	if err != nil {
+		return ClientLink{}, fmt.Errorf("failed to accept client invite: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ClientLink{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Client %s accepted link %d", clientId, id)
+	return s.GetClientLink(ctx, id)
+}
+
+func (s *PostgresStore) GetClientLink(ctx context.Context, id int) (ClientLink, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	link, err := scanClientLink(s.conn(ctx).QueryRowContext(ctx, clientLinkColumns+" WHERE l.id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ClientLink{}, errors.New("client link not found")
+		}
+		return ClientLink{}, fmt.Errorf("database error: %v", err)
+	}
+	return link, nil
+}
+
+func (s *PostgresStore) ListProfessionalClients(ctx context.Context, professionalId string) ([]ClientLink, error) {
+	return s.listClientLinks(ctx, "l.professional_id = $1", professionalId)
+}
+
+func (s *PostgresStore) ListClientProfessionals(ctx context.Context, clientId string) ([]ClientLink, error) {
+	return s.listClientLinks(ctx, "l.client_id = $1", clientId)
+}
+
+func (s *PostgresStore) SetMoodTrendConsent(ctx context.Context, linkId int, share bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE client_links SET share_mood_trends = $1 WHERE id = $2 AND status = 'active'",
+		share, linkId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update consent: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("client link not active")
+	}
+	return nil
+}
+
+func (s *PostgresStore) EndClientLink(ctx context.Context, linkId int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// Ending a link also withdraws consent and voids an unused invitation
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE client_links SET status = 'ended', ended_at = NOW(), share_mood_trends = FALSE, invite_token_hash = NULL
+		 WHERE id = $1 AND status <> 'ended'`,
+		linkId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end client link: %v", err)
+	}
+
+	log.Printf("[DB] Client link %d ended", linkId)
+	return nil
+}
+
+func (s *PostgresStore) AssignSession(ctx context.Context, linkId int, animationId, note string) (SessionAssignment, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	assignment := SessionAssignment{LinkID: linkId, AnimationID: animationId, Note: note}
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT COALESCE(description, '') FROM animations WHERE id = $1 AND removed_at IS NULL",
+		animationId,
+	).Scan(&assignment.Description)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SessionAssignment{}, errors.New("animation not found")
+		}
+		return SessionAssignment{}, fmt.Errorf("database error: %v", err)
+	}
+
+	err = s.conn(ctx).QueryRowContext(ctx,
+		"INSERT INTO session_assignments (link_id, animation_id, note) VALUES ($1, $2, $3) RETURNING id, created_at",
+		linkId, animationId, note,
+	).Scan(&assignment.ID, &assignment.CreatedAt)
+	if err != nil {
+		return SessionAssignment{}, fmt.Errorf("failed to assign session: %v", err)
+	}
+	return assignment, nil
+}
+
+func (s *PostgresStore) listSessions(ctx context.Context, where string, arg interface{}) ([]SessionAssignment, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT s.id, s.link_id, s.animation_id, COALESCE(a.description, ''), s.note, s.created_at
+		 FROM session_assignments s
+		 JOIN client_links l ON l.id = s.link_id
+		 JOIN animations a ON a.id = s.animation_id
+		 WHERE `+where+` AND a.removed_at IS NULL
+		 ORDER BY s.created_at DESC, s.id DESC`,
+		arg,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := []SessionAssignment{}
+	for rows.Next() {
+		var session SessionAssignment
+		if err := rows.Scan(&session.ID, &session.LinkID, &session.AnimationID, &session.Description, &session.Note, &session.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *PostgresStore) ListLinkSessions(ctx context.Context, linkId int) ([]SessionAssignment, error) {
+	return s.listSessions(ctx, "s.link_id = $1", linkId)
+}
+
+func (s *PostgresStore) ListClientSessions(ctx context.Context, clientId string) ([]SessionAssignment, error) {
+	return s.listSessions(ctx, "l.client_id = $1 AND l.status = 'active'", clientId)
+}
+
+func (s *PostgresStore) GetMoodTrends(ctx context.Context, userId string, since time.Time) ([]MoodTrend, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	ring, err := MoodKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypted moods can only be counted once they are decrypted here
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT date_trunc('week', created_at), mood, mood_encrypted, mood_key_id
+		 FROM user_moods
+		 WHERE user_id = $1 AND created_at >= $2`,
+		userId, since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	trends := []MoodTrend{}
+	for rows.Next() {
+		var week time.Time
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&week, &plain, &encrypted, &keyId); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		mood, err := openMood(ring, plain, encrypted, keyId)
+		if err != nil {
+			return nil, err
+		}
+		trends = addMoodCount(trends, week, Mood(mood), 1)
+	}
+	return trends, rows.Err()
+}
+
+func (s *PostgresStore) RecordProfessionalAudit(ctx context.Context, linkId int, actorId, action string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO professional_audit_log (link_id, actor_id, action) VALUES ($1, $2, $3)",
+		linkId, actorId, action,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListProfessionalAudit(ctx context.Context, linkId int) ([]ProfessionalAuditEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT actor_id, action, created_at FROM professional_audit_log WHERE link_id = $1 ORDER BY created_at DESC, id DESC",
+		linkId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []ProfessionalAuditEntry{}
+	for rows.Next() {
+		var entry ProfessionalAuditEntry
+		if err := rows.Scan(&entry.ActorID, &entry.Action, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ListDatasetAnimations returns every animation that has not been removed with its mood counts.
+// Moods may be encrypted, so they are counted here rather than in SQL.
+func (s *PostgresStore) ListDatasetAnimations(ctx context.Context) ([]DatasetAnimation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	ring, err := MoodKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT id, COALESCE(description, ''), COALESCE(p5_version, ''), render_status, photosensitivity, created_at
+		 FROM animations WHERE removed_at IS NULL ORDER BY created_at, id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	animations := []DatasetAnimation{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var animation DatasetAnimation
+		if err := rows.Scan(&animation.ID, &animation.Description, &animation.P5Version, &animation.RenderStatus,
+			&animation.Photosensitivity, &animation.CreatedWeek); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		index[animation.ID] = len(animations)
+		animations = append(animations, animation)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err = s.conn(ctx).QueryContext(ctx, "SELECT animation_id, mood, mood_encrypted, mood_key_id FROM user_moods")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var animationId string
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&animationId, &plain, &encrypted, &keyId); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		i, ok := index[animationId]
+		if !ok {
+			continue
+		}
+		mood, err := openMood(ring, plain, encrypted, keyId)
+		if err != nil {
+			return nil, err
+		}
+		if animations[i].MoodCounts == nil {
+			animations[i].MoodCounts = make(map[Mood]int)
+		}
+		animations[i].MoodCounts[Mood(mood)]++
+		animations[i].MoodTotal++
+	}
+	return animations, rows.Err()
+}
+
+// SaveDataset stores a published dataset, dropping all but the most recent few
+func (s *PostgresStore) SaveDataset(ctx context.Context, dataset Dataset) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	data, err := json.Marshal(dataset)
+	if err != nil {
+		return fmt.Errorf("failed to encode dataset: %w", err)
+	}
+	if _, err := s.conn(ctx).ExecContext(ctx, "INSERT INTO datasets (generated_at, data) VALUES ($1, $2)", dataset.GeneratedAt, data); err != nil {
+		return fmt.Errorf("failed to save dataset: %w", err)
+	}
+	_, err = s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM datasets WHERE id NOT IN (SELECT id FROM datasets ORDER BY generated_at DESC, id DESC LIMIT $1)",
+		datasetsKept,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune datasets: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetLatestDataset(ctx context.Context) (Dataset, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var data []byte
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT data FROM datasets ORDER BY generated_at DESC, id DESC LIMIT 1").Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Dataset{}, errors.New("dataset not found")
+		}
+		return Dataset{}, fmt.Errorf("database error: %v", err)
+	}
+	var dataset Dataset
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		return Dataset{}, fmt.Errorf("failed to decode dataset: %w", err)
+	}
+	return dataset, nil
+}
+
+func (s *PostgresStore) SaveAnimationEmbedding(ctx context.Context, id, model string, vector []float32) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO animation_embeddings (animation_id, model, embedding) VALUES ($1, $2, $3)
+		 ON CONFLICT (animation_id) DO UPDATE SET model = EXCLUDED.model, embedding = EXCLUDED.embedding, created_at = NOW()`,
+		id, model, pq.Float32Array(vector),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save embedding: %w", err)
+	}
+	return nil
+}
+
+// ListAnimationEmbeddings returns the embeddings from model of the animations the feed may show.
+// Similarity is computed by the caller, so every eligible vector is read.
+func (s *PostgresStore) ListAnimationEmbeddings(ctx context.Context, model string, filter FeedFilter) ([]AnimationEmbedding, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions, args := feedConditions(filter, []interface{}{model})
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, e.embedding FROM animation_embeddings e
+		 JOIN animations a ON a.id = e.animation_id
+		 WHERE e.model = $1 AND `+conditions,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	embeddings := []AnimationEmbedding{}
+	for rows.Next() {
+		var embedding AnimationEmbedding
+		var vector pq.Float32Array
+		if err := rows.Scan(&embedding.AnimationID, &vector); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		embedding.Vector = vector
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, rows.Err()
+}
+
+func (s *PostgresStore) ListAnimationsWithoutEmbedding(ctx context.Context, model string, limit int) ([]DescribedAnimation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, a.description FROM animations a
+		 LEFT JOIN animation_embeddings e ON e.animation_id = a.id AND e.model = $1
+		 WHERE e.animation_id IS NULL AND COALESCE(TRIM(a.description), '') <> ''
+		 ORDER BY a.id LIMIT $2`,
+		model, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := []DescribedAnimation{}
+	for rows.Next() {
+		var animation DescribedAnimation
+		if err := rows.Scan(&animation.ID, &animation.Description); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, rows.Err()
+}
+
+func (s *PostgresStore) CreateComment(ctx context.Context, animationId, userId, body string) (Comment, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	comment := Comment{AnimationID: animationId, Author: CommentAuthor{ID: userId}, Body: body}
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO comments (animation_id, user_id, body)
+		 SELECT id, $2, $3 FROM animations WHERE id = $1 AND removed_at IS NULL
+		 RETURNING id, created_at, (SELECT COALESCE(username, '') FROM users WHERE id = $2)`,
+		animationId, userId, body,
+	).Scan(&comment.ID, &comment.CreatedAt, &comment.Author.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Comment{}, errors.New("animation not found")
+		}
+		return Comment{}, fmt.Errorf("failed to save comment: %v", err)
+	}
+
+	log.Printf("[DB] Comment %d added to animation %s", comment.ID, animationId)
+	return comment, nil
+}
+
+func (s *PostgresStore) ListComments(ctx context.Context, animationId string, limit, offset int) ([]Comment, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM comments WHERE animation_id = a.id) FROM animations a
+		 WHERE a.id = $1 AND a.removed_at IS NULL`,
+		animationId,
+	).Scan(&total)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, errors.New("animation not found")
+		}
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT c.id, c.animation_id, c.user_id, COALESCE(u.username, ''), c.body, c.created_at
+		 FROM comments c
+		 JOIN users u ON u.id = c.user_id
+		 WHERE c.animation_id = $1
+		 ORDER BY c.created_at, c.id
+		 LIMIT $2 OFFSET $3`,
+		animationId, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(&comment.ID, &comment.AnimationID, &comment.Author.ID, &comment.Author.Username, &comment.Body, &comment.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		comments = append(comments, comment)
+	}
+	return comments, total, rows.Err()
+}
+
+func (s *PostgresStore) DeleteComment(ctx context.Context, animationId string, commentId int, userId string, asAdmin bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var authorId, ownerId string
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT c.user_id, COALESCE(a.user_id, '') FROM comments c
+		 JOIN animations a ON a.id = c.animation_id
+		 WHERE c.id = $1 AND c.animation_id = $2`,
+		commentId, animationId,
+	).Scan(&authorId, &ownerId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("comment not found")
+		}
+		return fmt.Errorf("database error: %v", err)
+	}
+	if !asAdmin && userId != authorId && (ownerId == "" || userId != ownerId) {
+		return errors.New("not the comment author")
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM comments WHERE id = $1", commentId); err != nil {
+		return fmt.Errorf("failed to delete comment: %v", err)
+	}
+
+	log.Printf("[DB] Comment %d on animation %s deleted by %s", commentId, animationId, userId)
+	return nil
+}
+
+func (s *PostgresStore) GetNotificationPreferences(ctx context.Context, userId string) (NotificationPreferences, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var events []byte
+	var start, end, timezone sql.NullString
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT events, TO_CHAR(quiet_start, 'HH24:MI'), TO_CHAR(quiet_end, 'HH24:MI'), quiet_timezone
+		 FROM user_notification_preferences WHERE user_id = $1`,
+		userId,
+	).Scan(&events, &start, &end, &timezone)
+	if err == sql.ErrNoRows {
+		return NotificationPreferences{}, nil
+	}
+	if err != nil {
+		return NotificationPreferences{}, fmt.Errorf("database error: %v", err)
+	}
+
+	var preferences NotificationPreferences
+	if err := json.Unmarshal(events, &preferences.Events); err != nil {
+		return NotificationPreferences{}, fmt.Errorf("invalid notification events: %v", err)
+	}
+	if start.Valid && end.Valid && timezone.Valid {
+		preferences.QuietHours = &QuietHours{Start: start.String, End: end.String, Timezone: timezone.String}
+	}
+	return preferences, nil
+}
+
+func (s *PostgresStore) SaveNotificationPreferences(ctx context.Context, userId string, preferences NotificationPreferences) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	events, err := json.Marshal(preferences.Events)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification events: %v", err)
+	}
+	var start, end, timezone sql.NullString
+	if quiet := preferences.QuietHours; quiet != nil {
+		start = sql.NullString{String: quiet.Start, Valid: true}
+		end = sql.NullString{String: quiet.End, Valid: true}
+		timezone = sql.NullString{String: quiet.Timezone, Valid: true}
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO user_notification_preferences (user_id, events, quiet_start, quiet_end, quiet_timezone, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, NOW())
+		 ON CONFLICT (user_id) DO UPDATE SET events = EXCLUDED.events, quiet_start = EXCLUDED.quiet_start,
+			quiet_end = EXCLUDED.quiet_end, quiet_timezone = EXCLUDED.quiet_timezone, updated_at = NOW()`,
+		userId, events, start, end, timezone,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) QueueNotification(ctx context.Context, notification Notification) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// The delay is computed here rather than passing DeliverAfter, since the column has no time zone
+	delay := max(time.Until(notification.DeliverAfter), 0)
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO notification_queue (user_id, event, channel, subject, body, next_attempt_at)
+		 VALUES ($1, $2, $3, $4, $5, NOW() + $6 * INTERVAL '1 second')`,
+		notification.UserID, notification.Event, notification.Channel, notification.Subject, notification.Body,
+		int64(delay.Seconds()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue notification: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ClaimDueNotifications(ctx context.Context, limit int) ([]Notification, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`UPDATE notification_queue SET attempts = attempts + 1, next_attempt_at = NOW() + INTERVAL '5 minutes'
+		 WHERE id IN (
+			SELECT id FROM notification_queue WHERE next_attempt_at <= NOW()
+			ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, user_id, event, channel, subject, body, attempts`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Event, &n.Channel, &n.Subject, &n.Body, &n.Attempts); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *PostgresStore) CompleteNotification(ctx context.Context, id int64) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM notification_queue WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to complete notification: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) FailNotification(ctx context.Context, id int64, cause error) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE notification_queue
+		 SET next_attempt_at = NOW() + LEAST(POWER(2, attempts), $2) * INTERVAL '1 minute', last_error = $3
+		 WHERE id = $1`,
+		id, notificationRetryMaxMinutes, cause.Error(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule notification: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetReminderSchedule(ctx context.Context, userId string) (ReminderSchedule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	schedule := ReminderSchedule{Times: []string{}}
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT times, timezone FROM mood_reminders WHERE user_id = $1",
+		userId,
+	).Scan(pq.Array(&schedule.Times), &schedule.Timezone)
+	if err != nil && err != sql.ErrNoRows {
+		return ReminderSchedule{}, fmt.Errorf("database error: %v", err)
+	}
+	return schedule, nil
+}
+
+func (s *PostgresStore) SaveReminderSchedule(ctx context.Context, userId string, schedule ReminderSchedule, nextAt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO mood_reminders (user_id, times, timezone, next_reminder_at, updated_at)
+		 VALUES ($1, $2, $3, `+reminderDueAt(4)+`, NOW())
+		 ON CONFLICT (user_id) DO UPDATE SET times = EXCLUDED.times, timezone = EXCLUDED.timezone,
+			next_reminder_at = EXCLUDED.next_reminder_at, updated_at = NOW()`,
+		userId, pq.Array(schedule.Times), schedule.Timezone, reminderDelaySeconds(nextAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save reminder schedule: %v", err)
+	}
+	return nil
+}
+
+// reminderDueAt is the SQL for a next_reminder_at whose delay in seconds from now, or NULL, is
+// parameter n. The delay is computed in Go since the column has no time zone.
+func reminderDueAt(n int) string {
+	return fmt.Sprintf("NOW() + $%d * INTERVAL '1 second'", n)
+}
+
+// reminderDelaySeconds returns the parameter for reminderDueAt: NULL for a zero nextAt
+func reminderDelaySeconds(nextAt time.Time) sql.NullInt64 {
+	if nextAt.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(max(time.Until(nextAt), 0).Seconds()), Valid: true}
+}
+
+func (s *PostgresStore) ClaimDueReminders(ctx context.Context, limit int) ([]DueReminder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`UPDATE mood_reminders SET next_reminder_at = NOW() + INTERVAL '5 minutes'
+		 WHERE user_id IN (
+			SELECT user_id FROM mood_reminders WHERE next_reminder_at <= NOW()
+			ORDER BY next_reminder_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING user_id, times, timezone`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var due []DueReminder
+	for rows.Next() {
+		var reminder DueReminder
+		if err := rows.Scan(&reminder.UserID, pq.Array(&reminder.Schedule.Times), &reminder.Schedule.Timezone); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		due = append(due, reminder)
+	}
+	return due, rows.Err()
+}
+
+func (s *PostgresStore) SetNextReminder(ctx context.Context, userId string, nextAt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE mood_reminders SET next_reminder_at = "+reminderDueAt(2)+" WHERE user_id = $1",
+		userId, reminderDelaySeconds(nextAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule reminder: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) RecordReminderSent(ctx context.Context, userId, animationId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO mood_reminder_deliveries (user_id, animation_id) VALUES ($1, NULLIF($2, ''))",
+		userId, animationId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record reminder: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) RecordReminderCheckIn(ctx context.Context, userId string, window time.Duration) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE mood_reminder_deliveries SET checked_in_at = NOW()
+		 WHERE user_id = $1 AND checked_in_at IS NULL AND sent_at >= NOW() - $2 * INTERVAL '1 second'`,
+		userId, int64(window.Seconds()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record reminder check-in: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListReminderDeliveries(ctx context.Context, userId string, window time.Duration) ([]ReminderDelivery, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT COALESCE(animation_id, ''), sent_at, checked_in_at FROM mood_reminder_deliveries
+		 WHERE user_id = $1 AND sent_at >= NOW() - $2 * INTERVAL '1 second'
+		 ORDER BY sent_at DESC`,
+		userId, int64(window.Seconds()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []ReminderDelivery{}
+	for rows.Next() {
+		var delivery ReminderDelivery
+		var checkedInAt sql.NullTime
+		if err := rows.Scan(&delivery.AnimationID, &delivery.SentAt, &checkedInAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if checkedInAt.Valid {
+			delivery.CheckedInAt = &checkedInAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// announcementColumns are the columns scanAnnouncement reads, in order
+const announcementColumns = "a.id, a.title, a.body, a.audience, a.target, a.starts_at, a.ends_at, COALESCE(a.created_by, ''), a.created_at"
+
+// scanAnnouncement reads the announcementColumns of a row
+func scanAnnouncement(row interface{ Scan(...any) error }, extra ...any) (Announcement, error) {
+	var announcement Announcement
+	var endsAt sql.NullTime
+	dest := append([]any{&announcement.ID, &announcement.Title, &announcement.Body, &announcement.Audience, &announcement.Target,
+		&announcement.StartsAt, &endsAt, &announcement.CreatedBy, &announcement.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return Announcement{}, err
+	}
+	if endsAt.Valid {
+		announcement.EndsAt = &endsAt.Time
+	}
+	return announcement, nil
+}
+
+func (s *PostgresStore) CreateAnnouncement(ctx context.Context, announcement Announcement) (Announcement, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	created, err := scanAnnouncement(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO announcements AS a (title, body, audience, target, starts_at, ends_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		 RETURNING `+announcementColumns,
+		announcement.Title, announcement.Body, announcement.Audience, announcement.Target,
+		announcement.StartsAt, announcement.EndsAt, announcement.CreatedBy,
+	))
+	if err != nil {
+		return Announcement{}, fmt.Errorf("failed to create announcement: %v", err)
+	}
+
+	log.Printf("[DB] Announcement %d created by %s", created.ID, announcement.CreatedBy)
+	return created, nil
+}
+
+func (s *PostgresStore) UpdateAnnouncement(ctx context.Context, announcement Announcement) (Announcement, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var dismissals int
+	updated, err := scanAnnouncement(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE announcements AS a SET title = $2, body = $3, audience = $4, target = $5, starts_at = $6, ends_at = $7,
+			updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING `+announcementColumns+`, (SELECT COUNT(*) FROM announcement_dismissals WHERE announcement_id = a.id)`,
+		announcement.ID, announcement.Title, announcement.Body, announcement.Audience, announcement.Target,
+		announcement.StartsAt, announcement.EndsAt,
+	), &dismissals)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Announcement{}, errors.New("announcement not found")
+		}
+		return Announcement{}, fmt.Errorf("failed to update announcement: %v", err)
+	}
+	updated.Dismissals = dismissals
+	return updated, nil
+}
+
+func (s *PostgresStore) DeleteAnnouncement(ctx context.Context, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM announcements WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete announcement: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("announcement not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListAnnouncements(ctx context.Context) ([]Announcement, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT `+announcementColumns+`, (SELECT COUNT(*) FROM announcement_dismissals WHERE announcement_id = a.id)
+		 FROM announcements a
+		 ORDER BY a.starts_at DESC, a.id DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	announcements := []Announcement{}
+	for rows.Next() {
+		var dismissals int
+		announcement, err := scanAnnouncement(rows, &dismissals)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		announcement.Dismissals = dismissals
+		announcements = append(announcements, announcement)
+	}
+	return announcements, rows.Err()
+}
+
+func (s *PostgresStore) ListActiveAnnouncements(ctx context.Context, userId string) ([]Announcement, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT `+announcementColumns+` FROM announcements a
+		 WHERE a.starts_at <= NOW() AND (a.ends_at IS NULL OR a.ends_at > NOW())
+		   AND NOT EXISTS (SELECT 1 FROM announcement_dismissals d WHERE d.announcement_id = a.id AND d.user_id = $1)
+		 ORDER BY a.starts_at DESC, a.id DESC`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	announcements := []Announcement{}
+	for rows.Next() {
+		announcement, err := scanAnnouncement(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		announcements = append(announcements, announcement)
+	}
+	return announcements, rows.Err()
+}
+
+func (s *PostgresStore) DismissAnnouncement(ctx context.Context, id int, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO announcement_dismissals (announcement_id, user_id)
+		 SELECT id, $2 FROM announcements WHERE id = $1
+		 ON CONFLICT (announcement_id, user_id) DO NOTHING`,
+		id, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to dismiss announcement: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 && !s.announcementExists(ctx, id) {
+		return errors.New("announcement not found")
+	}
+	return nil
+}
+
+// announcementExists reports whether an announcement with the given ID exists
+func (s *PostgresStore) announcementExists(ctx context.Context, id int) bool {
+	var exists bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM announcements WHERE id = $1)", id).Scan(&exists)
+	return err == nil && exists
+}
+
+// Ping checks the primary database. Status and incidents are not kept per data region.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresStore) CreateIncident(ctx context.Context, incident Incident, message string) (Incident, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Incident{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO incidents (title, component, severity, status, created_by)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id, started_at`,
+		incident.Title, incident.Component, incident.Severity, incident.Status, incident.CreatedBy,
+	).Scan(&incident.ID, &incident.StartedAt)
+	if err != nil {
+		return Incident{}, fmt.Errorf("failed to create incident: %v", err)
+	}
+	update := IncidentUpdate{Status: incident.Status, Message: message}
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO incident_updates (incident_id, status, message) VALUES ($1, $2, $3) RETURNING created_at",
+		incident.ID, update.Status, update.Message,
+	).Scan(&update.CreatedAt)
+	if err != nil {
+		return Incident{}, fmt.Errorf("failed to add incident update: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Incident{}, fmt.Errorf("failed to commit incident: %w", err)
+	}
+
+	incident.Updates = []IncidentUpdate{update}
+	log.Printf("[DB] Incident %d opened on %s by %s", incident.ID, incident.Component, incident.CreatedBy)
+	return incident, nil
+}
+
+func (s *PostgresStore) AddIncidentUpdate(ctx context.Context, id int, status, message string) (Incident, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Incident{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var resolved bool
+	err = tx.QueryRowContext(ctx, "SELECT resolved_at IS NOT NULL FROM incidents WHERE id = $1 FOR UPDATE", id).Scan(&resolved)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Incident{}, errors.New("incident not found")
+		}
+		return Incident{}, fmt.Errorf("database error: %v", err)
+	}
+	if resolved {
+		return Incident{}, errors.New("incident resolved")
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO incident_updates (incident_id, status, message) VALUES ($1, $2, $3)",
+		id, status, message,
+	); err != nil {
+		return Incident{}, fmt.Errorf("failed to add incident update: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE incidents SET status = $2, resolved_at = CASE WHEN $2 = 'resolved' THEN NOW() END WHERE id = $1`,
+		id, status,
+	); err != nil {
+		return Incident{}, fmt.Errorf("failed to update incident: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Incident{}, fmt.Errorf("failed to commit incident update: %w", err)
+	}
+
+	incidents, err := s.listIncidents(ctx, "WHERE id = $1", id)
+	if err != nil {
+		return Incident{}, err
+	}
+	if len(incidents) == 0 {
+		return Incident{}, errors.New("incident not found")
+	}
+	return incidents[0], nil
+}
+
+func (s *PostgresStore) ListIncidents(ctx context.Context, resolvedSince time.Time) ([]Incident, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	return s.listIncidents(ctx, "WHERE resolved_at IS NULL OR resolved_at > $1", resolvedSince)
+}
+
+// listIncidents returns the incidents matching where, latest started first, with their updates
+func (s *PostgresStore) listIncidents(ctx context.Context, where string, args ...any) ([]Incident, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, title, component, severity, status, started_at, resolved_at FROM incidents `+where+`
+		 ORDER BY started_at DESC, id DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	incidents := []Incident{}
+	ids := []int64{}
+	for rows.Next() {
+		incident := Incident{Updates: []IncidentUpdate{}}
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&incident.ID, &incident.Title, &incident.Component, &incident.Severity, &incident.Status,
+			&incident.StartedAt, &resolvedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if resolvedAt.Valid {
+			incident.ResolvedAt = &resolvedAt.Time
+		}
+		incidents = append(incidents, incident)
+		ids = append(ids, int64(incident.ID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	if len(incidents) == 0 {
+		return incidents, nil
+	}
+
+	updateRows, err := s.db.QueryContext(ctx,
+		`SELECT incident_id, status, message, created_at FROM incident_updates
+		 WHERE incident_id = ANY($1) ORDER BY created_at DESC, id DESC`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer updateRows.Close()
+
+	byId := make(map[int]*Incident, len(incidents))
+	for i := range incidents {
+		byId[incidents[i].ID] = &incidents[i]
+	}
+	for updateRows.Next() {
+		var incidentId int
+		var update IncidentUpdate
+		if err := updateRows.Scan(&incidentId, &update.Status, &update.Message, &update.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if incident, ok := byId[incidentId]; ok {
+			incident.Updates = append(incident.Updates, update)
+		}
+	}
+	return incidents, updateRows.Err()
+}
+
+func (s *PostgresStore) SetProviderKey(ctx context.Context, userId string, key ProviderKey) (ProviderKey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO user_provider_keys (user_id, provider, key_encrypted, key_id, key_hint)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (user_id) DO UPDATE SET provider = EXCLUDED.provider, key_encrypted = EXCLUDED.key_encrypted,
+			key_id = EXCLUDED.key_id, key_hint = EXCLUDED.key_hint, updated_at = CURRENT_TIMESTAMP`,
+		userId, key.Provider, key.Encrypted, key.KeyID, key.Hint,
+	)
+	if err != nil {
+		return ProviderKey{}, fmt.Errorf("failed to save provider key: %w", err)
+	}
+
+	log.Printf("[DB] %s key saved for user %s", key.Provider, userId)
+	return s.GetProviderKey(ctx, userId)
+}
+
+func (s *PostgresStore) GetProviderKey(ctx context.Context, userId string) (ProviderKey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var key ProviderKey
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT k.provider, k.key_hint, k.updated_at, k.key_id, k.key_encrypted,
+			COALESCE(SUM(u.generation_count) FILTER (WHERE u.usage_date = CURRENT_DATE), 0),
+			COALESCE(SUM(u.generation_count), 0)
+		 FROM user_provider_keys k
+		 LEFT JOIN provider_key_usage u ON u.user_id = k.user_id AND u.usage_date >= date_trunc('month', CURRENT_DATE)
+		 WHERE k.user_id = $1
+		 GROUP BY k.user_id`,
+		userId,
+	).Scan(&key.Provider, &key.Hint, &key.UpdatedAt, &key.KeyID, &key.Encrypted, &key.GenerationsToday, &key.GenerationsThisMonth)
+	if err == sql.ErrNoRows {
+		return ProviderKey{}, errors.New("provider key not found")
+	}
+	if err != nil {
+		return ProviderKey{}, fmt.Errorf("database error: %v", err)
+	}
+	return key, nil
+}
+
+func (s *PostgresStore) DeleteProviderKey(ctx context.Context, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM user_provider_keys WHERE user_id = $1", userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete provider key: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("provider key not found")
+	}
+
+	log.Printf("[DB] Provider key deleted for user %s", userId)
+	return nil
+}
+
+func (s *PostgresStore) RecordProviderKeyGeneration(ctx context.Context, userId, provider string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO provider_key_usage (user_id, usage_date, provider, generation_count)
+		 VALUES ($1, CURRENT_DATE, $2, 1)
+		 ON CONFLICT (user_id, usage_date, provider)
+		 DO UPDATE SET generation_count = provider_key_usage.generation_count + 1`,
+		userId, provider,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record provider key usage: %w", err)
+	}
+	return nil
+}
+
+// promptPresetColumns are the columns scanPromptPreset reads, in order, from prompt_presets p
+// joined with users u
+const promptPresetColumns = `p.id, p.user_id, COALESCE(u.username, ''), p.name, p.template, p.public, p.created_at, p.updated_at`
+
+// scanPromptPreset reads the promptPresetColumns of a row
+func scanPromptPreset(row interface{ Scan(...any) error }) (PromptPreset, error) {
+	var preset PromptPreset
+	err := row.Scan(&preset.ID, &preset.UserID, &preset.Username, &preset.Name, &preset.Template, &preset.Public, &preset.CreatedAt, &preset.UpdatedAt)
+	if err != nil {
+		return PromptPreset{}, err
+	}
+	preset.Placeholders = PromptPlaceholders(preset.Template)
+	return preset, nil
+}
+
+func (s *PostgresStore) CreatePromptPreset(ctx context.Context, preset PromptPreset) (PromptPreset, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	created, err := scanPromptPreset(s.conn(ctx).QueryRowContext(ctx,
+		`WITH p AS (
+		     INSERT INTO prompt_presets (user_id, name, template, public) VALUES ($1, $2, $3, $4)
+		     RETURNING *
+		 )
+		 SELECT `+promptPresetColumns+` FROM p JOIN users u ON u.id = p.user_id`,
+		preset.UserID, preset.Name, preset.Template, preset.Public,
+	))
+	if err != nil {
+		return PromptPreset{}, fmt.Errorf("failed to save prompt preset: %v", err)
+	}
+
+	log.Printf("[DB] Prompt preset %d saved by %s", created.ID, preset.UserID)
+	return created, nil
+}
+
+func (s *PostgresStore) UpdatePromptPreset(ctx context.Context, preset PromptPreset) (PromptPreset, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	updated, err := scanPromptPreset(s.conn(ctx).QueryRowContext(ctx,
+		`WITH p AS (
+		     UPDATE prompt_presets SET name = $3, template = $4, public = $5, updated_at = CURRENT_TIMESTAMP
+		     WHERE id = $1 AND user_id = $2
+		     RETURNING *
+		 )
+		 SELECT `+promptPresetColumns+` FROM p JOIN users u ON u.id = p.user_id`,
+		preset.ID, preset.UserID, preset.Name, preset.Template, preset.Public,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PromptPreset{}, errors.New("prompt preset not found")
+		}
+		return PromptPreset{}, fmt.Errorf("failed to update prompt preset: %v", err)
+	}
+	return updated, nil
+}
+
+func (s *PostgresStore) DeletePromptPreset(ctx context.Context, id int, userId string, asAdmin bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM prompt_presets WHERE id = $1 AND (user_id = $2 OR $3)",
+		id, userId, asAdmin,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete prompt preset: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("prompt preset not found")
+	}
+
+	log.Printf("[DB] Prompt preset %d deleted by %s", id, userId)
+	return nil
+}
+
+func (s *PostgresStore) GetPromptPreset(ctx context.Context, id int, userId string) (PromptPreset, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	preset, err := scanPromptPreset(s.conn(ctx).QueryRowContext(ctx,
+		`SELECT `+promptPresetColumns+` FROM prompt_presets p JOIN users u ON u.id = p.user_id
+		 WHERE p.id = $1 AND (p.user_id = $2 OR p.public)`,
+		id, userId,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PromptPreset{}, errors.New("prompt preset not found")
+		}
+		return PromptPreset{}, fmt.Errorf("database error: %v", err)
+	}
+	return preset, nil
+}
+
+func (s *PostgresStore) ListPromptPresets(ctx context.Context, userId string, limit, offset int) ([]PromptPreset, int, error) {
+	return s.listPromptPresets(ctx, "p.user_id = $1", []any{userId}, limit, offset)
+}
+
+func (s *PostgresStore) ListPublicPromptPresets(ctx context.Context, limit, offset int) ([]PromptPreset, int, error) {
+	return s.listPromptPresets(ctx, "p.public", nil, limit, offset)
+}
+
+// listPromptPresets returns a page of the presets matching condition, newest first, and how many
+// match. The page bounds are appended to args.
+func (s *PostgresStore) listPromptPresets(ctx context.Context, condition string, args []any, limit, offset int) ([]PromptPreset, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM prompt_presets p WHERE "+condition, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT `+promptPresetColumns+` FROM prompt_presets p JOIN users u ON u.id = p.user_id
+		 WHERE `+condition+`
+		 ORDER BY p.created_at DESC, p.id DESC
+		 `+fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2),
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	presets := []PromptPreset{}
+	for rows.Next() {
+		preset, err := scanPromptPreset(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		presets = append(presets, preset)
+	}
+	return presets, total, rows.Err()
+}
+
+// collectionColumns are the columns scanCollection reads, in order, from collections c joined
+// with users u
+const collectionColumns = `c.id, c.user_id, COALESCE(u.username, ''), c.title, c.description, c.public,
+	COALESCE((SELECT array_agg(ca.animation_id ORDER BY ca.position) FROM collection_animations ca WHERE ca.collection_id = c.id), '{}'),
+	c.created_at, c.updated_at`
+
+// scanCollection reads the collectionColumns of a row
+func scanCollection(row interface{ Scan(...any) error }) (Collection, error) {
+	var collection Collection
+	err := row.Scan(&collection.ID, &collection.UserID, &collection.Username, &collection.Title, &collection.Description,
+		&collection.Public, pq.Array(&collection.AnimationIDs), &collection.CreatedAt, &collection.UpdatedAt)
+	return collection, err
+}
+
+// replaceCollectionAnimations makes ids the animations of a collection, in order, keeping when the
+// ones it already held were added
+func replaceCollectionAnimations(ctx context.Context, tx *sql.Tx, id int, ids []string) error {
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM collection_animations WHERE collection_id = $1 AND NOT (animation_id = ANY($2))",
+		id, pq.Array(ids),
+	); err != nil {
+		return fmt.Errorf("failed to remove collection animations: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO collection_animations (collection_id, animation_id, position)
+		 SELECT $1, ids.id, ids.n - 1 FROM unnest($2::varchar[]) WITH ORDINALITY AS ids(id, n)
+		 ON CONFLICT (collection_id, animation_id) DO UPDATE SET position = EXCLUDED.position`,
+		id, pq.Array(ids),
+	); err != nil {
+		return fmt.Errorf("failed to save collection animations: %v", err)
+	}
+	return nil
+}
+
+// getCollection reads a collection in tx, after it was written
+func getCollection(ctx context.Context, tx *sql.Tx, id int) (Collection, error) {
+	collection, err := scanCollection(tx.QueryRowContext(ctx,
+		`SELECT `+collectionColumns+` FROM collections c JOIN users u ON u.id = c.user_id WHERE c.id = $1`, id,
+	))
+	if err != nil {
+		return Collection{}, fmt.Errorf("database error: %v", err)
+	}
+	return collection, nil
+}
+
+func (s *PostgresStore) CreateCollection(ctx context.Context, collection Collection) (Collection, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return Collection{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO collections (user_id, title, description, public) VALUES ($1, $2, $3, $4) RETURNING id",
+		collection.UserID, collection.Title, collection.Description, collection.Public,
+	).Scan(&id)
+	if err != nil {
+		return Collection{}, fmt.Errorf("failed to save collection: %v", err)
+	}
+	if err := replaceCollectionAnimations(ctx, tx, id, collection.AnimationIDs); err != nil {
+		return Collection{}, err
+	}
+	created, err := getCollection(ctx, tx, id)
+	if err != nil {
+		return Collection{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Collection{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Collection %d saved by %s", id, collection.UserID)
+	return created, nil
+}
+
+func (s *PostgresStore) UpdateCollection(ctx context.Context, collection Collection) (Collection, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return Collection{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE collections SET title = $3, description = $4, public = $5, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND user_id = $2`,
+		collection.ID, collection.UserID, collection.Title, collection.Description, collection.Public,
+	)
+	if err != nil {
+		return Collection{}, fmt.Errorf("failed to update collection: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return Collection{}, fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return Collection{}, errors.New("collection not found")
+	}
+	if err := replaceCollectionAnimations(ctx, tx, collection.ID, collection.AnimationIDs); err != nil {
+		return Collection{}, err
+	}
+	updated, err := getCollection(ctx, tx, collection.ID)
+	if err != nil {
+		return Collection{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Collection{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+func (s *PostgresStore) DeleteCollection(ctx context.Context, id int, userId string, asAdmin bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM collections WHERE id = $1 AND (user_id = $2 OR $3)",
+		id, userId, asAdmin,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("collection not found")
+	}
+
+	log.Printf("[DB] Collection %d deleted by %s", id, userId)
+	return nil
+}
+
+func (s *PostgresStore) GetCollection(ctx context.Context, id int, userId string) (Collection, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	collection, err := scanCollection(s.conn(ctx).QueryRowContext(ctx,
+		`SELECT `+collectionColumns+` FROM collections c JOIN users u ON u.id = c.user_id
+		 WHERE c.id = $1 AND (c.user_id = $2 OR c.public)`,
+		id, userId,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Collection{}, errors.New("collection not found")
+		}
+		return Collection{}, fmt.Errorf("database error: %v", err)
+	}
+	return collection, nil
+}
+
+func (s *PostgresStore) ListCollections(ctx context.Context, userId string, limit, offset int) ([]Collection, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var total int
+	if err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM collections WHERE user_id = $1", userId).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT `+collectionColumns+` FROM collections c JOIN users u ON u.id = c.user_id
+		 WHERE c.user_id = $1
+		 ORDER BY c.created_at DESC, c.id DESC
+		 LIMIT $2 OFFSET $3`,
+		userId, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		collections = append(collections, collection)
+	}
+	return collections, total, rows.Err()
+}
+
+func (s *PostgresStore) ListCollectionAnimations(ctx context.Context, id, limit, offset int) ([]CollectionAnimation, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM collection_animations ca JOIN animations a ON a.id = ca.animation_id
+		 WHERE ca.collection_id = $1 AND a.removed_at IS NULL`,
+		id,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, a.description, ca.added_at
+		 FROM collection_animations ca JOIN animations a ON a.id = ca.animation_id
+		 WHERE ca.collection_id = $1 AND a.removed_at IS NULL
+		 ORDER BY ca.position
+		 LIMIT $2 OFFSET $3`,
+		id, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := []CollectionAnimation{}
+	for rows.Next() {
+		var animation CollectionAnimation
+		if err := rows.Scan(&animation.ID, &animation.Description, &animation.AddedAt); err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, total, rows.Err()
+}
+
+func (s *PostgresStore) SetOrganizationReviewRequired(ctx context.Context, id int, required bool) (Organization, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "UPDATE organizations SET review_required = $2 WHERE id = $1", id, required)
+	if err != nil {
+		return Organization{}, fmt.Errorf("failed to set organization review: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return Organization{}, fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return Organization{}, errors.New("organization not found")
+	}
+
+	log.Printf("[DB] Organization %d review required: %t", id, required)
+	return s.GetOrganization(ctx, id)
+}
+
+// animationReviewColumns are the columns scanAnimationReview reads, in order, from
+// animation_reviews r joined with animations a and users u
+const animationReviewColumns = `r.animation_id, r.organization_id, r.author_id, COALESCE(u.username, ''),
+	COALESCE(a.description, ''), r.status, r.note, r.submitted_at, COALESCE(r.reviewed_by, ''), r.reviewed_at`
+
+const animationReviewTables = `animation_reviews r JOIN animations a ON a.id = r.animation_id LEFT JOIN users u ON u.id = r.author_id`
+
+// scanAnimationReview reads a row selected with animationReviewColumns
+func scanAnimationReview(row interface{ Scan(...any) error }) (AnimationReview, error) {
+	var review AnimationReview
+	var reviewedAt sql.NullTime
+	err := row.Scan(&review.AnimationID, &review.OrganizationID, &review.AuthorID, &review.AuthorUsername,
+		&review.Description, &review.Status, &review.Note, &review.SubmittedAt, &review.ReviewedBy, &reviewedAt)
+	if reviewedAt.Valid {
+		review.ReviewedAt = &reviewedAt.Time
+	}
+	return review, err
+}
+
+func (s *PostgresStore) GetAnimationReview(ctx context.Context, animationId string) (AnimationReview, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	review, err := scanAnimationReview(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+animationReviewColumns+" FROM "+animationReviewTables+" WHERE r.animation_id = $1",
+		animationId,
+	))
+	if err == sql.ErrNoRows {
+		return AnimationReview{}, errors.New("animation review not found")
+	}
+	if err != nil {
+		return AnimationReview{}, fmt.Errorf("database error: %v", err)
+	}
+	return review, nil
+}
+
+func (s *PostgresStore) ListAnimationReviews(ctx context.Context, filter AnimationReviewFilter, limit, offset int) ([]AnimationReview, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// Zero fields of the filter match every review
+	where := `($1 = 0 OR r.organization_id = $1) AND ($2 = '' OR r.author_id = $2) AND ($3 = '' OR r.status = $3)`
+	var total int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM animation_reviews r WHERE "+where,
+		filter.OrganizationID, filter.AuthorID, filter.Status,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+animationReviewColumns+" FROM "+animationReviewTables+" WHERE "+where+
+			" ORDER BY r.submitted_at, r.animation_id LIMIT $4 OFFSET $5",
+		filter.OrganizationID, filter.AuthorID, filter.Status, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	reviews := []AnimationReview{}
+	for rows.Next() {
+		review, err := scanAnimationReview(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("database error: %v", err)
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, total, rows.Err()
+}
+
+func (s *PostgresStore) DecideAnimationReview(ctx context.Context, animationId, status, reviewerId, note string) (AnimationReview, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return AnimationReview{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM animation_reviews WHERE animation_id = $1 FOR UPDATE", animationId).Scan(&current)
+	if err == sql.ErrNoRows {
+		return AnimationReview{}, errors.New("animation review not found")
+	}
+	if err != nil {
+		return AnimationReview{}, fmt.Errorf("database error: %v", err)
+	}
+	if current != ReviewPending {
+		return AnimationReview{}, errors.New("animation review already decided")
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE animation_reviews SET status = $2, note = $3, reviewed_by = $4, reviewed_at = NOW() WHERE animation_id = $1",
+		animationId, status, note, reviewerId,
+	)
+	if err != nil {
+		return AnimationReview{}, fmt.Errorf("failed to decide animation review: %v", err)
+	}
+	reason := note
+	if reason == "" {
+		reason = "Workspace review"
+	}
+	if err = recordModerationAudit(ctx, tx, moderationEntry(ctx, animationId, ModerationReview, ReviewPending, status, reason)); err != nil {
+		return AnimationReview{}, err
+	}
+	// Approved animations join the search index
+	if err = recordSearchEvent(ctx, tx, animationId, SearchEventUpdate); err != nil {
+		return AnimationReview{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return AnimationReview{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Animation %s review %s by %s", animationId, status, reviewerId)
+	return s.GetAnimationReview(ctx, animationId)
+}
+
+// organizationMemberColumns are the columns scanOrganizationMember reads, in order, from
+// organization_members m joined with users u
+const organizationMemberColumns = `m.user_id, COALESCE(u.username, ''), m.role, m.monthly_limit, m.joined_at`
+
+// scanOrganizationMember reads the organizationMemberColumns of a row
+func scanOrganizationMember(row interface{ Scan(...any) error }) (OrganizationMember, error) {
+	var member OrganizationMember
+	err := row.Scan(&member.UserID, &member.Username, &member.Role, &member.MonthlyLimit, &member.JoinedAt)
+	return member, err
+}
+
+func (s *PostgresStore) CreateOrganization(ctx context.Context, name, ownerId string) (Organization, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return Organization{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO organizations (name, owner_id) VALUES ($1, $2) RETURNING id",
+		name, ownerId,
+	).Scan(&id)
+	if err != nil {
+		return Organization{}, fmt.Errorf("failed to create organization: %v", err)
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id) DO NOTHING`,
+		id, ownerId, OrgRoleOwner,
+	)
+	if err != nil {
+		return Organization{}, fmt.Errorf("failed to add organization owner: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return Organization{}, fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return Organization{}, errors.New("already in an organization")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Organization{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Organization %d created by %s", id, ownerId)
+	return s.GetOrganization(ctx, id)
+}
+
+func (s *PostgresStore) GetOrganization(ctx context.Context, id int) (Organization, error) {
+	return s.getOrganization(ctx, "o.id = $1", id)
+}
+
+func (s *PostgresStore) GetUserOrganization(ctx context.Context, userId string) (Organization, error) {
+	return s.getOrganization(ctx, "o.id = (SELECT organization_id FROM organization_members WHERE user_id = $1)", userId)
+}
+
+// getOrganization returns the workspace matching condition with its members, the owner first
+func (s *PostgresStore) getOrganization(ctx context.Context, condition string, arg any) (Organization, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var org Organization
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT o.id, o.name, o.owner_id, o.monthly_credits, o.review_required, o.created_at FROM organizations o WHERE "+condition,
+		arg,
+	).Scan(&org.ID, &org.Name, &org.OwnerID, &org.MonthlyCredits, &org.ReviewRequired, &org.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Organization{}, errors.New("organization not found")
+	}
+	if err != nil {
+		return Organization{}, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT `+organizationMemberColumns+` FROM organization_members m JOIN users u ON u.id = m.user_id
+		 WHERE m.organization_id = $1
+		 ORDER BY m.role = $2 DESC, m.joined_at, m.user_id`,
+		org.ID, OrgRoleOwner,
+	)
+	if err != nil {
+		return Organization{}, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member, err := scanOrganizationMember(rows)
+		if err != nil {
+			return Organization{}, fmt.Errorf("database error: %v", err)
+		}
+		org.Members = append(org.Members, member)
+	}
+	return org, rows.Err()
+}
+
+func (s *PostgresStore) DeleteOrganization(ctx context.Context, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM organizations WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("organization not found")
+	}
+
+	log.Printf("[DB] Organization %d deleted", id)
+	return nil
+}
+
+func (s *PostgresStore) SetOrganizationCredits(ctx context.Context, id, monthlyCredits int) (Organization, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE organizations SET monthly_credits = $2 WHERE id = $1",
+		id, monthlyCredits,
+	)
+	if err != nil {
+		return Organization{}, fmt.Errorf("failed to set organization credits: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return Organization{}, fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return Organization{}, errors.New("organization not found")
+	}
+
+	log.Printf("[DB] Organization %d now has %d monthly credits", id, monthlyCredits)
+	return s.GetOrganization(ctx, id)
+}
+
+func (s *PostgresStore) AddOrganizationMember(ctx context.Context, id int, userId string, monthlyLimit int) (OrganizationMember, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	member, err := scanOrganizationMember(s.conn(ctx).QueryRowContext(ctx,
+		`WITH m AS (
+		     INSERT INTO organization_members (organization_id, user_id, role, monthly_limit)
+		     SELECT id, $2, $3, $4 FROM organizations WHERE id = $1
+		     ON CONFLICT (user_id) DO NOTHING
+		     RETURNING *
+		 )
+		 SELECT `+organizationMemberColumns+` FROM m JOIN users u ON u.id = m.user_id`,
+		id, userId, OrgRoleMember, monthlyLimit,
+	))
+	if err == sql.ErrNoRows {
+		// Nothing was added because the workspace is gone or the user is already in one
+		if _, err := s.GetOrganization(ctx, id); err != nil {
+			return OrganizationMember{}, err
+		}
+		return OrganizationMember{}, errors.New("already in an organization")
+	}
+	if err != nil {
+		return OrganizationMember{}, fmt.Errorf("failed to add organization member: %v", err)
+	}
+
+	log.Printf("[DB] User %s joined organization %d", userId, id)
+	return member, nil
+}
+
+func (s *PostgresStore) SetOrganizationMemberLimit(ctx context.Context, id int, userId string, monthlyLimit int) (OrganizationMember, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	member, err := scanOrganizationMember(s.conn(ctx).QueryRowContext(ctx,
+		`WITH m AS (
+		     UPDATE organization_members SET monthly_limit = $3
+		     WHERE organization_id = $1 AND user_id = $2
+		     RETURNING *
+		 )
+		 SELECT `+organizationMemberColumns+` FROM m JOIN users u ON u.id = m.user_id`,
+		id, userId, monthlyLimit,
+	))
+	if err == sql.ErrNoRows {
+		return OrganizationMember{}, errors.New("organization member not found")
+	}
+	if err != nil {
+		return OrganizationMember{}, fmt.Errorf("failed to set organization member limit: %v", err)
+	}
+	return member, nil
+}
+
+func (s *PostgresStore) RemoveOrganizationMember(ctx context.Context, id int, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2",
+		id, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove organization member: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("organization member not found")
+	}
+
+	log.Printf("[DB] User %s left organization %d", userId, id)
+	return nil
+}
+
+func (s *PostgresStore) ReserveOrganizationGeneration(ctx context.Context, id int, userId string) (GenerationQuota, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the workspace serializes concurrent reservations against its credits
+	var credits, memberLimit int
+	err = tx.QueryRowContext(ctx,
+		`SELECT o.monthly_credits, m.monthly_limit FROM organizations o
+		 JOIN organization_members m ON m.organization_id = o.id AND m.user_id = $2
+		 WHERE o.id = $1
+		 FOR UPDATE OF o`,
+		id, userId,
+	).Scan(&credits, &memberLimit)
+	if err == sql.ErrNoRows {
+		return GenerationQuota{}, errors.New("organization member not found")
+	}
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("database error: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organization_usage (organization_id, user_id, usage_date, generation_count)
+		 VALUES ($1, $2, CURRENT_DATE, 1)
+		 ON CONFLICT (organization_id, usage_date, user_id)
+		 DO UPDATE SET generation_count = organization_usage.generation_count + 1`,
+		id, userId,
+	)
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("failed to record organization usage: %w", err)
+	}
+
+	var used, memberUsed int
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(generation_count), 0), COALESCE(SUM(generation_count) FILTER (WHERE user_id = $2), 0)
+		 FROM organization_usage
+		 WHERE organization_id = $1 AND usage_date >= date_trunc('month', CURRENT_DATE)`,
+		id, userId,
+	).Scan(&used, &memberUsed)
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("database error: %v", err)
+	}
+
+	quota, err := checkOrganizationReservation(credits, used, memberLimit, memberUsed)
+	if err != nil {
+		return quota, err
+	}
+	if err = tx.Commit(); err != nil {
+		return GenerationQuota{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return quota, nil
+}
+
+func (s *PostgresStore) ReleaseOrganizationGeneration(ctx context.Context, id int, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE organization_usage SET generation_count = generation_count - 1
+		 WHERE organization_id = $1 AND user_id = $2 AND usage_date = CURRENT_DATE AND generation_count > 0`,
+		id, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release organization usage: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetOrganizationUsage(ctx context.Context, id int, month time.Time) (OrganizationUsage, error) {
+	org, err := s.GetOrganization(ctx, id)
+	if err != nil {
+		return OrganizationUsage{}, err
+	}
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT user_id, SUM(generation_count) FROM organization_usage
+		 WHERE organization_id = $1 AND usage_date >= $2 AND usage_date < $3
+		 GROUP BY user_id`,
+		id, month, month.AddDate(0, 1, 0),
+	)
+	if err != nil {
+		return OrganizationUsage{}, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	used, usedBy := 0, map[string]int{}
+	for rows.Next() {
+		var userId string
+		var count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return OrganizationUsage{}, fmt.Errorf("database error: %v", err)
+		}
+		used += count
+		usedBy[userId] = count
+	}
+	if err := rows.Err(); err != nil {
+		return OrganizationUsage{}, fmt.Errorf("database error: %v", err)
+	}
+	return newOrganizationUsage(org, month, used, usedBy), nil
+}
+
+// signageScheduleColumns are the columns scanSignageSchedule reads, in order, from signage_schedules
+const signageScheduleColumns = `id, user_id, name, timezone, slots, COALESCE(fallback_animation_id, ''), created_at, updated_at`
+
+// scanSignageSchedule reads the signageScheduleColumns of a row
+func scanSignageSchedule(row interface{ Scan(...any) error }) (SignageSchedule, error) {
+	var schedule SignageSchedule
+	var slots []byte
+	err := row.Scan(&schedule.ID, &schedule.UserID, &schedule.Name, &schedule.Timezone, &slots,
+		&schedule.FallbackAnimationID, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return SignageSchedule{}, err
+	}
+	if err := json.Unmarshal(slots, &schedule.Slots); err != nil {
+		return SignageSchedule{}, fmt.Errorf("invalid signage slots: %v", err)
+	}
+	return schedule, nil
+}
+
+func (s *PostgresStore) CreateSignageSchedule(ctx context.Context, schedule SignageSchedule) (SignageSchedule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	id, err := generateRandomID()
+	if err != nil {
+		return SignageSchedule{}, fmt.Errorf("failed to generate signage schedule ID: %v", err)
+	}
+	slots, err := json.Marshal(schedule.Slots)
+	if err != nil {
+		return SignageSchedule{}, fmt.Errorf("failed to encode signage slots: %v", err)
+	}
+
+	created, err := scanSignageSchedule(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO signage_schedules (id, user_id, name, timezone, slots, fallback_animation_id)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		 RETURNING `+signageScheduleColumns,
+		id, schedule.UserID, schedule.Name, schedule.Timezone, slots, schedule.FallbackAnimationID,
+	))
+	if err != nil {
+		return SignageSchedule{}, fmt.Errorf("failed to save signage schedule: %v", err)
+	}
+
+	log.Printf("[DB] Signage schedule %s saved by %s", created.ID, schedule.UserID)
+	return created, nil
+}
+
+func (s *PostgresStore) UpdateSignageSchedule(ctx context.Context, schedule SignageSchedule) (SignageSchedule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	slots, err := json.Marshal(schedule.Slots)
+	if err != nil {
+		return SignageSchedule{}, fmt.Errorf("failed to encode signage slots: %v", err)
+	}
+
+	updated, err := scanSignageSchedule(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE signage_schedules
+		 SET name = $3, timezone = $4, slots = $5, fallback_animation_id = NULLIF($6, ''), updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND user_id = $2
+		 RETURNING `+signageScheduleColumns,
+		schedule.ID, schedule.UserID, schedule.Name, schedule.Timezone, slots, schedule.FallbackAnimationID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SignageSchedule{}, errors.New("signage schedule not found")
+		}
+		return SignageSchedule{}, fmt.Errorf("failed to update signage schedule: %v", err)
+	}
+	return updated, nil
+}
+
+func (s *PostgresStore) DeleteSignageSchedule(ctx context.Context, id, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM signage_schedules WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete signage schedule: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("signage schedule not found")
+	}
+
+	log.Printf("[DB] Signage schedule %s deleted by %s", id, userId)
+	return nil
+}
+
+func (s *PostgresStore) GetSignageSchedule(ctx context.Context, id string) (SignageSchedule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	schedule, err := scanSignageSchedule(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+signageScheduleColumns+" FROM signage_schedules WHERE id = $1", id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SignageSchedule{}, errors.New("signage schedule not found")
+		}
+		return SignageSchedule{}, fmt.Errorf("database error: %v", err)
+	}
+	return schedule, nil
+}
+
+func (s *PostgresStore) ListSignageSchedules(ctx context.Context, userId string) ([]SignageSchedule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+signageScheduleColumns+" FROM signage_schedules WHERE user_id = $1 ORDER BY created_at DESC, id",
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	schedules := []SignageSchedule{}
+	for rows.Next() {
+		schedule, err := scanSignageSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// kioskTokenColumns are the columns scanKioskToken reads, in order, from kiosk_tokens
+const kioskTokenColumns = `id, name, schedule_ids, feed, created_by, created_at, expires_at, last_used_at`
+
+// scanKioskToken reads the kioskTokenColumns of a row
+func scanKioskToken(row interface{ Scan(...any) error }) (KioskToken, error) {
+	var token KioskToken
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.Name, pq.Array(&token.ScheduleIDs), &token.Feed, &token.CreatedBy,
+		&token.CreatedAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		return KioskToken{}, err
+	}
+	if token.ScheduleIDs == nil {
+		token.ScheduleIDs = []string{}
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, nil
+}
+
+func (s *PostgresStore) CreateKioskToken(ctx context.Context, token KioskToken, tokenHash string) (KioskToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	created, err := scanKioskToken(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO kiosk_tokens (token_hash, name, schedule_ids, feed, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+kioskTokenColumns,
+		tokenHash, token.Name, pq.Array(token.ScheduleIDs), token.Feed, token.CreatedBy, token.ExpiresAt,
+	))
+	if err != nil {
+		return KioskToken{}, fmt.Errorf("failed to save kiosk token: %v", err)
+	}
+
+	log.Printf("[DB] Kiosk token %d issued by %s", created.ID, token.CreatedBy)
+	return created, nil
+}
+
+func (s *PostgresStore) ListKioskTokens(ctx context.Context) ([]KioskToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+kioskTokenColumns+" FROM kiosk_tokens ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := []KioskToken{}
+	for rows.Next() {
+		token, err := scanKioskToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *PostgresStore) GetKioskTokenByHash(ctx context.Context, tokenHash string) (KioskToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	token, err := scanKioskToken(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+kioskTokenColumns+" FROM kiosk_tokens WHERE token_hash = $1", tokenHash,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return KioskToken{}, errors.New("kiosk token not found")
+		}
+		return KioskToken{}, fmt.Errorf("database error: %v", err)
+	}
+	return token, nil
+}
+
+func (s *PostgresStore) UpdateKioskToken(ctx context.Context, token KioskToken) (KioskToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	updated, err := scanKioskToken(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE kiosk_tokens SET name = $2, schedule_ids = $3, feed = $4
+		 WHERE id = $1
+		 RETURNING `+kioskTokenColumns,
+		token.ID, token.Name, pq.Array(token.ScheduleIDs), token.Feed,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return KioskToken{}, errors.New("kiosk token not found")
+		}
+		return KioskToken{}, fmt.Errorf("failed to update kiosk token: %v", err)
+	}
+	return updated, nil
+}
+
+func (s *PostgresStore) RevokeKioskToken(ctx context.Context, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM kiosk_tokens WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke kiosk token: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("kiosk token not found")
+	}
+
+	log.Printf("[DB] Kiosk token %d revoked", id)
+	return nil
+}
+
+func (s *PostgresStore) TouchKioskToken(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "UPDATE kiosk_tokens SET last_used_at = $2 WHERE id = $1", id, at); err != nil {
+		return fmt.Errorf("failed to record kiosk token use: %v", err)
+	}
+	return nil
+}
+
+// impersonationColumns are the columns scanImpersonation reads, in order, from impersonations
+const impersonationColumns = `id, admin_id, user_id, reason, minutes, consent_required, status, created_at, decided_at, started_at, expires_at, ended_at`
+
+// scanImpersonation reads the impersonationColumns of a row
+func scanImpersonation(row interface{ Scan(...any) error }) (Impersonation, error) {
+	var impersonation Impersonation
+	var decidedAt, startedAt, expiresAt, endedAt sql.NullTime
+	err := row.Scan(&impersonation.ID, &impersonation.AdminID, &impersonation.UserID, &impersonation.Reason,
+		&impersonation.Minutes, &impersonation.ConsentRequired, &impersonation.Status, &impersonation.CreatedAt,
+		&decidedAt, &startedAt, &expiresAt, &endedAt)
+	if err != nil {
+		return Impersonation{}, err
+	}
+	if decidedAt.Valid {
+		impersonation.DecidedAt = &decidedAt.Time
+	}
+	if startedAt.Valid {
+		impersonation.StartedAt = &startedAt.Time
+	}
+	if expiresAt.Valid {
+		impersonation.ExpiresAt = &expiresAt.Time
+	}
+	if endedAt.Valid {
+		impersonation.EndedAt = &endedAt.Time
+	}
+	return impersonation, nil
+}
+
+func (s *PostgresStore) CreateImpersonation(ctx context.Context, impersonation Impersonation) (Impersonation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	created, err := scanImpersonation(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO impersonations (admin_id, user_id, reason, minutes, consent_required, status)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+impersonationColumns,
+		impersonation.AdminID, impersonation.UserID, impersonation.Reason, impersonation.Minutes,
+		impersonation.ConsentRequired, impersonation.Status,
+	))
+	if err != nil {
+		return Impersonation{}, fmt.Errorf("failed to save impersonation: %v", err)
+	}
+
+	log.Printf("[DB] Impersonation %d of user %s requested by %s", created.ID, created.UserID, created.AdminID)
+	return created, nil
+}
+
+func (s *PostgresStore) GetImpersonation(ctx context.Context, id int) (Impersonation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	impersonation, err := scanImpersonation(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+impersonationColumns+" FROM impersonations WHERE id = $1", id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Impersonation{}, errors.New("impersonation not found")
+		}
+		return Impersonation{}, fmt.Errorf("database error: %v", err)
+	}
+	return impersonation, nil
+}
+
+func (s *PostgresStore) GetImpersonationByTokenHash(ctx context.Context, tokenHash string) (Impersonation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	impersonation, err := scanImpersonation(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+impersonationColumns+" FROM impersonations WHERE token_hash = $1", tokenHash,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Impersonation{}, errors.New("impersonation not found")
+		}
+		return Impersonation{}, fmt.Errorf("database error: %v", err)
+	}
+	return impersonation, nil
+}
+
+func (s *PostgresStore) ListImpersonations(ctx context.Context, userId string, limit int) ([]Impersonation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+impersonationColumns+" FROM impersonations WHERE $1 = '' OR user_id = $1 ORDER BY id DESC LIMIT $2",
+		userId, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	impersonations := []Impersonation{}
+	for rows.Next() {
+		impersonation, err := scanImpersonation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	return impersonations, rows.Err()
+}
+
+// impersonationStatusChanged tells a transition that matched no row apart from a missing impersonation
+func (s *PostgresStore) impersonationStatusChanged(ctx context.Context, id int) error {
+	if _, err := s.GetImpersonation(ctx, id); err != nil {
+		return err
+	}
+	return errors.New("impersonation status changed")
+}
+
+func (s *PostgresStore) TransitionImpersonation(ctx context.Context, id int, from []string, status string) (Impersonation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	impersonation, err := scanImpersonation(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE impersonations SET status = $3,
+		     decided_at = CASE WHEN $3 IN ('approved', 'denied') THEN CURRENT_TIMESTAMP ELSE decided_at END,
+		     ended_at = CASE WHEN $3 = 'ended' THEN CURRENT_TIMESTAMP ELSE ended_at END
+		 WHERE id = $1 AND status = ANY($2)
+		 RETURNING `+impersonationColumns,
+		id, pq.Array(from), status,
+	))
+	if err == sql.ErrNoRows {
+		return Impersonation{}, s.impersonationStatusChanged(ctx, id)
+	}
+	if err != nil {
+		return Impersonation{}, fmt.Errorf("failed to update impersonation: %v", err)
+	}
+
+	log.Printf("[DB] Impersonation %d is now %s", id, status)
+	return impersonation, nil
+}
+
+func (s *PostgresStore) StartImpersonation(ctx context.Context, id int, tokenHash string, expiresAt time.Time) (Impersonation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	impersonation, err := scanImpersonation(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE impersonations SET status = 'active', token_hash = $2, started_at = CURRENT_TIMESTAMP, expires_at = $3
+		 WHERE id = $1 AND status = 'approved'
+		 RETURNING `+impersonationColumns,
+		id, tokenHash, expiresAt,
+	))
+	if err == sql.ErrNoRows {
+		return Impersonation{}, s.impersonationStatusChanged(ctx, id)
+	}
+	if err != nil {
+		return Impersonation{}, fmt.Errorf("failed to start impersonation: %v", err)
+	}
+
+	log.Printf("[DB] Impersonation %d started until %s", id, expiresAt.Format(time.RFC3339))
+	return impersonation, nil
+}
+
+func (s *PostgresStore) RecordImpersonationAudit(ctx context.Context, entry ImpersonationAuditEntry) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO impersonation_audit (impersonation_id, actor_id, action, detail) VALUES ($1, $2, $3, $4)",
+		entry.ImpersonationID, entry.ActorID, entry.Action, entry.Detail,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record impersonation audit: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListImpersonationAudit(ctx context.Context, id int) ([]ImpersonationAuditEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT id, impersonation_id, actor_id, action, detail, created_at FROM impersonation_audit WHERE impersonation_id = $1 ORDER BY id",
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []ImpersonationAuditEntry{}
+	for rows.Next() {
+		var entry ImpersonationAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.ImpersonationID, &entry.ActorID, &entry.Action, &entry.Detail, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *PostgresStore) RecordGeneration(ctx context.Context, record GenerationRecord) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO generations (user_id, job_id, provider, model, own_key, succeeded, input_tokens, output_tokens, cost_usd)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		record.UserID, record.JobID, record.Provider, record.Model, record.OwnKey, record.Succeeded,
+		record.InputTokens, record.OutputTokens, record.CostUSD,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record generation: %v", err)
+	}
+	return nil
+}
+
+// generationCostColumns add up the generations matched by a cost query
+const generationCostColumns = `COUNT(*), COALESCE(SUM(g.input_tokens), 0), COALESCE(SUM(g.output_tokens), 0), COALESCE(SUM(g.cost_usd), 0)`
+
+// generationRange matches generations made from $1 until before $2, with NULL bounds leaving the
+// range open
+const generationRange = `($1::timestamp IS NULL OR g.created_at >= $1) AND ($2::timestamp IS NULL OR g.created_at < $2)`
+
+// timeRangeArgs turns zero times into NULL query arguments
+func timeRangeArgs(from, to time.Time) (interface{}, interface{}) {
+	var fromArg, toArg interface{}
+	if !from.IsZero() {
+		fromArg = from
+	}
+	if !to.IsZero() {
+		toArg = to
+	}
+	return fromArg, toArg
+}
+
+func (s *PostgresStore) GetGenerationCosts(ctx context.Context, from, to time.Time, userId string) (GenerationCosts, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	fromArg, toArg := timeRangeArgs(from, to)
+	var costs GenerationCosts
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+generationCostColumns+" FROM generations g WHERE "+generationRange+" AND ($3 = '' OR g.user_id = $3)",
+		fromArg, toArg, userId,
+	).Scan(&costs.Generations, &costs.InputTokens, &costs.OutputTokens, &costs.CostUSD)
+	if err != nil {
+		return GenerationCosts{}, fmt.Errorf("database error: %v", err)
+	}
+	return costs, nil
+}
+
+func (s *PostgresStore) ListUserGenerationCosts(ctx context.Context, from, to time.Time, limit int) ([]UserGenerationCosts, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	fromArg, toArg := timeRangeArgs(from, to)
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT g.user_id, COALESCE(u.username, ''), `+generationCostColumns+`
+		 FROM generations g
+		 LEFT JOIN users u ON u.id = g.user_id
+		 WHERE `+generationRange+`
+		 GROUP BY g.user_id, u.username
+		 ORDER BY SUM(g.cost_usd) DESC, g.user_id
+		 LIMIT $3`,
+		fromArg, toArg, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	users := []UserGenerationCosts{}
+	for rows.Next() {
+		var user UserGenerationCosts
+		if err := rows.Scan(&user.UserID, &user.Username, &user.Generations, &user.InputTokens, &user.OutputTokens, &user.CostUSD); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *PostgresStore) SetCalendarFeedToken(ctx context.Context, userId, tokenHash string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO calendar_feeds (user_id, token_hash, created_at)
+		 VALUES ($1, $2, NOW())
+		 ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = NOW()`,
+		userId, tokenHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save calendar feed: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetCalendarFeedUser(ctx context.Context, tokenHash string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var userId string
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT user_id FROM calendar_feeds WHERE token_hash = $1", tokenHash).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("calendar feed not found")
+		}
+		return "", fmt.Errorf("database error: %v", err)
+	}
+	return userId, nil
+}
+
+func (s *PostgresStore) DeleteCalendarFeedToken(ctx context.Context, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM calendar_feeds WHERE user_id = $1", userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete calendar feed: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("calendar feed not found")
+	}
+	return nil
+}
+
+// teamIntegrationColumns are the columns scanTeamIntegration reads, in order, from team_integrations
+const teamIntegrationColumns = `id, organization_id, platform, webhook_url, secret, post_time, timezone, next_post_at, created_by, created_at`
+
+// scanTeamIntegration reads the teamIntegrationColumns of a row
+func scanTeamIntegration(row interface{ Scan(...any) error }) (TeamIntegration, error) {
+	var integration TeamIntegration
+	var nextPostAt sql.NullTime
+	err := row.Scan(&integration.ID, &integration.OrganizationID, &integration.Platform, &integration.WebhookURL,
+		&integration.Secret, &integration.PostTime, &integration.Timezone, &nextPostAt, &integration.CreatedBy, &integration.CreatedAt)
+	if err != nil {
+		return TeamIntegration{}, err
+	}
+	if nextPostAt.Valid {
+		integration.NextPostAt = &nextPostAt.Time
+	}
+	return integration, nil
+}
+
+func (s *PostgresStore) SaveTeamIntegration(ctx context.Context, integration TeamIntegration) (TeamIntegration, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var nextAt time.Time
+	if integration.NextPostAt != nil {
+		nextAt = *integration.NextPostAt
+	}
+	saved, err := scanTeamIntegration(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO team_integrations (id, organization_id, platform, webhook_url, secret, post_time, timezone, next_post_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, `+reminderDueAt(8)+`, $9)
+		 ON CONFLICT (organization_id, platform) DO UPDATE SET
+			webhook_url = EXCLUDED.webhook_url, secret = EXCLUDED.secret, post_time = EXCLUDED.post_time,
+			timezone = EXCLUDED.timezone, next_post_at = EXCLUDED.next_post_at
+		 RETURNING `+teamIntegrationColumns,
+		integration.ID, integration.OrganizationID, integration.Platform, integration.WebhookURL, integration.Secret,
+		integration.PostTime, integration.Timezone, reminderDelaySeconds(nextAt), integration.CreatedBy,
+	))
+	if err != nil {
+		return TeamIntegration{}, fmt.Errorf("failed to save team integration: %v", err)
+	}
+	return saved, nil
+}
+
+func (s *PostgresStore) GetTeamIntegration(ctx context.Context, organizationId int, platform string) (TeamIntegration, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	integration, err := scanTeamIntegration(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+teamIntegrationColumns+" FROM team_integrations WHERE organization_id = $1 AND platform = $2",
+		organizationId, platform,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TeamIntegration{}, errors.New("team integration not found")
+		}
+		return TeamIntegration{}, fmt.Errorf("database error: %v", err)
+	}
+	return integration, nil
+}
+
+func (s *PostgresStore) GetTeamIntegrationByID(ctx context.Context, id string) (TeamIntegration, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	integration, err := scanTeamIntegration(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+teamIntegrationColumns+" FROM team_integrations WHERE id = $1", id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TeamIntegration{}, errors.New("team integration not found")
+		}
+		return TeamIntegration{}, fmt.Errorf("database error: %v", err)
+	}
+	return integration, nil
+}
+
+func (s *PostgresStore) DeleteTeamIntegration(ctx context.Context, organizationId int, platform string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM team_integrations WHERE organization_id = $1 AND platform = $2", organizationId, platform)
+	if err != nil {
+		return fmt.Errorf("failed to delete team integration: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("team integration not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ClaimDueTeamIntegrations(ctx context.Context, limit int) ([]TeamIntegration, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`UPDATE team_integrations SET next_post_at = NOW() + INTERVAL '5 minutes'
+		 WHERE id IN (
+			SELECT id FROM team_integrations WHERE next_post_at <= NOW()
+			ORDER BY next_post_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+teamIntegrationColumns,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var due []TeamIntegration
+	for rows.Next() {
+		integration, err := scanTeamIntegration(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		due = append(due, integration)
+	}
+	return due, rows.Err()
+}
+
+func (s *PostgresStore) SetNextTeamPost(ctx context.Context, id string, nextAt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"UPDATE team_integrations SET next_post_at = "+reminderDueAt(2)+" WHERE id = $1",
+		id, reminderDelaySeconds(nextAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule team post: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) RecordTeamPost(ctx context.Context, post TeamPost) (TeamPost, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO team_posts (integration_id, animation_id, message_id)
+		 VALUES ($1, $2, NULLIF($3, ''))
+		 RETURNING id, posted_at`,
+		post.IntegrationID, post.AnimationID, post.MessageID,
+	).Scan(&post.ID, &post.PostedAt)
+	if err != nil {
+		return TeamPost{}, fmt.Errorf("failed to record team post: %v", err)
+	}
+	post.Counts = nil
+	return post, nil
+}
+
+func (s *PostgresStore) FindTeamPost(ctx context.Context, integrationId, messageId string, at time.Time, window time.Duration) (TeamPost, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	post := TeamPost{IntegrationID: integrationId}
+	var storedMessageId sql.NullString
+	var err error
+	if messageId != "" {
+		err = s.conn(ctx).QueryRowContext(ctx,
+			"SELECT id, animation_id, message_id, posted_at FROM team_posts WHERE integration_id = $1 AND message_id = $2",
+			integrationId, messageId,
+		).Scan(&post.ID, &post.AnimationID, &storedMessageId, &post.PostedAt)
+	} else {
+		// at is passed as seconds ago, since posted_at has no time zone
+		err = s.conn(ctx).QueryRowContext(ctx,
+			`SELECT id, animation_id, message_id, posted_at FROM team_posts
+			 WHERE integration_id = $1
+			   AND ABS(EXTRACT(EPOCH FROM (NOW() - $2 * INTERVAL '1 second') - posted_at)) <= $3
+			 ORDER BY ABS(EXTRACT(EPOCH FROM (NOW() - $2 * INTERVAL '1 second') - posted_at))
+			 LIMIT 1`,
+			integrationId, time.Since(at).Seconds(), window.Seconds(),
+		).Scan(&post.ID, &post.AnimationID, &storedMessageId, &post.PostedAt)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TeamPost{}, errors.New("team post not found")
+		}
+		return TeamPost{}, fmt.Errorf("database error: %v", err)
+	}
+	post.MessageID = storedMessageId.String
+	return post, nil
+}
+
+func (s *PostgresStore) SetTeamMoodSignal(ctx context.Context, postId int, reactorHash string, mood Mood) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO team_mood_signals (post_id, reactor_hash, mood)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (post_id, reactor_hash) DO UPDATE SET mood = EXCLUDED.mood, created_at = NOW()`,
+		postId, reactorHash, string(mood),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save team mood signal: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) RemoveTeamMoodSignal(ctx context.Context, postId int, reactorHash string, mood Mood) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM team_mood_signals WHERE post_id = $1 AND reactor_hash = $2 AND mood = $3",
+		postId, reactorHash, string(mood),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete team mood signal: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListTeamPosts(ctx context.Context, integrationId string, limit int) ([]TeamPost, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT p.id, p.animation_id, COALESCE(p.message_id, ''), p.posted_at, s.mood, COUNT(s.mood)
+		 FROM (
+			SELECT * FROM team_posts WHERE integration_id = $1
+			ORDER BY posted_at DESC, id DESC LIMIT $2
+		 ) p
+		 LEFT JOIN team_mood_signals s ON s.post_id = p.id
+		 GROUP BY p.id, p.animation_id, p.message_id, p.posted_at, s.mood
+		 ORDER BY p.posted_at DESC, p.id DESC`,
+		integrationId, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	posts := []TeamPost{}
+	for rows.Next() {
+		post := TeamPost{IntegrationID: integrationId}
+		var mood sql.NullString
+		var count int
+		if err := rows.Scan(&post.ID, &post.AnimationID, &post.MessageID, &post.PostedAt, &mood, &count); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if len(posts) == 0 || posts[len(posts)-1].ID != post.ID {
+			post.Counts = map[Mood]int{}
+			posts = append(posts, post)
+		}
+		if mood.Valid {
+			posts[len(posts)-1].Counts[Mood(mood.String)] = count
+		}
+	}
+	return posts, rows.Err()
+}
+
+func (s *PostgresStore) ListRefinementTurns(ctx context.Context, animationId, userId string, limit int) ([]RefinementTurn, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkAnimationOwner(ctx, animationId, userId); err != nil {
+		return nil, err
+	}
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT role, content, created_at FROM (
+			SELECT id, role, content, created_at FROM animation_refinements
+			WHERE animation_id = $1 ORDER BY id DESC LIMIT $2
+		 ) latest ORDER BY id`,
+		animationId, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	turns := []RefinementTurn{}
+	for rows.Next() {
+		var turn RefinementTurn
+		if err := rows.Scan(&turn.Role, &turn.Content, &turn.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, rows.Err()
+}
+
+func (s *PostgresStore) AddRefinementTurns(ctx context.Context, animationId string, turns []RefinementTurn) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	roles := make([]string, len(turns))
+	contents := make([]string, len(turns))
+	for i, turn := range turns {
+		roles[i], contents[i] = turn.Role, turn.Content
+	}
+	// The turns keep their order through the serial IDs unnest hands them out in
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO animation_refinements (animation_id, role, content)
+		 SELECT $1, role, content FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS t(role, content, n)
+		 ORDER BY n`,
+		animationId, pq.Array(roles), pq.Array(contents),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save refinement: %v", err)
+	}
+	return nil
+}
+
+// integrationKeyColumns are the columns scanIntegrationKey reads, in order, from integration_keys
+const integrationKeyColumns = `id, name, created_at, last_used_at`
+
+// scanIntegrationKey reads the integrationKeyColumns of a row, and any columns after them into extra
+func scanIntegrationKey(row interface{ Scan(...any) error }, extra ...any) (IntegrationKey, error) {
+	var key IntegrationKey
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(append([]any{&key.ID, &key.Name, &key.CreatedAt, &lastUsedAt}, extra...)...); err != nil {
+		return IntegrationKey{}, err
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return key, nil
+}
+
+func (s *PostgresStore) CreateIntegrationKey(ctx context.Context, userId string, key IntegrationKey, keyHash string) (IntegrationKey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	created, err := scanIntegrationKey(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO integration_keys (user_id, key_hash, name)
+		 VALUES ($1, $2, $3)
+		 RETURNING `+integrationKeyColumns,
+		userId, keyHash, key.Name,
+	))
+	if err != nil {
+		return IntegrationKey{}, fmt.Errorf("failed to save integration key: %v", err)
+	}
+
+	log.Printf("[DB] Integration key %d issued to user %s", created.ID, userId)
+	return created, nil
+}
+
+func (s *PostgresStore) ListIntegrationKeys(ctx context.Context, userId string) ([]IntegrationKey, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+integrationKeyColumns+" FROM integration_keys WHERE user_id = $1 ORDER BY created_at DESC, id DESC",
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []IntegrationKey{}
+	for rows.Next() {
+		key, err := scanIntegrationKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) GetIntegrationKeyByHash(ctx context.Context, keyHash string) (IntegrationKey, string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var userId string
+	key, err := scanIntegrationKey(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+integrationKeyColumns+", user_id FROM integration_keys WHERE key_hash = $1", keyHash,
+	), &userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return IntegrationKey{}, "", errors.New("integration key not found")
+		}
+		return IntegrationKey{}, "", fmt.Errorf("database error: %v", err)
+	}
+	return key, userId, nil
+}
+
+func (s *PostgresStore) DeleteIntegrationKey(ctx context.Context, id int, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM integration_keys WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete integration key: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("integration key not found")
+	}
+
+	log.Printf("[DB] Integration key %d deleted by user %s", id, userId)
+	return nil
+}
+
+func (s *PostgresStore) TouchIntegrationKey(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "UPDATE integration_keys SET last_used_at = $2 WHERE id = $1", id, at); err != nil {
+		return fmt.Errorf("failed to record integration key use: %v", err)
+	}
+	return nil
+}
+
+// triggerOrder is the direction trigger queries read rows in. A zero cursor reads the latest rows
+// newest first, and the caller puts them back in order.
+func triggerOrder(cursor TriggerCursor) string {
+	if cursor.At.IsZero() {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func (s *PostgresStore) ListAnimationsAfter(ctx context.Context, userId string, cursor TriggerCursor, limit int) ([]UserAnimation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// A NULL cursor time starts from the latest animations
+	after, _ := timeRangeArgs(cursor.At, time.Time{})
+	order := triggerOrder(cursor)
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, COALESCE(b.code, a.code), a.description,
+			COALESCE(a.p5_version, ''), COALESCE(l.url, ''), COALESCE(l.integrity, ''),
+			a.render_status, a.photosensitivity, a.created_at
+		 FROM animations a
+		 LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 LEFT JOIN p5_libraries l ON l.version = a.p5_version
+		 WHERE a.user_id = $1 AND a.removed_at IS NULL
+			AND ($2::timestamp IS NULL OR (a.created_at, a.id) > ($2::timestamp, $3))
+		 ORDER BY a.created_at `+order+`, a.id `+order+`
+		 LIMIT $4`,
+		userId, after, cursor.ID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := make([]UserAnimation, 0, limit)
+	for rows.Next() {
+		var animation UserAnimation
+		err := rows.Scan(&animation.ID, &animation.Code, &animation.Description,
+			&animation.P5Version, &animation.P5URL, &animation.P5Integrity,
+			&animation.RenderStatus, &animation.Photosensitivity, &animation.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	if order == "DESC" {
+		slices.Reverse(animations)
+	}
+	return animations, rows.Err()
+}
+
+func (s *PostgresStore) ListMoodsAfter(ctx context.Context, userId string, cursor TriggerCursor, limit int) ([]MoodEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	ring, err := MoodKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	// A NULL cursor time starts from the latest moods
+	after, _ := timeRangeArgs(cursor.At, time.Time{})
+	order := triggerOrder(cursor)
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT m.animation_id, COALESCE(a.description, ''), m.mood, m.mood_encrypted, m.mood_key_id, m.created_at
+		 FROM user_moods m
+		 LEFT JOIN animations a ON a.id = m.animation_id AND a.removed_at IS NULL
+		 WHERE m.user_id = $1 AND ($2::timestamp IS NULL OR (m.created_at, m.animation_id) > ($2::timestamp, $3))
+		 ORDER BY m.created_at `+order+`, m.animation_id `+order+`
+		 LIMIT $4`,
+		userId, after, cursor.ID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	moods := []MoodEntry{}
+	for rows.Next() {
+		var entry MoodEntry
+		var plain, keyId sql.NullString
+		var encrypted []byte
+		if err := rows.Scan(&entry.AnimationID, &entry.AnimationDescription, &plain, &encrypted, &keyId, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		mood, err := openMood(ring, plain, encrypted, keyId)
+		if err != nil {
+			return nil, err
+		}
+		entry.Mood = Mood(mood)
+		moods = append(moods, entry)
+	}
+	if order == "DESC" {
+		slices.Reverse(moods)
+	}
+	return moods, rows.Err()
+}
+
+func (s *PostgresStore) EnqueueGenerationJob(ctx context.Context, job QueuedGeneration) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO generation_jobs (id, user_id, description, style, provider, own_key, organization_id, request_id, trace_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8, $9)`,
+		job.ID, job.UserID, job.Description, job.Style, job.Provider, job.OwnKey, job.OrganizationID,
+		job.Correlation.RequestID, job.Correlation.TraceID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue generation job: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ClaimGenerationJobs(ctx context.Context, limit int) ([]QueuedGeneration, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`UPDATE generation_jobs SET status = 'generating', attempts = attempts + 1,
+			claimed_until = NOW() + $2 * INTERVAL '1 second', updated_at = NOW()
+		 WHERE id IN (
+			SELECT id FROM generation_jobs
+			WHERE status = 'queued' OR (status = 'generating' AND claimed_until < NOW())
+			ORDER BY created_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, user_id, description, style, provider, own_key, COALESCE(organization_id, 0), attempts, request_id, trace_id`,
+		limit, int(generationJobClaimHold.Seconds()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []QueuedGeneration
+	for rows.Next() {
+		var job QueuedGeneration
+		err := rows.Scan(&job.ID, &job.UserID, &job.Description, &job.Style, &job.Provider, &job.OwnKey,
+			&job.OrganizationID, &job.Attempts, &job.Correlation.RequestID, &job.Correlation.TraceID)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *PostgresStore) CompleteGenerationJob(ctx context.Context, id string, result AnimationResponse) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode generation result: %w", err)
+	}
+	return s.finishGenerationJob(ctx, id, GenerationDone, encoded, nil)
+}
+
+func (s *PostgresStore) FailGenerationJob(ctx context.Context, id, message string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	return s.finishGenerationJob(ctx, id, GenerationFailed, nil, &message)
+}
+
+// finishGenerationJob records how a job ended
+func (s *PostgresStore) finishGenerationJob(ctx context.Context, id, status string, result []byte, message *string) error {
+	res, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE generation_jobs SET status = $2, result = $3, error = $4, claimed_until = NULL, updated_at = NOW()
+		 WHERE id = $1`,
+		id, status, result, message,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish generation job: %v", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("generation job not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetGenerationJob(ctx context.Context, id, userId string) (GenerationJob, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var job GenerationJob
+	var result []byte
+	var message sql.NullString
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT id, status, result, error, created_at, updated_at
+		 FROM generation_jobs WHERE id = $1 AND user_id = $2`,
+		id, userId,
+	).Scan(&job.ID, &job.Status, &result, &message, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return GenerationJob{}, errors.New("generation job not found")
+		}
+		return GenerationJob{}, fmt.Errorf("database error: %v", err)
+	}
+	if result != nil {
+		job.Result = &AnimationResponse{}
+		if err := json.Unmarshal(result, job.Result); err != nil {
+			return GenerationJob{}, fmt.Errorf("failed to decode generation result: %w", err)
+		}
+	}
+	job.Error = message.String
+	return job, nil
+}
+
+func (s *PostgresStore) DeleteFinishedGenerationJobs(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM generation_jobs WHERE status IN ('done', 'failed') AND updated_at < $1",
+		before,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished generation jobs: %v", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	return int(deleted), nil
+}
+
+func (s *PostgresStore) CreateOAuthApp(ctx context.Context, userId string, app OAuthApp) (OAuthApp, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO oauth_apps (client_id, user_id, name, redirect_uris)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING created_at`,
+		app.ClientID, userId, app.Name, pq.Array(app.RedirectURIs),
+	).Scan(&app.CreatedAt)
+	if err != nil {
+		return OAuthApp{}, fmt.Errorf("failed to save oauth app: %v", err)
+	}
+
+	log.Printf("[DB] OAuth app %s registered by user %s", app.ClientID, userId)
+	return app, nil
+}
+
+func (s *PostgresStore) ListOAuthApps(ctx context.Context, userId string) ([]OAuthApp, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT client_id, name, redirect_uris, created_at FROM oauth_apps
+		 WHERE user_id = $1 ORDER BY created_at DESC, client_id`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	apps := []OAuthApp{}
+	for rows.Next() {
+		var app OAuthApp
+		if err := rows.Scan(&app.ClientID, &app.Name, pq.Array(&app.RedirectURIs), &app.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		apps = append(apps, app)
+	}
+	return apps, rows.Err()
+}
+
+func (s *PostgresStore) GetOAuthApp(ctx context.Context, clientId string) (OAuthApp, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var app OAuthApp
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT client_id, name, redirect_uris, created_at FROM oauth_apps WHERE client_id = $1",
+		clientId,
+	).Scan(&app.ClientID, &app.Name, pq.Array(&app.RedirectURIs), &app.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OAuthApp{}, errors.New("oauth app not found")
+		}
+		return OAuthApp{}, fmt.Errorf("database error: %v", err)
+	}
+	return app, nil
+}
+
+func (s *PostgresStore) DeleteOAuthApp(ctx context.Context, clientId, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// Codes and tokens go with the app
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_apps WHERE client_id = $1 AND user_id = $2", clientId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth app: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("oauth app not found")
+	}
+
+	log.Printf("[DB] OAuth app %s deleted by user %s", clientId, userId)
+	return nil
+}
+
+func (s *PostgresStore) SaveOAuthCode(ctx context.Context, codeHash string, authorization OAuthAuthorization) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_codes WHERE expires_at <= NOW()"); err != nil {
+		return fmt.Errorf("failed to delete expired oauth codes: %v", err)
+	}
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		codeHash, authorization.ClientID, authorization.UserID, authorization.RedirectURI,
+		pq.Array(authorization.Scopes), authorization.CodeChallenge, authorization.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save oauth code: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ConsumeOAuthCode(ctx context.Context, codeHash string) (OAuthAuthorization, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var authorization OAuthAuthorization
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`DELETE FROM oauth_codes WHERE code_hash = $1
+		 RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, expires_at`,
+		codeHash,
+	).Scan(&authorization.ClientID, &authorization.UserID, &authorization.RedirectURI,
+		pq.Array(&authorization.Scopes), &authorization.CodeChallenge, &authorization.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OAuthAuthorization{}, errors.New("oauth code not found")
+		}
+		return OAuthAuthorization{}, fmt.Errorf("database error: %v", err)
+	}
+	return authorization, nil
+}
+
+// oauthTokenColumns are the columns scanOAuthToken reads, in order, from oauth_tokens
+const oauthTokenColumns = `id, client_id, user_id, scopes, expires_at, refresh_expires_at, created_at`
+
+// scanOAuthToken reads the oauthTokenColumns of a row
+func scanOAuthToken(row interface{ Scan(...any) error }) (OAuthToken, error) {
+	var token OAuthToken
+	err := row.Scan(&token.ID, &token.ClientID, &token.UserID, pq.Array(&token.Scopes),
+		&token.ExpiresAt, &token.RefreshExpiresAt, &token.CreatedAt)
+	return token, err
+}
+
+func (s *PostgresStore) CreateOAuthToken(ctx context.Context, token OAuthToken, accessHash, refreshHash string) (OAuthToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	created, err := scanOAuthToken(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO oauth_tokens (client_id, user_id, scopes, access_hash, refresh_hash, expires_at, refresh_expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+oauthTokenColumns,
+		token.ClientID, token.UserID, pq.Array(token.Scopes), accessHash, refreshHash, token.ExpiresAt, token.RefreshExpiresAt,
+	))
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to save oauth token: %v", err)
+	}
+
+	log.Printf("[DB] OAuth token %d issued to app %s for user %s", created.ID, created.ClientID, created.UserID)
+	return created, nil
+}
+
+func (s *PostgresStore) GetOAuthTokenByAccessHash(ctx context.Context, accessHash string) (OAuthToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	token, err := scanOAuthToken(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+oauthTokenColumns+" FROM oauth_tokens WHERE access_hash = $1", accessHash,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OAuthToken{}, errors.New("oauth token not found")
+		}
+		return OAuthToken{}, fmt.Errorf("database error: %v", err)
+	}
+	return token, nil
+}
+
+func (s *PostgresStore) RotateOAuthToken(ctx context.Context, refreshHash, clientId string, token OAuthToken, accessHash, newRefreshHash string) (OAuthToken, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rotated, err := scanOAuthToken(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE oauth_tokens SET access_hash = $3, refresh_hash = $4, expires_at = $5, refresh_expires_at = $6
+		 WHERE refresh_hash = $1 AND client_id = $2 AND refresh_expires_at > NOW()
+		 RETURNING `+oauthTokenColumns,
+		refreshHash, clientId, accessHash, newRefreshHash, token.ExpiresAt, token.RefreshExpiresAt,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OAuthToken{}, errors.New("oauth token not found")
+		}
+		return OAuthToken{}, fmt.Errorf("failed to rotate oauth token: %v", err)
+	}
+	return rotated, nil
+}
+
+func (s *PostgresStore) RevokeOAuthToken(ctx context.Context, tokenHash, clientId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM oauth_tokens WHERE (access_hash = $1 OR refresh_hash = $1) AND client_id = $2",
+		tokenHash, clientId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke oauth token: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("oauth token not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListOAuthGrants(ctx context.Context, userId string) ([]OAuthGrant, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT t.client_id, a.name, ARRAY_AGG(DISTINCT scope ORDER BY scope), MIN(t.created_at)
+		 FROM oauth_tokens t
+		 JOIN oauth_apps a ON a.client_id = t.client_id
+		 CROSS JOIN LATERAL UNNEST(t.scopes) AS scope
+		 WHERE t.user_id = $1 AND t.refresh_expires_at > NOW()
+		 GROUP BY t.client_id, a.name
+		 ORDER BY MIN(t.created_at) DESC`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	grants := []OAuthGrant{}
+	for rows.Next() {
+		var grant OAuthGrant
+		if err := rows.Scan(&grant.ClientID, &grant.AppName, pq.Array(&grant.Scopes), &grant.GrantedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+func (s *PostgresStore) RevokeOAuthGrant(ctx context.Context, userId, clientId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM oauth_tokens WHERE user_id = $1 AND client_id = $2", userId, clientId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke oauth grant: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	} else if affected == 0 {
+		return errors.New("oauth grant not found")
+	}
+
+	log.Printf("[DB] User %s disconnected OAuth app %s", userId, clientId)
+	return nil
+}
+
+func (s *PostgresStore) SaveAnimationExport(ctx context.Context, export AnimationExport, data []byte) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO animation_exports (id, animation_id, code_hash, format, frames, fps, data, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		export.ID, export.AnimationID, export.CodeHash, export.Format, export.Frames, export.FPS, data,
+		export.CreatedAt, export.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save animation export: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetAnimationExport(ctx context.Context, id string) (AnimationExport, []byte, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var export AnimationExport
+	var data []byte
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT id, animation_id, code_hash, format, frames, fps, data, created_at, expires_at
+		 FROM animation_exports WHERE id = $1 AND expires_at > NOW()`,
+		id,
+	).Scan(&export.ID, &export.AnimationID, &export.CodeHash, &export.Format, &export.Frames, &export.FPS, &data,
+		&export.CreatedAt, &export.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AnimationExport{}, nil, errors.New("export not found")
+		}
+		return AnimationExport{}, nil, fmt.Errorf("database error: %v", err)
+	}
+	export.SizeBytes = len(data)
+	return export, data, nil
+}
+
+func (s *PostgresStore) FindAnimationExport(ctx context.Context, animationId, codeHash, format string, frames, fps int) (AnimationExport, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var export AnimationExport
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT id, animation_id, code_hash, format, frames, fps, LENGTH(data), created_at, expires_at
+		 FROM animation_exports
+		 WHERE animation_id = $1 AND code_hash = $2 AND format = $3 AND frames = $4 AND fps = $5 AND expires_at > NOW()
+		 ORDER BY created_at DESC LIMIT 1`,
+		animationId, codeHash, format, frames, fps,
+	).Scan(&export.ID, &export.AnimationID, &export.CodeHash, &export.Format, &export.Frames, &export.FPS, &export.SizeBytes,
+		&export.CreatedAt, &export.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AnimationExport{}, errors.New("export not found")
+		}
+		return AnimationExport{}, fmt.Errorf("database error: %v", err)
+	}
+	return export, nil
+}
+
+func (s *PostgresStore) DeleteExpiredAnimationExports(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM animation_exports WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired animation exports: %v", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	return int(deleted), nil
+}
+
+func (s *PostgresStore) ListModerationAudit(ctx context.Context, animationId string) ([]ModerationAuditEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT id, animation_id, actor, action, from_state, to_state, reason, created_at FROM moderation_audit WHERE animation_id = $1 ORDER BY id",
+		animationId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []ModerationAuditEntry{}
+	for rows.Next() {
+		var entry ModerationAuditEntry
+		if err := rows.Scan(&entry.ID, &entry.AnimationID, &entry.Actor, &entry.Action, &entry.FromState, &entry.ToState, &entry.Reason, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// moodRuleColumns are the columns scanMoodRule reads, in order, from mood_rules
+const moodRuleColumns = `id, name, mood, tenant, repeats, within_hours, actions, COALESCE(created_by, ''), created_at`
+
+// scanMoodRule reads the moodRuleColumns of a row
+func scanMoodRule(row interface{ Scan(...any) error }) (MoodRule, error) {
+	var rule MoodRule
+	var actions []byte
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Mood, &rule.Tenant, &rule.Repeats, &rule.WithinHours, &actions,
+		&rule.CreatedBy, &rule.CreatedAt)
+	if err != nil {
+		return MoodRule{}, err
+	}
+	if err := json.Unmarshal(actions, &rule.Actions); err != nil {
+		return MoodRule{}, fmt.Errorf("invalid mood rule actions: %v", err)
+	}
+	return rule, nil
+}
+
+func (s *PostgresStore) CreateMoodRule(ctx context.Context, rule MoodRule) (MoodRule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return MoodRule{}, fmt.Errorf("failed to encode mood rule actions: %v", err)
+	}
+	created, err := scanMoodRule(s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO mood_rules (name, mood, tenant, repeats, within_hours, actions, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		 RETURNING `+moodRuleColumns,
+		rule.Name, rule.Mood, rule.Tenant, rule.Repeats, rule.WithinHours, actions, rule.CreatedBy,
+	))
+	if err != nil {
+		return MoodRule{}, fmt.Errorf("failed to create mood rule: %v", err)
+	}
+
+	log.Printf("[DB] Mood rule %d created by %s", created.ID, rule.CreatedBy)
+	return created, nil
+}
+
+func (s *PostgresStore) UpdateMoodRule(ctx context.Context, rule MoodRule) (MoodRule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return MoodRule{}, fmt.Errorf("failed to encode mood rule actions: %v", err)
+	}
+	updated, err := scanMoodRule(s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE mood_rules SET name = $2, mood = $3, tenant = $4, repeats = $5, within_hours = $6, actions = $7,
+			updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING `+moodRuleColumns,
+		rule.ID, rule.Name, rule.Mood, rule.Tenant, rule.Repeats, rule.WithinHours, actions,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return MoodRule{}, errors.New("mood rule not found")
+		}
+		return MoodRule{}, fmt.Errorf("failed to update mood rule: %v", err)
+	}
+	return updated, nil
+}
+
+func (s *PostgresStore) DeleteMoodRule(ctx context.Context, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM mood_rules WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete mood rule: %v", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return errors.New("mood rule not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListMoodRules(ctx context.Context) ([]MoodRule, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+moodRuleColumns+" FROM mood_rules ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	rules := []MoodRule{}
+	for rows.Next() {
+		rule, err := scanMoodRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (s *PostgresStore) RecordPlaybackView(ctx context.Context, session PlaybackSession, view PlaybackView) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// Of concurrent first reports, the one whose insert wins is the first
+	result, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO playback_sessions (id_hash, animation_id, viewer_key, created_at, expires_at, viewed_at, suspect, watched_seconds, average_fps)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT (id_hash) DO NOTHING`,
+		session.IDHash, session.AnimationID, session.ViewerKey, session.CreatedAt, session.ExpiresAt,
+		view.At, view.Suspect, view.WatchedSeconds, view.AverageFPS,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record view: %v", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return false, fmt.Errorf("failed to record view: %v", err)
+	} else if inserted > 0 {
+		return true, nil
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx,
+		"UPDATE playback_sessions SET watched_seconds = GREATEST(watched_seconds, $2), average_fps = $3 WHERE id_hash = $1",
+		session.IDHash, view.WatchedSeconds, view.AverageFPS,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record view: %v", err)
+	}
+	return false, nil
+}
+
+func (s *PostgresStore) GetPlaybackStats(ctx context.Context, animationId string, from, to time.Time) (PlaybackStats, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	stats := PlaybackStats{AnimationID: animationId, From: from, To: to}
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT COUNT(*) FILTER (WHERE viewed_at IS NOT NULL AND NOT suspect),
+			COUNT(DISTINCT viewer_key) FILTER (WHERE viewed_at IS NOT NULL AND NOT suspect),
+			COUNT(*) FILTER (WHERE viewed_at IS NOT NULL AND suspect),
+			COALESCE(AVG(watched_seconds) FILTER (WHERE viewed_at IS NOT NULL AND NOT suspect), 0)
+		 FROM playback_sessions
+		 WHERE animation_id = $1 AND created_at >= $2 AND created_at < $3`,
+		animationId, from, to,
+	).Scan(&stats.Views, &stats.UniqueViewers, &stats.SuspectViews, &stats.AverageWatchedSeconds)
+	if err != nil {
+		return PlaybackStats{}, fmt.Errorf("database error: %v", err)
+	}
+	return stats, nil
+}
+
+func (s *PostgresStore) DeletePlaybackSessions(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM playback_sessions WHERE created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete playback sessions: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete playback sessions: %v", err)
+	}
+	return int(deleted), nil
+}
+
+const subscriptionColumns = `s.id, s.user_id, s.kind, s.target, COALESCE(u.username, ''), s.created_at`
+
+// scanSubscription reads the subscriptionColumns of a row, joined to the users u the creator
+// subscriptions follow
+func scanSubscription(row interface{ Scan(...any) error }) (Subscription, error) {
+	var subscription Subscription
+	var target, username string
+	if err := row.Scan(&subscription.ID, &subscription.UserID, &subscription.Kind, &target, &username, &subscription.CreatedAt); err != nil {
+		return Subscription{}, err
+	}
+	if subscription.Kind == SubscriptionCreator {
+		subscription.CreatorID, subscription.CreatorUsername = target, username
+	} else {
+		subscription.Tag = target
+	}
+	return subscription, nil
+}
+
+func (s *PostgresStore) CreateSubscription(ctx context.Context, subscription Subscription) (Subscription, bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	target := subscription.Tag
+	if subscription.Kind == SubscriptionCreator {
+		target = subscription.CreatorID
+	}
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO subscriptions (user_id, kind, target) VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id, kind, target) DO NOTHING
+		 RETURNING id`,
+		subscription.UserID, subscription.Kind, target,
+	).Scan(&id)
+	created := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return Subscription{}, false, fmt.Errorf("failed to save subscription: %v", err)
+	}
+
+	saved, err := scanSubscription(s.conn(ctx).QueryRowContext(ctx,
+		"SELECT "+subscriptionColumns+` FROM subscriptions s
+		 LEFT JOIN users u ON s.kind = 'creator' AND u.id = s.target
+		 WHERE s.user_id = $1 AND s.kind = $2 AND s.target = $3`,
+		subscription.UserID, subscription.Kind, target,
+	))
+	if err != nil {
+		return Subscription{}, false, fmt.Errorf("database error: %v", err)
+	}
+	if created {
+		log.Printf("[DB] User %s subscribed to %s %s", subscription.UserID, subscription.Kind, target)
+	}
+	return saved, created, nil
+}
+
+func (s *PostgresStore) ListSubscriptions(ctx context.Context, userId string) ([]Subscription, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+subscriptionColumns+` FROM subscriptions s
+		 LEFT JOIN users u ON s.kind = 'creator' AND u.id = s.target
+		 WHERE s.user_id = $1 ORDER BY s.id`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []Subscription{}
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (s *PostgresStore) DeleteSubscription(ctx context.Context, id int, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM subscriptions WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %v", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete subscription: %v", err)
+	} else if deleted == 0 {
+		return errors.New("subscription not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListSubscribers(ctx context.Context, creatorId string, tags []string) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT DISTINCT user_id FROM subscriptions
+		 WHERE (kind = 'creator' AND target = $1 AND $1 <> '') OR (kind = 'tag' AND target = ANY($2))`,
+		creatorId, pq.Array(tags),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	subscribers := []string{}
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		subscribers = append(subscribers, userId)
+	}
+	return subscribers, rows.Err()
+}
+
+func (s *PostgresStore) ReserveIdempotencyKey(ctx context.Context, key IdempotencyKey, staleBefore time.Time) (IdempotencyKey, bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// A claim that expired, or whose request died without finishing, is taken over in place. No row
+	// comes back when the key is held.
+	var claimed bool
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO idempotency_keys (user_id, route, key, request_hash, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (user_id, route, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, status = 0,
+			headers = '{}', body = NULL, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		 WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+			OR (idempotency_keys.status = 0 AND idempotency_keys.created_at < $7)
+		 RETURNING true`,
+		key.UserID, key.Route, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt, staleBefore,
+	).Scan(&claimed)
+	if err == nil {
+		return key, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return IdempotencyKey{}, false, fmt.Errorf("failed to reserve idempotency key: %v", err)
+	}
+
+	existing := IdempotencyKey{UserID: key.UserID, Route: key.Route, Key: key.Key}
+	var headers []byte
+	err = s.conn(ctx).QueryRowContext(ctx,
+		`SELECT request_hash, status, headers, body, created_at, expires_at FROM idempotency_keys
+		 WHERE user_id = $1 AND route = $2 AND key = $3`,
+		key.UserID, key.Route, key.Key,
+	).Scan(&existing.RequestHash, &existing.Status, &headers, &existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return IdempotencyKey{}, false, errors.New("idempotency key not found")
+		}
+		return IdempotencyKey{}, false, fmt.Errorf("database error: %v", err)
+	}
+	if err := json.Unmarshal(headers, &existing.Headers); err != nil {
+		return IdempotencyKey{}, false, fmt.Errorf("invalid idempotency key headers: %v", err)
+	}
+	return existing, false, nil
+}
+
+func (s *PostgresStore) CompleteIdempotencyKey(ctx context.Context, key IdempotencyKey) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	headers, err := json.Marshal(key.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency key headers: %v", err)
+	}
+	result, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE idempotency_keys SET status = $5, headers = $6, body = $7
+		 WHERE user_id = $1 AND route = $2 AND key = $3 AND created_at = $4 AND status = 0`,
+		key.UserID, key.Route, key.Key, key.CreatedAt, key.Status, headers, key.Body,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %v", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %v", err)
+	} else if updated == 0 {
+		return errors.New("idempotency key not found")
+	}
+	return nil
+}
+
+func (s *PostgresStore) ReleaseIdempotencyKey(ctx context.Context, key IdempotencyKey) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"DELETE FROM idempotency_keys WHERE user_id = $1 AND route = $2 AND key = $3 AND created_at = $4 AND status = 0",
+		key.UserID, key.Route, key.Key, key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idempotency keys: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idempotency keys: %v", err)
+	}
+	return int(deleted), nil
+}
+
+func (s *PostgresStore) SaveMagicLinkToken(ctx context.Context, userId, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		"INSERT INTO magic_link_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		tokenHash, userId, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save magic link token: %w", err)
+	}
+
+	// Expired tokens are never usable again, so drop them while we are here
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM magic_link_tokens WHERE expires_at < NOW() - INTERVAL '1 day'"); err != nil {
+		log.Printf("[DB] Warning: Failed to delete expired magic link tokens: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var userId string
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`UPDATE magic_link_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		tokenHash,
+	).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("login link is invalid or expired")
+		}
+		return "", fmt.Errorf("database error: %v", err)
+	}
+	return userId, nil
+}
+
+func (s *PostgresStore) ListAnimationCode(ctx context.Context, afterId string, limit int) ([]StoredAnimationCode, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT a.id, COALESCE(a.code_hash, ''), COALESCE(b.code, a.code, ''), COALESCE(a.p5_version, '')
+		 FROM animations a LEFT JOIN code_blobs b ON b.hash = a.code_hash
+		 WHERE a.id > $1 ORDER BY a.id LIMIT $2`,
+		afterId, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	animations := make([]StoredAnimationCode, 0, limit)
+	for rows.Next() {
+		var animation StoredAnimationCode
+		if err := rows.Scan(&animation.ID, &animation.CodeHash, &animation.Code, &animation.P5Version); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		animations = append(animations, animation)
+	}
+	return animations, rows.Err()
+}
+
+func (s *PostgresStore) CreateSanitizationRun(ctx context.Context, adminId, targetP5Version string) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var runId int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"INSERT INTO sanitization_runs (created_by, target_p5_version) VALUES ($1, NULLIF($2, '')) RETURNING id",
+		adminId, targetP5Version,
+	).Scan(&runId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create sanitization run: %w", err)
+	}
+	return runId, nil
+}
+
+func (s *PostgresStore) AddSanitizationFix(ctx context.Context, runId int, animation StoredAnimationCode, newCode, diff string, validationErrors []string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`INSERT INTO sanitization_fixes (run_id, animation_id, old_code_hash, new_code, diff, validation_errors)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		runId, animation.ID, animation.CodeHash, newCode, diff, strings.Join(validationErrors, "\n"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record sanitization fix: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) FinishSanitizationRun(ctx context.Context, runId, scanned, changed int, runErr error) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	status, message := "completed", ""
+	if runErr != nil {
+		status, message = "failed", runErr.Error()
+	}
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE sanitization_runs SET status = $1, scanned = $2, changed = $3, error = $4, completed_at = NOW()
+		 WHERE id = $5`,
+		status, scanned, changed, message, runId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish sanitization run: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetSanitizationRun(ctx context.Context, runId int) (SanitizationRun, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var run SanitizationRun
+	var runError sql.NullString
+	err := s.conn(ctx).QueryRowContext(ctx,
+		`SELECT id, created_by, status, COALESCE(target_p5_version, ''), scanned, changed, error, created_at
+		 FROM sanitization_runs WHERE id = $1`,
+		runId,
+	).Scan(&run.ID, &run.CreatedBy, &run.Status, &run.TargetP5Version, &run.Scanned, &run.Changed, &runError, &run.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return run, errors.New("sanitization run not found")
+		}
+		return run, fmt.Errorf("database error: %v", err)
+	}
+	run.Error = runError.String
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT id, animation_id, diff, validation_errors, status FROM sanitization_fixes
+		 WHERE run_id = $1 ORDER BY id`,
+		runId,
+	)
+	if err != nil {
+		return run, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	run.Fixes = make([]SanitizationFix, 0)
+	for rows.Next() {
+		var fix SanitizationFix
+		var validationErrors string
+		if err := rows.Scan(&fix.ID, &fix.AnimationID, &fix.Diff, &validationErrors, &fix.Status); err != nil {
+			return run, fmt.Errorf("database error: %v", err)
+		}
+		fix.ValidationErrors = []string{}
+		if validationErrors != "" {
+			fix.ValidationErrors = strings.Split(validationErrors, "\n")
+		}
+		run.Fixes = append(run.Fixes, fix)
+	}
+	return run, rows.Err()
+}
+
+func (s *PostgresStore) ApplySanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var targetP5Version sql.NullString
+	if err = tx.QueryRowContext(ctx, "SELECT target_p5_version FROM sanitization_runs WHERE id = $1", runId).Scan(&targetP5Version); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, animation_id, old_code_hash, new_code FROM sanitization_fixes
+		 WHERE run_id = $1 AND status = 'pending' AND (cardinality($2::int[]) = 0 OR id = ANY($2::int[]))
+		 FOR UPDATE`,
+		runId, pq.Array(fixIds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	type pendingFix struct {
+		id          int
+		animationId string
+		oldCodeHash string
+		newCode     string
+	}
+	fixes := make([]pendingFix, 0)
+	for rows.Next() {
+		var fix pendingFix
+		if err := rows.Scan(&fix.id, &fix.animationId, &fix.oldCodeHash, &fix.newCode); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		fixes = append(fixes, fix)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	applied := []string{}
+	for _, fix := range fixes {
+		newHash, err := saveCodeBlob(ctx, tx, fix.newCode)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := tx.ExecContext(ctx,
+			"UPDATE animations SET code_hash = $1, code = NULL, p5_version = COALESCE($4, p5_version) WHERE id = $2 AND code_hash = $3",
+			newHash, fix.animationId, fix.oldCodeHash, targetP5Version,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update animation code: %w", err)
+		}
+
+		status := "applied"
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			status = "stale"
+		} else {
+			applied = append(applied, fix.animationId)
+			if _, err := recordAnimationVersion(ctx, tx, fix.animationId, VersionFixed, adminId, 0); err != nil {
+				return nil, err
+			}
+			// The code changed, so its compatibility is checked again on the next lookup
+			if _, err := tx.ExecContext(ctx, "DELETE FROM animation_p5_compatibility WHERE animation_id = $1", fix.animationId); err != nil {
+				return nil, fmt.Errorf("failed to clear compatibility: %w", err)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE sanitization_fixes SET status = $1, reviewed_by = $2, reviewed_at = NOW() WHERE id = $3",
+			status, adminId, fix.id,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update sanitization fix: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Applied %d sanitization fixes from run %d", len(applied), runId)
+	return applied, nil
+}
+
+func (s *PostgresStore) RejectSanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE sanitization_fixes SET status = 'rejected', reviewed_by = $3, reviewed_at = NOW()
+		 WHERE run_id = $1 AND status = 'pending' AND (cardinality($2::int[]) = 0 OR id = ANY($2::int[]))`,
+		runId, pq.Array(fixIds), adminId,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reject sanitization fixes: %w", err)
+	}
+
+	rejected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rejected fixes: %w", err)
+	}
+	return int(rejected), nil
+}
+
+func (s *PostgresStore) SaveContractRun(ctx context.Context, report ContractReport) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	cases, err := json.Marshal(report.Cases)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode contract cases: %w", err)
+	}
+
+	var id int
+	err = s.conn(ctx).QueryRowContext(ctx,
+		"INSERT INTO contract_runs (mode, total, passed, skipped, cases) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		report.Mode, report.Total, report.Passed, report.Skipped, cases,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save contract run: %w", err)
+	}
+	return id, nil
+}
+
+func (s *PostgresStore) GetContractRuns(ctx context.Context, limit int) ([]ContractReport, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT id, mode, total, passed, skipped, created_at FROM contract_runs ORDER BY created_at DESC, id DESC LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	reports := make([]ContractReport, 0, limit)
+	for rows.Next() {
+		var report ContractReport
+		if err := rows.Scan(&report.ID, &report.Mode, &report.Total, &report.Passed, &report.Skipped, &report.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if report.Total > 0 {
+			report.PassRate = 100 * float64(report.Passed) / float64(report.Total)
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (s *PostgresStore) ReserveGeneration(ctx context.Context, userId string, dailyLimit, monthlyLimit int) (GenerationQuota, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The upsert locks today's row, serializing concurrent reservations for the same user
+	var dailyUsed int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO generation_usage (user_id, usage_date, generation_count)
+		 VALUES ($1, CURRENT_DATE, 1)
+		 ON CONFLICT (user_id, usage_date)
+		 DO UPDATE SET generation_count = generation_usage.generation_count + 1
+		 RETURNING generation_count`,
+		userId,
+	).Scan(&dailyUsed)
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("failed to record generation usage: %w", err)
+	}
+
+	var monthlyUsed int
+	if err := tx.QueryRowContext(ctx, monthlyGenerationCountQuery, userId).Scan(&monthlyUsed); err != nil {
+		return GenerationQuota{}, fmt.Errorf("database error: %v", err)
+	}
+
+	quota := newGenerationQuota(dailyLimit, dailyUsed, monthlyLimit, monthlyUsed)
+	if quota.Exceeded() {
+		return newGenerationQuota(dailyLimit, dailyUsed-1, monthlyLimit, monthlyUsed-1), errors.New("generation quota exceeded")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return GenerationQuota{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return quota, nil
+}
+
+func (s *PostgresStore) ReleaseGeneration(ctx context.Context, userId string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx,
+		`UPDATE generation_usage SET generation_count = generation_count - 1
+		 WHERE user_id = $1 AND usage_date = CURRENT_DATE AND generation_count > 0`,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release generation usage: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetGenerationQuota(ctx context.Context, userId string, dailyLimit, monthlyLimit int) (GenerationQuota, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var dailyUsed int
+	err := s.conn(ctx).QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(generation_count), 0) FROM generation_usage WHERE user_id = $1 AND usage_date = CURRENT_DATE",
+		userId,
+	).Scan(&dailyUsed)
+	if err != nil {
+		return GenerationQuota{}, fmt.Errorf("database error: %v", err)
+	}
+
+	var monthlyUsed int
+	if err := s.conn(ctx).QueryRowContext(ctx, monthlyGenerationCountQuery, userId).Scan(&monthlyUsed); err != nil {
+		return GenerationQuota{}, fmt.Errorf("database error: %v", err)
+	}
+
+	return newGenerationQuota(dailyLimit, dailyUsed, monthlyLimit, monthlyUsed), nil
+}
+
+// takedownColumns are the takedown request columns read by scanTakedown, joined with the animation's uploader
+const takedownColumns = `t.id, t.animation_id, COALESCE(a.user_id, ''), t.reporter_name, t.reporter_email, t.reason,
+	t.status, t.created_at, t.updated_at
+	FROM takedown_requests t JOIN animations a ON a.id = t.animation_id`
+
+// scanTakedown reads a row selected with takedownColumns
+func scanTakedown(row interface{ Scan(...interface{}) error }) (TakedownRequest, error) {
+	var takedown TakedownRequest
+	err := row.Scan(&takedown.ID, &takedown.AnimationID, &takedown.UploaderID, &takedown.ReporterName,
+		&takedown.ReporterEmail, &takedown.Reason, &takedown.Status, &takedown.CreatedAt, &takedown.UpdatedAt)
+	return takedown, err
+}
+
+func (s *PostgresStore) CreateTakedownRequest(ctx context.Context, animationId, reporterName, reporterEmail, reason string) (TakedownRequest, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO takedown_requests (animation_id, reporter_name, reporter_email, reason, status)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		animationId, reporterName, reporterEmail, reason, TakedownReported,
+	).Scan(&id)
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to create takedown request: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO takedown_events (takedown_id, actor, to_status, note) VALUES ($1, $2, $3, $4)",
+		id, reporterEmail, TakedownReported, reason,
+	)
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to record takedown event: %w", err)
+	}
+
+	takedown, err := scanTakedown(tx.QueryRowContext(ctx, "SELECT "+takedownColumns+" WHERE t.id = $1", id))
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("database error: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Takedown request %d created for animation %s", id, animationId)
+	return takedown, nil
+}
+
+func (s *PostgresStore) GetTakedownRequest(ctx context.Context, id int) (TakedownRequest, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	takedown, err := scanTakedown(s.conn(ctx).QueryRowContext(ctx, "SELECT "+takedownColumns+" WHERE t.id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return takedown, errors.New("takedown request not found")
+		}
+		return takedown, fmt.Errorf("database error: %v", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		`SELECT actor, COALESCE(from_status, ''), to_status, note, created_at FROM takedown_events
+		 WHERE takedown_id = $1 ORDER BY id`,
+		id,
+	)
+	if err != nil {
+		return takedown, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	takedown.Events = make([]TakedownEvent, 0)
+	for rows.Next() {
+		var event TakedownEvent
+		if err := rows.Scan(&event.Actor, &event.FromStatus, &event.ToStatus, &event.Note, &event.CreatedAt); err != nil {
+			return takedown, fmt.Errorf("database error: %v", err)
+		}
+		takedown.Events = append(takedown.Events, event)
+	}
+	return takedown, rows.Err()
+}
+
+func (s *PostgresStore) ListTakedownRequests(ctx context.Context, status string, limit int) ([]TakedownRequest, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		"SELECT "+takedownColumns+" WHERE ($1 = '' OR t.status = $1) ORDER BY t.created_at DESC, t.id DESC LIMIT $2",
+		status, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	takedowns := make([]TakedownRequest, 0)
+	for rows.Next() {
+		takedown, err := scanTakedown(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		takedowns = append(takedowns, takedown)
+	}
+	return takedowns, rows.Err()
+}
+
+func (s *PostgresStore) TransitionTakedown(ctx context.Context, id int, to, actor, note string) (TakedownRequest, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from, animationId string
+	err = tx.QueryRowContext(ctx, "SELECT status, animation_id FROM takedown_requests WHERE id = $1 FOR UPDATE", id).Scan(&from, &animationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TakedownRequest{}, errors.New("takedown request not found")
+		}
+		return TakedownRequest{}, fmt.Errorf("database error: %v", err)
+	}
+
+	if err := ValidateTakedownTransition(from, to); err != nil {
+		return TakedownRequest{}, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE takedown_requests SET status = $1, updated_at = NOW() WHERE id = $2", to, id); err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to update takedown request: %w", err)
+	}
+
+	// The visibility before the change, for the moderation audit; empty if the animation was deleted
+	var before string
+	var removed bool
+	err = tx.QueryRowContext(ctx, "SELECT removed_at IS NOT NULL FROM animations WHERE id = $1 FOR UPDATE", animationId).Scan(&removed)
+	switch {
+	case err == nil:
+		before = visibilityState(removed)
+	case err != sql.ErrNoRows:
+		return TakedownRequest{}, fmt.Errorf("database error: %v", err)
+	}
+
+	switch to {
+	case TakedownRemoved:
+		_, err = tx.ExecContext(ctx, "UPDATE animations SET removed_at = NOW() WHERE id = $1", animationId)
+		if err == nil {
+			err = recordSearchEvent(ctx, tx, animationId, SearchEventDelete)
+		}
+	case TakedownRestored:
+		_, err = tx.ExecContext(ctx, "UPDATE animations SET removed_at = NULL WHERE id = $1", animationId)
+		if err == nil {
+			err = recordSearchEvent(ctx, tx, animationId, SearchEventCreate)
+		}
+	}
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to update animation visibility: %w", err)
+	}
+	if after := visibilityState(to == TakedownRemoved); before != "" && before != after && (to == TakedownRemoved || to == TakedownRestored) {
+		entry := moderationEntry(ctx, animationId, ModerationVisibility, before, after, fmt.Sprintf("Takedown request %d", id))
+		entry.Actor = actor
+		if note != "" {
+			entry.Reason += ": " + note
+		}
+		if err = recordModerationAudit(ctx, tx, entry); err != nil {
+			return TakedownRequest{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO takedown_events (takedown_id, actor, from_status, to_status, note) VALUES ($1, $2, $3, $4, $5)",
+		id, actor, from, to, note,
+	)
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to record takedown event: %w", err)
+	}
+
+	takedown, err := scanTakedown(tx.QueryRowContext(ctx, "SELECT "+takedownColumns+" WHERE t.id = $1", id))
+	if err != nil {
+		return TakedownRequest{}, fmt.Errorf("database error: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return TakedownRequest{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("[DB] Takedown request %d moved from %s to %s by %s", id, from, to, actor)
+	return takedown, nil
+}
@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// testPostgresStore migrates the database at DATABASE_URL and returns a store backed by it. Tests
+// using it are skipped when DATABASE_URL is unset.
+func testPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	saved := db
+	db = openTestDatabase(t, databaseURL)
+	t.Cleanup(func() { db = saved })
+	if _, err := MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewPostgresStore()
+}
+
+// openTestDatabase connects to the database at databaseURL until the test ends
+func openTestDatabase(t *testing.T, databaseURL string) *tracedDB {
+	t.Helper()
+	conn, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.PingContext(context.Background()); err != nil {
+		t.Fatalf("ping database: %v", err)
+	}
+	return newTracedDB(conn, nil)
+}
+
+// testRegionDatabase creates a database for region beside the one at DATABASE_URL, if there is
+// none yet, and migrates it and sends the region's queries to it until the test ends
+func testRegionDatabase(t *testing.T, region string) *tracedDB {
+	t.Helper()
+	parsed, err := url.Parse(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatalf("parse DATABASE_URL: %v", err)
+	}
+	name := strings.TrimPrefix(parsed.Path, "/") + "_" + region
+	ctx := context.Background()
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+		t.Fatalf("look up region database: %v", err)
+	}
+	if !exists {
+		if _, err := db.ExecContext(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(name)); err != nil {
+			t.Fatalf("create region database: %v", err)
+		}
+	}
+
+	parsed.Path = "/" + name
+	regional := openTestDatabase(t, parsed.String())
+	regionDBs[region] = regional
+	t.Cleanup(func() { delete(regionDBs, region) })
+	if _, err := MigrateUp(WithDataRegion(ctx, region)); err != nil {
+		t.Fatalf("migrate region database: %v", err)
+	}
+	return regional
+}
+
+// testPostgresUser creates a user for a test, unique to the run
+func testPostgresUser(ctx context.Context, t *testing.T, store *PostgresStore, prefix string) string {
+	t.Helper()
+	suffix, err := generateRandomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId, err := store.CreateUserWithUsername(ctx, prefix+"-"+suffix+"@example.com", prefix+"-"+suffix, "hash")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return userId
+}
+
+func TestPostgresCodeBlobs(t *testing.T) {
+	ctx := context.Background()
+	store := testPostgresStore(t)
+	suffix, err := generateRandomID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId, err := store.CreateUserWithUsername(ctx, "blobs-"+suffix+"@example.com", "blobs-"+suffix, "hash")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// blob reads where an animation's code is kept, and how many blobs hold the code it points at
+	blob := func(id string) (codeHash string, inline bool, blobs int) {
+		t.Helper()
+		err := db.QueryRowContext(ctx,
+			`SELECT a.code_hash, a.code IS NOT NULL, (SELECT COUNT(*) FROM code_blobs b WHERE b.hash = a.code_hash)
+			 FROM animations a WHERE a.id = $1`,
+			id,
+		).Scan(&codeHash, &inline, &blobs)
+		if err != nil {
+			t.Fatalf("read animation %s: %v", id, err)
+		}
+		return codeHash, inline, blobs
+	}
+
+	// The code is unique to this run, so the blob count is not thrown off by earlier runs
+	code := "function draw() { background(" + suffix + "); }"
+	first, err := store.SaveAnimation(ctx, code, "first", userId, "")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	second, err := store.SaveAnimation(ctx, code, "second", userId, "")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	for _, id := range []string{first, second} {
+		if codeHash, inline, blobs := blob(id); codeHash != CodeHash(code) || inline || blobs != 1 {
+			t.Errorf("animation %s is stored under %q (inline %v, %d blobs), want one blob under %q", id, codeHash, inline, blobs, CodeHash(code))
+		}
+		if animation, err := store.GetAnimation(ctx, id); err != nil || animation.Code != code {
+			t.Errorf("get %s = %q, %v, want the code read back from its blob", id, animation.Code, err)
+		}
+	}
+
+	// Editing one animation moves it to a new blob and leaves the shared one to the other
+	edited := code + "\n// edited"
+	if err := store.UpdateAnimation(ctx, second, userId, UpdateAnimationRequest{Code: &edited}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if codeHash, _, blobs := blob(second); codeHash != CodeHash(edited) || blobs != 1 {
+		t.Errorf("edited animation is stored under %q (%d blobs), want %q", codeHash, blobs, CodeHash(edited))
+	}
+	if animation, _ := store.GetAnimation(ctx, first); animation.Code != code {
+		t.Errorf("other animation's code = %q, want it unchanged", animation.Code)
+	}
+	if animation, _ := store.GetAnimation(ctx, second); animation.Code != edited {
+		t.Errorf("edited animation's code = %q, want %q", animation.Code, edited)
+	}
+}
+
+func TestPostgresGenerationJobClaims(t *testing.T) {
+	ctx := context.Background()
+	store := testPostgresStore(t)
+	userId := testPostgresUser(ctx, t, store, "claims")
+
+	// claimed returns how many times each of ids was claimed by claims running at once. Other jobs
+	// left in the database may be claimed too, so only ids are counted.
+	claimed := func(ids []string, claims int) map[string]int {
+		t.Helper()
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		counts := make(map[string]int)
+		for i := 0; i < claims; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				jobs, err := store.ClaimGenerationJobs(ctx, 100)
+				if err != nil {
+					t.Errorf("claim: %v", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for _, job := range jobs {
+					if slices.Contains(ids, job.ID) {
+						counts[job.ID]++
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		return counts
+	}
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		id, err := generateRandomID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.EnqueueGenerationJob(ctx, QueuedGeneration{ID: id, UserID: userId, Description: "waves"}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Workers claiming at once never get the same job
+	counts := claimed(ids, 5)
+	for _, id := range ids {
+		if counts[id] != 1 {
+			t.Errorf("job %s was claimed %d times, want once", id, counts[id])
+		}
+	}
+
+	// Claimed jobs are held until their lease runs out
+	if counts := claimed(ids, 1); len(counts) != 0 {
+		t.Errorf("held jobs were claimed again: %v", counts)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE generation_jobs SET claimed_until = NOW() - INTERVAL '1 second' WHERE id = $1", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := store.ClaimGenerationJobs(ctx, 100)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	var reclaimed *QueuedGeneration
+	for i := range jobs {
+		if jobs[i].ID == ids[0] {
+			reclaimed = &jobs[i]
+		} else if slices.Contains(ids, jobs[i].ID) {
+			t.Errorf("job %s was claimed while its lease was held", jobs[i].ID)
+		}
+	}
+	if reclaimed == nil || reclaimed.Attempts != 2 {
+		t.Errorf("job with an expired lease = %+v, want it claimed for a second attempt", reclaimed)
+	}
+
+	// Finished jobs are never claimed again
+	if err := store.CompleteGenerationJob(ctx, ids[0], AnimationResponse{}); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE generation_jobs SET claimed_until = NOW() - INTERVAL '1 second' WHERE id = $1", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if counts := claimed(ids[:1], 1); len(counts) != 0 {
+		t.Errorf("finished job was claimed: %v", counts)
+	}
+	if job, err := store.GetGenerationJob(ctx, ids[0], userId); err != nil || job.Status != GenerationDone {
+		t.Errorf("finished job = %+v, %v, want it done", job, err)
+	}
+}
+
+func TestPostgresIdempotencyKeyReserve(t *testing.T) {
+	ctx := context.Background()
+	store := testPostgresStore(t)
+	userId := testPostgresUser(ctx, t, store, "idempotency")
+
+	// Postgres keeps microseconds, so times are truncated to compare them after a round trip
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	key := IdempotencyKey{UserID: userId, Route: "POST /save-animation", Key: "first", RequestHash: "hash", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	staleBefore := now.Add(-time.Minute)
+
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, key, staleBefore); err != nil || !reserved {
+		t.Fatalf("reserve new key = %v, %v, want it reserved", reserved, err)
+	}
+	retry := key
+	retry.CreatedAt = now.Add(time.Second)
+	existing, reserved, err := store.ReserveIdempotencyKey(ctx, retry, staleBefore)
+	if err != nil || reserved || existing.Status != 0 || !existing.CreatedAt.Equal(now) {
+		t.Fatalf("reserve running key = %+v, %v, %v, want the running claim", existing, reserved, err)
+	}
+
+	key.Status, key.Headers, key.Body = 201, map[string]string{"Content-Type": "application/json"}, []byte(`{"id":"a"}`)
+	if err := store.CompleteIdempotencyKey(ctx, key); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	existing, reserved, err = store.ReserveIdempotencyKey(ctx, retry, now.Add(time.Minute))
+	if err != nil || reserved || existing.Status != 201 || string(existing.Body) != `{"id":"a"}` || existing.Headers["Content-Type"] != "application/json" {
+		t.Errorf("reserve completed key = %+v, %v, %v, want its response, even when old", existing, reserved, err)
+	}
+
+	// A request that died while running is taken over once stale
+	stale := IdempotencyKey{UserID: userId, Route: key.Route, Key: "stale", RequestHash: "hash", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, stale, staleBefore); err != nil || !reserved {
+		t.Fatalf("reserve = %v, %v", reserved, err)
+	}
+	takeover := stale
+	takeover.CreatedAt, takeover.RequestHash = now, "other"
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, takeover, staleBefore); err != nil || !reserved {
+		t.Errorf("reserve stale key = %v, %v, want it taken over", reserved, err)
+	}
+
+	// An expired key is replaced, even with a response
+	expired := IdempotencyKey{UserID: userId, Route: key.Route, Key: "expired", RequestHash: "hash", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Status: 200, Headers: map[string]string{}}
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, expired, staleBefore); err != nil || !reserved {
+		t.Fatalf("reserve = %v, %v", reserved, err)
+	}
+	if err := store.CompleteIdempotencyKey(ctx, expired); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	renewed := expired
+	renewed.CreatedAt, renewed.ExpiresAt, renewed.Status = now, now.Add(time.Hour), 0
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, renewed, staleBefore); err != nil || !reserved {
+		t.Errorf("reserve expired key = %v, %v, want it replaced", reserved, err)
+	}
+
+	// A released key can be reserved again straight away
+	if err := store.ReleaseIdempotencyKey(ctx, renewed); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, reserved, err := store.ReserveIdempotencyKey(ctx, renewed, staleBefore); err != nil || !reserved {
+		t.Errorf("reserve released key = %v, %v, want it reserved", reserved, err)
+	}
+}
+
+func TestPostgresResidency(t *testing.T) {
+	store := testPostgresStore(t)
+	regional := testRegionDatabase(t, "eu")
+
+	primary := context.Background()
+	eu := WithDataRegion(WithTenant(primary, "acme"), "eu")
+
+	// tenantIn returns the tenant a user is stored with in a database, and whether it has the user
+	tenantIn := func(conn *tracedDB, userId string) (string, bool) {
+		t.Helper()
+		var tenant string
+		err := conn.QueryRowContext(primary, "SELECT tenant FROM users WHERE id = $1", userId).Scan(&tenant)
+		if err == sql.ErrNoRows {
+			return "", false
+		}
+		if err != nil {
+			t.Fatalf("read user %s: %v", userId, err)
+		}
+		return tenant, true
+	}
+
+	// A tenant's account is stored with its tenant in its region only
+	userId := testPostgresUser(eu, t, store, "residency")
+	if tenant, ok := tenantIn(regional, userId); !ok || tenant != "acme" {
+		t.Errorf("regional user = %q, %v, want it stored for acme", tenant, ok)
+	}
+	if _, ok := tenantIn(db, userId); ok {
+		t.Error("regional user was stored in the primary database")
+	}
+	if user, err := store.GetUserDetails(eu, userId); err != nil || user.Tenant != "acme" {
+		t.Errorf("GetUserDetails in the region = %+v, %v", user, err)
+	}
+	if _, err := store.GetUserDetails(primary, userId); err == nil {
+		t.Error("regional user was found in the primary database")
+	}
+
+	// Its animations stay there too
+	id, err := store.SaveAnimation(eu, "function draw() {}", "regional", userId, "")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if !store.AnimationExists(eu, id) || store.AnimationExists(primary, id) {
+		t.Error("regional animation is not kept in its region alone")
+	}
+
+	// Accounts from before tenants were recorded take on the first tenant they sign in to, only
+	legacy := testPostgresUser(primary, t, store, "legacy")
+	if tenant, _ := tenantIn(db, legacy); tenant != "" {
+		t.Fatalf("legacy user tenant = %q, want none", tenant)
+	}
+	if err := store.SetUserTenant(primary, legacy, "globex"); err != nil {
+		t.Fatalf("set tenant: %v", err)
+	}
+	if err := store.SetUserTenant(primary, legacy, "initech"); err != nil {
+		t.Fatalf("set tenant again: %v", err)
+	}
+	if tenant, _ := tenantIn(db, legacy); tenant != "globex" {
+		t.Errorf("legacy user tenant = %q, want the first one set", tenant)
+	}
+}
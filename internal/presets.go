@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	maxPromptPresetNameLength     = 80
+	maxPromptPresetTemplateLength = 1000
+	maxPromptPresetPlaceholders   = 10
+	maxPromptPresetValueLength    = 200
+	// maxPromptPresets is how many presets each user may keep
+	maxPromptPresets = 100
+)
+
+// promptPlaceholder matches a {{name}} placeholder in a prompt preset
+var promptPlaceholder = regexp.MustCompile(`\{\{([a-z][a-z0-9_]{0,31})\}\}`)
+
+// PromptPlaceholders returns the names of the placeholders in a preset template, in the order
+// they first appear
+func PromptPlaceholders(template string) []string {
+	names := []string{}
+	for _, match := range promptPlaceholder.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Validate reports a generation request naming both a description and a preset to stand in for it
+func (req AnimationRequest) Validate() []FieldError {
+	if req.PresetID != 0 && req.Description != "" {
+		return []FieldError{{Field: "description", Code: ErrCodeConflict, Message: "must be left out when presetId is given"}}
+	}
+	return nil
+}
+
+// ValidatePromptPreset checks a preset request and returns the preset it describes
+func ValidatePromptPreset(req PromptPresetRequest) (PromptPreset, error) {
+	preset := PromptPreset{
+		Name:     strings.TrimSpace(req.Name),
+		Template: strings.TrimSpace(req.Template),
+		Public:   req.Public,
+	}
+	if preset.Name == "" || len(preset.Name) > maxPromptPresetNameLength {
+		return PromptPreset{}, fmt.Errorf("name must be 1-%d characters", maxPromptPresetNameLength)
+	}
+	if preset.Template == "" || len(preset.Template) > maxPromptPresetTemplateLength {
+		return PromptPreset{}, fmt.Errorf("template must be 1-%d characters", maxPromptPresetTemplateLength)
+	}
+	// Braces left after removing the placeholders are malformed placeholders
+	if rest := promptPlaceholder.ReplaceAllString(preset.Template, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return PromptPreset{}, errors.New("placeholders must look like {{name}}, using lowercase letters, digits and underscores")
+	}
+	preset.Placeholders = PromptPlaceholders(preset.Template)
+	if len(preset.Placeholders) > maxPromptPresetPlaceholders {
+		return PromptPreset{}, fmt.Errorf("templates may have at most %d placeholders", maxPromptPresetPlaceholders)
+	}
+	return preset, nil
+}
+
+// Apply fills the preset's placeholders with variables and returns the description to generate
+// from. Every placeholder needs a value, and variables the preset does not use are rejected.
+func (p PromptPreset) Apply(variables map[string]string) (string, error) {
+	var missing, unknown []string
+	replacements := []string{}
+	for _, name := range PromptPlaceholders(p.Template) {
+		value := strings.TrimSpace(variables[name])
+		if value == "" {
+			missing = append(missing, name)
+			continue
+		}
+		if len(value) > maxPromptPresetValueLength {
+			return "", fmt.Errorf("%s must be at most %d characters", name, maxPromptPresetValueLength)
+		}
+		replacements = append(replacements, "{{"+name+"}}", value)
+	}
+	for name := range variables {
+		if !promptPlaceholder.MatchString("{{"+name+"}}") || !strings.Contains(p.Template, "{{"+name+"}}") {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", errors.New("missing values for " + strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", errors.New("the preset has no placeholders named " + strings.Join(unknown, ", "))
+	}
+	// Values are filled in one pass, so a value that looks like a placeholder stays as written
+	return strings.NewReplacer(replacements...).Replace(p.Template), nil
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidatePromptPreset(t *testing.T) {
+	tests := []struct {
+		name             string
+		req              PromptPresetRequest
+		wantPlaceholders []string
+		wantErr          bool
+	}{
+		{name: "Placeholders", req: PromptPresetRequest{Name: " Waves ", Template: "{{color}} waves under a {{sky}} sky, {{color}} foam"},
+			wantPlaceholders: []string{"color", "sky"}},
+		{name: "No placeholders", req: PromptPresetRequest{Name: "Rain", Template: "rain on a window"}, wantPlaceholders: []string{}},
+		{name: "Missing name", req: PromptPresetRequest{Template: "rain"}, wantErr: true},
+		{name: "Missing template", req: PromptPresetRequest{Name: "Rain", Template: "  "}, wantErr: true},
+		{name: "Too long", req: PromptPresetRequest{Name: "Rain", Template: strings.Repeat("a", maxPromptPresetTemplateLength+1)}, wantErr: true},
+		{name: "Uppercase placeholder", req: PromptPresetRequest{Name: "Rain", Template: "{{Color}} rain"}, wantErr: true},
+		{name: "Unclosed placeholder", req: PromptPresetRequest{Name: "Rain", Template: "{{color rain"}, wantErr: true},
+		{name: "Too many placeholders", req: PromptPresetRequest{Name: "Rain", Template: "{{a}}{{b}}{{c}}{{d}}{{e}}{{f}}{{g}}{{h}}{{i}}{{j}}{{k}}"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preset, err := ValidatePromptPreset(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidatePromptPreset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(preset.Placeholders, tt.wantPlaceholders) {
+				t.Errorf("placeholders = %v, want %v", preset.Placeholders, tt.wantPlaceholders)
+			}
+		})
+	}
+}
+
+func TestPromptPresetApply(t *testing.T) {
+	preset := PromptPreset{Template: "{{color}} waves under a {{sky}} sky, {{color}} foam"}
+	tests := []struct {
+		name      string
+		variables map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{name: "Filled", variables: map[string]string{"color": "teal", "sky": " starry "}, want: "teal waves under a starry sky, teal foam"},
+		{name: "Value looks like a placeholder", variables: map[string]string{"color": "{{sky}}", "sky": "grey"}, want: "{{sky}} waves under a grey sky, {{sky}} foam"},
+		{name: "Missing value", variables: map[string]string{"color": "teal"}, wantErr: true},
+		{name: "Blank value", variables: map[string]string{"color": "teal", "sky": " "}, wantErr: true},
+		{name: "Unknown variable", variables: map[string]string{"color": "teal", "sky": "grey", "mood": "calm"}, wantErr: true},
+		{name: "Value too long", variables: map[string]string{"color": strings.Repeat("a", maxPromptPresetValueLength+1), "sky": "grey"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := preset.Apply(tt.variables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptPresetHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	alice := registerUser(t, router, "alice")
+	bob := registerUser(t, router, "bob")
+
+	var private, shared PromptPreset
+	if code := doJSON(t, router, http.MethodPost, "/me/prompt-presets", alice, PromptPresetRequest{Name: "Waves", Template: "{{color}} waves"}, &private); code != http.StatusCreated {
+		t.Fatalf("create status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/me/prompt-presets", alice, PromptPresetRequest{Name: "Rain", Template: "rain on {{surface}}", Public: true}, &shared); code != http.StatusCreated {
+		t.Fatalf("create status = %d", code)
+	}
+	if shared.Username != "alice" || !reflect.DeepEqual(shared.Placeholders, []string{"surface"}) {
+		t.Errorf("preset = %+v, want alice's with a surface placeholder", shared)
+	}
+
+	var mine PromptPresetsResponse
+	doJSON(t, router, http.MethodGet, "/me/prompt-presets", alice, nil, &mine)
+	if mine.Total != 2 || len(mine.Presets) != 2 || mine.Presets[0].ID != shared.ID {
+		t.Errorf("alice's presets = %+v, want both, newest first", mine)
+	}
+	var gallery PromptPresetsResponse
+	doJSON(t, router, http.MethodGet, "/prompt-presets", "", nil, &gallery)
+	if gallery.Total != 1 || gallery.Presets[0].ID != shared.ID {
+		t.Errorf("gallery = %+v, want only the shared preset", gallery)
+	}
+
+	privatePath := "/me/prompt-presets/" + strconv.Itoa(private.ID)
+	sharedPath := "/me/prompt-presets/" + strconv.Itoa(shared.ID)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Invalid template", method: http.MethodPost, path: "/me/prompt-presets", token: alice, body: PromptPresetRequest{Name: "Bad", Template: "{{Bad}}"}, wantCode: http.StatusBadRequest},
+		{name: "Signed out", method: http.MethodPost, path: "/me/prompt-presets", body: PromptPresetRequest{Name: "Waves", Template: "waves"}, wantCode: http.StatusUnauthorized},
+		{name: "Update", method: http.MethodPut, path: privatePath, token: alice, body: PromptPresetRequest{Name: "Waves", Template: "{{color}} waves at dusk"}, wantCode: http.StatusOK},
+		{name: "Update another user's", method: http.MethodPut, path: sharedPath, token: bob, body: PromptPresetRequest{Name: "Mine", Template: "rain"}, wantCode: http.StatusNotFound},
+		{name: "Delete another user's", method: http.MethodDelete, path: privatePath, token: bob, wantCode: http.StatusNotFound},
+		{name: "Bad page", method: http.MethodGet, path: "/prompt-presets?limit=0", wantCode: http.StatusBadRequest},
+		{name: "Delete", method: http.MethodDelete, path: privatePath, token: alice, wantCode: http.StatusNoContent},
+		{name: "Admin takes down a shared preset", method: http.MethodDelete, path: sharedPath, token: admin.Token, wantCode: http.StatusNoContent},
+		{name: "Delete again", method: http.MethodDelete, path: sharedPath, token: alice, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGenerateFromPromptPreset(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("PROVIDER_KEY_ENCRYPTION_KEYS", testKey("k1", 7))
+
+	var prompt string
+	openAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []ClaudeMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		// The user prompt follows the system prompt
+		prompt = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": "function setup() {}\nfunction draw() {}"}}},
+		})
+	}))
+	defer openAI.Close()
+	savedURL := openAIChatURL
+	openAIChatURL = openAI.URL
+	t.Cleanup(func() { openAIChatURL = savedURL })
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	pro := registerAccount(t, router, "therapist")
+	doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil)
+	doJSON(t, router, http.MethodPut, "/me/provider-key", pro.Token, ProviderKeyRequest{Provider: ProviderOpenAI, Key: testOpenAIKey}, nil)
+	author := registerUser(t, router, "author")
+
+	var shared, private PromptPreset
+	doJSON(t, router, http.MethodPost, "/me/prompt-presets", author, PromptPresetRequest{Name: "Waves", Template: "{{color}} waves", Public: true}, &shared)
+	doJSON(t, router, http.MethodPost, "/me/prompt-presets", author, PromptPresetRequest{Name: "Rain", Template: "rain"}, &private)
+
+	tests := []struct {
+		name       string
+		req        AnimationRequest
+		wantCode   int
+		wantPrompt string
+	}{
+		{name: "Shared preset", req: AnimationRequest{PresetID: shared.ID, Variables: map[string]string{"color": "teal"}}, wantCode: http.StatusAccepted, wantPrompt: `description: "teal waves"`},
+		{name: "Missing variable", req: AnimationRequest{PresetID: shared.ID}, wantCode: http.StatusBadRequest},
+		{name: "Description as well", req: AnimationRequest{Description: "rain", PresetID: shared.ID, Variables: map[string]string{"color": "teal"}}, wantCode: http.StatusBadRequest},
+		{name: "Another user's private preset", req: AnimationRequest{PresetID: private.ID}, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt = ""
+			if code, _ := generateAndWait(t, server, router, pro.Token, tt.req); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(prompt, tt.wantPrompt) {
+				t.Errorf("prompt = %q, want it to contain %q", prompt, tt.wantPrompt)
+			}
+		})
+	}
+}
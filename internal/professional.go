@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"log"
+	"time"
+)
+
+// Account types
+const (
+	AccountPersonal     = "personal"
+	AccountProfessional = "professional"
+)
+
+// Client link statuses
+const (
+	ClientLinkInvited = "invited"
+	ClientLinkActive  = "active"
+	ClientLinkEnded   = "ended"
+)
+
+// Actions recorded in the professional audit log
+const (
+	AuditClientInvited     = "client_invited"
+	AuditInviteAccepted    = "invite_accepted"
+	AuditConsentGranted    = "mood_trends_consent_granted"
+	AuditConsentRevoked    = "mood_trends_consent_revoked"
+	AuditSessionAssigned   = "session_assigned"
+	AuditSessionsViewed    = "sessions_viewed"
+	AuditMoodTrendsViewed  = "mood_trends_viewed"
+	AuditReportViewed      = "monthly_report_viewed"
+	AuditLinkEndedByClient = "link_ended_by_client"
+	AuditLinkEndedByPro    = "link_ended_by_professional"
+)
+
+// Defaults for client links
+const (
+	defaultClientInviteTTL = 7 * 24 * time.Hour
+	defaultMoodTrendWeeks  = 12
+	maxMoodTrendWeeks      = 52
+	maxSessionNoteLength   = 500
+)
+
+// ClientInviteTTL returns how long a client invitation stays valid, configured by CLIENT_INVITE_TTL_HOURS
+func ClientInviteTTL() time.Duration {
+	return envHours("CLIENT_INVITE_TTL_HOURS", defaultClientInviteTTL)
+}
+
+// ValidAccountType reports whether accountType is a known account type
+func ValidAccountType(accountType string) bool {
+	return accountType == AccountPersonal || accountType == AccountProfessional
+}
+
+// weekStart returns midnight UTC on the Monday of t's week, matching PostgreSQL's date_trunc('week', ...)
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// addMoodCount adds count moods recorded in the week starting at week to trends, which are kept
+// oldest week first
+func addMoodCount(trends []MoodTrend, week time.Time, mood Mood, count int) []MoodTrend {
+	i := len(trends)
+	for i > 0 && trends[i-1].WeekStart.After(week) {
+		i--
+	}
+	if i == 0 || !trends[i-1].WeekStart.Equal(week) {
+		trends = append(trends, MoodTrend{})
+		copy(trends[i+1:], trends[i:])
+		trends[i] = MoodTrend{WeekStart: week, Counts: make(map[Mood]int)}
+		i++
+	}
+	trends[i-1].Counts[mood] += count
+	trends[i-1].Total += count
+	return trends
+}
+
+// sendClientInvite emails the single-use token a client needs to accept a professional's invitation.
+// Delivery failures are logged; the professional can invite again.
+func sendClientInvite(email, professionalName, token string, expiresAt time.Time) {
+	body := professionalName + " invited you to connect on Animate as your therapist or coach.\n\n" +
+		"To accept, sign in with this email address and send this code to POST " + PublicURL("/me/professionals/accept") + ":\n\n" +
+		token + "\n\n" +
+		"They will be able to recommend animations to you. They can only see your mood trends if you choose to share them, " +
+		"and you can stop sharing or end the connection at any time. The code expires at " + expiresAt.UTC().Format(time.RFC1123) + "."
+	if err := GetMailer().Send(email, professionalName+" invited you to Animate", body); err != nil {
+		log.Printf("[PROFESSIONAL] Failed to send client invite: %v", err)
+	}
+}
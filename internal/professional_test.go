@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWeekStart(t *testing.T) {
+	tests := []struct {
+		in   time.Time
+		want time.Time
+	}{
+		{time.Date(2026, 10, 16, 15, 4, 5, 0, time.UTC), time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC), time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2026, 2, 23, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := weekStart(tt.in); !got.Equal(tt.want) {
+			t.Errorf("weekStart(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAddMoodCount(t *testing.T) {
+	first := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 0, 7)
+
+	var trends []MoodTrend
+	trends = addMoodCount(trends, second, MoodBetter, 2)
+	trends = addMoodCount(trends, first, MoodSame, 1)
+	trends = addMoodCount(trends, second, MoodWorse, 1)
+
+	if len(trends) != 2 || !trends[0].WeekStart.Equal(first) || !trends[1].WeekStart.Equal(second) {
+		t.Fatalf("trends = %+v, want two weeks oldest first", trends)
+	}
+	if trends[1].Total != 3 || trends[1].Counts[MoodBetter] != 2 || trends[1].Counts[MoodWorse] != 1 {
+		t.Errorf("second week = %+v, want 2 better and 1 worse", trends[1])
+	}
+}
+
+func TestProfessionalClientLinks(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	pro := registerAccount(t, router, "coach")
+	client := registerAccount(t, router, "client")
+	stranger := registerAccount(t, router, "stranger")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+
+	// Only admins make professional accounts, and only professionals reach professional routes
+	if code := doJSON(t, router, http.MethodPost, "/professional/invites", pro.Token, ClientInviteRequest{Email: "client@example.com"}, nil); code != http.StatusForbidden {
+		t.Errorf("invite from personal account status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", pro.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil); code != http.StatusForbidden {
+		t.Errorf("self-promotion status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: "guru"}, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown account type status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil); code != http.StatusOK {
+		t.Fatalf("set account type status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/professional/invites", pro.Token, ClientInviteRequest{Email: "client@example.com"}, nil); code != http.StatusCreated {
+		t.Errorf("invite status = %d, want %d", code, http.StatusCreated)
+	}
+
+	// The emailed token is only ever stored hashed, so plant an invitation with a known one
+	invite, err := store.CreateClientInvite(ctx, pro.User.ID, "Client@example.com", HashToken("invite-token"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateClientInvite: %v", err)
+	}
+	linkPath := "/professional/clients/" + strconv.Itoa(invite.ID)
+
+	if code := doJSON(t, router, http.MethodPost, "/me/professionals/accept", stranger.Token, AcceptClientInviteRequest{Token: "invite-token"}, nil); code != http.StatusNotFound {
+		t.Errorf("accept by someone else status = %d, want %d", code, http.StatusNotFound)
+	}
+	var link ClientLink
+	if code := doJSON(t, router, http.MethodPost, "/me/professionals/accept", client.Token, AcceptClientInviteRequest{Token: "invite-token"}, &link); code != http.StatusOK {
+		t.Fatalf("accept status = %d", code)
+	}
+	if link.Status != ClientLinkActive || link.ProfessionalName != "coach" || link.ShareMoodTrends {
+		t.Errorf("link = %+v, want active without mood sharing", link)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/me/professionals/accept", client.Token, AcceptClientInviteRequest{Token: "invite-token"}, nil); code != http.StatusNotFound {
+		t.Errorf("reused invite status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// Mood trends need the client's consent
+	animationId, err := store.SaveAnimation(ctx, "function draw() {}", "waves", "", "")
+	if err != nil {
+		t.Fatalf("SaveAnimation: %v", err)
+	}
+	store.SaveMood(ctx, client.User.ID, animationId, string(MoodBetter))
+	if code := doJSON(t, router, http.MethodGet, linkPath+"/mood-trends", pro.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("mood trends without consent status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodPut, "/me/professionals/"+strconv.Itoa(link.ID)+"/consent", client.Token, MoodTrendConsentRequest{ShareMoodTrends: true}, nil); code != http.StatusOK {
+		t.Fatalf("grant consent status = %d", code)
+	}
+	var trends []MoodTrend
+	if code := doJSON(t, router, http.MethodGet, linkPath+"/mood-trends?weeks=4", pro.Token, nil, &trends); code != http.StatusOK {
+		t.Fatalf("mood trends status = %d", code)
+	}
+	if len(trends) != 1 || trends[0].Counts[MoodBetter] != 1 {
+		t.Errorf("mood trends = %+v, want one better mood this week", trends)
+	}
+	if code := doJSON(t, router, http.MethodGet, linkPath+"/mood-trends?weeks=0", pro.Token, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid weeks status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// Sessions reach the client while the link is active
+	if code := doJSON(t, router, http.MethodPost, linkPath+"/sessions", pro.Token, AssignSessionRequest{AnimationID: "missing"}, nil); code != http.StatusNotFound {
+		t.Errorf("assign unknown animation status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := doJSON(t, router, http.MethodPost, linkPath+"/sessions", pro.Token, AssignSessionRequest{AnimationID: animationId, Note: "Before bed"}, nil); code != http.StatusCreated {
+		t.Fatalf("assign session status = %d", code)
+	}
+	var sessions []SessionAssignment
+	if code := doJSON(t, router, http.MethodGet, "/me/sessions", client.Token, nil, &sessions); code != http.StatusOK || len(sessions) != 1 || sessions[0].Note != "Before bed" {
+		t.Errorf("client sessions = %+v, status %d, want the assigned session", sessions, code)
+	}
+
+	// Other people cannot see or change the link
+	if code := doJSON(t, router, http.MethodGet, "/me/professionals/"+strconv.Itoa(link.ID)+"/audit", stranger.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("stranger audit status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := doJSON(t, router, http.MethodGet, linkPath+"/mood-trends", client.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("client on professional route status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	var audit []ProfessionalAuditEntry
+	if code := doJSON(t, router, http.MethodGet, "/me/professionals/"+strconv.Itoa(link.ID)+"/audit", client.Token, nil, &audit); code != http.StatusOK {
+		t.Fatalf("audit status = %d", code)
+	}
+	actions := []string{}
+	for _, entry := range audit {
+		actions = append(actions, entry.Action)
+	}
+	want := []string{AuditSessionAssigned, AuditMoodTrendsViewed, AuditConsentGranted, AuditInviteAccepted}
+	if strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Errorf("audit actions = %v, want %v", actions, want)
+	}
+
+	// Ending the link withdraws consent and hides its sessions
+	if code := doJSON(t, router, http.MethodDelete, "/me/professionals/"+strconv.Itoa(link.ID), client.Token, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("end link status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, linkPath+"/mood-trends", pro.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("mood trends after ending status = %d, want %d", code, http.StatusForbidden)
+	}
+	var after []SessionAssignment
+	if doJSON(t, router, http.MethodGet, "/me/sessions", client.Token, nil, &after); len(after) != 0 {
+		t.Errorf("sessions after ending = %+v, want none", after)
+	}
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"html"
+	"net/http"
+	"strings"
+)
+
+// revertPageSecurityPolicy keeps the email revert pages from running scripts, loading anything or
+// being framed, so the confirm button cannot be clicked through another site
+const revertPageSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'"
+
+// writeRevertEmailPage answers a browser that followed an email revert link with a small HTML page.
+// When token is set the page asks to confirm the revert, posting the token back.
+func writeRevertEmailPage(w http.ResponseWriter, status int, heading, message, token string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", revertPageSecurityPolicy)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The token is in the URL, so it must not reach other sites
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	var page strings.Builder
+	page.WriteString("<!doctype html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	page.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	page.WriteString("<title>" + html.EscapeString(heading) + " - Animate</title>\n")
+	page.WriteString("<style>body{font-family:sans-serif;max-width:32rem;margin:4rem auto;padding:0 1rem}</style>\n")
+	page.WriteString("</head>\n<body>\n<h1>" + html.EscapeString(heading) + "</h1>\n<p>" + html.EscapeString(message) + "</p>\n")
+	if token != "" {
+		page.WriteString("<form method=\"post\" action=\"revert-email\">\n")
+		page.WriteString("<input type=\"hidden\" name=\"token\" value=\"" + html.EscapeString(token) + "\">\n")
+		page.WriteString("<button type=\"submit\">Restore my email address</button>\n</form>\n")
+	}
+	page.WriteString("</body>\n</html>\n")
+	w.Write([]byte(page.String()))
+}
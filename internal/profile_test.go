@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRevertEmailChange(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	// Every token is renewed, as a hijacker's would be kept alive
+	t.Setenv("JWT_RENEWAL_WINDOW_HOURS", "100000")
+
+	server := NewServer(NewMemoryStore())
+	mailer := &fakeMailer{}
+	server.mailer = mailer
+	router := server.Router()
+	owner := registerAccount(t, router, "owner")
+
+	// Whoever holds the session changes the email, and the previous address is sent a revert link
+	if code := doJSON(t, router, http.MethodPatch, "/profile", owner.Token, UpdateProfileRequest{Email: "hijacker@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("update profile status = %d", code)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0] != "owner@example.com: Your Animate email address was changed" {
+		t.Fatalf("sent %v, want the revert link sent to the previous address", mailer.sent)
+	}
+	token := linkToken(t, mailer.bodies[0])
+
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	revert := func(token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/profile/revert-email", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return send(req)
+	}
+	profile := func(token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/me/preferences/content", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return send(req)
+	}
+
+	// Opening the link only asks to confirm
+	page := send(httptest.NewRequest(http.MethodGet, "/profile/revert-email?token="+url.QueryEscape(token), nil))
+	if page.Code != http.StatusOK || !strings.HasPrefix(page.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(page.Body.String(), `<form method="post"`) || !strings.Contains(page.Body.String(), token) {
+		t.Fatalf("revert page = %d %s, want a form confirming the revert", page.Code, page.Body.String())
+	}
+	if rec := profile(owner.Token); rec.Code != http.StatusOK || rec.Header().Get(RefreshedTokenHeader) == "" {
+		t.Fatalf("session before the revert = %d, want it still valid and renewed", rec.Code)
+	}
+	if rec := send(httptest.NewRequest(http.MethodGet, "/profile/revert-email", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("page without a token status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := revert(token); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "owner@example.com") {
+		t.Fatalf("revert = %d %s, want the email restored", rec.Code, rec.Body.String())
+	}
+	if rec := revert(token); rec.Code != http.StatusNotFound || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("reused link = %d %s, want a %d page", rec.Code, rec.Header().Get("Content-Type"), http.StatusNotFound)
+	}
+
+	// Every session from before the revert is signed out, and is not renewed on the way
+	rec := profile(owner.Token)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(RefreshedTokenHeader) != "" {
+		t.Errorf("session from before the revert = %d, renewed %v, want it refused", rec.Code, rec.Header().Get(RefreshedTokenHeader) != "")
+	}
+	var login LoginResponse
+	if code := doJSON(t, router, http.MethodPost, "/login", "", LoginRequest{Email: "owner@example.com", Password: "correct horse battery"}, &login); code != http.StatusOK {
+		t.Fatalf("login with the restored email status = %d", code)
+	}
+	if rec := profile(login.Token); rec.Code != http.StatusOK {
+		t.Errorf("session after the revert status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	server := NewServer(NewMemoryStore())
+	mailer := &fakeMailer{}
+	server.mailer = mailer
+	router := server.Router()
+	artist := registerAccount(t, router, "artist")
+	registerAccount(t, router, "taken")
+
+	tests := []struct {
+		name     string
+		token    string
+		req      UpdateProfileRequest
+		wantCode int
+		want     User
+		wantSent []string
+	}{
+		{name: "Nothing to change", token: artist.Token, wantCode: http.StatusBadRequest},
+		{name: "Invalid email", token: artist.Token, req: UpdateProfileRequest{Email: "not-an-email"}, wantCode: http.StatusBadRequest},
+		{name: "Email of another user", token: artist.Token, req: UpdateProfileRequest{Email: "taken@example.com"}, wantCode: http.StatusConflict},
+		{name: "Not signed in", req: UpdateProfileRequest{Username: "painter"}, wantCode: http.StatusUnauthorized},
+		{
+			name: "Username only", token: artist.Token, req: UpdateProfileRequest{Username: " painter "}, wantCode: http.StatusOK,
+			want: User{ID: artist.User.ID, Username: "painter", Email: "artist@example.com"},
+		},
+		{
+			name: "Email", token: artist.Token, req: UpdateProfileRequest{Email: "painter@example.com"}, wantCode: http.StatusOK,
+			want:     User{ID: artist.User.ID, Username: "painter", Email: "painter@example.com"},
+			wantSent: []string{"artist@example.com: Your Animate email address was changed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer.sent, mailer.bodies = nil, nil
+			var user User
+			if code := doJSON(t, router, http.MethodPatch, "/profile", tt.token, tt.req, &user); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if user.ID != tt.want.ID || user.Username != tt.want.Username || user.Email != tt.want.Email {
+				t.Errorf("user = %+v, want %+v", user, tt.want)
+			}
+			if strings.Join(mailer.sent, "|") != strings.Join(tt.wantSent, "|") {
+				t.Errorf("sent %v, want %v", mailer.sent, tt.wantSent)
+			}
+			if len(tt.wantSent) > 0 && !strings.Contains(mailer.bodies[0], PublicURL("/profile/revert-email?token=")) {
+				t.Errorf("email change notice %q has no revert link", mailer.bodies[0])
+			}
+		})
+	}
+
+	// The profile reads back as changed
+	var login LoginResponse
+	if code := doJSON(t, router, http.MethodPost, "/login", "", LoginRequest{Email: "painter@example.com", Password: "correct horse battery"}, &login); code != http.StatusOK || login.User.Username != "painter" {
+		t.Errorf("login with the new email = %d %+v, want the updated profile", code, login.User)
+	}
+}
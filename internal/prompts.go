@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the prompt templates, which are also their file names, with .txt, in PROMPT_TEMPLATES_DIR
+const (
+	PromptSystem   = "system"
+	PromptGenerate = "generate"
+	PromptFix      = "fix"
+)
+
+const (
+	// defaultPromptStyle fills {{style}} when a generation asks for no style
+	defaultPromptStyle = "whatever suits the description best"
+	// defaultCanvasTarget is the ID of the element the player puts sketches' canvases in
+	defaultCanvasTarget  = "animation-container"
+	maxPromptStyleLength = 200
+)
+
+// promptTemplateSpec describes a prompt template: the built-in one, the placeholders a replacement
+// must have and those it may have
+type promptTemplateSpec struct {
+	fallback string
+	required []string
+	allowed  []string
+}
+
+var promptTemplateSpecs = map[string]promptTemplateSpec{
+	PromptSystem:   {fallback: DefaultSystemPromptTemplate, allowed: []string{"canvas_target"}},
+	PromptGenerate: {fallback: DefaultAnimationPromptTemplate, required: []string{"description"}, allowed: []string{"description", "style", "canvas_target"}},
+	PromptFix:      {fallback: DefaultFixPromptTemplate, required: []string{"code", "error"}, allowed: []string{"code", "error", "canvas_target"}},
+}
+
+// validate checks that a template read from a file can stand in for the built-in one
+func (spec promptTemplateSpec) validate(template string) error {
+	if template == "" {
+		return errors.New("template is empty")
+	}
+	if rest := promptPlaceholder.ReplaceAllString(template, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return errors.New("placeholders must look like {{name}}, using lowercase letters, digits and underscores")
+	}
+	placeholders := PromptPlaceholders(template)
+	for _, name := range spec.required {
+		if !slices.Contains(placeholders, name) {
+			return fmt.Errorf("template must contain {{%s}}", name)
+		}
+	}
+	for _, name := range placeholders {
+		if !slices.Contains(spec.allowed, name) {
+			return fmt.Errorf("unknown placeholder {{%s}}", name)
+		}
+	}
+	return nil
+}
+
+// promptTemplateFile is a template file as it was when last read
+type promptTemplateFile struct {
+	modTime time.Time
+	size    int64
+	// template is the last valid template read from the file, or empty when there has been none
+	template string
+}
+
+// promptTemplateFiles caches the template files read from PROMPT_TEMPLATES_DIR by path
+var promptTemplateFiles = struct {
+	mu    sync.Mutex
+	files map[string]promptTemplateFile
+}{files: map[string]promptTemplateFile{}}
+
+// PromptTemplate returns the named prompt template: name.txt in PROMPT_TEMPLATES_DIR when the
+// directory is set and holds a valid one, otherwise the built-in template. The file is checked on
+// every use and read again when it changed, so prompts can be tuned without a restart. A change
+// that makes it invalid is logged and the last valid version kept.
+func PromptTemplate(name string) string {
+	spec := promptTemplateSpecs[name]
+	dir := os.Getenv("PROMPT_TEMPLATES_DIR")
+	if dir == "" {
+		return spec.fallback
+	}
+	if template := loadPromptTemplate(filepath.Join(dir, name+".txt"), spec); template != "" {
+		return template
+	}
+	return spec.fallback
+}
+
+// loadPromptTemplate returns the last valid template read from path, reading it again when its
+// size or modification time changed. It returns an empty string when there is none.
+func loadPromptTemplate(path string, spec promptTemplateSpec) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read prompt template %s: %v", path, err)
+		}
+		return ""
+	}
+
+	promptTemplateFiles.mu.Lock()
+	defer promptTemplateFiles.mu.Unlock()
+	cached, ok := promptTemplateFiles.files[path]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.template
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Warning: Cannot read prompt template %s: %v", path, err)
+		return cached.template
+	}
+	// The change is remembered even when it is invalid, so it is only reported once
+	file := promptTemplateFile{modTime: info.ModTime(), size: info.Size(), template: cached.template}
+	if template := strings.TrimSpace(string(contents)); spec.validate(template) != nil {
+		log.Printf("Warning: Ignoring prompt template %s: %v", path, spec.validate(template))
+	} else {
+		file.template = template
+		log.Printf("[PROMPTS] Loaded prompt template %s", path)
+	}
+	promptTemplateFiles.files[path] = file
+	return file.template
+}
+
+// SystemPrompt returns the system prompt Claude calls are sent with
+func SystemPrompt() string {
+	return renderPrompt(PromptTemplate(PromptSystem), map[string]string{"canvas_target": CanvasTarget()})
+}
+
+// CanvasTarget returns the ID of the element prompts ask sketches to put their canvas in,
+// configured by PROMPT_CANVAS_TARGET
+func CanvasTarget() string {
+	if target := strings.TrimSpace(os.Getenv("PROMPT_CANVAS_TARGET")); target != "" {
+		return target
+	}
+	return defaultCanvasTarget
+}
+
+// renderPrompt fills the placeholders of a template with values in one pass, so placeholders in
+// the values themselves are left as they are. Placeholders without a value are kept.
+func renderPrompt(template string, values map[string]string) string {
+	return promptPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if value, ok := values[strings.Trim(placeholder, "{}")]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// ValidatePromptStyle trims the style a generation asked for and checks its length
+func ValidatePromptStyle(style string) (string, error) {
+	style = strings.TrimSpace(style)
+	if len(style) > maxPromptStyleLength {
+		return "", fmt.Errorf("style must be at most %d characters", maxPromptStyleLength)
+	}
+	return style, nil
+}
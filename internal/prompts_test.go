@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildAnimationPromptVariables(t *testing.T) {
+	tests := []struct {
+		name         string
+		canvasTarget string
+		description  string
+		style        string
+		want         string
+	}{
+		{name: "Defaults", description: "rain", want: "rain in whatever suits the description best, inside #animation-container"},
+		{name: "Style and canvas target", canvasTarget: "stage", description: "rain", style: "pastel watercolour", want: "rain in pastel watercolour, inside #stage"},
+		{name: "Placeholders in values are kept", description: "{{style}} rain", style: "ink", want: "{{style}} rain in ink, inside #animation-container"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PROMPT_CANVAS_TARGET", tt.canvasTarget)
+			if got := BuildAnimationPrompt("{{description}} in {{style}}, inside #{{canvas_target}}", tt.description, tt.style); got != tt.want {
+				t.Errorf("BuildAnimationPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptTemplateSpecValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		spec     string
+		wantErr  bool
+	}{
+		{name: "Built-in generate", template: DefaultAnimationPromptTemplate, spec: PromptGenerate},
+		{name: "Built-in fix", template: DefaultFixPromptTemplate, spec: PromptFix},
+		{name: "Built-in system", template: DefaultSystemPromptTemplate, spec: PromptSystem},
+		{name: "System without placeholders", template: "Answer with p5.js code only", spec: PromptSystem},
+		{name: "System with a description", template: "Draw {{description}}", spec: PromptSystem, wantErr: true},
+		{name: "Description only", template: "Sketch {{description}}", spec: PromptGenerate},
+		{name: "No description", template: "Sketch something in {{style}}", spec: PromptGenerate, wantErr: true},
+		{name: "Unknown placeholder", template: "Sketch {{description}} for {{audience}}", spec: PromptGenerate, wantErr: true},
+		{name: "Malformed placeholder", template: "Sketch {{description}} in {{ style }}", spec: PromptGenerate, wantErr: true},
+		{name: "Fix without the error", template: "Repair {{code}}", spec: PromptFix, wantErr: true},
+		{name: "Empty", spec: PromptFix, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := promptTemplateSpecs[tt.spec].validate(tt.template); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromptTemplateReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, PromptGenerate+".txt")
+	t.Setenv("PROMPT_TEMPLATES_DIR", dir)
+
+	// Files are told apart by size and modification time, so each write moves the time on
+	modTime := time.Now().Add(-time.Hour)
+	write := func(template string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(template), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime = modTime.Add(time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name  string
+		write func()
+		want  string
+	}{
+		{name: "No file", want: DefaultAnimationPromptTemplate},
+		{name: "File", write: func() { write("Draw {{description}}\n") }, want: "Draw {{description}}"},
+		{name: "Edited", write: func() { write("Sketch {{description}} in {{style}}") }, want: "Sketch {{description}} in {{style}}"},
+		{name: "Invalid edit keeps the last valid template", write: func() { write("Sketch something") }, want: "Sketch {{description}} in {{style}}"},
+		{name: "Fixed", write: func() { write("Paint {{description}}") }, want: "Paint {{description}}"},
+		{name: "Removed", write: func() { os.Remove(path) }, want: DefaultAnimationPromptTemplate},
+	}
+	for _, step := range steps {
+		if step.write != nil {
+			step.write()
+		}
+		if got := PromptTemplate(PromptGenerate); got != step.want {
+			t.Errorf("%s: PromptTemplate() = %q, want %q", step.name, got, step.want)
+		}
+	}
+	if got := PromptTemplate(PromptFix); got != DefaultFixPromptTemplate {
+		t.Errorf("fix template = %q, want the built-in one", got)
+	}
+}
+
+func TestGenerateWithStyle(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, PromptGenerate+".txt"), []byte("Sketch {{description}} as {{style}} in #{{canvas_target}}"), 0o644)
+	t.Setenv("PROMPT_TEMPLATES_DIR", dir)
+	t.Setenv("PROMPT_CANVAS_TARGET", "stage")
+
+	var prompt string
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClaudeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[0].Content
+		w.Write([]byte(`{"content": [{"type": "text", "text": "function setup() {}\nfunction draw() {}"}]}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	artist := registerAccount(t, router, "artist")
+
+	tests := []struct {
+		name       string
+		req        AnimationRequest
+		wantCode   int
+		wantPrompt string
+	}{
+		{name: "Style", req: AnimationRequest{Description: "rain", Style: " pastel watercolour "}, wantCode: http.StatusAccepted, wantPrompt: "Sketch rain as pastel watercolour in #stage"},
+		{name: "No style", req: AnimationRequest{Description: "rain"}, wantCode: http.StatusAccepted, wantPrompt: "Sketch rain as " + defaultPromptStyle + " in #stage"},
+		{name: "Style too long", req: AnimationRequest{Description: "rain", Style: strings.Repeat("a", maxPromptStyleLength+1)}, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt = ""
+			if code, _ := generateAndWait(t, server, router, artist.Token, tt.req); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if prompt != tt.wantPrompt {
+				t.Errorf("prompt = %q, want %q", prompt, tt.wantPrompt)
+			}
+		})
+	}
+}
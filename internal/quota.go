@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Default generation limits used when GENERATION_*_LIMIT is not set
+const (
+	defaultDailyGenerationLimit   = 20
+	defaultMonthlyGenerationLimit = 200
+)
+
+// Quota headers returned with every generation request
+const (
+	QuotaDailyRemainingHeader   = "X-Quota-Daily-Remaining"
+	QuotaMonthlyRemainingHeader = "X-Quota-Monthly-Remaining"
+)
+
+// GenerationLimits returns the daily and monthly generation limits per user.
+// A limit of 0 means unlimited.
+func GenerationLimits() (int, int) {
+	return envLimit("GENERATION_DAILY_LIMIT", defaultDailyGenerationLimit),
+		envLimit("GENERATION_MONTHLY_LIMIT", defaultMonthlyGenerationLimit)
+}
+
+// newGenerationQuota fills in the remaining counts for the given limits and usage
+func newGenerationQuota(dailyLimit, dailyUsed, monthlyLimit, monthlyUsed int) GenerationQuota {
+	return GenerationQuota{
+		DailyLimit:       dailyLimit,
+		DailyUsed:        dailyUsed,
+		DailyRemaining:   remainingQuota(dailyLimit, dailyUsed),
+		MonthlyLimit:     monthlyLimit,
+		MonthlyUsed:      monthlyUsed,
+		MonthlyRemaining: remainingQuota(monthlyLimit, monthlyUsed),
+	}
+}
+
+// Exceeded reports whether either limit has been passed
+func (q GenerationQuota) Exceeded() bool {
+	return (q.DailyLimit > 0 && q.DailyUsed > q.DailyLimit) ||
+		(q.MonthlyLimit > 0 && q.MonthlyUsed > q.MonthlyLimit)
+}
+
+// SetHeaders exposes the remaining quota to the client
+func (q GenerationQuota) SetHeaders(w http.ResponseWriter) {
+	w.Header().Set(QuotaDailyRemainingHeader, strconv.Itoa(q.DailyRemaining))
+	w.Header().Set(QuotaMonthlyRemainingHeader, strconv.Itoa(q.MonthlyRemaining))
+}
+
+// remainingQuota returns how many generations are left, or -1 when unlimited
+func remainingQuota(limit, used int) int {
+	if limit <= 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// envLimit reads a non-negative integer limit from the environment
+func envLimit(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		log.Printf("Warning: Ignoring invalid %s value %q", key, raw)
+		return fallback
+	}
+	return limit
+}
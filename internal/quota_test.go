@@ -0,0 +1,53 @@
+package internal
+
+import "testing"
+
+func TestGenerationQuota(t *testing.T) {
+	tests := []struct {
+		name         string
+		quota        GenerationQuota
+		wantDaily    int
+		wantMonthly  int
+		wantExceeded bool
+	}{
+		{
+			name:        "Within limits",
+			quota:       newGenerationQuota(20, 5, 200, 50),
+			wantDaily:   15,
+			wantMonthly: 150,
+		},
+		{
+			name:        "Daily limit reached",
+			quota:       newGenerationQuota(20, 20, 200, 50),
+			wantDaily:   0,
+			wantMonthly: 150,
+		},
+		{
+			name:         "Monthly limit exceeded",
+			quota:        newGenerationQuota(20, 1, 200, 201),
+			wantDaily:    19,
+			wantMonthly:  0,
+			wantExceeded: true,
+		},
+		{
+			name:        "Unlimited",
+			quota:       newGenerationQuota(0, 500, 0, 5000),
+			wantDaily:   -1,
+			wantMonthly: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.quota.DailyRemaining != tt.wantDaily {
+				t.Errorf("DailyRemaining = %d, want %d", tt.quota.DailyRemaining, tt.wantDaily)
+			}
+			if tt.quota.MonthlyRemaining != tt.wantMonthly {
+				t.Errorf("MonthlyRemaining = %d, want %d", tt.quota.MonthlyRemaining, tt.wantMonthly)
+			}
+			if tt.quota.Exceeded() != tt.wantExceeded {
+				t.Errorf("Exceeded() = %v, want %v", tt.quota.Exceeded(), tt.wantExceeded)
+			}
+		})
+	}
+}
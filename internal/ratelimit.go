@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default request budgets used when the RATE_LIMIT_* variables are not set
+const (
+	defaultIPRatePerSecond   = 10
+	defaultIPBurst           = 20
+	defaultUserRatePerSecond = 5
+	defaultUserBurst         = 10
+)
+
+// tokenBucket tracks the remaining budget for a single key
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token-bucket rate limiter keyed by an arbitrary string such as an IP or user ID
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates a limiter that refills rate tokens per second up to burst tokens
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow consumes a token for key, returning false and the time until the next token when none is left
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(key)
+	if bucket.tokens < 1 {
+		return false, l.waitFor(bucket)
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// Peek reports whether key has a token left without consuming it
+func (l *RateLimiter) Peek(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(key)
+	if bucket.tokens < 1 {
+		return false, l.waitFor(bucket)
+	}
+	return true, 0
+}
+
+// Reset restores the full budget for key
+func (l *RateLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.buckets, key)
+}
+
+// refill returns the bucket for key topped up for the time elapsed since its last use
+func (l *RateLimiter) refill(key string) *tokenBucket {
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	return bucket
+}
+
+// waitFor returns the time until bucket holds a full token again
+func (l *RateLimiter) waitFor(bucket *tokenBucket) time.Duration {
+	return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to refill completely
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	fullAfter := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > fullAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitMiddleware rejects requests with 429 once the key returned by keyFunc exhausts its budget.
+// Requests for which keyFunc returns false are not limited.
+func RateLimitMiddleware(limiter *RateLimiter, keyFunc func(*http.Request) (string, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, ok := keyFunc(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowed, wait := limiter.Allow(key); !allowed {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				LogResponse(r.URL.Path, "Rate limit exceeded for "+key, nil)
+				EncodeError(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPRateLimitMiddleware limits every request by client IP using RATE_LIMIT_IP_RPS and RATE_LIMIT_IP_BURST
+func IPRateLimitMiddleware() func(http.Handler) http.Handler {
+	limiter := rateLimiterFromEnv("RATE_LIMIT_IP", defaultIPRatePerSecond, defaultIPBurst)
+	return RateLimitMiddleware(limiter, func(r *http.Request) (string, bool) {
+		return "ip:" + ClientIP(r), true
+	})
+}
+
+// UserRateLimitMiddleware limits authenticated requests by user ID using RATE_LIMIT_USER_RPS and RATE_LIMIT_USER_BURST.
+// It must run after AuthMiddleware.
+func UserRateLimitMiddleware() func(http.Handler) http.Handler {
+	limiter := rateLimiterFromEnv("RATE_LIMIT_USER", defaultUserRatePerSecond, defaultUserBurst)
+	return RateLimitMiddleware(limiter, func(r *http.Request) (string, bool) {
+		userId, ok := GetUserIDFromContext(r.Context())
+		return "user:" + userId, ok
+	})
+}
+
+// rateLimiterFromEnv builds a limiter from <prefix>_RPS and <prefix>_BURST, returning nil when disabled with a rate of 0
+func rateLimiterFromEnv(prefix string, defaultRate float64, defaultBurst int) *RateLimiter {
+	rate := defaultRate
+	if raw := os.Getenv(prefix + "_RPS"); raw != "" {
+		if parsed, err := strconv.ParseFloat(raw, 64); err == nil && parsed >= 0 {
+			rate = parsed
+		} else {
+			log.Printf("Warning: Ignoring invalid %s_RPS value %q", prefix, raw)
+		}
+	}
+
+	burst := defaultBurst
+	if raw := os.Getenv(prefix + "_BURST"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			burst = parsed
+		} else {
+			log.Printf("Warning: Ignoring invalid %s_BURST value %q", prefix, raw)
+		}
+	}
+
+	if rate == 0 {
+		log.Printf("[RATE LIMIT] %s disabled", prefix)
+		return nil
+	}
+	return NewRateLimiter(rate, burst)
+}
+
+// ClientIP returns the caller's IP, honouring X-Forwarded-For only when TRUST_PROXY_HEADERS is enabled
+func ClientIP(r *http.Request) string {
+	if trust, _ := envBool("TRUST_PROXY_HEADERS"); trust {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("client"); !allowed {
+			t.Fatalf("request %d should be allowed within burst", i+1)
+		}
+	}
+
+	allowed, wait := limiter.Allow("client")
+	if allowed {
+		t.Fatal("request beyond burst should be rejected")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %v, want %v", wait, time.Second)
+	}
+
+	if allowed, _ := limiter.Allow("other"); !allowed {
+		t.Error("other keys should have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if allowed, _ := limiter.Allow("client"); !allowed {
+		t.Error("request should be allowed after refill")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	handler := RateLimitMiddleware(limiter, func(r *http.Request) (string, bool) {
+		return ClientIP(r), true
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	statuses := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/feed", nil))
+		statuses = append(statuses, recorder.Code)
+
+		if recorder.Code == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") == "" {
+			t.Error("429 response should set Retry-After")
+		}
+	}
+
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [200 429]", statuses)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	t.Setenv("TRUST_PROXY_HEADERS", "")
+	if ip := ClientIP(request); ip != "10.0.0.1" {
+		t.Errorf("ClientIP() = %q, want %q", ip, "10.0.0.1")
+	}
+
+	t.Setenv("TRUST_PROXY_HEADERS", "true")
+	if ip := ClientIP(request); ip != "203.0.113.7" {
+		t.Errorf("ClientIP() = %q, want %q", ip, "203.0.113.7")
+	}
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Default number of description characters kept in production logs
+const defaultLogDescriptionMaxChars = 40
+
+var (
+	emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+\-])[A-Za-z0-9._%+\-]*@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	tokenPattern = regexp.MustCompile(`(?i)(bearer\s+)?(eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+|sk-ant-[A-Za-z0-9_\-]+)`)
+)
+
+// LogRedactionRules controls which sensitive values are masked before logging
+type LogRedactionRules struct {
+	MaskEmails          bool
+	MaskTokens          bool
+	DescriptionMaxChars int // 0 keeps descriptions in full
+}
+
+// defaultLogRedactionRules returns the rules for the given APP_ENV value.
+// Only an explicit development environment logs values in the clear.
+func defaultLogRedactionRules(env string) LogRedactionRules {
+	switch strings.ToLower(strings.TrimSpace(env)) {
+	case "development", "dev", "local":
+		return LogRedactionRules{}
+	default:
+		return LogRedactionRules{
+			MaskEmails:          true,
+			MaskTokens:          true,
+			DescriptionMaxChars: defaultLogDescriptionMaxChars,
+		}
+	}
+}
+
+// logRedactionRulesFromEnv returns the redaction rules for the running environment, applying any
+// LOG_REDACT_* overrides on top of the APP_ENV defaults
+func logRedactionRulesFromEnv() LogRedactionRules {
+	rules := defaultLogRedactionRules(os.Getenv("APP_ENV"))
+
+	if value, ok := envBool("LOG_REDACT_EMAILS"); ok {
+		rules.MaskEmails = value
+	}
+	if value, ok := envBool("LOG_REDACT_TOKENS"); ok {
+		rules.MaskTokens = value
+	}
+	if raw := os.Getenv("LOG_DESCRIPTION_MAX_CHARS"); raw != "" {
+		if maxChars, err := strconv.Atoi(raw); err == nil && maxChars >= 0 {
+			rules.DescriptionMaxChars = maxChars
+		} else {
+			log.Printf("Warning: Ignoring invalid LOG_DESCRIPTION_MAX_CHARS value %q", raw)
+		}
+	}
+
+	return rules
+}
+
+// tenantLogRedactionRules returns the rules of each tenant LOG_REDACT_EMAILS_BY_TENANT,
+// LOG_REDACT_TOKENS_BY_TENANT or LOG_DESCRIPTION_MAX_CHARS_BY_TENANT names, as tenant=value pairs
+// applied on top of rules
+func tenantLogRedactionRules(rules LogRedactionRules) (map[string]LogRedactionRules, error) {
+	tenants, err := TenantRegions()
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]LogRedactionRules)
+	override := func(key string, apply func(rules *LogRedactionRules, value string) error) error {
+		values, err := parseRegionMap(key)
+		if err != nil {
+			return err
+		}
+		for tenant, value := range values {
+			if _, ok := tenants[tenant]; !ok {
+				return fmt.Errorf("%s names unknown tenant %s", key, tenant)
+			}
+			tenantRules, ok := overrides[tenant]
+			if !ok {
+				tenantRules = rules
+			}
+			if err := apply(&tenantRules, value); err != nil {
+				return fmt.Errorf("invalid %s value %q for %s", key, value, tenant)
+			}
+			overrides[tenant] = tenantRules
+		}
+		return nil
+	}
+
+	if err := override("LOG_REDACT_EMAILS_BY_TENANT", func(rules *LogRedactionRules, value string) (err error) {
+		rules.MaskEmails, err = strconv.ParseBool(value)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := override("LOG_REDACT_TOKENS_BY_TENANT", func(rules *LogRedactionRules, value string) (err error) {
+		rules.MaskTokens, err = strconv.ParseBool(value)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := override("LOG_DESCRIPTION_MAX_CHARS_BY_TENANT", func(rules *LogRedactionRules, value string) error {
+		maxChars, err := strconv.Atoi(value)
+		if err == nil && maxChars < 0 {
+			err = errors.New("negative length")
+		}
+		rules.DescriptionMaxChars = maxChars
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// logRedactionConfig is the rules everyone's logs are redacted with, and those of the tenants
+// that override them
+type logRedactionConfig struct {
+	rules   LogRedactionRules
+	tenants map[string]LogRedactionRules
+}
+
+// logRedaction holds the rules LoadLogRedactionRules last read
+var logRedaction atomic.Pointer[logRedactionConfig]
+
+// LoadLogRedactionRules reads the redaction rules from the environment, once at startup, so
+// logging does not read it on every line. When the per-tenant rules are invalid every tenant gets
+// the environment's rules and the error is returned.
+func LoadLogRedactionRules() error {
+	config := &logRedactionConfig{rules: logRedactionRulesFromEnv()}
+	tenants, err := tenantLogRedactionRules(config.rules)
+	config.tenants = tenants
+	logRedaction.Store(config)
+	return err
+}
+
+// currentLogRedaction returns the loaded rules, loading them first if nothing has
+func currentLogRedaction() *logRedactionConfig {
+	if config := logRedaction.Load(); config != nil {
+		return config
+	}
+	if err := LoadLogRedactionRules(); err != nil {
+		log.Printf("Warning: Ignoring per-tenant log redaction rules: %v", err)
+	}
+	return logRedaction.Load()
+}
+
+// CurrentLogRedactionRules returns the redaction rules for the running environment
+func CurrentLogRedactionRules() LogRedactionRules {
+	return currentLogRedaction().rules
+}
+
+// LogRedactionRulesFor returns the redaction rules of the tenant ctx acts for, falling back to
+// those of the running environment
+func LogRedactionRulesFor(ctx context.Context) LogRedactionRules {
+	config := currentLogRedaction()
+	if rules, ok := config.tenants[TenantFromContext(ctx)]; ok {
+		return rules
+	}
+	return config.rules
+}
+
+// Redact masks emails and tokens in a log message
+func (rules LogRedactionRules) Redact(message string) string {
+	if rules.MaskTokens {
+		message = tokenPattern.ReplaceAllString(message, "${1}[REDACTED]")
+	}
+	if rules.MaskEmails {
+		message = emailPattern.ReplaceAllString(message, "${1}***@${2}")
+	}
+	return message
+}
+
+// RedactDescription truncates a user supplied description and masks anything sensitive in it
+func (rules LogRedactionRules) RedactDescription(description string) string {
+	if rules.DescriptionMaxChars > 0 {
+		runes := []rune(description)
+		if len(runes) > rules.DescriptionMaxChars {
+			description = string(runes[:rules.DescriptionMaxChars]) + "...(" + strconv.Itoa(len(runes)) + " chars)"
+		}
+	}
+	return rules.Redact(description)
+}
+
+// RedactLog masks sensitive values in a log message using the current rules
+func RedactLog(message string) string {
+	return CurrentLogRedactionRules().Redact(message)
+}
+
+// RedactLogFor masks sensitive values in a log message using the rules of the tenant ctx acts for
+func RedactLogFor(ctx context.Context, message string) string {
+	return LogRedactionRulesFor(ctx).Redact(message)
+}
+
+// RedactDescriptionFor prepares a description for logging using the rules of the tenant ctx acts for
+func RedactDescriptionFor(ctx context.Context, description string) string {
+	return LogRedactionRulesFor(ctx).RedactDescription(description)
+}
+
+// envBool reads a boolean environment variable, reporting whether it was set
+func envBool(key string) (bool, bool) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return false, false
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Warning: Ignoring invalid %s value %q", key, raw)
+		return false, false
+	}
+	return value, true
+}
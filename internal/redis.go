@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisDialTimeout  = 2 * time.Second
+	redisIOTimeout    = time.Second
+	redisMaxIdleConns = 8
+)
+
+// errRedisNil is returned for a nil bulk reply, e.g. GET on a missing key
+var errRedisNil = errors.New("redis: nil")
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// RedisCache is a Cache backed by Redis. It speaks just enough of the RESP protocol for
+// GET, SET and DEL and keeps a small pool of idle connections.
+type RedisCache struct {
+	addr     string
+	password string
+	database int
+	idle     chan *redisConn
+}
+
+// redisConn is one connection to the server
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisCache returns a cache for a redis:// URL such as redis://:password@localhost:6379/0.
+// Connections are opened lazily, so an unreachable server only shows up as cache errors.
+func NewRedisCache(rawURL string) (*RedisCache, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	if parsed.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid Redis URL: scheme must be redis, got %q", parsed.Scheme)
+	}
+
+	cache := &RedisCache{addr: parsed.Host, idle: make(chan *redisConn, redisMaxIdleConns)}
+	if parsed.Port() == "" {
+		cache.addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if password, ok := parsed.User.Password(); ok {
+		cache.password = password
+	}
+	if path := strings.TrimPrefix(parsed.Path, "/"); path != "" {
+		if cache.database, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	return cache, nil
+}
+
+// Get returns the value stored at key, or false if there is none
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err == errRedisNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value at key for ttl
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Delete removes keys
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// do sends one command and reads its reply. Connections are only returned to the pool after a
+// complete exchange, so a timeout never leaves a half-read reply for the next caller.
+func (c *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(redisIOTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.conn.SetDeadline(deadline)
+
+	reply, err := conn.exchange(args...)
+	if _, isReplyErr := err.(redisError); err != nil && err != errRedisNil && !isReplyErr {
+		conn.conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// get takes an idle connection or dials a new one
+func (c *RedisCache) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: redisDialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	netConn.SetDeadline(time.Now().Add(redisIOTimeout))
+
+	if c.password != "" {
+		if _, err := conn.exchange("AUTH", c.password); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	if c.database != 0 {
+		if _, err := conn.exchange("SELECT", strconv.Itoa(c.database)); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool, closing it when the pool is full
+func (c *RedisCache) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// exchange writes a command as a RESP array of bulk strings and reads the reply
+func (rc *redisConn) exchange(args ...string) (interface{}, error) {
+	if _, err := rc.conn.Write(encodeRESPCommand(args...)); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readRESP(rc.reader)
+}
+
+// encodeRESPCommand encodes a command as a RESP array of bulk strings
+func encodeRESPCommand(args ...string) []byte {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// readRESP reads one RESP reply: a string, an int64, []byte for bulk strings or
+// []interface{} for arrays. Nil replies return errRedisNil and error replies a redisError.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer %q", body)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if size < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if count < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readRESP(r)
+			if err != nil && err != errRedisNil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
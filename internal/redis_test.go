@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRESPCommand(t *testing.T) {
+	got := string(encodeRESPCommand("SET", "key", "a b", "PX", "1000"))
+	want := "*5\r\n$3\r\nSET\r\n$3\r\nkey\r\n$3\r\na b\r\n$2\r\nPX\r\n$4\r\n1000\r\n"
+	if got != want {
+		t.Errorf("encodeRESPCommand = %q, want %q", got, want)
+	}
+}
+
+func TestReadRESP(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr error
+	}{
+		{name: "simple string", input: "+OK\r\n", want: "OK"},
+		{name: "integer", input: ":2\r\n", want: int64(2)},
+		{name: "bulk string", input: "$5\r\nhe\r\nl\r\n", want: []byte("he\r\nl")},
+		{name: "nil bulk", input: "$-1\r\n", wantErr: errRedisNil},
+		{name: "error", input: "-WRONGPASS invalid password\r\n", wantErr: redisError("WRONGPASS invalid password")},
+		{name: "array", input: "*2\r\n$1\r\na\r\n:1\r\n", want: []interface{}{[]byte("a"), int64(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRESP(bufio.NewReader(strings.NewReader(tt.input)))
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readRESP = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRedisCache(t *testing.T) {
+	cache, err := NewRedisCache("redis://:secret@cache.internal/2")
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	if cache.addr != "cache.internal:6379" || cache.password != "secret" || cache.database != 2 {
+		t.Errorf("cache = %+v, want default port, password and database 2", cache)
+	}
+	if _, err := NewRedisCache("http://localhost:6379"); err == nil {
+		t.Error("accepted a non-redis URL")
+	}
+}
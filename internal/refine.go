@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	maxRefineInstructionLength = 1000
+	// maxRefinementExchanges is how many earlier instructions, each with the code answered to it,
+	// are sent along with a new one
+	maxRefinementExchanges = 10
+)
+
+// refineEditedTemplate introduces the saved code when it is none of Claude's answers, because the
+// owner edited it since, so the instruction applies to what they have now
+const refineEditedTemplate = "The sketch has been changed since then. This is the current code:\n\n%s\n\nApply the following change to it: %s"
+
+// ValidateRefineInstruction trims a follow-up instruction and checks it can be sent
+func ValidateRefineInstruction(instruction string) (string, error) {
+	instruction = strings.TrimSpace(instruction)
+	if instruction == "" {
+		return "", errors.New("instruction cannot be empty")
+	}
+	if len(instruction) > maxRefineInstructionLength {
+		return "", fmt.Errorf("instruction must be at most %d characters", maxRefineInstructionLength)
+	}
+	return instruction, nil
+}
+
+// refinementConversation returns the turns a refinement adds to an animation's conversation,
+// all but the reply, and the messages to send for it. An animation refined for the first time
+// starts from the prompt it could have been generated with and its saved code. Later instructions
+// follow on from Claude's last answer, which need not have been saved, unless the saved code was
+// edited since.
+func refinementConversation(turns []RefinementTurn, animation GetAnimationResponse, instruction string) ([]RefinementTurn, []ClaudeMessage) {
+	var added []RefinementTurn
+	if len(turns) == 0 {
+		added = []RefinementTurn{
+			{Role: "user", Content: BuildAnimationPrompt(PromptTemplate(PromptGenerate), animation.Description, "")},
+			{Role: "assistant", Content: animation.Code},
+		}
+	} else if !slices.ContainsFunc(turns, func(turn RefinementTurn) bool {
+		return turn.Role == "assistant" && turn.Content == animation.Code
+	}) {
+		instruction = fmt.Sprintf(refineEditedTemplate, animation.Code, instruction)
+	}
+	added = append(added, RefinementTurn{Role: "user", Content: instruction})
+
+	messages := make([]ClaudeMessage, 0, len(turns)+len(added))
+	for _, turn := range slices.Concat(turns, added) {
+		messages = append(messages, ClaudeMessage{Role: turn.Role, Content: turn.Content})
+	}
+	return added, messages
+}
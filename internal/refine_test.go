@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRefinementConversation(t *testing.T) {
+	animation := GetAnimationResponse{Description: "night sky", Code: "function draw() { stars(); }"}
+	earlier := []RefinementTurn{
+		{Role: "user", Content: "Draw a night sky"},
+		{Role: "assistant", Content: animation.Code},
+		{Role: "user", Content: "add more stars"},
+		{Role: "assistant", Content: "function draw() { stars(100); }"},
+	}
+
+	tests := []struct {
+		name        string
+		turns       []RefinementTurn
+		code        string
+		wantAdded   int
+		wantMessage string
+	}{
+		{name: "First refinement starts from the saved code", code: animation.Code, wantAdded: 3, wantMessage: "make it loop"},
+		{name: "Follows on from an unsaved answer", turns: earlier, code: animation.Code, wantAdded: 1, wantMessage: "make it loop"},
+		{name: "Follows on from a saved answer", turns: earlier, code: "function draw() { stars(100); }", wantAdded: 1, wantMessage: "make it loop"},
+		{name: "Edited since", turns: earlier, code: "function draw() { moon(); }", wantAdded: 1,
+			wantMessage: "The sketch has been changed since then. This is the current code:\n\nfunction draw() { moon(); }\n\nApply the following change to it: make it loop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := animation
+			current.Code = tt.code
+			added, messages := refinementConversation(tt.turns, current, "make it loop")
+			if len(added) != tt.wantAdded || len(messages) != len(tt.turns)+len(added) {
+				t.Fatalf("added %d turns and %d messages, want %d turns after the %d earlier ones", len(added), len(messages), tt.wantAdded, len(tt.turns))
+			}
+			if len(tt.turns) == 0 && (!strings.Contains(added[0].Content, "night sky") || added[1].Content != animation.Code) {
+				t.Errorf("conversation starts with %+v, want the prompt and saved code", added[:2])
+			}
+			for i, message := range messages {
+				if wantRole := []string{"user", "assistant"}[i%2]; message.Role != wantRole {
+					t.Errorf("message %d role = %q, want %q", i, message.Role, wantRole)
+				}
+			}
+			if last := messages[len(messages)-1]; last.Content != tt.wantMessage {
+				t.Errorf("instruction sent = %q, want %q", last.Content, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRefineAnimationHandler(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("CLAUDE_API_KEY", "house-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+
+	// Claude answers each refinement with a sketch numbered by how many messages it was sent
+	var sent [][]ClaudeMessage
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClaudeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req.Messages)
+		json.NewEncoder(w).Encode(ClaudeResponse{Content: []ClaudeContent{{Type: "text", Text: "function setup() {}\nfunction draw() { circle(" + strconv.Itoa(len(req.Messages)) + "); }"}}})
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	artist := registerAccount(t, router, "artist")
+	other := registerAccount(t, router, "other")
+	id, _ := store.SaveAnimation(ctx, "function setup() {}\nfunction draw() { stars(); }", "night sky", artist.User.ID, "")
+	path := "/animation/" + id + "/refine"
+
+	tests := []struct {
+		name         string
+		token        string
+		path         string
+		instruction  string
+		wantCode     int
+		wantMessages int
+	}{
+		{name: "Empty instruction", token: artist.Token, path: path, instruction: "  ", wantCode: http.StatusBadRequest},
+		{name: "Instruction too long", token: artist.Token, path: path, instruction: strings.Repeat("a", maxRefineInstructionLength+1), wantCode: http.StatusBadRequest},
+		{name: "Not the owner", token: other.Token, path: path, instruction: "add more stars", wantCode: http.StatusForbidden},
+		{name: "Unknown animation", token: artist.Token, path: "/animation/missing/refine", instruction: "add more stars", wantCode: http.StatusNotFound},
+		{name: "First refinement", token: artist.Token, path: path, instruction: "add more stars", wantCode: http.StatusOK, wantMessages: 3},
+		{name: "Follow-up keeps the conversation", token: artist.Token, path: path, instruction: "make it loop seamlessly", wantCode: http.StatusOK, wantMessages: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent = nil
+			var response AnimationResponse
+			if code := doJSON(t, router, http.MethodPost, tt.path, tt.token, RefineRequest{Instruction: tt.instruction}, &response); code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantMessages == 0 {
+				if len(sent) != 0 {
+					t.Errorf("Claude was called %d times, want none", len(sent))
+				}
+				return
+			}
+			if len(sent) != 1 || len(sent[0]) != tt.wantMessages {
+				t.Fatalf("sent %v, want one call with %d messages", sent, tt.wantMessages)
+			}
+			if last := sent[0][len(sent[0])-1]; last.Content != strings.TrimSpace(tt.instruction) {
+				t.Errorf("last message = %q, want the instruction", last.Content)
+			}
+			if !strings.Contains(response.Code, "circle("+strconv.Itoa(tt.wantMessages)+")") {
+				t.Errorf("code = %q, want Claude's answer", response.Code)
+			}
+		})
+	}
+
+	// The follow-up was sent after the first answer, which was not saved
+	turns, _ := store.ListRefinementTurns(ctx, id, artist.User.ID, 2*maxRefinementExchanges)
+	if len(turns) != 6 || !strings.Contains(turns[3].Content, "circle(3)") || !strings.Contains(turns[5].Content, "circle(5)") {
+		t.Errorf("stored conversation = %+v, want the prompt, saved code and two exchanges", turns)
+	}
+}
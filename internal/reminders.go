@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+const (
+	// maxRemindersPerDay caps how many reminder times a user can choose
+	maxRemindersPerDay = 6
+	// reminderCheckInWindow is how soon after a reminder a mood must be recorded to answer it
+	reminderCheckInWindow = 12 * time.Hour
+	// reminderAdherenceDays is how far back GET /me/reminders summarizes adherence
+	reminderAdherenceDays = 30
+	// reminderSessionMaxAge is how long reminders keep linking to an animation a professional recommended
+	reminderSessionMaxAge = 7 * 24 * time.Hour
+	reminderBatchSize     = 50
+	reminderCheckInterval = time.Minute
+)
+
+// ValidateReminderSchedule checks a schedule's times and timezone, and sorts its times and removes
+// repeated ones
+func ValidateReminderSchedule(schedule *ReminderSchedule) error {
+	if schedule.Times == nil {
+		schedule.Times = []string{}
+	}
+	for _, value := range schedule.Times {
+		if _, err := parseClock(value); err != nil {
+			return err
+		}
+	}
+	slices.Sort(schedule.Times)
+	schedule.Times = slices.Compact(schedule.Times)
+	if len(schedule.Times) > maxRemindersPerDay {
+		return fmt.Errorf("at most %d reminders a day", maxRemindersPerDay)
+	}
+	if schedule.Timezone == "" {
+		if len(schedule.Times) > 0 {
+			return errors.New("reminders need a timezone")
+		}
+		schedule.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", schedule.Timezone)
+	}
+	return nil
+}
+
+// nextReminder returns the first of the schedule's times after after, and false without times
+func (s ReminderSchedule) nextReminder(after time.Time) (time.Time, bool) {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := after.In(location)
+	var next time.Time
+	for days := 0; days <= 1; days++ {
+		for _, value := range s.Times {
+			minute, err := parseClock(value)
+			if err != nil {
+				continue
+			}
+			at := time.Date(local.Year(), local.Month(), local.Day()+days, minute/60, minute%60, 0, 0, location)
+			if at.After(after) && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// summarizeAdherence counts the reminders sent and answered, newest first, and the days in a row
+// in location on which one was answered. Today only extends the streak, since it can still be answered.
+func summarizeAdherence(deliveries []ReminderDelivery, location *time.Location, now time.Time) ReminderAdherence {
+	adherence := ReminderAdherence{Days: reminderAdherenceDays, Sent: len(deliveries)}
+	answered := make(map[string]bool)
+	for _, delivery := range deliveries {
+		if delivery.CheckedInAt != nil {
+			adherence.CheckedIn++
+			answered[delivery.SentAt.In(location).Format(time.DateOnly)] = true
+		}
+	}
+
+	day := now.In(location)
+	if !answered[day.Format(time.DateOnly)] {
+		day = day.AddDate(0, 0, -1)
+	}
+	for answered[day.Format(time.DateOnly)] {
+		adherence.Streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	return adherence
+}
+
+// reminderAnimation picks the animation a reminder links to: the latest one a professional
+// recommended to the user this week, otherwise one from the feed that suits their content preferences.
+// It returns an empty ID when there is none.
+func reminderAnimation(ctx context.Context, store Store, userId string) (id, description string) {
+	if sessions, err := store.ListClientSessions(ctx, userId); err != nil {
+		log.Printf("[REMINDER] Failed to list sessions of user %s: %v", userId, err)
+	} else if len(sessions) > 0 && time.Since(sessions[0].CreatedAt) < reminderSessionMaxAge {
+		return sessions[0].AnimationID, sessions[0].Description
+	}
+
+	filter := FeedFilter{MaxMotionScore: ReducedMotionMaxChange()}
+	if preferences, err := store.GetContentPreferences(ctx, userId); err == nil {
+		filter.ReducedMotion = preferences.ReduceMotion
+		filter.AvoidFlashing = preferences.AvoidFlashing
+	}
+	animation, err := store.GetRandomAnimation(ctx, filter)
+	if err != nil {
+		if err.Error() != "no animations found" {
+			log.Printf("[REMINDER] Failed to pick an animation for user %s: %v", userId, err)
+		}
+		return "", ""
+	}
+	return animation.ID, animation.Description
+}
+
+// sendMoodReminder nudges a user to check in with their mood and records the reminder for adherence
+func sendMoodReminder(ctx context.Context, store Store, mailer Mailer, userId string) {
+	body := "It's time for your mood check-in."
+	animationId, description := reminderAnimation(ctx, store, userId)
+	if animationId != "" {
+		body += "\n\nToday's animation"
+		if description != "" {
+			body += ", " + description
+		}
+		body += ":\n" + PublicURL("/animation/"+animationId)
+	}
+	body += "\n\nAfterwards, record how you feel. You can change your reminder times in the app."
+
+	if !notifyUser(ctx, store, mailer, userId, NotificationMoodReminder, "Time for your mood check-in", body) {
+		return
+	}
+	if err := store.RecordReminderSent(ctx, userId, animationId); err != nil {
+		log.Printf("[REMINDER] Failed to record reminder for user %s: %v", userId, err)
+	}
+}
+
+// sendDueReminders reminds a batch of users whose reminder is due, schedules their next one and
+// returns how many it claimed
+func sendDueReminders(ctx context.Context, store Store, mailer Mailer) (int, error) {
+	due, err := store.ClaimDueReminders(ctx, reminderBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, reminder := range due {
+		sendMoodReminder(ctx, store, mailer, reminder.UserID)
+		next, _ := reminder.Schedule.nextReminder(time.Now())
+		if err := store.SetNextReminder(ctx, reminder.UserID, next); err != nil {
+			log.Printf("[REMINDER] Failed to schedule the next reminder for user %s: %v", reminder.UserID, err)
+		}
+	}
+	return len(due), nil
+}
+
+// RunReminderScheduler sends mood check-in reminders in every region as they come due, until ctx
+// is done
+func RunReminderScheduler(ctx context.Context, store Store) {
+	ticker := time.NewTicker(reminderCheckInterval)
+	defer ticker.Stop()
+	for {
+		err := drainEveryDataRegion(ctx, reminderBatchSize, func(ctx context.Context) (int, error) {
+			return sendDueReminders(ctx, store, GetMailer())
+		})
+		if err != nil {
+			log.Printf("[REMINDER] Failed to claim due reminders: %v", err)
+		}
+		recordWorkerPass("mood reminders", reminderCheckInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateReminderSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedule  ReminderSchedule
+		wantTimes []string
+		wantErr   bool
+	}{
+		{name: "Off", wantTimes: []string{}},
+		{name: "Sorted without repeats", schedule: ReminderSchedule{Times: []string{"20:00", "08:30", "20:00"}, Timezone: "Europe/Berlin"},
+			wantTimes: []string{"08:30", "20:00"}},
+		{name: "Missing timezone", schedule: ReminderSchedule{Times: []string{"08:30"}}, wantErr: true},
+		{name: "Invalid time", schedule: ReminderSchedule{Times: []string{"8am"}, Timezone: "UTC"}, wantErr: true},
+		{name: "Too many", schedule: ReminderSchedule{Times: []string{"01:00", "02:00", "03:00", "04:00", "05:00", "06:00", "07:00"}, Timezone: "UTC"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReminderSchedule(&tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateReminderSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(tt.schedule.Times, tt.wantTimes) {
+				t.Errorf("times = %v, want %v", tt.schedule.Times, tt.wantTimes)
+			}
+		})
+	}
+}
+
+func TestNextReminder(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := ReminderSchedule{Times: []string{"08:30", "20:00"}, Timezone: "Asia/Tokyo"}
+	tests := []struct {
+		name  string
+		after time.Time
+		want  time.Time
+	}{
+		{name: "Later today", after: time.Date(2026, 3, 1, 9, 0, 0, 0, tokyo), want: time.Date(2026, 3, 1, 20, 0, 0, 0, tokyo)},
+		{name: "Tomorrow", after: time.Date(2026, 3, 1, 20, 0, 0, 0, tokyo), want: time.Date(2026, 3, 2, 8, 30, 0, 0, tokyo)},
+		{name: "In the user's timezone", after: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 3, 1, 20, 0, 0, 0, tokyo)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := schedule.nextReminder(tt.after); !ok || !got.Equal(tt.want) {
+				t.Errorf("nextReminder() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+	if _, ok := (ReminderSchedule{Times: []string{}, Timezone: "UTC"}).nextReminder(time.Now()); ok {
+		t.Error("nextReminder() without times found a reminder")
+	}
+}
+
+func TestSummarizeAdherence(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := func(daysAgo int, answered bool) ReminderDelivery {
+		sentAt := now.AddDate(0, 0, -daysAgo).Add(-time.Hour)
+		delivery := ReminderDelivery{SentAt: sentAt}
+		if answered {
+			checkedInAt := sentAt.Add(time.Hour)
+			delivery.CheckedInAt = &checkedInAt
+		}
+		return delivery
+	}
+	tests := []struct {
+		name       string
+		deliveries []ReminderDelivery
+		want       ReminderAdherence
+	}{
+		{name: "None", want: ReminderAdherence{Days: reminderAdherenceDays}},
+		{name: "Answered today", deliveries: []ReminderDelivery{day(0, true), day(1, true), day(3, true)},
+			want: ReminderAdherence{Days: reminderAdherenceDays, Sent: 3, CheckedIn: 3, Streak: 2}},
+		{name: "Today still open", deliveries: []ReminderDelivery{day(0, false), day(1, true), day(2, true)},
+			want: ReminderAdherence{Days: reminderAdherenceDays, Sent: 3, CheckedIn: 2, Streak: 2}},
+		{name: "Missed yesterday", deliveries: []ReminderDelivery{day(0, false), day(1, false), day(2, true)},
+			want: ReminderAdherence{Days: reminderAdherenceDays, Sent: 3, CheckedIn: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeAdherence(tt.deliveries, time.UTC, now); got != tt.want {
+				t.Errorf("summarizeAdherence() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendDueReminders(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	userId, err := store.CreateUserWithUsername(ctx, "viewer@example.com", "viewer", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	animationId, err := store.SaveAnimation(ctx, "function draw() {}", "slow tide", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := ReminderSchedule{Times: []string{"08:30"}, Timezone: "UTC"}
+	if err := store.SaveReminderSchedule(ctx, userId, schedule, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := &fakeMailer{}
+	if count, err := sendDueReminders(ctx, store, mailer); err != nil || count != 1 {
+		t.Fatalf("sendDueReminders() = %d, %v, want 1 reminded", count, err)
+	}
+	if want := []string{"viewer@example.com: Time for your mood check-in"}; !reflect.DeepEqual(mailer.sent, want) {
+		t.Errorf("sent %v, want %v", mailer.sent, want)
+	}
+	deliveries, _ := store.ListReminderDeliveries(ctx, userId, time.Hour)
+	if len(deliveries) != 1 || deliveries[0].AnimationID != animationId {
+		t.Errorf("deliveries = %+v, want one linking to %s", deliveries, animationId)
+	}
+	if next := store.reminders[userId].nextAt; !next.After(time.Now()) {
+		t.Errorf("next reminder at %v, want it moved to the next 08:30", next)
+	}
+
+	// Nothing is due until then
+	if count, _ := sendDueReminders(ctx, store, mailer); count != 0 {
+		t.Errorf("sendDueReminders() reminded %d users again", count)
+	}
+}
+
+func TestRemindersHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	account := registerAccount(t, router, "viewer")
+
+	var got RemindersResponse
+	update := ReminderSchedule{Times: []string{"21:00", "07:45"}, Timezone: "America/Chicago"}
+	if code := doJSON(t, router, http.MethodPut, "/me/reminders", account.Token, update, &got); code != http.StatusOK {
+		t.Fatalf("put status = %d", code)
+	}
+	if !reflect.DeepEqual(got.Times, []string{"07:45", "21:00"}) || got.NextReminderAt == nil {
+		t.Errorf("reminders = %+v, want sorted times and the next reminder", got)
+	}
+
+	// A reminder answered with a mood counts toward the streak
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", account.Token, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	if err := store.RecordReminderSent(context.Background(), account.User.ID, saved.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/save-mood", account.Token, SaveMoodRequest{AnimationID: saved.ID, Mood: MoodBetter, PlaybackSession: playAnimation(t, router, account.Token, saved.ID)}, nil); code != http.StatusOK {
+		t.Fatalf("save mood status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/me/reminders", account.Token, nil, &got); code != http.StatusOK {
+		t.Fatalf("get status = %d", code)
+	}
+	if want := (ReminderAdherence{Days: reminderAdherenceDays, Sent: 1, CheckedIn: 1, Streak: 1}); got.Adherence != want {
+		t.Errorf("adherence = %+v, want %+v", got.Adherence, want)
+	}
+
+	invalid := ReminderSchedule{Times: []string{"07:45"}, Timezone: "Nowhere/Special"}
+	if code := doJSON(t, router, http.MethodPut, "/me/reminders", account.Token, invalid, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown timezone status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
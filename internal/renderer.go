@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the headless sketch renderer
+const (
+	defaultRendererPoolSize = 2
+	defaultRenderFrames     = 60
+	defaultRenderTimeout    = 20 * time.Second
+	determinismSeed         = 42
+)
+
+// Render statuses stored on animations
+const (
+	RenderStatusUnchecked        = "unchecked"
+	RenderStatusOK               = "ok"
+	RenderStatusNondeterministic = "nondeterministic"
+	RenderStatusCrashed          = "crashed"
+)
+
+// RenderRequest is sent as JSON on stdin to the renderer command. CaptureFrames lists
+// frame numbers whose canvas should be returned as PNG images.
+type RenderRequest struct {
+	Code          string `json:"code"`
+	Seed          int64  `json:"seed"`
+	Frames        int    `json:"frames"`
+	TimeoutMs     int    `json:"timeoutMs"`
+	CaptureFrames []int  `json:"captureFrames,omitempty"`
+}
+
+// RenderResult is read as JSON from the renderer command's stdout.
+// Error holds the sketch's runtime exception, if any. AvgFrameMs and HeapUsedBytes
+// are optional measurements used by the performance budget, and FrameStats by the
+// photosensitivity screen. Captures holds the base64-encoded PNGs of the requested
+// CaptureFrames, in the same order.
+type RenderResult struct {
+	FrameHashes   []string     `json:"frameHashes"`
+	FrameStats    []FrameStats `json:"frameStats,omitempty"`
+	Captures      []string     `json:"captures,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	AvgFrameMs    float64      `json:"avgFrameMs,omitempty"`
+	HeapUsedBytes int64        `json:"heapUsedBytes,omitempty"`
+}
+
+// SketchRenderer runs sketch code headlessly
+type SketchRenderer interface {
+	Render(ctx context.Context, req RenderRequest) (RenderResult, error)
+}
+
+// commandRenderer runs an external headless browser command, limiting how many run at once
+type commandRenderer struct {
+	command []string
+	slots   chan struct{}
+}
+
+// Render runs the renderer command for one request, waiting for a free slot in the pool
+func (c *commandRenderer) Render(ctx context.Context, req RenderRequest) (RenderResult, error) {
+	select {
+	case c.slots <- struct{}{}:
+		defer func() { <-c.slots }()
+	case <-ctx.Done():
+		return RenderResult{}, fmt.Errorf("waiting for renderer: %w", ctx.Err())
+	}
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return RenderResult{}, fmt.Errorf("failed to marshal render request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(req.TimeoutMs)*time.Millisecond+5*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return RenderResult{}, fmt.Errorf("renderer failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var result RenderResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return RenderResult{}, fmt.Errorf("failed to parse renderer output: %w", err)
+	}
+	return result, nil
+}
+
+var (
+	rendererOnce   sync.Once
+	sketchRenderer SketchRenderer
+)
+
+// GetSketchRenderer returns the shared renderer, or false when no renderer is configured. It runs
+// SKETCH_RENDERER_COMMAND when that is set, and otherwise drives the Chromium binary at
+// CHROMIUM_PATH. RENDERER_POOL_SIZE bounds how many sketches either renders at once.
+func GetSketchRenderer() (SketchRenderer, bool) {
+	rendererOnce.Do(func() {
+		poolSize := envLimit("RENDERER_POOL_SIZE", defaultRendererPoolSize)
+		if poolSize == 0 {
+			poolSize = defaultRendererPoolSize
+		}
+		if command := strings.Fields(os.Getenv("SKETCH_RENDERER_COMMAND")); len(command) > 0 {
+			sketchRenderer = &commandRenderer{command: command, slots: make(chan struct{}, poolSize)}
+			return
+		}
+		if path := os.Getenv("CHROMIUM_PATH"); path != "" {
+			sketchRenderer = newChromiumRenderer(path, RendererP5URL(), poolSize)
+			return
+		}
+		log.Println("[RENDER] Neither SKETCH_RENDERER_COMMAND nor CHROMIUM_PATH is set, headless rendering disabled")
+	})
+	return sketchRenderer, sketchRenderer != nil
+}
+
+// DeterminismReport is the outcome of rendering a sketch twice with the same seed
+type DeterminismReport struct {
+	AnimationID         string `json:"animationId,omitempty"`
+	Status              string `json:"status"`
+	FramesCompared      int    `json:"framesCompared"`
+	FirstDifferingFrame int    `json:"firstDifferingFrame,omitempty"`
+	Error               string `json:"error,omitempty"`
+	// Photosensitivity is screened from the first render when the renderer reports frame stats
+	Photosensitivity *PhotosensitivityReport `json:"photosensitivity,omitempty"`
+}
+
+// CheckDeterminism renders code twice with a fixed seed and compares the frames.
+// A sketch that throws is reported as crashed; one whose frames differ as nondeterministic.
+func CheckDeterminism(ctx context.Context, renderer SketchRenderer, code string) (DeterminismReport, error) {
+	req := RenderRequest{
+		Code:      code,
+		Seed:      determinismSeed,
+		Frames:    defaultRenderFrames,
+		TimeoutMs: int(defaultRenderTimeout / time.Millisecond),
+	}
+
+	var runs [2]RenderResult
+	for i := range runs {
+		result, err := renderer.Render(ctx, req)
+		if err != nil {
+			return DeterminismReport{}, err
+		}
+		if result.Error != "" {
+			return DeterminismReport{Status: RenderStatusCrashed, Error: result.Error}, nil
+		}
+		runs[i] = result
+	}
+
+	first, second := runs[0].FrameHashes, runs[1].FrameHashes
+	if len(first) == 0 {
+		return DeterminismReport{}, errors.New("renderer returned no frames")
+	}
+
+	report := DeterminismReport{Status: RenderStatusOK, FramesCompared: len(first)}
+	if len(runs[0].FrameStats) > 0 {
+		screen := ScreenPhotosensitivity(runs[0].FrameStats)
+		report.Photosensitivity = &screen
+	}
+	for i := range first {
+		if i >= len(second) || first[i] != second[i] {
+			report.Status = RenderStatusNondeterministic
+			report.FirstDifferingFrame = i + 1
+			break
+		}
+	}
+	if report.Status == RenderStatusOK && len(second) != len(first) {
+		report.Status = RenderStatusNondeterministic
+		report.FirstDifferingFrame = len(first) + 1
+	}
+	return report, nil
+}
+
+// Defaults for smoke testing newly generated sketches
+const (
+	smokeTestFrames            = 120 // about two seconds at 60fps
+	smokeTestTimeout           = 2 * time.Second
+	defaultSmokeTestMaxRepairs = 1
+)
+
+// SmokeTestResult reports whether generated code survived its first seconds of running
+type SmokeTestResult struct {
+	Passed  bool   `json:"passed"`
+	Error   string `json:"error,omitempty"`
+	Repairs int    `json:"repairs"`
+}
+
+// SmokeTestEnabled reports whether generated code should be smoke tested, configured by SMOKE_TEST_GENERATED
+func SmokeTestEnabled() bool {
+	enabled, _ := envBool("SMOKE_TEST_GENERATED")
+	return enabled
+}
+
+// SmokeTestMaxRepairs returns how many repair attempts a failing sketch gets, configured by SMOKE_TEST_MAX_REPAIRS
+func SmokeTestMaxRepairs() int {
+	return envLimit("SMOKE_TEST_MAX_REPAIRS", defaultSmokeTestMaxRepairs)
+}
+
+// SmokeTestWithRepairs runs code briefly and, while it throws, hands the error to repair
+// up to maxRepairs times. It returns the last code tried along with the outcome.
+func SmokeTestWithRepairs(ctx context.Context, renderer SketchRenderer, code string, maxRepairs int, repair func(code, errorMessage string) (string, error)) (string, SmokeTestResult, error) {
+	result := SmokeTestResult{}
+	for {
+		rendered, err := renderer.Render(ctx, RenderRequest{
+			Code:      code,
+			Seed:      determinismSeed,
+			Frames:    smokeTestFrames,
+			TimeoutMs: int(smokeTestTimeout / time.Millisecond),
+		})
+		if err != nil {
+			return code, result, err
+		}
+
+		result.Error = rendered.Error
+		result.Passed = rendered.Error == ""
+		if result.Passed || result.Repairs >= maxRepairs {
+			return code, result, nil
+		}
+
+		log.Printf("[RENDER] Generated sketch failed smoke test, requesting repair: %s", RedactLogFor(ctx, rendered.Error))
+		repaired, err := repair(code, rendered.Error)
+		if err != nil {
+			return code, result, fmt.Errorf("failed to repair sketch: %w", err)
+		}
+		code = repaired
+		result.Repairs++
+	}
+}
+
+// MeasureSketch runs code briefly to collect frame time and heap measurements
+func MeasureSketch(ctx context.Context, renderer SketchRenderer, code string) (RenderResult, error) {
+	return renderer.Render(ctx, RenderRequest{
+		Code:      code,
+		Seed:      determinismSeed,
+		Frames:    smokeTestFrames,
+		TimeoutMs: int(smokeTestTimeout / time.Millisecond),
+	})
+}
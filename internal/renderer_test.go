@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+// fakeRenderer returns canned results, one per call
+type fakeRenderer struct {
+	results []RenderResult
+	calls   int
+}
+
+func (f *fakeRenderer) Render(ctx context.Context, req RenderRequest) (RenderResult, error) {
+	result := f.results[f.calls%len(f.results)]
+	f.calls++
+	return result, nil
+}
+
+func TestCheckDeterminism(t *testing.T) {
+	tests := []struct {
+		name       string
+		results    []RenderResult
+		wantStatus string
+		wantFrame  int
+	}{
+		{
+			name:       "Identical frames",
+			results:    []RenderResult{{FrameHashes: []string{"a", "b"}}},
+			wantStatus: RenderStatusOK,
+		},
+		{
+			name: "Frames differ",
+			results: []RenderResult{
+				{FrameHashes: []string{"a", "b", "c"}},
+				{FrameHashes: []string{"a", "x", "c"}},
+			},
+			wantStatus: RenderStatusNondeterministic,
+			wantFrame:  2,
+		},
+		{
+			name:       "Sketch throws",
+			results:    []RenderResult{{Error: "ReferenceError: x is not defined"}},
+			wantStatus: RenderStatusCrashed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := CheckDeterminism(context.Background(), &fakeRenderer{results: tt.results}, "function setup() {}")
+			if err != nil {
+				t.Fatalf("CheckDeterminism() error = %v", err)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", report.Status, tt.wantStatus)
+			}
+			if report.FirstDifferingFrame != tt.wantFrame {
+				t.Errorf("FirstDifferingFrame = %d, want %d", report.FirstDifferingFrame, tt.wantFrame)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	t.Setenv("ADMIN_USER_IDS", "admin-1, admin-2")
+
+	if !IsAdmin("admin-2") {
+		t.Error("admin-2 should be an admin")
+	}
+	if IsAdmin("user-1") || IsAdmin("") {
+		t.Error("only listed users should be admins")
+	}
+}
+
+func TestSmokeTestWithRepairs(t *testing.T) {
+	renderer := &fakeRenderer{results: []RenderResult{
+		{Error: "TypeError: cannot read properties of undefined"},
+		{FrameHashes: []string{"a"}},
+	}}
+
+	var repairedError string
+	repair := func(code, errorMessage string) (string, error) {
+		repairedError = errorMessage
+		return "fixed", nil
+	}
+
+	code, result, err := SmokeTestWithRepairs(context.Background(), renderer, "broken", 1, repair)
+	if err != nil {
+		t.Fatalf("SmokeTestWithRepairs() error = %v", err)
+	}
+	if code != "fixed" || !result.Passed || result.Repairs != 1 {
+		t.Errorf("got code %q and result %+v, want repaired passing sketch", code, result)
+	}
+	if repairedError != "TypeError: cannot read properties of undefined" {
+		t.Errorf("repair received error %q", repairedError)
+	}
+
+	renderer = &fakeRenderer{results: []RenderResult{{Error: "boom"}}}
+	_, result, err = SmokeTestWithRepairs(context.Background(), renderer, "broken", 0, repair)
+	if err != nil {
+		t.Fatalf("SmokeTestWithRepairs() error = %v", err)
+	}
+	if result.Passed || result.Repairs != 0 || result.Error != "boom" {
+		t.Errorf("result = %+v, want failure without repairs", result)
+	}
+}
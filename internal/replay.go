@@ -0,0 +1,369 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Defaults for the replay log
+const (
+	defaultReplaySamplePercent = 100
+	// replayBufferSize is how many entries may wait to be written before new ones are dropped
+	replayBufferSize = 1024
+	replayIDPoolSize = 100
+)
+
+// replayQueryParams are the query parameters recorded with their values; they carry no user data.
+// Every other parameter is recorded by name only.
+var replayQueryParams = map[string]bool{"limit": true, "offset": true, "count": true, "reducedMotion": true}
+
+// routeParamPattern matches a path variable in a route template, such as {id} or {linkId:[0-9]+}
+var routeParamPattern = regexp.MustCompile(`\{[^}]+\}`)
+
+// ReplayEntry is one recorded request. It holds no bodies, headers, IP addresses, user IDs or path
+// variables, so the log can leave production.
+type ReplayEntry struct {
+	At     time.Time `json:"at"`
+	Method string    `json:"method"`
+	// Route is the matched route template, such as /animation/{id}
+	Route string `json:"route"`
+	// Query holds the values of the parameters in replayQueryParams
+	Query map[string]string `json:"query,omitempty"`
+	// RedactedParams names the other query parameters the request had
+	RedactedParams []string `json:"redactedParams,omitempty"`
+	Authenticated  bool     `json:"authenticated"`
+	Status         int      `json:"status"`
+	DurationMs     float64  `json:"durationMs"`
+	RequestBytes   int64    `json:"requestBytes"`
+	ResponseBytes  int64    `json:"responseBytes"`
+}
+
+// sanitizeReplayEntry describes a served request without any of its content
+func sanitizeReplayEntry(r *http.Request, route string, status int, duration time.Duration, responseBytes int64, at time.Time) ReplayEntry {
+	entry := ReplayEntry{
+		At:            at.UTC(),
+		Method:        r.Method,
+		Route:         route,
+		Authenticated: r.Header.Get("Authorization") != "",
+		Status:        status,
+		DurationMs:    float64(duration.Microseconds()) / 1000,
+		RequestBytes:  max(r.ContentLength, 0),
+		ResponseBytes: responseBytes,
+	}
+	for name, values := range r.URL.Query() {
+		if !replayQueryParams[name] {
+			entry.RedactedParams = append(entry.RedactedParams, name)
+			continue
+		}
+		if entry.Query == nil {
+			entry.Query = map[string]string{}
+		}
+		entry.Query[name] = values[0]
+	}
+	sort.Strings(entry.RedactedParams)
+	return entry
+}
+
+// ReplayRecorderMiddleware appends a sanitized entry for a sample of requests to REPLAY_LOG_FILE,
+// one JSON object per line. Recording is off when the file is not set. Entries are written in the
+// background; when the writer falls behind, entries are dropped rather than slowing requests down.
+// It must be registered on the router so the matched route is known.
+func ReplayRecorderMiddleware() func(http.Handler) http.Handler {
+	path := os.Getenv("REPLAY_LOG_FILE")
+	if path == "" {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("[REPLAY] Not recording requests, failed to open %s: %v", path, err)
+		return func(next http.Handler) http.Handler { return next }
+	}
+	samplePercent := envPercentOrAll("REPLAY_SAMPLE_PERCENT", defaultReplaySamplePercent)
+	log.Printf("[REPLAY] Recording %.0f%% of requests to %s", samplePercent, path)
+
+	entries := make(chan ReplayEntry, replayBufferSize)
+	go writeReplayEntries(file, entries)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions || rand.Float64()*100 >= samplePercent {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			wrw := newResponseWriter(w)
+			next.ServeHTTP(wrw, r)
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			select {
+			case entries <- sanitizeReplayEntry(r, route, wrw.statusCode, time.Since(start), wrw.bytes, start):
+			default:
+			}
+		})
+	}
+}
+
+// envPercentOrAll reads a sampling percentage from 0 to 100 from key
+func envPercentOrAll(key string, fallback float64) float64 {
+	if percent := envLimit(key, int(fallback)); percent <= 100 {
+		return float64(percent)
+	}
+	log.Printf("Warning: Ignoring invalid %s value %q", key, os.Getenv(key))
+	return fallback
+}
+
+// writeReplayEntries writes entries to w as JSON lines, flushing whenever the queue drains
+func writeReplayEntries(w io.Writer, entries <-chan ReplayEntry) {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			log.Printf("[REPLAY] Failed to write entry: %v", err)
+		}
+		if len(entries) == 0 {
+			if err := buffered.Flush(); err != nil {
+				log.Printf("[REPLAY] Failed to flush replay log: %v", err)
+			}
+		}
+	}
+}
+
+// LoadReplayLog reads a replay log written by ReplayRecorderMiddleware, oldest entry first
+func LoadReplayLog(r io.Reader) ([]ReplayEntry, error) {
+	var entries []ReplayEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry ReplayEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	return entries, nil
+}
+
+// ReplayOptions controls how a replay log is sent to a target server
+type ReplayOptions struct {
+	// Target is the base URL of the server to replay against, such as https://staging.example.com
+	Target string
+	// Speed scales the recorded timing: 2 replays twice as fast, 0 sends requests back to back
+	Speed float64
+	// Concurrency caps the requests in flight
+	Concurrency int
+	// Token is sent as a bearer token on requests that were authenticated when recorded
+	Token string
+	// Fill is the value sent for redacted query parameters
+	Fill string
+	// IDs are substituted in turn for {id} in routes
+	IDs    []string
+	Client *http.Client
+}
+
+// ReplayRouteStats summarizes the replayed requests of one route
+type ReplayRouteStats struct {
+	Requests       int     `json:"requests"`
+	Failures       int     `json:"failures"`
+	P50Ms          float64 `json:"p50Ms"`
+	P95Ms          float64 `json:"p95Ms"`
+	RecordedP95Ms  float64 `json:"recordedP95Ms"`
+	latencies      []float64
+	recordedMillis []float64
+}
+
+// ReplayReport summarizes a replay
+type ReplayReport struct {
+	Sent int `json:"sent"`
+	// Skipped counts entries that cannot be replayed safely: writes, and routes with path
+	// variables other than {id}
+	Skipped int `json:"skipped"`
+	// Failures counts transport errors and 5xx responses
+	Failures int `json:"failures"`
+	// Lag is how far behind the recorded schedule the last request was sent
+	LagMs    float64                      `json:"lagMs"`
+	Duration string                       `json:"duration"`
+	Routes   map[string]*ReplayRouteStats `json:"routes"`
+}
+
+// replayPath fills in a route's path variables, or returns false when it cannot be replayed
+func replayPath(entry ReplayEntry, ids []string, n int, fill string) (string, bool) {
+	if entry.Method != http.MethodGet && entry.Method != http.MethodHead {
+		return "", false
+	}
+	ok := true
+	path := routeParamPattern.ReplaceAllStringFunc(entry.Route, func(param string) string {
+		if param != "{id}" || len(ids) == 0 {
+			ok = false
+			return param
+		}
+		return url.PathEscape(ids[n%len(ids)])
+	})
+	if !ok {
+		return "", false
+	}
+
+	query := url.Values{}
+	for name, value := range entry.Query {
+		query.Set(name, value)
+	}
+	for _, name := range entry.RedactedParams {
+		query.Set(name, fill)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, true
+}
+
+// percentileMs returns the p-th percentile of sorted latencies
+func percentileMs(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p/100)]
+}
+
+// Replay sends the replayable entries to opts.Target on their recorded schedule, scaled by
+// opts.Speed, and reports the latency of each route next to the recorded one
+func Replay(ctx context.Context, entries []ReplayEntry, opts ReplayOptions) ReplayReport {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	concurrency := max(opts.Concurrency, 1)
+	report := ReplayReport{Routes: map[string]*ReplayRouteStats{}}
+	if len(entries) == 0 {
+		return report
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	start := time.Now()
+	first := entries[0].At
+
+	for i, entry := range entries {
+		path, ok := replayPath(entry, opts.IDs, i, opts.Fill)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		if opts.Speed > 0 {
+			due := start.Add(time.Duration(float64(entry.At.Sub(first)) / opts.Speed))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(due)):
+			}
+			if lag := time.Since(due); lag > 0 {
+				report.LagMs = float64(lag.Microseconds()) / 1000
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(entry ReplayEntry, path string) {
+			defer func() { <-slots; wg.Done() }()
+			failed := false
+			sent := time.Now()
+			req, err := http.NewRequestWithContext(ctx, entry.Method, strings.TrimRight(opts.Target, "/")+path, nil)
+			if err == nil {
+				if entry.Authenticated && opts.Token != "" {
+					req.Header.Set("Authorization", "Bearer "+opts.Token)
+				}
+				var resp *http.Response
+				if resp, err = opts.Client.Do(req); err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					failed = resp.StatusCode >= http.StatusInternalServerError
+				}
+			}
+			if err != nil {
+				failed = true
+			}
+			elapsed := float64(time.Since(sent).Microseconds()) / 1000
+
+			mu.Lock()
+			defer mu.Unlock()
+			stats, ok := report.Routes[entry.Method+" "+entry.Route]
+			if !ok {
+				stats = &ReplayRouteStats{}
+				report.Routes[entry.Method+" "+entry.Route] = stats
+			}
+			report.Sent++
+			stats.Requests++
+			stats.latencies = append(stats.latencies, elapsed)
+			stats.recordedMillis = append(stats.recordedMillis, entry.DurationMs)
+			if failed {
+				report.Failures++
+				stats.Failures++
+			}
+		}(entry, path)
+	}
+	wg.Wait()
+
+	for _, stats := range report.Routes {
+		sort.Float64s(stats.latencies)
+		sort.Float64s(stats.recordedMillis)
+		stats.P50Ms = percentileMs(stats.latencies, 50)
+		stats.P95Ms = percentileMs(stats.latencies, 95)
+		stats.RecordedP95Ms = percentileMs(stats.recordedMillis, 95)
+	}
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+	return report
+}
+
+// FetchReplayIDs returns the IDs of animations on the target's feed, to stand in for the recorded
+// requests' {id} path variables
+func FetchReplayIDs(ctx context.Context, client *http.Client, target string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/feed?limit=%d", strings.TrimRight(target, "/"), replayIDPoolSize), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %d", resp.StatusCode)
+	}
+
+	var feed GetAnimationFeedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %v", err)
+	}
+	ids := make([]string, 0, len(feed.Animations))
+	for _, animation := range feed.Animations {
+		ids = append(ids, animation.ID)
+	}
+	return ids, nil
+}
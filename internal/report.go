@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// reportPageSize is how many moods and animations are read at a time while building a report
+	reportPageSize = 100
+	// reportRenderTimeout bounds building and rendering one report in the background
+	reportRenderTimeout = time.Minute
+	// reportRetention is how long a rendered report is kept for the polls that pick it up. Reports
+	// of the current month are rendered again after it, so they take in new moods.
+	reportRetention = 10 * time.Minute
+	// reportRetryAfter is how many seconds clients are asked to wait before polling for a report
+	reportRetryAfter = 2
+)
+
+// reportMoods lists moods from best to worst, the order reports show them in
+var reportMoods = []Mood{MoodMuchBetter, MoodBetter, MoodSame, MoodWorse, MoodMuchWorse}
+
+// monthlyReport is what a user recorded in one UTC month
+type monthlyReport struct {
+	Username string
+	Month    time.Time
+	// Days holds each day of the month's moods, the first day first
+	Days              []moodReportDay
+	Counts            map[Mood]int
+	Total             int
+	AnimationsCreated int
+	GeneratedAt       time.Time
+}
+
+// moodReportDay counts the moods of one day, with their mean weight from -2 to 2
+type moodReportDay struct {
+	Total int
+	Score float64
+}
+
+// buildMonthlyReport gathers the moods a user recorded and the animations they saved in the UTC
+// month starting at month
+func buildMonthlyReport(ctx context.Context, store Store, userId string, month, now time.Time) (monthlyReport, error) {
+	user, err := store.GetUserDetails(ctx, userId)
+	if err != nil {
+		return monthlyReport{}, err
+	}
+	end := month.AddDate(0, 1, 0)
+	report := monthlyReport{
+		Username:    user.Username,
+		Month:       month,
+		Days:        make([]moodReportDay, int(end.Sub(month).Hours()/24)),
+		Counts:      map[Mood]int{},
+		GeneratedAt: now,
+	}
+
+	scores := make([]float64, len(report.Days))
+	for offset := 0; ; offset += reportPageSize {
+		moods, total, err := store.ListMoods(ctx, userId, month, end, reportPageSize, offset)
+		if err != nil {
+			return monthlyReport{}, err
+		}
+		for _, mood := range moods {
+			day := mood.CreatedAt.UTC().Day() - 1
+			report.Days[day].Total++
+			scores[day] += moodWeights[mood.Mood]
+			report.Counts[mood.Mood]++
+			report.Total++
+		}
+		if len(moods) == 0 || offset+len(moods) >= total {
+			break
+		}
+	}
+	for i := range report.Days {
+		if report.Days[i].Total > 0 {
+			report.Days[i].Score = scores[i] / float64(report.Days[i].Total)
+		}
+	}
+
+	// Animations come newest first, so paging stops at the first one saved before the month
+	for offset := 0; ; offset += reportPageSize {
+		animations, total, err := store.ListUserAnimations(ctx, userId, reportPageSize, offset)
+		if err != nil {
+			return monthlyReport{}, err
+		}
+		for _, animation := range animations {
+			if animation.CreatedAt.Before(month) {
+				return report, nil
+			}
+			if animation.CreatedAt.Before(end) {
+				report.AnimationsCreated++
+			}
+		}
+		if len(animations) == 0 || offset+len(animations) >= total {
+			return report, nil
+		}
+	}
+}
+
+// renderMonthlyReport lays a report out on one A4 page: a summary, a chart of each day's mean
+// mood, and how often each mood was recorded
+func renderMonthlyReport(report monthlyReport) []byte {
+	page := &pdfPage{}
+	page.text(50, 780, 20, true, "Monthly wellbeing report")
+	page.text(50, 758, 12, false, report.Month.Format("January 2006")+" - "+report.Username)
+
+	daysRecorded := 0
+	score := 0.0
+	for _, day := range report.Days {
+		if day.Total > 0 {
+			daysRecorded++
+		}
+		score += day.Score * float64(day.Total)
+	}
+	page.text(50, 725, 11, false, fmt.Sprintf("Moods recorded: %d, on %d of %d days", report.Total, daysRecorded, len(report.Days)))
+	average := "none recorded"
+	if report.Total > 0 {
+		average = fmt.Sprintf("%+.2f (from -2, much worse, to +2, much better)", score/float64(report.Total))
+	}
+	page.text(50, 709, 11, false, "Average mood: "+average)
+	page.text(50, 693, 11, false, "Animations created: "+strconv.Itoa(report.AnimationsCreated))
+
+	// The chart's zero line sits halfway up, with bars rising for days that felt better and
+	// falling for days that felt worse
+	const (
+		chartLeft   = 90.0
+		chartWidth  = 455.0
+		chartZero   = 540.0
+		chartHeight = 70.0
+	)
+	page.text(50, 650, 13, true, "Mood by day")
+	page.text(50, chartZero+chartHeight-3, 8, false, "+2")
+	page.text(50, chartZero-3, 8, false, "0")
+	page.text(50, chartZero-chartHeight-3, 8, false, "-2")
+	page.line(chartLeft, chartZero, chartLeft+chartWidth, chartZero)
+	page.line(chartLeft, chartZero+chartHeight, chartLeft, chartZero-chartHeight)
+	slot := chartWidth / float64(len(report.Days))
+	for i, day := range report.Days {
+		x := chartLeft + float64(i)*slot
+		if day.Total > 0 {
+			height := day.Score / moodWeights[MoodMuchBetter] * chartHeight
+			if height >= 0 {
+				page.rect(x+1, chartZero, slot-2, max(height, 1), 0.30, 0.62, 0.45)
+			} else {
+				page.rect(x+1, chartZero+height, slot-2, -height, 0.85, 0.42, 0.35)
+			}
+		}
+		if i == 0 || (i+1)%5 == 0 {
+			page.text(x+1, chartZero-chartHeight-15, 8, false, strconv.Itoa(i+1))
+		}
+	}
+
+	page.text(50, 410, 13, true, "Moods recorded")
+	for i, mood := range reportMoods {
+		y := 388 - float64(i)*18
+		share := 0
+		if report.Total > 0 {
+			share = report.Counts[mood] * 100 / report.Total
+		}
+		page.text(50, y, 11, false, string(mood))
+		page.text(150, y, 11, false, fmt.Sprintf("%d (%d%%)", report.Counts[mood], share))
+		if report.Counts[mood] > 0 {
+			page.rect(230, y-1, float64(share)*3, 10, 0.45, 0.55, 0.75)
+		}
+	}
+
+	page.text(50, 60, 8, false, "Moods are how "+report.Username+" felt after watching animations, as they recorded them; this is not a clinical assessment.")
+	page.text(50, 48, 8, false, "Days are in UTC. Generated "+report.GeneratedAt.UTC().Format("2 January 2006 15:04")+" UTC.")
+	return page.bytes()
+}
+
+// reportJobs renders reports in the background and keeps them for reportRetention, so clients
+// poll for a report rather than hold a request open while it renders. Reports live on the
+// instance that rendered them.
+type reportJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*reportJob
+}
+
+// reportJob is one report being rendered, or rendered
+type reportJob struct {
+	done       bool
+	pdf        []byte
+	err        error
+	finishedAt time.Time
+}
+
+// fetch returns the report stored under key when it is ready, and otherwise starts rendering it
+// with render unless that is already under way. A failed render is reported once and then
+// forgotten, so the next fetch tries again.
+func (j *reportJobs) fetch(key string, render func(ctx context.Context) ([]byte, error)) ([]byte, bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.jobs == nil {
+		j.jobs = map[string]*reportJob{}
+	}
+	for k, job := range j.jobs {
+		if job.done && time.Since(job.finishedAt) > reportRetention {
+			delete(j.jobs, k)
+		}
+	}
+
+	if job, ok := j.jobs[key]; ok {
+		if !job.done {
+			return nil, false, nil
+		}
+		if job.err != nil {
+			delete(j.jobs, key)
+			return nil, true, job.err
+		}
+		return slices.Clone(job.pdf), true, nil
+	}
+
+	job := &reportJob{}
+	j.jobs[key] = job
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), reportRenderTimeout)
+		defer cancel()
+		pdf, err := render(ctx)
+		if err != nil {
+			log.Printf("[REPORT] Failed to render report %s: %v", key, err)
+		}
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job.done, job.pdf, job.err, job.finishedAt = true, pdf, err, time.Now()
+	}()
+	return nil, false, nil
+}
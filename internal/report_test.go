@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPDFEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "Plain", in: "Mood by day", want: "Mood by day"},
+		{name: "Parentheses", in: "much better (2)", want: `much better \(2\)`},
+		{name: "Backslash", in: `a\b`, want: `a\\b`},
+		{name: "Outside ASCII", in: "Zoë\n", want: "Zo??"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfEscape(tt.in); got != tt.want {
+				t.Errorf("pdfEscape(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMonthlyReport(t *testing.T) {
+	month := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	report := monthlyReport{Username: "sam (they/them)", Month: month, Days: make([]moodReportDay, 28), Counts: map[Mood]int{MoodBetter: 2, MoodWorse: 1}, Total: 3}
+	report.Days[2] = moodReportDay{Total: 2, Score: 1}
+	report.Days[9] = moodReportDay{Total: 1, Score: -1}
+	pdf := renderMonthlyReport(report)
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("report is not a PDF document")
+	}
+	for _, want := range []string{"February 2026", `sam \(they/them\)`, "Moods recorded: 3, on 2 of 28 days", "Average mood: +0.33"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("report is missing %q", want)
+		}
+	}
+
+	// Readers find objects through the cross-reference table, so its offsets must be exact
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the cross-reference table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj"; !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("offset %d does not point at %q", offset, want)
+		}
+	}
+}
+
+func TestBuildMonthlyReport(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	userId, _ := store.CreateUserWithUsername(ctx, "sam@example.com", "sam", "hash")
+	first, _ := store.SaveAnimation(ctx, "function draw() {}", "waves", userId, "")
+	second, _ := store.SaveAnimation(ctx, "function draw() {}", "rain", userId, "")
+	store.SaveMood(ctx, userId, first, string(MoodMuchBetter))
+	store.SaveMood(ctx, userId, second, string(MoodWorse))
+
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		month          time.Time
+		wantTotal      int
+		wantAnimations int
+		wantScore      float64
+	}{
+		{name: "This month", month: month, wantTotal: 2, wantAnimations: 2, wantScore: 0.5},
+		{name: "Last month", month: month.AddDate(0, -1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := buildMonthlyReport(ctx, store, userId, tt.month, now)
+			if err != nil {
+				t.Fatalf("buildMonthlyReport: %v", err)
+			}
+			if report.Total != tt.wantTotal || report.AnimationsCreated != tt.wantAnimations || report.Username != "sam" {
+				t.Errorf("report = %+v, want %d moods and %d animations by sam", report, tt.wantTotal, tt.wantAnimations)
+			}
+			if days := tt.month.AddDate(0, 1, -1).Day(); len(report.Days) != days {
+				t.Errorf("report has %d days, want %d", len(report.Days), days)
+			}
+			if tt.wantTotal > 0 && report.Days[now.Day()-1].Score != tt.wantScore {
+				t.Errorf("today's score = %v, want %v", report.Days[now.Day()-1].Score, tt.wantScore)
+			}
+		})
+	}
+}
+
+// pollReport requests a monthly report until it is rendered and returns the final response
+func pollReport(t *testing.T, router http.Handler, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	for attempt := 0; attempt < 100; attempt++ {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			return rec
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("pending report answered without Retry-After")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("report at %s never finished rendering", path)
+	return nil
+}
+
+func TestMonthlyReportHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	pro := registerAccount(t, router, "coach")
+	client := registerAccount(t, router, "client")
+	doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil)
+	invite, _ := store.CreateClientInvite(ctx, pro.User.ID, "client@example.com", HashToken("invite-token"), time.Now().Add(time.Hour))
+	doJSON(t, router, http.MethodPost, "/me/professionals/accept", client.Token, AcceptClientInviteRequest{Token: "invite-token"}, nil)
+
+	rec := pollReport(t, router, "/me/reports/monthly.pdf", client.Token)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("own report = %d %s, want a PDF", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	clientPath := "/professional/clients/" + strconv.Itoa(invite.ID) + "/reports/monthly.pdf"
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		wantCode int
+	}{
+		{name: "Future month", path: "/me/reports/monthly.pdf?month=2999-01", token: client.Token, wantCode: http.StatusBadRequest},
+		{name: "Bad month", path: "/me/reports/monthly.pdf?month=soon", token: client.Token, wantCode: http.StatusBadRequest},
+		{name: "Signed out", path: "/me/reports/monthly.pdf", wantCode: http.StatusUnauthorized},
+		{name: "Professional without consent", path: clientPath, token: pro.Token, wantCode: http.StatusForbidden},
+		{name: "Someone else's client", path: clientPath, token: admin.Token, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodGet, tt.path, tt.token, nil, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	// With consent the professional gets the report, and only the response carrying it is audited
+	doJSON(t, router, http.MethodPut, "/me/professionals/"+strconv.Itoa(invite.ID)+"/consent", client.Token, MoodTrendConsentRequest{ShareMoodTrends: true}, nil)
+	if rec := pollReport(t, router, clientPath+"?month=2026-01", pro.Token); rec.Code != http.StatusOK {
+		t.Fatalf("client report status = %d", rec.Code)
+	}
+	audit, _ := store.ListProfessionalAudit(ctx, invite.ID)
+	if len(audit) == 0 || audit[0].Action != AuditReportViewed || (len(audit) > 1 && audit[1].Action == AuditReportViewed) {
+		t.Errorf("audit = %+v, want one report view on top", audit)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"log"
+)
+
+// resanitizeBatchSize is how many animations are read from the database at a time during a run
+const resanitizeBatchSize = 100
+
+// ResanitizeCode runs stored code through the current sanitizer and preprocessor.
+// It returns the cleaned code along with any validation errors it still has.
+func ResanitizeCode(code string) (string, []string) {
+	cleaned := PreprocessP5Code(SanitizeAnimationCode(code))
+	validationErrors, _ := AnalyzeP5Code(cleaned)["errors"].([]string)
+	return cleaned, validationErrors
+}
+
+// RunResanitization re-sanitizes every stored animation and records a pending fix for each one whose
+// code would change. With a targetP5Version the run instead proposes migrating every animation not yet
+// pinned to that p5.js 2.x version, skipping those that need changes by hand. Fixes are only applied
+// once an admin approves them.
+func RunResanitization(ctx context.Context, store SanitizationStore, runId int, targetP5Version string) {
+	scanned, changed, manual := 0, 0, 0
+	afterId := ""
+
+	var runErr error
+	for {
+		animations, err := store.ListAnimationCode(ctx, afterId, resanitizeBatchSize)
+		if err != nil {
+			runErr = err
+			break
+		}
+		if len(animations) == 0 {
+			break
+		}
+
+		for _, animation := range animations {
+			scanned++
+			var cleaned string
+			var validationErrors []string
+			if targetP5Version != "" {
+				var remaining []P5CompatibilityIssue
+				if cleaned, remaining = MigrateToP5V2(animation.Code); len(remaining) > 0 {
+					// Repinning would break the sketch; its compatibility matrix lists what to fix by hand
+					manual++
+					continue
+				}
+				if cleaned == animation.Code && animation.P5Version == targetP5Version {
+					continue
+				}
+				validationErrors, _ = AnalyzeP5Code(cleaned)["errors"].([]string)
+			} else if cleaned, validationErrors = ResanitizeCode(animation.Code); cleaned == animation.Code {
+				continue
+			}
+
+			if err := store.AddSanitizationFix(ctx, runId, animation, cleaned, LineDiff(animation.Code, cleaned), validationErrors); err != nil {
+				log.Printf("[RESANITIZE] Failed to record fix for animation %s: %v", animation.ID, err)
+				continue
+			}
+			changed++
+		}
+		afterId = animations[len(animations)-1].ID
+	}
+
+	if err := store.FinishSanitizationRun(ctx, runId, scanned, changed, runErr); err != nil {
+		log.Printf("[RESANITIZE] Failed to finish run %d: %v", runId, err)
+	}
+	log.Printf("[RESANITIZE] Run %d scanned %d animations, %d need fixes", runId, scanned, changed)
+	if manual > 0 {
+		log.Printf("[RESANITIZE] Run %d skipped %d animations that need manual changes for p5.js %s", runId, manual, targetP5Version)
+	}
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResanitizeCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		wantCode   string
+		wantErrors []string
+	}{
+		{
+			name:       "already clean",
+			code:       "function setup() {\n  createCanvas(400, 400);\n}\nfunction draw() {\n}",
+			wantCode:   "function setup() {\n  createCanvas(400, 400);\n}\nfunction draw() {\n}",
+			wantErrors: []string{},
+		},
+		{
+			name:       "markdown fence and undeclared variable",
+			code:       "```javascript\nx = 0;\nfunction setup() {}\nfunction draw() {}\n```",
+			wantCode:   "let x = 0;\nfunction setup() {}\nfunction draw() {}",
+			wantErrors: []string{},
+		},
+		{
+			name:       "still missing draw",
+			code:       "function setup() {}",
+			wantCode:   "function setup() {}",
+			wantErrors: []string{"Missing draw() function"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, errs := ResanitizeCode(tt.code)
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrors) {
+				t.Errorf("errors = %v, want %v", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestApprovedFixesReachCachedReads(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewCachedStore(NewMemoryStore(), NewMemoryCache(), time.Minute)
+	router := NewServer(store).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	id, err := store.SaveAnimation(ctx, "```javascript\nx = 0;\nfunction setup() {}\nfunction draw() {}\n```", "fenced", admin.User.ID, "")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// Reading the animation caches the code the fix is about to replace
+	var before GetAnimationResponse
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+id, "", nil, &before); code != http.StatusOK {
+		t.Fatalf("get status = %d", code)
+	}
+	runId, err := store.CreateSanitizationRun(ctx, admin.User.ID, "")
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	RunResanitization(ctx, store, runId, "")
+
+	var reviewed ReviewSanitizationFixesResponse
+	if code := doJSON(t, router, http.MethodPost, "/admin/resanitize/"+strconv.Itoa(runId)+"/approve", admin.Token, nil, &reviewed); code != http.StatusOK || reviewed.Updated != 1 {
+		t.Fatalf("approve = %d %+v, want one fix applied", code, reviewed)
+	}
+	var after GetAnimationResponse
+	doJSON(t, router, http.MethodGet, "/animation/"+id, "", nil, &after)
+	if want := "let x = 0;\nfunction setup() {}\nfunction draw() {}"; after.Code != want {
+		t.Errorf("code after approval = %q, want %q", after.Code, want)
+	}
+}
@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TenantHeader names the tenant a request acts for; its data lives in the tenant's region
+const TenantHeader = "X-Tenant-ID"
+
+// defaultDataRegion names the region of the database configured by DB_HOST and friends
+const defaultDataRegion = "primary"
+
+// regionDBs are the connection pools of regions other than the primary one, opened by OpenDB
+var regionDBs = map[string]*tracedDB{}
+
+type dataRegionContextKey struct{}
+
+type tenantContextKey struct{}
+
+// PrimaryDataRegion returns the region of the primary database, configured by DATA_REGION
+func PrimaryDataRegion() string {
+	if region := strings.TrimSpace(os.Getenv("DATA_REGION")); region != "" {
+		return region
+	}
+	return defaultDataRegion
+}
+
+// parseRegionMap parses a comma-separated list of name=value pairs
+func parseRegionMap(key string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, want name=value", key, entry)
+		}
+		if _, dup := pairs[name]; dup {
+			return nil, fmt.Errorf("%s lists %s twice", key, name)
+		}
+		pairs[name] = value
+	}
+	return pairs, nil
+}
+
+// RegionDatabaseURLs returns the connection URL of each region besides the primary one, configured
+// by DATA_REGION_DATABASES as region=postgres://... pairs
+func RegionDatabaseURLs() (map[string]string, error) {
+	urls, err := parseRegionMap("DATA_REGION_DATABASES")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := urls[PrimaryDataRegion()]; ok {
+		return nil, fmt.Errorf("DATA_REGION_DATABASES lists the primary region %s", PrimaryDataRegion())
+	}
+	return urls, nil
+}
+
+// TenantRegions returns the region each tenant's data lives in, configured by TENANT_REGIONS as
+// tenant=region pairs. Every region must be the primary one or listed in DATA_REGION_DATABASES.
+func TenantRegions() (map[string]string, error) {
+	tenants, err := parseRegionMap("TENANT_REGIONS")
+	if err != nil {
+		return nil, err
+	}
+	urls, err := RegionDatabaseURLs()
+	if err != nil {
+		return nil, err
+	}
+	for tenant, region := range tenants {
+		if _, ok := urls[region]; !ok && region != PrimaryDataRegion() {
+			return nil, fmt.Errorf("tenant %s is in region %s, which has no database", tenant, region)
+		}
+	}
+	return tenants, nil
+}
+
+// WithDataRegion returns a context whose queries go to region's database
+func WithDataRegion(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, dataRegionContextKey{}, region)
+}
+
+// DataRegionFromContext returns the region a request's data lives in
+func DataRegionFromContext(ctx context.Context) string {
+	if region, ok := ctx.Value(dataRegionContextKey{}).(string); ok {
+		return region
+	}
+	return PrimaryDataRegion()
+}
+
+// isPrimaryRegion reports whether ctx's queries go to the primary database
+func isPrimaryRegion(ctx context.Context) bool {
+	return DataRegionFromContext(ctx) == PrimaryDataRegion()
+}
+
+// dbFor returns the connection pool of ctx's region
+func dbFor(ctx context.Context) *tracedDB {
+	if regional, ok := regionDBs[DataRegionFromContext(ctx)]; ok {
+		return regional
+	}
+	return db
+}
+
+// DataRegions returns every region with a database, the primary one first
+func DataRegions() []string {
+	regions := []string{PrimaryDataRegion()}
+	for region := range regionDBs {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions[1:])
+	return regions
+}
+
+// ForEachDataRegion runs fn against every region's database in turn, stopping at the first error
+func ForEachDataRegion(ctx context.Context, fn func(ctx context.Context, region string) error) error {
+	for _, region := range DataRegions() {
+		if err := fn(WithDataRegion(ctx, region), region); err != nil {
+			return fmt.Errorf("region %s: %w", region, err)
+		}
+	}
+	return nil
+}
+
+// drainEveryDataRegion runs a background worker's batch against every region's database in turn,
+// repeating it in a region while full batches of batchSize show a backlog there
+func drainEveryDataRegion(ctx context.Context, batchSize int, batch func(ctx context.Context) (int, error)) error {
+	return ForEachDataRegion(ctx, func(ctx context.Context, region string) error {
+		for {
+			count, err := batch(ctx)
+			if err != nil || count < batchSize {
+				return err
+			}
+		}
+	})
+}
+
+// deleteInEveryDataRegion runs a pruner's delete against every region's database in turn,
+// returning how many rows it deleted in all
+func deleteInEveryDataRegion(ctx context.Context, delete func(ctx context.Context) (int, error)) (int, error) {
+	total := 0
+	err := ForEachDataRegion(ctx, func(ctx context.Context, region string) error {
+		deleted, err := delete(ctx)
+		total += deleted
+		return err
+	})
+	return total, err
+}
+
+// openRegionDBs opens the connection pool of every region in DATA_REGION_DATABASES
+func openRegionDBs(ctx context.Context) error {
+	urls, err := RegionDatabaseURLs()
+	if err != nil {
+		return err
+	}
+	poolConfig := DBPoolConfigFromEnv()
+	for region, url := range urls {
+		conn, err := sql.Open("postgres", url)
+		if err != nil {
+			return fmt.Errorf("failed to connect to region %s: %v", region, err)
+		}
+		poolConfig.Apply(conn)
+
+		pingCtx, cancel := withQueryTimeout(ctx)
+		err = conn.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to ping region %s database: %v", region, err)
+		}
+		regionDBs[region] = newTracedDB(conn, nil)
+		log.Printf("[DB] Connected to the %s region database", region)
+	}
+	return nil
+}
+
+// WithTenant returns a context acting for tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant a request acts for, or "" for none
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// signedInTenant returns the tenant of the account whose JWT signs r in, and whether one does.
+// Tokens issued before accounts' tenants were recorded name none.
+func signedInTenant(r *http.Request) (string, bool) {
+	secret, ok := bearerCredential(r)
+	if !ok {
+		return "", false
+	}
+	token, err := parseJWT(secret)
+	if err != nil {
+		return "", false
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if userId, _ := claims["userId"].(string); userId == "" {
+		return "", false
+	}
+	tenant, _ := claims["tenant"].(string)
+	return tenant, true
+}
+
+// TenantMiddleware routes a request's queries to the region of the tenant it acts for. Signed-in
+// users act for the tenant of their account, which their JWT names, and requests naming another in
+// the X-Tenant-ID header are refused. Other requests act for the tenant the header names: an app
+// or impersonation token is only found in the region it was issued in, so it cannot be taken to
+// another. Requests without a tenant use the primary region; unknown tenants are rejected rather
+// than having their data land in the wrong region.
+func TenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tenant := strings.TrimSpace(r.Header.Get(TenantHeader))
+		if account, ok := signedInTenant(r); ok {
+			if tenant != "" && tenant != account {
+				EncodeErrorCode(w, ErrCodeTenantMismatch, "Tenant does not match the signed-in account", http.StatusForbidden)
+				return
+			}
+			tenant = account
+		}
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tenants, err := TenantRegions()
+		if err != nil {
+			LogResponse("TenantMiddleware", "Invalid tenant configuration", err)
+			EncodeError(w, "Tenant configuration error", http.StatusInternalServerError)
+			return
+		}
+		region, ok := tenants[tenant]
+		if !ok {
+			EncodeError(w, "Unknown tenant", http.StatusBadRequest)
+			return
+		}
+		ctx := WithTenant(WithDataRegion(r.Context(), region), tenant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
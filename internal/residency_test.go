@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTenantRegions(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   string
+		databases string
+		tenants   string
+		want      map[string]string
+		wantErr   bool
+	}{
+		{name: "Unset", want: map[string]string{}},
+		{name: "Regional tenant", databases: "eu=postgres://eu-db/animations", tenants: "acme=eu, globex=primary",
+			want: map[string]string{"acme": "eu", "globex": "primary"}},
+		{name: "Named primary region", primary: "us", tenants: "globex=us", want: map[string]string{"globex": "us"}},
+		{name: "Region without a database", tenants: "acme=eu", wantErr: true},
+		{name: "Primary region listed as a database", databases: "primary=postgres://db/animations", wantErr: true},
+		{name: "Malformed entry", tenants: "acme", wantErr: true},
+		{name: "Duplicate tenant", databases: "eu=postgres://eu-db/animations", tenants: "acme=eu,acme=primary", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATA_REGION", tt.primary)
+			t.Setenv("DATA_REGION_DATABASES", tt.databases)
+			t.Setenv("TENANT_REGIONS", tt.tenants)
+			got, err := TenantRegions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TenantRegions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("TenantRegions() = %v, want %v", got, tt.want)
+			}
+			for tenant, region := range tt.want {
+				if got[tenant] != region {
+					t.Errorf("region of %s = %q, want %q", tenant, got[tenant], region)
+				}
+			}
+		})
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("DATA_REGION_DATABASES", "eu=postgres://eu-db/animations")
+	t.Setenv("TENANT_REGIONS", "acme=eu,globex=primary")
+
+	var gotRegion, gotTenant string
+	handler := TenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRegion, gotTenant = DataRegionFromContext(r.Context()), TenantFromContext(r.Context())
+	}))
+	signIn := func(tenant string) string {
+		t.Helper()
+		token, err := generateJWT("user", tenant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		tenant     string
+		wantStatus int
+		wantRegion string
+		wantTenant string
+	}{
+		{name: "No tenant", wantStatus: http.StatusOK, wantRegion: "primary"},
+		{name: "Regional tenant", tenant: "acme", wantStatus: http.StatusOK, wantRegion: "eu", wantTenant: "acme"},
+		{name: "Primary tenant", tenant: "globex", wantStatus: http.StatusOK, wantRegion: "primary", wantTenant: "globex"},
+		{name: "Unknown tenant", tenant: "initech", wantStatus: http.StatusBadRequest},
+		{name: "Signed in to a regional tenant", token: signIn("acme"), wantStatus: http.StatusOK, wantRegion: "eu", wantTenant: "acme"},
+		{name: "Naming the account's tenant", token: signIn("acme"), tenant: "acme", wantStatus: http.StatusOK, wantRegion: "eu", wantTenant: "acme"},
+		{name: "Naming another tenant", token: signIn("acme"), tenant: "globex", wantStatus: http.StatusForbidden},
+		{name: "Signed in without a tenant", token: signIn(""), wantStatus: http.StatusOK, wantRegion: "primary"},
+		{name: "Naming a tenant without one", token: signIn(""), tenant: "acme", wantStatus: http.StatusForbidden},
+		{name: "Other credentials", token: "oat_token", tenant: "acme", wantStatus: http.StatusOK, wantRegion: "eu", wantTenant: "acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRegion, gotTenant = "", ""
+			r := httptest.NewRequest(http.MethodGet, "/feed", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.tenant != "" {
+				r.Header.Set(TenantHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if gotRegion != tt.wantRegion {
+				t.Errorf("region = %q, want %q", gotRegion, tt.wantRegion)
+			}
+			if gotTenant != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", gotTenant, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestAccountsBelongToTheirTenant(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("DATA_REGION_DATABASES", "eu=postgres://eu-db/animations")
+	t.Setenv("TENANT_REGIONS", "acme=eu,globex=primary")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	tokenTenant := func(token string) string {
+		t.Helper()
+		parsed, err := parseJWT(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tenant, _ := parsed.Claims.(jwt.MapClaims)["tenant"].(string)
+		return tenant
+	}
+	login := func(email, tenant string) (int, LoginResponse) {
+		t.Helper()
+		var body bytes.Buffer
+		json.NewEncoder(&body).Encode(LoginRequest{Email: email, Password: "correct horse battery"})
+		req := httptest.NewRequest(http.MethodPost, "/login", &body)
+		req.Header.Set("Content-Type", "application/json")
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var response LoginResponse
+		json.NewDecoder(rec.Body).Decode(&response)
+		return rec.Code, response
+	}
+
+	// Registering for a tenant makes the account its, and signing in without naming it finds it
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(RegisterRequest{Username: "ada", Email: "ada@example.com", Password: "correct horse battery"})
+	req := httptest.NewRequest(http.MethodPost, "/register", &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TenantHeader, "acme")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var registered RegisterResponse
+	if err := json.NewDecoder(rec.Body).Decode(&registered); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("register status = %d: %v", rec.Code, err)
+	}
+	if got := tokenTenant(registered.Token); got != "acme" || registered.User.Tenant != "acme" {
+		t.Errorf("registered tenant = %q in the token, %q in the user, want acme", got, registered.User.Tenant)
+	}
+	if code, response := login("ada@example.com", ""); code != http.StatusOK || tokenTenant(response.Token) != "acme" {
+		t.Errorf("login without a tenant = %d with tenant %q, want acme", code, tokenTenant(response.Token))
+	}
+	if code, _ := login("ada@example.com", "globex"); code != http.StatusUnauthorized {
+		t.Errorf("login naming another tenant status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/my-animations", registered.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("signed-in request status = %d", code)
+	}
+
+	// Accounts from before tenants were recorded take the first one they are signed in to
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateUserWithUsername(context.Background(), "grace@example.com", "grace", string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	if code, response := login("grace@example.com", "acme"); code != http.StatusOK || tokenTenant(response.Token) != "acme" {
+		t.Errorf("first login naming a tenant = %d with tenant %q, want acme", code, tokenTenant(response.Token))
+	}
+	if code, _ := login("grace@example.com", "globex"); code != http.StatusUnauthorized {
+		t.Errorf("login naming another tenant after the first status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestCachedStoreSkipsRegionalData(t *testing.T) {
+	ctx := WithDataRegion(context.Background(), "eu")
+	memory := NewMemoryStore()
+	counting := &countingStore{Store: memory}
+	cache := NewMemoryCache()
+	store := NewCachedStore(counting, cache, time.Minute)
+
+	id, err := store.SaveAnimation(ctx, "function draw() {}", "calm", "", "")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := store.GetAnimation(ctx, id); err != nil {
+			t.Fatalf("get: %v", err)
+		}
+	}
+	if counting.reads != 2 {
+		t.Errorf("store reads = %d, want 2", counting.reads)
+	}
+	if _, ok, _ := cache.Get(context.Background(), animationCacheKey(id)); ok {
+		t.Error("regional animation was written to the shared cache")
+	}
+}
+
+// withDataRegions adds regions besides the primary one for the length of a test. Their pools are
+// stand-ins, for stores that keep each region's data themselves, such as regionalStore.
+func withDataRegions(t *testing.T, regions ...string) {
+	t.Helper()
+	for _, region := range regions {
+		regionDBs[region] = &tracedDB{}
+	}
+	t.Cleanup(func() {
+		for _, region := range regions {
+			delete(regionDBs, region)
+		}
+	})
+}
+
+// regionalStore keeps the generation jobs of each region besides the primary one in a store of
+// its own, as the regions' databases would, and everything else in the primary store
+type regionalStore struct {
+	Store
+	regions map[string]*MemoryStore
+}
+
+func newRegionalStore(regions ...string) *regionalStore {
+	store := &regionalStore{Store: NewMemoryStore(), regions: map[string]*MemoryStore{}}
+	for _, region := range regions {
+		store.regions[region] = NewMemoryStore()
+	}
+	return store
+}
+
+// in returns the store of ctx's region
+func (s *regionalStore) in(ctx context.Context) Store {
+	if regional, ok := s.regions[DataRegionFromContext(ctx)]; ok {
+		return regional
+	}
+	return s.Store
+}
+
+func (s *regionalStore) EnqueueGenerationJob(ctx context.Context, job QueuedGeneration) error {
+	return s.in(ctx).EnqueueGenerationJob(ctx, job)
+}
+
+func (s *regionalStore) ClaimGenerationJobs(ctx context.Context, limit int) ([]QueuedGeneration, error) {
+	return s.in(ctx).ClaimGenerationJobs(ctx, limit)
+}
+
+func (s *regionalStore) CompleteGenerationJob(ctx context.Context, id string, result AnimationResponse) error {
+	return s.in(ctx).CompleteGenerationJob(ctx, id, result)
+}
+
+func (s *regionalStore) FailGenerationJob(ctx context.Context, id, message string) error {
+	return s.in(ctx).FailGenerationJob(ctx, id, message)
+}
+
+func (s *regionalStore) GetGenerationJob(ctx context.Context, id, userId string) (GenerationJob, error) {
+	return s.in(ctx).GetGenerationJob(ctx, id, userId)
+}
+
+func (s *regionalStore) DeleteFinishedGenerationJobs(ctx context.Context, before time.Time) (int, error) {
+	return s.in(ctx).DeleteFinishedGenerationJobs(ctx, before)
+}
+
+func TestBackgroundWorkersRunInEveryRegion(t *testing.T) {
+	withDataRegions(t, "eu", "ap")
+
+	// Each region's backlog is worked through, however many batches it takes
+	backlog := map[string]int{"primary": 5, "eu": 1, "ap": 0}
+	batches := map[string]int{}
+	err := drainEveryDataRegion(context.Background(), 2, func(ctx context.Context) (int, error) {
+		region := DataRegionFromContext(ctx)
+		batches[region]++
+		count := min(backlog[region], 2)
+		backlog[region] -= count
+		return count, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"primary": 3, "eu": 1, "ap": 1}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+
+	deleted, err := deleteInEveryDataRegion(context.Background(), func(ctx context.Context) (int, error) {
+		return map[string]int{"primary": 1, "eu": 2, "ap": 3}[DataRegionFromContext(ctx)], nil
+	})
+	if err != nil || deleted != 6 {
+		t.Errorf("deleted = %d, %v, want 6 from every region", deleted, err)
+	}
+	_, err = deleteInEveryDataRegion(context.Background(), func(ctx context.Context) (int, error) {
+		if DataRegionFromContext(ctx) == "eu" {
+			return 0, errors.New("connection refused")
+		}
+		return 0, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "region eu") {
+		t.Errorf("error = %v, want the failed region named", err)
+	}
+}
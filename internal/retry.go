@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for retrying Claude calls that fail transiently
+const (
+	defaultClaudeMaxRetries     = 3
+	defaultClaudeRetryBaseDelay = 500 * time.Millisecond
+	defaultClaudeRetryMaxDelay  = 8 * time.Second
+)
+
+// ClaudeRetryPolicy decides how often, and after how long, Claude calls that were rate limited,
+// overloaded or failed on the way are sent again
+type ClaudeRetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	// MaxDelay caps each wait. Claude asking, through Retry-After, for a longer one ends the retries.
+	MaxDelay time.Duration
+}
+
+// ClaudeRetryPolicyFromEnv reads CLAUDE_MAX_RETRIES, CLAUDE_RETRY_BASE_DELAY_MS and
+// CLAUDE_RETRY_MAX_DELAY_MS; CLAUDE_MAX_RETRIES=0 turns retries off
+func ClaudeRetryPolicyFromEnv() ClaudeRetryPolicy {
+	return ClaudeRetryPolicy{
+		MaxRetries: envLimit("CLAUDE_MAX_RETRIES", defaultClaudeMaxRetries),
+		BaseDelay:  envMilliseconds("CLAUDE_RETRY_BASE_DELAY_MS", defaultClaudeRetryBaseDelay),
+		MaxDelay:   envMilliseconds("CLAUDE_RETRY_MAX_DELAY_MS", defaultClaudeRetryMaxDelay),
+	}
+}
+
+// retryableStatus reports whether Claude may answer a request differently if it is sent again:
+// when it was rate limited, overloaded (529) or failed on Anthropic's side
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// delay returns how long to wait before retry number retry, counted from zero, and false when the
+// call should not be retried. Claude's Retry-After is used as given; otherwise the wait is drawn at
+// random up to an exponentially growing ceiling, so clients that failed together do not retry
+// together.
+func (p ClaudeRetryPolicy) delay(retry int, retryAfter string, now time.Time) (time.Duration, bool) {
+	if retry >= p.MaxRetries {
+		return 0, false
+	}
+	if wait, ok := parseRetryAfter(retryAfter, now); ok {
+		return wait, wait <= p.MaxDelay
+	}
+	ceiling := p.MaxDelay
+	if retry < 30 && p.BaseDelay<<retry < ceiling {
+		ceiling = p.BaseDelay << retry
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1)), true
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// waitToRetry sleeps for wait, returning false early if ctx ends first or would end before the
+// wait is over
+func waitToRetry(ctx context.Context, wait time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
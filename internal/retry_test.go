@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{value: "3", want: 3 * time.Second, wantOk: true},
+		{value: "Wed, 01 May 2024 12:00:10 GMT", want: 10 * time.Second, wantOk: true},
+		{value: "Wed, 01 May 2024 11:59:00 GMT", want: 0, wantOk: true},
+		{value: ""},
+		{value: "-1"},
+		{value: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestClaudeRetryPolicyDelay(t *testing.T) {
+	policy := ClaudeRetryPolicy{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	now := time.Now()
+	tests := []struct {
+		name       string
+		retry      int
+		retryAfter string
+		wantMax    time.Duration
+		wantMin    time.Duration
+		wantOk     bool
+	}{
+		{name: "First retry", retry: 0, wantMax: 100 * time.Millisecond, wantOk: true},
+		{name: "Backs off", retry: 2, wantMax: 400 * time.Millisecond, wantOk: true},
+		{name: "Retry-After", retry: 0, retryAfter: "1", wantMin: time.Second, wantMax: time.Second, wantOk: true},
+		{name: "Retry-After too long", retry: 0, retryAfter: "30"},
+		{name: "Out of retries", retry: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				got, ok := policy.delay(tt.retry, tt.retryAfter, now)
+				if ok != tt.wantOk || (ok && (got < tt.wantMin || got > tt.wantMax)) {
+					t.Fatalf("delay() = %v, %v, want %v-%v, %v", got, ok, tt.wantMin, tt.wantMax, tt.wantOk)
+				}
+			}
+		})
+	}
+
+	capped := ClaudeRetryPolicy{MaxRetries: 100, BaseDelay: time.Second, MaxDelay: 2 * time.Second}
+	if got, ok := capped.delay(80, "", now); !ok || got > 2*time.Second {
+		t.Errorf("delay() late in a long run = %v, %v, want at most the maximum", got, ok)
+	}
+}
+
+func TestSendClaudePromptRetries(t *testing.T) {
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+	t.Setenv("CLAUDE_MAX_RETRIES", "2")
+	t.Setenv("CLAUDE_RETRY_BASE_DELAY_MS", "1")
+	t.Setenv("CLAUDE_RETRY_MAX_DELAY_MS", "1500")
+
+	const ok = `{"content": [{"type": "text", "text": "function setup() {}"}]}`
+	tests := []struct {
+		name      string
+		statuses  []int
+		headers   map[string]string
+		wantCalls int32
+		wantErr   string
+	}{
+		{name: "Recovers", statuses: []int{529, http.StatusTooManyRequests, http.StatusOK}, wantCalls: 3},
+		{name: "Retry-After", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, headers: map[string]string{"Retry-After": "1"}, wantCalls: 2},
+		{name: "Exhausted", statuses: []int{503, 503, 503}, wantCalls: 3, wantErr: "still failing after 3 attempts"},
+		{name: "Retry-After too long", statuses: []int{http.StatusTooManyRequests}, headers: map[string]string{"Retry-After": "60"}, wantCalls: 1, wantErr: "status 429"},
+		{name: "Not retryable", statuses: []int{http.StatusBadRequest}, wantCalls: 1, wantErr: "status 400"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := int(calls.Add(1)) - 1
+				status := tt.statuses[min(call, len(tt.statuses)-1)]
+				if status != http.StatusOK {
+					for name, value := range tt.headers {
+						w.Header().Set(name, value)
+					}
+					w.WriteHeader(status)
+					w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+					return
+				}
+				w.Write([]byte(ok))
+			}))
+			defer claude.Close()
+			savedURL := claudeMessagesURL
+			claudeMessagesURL = claude.URL
+			defer func() { claudeMessagesURL = savedURL }()
+
+			text, err := sendClaudePromptWithModel(context.Background(), "a calm ocean", DefaultClaudeModel, "test-key")
+			if tt.wantErr == "" && (err != nil || text != "function setup() {}") {
+				t.Errorf("sendClaudePromptWithModel() = %q, %v, want the sketch", text, err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("sendClaudePromptWithModel() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSendClaudePromptStopsRetryingWhenCanceled(t *testing.T) {
+	t.Setenv("CLAUDE_MAX_RETRIES", "5")
+	t.Setenv("CLAUDE_RETRY_BASE_DELAY_MS", "1000")
+	var calls atomic.Int32
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(529)
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	defer func() { claudeMessagesURL = savedURL }()
+
+	// The backoff would outlast the deadline, so there is no point waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := sendClaudePromptWithModel(ctx, "a calm ocean", DefaultClaudeModel, "test-key"); err == nil {
+		t.Fatal("sendClaudePromptWithModel() succeeded, want an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %v and %d calls, want promptly", elapsed, calls.Load())
+	}
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Statuses of animation reviews. Only approved animations appear in the feed and search.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// maxReviewNoteLength bounds the note an owner leaves with a review decision
+const maxReviewNoteLength = 500
+
+// ValidateReviewDecision checks an owner's review decision and trims its note
+func ValidateReviewDecision(req ReviewDecisionRequest) (ReviewDecisionRequest, error) {
+	if req.Status != ReviewApproved && req.Status != ReviewRejected {
+		return req, fmt.Errorf("status must be %q or %q", ReviewApproved, ReviewRejected)
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxReviewNoteLength {
+		return req, fmt.Errorf("note must be at most %d characters", maxReviewNoteLength)
+	}
+	return req, nil
+}
+
+// sendReviewNotices tells the workspace owner a member's animation is waiting for review, or the
+// author what the owner decided
+func sendReviewNotices(ctx context.Context, store Store, org Organization, review AnimationReview) {
+	animationURL := PublicURL("/animation/" + review.AnimationID)
+	mailer := GetMailer()
+	switch review.Status {
+	case ReviewPending:
+		body := review.AuthorUsername + " saved " + animationURL + " in " + org.Name + ". It stays out of the feed until you approve it.\n\n" +
+			"Review it with PUT " + PublicURL(fmt.Sprintf("/orgs/%d/reviews/%s", org.ID, review.AnimationID)) + "."
+		notifyUser(ctx, store, mailer, org.OwnerID, NotificationReviewRequested, "An animation is waiting for your review", body)
+	case ReviewApproved:
+		body := "Your animation " + animationURL + " was approved and now appears in the feed."
+		if review.Note != "" {
+			body += "\n\nNote from the reviewer:\n" + review.Note
+		}
+		notifyUser(ctx, store, mailer, review.AuthorID, NotificationReviewDecided, "Your animation was approved", body)
+	case ReviewRejected:
+		body := "Your animation " + animationURL + " was not approved and stays out of the feed."
+		if review.Note != "" {
+			body += "\n\nNote from the reviewer:\n" + review.Note
+		}
+		notifyUser(ctx, store, mailer, review.AuthorID, NotificationReviewDecided, "Your animation was not approved", body)
+	}
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateReviewDecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     ReviewDecisionRequest
+		wantErr bool
+	}{
+		{name: "Approved", req: ReviewDecisionRequest{Status: ReviewApproved}},
+		{name: "Rejected with a note", req: ReviewDecisionRequest{Status: ReviewRejected, Note: " Too busy "}},
+		{name: "Pending", req: ReviewDecisionRequest{Status: ReviewPending}, wantErr: true},
+		{name: "Note too long", req: ReviewDecisionRequest{Status: ReviewRejected, Note: strings.Repeat("a", maxReviewNoteLength+1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateReviewDecision(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateReviewDecision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Note != strings.TrimSpace(tt.req.Note) {
+				t.Errorf("note = %q, want it trimmed", got.Note)
+			}
+		})
+	}
+}
+
+func TestAnimationReviewWorkflow(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	owner := registerAccount(t, router, "studio")
+	artist := registerAccount(t, router, "artist")
+	outsider := registerAccount(t, router, "outsider")
+
+	var org Organization
+	if code := doJSON(t, router, http.MethodPost, "/orgs", owner.Token, OrganizationRequest{Name: "Studio"}, &org); code != http.StatusCreated {
+		t.Fatalf("create organization status = %d", code)
+	}
+	orgPath := "/orgs/" + strconv.Itoa(org.ID)
+	if code := doJSON(t, router, http.MethodPost, orgPath+"/members", owner.Token, OrganizationMemberRequest{Email: "artist@example.com"}, nil); code != http.StatusCreated {
+		t.Fatalf("add member status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodPut, orgPath+"/review", artist.Token, OrganizationReviewRequest{ReviewRequired: true}, nil); code != http.StatusForbidden {
+		t.Errorf("member turning review on status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodPut, orgPath+"/review", owner.Token, OrganizationReviewRequest{ReviewRequired: true}, &org); code != http.StatusOK || !org.ReviewRequired {
+		t.Fatalf("turn review on = %d %+v", code, org)
+	}
+
+	save := func(token, description string) SaveAnimationResponse {
+		t.Helper()
+		var saved SaveAnimationResponse
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", token, sketch, &saved); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+		return saved
+	}
+	feedTotal := func() int {
+		t.Helper()
+		var page GetAnimationFeedResponse
+		if code := doJSON(t, router, http.MethodGet, "/feed?limit=10", "", nil, &page); code != http.StatusOK {
+			t.Fatalf("feed status = %d", code)
+		}
+		return page.Total
+	}
+
+	// The owner's own work and people outside the workspace are not held back
+	if saved := save(owner.Token, "owner"); saved.ReviewStatus != "" {
+		t.Errorf("owner's save review status = %q, want none", saved.ReviewStatus)
+	}
+	save(outsider.Token, "outsider")
+	waves, rain := save(artist.Token, "waves"), save(artist.Token, "rain")
+	if waves.ReviewStatus != ReviewPending {
+		t.Errorf("member's save review status = %q, want %q", waves.ReviewStatus, ReviewPending)
+	}
+	if total := feedTotal(); total != 2 {
+		t.Errorf("feed total = %d, want the 2 animations not waiting for review", total)
+	}
+
+	var pending AnimationReviewsResponse
+	if code := doJSON(t, router, http.MethodGet, orgPath+"/reviews?status=pending", owner.Token, nil, &pending); code != http.StatusOK || pending.Total != 2 || pending.Reviews[0].AnimationID != waves.ID || pending.Reviews[0].AuthorUsername != "artist" {
+		t.Fatalf("pending reviews = %d %+v, want both of the artist's animations, oldest first", code, pending)
+	}
+	if code := doJSON(t, router, http.MethodGet, orgPath+"/reviews", artist.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("member listing reviews status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := doJSON(t, router, http.MethodGet, orgPath+"/reviews?status=draft", owner.Token, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown status filter = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	decide := func(id string, req ReviewDecisionRequest, wantCode int) AnimationReview {
+		t.Helper()
+		var review AnimationReview
+		if code := doJSON(t, router, http.MethodPut, orgPath+"/reviews/"+id, owner.Token, req, &review); code != wantCode {
+			t.Fatalf("decide %s %s status = %d, want %d", id, req.Status, code, wantCode)
+		}
+		return review
+	}
+	decide(waves.ID, ReviewDecisionRequest{Status: ReviewPending}, http.StatusBadRequest)
+	decide("unknown", ReviewDecisionRequest{Status: ReviewApproved}, http.StatusNotFound)
+	if approved := decide(waves.ID, ReviewDecisionRequest{Status: ReviewApproved}, http.StatusOK); approved.Status != ReviewApproved || approved.ReviewedBy != owner.User.ID || approved.ReviewedAt == nil {
+		t.Errorf("approved review = %+v", approved)
+	}
+	decide(waves.ID, ReviewDecisionRequest{Status: ReviewRejected}, http.StatusConflict)
+	if rejected := decide(rain.ID, ReviewDecisionRequest{Status: ReviewRejected, Note: "Too busy"}, http.StatusOK); rejected.Note != "Too busy" {
+		t.Errorf("rejected review = %+v, want the note", rejected)
+	}
+	if total := feedTotal(); total != 3 {
+		t.Errorf("feed total = %d, want the approved animation added", total)
+	}
+
+	var mine AnimationReviewsResponse
+	if code := doJSON(t, router, http.MethodGet, "/me/reviews?status=rejected", artist.Token, nil, &mine); code != http.StatusOK || mine.Total != 1 || mine.Reviews[0].AnimationID != rain.ID {
+		t.Errorf("artist's rejected reviews = %d %+v", code, mine)
+	}
+
+	// Once review is off, new animations go straight to the feed
+	doJSON(t, router, http.MethodPut, orgPath+"/review", owner.Token, OrganizationReviewRequest{ReviewRequired: false}, nil)
+	if saved := save(artist.Token, "stars"); saved.ReviewStatus != "" {
+		t.Errorf("save with review off review status = %q, want none", saved.ReviewStatus)
+	}
+}
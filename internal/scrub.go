@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Scrubbing strictness levels, set for everyone by SCRUB_STRICTNESS and per workspace by
+// SCRUB_WORKSPACE_STRICTNESS
+const (
+	// ScrubOff stores and shows text as it was written
+	ScrubOff = "off"
+	// ScrubStandard masks emails, phone numbers and dictionary words
+	ScrubStandard = "standard"
+	// ScrubStrict also asks Claude to mask what the patterns miss before text is stored
+	ScrubStrict = "strict"
+)
+
+// Replacements for masked personal information; dictionary words are replaced by asterisks
+const (
+	scrubbedEmail = "[email removed]"
+	scrubbedPhone = "[phone removed]"
+)
+
+// Phone numbers have between minPhoneDigits and maxPhoneDigits digits, so sizes and counts in
+// descriptions are left alone
+const (
+	minPhoneDigits = 9
+	maxPhoneDigits = 15
+)
+
+var (
+	scrubEmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// scrubPhonePattern matches runs of digits with the separators phone numbers are written with
+	scrubPhonePattern = regexp.MustCompile(`\+?\(?\d[\d\s().\-]{7,}\d`)
+)
+
+// defaultScrubWords is the built-in dictionary of profanity. Slurs and other terms are added by
+// listing them one per line in the file named by SCRUB_WORDS_FILE.
+var defaultScrubWords = []string{
+	"asshole", "bastard", "bitch", "bullshit", "cunt", "fuck", "fucked", "fucker", "fucking",
+	"motherfucker", "shit", "shitty",
+}
+
+// scrubClaudePrompt asks Claude, in strict mode, to mask what the patterns and dictionary missed
+const scrubClaudePrompt = `You moderate text people write about animations before it is published. Replace slurs, ` +
+	`including obfuscated spellings, and personal information about private individuals (names, addresses, ` +
+	`emails, phone numbers, social media handles) in the text below with [removed]. Change nothing else. ` +
+	`Reply with the resulting text only, without the tags.
+
+<text>
+{{text}}
+</text>`
+
+// ScrubStrictness returns how strictly text written by members of the workspace is scrubbed; 0
+// stands for no workspace. People outside a workspace, and workspaces SCRUB_WORKSPACE_STRICTNESS
+// leaves out, get SCRUB_STRICTNESS, which is standard unless set.
+func ScrubStrictness(workspace int) string {
+	strictness := ScrubStandard
+	if level, ok := parseScrubStrictness("SCRUB_STRICTNESS", os.Getenv("SCRUB_STRICTNESS")); ok {
+		strictness = level
+	}
+	if workspace == 0 {
+		return strictness
+	}
+	workspaces, err := parseRegionMap("SCRUB_WORKSPACE_STRICTNESS")
+	if err != nil {
+		log.Printf("Warning: Ignoring SCRUB_WORKSPACE_STRICTNESS: %v", err)
+		return strictness
+	}
+	id := strconv.Itoa(workspace)
+	if level, ok := parseScrubStrictness("SCRUB_WORKSPACE_STRICTNESS for workspace "+id, workspaces[id]); ok {
+		strictness = level
+	}
+	return strictness
+}
+
+// parseScrubStrictness reads a strictness level, reporting whether raw named one
+func parseScrubStrictness(setting, raw string) (string, bool) {
+	switch level := strings.ToLower(strings.TrimSpace(raw)); level {
+	case "":
+		return "", false
+	case ScrubOff, ScrubStandard, ScrubStrict:
+		return level, true
+	default:
+		log.Printf("Warning: Ignoring invalid %s value %q", setting, raw)
+		return "", false
+	}
+}
+
+// scrubDictionary caches the pattern built from the dictionary, rebuilt when SCRUB_WORDS_FILE changes
+var scrubDictionary struct {
+	mu      sync.Mutex
+	path    string
+	pattern *regexp.Regexp
+}
+
+// scrubWordPattern returns the pattern matching any dictionary word as a whole word, ignoring case
+func scrubWordPattern() *regexp.Regexp {
+	path := os.Getenv("SCRUB_WORDS_FILE")
+	scrubDictionary.mu.Lock()
+	defer scrubDictionary.mu.Unlock()
+	if scrubDictionary.pattern != nil && scrubDictionary.path == path {
+		return scrubDictionary.pattern
+	}
+
+	words := append([]string(nil), defaultScrubWords...)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: Failed to read SCRUB_WORDS_FILE, using the built-in dictionary: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if word := strings.ToLower(strings.TrimSpace(line)); word != "" && !strings.HasPrefix(word, "#") {
+				words = append(words, word)
+			}
+		}
+	}
+	// Longer words first, so a word is not masked only as far as a shorter one it starts with
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+
+	scrubDictionary.path = path
+	scrubDictionary.pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return scrubDictionary.pattern
+}
+
+// TextScrubber masks personal information and offensive words in text people write, as strictly as
+// their workspace asks
+type TextScrubber struct {
+	Strictness string
+}
+
+// ScrubberFor returns the scrubber for text the user writes or reads, by the workspace they belong
+// to. The workspace is only looked up when SCRUB_WORKSPACE_STRICTNESS is set; signed-out users, and
+// users whose workspace cannot be looked up, get SCRUB_STRICTNESS.
+func ScrubberFor(ctx context.Context, store OrganizationStore, userId string) TextScrubber {
+	workspace := 0
+	if userId != "" && os.Getenv("SCRUB_WORKSPACE_STRICTNESS") != "" {
+		if org, err := store.GetUserOrganization(ctx, userId); err == nil {
+			workspace = org.ID
+		}
+	}
+	return TextScrubber{Strictness: ScrubStrictness(workspace)}
+}
+
+// scrubberFor returns the scrubber for text sent in r by its signed-in user, if any
+func (s *Server) scrubberFor(r *http.Request) TextScrubber {
+	userId, _ := GetUserIDFromContext(r.Context())
+	return ScrubberFor(r.Context(), s.store, userId)
+}
+
+// Mask replaces emails, phone numbers and dictionary words in text. It is quick enough to run on
+// everything shown, so text stored before scrubbing was configured is masked too.
+func (s TextScrubber) Mask(text string) string {
+	if s.Strictness == ScrubOff || text == "" {
+		return text
+	}
+	text = scrubEmailPattern.ReplaceAllString(text, scrubbedEmail)
+	text = scrubPhonePattern.ReplaceAllStringFunc(text, func(match string) string {
+		digits := 0
+		for _, r := range match {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		if digits < minPhoneDigits || digits > maxPhoneDigits {
+			return match
+		}
+		return scrubbedPhone
+	})
+	return scrubWordPattern().ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+}
+
+// Scrub masks text before it is stored. Strict scrubbers then have Claude mask what the patterns
+// missed; if Claude cannot be reached, the masked text is stored as it is rather than failing the
+// request.
+func (s TextScrubber) Scrub(ctx context.Context, text string) string {
+	text = s.Mask(text)
+	if s.Strictness != ScrubStrict || strings.TrimSpace(text) == "" {
+		return text
+	}
+	apiKey := GetAPIKey("CLAUDE_API_KEY")
+	if apiKey == "" {
+		return text
+	}
+
+	reply, err := sendClaudePrompt(ctx, renderPrompt(scrubClaudePrompt, map[string]string{"text": text}), apiKey)
+	reply = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(reply), "<text>"), "</text>"))
+	switch {
+	case err != nil:
+		log.Printf("[SCRUB] Claude scrubbing failed, storing pattern-masked text: %v", err)
+		return text
+	case reply == "" || len(reply) > 2*len(text)+100:
+		// A reply that lost the text or added to it is not a scrubbed copy of it
+		log.Printf("[SCRUB] Ignoring Claude reply of %d bytes for text of %d bytes", len(reply), len(text))
+		return text
+	}
+	return s.Mask(reply)
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTextScrubberMask(t *testing.T) {
+	scrubber := TextScrubber{Strictness: ScrubStandard}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "Email", text: "Mail me at jane.doe+art@example.com", want: "Mail me at [email removed]"},
+		{name: "Phone", text: "Call +1 (555) 123-4567 now", want: "Call [phone removed] now"},
+		{name: "Counts are not phones", text: "200 circles over 1920x1080 pixels", want: "200 circles over 1920x1080 pixels"},
+		{name: "Profanity", text: "Holy SHIT that is fucking calm", want: "Holy **** that is ******* calm"},
+		{name: "Whole words only", text: "Shiitake mushrooms in a cocktail", want: "Shiitake mushrooms in a cocktail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scrubber.Mask(tt.text); got != tt.want {
+				t.Errorf("Mask(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	if got := (TextScrubber{Strictness: ScrubOff}).Mask("shit"); got != "shit" {
+		t.Errorf("Mask with scrubbing off = %q, want it unchanged", got)
+	}
+
+	words := filepath.Join(t.TempDir(), "words.txt")
+	os.WriteFile(words, []byte("# terms our community guidelines ban\nGrumble\n"), 0o600)
+	t.Setenv("SCRUB_WORDS_FILE", words)
+	if got := scrubber.Mask("grumble grumble"); got != "******* *******" {
+		t.Errorf("Mask with SCRUB_WORDS_FILE = %q, want its words masked", got)
+	}
+}
+
+func TestScrubStrictness(t *testing.T) {
+	t.Setenv("SCRUB_STRICTNESS", "")
+	if got := ScrubStrictness(0); got != ScrubStandard {
+		t.Errorf("default strictness = %q, want %q", got, ScrubStandard)
+	}
+
+	t.Setenv("SCRUB_STRICTNESS", "off")
+	t.Setenv("SCRUB_WORKSPACE_STRICTNESS", "1=strict,2=loose")
+	for workspace, want := range map[int]string{0: ScrubOff, 1: ScrubStrict, 2: ScrubOff, 3: ScrubOff} {
+		if got := ScrubStrictness(workspace); got != want {
+			t.Errorf("ScrubStrictness(%d) = %q, want %q", workspace, got, want)
+		}
+	}
+}
+
+func TestTextScrubberStrict(t *testing.T) {
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+	t.Setenv("CLAUDE_API_KEY", "test-key")
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+	claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content": [{"type": "text", "text": "<text>\nWaves for [removed] at shit@example.com\n</text>"}]}`))
+	}))
+	defer claude.Close()
+	savedURL := claudeMessagesURL
+	claudeMessagesURL = claude.URL
+	t.Cleanup(func() { claudeMessagesURL = savedURL })
+
+	// What Claude sends back is masked again, in case it let something through
+	got := TextScrubber{Strictness: ScrubStrict}.Scrub(context.Background(), "Waves for Jane Doe")
+	if want := "Waves for [removed] at [email removed]"; got != want {
+		t.Errorf("Scrub() = %q, want %q", got, want)
+	}
+
+	claudeMessagesURL = "http://127.0.0.1:0"
+	if got := (TextScrubber{Strictness: ScrubStrict}).Scrub(context.Background(), "calm shit"); got != "calm ****" {
+		t.Errorf("Scrub() without Claude = %q, want the pattern-masked text", got)
+	}
+}
+
+func TestScrubbedComments(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("SCRUB_STRICTNESS", "")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	author := registerUser(t, router, "author")
+	var saved SaveAnimationResponse
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves, ask me at jane@example.com"}
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	stored, err := store.GetAnimation(context.Background(), saved.ID)
+	if err != nil || stored.Description != "waves, ask me at [email removed]" {
+		t.Errorf("stored description = %q, %v; want the email masked", stored.Description, err)
+	}
+
+	var comment Comment
+	if code := doJSON(t, router, http.MethodPost, "/animation/"+saved.ID+"/comments", author, CreateCommentRequest{Body: "text me on 555 123 4567"}, &comment); code != http.StatusCreated {
+		t.Fatalf("create comment status = %d", code)
+	}
+	if comment.Body != "text me on [phone removed]" {
+		t.Errorf("comment body = %q, want the phone number masked", comment.Body)
+	}
+
+	// Comments stored before scrubbing was configured are masked when shown
+	store.CreateComment(context.Background(), saved.ID, "", "what the fuck")
+	var listed CommentsResponse
+	doJSON(t, router, http.MethodGet, "/animation/"+saved.ID+"/comments", "", nil, &listed)
+	if len(listed.Comments) != 2 || listed.Comments[1].Body != "what the ****" {
+		t.Errorf("listed comments = %+v, want the older comment masked", listed.Comments)
+	}
+}
+
+func TestWorkspaceScrubStrictness(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("SCRUB_STRICTNESS", "")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	member := registerAccount(t, router, "member")
+	outsider := registerAccount(t, router, "outsider")
+	var org Organization
+	if code := doJSON(t, router, http.MethodPost, "/orgs", member.Token, OrganizationRequest{Name: "Studio"}, &org); code != http.StatusCreated {
+		t.Fatalf("create workspace status = %d", code)
+	}
+	t.Setenv("SCRUB_WORKSPACE_STRICTNESS", strconv.Itoa(org.ID)+"=off")
+	var saved SaveAnimationResponse
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", member.Token, SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}"}, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	// Strictness follows the workspace of whoever is signed in
+	for name, tt := range map[string]struct {
+		token string
+		want  string
+	}{
+		"member":   {token: member.Token, want: "ask me at jane@example.com"},
+		"outsider": {token: outsider.Token, want: "ask me at [email removed]"},
+	} {
+		var comment Comment
+		if code := doJSON(t, router, http.MethodPost, "/animation/"+saved.ID+"/comments", tt.token, CreateCommentRequest{Body: "ask me at jane@example.com"}, &comment); code != http.StatusCreated {
+			t.Fatalf("%s's comment status = %d", name, code)
+		}
+		if comment.Body != tt.want {
+			t.Errorf("%s's comment = %q, want %q", name, comment.Body, tt.want)
+		}
+	}
+}
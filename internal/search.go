@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// SearchFacetP5Version facets matches by the p5.js version they are pinned to
+const SearchFacetP5Version = "p5Version"
+
+// errFacetsUnsupported means a search asked for a facet the backend cannot filter on
+var errFacetsUnsupported = errors.New("search backend does not support facets")
+
+// SearchRequest is a full-text search of the animations the feed may show
+type SearchRequest struct {
+	Query  string
+	Filter FeedFilter
+	// P5Version only matches animations pinned to this p5.js version when set
+	P5Version string
+	Limit     int
+	Offset    int
+}
+
+// SearchResults is a page of matches, best first
+type SearchResults struct {
+	Animations []GetAnimationResponse
+	Total      int
+	// Facets counts all matches per facet value; nil when the backend does not facet
+	Facets map[string]map[string]int
+}
+
+// Searcher answers /search. The default searches PostgreSQL; with SEARCH_BACKEND set, the
+// replicated Meilisearch or OpenSearch index is searched instead.
+type Searcher interface {
+	Search(ctx context.Context, req SearchRequest) (SearchResults, error)
+}
+
+// storeSearcher searches with the store's full-text search
+type storeSearcher struct {
+	store AnimationStore
+}
+
+func (s storeSearcher) Search(ctx context.Context, req SearchRequest) (SearchResults, error) {
+	if req.P5Version != "" {
+		return SearchResults{}, errFacetsUnsupported
+	}
+	animations, total, err := s.store.SearchAnimations(ctx, req.Query, req.Filter, req.Limit, req.Offset)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	return SearchResults{Animations: animations, Total: total}, nil
+}
+
+// indexSearcher queries an external index and loads the matching animations from the store. When
+// the index fails, searches without a facet selection fall back to fallback.
+type indexSearcher struct {
+	index    SearchIndex
+	store    AnimationStore
+	fallback Searcher
+}
+
+func (s indexSearcher) Search(ctx context.Context, req SearchRequest) (SearchResults, error) {
+	hits, err := s.index.Query(ctx, req)
+	if err != nil {
+		if req.P5Version != "" || s.fallback == nil {
+			return SearchResults{}, err
+		}
+		log.Printf("[SEARCH] %s query failed, falling back to PostgreSQL: %v", s.index.Backend(), err)
+		return s.fallback.Search(ctx, req)
+	}
+
+	results := SearchResults{Animations: []GetAnimationResponse{}, Total: hits.Total, Facets: hits.Facets}
+	for _, id := range hits.IDs {
+		animation, err := s.store.GetAnimation(ctx, id)
+		if err != nil {
+			// Deleted or removed before the index caught up
+			log.Printf("[SEARCH] Skipping indexed animation %s: %v", id, err)
+			continue
+		}
+		results.Animations = append(results.Animations, animation)
+	}
+	return results, nil
+}
+
+// NewSearcher returns the searcher for store: the external index when SEARCH_BACKEND is set and
+// SEARCH_SERVE_QUERIES is not false, PostgreSQL otherwise
+func NewSearcher(store AnimationStore) Searcher {
+	fallback := storeSearcher{store: store}
+	index, ok := GetSearchIndex()
+	if !ok {
+		return fallback
+	}
+	// Replication can run on its own while a new index is filled
+	if serve, set := envBool("SEARCH_SERVE_QUERIES"); set && !serve {
+		log.Printf("[SEARCH] SEARCH_SERVE_QUERIES is false, /search keeps using PostgreSQL")
+		return fallback
+	}
+	return indexSearcher{index: index, store: store, fallback: fallback}
+}
@@ -0,0 +1,662 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Settings for replicating animations into an external search index
+const (
+	defaultSearchIndexName = "animations"
+	searchIndexTimeout     = 10 * time.Second
+	// searchOutboxBatchSize is how many outbox events a replicator claims at once
+	searchOutboxBatchSize = 100
+	// searchBackfillBatchSize is how many animations BackfillSearchIndex sends per request
+	searchBackfillBatchSize   = 500
+	searchReplicationInterval = 2 * time.Second
+	// searchRetryMaxSeconds caps the delay before a failed event is retried
+	searchRetryMaxSeconds = 600
+)
+
+// Supported SEARCH_BACKEND values
+const (
+	SearchBackendMeilisearch = "meilisearch"
+	SearchBackendOpenSearch  = "opensearch"
+)
+
+// Outbox event types
+const (
+	SearchEventCreate = "create"
+	SearchEventUpdate = "update"
+	SearchEventDelete = "delete"
+)
+
+// SearchIndex is an external full-text index animations are replicated into
+type SearchIndex interface {
+	// Backend names the search engine, e.g. SearchBackendMeilisearch
+	Backend() string
+	// Configure creates the index or updates its settings so the feed filters and facets work
+	Configure(ctx context.Context) error
+	// Upsert adds documents or replaces those with the same ID
+	Upsert(ctx context.Context, docs []SearchDocument) error
+	// Delete removes documents by ID; IDs that are not indexed are ignored
+	Delete(ctx context.Context, ids []string) error
+	// Query returns the IDs of a page of matches, best first, with the total and facet counts
+	Query(ctx context.Context, req SearchRequest) (searchHits, error)
+}
+
+// searchHits is a page of matches from a search index
+type searchHits struct {
+	IDs    []string
+	Total  int
+	Facets map[string]map[string]int
+}
+
+// searchClient sends requests to a search engine's HTTP API
+type searchClient struct {
+	url    string
+	apiKey string
+	index  string
+	client *http.Client
+}
+
+// do sends a request and returns the response body, failing unless the status is 2xx
+func (c *searchClient) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	ctx, span := StartSpan(ctx, "search "+method+" "+path, SpanKindClient)
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("search API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// meilisearchIndex writes to a Meilisearch index. Meilisearch applies writes asynchronously, so a
+// request succeeds once the task is enqueued.
+type meilisearchIndex struct {
+	searchClient
+}
+
+func (m *meilisearchIndex) Backend() string {
+	return SearchBackendMeilisearch
+}
+
+func (m *meilisearchIndex) Configure(ctx context.Context) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"searchableAttributes": []string{"description"},
+		"filterableAttributes": []string{"renderStatus", "photosensitivity", "motionScore", "p5Version"},
+		"sortableAttributes":   []string{"createdAt"},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.do(ctx, http.MethodPatch, "/indexes/"+url.PathEscape(m.index)+"/settings", "application/json", body)
+	return err
+}
+
+func (m *meilisearchIndex) Upsert(ctx context.Context, docs []SearchDocument) error {
+	body, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search documents: %w", err)
+	}
+	_, err = m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(m.index)+"/documents?primaryKey=id", "application/json", body)
+	return err
+}
+
+func (m *meilisearchIndex) Delete(ctx context.Context, ids []string) error {
+	body, err := json.Marshal(ids)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search document IDs: %w", err)
+	}
+	_, err = m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(m.index)+"/documents/delete-batch", "application/json", body)
+	return err
+}
+
+// meilisearchFilter expresses the feed filters and facet selection in Meilisearch's filter syntax
+func meilisearchFilter(req SearchRequest) string {
+	conditions := []string{
+		fmt.Sprintf("renderStatus NOT IN [%q, %q]", RenderStatusCrashed, RenderStatusNondeterministic),
+		fmt.Sprintf("photosensitivity != %q", PhotosensitivityFlashing),
+	}
+	if req.Filter.ReducedMotion {
+		conditions = append(conditions, fmt.Sprintf("photosensitivity = %q", PhotosensitivitySafe), fmt.Sprintf("motionScore <= %g", req.Filter.MaxMotionScore))
+	} else if req.Filter.AvoidFlashing {
+		conditions = append(conditions, fmt.Sprintf("photosensitivity = %q", PhotosensitivitySafe))
+	}
+	if req.P5Version != "" {
+		conditions = append(conditions, fmt.Sprintf("p5Version = %q", req.P5Version))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// Query searches with Meilisearch's default typo tolerance
+func (m *meilisearchIndex) Query(ctx context.Context, req SearchRequest) (searchHits, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"q":                    req.Query,
+		"offset":               req.Offset,
+		"limit":                req.Limit,
+		"filter":               meilisearchFilter(req),
+		"facets":               []string{SearchFacetP5Version},
+		"attributesToRetrieve": []string{"id"},
+	})
+	if err != nil {
+		return searchHits{}, err
+	}
+	data, err := m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(m.index)+"/search", "application/json", body)
+	if err != nil {
+		return searchHits{}, err
+	}
+
+	var parsed struct {
+		Hits []struct {
+			ID string `json:"id"`
+		} `json:"hits"`
+		EstimatedTotalHits int                       `json:"estimatedTotalHits"`
+		FacetDistribution  map[string]map[string]int `json:"facetDistribution"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return searchHits{}, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	hits := searchHits{IDs: []string{}, Total: parsed.EstimatedTotalHits, Facets: parsed.FacetDistribution}
+	for _, hit := range parsed.Hits {
+		hits.IDs = append(hits.IDs, hit.ID)
+	}
+	return hits, nil
+}
+
+// openSearchIndex writes to an OpenSearch (or Elasticsearch) index through the bulk API
+type openSearchIndex struct {
+	searchClient
+}
+
+func (o *openSearchIndex) Backend() string {
+	return SearchBackendOpenSearch
+}
+
+// Configure creates the index with a mapping whose filter fields are keywords. An existing index
+// keeps its mapping; delete it and run the backfill to change it.
+func (o *openSearchIndex) Configure(ctx context.Context) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"id":               map[string]string{"type": "keyword"},
+				"description":      map[string]string{"type": "text", "analyzer": "english"},
+				"p5Version":        map[string]string{"type": "keyword"},
+				"renderStatus":     map[string]string{"type": "keyword"},
+				"photosensitivity": map[string]string{"type": "keyword"},
+				"motionScore":      map[string]string{"type": "float"},
+				"createdAt":        map[string]string{"type": "long"},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = o.do(ctx, http.MethodPut, "/"+url.PathEscape(o.index), "application/json", body)
+	if err != nil && strings.Contains(err.Error(), "resource_already_exists_exception") {
+		return nil
+	}
+	return err
+}
+
+// openSearchQuery builds a query matching descriptions with fuzziness for typos, filtered like the feed
+func openSearchQuery(req SearchRequest) map[string]interface{} {
+	term := func(field, value string) map[string]interface{} {
+		return map[string]interface{}{"term": map[string]string{field: value}}
+	}
+	filter := []interface{}{}
+	if req.Filter.ReducedMotion {
+		filter = append(filter, term("photosensitivity", PhotosensitivitySafe),
+			map[string]interface{}{"range": map[string]interface{}{"motionScore": map[string]float64{"lte": req.Filter.MaxMotionScore}}})
+	} else if req.Filter.AvoidFlashing {
+		filter = append(filter, term("photosensitivity", PhotosensitivitySafe))
+	}
+	if req.P5Version != "" {
+		filter = append(filter, term("p5Version", req.P5Version))
+	}
+
+	return map[string]interface{}{
+		"from":             req.Offset,
+		"size":             req.Limit,
+		"track_total_hits": true,
+		"_source":          false,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []interface{}{map[string]interface{}{
+					"match": map[string]interface{}{"description": map[string]string{"query": req.Query, "fuzziness": "AUTO"}},
+				}},
+				"filter": filter,
+				"must_not": []interface{}{
+					map[string]interface{}{"terms": map[string][]string{"renderStatus": {RenderStatusCrashed, RenderStatusNondeterministic}}},
+					term("photosensitivity", PhotosensitivityFlashing),
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			SearchFacetP5Version: map[string]interface{}{"terms": map[string]string{"field": "p5Version"}},
+		},
+	}
+}
+
+func (o *openSearchIndex) Query(ctx context.Context, req SearchRequest) (searchHits, error) {
+	body, err := json.Marshal(openSearchQuery(req))
+	if err != nil {
+		return searchHits{}, err
+	}
+	data, err := o.do(ctx, http.MethodPost, "/"+url.PathEscape(o.index)+"/_search", "application/json", body)
+	if err != nil {
+		return searchHits{}, err
+	}
+
+	var parsed struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations map[string]struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return searchHits{}, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	hits := searchHits{IDs: []string{}, Total: parsed.Hits.Total.Value, Facets: map[string]map[string]int{}}
+	for _, hit := range parsed.Hits.Hits {
+		hits.IDs = append(hits.IDs, hit.ID)
+	}
+	for facet, aggregation := range parsed.Aggregations {
+		hits.Facets[facet] = map[string]int{}
+		for _, bucket := range aggregation.Buckets {
+			hits.Facets[facet][bucket.Key] = bucket.DocCount
+		}
+	}
+	return hits, nil
+}
+
+func (o *openSearchIndex) Upsert(ctx context.Context, docs []SearchDocument) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		encoder.Encode(map[string]interface{}{"index": map[string]string{"_index": o.index, "_id": doc.ID}})
+		if err := encoder.Encode(doc); err != nil {
+			return fmt.Errorf("failed to marshal search document: %w", err)
+		}
+	}
+	return o.bulk(ctx, body.Bytes())
+}
+
+func (o *openSearchIndex) Delete(ctx context.Context, ids []string) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, id := range ids {
+		encoder.Encode(map[string]interface{}{"delete": map[string]string{"_index": o.index, "_id": id}})
+	}
+	return o.bulk(ctx, body.Bytes())
+}
+
+// bulk sends NDJSON actions. The API answers 200 even when items fail, so each item is checked;
+// deleting a document that is not indexed is not a failure.
+func (o *openSearchIndex) bulk(ctx context.Context, body []byte) error {
+	data, err := o.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		return err
+	}
+	var parsed struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if !parsed.Errors {
+		return nil
+	}
+	for _, item := range parsed.Items {
+		for action, result := range item {
+			if result.Status >= 300 && !(action == "delete" && result.Status == http.StatusNotFound) {
+				return fmt.Errorf("bulk %s of %s returned %d: %s", action, result.ID, result.Status, result.Error)
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	searchIndexOnce sync.Once
+	searchIndex     SearchIndex
+)
+
+// GetSearchIndex returns the shared index configured by SEARCH_BACKEND, SEARCH_URL, SEARCH_API_KEY
+// and SEARCH_INDEX, or false when no external search engine is configured
+func GetSearchIndex() (SearchIndex, bool) {
+	searchIndexOnce.Do(func() {
+		index, err := searchIndexFromEnv()
+		if err != nil {
+			log.Printf("[SEARCH] External search index disabled: %v", err)
+			return
+		}
+		if index != nil {
+			log.Printf("[SEARCH] Replicating animations into %s at %s", index.Backend(), os.Getenv("SEARCH_URL"))
+		}
+		searchIndex = index
+	})
+	return searchIndex, searchIndex != nil
+}
+
+// searchIndexFromEnv builds the index described by the environment, or nil when SEARCH_BACKEND is unset
+func searchIndexFromEnv() (SearchIndex, error) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("SEARCH_BACKEND")))
+	if backend == "" {
+		return nil, nil
+	}
+	baseURL := strings.TrimRight(os.Getenv("SEARCH_URL"), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("SEARCH_URL is required with SEARCH_BACKEND=%s", backend)
+	}
+	name := os.Getenv("SEARCH_INDEX")
+	if name == "" {
+		name = defaultSearchIndexName
+	}
+	client := searchClient{
+		url:    baseURL,
+		apiKey: os.Getenv("SEARCH_API_KEY"),
+		index:  name,
+		client: &http.Client{Timeout: searchIndexTimeout},
+	}
+
+	switch backend {
+	case SearchBackendMeilisearch:
+		return &meilisearchIndex{client}, nil
+	case SearchBackendOpenSearch:
+		return &openSearchIndex{client}, nil
+	}
+	return nil, fmt.Errorf("unknown SEARCH_BACKEND %q, want %s or %s", backend, SearchBackendMeilisearch, SearchBackendOpenSearch)
+}
+
+// recordSearchEvent adds an event to the outbox in the transaction that changes the animation, so
+// the index cannot miss a committed change. Only the primary region is replicated, which keeps
+// other regions' data out of the shared index.
+func recordSearchEvent(ctx context.Context, tx *sql.Tx, animationId, event string) error {
+	if _, ok := GetSearchIndex(); !ok || !isPrimaryRegion(ctx) {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO search_outbox (animation_id, event) VALUES ($1, $2)", animationId, event); err != nil {
+		return fmt.Errorf("failed to record search event: %w", err)
+	}
+	return nil
+}
+
+// searchEvent is an outbox event claimed by a replicator
+type searchEvent struct {
+	ID          int64
+	AnimationID string
+}
+
+// claimSearchEvents leases up to limit due events for five minutes, so a replicator that dies
+// mid-batch only delays them. Other instances skip the claimed rows.
+func claimSearchEvents(ctx context.Context, limit int) ([]searchEvent, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbFor(ctx).QueryContext(ctx,
+		`UPDATE search_outbox SET attempts = attempts + 1, next_attempt_at = NOW() + INTERVAL '5 minutes'
+		 WHERE id IN (
+			SELECT id FROM search_outbox WHERE next_attempt_at <= NOW()
+			ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, animation_id`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer rows.Close()
+
+	var events []searchEvent
+	for rows.Next() {
+		var event searchEvent
+		if err := rows.Scan(&event.ID, &event.AnimationID); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// completeSearchEvents removes replicated events from the outbox
+func completeSearchEvents(ctx context.Context, ids []int64) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if _, err := dbFor(ctx).ExecContext(ctx, "DELETE FROM search_outbox WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to complete search events: %v", err)
+	}
+	return nil
+}
+
+// failSearchEvents schedules a retry, doubling the delay with each attempt
+func failSearchEvents(ctx context.Context, ids []int64, cause error) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := dbFor(ctx).ExecContext(ctx,
+		`UPDATE search_outbox
+		 SET next_attempt_at = NOW() + LEAST(POWER(2, attempts), $2) * INTERVAL '1 second', last_error = $3
+		 WHERE id = ANY($1)`,
+		pq.Array(ids), searchRetryMaxSeconds, cause.Error(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule search events: %v", err)
+	}
+	return nil
+}
+
+const searchDocumentColumns = `SELECT id, description, COALESCE(p5_version, ''), COALESCE(render_status, ''),
+	COALESCE(photosensitivity, ''), motion_score, created_at FROM animations`
+
+// scanSearchDocuments reads rows selected with searchDocumentColumns
+func scanSearchDocuments(rows *sql.Rows) ([]SearchDocument, error) {
+	defer rows.Close()
+	docs := []SearchDocument{}
+	for rows.Next() {
+		var doc SearchDocument
+		var motionScore sql.NullFloat64
+		var createdAt time.Time
+		if err := rows.Scan(&doc.ID, &doc.Description, &doc.P5Version, &doc.RenderStatus, &doc.Photosensitivity, &motionScore, &createdAt); err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if motionScore.Valid {
+			doc.MotionScore = &motionScore.Float64
+		}
+		doc.CreatedAt = createdAt.Unix()
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// ListSearchDocuments returns the index documents of the given animations; removed and deleted
+// animations, and ones waiting for review, are left out
+func ListSearchDocuments(ctx context.Context, ids []string) ([]SearchDocument, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbFor(ctx).QueryContext(ctx, searchDocumentColumns+" a WHERE a.id = ANY($1) AND a.removed_at IS NULL AND "+reviewedCondition, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return scanSearchDocuments(rows)
+}
+
+// listSearchDocumentsAfter returns up to limit index documents of animations with IDs after afterId
+func listSearchDocumentsAfter(ctx context.Context, afterId string, limit int) ([]SearchDocument, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := dbFor(ctx).QueryContext(ctx,
+		searchDocumentColumns+" a WHERE a.id > $1 AND a.removed_at IS NULL AND "+reviewedCondition+" ORDER BY a.id LIMIT $2",
+		afterId, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return scanSearchDocuments(rows)
+}
+
+// syncSearchDocuments makes the index match docs for the given animation IDs: animations with a
+// document are upserted and the rest deleted
+func syncSearchDocuments(ctx context.Context, index SearchIndex, ids []string, docs []SearchDocument) error {
+	live := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		live[doc.ID] = true
+	}
+	var gone []string
+	for _, id := range ids {
+		if !live[id] {
+			gone = append(gone, id)
+		}
+	}
+
+	if len(docs) > 0 {
+		if err := index.Upsert(ctx, docs); err != nil {
+			return err
+		}
+	}
+	if len(gone) > 0 {
+		return index.Delete(ctx, gone)
+	}
+	return nil
+}
+
+// replicateSearchBatch claims a batch of outbox events and syncs their animations. Events only name
+// the animation; its current state is read here, so several events for one animation collapse into
+// one write and a late event cannot undo a newer change.
+func replicateSearchBatch(ctx context.Context, index SearchIndex) (int, error) {
+	events, err := claimSearchEvents(ctx, searchOutboxBatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	eventIds := make([]int64, len(events))
+	seen := map[string]bool{}
+	var animationIds []string
+	for i, event := range events {
+		eventIds[i] = event.ID
+		if !seen[event.AnimationID] {
+			seen[event.AnimationID] = true
+			animationIds = append(animationIds, event.AnimationID)
+		}
+	}
+
+	docs, err := ListSearchDocuments(ctx, animationIds)
+	if err == nil {
+		err = syncSearchDocuments(ctx, index, animationIds, docs)
+	}
+	if err != nil {
+		if failErr := failSearchEvents(ctx, eventIds, err); failErr != nil {
+			log.Printf("[SEARCH] %v", failErr)
+		}
+		return len(events), err
+	}
+	return len(events), completeSearchEvents(ctx, eventIds)
+}
+
+// RunSearchReplicator drains the outbox into the external search index until ctx is done. It does
+// nothing unless SEARCH_BACKEND is set.
+func RunSearchReplicator(ctx context.Context) {
+	index, ok := GetSearchIndex()
+	if !ok {
+		return
+	}
+	if err := index.Configure(ctx); err != nil {
+		log.Printf("[SEARCH] Failed to configure the %s index: %v", index.Backend(), err)
+	}
+	ticker := time.NewTicker(searchReplicationInterval)
+	defer ticker.Stop()
+	for {
+		// Keep going while full batches show a backlog
+		var err error
+		for {
+			var count int
+			count, err = replicateSearchBatch(ctx, index)
+			if err != nil {
+				log.Printf("[SEARCH] Failed to replicate %d events, will retry: %v", count, err)
+				break
+			}
+			if count < searchOutboxBatchSize {
+				break
+			}
+		}
+		recordWorkerPass("search replication", searchReplicationInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// BackfillSearchIndex upserts every animation into the index, for a new index or one that fell
+// behind. Animations deleted before the outbox existed stay indexed until the index is rebuilt.
+func BackfillSearchIndex(ctx context.Context, index SearchIndex) (int, error) {
+	if err := index.Configure(ctx); err != nil {
+		return 0, fmt.Errorf("failed to configure index: %w", err)
+	}
+	indexed := 0
+	afterId := ""
+	for {
+		docs, err := listSearchDocumentsAfter(ctx, afterId, searchBackfillBatchSize)
+		if err != nil || len(docs) == 0 {
+			return indexed, err
+		}
+		if err := index.Upsert(ctx, docs); err != nil {
+			return indexed, err
+		}
+		indexed += len(docs)
+		afterId = docs[len(docs)-1].ID
+		log.Printf("[SEARCH] Indexed %d animations so far", indexed)
+	}
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchIndexFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		url         string
+		wantBackend string
+		wantErr     bool
+	}{
+		{name: "Disabled"},
+		{name: "Meilisearch", backend: "meilisearch", url: "http://localhost:7700", wantBackend: SearchBackendMeilisearch},
+		{name: "OpenSearch", backend: "OpenSearch", url: "https://search.internal:9200/", wantBackend: SearchBackendOpenSearch},
+		{name: "Missing URL", backend: "meilisearch", wantErr: true},
+		{name: "Unknown backend", backend: "solr", url: "http://localhost:8983", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SEARCH_BACKEND", tt.backend)
+			t.Setenv("SEARCH_URL", tt.url)
+			index, err := searchIndexFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("searchIndexFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			gotBackend := ""
+			if index != nil {
+				gotBackend = index.Backend()
+			}
+			if gotBackend != tt.wantBackend {
+				t.Errorf("backend = %q, want %q", gotBackend, tt.wantBackend)
+			}
+		})
+	}
+}
+
+// recordedRequest is a request received by a fake search engine
+type recordedRequest struct {
+	Method, Path, Auth, Body string
+}
+
+func fakeSearchEngine(t *testing.T, response string) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+	var got []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, recordedRequest{r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(body)})
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestMeilisearchIndex(t *testing.T) {
+	server, got := fakeSearchEngine(t, `{"taskUid": 1}`)
+	index := &meilisearchIndex{searchClient{url: server.URL, apiKey: "key", index: "animations", client: server.Client()}}
+
+	docs := []SearchDocument{{ID: "a1", Description: "calm waves", RenderStatus: "ok", Photosensitivity: "safe", CreatedAt: 1773329400}}
+	if err := index.Upsert(context.Background(), docs); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := index.Delete(context.Background(), []string{"b2", "c3"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	want := []recordedRequest{
+		{http.MethodPost, "/indexes/animations/documents?primaryKey=id", "Bearer key",
+			`[{"id":"a1","description":"calm waves","renderStatus":"ok","photosensitivity":"safe","createdAt":1773329400}]`},
+		{http.MethodPost, "/indexes/animations/documents/delete-batch", "Bearer key", `["b2","c3"]`},
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("requests = %+v, want %+v", *got, want)
+	}
+}
+
+func TestMeilisearchQuery(t *testing.T) {
+	server, got := fakeSearchEngine(t, `{"hits": [{"id": "a1"}, {"id": "c3"}], "estimatedTotalHits": 12, "facetDistribution": {"p5Version": {"1.9.4": 9, "1.11.1": 3}}}`)
+	index := &meilisearchIndex{searchClient{url: server.URL, index: "animations", client: server.Client()}}
+
+	hits, err := index.Query(context.Background(), SearchRequest{Query: "ocaen", P5Version: "1.9.4", Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := searchHits{IDs: []string{"a1", "c3"}, Total: 12, Facets: map[string]map[string]int{"p5Version": {"1.9.4": 9, "1.11.1": 3}}}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("Query() = %+v, want %+v", hits, want)
+	}
+	if len(*got) != 1 || (*got)[0].Path != "/indexes/animations/search" || !strings.Contains((*got)[0].Body, `"offset":4`) {
+		t.Errorf("requests = %+v, want one search from offset 4", *got)
+	}
+}
+
+func TestMeilisearchFilter(t *testing.T) {
+	base := `renderStatus NOT IN ["crashed", "nondeterministic"] AND photosensitivity != "flashing"`
+	tests := []struct {
+		name string
+		req  SearchRequest
+		want string
+	}{
+		{name: "Feed", want: base},
+		{name: "Reduced motion", req: SearchRequest{Filter: FeedFilter{ReducedMotion: true, MaxMotionScore: 0.05}},
+			want: base + ` AND photosensitivity = "safe" AND motionScore <= 0.05`},
+		{name: "Avoid flashing", req: SearchRequest{Filter: FeedFilter{AvoidFlashing: true}}, want: base + ` AND photosensitivity = "safe"`},
+		{name: "Facet", req: SearchRequest{P5Version: "1.9.4"}, want: base + ` AND p5Version = "1.9.4"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := meilisearchFilter(tt.req); got != tt.want {
+				t.Errorf("meilisearchFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenSearchQuery(t *testing.T) {
+	server, got := fakeSearchEngine(t, `{"hits": {"total": {"value": 3}, "hits": [{"_id": "a1"}]},
+		"aggregations": {"p5Version": {"buckets": [{"key": "1.9.4", "doc_count": 3}]}}}`)
+	index := &openSearchIndex{searchClient{url: server.URL, index: "animations", client: server.Client()}}
+
+	hits, err := index.Query(context.Background(), SearchRequest{Query: "ocaen", Limit: 1})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	want := searchHits{IDs: []string{"a1"}, Total: 3, Facets: map[string]map[string]int{"p5Version": {"1.9.4": 3}}}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("Query() = %+v, want %+v", hits, want)
+	}
+	if len(*got) != 1 || (*got)[0].Path != "/animations/_search" || !strings.Contains((*got)[0].Body, `"fuzziness":"AUTO"`) {
+		t.Errorf("requests = %+v, want one fuzzy search", *got)
+	}
+}
+
+func TestOpenSearchIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "Success", response: `{"errors": false, "items": []}`},
+		{name: "Deleting a missing document", response: `{"errors": true, "items": [{"delete": {"_id": "b2", "status": 404}}]}`},
+		{name: "Failed item", response: `{"errors": true, "items": [{"index": {"_id": "a1", "status": 429, "error": {"type": "es_rejected_execution_exception"}}}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, got := fakeSearchEngine(t, tt.response)
+			index := &openSearchIndex{searchClient{url: server.URL, index: "animations", client: server.Client()}}
+			err := index.Upsert(context.Background(), []SearchDocument{{ID: "a1", Description: "calm waves"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Upsert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			wantBody := `{"index":{"_id":"a1","_index":"animations"}}` + "\n" +
+				`{"id":"a1","description":"calm waves","renderStatus":"","photosensitivity":"","createdAt":0}` + "\n"
+			if len(*got) != 1 || (*got)[0].Path != "/_bulk" || (*got)[0].Body != wantBody {
+				t.Errorf("requests = %+v, want one bulk request with body %q", *got, wantBody)
+			}
+		})
+	}
+}
+
+// fakeSearchIndex records the writes made to it and answers queries with hits, or err
+type fakeSearchIndex struct {
+	upserted []string
+	deleted  []string
+	hits     searchHits
+	err      error
+}
+
+func (f *fakeSearchIndex) Backend() string                     { return "fake" }
+func (f *fakeSearchIndex) Configure(ctx context.Context) error { return nil }
+
+func (f *fakeSearchIndex) Query(ctx context.Context, req SearchRequest) (searchHits, error) {
+	return f.hits, f.err
+}
+
+func (f *fakeSearchIndex) Upsert(ctx context.Context, docs []SearchDocument) error {
+	for _, doc := range docs {
+		f.upserted = append(f.upserted, doc.ID)
+	}
+	return nil
+}
+
+func (f *fakeSearchIndex) Delete(ctx context.Context, ids []string) error {
+	f.deleted = append(f.deleted, ids...)
+	return nil
+}
+
+func TestSyncSearchDocuments(t *testing.T) {
+	index := &fakeSearchIndex{}
+	// b2 was deleted or removed, so it has no document
+	docs := []SearchDocument{{ID: "a1"}, {ID: "c3"}}
+	if err := syncSearchDocuments(context.Background(), index, []string{"a1", "b2", "c3"}, docs); err != nil {
+		t.Fatalf("syncSearchDocuments() error = %v", err)
+	}
+	if strings.Join(index.upserted, ",") != "a1,c3" || strings.Join(index.deleted, ",") != "b2" {
+		t.Errorf("upserted %v and deleted %v, want a1,c3 upserted and b2 deleted", index.upserted, index.deleted)
+	}
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIndexSearcher(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	var ids []string
+	for _, description := range []string{"calm ocean", "ocean at night"} {
+		id, err := store.SaveAnimation(ctx, "function setup() {}\nfunction draw() {}", description, "", "")
+		if err != nil {
+			t.Fatalf("SaveAnimation() error = %v", err)
+		}
+		ids = append(ids, id)
+	}
+	fallback := storeSearcher{store: store}
+	facets := map[string]map[string]int{SearchFacetP5Version: {"1.9.4": 2}}
+
+	tests := []struct {
+		name       string
+		index      *fakeSearchIndex
+		req        SearchRequest
+		wantIds    []string
+		wantTotal  int
+		wantFacets map[string]map[string]int
+		wantErr    error
+	}{
+		{
+			name: "Index order", index: &fakeSearchIndex{hits: searchHits{IDs: []string{ids[1], ids[0]}, Total: 2, Facets: facets}},
+			req: SearchRequest{Query: "ocaen", Limit: 10}, wantIds: []string{ids[1], ids[0]}, wantTotal: 2, wantFacets: facets,
+		},
+		{
+			name: "Deleted since indexed", index: &fakeSearchIndex{hits: searchHits{IDs: []string{"gone", ids[0]}, Total: 2}},
+			req: SearchRequest{Query: "ocean", Limit: 10}, wantIds: []string{ids[0]}, wantTotal: 2,
+		},
+		{
+			name: "Falls back to the store", index: &fakeSearchIndex{err: errors.New("connection refused")},
+			req: SearchRequest{Query: "night", Limit: 10}, wantIds: []string{ids[1]}, wantTotal: 1,
+		},
+		{
+			name: "Facet without the index", index: &fakeSearchIndex{err: errors.New("connection refused")},
+			req: SearchRequest{Query: "ocean", P5Version: "1.9.4", Limit: 10}, wantErr: errors.New("connection refused"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := indexSearcher{index: tt.index, store: store, fallback: fallback}.Search(ctx, tt.req)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Search() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			gotIds := []string{}
+			for _, animation := range results.Animations {
+				gotIds = append(gotIds, animation.ID)
+			}
+			if !reflect.DeepEqual(gotIds, tt.wantIds) || results.Total != tt.wantTotal || !reflect.DeepEqual(results.Facets, tt.wantFacets) {
+				t.Errorf("Search() = %v, total %d, facets %v, want %v, total %d, facets %v",
+					gotIds, results.Total, results.Facets, tt.wantIds, tt.wantTotal, tt.wantFacets)
+			}
+		})
+	}
+}
+
+func TestStoreSearcherRejectsFacets(t *testing.T) {
+	_, err := storeSearcher{store: NewMemoryStore()}.Search(context.Background(), SearchRequest{Query: "ocean", P5Version: "1.9.4", Limit: 10})
+	if !errors.Is(err, errFacetsUnsupported) {
+		t.Errorf("Search() error = %v, want %v", err, errFacetsUnsupported)
+	}
+}
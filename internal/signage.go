@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	maxSignageNameLength = 80
+	maxSignageSlots      = 48
+	// signagePollInterval caps how long screens may cache what is playing, so edits to a schedule
+	// reach them within it
+	signagePollInterval = time.Minute
+	// endOfDay is the minute "24:00" stands for at the end of a slot
+	endOfDay = 24 * 60
+)
+
+// signageDays maps the weekday names slots use to weekdays
+var signageDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ValidateSignageSchedule checks a schedule request and returns the schedule it describes, with
+// the slots' days lowercased and without repeats. Whether the animations exist is left to the
+// caller.
+func ValidateSignageSchedule(req SignageScheduleRequest) (SignageSchedule, error) {
+	schedule := SignageSchedule{
+		Name:                strings.TrimSpace(req.Name),
+		Timezone:            req.Timezone,
+		Slots:               []SignageSlot{},
+		FallbackAnimationID: req.FallbackAnimationID,
+	}
+	if schedule.Name == "" || len(schedule.Name) > maxSignageNameLength {
+		return SignageSchedule{}, fmt.Errorf("name must be 1-%d characters", maxSignageNameLength)
+	}
+	if schedule.Timezone == "" {
+		return SignageSchedule{}, errors.New("schedules need a timezone")
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return SignageSchedule{}, fmt.Errorf("unknown timezone %q", schedule.Timezone)
+	}
+	if len(req.Slots) == 0 && schedule.FallbackAnimationID == "" {
+		return SignageSchedule{}, errors.New("schedules need a slot or a fallback animation")
+	}
+	if len(req.Slots) > maxSignageSlots {
+		return SignageSchedule{}, fmt.Errorf("schedules may have at most %d slots", maxSignageSlots)
+	}
+
+	for i, slot := range req.Slots {
+		if slot.AnimationID == "" {
+			return SignageSchedule{}, fmt.Errorf("slot %d needs an animationId", i+1)
+		}
+		start, end, err := slot.minutes()
+		if err != nil {
+			return SignageSchedule{}, fmt.Errorf("slot %d: %v", i+1, err)
+		}
+		if start >= end {
+			return SignageSchedule{}, fmt.Errorf("slot %d must end after it starts; split slots that run past midnight", i+1)
+		}
+		days := []string{}
+		for _, day := range slot.Days {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if _, ok := signageDays[day]; !ok {
+				return SignageSchedule{}, fmt.Errorf("slot %d: unknown day %q, expected mon to sun", i+1, day)
+			}
+			if !slices.Contains(days, day) {
+				days = append(days, day)
+			}
+		}
+		slot.Days = days
+		schedule.Slots = append(schedule.Slots, slot)
+	}
+	return schedule, nil
+}
+
+// AnimationIDs returns the animations a schedule plays, without repeats
+func (s SignageSchedule) AnimationIDs() []string {
+	var ids []string
+	for _, slot := range s.Slots {
+		if !slices.Contains(ids, slot.AnimationID) {
+			ids = append(ids, slot.AnimationID)
+		}
+	}
+	if s.FallbackAnimationID != "" && !slices.Contains(ids, s.FallbackAnimationID) {
+		ids = append(ids, s.FallbackAnimationID)
+	}
+	return ids
+}
+
+// minutes returns the minutes of the day a slot starts and ends at
+func (s SignageSlot) minutes() (int, int, error) {
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if s.End == "24:00" {
+		return start, endOfDay, nil
+	}
+	end, err := parseClock(s.End)
+	return start, end, err
+}
+
+// appliesOn reports whether a slot plays on the weekday
+func (s SignageSlot) appliesOn(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, name := range s.Days {
+		if signageDays[name] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// NowPlaying returns the animation the schedule plays at now, and the next time that may change.
+// The first slot covering now wins, and the fallback plays when none does.
+func (s SignageSchedule) NowPlaying(now time.Time) SignageNowPlaying {
+	playing := SignageNowPlaying{ScheduleID: s.ID, AnimationID: s.FallbackAnimationID}
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	for _, slot := range s.Slots {
+		start, end, err := slot.minutes()
+		if err == nil && slot.appliesOn(local.Weekday()) && minute >= start && minute < end {
+			playing.AnimationID = slot.AnimationID
+			break
+		}
+	}
+
+	// The next slot starting or ending today may change the answer, and otherwise the next day
+	// beginning may, since slots can apply on some days only
+	at := func(days, minute int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, minute/60, minute%60, 0, 0, location)
+	}
+	playing.Until = at(1, 0)
+	for _, slot := range s.Slots {
+		start, end, err := slot.minutes()
+		if err != nil || !slot.appliesOn(local.Weekday()) {
+			continue
+		}
+		for _, boundary := range []time.Time{at(0, start), at(0, end)} {
+			if boundary.After(now) && boundary.Before(playing.Until) {
+				playing.Until = boundary
+			}
+		}
+	}
+	playing.Until = playing.Until.UTC()
+
+	if playing.AnimationID != "" {
+		playing.URL = PublicURL("/animation/" + playing.AnimationID)
+	}
+	return playing
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateSignageSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      SignageScheduleRequest
+		wantDays []string
+		wantErr  bool
+	}{
+		{name: "Slots", req: SignageScheduleRequest{Name: "Lobby", Timezone: "Europe/Berlin", Slots: []SignageSlot{
+			{AnimationID: "a1", Days: []string{"Mon", "tue", "mon"}, Start: "08:00", End: "12:00"},
+			{AnimationID: "a2", Start: "12:00", End: "24:00"},
+		}}, wantDays: []string{"mon", "tue"}},
+		{name: "Fallback only", req: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC", FallbackAnimationID: "a1"}},
+		{name: "Nothing to play", req: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC"}, wantErr: true},
+		{name: "Missing timezone", req: SignageScheduleRequest{Name: "Lobby", FallbackAnimationID: "a1"}, wantErr: true},
+		{name: "Unknown timezone", req: SignageScheduleRequest{Name: "Lobby", Timezone: "Mars/Olympus", FallbackAnimationID: "a1"}, wantErr: true},
+		{name: "Past midnight", req: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC", Slots: []SignageSlot{{AnimationID: "a1", Start: "22:00", End: "02:00"}}}, wantErr: true},
+		{name: "Bad time", req: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC", Slots: []SignageSlot{{AnimationID: "a1", Start: "8am", End: "12:00"}}}, wantErr: true},
+		{name: "Unknown day", req: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC", Slots: []SignageSlot{{AnimationID: "a1", Days: []string{"monday"}, Start: "08:00", End: "12:00"}}}, wantErr: true},
+		{name: "Missing animation", req: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC", Slots: []SignageSlot{{Start: "08:00", End: "12:00"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ValidateSignageSchedule(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateSignageSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(tt.wantDays) > 0 && !reflect.DeepEqual(schedule.Slots[0].Days, tt.wantDays) {
+				t.Errorf("days = %v, want %v", schedule.Slots[0].Days, tt.wantDays)
+			}
+		})
+	}
+}
+
+func TestSignageNowPlaying(t *testing.T) {
+	schedule := SignageSchedule{
+		Timezone: "Europe/Berlin",
+		Slots: []SignageSlot{
+			{AnimationID: "weekday-morning", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "12:00"},
+			{AnimationID: "daytime", Start: "06:00", End: "20:00"},
+		},
+		FallbackAnimationID: "night",
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, berlin) }
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		wantAnimation string
+		wantUntil     time.Time
+	}{
+		// 2026-10-16 is a Friday
+		{name: "First matching slot wins", now: at(16, 9, 30), wantAnimation: "weekday-morning", wantUntil: at(16, 12, 0)},
+		{name: "Later slot", now: at(16, 12, 0), wantAnimation: "daytime", wantUntil: at(16, 20, 0)},
+		{name: "Slot for some days only", now: at(17, 9, 30), wantAnimation: "daytime", wantUntil: at(17, 20, 0)},
+		{name: "Earlier slot starts during a later one", now: at(16, 7, 0), wantAnimation: "daytime", wantUntil: at(16, 8, 0)},
+		{name: "Fallback until midnight", now: at(16, 21, 0), wantAnimation: "night", wantUntil: at(17, 0, 0)},
+		{name: "Fallback until the first slot", now: at(17, 3, 0), wantAnimation: "night", wantUntil: at(17, 6, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playing := schedule.NowPlaying(tt.now.UTC())
+			if playing.AnimationID != tt.wantAnimation || !playing.Until.Equal(tt.wantUntil) {
+				t.Errorf("NowPlaying() = %s until %v, want %s until %v", playing.AnimationID, playing.Until, tt.wantAnimation, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestSignageHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	owner := registerUser(t, router, "clinic")
+	other := registerUser(t, router, "other")
+
+	var saved SaveAnimationResponse
+	doJSON(t, router, http.MethodPost, "/save-animation", owner, SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "calm"}, &saved)
+
+	var schedule SignageSchedule
+	allDay := SignageScheduleRequest{Name: "Waiting room", Timezone: "UTC", Slots: []SignageSlot{{AnimationID: saved.ID, Start: "00:00", End: "24:00"}}}
+	if code := doJSON(t, router, http.MethodPost, "/signage/schedules", owner, allDay, &schedule); code != http.StatusCreated {
+		t.Fatalf("create status = %d", code)
+	}
+	if len(schedule.ID) < 20 {
+		t.Errorf("schedule ID = %q, want an unguessable one", schedule.ID)
+	}
+
+	path := "/signage/schedules/" + schedule.ID
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Unknown animation", method: http.MethodPost, path: "/signage/schedules", token: owner, body: SignageScheduleRequest{Name: "Lobby", Timezone: "UTC", FallbackAnimationID: "missing"}, wantCode: http.StatusBadRequest},
+		{name: "Signed out", method: http.MethodPost, path: "/signage/schedules", body: allDay, wantCode: http.StatusUnauthorized},
+		{name: "Another user's", method: http.MethodGet, path: path, token: other, wantCode: http.StatusNotFound},
+		{name: "Update another user's", method: http.MethodPut, path: path, token: other, body: allDay, wantCode: http.StatusNotFound},
+		{name: "Update", method: http.MethodPut, path: path, token: owner, body: allDay, wantCode: http.StatusOK},
+		{name: "Unknown schedule", method: http.MethodGet, path: "/signage/schedules/missing/now", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	// Screens poll without signing in, and revalidate with the ETag
+	var playing SignageNowPlaying
+	if code := doJSON(t, router, http.MethodGet, path+"/now", "", nil, &playing); code != http.StatusOK || playing.AnimationID != saved.ID {
+		t.Fatalf("now playing = %d %+v, want %s", code, playing, saved.ID)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+"/now", nil))
+	if cacheControl := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cacheControl, "public, max-age=") {
+		t.Errorf("Cache-Control = %q, want it cacheable", cacheControl)
+	}
+	req := httptest.NewRequest(http.MethodGet, path+"/now", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want 304", rec.Code)
+	}
+
+	var list SignageSchedulesResponse
+	doJSON(t, router, http.MethodGet, "/signage/schedules", owner, nil, &list)
+	if len(list.Schedules) != 1 || list.Schedules[0].ID != schedule.ID {
+		t.Errorf("schedules = %+v, want the one created", list)
+	}
+	if code := doJSON(t, router, http.MethodDelete, path, owner, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d", code)
+	}
+}
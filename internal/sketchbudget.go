@@ -0,0 +1,313 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default per-frame budgets for sketches shown in the feed
+const (
+	defaultMaxIterationsPerFrame  = 100000
+	defaultMaxAllocationsPerFrame = 5000
+	defaultMaxFrameMs             = 33
+	defaultMaxHeapMB              = 256
+	defaultAssumedLoopBound       = 100
+)
+
+var (
+	drawFunctionRegex  = regexp.MustCompile(`function\s+draw\s*\(\s*\)\s*\{`)
+	forHeaderRegex     = regexp.MustCompile(`\bfor\s*\(`)
+	whileHeaderRegex   = regexp.MustCompile(`\bwhile\s*\(`)
+	countingLoopRegex  = regexp.MustCompile(`^\s*(?:let|var)?\s*([A-Za-z_$][\w$]*)\s*=\s*(-?\d+)\s*;\s*([A-Za-z_$][\w$]*)\s*(<=|<|>=|>)\s*(-?\d+)\s*;\s*(?:[A-Za-z_$][\w$]*\s*(\+\+|--|\+=\s*(\d+)|-=\s*(\d+))|(\+\+|--)\s*[A-Za-z_$][\w$]*)\s*$`)
+	infiniteWhileRegex = regexp.MustCompile(`^\s*(true|1)\s*$`)
+	allocationRegex    = regexp.MustCompile(`\bnew\s+[A-Za-z_$]|\b(?:createVector|color|createGraphics|createImage|loadImage)\s*\(|[=(,:]\s*[\[{]`)
+)
+
+// SketchBudget is the per-frame CPU and memory budget sketches must fit in
+type SketchBudget struct {
+	MaxIterationsPerFrame  int
+	MaxAllocationsPerFrame int
+	MaxFrameMs             int
+	MaxHeapMB              int
+	AssumedLoopBound       int
+}
+
+// SketchCostEstimate is the estimated per-frame cost of a sketch's draw() function
+type SketchCostEstimate struct {
+	IterationsPerFrame  int      `json:"iterationsPerFrame"`
+	AllocationsPerFrame int      `json:"allocationsPerFrame"`
+	UnboundedLoops      int      `json:"unboundedLoops"`
+	InfiniteLoop        bool     `json:"infiniteLoop"`
+	AvgFrameMs          float64  `json:"avgFrameMs,omitempty"`
+	HeapUsedMB          float64  `json:"heapUsedMB,omitempty"`
+	Violations          []string `json:"violations"`
+}
+
+// WithinBudget reports whether no budget was exceeded
+func (e SketchCostEstimate) WithinBudget() bool {
+	return len(e.Violations) == 0
+}
+
+// CurrentSketchBudget returns the budget configured by the SKETCH_MAX_* variables. A limit of 0 disables that check.
+func CurrentSketchBudget() SketchBudget {
+	return SketchBudget{
+		MaxIterationsPerFrame:  envLimit("SKETCH_MAX_ITERATIONS_PER_FRAME", defaultMaxIterationsPerFrame),
+		MaxAllocationsPerFrame: envLimit("SKETCH_MAX_ALLOCATIONS_PER_FRAME", defaultMaxAllocationsPerFrame),
+		MaxFrameMs:             envLimit("SKETCH_MAX_FRAME_MS", defaultMaxFrameMs),
+		MaxHeapMB:              envLimit("SKETCH_MAX_HEAP_MB", defaultMaxHeapMB),
+		AssumedLoopBound:       envLimit("SKETCH_ASSUMED_LOOP_BOUND", defaultAssumedLoopBound),
+	}
+}
+
+// loopRange is a loop body within draw() and how many times it runs per execution of its header
+type loopRange struct {
+	bodyStart  int
+	bodyEnd    int
+	iterations int
+}
+
+// EstimateSketchCost statically estimates how much work draw() does per frame.
+// Loops with literal bounds are counted exactly; other loops are assumed to run AssumedLoopBound times.
+func EstimateSketchCost(code string, budget SketchBudget) SketchCostEstimate {
+	estimate := SketchCostEstimate{Violations: []string{}}
+
+	body := drawBody(stripCommentsAndStrings(code))
+	if body == "" {
+		return estimate
+	}
+
+	loops := findLoops(body, budget.AssumedLoopBound, &estimate)
+
+	// Each loop body runs once per iteration of every loop around it
+	multiplierAt := func(position int) int {
+		multiplier := 1
+		for _, loop := range loops {
+			if position >= loop.bodyStart && position < loop.bodyEnd {
+				multiplier = saturatingMultiply(multiplier, loop.iterations)
+			}
+		}
+		return multiplier
+	}
+
+	for _, loop := range loops {
+		estimate.IterationsPerFrame = saturatingAdd(estimate.IterationsPerFrame, saturatingMultiply(multiplierAt(loop.bodyStart-1), loop.iterations))
+	}
+	for _, match := range allocationRegex.FindAllStringIndex(body, -1) {
+		estimate.AllocationsPerFrame = saturatingAdd(estimate.AllocationsPerFrame, multiplierAt(match[0]))
+	}
+
+	estimate.checkStatic(budget)
+	return estimate
+}
+
+// ApplyRenderMetrics adds measured frame time and heap usage from a headless run and checks them against the budget
+func (e *SketchCostEstimate) ApplyRenderMetrics(result RenderResult, budget SketchBudget) {
+	e.AvgFrameMs = result.AvgFrameMs
+	e.HeapUsedMB = float64(result.HeapUsedBytes) / (1024 * 1024)
+
+	if budget.MaxFrameMs > 0 && e.AvgFrameMs > float64(budget.MaxFrameMs) {
+		e.Violations = append(e.Violations, fmt.Sprintf("average frame time %.1fms exceeds %dms", e.AvgFrameMs, budget.MaxFrameMs))
+	}
+	if budget.MaxHeapMB > 0 && e.HeapUsedMB > float64(budget.MaxHeapMB) {
+		e.Violations = append(e.Violations, fmt.Sprintf("heap usage %.0fMB exceeds %dMB", e.HeapUsedMB, budget.MaxHeapMB))
+	}
+}
+
+func (e *SketchCostEstimate) checkStatic(budget SketchBudget) {
+	if e.InfiniteLoop {
+		e.Violations = append(e.Violations, "draw() contains a loop that never terminates")
+	}
+	if budget.MaxIterationsPerFrame > 0 && e.IterationsPerFrame > budget.MaxIterationsPerFrame {
+		e.Violations = append(e.Violations, fmt.Sprintf("about %d loop iterations per frame exceeds %d", e.IterationsPerFrame, budget.MaxIterationsPerFrame))
+	}
+	if budget.MaxAllocationsPerFrame > 0 && e.AllocationsPerFrame > budget.MaxAllocationsPerFrame {
+		e.Violations = append(e.Violations, fmt.Sprintf("about %d allocations per frame exceeds %d", e.AllocationsPerFrame, budget.MaxAllocationsPerFrame))
+	}
+}
+
+// findLoops locates for and while loops in body along with their estimated iteration counts
+func findLoops(body string, assumedBound int, estimate *SketchCostEstimate) []loopRange {
+	loops := make([]loopRange, 0)
+
+	addLoops := func(headers [][]int, parse func(header string) (int, bool)) {
+		for _, match := range headers {
+			headerEnd := matchingClose(body, match[1]-1, '(', ')')
+			if headerEnd < 0 {
+				continue
+			}
+			bodyStart, bodyEnd := statementRange(body, headerEnd+1)
+
+			iterations, bounded := parse(body[match[1]:headerEnd])
+			if !bounded {
+				estimate.UnboundedLoops++
+				iterations = assumedBound
+			}
+			loops = append(loops, loopRange{bodyStart: bodyStart, bodyEnd: bodyEnd, iterations: iterations})
+		}
+	}
+
+	addLoops(forHeaderRegex.FindAllStringIndex(body, -1), countingLoopIterations)
+	addLoops(whileHeaderRegex.FindAllStringIndex(body, -1), func(condition string) (int, bool) {
+		if infiniteWhileRegex.MatchString(condition) {
+			estimate.InfiniteLoop = true
+		}
+		return 0, false
+	})
+
+	return loops
+}
+
+// countingLoopIterations computes the iterations of a "for (i = a; i < b; i++)" style header
+func countingLoopIterations(header string) (int, bool) {
+	matches := countingLoopRegex.FindStringSubmatch(header)
+	if matches == nil || matches[1] != matches[3] {
+		return 0, false
+	}
+
+	start, _ := strconv.Atoi(matches[2])
+	bound, _ := strconv.Atoi(matches[5])
+	operator := matches[4]
+
+	step := 1
+	increment := matches[6]
+	if increment == "" {
+		increment = matches[9]
+	}
+	switch {
+	case matches[7] != "":
+		step, _ = strconv.Atoi(matches[7])
+	case matches[8] != "":
+		step, _ = strconv.Atoi(matches[8])
+		step = -step
+	case increment == "--":
+		step = -1
+	}
+	if step == 0 {
+		return 0, false
+	}
+
+	span := bound - start
+	if operator == "<=" || operator == ">=" {
+		if span >= 0 {
+			span++
+		} else {
+			span--
+		}
+	}
+
+	// Loops that step away from their bound never terminate
+	if (operator[0] == '<') != (step > 0) {
+		return 0, false
+	}
+
+	iterations := span / step
+	if span%step != 0 {
+		iterations++
+	}
+	if iterations < 0 {
+		return 0, true
+	}
+	return iterations, true
+}
+
+// drawBody returns the body of the draw() function, or "" when there is none
+func drawBody(code string) string {
+	match := drawFunctionRegex.FindStringIndex(code)
+	if match == nil {
+		return ""
+	}
+	end := matchingClose(code, match[1]-1, '{', '}')
+	if end < 0 {
+		return code[match[1]:]
+	}
+	return code[match[1]:end]
+}
+
+// statementRange returns the range of the statement starting at from: a braced block or a single statement
+func statementRange(code string, from int) (int, int) {
+	start := from
+	for start < len(code) && (code[start] == ' ' || code[start] == '\t' || code[start] == '\n' || code[start] == '\r') {
+		start++
+	}
+	if start < len(code) && code[start] == '{' {
+		if end := matchingClose(code, start, '{', '}'); end >= 0 {
+			return start, end
+		}
+		return start, len(code)
+	}
+	if end := strings.IndexByte(code[start:], ';'); end >= 0 {
+		return start, start + end + 1
+	}
+	return start, len(code)
+}
+
+// matchingClose returns the index of the bracket closing the one at open, or -1
+func matchingClose(code string, open int, openChar, closeChar byte) int {
+	depth := 0
+	for i := open; i < len(code); i++ {
+		switch code[i] {
+		case openChar:
+			depth++
+		case closeChar:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// stripCommentsAndStrings blanks out comments and string contents so brackets inside them are ignored
+func stripCommentsAndStrings(code string) string {
+	out := []byte(code)
+	for i := 0; i < len(out); i++ {
+		switch {
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '/':
+			for i < len(out) && out[i] != '\n' {
+				out[i] = ' '
+				i++
+			}
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '*':
+			for i < len(out) && !(out[i] == '*' && i+1 < len(out) && out[i+1] == '/') {
+				out[i] = ' '
+				i++
+			}
+			if i+1 < len(out) {
+				out[i], out[i+1] = ' ', ' '
+				i++
+			}
+		case out[i] == '"' || out[i] == '\'' || out[i] == '`':
+			quote := out[i]
+			for i++; i < len(out) && out[i] != quote; i++ {
+				if out[i] == '\\' && i+1 < len(out) {
+					out[i] = ' '
+					i++
+				}
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		}
+	}
+	return string(out)
+}
+
+// saturatingMultiply multiplies without overflowing past a very large estimate
+func saturatingMultiply(a, b int) int {
+	const ceiling = 1 << 40
+	if a != 0 && b > ceiling/a {
+		return ceiling
+	}
+	return a * b
+}
+
+func saturatingAdd(a, b int) int {
+	const ceiling = 1 << 40
+	if a+b > ceiling {
+		return ceiling
+	}
+	return a + b
+}
@@ -0,0 +1,109 @@
+package internal
+
+import "testing"
+
+func TestCountingLoopIterations(t *testing.T) {
+	tests := []struct {
+		header      string
+		want        int
+		wantBounded bool
+	}{
+		{header: "let i = 0; i < 100; i++", want: 100, wantBounded: true},
+		{header: "let i = 0; i <= 10; i += 2", want: 6, wantBounded: true},
+		{header: "let i = 10; i > 0; i--", want: 10, wantBounded: true},
+		{header: "let i = 0; i < particles.length; i++", wantBounded: false},
+		{header: "let i = 0; i < 10; i--", wantBounded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, bounded := countingLoopIterations(tt.header)
+			if bounded != tt.wantBounded || (bounded && got != tt.want) {
+				t.Errorf("countingLoopIterations() = %d, %v, want %d, %v", got, bounded, tt.want, tt.wantBounded)
+			}
+		})
+	}
+}
+
+func TestEstimateSketchCost(t *testing.T) {
+	budget := SketchBudget{
+		MaxIterationsPerFrame:  10000,
+		MaxAllocationsPerFrame: 100,
+		AssumedLoopBound:       50,
+	}
+
+	tests := []struct {
+		name            string
+		code            string
+		wantIterations  int
+		wantAllocations int
+		wantWithin      bool
+	}{
+		{
+			name: "Simple sketch",
+			code: `function setup() { createCanvas(400, 400); }
+function draw() {
+  background(220);
+  for (let i = 0; i < 10; i++) {
+    circle(i * 10, 200, 5);
+  }
+}`,
+			wantIterations: 10,
+			wantWithin:     true,
+		},
+		{
+			name: "Nested loops allocating vectors",
+			code: `function draw() {
+  for (let x = 0; x < 200; x++) {
+    for (let y = 0; y < 200; y++) {
+      let v = createVector(x, y); // "for (;;)" in a comment is ignored
+    }
+  }
+}`,
+			wantIterations:  200 + 200*200,
+			wantAllocations: 200 * 200,
+			wantWithin:      false,
+		},
+		{
+			name: "Unbounded loop uses assumed bound",
+			code: `function draw() {
+  for (let p of particles) {
+    p.update();
+  }
+}`,
+			wantIterations: 50,
+			wantWithin:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimate := EstimateSketchCost(tt.code, budget)
+			if estimate.IterationsPerFrame != tt.wantIterations {
+				t.Errorf("IterationsPerFrame = %d, want %d", estimate.IterationsPerFrame, tt.wantIterations)
+			}
+			if estimate.AllocationsPerFrame != tt.wantAllocations {
+				t.Errorf("AllocationsPerFrame = %d, want %d", estimate.AllocationsPerFrame, tt.wantAllocations)
+			}
+			if estimate.WithinBudget() != tt.wantWithin {
+				t.Errorf("WithinBudget() = %v, want %v (violations %v)", estimate.WithinBudget(), tt.wantWithin, estimate.Violations)
+			}
+		})
+	}
+}
+
+func TestEstimateSketchCostInfiniteLoop(t *testing.T) {
+	estimate := EstimateSketchCost("function draw() { while (true) { x++; } }", CurrentSketchBudget())
+	if !estimate.InfiniteLoop || estimate.WithinBudget() {
+		t.Errorf("estimate = %+v, want infinite loop violation", estimate)
+	}
+}
+
+func TestApplyRenderMetrics(t *testing.T) {
+	estimate := SketchCostEstimate{Violations: []string{}}
+	estimate.ApplyRenderMetrics(RenderResult{AvgFrameMs: 50, HeapUsedBytes: 10 << 20}, SketchBudget{MaxFrameMs: 33, MaxHeapMB: 256})
+
+	if len(estimate.Violations) != 1 {
+		t.Errorf("Violations = %v, want only the frame time violation", estimate.Violations)
+	}
+}
@@ -0,0 +1,430 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Defaults for the service-level objectives
+const (
+	defaultAvailabilityObjective      = 99.9
+	defaultGenerationSuccessObjective = 95
+	defaultFeedLatencyThreshold       = 500 * time.Millisecond
+	defaultAnimationLatencyThreshold  = 300 * time.Millisecond
+	// latencyObjective is the share of requests that must beat the latency threshold, making the
+	// threshold a p95 target
+	latencyObjective = 95
+	// sloHistory is how far back burn rates can look; it matches the longest alert window
+	sloHistory = 6 * time.Hour
+	// sloAlertMinEvents keeps a handful of failures during a quiet hour from paging anyone
+	sloAlertMinEvents = 10
+	sloAlertInterval  = time.Minute
+	sloWebhookTimeout = 10 * time.Second
+)
+
+// SLO names
+const (
+	SLOAvailability      = "availability"
+	SLOFeedLatency       = "feed_latency"
+	SLOAnimationLatency  = "animation_latency"
+	SLOGenerationSuccess = "generation_success"
+)
+
+// sloWindows are the windows GET /admin/slo reports burn rates over
+var sloWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// sloAlertRule fires when the error budget burns at least BurnRate times faster than sustainable
+// over both windows: the long one shows the burn is significant, the short one that it is still
+// happening. The rates are those recommended for a 30-day budget.
+type sloAlertRule struct {
+	Severity    string
+	LongWindow  time.Duration
+	ShortWindow time.Duration
+	BurnRate    float64
+}
+
+var sloAlertRules = []sloAlertRule{
+	{Severity: "page", LongWindow: time.Hour, ShortWindow: 5 * time.Minute, BurnRate: 14.4},
+	{Severity: "ticket", LongWindow: 6 * time.Hour, ShortWindow: 30 * time.Minute, BurnRate: 6},
+}
+
+// SLO is a service-level objective over requests matched by the router
+type SLO struct {
+	Name        string
+	Description string
+	// Objective is the fraction of counted requests that must be good
+	Objective float64
+	// LatencyThreshold is how fast a request must be to be good, for latency objectives
+	LatencyThreshold time.Duration
+	// classify reports whether a request counts towards the objective and whether it was good
+	classify func(route, method string, status int, duration time.Duration) (counted, good bool)
+}
+
+// envPercent reads a percentage between 0 and 100 exclusive from key
+func envPercent(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	percent, err := strconv.ParseFloat(raw, 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		log.Printf("Warning: Ignoring invalid %s value %q", key, raw)
+		return fallback
+	}
+	return percent
+}
+
+// envMilliseconds reads a positive duration in milliseconds from key
+func envMilliseconds(key string, fallback time.Duration) time.Duration {
+	if ms := envLimit(key, 0); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return fallback
+}
+
+// latencyClassifier counts successful requests to route and calls the ones under threshold good.
+// Failed requests already count against availability.
+func latencyClassifier(route, method string, threshold time.Duration) func(string, string, int, time.Duration) (bool, bool) {
+	return func(gotRoute, gotMethod string, status int, duration time.Duration) (bool, bool) {
+		if gotRoute != route || gotMethod != method || status >= http.StatusInternalServerError {
+			return false, false
+		}
+		return true, duration <= threshold
+	}
+}
+
+// SLOs returns the service-level objectives, configured by SLO_AVAILABILITY_PERCENT,
+// SLO_FEED_LATENCY_MS, SLO_ANIMATION_LATENCY_MS and SLO_GENERATION_SUCCESS_PERCENT
+func SLOs() []SLO {
+	feedThreshold := envMilliseconds("SLO_FEED_LATENCY_MS", defaultFeedLatencyThreshold)
+	animationThreshold := envMilliseconds("SLO_ANIMATION_LATENCY_MS", defaultAnimationLatencyThreshold)
+	return []SLO{
+		{
+			Name:        SLOAvailability,
+			Description: "Requests that do not fail with a server error",
+			Objective:   envPercent("SLO_AVAILABILITY_PERCENT", defaultAvailabilityObjective) / 100,
+			classify: func(route, method string, status int, duration time.Duration) (bool, bool) {
+				return true, status < http.StatusInternalServerError
+			},
+		},
+		{
+			Name:             SLOFeedLatency,
+			Description:      "GET /feed requests answered within the latency threshold",
+			Objective:        latencyObjective / 100.0,
+			LatencyThreshold: feedThreshold,
+			classify:         latencyClassifier("/feed", http.MethodGet, feedThreshold),
+		},
+		{
+			Name:             SLOAnimationLatency,
+			Description:      "GET /animation/{id} requests answered within the latency threshold",
+			Objective:        latencyObjective / 100.0,
+			LatencyThreshold: animationThreshold,
+			classify:         latencyClassifier("/animation/{id}", http.MethodGet, animationThreshold),
+		},
+		{
+			Name:        SLOGenerationSuccess,
+			Description: "Generation requests that produce an animation; rejected requests are not counted",
+			Objective:   envPercent("SLO_GENERATION_SUCCESS_PERCENT", defaultGenerationSuccessObjective) / 100,
+			classify: func(route, method string, status int, duration time.Duration) (bool, bool) {
+				if route != "/generate-animation" || method != http.MethodPost {
+					return false, false
+				}
+				// Invalid requests and exhausted quotas are the client's doing
+				if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+					return false, false
+				}
+				return true, status < http.StatusBadRequest
+			},
+		},
+	}
+}
+
+// sloBucket counts the events of one minute
+type sloBucket struct {
+	minute int64
+	good   int64
+	total  int64
+}
+
+// sloTracker counts an objective's events per minute over sloHistory, plus totals since startup
+type sloTracker struct {
+	mu         sync.Mutex
+	buckets    [int(sloHistory / time.Minute)]sloBucket
+	goodTotal  int64
+	eventTotal int64
+}
+
+func (t *sloTracker) record(now time.Time, good bool) {
+	minute := now.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := &t.buckets[minute%int64(len(t.buckets))]
+	if bucket.minute != minute {
+		*bucket = sloBucket{minute: minute}
+	}
+	bucket.total++
+	t.eventTotal++
+	if good {
+		bucket.good++
+		t.goodTotal++
+	}
+}
+
+// counts returns the good and total events in the window ending at now
+func (t *sloTracker) counts(now time.Time, window time.Duration) (good, total int64) {
+	minute := now.Unix() / 60
+	oldest := minute - int64(window/time.Minute)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, bucket := range t.buckets {
+		if bucket.minute > oldest && bucket.minute <= minute {
+			good += bucket.good
+			total += bucket.total
+		}
+	}
+	return good, total
+}
+
+// totals returns the good and total events since startup
+func (t *sloTracker) totals() (good, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.goodTotal, t.eventTotal
+}
+
+var (
+	sloTrackersMu sync.Mutex
+	sloTrackers   = map[string]*sloTracker{}
+)
+
+// trackerFor returns the tracker of the objective called name
+func trackerFor(name string) *sloTracker {
+	sloTrackersMu.Lock()
+	defer sloTrackersMu.Unlock()
+	tracker, ok := sloTrackers[name]
+	if !ok {
+		tracker = &sloTracker{}
+		sloTrackers[name] = tracker
+	}
+	return tracker
+}
+
+// burnRate is how many times faster than sustainable the error budget is being spent: 1 spends it
+// exactly over the objective's period
+func burnRate(good, total int64, objective float64) float64 {
+	if total == 0 || objective >= 1 {
+		return 0
+	}
+	return (float64(total-good) / float64(total)) / (1 - objective)
+}
+
+// SLOMiddleware records every routed request against the objectives it counts towards. It must be
+// registered on the router so the matched route is known.
+func SLOMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		wrw := newResponseWriter(w)
+		next.ServeHTTP(wrw, r)
+		duration := time.Since(start)
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				// Objectives cover every API version of their routes
+				route = unversionedRoute(template)
+			}
+		}
+		now := time.Now()
+		for _, slo := range SLOs() {
+			if counted, good := slo.classify(route, r.Method, wrw.statusCode, duration); counted {
+				trackerFor(slo.Name).record(now, good)
+			}
+		}
+	})
+}
+
+// firingRules returns the severities of the alert rules slo currently breaks
+func firingRules(slo SLO, now time.Time) map[string]float64 {
+	tracker := trackerFor(slo.Name)
+	firing := map[string]float64{}
+	for _, rule := range sloAlertRules {
+		longGood, longTotal := tracker.counts(now, rule.LongWindow)
+		shortGood, shortTotal := tracker.counts(now, rule.ShortWindow)
+		if longTotal < sloAlertMinEvents {
+			continue
+		}
+		longRate := burnRate(longGood, longTotal, slo.Objective)
+		if longRate >= rule.BurnRate && burnRate(shortGood, shortTotal, slo.Objective) >= rule.BurnRate {
+			firing[rule.Severity] = longRate
+		}
+	}
+	return firing
+}
+
+// SLOReportAt reports every objective's burn rates and alerts as of now
+func SLOReportAt(now time.Time) SLOReport {
+	report := SLOReport{GeneratedAt: now.UTC(), SLOs: []SLOStatus{}}
+	for _, slo := range SLOs() {
+		tracker := trackerFor(slo.Name)
+		status := SLOStatus{
+			Name:               slo.Name,
+			Description:        slo.Description,
+			ObjectivePercent:   slo.Objective * 100,
+			LatencyThresholdMs: slo.LatencyThreshold.Milliseconds(),
+			Windows:            []SLOWindow{},
+			Alerts:             []string{},
+		}
+		for _, window := range sloWindows {
+			good, total := tracker.counts(now, window)
+			status.Windows = append(status.Windows, SLOWindow{
+				Window:   window.String(),
+				Good:     good,
+				Total:    total,
+				BurnRate: burnRate(good, total, slo.Objective),
+			})
+		}
+		firing := firingRules(slo, now)
+		for _, rule := range sloAlertRules {
+			if _, ok := firing[rule.Severity]; ok {
+				status.Alerts = append(status.Alerts, rule.Severity)
+			}
+		}
+		report.SLOs = append(report.SLOs, status)
+	}
+	return report
+}
+
+// sloHandler reports the objectives' burn rates as seen by this instance
+func sloHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	LogResponse("/admin/slo", "SLO report retrieved", nil)
+	json.NewEncoder(w).Encode(SLOReportAt(time.Now()))
+}
+
+// writeSLOMetrics reports each objective's event counts, so burn rates can also be computed across
+// instances
+func writeSLOMetrics(w io.Writer) {
+	now := time.Now()
+	for _, slo := range SLOs() {
+		tracker := trackerFor(slo.Name)
+		good, total := tracker.totals()
+		writeMetric(w, "animate_slo_"+slo.Name+"_events_total", "counter", "Total requests counted towards the "+slo.Name+" objective.", float64(total))
+		writeMetric(w, "animate_slo_"+slo.Name+"_good_events_total", "counter", "Total requests that met the "+slo.Name+" objective.", float64(good))
+		good, total = tracker.counts(now, time.Hour)
+		writeMetric(w, "animate_slo_"+slo.Name+"_burn_rate_1h", "gauge", "Error budget burn rate of the "+slo.Name+" objective over the last hour.", burnRate(good, total, slo.Objective))
+	}
+}
+
+// SLOAlertWebhooks returns the URLs alerts are posted to, configured by SLO_ALERT_WEBHOOK_URLS
+func SLOAlertWebhooks() []string {
+	var urls []string
+	for _, url := range strings.Split(os.Getenv("SLO_ALERT_WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// postSLOAlert sends alert to every webhook, logging the ones that fail
+func postSLOAlert(ctx context.Context, urls []string, alert SLOAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("[SLO] Failed to marshal alert: %v", err)
+		return
+	}
+	for _, url := range urls {
+		ctx, cancel := context.WithTimeout(ctx, sloWebhookTimeout)
+		err := func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				return fmt.Errorf("webhook returned %d", resp.StatusCode)
+			}
+			return nil
+		}()
+		cancel()
+		if err != nil {
+			log.Printf("[SLO] Failed to deliver %s alert for %s: %v", alert.Severity, alert.SLO, err)
+		}
+	}
+}
+
+// sloAlerter remembers which alerts are firing so webhooks hear about each change once
+type sloAlerter struct {
+	firing map[string]bool
+	notify func(SLOAlert)
+}
+
+// evaluate notifies about every alert that started or stopped firing since the last evaluation
+func (a *sloAlerter) evaluate(now time.Time) {
+	for _, slo := range SLOs() {
+		firing := firingRules(slo, now)
+		for _, rule := range sloAlertRules {
+			key := slo.Name + "/" + rule.Severity
+			rate, isFiring := firing[rule.Severity]
+			if isFiring == a.firing[key] {
+				continue
+			}
+			a.firing[key] = isFiring
+
+			alert := SLOAlert{SLO: slo.Name, Severity: rule.Severity, Status: "resolved", Window: rule.LongWindow.String(),
+				BurnRate: rate, ObjectivePercent: slo.Objective * 100, At: now.UTC()}
+			if isFiring {
+				alert.Status = "firing"
+				alert.Text = fmt.Sprintf("[%s] %s is burning its error budget %.1fx too fast over %s", rule.Severity, slo.Name, rate, alert.Window)
+			} else {
+				alert.Text = fmt.Sprintf("[%s] %s is no longer burning its error budget too fast", rule.Severity, slo.Name)
+			}
+			log.Printf("[SLO] %s", alert.Text)
+			a.notify(alert)
+		}
+	}
+}
+
+// RunSLOAlerter evaluates the alert rules every minute until ctx is done, posting changes to
+// SLO_ALERT_WEBHOOK_URLS. Each instance alerts on the traffic it served.
+func RunSLOAlerter(ctx context.Context) {
+	urls := SLOAlertWebhooks()
+	if len(urls) == 0 {
+		log.Println("[SLO] SLO_ALERT_WEBHOOK_URLS not set, burn rate alerts are only logged")
+	}
+	alerter := &sloAlerter{firing: map[string]bool{}, notify: func(alert SLOAlert) {
+		postSLOAlert(ctx, urls, alert)
+	}}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sloAlertInterval):
+		}
+		alerter.evaluate(time.Now())
+	}
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// resetSLOTrackers forgets every event recorded by earlier tests
+func resetSLOTrackers(t *testing.T) {
+	t.Helper()
+	sloTrackersMu.Lock()
+	sloTrackers = map[string]*sloTracker{}
+	sloTrackersMu.Unlock()
+}
+
+func TestBurnRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		good      int64
+		total     int64
+		objective float64
+		want      float64
+	}{
+		{name: "No traffic", objective: 0.999, want: 0},
+		{name: "No errors", good: 100, total: 100, objective: 0.999, want: 0},
+		{name: "Exactly on budget", good: 999, total: 1000, objective: 0.999, want: 1},
+		{name: "Burning fast", good: 90, total: 100, objective: 0.99, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := burnRate(tt.good, tt.total, tt.objective); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("burnRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSLOMiddleware(t *testing.T) {
+	resetSLOTrackers(t)
+	t.Setenv("SLO_ANIMATION_LATENCY_MS", "1000")
+
+	r := mux.NewRouter()
+	r.Use(SLOMiddleware)
+	r.HandleFunc("/animation/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/generate-animation", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}).Methods(http.MethodPost)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/animation/a", nil),
+		httptest.NewRequest(http.MethodGet, "/animation/b", nil),
+		httptest.NewRequest(http.MethodGet, "/animation/broken", nil),
+		httptest.NewRequest(http.MethodPost, "/generate-animation", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		slo       string
+		wantGood  int64
+		wantTotal int64
+	}{
+		{slo: SLOAvailability, wantGood: 3, wantTotal: 4},
+		{slo: SLOAnimationLatency, wantGood: 2, wantTotal: 2},
+		{slo: SLOFeedLatency},
+		{slo: SLOGenerationSuccess},
+	}
+	for _, tt := range tests {
+		good, total := trackerFor(tt.slo).counts(time.Now(), time.Hour)
+		if good != tt.wantGood || total != tt.wantTotal {
+			t.Errorf("%s counts = %d/%d, want %d/%d", tt.slo, good, total, tt.wantGood, tt.wantTotal)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	sloHandler(w, httptest.NewRequest(http.MethodGet, "/admin/slo", nil))
+	var report SLOReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(report.SLOs) != 4 || report.SLOs[0].Name != SLOAvailability || report.SLOs[0].Windows[0].Total != 4 {
+		t.Errorf("report = %+v, want 4 objectives with availability counting 4 requests", report)
+	}
+}
+
+func TestSLOAlerter(t *testing.T) {
+	resetSLOTrackers(t)
+	now := time.Date(2026, 3, 12, 15, 30, 0, 0, time.UTC)
+	tracker := trackerFor(SLOAvailability)
+	for i := 0; i < 100; i++ {
+		// 5% errors burn a 99.9% budget 50 times too fast
+		tracker.record(now.Add(-time.Duration(i)*time.Second), i%20 != 0)
+	}
+
+	var alerts []SLOAlert
+	alerter := &sloAlerter{firing: map[string]bool{}, notify: func(alert SLOAlert) { alerts = append(alerts, alert) }}
+
+	alerter.evaluate(now)
+	if len(alerts) != 2 || alerts[0].Severity != "page" || alerts[0].Status != "firing" || alerts[1].Severity != "ticket" {
+		t.Fatalf("alerts = %+v, want page and ticket firing", alerts)
+	}
+	if alerts[0].SLO != SLOAvailability || math.Abs(alerts[0].BurnRate-50) > 1e-6 {
+		t.Errorf("alert = %+v, want availability burning 50x", alerts[0])
+	}
+
+	alerts = nil
+	alerter.evaluate(now.Add(time.Minute))
+	if len(alerts) != 0 {
+		t.Errorf("alerts while still firing = %+v, want none", alerts)
+	}
+
+	alerter.evaluate(now.Add(7 * time.Hour))
+	if len(alerts) != 2 || alerts[0].Status != "resolved" || alerts[1].Status != "resolved" {
+		t.Errorf("alerts after recovery = %+v, want both resolved", alerts)
+	}
+}
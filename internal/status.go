@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Component statuses, from best to worst
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "outage"
+)
+
+// Components reported by GET /status
+const (
+	ComponentDatabase   = "database"
+	ComponentGeneration = "generation"
+	ComponentWorkers    = "workers"
+)
+
+// Incident statuses; every status but resolved leaves the incident open
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+// Incident severities: an open minor incident shows its component as degraded, a major one as an outage
+const (
+	IncidentMinor = "minor"
+	IncidentMajor = "major"
+)
+
+const (
+	// providerStatusWindow is how far back calls to the generation provider are judged
+	providerStatusWindow = 5 * time.Minute
+	// providerStatusMinCalls keeps one or two failed calls from reporting an outage
+	providerStatusMinCalls    = 3
+	providerDegradedErrorRate = 0.2
+	providerOutageErrorRate   = 0.5
+	// workerStaleIntervals is how many of its intervals a worker may go without finishing a pass
+	workerStaleIntervals = 3
+	// incidentHistory is how long resolved incidents stay on GET /status
+	incidentHistory          = 7 * 24 * time.Hour
+	maxIncidentTitleLength   = 200
+	maxIncidentMessageLength = 2000
+)
+
+var (
+	statusComponents   = []string{ComponentDatabase, ComponentGeneration, ComponentWorkers}
+	statusRank         = map[string]int{StatusOperational: 0, StatusDegraded: 1, StatusOutage: 2}
+	incidentStatuses   = []string{IncidentInvestigating, IncidentIdentified, IncidentMonitoring, IncidentResolved}
+	incidentSeverities = []string{IncidentMinor, IncidentMajor}
+)
+
+// providerCalls counts the calls to the generation provider that got an answer
+var providerCalls = &sloTracker{}
+
+// recordProviderCall counts a call to the generation provider towards the generation status. Calls
+// the client gave up on are not the provider's doing and should not be recorded.
+func recordProviderCall(ok bool) {
+	providerCalls.record(time.Now(), ok)
+}
+
+// workerPass is the last pass a background worker finished
+type workerPass struct {
+	at       time.Time
+	interval time.Duration
+	err      error
+}
+
+var (
+	workerPassesMu sync.Mutex
+	workerPasses   = map[string]workerPass{}
+)
+
+// recordWorkerPass notes that the named background worker finished a pass, failed when err is set,
+// and is expected to finish another within interval
+func recordWorkerPass(name string, interval time.Duration, err error) {
+	workerPassesMu.Lock()
+	defer workerPassesMu.Unlock()
+	workerPasses[name] = workerPass{at: time.Now(), interval: interval, err: err}
+}
+
+// ValidateIncident checks an admin's incident report and returns the incident it opens
+func ValidateIncident(req CreateIncidentRequest) (Incident, error) {
+	incident := Incident{
+		Title:     strings.TrimSpace(req.Title),
+		Component: req.Component,
+		Severity:  req.Severity,
+		Status:    req.Status,
+	}
+	if incident.Title == "" || len(incident.Title) > maxIncidentTitleLength {
+		return Incident{}, fmt.Errorf("title must be 1-%d characters", maxIncidentTitleLength)
+	}
+	if !slices.Contains(statusComponents, incident.Component) {
+		return Incident{}, fmt.Errorf("component must be one of %s", strings.Join(statusComponents, ", "))
+	}
+	if !slices.Contains(incidentSeverities, incident.Severity) {
+		return Incident{}, fmt.Errorf("severity must be %s or %s", IncidentMinor, IncidentMajor)
+	}
+	if incident.Status == "" {
+		incident.Status = IncidentInvestigating
+	}
+	if incident.Status == IncidentResolved {
+		return Incident{}, errors.New("a new incident cannot already be resolved")
+	}
+	return incident, ValidateIncidentUpdate(IncidentUpdateRequest{Status: incident.Status, Message: req.Message})
+}
+
+// ValidateIncidentUpdate checks an update's status and message
+func ValidateIncidentUpdate(req IncidentUpdateRequest) error {
+	if !slices.Contains(incidentStatuses, req.Status) {
+		return fmt.Errorf("status must be one of %s", strings.Join(incidentStatuses, ", "))
+	}
+	if message := strings.TrimSpace(req.Message); message == "" || len(message) > maxIncidentMessageLength {
+		return fmt.Errorf("message must be 1-%d characters", maxIncidentMessageLength)
+	}
+	return nil
+}
+
+// providerStatus judges the generation provider by the share of recent calls that failed
+func providerStatus(now time.Time) ComponentStatus {
+	status := ComponentStatus{Name: ComponentGeneration, Status: StatusOperational}
+	good, total := providerCalls.counts(now, providerStatusWindow)
+	if total < providerStatusMinCalls {
+		return status
+	}
+	errorRate := float64(total-good) / float64(total)
+	switch {
+	case errorRate >= providerOutageErrorRate:
+		status.Status = StatusOutage
+		status.Detail = "Animation generation is unavailable"
+	case errorRate >= providerDegradedErrorRate:
+		status.Status = StatusDegraded
+		status.Detail = "Some animation generations are failing"
+	}
+	return status
+}
+
+// workersStatus reports the background workers of this instance as degraded when one failed its
+// last pass or has stopped finishing them
+func workersStatus(now time.Time) ComponentStatus {
+	status := ComponentStatus{Name: ComponentWorkers, Status: StatusOperational}
+	workerPassesMu.Lock()
+	defer workerPassesMu.Unlock()
+
+	var failing []string
+	for name, pass := range workerPasses {
+		if pass.err != nil || now.Sub(pass.at) > workerStaleIntervals*pass.interval {
+			failing = append(failing, name)
+		}
+	}
+	if len(failing) > 0 {
+		slices.Sort(failing)
+		status.Status = StatusDegraded
+		status.Detail = "Delayed: " + strings.Join(failing, ", ")
+	}
+	return status
+}
+
+// worseStatus returns the worse of two component statuses
+func worseStatus(a, b string) string {
+	if statusRank[b] > statusRank[a] {
+		return b
+	}
+	return a
+}
+
+// BuildStatus checks every component, reports which optional features are on and lists the open
+// and recently resolved incidents. An open incident makes its component at least as bad as its
+// severity.
+func BuildStatus(ctx context.Context, store StatusStore, now time.Time) StatusResponse {
+	response := StatusResponse{Status: StatusOperational, Incidents: []Incident{}, GeneratedAt: now.UTC()}
+
+	database := ComponentStatus{Name: ComponentDatabase, Status: StatusOperational}
+	err := store.Ping(ctx)
+	recordDatabaseCheck(err)
+	if err != nil {
+		log.Printf("[STATUS] Database ping failed: %v", err)
+		database.Status = StatusOutage
+		database.Detail = "The database is unreachable"
+	} else if incidents, err := store.ListIncidents(ctx, now.Add(-incidentHistory)); err != nil {
+		log.Printf("[STATUS] Failed to list incidents: %v", err)
+	} else {
+		response.Incidents = incidents
+	}
+	response.Components = []ComponentStatus{database, providerStatus(now), workersStatus(now)}
+
+	for _, incident := range response.Incidents {
+		if incident.ResolvedAt != nil {
+			continue
+		}
+		impact := StatusDegraded
+		if incident.Severity == IncidentMajor {
+			impact = StatusOutage
+		}
+		for i := range response.Components {
+			component := &response.Components[i]
+			if component.Name == incident.Component && statusRank[impact] > statusRank[component.Status] {
+				component.Status = impact
+				component.Detail = incident.Title
+			}
+		}
+	}
+	for _, component := range response.Components {
+		response.Status = worseStatus(response.Status, component.Status)
+	}
+	response.Features = features.evaluate(now)
+	return response
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateIncident(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        CreateIncidentRequest
+		wantStatus string
+		wantErr    bool
+	}{
+		{name: "Investigating by default", req: CreateIncidentRequest{Title: "Generation failing", Component: ComponentGeneration, Severity: IncidentMajor, Message: "Claude is returning errors"},
+			wantStatus: IncidentInvestigating},
+		{name: "Identified", req: CreateIncidentRequest{Title: "Slow reminders", Component: ComponentWorkers, Severity: IncidentMinor, Status: IncidentIdentified, Message: "Mail provider is slow"},
+			wantStatus: IncidentIdentified},
+		{name: "Unknown component", req: CreateIncidentRequest{Title: "Down", Component: "cdn", Severity: IncidentMajor, Message: "Down"}, wantErr: true},
+		{name: "Unknown severity", req: CreateIncidentRequest{Title: "Down", Component: ComponentDatabase, Severity: "critical", Message: "Down"}, wantErr: true},
+		{name: "Already resolved", req: CreateIncidentRequest{Title: "Down", Component: ComponentDatabase, Severity: IncidentMajor, Status: IncidentResolved, Message: "Down"}, wantErr: true},
+		{name: "Missing message", req: CreateIncidentRequest{Title: "Down", Component: ComponentDatabase, Severity: IncidentMajor}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			incident, err := ValidateIncident(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateIncident() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && incident.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", incident.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProviderStatus(t *testing.T) {
+	saved := providerCalls
+	t.Cleanup(func() { providerCalls = saved })
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		good   int
+		failed int
+		want   string
+	}{
+		{name: "No calls", want: StatusOperational},
+		{name: "Too few to judge", failed: providerStatusMinCalls - 1, want: StatusOperational},
+		{name: "Healthy", good: 9, failed: 1, want: StatusOperational},
+		{name: "Some failing", good: 7, failed: 3, want: StatusDegraded},
+		{name: "Down", good: 2, failed: 8, want: StatusOutage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providerCalls = &sloTracker{}
+			for i := 0; i < tt.good; i++ {
+				providerCalls.record(now, true)
+			}
+			for i := 0; i < tt.failed; i++ {
+				providerCalls.record(now, false)
+			}
+			if got := providerStatus(now); got.Status != tt.want {
+				t.Errorf("providerStatus() = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkersStatus(t *testing.T) {
+	workerPassesMu.Lock()
+	saved := workerPasses
+	workerPasses = map[string]workerPass{}
+	workerPassesMu.Unlock()
+	t.Cleanup(func() {
+		workerPassesMu.Lock()
+		workerPasses = saved
+		workerPassesMu.Unlock()
+	})
+
+	recordWorkerPass("notifications", time.Minute, nil)
+	if got := workersStatus(time.Now()); got.Status != StatusOperational {
+		t.Errorf("workersStatus() = %+v, want operational", got)
+	}
+	recordWorkerPass("mood reminders", time.Minute, errors.New("database error"))
+	if got := workersStatus(time.Now()); got.Status != StatusDegraded || got.Detail != "Delayed: mood reminders" {
+		t.Errorf("workersStatus() = %+v, want mood reminders delayed", got)
+	}
+	recordWorkerPass("mood reminders", time.Minute, nil)
+	if got := workersStatus(time.Now().Add(workerStaleIntervals*time.Minute + time.Second)); got.Detail != "Delayed: mood reminders, notifications" {
+		t.Errorf("workersStatus() = %+v, want both stalled workers", got)
+	}
+}
+
+// unreachableStore is a store whose database cannot be reached
+type unreachableStore struct {
+	*MemoryStore
+}
+
+func (unreachableStore) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestBuildStatusWithoutDatabase(t *testing.T) {
+	resetFeatures(t)
+
+	status := BuildStatus(context.Background(), unreachableStore{NewMemoryStore()}, time.Now())
+	if status.Status != StatusOutage || status.Components[0].Name != ComponentDatabase || status.Components[0].Status != StatusOutage {
+		t.Errorf("status = %+v, want a database outage", status)
+	}
+	for _, feature := range status.Features {
+		if wantEnabled := feature.Name == FeatureSmokeTests; feature.Enabled != wantEnabled {
+			t.Errorf("feature %s enabled = %v, want %v during a database outage", feature.Name, feature.Enabled, wantEnabled)
+		}
+	}
+	if FeatureEnabled(FeatureThumbnails) {
+		t.Error("thumbnails enabled during a database outage, want them switched off")
+	}
+}
+
+func TestStatusHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+
+	router := NewServer(NewMemoryStore()).Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+
+	var status StatusResponse
+	if code := doJSON(t, router, http.MethodGet, "/status", "", nil, &status); code != http.StatusOK {
+		t.Fatalf("status code = %d", code)
+	}
+	if status.Status != StatusOperational || len(status.Components) != 3 || len(status.Incidents) != 0 {
+		t.Errorf("status = %+v, want every component operational", status)
+	}
+
+	report := CreateIncidentRequest{Title: "Generation failing", Component: ComponentGeneration, Severity: IncidentMajor, Message: "Claude is returning errors"}
+	var incident Incident
+	if code := doJSON(t, router, http.MethodPost, "/admin/incidents", admin.Token, report, &incident); code != http.StatusCreated {
+		t.Fatalf("create incident status = %d", code)
+	}
+	doJSON(t, router, http.MethodGet, "/status", "", nil, &status)
+	if status.Status != StatusOutage || status.Components[1].Status != StatusOutage || status.Components[1].Detail != report.Title {
+		t.Errorf("status = %+v, want a generation outage", status)
+	}
+
+	updates := "/admin/incidents/" + strconv.Itoa(incident.ID) + "/updates"
+	resolve := IncidentUpdateRequest{Status: IncidentResolved, Message: "Generation is back"}
+	if code := doJSON(t, router, http.MethodPost, updates, admin.Token, resolve, &incident); code != http.StatusOK {
+		t.Fatalf("resolve status = %d", code)
+	}
+	if incident.ResolvedAt == nil || len(incident.Updates) != 2 || incident.Updates[0].Message != resolve.Message {
+		t.Errorf("incident = %+v, want it resolved with the newest update first", incident)
+	}
+	doJSON(t, router, http.MethodGet, "/status", "", nil, &status)
+	if status.Status != StatusOperational || len(status.Incidents) != 1 {
+		t.Errorf("status = %+v, want operational with the resolved incident listed", status)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		body     interface{}
+		wantCode int
+	}{
+		{name: "Already resolved", path: updates, token: admin.Token, body: resolve, wantCode: http.StatusConflict},
+		{name: "Unknown incident", path: "/admin/incidents/999/updates", token: admin.Token, body: resolve, wantCode: http.StatusNotFound},
+		{name: "Unknown status", path: updates, token: admin.Token, body: IncidentUpdateRequest{Status: "fixed", Message: "Fixed"}, wantCode: http.StatusBadRequest},
+		{name: "Not an admin", path: "/admin/incidents", token: registerUser(t, router, "viewer"), body: report, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, http.MethodPost, tt.path, tt.token, tt.body, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
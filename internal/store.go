@@ -0,0 +1,641 @@
+package internal
+
+import (
+	"context"
+	"time"
+)
+
+// UserStore persists user accounts and their profile change history
+type UserStore interface {
+	UserExists(ctx context.Context, email string) bool
+	EmailInUseByOtherUser(ctx context.Context, email, userId string) bool
+	// CreateUserWithUsername creates an account belonging to the tenant ctx acts for
+	CreateUserWithUsername(ctx context.Context, email, username, passwordHash string) (string, error)
+	GetUserCredentials(ctx context.Context, email string) (string, string, error)
+	GetUserIDByEmail(ctx context.Context, email string) (string, error)
+	GetUserDetails(ctx context.Context, userId string) (User, error)
+	UpdateUserProfile(ctx context.Context, userId, email, username string) (User, error)
+	// SetUserTenant records the tenant of an account from before tenants were recorded
+	SetUserTenant(ctx context.Context, userId, tenant string) error
+	RecordProfileChange(ctx context.Context, userId, field, oldValue, newValue, revertTokenHash string, revertExpiresAt time.Time) error
+	// RevertEmailChange restores the email an unexpired revert link was sent to and signs the user
+	// out everywhere, since whoever changed the email may hold a session
+	RevertEmailChange(ctx context.Context, revertTokenHash string) (User, error)
+	// SessionsRevokedAt returns when the user was last signed out everywhere, or the zero time
+	SessionsRevokedAt(ctx context.Context, userId string) (time.Time, error)
+	// GetContentPreferences returns a user's content preferences, all off when they have not set any
+	GetContentPreferences(ctx context.Context, userId string) (ContentPreferences, error)
+	SaveContentPreferences(ctx context.Context, userId string, preferences ContentPreferences) error
+}
+
+// AnimationStore persists animations and their render status
+type AnimationStore interface {
+	// SaveAnimation saves an animation. When the user is a member, not the owner, of a workspace that
+	// requires review, it is held out of the feed with a pending review.
+	SaveAnimation(ctx context.Context, code string, description string, userId string, p5Version string) (string, error)
+	GetAnimation(ctx context.Context, id string) (GetAnimationResponse, error)
+	UpdateAnimation(ctx context.Context, id, userId string, update UpdateAnimationRequest) error
+	// DeleteAnimation deletes an animation and the moods recorded against it. Only its owner may
+	// delete it, unless asAdmin is set.
+	DeleteAnimation(ctx context.Context, id, userId string, asAdmin bool) error
+	GetAnimationChangelog(ctx context.Context, id string) ([]ChangelogEntry, error)
+	// ListAnimationVersions returns the versions of one of userId's animations, newest first
+	ListAnimationVersions(ctx context.Context, id, userId string) ([]AnimationVersion, error)
+	// GetAnimationVersion returns one version of one of userId's animations, with its code
+	GetAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error)
+	// RestoreAnimationVersion makes the code of an earlier version current again, as a new version,
+	// and returns the new version with its code
+	RestoreAnimationVersion(ctx context.Context, id string, version int, userId string) (AnimationVersion, error)
+	AnimationExists(ctx context.Context, id string) bool
+	GetRandomAnimation(ctx context.Context, filter FeedFilter) (GetAnimationResponse, error)
+	ListFeedAnimationIDs(ctx context.Context, filter FeedFilter, limit int) ([]string, error)
+	// SaveP5Compatibility replaces the stored compatibility matrix of an animation
+	SaveP5Compatibility(ctx context.Context, id string, matrix []P5Compatibility) error
+	// GetP5Compatibility returns the stored compatibility matrix of an animation, empty when it has not been checked
+	GetP5Compatibility(ctx context.Context, id string) ([]P5Compatibility, error)
+	// ListUserAnimations returns a page of the animations a user saved, newest first, including removed ones, and how many there are in total
+	ListUserAnimations(ctx context.Context, userId string, limit, offset int) ([]UserAnimation, int, error)
+	// GetPreviewFrames returns the frames rendered for code with the given hash, or none if a set of count frames has not been rendered
+	GetPreviewFrames(ctx context.Context, codeHash string, count int) ([]PreviewFrame, error)
+	SavePreviewFrames(ctx context.Context, codeHash string, frames []PreviewFrame) error
+	// ListFeedAnimations returns a page of the animations the feed may show, newest first, and how many there are in total
+	ListFeedAnimations(ctx context.Context, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error)
+	// SearchAnimations returns a page of the animations the feed may show whose description matches
+	// query, best match first, and how many match in total
+	SearchAnimations(ctx context.Context, query string, filter FeedFilter, limit, offset int) ([]GetAnimationResponse, int, error)
+	// SaveAnimationEmbedding replaces the stored embedding of an animation's description
+	SaveAnimationEmbedding(ctx context.Context, id, model string, vector []float32) error
+	// ListAnimationEmbeddings returns the embeddings from model of the animations the feed may show
+	ListAnimationEmbeddings(ctx context.Context, model string, filter FeedFilter) ([]AnimationEmbedding, error)
+	// ListAnimationsWithoutEmbedding returns up to limit animations with a description but no embedding from model
+	ListAnimationsWithoutEmbedding(ctx context.Context, model string, limit int) ([]DescribedAnimation, error)
+	SetAnimationRenderStatus(ctx context.Context, id string, status string) error
+	SetAnimationPhotosensitivity(ctx context.Context, id string, report PhotosensitivityReport) error
+	GetAnimationIDsByRenderStatus(ctx context.Context, status string, limit int) ([]string, error)
+}
+
+// MoodStore persists how users felt after viewing an animation
+type MoodStore interface {
+	SaveMood(ctx context.Context, userId string, animationId string, mood string) error
+	// ListMoods returns a page of a user's moods saved from from until before to, newest first, and
+	// how many there are in total. A zero from or to leaves that end of the range open.
+	ListMoods(ctx context.Context, userId string, from, to time.Time, limit, offset int) ([]MoodEntry, int, error)
+	// GetMoodCounts returns how often each mood was recorded for each of the given animations;
+	// animations without moods are left out
+	GetMoodCounts(ctx context.Context, animationIds []string) (map[string]map[Mood]int, error)
+}
+
+// CommentStore persists the comments viewers leave on animations
+type CommentStore interface {
+	// CreateComment adds a comment to an animation that has not been removed
+	CreateComment(ctx context.Context, animationId, userId, body string) (Comment, error)
+	// ListComments returns a page of an animation's comments, oldest first, and how many there are in total
+	ListComments(ctx context.Context, animationId string, limit, offset int) ([]Comment, int, error)
+	// DeleteComment deletes a comment on an animation. Only its author or the animation's owner may
+	// delete it, unless asAdmin is set.
+	DeleteComment(ctx context.Context, animationId string, commentId int, userId string, asAdmin bool) error
+}
+
+// NotificationStore persists notification preferences and the notifications waiting for delivery
+type NotificationStore interface {
+	// GetNotificationPreferences returns the preferences a user saved, with no events or quiet hours
+	// when they have not set any; see EffectiveNotificationEvents for the defaults
+	GetNotificationPreferences(ctx context.Context, userId string) (NotificationPreferences, error)
+	SaveNotificationPreferences(ctx context.Context, userId string, preferences NotificationPreferences) error
+	QueueNotification(ctx context.Context, notification Notification) error
+	// ClaimDueNotifications returns up to limit notifications due for delivery and holds them for a
+	// few minutes, so other dispatchers skip them while they are delivered
+	ClaimDueNotifications(ctx context.Context, limit int) ([]Notification, error)
+	// CompleteNotification removes a delivered, or abandoned, notification from the queue
+	CompleteNotification(ctx context.Context, id int64) error
+	// FailNotification schedules a retry, doubling the delay with each attempt
+	FailNotification(ctx context.Context, id int64, cause error) error
+}
+
+// ReminderStore persists mood check-in reminder schedules and the reminders sent
+type ReminderStore interface {
+	// GetReminderSchedule returns a user's reminder schedule, with no times when they have none
+	GetReminderSchedule(ctx context.Context, userId string) (ReminderSchedule, error)
+	// SaveReminderSchedule replaces a user's schedule and when their next reminder is due; a zero
+	// nextAt stops their reminders
+	SaveReminderSchedule(ctx context.Context, userId string, schedule ReminderSchedule, nextAt time.Time) error
+	// ClaimDueReminders returns up to limit users whose next reminder is due and holds them for a
+	// few minutes, so other schedulers skip them while they are reminded
+	ClaimDueReminders(ctx context.Context, limit int) ([]DueReminder, error)
+	SetNextReminder(ctx context.Context, userId string, nextAt time.Time) error
+	RecordReminderSent(ctx context.Context, userId, animationId string) error
+	// RecordReminderCheckIn marks the reminders sent to a user within the last window as answered
+	RecordReminderCheckIn(ctx context.Context, userId string, window time.Duration) error
+	// ListReminderDeliveries returns the reminders sent to a user within the last window, newest first
+	ListReminderDeliveries(ctx context.Context, userId string, window time.Duration) ([]ReminderDelivery, error)
+}
+
+// DatasetStore persists the anonymized research dataset
+type DatasetStore interface {
+	// ListDatasetAnimations returns every animation that has not been removed with how often each
+	// mood was recorded for it. The result is not anonymized yet; see AnonymizeDataset.
+	ListDatasetAnimations(ctx context.Context) ([]DatasetAnimation, error)
+	SaveDataset(ctx context.Context, dataset Dataset) error
+	// GetLatestDataset returns the most recently published dataset
+	GetLatestDataset(ctx context.Context) (Dataset, error)
+}
+
+// P5LibraryStore persists the p5.js builds animations can be pinned to
+type P5LibraryStore interface {
+	SaveP5Library(ctx context.Context, library P5Library) error
+	GetP5Library(ctx context.Context, version string) (P5Library, error)
+	ListP5Libraries(ctx context.Context) ([]P5Library, error)
+}
+
+// ProfessionalStore persists professional accounts, their links to clients, recommended sessions
+// and the audit trail of every action on a link
+type ProfessionalStore interface {
+	GetAccountType(ctx context.Context, userId string) (string, error)
+	SetAccountType(ctx context.Context, userId, accountType string) error
+	CreateClientInvite(ctx context.Context, professionalId, email, tokenHash string, expiresAt time.Time) (ClientLink, error)
+	// AcceptClientInvite links the client to the professional who invited them. The invitation must
+	// be unexpired and sent to the client's email address.
+	AcceptClientInvite(ctx context.Context, tokenHash, clientId string, shareMoodTrends bool) (ClientLink, error)
+	GetClientLink(ctx context.Context, id int) (ClientLink, error)
+	ListProfessionalClients(ctx context.Context, professionalId string) ([]ClientLink, error)
+	ListClientProfessionals(ctx context.Context, clientId string) ([]ClientLink, error)
+	SetMoodTrendConsent(ctx context.Context, linkId int, share bool) error
+	EndClientLink(ctx context.Context, linkId int) error
+	AssignSession(ctx context.Context, linkId int, animationId, note string) (SessionAssignment, error)
+	ListLinkSessions(ctx context.Context, linkId int) ([]SessionAssignment, error)
+	// ListClientSessions returns the sessions assigned to a client over their active links, newest first
+	ListClientSessions(ctx context.Context, clientId string) ([]SessionAssignment, error)
+	// GetMoodTrends returns a user's mood counts per week since the given time, oldest week first
+	GetMoodTrends(ctx context.Context, userId string, since time.Time) ([]MoodTrend, error)
+	RecordProfessionalAudit(ctx context.Context, linkId int, actorId, action string) error
+	ListProfessionalAudit(ctx context.Context, linkId int) ([]ProfessionalAuditEntry, error)
+}
+
+// AnnouncementStore persists the announcements admins publish and the ones each user dismissed
+type AnnouncementStore interface {
+	CreateAnnouncement(ctx context.Context, announcement Announcement) (Announcement, error)
+	// UpdateAnnouncement replaces the content, audience and schedule of an announcement
+	UpdateAnnouncement(ctx context.Context, announcement Announcement) (Announcement, error)
+	DeleteAnnouncement(ctx context.Context, id int) error
+	// ListAnnouncements returns every announcement, newest first, with how many users dismissed it
+	ListAnnouncements(ctx context.Context) ([]Announcement, error)
+	// ListActiveAnnouncements returns the announcements shown now, newest first, leaving out the
+	// ones userId dismissed. Audiences are left to the caller.
+	ListActiveAnnouncements(ctx context.Context, userId string) ([]Announcement, error)
+	DismissAnnouncement(ctx context.Context, id int, userId string) error
+}
+
+// MoodRuleStore persists the follow-ups admins configure for moods
+type MoodRuleStore interface {
+	CreateMoodRule(ctx context.Context, rule MoodRule) (MoodRule, error)
+	// UpdateMoodRule replaces the trigger and actions of a mood rule
+	UpdateMoodRule(ctx context.Context, rule MoodRule) (MoodRule, error)
+	DeleteMoodRule(ctx context.Context, id int) error
+	// ListMoodRules returns every mood rule in the order they were created, which is the order they
+	// are evaluated in
+	ListMoodRules(ctx context.Context) ([]MoodRule, error)
+}
+
+// PlaybackStore persists the playback sessions that led to a view, and the views reported in them.
+// Sessions are issued without being stored.
+type PlaybackStore interface {
+	// RecordPlaybackView records a view in a session, storing the session with its first view and
+	// reporting whether it was the first. Later views only raise the watched time and replace the
+	// frame rate.
+	RecordPlaybackView(ctx context.Context, session PlaybackSession, view PlaybackView) (bool, error)
+	// GetPlaybackStats counts the viewed sessions of an animation issued between from and to
+	GetPlaybackStats(ctx context.Context, animationId string, from, to time.Time) (PlaybackStats, error)
+	// DeletePlaybackSessions deletes the sessions issued before before, returning how many
+	DeletePlaybackSessions(ctx context.Context, before time.Time) (int, error)
+}
+
+// SubscriptionStore persists the tags and creators users follow
+type SubscriptionStore interface {
+	// CreateSubscription subscribes a user to a tag or creator. When they already follow it, the
+	// existing subscription is returned with false.
+	CreateSubscription(ctx context.Context, subscription Subscription) (Subscription, bool, error)
+	// ListSubscriptions returns a user's subscriptions, oldest first, with the usernames of the creators they follow
+	ListSubscriptions(ctx context.Context, userId string) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, id int, userId string) error
+	// ListSubscribers returns the IDs of the users following creatorId or any of tags, each once
+	ListSubscribers(ctx context.Context, creatorId string, tags []string) ([]string, error)
+}
+
+// StatusStore reports whether the store can be reached and persists the incidents shown on GET /status
+type StatusStore interface {
+	Ping(ctx context.Context) error
+	// CreateIncident records an incident with its first update and returns it
+	CreateIncident(ctx context.Context, incident Incident, message string) (Incident, error)
+	// AddIncidentUpdate adds an update to an open incident and moves it to the update's status,
+	// resolving it when that is resolved
+	AddIncidentUpdate(ctx context.Context, id int, status, message string) (Incident, error)
+	// ListIncidents returns the open incidents and those resolved after resolvedSince, latest
+	// started first, with their updates
+	ListIncidents(ctx context.Context, resolvedSince time.Time) ([]Incident, error)
+}
+
+// ProviderKeyStore persists the sealed API keys users generate animations with, and how often they
+// used them
+type ProviderKeyStore interface {
+	// SetProviderKey stores a user's sealed key, replacing any they stored before
+	SetProviderKey(ctx context.Context, userId string, key ProviderKey) (ProviderKey, error)
+	// GetProviderKey returns a user's sealed key with their generations today and this month
+	GetProviderKey(ctx context.Context, userId string) (ProviderKey, error)
+	DeleteProviderKey(ctx context.Context, userId string) error
+	// RecordProviderKeyGeneration counts a generation made with a user's own key
+	RecordProviderKeyGeneration(ctx context.Context, userId, provider string) error
+}
+
+// CollectionStore persists the galleries of animations users curate
+type CollectionStore interface {
+	// CreateCollection saves a collection with its animations in the order given
+	CreateCollection(ctx context.Context, collection Collection) (Collection, error)
+	// UpdateCollection replaces the title, description, sharing and animations of one of the
+	// collection owner's collections. Animations it keeps keep when they were added.
+	UpdateCollection(ctx context.Context, collection Collection) (Collection, error)
+	// DeleteCollection deletes one of the user's collections, or anyone's when asAdmin is set
+	DeleteCollection(ctx context.Context, id int, userId string, asAdmin bool) error
+	// GetCollection returns a collection that belongs to the user or is public
+	GetCollection(ctx context.Context, id int, userId string) (Collection, error)
+	// ListCollections returns a page of the user's collections, newest first, and how many they have
+	ListCollections(ctx context.Context, userId string, limit, offset int) ([]Collection, int, error)
+	// ListCollectionAnimations returns a page of a collection's animations that were not removed,
+	// in the order they were curated in, and how many there are
+	ListCollectionAnimations(ctx context.Context, id, limit, offset int) ([]CollectionAnimation, int, error)
+}
+
+// PromptPresetStore persists the prompt presets users save and share
+type PromptPresetStore interface {
+	CreatePromptPreset(ctx context.Context, preset PromptPreset) (PromptPreset, error)
+	// UpdatePromptPreset replaces the name, template and sharing of one of the preset owner's presets
+	UpdatePromptPreset(ctx context.Context, preset PromptPreset) (PromptPreset, error)
+	// DeletePromptPreset deletes one of the user's presets, or anyone's when asAdmin is set
+	DeletePromptPreset(ctx context.Context, id int, userId string, asAdmin bool) error
+	// GetPromptPreset returns a preset that belongs to the user or is public
+	GetPromptPreset(ctx context.Context, id int, userId string) (PromptPreset, error)
+	// ListPromptPresets returns a page of the user's presets, newest first, and how many they have
+	ListPromptPresets(ctx context.Context, userId string, limit, offset int) ([]PromptPreset, int, error)
+	// ListPublicPromptPresets returns a page of the presets users shared, newest first, and how
+	// many there are
+	ListPublicPromptPresets(ctx context.Context, limit, offset int) ([]PromptPreset, int, error)
+}
+
+// OrganizationStore persists team workspaces, their members and the generations drawn on their
+// credits. A user belongs to at most one workspace.
+type OrganizationStore interface {
+	// CreateOrganization creates a workspace with the user as its owner and first member
+	CreateOrganization(ctx context.Context, name, ownerId string) (Organization, error)
+	// GetOrganization returns a workspace with its members, the owner first
+	GetOrganization(ctx context.Context, id int) (Organization, error)
+	// GetUserOrganization returns the workspace the user belongs to, with its members
+	GetUserOrganization(ctx context.Context, userId string) (Organization, error)
+	// DeleteOrganization deletes a workspace along with its members and usage
+	DeleteOrganization(ctx context.Context, id int) error
+	SetOrganizationCredits(ctx context.Context, id, monthlyCredits int) (Organization, error)
+	AddOrganizationMember(ctx context.Context, id int, userId string, monthlyLimit int) (OrganizationMember, error)
+	SetOrganizationMemberLimit(ctx context.Context, id int, userId string, monthlyLimit int) (OrganizationMember, error)
+	RemoveOrganizationMember(ctx context.Context, id int, userId string) error
+	// ReserveOrganizationGeneration counts a generation by a member against the workspace's credits
+	// and their own limit. If either would be exceeded the reservation is rolled back and an error
+	// is returned with the member's current quota.
+	ReserveOrganizationGeneration(ctx context.Context, id int, userId string) (GenerationQuota, error)
+	// ReleaseOrganizationGeneration gives back a reserved generation, e.g. when the Claude call failed
+	ReleaseOrganizationGeneration(ctx context.Context, id int, userId string) error
+	// GetOrganizationUsage reports the generations drawn on a workspace's credits in the month
+	// starting at month
+	GetOrganizationUsage(ctx context.Context, id int, month time.Time) (OrganizationUsage, error)
+	// SetOrganizationReviewRequired turns the review of members' new animations on or off
+	SetOrganizationReviewRequired(ctx context.Context, id int, required bool) (Organization, error)
+	// GetAnimationReview returns the review an animation was held for
+	GetAnimationReview(ctx context.Context, animationId string) (AnimationReview, error)
+	// ListAnimationReviews returns a page of the reviews matching filter, oldest submission first,
+	// and how many there are
+	ListAnimationReviews(ctx context.Context, filter AnimationReviewFilter, limit, offset int) ([]AnimationReview, int, error)
+	// DecideAnimationReview approves or rejects a pending review. Approved animations join the feed.
+	DecideAnimationReview(ctx context.Context, animationId, status, reviewerId, note string) (AnimationReview, error)
+}
+
+// SignageStore persists the playlists digital signage screens play from
+type SignageStore interface {
+	// CreateSignageSchedule saves a schedule under a new random ID
+	CreateSignageSchedule(ctx context.Context, schedule SignageSchedule) (SignageSchedule, error)
+	// UpdateSignageSchedule replaces the name, timezone, slots and fallback of one of the schedule
+	// owner's schedules
+	UpdateSignageSchedule(ctx context.Context, schedule SignageSchedule) (SignageSchedule, error)
+	DeleteSignageSchedule(ctx context.Context, id, userId string) error
+	// GetSignageSchedule returns a schedule whoever it belongs to; screens poll it by its ID
+	GetSignageSchedule(ctx context.Context, id string) (SignageSchedule, error)
+	// ListSignageSchedules returns the user's schedules, newest first
+	ListSignageSchedules(ctx context.Context, userId string) ([]SignageSchedule, error)
+}
+
+// KioskTokenStore persists the tokens unattended displays read their assigned schedules with
+type KioskTokenStore interface {
+	// CreateKioskToken saves a token under the hash of its secret
+	CreateKioskToken(ctx context.Context, token KioskToken, tokenHash string) (KioskToken, error)
+	// ListKioskTokens returns the tokens issued, newest first
+	ListKioskTokens(ctx context.Context) ([]KioskToken, error)
+	// GetKioskTokenByHash returns the token whose secret hashes to tokenHash
+	GetKioskTokenByHash(ctx context.Context, tokenHash string) (KioskToken, error)
+	// UpdateKioskToken replaces the name, schedules and feed access of a token
+	UpdateKioskToken(ctx context.Context, token KioskToken) (KioskToken, error)
+	RevokeKioskToken(ctx context.Context, id int) error
+	// TouchKioskToken records that a token was just used
+	TouchKioskToken(ctx context.Context, id int, at time.Time) error
+}
+
+// ImpersonationStore persists the sessions admins open as users, with the hash of each session's
+// token, and their append-only audit trail
+type ImpersonationStore interface {
+	CreateImpersonation(ctx context.Context, impersonation Impersonation) (Impersonation, error)
+	GetImpersonation(ctx context.Context, id int) (Impersonation, error)
+	// GetImpersonationByTokenHash returns the impersonation whose token hashes to tokenHash
+	GetImpersonationByTokenHash(ctx context.Context, tokenHash string) (Impersonation, error)
+	// ListImpersonations returns up to limit impersonations of a user, or of every user when userId
+	// is empty, newest first
+	ListImpersonations(ctx context.Context, userId string, limit int) ([]Impersonation, error)
+	// TransitionImpersonation moves an impersonation in one of the statuses from to status,
+	// recording when the user decided or the session ended
+	TransitionImpersonation(ctx context.Context, id int, from []string, status string) (Impersonation, error)
+	// StartImpersonation makes an approved impersonation active until expiresAt, with the token
+	// hashing to tokenHash
+	StartImpersonation(ctx context.Context, id int, tokenHash string, expiresAt time.Time) (Impersonation, error)
+	RecordImpersonationAudit(ctx context.Context, entry ImpersonationAuditEntry) error
+	// ListImpersonationAudit returns everything recorded of an impersonation, oldest first
+	ListImpersonationAudit(ctx context.Context, id int) ([]ImpersonationAuditEntry, error)
+}
+
+// QuotaStore counts the generations users make with the house key against their daily and monthly
+// limits
+type QuotaStore interface {
+	// ReserveGeneration counts a generation against the user's quota. When that would exceed a limit
+	// nothing is counted, and "generation quota exceeded" is returned with the quota as it stands.
+	ReserveGeneration(ctx context.Context, userId string, dailyLimit, monthlyLimit int) (GenerationQuota, error)
+	// ReleaseGeneration gives back a reserved generation, e.g. when the Claude call failed
+	ReleaseGeneration(ctx context.Context, userId string) error
+	// GetGenerationQuota returns the user's current generation usage against the given limits
+	GetGenerationQuota(ctx context.Context, userId string, dailyLimit, monthlyLimit int) (GenerationQuota, error)
+}
+
+// MagicLinkStore keeps the hashes of the single-use tokens in emailed login links
+type MagicLinkStore interface {
+	SaveMagicLinkToken(ctx context.Context, userId, tokenHash string, expiresAt time.Time) error
+	// ConsumeMagicLinkToken marks an unused, unexpired login token as used and returns its user ID
+	ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (string, error)
+}
+
+// SanitizationStore keeps re-sanitization runs and the fixes they propose until an admin reviews them
+type SanitizationStore interface {
+	// ListAnimationCode returns up to limit animations with IDs after afterId, ordered by ID
+	ListAnimationCode(ctx context.Context, afterId string, limit int) ([]StoredAnimationCode, error)
+	// CreateSanitizationRun starts a new run and returns its ID. With a targetP5Version the run
+	// migrates animations to that p5.js version instead.
+	CreateSanitizationRun(ctx context.Context, adminId, targetP5Version string) (int, error)
+	// AddSanitizationFix records a proposed code change for an animation
+	AddSanitizationFix(ctx context.Context, runId int, animation StoredAnimationCode, newCode, diff string, validationErrors []string) error
+	// FinishSanitizationRun stores the totals of a run and marks it completed, or failed when runErr is set
+	FinishSanitizationRun(ctx context.Context, runId, scanned, changed int, runErr error) error
+	// GetSanitizationRun retrieves a run with all of its proposed fixes
+	GetSanitizationRun(ctx context.Context, runId int) (SanitizationRun, error)
+	// ApplySanitizationFixes approves pending fixes of a run (all of them when fixIds is empty) and
+	// stores their code on the animations, repinning them when the run migrates to another p5.js
+	// version. A fix is marked stale and skipped when its animation changed since the run. It
+	// returns the IDs of the animations it changed.
+	ApplySanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) ([]string, error)
+	// RejectSanitizationFixes rejects pending fixes of a run (all of them when fixIds is empty)
+	RejectSanitizationFixes(ctx context.Context, runId int, fixIds []int, adminId string) (int, error)
+}
+
+// ContractRunStore keeps the results of generation contract runs for trend reporting
+type ContractRunStore interface {
+	// SaveContractRun stores the results of a run and returns its ID
+	SaveContractRun(ctx context.Context, report ContractReport) (int, error)
+	// GetContractRuns returns the most recent runs, newest first, without their individual cases
+	GetContractRuns(ctx context.Context, limit int) ([]ContractReport, error)
+}
+
+// GenerationStore persists what each generation cost, for cost reports
+type GenerationStore interface {
+	RecordGeneration(ctx context.Context, record GenerationRecord) error
+	// GetGenerationCosts adds up the generations made from from until before to, by the user or,
+	// when userId is empty, by everyone. A zero from or to leaves that end of the range open.
+	GetGenerationCosts(ctx context.Context, from, to time.Time, userId string) (GenerationCosts, error)
+	// ListUserGenerationCosts returns the limit users whose generations from from until before to
+	// cost the most, most first
+	ListUserGenerationCosts(ctx context.Context, from, to time.Time, limit int) ([]UserGenerationCosts, error)
+}
+
+// CalendarFeedStore persists the secret tokens calendar apps subscribe to users' mood check-ins with
+type CalendarFeedStore interface {
+	// SetCalendarFeedToken stores the hash of a user's calendar token, replacing the one they had
+	SetCalendarFeedToken(ctx context.Context, userId, tokenHash string) error
+	// GetCalendarFeedUser returns the user whose calendar token hashes to tokenHash
+	GetCalendarFeedUser(ctx context.Context, tokenHash string) (string, error)
+	DeleteCalendarFeedToken(ctx context.Context, userId string) error
+}
+
+// RefinementStore keeps the conversation each animation is refined through, so follow-up
+// instructions are sent with the ones before them
+type RefinementStore interface {
+	// ListRefinementTurns returns the latest limit turns of an animation's conversation, oldest
+	// first, when userId owns the animation
+	ListRefinementTurns(ctx context.Context, animationId, userId string, limit int) ([]RefinementTurn, error)
+	// AddRefinementTurns appends turns to an animation's conversation
+	AddRefinementTurns(ctx context.Context, animationId string, turns []RefinementTurn) error
+}
+
+// GenerationJobStore is the queue generation jobs wait in until a worker runs them. A job is held
+// by the worker that claimed it for a while, after which another may claim it again.
+type GenerationJobStore interface {
+	EnqueueGenerationJob(ctx context.Context, job QueuedGeneration) error
+	// ClaimGenerationJobs returns up to limit of the jobs waiting longest, queued or abandoned by
+	// their worker, and marks them as generating
+	ClaimGenerationJobs(ctx context.Context, limit int) ([]QueuedGeneration, error)
+	// CompleteGenerationJob marks a job done with its result
+	CompleteGenerationJob(ctx context.Context, id string, result AnimationResponse) error
+	// FailGenerationJob marks a job failed with the error shown to its user
+	FailGenerationJob(ctx context.Context, id, message string) error
+	// GetGenerationJob returns one of userId's jobs
+	GetGenerationJob(ctx context.Context, id, userId string) (GenerationJob, error)
+	// DeleteFinishedGenerationJobs deletes jobs that were done or failed before before
+	DeleteFinishedGenerationJobs(ctx context.Context, before time.Time) (int, error)
+}
+
+// ExportStore persists the files animations were exported to, until they expire
+type ExportStore interface {
+	SaveAnimationExport(ctx context.Context, export AnimationExport, data []byte) error
+	// GetAnimationExport returns an export and its file, unless it has expired
+	GetAnimationExport(ctx context.Context, id string) (AnimationExport, []byte, error)
+	// FindAnimationExport returns an unexpired export of an animation's code with the same settings,
+	// so repeated exports are not rendered again
+	FindAnimationExport(ctx context.Context, animationId, codeHash, format string, frames, fps int) (AnimationExport, error)
+	// DeleteExpiredAnimationExports deletes exports that expired before before
+	DeleteExpiredAnimationExports(ctx context.Context, before time.Time) (int, error)
+}
+
+// IdempotencyStore remembers the responses to requests sent with an Idempotency-Key, so retries
+// are answered with the first response instead of being run again
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims a user's key on a route for key's request. A claim that expired,
+	// or that is still running and was made before staleBefore, is replaced. Otherwise the existing
+	// claim is returned, with its response once its request completed, and false.
+	ReserveIdempotencyKey(ctx context.Context, key IdempotencyKey, staleBefore time.Time) (IdempotencyKey, bool, error)
+	// CompleteIdempotencyKey saves the response to the request that claimed a key
+	CompleteIdempotencyKey(ctx context.Context, key IdempotencyKey) error
+	// ReleaseIdempotencyKey drops the claim on a key, so the request can be retried with it
+	ReleaseIdempotencyKey(ctx context.Context, key IdempotencyKey) error
+	// DeleteExpiredIdempotencyKeys deletes keys that expired before before, returning how many
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+}
+
+// ModerationAuditStore reads the append-only trail of moderation changes. Entries are recorded by
+// the writes that make the changes, in the same transaction, and outlive the animation.
+type ModerationAuditStore interface {
+	// ListModerationAudit returns the changes made to an animation, oldest first
+	ListModerationAudit(ctx context.Context, animationId string) ([]ModerationAuditEntry, error)
+}
+
+// TakedownStore persists reports asking for animations to be removed and their audit trails
+type TakedownStore interface {
+	// CreateTakedownRequest records a report against an animation and the first entry of its audit trail
+	CreateTakedownRequest(ctx context.Context, animationId, reporterName, reporterEmail, reason string) (TakedownRequest, error)
+	// GetTakedownRequest retrieves a takedown request with its audit trail, oldest event first.
+	// Unknown requests return "takedown request not found".
+	GetTakedownRequest(ctx context.Context, id int) (TakedownRequest, error)
+	// ListTakedownRequests returns takedown requests, newest first, optionally only those with the given status
+	ListTakedownRequests(ctx context.Context, status string, limit int) ([]TakedownRequest, error)
+	// TransitionTakedown moves a takedown request to a new status, hides or restores the animation
+	// accordingly and records the change in the audit trail. Moves ValidateTakedownTransition
+	// refuses return its error.
+	TransitionTakedown(ctx context.Context, id int, to, actor, note string) (TakedownRequest, error)
+}
+
+// OAuthStore persists third-party apps and the codes and tokens users let them in with. Codes and
+// tokens are stored under the hashes of their secrets.
+type OAuthStore interface {
+	// CreateOAuthApp registers app, with the client ID the caller picked, for the developer userId
+	CreateOAuthApp(ctx context.Context, userId string, app OAuthApp) (OAuthApp, error)
+	// ListOAuthApps returns the apps a developer registered, newest first
+	ListOAuthApps(ctx context.Context, userId string) ([]OAuthApp, error)
+	GetOAuthApp(ctx context.Context, clientId string) (OAuthApp, error)
+	// DeleteOAuthApp deletes one of a developer's apps with every code and token it was issued
+	DeleteOAuthApp(ctx context.Context, clientId, userId string) error
+	// SaveOAuthCode saves an authorization code, deleting any that expired
+	SaveOAuthCode(ctx context.Context, codeHash string, authorization OAuthAuthorization) error
+	// ConsumeOAuthCode returns the authorization of a code and deletes it, so it is only exchanged once
+	ConsumeOAuthCode(ctx context.Context, codeHash string) (OAuthAuthorization, error)
+	// CreateOAuthToken saves an access and refresh token pair
+	CreateOAuthToken(ctx context.Context, token OAuthToken, accessHash, refreshHash string) (OAuthToken, error)
+	// GetOAuthTokenByAccessHash returns the token whose access token hashes to accessHash
+	GetOAuthTokenByAccessHash(ctx context.Context, accessHash string) (OAuthToken, error)
+	// RotateOAuthToken replaces the pair whose unexpired refresh token of clientId hashes to
+	// refreshHash with the new pair in token, so each refresh token is only used once
+	RotateOAuthToken(ctx context.Context, refreshHash, clientId string, token OAuthToken, accessHash, newRefreshHash string) (OAuthToken, error)
+	// RevokeOAuthToken deletes the pair of clientId with an access or refresh token hashing to tokenHash
+	RevokeOAuthToken(ctx context.Context, tokenHash, clientId string) error
+	// ListOAuthGrants returns the apps a user let in that still hold a token, most recently let in first
+	ListOAuthGrants(ctx context.Context, userId string) ([]OAuthGrant, error)
+	// RevokeOAuthGrant deletes every token a user let an app have
+	RevokeOAuthGrant(ctx context.Context, userId, clientId string) error
+}
+
+// IntegrationKeyStore persists the keys no-code tools poll users' integration triggers with
+type IntegrationKeyStore interface {
+	// CreateIntegrationKey saves a user's key under the hash of its secret
+	CreateIntegrationKey(ctx context.Context, userId string, key IntegrationKey, keyHash string) (IntegrationKey, error)
+	// ListIntegrationKeys returns a user's keys, newest first
+	ListIntegrationKeys(ctx context.Context, userId string) ([]IntegrationKey, error)
+	// GetIntegrationKeyByHash returns the key whose secret hashes to keyHash and the user it belongs to
+	GetIntegrationKeyByHash(ctx context.Context, keyHash string) (IntegrationKey, string, error)
+	DeleteIntegrationKey(ctx context.Context, id int, userId string) error
+	// TouchIntegrationKey records that a key was just used
+	TouchIntegrationKey(ctx context.Context, id int, at time.Time) error
+}
+
+// TriggerStore lists what a user saved in the order they saved it, for integration triggers to
+// page through. A zero cursor starts from the latest limit items.
+type TriggerStore interface {
+	// ListAnimationsAfter returns up to limit of the animations a user saved after cursor, oldest
+	// first, leaving out removed ones
+	ListAnimationsAfter(ctx context.Context, userId string, cursor TriggerCursor, limit int) ([]UserAnimation, error)
+	// ListMoodsAfter returns up to limit of the moods a user saved after cursor, oldest first.
+	// Cursor IDs are animation IDs, since a user has one mood per animation.
+	ListMoodsAfter(ctx context.Context, userId string, cursor TriggerCursor, limit int) ([]MoodEntry, error)
+}
+
+// TeamIntegrationStore persists workspaces' Slack and Discord integrations, the animations they
+// posted and the anonymous mood signals teammates reacted with. A workspace has at most one
+// integration per platform.
+type TeamIntegrationStore interface {
+	// SaveTeamIntegration creates a workspace's integration with a platform, or replaces the
+	// webhook, secret and schedule of the one it has, keeping its ID
+	SaveTeamIntegration(ctx context.Context, integration TeamIntegration) (TeamIntegration, error)
+	GetTeamIntegration(ctx context.Context, organizationId int, platform string) (TeamIntegration, error)
+	GetTeamIntegrationByID(ctx context.Context, id string) (TeamIntegration, error)
+	// DeleteTeamIntegration deletes an integration along with its posts and their mood signals
+	DeleteTeamIntegration(ctx context.Context, organizationId int, platform string) error
+	// ClaimDueTeamIntegrations returns up to limit integrations whose daily post is due and holds
+	// them for a few minutes, so other posters skip them while they post
+	ClaimDueTeamIntegrations(ctx context.Context, limit int) ([]TeamIntegration, error)
+	SetNextTeamPost(ctx context.Context, id string, nextAt time.Time) error
+	RecordTeamPost(ctx context.Context, post TeamPost) (TeamPost, error)
+	// FindTeamPost returns the integration's post with the message ID or, when messageId is empty,
+	// the post made closest to at and within window of it
+	FindTeamPost(ctx context.Context, integrationId, messageId string, at time.Time, window time.Duration) (TeamPost, error)
+	// SetTeamMoodSignal records the mood a teammate reacted to a post with, replacing their earlier one
+	SetTeamMoodSignal(ctx context.Context, postId int, reactorHash string, mood Mood) error
+	// RemoveTeamMoodSignal takes back a teammate's mood signal, if it is still mood
+	RemoveTeamMoodSignal(ctx context.Context, postId int, reactorHash string, mood Mood) error
+	// ListTeamPosts returns an integration's latest limit posts, newest first, with how often
+	// teammates reacted with each mood
+	ListTeamPosts(ctx context.Context, integrationId string, limit int) ([]TeamPost, error)
+}
+
+// Store is everything the HTTP handlers need to persist. Errors use the same messages
+// across implementations (e.g. "user not found") because handlers match on them.
+type Store interface {
+	UserStore
+	AnimationStore
+	MoodStore
+	P5LibraryStore
+	ProfessionalStore
+	DatasetStore
+	CommentStore
+	NotificationStore
+	ReminderStore
+	AnnouncementStore
+	MoodRuleStore
+	PlaybackStore
+	SubscriptionStore
+	StatusStore
+	ProviderKeyStore
+	PromptPresetStore
+	CollectionStore
+	OrganizationStore
+	SignageStore
+	KioskTokenStore
+	ImpersonationStore
+	QuotaStore
+	MagicLinkStore
+	SanitizationStore
+	ContractRunStore
+	GenerationStore
+	CalendarFeedStore
+	TeamIntegrationStore
+	RefinementStore
+	IntegrationKeyStore
+	OAuthStore
+	TriggerStore
+	GenerationJobStore
+	ExportStore
+	IdempotencyStore
+	ModerationAuditStore
+	TakedownStore
+}
+
+// Every implementation must satisfy Store
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*CachedStore)(nil)
+)
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Stages reported by progress events on POST /generate-animation/stream
+const (
+	StageGenerating = "generating"
+	StageProcessing = "processing"
+)
+
+// maxStreamLine bounds a single line of a streamed Claude reply
+const maxStreamLine = 1 << 20
+
+// streamAnimationWithClaude generates an animation like GenerateAnimationWithClaude, handing each
+// piece of text to onText as Claude writes it
+func streamAnimationWithClaude(ctx context.Context, description, style string, apiKey string, onText func(string) error) (string, error) {
+	log.Printf("[CLAUDE] Streaming animation for description: %s", RedactDescriptionFor(ctx, description))
+
+	return streamClaudePromptWithModel(ctx, BuildAnimationPrompt(PromptTemplate(PromptGenerate), description, style), DefaultClaudeModel, apiKey, onText)
+}
+
+// streamClaudePromptWithModel sends a single user prompt to the given Claude model, asking for the
+// reply as server-sent events, and returns the whole text once the reply ends. An error from onText
+// stops reading.
+func streamClaudePromptWithModel(ctx context.Context, prompt string, model string, apiKey string, onText func(string) error) (string, error) {
+	ctx, span := StartSpan(ctx, "claude.messages", SpanKindClient)
+	defer span.End()
+	ctx, cancel := withClaudeTimeout(ctx)
+	defer cancel()
+
+	claudeReq := newClaudeRequest(userMessages(prompt), model)
+	claudeReq.Stream = true
+	resp, err := doClaudeRequest(ctx, span, claudeReq, apiKey)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Errors are answered with a plain JSON body rather than a stream
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamLine))
+		err := fmt.Errorf("claude returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		log.Printf("[CLAUDE ERROR] %v", err)
+		span.RecordError(err)
+		return "", err
+	}
+
+	var text strings.Builder
+	var usage ClaudeUsage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event ClaudeStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			log.Printf("[CLAUDE ERROR] Failed to unmarshal stream event: %v", err)
+			span.RecordError(err)
+			return "", err
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "message_delta":
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" {
+				continue
+			}
+			text.WriteString(event.Delta.Text)
+			if err := onText(event.Delta.Text); err != nil {
+				return "", err
+			}
+		case "error":
+			err := errors.New("claude stream failed: " + event.Error.Message)
+			log.Printf("[CLAUDE ERROR] %v", err)
+			span.RecordError(err)
+			return "", err
+		case "message_stop":
+			log.Printf("[CLAUDE] Stream finished successfully")
+			meterTokens(ctx, model, usage)
+			span.SetAttribute("gen_ai.usage.input_tokens", usage.PromptTokens())
+			span.SetAttribute("gen_ai.usage.output_tokens", usage.OutputTokens)
+			return text.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("[CLAUDE ERROR] Failed to read stream: %v", err)
+		return "", err
+	}
+	return "", errors.New("claude stream ended early")
+}
+
+// eventStream writes server-sent events, flushing each one to the client as soon as it is written
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newEventStream starts a server-sent event response, or returns false when w cannot flush
+func newEventStream(w http.ResponseWriter) (*eventStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &eventStream{w: w, flusher: flusher}, true
+}
+
+// send writes one event whose data is the JSON encoding of data
+func (s *eventStream) send(event string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, encoded); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// claudeStreamEvent formats one event of a streamed Claude reply
+func claudeStreamEvent(event, data string) string {
+	return "event: " + event + "\ndata: " + data + "\n\n"
+}
+
+func textDelta(text string) string {
+	encoded, _ := json.Marshal(text)
+	return claudeStreamEvent("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":`+string(encoded)+`}}`)
+}
+
+func TestStreamClaudePrompt(t *testing.T) {
+	saved := providerCalls
+	providerCalls = &sloTracker{}
+	t.Cleanup(func() { providerCalls = saved })
+	t.Setenv("CLAUDE_MAX_RETRIES", "0")
+
+	start := claudeStreamEvent("message_start", `{"type":"message_start","message":{"id":"msg_1"}}`) +
+		claudeStreamEvent("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`) +
+		claudeStreamEvent("ping", `{"type": "ping"}`)
+	stop := claudeStreamEvent("content_block_stop", `{"type":"content_block_stop","index":0}`) +
+		claudeStreamEvent("message_stop", `{"type":"message_stop"}`)
+
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantChunks []string
+		wantText   string
+		wantErr    bool
+	}{
+		{name: "Chunks", status: http.StatusOK, body: start + textDelta("function setup() {") + textDelta("\n}") + stop,
+			wantChunks: []string{"function setup() {", "\n}"}, wantText: "function setup() {\n}"},
+		{name: "Overloaded mid-stream", status: http.StatusOK,
+			body:       start + textDelta("function") + claudeStreamEvent("error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+			wantChunks: []string{"function"}, wantErr: true},
+		{name: "Cut off", status: http.StatusOK, body: start + textDelta("function"), wantChunks: []string{"function"}, wantErr: true},
+		{name: "Rejected", status: http.StatusTooManyRequests, body: `{"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claude := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req ClaudeRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream || r.Header.Get("x-api-key") != "test-key" {
+					t.Errorf("request = %+v, %v, want a streamed request with the API key", req, err)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer claude.Close()
+			savedURL := claudeMessagesURL
+			claudeMessagesURL = claude.URL
+			defer func() { claudeMessagesURL = savedURL }()
+
+			var chunks []string
+			text, err := streamClaudePromptWithModel(context.Background(), "a calm ocean", DefaultClaudeModel, "test-key", func(chunk string) error {
+				chunks = append(chunks, chunk)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("streamClaudePromptWithModel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if text != tt.wantText || !reflect.DeepEqual(chunks, tt.wantChunks) {
+				t.Errorf("text = %q, chunks = %q, want %q, %q", text, chunks, tt.wantText, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	rec := httptest.NewRecorder()
+	stream, ok := newEventStream(newResponseWriter(rec))
+	if !ok {
+		t.Fatal("newEventStream() cannot stream through the logging response writer")
+	}
+	stream.send("progress", GenerationProgress{Stage: StageGenerating})
+	stream.send("chunk", GenerationChunk{Text: "line one\nline two"})
+
+	want := "event: progress\ndata: {\"stage\":\"generating\"}\n\n" +
+		"event: chunk\ndata: {\"text\":\"line one\\nline two\"}\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "text/event-stream" || !rec.Flushed {
+		t.Errorf("Content-Type = %q, flushed = %v, want a flushed event stream", contentType, rec.Flushed)
+	}
+	if !strings.Contains(rec.Header().Get("Cache-Control"), "no-cache") {
+		t.Errorf("Cache-Control = %q, want no-cache", rec.Header().Get("Cache-Control"))
+	}
+}
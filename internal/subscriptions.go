@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Kinds of subscriptions
+const (
+	// SubscriptionTag follows animations whose description carries a #tag
+	SubscriptionTag = "tag"
+	// SubscriptionCreator follows the animations one user publishes
+	SubscriptionCreator = "creator"
+)
+
+const (
+	// maxSubscriptions is how many tags and creators each user may follow
+	maxSubscriptions = 100
+	// maxAnimationTags is how many of a description's tags are matched against subscriptions
+	maxAnimationTags = 10
+	// eventBusBuffer is how many published animations wait for the subscription notifier before
+	// further ones are dropped, so saves never wait on notifications
+	eventBusBuffer = 256
+)
+
+// animationTag matches a #tag in a description. Tags are matched without their # and lowercased.
+var animationTag = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]{1,32})`)
+
+// Animations handed to the subscription notifier, dropped because it fell behind, and notifications
+// sent to subscribers
+var subscriptionEventsPublished, subscriptionEventsDropped, subscriptionNotifications atomic.Int64
+
+// AnimationTags returns the distinct tags of a description, lowercased and in the order they first
+// appear, at most maxAnimationTags of them
+func AnimationTags(description string) []string {
+	tags := []string{}
+	for _, match := range animationTag.FindAllStringSubmatch(description, -1) {
+		tag := strings.ToLower(match[1])
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+		if len(tags) == maxAnimationTags {
+			break
+		}
+	}
+	return tags
+}
+
+// normalizeTag returns tag as subscriptions store it, without a leading # and lowercased, and false
+// when it is not a tag a description could carry
+func normalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	matches := AnimationTags("#" + tag)
+	if len(matches) != 1 || matches[0] != tag {
+		return "", false
+	}
+	return tag, true
+}
+
+// Validate checks that a subscription request names one tag that descriptions could carry, or
+// one creator
+func (req SubscriptionRequest) Validate() []FieldError {
+	tag, creatorId := strings.TrimSpace(req.Tag), strings.TrimSpace(req.CreatorID)
+	switch {
+	case tag == "" && creatorId == "":
+		return []FieldError{{Field: "tag", Code: ErrCodeFieldRequired, Message: "or creatorId is required"}}
+	case tag != "" && creatorId != "":
+		return []FieldError{{Field: "creatorId", Code: ErrCodeConflict, Message: "must be left out when tag is given"}}
+	case tag != "":
+		if _, ok := normalizeTag(tag); !ok {
+			return []FieldError{{Field: "tag", Code: ErrCodeFieldFormat, Message: "must be up to 32 letters, digits or underscores"}}
+		}
+	}
+	return nil
+}
+
+// AnimationPublished is the event sent when an animation first appears in the feed: once it is
+// saved, or once its workspace owner approves it when it was held for review
+type AnimationPublished struct {
+	AnimationID string
+	// CreatorID is the user who saved the animation, empty for anonymous saves
+	CreatorID string
+}
+
+// eventBus carries the server's events from the handlers that raise them to their subscribers on
+// this instance
+type eventBus struct {
+	animations chan AnimationPublished
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{animations: make(chan AnimationPublished, eventBusBuffer)}
+}
+
+// publishAnimation announces a published animation without waiting; when the subscriber is too
+// far behind the event is dropped and logged
+func (b *eventBus) publishAnimation(event AnimationPublished) {
+	select {
+	case b.animations <- event:
+		subscriptionEventsPublished.Add(1)
+	default:
+		subscriptionEventsDropped.Add(1)
+		log.Printf("[SUBSCRIPTIONS] Event bus full, not notifying subscribers of animation %s", event.AnimationID)
+	}
+}
+
+// RunSubscriptionNotifier notifies the subscribers of each animation published on this instance,
+// until ctx is done
+func (s *Server) RunSubscriptionNotifier(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.events.animations:
+			s.notifySubscribers(ctx, event)
+		}
+	}
+}
+
+// notifySubscribers sends a subscription_published notification to the users following the
+// creator or any tag of a published animation, each once. The creator is never told of their own
+// animation.
+func (s *Server) notifySubscribers(ctx context.Context, event AnimationPublished) {
+	// The animation may have been taken down or deleted while the event waited
+	animation, err := s.store.GetAnimation(ctx, event.AnimationID)
+	if err != nil {
+		log.Printf("[SUBSCRIPTIONS] Animation %s is no longer available, not notifying subscribers: %v", event.AnimationID, err)
+		return
+	}
+	tags := AnimationTags(animation.Description)
+	if event.CreatorID == "" && len(tags) == 0 {
+		return
+	}
+	subscribers, err := s.store.ListSubscribers(ctx, event.CreatorID, tags)
+	if err != nil {
+		log.Printf("[SUBSCRIPTIONS] Failed to list the subscribers of animation %s: %v", event.AnimationID, err)
+		return
+	}
+
+	creator := "Someone"
+	if event.CreatorID != "" {
+		if user, err := s.store.GetUserDetails(ctx, event.CreatorID); err == nil && user.Username != "" {
+			creator = user.Username
+		}
+	}
+	subject := creator + " published a new animation"
+	body := creator + " published " + PublicURL("/animation/"+event.AnimationID)
+	if animation.Description != "" {
+		body += ":\n\n" + animation.Description
+	}
+	body += "\n\nYou follow them or one of its tags. Manage what you follow with " + PublicURL("/subscriptions") + "."
+
+	for _, userId := range subscribers {
+		if userId == event.CreatorID {
+			continue
+		}
+		if notifyUser(ctx, s.store, s.mailer, userId, NotificationSubscriptionPublished, subject, body) {
+			subscriptionNotifications.Add(1)
+		}
+	}
+}
+
+// writeSubscriptionMetrics reports how published animations reached their subscribers
+func writeSubscriptionMetrics(w io.Writer) {
+	writeMetric(w, "animate_subscription_events_total", "counter", "Total published animations handed to the subscription notifier.", float64(subscriptionEventsPublished.Load()))
+	writeMetric(w, "animate_subscription_events_dropped_total", "counter", "Total published animations dropped because the subscription notifier fell behind.", float64(subscriptionEventsDropped.Load()))
+	writeMetric(w, "animate_subscription_notifications_total", "counter", "Total subscribers notified of a published animation.", float64(subscriptionNotifications.Load()))
+}
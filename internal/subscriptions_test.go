@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnimationTags(t *testing.T) {
+	tests := []struct {
+		description string
+		want        []string
+	}{
+		{description: "Waves at dusk #Ocean #calm, more #ocean", want: []string{"ocean", "calm"}},
+		{description: "#sunrise_2 starts it", want: []string{"sunrise_2"}},
+		{description: "issue#12 and &#39; are not tags", want: []string{}},
+		{description: "Étoiles #étoilé", want: []string{"étoilé"}},
+		{description: "no tags", want: []string{}},
+	}
+	for _, tt := range tests {
+		if got := AnimationTags(tt.description); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AnimationTags(%q) = %v, want %v", tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	server := NewServer(store)
+	router := server.Router()
+	creator := registerAccount(t, router, "creator")
+	fan := registerAccount(t, router, "fan")
+	tagFan := registerAccount(t, router, "tagfan")
+
+	subscribe := func(token string, req SubscriptionRequest, wantCode int) Subscription {
+		t.Helper()
+		var subscription Subscription
+		if code := doJSON(t, router, http.MethodPost, "/subscriptions", token, req, &subscription); code != wantCode {
+			t.Fatalf("subscribe %+v status = %d, want %d", req, code, wantCode)
+		}
+		return subscription
+	}
+	followed := subscribe(fan.Token, SubscriptionRequest{CreatorID: creator.User.ID}, http.StatusCreated)
+	if again := subscribe(fan.Token, SubscriptionRequest{CreatorID: creator.User.ID}, http.StatusOK); again.ID != followed.ID || again.CreatorUsername != "creator" {
+		t.Errorf("subscribing again = %+v, want subscription %d", again, followed.ID)
+	}
+	if tagged := subscribe(tagFan.Token, SubscriptionRequest{Tag: "#Ocean"}, http.StatusCreated); tagged.Kind != SubscriptionTag || tagged.Tag != "ocean" {
+		t.Errorf("tag subscription = %+v, want the ocean tag", tagged)
+	}
+	subscribe(fan.Token, SubscriptionRequest{}, http.StatusBadRequest)
+	subscribe(fan.Token, SubscriptionRequest{Tag: "ocean", CreatorID: creator.User.ID}, http.StatusBadRequest)
+	subscribe(fan.Token, SubscriptionRequest{Tag: "deep sea"}, http.StatusBadRequest)
+	subscribe(fan.Token, SubscriptionRequest{CreatorID: fan.User.ID}, http.StatusBadRequest)
+	subscribe(fan.Token, SubscriptionRequest{CreatorID: "missing"}, http.StatusNotFound)
+
+	// Notifications to the subscribers are held in their quiet hours, where they can be seen
+	now := time.Now().UTC()
+	quiet := NotificationPreferences{QuietHours: &QuietHours{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04"), Timezone: "UTC"}}
+	for _, userId := range []string{fan.User.ID, tagFan.User.ID} {
+		if err := store.SaveNotificationPreferences(ctx, userId, quiet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish := func(account RegisterResponse, description string) {
+		t.Helper()
+		sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: description}
+		if code := doJSON(t, router, http.MethodPost, "/save-animation", account.Token, sketch, nil); code != http.StatusOK {
+			t.Fatalf("save animation status = %d", code)
+		}
+		server.notifySubscribers(ctx, <-server.events.animations)
+	}
+	notified := func() []string {
+		var users []string
+		for _, queued := range store.notifications {
+			if queued.notification.Event == NotificationSubscriptionPublished {
+				users = append(users, queued.notification.UserID)
+			}
+		}
+		return users
+	}
+
+	publish(creator, "Waves at dusk #ocean")
+	if got := notified(); !reflect.DeepEqual(got, []string{fan.User.ID, tagFan.User.ID}) {
+		t.Errorf("notified %v, want the creator's and the tag's subscribers", got)
+	}
+	// Subscribers are not told of their own animations, nor of animations nothing they follow matches
+	publish(tagFan, "My own #ocean")
+	publish(fan, "Rain #storm")
+	if got := notified(); len(got) != 2 {
+		t.Errorf("notified %v, want no one more", got)
+	}
+
+	var list SubscriptionsResponse
+	if code := doJSON(t, router, http.MethodGet, "/subscriptions", fan.Token, nil, &list); code != http.StatusOK || len(list.Subscriptions) != 1 || list.Subscriptions[0].CreatorUsername != "creator" {
+		t.Errorf("list = %d %+v, want the creator", code, list)
+	}
+	path := "/subscriptions/" + strconv.Itoa(followed.ID)
+	if code := doJSON(t, router, http.MethodDelete, path, tagFan.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleting another user's subscription status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := doJSON(t, router, http.MethodDelete, path, fan.Token, nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", code, http.StatusNoContent)
+	}
+	publish(creator, "Tides")
+	if got := notified(); len(got) != 2 {
+		t.Errorf("notified %v after unsubscribing, want no one more", got)
+	}
+}
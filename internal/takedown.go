@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// Takedown request statuses
+const (
+	TakedownReported    = "reported"
+	TakedownUnderReview = "under_review"
+	TakedownRemoved     = "removed"
+	TakedownRestored    = "restored"
+	TakedownAppealed    = "appealed"
+)
+
+// takedownTransitions lists the statuses each status may move to. Admins review reports and
+// appeals; only the uploader can appeal a removal. Restored is final; a new report starts over.
+var takedownTransitions = map[string][]string{
+	TakedownReported:    {TakedownUnderReview},
+	TakedownUnderReview: {TakedownRemoved, TakedownRestored},
+	TakedownRemoved:     {TakedownAppealed},
+	TakedownAppealed:    {TakedownRemoved, TakedownRestored},
+}
+
+// ValidateTakedownTransition returns an error unless a takedown request may move from one status to another
+func ValidateTakedownTransition(from, to string) error {
+	for _, allowed := range takedownTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot move takedown request from %s to %s", from, to)
+}
+
+// sendTakedownNotices emails the reporter about a takedown request's new status, and notifies the
+// uploader, when known, as their notification preferences allow. Removal notices are legal notices,
+// so they are emailed to the uploader straight away whatever their preferences and quiet hours.
+// Delivery failures are logged and do not undo the change.
+func sendTakedownNotices(ctx context.Context, store Store, mailer Mailer, takedown TakedownRequest) {
+	reference := "takedown request #" + strconv.Itoa(takedown.ID)
+	animationURL := PublicURL("/animation/" + takedown.AnimationID)
+
+	var uploaderSubject, uploaderBody, reporterSubject, reporterBody string
+	uploaderEvent := NotificationTakedownDecided
+	switch takedown.Status {
+	case TakedownReported:
+		uploaderEvent = NotificationTakedownReported
+		uploaderSubject = "Your animation was reported"
+		uploaderBody = "Your animation " + animationURL + " was reported for removal (" + reference + ").\n\n" +
+			"Reason given:\n" + takedown.Reason + "\n\nIt stays visible while we review the report."
+		reporterSubject = "We received your takedown request"
+		reporterBody = "Thanks, we received " + reference + " for " + animationURL + " and will review it."
+	case TakedownRemoved:
+		uploaderSubject = "Your animation was removed"
+		uploaderBody = "Your animation " + animationURL + " was removed following " + reference + ".\n\n" +
+			"If you believe this is a mistake, you can appeal with POST " + PublicURL("/takedown-requests/"+strconv.Itoa(takedown.ID)+"/appeal") + "."
+		reporterSubject = "The animation you reported was removed"
+		reporterBody = "Following " + reference + ", " + animationURL + " has been removed."
+	case TakedownRestored:
+		uploaderSubject = "Your animation was restored"
+		uploaderBody = "After review of " + reference + ", your animation " + animationURL + " is visible again."
+		reporterSubject = "Your takedown request was resolved"
+		reporterBody = "After review of " + reference + ", " + animationURL + " has been restored."
+	case TakedownAppealed:
+		reporterSubject = "The uploader appealed the removal"
+		reporterBody = "The uploader appealed the removal made under " + reference + ". We will review the appeal."
+	default:
+		return
+	}
+
+	switch {
+	case takedown.UploaderID == "" || uploaderSubject == "":
+	case takedown.Status == TakedownRemoved:
+		if err := sendRemovalNotice(ctx, store, mailer, takedown.UploaderID, uploaderSubject, uploaderBody); err != nil {
+			log.Printf("[TAKEDOWN] Failed to notify uploader about %s: %v", reference, err)
+		}
+	default:
+		notifyUser(ctx, store, mailer, takedown.UploaderID, uploaderEvent, uploaderSubject, uploaderBody)
+	}
+	if reporterSubject != "" {
+		if err := mailer.Send(takedown.ReporterEmail, reporterSubject, reporterBody); err != nil {
+			log.Printf("[TAKEDOWN] Failed to notify reporter about %s: %v", reference, err)
+		}
+	}
+}
+
+// sendRemovalNotice emails the uploader of a removed animation
+func sendRemovalNotice(ctx context.Context, store UserStore, mailer Mailer, uploaderId, subject, body string) error {
+	uploader, err := store.GetUserDetails(ctx, uploaderId)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(uploader.Email, subject, body)
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateTakedownTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		wantErr  bool
+	}{
+		{from: TakedownReported, to: TakedownUnderReview},
+		{from: TakedownUnderReview, to: TakedownRemoved},
+		{from: TakedownUnderReview, to: TakedownRestored},
+		{from: TakedownRemoved, to: TakedownAppealed},
+		{from: TakedownAppealed, to: TakedownRemoved},
+		{from: TakedownAppealed, to: TakedownRestored},
+		{from: TakedownReported, to: TakedownRemoved, wantErr: true},
+		{from: TakedownRemoved, to: TakedownRestored, wantErr: true},
+		{from: TakedownRestored, to: TakedownUnderReview, wantErr: true},
+		{from: TakedownUnderReview, to: TakedownAppealed, wantErr: true},
+		{from: TakedownReported, to: "deleted", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			err := ValidateTakedownTransition(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateTakedownTransition(%q, %q) = %v, wantErr %v", tt.from, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTakedownHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	server := NewServer(store)
+	mailer := &fakeMailer{}
+	server.mailer = mailer
+	router := server.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	uploader := registerAccount(t, router, "uploader")
+	other := registerAccount(t, router, "other")
+	id, _ := store.SaveAnimation(ctx, "function setup() {}\nfunction draw() {}", "borrowed", uploader.User.ID, "")
+
+	// The uploader turned off takedown emails and is in quiet hours, which removal notices ignore
+	quiet := QuietHours{Start: "00:00", End: "23:59", Timezone: "UTC"}
+	store.SaveNotificationPreferences(ctx, uploader.User.ID, NotificationPreferences{
+		Events:     map[NotificationEvent][]NotificationChannel{NotificationTakedownReported: {}, NotificationTakedownDecided: {}},
+		QuietHours: &quiet,
+	})
+
+	report := TakedownReportRequest{AnimationID: id, Name: "Rights Holder", Email: "legal@example.com", Reason: "Copies our work"}
+	if code := doJSON(t, router, http.MethodPost, "/takedown-requests", "", TakedownReportRequest{AnimationID: "missing", Name: "x", Email: "x@example.com", Reason: "x"}, nil); code != http.StatusNotFound {
+		t.Errorf("report of a missing animation status = %d, want %d", code, http.StatusNotFound)
+	}
+	var filed TakedownRequest
+	if code := doJSON(t, router, http.MethodPost, "/takedown-requests", "", report, &filed); code != http.StatusCreated || filed.Status != TakedownReported {
+		t.Fatalf("report = %d %+v, want it reported", code, filed)
+	}
+	if want := []string{"legal@example.com: We received your takedown request"}; !reflect.DeepEqual(mailer.sent, want) {
+		t.Errorf("sent %v after the report, want %v", mailer.sent, want)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+id, "", nil, nil); code != http.StatusOK {
+		t.Errorf("reported animation status = %d, want it visible during review", code)
+	}
+
+	transition := func(status string) int {
+		t.Helper()
+		path := "/admin/takedown-requests/" + strconv.Itoa(filed.ID) + "/transition"
+		return doJSON(t, router, http.MethodPost, path, admin.Token, TakedownTransitionRequest{Status: status, Note: "Reviewed"}, nil)
+	}
+	if code := transition(TakedownRemoved); code != http.StatusConflict {
+		t.Errorf("removal before review status = %d, want %d", code, http.StatusConflict)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/admin/takedown-requests/"+strconv.Itoa(filed.ID)+"/transition", other.Token, TakedownTransitionRequest{Status: TakedownUnderReview}, nil); code != http.StatusForbidden {
+		t.Errorf("transition by a non-admin status = %d, want %d", code, http.StatusForbidden)
+	}
+	mailer.sent = nil
+	for _, status := range []string{TakedownUnderReview, TakedownRemoved} {
+		if code := transition(status); code != http.StatusOK {
+			t.Fatalf("move to %s status = %d", status, code)
+		}
+	}
+
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+id, "", nil, nil); code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("removed animation status = %d, want %d", code, http.StatusUnavailableForLegalReasons)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/feed", "", nil, nil); code != http.StatusNoContent {
+		t.Errorf("feed with only a removed animation status = %d, want %d", code, http.StatusNoContent)
+	}
+	want := []string{"uploader@example.com: Your animation was removed", "legal@example.com: The animation you reported was removed"}
+	if !reflect.DeepEqual(mailer.sent, want) {
+		t.Errorf("sent %v after the removal, want %v", mailer.sent, want)
+	}
+
+	var trail TakedownRequest
+	doJSON(t, router, http.MethodGet, "/admin/takedown-requests/"+strconv.Itoa(filed.ID), admin.Token, nil, &trail)
+	if trail.Status != TakedownRemoved || trail.UploaderID != uploader.User.ID || len(trail.Events) != 3 {
+		t.Errorf("takedown = %+v, want it removed with three events", trail)
+	}
+	if audit, _ := store.ListModerationAudit(ctx, id); len(audit) != 1 || audit[0].ToState != VisibilityRemoved || audit[0].Actor != admin.User.ID {
+		t.Errorf("moderation audit = %+v, want the removal by the admin", audit)
+	}
+
+	// Only the uploader may appeal, and restoring brings the animation back
+	appeal := TakedownAppealRequest{Reason: "It is my own work"}
+	if code := doJSON(t, router, http.MethodPost, "/takedown-requests/"+strconv.Itoa(filed.ID)+"/appeal", other.Token, appeal, nil); code != http.StatusNotFound {
+		t.Errorf("appeal by another user status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/takedown-requests/"+strconv.Itoa(filed.ID)+"/appeal", uploader.Token, appeal, nil); code != http.StatusOK {
+		t.Fatalf("appeal status = %d", code)
+	}
+	if code := transition(TakedownRestored); code != http.StatusOK {
+		t.Fatalf("restore status = %d", code)
+	}
+	if code := doJSON(t, router, http.MethodGet, "/animation/"+id, "", nil, nil); code != http.StatusOK {
+		t.Errorf("restored animation status = %d, want %d", code, http.StatusOK)
+	}
+	var listed []TakedownRequest
+	if code := doJSON(t, router, http.MethodGet, "/admin/takedown-requests?status="+TakedownRestored, admin.Token, nil, &listed); code != http.StatusOK || len(listed) != 1 {
+		t.Errorf("restored requests = %d %+v, want the one request", code, listed)
+	}
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	// thumbnailFrameCount makes a thumbnail the one-frame preview, captured at the end of the
+	// preview span once the sketch has had time to draw
+	thumbnailFrameCount = 1
+	// thumbnailMaxAge is how long browsers and CDNs may reuse a thumbnail; edits change its ETag
+	thumbnailMaxAge = time.Hour
+	// thumbnailRenderTimeout bounds rendering a thumbnail in the background after a save
+	thumbnailRenderTimeout = 30 * time.Second
+)
+
+// errThumbnailNotRendered is returned for a thumbnail that is not stored when no renderer is configured
+var errThumbnailNotRendered = errors.New("thumbnail not rendered")
+
+// thumbnail returns the PNG thumbnail of code, rendering and storing it the first time it is asked
+// for when a renderer is configured. Thumbnails are stored with the preview frames by code hash.
+func (s *Server) thumbnail(ctx context.Context, code string) ([]byte, error) {
+	frames, err := s.store.GetPreviewFrames(ctx, CodeHash(code), thumbnailFrameCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == thumbnailFrameCount {
+		return frames[0].PNG, nil
+	}
+
+	renderer, ok := GetSketchRenderer()
+	if !ok {
+		return nil, errThumbnailNotRendered
+	}
+	if frames, err = s.previewFrames(ctx, renderer, code, thumbnailFrameCount); err != nil {
+		return nil, err
+	}
+	return frames[0].PNG, nil
+}
+
+// renderThumbnailInBackground renders the thumbnail of an animation's new code once a save has
+// been answered, so feeds find it ready. It does nothing without a renderer or while thumbnails are
+// switched off; the thumbnail is then rendered when it is first asked for.
+func (s *Server) renderThumbnailInBackground(id, code string) {
+	if _, ok := GetSketchRenderer(); !ok || !FeatureEnabled(FeatureThumbnails) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), thumbnailRenderTimeout)
+		defer cancel()
+		if _, err := s.thumbnail(ctx, code); err != nil {
+			log.Printf("[THUMBNAIL] Failed to render the thumbnail of animation %s: %v", id, err)
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestThumbnailHandler(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	server := NewServer(NewMemoryStore())
+	router := server.Router()
+	author := registerUser(t, router, "author")
+	sketch := SaveAnimationRequest{Code: "function setup() {}\nfunction draw() {}", Description: "waves"}
+	var saved SaveAnimationResponse
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", author, sketch, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/animation/"+saved.ID+"/thumbnail", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without a renderer only stored thumbnails can be served
+	if rec := get(""); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("ETag") != "" {
+		t.Errorf("unrendered thumbnail status = %d with ETag %q, want %d without", rec.Code, rec.Header().Get("ETag"), http.StatusServiceUnavailable)
+	}
+
+	png := append(append([]byte{}, pngSignature...), "thumb"...)
+	if err := server.store.SavePreviewFrames(context.Background(), CodeHash(sketch.Code), []PreviewFrame{{Frame: previewFrameSpan, PNG: png}}); err != nil {
+		t.Fatalf("SavePreviewFrames: %v", err)
+	}
+	rec := get("")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Fatalf("thumbnail = %d %q, want the stored PNG", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q", rec.Header().Get("Cache-Control"))
+	}
+	if revalidated := get(rec.Header().Get("ETag")); revalidated.Code != http.StatusNotModified {
+		t.Errorf("revalidated status = %d, want %d", revalidated.Code, http.StatusNotModified)
+	}
+
+	edit := "function setup() {}\nfunction draw() { background(0); }"
+	doJSON(t, router, http.MethodPatch, "/animation/"+saved.ID, author, UpdateAnimationRequest{Code: &edit}, nil)
+	if edited := get(rec.Header().Get("ETag")); edited.Code != http.StatusServiceUnavailable {
+		t.Errorf("edited thumbnail status = %d, want the old one not served", edited.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/animation/missing/thumbnail", nil)
+	missing := httptest.NewRecorder()
+	router.ServeHTTP(missing, req)
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("missing animation status = %d, want %d", missing.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Defaults for serving the API
+const (
+	defaultHTTPAddr         = ":8080"
+	defaultTLSHTTPAddr      = ":80"
+	defaultHTTPSAddr        = ":443"
+	defaultAutocertCacheDir = "certs"
+)
+
+// Timeouts of every server, so slow or idle clients cannot hold connections open. Writes are not
+// limited, since generations stream their responses.
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 60 * time.Second
+	serverIdleTimeout       = 120 * time.Second
+)
+
+// ServerConfig describes how the API is served, read from the environment by ServerConfigFromEnv
+type ServerConfig struct {
+	HTTPAddr          string
+	HTTPSAddr         string
+	CertFile          string
+	KeyFile           string
+	AutocertDomains   []string
+	AutocertEmail     string
+	AutocertCacheDir  string
+	AutocertDirectory string
+	RedirectHTTP      bool
+}
+
+// TLSEnabled reports whether HTTPS is served directly instead of behind a reverse proxy
+func (c ServerConfig) TLSEnabled() bool {
+	return c.CertFile != "" || len(c.AutocertDomains) > 0
+}
+
+// ServerConfigFromEnv reads TLS_CERT_FILE/TLS_KEY_FILE for fixed certificates or TLS_AUTOCERT_DOMAINS
+// for certificates obtained over ACME. Without either the API is served over plain HTTP.
+func ServerConfigFromEnv() (ServerConfig, error) {
+	config := ServerConfig{
+		HTTPAddr:          os.Getenv("HTTP_ADDR"),
+		HTTPSAddr:         os.Getenv("HTTPS_ADDR"),
+		CertFile:          os.Getenv("TLS_CERT_FILE"),
+		KeyFile:           os.Getenv("TLS_KEY_FILE"),
+		AutocertEmail:     os.Getenv("TLS_AUTOCERT_EMAIL"),
+		AutocertCacheDir:  os.Getenv("TLS_AUTOCERT_CACHE_DIR"),
+		AutocertDirectory: os.Getenv("TLS_AUTOCERT_DIRECTORY_URL"),
+		RedirectHTTP:      true,
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			config.AutocertDomains = append(config.AutocertDomains, domain)
+		}
+	}
+	if redirect, ok := envBool("TLS_REDIRECT_HTTP"); ok {
+		config.RedirectHTTP = redirect
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return config, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if config.CertFile != "" && len(config.AutocertDomains) > 0 {
+		return config, errors.New("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS cannot both be set")
+	}
+
+	if config.HTTPAddr == "" {
+		config.HTTPAddr = defaultHTTPAddr
+		if config.TLSEnabled() {
+			config.HTTPAddr = defaultTLSHTTPAddr
+		}
+	}
+	if config.HTTPSAddr == "" {
+		config.HTTPSAddr = defaultHTTPSAddr
+	}
+	if config.AutocertCacheDir == "" {
+		config.AutocertCacheDir = defaultAutocertCacheDir
+	}
+	if config.AutocertDirectory == "" {
+		config.AutocertDirectory = acme.LetsEncryptURL
+	}
+	return config, nil
+}
+
+// ListenAndServe serves handler as configured. With TLS enabled, the HTTP listener only answers
+// ACME challenges and redirects to HTTPS (or serves handler when RedirectHTTP is off).
+func ListenAndServe(config ServerConfig, handler http.Handler) error {
+	if !config.TLSEnabled() {
+		log.Printf("Animation Server starting on %s...", config.HTTPAddr)
+		return newHTTPServer(config.HTTPAddr, handler).ListenAndServe()
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	httpHandler := handler
+	if config.RedirectHTTP {
+		httpHandler = HTTPSRedirectHandler(config.HTTPSAddr)
+	}
+
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else {
+		manager := newCertManager(config)
+		tlsConfig = manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		httpHandler = manager.HTTPHandler(httpHandler)
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		log.Printf("Serving HTTP on %s", config.HTTPAddr)
+		errs <- newHTTPServer(config.HTTPAddr, httpHandler).ListenAndServe()
+	}()
+	go func() {
+		server := newHTTPServer(config.HTTPSAddr, HSTSMiddleware(handler))
+		server.TLSConfig = tlsConfig
+		log.Printf("Animation Server starting on %s (HTTPS)...", config.HTTPSAddr)
+		errs <- server.ListenAndServeTLS("", "")
+	}()
+	return <-errs
+}
+
+// newHTTPServer returns a server of handler on addr with the read and idle timeouts
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+}
+
+// HTTPSRedirectHandler redirects every request to the same URL over HTTPS
+func HTTPSRedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		// 308 keeps the method and body of API calls; browsers get a plain permanent redirect
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+// HSTSMiddleware tells browsers to only use HTTPS for this host
+func HSTSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newCertManager returns the manager that obtains and renews certificates for the configured
+// domains over ACME HTTP-01 challenges, keeping the account key and certificates in the cache dir
+func newCertManager(config ServerConfig) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.AutocertDomains...),
+		Cache:      autocert.DirCache(config.AutocertCacheDir),
+		Email:      config.AutocertEmail,
+		Client:     &acme.Client{DirectoryURL: config.AutocertDirectory},
+	}
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantErr       bool
+		wantTLS       bool
+		wantHTTPAddr  string
+		wantRedirects bool
+	}{
+		{name: "plain HTTP", env: map[string]string{}, wantHTTPAddr: ":8080", wantRedirects: true},
+		{name: "certificate files", env: map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem"}, wantTLS: true, wantHTTPAddr: ":80", wantRedirects: true},
+		{name: "autocert without redirect", env: map[string]string{"TLS_AUTOCERT_DOMAINS": "a.example.com, b.example.com", "TLS_REDIRECT_HTTP": "false"}, wantTLS: true, wantHTTPAddr: ":80"},
+		{name: "custom HTTP address", env: map[string]string{"TLS_AUTOCERT_DOMAINS": "a.example.com", "HTTP_ADDR": ":8081"}, wantTLS: true, wantHTTPAddr: ":8081", wantRedirects: true},
+		{name: "certificate without key", env: map[string]string{"TLS_CERT_FILE": "cert.pem"}, wantErr: true},
+		{name: "certificate and autocert", env: map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "TLS_AUTOCERT_DOMAINS": "a.example.com"}, wantErr: true},
+	}
+
+	keys := []string{"HTTP_ADDR", "HTTPS_ADDR", "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_AUTOCERT_DOMAINS", "TLS_REDIRECT_HTTP"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range keys {
+				t.Setenv(key, tt.env[key])
+			}
+
+			config, err := ServerConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ServerConfigFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.TLSEnabled() != tt.wantTLS {
+				t.Errorf("TLSEnabled() = %v, want %v", config.TLSEnabled(), tt.wantTLS)
+			}
+			if config.HTTPAddr != tt.wantHTTPAddr {
+				t.Errorf("HTTPAddr = %q, want %q", config.HTTPAddr, tt.wantHTTPAddr)
+			}
+			if config.RedirectHTTP != tt.wantRedirects {
+				t.Errorf("RedirectHTTP = %v, want %v", config.RedirectHTTP, tt.wantRedirects)
+			}
+		})
+	}
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		httpsAddr    string
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "GET on default port", httpsAddr: ":443", method: http.MethodGet, target: "http://example.com/feed?x=1", wantStatus: http.StatusMovedPermanently, wantLocation: "https://example.com/feed?x=1"},
+		{name: "POST keeps method", httpsAddr: ":443", method: http.MethodPost, target: "http://example.com:80/login", wantStatus: http.StatusPermanentRedirect, wantLocation: "https://example.com/login"},
+		{name: "custom HTTPS port", httpsAddr: ":8443", method: http.MethodGet, target: "http://example.com:8080/feed", wantStatus: http.StatusMovedPermanently, wantLocation: "https://example.com:8443/feed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			HTTPSRedirectHandler(tt.httpsAddr).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestCertManager(t *testing.T) {
+	config := ServerConfig{AutocertDomains: []string{"api.example.com"}, AutocertCacheDir: t.TempDir(), AutocertEmail: "ops@example.com"}
+	m := newCertManager(config)
+	if err := m.HostPolicy(context.Background(), "api.example.com"); err != nil {
+		t.Errorf("configured domain refused: %v", err)
+	}
+	if err := m.HostPolicy(context.Background(), "evil.example.com"); err == nil {
+		t.Error("unconfigured domain allowed")
+	}
+	if m.Email != config.AutocertEmail {
+		t.Errorf("email = %q, want %q", m.Email, config.AutocertEmail)
+	}
+
+	// Requests other than ACME challenges reach the redirect
+	handler := m.HTTPHandler(HTTPSRedirectHandler(":443"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://api.example.com/feed", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://api.example.com/feed" {
+		t.Errorf("redirect = %d %q, want 301 to HTTPS", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://api.example.com/.well-known/acme-challenge/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown challenge status = %d, want 404", rec.Code)
+	}
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	server := newHTTPServer(":8080", http.NotFoundHandler())
+	if server.ReadHeaderTimeout <= 0 || server.ReadTimeout <= 0 || server.IdleTimeout <= 0 {
+		t.Errorf("timeouts = %v header, %v read, %v idle, want all set", server.ReadHeaderTimeout, server.ReadTimeout, server.IdleTimeout)
+	}
+	if server.WriteTimeout != 0 {
+		t.Errorf("write timeout = %v, want none so streams are not cut off", server.WriteTimeout)
+	}
+}
@@ -0,0 +1,358 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Span kinds and status codes as defined by the OTLP trace protocol
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+
+	spanStatusError = 2
+)
+
+// Export tuning for the OTLP exporter
+const (
+	spanQueueSize     = 2048
+	spanBatchSize     = 256
+	spanFlushInterval = 5 * time.Second
+)
+
+// spanContextKey stores the active span in a context
+type spanContextKey struct{}
+
+// Span is a single timed operation in a trace. A nil *Span is a valid no-op span,
+// which is what StartSpan returns when tracing is disabled.
+type Span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	errMessage string
+	tracer     *tracer
+}
+
+// SetAttribute records a string, bool, int or float attribute on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.errMessage = err.Error()
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.tracer.enqueue(s)
+}
+
+// TraceParent returns the W3C traceparent header value for the span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+// tracer batches finished spans and sends them to an OTLP/HTTP collector
+type tracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	queue       chan *Span
+	client      *http.Client
+}
+
+var (
+	tracerOnce   sync.Once
+	activeTracer *tracer
+)
+
+// getTracer returns the exporter configured by OTEL_EXPORTER_OTLP_ENDPOINT, or nil when tracing is disabled
+func getTracer() *tracer {
+	tracerOnce.Do(func() {
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		if endpoint == "" {
+			base := strings.TrimRight(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/")
+			if base == "" {
+				return
+			}
+			endpoint = base + "/v1/traces"
+		}
+
+		serviceName := os.Getenv("OTEL_SERVICE_NAME")
+		if serviceName == "" {
+			serviceName = "animate-server"
+		}
+
+		activeTracer = &tracer{
+			endpoint:    endpoint,
+			headers:     parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+			serviceName: serviceName,
+			queue:       make(chan *Span, spanQueueSize),
+			client:      &http.Client{Timeout: 10 * time.Second},
+		}
+		go activeTracer.run()
+		log.Printf("[TRACE] Exporting spans to %s", endpoint)
+	})
+	return activeTracer
+}
+
+// StartSpan starts a span as a child of the span in ctx, or a new trace when there is none
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	t := getTracer()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{name: name, kind: kind, start: time.Now(), attributes: make(map[string]interface{}), tracer: t}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SpanFromContext returns the active span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// startRemoteSpan starts a server span that continues the trace in an incoming traceparent header
+func startRemoteSpan(ctx context.Context, traceParent, name string) (context.Context, *Span) {
+	ctx, span := StartSpan(ctx, name, SpanKindServer)
+	if span == nil {
+		return ctx, nil
+	}
+	if traceID, parentID, ok := parseTraceParent(traceParent); ok {
+		span.traceID = traceID
+		span.parentID = parentID
+	}
+	return ctx, span
+}
+
+// parseTraceParent parses a W3C traceparent header
+func parseTraceParent(header string) ([16]byte, [8]byte, bool) {
+	var traceID [16]byte
+	var parentID [8]byte
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false
+	}
+	if traceID == ([16]byte{}) || parentID == ([8]byte{}) {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, true
+}
+
+// parseOTLPHeaders parses OTEL_EXPORTER_OTLP_HEADERS ("key=value,key2=value2")
+func parseOTLPHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) != "" {
+			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return headers
+}
+
+// enqueue queues a finished span, dropping it when the exporter is falling behind
+func (t *tracer) enqueue(span *Span) {
+	select {
+	case t.queue <- span:
+	default:
+	}
+}
+
+// run exports queued spans in batches
+func (t *tracer) run() {
+	ticker := time.NewTicker(spanFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, spanBatchSize)
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) < spanBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := t.export(batch); err != nil {
+			log.Printf("[TRACE] Failed to export %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+}
+
+// export sends spans to the collector using the OTLP/HTTP JSON encoding
+func (t *tracer) export(spans []*Span) error {
+	body, err := json.Marshal(t.payload(spans))
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// payload builds the OTLP ExportTraceServiceRequest for a batch of spans
+func (t *tracer) payload(spans []*Span) map[string]interface{} {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		otlpSpan := map[string]interface{}{
+			"traceId":           hex.EncodeToString(span.traceID[:]),
+			"spanId":            hex.EncodeToString(span.spanID[:]),
+			"name":              span.name,
+			"kind":              span.kind,
+			"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.attributes),
+		}
+		if span.parentID != ([8]byte{}) {
+			otlpSpan["parentSpanId"] = hex.EncodeToString(span.parentID[:])
+		}
+		if span.errMessage != "" {
+			otlpSpan["status"] = map[string]interface{}{"code": spanStatusError, "message": span.errMessage}
+		}
+		otlpSpans = append(otlpSpans, otlpSpan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": t.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "animate-server"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpAttributes converts attributes to OTLP KeyValue entries
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	keyValues := make([]map[string]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var anyValue map[string]interface{}
+		switch v := value.(type) {
+		case bool:
+			anyValue = map[string]interface{}{"boolValue": v}
+		case int:
+			anyValue = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			anyValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			anyValue = map[string]interface{}{"doubleValue": v}
+		default:
+			anyValue = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		keyValues = append(keyValues, map[string]interface{}{"key": key, "value": anyValue})
+	}
+	return keyValues
+}
+
+// TracingMiddleware starts a server span for each request, continuing any incoming W3C trace
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := startRemoteSpan(r.Context(), r.Header.Get("traceparent"), r.Method+" "+routeTemplate(r))
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("client.address", ClientIP(r))
+
+		wrw := newResponseWriter(w)
+		next.ServeHTTP(wrw, r.WithContext(ctx))
+
+		span.SetAttribute("http.response.status_code", wrw.statusCode)
+		if wrw.statusCode >= 500 {
+			span.RecordError(fmt.Errorf("HTTP %d", wrw.statusCode))
+		}
+	})
+}
+
+// routeTemplate returns the matched route pattern so span names don't contain IDs
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceID, parentID, ok := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatal("valid traceparent should parse")
+	}
+	if traceID[0] != 0x4b || parentID[7] != 0xb7 {
+		t.Errorf("parsed IDs %x / %x do not match header", traceID, parentID)
+	}
+
+	for _, header := range []string{"", "garbage", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		if _, _, ok := parseTraceParent(header); ok {
+			t.Errorf("parseTraceParent(%q) should fail", header)
+		}
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	var received map[string]interface{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("path = %q, want /v1/traces", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("missing configured OTLP header")
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer collector.Close()
+
+	exporter := &tracer{
+		endpoint:    collector.URL + "/v1/traces",
+		headers:     parseOTLPHeaders("Authorization=Bearer token"),
+		serviceName: "animate-server",
+		queue:       make(chan *Span, 2),
+	}
+	exporter.client = collector.Client()
+
+	parent := &Span{name: "GET /feed", kind: SpanKindServer, attributes: map[string]interface{}{}, tracer: exporter}
+	parent.traceID[0], parent.spanID[0] = 1, 1
+	ctx := context.WithValue(context.Background(), spanContextKey{}, parent)
+
+	child := &Span{name: "db SELECT", kind: SpanKindClient, attributes: map[string]interface{}{"db.system": "postgresql"}, tracer: exporter}
+	child.traceID = SpanFromContext(ctx).traceID
+	child.parentID = parent.spanID
+	child.spanID[0] = 2
+	child.RecordError(errors.New("boom"))
+
+	if err := exporter.export([]*Span{parent, child}); err != nil {
+		t.Fatalf("export() error = %v", err)
+	}
+
+	resourceSpans := received["resourceSpans"].([]interface{})
+	scopeSpans := resourceSpans[0].(map[string]interface{})["scopeSpans"].([]interface{})
+	spans := scopeSpans[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+
+	exportedChild := spans[1].(map[string]interface{})
+	if exportedChild["parentSpanId"] != "0100000000000000" {
+		t.Errorf("parentSpanId = %v, want parent span ID", exportedChild["parentSpanId"])
+	}
+	if status, ok := exportedChild["status"].(map[string]interface{}); !ok || status["message"] != "boom" {
+		t.Errorf("status = %v, want error status", exportedChild["status"])
+	}
+}
@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// integrationKeyPrefix marks integration keys apart from the JWTs users sign in with
+	integrationKeyPrefix        = "ik_"
+	maxIntegrationKeyNameLength = 80
+	// maxIntegrationKeys caps how many keys one user may hold
+	maxIntegrationKeys = 10
+	// integrationKeyTouchInterval is how stale a key's last use may get before it is recorded
+	// again, so tools polling every few minutes do not write on every request
+	integrationKeyTouchInterval = 5 * time.Minute
+	// triggerPageSize is the most items one poll of a trigger returns
+	triggerPageSize = 100
+)
+
+// Integration trigger events. There is no new_follower trigger because accounts cannot follow
+// each other yet.
+const (
+	TriggerNewAnimation = "new_animation"
+	TriggerNewMood      = "new_mood"
+)
+
+// TriggerEvents are the integration triggers a key may poll
+var TriggerEvents = []string{TriggerNewAnimation, TriggerNewMood}
+
+// newIntegrationKey returns a random integration key and the hash it is stored under
+func newIntegrationKey() (string, string, error) {
+	secret, err := generateRandomID()
+	if err != nil {
+		return "", "", err
+	}
+	key := integrationKeyPrefix + secret
+	return key, HashToken(key), nil
+}
+
+// ValidateIntegrationKey checks an integration key request and returns the key it describes
+func ValidateIntegrationKey(req IntegrationKeyRequest) (IntegrationKey, error) {
+	key := IntegrationKey{Name: strings.TrimSpace(req.Name)}
+	if key.Name == "" || len(key.Name) > maxIntegrationKeyNameLength {
+		return IntegrationKey{}, fmt.Errorf("name must be 1-%d characters", maxIntegrationKeyNameLength)
+	}
+	return key, nil
+}
+
+// Before reports whether an item created at at with the given ID comes after the cursor
+func (c TriggerCursor) Before(at time.Time, id string) bool {
+	if !at.Equal(c.At) {
+		return at.After(c.At)
+	}
+	return id > c.ID
+}
+
+// String encodes the cursor for the since parameter. Callers should treat it as opaque.
+func (c TriggerCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.At.UnixNano(), 10) + ":" + c.ID))
+}
+
+// ParseTriggerSince reads where a poll starts from: a cursor a previous poll returned, or an
+// RFC 3339 time for tools that keep their own. An empty since starts from the latest items.
+func ParseTriggerSince(since string) (TriggerCursor, error) {
+	if since == "" {
+		return TriggerCursor{}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, since); err == nil {
+		// IDs sort after "", so items saved at exactly that time are included
+		return TriggerCursor{At: at}, nil
+	}
+	invalid := errors.New("since must be a cursor from an earlier poll or an RFC 3339 time")
+	decoded, err := base64.RawURLEncoding.DecodeString(since)
+	if err != nil {
+		return TriggerCursor{}, invalid
+	}
+	nanos, id, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return TriggerCursor{}, invalid
+	}
+	unixNanos, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil || unixNanos <= 0 {
+		return TriggerCursor{}, invalid
+	}
+	return TriggerCursor{At: time.Unix(0, unixNanos), ID: id}, nil
+}
+
+// triggerPage trims items after a cursor, oldest first, to a page. A zero cursor keeps the latest
+// items; any other keeps the earliest, so a poll that falls behind catches up without gaps.
+func triggerPage[T any](items []T, cursor TriggerCursor, limit int) []T {
+	if len(items) <= limit {
+		return items
+	}
+	if cursor.At.IsZero() {
+		return items[len(items)-limit:]
+	}
+	return items[:limit]
+}
+
+// animationTriggerItems turns a page of animations, oldest first, into trigger items
+func animationTriggerItems(animations []UserAnimation) []TriggerItem {
+	items := make([]TriggerItem, 0, len(animations))
+	for _, animation := range animations {
+		cursor := TriggerCursor{At: animation.CreatedAt, ID: animation.ID}
+		items = append(items, TriggerItem{
+			ID:          animation.ID,
+			Cursor:      cursor.String(),
+			AnimationID: animation.ID,
+			Description: animation.Description,
+			URL:         PublicURL("/animation/" + animation.ID),
+			CreatedAt:   animation.CreatedAt,
+		})
+	}
+	return items
+}
+
+// moodTriggerItems turns a page of moods, oldest first, into trigger items. A user has one mood
+// per animation, which a new check-in replaces, so each check-in is told apart by when it was saved.
+func moodTriggerItems(moods []MoodEntry) []TriggerItem {
+	items := make([]TriggerItem, 0, len(moods))
+	for _, mood := range moods {
+		cursor := TriggerCursor{At: mood.CreatedAt, ID: mood.AnimationID}
+		items = append(items, TriggerItem{
+			ID:          HashToken(mood.AnimationID + ":" + mood.CreatedAt.UTC().Format(time.RFC3339Nano))[:32],
+			Cursor:      cursor.String(),
+			AnimationID: mood.AnimationID,
+			Description: mood.AnimationDescription,
+			URL:         PublicURL("/animation/" + mood.AnimationID),
+			Mood:        mood.Mood,
+			CreatedAt:   mood.CreatedAt,
+		})
+	}
+	return items
+}
+
+// triggerResponse answers a poll from since with a page of items, oldest first. Items are returned
+// newest first, as polling tools expect, and the next poll carries on from the newest. A poll that
+// finds nothing new hands its own since back. Only polls from a cursor can have more to fetch,
+// since one without starts from the latest items.
+func triggerResponse(event string, items []TriggerItem, since string) TriggerResponse {
+	response := TriggerResponse{Event: event, Items: make([]TriggerItem, 0, len(items)), NextCursor: since}
+	response.HasMore = since != "" && len(items) == triggerPageSize
+	for i := len(items) - 1; i >= 0; i-- {
+		response.Items = append(response.Items, items[i])
+	}
+	if len(items) > 0 {
+		response.NextCursor = items[len(items)-1].Cursor
+	}
+	return response
+}
+
+// IntegrationKeyAuthMiddleware authenticates no-code tools by the integration key in their
+// X-API-Key header and adds its owner to the context. Integration keys are not JWTs, so
+// AuthMiddleware turns them away from every other route.
+func (s *Server) IntegrationKeyAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret := r.Header.Get("X-API-Key")
+		if !strings.HasPrefix(secret, integrationKeyPrefix) {
+			EncodeError(w, "Integration key required", http.StatusUnauthorized)
+			return
+		}
+		key, userId, err := s.store.GetIntegrationKeyByHash(r.Context(), HashToken(secret))
+		if err != nil {
+			if err.Error() != "integration key not found" {
+				LogResponse(r.URL.Path, "Error retrieving integration key", err)
+				EncodeError(w, "Error retrieving integration key", http.StatusInternalServerError)
+				return
+			}
+			EncodeError(w, "Invalid integration key", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= integrationKeyTouchInterval {
+			if err := s.store.TouchIntegrationKey(r.Context(), key.ID, now); err != nil {
+				log.Printf("[TRIGGERS] Failed to record use of integration key %d: %v", key.ID, err)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey, userId)))
+	})
+}
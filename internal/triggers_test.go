@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTriggerSince(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 30, 0, 123456000, time.UTC)
+	tests := []struct {
+		name    string
+		since   string
+		want    TriggerCursor
+		wantErr bool
+	}{
+		{name: "Empty starts from the latest", since: "", want: TriggerCursor{}},
+		{name: "Cursor", since: TriggerCursor{At: at, ID: "abc"}.String(), want: TriggerCursor{At: at, ID: "abc"}},
+		{name: "RFC 3339 time", since: "2024-05-01T09:30:00Z", want: TriggerCursor{At: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)}},
+		{name: "Garbage", since: "not a cursor!", wantErr: true},
+		{name: "Cursor without an ID", since: "MTIz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := ParseTriggerSince(tt.since)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTriggerSince() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!cursor.At.Equal(tt.want.At) || cursor.ID != tt.want.ID) {
+				t.Errorf("cursor = %+v, want %+v", cursor, tt.want)
+			}
+		})
+	}
+}
+
+func TestTriggerCursorOrder(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	cursor := TriggerCursor{At: at, ID: "m"}
+	tests := []struct {
+		name string
+		at   time.Time
+		id   string
+		want bool
+	}{
+		{name: "Later", at: at.Add(time.Microsecond), id: "a", want: true},
+		{name: "Earlier", at: at.Add(-time.Microsecond), id: "z", want: false},
+		{name: "Same instant, later ID", at: at, id: "n", want: true},
+		{name: "Same instant, earlier ID", at: at, id: "l", want: false},
+		{name: "The cursor's own item", at: at, id: "m", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cursor.Before(tt.at, tt.id); got != tt.want {
+				t.Errorf("Before() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pollTrigger polls an integration trigger with an integration key
+func pollTrigger(t *testing.T, router http.Handler, key, path string) (int, TriggerResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var response TriggerResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("decode %s response: %v", path, err)
+		}
+	}
+	return rec.Code, response
+}
+
+func TestIntegrationTriggers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	artist := registerAccount(t, router, "artist")
+	other := registerAccount(t, router, "other")
+
+	var key IntegrationKey
+	if code := doJSON(t, router, http.MethodPost, "/me/integration-keys", artist.Token, IntegrationKeyRequest{Name: " Zapier "}, &key); code != http.StatusCreated {
+		t.Fatalf("issue status = %d", code)
+	}
+	if !strings.HasPrefix(key.Key, integrationKeyPrefix) || key.Name != "Zapier" {
+		t.Fatalf("issued %+v, want a named key", key)
+	}
+	if code := doJSON(t, router, http.MethodPost, "/me/integration-keys", artist.Token, IntegrationKeyRequest{Name: " "}, nil); code != http.StatusBadRequest {
+		t.Errorf("blank name status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	first, _ := store.SaveAnimation(ctx, "function draw() { one(); }", "first", artist.User.ID, "")
+	second, _ := store.SaveAnimation(ctx, "function draw() { two(); }", "second", artist.User.ID, "")
+	store.SaveAnimation(ctx, "function draw() { theirs(); }", "theirs", other.User.ID, "")
+	store.SaveMood(ctx, artist.User.ID, first, string(MoodBetter))
+
+	t.Run("Authentication", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			key      string
+			bearer   string
+			wantCode int
+		}{
+			{name: "No key", wantCode: http.StatusUnauthorized},
+			{name: "Unknown key", key: integrationKeyPrefix + "unknown", wantCode: http.StatusUnauthorized},
+			{name: "Sign-in token", bearer: artist.Token, wantCode: http.StatusUnauthorized},
+			{name: "Integration key", key: key.Key, wantCode: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/integrations/triggers", nil)
+				if tt.key != "" {
+					req.Header.Set("X-API-Key", tt.key)
+				}
+				if tt.bearer != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.bearer)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != tt.wantCode {
+					t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+				}
+				if tt.wantCode == http.StatusOK {
+					var triggers TriggersResponse
+					json.NewDecoder(rec.Body).Decode(&triggers)
+					if triggers.UserID != artist.User.ID || len(triggers.Events) != len(TriggerEvents) {
+						t.Errorf("triggers = %+v, want the artist's", triggers)
+					}
+				}
+			})
+		}
+		// Integration keys open nothing else
+		req := httptest.NewRequest(http.MethodGet, "/my-animations", nil)
+		req.Header.Set("Authorization", "Bearer "+key.Key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("/my-animations with an integration key status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("Polls", func(t *testing.T) {
+		code, animations := pollTrigger(t, router, key.Key, "/integrations/triggers/new_animation")
+		if code != http.StatusOK || len(animations.Items) != 2 || animations.Items[0].ID != second || animations.Items[1].ID != first {
+			t.Fatalf("first poll = %d %+v, want the artist's two animations newest first", code, animations)
+		}
+		if animations.NextCursor != animations.Items[0].Cursor || animations.HasMore {
+			t.Errorf("next cursor = %q, hasMore %v, want the newest item's and no more", animations.NextCursor, animations.HasMore)
+		}
+
+		code, again := pollTrigger(t, router, key.Key, "/integrations/triggers/new_animation?since="+animations.NextCursor)
+		if code != http.StatusOK || len(again.Items) != 0 || again.NextCursor != animations.NextCursor {
+			t.Errorf("poll with nothing new = %d %+v, want no items and the same cursor", code, again)
+		}
+
+		third, _ := store.SaveAnimation(ctx, "function draw() { three(); }", "third", artist.User.ID, "")
+		code, later := pollTrigger(t, router, key.Key, "/integrations/triggers/new_animation?since="+animations.NextCursor)
+		if code != http.StatusOK || len(later.Items) != 1 || later.Items[0].ID != third || later.Items[0].URL != PublicURL("/animation/"+third) {
+			t.Errorf("poll after saving = %d %+v, want only the new animation", code, later)
+		}
+
+		code, moods := pollTrigger(t, router, key.Key, "/integrations/triggers/new_mood")
+		if code != http.StatusOK || len(moods.Items) != 1 || moods.Items[0].Mood != MoodBetter || moods.Items[0].Description != "first" {
+			t.Fatalf("mood poll = %d %+v, want the artist's check-in", code, moods)
+		}
+		// Checking in again on the same animation is a new event
+		store.SaveMood(ctx, artist.User.ID, first, string(MoodMuchBetter))
+		code, changed := pollTrigger(t, router, key.Key, "/integrations/triggers/new_mood?since="+moods.NextCursor)
+		if code != http.StatusOK || len(changed.Items) != 1 || changed.Items[0].ID == moods.Items[0].ID || changed.Items[0].Mood != MoodMuchBetter {
+			t.Errorf("poll after checking in again = %d %+v, want a new item", code, changed)
+		}
+	})
+
+	t.Run("Invalid polls", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			path     string
+			wantCode int
+		}{
+			{name: "Unknown event", path: "/integrations/triggers/new_follower", wantCode: http.StatusNotFound},
+			{name: "Invalid since", path: "/integrations/triggers/new_animation?since=yesterday", wantCode: http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if code, _ := pollTrigger(t, router, key.Key, tt.path); code != tt.wantCode {
+					t.Errorf("status = %d, want %d", code, tt.wantCode)
+				}
+			})
+		}
+	})
+
+	t.Run("Revoking", func(t *testing.T) {
+		var keys IntegrationKeysResponse
+		doJSON(t, router, http.MethodGet, "/me/integration-keys", artist.Token, nil, &keys)
+		if len(keys.Keys) != 1 || keys.Keys[0].Key != "" || keys.Keys[0].LastUsedAt == nil {
+			t.Fatalf("keys = %+v, want the used key without its secret", keys.Keys)
+		}
+		path := "/me/integration-keys/" + strconv.Itoa(key.ID)
+		if code := doJSON(t, router, http.MethodDelete, path, other.Token, nil, nil); code != http.StatusNotFound {
+			t.Errorf("deleting another user's key status = %d, want %d", code, http.StatusNotFound)
+		}
+		if code := doJSON(t, router, http.MethodDelete, path, artist.Token, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("delete status = %d", code)
+		}
+		if code, _ := pollTrigger(t, router, key.Key, "/integrations/triggers/new_animation"); code != http.StatusUnauthorized {
+			t.Errorf("poll with a deleted key status = %d, want %d", code, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses a generation reports on GET /ws
+const (
+	GenerationQueued     = "queued"
+	GenerationGenerating = "generating"
+	GenerationSanitizing = "sanitizing"
+	GenerationDone       = "done"
+	GenerationFailed     = "failed"
+)
+
+// GenerationJobHeader carries the ID a generation's updates on GET /ws are tagged with
+const GenerationJobHeader = "X-Generation-Job"
+
+// updateBuffer is how many updates a slow connection may fall behind before further ones are dropped
+const updateBuffer = 32
+
+// updateHub fans generation updates out to each user's WebSocket connections. Connections only
+// hear about generations made through the same instance.
+type updateHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan GenerationUpdate]struct{}
+}
+
+// generationUpdates carries updates for every generation this instance makes
+var generationUpdates = &updateHub{}
+
+// subscribe returns a channel receiving the user's updates and a function that stops them
+func (h *updateHub) subscribe(userId string) (<-chan GenerationUpdate, func()) {
+	updates := make(chan GenerationUpdate, updateBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = map[string]map[chan GenerationUpdate]struct{}{}
+	}
+	if h.subscribers[userId] == nil {
+		h.subscribers[userId] = map[chan GenerationUpdate]struct{}{}
+	}
+	h.subscribers[userId][updates] = struct{}{}
+
+	return updates, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[userId], updates)
+		if len(h.subscribers[userId]) == 0 {
+			delete(h.subscribers, userId)
+		}
+	}
+}
+
+// publish hands an update to each of the user's connections without waiting on slow ones
+func (h *updateHub) publish(userId string, update GenerationUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for updates := range h.subscribers[userId] {
+		select {
+		case updates <- update:
+		default:
+			log.Printf("[WS] Dropping %s update for job %s: connection is too far behind", update.Status, update.JobID)
+		}
+	}
+}
+
+// generationJob is one accepted generation request
+type generationJob struct {
+	id          string
+	userId      string
+	description string
+	// style is the visual style asked for, or empty for the default
+	style string
+	key   GenerationKey
+	// organizationId is the workspace whose credits pay for the generation, or 0
+	organizationId int
+}
+
+// publish reports the job's progress to the user's WebSocket connections
+func (j generationJob) publish(update GenerationUpdate) {
+	update.JobID = j.id
+	update.At = time.Now().UTC()
+	generationUpdates.publish(j.userId, update)
+}
+
+// generationUpdatesHandler upgrades the caller's connection to a WebSocket and pushes a
+// GenerationUpdate text message for each step of their generations until it closes. Browsers,
+// which cannot set an Authorization header, offer the subprotocols "bearer" and their token.
+func (s *Server) generationUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		LogResponse("/ws", "User ID missing from context", nil)
+		EncodeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := validateWebSocketHandshake(r); err != nil {
+		LogResponse("/ws", "Invalid WebSocket handshake", err)
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		EncodeError(w, err.Error(), http.StatusUpgradeRequired)
+		return
+	}
+
+	// Subscribe before the handshake completes so no update after it is missed
+	updates, unsubscribe := generationUpdates.subscribe(userId)
+	defer unsubscribe()
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		LogResponse("/ws", "Error upgrading connection", err)
+		EncodeError(w, "Error upgrading connection", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	LogResponse("/ws", "Streaming generation updates to user "+userId, nil)
+
+	closed := make(chan struct{})
+	go conn.serveControlFrames(closed)
+	ping := time.NewTicker(webSocketPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		case update := <-updates:
+			message, err := json.Marshal(update)
+			if err != nil {
+				LogResponse("/ws", "Error encoding generation update", err)
+				continue
+			}
+			if conn.writeFrame(wsOpText, message) != nil {
+				return
+			}
+		case <-ping.C:
+			if conn.writeFrame(wsOpPing, nil) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Request models declare how their fields must look in validate struct tags, which decodeRequest
+// checks once the body is decoded. A tag lists comma-separated rules:
+//
+//	required    the field must be set; strings must not be blank and pointers not nil
+//	email       a non-blank string must be a bare email address
+//	min=N       strings need at least N characters, numbers a value of N and lists N items
+//	max=N       strings, numbers and lists may have at most N
+//	oneof=a|b   a non-blank string must be one of the values separated by |
+//	mood        a non-blank string must be one of the moods, coded INVALID_MOOD
+//
+// Rules other than required skip fields that were left out. Models with rules a tag cannot say,
+// such as one field depending on another, also implement requestValidator.
+
+// FieldError is a rule a request field broke, named as in the JSON body
+type FieldError struct {
+	Field   string    `json:"field"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// ValidationError lists every rule a request broke
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// requestValidator is implemented by request models with rules beyond their validate tags
+type requestValidator interface {
+	Validate() []FieldError
+}
+
+// ValidateRequest checks the validate tags of the fields of req, a struct or a pointer to one,
+// and its Validate method when it has one. It returns a *ValidationError listing every broken rule.
+func ValidateRequest(req any) error {
+	value := reflect.ValueOf(req)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+		name := jsonFieldName(field)
+		for _, rule := range strings.Split(tag, ",") {
+			if code, message := checkFieldRule(value.Field(i), rule); message != "" {
+				fields = append(fields, FieldError{Field: name, Code: code, Message: message})
+				// Later rules would only repeat what is wrong with the field
+				break
+			}
+		}
+	}
+	if validator, ok := req.(requestValidator); ok {
+		fields = append(fields, validator.Validate()...)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// jsonFieldName returns the name a struct field has in JSON bodies
+func jsonFieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// checkFieldRule returns the code of and what is wrong with value under rule, or "" when nothing is
+func checkFieldRule(value reflect.Value, rule string) (ErrorCode, string) {
+	rule, argument, _ := strings.Cut(strings.TrimSpace(rule), "=")
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if rule == "required" {
+				return ErrCodeFieldRequired, "is required"
+			}
+			return "", ""
+		}
+		value = value.Elem()
+	}
+
+	switch rule {
+	case "required":
+		if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") {
+			return ErrCodeFieldRequired, "is required"
+		}
+	case "email":
+		email := strings.TrimSpace(value.String())
+		if address, err := mail.ParseAddress(email); email != "" && (err != nil || address.Address != email) {
+			return ErrCodeFieldEmail, "must be a valid email address"
+		}
+	case "min", "max":
+		limit, err := strconv.Atoi(argument)
+		if err != nil {
+			panic(fmt.Sprintf("validate rule %s needs a number, got %q", rule, argument))
+		}
+		return checkFieldBound(value, rule, limit)
+	case "oneof":
+		allowed := strings.Split(argument, "|")
+		if text := value.String(); strings.TrimSpace(text) != "" && !slices.Contains(allowed, text) {
+			return ErrCodeFieldChoice, "must be one of " + strings.Join(allowed, ", ")
+		}
+	case "mood":
+		if text := value.String(); strings.TrimSpace(text) != "" && !Mood(text).Valid() {
+			return ErrCodeInvalidMood, "must be one of much worse, worse, same, better, much better"
+		}
+	default:
+		panic(fmt.Sprintf("unknown validate rule %q", rule))
+	}
+	return "", ""
+}
+
+// checkFieldBound checks a min or max rule against a string's length in characters, a number's
+// value or a list's length
+func checkFieldBound(value reflect.Value, rule string, limit int) (ErrorCode, string) {
+	var size float64
+	unit := ""
+	tooSmall, tooLarge := ErrCodeFieldTooSmall, ErrCodeFieldTooLarge
+	switch value.Kind() {
+	case reflect.String:
+		if value.String() == "" {
+			return "", ""
+		}
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters"
+		tooSmall, tooLarge = ErrCodeFieldTooShort, ErrCodeFieldTooLong
+	case reflect.Slice, reflect.Map:
+		size, unit = float64(value.Len()), " items"
+		tooSmall, tooLarge = ErrCodeFieldTooShort, ErrCodeFieldTooLong
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		panic(fmt.Sprintf("validate rule %s does not apply to %s", rule, value.Kind()))
+	}
+	if rule == "min" && size < float64(limit) {
+		return tooSmall, "must be at least " + strconv.Itoa(limit) + unit
+	}
+	if rule == "max" && size > float64(limit) {
+		return tooLarge, "must be at most " + strconv.Itoa(limit) + unit
+	}
+	return "", ""
+}
+
+// jsonTypeName describes a Go type as the JSON value a client should have sent
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a " + t.String()
+}
+
+// decodeRequest reads the JSON body of r into req and checks it with ValidateRequest, answering
+// the request itself with the fields at fault and returning false when it is malformed or invalid
+func decodeRequest(w http.ResponseWriter, r *http.Request, endpoint string, req any) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		LogResponse(endpoint, "Invalid request format", err)
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			EncodeValidationError(w, "Invalid request format", []FieldError{{Field: typeErr.Field, Code: ErrCodeFieldType, Message: "must be " + jsonTypeName(typeErr.Type)}})
+			return false
+		}
+		EncodeError(w, "Invalid request format", http.StatusBadRequest)
+		return false
+	}
+
+	if err := ValidateRequest(req); err != nil {
+		LogResponse(endpoint, "Invalid request", err)
+		var invalid *ValidationError
+		errors.As(err, &invalid)
+		EncodeValidationError(w, err.Error(), invalid.Fields)
+		return false
+	}
+	return true
+}
+
+// encodeFieldError answers a request with one field at fault, for rules a handler checks itself
+func encodeFieldError(w http.ResponseWriter, endpoint, field string, code ErrorCode, message string) {
+	LogResponse(endpoint, "Invalid request", errors.New(field+" "+message))
+	EncodeValidationError(w, field+" "+message, []FieldError{{Field: field, Code: code, Message: message}})
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequest(t *testing.T) {
+	description := strings.Repeat("x", 1001)
+	tests := []struct {
+		name       string
+		req        any
+		wantFields []FieldError
+	}{
+		{name: "Valid registration", req: RegisterRequest{Username: "mira", Email: "mira@example.com", Password: "correct horse battery"}},
+		{name: "Registration", req: &RegisterRequest{Username: " ", Email: "Mira <mira@example.com>", Password: "short"}, wantFields: []FieldError{
+			{Field: "username", Code: ErrCodeFieldRequired, Message: "is required"},
+			{Field: "email", Code: ErrCodeFieldEmail, Message: "must be a valid email address"},
+			{Field: "password", Code: ErrCodeFieldTooShort, Message: "must be at least 8 characters"},
+		}},
+		{name: "Only the first broken rule", req: RegisterRequest{Username: "mira", Password: "correct horse battery"}, wantFields: []FieldError{{Field: "email", Code: ErrCodeFieldRequired, Message: "is required"}}},
+		{name: "Unknown mood", req: SaveMoodRequest{AnimationID: "abc", Mood: "ecstatic"}, wantFields: []FieldError{{Field: "mood", Code: ErrCodeInvalidMood, Message: "must be one of much worse, worse, same, better, much better"}}},
+		{name: "Optional email left out", req: UpdateProfileRequest{Username: "mira"}},
+		{name: "Description pointer too long", req: UpdateAnimationRequest{Description: &description}, wantFields: []FieldError{{Field: "description", Code: ErrCodeFieldTooLong, Message: "must be at most 1000 characters"}}},
+		{name: "Negative limit", req: OrganizationMemberRequest{MonthlyLimit: -1}, wantFields: []FieldError{{Field: "monthlyLimit", Code: ErrCodeFieldTooSmall, Message: "must be at least 0"}}},
+		{name: "Validate method", req: AnimationRequest{Description: "waves", PresetID: 3}, wantFields: []FieldError{{Field: "description", Code: ErrCodeConflict, Message: "must be left out when presetId is given"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequest(tt.req)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("ValidateRequest() = %v, want nil", err)
+				}
+				return
+			}
+			invalid, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("ValidateRequest() = %v, want a *ValidationError", err)
+			}
+			if !reflect.DeepEqual(invalid.Fields, tt.wantFields) {
+				t.Errorf("fields = %+v, want %+v", invalid.Fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantOK     bool
+		wantFields []FieldError
+	}{
+		{name: "Valid", body: `{"animationId": "abc", "mood": "better"}`, wantOK: true},
+		{name: "Malformed", body: `{"animationId": `},
+		{name: "Wrong type", body: `{"animationId": 7, "mood": "better"}`, wantFields: []FieldError{{Field: "animationId", Code: ErrCodeFieldType, Message: "must be a string"}}},
+		{name: "Invalid", body: `{"mood": "fine"}`, wantFields: []FieldError{
+			{Field: "animationId", Code: ErrCodeFieldRequired, Message: "is required"},
+			{Field: "mood", Code: ErrCodeInvalidMood, Message: "must be one of much worse, worse, same, better, much better"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/save-mood", bytes.NewBufferString(tt.body))
+			var mood SaveMoodRequest
+			if ok := decodeRequest(rec, req, "/save-mood", &mood); ok != tt.wantOK {
+				t.Fatalf("decodeRequest() = %v, want %v", ok, tt.wantOK)
+			}
+			if tt.wantOK {
+				return
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			var body struct {
+				Error  string       `json:"error"`
+				Fields []FieldError `json:"fields"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding error body: %v", err)
+			}
+			if !reflect.DeepEqual(body.Fields, tt.wantFields) {
+				t.Errorf("fields = %+v, want %+v", body.Fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// recordAnimationVersion adds the animation's current code and p5.js version as its next version, in
+// the transaction that changed them, and returns the new version number. restoredFrom is 0 unless
+// source is VersionRestored.
+func recordAnimationVersion(ctx context.Context, tx *sql.Tx, id, source, createdBy string, restoredFrom int) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO animation_versions (animation_id, version, code_hash, p5_version, source, restored_from, created_by)
+		 SELECT a.id, COALESCE((SELECT MAX(version) FROM animation_versions WHERE animation_id = a.id), 0) + 1,
+			a.code_hash, a.p5_version, $2, NULLIF($3, 0), NULLIF($4, '')
+		 FROM animations a WHERE a.id = $1
+		 RETURNING version`,
+		id, source, restoredFrom, createdBy,
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record animation version: %v", err)
+	}
+	return version, nil
+}
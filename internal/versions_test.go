@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnimationVersions(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+
+	router := NewServer(NewMemoryStore()).Router()
+	owner := registerUser(t, router, "owner")
+	other := registerUser(t, router, "other")
+
+	original := "function setup() {}\nfunction draw() { background(0); }"
+	var saved SaveAnimationResponse
+	if code := doJSON(t, router, http.MethodPost, "/save-animation", owner, SaveAnimationRequest{Code: original, Description: "night"}, &saved); code != http.StatusOK {
+		t.Fatalf("save animation status = %d", code)
+	}
+	base := "/animation/" + saved.ID + "/versions"
+	for _, code := range []string{
+		"function setup() {}\nfunction draw() { background(255); }",
+		"function setup() {}\nfunction draw() { background(255, 0, 0); }",
+	} {
+		if status := doJSON(t, router, http.MethodPatch, "/animation/"+saved.ID, owner, UpdateAnimationRequest{Code: &code}, nil); status != http.StatusOK {
+			t.Fatalf("update status = %d", status)
+		}
+	}
+	// Description changes leave the code, and its versions, alone
+	description := "dusk"
+	doJSON(t, router, http.MethodPatch, "/animation/"+saved.ID, owner, UpdateAnimationRequest{Description: &description}, nil)
+
+	var versions []AnimationVersion
+	if code := doJSON(t, router, http.MethodGet, base, owner, nil, &versions); code != http.StatusOK {
+		t.Fatalf("list status = %d", code)
+	}
+	var got []string
+	for _, version := range versions {
+		got = append(got, version.Source)
+	}
+	if want := []string{VersionEdited, VersionEdited, VersionCreated}; !reflect.DeepEqual(got, want) || !versions[0].Current || versions[0].Version != 3 {
+		t.Fatalf("versions = %+v, want sources %v with version 3 current", versions, want)
+	}
+
+	var first AnimationVersion
+	if code := doJSON(t, router, http.MethodGet, base+"/1", owner, nil, &first); code != http.StatusOK || first.Code != original || first.Current {
+		t.Errorf("version 1 = %+v (status %d), want the original code", first, code)
+	}
+
+	var restored AnimationVersion
+	if code := doJSON(t, router, http.MethodPost, base+"/1/restore", owner, nil, &restored); code != http.StatusOK {
+		t.Fatalf("restore status = %d", code)
+	}
+	if restored.Version != 4 || restored.RestoredFrom == nil || *restored.RestoredFrom != 1 || restored.Source != VersionRestored {
+		t.Errorf("restored = %+v, want version 4 restored from 1", restored)
+	}
+	var animation GetAnimationResponse
+	doJSON(t, router, http.MethodGet, "/animation/"+saved.ID, "", nil, &animation)
+	if animation.Code != original {
+		t.Errorf("code after restore = %q, want the original", animation.Code)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		wantCode int
+	}{
+		{name: "Other user lists", method: http.MethodGet, path: base, token: other, wantCode: http.StatusForbidden},
+		{name: "Other user restores", method: http.MethodPost, path: base + "/2/restore", token: other, wantCode: http.StatusForbidden},
+		{name: "Missing version", method: http.MethodGet, path: base + "/9", token: owner, wantCode: http.StatusNotFound},
+		{name: "Missing animation", method: http.MethodGet, path: "/animation/missing/versions", token: owner, wantCode: http.StatusNotFound},
+		{name: "Anonymous", method: http.MethodGet, path: base, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, nil, nil); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket support. The server speaks just enough of RFC 6455 to push JSON text messages: it
+// answers pings and closes, and refuses fragmented or oversized client messages.
+const (
+	// webSocketGUID is appended to the client's key to prove the server understood the handshake
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// webSocketBearerProtocol is offered as a subprotocol, followed by the client's token, by
+	// browsers, which cannot set an Authorization header on a WebSocket
+	webSocketBearerProtocol = "bearer"
+	webSocketMaxMessage     = 4096
+	webSocketPingInterval   = 30 * time.Second
+	webSocketWriteTimeout   = 10 * time.Second
+)
+
+// WebSocket opcodes
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// wsConn is the server side of a WebSocket connection. Writes may come from several goroutines.
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// isWebSocketUpgrade reports whether r asks to switch to the WebSocket protocol
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && slices.ContainsFunc(
+		strings.Split(r.Header.Get("Connection"), ","),
+		func(option string) bool { return strings.EqualFold(strings.TrimSpace(option), "upgrade") },
+	)
+}
+
+// webSocketProtocols returns the subprotocols a WebSocket client offered, in order
+func webSocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
+}
+
+// WebSocketAuthMiddleware lets browsers authenticate a WebSocket by offering the subprotocols
+// "bearer" and their token, which it turns into an Authorization header. It must run before
+// AuthMiddleware.
+func WebSocketAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if protocols := webSocketProtocols(r); r.Header.Get("Authorization") == "" &&
+			len(protocols) >= 2 && protocols[0] == webSocketBearerProtocol {
+			r.Header.Set("Authorization", "Bearer "+protocols[1])
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateWebSocketHandshake checks the headers a WebSocket handshake must carry
+func validateWebSocketHandshake(r *http.Request) error {
+	if r.Method != http.MethodGet || !isWebSocketUpgrade(r) {
+		return errors.New("WebSocket upgrade required")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return errors.New("only WebSocket version 13 is supported")
+	}
+	if key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key")); err != nil || len(key) != 16 {
+		return errors.New("invalid Sec-WebSocket-Key")
+	}
+	return nil
+}
+
+// webSocketAccept returns the Sec-WebSocket-Accept value for a client's key
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket takes over the connection of a request that passed validateWebSocketHandshake
+// and completes the handshake
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	conn, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n"
+	// A browser drops the connection unless one of the protocols it offered is selected
+	if slices.Contains(webSocketProtocols(r), webSocketBearerProtocol) {
+		response += "Sec-WebSocket-Protocol: " + webSocketBearerProtocol + "\r\n"
+	}
+	// The connection stays open past the server's read timeout, which may still apply to it
+	conn.SetReadDeadline(time.Time{})
+	conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	if _, err := buffered.WriteString(response + "\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+// writeFrame sends one unfragmented frame. Server frames are never masked.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame reads the next frame from the client and returns its opcode and unmasked payload
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	final, opcode := header[0]&0x80 != 0, header[0]&0x0F
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if !final {
+		return 0, nil, errors.New("fragmented messages are not supported")
+	}
+	if !masked {
+		return 0, nil, errors.New("client frames must be masked")
+	}
+	if length > webSocketMaxMessage {
+		return 0, nil, errors.New("message too large")
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, mask); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// serveControlFrames answers the client's pings and close until the connection ends, then closes
+// done. Messages the client sends are ignored.
+func (c *wsConn) serveControlFrames(done chan<- struct{}) {
+	defer close(done)
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsOpPing:
+			if c.writeFrame(wsOpPong, payload) != nil {
+				return
+			}
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
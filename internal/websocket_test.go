@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebSocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func TestWebSocketAccept(t *testing.T) {
+	// The worked example from RFC 6455 section 1.3
+	if got := webSocketAccept(testWebSocketKey); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("webSocketAccept() = %q", got)
+	}
+}
+
+func TestValidateWebSocketHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		wantErr bool
+	}{
+		{name: "Valid", method: http.MethodGet, headers: map[string]string{"Upgrade": "websocket", "Connection": "keep-alive, Upgrade", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": testWebSocketKey}},
+		{name: "Plain request", method: http.MethodGet, wantErr: true},
+		{name: "Old version", method: http.MethodGet, headers: map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": testWebSocketKey}, wantErr: true},
+		{name: "Short key", method: http.MethodGet, headers: map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "c2hvcnQ="}, wantErr: true},
+		{name: "POST", method: http.MethodPost, headers: map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": testWebSocketKey}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/ws", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if err := validateWebSocketHandshake(r); (err != nil) != tt.wantErr {
+				t.Errorf("validateWebSocketHandshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateHub(t *testing.T) {
+	hub := &updateHub{}
+	first, unsubscribeFirst := hub.subscribe("u1")
+	second, unsubscribeSecond := hub.subscribe("u1")
+	other, unsubscribeOther := hub.subscribe("u2")
+	defer unsubscribeSecond()
+	defer unsubscribeOther()
+
+	hub.publish("u1", GenerationUpdate{JobID: "j1", Status: GenerationQueued})
+	for _, updates := range []<-chan GenerationUpdate{first, second} {
+		if update := <-updates; update.JobID != "j1" {
+			t.Errorf("update = %+v, want job j1", update)
+		}
+	}
+	if len(other) != 0 {
+		t.Error("another user's connection received the update")
+	}
+
+	// A full connection is skipped rather than blocking the generation
+	unsubscribeFirst()
+	for i := 0; i < updateBuffer+1; i++ {
+		hub.publish("u1", GenerationUpdate{JobID: "j2", Status: GenerationGenerating})
+	}
+	if len(first) != 0 || len(second) != updateBuffer {
+		t.Errorf("buffered updates = %d, %d, want 0, %d", len(first), len(second), updateBuffer)
+	}
+}
+
+// dialWebSocket opens a WebSocket to the test server, authenticating as browsers do
+func dialWebSocket(t *testing.T, server *httptest.Server, token string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + testWebSocketKey + "\r\n" +
+		"Sec-WebSocket-Protocol: bearer, " + token + "\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(testWebSocketKey) ||
+		resp.Header.Get("Sec-WebSocket-Protocol") != webSocketBearerProtocol {
+		t.Fatalf("handshake = %d %v, want 101 with the accept key and bearer protocol", resp.StatusCode, resp.Header)
+	}
+	return conn, reader
+}
+
+// writeClientFrame sends a masked frame, as clients must
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+}
+
+// readServerFrame reads one unmasked frame from the server
+func readServerFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		io.ReadFull(reader, extended)
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		io.ReadFull(reader, extended)
+		length = binary.BigEndian.Uint64(extended)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("read payload: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func TestGenerationUpdatesOverWebSocket(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_USER_RPS", "0")
+	t.Setenv("PROVIDER_KEY_ENCRYPTION_KEYS", testKey("k1", 7))
+
+	openAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": "function setup() {}\nfunction draw() {}"}}},
+		})
+	}))
+	defer openAI.Close()
+	savedURL := openAIChatURL
+	openAIChatURL = openAI.URL
+	t.Cleanup(func() { openAIChatURL = savedURL })
+
+	app := NewServer(NewMemoryStore())
+	router := app.Router()
+	admin := registerAccount(t, router, "admin")
+	t.Setenv("ADMIN_USER_IDS", admin.User.ID)
+	pro := registerAccount(t, router, "therapist")
+	doJSON(t, router, http.MethodPut, "/admin/users/"+pro.User.ID+"/account-type", admin.Token, SetAccountTypeRequest{AccountType: AccountProfessional}, nil)
+	if code := doJSON(t, router, http.MethodPut, "/me/provider-key", pro.Token, ProviderKeyRequest{Provider: ProviderOpenAI, Key: testOpenAIKey}, nil); code != http.StatusOK {
+		t.Fatalf("store key status = %d", code)
+	}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		token    string
+		headers  map[string]string
+		wantCode int
+	}{
+		{name: "Signed out", headers: map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": testWebSocketKey}, wantCode: http.StatusUnauthorized},
+		{name: "Not an upgrade", token: pro.Token, wantCode: http.StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+		})
+	}
+
+	conn, reader := dialWebSocket(t, server, pro.Token)
+	writeClientFrame(t, conn, wsOpPing, []byte("hi"))
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpPong || string(payload) != "hi" {
+		t.Errorf("reply to ping = %x %q, want a pong echoing it", opcode, payload)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/generate-animation", strings.NewReader(`{"description": "a calm ocean"}`))
+	req.Header.Set("Authorization", "Bearer "+pro.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	resp.Body.Close()
+	jobId := resp.Header.Get(GenerationJobHeader)
+	if resp.StatusCode != http.StatusAccepted || jobId == "" {
+		t.Fatalf("generate status = %d, job = %q", resp.StatusCode, jobId)
+	}
+	if ran, err := app.runNextGenerationJob(context.Background()); !ran || err != nil {
+		t.Fatalf("runNextGenerationJob() = %v, %v", ran, err)
+	}
+
+	var statuses []string
+	var done GenerationUpdate
+	for len(statuses) < 4 {
+		opcode, payload := readServerFrame(t, reader)
+		if opcode != wsOpText {
+			continue
+		}
+		var update GenerationUpdate
+		if err := json.Unmarshal(payload, &update); err != nil || update.JobID != jobId {
+			t.Fatalf("update = %s, %v, want one for job %s", payload, err, jobId)
+		}
+		statuses = append(statuses, update.Status)
+		done = update
+	}
+	if want := []string{GenerationQueued, GenerationGenerating, GenerationSanitizing, GenerationDone}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if !strings.Contains(done.Code, "function draw()") {
+		t.Errorf("done code = %q, want the generated sketch", done.Code)
+	}
+}
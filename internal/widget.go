@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// widgetRotation is how long every widget shows the same animation; windows start on the clock
+	// so that caches expire together
+	widgetRotation = 5 * time.Minute
+	// widgetStaleWhileRevalidate lets a CDN keep serving the previous animation while it fetches the next
+	widgetStaleWhileRevalidate = 60
+	// widgetScriptMaxAge is how long the embed script may be cached; it does not change between releases
+	widgetScriptMaxAge = 24 * 60 * 60
+	// Default per-domain budget used when RATE_LIMIT_WIDGET_DOMAIN_* is not set. Most widget traffic
+	// is answered by the CDN, so a domain going past this is usually busting the cache.
+	defaultWidgetDomainRatePerSecond = 2
+	defaultWidgetDomainBurst         = 30
+)
+
+// widgetMoment remembers the animation widgets are showing in the current rotation window
+type widgetMoment struct {
+	mu    sync.Mutex
+	id    string
+	until time.Time
+}
+
+// widgetFilter keeps widgets to calm animations: screened, never flashing and with little motion
+func widgetFilter() FeedFilter {
+	return FeedFilter{ReducedMotion: true, AvoidFlashing: true, MaxMotionScore: ReducedMotionMaxChange()}
+}
+
+// animationOfTheMoment returns the animation widgets show until the end of the rotation window
+// containing now. A new one is picked when the window ends or the current one is no longer available.
+func (s *Server) animationOfTheMoment(ctx context.Context, now time.Time) (WidgetAnimation, error) {
+	s.widget.mu.Lock()
+	defer s.widget.mu.Unlock()
+
+	until := now.Truncate(widgetRotation).Add(widgetRotation)
+	var animation GetAnimationResponse
+	current := s.widget.id != "" && s.widget.until.Equal(until)
+	if current {
+		var err error
+		animation, err = s.store.GetAnimation(ctx, s.widget.id)
+		current = err == nil
+	}
+	if !current {
+		var err error
+		if animation, err = s.store.GetRandomAnimation(ctx, widgetFilter()); err != nil {
+			return WidgetAnimation{}, err
+		}
+		s.widget.id, s.widget.until = animation.ID, until
+	}
+
+	animation = withDefaultP5Library(ctx, s.store, animation)
+
+	return WidgetAnimation{
+		ID:          animation.ID,
+		Description: animation.Description,
+		Code:        animation.Code,
+		P5URL:       animation.P5URL,
+		P5Integrity: animation.P5Integrity,
+		URL:         PublicURL("/animation/" + animation.ID),
+		ExpiresAt:   until.UTC(),
+	}, nil
+}
+
+// setWidgetHeaders lets any site load a widget response and any shared cache keep it for maxAge seconds
+func setWidgetHeaders(w http.ResponseWriter, maxAge int) {
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(maxAge)+", s-maxage="+strconv.Itoa(maxAge)+
+		", stale-while-revalidate="+strconv.Itoa(widgetStaleWhileRevalidate))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Del("Access-Control-Allow-Credentials")
+}
+
+// widgetDomain returns the host name of the site embedding a widget, from Origin or else Referer
+func widgetDomain(r *http.Request) (string, bool) {
+	for _, header := range []string{"Origin", "Referer"} {
+		if parsed, err := url.Parse(r.Header.Get(header)); err == nil && parsed.Hostname() != "" {
+			return strings.ToLower(parsed.Hostname()), true
+		}
+	}
+	return "", false
+}
+
+// WidgetRateLimitMiddleware limits widget requests by the domain embedding them using
+// RATE_LIMIT_WIDGET_DOMAIN_RPS and RATE_LIMIT_WIDGET_DOMAIN_BURST. Requests that name no site are
+// limited by client IP instead.
+func WidgetRateLimitMiddleware() func(http.Handler) http.Handler {
+	limiter := rateLimiterFromEnv("RATE_LIMIT_WIDGET_DOMAIN", defaultWidgetDomainRatePerSecond, defaultWidgetDomainBurst)
+	return RateLimitMiddleware(limiter, func(r *http.Request) (string, bool) {
+		if domain, ok := widgetDomain(r); ok {
+			return "widget-domain:" + domain, true
+		}
+		return "widget-ip:" + ClientIP(r), true
+	})
+}
+
+// widgetScript is served by GET /widget/random.js. It replaces its own script tag's position with a
+// sandboxed frame playing the animation of the moment, finding the API from its own src so that
+// the same script works behind any host name. data-width and data-height size the frame.
+const widgetScript = `(function () {
+  var script = document.currentScript;
+  if (!script) return;
+  var base = script.src.replace(/\/widget\/random\.js(\?.*)?$/, "");
+  var figure = document.createElement("figure");
+  figure.className = "animate-widget";
+  script.parentNode.insertBefore(figure, script.nextSibling);
+
+  var attribute = function (value) {
+    return String(value).replace(/&/g, "&amp;").replace(/"/g, "&quot;").replace(/</g, "&lt;");
+  };
+  fetch(base + "/widget/random.json").then(function (response) {
+    if (!response.ok) throw new Error("No animation available");
+    return response.json();
+  }).then(function (animation) {
+    var library = "";
+    if (animation.p5Url) {
+      library = '<script src="' + attribute(animation.p5Url) + '"' +
+        (animation.p5Integrity ? ' integrity="' + attribute(animation.p5Integrity) + '" crossorigin="anonymous"' : "") +
+        "></scr" + "ipt>";
+    }
+    var frame = document.createElement("iframe");
+    frame.setAttribute("sandbox", "allow-scripts");
+    frame.width = script.getAttribute("data-width") || "400";
+    frame.height = script.getAttribute("data-height") || "400";
+    frame.title = animation.description;
+    frame.style.border = "0";
+    frame.srcdoc = "<!doctype html><html><head><style>html,body{margin:0;overflow:hidden}</style>" + library +
+      "</head><body><script>" + animation.code.replace(/<\/script/gi, "<\\/script") + "</scr" + "ipt></body></html>";
+
+    var link = document.createElement("a");
+    link.href = animation.url;
+    link.target = "_blank";
+    link.rel = "noopener";
+    link.textContent = animation.description;
+    var caption = document.createElement("figcaption");
+    caption.appendChild(link);
+    figure.appendChild(frame);
+    figure.appendChild(caption);
+  }).catch(function () {
+    figure.remove();
+  });
+})();
+`
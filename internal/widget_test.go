@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWidgetDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		referer string
+		want    string
+		wantOk  bool
+	}{
+		{name: "Origin", origin: "https://Blog.example.com", want: "blog.example.com", wantOk: true},
+		{name: "Referer", referer: "https://blog.example.com:8443/posts/calm?x=1", want: "blog.example.com", wantOk: true},
+		{name: "Origin wins", origin: "https://a.example", referer: "https://b.example/page", want: "a.example", wantOk: true},
+		{name: "Opaque origin", origin: "null", referer: "https://b.example/page", want: "b.example", wantOk: true},
+		{name: "Neither", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/widget/random.json", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			got, ok := widgetDomain(r)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("widgetDomain() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestAnimationOfTheMoment(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	server := NewServer(store)
+	now := time.Date(2026, 5, 1, 12, 1, 0, 0, time.UTC)
+
+	if _, err := server.animationOfTheMoment(ctx, now); err == nil || err.Error() != "no animations found" {
+		t.Fatalf("animationOfTheMoment() on an empty store error = %v", err)
+	}
+
+	for _, description := range []string{"calm", "still", "unchecked"} {
+		id, err := store.SaveAnimation(ctx, "function draw() {}", description, "", "")
+		if err != nil {
+			t.Fatalf("SaveAnimation: %v", err)
+		}
+		if description != "unchecked" {
+			store.SetAnimationPhotosensitivity(ctx, id, PhotosensitivityReport{Status: PhotosensitivitySafe, MotionScore: 0.01})
+		}
+	}
+
+	first, err := server.animationOfTheMoment(ctx, now)
+	if err != nil {
+		t.Fatalf("animationOfTheMoment() error = %v", err)
+	}
+	if first.Description == "unchecked" || !first.ExpiresAt.Equal(time.Date(2026, 5, 1, 12, 5, 0, 0, time.UTC)) {
+		t.Errorf("animation = %+v, want a screened animation until 12:05", first)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := server.animationOfTheMoment(ctx, now.Add(3*time.Minute)); again.ID != first.ID {
+			t.Fatalf("animation changed within the window: %s, want %s", again.ID, first.ID)
+		}
+	}
+
+	// A removed animation is replaced without waiting for the window to end
+	store.DeleteAnimation(ctx, first.ID, "", true)
+	replaced, err := server.animationOfTheMoment(ctx, now)
+	if err != nil || replaced.ID == first.ID || replaced.Description == "unchecked" {
+		t.Errorf("animation after removal = %+v, %v, want the other screened animation", replaced, err)
+	}
+}
+
+func TestWidgetHandlers(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", strings.Repeat("s", minJWTSecretLength))
+	t.Setenv("RATE_LIMIT_IP_RPS", "0")
+	t.Setenv("RATE_LIMIT_WIDGET_DOMAIN_RPS", "0.001")
+	t.Setenv("RATE_LIMIT_WIDGET_DOMAIN_BURST", "3")
+	t.Setenv("ALLOWED_ORIGINS", "https://app.example")
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	router := NewServer(store).Router()
+	id, err := store.SaveAnimation(ctx, "function draw() {}", "calm", "", "")
+	if err != nil {
+		t.Fatalf("SaveAnimation: %v", err)
+	}
+	store.SetAnimationPhotosensitivity(ctx, id, PhotosensitivityReport{Status: PhotosensitivitySafe})
+
+	get := func(path, origin, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", origin)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/widget/random.json", "https://blog.example", "")
+	var animation WidgetAnimation
+	if err := json.NewDecoder(rec.Body).Decode(&animation); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("widget status = %d, decode error %v", rec.Code, err)
+	}
+	if animation.ID != id || !strings.HasSuffix(animation.URL, "/animation/"+id) {
+		t.Errorf("animation = %+v, want %s", animation, id)
+	}
+	if cacheControl := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cacheControl, "public, max-age=") || !strings.Contains(cacheControl, "s-maxage=") {
+		t.Errorf("Cache-Control = %q, want a public shared-cache policy", cacheControl)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("CORS headers = %v, want any origin without credentials", rec.Header())
+	}
+
+	if rec := get("/widget/random.json", "https://blog.example", rec.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	rec = get("/widget/random.js", "https://blog.example", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/javascript") ||
+		!strings.Contains(rec.Body.String(), "/widget/random.json") {
+		t.Errorf("script status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// The blog has spent its budget; other sites have their own
+	if rec := get("/widget/random.json", "https://blog.example", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("over-budget status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := get("/widget/random.json", "https://other.example", ""); rec.Code != http.StatusOK {
+		t.Errorf("other site status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}